@@ -0,0 +1,172 @@
+// Package auth identifies the clients of the RPC servers from the certificates
+// they present over mutual TLS, and restricts the admin and write RPCs to the
+// clients allowed to make them.
+//
+// A client's identity is the common name of its verified certificate. Each
+// identity can be mapped to a principal, so that several certificates, such as
+// those of the replicas of a personality, share the same quota and access.
+// Identities without a mapping are their own principal.
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// adminService is the prefix of the methods of the TrillianAdmin service.
+const adminService = "/trillian.TrillianAdmin/"
+
+// WriteMethods holds the full names of the log and map RPCs that change trees.
+var WriteMethods = map[string]bool{
+	"/trillian.TrillianLog/QueueLeaves":           true,
+	"/trillian.TrillianLog/AddSequencedLeaves":    true,
+	"/trillian.TrillianLog/AddLogRootCosignature": true,
+	"/trillian.TrillianLog/InitLog":               true,
+	"/trillian.TrillianMap/SetLeaves":             true,
+	"/trillian.TrillianMap/SetLeavesStream":       true,
+	"/trillian.TrillianMap/PublishMapRevision":    true,
+	"/trillian.TrillianMap/AbandonMapRevision":    true,
+	"/trillian.TrillianMap/InitMap":               true,
+	"/trillian.TrillianMap/TagMapRevision":        true,
+}
+
+// PeerIdentity returns the identity of the client of the RPC in ctx, which is
+// the common name of its verified certificate, or empty if it has none.
+func PeerIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return info.State.VerifiedChains[0][0].Subject.CommonName
+}
+
+// ForwardedUserKey is the metadata key under which a frontend that makes
+// requests on behalf of its own clients, such as the HTTP gateway, names the
+// client a request is for.
+const ForwardedUserKey = "x-trillian-forwarded-user"
+
+// ForwardedUser returns the user named under ForwardedUserKey in the metadata
+// of the RPC in ctx, or empty if there isn't exactly one. Any client can set
+// it, so it must only be trusted from principals known to forward users.
+func ForwardedUser(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md[ForwardedUserKey]) != 1 {
+		return ""
+	}
+	return md[ForwardedUserKey][0]
+}
+
+// Principals maps client identities to the principals they act as.
+type Principals map[string]string
+
+// ParsePrincipals parses a comma separated list of identity=principal pairs.
+func ParsePrincipals(s string) (Principals, error) {
+	p := make(Principals)
+	if len(s) == 0 {
+		return p, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return nil, fmt.Errorf("principal %q isn't of the form identity=principal", pair)
+		}
+		if _, ok := p[parts[0]]; ok {
+			return nil, fmt.Errorf("identity %q is mapped more than once", parts[0])
+		}
+		p[parts[0]] = parts[1]
+	}
+	return p, nil
+}
+
+// Principal returns the principal of the client of the RPC in ctx, or empty if
+// the client has no identity.
+func (p Principals) Principal(ctx context.Context) string {
+	id := PeerIdentity(ctx)
+	if principal, ok := p[id]; ok {
+		return principal
+	}
+	return id
+}
+
+// ParseList parses a comma separated list of principals into a set, which is
+// nil if s is empty.
+func ParseList(s string) map[string]bool {
+	if len(s) == 0 {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		set[name] = true
+	}
+	return set
+}
+
+// Policy restricts the admin and write RPCs to the principals allowed to make
+// them. Other RPCs are allowed for every client.
+type Policy struct {
+	// Principals maps client identities to principals
+	Principals Principals
+	// Admins are the principals allowed to call the TrillianAdmin service. If
+	// nil, admin RPCs aren't restricted
+	Admins map[string]bool
+	// Writers are the principals allowed to call the WriteMethods. If nil,
+	// write RPCs aren't restricted. Admins aren't allowed to write unless
+	// they're writers too
+	Writers map[string]bool
+}
+
+// check returns an error if the client of the RPC in ctx isn't allowed to call
+// method.
+func (p *Policy) check(ctx context.Context, method string) error {
+	var allowed map[string]bool
+	switch {
+	case strings.HasPrefix(method, adminService):
+		allowed = p.Admins
+	case WriteMethods[method]:
+		allowed = p.Writers
+	}
+	if allowed == nil {
+		return nil
+	}
+	principal := p.Principals.Principal(ctx)
+	if len(principal) == 0 {
+		return grpc.Errorf(codes.Unauthenticated, "%s requires a client certificate", method)
+	}
+	if !allowed[principal] {
+		return grpc.Errorf(codes.PermissionDenied, "%s is not allowed to call %s", principal, method)
+	}
+	return nil
+}
+
+// UnaryInterceptor returns a UnaryServerInterceptor which rejects requests that
+// the policy doesn't allow.
+func (p *Policy) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := p.check(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor returns a StreamServerInterceptor which rejects streams
+// that the policy doesn't allow.
+func (p *Policy) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := p.check(stream.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
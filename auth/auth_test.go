@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// clientContext returns the context of an RPC from a client with a verified
+// certificate of the common name cn, or without a certificate if cn is empty.
+func clientContext(cn string) context.Context {
+	p := &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}}
+	if len(cn) > 0 {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+		p.AuthInfo = credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+	}
+	return peer.NewContext(context.Background(), p)
+}
+
+func TestPrincipal(t *testing.T) {
+	principals, err := ParsePrincipals("ct-1.example.com=ct,ct-2.example.com=ct")
+	if err != nil {
+		t.Fatalf("ParsePrincipals() = %v", err)
+	}
+	for _, test := range []struct {
+		ctx  context.Context
+		want string
+	}{
+		{ctx: context.Background(), want: ""},
+		{ctx: clientContext(""), want: ""},
+		{ctx: clientContext("ct-2.example.com"), want: "ct"},
+		{ctx: clientContext("monitor.example.com"), want: "monitor.example.com"},
+	} {
+		if got := principals.Principal(test.ctx); got != test.want {
+			t.Errorf("Principal(%v) = %q, want %q", test.ctx, got, test.want)
+		}
+	}
+}
+
+func TestParsePrincipals(t *testing.T) {
+	if p, err := ParsePrincipals(""); err != nil || len(p) != 0 {
+		t.Errorf("ParsePrincipals(\"\") = %v, %v, want no principals", p, err)
+	}
+	if p, err := ParsePrincipals("a=b,c=b"); err != nil || !reflect.DeepEqual(p, Principals{"a": "b", "c": "b"}) {
+		t.Errorf("ParsePrincipals(a=b,c=b) = %v, %v", p, err)
+	}
+	for _, s := range []string{"a", "a=", "=b", "a=b,a=c", "a=b,"} {
+		if _, err := ParsePrincipals(s); err == nil {
+			t.Errorf("ParsePrincipals(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy := &Policy{
+		Principals: Principals{"ct-1.example.com": "ct"},
+		Admins:     ParseList("ops"),
+		Writers:    ParseList("ct,ops"),
+	}
+	interceptor := policy.UnaryInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+
+	for _, test := range []struct {
+		client string
+		method string
+		want   codes.Code
+	}{
+		{client: "", method: "/trillian.TrillianLog/GetLatestSignedLogRoot", want: codes.OK},
+		{client: "", method: "/trillian.TrillianLog/QueueLeaves", want: codes.Unauthenticated},
+		{client: "", method: "/trillian.TrillianAdmin/CreateTree", want: codes.Unauthenticated},
+		{client: "ct-1.example.com", method: "/trillian.TrillianLog/QueueLeaves", want: codes.OK},
+		{client: "ct-1.example.com", method: "/trillian.TrillianAdmin/CreateTree", want: codes.PermissionDenied},
+		{client: "ct", method: "/trillian.TrillianLog/QueueLeaves", want: codes.OK},
+		{client: "monitor", method: "/trillian.TrillianMap/SetLeaves", want: codes.PermissionDenied},
+		{client: "monitor", method: "/trillian.TrillianMap/GetLeaves", want: codes.OK},
+		{client: "ops", method: "/trillian.TrillianAdmin/DeleteTree", want: codes.OK},
+	} {
+		_, err := interceptor(clientContext(test.client), nil, &grpc.UnaryServerInfo{FullMethod: test.method}, handler)
+		if got := grpc.Code(err); got != test.want {
+			t.Errorf("%s calling %s: got code %v, want %v", test.client, test.method, got, test.want)
+		}
+	}
+
+	// Writes aren't restricted without a list of writers
+	policy.Writers = nil
+	if _, err := interceptor(clientContext(""), nil, &grpc.UnaryServerInfo{FullMethod: "/trillian.TrillianLog/QueueLeaves"}, handler); err != nil {
+		t.Errorf("Unrestricted write failed: %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+// Package authz decides which operations each subject may perform on each tree,
+// so that the personalities sharing a multi-tenant deployment are restricted to
+// their own trees. Every RPC is checked by an Authorizer, given the principal
+// making it, the tree it's for and whether it reads, writes or administers the
+// tree.
+//
+// Deployments can supply their own Authorizer, such as one backed by an IAM
+// service, by registering a provider in an init function of a package linked
+// into the servers, and selecting it by name with the authz_provider flag.
+package authz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/quota"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// adminService is the prefix of the methods of the TrillianAdmin service.
+const adminService = "/trillian.TrillianAdmin/"
+
+// Operation is the kind of access to a tree that an RPC needs.
+type Operation int
+
+// Operations on trees. Admin operations aren't treated as reads or writes, and
+// their tree is zero if they're not for one tree, such as listing trees.
+const (
+	Read Operation = iota
+	Write
+	Admin
+)
+
+var operationNames = map[Operation]string{Read: "read", Write: "write", Admin: "admin"}
+
+func (o Operation) String() string {
+	if name, ok := operationNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("Operation(%d)", int(o))
+}
+
+// ParseOperation returns the Operation named s, which is one of "read", "write"
+// or "admin".
+func ParseOperation(s string) (Operation, error) {
+	for op, name := range operationNames {
+		if name == s {
+			return op, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown operation %q", s)
+}
+
+// Authorizer decides whether RPCs are allowed.
+type Authorizer interface {
+	// Authorize returns nil if subject may perform op on the tree treeID, or
+	// else an error saying why not. Subject is empty for clients without an
+	// identity. Errors with a gRPC code are returned to the client as they
+	// are, others with PermissionDenied.
+	Authorize(ctx context.Context, subject string, treeID int64, op Operation) error
+}
+
+// AuthorizerFunc adapts a function to an Authorizer.
+type AuthorizerFunc func(ctx context.Context, subject string, treeID int64, op Operation) error
+
+// Authorize calls f.
+func (f AuthorizerFunc) Authorize(ctx context.Context, subject string, treeID int64, op Operation) error {
+	return f(ctx, subject, treeID, op)
+}
+
+// ProviderFunc creates an Authorizer from a provider specific configuration,
+// such as the name of a file.
+type ProviderFunc func(config string) (Authorizer, error)
+
+var (
+	providersMu sync.Mutex
+	providers   = map[string]ProviderFunc{}
+)
+
+// RegisterProvider makes the provider f available as name to New. It panics if
+// name is already registered.
+func RegisterProvider(name string, f ProviderFunc) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if _, ok := providers[name]; ok {
+		panic(fmt.Sprintf("authz provider %q registered twice", name))
+	}
+	providers[name] = f
+}
+
+// Providers returns the names of the registered providers, in order.
+func Providers() []string {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	var names []string
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates an Authorizer with the registered provider name.
+func New(name, config string) (Authorizer, error) {
+	providersMu.Lock()
+	f, ok := providers[name]
+	providersMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown authz provider %q, registered providers are: %s", name, strings.Join(Providers(), ", "))
+	}
+	return f(config)
+}
+
+// RequestTree returns the tree that the request req, made to the method
+// fullMethod, is for and the operation it performs on it. If req isn't a known
+// request ok is false, and it must be denied, as what it does is unknown.
+func RequestTree(fullMethod string, req interface{}) (treeID int64, op Operation, ok bool) {
+	if strings.HasPrefix(fullMethod, adminService) {
+		treeID, ok := adminRequestTree(req)
+		return treeID, Admin, ok
+	}
+	kind, treeID, ok := quota.RequestTree(req)
+	if kind == trillian.QuotaKind_WRITE {
+		return treeID, Write, ok
+	}
+	return treeID, Read, ok
+}
+
+// adminRequestTree returns the tree an admin request is for, or zero if it's
+// not for one tree. If req isn't an admin request ok is false.
+func adminRequestTree(req interface{}) (treeID int64, ok bool) {
+	switch req := req.(type) {
+	case *trillian.ListTreesRequest, *trillian.ListQuotaLimitsRequest:
+		return 0, true
+	case *trillian.CreateTreeRequest:
+		if req.Tree != nil {
+			return req.Tree.TreeId, true
+		}
+		return 0, true
+	case *trillian.GetTreeRequest:
+		return req.TreeId, true
+	case *trillian.UpdateTreeRequest:
+		return req.TreeId, true
+	case *trillian.DeleteTreeRequest:
+		return req.TreeId, true
+	case *trillian.UndeleteTreeRequest:
+		return req.TreeId, true
+	case *trillian.SetQuotaLimitRequest:
+		if req.Limit != nil {
+			return req.Limit.TreeId, true
+		}
+		return 0, true
+	case *trillian.DeleteQuotaLimitRequest:
+		return req.TreeId, true
+	}
+	return 0, false
+}
+
+// SubjectFunc returns the subject making the RPC in ctx.
+type SubjectFunc func(ctx context.Context) string
+
+// authorize checks that the subject of ctx may perform op on the tree treeID,
+// for a request to fullMethod.
+func authorize(ctx context.Context, a Authorizer, subject SubjectFunc, fullMethod string, treeID int64, op Operation) error {
+	err := a.Authorize(ctx, subject(ctx), treeID, op)
+	if err == nil || grpc.Code(err) != codes.Unknown {
+		return err
+	}
+	return grpc.Errorf(codes.PermissionDenied, "%s denied: %v", fullMethod, err)
+}
+
+// unknownRequest returns the error denying a request to fullMethod that
+// RequestTree doesn't know.
+func unknownRequest(fullMethod string, req interface{}) error {
+	return grpc.Errorf(codes.PermissionDenied, "%s denied: unknown request %T", fullMethod, req)
+}
+
+// UnaryInterceptor returns a UnaryServerInterceptor which rejects requests that
+// a doesn't allow the subject returned by subject to make.
+func UnaryInterceptor(a Authorizer, subject SubjectFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		treeID, op, ok := RequestTree(info.FullMethod, req)
+		if !ok {
+			return nil, unknownRequest(info.FullMethod, req)
+		}
+		if err := authorize(ctx, a, subject, info.FullMethod, treeID, op); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor returns a StreamServerInterceptor which checks each message
+// received on a stream as if it were a separate request, as the tree is only
+// known once a message has been received. Messages that don't set their tree
+// are for the tree of the first message.
+func StreamInterceptor(a Authorizer, subject SubjectFunc) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &authorizingStream{ServerStream: stream, authorizer: a, subject: subject, method: info.FullMethod})
+	}
+}
+
+// authorizingStream checks each message as it's received.
+type authorizingStream struct {
+	grpc.ServerStream
+	authorizer Authorizer
+	subject    SubjectFunc
+	method     string
+	// treeID is the tree of the first message, zero until it's received
+	treeID int64
+}
+
+func (s *authorizingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	treeID, op, ok := RequestTree(s.method, m)
+	if !ok {
+		return unknownRequest(s.method, m)
+	}
+	if treeID == 0 {
+		treeID = s.treeID
+	} else if s.treeID == 0 {
+		s.treeID = treeID
+	}
+	return authorize(s.Context(), s.authorizer, s.subject, s.method, treeID, op)
+}
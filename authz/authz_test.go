@@ -0,0 +1,176 @@
+package authz
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// check is an authorization checked by an Authorizer.
+type check struct {
+	subject string
+	treeID  int64
+	op      Operation
+}
+
+// recorder returns an Authorizer that records its checks in checks, allowing
+// everything but writes to tree 13.
+func recorder(checks *[]check) Authorizer {
+	return AuthorizerFunc(func(ctx context.Context, subject string, treeID int64, op Operation) error {
+		*checks = append(*checks, check{subject, treeID, op})
+		if treeID == 13 && op == Write {
+			return errors.New("tree 13 is read only")
+		}
+		return nil
+	})
+}
+
+func subject(ctx context.Context) string { return "alice" }
+
+func TestRequestTree(t *testing.T) {
+	for _, test := range []struct {
+		method string
+		req    interface{}
+		tree   int64
+		op     Operation
+	}{
+		{method: "/trillian.TrillianLog/QueueLeaves", req: &trillian.QueueLeavesRequest{LogId: 1}, tree: 1, op: Write},
+		{method: "/trillian.TrillianLog/GetLeavesByIndex", req: &trillian.GetLeavesByIndexRequest{LogId: 2}, tree: 2, op: Read},
+		{method: "/trillian.TrillianMap/SetLeaves", req: &trillian.SetMapLeavesRequest{MapId: 3}, tree: 3, op: Write},
+		{method: "/trillian.TrillianMap/ListMapLeaves", req: &trillian.ListMapLeavesRequest{MapId: 4}, tree: 4, op: Read},
+		{method: "/trillian.TrillianAdmin/GetTree", req: &trillian.GetTreeRequest{TreeId: 5}, tree: 5, op: Admin},
+		{method: "/trillian.TrillianAdmin/CreateTree", req: &trillian.CreateTreeRequest{Tree: &trillian.Tree{TreeId: 6}}, tree: 6, op: Admin},
+		{method: "/trillian.TrillianAdmin/CreateTree", req: &trillian.CreateTreeRequest{}, tree: 0, op: Admin},
+		{method: "/trillian.TrillianAdmin/ListTrees", req: &trillian.ListTreesRequest{}, tree: 0, op: Admin},
+	} {
+		if tree, op, ok := RequestTree(test.method, test.req); tree != test.tree || op != test.op || !ok {
+			t.Errorf("RequestTree(%s) = %d, %v, %v, want %d, %v, true", test.method, tree, op, ok, test.tree, test.op)
+		}
+	}
+
+	// Requests that aren't known fail closed
+	for _, test := range []struct {
+		method string
+		req    interface{}
+	}{
+		{method: "/trillian.TrillianLog/Unknown", req: &trillian.ListTreesRequest{}},
+		{method: "/trillian.TrillianAdmin/Unknown", req: &trillian.QueueLeavesRequest{LogId: 1}},
+		{method: "/trillian.TrillianWitness/AddCheckpoint", req: &trillian.AddCheckpointRequest{LogId: 1}},
+	} {
+		if _, _, ok := RequestTree(test.method, test.req); ok {
+			t.Errorf("RequestTree(%s, %T) = _, _, true, want false", test.method, test.req)
+		}
+	}
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	var checks []check
+	interceptor := UnaryInterceptor(recorder(&checks), subject)
+	handled := 0
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		handled++
+		return nil, nil
+	}
+
+	if _, err := interceptor(context.Background(), &trillian.QueueLeavesRequest{LogId: 12}, &grpc.UnaryServerInfo{FullMethod: "/trillian.TrillianLog/QueueLeaves"}, handler); err != nil {
+		t.Errorf("Allowed request failed: %v", err)
+	}
+	_, err := interceptor(context.Background(), &trillian.QueueLeavesRequest{LogId: 13}, &grpc.UnaryServerInfo{FullMethod: "/trillian.TrillianLog/QueueLeaves"}, handler)
+	if got, want := grpc.Code(err), codes.PermissionDenied; got != want {
+		t.Errorf("Denied request got code %v, want %v: %v", got, want, err)
+	}
+	if handled != 1 {
+		t.Errorf("Handled %d requests, want 1", handled)
+	}
+	if want := []check{{"alice", 12, Write}, {"alice", 13, Write}}; len(checks) != 2 || checks[0] != want[0] || checks[1] != want[1] {
+		t.Errorf("Checked %v, want %v", checks, want)
+	}
+
+	// Unknown requests are denied without asking the authorizer
+	handled, checks = 0, nil
+	_, err = interceptor(context.Background(), &trillian.AddCheckpointRequest{LogId: 12}, &grpc.UnaryServerInfo{FullMethod: "/trillian.TrillianWitness/AddCheckpoint"}, handler)
+	if got, want := grpc.Code(err), codes.PermissionDenied; got != want {
+		t.Errorf("Unknown request got code %v, want %v: %v", got, want, err)
+	}
+	if handled != 0 || len(checks) != 0 {
+		t.Errorf("Unknown request handled %d times and checked %v, want neither", handled, checks)
+	}
+
+	// Errors with a code are returned as they are
+	unauthenticated := AuthorizerFunc(func(ctx context.Context, subject string, treeID int64, op Operation) error {
+		return grpc.Errorf(codes.Unauthenticated, "who are you")
+	})
+	_, err = UnaryInterceptor(unauthenticated, subject)(context.Background(), &trillian.GetTreeRequest{}, &grpc.UnaryServerInfo{FullMethod: "/trillian.TrillianAdmin/GetTree"}, handler)
+	if got, want := grpc.Code(err), codes.Unauthenticated; got != want {
+		t.Errorf("Unauthenticated request got code %v, want %v", got, want)
+	}
+}
+
+// fakeStream is a ServerStream receiving msgs.
+type fakeStream struct {
+	msgs []*trillian.SetMapLeavesRequest
+}
+
+func (s *fakeStream) SetHeader(metadata.MD) error  { return nil }
+func (s *fakeStream) SendHeader(metadata.MD) error { return nil }
+func (s *fakeStream) SetTrailer(metadata.MD)       {}
+func (s *fakeStream) Context() context.Context     { return context.Background() }
+func (s *fakeStream) SendMsg(m interface{}) error  { return nil }
+
+func (s *fakeStream) RecvMsg(m interface{}) error {
+	if len(s.msgs) == 0 {
+		return io.EOF
+	}
+	*m.(*trillian.SetMapLeavesRequest) = *s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return nil
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	var checks []check
+	interceptor := StreamInterceptor(recorder(&checks), subject)
+	info := &grpc.StreamServerInfo{FullMethod: "/trillian.TrillianMap/SetLeavesStream"}
+	// Reads messages until the stream ends or fails
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		for {
+			if err := stream.RecvMsg(&trillian.SetMapLeavesRequest{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Later messages without a map ID are for the first message's map
+	stream := &fakeStream{msgs: []*trillian.SetMapLeavesRequest{{MapId: 12}, {}}}
+	if err := interceptor(nil, stream, info, handler); err != io.EOF {
+		t.Errorf("Allowed stream = %v, want %v", err, io.EOF)
+	}
+	if want := []check{{"alice", 12, Write}, {"alice", 12, Write}}; len(checks) != 2 || checks[0] != want[0] || checks[1] != want[1] {
+		t.Errorf("Checked %v, want %v", checks, want)
+	}
+
+	stream = &fakeStream{msgs: []*trillian.SetMapLeavesRequest{{MapId: 13}, {}}}
+	if err := interceptor(nil, stream, info, handler); grpc.Code(err) != codes.PermissionDenied {
+		t.Errorf("Denied stream = %v, want code %v", err, codes.PermissionDenied)
+	}
+}
+
+func TestProviders(t *testing.T) {
+	if _, err := New("unknown", ""); err == nil {
+		t.Error("New() of an unknown provider succeeded")
+	}
+	RegisterProvider("test", func(config string) (Authorizer, error) {
+		return AuthorizerFunc(func(ctx context.Context, subject string, treeID int64, op Operation) error { return nil }), nil
+	})
+	if _, err := New("test", ""); err != nil {
+		t.Errorf("New() of a registered provider failed: %v", err)
+	}
+	if got := Providers(); len(got) != 2 || got[0] != "static" || got[1] != "test" {
+		t.Errorf("Providers() = %v, want [static test]", got)
+	}
+}
@@ -0,0 +1,142 @@
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// AnySubject matches every subject in a Rule, including clients without an
+// identity.
+const AnySubject = "*"
+
+func init() {
+	RegisterProvider("static", LoadStaticAuthorizer)
+}
+
+// Rule allows subjects to perform operations on trees.
+type Rule struct {
+	// Subjects are the principals the rule applies to, or AnySubject
+	Subjects []string
+	// Trees are the IDs of the trees the rule applies to, or empty for all
+	// trees, including operations that aren't for one tree
+	Trees []int64
+	// Operations are the operations allowed
+	Operations []Operation
+}
+
+// StaticAuthorizer allows the operations granted by a fixed list of rules, and
+// denies everything else.
+type StaticAuthorizer struct {
+	rules []Rule
+}
+
+// NewStaticAuthorizer creates a StaticAuthorizer allowing the operations given
+// by rules.
+func NewStaticAuthorizer(rules []Rule) (*StaticAuthorizer, error) {
+	for i, r := range rules {
+		if len(r.Subjects) == 0 || len(r.Operations) == 0 {
+			return nil, fmt.Errorf("rule %d must have subjects and operations", i)
+		}
+	}
+	return &StaticAuthorizer{rules: rules}, nil
+}
+
+// staticConfig is the file format read by LoadStaticAuthorizer.
+type staticConfig struct {
+	Rules []struct {
+		Subjects   []string `json:"subjects"`
+		Trees      []int64  `json:"trees"`
+		Operations []string `json:"operations"`
+	} `json:"rules"`
+}
+
+// LoadStaticAuthorizer creates a StaticAuthorizer from the rules in the JSON
+// file path, for example:
+//
+//	{"rules": [
+//	  {"subjects": ["ct"], "trees": [1, 2], "operations": ["read", "write"]},
+//	  {"subjects": ["ops"], "operations": ["admin"]},
+//	  {"subjects": ["*"], "operations": ["read"]}
+//	]}
+//
+// It's registered as the "static" provider.
+func LoadStaticAuthorizer(path string) (Authorizer, error) {
+	if len(path) == 0 {
+		return nil, errors.New("no rules file given")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config staticConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	var rules []Rule
+	for _, r := range config.Rules {
+		rule := Rule{Subjects: r.Subjects, Trees: r.Trees}
+		for _, name := range r.Operations {
+			op, err := ParseOperation(name)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			rule.Operations = append(rule.Operations, op)
+		}
+		rules = append(rules, rule)
+	}
+	return NewStaticAuthorizer(rules)
+}
+
+func (r Rule) matches(subject string, treeID int64, op Operation) bool {
+	return matchSubject(r.Subjects, subject) && matchTree(r.Trees, treeID) && matchOperation(r.Operations, op)
+}
+
+func matchSubject(subjects []string, subject string) bool {
+	for _, s := range subjects {
+		if s == AnySubject || (s == subject && len(subject) > 0) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchTree(trees []int64, treeID int64) bool {
+	if len(trees) == 0 {
+		return true
+	}
+	for _, t := range trees {
+		if t == treeID {
+			return true
+		}
+	}
+	return false
+}
+
+func matchOperation(ops []Operation, op Operation) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize allows op if any of the rules allows it. Anonymous clients that
+// aren't allowed are refused with Unauthenticated.
+func (a *StaticAuthorizer) Authorize(ctx context.Context, subject string, treeID int64, op Operation) error {
+	for _, r := range a.rules {
+		if r.matches(subject, treeID, op) {
+			return nil
+		}
+	}
+	if len(subject) == 0 {
+		return grpc.Errorf(codes.Unauthenticated, "anonymous clients may not %s tree %d", op, treeID)
+	}
+	return fmt.Errorf("%s may not %s tree %d", subject, op, treeID)
+}
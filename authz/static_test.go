@@ -0,0 +1,82 @@
+package authz
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestStaticAuthorizer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authz")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rules.json")
+	rules := `{"rules": [
+		{"subjects": ["ct"], "trees": [1, 2], "operations": ["read", "write"]},
+		{"subjects": ["ops"], "operations": ["admin"]},
+		{"subjects": ["*"], "trees": [2], "operations": ["read"]}
+	]}`
+	if err := ioutil.WriteFile(path, []byte(rules), 0600); err != nil {
+		t.Fatalf("Failed to write rules: %v", err)
+	}
+
+	a, err := New("static", path)
+	if err != nil {
+		t.Fatalf("New(static) = %v", err)
+	}
+	for _, test := range []struct {
+		subject string
+		treeID  int64
+		op      Operation
+		want    codes.Code
+	}{
+		{subject: "ct", treeID: 1, op: Write, want: codes.OK},
+		{subject: "ct", treeID: 2, op: Read, want: codes.OK},
+		{subject: "ct", treeID: 3, op: Read, want: codes.Unknown},
+		{subject: "ct", treeID: 1, op: Admin, want: codes.Unknown},
+		{subject: "ops", treeID: 0, op: Admin, want: codes.OK},
+		{subject: "ops", treeID: 7, op: Admin, want: codes.OK},
+		{subject: "ops", treeID: 1, op: Write, want: codes.Unknown},
+		{subject: "monitor", treeID: 2, op: Read, want: codes.OK},
+		{subject: "", treeID: 2, op: Read, want: codes.OK},
+		{subject: "", treeID: 1, op: Read, want: codes.Unauthenticated},
+	} {
+		err := a.Authorize(context.Background(), test.subject, test.treeID, test.op)
+		if got := grpc.Code(err); got != test.want {
+			t.Errorf("Authorize(%q, %d, %v) = %v, want code %v", test.subject, test.treeID, test.op, err, test.want)
+		}
+	}
+}
+
+func TestLoadStaticAuthorizerErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authz")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, rules := range []string{
+		`not json`,
+		`{"rules": [{"subjects": ["ct"], "operations": ["delete"]}]}`,
+		`{"rules": [{"subjects": ["ct"]}]}`,
+		`{"rules": [{"operations": ["read"]}]}`,
+	} {
+		path := filepath.Join(dir, "rules.json")
+		if err := ioutil.WriteFile(path, []byte(rules), 0600); err != nil {
+			t.Fatalf("Failed to write rules: %v", err)
+		}
+		if _, err := LoadStaticAuthorizer(path); err == nil {
+			t.Errorf("LoadStaticAuthorizer(%s) succeeded, want an error", rules)
+		}
+	}
+	if _, err := LoadStaticAuthorizer(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("LoadStaticAuthorizer() of a missing file succeeded")
+	}
+}
@@ -0,0 +1,317 @@
+// Package checkpoint converts signed log roots to and from checkpoints, the
+// signed note text format used by other transparency logs and their tools:
+//
+//	<origin>
+//	<tree size>
+//	<base64 root hash>
+//	<timestamp nanos>
+//
+//	— <origin> <base64 key ID and signature>
+//	— <witness ID> <base64 key hash and cosignature>
+//
+// The origin names the log. The timestamp is an extension line, so it's
+// covered by the log's signature. The lines up to the blank line are the note's
+// text, which the log signs as a signed note: its signature line holds the
+// 4 byte ID of its key followed by the signature of the text, and is checked
+// with Open.
+//
+// Witness cosignatures follow the log's signature. They are of the root's
+// fields, as made by crypto.TrillianSigner, rather than of the note text, so
+// each holds the 4 byte hash of the witness ID followed by the marshaled
+// DigitallySigned, and is checked with witness.VerifyCosignature. Note
+// verifiers which don't know these keys skip them, as they do any signature by
+// an unknown key.
+package checkpoint
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+)
+
+// signaturePrefix starts each signature line.
+const signaturePrefix = "— "
+
+// keyHashSize is the length of the key ID or name hash prefixed to signatures.
+const keyHashSize = 4
+
+// Signature types of note keys, which are part of their key IDs. Ed25519 keys
+// are those of the Go note package, ECDSA keys sign the SHA-256 digest of the
+// note text.
+const (
+	algEd25519 byte = 0x01
+	algECDSA   byte = 0x02
+)
+
+// Origin returns the origin used in checkpoints of the log with tree ID logID.
+func Origin(logID int64) string {
+	return fmt.Sprintf("trillian/log/%d", logID)
+}
+
+// ValidName returns whether name can name a signer in a checkpoint, which is a
+// non-empty UTF-8 name without spaces or plus signs.
+func ValidName(name string) bool {
+	return len(name) > 0 && utf8.ValidString(name) && strings.IndexFunc(name, func(r rune) bool { return unicode.IsSpace(r) || r == '+' }) < 0
+}
+
+// keyHash returns the hash identifying the witness named name.
+func keyHash(name string) []byte {
+	h := sha256.Sum256([]byte(name + "\n"))
+	return h[:keyHashSize]
+}
+
+// noteKey returns the signature type of pub and its encoding in key IDs.
+func noteKey(pub gocrypto.PublicKey) (byte, []byte, error) {
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return algEd25519, pub, nil
+	case *ecdsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return 0, nil, err
+		}
+		return algECDSA, der, nil
+	}
+	return 0, nil, fmt.Errorf("checkpoints can't be signed with %T keys", pub)
+}
+
+// keyID returns the ID of the note key of pub named name, which is the start of
+// the SHA-256 hash of the name, the signature type and the key.
+func keyID(name string, pub gocrypto.PublicKey) ([]byte, byte, error) {
+	alg, key, err := noteKey(pub)
+	if err != nil {
+		return nil, 0, err
+	}
+	h := sha256.New()
+	h.Write([]byte(name + "\n"))
+	h.Write([]byte{alg})
+	h.Write(key)
+	return h.Sum(nil)[:keyHashSize], alg, nil
+}
+
+// Signer signs the text of checkpoints of a log with the log's key.
+type Signer struct {
+	origin string
+	signer gocrypto.Signer
+	id     []byte
+	alg    byte
+}
+
+// NewSigner creates a Signer signing checkpoints of the log named origin with
+// signer, which must hold an Ed25519 or ECDSA key.
+func NewSigner(origin string, signer gocrypto.Signer) (*Signer, error) {
+	if !ValidName(origin) {
+		return nil, fmt.Errorf("invalid origin %q", origin)
+	}
+	id, alg, err := keyID(origin, signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{origin: origin, signer: signer, id: id, alg: alg}, nil
+}
+
+// Origin returns the origin of the checkpoints s signs.
+func (s *Signer) Origin() string {
+	return s.origin
+}
+
+func (s *Signer) sign(text []byte) ([]byte, error) {
+	if s.alg == algEd25519 {
+		return s.signer.Sign(rand.Reader, text, gocrypto.Hash(0))
+	}
+	digest := sha256.Sum256(text)
+	return s.signer.Sign(rand.Reader, digest[:], gocrypto.SHA256)
+}
+
+func cosignatureLine(cosig *trillian.Cosignature) (string, error) {
+	sigBytes, err := proto.Marshal(cosig.Signature)
+	if err != nil {
+		return "", err
+	}
+	return signaturePrefix + cosig.WitnessId + " " + base64.StdEncoding.EncodeToString(append(keyHash(cosig.WitnessId), sigBytes...)) + "\n", nil
+}
+
+// Marshal returns the checkpoint of root signed by s. Cosignatures of the root
+// are included after the log's signature, except those of witnesses whose IDs
+// can't name a signer, which are left out.
+func Marshal(root trillian.SignedLogRoot, s *Signer) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\n%d\n%s\n%d\n", s.origin, root.TreeSize, base64.StdEncoding.EncodeToString(root.RootHash), root.TimestampNanos)
+
+	sig, err := s.sign(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign checkpoint: %v", err)
+	}
+	fmt.Fprintf(&b, "\n%s%s %s\n", signaturePrefix, s.origin, base64.StdEncoding.EncodeToString(append(append([]byte{}, s.id...), sig...)))
+
+	for _, cosig := range root.Cosignatures {
+		if cosig == nil || cosig.Signature == nil || !ValidName(cosig.WitnessId) {
+			continue
+		}
+		line, err := cosignatureLine(cosig)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(line)
+	}
+	return b.Bytes(), nil
+}
+
+// signatureLine is a parsed signature line.
+type signatureLine struct {
+	name string
+	id   []byte
+	sig  []byte
+}
+
+// parse splits a checkpoint into its text, its parsed fields and its
+// signatures.
+func parse(data []byte) ([]byte, string, trillian.SignedLogRoot, []signatureLine, error) {
+	text := string(data)
+	split := strings.Index(text, "\n\n")
+	if split < 0 {
+		return nil, "", trillian.SignedLogRoot{}, nil, errors.New("checkpoint has no signatures")
+	}
+	body, sigs := text[:split+1], text[split+2:]
+
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	if len(lines) != 4 {
+		return nil, "", trillian.SignedLogRoot{}, nil, fmt.Errorf("checkpoint has %d lines before its signatures, want 4", len(lines))
+	}
+	origin := lines[0]
+	if !ValidName(origin) {
+		return nil, "", trillian.SignedLogRoot{}, nil, fmt.Errorf("invalid origin %q", origin)
+	}
+	var root trillian.SignedLogRoot
+	var err error
+	if root.TreeSize, err = strconv.ParseInt(lines[1], 10, 64); err != nil || root.TreeSize < 0 {
+		return nil, "", trillian.SignedLogRoot{}, nil, fmt.Errorf("invalid tree size %q", lines[1])
+	}
+	if root.RootHash, err = base64.StdEncoding.DecodeString(lines[2]); err != nil {
+		return nil, "", trillian.SignedLogRoot{}, nil, fmt.Errorf("invalid root hash %q: %v", lines[2], err)
+	}
+	if root.TimestampNanos, err = strconv.ParseInt(lines[3], 10, 64); err != nil {
+		return nil, "", trillian.SignedLogRoot{}, nil, fmt.Errorf("invalid timestamp %q", lines[3])
+	}
+
+	if !strings.HasSuffix(sigs, "\n") {
+		return nil, "", trillian.SignedLogRoot{}, nil, errors.New("checkpoint doesn't end with a newline")
+	}
+	var sigLines []signatureLine
+	for _, line := range strings.Split(strings.TrimSuffix(sigs, "\n"), "\n") {
+		sl, err := parseSignatureLine(line)
+		if err != nil {
+			return nil, "", trillian.SignedLogRoot{}, nil, err
+		}
+		sigLines = append(sigLines, sl)
+	}
+	return []byte(body), origin, root, sigLines, nil
+}
+
+func parseSignatureLine(line string) (signatureLine, error) {
+	if !strings.HasPrefix(line, signaturePrefix) {
+		return signatureLine{}, fmt.Errorf("malformed signature line %q", line)
+	}
+	fields := strings.Split(strings.TrimPrefix(line, signaturePrefix), " ")
+	if len(fields) != 2 || !ValidName(fields[0]) {
+		return signatureLine{}, fmt.Errorf("malformed signature line %q", line)
+	}
+	name := fields[0]
+	sigBytes, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil || len(sigBytes) <= keyHashSize {
+		return signatureLine{}, fmt.Errorf("malformed signature from %s", name)
+	}
+	return signatureLine{name: name, id: sigBytes[:keyHashSize], sig: sigBytes[keyHashSize:]}, nil
+}
+
+// cosignatures returns the witness cosignatures of a checkpoint of the log named
+// origin. Signatures that aren't cosignatures, such as those by other note
+// keys, are skipped.
+func cosignatures(origin string, sigLines []signatureLine) []*trillian.Cosignature {
+	var cosigs []*trillian.Cosignature
+	for _, sl := range sigLines {
+		if sl.name == origin || !bytes.Equal(sl.id, keyHash(sl.name)) {
+			continue
+		}
+		var sig trillian.DigitallySigned
+		if err := proto.Unmarshal(sl.sig, &sig); err != nil {
+			continue
+		}
+		cosigs = append(cosigs, &trillian.Cosignature{WitnessId: sl.name, Signature: &sig})
+	}
+	return cosigs
+}
+
+// Unmarshal parses a checkpoint, returning the origin and the root with its
+// witness cosignatures. No signatures are checked, and the root's Signature is
+// left unset as the log's signature is of the note text; use Open to check it.
+func Unmarshal(data []byte) (string, trillian.SignedLogRoot, error) {
+	_, origin, root, sigLines, err := parse(data)
+	if err != nil {
+		return "", trillian.SignedLogRoot{}, err
+	}
+	signed := false
+	for _, sl := range sigLines {
+		if sl.name == origin {
+			signed = true
+		}
+	}
+	if !signed {
+		return "", trillian.SignedLogRoot{}, errors.New("checkpoint isn't signed by the log")
+	}
+	root.Cosignatures = cosignatures(origin, sigLines)
+	return origin, root, nil
+}
+
+// Open parses a checkpoint of the log named origin and checks that it's signed
+// with the log's key pub, returning the root with its witness cosignatures.
+// The cosignatures aren't checked.
+func Open(data []byte, origin string, pub gocrypto.PublicKey) (trillian.SignedLogRoot, error) {
+	id, alg, err := keyID(origin, pub)
+	if err != nil {
+		return trillian.SignedLogRoot{}, err
+	}
+	text, gotOrigin, root, sigLines, err := parse(data)
+	if err != nil {
+		return trillian.SignedLogRoot{}, err
+	}
+	if gotOrigin != origin {
+		return trillian.SignedLogRoot{}, fmt.Errorf("checkpoint is of %q, want %q", gotOrigin, origin)
+	}
+	for _, sl := range sigLines {
+		if sl.name != origin || !bytes.Equal(sl.id, id) {
+			continue
+		}
+		if !verify(pub, alg, text, sl.sig) {
+			return trillian.SignedLogRoot{}, errors.New("checkpoint has an invalid signature from the log")
+		}
+		root.Cosignatures = cosignatures(origin, sigLines)
+		return root, nil
+	}
+	return trillian.SignedLogRoot{}, errors.New("checkpoint isn't signed with the log's key")
+}
+
+func verify(pub gocrypto.PublicKey, alg byte, text, sig []byte) bool {
+	switch alg {
+	case algEd25519:
+		return ed25519.Verify(pub.(ed25519.PublicKey), text, sig)
+	case algECDSA:
+		digest := sha256.Sum256(text)
+		return ecdsa.VerifyASN1(pub.(*ecdsa.PublicKey), digest[:], sig)
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package checkpoint
+
+import (
+	gocrypto "crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+)
+
+var testRoot = trillian.SignedLogRoot{TimestampNanos: 1500000000000000000, TreeSize: 12, RootHash: []byte("0123456789abcdef0123456789abcdef")}
+
+func newTestSigner(t *testing.T, origin string, alg trillian.SignatureAlgorithm) *Signer {
+	key, err := crypto.GenerateKey(alg)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	s, err := NewSigner(origin, key)
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+	return s
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for _, alg := range []trillian.SignatureAlgorithm{trillian.SignatureAlgorithm_ECDSA, trillian.SignatureAlgorithm_ED25519} {
+		s := newTestSigner(t, Origin(6), alg)
+		for _, cosigs := range [][]*trillian.Cosignature{
+			nil,
+			{
+				{WitnessId: "witness-1", Signature: &trillian.DigitallySigned{Signature: []byte("cosig 1")}},
+				{WitnessId: "example.com/witness-2", Signature: &trillian.DigitallySigned{Signature: []byte("cosig 2")}},
+			},
+		} {
+			root := testRoot
+			root.Cosignatures = cosigs
+			cp, err := Marshal(root, s)
+			if err != nil {
+				t.Fatalf("%v: Marshal() failed: %v", alg, err)
+			}
+			if want := "trillian/log/6\n12\nMDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=\n1500000000000000000\n\n— trillian/log/6 "; !strings.HasPrefix(string(cp), want) {
+				t.Errorf("%v: Marshal() = %q, want prefix %q", alg, cp, want)
+			}
+			if got, want := strings.Count(string(cp), "\n— "), 1+len(cosigs); got != want {
+				t.Errorf("%v: Marshal() = %q with %d signature lines, want %d", alg, cp, got, want)
+			}
+
+			origin, got, err := Unmarshal(cp)
+			if err != nil {
+				t.Fatalf("%v: Unmarshal(%q) failed: %v", alg, cp, err)
+			}
+			if origin != Origin(6) {
+				t.Errorf("%v: Unmarshal() origin = %q, want %q", alg, origin, Origin(6))
+			}
+			if !proto.Equal(&got, &root) {
+				t.Errorf("%v: Unmarshal() root = %v, want %v", alg, got, root)
+			}
+
+			got, err = Open(cp, Origin(6), s.signer.Public())
+			if err != nil {
+				t.Fatalf("%v: Open(%q) failed: %v", alg, cp, err)
+			}
+			if !proto.Equal(&got, &root) {
+				t.Errorf("%v: Open() root = %v, want %v", alg, got, root)
+			}
+		}
+	}
+}
+
+func TestMarshalSkipsInvalidWitnesses(t *testing.T) {
+	s := newTestSigner(t, "log", trillian.SignatureAlgorithm_ECDSA)
+	valid := &trillian.Cosignature{WitnessId: "witness", Signature: &trillian.DigitallySigned{Signature: []byte("cosig")}}
+	root := testRoot
+	root.Cosignatures = []*trillian.Cosignature{
+		{WitnessId: "a witness", Signature: &trillian.DigitallySigned{Signature: []byte("cosig")}},
+		{WitnessId: "a+witness", Signature: &trillian.DigitallySigned{Signature: []byte("cosig")}},
+		{WitnessId: "", Signature: &trillian.DigitallySigned{Signature: []byte("cosig")}},
+		{WitnessId: "unsigned"},
+		valid,
+	}
+	cp, err := Marshal(root, s)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	_, got, err := Unmarshal(cp)
+	if err != nil {
+		t.Fatalf("Unmarshal(%q) failed: %v", cp, err)
+	}
+	if len(got.Cosignatures) != 1 || !proto.Equal(got.Cosignatures[0], valid) {
+		t.Errorf("Unmarshal() cosignatures = %v, want only %v", got.Cosignatures, valid)
+	}
+}
+
+func TestNewSignerErrors(t *testing.T) {
+	ecdsaKey, err := crypto.GenerateKey(trillian.SignatureAlgorithm_ECDSA)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	rsaKey, err := crypto.GenerateKey(trillian.SignatureAlgorithm_RSA)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	for _, test := range []struct {
+		desc   string
+		origin string
+		key    gocrypto.Signer
+	}{
+		{desc: "empty origin", origin: "", key: ecdsaKey},
+		{desc: "origin with space", origin: "my log", key: ecdsaKey},
+		{desc: "origin with plus", origin: "my+log", key: ecdsaKey},
+		{desc: "RSA key", origin: "log", key: rsaKey},
+	} {
+		if _, err := NewSigner(test.origin, test.key); err == nil {
+			t.Errorf("%s: NewSigner() succeeded, want an error", test.desc)
+		}
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	s := newTestSigner(t, "log", trillian.SignatureAlgorithm_ED25519)
+	cp, err := Marshal(testRoot, s)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	valid := string(cp)
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	otherSigner := newTestSigner(t, "log", trillian.SignatureAlgorithm_ED25519)
+	otherCP, err := Marshal(testRoot, otherSigner)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	otherSig := string(otherCP)[strings.Index(string(otherCP), "— "):]
+
+	for _, test := range []struct {
+		desc   string
+		cp     string
+		origin string
+		pub    gocrypto.PublicKey
+	}{
+		{desc: "other origin", cp: valid, origin: "other", pub: s.signer.Public()},
+		{desc: "other key", cp: valid, origin: "log", pub: otherKey},
+		{desc: "altered text", cp: strings.Replace(valid, "\n12\n", "\n13\n", 1), origin: "log", pub: s.signer.Public()},
+		{desc: "signed by another key", cp: strings.Replace(valid, valid[strings.Index(valid, "— "):], otherSig, 1), origin: "log", pub: s.signer.Public()},
+	} {
+		if _, err := Open([]byte(test.cp), test.origin, test.pub); err == nil {
+			t.Errorf("%s: Open(%q) succeeded, want an error", test.desc, test.cp)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	cp, err := Marshal(testRoot, newTestSigner(t, "log", trillian.SignatureAlgorithm_ECDSA))
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	valid := string(cp)
+	sigLine := valid[strings.Index(valid, "— "):]
+
+	for _, test := range []struct {
+		desc string
+		cp   string
+	}{
+		{desc: "empty", cp: ""},
+		{desc: "no signatures", cp: strings.TrimSuffix(valid, sigLine)},
+		{desc: "missing line", cp: strings.Replace(valid, "12\n", "", 1)},
+		{desc: "bad tree size", cp: strings.Replace(valid, "\n12\n", "\nabc\n", 1)},
+		{desc: "negative tree size", cp: strings.Replace(valid, "\n12\n", "\n-12\n", 1)},
+		{desc: "bad root hash", cp: strings.Replace(valid, "MDEy", "!!!!", 1)},
+		{desc: "bad timestamp", cp: strings.Replace(valid, "1500000000000000000", "soon", 1)},
+		{desc: "no trailing newline", cp: strings.TrimSuffix(valid, "\n")},
+		{desc: "signed by another name", cp: strings.Replace(valid, "— log ", "— other ", 1)},
+		{desc: "malformed signature line", cp: valid + "not a signature\n"},
+		{desc: "bad signature encoding", cp: valid + "— witness !!!!\n"},
+	} {
+		if _, _, err := Unmarshal([]byte(test.cp)); err == nil {
+			t.Errorf("%s: Unmarshal(%q) succeeded, want an error", test.desc, test.cp)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package client contains helpers for applications which talk to Trillian
+// servers.
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+)
+
+// BatchOptions controls how a large request is split up by the batching helpers.
+type BatchOptions struct {
+	// MaxBatchSize is the largest number of items sent in a single request. It
+	// should be no more than the server will accept.
+	MaxBatchSize int
+	// MaxConcurrency is the largest number of requests in flight at once.
+	MaxConcurrency int
+}
+
+// DefaultBatchOptions are used by the batching helpers if none are given.
+var DefaultBatchOptions = BatchOptions{MaxBatchSize: 50, MaxConcurrency: 4}
+
+func (o BatchOptions) validate() error {
+	if o.MaxBatchSize <= 0 {
+		return fmt.Errorf("MaxBatchSize must be positive, got %d", o.MaxBatchSize)
+	}
+	if o.MaxConcurrency <= 0 {
+		return fmt.Errorf("MaxConcurrency must be positive, got %d", o.MaxConcurrency)
+	}
+	return nil
+}
+
+// ChunkError records why the items in [Start, End) could not be processed.
+type ChunkError struct {
+	Start int
+	End   int
+	Err   error
+}
+
+func (c ChunkError) Error() string {
+	return fmt.Sprintf("items [%d, %d): %v", c.Start, c.End, c.Err)
+}
+
+// BatchError is returned by the batching helpers when any chunk fails. Chunks
+// are independent, so the items outside the failed chunks were processed.
+type BatchError struct {
+	// Chunks is the total number of chunks the request was split into.
+	Chunks int
+	// Errors holds the failed chunks in item order.
+	Errors []ChunkError
+}
+
+func (b *BatchError) Error() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d of %d batches failed", len(b.Errors), b.Chunks)
+	for _, e := range b.Errors {
+		fmt.Fprintf(&buf, "; %v", e)
+	}
+	return buf.String()
+}
+
+// RunBatches splits n items into chunks of at most opts.MaxBatchSize and calls
+// f for each chunk with the range of items [start, end) it covers. Up to
+// opts.MaxConcurrency calls are made at once. Every chunk is attempted even if
+// others fail, unless ctx is cancelled, and if any fail a *BatchError is
+// returned.
+func RunBatches(ctx context.Context, n int, opts BatchOptions, f func(ctx context.Context, start, end int) error) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	numChunks := (n + opts.MaxBatchSize - 1) / opts.MaxBatchSize
+	errs := make([]error, numChunks)
+
+	var wg sync.WaitGroup
+	sem := make(chan bool, opts.MaxConcurrency)
+	for c := 0; c < numChunks; c++ {
+		start := c * opts.MaxBatchSize
+		end := start + opts.MaxBatchSize
+		if end > n {
+			end = n
+		}
+
+		select {
+		case sem <- true:
+		case <-ctx.Done():
+			errs[c] = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func(c, start, end int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[c] = f(ctx, start, end)
+		}(c, start, end)
+	}
+	wg.Wait()
+
+	var chunkErrs []ChunkError
+	for c, err := range errs {
+		if err == nil {
+			continue
+		}
+		start := c * opts.MaxBatchSize
+		end := start + opts.MaxBatchSize
+		if end > n {
+			end = n
+		}
+		chunkErrs = append(chunkErrs, ChunkError{Start: start, End: end, Err: err})
+	}
+	if len(chunkErrs) > 0 {
+		return &BatchError{Chunks: numChunks, Errors: chunkErrs}
+	}
+
+	return nil
+}
+
+// checkStatus turns a failure status in a response into an error. Not all
+// servers set a status when they succeed.
+func checkStatus(status *trillian.TrillianApiStatus) error {
+	if status != nil && status.StatusCode != trillian.TrillianApiStatusCode_OK {
+		return fmt.Errorf("server returned %v: %s", status.StatusCode, status.Description)
+	}
+	return nil
+}
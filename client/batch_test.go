@@ -0,0 +1,131 @@
+package client
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestRunBatchesChunks(t *testing.T) {
+	for _, test := range []struct {
+		n, size int
+		want    [][2]int
+	}{
+		{n: 0, size: 3, want: nil},
+		{n: 3, size: 3, want: [][2]int{{0, 3}}},
+		{n: 7, size: 3, want: [][2]int{{0, 3}, {3, 6}, {6, 7}}},
+		{n: 2, size: 5, want: [][2]int{{0, 2}}},
+	} {
+		var mu sync.Mutex
+		got := make([][2]int, 0)
+		err := RunBatches(context.Background(), test.n, BatchOptions{MaxBatchSize: test.size, MaxConcurrency: 2}, func(ctx context.Context, start, end int) error {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, [2]int{start, end})
+			return nil
+		})
+		if err != nil {
+			t.Errorf("RunBatches(%d, %d) failed: %v", test.n, test.size, err)
+			continue
+		}
+		// Chunks run concurrently so can be seen in any order
+		seen := make(map[[2]int]bool)
+		for _, c := range got {
+			seen[c] = true
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("RunBatches(%d, %d) ran chunks %v, want %v", test.n, test.size, got, test.want)
+			continue
+		}
+		for _, c := range test.want {
+			if !seen[c] {
+				t.Errorf("RunBatches(%d, %d) ran chunks %v, want %v", test.n, test.size, got, test.want)
+			}
+		}
+	}
+}
+
+func TestRunBatchesBoundsConcurrency(t *testing.T) {
+	const maxConcurrency = 3
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	release := make(chan bool)
+	started := make(chan bool)
+
+	done := make(chan error)
+	go func() {
+		done <- RunBatches(context.Background(), 20, BatchOptions{MaxBatchSize: 2, MaxConcurrency: maxConcurrency}, func(ctx context.Context, start, end int) error {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			started <- true
+			<-release
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil
+		})
+	}()
+
+	for i := 0; i < 10; i++ {
+		<-started
+		release <- true
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("RunBatches failed: %v", err)
+	}
+	if maxRunning > maxConcurrency {
+		t.Fatalf("RunBatches ran %d chunks at once, want at most %d", maxRunning, maxConcurrency)
+	}
+}
+
+func TestRunBatchesAggregatesErrors(t *testing.T) {
+	failed := errors.New("failed")
+	err := RunBatches(context.Background(), 10, BatchOptions{MaxBatchSize: 3, MaxConcurrency: 2}, func(ctx context.Context, start, end int) error {
+		if start == 3 || start == 9 {
+			return failed
+		}
+		return nil
+	})
+
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("RunBatches returned %v, want *BatchError", err)
+	}
+	want := &BatchError{Chunks: 4, Errors: []ChunkError{{Start: 3, End: 6, Err: failed}, {Start: 9, End: 10, Err: failed}}}
+	if !reflect.DeepEqual(batchErr, want) {
+		t.Fatalf("RunBatches returned %v, want %v", batchErr, want)
+	}
+}
+
+func TestRunBatchesCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := RunBatches(ctx, 10, BatchOptions{MaxBatchSize: 1, MaxConcurrency: 1}, func(ctx context.Context, start, end int) error {
+		return ctx.Err()
+	})
+	if err == nil {
+		t.Fatalf("RunBatches succeeded with a cancelled context")
+	}
+	// Every chunk fails whether or not it was started
+	if got, want := len(err.(*BatchError).Errors), 10; got != want {
+		t.Fatalf("RunBatches returned %d chunk errors, want %d", got, want)
+	}
+}
+
+func TestRunBatchesInvalidOptions(t *testing.T) {
+	for _, opts := range []BatchOptions{{MaxBatchSize: 0, MaxConcurrency: 1}, {MaxBatchSize: 1, MaxConcurrency: 0}} {
+		err := RunBatches(context.Background(), 1, opts, func(context.Context, int, int) error { return nil })
+		if err == nil {
+			t.Errorf("RunBatches with options %+v succeeded", opts)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Package discovery finds the addresses of Trillian servers through a service
+// registry, such as Consul, etcd or Kubernetes, so that clients need not be
+// configured with fixed server addresses.
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/util/kubernetes"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// ErrNoAddresses is returned when a service has no instances available.
+var ErrNoAddresses = errors.New("no addresses found for service")
+
+// Resolver looks up the addresses of the instances of a named service.
+type Resolver interface {
+	// Resolve returns the host:port address of each available instance of
+	// service.
+	Resolve(ctx context.Context, service string) ([]string, error)
+}
+
+// StaticResolver is a Resolver for a fixed list of addresses, which are
+// returned whatever service is requested.
+type StaticResolver []string
+
+// Resolve implements Resolver.
+func (s StaticResolver) Resolve(ctx context.Context, service string) ([]string, error) {
+	if len(s) == 0 {
+		return nil, ErrNoAddresses
+	}
+	return s, nil
+}
+
+// Dialer makes connections to any available instance of a service, looking up
+// the instances each time it connects. When an instance fails gRPC makes a new
+// connection, so it fails over to another instance automatically. If the
+// resolver can't be reached the addresses it last returned are used. It is safe
+// for concurrent use.
+type Dialer struct {
+	resolver Resolver
+	// Must hold this lock before accessing lastGood
+	mu       sync.Mutex
+	lastGood map[string][]string
+}
+
+// NewDialer creates a Dialer which finds instances through r.
+func NewDialer(r Resolver) *Dialer {
+	return &Dialer{resolver: r, lastGood: make(map[string][]string)}
+}
+
+// Dial connects to an instance of service, trying the instances in a random
+// order until one accepts the connection or timeout passes. It has the
+// signature needed by grpc.WithDialer.
+func (d *Dialer) Dial(service string, timeout time.Duration) (net.Conn, error) {
+	deadline := time.Now().Add(timeout)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	addrs, err := d.resolve(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+
+	lastErr := ErrNoAddresses
+	for _, i := range rand.Perm(len(addrs)) {
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			break
+		}
+		conn, err := net.DialTimeout("tcp", addrs[i], remaining)
+		if err == nil {
+			return conn, nil
+		}
+		glog.V(1).Infof("Failed to connect to %s instance %s: %v", service, addrs[i], err)
+		lastErr = err
+	}
+	return nil, fmt.Errorf("failed to connect to any instance of %s: %v", service, lastErr)
+}
+
+// resolve returns the addresses of service, falling back to the last ones found
+// if the resolver fails.
+func (d *Dialer) resolve(ctx context.Context, service string) ([]string, error) {
+	addrs, err := d.resolver.Resolve(ctx, service)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err == nil && len(addrs) > 0 {
+		d.lastGood[service] = addrs
+		return addrs, nil
+	}
+	if last, ok := d.lastGood[service]; ok {
+		glog.Warningf("Failed to resolve %s, using the last addresses found: %v", service, err)
+		return last, nil
+	}
+	if err == nil {
+		err = ErrNoAddresses
+	}
+	return nil, err
+}
+
+// Dial creates a gRPC client connection to service, an instance of which will
+// be found through r. Other options, such as the transport security to use, are
+// taken from opts.
+func Dial(r Resolver, service string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append(opts, grpc.WithDialer(NewDialer(r).Dial))
+	return grpc.Dial(service, opts...)
+}
+
+// DialTarget creates a gRPC client connection to target, which may be:
+//
+//	host:port[,host:port...]                  a fixed list of addresses
+//	consul://agent-host:port/service          a service registered with Consul
+//	etcd://host:port/key/directory            addresses held as values under an etcd directory
+//	kubernetes:///namespace/endpoints[:port]  a Kubernetes service, from inside the cluster
+//
+// Anything other than the address of a single server is connected to through
+// a Dialer, so it fails over between instances. This lets flags which used to
+// hold a server address take any of these forms.
+func DialTarget(target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	r, service, err := ParseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return grpc.Dial(target, opts...)
+	}
+	return Dial(r, service, opts...)
+}
+
+// ParseTarget returns the Resolver and service name for target, see DialTarget.
+// A nil Resolver is returned if target is the address of a single server.
+func ParseTarget(target string) (Resolver, string, error) {
+	if !strings.Contains(target, "://") {
+		if addrs := strings.Split(target, ","); len(addrs) > 1 {
+			return StaticResolver(addrs), target, nil
+		}
+		return nil, target, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, "", err
+	}
+	path := strings.TrimPrefix(u.Path, "/")
+	if len(path) == 0 {
+		return nil, "", fmt.Errorf("no service given in target %s", target)
+	}
+
+	switch u.Scheme {
+	case "consul":
+		return &ConsulResolver{Address: u.Host}, path, nil
+	case "etcd":
+		return &EtcdResolver{Address: u.Host}, path, nil
+	case "kubernetes":
+		client, err := kubernetes.NewInClusterClient()
+		if err != nil {
+			return nil, "", err
+		}
+		return &KubernetesResolver{Client: client}, path, nil
+	default:
+		return nil, "", fmt.Errorf("unknown service discovery scheme %q", u.Scheme)
+	}
+}
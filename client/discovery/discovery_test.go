@@ -0,0 +1,118 @@
+package discovery
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// fakeResolver returns addrs, or err if it is set.
+type fakeResolver struct {
+	addrs []string
+	err   error
+}
+
+func (f *fakeResolver) Resolve(ctx context.Context, service string) ([]string, error) {
+	return f.addrs, f.err
+}
+
+// deadAddress returns an address that nothing is listening on.
+func deadAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestDialerFailsOver(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	r := &fakeResolver{addrs: []string{deadAddress(t), l.Addr().String(), deadAddress(t)}}
+	d := NewDialer(r)
+	// Instances are tried in a random order so try a few times
+	for i := 0; i < 5; i++ {
+		conn, err := d.Dial("log", time.Second)
+		if err != nil {
+			t.Fatalf("Dial failed with one instance up: %v", err)
+		}
+		if got, want := conn.RemoteAddr().String(), l.Addr().String(); got != want {
+			t.Fatalf("Dial connected to %s, want %s", got, want)
+		}
+		conn.Close()
+	}
+
+	r.addrs = []string{deadAddress(t)}
+	if _, err := d.Dial("log", time.Second); err == nil {
+		t.Fatalf("Dial succeeded with no instances up")
+	}
+}
+
+func TestDialerUsesLastGoodAddresses(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	r := &fakeResolver{err: errors.New("registry down")}
+	d := NewDialer(r)
+	if _, err := d.Dial("log", time.Second); err == nil {
+		t.Fatalf("Dial succeeded when the service had never been resolved")
+	}
+
+	r.addrs, r.err = []string{l.Addr().String()}, nil
+	conn, err := d.Dial("log", time.Second)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	conn.Close()
+
+	r.addrs, r.err = nil, errors.New("registry down")
+	conn, err = d.Dial("log", time.Second)
+	if err != nil {
+		t.Fatalf("Dial failed when the registry went down: %v", err)
+	}
+	conn.Close()
+}
+
+func TestParseTarget(t *testing.T) {
+	for _, test := range []struct {
+		target      string
+		wantService string
+		want        Resolver
+		wantErr     bool
+	}{
+		{target: "localhost:8090", wantService: "localhost:8090"},
+		{target: "a:1,b:2", wantService: "a:1,b:2", want: StaticResolver{"a:1", "b:2"}},
+		{target: "consul://127.0.0.1:8500/trillian-log", wantService: "trillian-log", want: &ConsulResolver{Address: "127.0.0.1:8500"}},
+		{target: "etcd://etcd:2379/services/trillian/log", wantService: "services/trillian/log", want: &EtcdResolver{Address: "etcd:2379"}},
+		{target: "consul://127.0.0.1:8500/", wantErr: true},
+		{target: "zookeeper://zk/log", wantErr: true},
+	} {
+		r, service, err := ParseTarget(test.target)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("ParseTarget(%q) returned error %v, want error %v", test.target, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if service != test.wantService {
+			t.Errorf("ParseTarget(%q) returned service %q, want %q", test.target, service, test.wantService)
+		}
+		if !reflect.DeepEqual(r, test.want) {
+			t.Errorf("ParseTarget(%q) returned resolver %#v, want %#v", test.target, r, test.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/trillian/util/kubernetes"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// getJSON makes req and decodes the JSON response body into v.
+func getJSON(ctx context.Context, client *http.Client, req *http.Request, v interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := ctxhttp.Do(ctx, client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", req.URL.Path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// ConsulResolver finds the instances of a service registered with Consul which
+// are passing their health checks.
+type ConsulResolver struct {
+	// Address is the host:port of the Consul HTTP API, usually the local agent.
+	Address string
+	// Client is used to make requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+type consulServiceEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+	}
+}
+
+// Resolve implements Resolver.
+func (c *ConsulResolver) Resolve(ctx context.Context, service string) ([]string, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/v1/health/service/%s?passing=1", c.Address, service), nil)
+	if err != nil {
+		return nil, err
+	}
+	var entries []consulServiceEntry
+	if err := getJSON(ctx, c.Client, req, &entries); err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		// Services registered without an address use their node's
+		host := e.Service.Address
+		if len(host) == 0 {
+			host = e.Node.Address
+		}
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(e.Service.Port)))
+	}
+	return addrs, nil
+}
+
+// EtcdResolver finds the instances of a service from the keys in an etcd
+// directory. Each instance registers itself by setting a key in the directory,
+// usually with a TTL that it refreshes, whose value is its host:port address.
+type EtcdResolver struct {
+	// Address is the host:port of the etcd v2 HTTP API.
+	Address string
+	// Client is used to make requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+type etcdResponse struct {
+	Node struct {
+		Nodes []struct {
+			Value string
+			Dir   bool
+		}
+	}
+}
+
+// Resolve implements Resolver. The service is the path of the directory.
+func (e *EtcdResolver) Resolve(ctx context.Context, service string) ([]string, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/v2/keys/%s", e.Address, strings.Trim(service, "/")), nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp etcdResponse
+	if err := getJSON(ctx, e.Client, req, &resp); err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(resp.Node.Nodes))
+	for _, n := range resp.Node.Nodes {
+		if !n.Dir && len(n.Value) > 0 {
+			addrs = append(addrs, n.Value)
+		}
+	}
+	return addrs, nil
+}
+
+// KubernetesResolver finds the ready endpoints of a Kubernetes service. The
+// service is given as "[namespace/]name[:port]", where port is the name of the
+// port to connect to and may be left out if the service only has one.
+type KubernetesResolver struct {
+	// Client is used to query the API server. Services given without a
+	// namespace are looked up in its namespace.
+	Client *kubernetes.Client
+}
+
+type kubernetesEndpoints struct {
+	Subsets []struct {
+		Addresses []struct {
+			IP string
+		}
+		Ports []struct {
+			Name string
+			Port int
+		}
+	}
+}
+
+// Resolve implements Resolver.
+func (k *KubernetesResolver) Resolve(ctx context.Context, service string) ([]string, error) {
+	namespace, name, portName := k.Client.Namespace, service, ""
+	if i := strings.Index(name, "/"); i >= 0 {
+		namespace, name = name[:i], name[i+1:]
+	}
+	if i := strings.Index(name, ":"); i >= 0 {
+		name, portName = name[:i], name[i+1:]
+	}
+
+	var endpoints kubernetesEndpoints
+	if err := k.Client.Do(ctx, "GET", fmt.Sprintf("/api/v1/namespaces/%s/endpoints/%s", namespace, name), nil, &endpoints); err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	for _, subset := range endpoints.Subsets {
+		port := -1
+		for _, p := range subset.Ports {
+			if len(portName) == 0 && len(subset.Ports) == 1 || p.Name == portName {
+				port = p.Port
+			}
+		}
+		if port < 0 {
+			continue
+		}
+		// Only ready endpoints are listed in Addresses
+		for _, a := range subset.Addresses {
+			addrs = append(addrs, net.JoinHostPort(a.IP, strconv.Itoa(port)))
+		}
+	}
+	return addrs, nil
+}
@@ -0,0 +1,108 @@
+package discovery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/trillian/util/kubernetes"
+	"golang.org/x/net/context"
+)
+
+// serve returns a server which responds to requests for path with body, and
+// records the Authorization header sent.
+func serve(t *testing.T, path, body string, auth *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.RequestURI(); got != path {
+			t.Errorf("Request for %s, want %s", got, path)
+			http.NotFound(w, r)
+			return
+		}
+		if auth != nil {
+			*auth = r.Header.Get("Authorization")
+		}
+		w.Write([]byte(body))
+	}))
+}
+
+func TestConsulResolver(t *testing.T) {
+	s := serve(t, "/v1/health/service/trillian-log?passing=1", `[
+		{"Node": {"Address": "10.0.0.1"}, "Service": {"Address": "", "Port": 8090}},
+		{"Node": {"Address": "10.0.0.2"}, "Service": {"Address": "10.1.0.2", "Port": 8091}}
+	]`, nil)
+	defer s.Close()
+
+	r := &ConsulResolver{Address: strings.TrimPrefix(s.URL, "http://")}
+	addrs, err := r.Resolve(context.Background(), "trillian-log")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if want := []string{"10.0.0.1:8090", "10.1.0.2:8091"}; !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("Resolve returned %v, want %v", addrs, want)
+	}
+}
+
+func TestEtcdResolver(t *testing.T) {
+	s := serve(t, "/v2/keys/services/log", `{"action": "get", "node": {"key": "/services/log", "dir": true, "nodes": [
+		{"key": "/services/log/a", "value": "10.0.0.1:8090"},
+		{"key": "/services/log/old", "dir": true},
+		{"key": "/services/log/b", "value": "10.0.0.2:8090"}
+	]}}`, nil)
+	defer s.Close()
+
+	r := &EtcdResolver{Address: strings.TrimPrefix(s.URL, "http://")}
+	addrs, err := r.Resolve(context.Background(), "/services/log/")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if want := []string{"10.0.0.1:8090", "10.0.0.2:8090"}; !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("Resolve returned %v, want %v", addrs, want)
+	}
+}
+
+func TestKubernetesResolver(t *testing.T) {
+	const endpoints = `{"subsets": [
+		{"addresses": [{"ip": "10.0.0.1"}, {"ip": "10.0.0.2"}], "ports": [{"name": "grpc", "port": 8090}, {"name": "http", "port": 8091}]},
+		{"addresses": [{"ip": "10.0.0.3"}], "ports": [{"name": "http", "port": 8091}]}
+	]}`
+
+	for _, test := range []struct {
+		service string
+		path    string
+		want    []string
+	}{
+		{service: "trillian:grpc", path: "/api/v1/namespaces/default/endpoints/trillian", want: []string{"10.0.0.1:8090", "10.0.0.2:8090"}},
+		{service: "ct/trillian:http", path: "/api/v1/namespaces/ct/endpoints/trillian", want: []string{"10.0.0.1:8091", "10.0.0.2:8091", "10.0.0.3:8091"}},
+		// The port can only be left out for subsets with a single port
+		{service: "trillian", path: "/api/v1/namespaces/default/endpoints/trillian", want: []string{"10.0.0.3:8091"}},
+	} {
+		var auth string
+		s := serve(t, test.path, endpoints, &auth)
+
+		r := &KubernetesResolver{Client: &kubernetes.Client{APIServer: s.URL, Namespace: "default", Token: "secret"}}
+		addrs, err := r.Resolve(context.Background(), test.service)
+		s.Close()
+		if err != nil {
+			t.Errorf("Resolve(%q) failed: %v", test.service, err)
+			continue
+		}
+		if !reflect.DeepEqual(addrs, test.want) {
+			t.Errorf("Resolve(%q) returned %v, want %v", test.service, addrs, test.want)
+		}
+		if auth != "Bearer secret" {
+			t.Errorf("Resolve(%q) sent authorization %q, want the bearer token", test.service, auth)
+		}
+	}
+}
+
+func TestResolverErrorStatus(t *testing.T) {
+	s := httptest.NewServer(http.NotFoundHandler())
+	defer s.Close()
+
+	r := &ConsulResolver{Address: strings.TrimPrefix(s.URL, "http://")}
+	if _, err := r.Resolve(context.Background(), "log"); err == nil {
+		t.Fatalf("Resolve succeeded when the registry returned an error")
+	}
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+)
+
+// QueueLeaves queues any number of leaves to a log, in as many requests as
+// needed. If a *BatchError is returned the leaves outside the failed chunks were
+// queued.
+func QueueLeaves(ctx context.Context, c trillian.TrillianLogClient, logID int64, leaves []*trillian.LeafProto, opts BatchOptions) error {
+	return RunBatches(ctx, len(leaves), opts, func(ctx context.Context, start, end int) error {
+		resp, err := c.QueueLeaves(ctx, &trillian.QueueLeavesRequest{LogId: logID, Leaves: leaves[start:end]})
+		if err != nil {
+			return err
+		}
+		return checkStatus(resp.Status)
+	})
+}
+
+// GetLeavesByIndex fetches any number of leaves from a log by their index, in
+// as many requests as needed. The leaves are returned in the order requested.
+func GetLeavesByIndex(ctx context.Context, c trillian.TrillianLogClient, logID int64, indices []int64, opts BatchOptions) ([]*trillian.LeafProto, error) {
+	chunks := make([][]*trillian.LeafProto, numChunks(len(indices), opts))
+	err := RunBatches(ctx, len(indices), opts, func(ctx context.Context, start, end int) error {
+		resp, err := c.GetLeavesByIndex(ctx, &trillian.GetLeavesByIndexRequest{LogId: logID, LeafIndex: indices[start:end]})
+		if err != nil {
+			return err
+		}
+		if err := checkStatus(resp.Status); err != nil {
+			return err
+		}
+		chunks[start/opts.MaxBatchSize] = resp.Leaves
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return joinLeaves(chunks), nil
+}
+
+// GetLeavesByHash fetches any number of leaves from a log by their leaf hash, in
+// as many requests as needed. The leaves found for each chunk of hashes are
+// returned together, in the order of the chunks.
+func GetLeavesByHash(ctx context.Context, c trillian.TrillianLogClient, logID int64, leafHashes [][]byte, opts BatchOptions) ([]*trillian.LeafProto, error) {
+	chunks := make([][]*trillian.LeafProto, numChunks(len(leafHashes), opts))
+	err := RunBatches(ctx, len(leafHashes), opts, func(ctx context.Context, start, end int) error {
+		resp, err := c.GetLeavesByHash(ctx, &trillian.GetLeavesByHashRequest{LogId: logID, LeafHash: leafHashes[start:end]})
+		if err != nil {
+			return err
+		}
+		if err := checkStatus(resp.Status); err != nil {
+			return err
+		}
+		chunks[start/opts.MaxBatchSize] = resp.Leaves
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return joinLeaves(chunks), nil
+}
+
+// numChunks returns how many chunks RunBatches will split n items into, or zero
+// if the options are invalid, in which case RunBatches will fail.
+func numChunks(n int, opts BatchOptions) int {
+	if opts.validate() != nil {
+		return 0
+	}
+	return (n + opts.MaxBatchSize - 1) / opts.MaxBatchSize
+}
+
+func joinLeaves(chunks [][]*trillian.LeafProto) []*trillian.LeafProto {
+	var leaves []*trillian.LeafProto
+	for _, chunk := range chunks {
+		leaves = append(leaves, chunk...)
+	}
+	return leaves
+}
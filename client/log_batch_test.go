@@ -0,0 +1,77 @@
+package client
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+)
+
+const testLogID = int64(5)
+
+var okStatus = &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_OK}
+
+func testLeaves(n int) []*trillian.LeafProto {
+	leaves := make([]*trillian.LeafProto, n)
+	for i := range leaves {
+		leaves[i] = &trillian.LeafProto{LeafIndex: int64(i), LeafData: []byte{byte(i)}}
+	}
+	return leaves
+}
+
+func TestQueueLeaves(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	leaves := testLeaves(5)
+	c := trillian.NewMockTrillianLogClient(ctrl)
+	c.EXPECT().QueueLeaves(gomock.Any(), &trillian.QueueLeavesRequest{LogId: testLogID, Leaves: leaves[0:2]}).Return(&trillian.QueueLeavesResponse{Status: okStatus}, nil)
+	c.EXPECT().QueueLeaves(gomock.Any(), &trillian.QueueLeavesRequest{LogId: testLogID, Leaves: leaves[2:4]}).Return(nil, errors.New("unavailable"))
+	c.EXPECT().QueueLeaves(gomock.Any(), &trillian.QueueLeavesRequest{LogId: testLogID, Leaves: leaves[4:5]}).Return(&trillian.QueueLeavesResponse{Status: okStatus}, nil)
+
+	err := QueueLeaves(context.Background(), c, testLogID, leaves, BatchOptions{MaxBatchSize: 2, MaxConcurrency: 2})
+	batchErr, ok := err.(*BatchError)
+	if !ok || len(batchErr.Errors) != 1 || batchErr.Errors[0].Start != 2 {
+		t.Fatalf("QueueLeaves returned %v, want failure of items [2, 4) only", err)
+	}
+}
+
+func TestGetLeavesByIndexKeepsOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	leaves := testLeaves(5)
+	c := trillian.NewMockTrillianLogClient(ctrl)
+	for _, chunk := range [][]int64{{0, 1}, {2, 3}, {4}} {
+		var resp []*trillian.LeafProto
+		for _, i := range chunk {
+			resp = append(resp, leaves[i])
+		}
+		c.EXPECT().GetLeavesByIndex(gomock.Any(), &trillian.GetLeavesByIndexRequest{LogId: testLogID, LeafIndex: chunk}).Return(&trillian.GetLeavesByIndexResponse{Status: okStatus, Leaves: resp}, nil)
+	}
+
+	got, err := GetLeavesByIndex(context.Background(), c, testLogID, []int64{0, 1, 2, 3, 4}, BatchOptions{MaxBatchSize: 2, MaxConcurrency: 3})
+	if err != nil {
+		t.Fatalf("GetLeavesByIndex failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, leaves) {
+		t.Fatalf("GetLeavesByIndex returned %v, want %v", got, leaves)
+	}
+}
+
+func TestGetLeavesByHashStatusError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := trillian.NewMockTrillianLogClient(ctrl)
+	c.EXPECT().GetLeavesByHash(gomock.Any(), gomock.Any()).Return(&trillian.GetLeavesByHashResponse{
+		Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_ERROR, Description: "bad hash"},
+	}, nil)
+
+	if _, err := GetLeavesByHash(context.Background(), c, testLogID, [][]byte{[]byte("hash")}, DefaultBatchOptions); err == nil {
+		t.Fatalf("GetLeavesByHash succeeded when the server returned an error status")
+	}
+}
@@ -0,0 +1,374 @@
+package client
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/signer"
+	"golang.org/x/net/context"
+)
+
+// DefaultPollInterval is how long a LogClient waits between checks for a
+// queued leaf's inclusion, unless set with SetPollInterval.
+const DefaultPollInterval = time.Second
+
+// ErrNotIncluded is returned when a leaf isn't in the log's verified root.
+var ErrNotIncluded = errors.New("leaf is not included in the verified root")
+
+// ErrQuotaExceeded is returned when the log refuses a leaf because it's over
+// the log's write quota.
+var ErrQuotaExceeded = errors.New("leaf is over the log's write quota")
+
+// VerificationError is returned when the log serves a root or proof that
+// doesn't verify, so the log can't be trusted.
+type VerificationError struct {
+	Err error
+}
+
+func (v VerificationError) Error() string {
+	return fmt.Sprintf("verification failed: %v", v.Err)
+}
+
+// LogClient talks to a single log, checking what it returns so that callers
+// don't have to trust the server. It tracks the latest root it has verified:
+// each root must be signed by the log's key and proven consistent with the one
+// before, and inclusion proofs are checked against it. While the log's key is
+// being rotated, roots are also accepted if the new key has signed them. It is
+// safe for concurrent use.
+type LogClient struct {
+	client       trillian.TrillianLogClient
+	logID        int64
+	hasher       merkle.TreeHasher
+	verifier     merkle.LogVerifier
+	keys         *crypto.KeySet
+	threshold    *signer.ThresholdVerifier
+	pollInterval time.Duration
+
+	// Must hold this lock while updating the root, so each new root is
+	// checked against the one before
+	updateMu sync.Mutex
+	// Must hold this lock before accessing root
+	mu sync.Mutex
+	// root is the latest verified root, empty until one has been verified
+	root trillian.SignedLogRoot
+}
+
+// NewLogClient creates a LogClient for the log logID served by c, whose nodes
+// are hashed with th and roots are signed with the private key of publicKey.
+func NewLogClient(c trillian.TrillianLogClient, logID int64, th merkle.TreeHasher, publicKey gocrypto.PublicKey) *LogClient {
+	return &LogClient{
+		client:       c,
+		logID:        logID,
+		hasher:       th,
+		verifier:     merkle.NewLogVerifier(th),
+		keys:         crypto.NewKeySetForKey(publicKey),
+		pollInterval: DefaultPollInterval,
+	}
+}
+
+// SetPollInterval sets how long QueueLeaf and WaitForInclusion wait between
+// checks for a leaf's inclusion.
+func (c *LogClient) SetPollInterval(d time.Duration) {
+	c.pollInterval = d
+}
+
+// SetKeys makes the client check each root with the key of the log that was
+// active at the root's timestamp, given the log's keys as they're returned by
+// GetTreeKeys, rather than the single key it was created with. It must be
+// called before the client is used.
+func (c *LogClient) SetKeys(keys []*trillian.TreeKey) error {
+	ks, err := crypto.NewKeySet(keys)
+	if err != nil {
+		return err
+	}
+	c.keys = ks
+	return nil
+}
+
+// SetThresholdVerifier makes the client accept roots with threshold signatures
+// that v verifies, for logs whose roots are signed by several co-signers.
+func (c *LogClient) SetThresholdVerifier(v *signer.ThresholdVerifier) {
+	c.threshold = v
+}
+
+// Root returns the latest verified root, which is empty until one has been
+// verified by UpdateRoot or set by SetRoot.
+func (c *LogClient) Root() trillian.SignedLogRoot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.root
+}
+
+// SetRoot makes root the verified root, if it is signed by the log's key. It
+// can be used to start from a root verified earlier, such as one saved by a
+// previous run, so that the log's later roots are checked against it.
+func (c *LogClient) SetRoot(root trillian.SignedLogRoot) error {
+	if err := c.verifySignature(root); err != nil {
+		return err
+	}
+	c.updateMu.Lock()
+	defer c.updateMu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.root = root
+	return nil
+}
+
+func (c *LogClient) verifySignature(root trillian.SignedLogRoot) error {
+	if root.Signature == nil {
+		return VerificationError{errors.New("log root is not signed")}
+	}
+	if root.Signature.SignatureAlgorithm == trillian.SignatureAlgorithm_THRESHOLD {
+		if c.threshold == nil {
+			return VerificationError{errors.New("log root has a threshold signature, but no threshold keys are known")}
+		}
+		if err := c.threshold.VerifyLogRoot(root, *root.Signature); err != nil {
+			return VerificationError{fmt.Errorf("log root threshold signature is invalid: %v", err)}
+		}
+		return nil
+	}
+	if err := c.keys.VerifyLogRoot(c.hasher.Hasher, root); err != nil {
+		return VerificationError{fmt.Errorf("log root signature is invalid: %v", err)}
+	}
+	return nil
+}
+
+// UpdateRoot fetches the log's latest root, and makes it the verified root if
+// it's signed by the log's key and consistent with the current verified root.
+// It returns the verified root, which is kept if the log hasn't grown.
+func (c *LogClient) UpdateRoot(ctx context.Context) (trillian.SignedLogRoot, error) {
+	c.updateMu.Lock()
+	defer c.updateMu.Unlock()
+	current := c.Root()
+
+	resp, err := c.client.GetLatestSignedLogRoot(ctx, &trillian.GetLatestSignedLogRootRequest{LogId: c.logID})
+	if err != nil {
+		return current, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return current, err
+	}
+	if resp.SignedLogRoot == nil {
+		return current, errors.New("server returned no log root")
+	}
+	root := *resp.SignedLogRoot
+	if err := c.verifySignature(root); err != nil {
+		return current, err
+	}
+
+	switch {
+	case root.TreeSize < current.TreeSize:
+		return current, VerificationError{fmt.Errorf("log root went back from tree size %d to %d", current.TreeSize, root.TreeSize)}
+	case root.TreeSize == current.TreeSize:
+		if len(current.RootHash) > 0 && !bytes.Equal(root.RootHash, current.RootHash) {
+			return current, VerificationError{fmt.Errorf("log has roots %x and %x for tree size %d", current.RootHash, root.RootHash, root.TreeSize)}
+		}
+		if root.TimestampNanos <= current.TimestampNanos {
+			return current, nil
+		}
+	case current.TreeSize > 0:
+		if err := c.verifyConsistency(ctx, current, root); err != nil {
+			return current, err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.root = root
+	return root, nil
+}
+
+// verifyConsistency checks that the log proves root is consistent with the
+// older root, which mustn't be empty.
+func (c *LogClient) verifyConsistency(ctx context.Context, older, root trillian.SignedLogRoot) error {
+	req := &trillian.GetConsistencyProofRequest{LogId: c.logID, FirstTreeSize: older.TreeSize, SecondTreeSize: root.TreeSize}
+	resp, err := c.client.GetConsistencyProof(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return err
+	}
+	if err := c.verifier.VerifyConsistencyProof(older.TreeSize, root.TreeSize, older.RootHash, root.RootHash, proofHashes(resp.Proof)); err != nil {
+		return VerificationError{fmt.Errorf("consistency proof from tree size %d to %d is invalid: %v", older.TreeSize, root.TreeSize, err)}
+	}
+	return nil
+}
+
+// GetInclusionProof returns a proof that the leaf with leafHash is at leafIndex
+// in the verified root, after checking it. The root is updated first if it
+// doesn't include leafIndex.
+func (c *LogClient) GetInclusionProof(ctx context.Context, leafIndex int64, leafHash []byte) (*trillian.ProofProto, error) {
+	root := c.Root()
+	if leafIndex >= root.TreeSize {
+		var err error
+		if root, err = c.UpdateRoot(ctx); err != nil {
+			return nil, err
+		}
+		if leafIndex >= root.TreeSize {
+			return nil, ErrNotIncluded
+		}
+	}
+
+	req := &trillian.GetInclusionProofRequest{LogId: c.logID, LeafIndex: leafIndex, TreeSize: root.TreeSize}
+	resp, err := c.client.GetInclusionProof(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return nil, err
+	}
+	if resp.Proof == nil {
+		return nil, errors.New("server returned no proof")
+	}
+	if err := c.verifyInclusion(root, leafIndex, resp.Proof, leafHash); err != nil {
+		return nil, err
+	}
+	return resp.Proof, nil
+}
+
+// GetInclusionProofByHash returns a proof that the leaf with leafHash is in the
+// verified root, after checking it. If the log holds the leaf more than once
+// the proof is for the earliest. It returns ErrNotIncluded if the leaf isn't
+// in the verified root.
+func (c *LogClient) GetInclusionProofByHash(ctx context.Context, leafHash []byte) (*trillian.ProofProto, error) {
+	root := c.Root()
+	if root.TreeSize == 0 {
+		return nil, ErrNotIncluded
+	}
+
+	req := &trillian.GetInclusionProofByHashRequest{LogId: c.logID, LeafHash: leafHash, TreeSize: root.TreeSize, OrderBySequence: true}
+	resp, err := c.client.GetInclusionProofByHash(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return nil, err
+	}
+	if len(resp.Proof) == 0 {
+		return nil, ErrNotIncluded
+	}
+	// Every proof is checked, as any that fails shows the log can't be trusted
+	for _, proof := range resp.Proof {
+		if proof == nil {
+			return nil, errors.New("server returned an empty proof")
+		}
+		if err := c.verifyInclusion(root, proof.LeafIndex, proof, leafHash); err != nil {
+			return nil, err
+		}
+	}
+	return resp.Proof[0], nil
+}
+
+// GetEntryAndProof returns the leaf at leafIndex in the verified root and the
+// proof of its inclusion, after checking the proof against the hash of the leaf
+// data returned. Both are read by the server in one transaction, in a single
+// request. The root is updated first if it doesn't include leafIndex, and
+// ErrNotIncluded is returned if it still doesn't.
+func (c *LogClient) GetEntryAndProof(ctx context.Context, leafIndex int64) (*trillian.LeafProto, *trillian.ProofProto, error) {
+	root := c.Root()
+	if leafIndex >= root.TreeSize {
+		var err error
+		if root, err = c.UpdateRoot(ctx); err != nil {
+			return nil, nil, err
+		}
+		if leafIndex >= root.TreeSize {
+			return nil, nil, ErrNotIncluded
+		}
+	}
+
+	req := &trillian.GetEntryAndProofRequest{LogId: c.logID, LeafIndex: leafIndex, TreeSize: root.TreeSize}
+	resp, err := c.client.GetEntryAndProof(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return nil, nil, err
+	}
+	if resp.Leaf == nil || resp.Proof == nil {
+		return nil, nil, errors.New("server returned no leaf or proof")
+	}
+	if resp.Leaf.LeafIndex != leafIndex {
+		return nil, nil, VerificationError{fmt.Errorf("got leaf %d, want leaf %d", resp.Leaf.LeafIndex, leafIndex)}
+	}
+	if err := c.verifyInclusion(root, leafIndex, resp.Proof, c.hasher.HashLeaf(resp.Leaf.LeafData)); err != nil {
+		return nil, nil, err
+	}
+	return resp.Leaf, resp.Proof, nil
+}
+
+func (c *LogClient) verifyInclusion(root trillian.SignedLogRoot, leafIndex int64, proof *trillian.ProofProto, leafHash []byte) error {
+	if proof.LeafIndex != leafIndex {
+		return VerificationError{fmt.Errorf("got proof for leaf %d, want leaf %d", proof.LeafIndex, leafIndex)}
+	}
+	if err := c.verifier.VerifyInclusionProof(leafIndex, root.TreeSize, proofHashes(proof), root.RootHash, leafHash); err != nil {
+		return VerificationError{fmt.Errorf("inclusion proof for leaf %d in tree size %d is invalid: %v", leafIndex, root.TreeSize, err)}
+	}
+	return nil
+}
+
+// QueueLeaf adds a leaf holding data to the log, then waits for it to be
+// included as WaitForInclusion does.
+func (c *LogClient) QueueLeaf(ctx context.Context, data []byte) (*trillian.ProofProto, error) {
+	leafHash := c.hasher.HashLeaf(data)
+	req := &trillian.QueueLeavesRequest{LogId: c.logID, Leaves: []*trillian.LeafProto{{LeafHash: leafHash, LeafData: data}}}
+	resp, err := c.client.QueueLeaves(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return nil, err
+	}
+	// A duplicate of a leaf already in the log is waited for in the same way
+	if len(resp.QueuedLeaves) > 0 && resp.QueuedLeaves[0].Status == trillian.QueuedLeaf_QUOTA_EXCEEDED {
+		return nil, ErrQuotaExceeded
+	}
+	return c.WaitForInclusion(ctx, leafHash)
+}
+
+// WaitForInclusion updates the verified root until it includes the leaf with
+// leafHash, and returns the checked proof of its inclusion. Failed requests are
+// retried until ctx is done, but it returns a VerificationError as soon as the
+// log serves a root or proof that doesn't verify.
+func (c *LogClient) WaitForInclusion(ctx context.Context, leafHash []byte) (*trillian.ProofProto, error) {
+	for {
+		_, err := c.UpdateRoot(ctx)
+		if err == nil {
+			var proof *trillian.ProofProto
+			if proof, err = c.GetInclusionProofByHash(ctx, leafHash); err == nil {
+				return proof, nil
+			}
+		}
+		if _, ok := err.(VerificationError); ok {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			if err == ErrNotIncluded {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("%v, last error: %v", ctx.Err(), err)
+		case <-time.After(c.pollInterval):
+		}
+	}
+}
+
+// proofHashes returns the hashes of the nodes in a proof.
+func proofHashes(proof *trillian.ProofProto) []trillian.Hash {
+	if proof == nil {
+		return nil
+	}
+	hashes := make([]trillian.Hash, 0, len(proof.ProofNode))
+	for _, node := range proof.ProofNode {
+		hashes = append(hashes, node.NodeHash)
+	}
+	return hashes
+}
@@ -0,0 +1,244 @@
+package client
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// fakeLog serves a log held in memory, which integrates the leaves queued each
+// time its latest root is read.
+type fakeLog struct {
+	trillian.TrillianLogClient
+	tree   *merkle.InMemoryMerkleTree
+	signer *crypto.TrillianSigner
+	hashes [][]byte
+	data   [][]byte
+	queued [][]byte
+	// forkRoot has roots signed with a different root hash when set
+	forkRoot bool
+}
+
+func newFakeLog(t *testing.T, th merkle.TreeHasher) (*fakeLog, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	return &fakeLog{
+		tree:   merkle.NewInMemoryMerkleTree(th),
+		signer: crypto.NewTrillianSigner(th.Hasher, trillian.SignatureAlgorithm_ECDSA, key),
+	}, key
+}
+
+func (f *fakeLog) QueueLeaves(ctx context.Context, req *trillian.QueueLeavesRequest, opts ...grpc.CallOption) (*trillian.QueueLeavesResponse, error) {
+	for _, leaf := range req.Leaves {
+		f.queued = append(f.queued, leaf.LeafData)
+	}
+	return &trillian.QueueLeavesResponse{Status: okStatus}, nil
+}
+
+func (f *fakeLog) GetLatestSignedLogRoot(ctx context.Context, req *trillian.GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*trillian.GetLatestSignedLogRootResponse, error) {
+	for _, data := range f.queued {
+		_, entry := f.tree.AddLeaf(data)
+		f.hashes = append(f.hashes, entry.Hash())
+		f.data = append(f.data, data)
+	}
+	f.queued = nil
+
+	root := trillian.SignedLogRoot{TimestampNanos: time.Now().UnixNano(), TreeSize: int64(f.tree.LeafCount()), RootHash: f.tree.CurrentRoot().Hash()}
+	if f.forkRoot {
+		root.RootHash = []byte("forked")
+	}
+	sig, err := f.signer.SignLogRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	root.Signature = &sig
+	return &trillian.GetLatestSignedLogRootResponse{Status: okStatus, SignedLogRoot: &root}, nil
+}
+
+func proofOf(entries []merkle.TreeEntryDescriptor, leafIndex int64) *trillian.ProofProto {
+	proof := &trillian.ProofProto{LeafIndex: leafIndex}
+	for _, entry := range entries {
+		proof.ProofNode = append(proof.ProofNode, &trillian.NodeProto{NodeHash: entry.Value.Hash()})
+	}
+	return proof
+}
+
+func (f *fakeLog) GetConsistencyProof(ctx context.Context, req *trillian.GetConsistencyProofRequest, opts ...grpc.CallOption) (*trillian.GetConsistencyProofResponse, error) {
+	proof := proofOf(f.tree.SnapshotConsistency(int(req.FirstTreeSize), int(req.SecondTreeSize)), 0)
+	return &trillian.GetConsistencyProofResponse{Status: okStatus, Proof: proof}, nil
+}
+
+func (f *fakeLog) GetInclusionProof(ctx context.Context, req *trillian.GetInclusionProofRequest, opts ...grpc.CallOption) (*trillian.GetInclusionProofResponse, error) {
+	proof := proofOf(f.tree.PathToRootAtSnapshot(int(req.LeafIndex+1), int(req.TreeSize)), req.LeafIndex)
+	return &trillian.GetInclusionProofResponse{Status: okStatus, Proof: proof}, nil
+}
+
+func (f *fakeLog) GetInclusionProofByHash(ctx context.Context, req *trillian.GetInclusionProofByHashRequest, opts ...grpc.CallOption) (*trillian.GetInclusionProofByHashResponse, error) {
+	resp := &trillian.GetInclusionProofByHashResponse{Status: okStatus}
+	for i, hash := range f.hashes {
+		if int64(i) < req.TreeSize && bytes.Equal(hash, req.LeafHash) {
+			resp.Proof = append(resp.Proof, proofOf(f.tree.PathToRootAtSnapshot(i+1, int(req.TreeSize)), int64(i)))
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeLog) GetEntryAndProof(ctx context.Context, req *trillian.GetEntryAndProofRequest, opts ...grpc.CallOption) (*trillian.GetEntryAndProofResponse, error) {
+	proof := proofOf(f.tree.PathToRootAtSnapshot(int(req.LeafIndex+1), int(req.TreeSize)), req.LeafIndex)
+	leaf := &trillian.LeafProto{LeafIndex: req.LeafIndex, LeafHash: f.hashes[req.LeafIndex], LeafData: f.data[req.LeafIndex]}
+	return &trillian.GetEntryAndProofResponse{Status: okStatus, Leaf: leaf, Proof: proof}, nil
+}
+
+func TestLogClientQueueLeaf(t *testing.T) {
+	th := merkle.NewRFC6962TreeHasher(trillian.NewSHA256())
+	log, key := newFakeLog(t, th)
+	c := NewLogClient(log, testLogID, th, key.Public())
+	c.SetPollInterval(time.Millisecond)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		data := []byte(fmt.Sprintf("leaf %d", i))
+		proof, err := c.QueueLeaf(ctx, data)
+		if err != nil {
+			t.Fatalf("QueueLeaf(%d) failed: %v", i, err)
+		}
+		if proof.LeafIndex != int64(i) {
+			t.Errorf("QueueLeaf(%d) returned proof for leaf %d", i, proof.LeafIndex)
+		}
+		if got, want := c.Root().TreeSize, int64(i+1); got != want {
+			t.Errorf("Verified root has tree size %d, want %d", got, want)
+		}
+
+		if _, err := c.GetInclusionProof(ctx, 0, th.HashLeaf([]byte("leaf 0"))); err != nil {
+			t.Errorf("GetInclusionProof(0) failed: %v", err)
+		}
+		if _, err := c.GetInclusionProof(ctx, 0, th.HashLeaf([]byte("other"))); err == nil {
+			t.Errorf("GetInclusionProof(0) accepted the wrong leaf hash")
+		}
+	}
+
+	if _, err := c.GetInclusionProofByHash(ctx, th.HashLeaf([]byte("missing"))); err != ErrNotIncluded {
+		t.Errorf("GetInclusionProofByHash(missing) returned %v, want ErrNotIncluded", err)
+	}
+}
+
+func TestLogClientGetEntryAndProof(t *testing.T) {
+	th := merkle.NewRFC6962TreeHasher(trillian.NewSHA256())
+	log, key := newFakeLog(t, th)
+	c := NewLogClient(log, testLogID, th, key.Public())
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		log.queued = append(log.queued, []byte(fmt.Sprintf("leaf %d", i)))
+	}
+	// The root is updated to include the leaf asked for
+	for i := int64(0); i < 3; i++ {
+		leaf, proof, err := c.GetEntryAndProof(ctx, i)
+		if err != nil {
+			t.Fatalf("GetEntryAndProof(%d) failed: %v", i, err)
+		}
+		if got, want := string(leaf.LeafData), fmt.Sprintf("leaf %d", i); got != want {
+			t.Errorf("GetEntryAndProof(%d) returned leaf %q, want %q", i, got, want)
+		}
+		if proof.LeafIndex != i {
+			t.Errorf("GetEntryAndProof(%d) returned proof for leaf %d", i, proof.LeafIndex)
+		}
+	}
+	if _, _, err := c.GetEntryAndProof(ctx, 3); err != ErrNotIncluded {
+		t.Errorf("GetEntryAndProof(3) returned %v, want ErrNotIncluded", err)
+	}
+
+	// A leaf that isn't the one proved is caught
+	log.data[1] = []byte("other")
+	if _, _, err := c.GetEntryAndProof(ctx, 1); err == nil {
+		t.Error("GetEntryAndProof(1) accepted a leaf that isn't in the log")
+	} else if _, ok := err.(VerificationError); !ok {
+		t.Errorf("GetEntryAndProof(1) returned %v, want a VerificationError", err)
+	}
+}
+
+func TestLogClientRejectsBadRoots(t *testing.T) {
+	th := merkle.NewRFC6962TreeHasher(trillian.NewSHA256())
+	ctx := context.Background()
+
+	log, key := newFakeLog(t, th)
+	log.queued = [][]byte{[]byte("a"), []byte("b")}
+	c := NewLogClient(log, testLogID, th, key.Public())
+	root, err := c.UpdateRoot(ctx)
+	if err != nil {
+		t.Fatalf("UpdateRoot failed: %v", err)
+	}
+
+	// A root of the same size with a different hash is a fork
+	log.forkRoot = true
+	if _, err := c.UpdateRoot(ctx); err == nil {
+		t.Errorf("UpdateRoot accepted a forked root")
+	}
+	// So is a larger root that isn't consistent
+	log.queued = [][]byte{[]byte("c")}
+	if _, err := c.UpdateRoot(ctx); err == nil {
+		t.Errorf("UpdateRoot accepted an inconsistent root")
+	}
+	if got := c.Root(); !bytes.Equal(got.RootHash, root.RootHash) {
+		t.Errorf("Verified root changed to %x after bad roots, want %x", got.RootHash, root.RootHash)
+	}
+
+	// Roots signed with another key are refused
+	other, _ := newFakeLog(t, th)
+	c = NewLogClient(other, testLogID, th, key.Public())
+	if _, err := c.UpdateRoot(ctx); err == nil {
+		t.Errorf("UpdateRoot accepted a root signed with the wrong key")
+	}
+	if err := c.SetRoot(root); err != nil {
+		t.Errorf("SetRoot failed: %v", err)
+	}
+	root.TreeSize++
+	if err := c.SetRoot(root); err == nil {
+		t.Errorf("SetRoot accepted a root with a bad signature")
+	}
+}
+
+func TestLogClientSetKeys(t *testing.T) {
+	th := merkle.NewRFC6962TreeHasher(trillian.NewSHA256())
+	ctx := context.Background()
+
+	log, key := newFakeLog(t, th)
+	old, oldKey := newFakeLog(t, th)
+	keyDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey failed: %v", err)
+	}
+	oldDER, err := x509.MarshalPKIXPublicKey(oldKey.Public())
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey failed: %v", err)
+	}
+
+	// The log's key was replaced long ago, so its roots are signed with the new one
+	c := NewLogClient(log, testLogID, th, oldKey.Public())
+	if err := c.SetKeys([]*trillian.TreeKey{{KeyId: "old", PublicKeyDer: oldDER}, {KeyId: "new", PublicKeyDer: keyDER, ActivateTimeNanos: 1}}); err != nil {
+		t.Fatalf("SetKeys failed: %v", err)
+	}
+	if _, err := c.UpdateRoot(ctx); err != nil {
+		t.Errorf("UpdateRoot failed: %v", err)
+	}
+	c = NewLogClient(old, testLogID, th, oldKey.Public())
+	if err := c.SetKeys([]*trillian.TreeKey{{KeyId: "old", PublicKeyDer: oldDER}, {KeyId: "new", PublicKeyDer: keyDER, ActivateTimeNanos: 1}}); err != nil {
+		t.Fatalf("SetKeys failed: %v", err)
+	}
+	if _, err := c.UpdateRoot(ctx); err == nil {
+		t.Errorf("UpdateRoot accepted a root signed with a replaced key")
+	}
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+)
+
+// GetMapLeaves reads any number of keys from a map, in as many requests as
+// needed. The options, other than the keys, are taken from req. If req asks for
+// the latest revision, the latest revision when the call is made is read by
+// every request so the results are consistent. Keys which have no value are
+// skipped. The storage doesn't return the leaves of a request in any particular
+// order, so callers must match them to their keys rather than rely on it.
+func GetMapLeaves(ctx context.Context, c trillian.TrillianMapClient, req *trillian.GetMapLeavesRequest, opts BatchOptions) (*trillian.GetMapLeavesResponse, error) {
+	chunkReq := *req
+	var root *trillian.SignedMapRoot
+	if len(req.RevisionTag) == 0 && req.Revision < 0 {
+		resp, err := c.GetSignedMapRoot(ctx, &trillian.GetSignedMapRootRequest{MapId: req.MapId})
+		if err != nil {
+			return nil, err
+		}
+		if err := checkStatus(resp.Status); err != nil {
+			return nil, err
+		}
+		root = resp.MapRoot
+		chunkReq.Revision = root.MapRevision
+	}
+
+	chunks := make([][]*trillian.KeyValueInclusion, numChunks(len(req.Key), opts))
+	err := RunBatches(ctx, len(req.Key), opts, func(ctx context.Context, start, end int) error {
+		r := chunkReq
+		r.Key = req.Key[start:end]
+		resp, err := c.GetLeaves(ctx, &r)
+		if err != nil {
+			return err
+		}
+		if err := checkStatus(resp.Status); err != nil {
+			return err
+		}
+		chunks[start/opts.MaxBatchSize] = resp.KeyValue
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &trillian.GetMapLeavesResponse{MapRoot: root}
+	for _, chunk := range chunks {
+		resp.KeyValue = append(resp.KeyValue, chunk...)
+	}
+	return resp, nil
+}
+
+// SetMapLeaves writes any number of key values to a map as a single new
+// revision. The options, other than the key values, are taken from req. The key
+// values are streamed to the server in chunks of at most opts.MaxBatchSize, one
+// at a time, and nothing is written unless they all arrive.
+func SetMapLeaves(ctx context.Context, c trillian.TrillianMapClient, req *trillian.SetMapLeavesRequest, opts BatchOptions) (*trillian.SetMapLeavesResponse, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	stream, err := c.SetLeavesStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first request carries the options for the whole revision
+	first := *req
+	end := len(req.KeyValue)
+	if end > opts.MaxBatchSize {
+		end = opts.MaxBatchSize
+	}
+	first.KeyValue = req.KeyValue[:end]
+	if err := stream.Send(&first); err != nil {
+		return nil, err
+	}
+
+	for start := end; start < len(req.KeyValue); start = end {
+		end = start + opts.MaxBatchSize
+		if end > len(req.KeyValue) {
+			end = len(req.KeyValue)
+		}
+		if err := stream.Send(&trillian.SetMapLeavesRequest{MapId: req.MapId, KeyValue: req.KeyValue[start:end]}); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
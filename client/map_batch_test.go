@@ -0,0 +1,96 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+const testMapID = int64(7)
+
+func testKeyValues(n int) []*trillian.KeyValue {
+	kvs := make([]*trillian.KeyValue, n)
+	for i := range kvs {
+		kvs[i] = &trillian.KeyValue{Key: []byte{byte(i)}, Value: &trillian.MapLeaf{LeafValue: []byte{byte(i)}}}
+	}
+	return kvs
+}
+
+func TestGetMapLeavesPinsLatestRevision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	root := &trillian.SignedMapRoot{MapRevision: 9}
+	kvs := testKeyValues(3)
+	c := trillian.NewMockTrillianMapClient(ctrl)
+	c.EXPECT().GetSignedMapRoot(gomock.Any(), &trillian.GetSignedMapRootRequest{MapId: testMapID}).Return(&trillian.GetSignedMapRootResponse{MapRoot: root}, nil)
+	for i, kv := range kvs {
+		c.EXPECT().GetLeaves(gomock.Any(), &trillian.GetMapLeavesRequest{MapId: testMapID, Key: [][]byte{kv.Key}, Revision: 9}).Return(&trillian.GetMapLeavesResponse{
+			KeyValue: []*trillian.KeyValueInclusion{{KeyValue: kvs[i]}},
+		}, nil)
+	}
+
+	resp, err := GetMapLeaves(context.Background(), c, &trillian.GetMapLeavesRequest{MapId: testMapID, Key: [][]byte{kvs[0].Key, kvs[1].Key, kvs[2].Key}, Revision: -1}, BatchOptions{MaxBatchSize: 1, MaxConcurrency: 2})
+	if err != nil {
+		t.Fatalf("GetMapLeaves failed: %v", err)
+	}
+	if resp.MapRoot != root {
+		t.Fatalf("GetMapLeaves returned root %v, want %v", resp.MapRoot, root)
+	}
+	if got, want := len(resp.KeyValue), len(kvs); got != want {
+		t.Fatalf("GetMapLeaves returned %d leaves, want %d", got, want)
+	}
+	for i, kvi := range resp.KeyValue {
+		if kvi.KeyValue != kvs[i] {
+			t.Errorf("GetMapLeaves returned %v for batch %d, want %v", kvi.KeyValue, i, kvs[i])
+		}
+	}
+}
+
+// fakeSetLeavesStream records the requests sent on a SetLeavesStream call.
+type fakeSetLeavesStream struct {
+	grpc.ClientStream
+	sent []*trillian.SetMapLeavesRequest
+	resp *trillian.SetMapLeavesResponse
+}
+
+func (f *fakeSetLeavesStream) Send(req *trillian.SetMapLeavesRequest) error {
+	f.sent = append(f.sent, req)
+	return nil
+}
+
+func (f *fakeSetLeavesStream) CloseAndRecv() (*trillian.SetMapLeavesResponse, error) {
+	return f.resp, nil
+}
+
+func TestSetMapLeavesStreamsChunks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	kvs := testKeyValues(5)
+	stream := &fakeSetLeavesStream{resp: &trillian.SetMapLeavesResponse{MapRoot: &trillian.SignedMapRoot{MapRevision: 3}}}
+	c := trillian.NewMockTrillianMapClient(ctrl)
+	c.EXPECT().SetLeavesStream(gomock.Any()).Return(stream, nil)
+
+	metadata := &trillian.MapperMetadata{HighestFullyCompletedSeq: 10}
+	resp, err := SetMapLeaves(context.Background(), c, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: kvs, MapperData: metadata, Stage: true}, BatchOptions{MaxBatchSize: 2, MaxConcurrency: 1})
+	if err != nil {
+		t.Fatalf("SetMapLeaves failed: %v", err)
+	}
+	if resp != stream.resp {
+		t.Fatalf("SetMapLeaves returned %v, want %v", resp, stream.resp)
+	}
+
+	want := []*trillian.SetMapLeavesRequest{
+		{MapId: testMapID, KeyValue: kvs[0:2], MapperData: metadata, Stage: true},
+		{MapId: testMapID, KeyValue: kvs[2:4]},
+		{MapId: testMapID, KeyValue: kvs[4:5]},
+	}
+	if !reflect.DeepEqual(stream.sent, want) {
+		t.Fatalf("SetMapLeaves sent %v, want %v", stream.sent, want)
+	}
+}
@@ -0,0 +1,247 @@
+package client
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+)
+
+// DefaultMaxCachedRoots is the number of verified roots a MapClient keeps,
+// unless set with SetMaxCachedRoots.
+const DefaultMaxCachedRoots = 16
+
+// MapClient reads from a single map, checking what it returns so that callers
+// don't have to trust the server. Roots must be signed by the map's key, or by
+// the new key while it's being rotated, and each leaf returned is checked to be
+// the value of the key asked for in the root's revision, or that the key has no
+// value. Verified roots are cached by revision, so a root seen before isn't
+// verified again and the map can't serve two different roots for one revision.
+// It is safe for concurrent use.
+type MapClient struct {
+	client trillian.TrillianMapClient
+	mapID  int64
+	hasher merkle.MapHasher
+	keys   *crypto.KeySet
+
+	// Must hold this lock before accessing the fields below
+	mu sync.Mutex
+	// roots holds the verified roots by revision
+	roots    map[int64]trillian.SignedMapRoot
+	maxRoots int
+	// latest is the highest revision of the verified roots, -1 if there are none
+	latest int64
+}
+
+// NewMapClient creates a MapClient for the map mapID served by c, whose keys
+// and nodes are hashed with h and roots are signed with the private key of
+// publicKey.
+func NewMapClient(c trillian.TrillianMapClient, mapID int64, h merkle.MapHasher, publicKey gocrypto.PublicKey) *MapClient {
+	return &MapClient{
+		client:   c,
+		mapID:    mapID,
+		hasher:   h,
+		keys:     crypto.NewKeySetForKey(publicKey),
+		roots:    make(map[int64]trillian.SignedMapRoot),
+		maxRoots: DefaultMaxCachedRoots,
+		latest:   -1,
+	}
+}
+
+// SetKeys makes the client check each root with the key of the map that was
+// active at the root's timestamp, given the map's keys as they're returned by
+// GetTreeKeys, rather than the single key it was created with. It must be
+// called before the client is used.
+func (c *MapClient) SetKeys(keys []*trillian.TreeKey) error {
+	ks, err := crypto.NewKeySet(keys)
+	if err != nil {
+		return err
+	}
+	c.keys = ks
+	return nil
+}
+
+// SetMaxCachedRoots sets how many verified roots are kept. The roots of the
+// lowest revisions are dropped first, but the latest is always kept.
+func (c *MapClient) SetMaxCachedRoots(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxRoots = n
+	c.evictRoots()
+}
+
+// Root returns the verified root of the highest revision seen, and false if no
+// root has been verified yet.
+func (c *MapClient) Root() (trillian.SignedMapRoot, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	root, ok := c.roots[c.latest]
+	return root, ok
+}
+
+// verifyRoot checks that root is signed by the map's key, unless the same root
+// is already cached, and caches it.
+func (c *MapClient) verifyRoot(root *trillian.SignedMapRoot) error {
+	if root == nil {
+		return errors.New("server returned no map root")
+	}
+
+	c.mu.Lock()
+	cached, ok := c.roots[root.MapRevision]
+	c.mu.Unlock()
+	if ok {
+		if !bytes.Equal(cached.RootHash, root.RootHash) {
+			return VerificationError{fmt.Errorf("map has roots %x and %x for revision %d", cached.RootHash, root.RootHash, root.MapRevision)}
+		}
+		if cached.TimestampNanos == root.TimestampNanos {
+			return nil
+		}
+	}
+
+	if root.Signature == nil {
+		return VerificationError{errors.New("map root is not signed")}
+	}
+	if err := c.keys.VerifyMapRoot(c.hasher.Hasher, *root); err != nil {
+		return VerificationError{fmt.Errorf("map root signature is invalid: %v", err)}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.roots[root.MapRevision] = *root
+	if root.MapRevision > c.latest {
+		c.latest = root.MapRevision
+	}
+	c.evictRoots()
+	return nil
+}
+
+// evictRoots drops the roots of the lowest revisions until there are no more
+// than maxRoots. Must hold mu.
+func (c *MapClient) evictRoots() {
+	for len(c.roots) > c.maxRoots && len(c.roots) > 1 {
+		lowest := c.latest
+		for revision := range c.roots {
+			if revision < lowest {
+				lowest = revision
+			}
+		}
+		delete(c.roots, lowest)
+	}
+}
+
+// GetRoot fetches the map's latest root, after checking its signature. The
+// map's revision mustn't have gone back from the highest verified revision.
+func (c *MapClient) GetRoot(ctx context.Context) (trillian.SignedMapRoot, error) {
+	resp, err := c.client.GetSignedMapRoot(ctx, &trillian.GetSignedMapRootRequest{MapId: c.mapID})
+	if err != nil {
+		return trillian.SignedMapRoot{}, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return trillian.SignedMapRoot{}, err
+	}
+	if err := c.verifyRoot(resp.MapRoot); err != nil {
+		return trillian.SignedMapRoot{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if resp.MapRoot.MapRevision < c.latest {
+		return trillian.SignedMapRoot{}, VerificationError{fmt.Errorf("map's latest revision went back from %d to %d", c.latest, resp.MapRoot.MapRevision)}
+	}
+	return *resp.MapRoot, nil
+}
+
+// GetRootByRevision returns the map's root for revision, after checking its
+// signature. Roots that have been verified before are returned from the cache.
+func (c *MapClient) GetRootByRevision(ctx context.Context, revision int64) (trillian.SignedMapRoot, error) {
+	c.mu.Lock()
+	root, ok := c.roots[revision]
+	c.mu.Unlock()
+	if ok {
+		return root, nil
+	}
+
+	resp, err := c.client.GetSignedMapRootByRevision(ctx, &trillian.GetSignedMapRootByRevisionRequest{MapId: c.mapID, Revision: revision})
+	if err != nil {
+		return trillian.SignedMapRoot{}, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return trillian.SignedMapRoot{}, err
+	}
+	if err := c.verifyRoot(resp.MapRoot); err != nil {
+		return trillian.SignedMapRoot{}, err
+	}
+	if resp.MapRoot.MapRevision != revision {
+		return trillian.SignedMapRoot{}, VerificationError{fmt.Errorf("got root of revision %d, want revision %d", resp.MapRoot.MapRevision, revision)}
+	}
+	return *resp.MapRoot, nil
+}
+
+// GetLeaves fetches the leaves of keys in revision, or the latest revision if
+// revision is negative, and checks them against the revision's root, which is
+// returned too. The leaves are in the same order as keys, with nil for keys
+// that have no value.
+func (c *MapClient) GetLeaves(ctx context.Context, keys [][]byte, revision int64) ([]*trillian.MapLeaf, trillian.SignedMapRoot, error) {
+	resp, err := c.client.GetMapLeavesWithProof(ctx, &trillian.GetMapLeavesRequest{MapId: c.mapID, Key: keys, Revision: revision})
+	if err != nil {
+		return nil, trillian.SignedMapRoot{}, err
+	}
+	if err := checkStatus(resp.Status); err != nil {
+		return nil, trillian.SignedMapRoot{}, err
+	}
+	if err := c.verifyRoot(resp.MapRoot); err != nil {
+		return nil, trillian.SignedMapRoot{}, err
+	}
+	root := *resp.MapRoot
+	if revision >= 0 && root.MapRevision != revision {
+		return nil, root, VerificationError{fmt.Errorf("got leaves of revision %d, want revision %d", root.MapRevision, revision)}
+	}
+
+	if len(resp.LeafProof) != len(keys) {
+		return nil, root, VerificationError{fmt.Errorf("got %d leaf proofs for %d keys", len(resp.LeafProof), len(keys))}
+	}
+	leaves := make([]*trillian.MapLeaf, len(keys))
+	for i, lp := range resp.LeafProof {
+		if lp == nil || !bytes.Equal(lp.Key, keys[i]) {
+			return nil, root, VerificationError{fmt.Errorf("proof %d isn't for key %q", i, keys[i])}
+		}
+		if err := c.verifyLeaf(root, lp); err != nil {
+			return nil, root, err
+		}
+		leaves[i] = lp.Leaf
+	}
+	return leaves, root, nil
+}
+
+// verifyLeaf checks the proof of a key's leaf, or that it has none, in root.
+func (c *MapClient) verifyLeaf(root trillian.SignedMapRoot, lp *trillian.MapLeafProof) error {
+	keyHash := c.hasher.HashKey(lp.Key)
+	proof := make([]trillian.Hash, 0, len(lp.Inclusion))
+	for _, p := range lp.Inclusion {
+		proof = append(proof, p)
+	}
+
+	if lp.Leaf == nil {
+		if err := merkle.VerifyMapExclusionProof(keyHash, root.RootHash, proof, c.hasher); err != nil {
+			return VerificationError{fmt.Errorf("proof that key %q has no value in revision %d is invalid: %v", lp.Key, root.MapRevision, err)}
+		}
+		return nil
+	}
+	if len(lp.Leaf.KeyHash) > 0 && !bytes.Equal(lp.Leaf.KeyHash, keyHash) {
+		return VerificationError{fmt.Errorf("leaf for key %q has key hash %x, want %x", lp.Key, lp.Leaf.KeyHash, keyHash)}
+	}
+	leafHash := c.hasher.HashLeaf(lp.Leaf.LeafValue)
+	if len(lp.Leaf.LeafHash) > 0 && !bytes.Equal(lp.Leaf.LeafHash, leafHash) {
+		return VerificationError{fmt.Errorf("leaf for key %q has leaf hash %x, want %x", lp.Key, lp.Leaf.LeafHash, leafHash)}
+	}
+	if err := merkle.VerifyMapInclusionProof(keyHash, leafHash, root.RootHash, proof, c.hasher); err != nil {
+		return VerificationError{fmt.Errorf("proof of key %q in revision %d is invalid: %v", lp.Key, root.MapRevision, err)}
+	}
+	return nil
+}
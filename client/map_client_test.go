@@ -0,0 +1,160 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/server/vmap"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/memory"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// mapServerClient calls a map server directly. Its tamper function, if set,
+// can change the responses to GetMapLeavesWithProof.
+type mapServerClient struct {
+	trillian.TrillianMapClient
+	server *vmap.TrillianMapServer
+	tamper func(*trillian.GetMapLeavesWithProofResponse)
+	// rootCalls counts the calls to GetSignedMapRootByRevision
+	rootCalls int
+}
+
+func (m *mapServerClient) GetSignedMapRoot(ctx context.Context, req *trillian.GetSignedMapRootRequest, opts ...grpc.CallOption) (*trillian.GetSignedMapRootResponse, error) {
+	return m.server.GetSignedMapRoot(ctx, req)
+}
+
+func (m *mapServerClient) GetSignedMapRootByRevision(ctx context.Context, req *trillian.GetSignedMapRootByRevisionRequest, opts ...grpc.CallOption) (*trillian.GetSignedMapRootResponse, error) {
+	m.rootCalls++
+	return m.server.GetSignedMapRootByRevision(ctx, req)
+}
+
+func (m *mapServerClient) GetMapLeavesWithProof(ctx context.Context, req *trillian.GetMapLeavesRequest, opts ...grpc.CallOption) (*trillian.GetMapLeavesWithProofResponse, error) {
+	resp, err := m.server.GetMapLeavesWithProof(ctx, req)
+	if err == nil && m.tamper != nil {
+		m.tamper(resp)
+	}
+	return resp, err
+}
+
+func setupMap(t *testing.T) (*mapServerClient, *ecdsa.PrivateKey) {
+	ctx := context.Background()
+	s, err := memory.NewMapStorage(memory.NewDatabase(), trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+	if err != nil {
+		t.Fatalf("Failed to create map storage: %v", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	server := vmap.NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return s, nil })
+	server.SetRootSigners(func(int64) (crypto.MapRootSigner, error) {
+		return crypto.NewTrillianSigner(trillian.NewSHA256(), trillian.SignatureAlgorithm_ECDSA, key), nil
+	})
+
+	if _, err := server.InitMap(ctx, &trillian.InitMapRequest{MapId: testMapID}); err != nil {
+		t.Fatalf("InitMap failed: %v", err)
+	}
+	for _, value := range []string{"value1", "value2"} {
+		req := &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: []*trillian.KeyValue{{Key: []byte("key"), Value: &trillian.MapLeaf{LeafValue: []byte(value)}}}}
+		if _, err := server.SetLeaves(ctx, req); err != nil {
+			t.Fatalf("SetLeaves failed: %v", err)
+		}
+	}
+	return &mapServerClient{server: server}, key
+}
+
+func TestMapClientGetLeaves(t *testing.T) {
+	m, key := setupMap(t)
+	c := NewMapClient(m, testMapID, merkle.NewMapHasher(merkle.NewRFC6962TreeHasher(trillian.NewSHA256())), key.Public())
+	ctx := context.Background()
+	keys := [][]byte{[]byte("key"), []byte("absent")}
+
+	for _, test := range []struct {
+		revision int64
+		want     string
+	}{
+		{revision: -1, want: "value2"},
+		{revision: 1, want: "value1"},
+		{revision: 0, want: ""},
+	} {
+		leaves, root, err := c.GetLeaves(ctx, keys, test.revision)
+		if err != nil {
+			t.Errorf("GetLeaves(%d) failed: %v", test.revision, err)
+			continue
+		}
+		if test.revision >= 0 && root.MapRevision != test.revision {
+			t.Errorf("GetLeaves(%d) returned root of revision %d", test.revision, root.MapRevision)
+		}
+		if len(leaves) != 2 || leaves[1] != nil {
+			t.Errorf("GetLeaves(%d) returned %v, want two leaves, the second nil", test.revision, leaves)
+			continue
+		}
+		if got := leaves[0]; (got == nil) != (test.want == "") || (got != nil && string(got.LeafValue) != test.want) {
+			t.Errorf("GetLeaves(%d) returned leaf %v, want value %q", test.revision, got, test.want)
+		}
+	}
+	if root, ok := c.Root(); !ok || root.MapRevision != 2 {
+		t.Errorf("Root() returned revision %d, %v, want 2", root.MapRevision, ok)
+	}
+
+	// Roots verified before are served from the cache
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetRootByRevision(ctx, 1); err != nil {
+			t.Fatalf("GetRootByRevision failed: %v", err)
+		}
+	}
+	if m.rootCalls != 0 {
+		t.Errorf("GetRootByRevision fetched the root %d times, want 0", m.rootCalls)
+	}
+	c.SetMaxCachedRoots(1)
+	if _, err := c.GetRootByRevision(ctx, 1); err != nil {
+		t.Fatalf("GetRootByRevision failed: %v", err)
+	}
+	if m.rootCalls != 1 {
+		t.Errorf("GetRootByRevision fetched the root %d times after eviction, want 1", m.rootCalls)
+	}
+}
+
+func TestMapClientRejectsBadProofs(t *testing.T) {
+	m, key := setupMap(t)
+	h := merkle.NewMapHasher(merkle.NewRFC6962TreeHasher(trillian.NewSHA256()))
+	ctx := context.Background()
+	keys := [][]byte{[]byte("key")}
+
+	for _, test := range []struct {
+		desc   string
+		tamper func(*trillian.GetMapLeavesWithProofResponse)
+	}{
+		{desc: "changed value", tamper: func(r *trillian.GetMapLeavesWithProofResponse) { r.LeafProof[0].Leaf.LeafValue = []byte("other") }},
+		{desc: "missing value", tamper: func(r *trillian.GetMapLeavesWithProofResponse) { r.LeafProof[0].Leaf = nil }},
+		{desc: "other key", tamper: func(r *trillian.GetMapLeavesWithProofResponse) { r.LeafProof[0].Key = []byte("other") }},
+		{desc: "no proofs", tamper: func(r *trillian.GetMapLeavesWithProofResponse) { r.LeafProof = nil }},
+		{desc: "changed root", tamper: func(r *trillian.GetMapLeavesWithProofResponse) { r.MapRoot.RootHash = h.EmptyHashes()[0] }},
+	} {
+		c := NewMapClient(m, testMapID, h, key.Public())
+		m.tamper = test.tamper
+		if _, _, err := c.GetLeaves(ctx, keys, -1); err == nil {
+			t.Errorf("GetLeaves accepted a response with %s", test.desc)
+		} else if _, ok := err.(VerificationError); !ok {
+			t.Errorf("GetLeaves with %s returned %v, want a VerificationError", test.desc, err)
+		}
+	}
+
+	// A different root for a cached revision is refused
+	m.tamper = nil
+	c := NewMapClient(m, testMapID, h, key.Public())
+	if _, _, err := c.GetLeaves(ctx, keys, -1); err != nil {
+		t.Fatalf("GetLeaves failed: %v", err)
+	}
+	m.tamper = func(r *trillian.GetMapLeavesWithProofResponse) { r.MapRoot.RootHash = h.EmptyHashes()[0] }
+	if _, _, err := c.GetLeaves(ctx, keys, -1); err == nil {
+		t.Errorf("GetLeaves accepted a second root for the same revision")
+	}
+}
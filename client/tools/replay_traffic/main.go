@@ -0,0 +1,116 @@
+// The replay_traffic command replays RPC traffic captured by a log or map
+// server's capture_file flag against test servers, with requests of the same
+// shape made up of random data. It reports the number of calls, errors and
+// latencies of each method, so that changes can be compared under a realistic
+// load. Replayed writes change the trees they're sent to, so it must not be
+// pointed at production servers.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/client/discovery"
+	"github.com/google/trillian/util/capture"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+var captureFileFlag = flag.String("capture_file", "", "File holding the captured traffic")
+var logServerFlag = flag.String("log_server", "", "Log server to replay log requests against, they're skipped if empty")
+var mapServerFlag = flag.String("map_server", "", "Map server to replay map requests against, they're skipped if empty")
+var treeIDsFlag = flag.String("tree_ids", "", "Comma separated list of captured=replayed tree ID pairs, for trees with different IDs in the test cluster")
+var speedFlag = flag.Float64("speed", 1, "Speed to replay at relative to the capture, zero replays as fast as possible")
+var seedFlag = flag.Int64("seed", 0, "Seed for the replayed data, zero for a random seed")
+
+// parseTreeIDs parses the tree_ids flag.
+func parseTreeIDs(s string) (map[int64]int64, error) {
+	ids := make(map[int64]int64)
+	if len(s) == 0 {
+		return ids, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.Split(pair, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid tree ID pair %q", pair)
+		}
+		from, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		to, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids[from] = to
+	}
+	return ids, nil
+}
+
+func main() {
+	flag.Parse()
+
+	f, err := os.Open(*captureFileFlag)
+	if err != nil {
+		log.Exitf("Failed to open capture: %v", err)
+	}
+	records, err := capture.ReadRecords(f)
+	f.Close()
+	if err != nil {
+		log.Exitf("Failed to read capture: %v", err)
+	}
+
+	treeIDs, err := parseTreeIDs(*treeIDsFlag)
+	if err != nil {
+		log.Exitf("Invalid tree_ids flag: %v", err)
+	}
+	seed := *seedFlag
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	p := &capture.Replayer{TreeIDs: treeIDs, Rand: rand.New(rand.NewSource(seed))}
+	if len(*logServerFlag) > 0 {
+		conn, err := discovery.DialTarget(*logServerFlag, grpc.WithInsecure())
+		if err != nil {
+			log.Exitf("Failed to dial log server: %v", err)
+		}
+		defer conn.Close()
+		p.Log = trillian.NewTrillianLogClient(conn)
+	}
+	if len(*mapServerFlag) > 0 {
+		conn, err := discovery.DialTarget(*mapServerFlag, grpc.WithInsecure())
+		if err != nil {
+			log.Exitf("Failed to dial map server: %v", err)
+		}
+		defer conn.Close()
+		p.Map = trillian.NewTrillianMapClient(conn)
+	}
+
+	fmt.Printf("Replaying %d requests with seed %d\n", len(records), seed)
+	start := time.Now()
+	result := p.Replay(context.Background(), records, *speedFlag)
+	fmt.Printf("Replayed in %v, skipped %d requests\n", time.Since(start), result.Skipped)
+
+	methods := make([]string, 0, len(result.Methods))
+	for method := range result.Methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tCALLS\tERRORS\tMEAN\tMAX")
+	for _, method := range methods {
+		m := result.Methods[method]
+		mean := time.Duration(m.TotalNanos / int64(m.Calls))
+		fmt.Fprintf(w, "%s\t%d\t%d\t%v\t%v\n", method, m.Calls, m.Errors, mean, time.Duration(m.MaxNanos))
+	}
+	w.Flush()
+}
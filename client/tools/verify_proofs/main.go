@@ -0,0 +1,497 @@
+// The verify_proofs command checks signed roots and proofs from a log or map,
+// so auditors can confirm what a server has committed to without trusting it.
+// Usage:
+//
+//	verify_proofs [flags] <command>
+//
+// where command is one of:
+//
+//	root         check the signature of a log root
+//	inclusion    check a leaf is included in a log root
+//	consistency  check a log root is consistent with an older one
+//	map          check the inclusion, or non-inclusion, of keys in a map root
+//
+// Roots and proofs are fetched from the server flag, or read from files holding
+// the JSON encoding of the API messages, so that evidence saved earlier can be
+// checked offline. Root signatures are checked with the public_key flag, or
+// with the threshold_keys and threshold flags for threshold signed log roots.
+// Leaf hashes are recalculated from the leaf data rather than trusted.
+package main
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/client/discovery"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/signer"
+	"github.com/google/trillian/storage"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+var serverFlag = flag.String("server", "", "Log or map server to fetch roots and proofs from, if they aren't read from files")
+var treeIDFlag = flag.Int64("tree_id", 0, "ID of the log or map to fetch from the server")
+var timeoutFlag = flag.Duration("timeout", 10*time.Second, "Deadline for fetching from the server")
+var publicKeyFlag = flag.String("public_key", "", "PEM file holding the public key that signs the tree's roots. If neither this nor tree_keys_file is set, the tree's keys are fetched from the server")
+var treeKeysFileFlag = flag.String("tree_keys_file", "", "File holding a GetTreeKeysResponse with the keys that sign the tree's roots, each used from its activation time")
+var thresholdKeysFlag = flag.String("threshold_keys", "", "Comma separated PEM files holding the public keys of the signers, in key index order, for logs whose roots have threshold signatures")
+var thresholdFlag = flag.Int("threshold", 0, "How many of threshold_keys must have signed a log root")
+var hashAlgorithmFlag = flag.String("hash_algorithm", trillian.HashAlgorithm_SHA256.String(), "Hash algorithm of the tree, SHA256 or SHA512. A map's proofs are as long as its key hashes")
+var hashStrategyFlag = flag.String("hash_strategy", trillian.HashStrategy_RFC6962.String(), "Hash strategy of the tree, RFC6962, SHA512_256 or LIE_SHA512_256")
+var leafHashPrefixFlag = flag.String("leaf_hash_prefix", "", "Hex encoded domain separation prefix for leaf hashes, empty for RFC 6962")
+var nodeHashPrefixFlag = flag.String("node_hash_prefix", "", "Hex encoded domain separation prefix for node hashes, empty for RFC 6962")
+var rootFileFlag = flag.String("root_file", "", "File holding a SignedLogRoot or SignedMapRoot, instead of fetching the latest root")
+var oldRootFileFlag = flag.String("old_root_file", "", "File holding the older SignedLogRoot, for consistency")
+var proofFileFlag = flag.String("proof_file", "", "File holding a GetEntryAndProofResponse, GetConsistencyProofResponse or GetMapLeavesResponse, instead of fetching the proof")
+var leafIndexFlag = flag.Int64("leaf_index", -1, "Index of the leaf to fetch for inclusion")
+var leafHashFlag = flag.String("leaf_hash", "", "Hex encoded hash the leaf's data is expected to have, for inclusion")
+var keysFlag = flag.String("keys", "", "Comma separated map keys to fetch for map")
+var absentFlag = flag.Bool("absent", false, "If true map checks that the keys are not in the map, rather than that they are")
+
+// commands maps each command name to the function that runs it.
+var commands = map[string]func(*verifier) error{
+	"root":        verifyRoot,
+	"inclusion":   verifyInclusion,
+	"consistency": verifyConsistency,
+	"map":         verifyMap,
+}
+
+// verifier holds what's needed to fetch and check roots and proofs.
+type verifier struct {
+	th   merkle.TreeHasher
+	conn *grpc.ClientConn
+	// keys are those that sign the tree's roots, nil until they're known
+	keys      *crypto.KeySet
+	threshold *signer.ThresholdVerifier
+}
+
+// loadPublicKey reads the PEM encoded public key in path.
+func loadPublicKey(path string) (gocrypto.PublicKey, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPublicKey(string(pem)); err != nil {
+		return nil, err
+	}
+	return km.GetPublicKey()
+}
+
+// newVerifier creates a verifier from the flags. It only connects to a server
+// if one is given.
+func newVerifier() (*verifier, error) {
+	alg, ok := trillian.HashAlgorithm_value[*hashAlgorithmFlag]
+	if !ok {
+		return nil, fmt.Errorf("unknown hash_algorithm: %s", *hashAlgorithmFlag)
+	}
+	strategy, ok := trillian.HashStrategy_value[*hashStrategyFlag]
+	if !ok {
+		return nil, fmt.Errorf("unknown hash_strategy: %s", *hashStrategyFlag)
+	}
+	var prefixes storage.TreeHashPrefixes
+	var err error
+	if prefixes.Leaf, err = hex.DecodeString(*leafHashPrefixFlag); err != nil {
+		return nil, fmt.Errorf("invalid leaf_hash_prefix: %v", err)
+	}
+	if prefixes.Node, err = hex.DecodeString(*nodeHashPrefixFlag); err != nil {
+		return nil, fmt.Errorf("invalid node_hash_prefix: %v", err)
+	}
+	th, err := merkle.NewTreeHasherForStrategy(trillian.HashStrategy(strategy), trillian.HashAlgorithm(alg), prefixes)
+	if err != nil {
+		return nil, err
+	}
+	v := &verifier{th: th}
+
+	switch {
+	case len(*publicKeyFlag) > 0:
+		publicKey, err := loadPublicKey(*publicKeyFlag)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = crypto.NewKeySetForKey(publicKey)
+	case len(*treeKeysFileFlag) > 0:
+		resp := &trillian.GetTreeKeysResponse{}
+		if err := readMessage(*treeKeysFileFlag, resp); err != nil {
+			return nil, err
+		}
+		if v.keys, err = crypto.NewKeySet(resp.Keys); err != nil {
+			return nil, fmt.Errorf("invalid tree keys: %v", err)
+		}
+	}
+
+	if len(*thresholdKeysFlag) > 0 {
+		var keys []gocrypto.PublicKey
+		for _, path := range strings.Split(*thresholdKeysFlag, ",") {
+			key, err := loadPublicKey(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load threshold key %s: %v", path, err)
+			}
+			keys = append(keys, key)
+		}
+		// Roots are signed over their SHA-256 hash, whatever the tree's hashing
+		if v.threshold, err = signer.NewThresholdVerifier(keys, *thresholdFlag, trillian.NewSHA256()); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(*serverFlag) > 0 {
+		conn, err := discovery.DialTarget(*serverFlag, grpc.WithInsecure())
+		if err != nil {
+			return nil, err
+		}
+		v.conn = conn
+	}
+	return v, nil
+}
+
+// readMessage reads a message from a file holding its JSON encoding.
+func readMessage(path string, m proto.Message) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := jsonpb.Unmarshal(f, m); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return nil
+}
+
+// fetch calls f with a context that expires after the timeout flag, failing if
+// there is no server to call.
+func (v *verifier) fetch(what string, f func(ctx context.Context) error) error {
+	if v.conn == nil {
+		return fmt.Errorf("%s must be read from a file if server isn't set", what)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeoutFlag)
+	defer cancel()
+	if err := f(ctx); err != nil {
+		return fmt.Errorf("failed to fetch %s: %v", what, err)
+	}
+	return nil
+}
+
+// rootKeys returns the keys that sign the tree's roots, fetching them from the
+// log or map server if they weren't given by the flags.
+func (v *verifier) rootKeys(isMap bool) (*crypto.KeySet, error) {
+	if v.keys != nil {
+		return v.keys, nil
+	}
+	var keys []*trillian.TreeKey
+	err := v.fetch("tree keys", func(ctx context.Context) error {
+		req := &trillian.GetTreeKeysRequest{TreeId: *treeIDFlag}
+		var resp *trillian.GetTreeKeysResponse
+		var err error
+		if isMap {
+			resp, err = trillian.NewTrillianMapClient(v.conn).GetTreeKeys(ctx, req)
+		} else {
+			resp, err = trillian.NewTrillianLogClient(v.conn).GetTreeKeys(ctx, req)
+		}
+		if err == nil {
+			keys = resp.Keys
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("public_key or tree_keys_file must be set to check roots: %v", err)
+	}
+	if v.keys, err = crypto.NewKeySet(keys); err != nil {
+		return nil, fmt.Errorf("invalid tree keys: %v", err)
+	}
+	return v.keys, nil
+}
+
+// logRoot returns the log root read from path, or the latest root from the
+// server if path is empty, after checking its signature.
+func (v *verifier) logRoot(path string) (*trillian.SignedLogRoot, error) {
+	root := &trillian.SignedLogRoot{}
+	if len(path) > 0 {
+		if err := readMessage(path, root); err != nil {
+			return nil, err
+		}
+	} else {
+		err := v.fetch("log root", func(ctx context.Context) error {
+			resp, err := trillian.NewTrillianLogClient(v.conn).GetLatestSignedLogRoot(ctx, &trillian.GetLatestSignedLogRootRequest{LogId: *treeIDFlag})
+			if err == nil {
+				root = resp.SignedLogRoot
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if root == nil || root.Signature == nil {
+		return nil, errors.New("log root is not signed")
+	}
+	if root.Signature.SignatureAlgorithm == trillian.SignatureAlgorithm_THRESHOLD {
+		if v.threshold == nil {
+			return nil, errors.New("threshold_keys must be set to check threshold signed log roots")
+		}
+		if err := v.threshold.VerifyLogRoot(*root, *root.Signature); err != nil {
+			return nil, fmt.Errorf("log root threshold signature is invalid: %v", err)
+		}
+	} else {
+		keys, err := v.rootKeys(false)
+		if err != nil {
+			return nil, err
+		}
+		if err := keys.VerifyLogRoot(trillian.NewSHA256(), *root); err != nil {
+			return nil, fmt.Errorf("log root signature is invalid: %v", err)
+		}
+	}
+	fmt.Printf("Log root signature OK: tree size %d, root hash %x, signed at %v\n", root.TreeSize, root.RootHash, time.Unix(0, root.TimestampNanos).UTC())
+	return root, nil
+}
+
+// proofHashes returns the hashes of the nodes in a proof.
+func proofHashes(proof *trillian.ProofProto) []trillian.Hash {
+	if proof == nil {
+		return nil
+	}
+	hashes := make([]trillian.Hash, 0, len(proof.ProofNode))
+	for _, node := range proof.ProofNode {
+		hashes = append(hashes, node.NodeHash)
+	}
+	return hashes
+}
+
+func verifyRoot(v *verifier) error {
+	_, err := v.logRoot(*rootFileFlag)
+	return err
+}
+
+func verifyInclusion(v *verifier) error {
+	root, err := v.logRoot(*rootFileFlag)
+	if err != nil {
+		return err
+	}
+
+	resp := &trillian.GetEntryAndProofResponse{}
+	if len(*proofFileFlag) > 0 {
+		err = readMessage(*proofFileFlag, resp)
+	} else {
+		if *leafIndexFlag < 0 {
+			return errors.New("leaf_index must be set to fetch a proof")
+		}
+		err = v.fetch("inclusion proof", func(ctx context.Context) error {
+			req := &trillian.GetEntryAndProofRequest{LogId: *treeIDFlag, LeafIndex: *leafIndexFlag, TreeSize: root.TreeSize}
+			var err error
+			resp, err = trillian.NewTrillianLogClient(v.conn).GetEntryAndProof(ctx, req)
+			return err
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if resp.Leaf == nil || resp.Proof == nil {
+		return errors.New("response doesn't hold a leaf and proof")
+	}
+
+	// The proof is checked against the hash of the leaf's data, so the server
+	// can't prove the inclusion of different data than it returned
+	leafHash := v.th.HashLeaf(resp.Leaf.LeafData)
+	if len(resp.Leaf.LeafHash) > 0 && !bytes.Equal(resp.Leaf.LeafHash, leafHash) {
+		return fmt.Errorf("leaf %d has hash %x, but its data hashes to %x", resp.Proof.LeafIndex, resp.Leaf.LeafHash, leafHash)
+	}
+	if len(*leafHashFlag) > 0 {
+		want, err := hex.DecodeString(*leafHashFlag)
+		if err != nil {
+			return fmt.Errorf("invalid leaf_hash: %v", err)
+		}
+		if !bytes.Equal(leafHash, want) {
+			return fmt.Errorf("leaf %d has hash %x, expected %x", resp.Proof.LeafIndex, leafHash, want)
+		}
+	}
+
+	if err := merkle.NewLogVerifier(v.th).VerifyInclusionProof(resp.Proof.LeafIndex, root.TreeSize, proofHashes(resp.Proof), root.RootHash, leafHash); err != nil {
+		return fmt.Errorf("inclusion proof is invalid: %v", err)
+	}
+	fmt.Printf("Inclusion OK: leaf %d with hash %x is in the tree of size %d\n", resp.Proof.LeafIndex, leafHash, root.TreeSize)
+	return nil
+}
+
+func verifyConsistency(v *verifier) error {
+	if len(*oldRootFileFlag) == 0 {
+		return errors.New("old_root_file must be set")
+	}
+	oldRoot, err := v.logRoot(*oldRootFileFlag)
+	if err != nil {
+		return err
+	}
+	root, err := v.logRoot(*rootFileFlag)
+	if err != nil {
+		return err
+	}
+
+	var proof *trillian.ProofProto
+	switch {
+	case len(*proofFileFlag) > 0:
+		resp := &trillian.GetConsistencyProofResponse{}
+		if err := readMessage(*proofFileFlag, resp); err != nil {
+			return err
+		}
+		proof = resp.Proof
+	case oldRoot.TreeSize > 0 && oldRoot.TreeSize < root.TreeSize:
+		// The server can't give proofs from the empty tree or between equal sizes,
+		// but they don't need any nodes
+		err := v.fetch("consistency proof", func(ctx context.Context) error {
+			req := &trillian.GetConsistencyProofRequest{LogId: *treeIDFlag, FirstTreeSize: oldRoot.TreeSize, SecondTreeSize: root.TreeSize}
+			resp, err := trillian.NewTrillianLogClient(v.conn).GetConsistencyProof(ctx, req)
+			if err == nil {
+				proof = resp.Proof
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := merkle.NewLogVerifier(v.th).VerifyConsistencyProof(oldRoot.TreeSize, root.TreeSize, oldRoot.RootHash, root.RootHash, proofHashes(proof)); err != nil {
+		return fmt.Errorf("consistency proof is invalid: %v", err)
+	}
+	fmt.Printf("Consistency OK: the tree of size %d is a prefix of the tree of size %d\n", oldRoot.TreeSize, root.TreeSize)
+	return nil
+}
+
+func verifyMap(v *verifier) error {
+	root := &trillian.SignedMapRoot{}
+	if len(*rootFileFlag) > 0 {
+		if err := readMessage(*rootFileFlag, root); err != nil {
+			return err
+		}
+	} else {
+		err := v.fetch("map root", func(ctx context.Context) error {
+			resp, err := trillian.NewTrillianMapClient(v.conn).GetSignedMapRoot(ctx, &trillian.GetSignedMapRootRequest{MapId: *treeIDFlag})
+			if err == nil && resp.MapRoot != nil {
+				root = resp.MapRoot
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if root == nil || root.Signature == nil {
+		return errors.New("map root is not signed")
+	}
+	keys, err := v.rootKeys(true)
+	if err != nil {
+		return err
+	}
+	if err := keys.VerifyMapRoot(trillian.NewSHA256(), *root); err != nil {
+		return fmt.Errorf("map root signature is invalid: %v", err)
+	}
+	fmt.Printf("Map root signature OK: revision %d, root hash %x, signed at %v\n", root.MapRevision, root.RootHash, time.Unix(0, root.TimestampNanos).UTC())
+
+	resp := &trillian.GetMapLeavesResponse{}
+	if len(*proofFileFlag) > 0 {
+		if err := readMessage(*proofFileFlag, resp); err != nil {
+			return err
+		}
+	} else {
+		if len(*keysFlag) == 0 {
+			return errors.New("keys must be set to fetch proofs")
+		}
+		err := v.fetch("map leaves", func(ctx context.Context) error {
+			req := &trillian.GetMapLeavesRequest{MapId: *treeIDFlag, Revision: root.MapRevision}
+			for _, key := range bytes.Split([]byte(*keysFlag), []byte(",")) {
+				req.Key = append(req.Key, key)
+			}
+			var err error
+			resp, err = trillian.NewTrillianMapClient(v.conn).GetLeaves(ctx, req)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(resp.KeyValue) == 0 {
+		// The server only returns the keys it holds, with no proof for the others
+		return errors.New("no proofs to check")
+	}
+
+	h := merkle.NewMapHasher(v.th)
+	for _, kvi := range resp.KeyValue {
+		if kvi.KeyValue == nil {
+			return errors.New("proof doesn't name its key")
+		}
+		key := kvi.KeyValue.Key
+		// A key that's not in the map has an empty leaf
+		var value []byte
+		if kvi.KeyValue.Value != nil {
+			value = kvi.KeyValue.Value.LeafValue
+		}
+		if absent := len(value) == 0; absent != *absentFlag {
+			if absent {
+				return fmt.Errorf("key %q is not in the map", key)
+			}
+			return fmt.Errorf("key %q is in the map", key)
+		}
+
+		// As for log leaves the hash is recalculated from the value. A key
+		// with no leaf has the tree's hash of an absent leaf
+		leafHash := h.HashEmptyLeaf()
+		if kvi.KeyValue.Value != nil {
+			leafHash = h.HashLeaf(value)
+			if len(kvi.KeyValue.Value.LeafHash) > 0 && !bytes.Equal(kvi.KeyValue.Value.LeafHash, leafHash) {
+				return fmt.Errorf("key %q has leaf hash %x, but its value hashes to %x", key, kvi.KeyValue.Value.LeafHash, leafHash)
+			}
+		}
+
+		proof := make([]trillian.Hash, 0, len(kvi.Inclusion))
+		for _, p := range kvi.Inclusion {
+			proof = append(proof, p)
+		}
+		if err := merkle.VerifyMapInclusionProof(h.HashKey(key), leafHash, root.RootHash, proof, h); err != nil {
+			return fmt.Errorf("proof for key %q is invalid: %v", key, err)
+		}
+		if *absentFlag {
+			fmt.Printf("Non-inclusion OK: key %q is not in map revision %d\n", key, root.MapRevision)
+		} else {
+			fmt.Printf("Inclusion OK: key %q has value %x in map revision %d\n", key, value, root.MapRevision)
+		}
+	}
+	return nil
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Exitf("Usage: verify_proofs [flags] <command>, where command is one of root, inclusion, consistency or map")
+	}
+	command, ok := commands[flag.Arg(0)]
+	if !ok {
+		log.Exitf("Unknown command: %s", flag.Arg(0))
+	}
+
+	v, err := newVerifier()
+	if err != nil {
+		log.Exitf("Failed to set up: %v", err)
+	}
+	err = command(v)
+	if v.conn != nil {
+		v.conn.Close()
+	}
+	if err != nil {
+		log.Exitf("%s failed: %v", flag.Arg(0), err)
+	}
+}
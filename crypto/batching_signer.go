@@ -0,0 +1,165 @@
+package crypto
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+)
+
+// LogRootBatchSigner signs several log roots in one request, for signing
+// backends where each request is slow or counts against a quota. The
+// signatures are returned in the same order as the roots.
+type LogRootBatchSigner interface {
+	SignLogRoots(roots []trillian.SignedLogRoot) ([]trillian.DigitallySigned, error)
+}
+
+// LogRootBatchConsistencySigner is a LogRootBatchSigner which also signs a
+// batch of roots along with the consistency proofs a LogRootConsistencySigner
+// needs. proofs holds the proof function for each root, nil where there's none.
+type LogRootBatchConsistencySigner interface {
+	LogRootBatchSigner
+	SignLogRootsConsistent(roots []trillian.SignedLogRoot, proofs []ConsistencyProofFunc) ([]trillian.DigitallySigned, error)
+}
+
+// signRequest is a root waiting to be signed as part of a batch.
+type signRequest struct {
+	root      trillian.SignedLogRoot
+	proof     ConsistencyProofFunc
+	signature trillian.DigitallySigned
+	err       error
+	done      chan struct{}
+}
+
+// rootBatch collects the requests made while it's open.
+type rootBatch struct {
+	requests []*signRequest
+	// full is closed when the batch reaches its maximum size
+	full chan struct{}
+}
+
+// BatchingRootSigner groups the roots that are signed at around the same time,
+// usually for different trees, into batches signed with a single request. If a
+// batch can't be signed each of its roots is signed separately instead, so a
+// problem with one tree doesn't stop the others being signed. It's a
+// LogRootKeySigner, passing on the key signatures of whichever of its signers
+// is one.
+type BatchingRootSigner struct {
+	signer      LogRootSigner
+	batchSigner LogRootBatchSigner
+	maxBatch    int
+	maxWait     time.Duration
+
+	// Must hold this lock before accessing current
+	mu sync.Mutex
+	// current is the batch that new requests join, nil if there isn't one open
+	current *rootBatch
+}
+
+// NewBatchingRootSigner creates a BatchingRootSigner that signs batches of up
+// to maxBatch roots with batchSigner, and falls back to signer for single roots
+// and failed batches. A batch is signed once it's full, or maxWait after its
+// first root was added.
+func NewBatchingRootSigner(signer LogRootSigner, batchSigner LogRootBatchSigner, maxBatch int, maxWait time.Duration) *BatchingRootSigner {
+	return &BatchingRootSigner{signer: signer, batchSigner: batchSigner, maxBatch: maxBatch, maxWait: maxWait}
+}
+
+// SignLogRoot adds root to the open batch, and waits for the batch to be signed.
+// The caller that opens a batch signs it on behalf of all the others.
+func (b *BatchingRootSigner) SignLogRoot(root trillian.SignedLogRoot) (trillian.DigitallySigned, error) {
+	return b.SignLogRootConsistent(root, nil)
+}
+
+// SignLogRootConsistent is like SignLogRoot, but passes proof on to signers
+// that need roots to be proven consistent with those they signed before.
+func (b *BatchingRootSigner) SignLogRootConsistent(root trillian.SignedLogRoot, proof ConsistencyProofFunc) (trillian.DigitallySigned, error) {
+	req := &signRequest{root: root, proof: proof, done: make(chan struct{})}
+
+	b.mu.Lock()
+	opened := b.current == nil
+	if opened {
+		b.current = &rootBatch{full: make(chan struct{})}
+	}
+	batch := b.current
+	batch.requests = append(batch.requests, req)
+	if len(batch.requests) >= b.maxBatch {
+		// No more requests can join, so it can be signed straight away
+		b.current = nil
+		close(batch.full)
+	}
+	b.mu.Unlock()
+
+	if opened {
+		select {
+		case <-batch.full:
+		case <-time.After(b.maxWait):
+			b.mu.Lock()
+			if b.current == batch {
+				b.current = nil
+			}
+			b.mu.Unlock()
+		}
+		b.sign(batch.requests)
+	}
+
+	<-req.done
+	return req.signature, req.err
+}
+
+// KeySignLogRoot returns the signatures of root by keys that aren't active yet,
+// made by the batch signer if it's a LogRootKeySigner, or else by the signer of
+// single roots if that is. There are none if neither is.
+func (b *BatchingRootSigner) KeySignLogRoot(root trillian.SignedLogRoot) ([]*trillian.KeySignature, error) {
+	if k, ok := b.batchSigner.(LogRootKeySigner); ok {
+		return k.KeySignLogRoot(root)
+	}
+	if k, ok := b.signer.(LogRootKeySigner); ok {
+		return k.KeySignLogRoot(root)
+	}
+	return nil, nil
+}
+
+// sign signs the roots of a closed batch, and completes its requests.
+func (b *BatchingRootSigner) sign(requests []*signRequest) {
+	defer func() {
+		for _, req := range requests {
+			close(req.done)
+		}
+	}()
+
+	if len(requests) > 1 {
+		roots := make([]trillian.SignedLogRoot, 0, len(requests))
+		proofs := make([]ConsistencyProofFunc, 0, len(requests))
+		for _, req := range requests {
+			roots = append(roots, req.root)
+			proofs = append(proofs, req.proof)
+		}
+		var signatures []trillian.DigitallySigned
+		var err error
+		if c, ok := b.batchSigner.(LogRootBatchConsistencySigner); ok {
+			signatures, err = c.SignLogRootsConsistent(roots, proofs)
+		} else {
+			signatures, err = b.batchSigner.SignLogRoots(roots)
+		}
+		if err == nil && len(signatures) != len(roots) {
+			err = fmt.Errorf("got %d signatures for %d roots", len(signatures), len(roots))
+		}
+		if err == nil {
+			for i, req := range requests {
+				req.signature = signatures[i]
+			}
+			return
+		}
+		glog.Warningf("Failed to sign batch of %d roots, signing them separately: %v", len(roots), err)
+	}
+
+	for _, req := range requests {
+		if c, ok := b.signer.(LogRootConsistencySigner); ok {
+			req.signature, req.err = c.SignLogRootConsistent(req.root, req.proof)
+			continue
+		}
+		req.signature, req.err = b.signer.SignLogRoot(req.root)
+	}
+}
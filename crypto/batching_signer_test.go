@@ -0,0 +1,143 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+)
+
+// fakeRootSigner signs each root with its tree size, and records the requests.
+type fakeRootSigner struct {
+	mu         sync.Mutex
+	batches    [][]trillian.SignedLogRoot
+	singles    []trillian.SignedLogRoot
+	batchErr   error
+	failedSize int64
+}
+
+func signatureFor(root trillian.SignedLogRoot) trillian.DigitallySigned {
+	return trillian.DigitallySigned{Signature: []byte(fmt.Sprint(root.TreeSize))}
+}
+
+func (f *fakeRootSigner) SignLogRoot(root trillian.SignedLogRoot) (trillian.DigitallySigned, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.singles = append(f.singles, root)
+	if root.TreeSize == f.failedSize {
+		return trillian.DigitallySigned{}, errors.New("signing failed")
+	}
+	return signatureFor(root), nil
+}
+
+func (f *fakeRootSigner) SignLogRoots(roots []trillian.SignedLogRoot) ([]trillian.DigitallySigned, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batches = append(f.batches, roots)
+	if f.batchErr != nil {
+		return nil, f.batchErr
+	}
+	signatures := make([]trillian.DigitallySigned, 0, len(roots))
+	for _, root := range roots {
+		signatures = append(signatures, signatureFor(root))
+	}
+	return signatures, nil
+}
+
+// signConcurrently signs a root of each size at the same time, and returns
+// the errors keyed by size.
+func signConcurrently(t *testing.T, b *BatchingRootSigner, sizes ...int64) map[int64]error {
+	var mu sync.Mutex
+	errs := make(map[int64]error)
+	var wg sync.WaitGroup
+	for _, size := range sizes {
+		wg.Add(1)
+		go func(size int64) {
+			defer wg.Done()
+			root := trillian.SignedLogRoot{TreeSize: size}
+			signature, err := b.SignLogRoot(root)
+			if err == nil && string(signature.Signature) != string(signatureFor(root).Signature) {
+				t.Errorf("Root of size %d got signature %q", size, signature.Signature)
+			}
+			mu.Lock()
+			errs[size] = err
+			mu.Unlock()
+		}(size)
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestBatchingRootSignerBatches(t *testing.T) {
+	f := &fakeRootSigner{}
+	// The batch is signed when full, long before maxWait
+	b := NewBatchingRootSigner(f, f, 3, time.Hour)
+
+	for size, err := range signConcurrently(t, b, 1, 2, 3) {
+		if err != nil {
+			t.Errorf("SignLogRoot(%d) failed: %v", size, err)
+		}
+	}
+	if len(f.batches) != 1 || len(f.batches[0]) != 3 || len(f.singles) != 0 {
+		t.Fatalf("Got batches %v and single roots %v, want one batch of 3", f.batches, f.singles)
+	}
+}
+
+func TestBatchingRootSignerSignsSingleRootsAlone(t *testing.T) {
+	f := &fakeRootSigner{}
+	b := NewBatchingRootSigner(f, f, 3, time.Millisecond)
+
+	signature, err := b.SignLogRoot(trillian.SignedLogRoot{TreeSize: 5})
+	if err != nil {
+		t.Fatalf("SignLogRoot failed: %v", err)
+	}
+	if got, want := string(signature.Signature), "5"; got != want {
+		t.Fatalf("SignLogRoot returned signature %q, want %q", got, want)
+	}
+	if len(f.batches) != 0 || len(f.singles) != 1 {
+		t.Fatalf("Got batches %v and single roots %v, want one single root", f.batches, f.singles)
+	}
+}
+
+func TestBatchingRootSignerFallsBack(t *testing.T) {
+	f := &fakeRootSigner{batchErr: errors.New("quota exceeded"), failedSize: 2}
+	b := NewBatchingRootSigner(f, f, 3, time.Hour)
+
+	// Each root is signed separately after the batch fails, and only the root
+	// that can't be signed gets an error
+	errs := signConcurrently(t, b, 1, 2, 3)
+	for size, err := range errs {
+		if got, want := err != nil, size == 2; got != want {
+			t.Errorf("SignLogRoot(%d) returned error %v, want error: %v", size, err, want)
+		}
+	}
+	if len(f.batches) != 1 || len(f.singles) != 3 {
+		t.Fatalf("Got %d batches and %d single roots, want 1 and 3", len(f.batches), len(f.singles))
+	}
+}
+
+// fakeKeyRootSigner is a fakeRootSigner which also has a key waiting to be
+// activated.
+type fakeKeyRootSigner struct {
+	fakeRootSigner
+}
+
+func (f *fakeKeyRootSigner) KeySignLogRoot(root trillian.SignedLogRoot) ([]*trillian.KeySignature, error) {
+	signature := signatureFor(root)
+	return []*trillian.KeySignature{{KeyId: "next", Signature: &signature}}, nil
+}
+
+func TestBatchingRootSignerKeySigns(t *testing.T) {
+	root := trillian.SignedLogRoot{TreeSize: 4}
+	f := &fakeRootSigner{}
+	if keySignatures, err := NewBatchingRootSigner(f, f, 3, time.Hour).KeySignLogRoot(root); err != nil || len(keySignatures) != 0 {
+		t.Errorf("KeySignLogRoot()=%v, %v, want no signatures without a key signer", keySignatures, err)
+	}
+	k := &fakeKeyRootSigner{}
+	if keySignatures, err := NewBatchingRootSigner(f, k, 3, time.Hour).KeySignLogRoot(root); err != nil || len(keySignatures) != 1 || keySignatures[0].KeyId != "next" {
+		t.Errorf("KeySignLogRoot()=%v, %v, want a signature by next", keySignatures, err)
+	}
+}
@@ -3,6 +3,9 @@ package crypto
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -11,9 +14,11 @@ import (
 	"io/ioutil"
 
 	"github.com/golang/glog"
+	"github.com/google/trillian"
 )
 
-// KeyManager loads and holds our private and public keys. Should support ECDSA and RSA keys.
+// KeyManager loads and holds our private and public keys. Should support ECDSA, RSA and
+// Ed25519 keys.
 // The crypto.Signer API allows for obtaining a public key from a private key but there are
 // cases where we have the public key only, such as mirroring another log, so we treat them
 // separately. KeyManager is an interface as we expect multiple implementations supporting
@@ -107,7 +112,7 @@ func (k PEMKeyManager) Signer() (crypto.Signer, error) {
 	// Good old interface{}, this wouldn't be necessary in a proper type system. If it's
 	// even the right thing to do but I couldn't find any useful docs so meh
 	switch k.serverPrivateKey.(type) {
-	case *ecdsa.PrivateKey, *rsa.PrivateKey:
+	case *ecdsa.PrivateKey, *rsa.PrivateKey, ed25519.PrivateKey:
 		return k.serverPrivateKey.(crypto.Signer), nil
 	}
 
@@ -143,7 +148,7 @@ func parsePrivateKey(key []byte) (crypto.PrivateKey, error) {
 	}
 	if key, err := x509.ParsePKCS8PrivateKey(key); err == nil {
 		switch key := key.(type) {
-		case *ecdsa.PrivateKey, *rsa.PrivateKey:
+		case *ecdsa.PrivateKey, *rsa.PrivateKey, ed25519.PrivateKey:
 			return key, nil
 		default:
 			return nil, fmt.Errorf("unknown private key type: %T", key)
@@ -180,3 +185,70 @@ func LoadPasswordProtectedPrivateKey(keyFile, keyPassword string) (KeyManager, e
 
 	return *km, nil
 }
+
+// LoadPublicKeyFile returns the public key held PEM encoded in keyFile.
+func LoadPublicKeyFile(keyFile string) (crypto.PublicKey, error) {
+	pemData, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data from key file: %s because: %v", keyFile, err)
+	}
+
+	km := NewPEMKeyManager()
+	if err := km.LoadPublicKey(string(pemData)); err != nil {
+		return nil, err
+	}
+	return km.GetPublicKey()
+}
+
+// GenerateKey creates a new private key for signing with algorithm, which may
+// be ECDSA, using the P-256 curve, RSA, with 2048 bits, or ED25519.
+func GenerateKey(algorithm trillian.SignatureAlgorithm) (crypto.Signer, error) {
+	switch algorithm {
+	case trillian.SignatureAlgorithm_ECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case trillian.SignatureAlgorithm_RSA:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case trillian.SignatureAlgorithm_ED25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("can't generate keys for signature algorithm %v", algorithm)
+}
+
+// SignatureAlgorithmForKey returns the algorithm of the signatures made with
+// the private key of pub.
+func SignatureAlgorithmForKey(pub crypto.PublicKey) (trillian.SignatureAlgorithm, error) {
+	switch pub.(type) {
+	case *ecdsa.PublicKey:
+		return trillian.SignatureAlgorithm_ECDSA, nil
+	case *rsa.PublicKey:
+		return trillian.SignatureAlgorithm_RSA, nil
+	case ed25519.PublicKey:
+		return trillian.SignatureAlgorithm_ED25519, nil
+	}
+	return trillian.SignatureAlgorithm_ECDSA, fmt.Errorf("unsupported key type: %T", pub)
+}
+
+// MarshalPrivateKey PEM encodes a private key in PKCS #8 form, encrypted with
+// password, so it can be read by LoadPasswordProtectedPrivateKey.
+func MarshalPrivateKey(key crypto.Signer, password string) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	block, err := x509.EncryptPEMBlock(rand.Reader, "PRIVATE KEY", der, []byte(password), x509.PEMCipherAES256)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// MarshalPublicKey PEM encodes a public key, so it can be read by
+// LoadPublicKey.
+func MarshalPublicKey(pub crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
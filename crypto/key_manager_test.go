@@ -92,3 +92,50 @@ func TestLoadDemoECDSAPublicKey(t *testing.T) {
 		t.Fatalf("Expected to have loaded an ECDSA key but got: %v", key)
 	}
 }
+
+func TestGenerateKeyRoundTrip(t *testing.T) {
+	hasher := trillian.NewSHA256()
+	root := trillian.SignedLogRoot{TimestampNanos: 1000, RootHash: []byte("root"), TreeSize: 42}
+	for _, algorithm := range []trillian.SignatureAlgorithm{trillian.SignatureAlgorithm_ECDSA, trillian.SignatureAlgorithm_RSA, trillian.SignatureAlgorithm_ED25519} {
+		key, err := GenerateKey(algorithm)
+		if err != nil {
+			t.Fatalf("GenerateKey(%v) failed: %v", algorithm, err)
+		}
+		privatePEM, err := MarshalPrivateKey(key, "towel")
+		if err != nil {
+			t.Fatalf("MarshalPrivateKey(%v) failed: %v", algorithm, err)
+		}
+		publicPEM, err := MarshalPublicKey(key.Public())
+		if err != nil {
+			t.Fatalf("MarshalPublicKey(%v) failed: %v", algorithm, err)
+		}
+
+		km := NewPEMKeyManager()
+		if err := km.LoadPrivateKey(string(privatePEM), "towel"); err != nil {
+			t.Fatalf("LoadPrivateKey(%v) failed: %v", algorithm, err)
+		}
+		if err := km.LoadPublicKey(string(publicPEM)); err != nil {
+			t.Fatalf("LoadPublicKey(%v) failed: %v", algorithm, err)
+		}
+		signer, err := km.Signer()
+		if err != nil {
+			t.Fatalf("Signer(%v) failed: %v", algorithm, err)
+		}
+		pub, err := km.GetPublicKey()
+		if err != nil {
+			t.Fatalf("GetPublicKey(%v) failed: %v", algorithm, err)
+		}
+
+		sig, err := NewTrillianSigner(hasher, algorithm, signer).SignLogRoot(root)
+		if err != nil {
+			t.Fatalf("SignLogRoot(%v) failed: %v", algorithm, err)
+		}
+		if err := VerifyLogRoot(pub, hasher, root, sig); err != nil {
+			t.Errorf("VerifyLogRoot(%v) failed: %v", algorithm, err)
+		}
+	}
+
+	if _, err := GenerateKey(trillian.SignatureAlgorithm_THRESHOLD); err == nil {
+		t.Errorf("GenerateKey(THRESHOLD) succeeded")
+	}
+}
@@ -0,0 +1,253 @@
+// Package keys finds the private keys that sign the roots of each tree. A tree's
+// key is identified by the key ID held with it in the admin storage, which has
+// the form "scheme:name", where the scheme picks the Provider which holds the
+// key, such as a hardware security module.
+package keys
+
+import (
+	gocrypto "crypto"
+	"fmt"
+	"strings"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/util"
+)
+
+// Provider creates signers for the keys it holds.
+type Provider interface {
+	// Signer returns a signer for the key with the given name.
+	Signer(name string) (gocrypto.Signer, error)
+}
+
+// StaticProvider returns the same signer for every key name, such as one
+// loaded from a PEM file.
+type StaticProvider struct {
+	signer gocrypto.Signer
+}
+
+// NewStaticProvider creates a StaticProvider which returns signer.
+func NewStaticProvider(signer gocrypto.Signer) *StaticProvider {
+	return &StaticProvider{signer: signer}
+}
+
+// Signer implements Provider.
+func (p *StaticProvider) Signer(name string) (gocrypto.Signer, error) {
+	return p.signer, nil
+}
+
+// Registry is a Provider which passes each key ID to the provider registered
+// for its scheme. Key IDs without a registered scheme are passed whole to the
+// default provider, if there is one.
+type Registry struct {
+	providers map[string]Provider
+	// def is the default provider, may be nil
+	def Provider
+}
+
+// NewRegistry creates a Registry with no providers, which uses def for key IDs
+// without a registered scheme. If def is nil they're refused.
+func NewRegistry(def Provider) *Registry {
+	return &Registry{providers: make(map[string]Provider), def: def}
+}
+
+// Register has key IDs of the form "scheme:name" passed to p as name.
+func (r *Registry) Register(scheme string, p Provider) {
+	r.providers[scheme] = p
+}
+
+// Signer implements Provider.
+func (r *Registry) Signer(keyID string) (gocrypto.Signer, error) {
+	if i := strings.Index(keyID, ":"); i >= 0 {
+		if p, ok := r.providers[keyID[:i]]; ok {
+			return p.Signer(keyID[i+1:])
+		}
+	}
+	if r.def == nil {
+		return nil, fmt.Errorf("no key provider for key ID %q", keyID)
+	}
+	return r.def.Signer(keyID)
+}
+
+// KeyIDFunc returns the key ID of a tree.
+type KeyIDFunc func(treeID int64) (string, error)
+
+// ScheduledKey is a key that signs a tree's roots from its activation time
+// until the next key's.
+type ScheduledKey struct {
+	KeyID             string
+	ActivateTimeNanos int64
+}
+
+// KeyScheduleFunc returns the keys of a tree, ordered by activation time.
+type KeyScheduleFunc func(treeID int64) ([]ScheduledKey, error)
+
+// TreeSigners creates the signers of tree roots, using the keys of each tree.
+// The keys of a tree are looked up each time, so that changes made through
+// the admin service take effect. Roots are signed with the latest key to have
+// been activated, and while a new key is waiting to be activated they're also
+// signed with it, so verifiers can start trusting it before it's used.
+type TreeSigners struct {
+	provider   Provider
+	schedule   KeyScheduleFunc
+	hasher     trillian.Hasher
+	timeSource util.TimeSource
+}
+
+// NewTreeSigners creates a TreeSigners which finds the key ID of each tree with
+// keyIDs, and its key in p. Roots are hashed with hasher before signing.
+func NewTreeSigners(p Provider, keyIDs KeyIDFunc, hasher trillian.Hasher) *TreeSigners {
+	schedule := func(treeID int64) ([]ScheduledKey, error) {
+		keyID, err := keyIDs(treeID)
+		if err != nil {
+			return nil, err
+		}
+		return []ScheduledKey{{KeyID: keyID}}, nil
+	}
+	return NewTreeSignersWithSchedule(p, schedule, hasher, util.SystemTimeSource{})
+}
+
+// NewTreeSignersWithSchedule creates a TreeSigners which finds the keys of
+// each tree with schedule, and picks the active key at the time given by
+// timeSource.
+func NewTreeSignersWithSchedule(p Provider, schedule KeyScheduleFunc, hasher trillian.Hasher, timeSource util.TimeSource) *TreeSigners {
+	return &TreeSigners{provider: p, schedule: schedule, hasher: hasher, timeSource: timeSource}
+}
+
+// rootSigner signs both log and map roots.
+type rootSigner interface {
+	crypto.LogRootSigner
+	crypto.MapRootSigner
+}
+
+// pendingKey is a key of a tree that hasn't been activated yet.
+type pendingKey struct {
+	keyID  string
+	signer *crypto.TrillianSigner
+}
+
+// rotationSigner signs roots with the active key of a tree, and gives the
+// signatures of its pending keys as key signatures.
+type rotationSigner struct {
+	*crypto.TrillianSigner
+	pending []pendingKey
+}
+
+// KeySignLogRoot implements crypto.LogRootKeySigner.
+func (s *rotationSigner) KeySignLogRoot(root trillian.SignedLogRoot) ([]*trillian.KeySignature, error) {
+	keySignatures := make([]*trillian.KeySignature, 0, len(s.pending))
+	for _, k := range s.pending {
+		signature, err := k.signer.SignLogRoot(root)
+		if err != nil {
+			return nil, err
+		}
+		keySignatures = append(keySignatures, &trillian.KeySignature{KeyId: k.keyID, Signature: &signature})
+	}
+	return keySignatures, nil
+}
+
+// KeySignMapRoot implements crypto.MapRootKeySigner.
+func (s *rotationSigner) KeySignMapRoot(root trillian.SignedMapRoot) ([]*trillian.KeySignature, error) {
+	keySignatures := make([]*trillian.KeySignature, 0, len(s.pending))
+	for _, k := range s.pending {
+		signature, err := k.signer.SignMapRoot(root)
+		if err != nil {
+			return nil, err
+		}
+		keySignatures = append(keySignatures, &trillian.KeySignature{KeyId: k.keyID, Signature: &signature})
+	}
+	return keySignatures, nil
+}
+
+// activeKey returns the keys of a tree and the index of the active one.
+func (s *TreeSigners) activeKey(treeID int64) ([]ScheduledKey, int, error) {
+	treeKeys, err := s.schedule(treeID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(treeKeys) == 0 {
+		return nil, 0, fmt.Errorf("tree %d has no keys", treeID)
+	}
+	// The first key is used until another is activated
+	now := s.timeSource.Now().UnixNano()
+	active := 0
+	for i, key := range treeKeys {
+		if key.ActivateTimeNanos <= now {
+			active = i
+		}
+	}
+	return treeKeys, active, nil
+}
+
+// signer returns a signer using the active key of a tree, which is a
+// rotationSigner if the tree has keys waiting to be activated.
+func (s *TreeSigners) signer(treeID int64) (rootSigner, error) {
+	treeKeys, active, err := s.activeKey(treeID)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := s.keySigner(treeID, treeKeys[active].KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if active == len(treeKeys)-1 {
+		return signer, nil
+	}
+	rs := &rotationSigner{TrillianSigner: signer}
+	for _, key := range treeKeys[active+1:] {
+		keySigner, err := s.keySigner(treeID, key.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		rs.pending = append(rs.pending, pendingKey{keyID: key.KeyID, signer: keySigner})
+	}
+	return rs, nil
+}
+
+// keySigner returns a TrillianSigner using a key of a tree.
+func (s *TreeSigners) keySigner(treeID int64, keyID string) (*crypto.TrillianSigner, error) {
+	signer, err := s.provider.Signer(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("tree %d: failed to get key %q: %v", treeID, keyID, err)
+	}
+
+	algorithm, err := crypto.SignatureAlgorithmForKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("tree %d: key %q: %v", treeID, keyID, err)
+	}
+	return crypto.NewTrillianSigner(s.hasher, algorithm, signer), nil
+}
+
+// LogRootSigner returns a signer of the roots of a log. It's a
+// crypto.LogRootKeySigner while the log has a key waiting to be activated.
+func (s *TreeSigners) LogRootSigner(treeID int64) (crypto.LogRootSigner, error) {
+	signer, err := s.signer(treeID)
+	if err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// MapRootSigner returns a signer of the roots of a map. It's a
+// crypto.MapRootKeySigner while the map has a key waiting to be activated.
+func (s *TreeSigners) MapRootSigner(treeID int64) (crypto.MapRootSigner, error) {
+	signer, err := s.signer(treeID)
+	if err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// ActiveSigner returns the active key of a tree, for signing things other than
+// its roots, such as checkpoints.
+func (s *TreeSigners) ActiveSigner(treeID int64) (gocrypto.Signer, error) {
+	treeKeys, active, err := s.activeKey(treeID)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := s.provider.Signer(treeKeys[active].KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("tree %d: failed to get key %q: %v", treeID, treeKeys[active].KeyID, err)
+	}
+	return signer, nil
+}
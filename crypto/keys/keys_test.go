@@ -0,0 +1,320 @@
+package keys
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/util"
+)
+
+// fakeModule is a token holding software keys, which are labelled by their
+// index.
+type fakeModule struct {
+	keys []gocrypto.Signer
+	// rawPoint has EC points returned without the OCTET STRING wrapping
+	rawPoint bool
+}
+
+// Object handles are the key index times two, plus one for private keys.
+func (f *fakeModule) findObject(class uint, label string) (uint, error) {
+	for i := range f.keys {
+		if label == fmt.Sprint(i) {
+			if class == ckoPrivateKey {
+				return uint(2*i + 1), nil
+			}
+			return uint(2 * i), nil
+		}
+	}
+	return 0, errors.New("no such object")
+}
+
+func (f *fakeModule) attributes(object uint, types []uint) ([][]byte, error) {
+	if object%2 != 0 {
+		return nil, errors.New("private key attributes are sensitive")
+	}
+	values := make([][]byte, len(types))
+	for i, t := range types {
+		switch pub := f.keys[object/2].Public().(type) {
+		case *ecdsa.PublicKey:
+			switch t {
+			case ckaECParams:
+				values[i], _ = asn1.Marshal(oidP256)
+			case ckaECPoint:
+				values[i] = elliptic.Marshal(pub.Curve, pub.X, pub.Y)
+				if !f.rawPoint {
+					values[i], _ = asn1.Marshal(values[i])
+				}
+			}
+		case *rsa.PublicKey:
+			switch t {
+			case ckaModulus:
+				values[i] = pub.N.Bytes()
+			case ckaPublicExponent:
+				values[i] = big.NewInt(int64(pub.E)).Bytes()
+			}
+		}
+	}
+	return values, nil
+}
+
+func (f *fakeModule) sign(mechanism uint, key uint, data []byte) ([]byte, error) {
+	if key%2 == 0 {
+		return nil, errors.New("not a private key")
+	}
+	switch k := f.keys[key/2].(type) {
+	case *ecdsa.PrivateKey:
+		if mechanism != ckmECDSA {
+			return nil, errors.New("wrong mechanism")
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, k, data)
+		if err != nil {
+			return nil, err
+		}
+		// r and s are padded to the size of the order
+		size := (k.Params().BitSize + 7) / 8
+		sig := make([]byte, 2*size)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[size-len(rb):], rb)
+		copy(sig[2*size-len(sb):], sb)
+		return sig, nil
+	case *rsa.PrivateKey:
+		if mechanism != ckmRSAPKCS {
+			return nil, errors.New("wrong mechanism")
+		}
+		// A zero hash pads data as it is, like CKM_RSA_PKCS
+		return rsa.SignPKCS1v15(rand.Reader, k, 0, data)
+	}
+	return nil, errors.New("unsupported key")
+}
+
+func newTestKeys(t *testing.T) []gocrypto.Signer {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	return []gocrypto.Signer{ecdsaKey, rsaKey}
+}
+
+func TestPKCS11Signer(t *testing.T) {
+	keys := newTestKeys(t)
+	hasher := trillian.NewSHA256()
+	root := trillian.SignedLogRoot{TimestampNanos: 1000, RootHash: []byte("root"), TreeSize: 42}
+
+	for _, rawPoint := range []bool{false, true} {
+		p := newPKCS11Provider(&fakeModule{keys: keys, rawPoint: rawPoint})
+		for i, key := range keys {
+			signer, err := p.Signer(fmt.Sprint(i))
+			if err != nil {
+				t.Fatalf("Signer(%d) failed: %v", i, err)
+			}
+			algorithm := trillian.SignatureAlgorithm_ECDSA
+			if _, ok := key.(*rsa.PrivateKey); ok {
+				algorithm = trillian.SignatureAlgorithm_RSA
+			}
+
+			// The signature must be verifiable with the key's public key
+			sig, err := crypto.NewTrillianSigner(hasher, algorithm, signer).SignLogRoot(root)
+			if err != nil {
+				t.Fatalf("%d: SignLogRoot failed: %v", i, err)
+			}
+			if err := crypto.VerifyLogRoot(key.Public(), hasher, root, sig); err != nil {
+				t.Errorf("%d: VerifyLogRoot failed: %v", i, err)
+			}
+		}
+	}
+
+	p := newPKCS11Provider(&fakeModule{keys: keys})
+	if _, err := p.Signer("missing"); err == nil {
+		t.Errorf("Signer(missing) succeeded")
+	}
+	first, _ := p.Signer("0")
+	if second, _ := p.Signer("0"); second != first {
+		t.Errorf("Signer(0) returned a new signer, want the one created before")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	keys := newTestKeys(t)
+	r := NewRegistry(NewStaticProvider(keys[0]))
+	r.Register("hsm", NewStaticProvider(keys[1]))
+
+	for _, test := range []struct {
+		keyID string
+		want  gocrypto.Signer
+	}{
+		{keyID: "hsm:label", want: keys[1]},
+		{keyID: "key", want: keys[0]},
+		{keyID: "other:label", want: keys[0]},
+	} {
+		got, err := r.Signer(test.keyID)
+		if err != nil {
+			t.Errorf("Signer(%q) failed: %v", test.keyID, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Signer(%q) returned the wrong key", test.keyID)
+		}
+	}
+
+	if _, err := NewRegistry(nil).Signer("key"); err == nil {
+		t.Errorf("Signer with no default provider succeeded")
+	}
+}
+
+func TestTreeSigners(t *testing.T) {
+	keys := newTestKeys(t)
+	r := NewRegistry(nil)
+	r.Register("pkcs11", newPKCS11Provider(&fakeModule{keys: keys}))
+	keyIDs := map[int64]string{1: "pkcs11:0", 2: "pkcs11:1", 3: "pkcs11:missing"}
+	hasher := trillian.NewSHA256()
+	s := NewTreeSigners(r, func(treeID int64) (string, error) {
+		keyID, ok := keyIDs[treeID]
+		if !ok {
+			return "", fmt.Errorf("no tree %d", treeID)
+		}
+		return keyID, nil
+	}, hasher)
+
+	logRoot := trillian.SignedLogRoot{TimestampNanos: 1000, RootHash: []byte("root"), TreeSize: 42}
+	logSigner, err := s.LogRootSigner(1)
+	if err != nil {
+		t.Fatalf("LogRootSigner failed: %v", err)
+	}
+	sig, err := logSigner.SignLogRoot(logRoot)
+	if err != nil {
+		t.Fatalf("SignLogRoot failed: %v", err)
+	}
+	if sig.SignatureAlgorithm != trillian.SignatureAlgorithm_ECDSA {
+		t.Errorf("got signature algorithm %v, want ECDSA", sig.SignatureAlgorithm)
+	}
+	if err := crypto.VerifyLogRoot(keys[0].Public(), hasher, logRoot, sig); err != nil {
+		t.Errorf("VerifyLogRoot failed: %v", err)
+	}
+
+	mapRoot := trillian.SignedMapRoot{TimestampNanos: 1000, RootHash: []byte("root"), MapRevision: 3}
+	mapSigner, err := s.MapRootSigner(2)
+	if err != nil {
+		t.Fatalf("MapRootSigner failed: %v", err)
+	}
+	sig, err = mapSigner.SignMapRoot(mapRoot)
+	if err != nil {
+		t.Fatalf("SignMapRoot failed: %v", err)
+	}
+	if sig.SignatureAlgorithm != trillian.SignatureAlgorithm_RSA {
+		t.Errorf("got signature algorithm %v, want RSA", sig.SignatureAlgorithm)
+	}
+	if err := crypto.VerifyMapRoot(keys[1].Public(), hasher, mapRoot, sig); err != nil {
+		t.Errorf("VerifyMapRoot failed: %v", err)
+	}
+
+	for _, treeID := range []int64{3, 4} {
+		if _, err := s.LogRootSigner(treeID); err == nil {
+			t.Errorf("LogRootSigner(%d) succeeded", treeID)
+		}
+	}
+}
+
+func TestTreeSignersKeyRotation(t *testing.T) {
+	keys := newTestKeys(t)
+	r := NewRegistry(nil)
+	r.Register("pkcs11", newPKCS11Provider(&fakeModule{keys: keys}))
+	hasher := trillian.NewSHA256()
+	activate := time.Unix(1000, 0)
+	schedule := []ScheduledKey{{KeyID: "pkcs11:0"}, {KeyID: "pkcs11:1", ActivateTimeNanos: activate.UnixNano()}}
+	timeSource := &util.FakeTimeSource{FakeTime: activate.Add(-time.Second)}
+	s := NewTreeSignersWithSchedule(r, func(treeID int64) ([]ScheduledKey, error) {
+		return schedule, nil
+	}, hasher, timeSource)
+
+	// Before the new key is activated roots are signed with the old key, and
+	// with the new key as a key signature
+	logRoot := trillian.SignedLogRoot{TimestampNanos: 1000, RootHash: []byte("root"), TreeSize: 42}
+	logSigner, err := s.LogRootSigner(1)
+	if err != nil {
+		t.Fatalf("LogRootSigner failed: %v", err)
+	}
+	sig, err := logSigner.SignLogRoot(logRoot)
+	if err != nil {
+		t.Fatalf("SignLogRoot failed: %v", err)
+	}
+	if err := crypto.VerifyLogRoot(keys[0].Public(), hasher, logRoot, sig); err != nil {
+		t.Errorf("VerifyLogRoot with old key failed: %v", err)
+	}
+	active, err := s.ActiveSigner(1)
+	if err != nil {
+		t.Fatalf("ActiveSigner failed: %v", err)
+	}
+	if !reflect.DeepEqual(active.Public(), keys[0].Public()) {
+		t.Errorf("ActiveSigner() before activation isn't the old key")
+	}
+	keySigner, ok := logSigner.(crypto.LogRootKeySigner)
+	if !ok {
+		t.Fatalf("LogRootSigner() = %T, want a LogRootKeySigner while a key is pending", logSigner)
+	}
+	keySignatures, err := keySigner.KeySignLogRoot(logRoot)
+	if err != nil {
+		t.Fatalf("KeySignLogRoot failed: %v", err)
+	}
+	if len(keySignatures) != 1 || keySignatures[0].KeyId != "pkcs11:1" {
+		t.Fatalf("KeySignLogRoot() = %v, want a signature by pkcs11:1", keySignatures)
+	}
+	if err := crypto.VerifyLogRoot(keys[1].Public(), hasher, logRoot, *keySignatures[0].Signature); err != nil {
+		t.Errorf("VerifyLogRoot with new key failed: %v", err)
+	}
+
+	mapRoot := trillian.SignedMapRoot{TimestampNanos: 1000, RootHash: []byte("root"), MapRevision: 3}
+	mapSigner, err := s.MapRootSigner(2)
+	if err != nil {
+		t.Fatalf("MapRootSigner failed: %v", err)
+	}
+	mapKeySigner, ok := mapSigner.(crypto.MapRootKeySigner)
+	if !ok {
+		t.Fatalf("MapRootSigner() = %T, want a MapRootKeySigner while a key is pending", mapSigner)
+	}
+	if keySignatures, err = mapKeySigner.KeySignMapRoot(mapRoot); err != nil || len(keySignatures) != 1 {
+		t.Fatalf("KeySignMapRoot() = %v, %v, want one signature", keySignatures, err)
+	}
+	if err := crypto.VerifyMapRoot(keys[1].Public(), hasher, mapRoot, *keySignatures[0].Signature); err != nil {
+		t.Errorf("VerifyMapRoot with new key failed: %v", err)
+	}
+
+	// Once it's activated only the new key is used
+	timeSource.FakeTime = activate
+	if logSigner, err = s.LogRootSigner(1); err != nil {
+		t.Fatalf("LogRootSigner failed: %v", err)
+	}
+	if _, ok := logSigner.(crypto.LogRootKeySigner); ok {
+		t.Errorf("LogRootSigner() is a LogRootKeySigner with no pending keys")
+	}
+	if sig, err = logSigner.SignLogRoot(logRoot); err != nil {
+		t.Fatalf("SignLogRoot failed: %v", err)
+	}
+	if sig.SignatureAlgorithm != trillian.SignatureAlgorithm_RSA {
+		t.Errorf("got signature algorithm %v, want RSA", sig.SignatureAlgorithm)
+	}
+	if err := crypto.VerifyLogRoot(keys[1].Public(), hasher, logRoot, sig); err != nil {
+		t.Errorf("VerifyLogRoot with new key failed: %v", err)
+	}
+	if active, err = s.ActiveSigner(1); err != nil {
+		t.Fatalf("ActiveSigner failed: %v", err)
+	}
+	if !reflect.DeepEqual(active.Public(), keys[1].Public()) {
+		t.Errorf("ActiveSigner() after activation isn't the new key")
+	}
+}
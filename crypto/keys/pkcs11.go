@@ -0,0 +1,206 @@
+package keys
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+)
+
+// PKCS#11 constants used, from the specification.
+const (
+	ckoPublicKey  = 2
+	ckoPrivateKey = 3
+
+	ckaClass          = 0x0
+	ckaLabel          = 0x3
+	ckaModulus        = 0x120
+	ckaPublicExponent = 0x122
+	ckaECParams       = 0x180
+	ckaECPoint        = 0x181
+
+	ckmRSAPKCS = 0x1
+	ckmECDSA   = 0x1041
+)
+
+// module is the part of a PKCS#11 token's interface that's used, on a session
+// that has been logged in to. Its methods may be called concurrently.
+type module interface {
+	// findObject returns the handle of the object with the given class and
+	// label, which must be unique.
+	findObject(class uint, label string) (uint, error)
+	// attributes returns the values of the object's attributes, with nil for
+	// those it doesn't have.
+	attributes(object uint, types []uint) ([][]byte, error)
+	// sign signs data with a private key using mechanism.
+	sign(mechanism uint, key uint, data []byte) ([]byte, error)
+}
+
+// PKCS11Config configures a PKCS11Provider.
+type PKCS11Config struct {
+	// ModulePath is the path of the token vendor's PKCS#11 library.
+	ModulePath string
+	// SlotID is the slot of the token holding the keys.
+	SlotID uint
+	// PIN logs in to the token as a user.
+	PIN string
+}
+
+// PKCS11Provider holds keys in a hardware security module, or other token,
+// accessed through its PKCS#11 library. Keys are named by the label of their
+// private key object, and there must be a public key object with the same
+// label. ECDSA keys on the P-256, P-384 and P-521 curves and RSA keys are
+// supported.
+type PKCS11Provider struct {
+	m module
+
+	// Must hold this lock before accessing signers
+	mu sync.Mutex
+	// signers holds the signers created so far, by key name
+	signers map[string]gocrypto.Signer
+}
+
+// NewPKCS11Provider loads the PKCS#11 library and logs in to the token.
+func NewPKCS11Provider(config PKCS11Config) (*PKCS11Provider, error) {
+	m, err := openModule(config)
+	if err != nil {
+		return nil, err
+	}
+	return newPKCS11Provider(m), nil
+}
+
+func newPKCS11Provider(m module) *PKCS11Provider {
+	return &PKCS11Provider{m: m, signers: make(map[string]gocrypto.Signer)}
+}
+
+// Signer implements Provider.
+func (p *PKCS11Provider) Signer(name string) (gocrypto.Signer, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if s, ok := p.signers[name]; ok {
+		return s, nil
+	}
+
+	key, err := p.m.findObject(ckoPrivateKey, name)
+	if err != nil {
+		return nil, fmt.Errorf("private key %q: %v", name, err)
+	}
+	pubObject, err := p.m.findObject(ckoPublicKey, name)
+	if err != nil {
+		return nil, fmt.Errorf("public key %q: %v", name, err)
+	}
+	attrs, err := p.m.attributes(pubObject, []uint{ckaECParams, ckaECPoint, ckaModulus, ckaPublicExponent})
+	if err != nil {
+		return nil, fmt.Errorf("public key %q: %v", name, err)
+	}
+	var pub gocrypto.PublicKey
+	switch {
+	case attrs[0] != nil && attrs[1] != nil:
+		pub, err = ecPublicKey(attrs[0], attrs[1])
+	case attrs[2] != nil && attrs[3] != nil:
+		pub = &rsa.PublicKey{N: new(big.Int).SetBytes(attrs[2]), E: int(new(big.Int).SetBytes(attrs[3]).Int64())}
+	default:
+		err = errors.New("not an ECDSA or RSA key")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("public key %q: %v", name, err)
+	}
+
+	s := &pkcs11Signer{m: p.m, key: key, pub: pub}
+	p.signers[name] = s
+	return s, nil
+}
+
+// Object identifiers of the supported curves.
+var (
+	oidP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidP384 = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidP521 = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+)
+
+// ecPublicKey parses the CKA_EC_PARAMS and CKA_EC_POINT attributes of a key.
+func ecPublicKey(params, point []byte) (*ecdsa.PublicKey, error) {
+	var oid asn1.ObjectIdentifier
+	if rest, err := asn1.Unmarshal(params, &oid); err != nil || len(rest) > 0 {
+		return nil, errors.New("EC parameters aren't a named curve")
+	}
+	var curve elliptic.Curve
+	switch {
+	case oid.Equal(oidP256):
+		curve = elliptic.P256()
+	case oid.Equal(oidP384):
+		curve = elliptic.P384()
+	case oid.Equal(oidP521):
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %v", oid)
+	}
+
+	// The point should be DER encoded as an OCTET STRING, but some tokens
+	// return it bare
+	var raw []byte
+	if rest, err := asn1.Unmarshal(point, &raw); err != nil || len(rest) > 0 {
+		raw = point
+	}
+	x, y := elliptic.Unmarshal(curve, raw)
+	if x == nil {
+		return nil, errors.New("invalid EC point")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// pkcs11Signer is a crypto.Signer using a private key held by a token.
+type pkcs11Signer struct {
+	m   module
+	key uint
+	pub gocrypto.PublicKey
+}
+
+// Public implements crypto.Signer.
+func (s *pkcs11Signer) Public() gocrypto.PublicKey {
+	return s.pub
+}
+
+// Sign implements crypto.Signer. Signatures are in the same format as those of
+// the crypto/ecdsa and crypto/rsa keys, RSA signatures using PKCS #1 v1.5.
+func (s *pkcs11Signer) Sign(rand io.Reader, digest []byte, opts gocrypto.SignerOpts) ([]byte, error) {
+	switch s.pub.(type) {
+	case *ecdsa.PublicKey:
+		// The token returns r and s concatenated, each as long as the order
+		sig, err := s.m.sign(ckmECDSA, s.key, digest)
+		if err != nil {
+			return nil, err
+		}
+		if len(sig) == 0 || len(sig)%2 != 0 {
+			return nil, fmt.Errorf("token returned ECDSA signature of %d bytes", len(sig))
+		}
+		half := len(sig) / 2
+		return asn1.Marshal(struct{ R, S *big.Int }{new(big.Int).SetBytes(sig[:half]), new(big.Int).SetBytes(sig[half:])})
+	case *rsa.PublicKey:
+		// The token only pads, so the digest has to be wrapped in a DigestInfo
+		prefix, ok := digestInfoPrefixes[opts.HashFunc()]
+		if !ok {
+			return nil, fmt.Errorf("unsupported hash function %v for RSA", opts.HashFunc())
+		}
+		if len(digest) != opts.HashFunc().Size() {
+			return nil, fmt.Errorf("digest is %d bytes, want %d", len(digest), opts.HashFunc().Size())
+		}
+		return s.m.sign(ckmRSAPKCS, s.key, append(append([]byte{}, prefix...), digest...))
+	}
+	return nil, fmt.Errorf("unsupported key type %T", s.pub)
+}
+
+// digestInfoPrefixes are the DER encodings of the DigestInfo structure that
+// precede digests in PKCS #1 v1.5 signatures, from RFC 3447.
+var digestInfoPrefixes = map[gocrypto.Hash][]byte{
+	gocrypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	gocrypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	gocrypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
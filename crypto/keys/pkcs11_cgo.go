@@ -0,0 +1,247 @@
+// +build cgo
+
+package keys
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdlib.h>
+#include <string.h>
+
+// The few PKCS#11 types used, which match the specification's headers on the
+// platforms where structures aren't packed.
+typedef unsigned long CK_ULONG;
+typedef CK_ULONG CK_RV;
+typedef struct { CK_ULONG type; void *pValue; CK_ULONG ulValueLen; } CK_ATTRIBUTE;
+typedef struct { CK_ULONG mechanism; void *pParameter; CK_ULONG ulParameterLen; } CK_MECHANISM;
+
+typedef CK_RV (*initialize_fn)(void *);
+typedef CK_RV (*open_session_fn)(CK_ULONG, CK_ULONG, void *, void *, CK_ULONG *);
+typedef CK_RV (*login_fn)(CK_ULONG, CK_ULONG, unsigned char *, CK_ULONG);
+typedef CK_RV (*find_objects_init_fn)(CK_ULONG, CK_ATTRIBUTE *, CK_ULONG);
+typedef CK_RV (*find_objects_fn)(CK_ULONG, CK_ULONG *, CK_ULONG, CK_ULONG *);
+typedef CK_RV (*find_objects_final_fn)(CK_ULONG);
+typedef CK_RV (*get_attribute_value_fn)(CK_ULONG, CK_ULONG, CK_ATTRIBUTE *, CK_ULONG);
+typedef CK_RV (*sign_init_fn)(CK_ULONG, CK_MECHANISM *, CK_ULONG);
+typedef CK_RV (*sign_fn)(CK_ULONG, unsigned char *, CK_ULONG, unsigned char *, CK_ULONG *);
+
+typedef struct {
+	initialize_fn initialize;
+	open_session_fn open_session;
+	login_fn login;
+	find_objects_init_fn find_objects_init;
+	find_objects_fn find_objects;
+	find_objects_final_fn find_objects_final;
+	get_attribute_value_fn get_attribute_value;
+	sign_init_fn sign_init;
+	sign_fn sign;
+} pkcs11_functions;
+
+// pkcs11_load opens the library at path and finds the functions used, which
+// every PKCS#11 library exports. It returns an error message, or NULL.
+static const char *pkcs11_load(const char *path, pkcs11_functions *f) {
+	void *lib = dlopen(path, RTLD_NOW | RTLD_LOCAL);
+	if (lib == NULL) {
+		return dlerror();
+	}
+	f->initialize = (initialize_fn)dlsym(lib, "C_Initialize");
+	f->open_session = (open_session_fn)dlsym(lib, "C_OpenSession");
+	f->login = (login_fn)dlsym(lib, "C_Login");
+	f->find_objects_init = (find_objects_init_fn)dlsym(lib, "C_FindObjectsInit");
+	f->find_objects = (find_objects_fn)dlsym(lib, "C_FindObjects");
+	f->find_objects_final = (find_objects_final_fn)dlsym(lib, "C_FindObjectsFinal");
+	f->get_attribute_value = (get_attribute_value_fn)dlsym(lib, "C_GetAttributeValue");
+	f->sign_init = (sign_init_fn)dlsym(lib, "C_SignInit");
+	f->sign = (sign_fn)dlsym(lib, "C_Sign");
+	if (!f->initialize || !f->open_session || !f->login || !f->find_objects_init || !f->find_objects ||
+	    !f->find_objects_final || !f->get_attribute_value || !f->sign_init || !f->sign) {
+		return "library doesn't export the PKCS#11 functions";
+	}
+	return NULL;
+}
+
+static CK_RV pkcs11_initialize(pkcs11_functions *f) {
+	return f->initialize(NULL);
+}
+
+static CK_RV pkcs11_open_session(pkcs11_functions *f, CK_ULONG slot, CK_ULONG flags, CK_ULONG *session) {
+	return f->open_session(slot, flags, NULL, NULL, session);
+}
+
+static CK_RV pkcs11_login(pkcs11_functions *f, CK_ULONG session, unsigned char *pin, CK_ULONG pin_len) {
+	return f->login(session, 1, pin, pin_len);
+}
+
+// pkcs11_find finds up to two objects of the class with the label, so that
+// duplicates can be detected.
+static CK_RV pkcs11_find(pkcs11_functions *f, CK_ULONG session, CK_ULONG class, unsigned char *label, CK_ULONG label_len, CK_ULONG *objects, CK_ULONG *count) {
+	CK_ATTRIBUTE template[2] = {
+		{0x0, &class, sizeof(class)},
+		{0x3, label, label_len},
+	};
+	CK_RV rv = f->find_objects_init(session, template, 2);
+	if (rv != 0) {
+		return rv;
+	}
+	rv = f->find_objects(session, objects, 2, count);
+	CK_RV final_rv = f->find_objects_final(session);
+	return rv != 0 ? rv : final_rv;
+}
+
+static CK_RV pkcs11_get_attributes(pkcs11_functions *f, CK_ULONG session, CK_ULONG object, CK_ATTRIBUTE *attrs, CK_ULONG count) {
+	return f->get_attribute_value(session, object, attrs, count);
+}
+
+static CK_RV pkcs11_sign(pkcs11_functions *f, CK_ULONG session, CK_ULONG mechanism, CK_ULONG key, unsigned char *data, CK_ULONG data_len, unsigned char *sig, CK_ULONG *sig_len) {
+	CK_MECHANISM mech = {mechanism, NULL, 0};
+	CK_RV rv = f->sign_init(session, &mech, key);
+	if (rv != 0) {
+		return rv;
+	}
+	return f->sign(session, data, data_len, sig, sig_len);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// PKCS#11 return values handled.
+const (
+	ckrOK                         = 0x0
+	ckrAttributeTypeInvalid       = 0x12
+	ckrUserAlreadyLoggedIn        = 0x100
+	ckrCryptokiAlreadyInitialized = 0x191
+
+	ckfSerialSession = 0x4
+
+	// ckUnavailableInformation is the length returned for missing attributes
+	ckUnavailableInformation = ^C.CK_ULONG(0)
+)
+
+// pkcs11Error is a failure returned by a PKCS#11 function.
+type pkcs11Error struct {
+	function string
+	rv       C.CK_RV
+}
+
+func (e pkcs11Error) Error() string {
+	return fmt.Sprintf("%s failed: PKCS#11 error 0x%x", e.function, uint64(e.rv))
+}
+
+// cgoModule is a module using a session with a PKCS#11 library.
+type cgoModule struct {
+	// Must hold this lock before using the session, as a session can only
+	// carry out one operation at a time
+	mu        sync.Mutex
+	functions *C.pkcs11_functions
+	session   C.CK_ULONG
+}
+
+func openModule(config PKCS11Config) (module, error) {
+	path := C.CString(config.ModulePath)
+	defer C.free(unsafe.Pointer(path))
+
+	// The function table is kept in C memory so it can be passed to C
+	functions := (*C.pkcs11_functions)(C.malloc(C.sizeof_pkcs11_functions))
+	if msg := C.pkcs11_load(path, functions); msg != nil {
+		C.free(unsafe.Pointer(functions))
+		return nil, fmt.Errorf("failed to load %s: %s", config.ModulePath, C.GoString(msg))
+	}
+	m := &cgoModule{functions: functions}
+
+	if rv := C.pkcs11_initialize(functions); rv != ckrOK && rv != ckrCryptokiAlreadyInitialized {
+		return nil, pkcs11Error{"C_Initialize", rv}
+	}
+	if rv := C.pkcs11_open_session(functions, C.CK_ULONG(config.SlotID), ckfSerialSession, &m.session); rv != ckrOK {
+		return nil, pkcs11Error{"C_OpenSession", rv}
+	}
+	pin := C.CBytes([]byte(config.PIN))
+	defer C.free(pin)
+	if rv := C.pkcs11_login(functions, m.session, (*C.uchar)(pin), C.CK_ULONG(len(config.PIN))); rv != ckrOK && rv != ckrUserAlreadyLoggedIn {
+		return nil, pkcs11Error{"C_Login", rv}
+	}
+	return m, nil
+}
+
+func (m *cgoModule) findObject(class uint, label string) (uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cLabel := C.CBytes([]byte(label))
+	defer C.free(cLabel)
+	objects := (*[2]C.CK_ULONG)(C.malloc(C.size_t(unsafe.Sizeof(C.CK_ULONG(0))) * 2))
+	defer C.free(unsafe.Pointer(objects))
+	count := (*C.CK_ULONG)(C.malloc(C.size_t(unsafe.Sizeof(C.CK_ULONG(0)))))
+	defer C.free(unsafe.Pointer(count))
+
+	if rv := C.pkcs11_find(m.functions, m.session, C.CK_ULONG(class), (*C.uchar)(cLabel), C.CK_ULONG(len(label)), &objects[0], count); rv != ckrOK {
+		return 0, pkcs11Error{"C_FindObjects", rv}
+	}
+	switch *count {
+	case 0:
+		return 0, errors.New("no such object")
+	case 1:
+		return uint(objects[0]), nil
+	}
+	return 0, errors.New("label isn't unique")
+}
+
+func (m *cgoModule) attributes(object uint, types []uint) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The first call finds the lengths of the values, the second reads them
+	n := len(types)
+	attrs := (*[1 << 20]C.CK_ATTRIBUTE)(C.malloc(C.size_t(n) * C.sizeof_CK_ATTRIBUTE))[:n:n]
+	defer C.free(unsafe.Pointer(&attrs[0]))
+	for i, t := range types {
+		attrs[i] = C.CK_ATTRIBUTE{_type: C.CK_ULONG(t)}
+	}
+	rv := C.pkcs11_get_attributes(m.functions, m.session, C.CK_ULONG(object), &attrs[0], C.CK_ULONG(n))
+	if rv != ckrOK && rv != ckrAttributeTypeInvalid {
+		return nil, pkcs11Error{"C_GetAttributeValue", rv}
+	}
+	for i := range attrs {
+		if attrs[i].ulValueLen != ckUnavailableInformation {
+			attrs[i].pValue = C.malloc(C.size_t(attrs[i].ulValueLen) + 1)
+			defer C.free(attrs[i].pValue)
+		}
+	}
+	rv = C.pkcs11_get_attributes(m.functions, m.session, C.CK_ULONG(object), &attrs[0], C.CK_ULONG(n))
+	if rv != ckrOK && rv != ckrAttributeTypeInvalid {
+		return nil, pkcs11Error{"C_GetAttributeValue", rv}
+	}
+
+	values := make([][]byte, n)
+	for i := range attrs {
+		if attrs[i].pValue != nil && attrs[i].ulValueLen != ckUnavailableInformation {
+			values[i] = C.GoBytes(attrs[i].pValue, C.int(attrs[i].ulValueLen))
+		}
+	}
+	return values, nil
+}
+
+func (m *cgoModule) sign(mechanism uint, key uint, data []byte) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cData := C.CBytes(data)
+	defer C.free(cData)
+	// Large enough for RSA keys of up to 8192 bits
+	const maxSignature = 1024
+	sig := C.malloc(maxSignature)
+	defer C.free(sig)
+	sigLen := (*C.CK_ULONG)(C.malloc(C.size_t(unsafe.Sizeof(C.CK_ULONG(0)))))
+	defer C.free(unsafe.Pointer(sigLen))
+	*sigLen = maxSignature
+
+	if rv := C.pkcs11_sign(m.functions, m.session, C.CK_ULONG(mechanism), C.CK_ULONG(key), (*C.uchar)(cData), C.CK_ULONG(len(data)), (*C.uchar)(sig), sigLen); rv != ckrOK {
+		return nil, pkcs11Error{"C_Sign", rv}
+	}
+	return C.GoBytes(sig, C.int(*sigLen)), nil
+}
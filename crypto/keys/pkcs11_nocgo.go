@@ -0,0 +1,9 @@
+// +build !cgo
+
+package keys
+
+import "errors"
+
+func openModule(config PKCS11Config) (module, error) {
+	return nil, errors.New("PKCS#11 support needs a binary built with cgo")
+}
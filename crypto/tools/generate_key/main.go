@@ -0,0 +1,52 @@
+// The generate_key command creates a key for signing tree roots, writing the
+// private key in the form read by the log and map servers' private_key_file
+// flag, and the public key in the form read by clients verifying roots.
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+
+	log "github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+)
+
+var algorithmFlag = flag.String("signature_algorithm", trillian.SignatureAlgorithm_ECDSA.String(), "Algorithm of the key to generate, ECDSA, RSA or ED25519")
+var privateKeyFileFlag = flag.String("private_key_file", "", "File to write the PEM encoded private key to")
+var passwordFlag = flag.String("private_key_password", "", "Password to encrypt the private key with")
+var publicKeyFileFlag = flag.String("public_key_file", "", "File to write the PEM encoded public key to, if set")
+
+func main() {
+	flag.Parse()
+
+	algorithm, ok := trillian.SignatureAlgorithm_value[*algorithmFlag]
+	if !ok {
+		log.Fatalf("Unknown signature_algorithm %q", *algorithmFlag)
+	}
+	if len(*privateKeyFileFlag) == 0 || len(*passwordFlag) == 0 {
+		log.Fatal("private_key_file and private_key_password must be set")
+	}
+
+	key, err := crypto.GenerateKey(trillian.SignatureAlgorithm(algorithm))
+	if err != nil {
+		log.Fatal(err)
+	}
+	privatePEM, err := crypto.MarshalPrivateKey(key, *passwordFlag)
+	if err != nil {
+		log.Fatalf("Failed to encode private key: %v", err)
+	}
+	if err := ioutil.WriteFile(*privateKeyFileFlag, privatePEM, 0600); err != nil {
+		log.Fatalf("Failed to write private key: %v", err)
+	}
+
+	if len(*publicKeyFileFlag) > 0 {
+		publicPEM, err := crypto.MarshalPublicKey(key.Public())
+		if err != nil {
+			log.Fatalf("Failed to encode public key: %v", err)
+		}
+		if err := ioutil.WriteFile(*publicKeyFileFlag, publicPEM, 0644); err != nil {
+			log.Fatalf("Failed to write public key: %v", err)
+		}
+	}
+}
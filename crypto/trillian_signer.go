@@ -18,8 +18,55 @@ const (
 	mapKeyRootHash       string = "RootHash"
 	mapKeyTimestampNanos string = "TimestampNanos"
 	mapKeyTreeSize       string = "TreeSize"
+	mapKeyMapRevision    string = "MapRevision"
+	mapKeyMapID          string = "MapID"
+	mapKeyMetadata       string = "Metadata"
+
+	mapKeySourceLogID                  string = "SourceLogID"
+	mapKeyHighestFullyCompletedSeq     string = "HighestFullyCompletedSeq"
+	mapKeyHighestPartiallyCompletedSeq string = "HighestPartiallyCompletedSeq"
+	mapKeyRevisionStartSeq             string = "RevisionStartSeq"
 )
 
+// LogRootSigner signs log roots. TrillianSigner does this with a key it holds,
+// other implementations may ask a separate signing service to do it.
+type LogRootSigner interface {
+	SignLogRoot(root trillian.SignedLogRoot) (trillian.DigitallySigned, error)
+}
+
+// MapRootSigner signs map roots.
+type MapRootSigner interface {
+	SignMapRoot(root trillian.SignedMapRoot) (trillian.DigitallySigned, error)
+}
+
+// LogRootKeySigner is a LogRootSigner which also signs log roots with the keys
+// of a tree that aren't active yet, so that verifiers can trust roots signed
+// with a new key before it's activated.
+type LogRootKeySigner interface {
+	LogRootSigner
+	KeySignLogRoot(root trillian.SignedLogRoot) ([]*trillian.KeySignature, error)
+}
+
+// MapRootKeySigner is a MapRootSigner which also signs map roots with the keys
+// of a tree that aren't active yet.
+type MapRootKeySigner interface {
+	MapRootSigner
+	KeySignMapRoot(root trillian.SignedMapRoot) ([]*trillian.KeySignature, error)
+}
+
+// ConsistencyProofFunc returns the hashes of a proof that the log root being
+// signed is consistent with the earlier size fromSize of the same log.
+type ConsistencyProofFunc func(fromSize int64) ([][]byte, error)
+
+// LogRootConsistencySigner is a LogRootSigner that only signs a root of a log
+// once it's shown the root is consistent with the roots it signed before, such
+// as a co-signer that keeps the log honest. SignLogRoot fails for a root that
+// needs a consistency proof.
+type LogRootConsistencySigner interface {
+	LogRootSigner
+	SignLogRootConsistent(root trillian.SignedLogRoot, proof ConsistencyProofFunc) (trillian.DigitallySigned, error)
+}
+
 // TrillianSigner is responsible for signing log-related data and producing the appropriate
 // application specific signature objects.
 type TrillianSigner struct {
@@ -29,7 +76,7 @@ type TrillianSigner struct {
 }
 
 // NewTrillianSigner creates a new TrillianSigner wrapping up a hasher and a signer. For the moment
-// we only support SHA256 hashing and either ECDSA or RSA signing but this is not enforced
+// we only support SHA256 hashing and ECDSA, RSA or Ed25519 signing but this is not enforced
 // here.
 func NewTrillianSigner(hasher trillian.Hasher, signatureAlgorithm trillian.SignatureAlgorithm, signer crypto.Signer) *TrillianSigner {
 	return &TrillianSigner{hasher, signer, signatureAlgorithm}
@@ -44,7 +91,13 @@ func (s TrillianSigner) Sign(data []byte) (trillian.DigitallySigned, error) {
 			len(digest), s.hasher.Size())
 	}
 
-	sig, err := s.signer.Sign(rand.Reader, digest, s.hasher)
+	// Ed25519 can't sign a digest made by another hash function, so signs the
+	// digest as it is
+	var opts crypto.SignerOpts = s.hasher
+	if s.sigAlgorithm == trillian.SignatureAlgorithm_ED25519 {
+		opts = crypto.Hash(0)
+	}
+	sig, err := s.signer.Sign(rand.Reader, digest, opts)
 
 	if err != nil {
 		return trillian.DigitallySigned{}, err
@@ -84,3 +137,40 @@ func (s TrillianSigner) SignLogRoot(root trillian.SignedLogRoot) (trillian.Digit
 
 	return signature, nil
 }
+
+func (s TrillianSigner) hashMapRoot(root trillian.SignedMapRoot) []byte {
+	rootMap := make(map[string]interface{})
+
+	// As for log roots int64 values are in string format. The mapper metadata
+	// is only present for roots that have it.
+	rootMap[mapKeyRootHash] = base64.StdEncoding.EncodeToString(root.RootHash)
+	rootMap[mapKeyTimestampNanos] = strconv.FormatInt(root.TimestampNanos, 10)
+	rootMap[mapKeyMapRevision] = strconv.FormatInt(root.MapRevision, 10)
+	rootMap[mapKeyMapID] = base64.StdEncoding.EncodeToString(root.MapId)
+	if m := root.Metadata; m != nil {
+		rootMap[mapKeyMetadata] = map[string]interface{}{
+			mapKeySourceLogID:                  base64.StdEncoding.EncodeToString(m.SourceLogId),
+			mapKeyHighestFullyCompletedSeq:     strconv.FormatInt(m.HighestFullyCompletedSeq, 10),
+			mapKeyHighestPartiallyCompletedSeq: strconv.FormatInt(m.HighestPartiallyCompletedSeq, 10),
+			mapKeyRevisionStartSeq:             strconv.FormatInt(m.RevisionStartSeq, 10),
+		}
+	}
+
+	hash := objecthash.ObjectHash(rootMap)
+
+	return hash[:]
+}
+
+// SignMapRoot returns a signature of a map root from the crypto signer this
+// object was created with. Signatures use objecthash on a fixed JSON format of
+// the root.
+func (s TrillianSigner) SignMapRoot(root trillian.SignedMapRoot) (trillian.DigitallySigned, error) {
+	signature, err := s.Sign(s.hashMapRoot(root))
+
+	if err != nil {
+		glog.Warningf("Signer failed to sign map root: %v", err)
+		return trillian.DigitallySigned{}, err
+	}
+
+	return signature, nil
+}
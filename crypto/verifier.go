@@ -0,0 +1,210 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/google/trillian"
+)
+
+// VerifySignature checks that sig is a signature of data, made by
+// TrillianSigner.Sign with the private key corresponding to pub.
+func VerifySignature(pub crypto.PublicKey, hasher trillian.Hasher, data []byte, sig trillian.DigitallySigned) error {
+	if sig.HashAlgorithm != hasher.HashAlgorithm() {
+		return fmt.Errorf("signature uses hash algorithm %v, expected %v", sig.HashAlgorithm, hasher.HashAlgorithm())
+	}
+	digest := hasher.Digest(data)
+
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		if sig.SignatureAlgorithm != trillian.SignatureAlgorithm_ECDSA {
+			return fmt.Errorf("signature algorithm %v doesn't match ECDSA key", sig.SignatureAlgorithm)
+		}
+		var ecdsaSig struct {
+			R, S *big.Int
+		}
+		rest, err := asn1.Unmarshal(sig.Signature, &ecdsaSig)
+		if err != nil || len(rest) > 0 || ecdsaSig.R == nil || ecdsaSig.S == nil {
+			return errors.New("malformed ECDSA signature")
+		}
+		if !ecdsa.Verify(pub, digest, ecdsaSig.R, ecdsaSig.S) {
+			return errors.New("ECDSA signature verification failed")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if sig.SignatureAlgorithm != trillian.SignatureAlgorithm_RSA {
+			return fmt.Errorf("signature algorithm %v doesn't match RSA key", sig.SignatureAlgorithm)
+		}
+		return rsa.VerifyPKCS1v15(pub, hasher.HashFunc(), digest, sig.Signature)
+	case ed25519.PublicKey:
+		if sig.SignatureAlgorithm != trillian.SignatureAlgorithm_ED25519 {
+			return fmt.Errorf("signature algorithm %v doesn't match Ed25519 key", sig.SignatureAlgorithm)
+		}
+		if !ed25519.Verify(pub, digest, sig.Signature) {
+			return errors.New("Ed25519 signature verification failed")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported key type: %T", pub)
+}
+
+// VerifyLogRoot checks that sig is a signature of root, made by
+// TrillianSigner.SignLogRoot with the private key corresponding to pub.
+func VerifyLogRoot(pub crypto.PublicKey, hasher trillian.Hasher, root trillian.SignedLogRoot, sig trillian.DigitallySigned) error {
+	return VerifySignature(pub, hasher, TrillianSigner{}.hashRoot(root), sig)
+}
+
+// VerifyMapRoot checks that sig is a signature of root, made by
+// TrillianSigner.SignMapRoot with the private key corresponding to pub.
+func VerifyMapRoot(pub crypto.PublicKey, hasher trillian.Hasher, root trillian.SignedMapRoot, sig trillian.DigitallySigned) error {
+	return VerifySignature(pub, hasher, TrillianSigner{}.hashMapRoot(root), sig)
+}
+
+// VerifyLogRootSignatures checks that root is signed with the private key
+// corresponding to pub, either by its signature or by one of its key
+// signatures, which are made with a log's new key while it's being rotated.
+func VerifyLogRootSignatures(pub crypto.PublicKey, hasher trillian.Hasher, root trillian.SignedLogRoot) error {
+	if root.Signature == nil {
+		return errors.New("log root is not signed")
+	}
+	err := VerifyLogRoot(pub, hasher, root, *root.Signature)
+	if err == nil {
+		return nil
+	}
+	for _, ks := range root.KeySignatures {
+		if ks.Signature != nil && VerifyLogRoot(pub, hasher, root, *ks.Signature) == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// VerifyMapRootSignatures checks that root is signed with the private key
+// corresponding to pub, either by its signature or by one of its key
+// signatures.
+func VerifyMapRootSignatures(pub crypto.PublicKey, hasher trillian.Hasher, root trillian.SignedMapRoot) error {
+	if root.Signature == nil {
+		return errors.New("map root is not signed")
+	}
+	err := VerifyMapRoot(pub, hasher, root, *root.Signature)
+	if err == nil {
+		return nil
+	}
+	for _, ks := range root.KeySignatures {
+		if ks.Signature != nil && VerifyMapRoot(pub, hasher, root, *ks.Signature) == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// treeKey is a key of a KeySet.
+type treeKey struct {
+	keyID             string
+	pub               crypto.PublicKey
+	activateTimeNanos int64
+}
+
+// KeySet holds the keys that sign a tree's roots over its lifetime, as given by
+// the tree's Keys, so that roots signed before and after its key is rotated can
+// be verified. A root must be signed by the key active at its timestamp, which
+// is the last key activated by then, or the first key if none was.
+type KeySet struct {
+	// keys is ordered by activation time
+	keys []treeKey
+}
+
+// NewKeySet creates a KeySet holding keys. Keys whose public keys aren't
+// known are kept, so roots signed while they're active aren't accepted.
+func NewKeySet(keys []*trillian.TreeKey) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no keys")
+	}
+	ks := &KeySet{keys: make([]treeKey, 0, len(keys))}
+	for _, k := range keys {
+		if k == nil {
+			return nil, errors.New("nil key")
+		}
+		key := treeKey{keyID: k.KeyId, activateTimeNanos: k.ActivateTimeNanos}
+		if len(k.PublicKeyDer) > 0 {
+			pub, err := x509.ParsePKIXPublicKey(k.PublicKeyDer)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %v", k.KeyId, err)
+			}
+			key.pub = pub
+		}
+		ks.keys = append(ks.keys, key)
+	}
+	sort.SliceStable(ks.keys, func(i, j int) bool { return ks.keys[i].activateTimeNanos < ks.keys[j].activateTimeNanos })
+	return ks, nil
+}
+
+// NewKeySetForKey creates a KeySet holding only pub, which signs every root.
+func NewKeySetForKey(pub crypto.PublicKey) *KeySet {
+	return &KeySet{keys: []treeKey{{pub: pub}}}
+}
+
+// keyAt returns the key active at timestampNanos.
+func (ks *KeySet) keyAt(timestampNanos int64) (treeKey, error) {
+	key := ks.keys[0]
+	for _, k := range ks.keys[1:] {
+		if k.activateTimeNanos > timestampNanos {
+			break
+		}
+		key = k
+	}
+	if key.pub == nil {
+		return treeKey{}, fmt.Errorf("public key of key %q, active at %d, isn't known", key.keyID, timestampNanos)
+	}
+	return key, nil
+}
+
+// verify checks that sig, or one of keySigs made by the same key, is a
+// signature of a root with timestamp timestampNanos, using verifySig to check
+// each signature with the key active at the timestamp.
+func (ks *KeySet) verify(timestampNanos int64, sig *trillian.DigitallySigned, keySigs []*trillian.KeySignature, verifySig func(crypto.PublicKey, trillian.DigitallySigned) error) error {
+	if sig == nil {
+		return errors.New("root is not signed")
+	}
+	key, err := ks.keyAt(timestampNanos)
+	if err != nil {
+		return err
+	}
+	err = verifySig(key.pub, *sig)
+	if err == nil {
+		return nil
+	}
+	// The root may have been signed by the key as a pending key, if it was
+	// signed just before the key was activated
+	for _, s := range keySigs {
+		if s == nil || s.Signature == nil || (len(key.keyID) > 0 && s.KeyId != key.keyID) {
+			continue
+		}
+		if verifySig(key.pub, *s.Signature) == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// VerifyLogRoot checks that root is signed by the key active at its timestamp.
+func (ks *KeySet) VerifyLogRoot(hasher trillian.Hasher, root trillian.SignedLogRoot) error {
+	return ks.verify(root.TimestampNanos, root.Signature, root.KeySignatures, func(pub crypto.PublicKey, sig trillian.DigitallySigned) error {
+		return VerifyLogRoot(pub, hasher, root, sig)
+	})
+}
+
+// VerifyMapRoot checks that root is signed by the key active at its timestamp.
+func (ks *KeySet) VerifyMapRoot(hasher trillian.Hasher, root trillian.SignedMapRoot) error {
+	return ks.verify(root.TimestampNanos, root.Signature, root.KeySignatures, func(pub crypto.PublicKey, sig trillian.DigitallySigned) error {
+		return VerifyMapRoot(pub, hasher, root, sig)
+	})
+}
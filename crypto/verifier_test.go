@@ -0,0 +1,239 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+
+	"github.com/google/trillian"
+)
+
+func TestVerifyLogRoot(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	hasher := trillian.NewSHA256()
+	root := trillian.SignedLogRoot{TimestampNanos: 1000, RootHash: []byte("root"), TreeSize: 42}
+	for _, test := range []struct {
+		signer    crypto.Signer
+		algorithm trillian.SignatureAlgorithm
+	}{
+		{signer: ecdsaKey, algorithm: trillian.SignatureAlgorithm_ECDSA},
+		{signer: rsaKey, algorithm: trillian.SignatureAlgorithm_RSA},
+		{signer: ed25519Key, algorithm: trillian.SignatureAlgorithm_ED25519},
+	} {
+		sig, err := NewTrillianSigner(hasher, test.algorithm, test.signer).SignLogRoot(root)
+		if err != nil {
+			t.Fatalf("SignLogRoot failed: %v", err)
+		}
+		if err := VerifyLogRoot(test.signer.Public(), hasher, root, sig); err != nil {
+			t.Errorf("VerifyLogRoot(%v) failed: %v", test.algorithm, err)
+		}
+
+		changed := root
+		changed.TreeSize++
+		if err := VerifyLogRoot(test.signer.Public(), hasher, changed, sig); err == nil {
+			t.Errorf("VerifyLogRoot(%v) accepted the signature for a different root", test.algorithm)
+		}
+		if err := VerifyLogRoot(otherKey.Public(), hasher, root, sig); err == nil {
+			t.Errorf("VerifyLogRoot(%v) accepted the signature with a different key", test.algorithm)
+		}
+	}
+}
+
+func TestVerifyMapRoot(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	hasher := trillian.NewSHA256()
+	root := trillian.SignedMapRoot{TimestampNanos: 1000, RootHash: []byte("root"), MapRevision: 7, MapId: []byte("map"),
+		Metadata: &trillian.MapperMetadata{SourceLogId: []byte("log"), HighestFullyCompletedSeq: 10, RevisionStartSeq: 5}}
+	sig, err := NewTrillianSigner(hasher, trillian.SignatureAlgorithm_ECDSA, key).SignMapRoot(root)
+	if err != nil {
+		t.Fatalf("SignMapRoot failed: %v", err)
+	}
+	if err := VerifyMapRoot(key.Public(), hasher, root, sig); err != nil {
+		t.Errorf("VerifyMapRoot failed: %v", err)
+	}
+
+	for _, test := range []struct {
+		desc   string
+		change func(r *trillian.SignedMapRoot)
+	}{
+		{desc: "revision", change: func(r *trillian.SignedMapRoot) { r.MapRevision++ }},
+		{desc: "map ID", change: func(r *trillian.SignedMapRoot) { r.MapId = []byte("other") }},
+		{desc: "no metadata", change: func(r *trillian.SignedMapRoot) { r.Metadata = nil }},
+		{desc: "metadata", change: func(r *trillian.SignedMapRoot) {
+			m := *r.Metadata
+			m.HighestFullyCompletedSeq++
+			r.Metadata = &m
+		}},
+	} {
+		changed := root
+		test.change(&changed)
+		if err := VerifyMapRoot(key.Public(), hasher, changed, sig); err == nil {
+			t.Errorf("VerifyMapRoot accepted the signature for a root with a different %s", test.desc)
+		}
+	}
+	// A map root's signature isn't valid for a log root with the same fields
+	if err := VerifyLogRoot(key.Public(), hasher, trillian.SignedLogRoot{TimestampNanos: 1000, RootHash: []byte("root"), TreeSize: 7}, sig); err == nil {
+		t.Errorf("VerifyLogRoot accepted the signature of a map root")
+	}
+}
+
+func TestVerifyRootSignatures(t *testing.T) {
+	oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	hasher := trillian.NewSHA256()
+	oldSigner := NewTrillianSigner(hasher, trillian.SignatureAlgorithm_ECDSA, oldKey)
+	newSigner := NewTrillianSigner(hasher, trillian.SignatureAlgorithm_ECDSA, newKey)
+
+	// A root signed while the key is rotated can be verified with either key
+	logRoot := trillian.SignedLogRoot{TimestampNanos: 1000, RootHash: []byte("root"), TreeSize: 42}
+	sig, err := oldSigner.SignLogRoot(logRoot)
+	if err != nil {
+		t.Fatalf("SignLogRoot failed: %v", err)
+	}
+	keySig, err := newSigner.SignLogRoot(logRoot)
+	if err != nil {
+		t.Fatalf("SignLogRoot failed: %v", err)
+	}
+	logRoot.Signature = &sig
+	logRoot.KeySignatures = []*trillian.KeySignature{{KeyId: "new", Signature: &keySig}}
+	for _, key := range []*ecdsa.PrivateKey{oldKey, newKey} {
+		if err := VerifyLogRootSignatures(key.Public(), hasher, logRoot); err != nil {
+			t.Errorf("VerifyLogRootSignatures failed: %v", err)
+		}
+	}
+	if err := VerifyLogRootSignatures(otherKey.Public(), hasher, logRoot); err == nil {
+		t.Errorf("VerifyLogRootSignatures accepted a root signed with other keys")
+	}
+	logRoot.Signature = nil
+	if err := VerifyLogRootSignatures(newKey.Public(), hasher, logRoot); err == nil {
+		t.Errorf("VerifyLogRootSignatures accepted a root with only key signatures")
+	}
+
+	mapRoot := trillian.SignedMapRoot{TimestampNanos: 1000, RootHash: []byte("root"), MapRevision: 7}
+	if sig, err = oldSigner.SignMapRoot(mapRoot); err != nil {
+		t.Fatalf("SignMapRoot failed: %v", err)
+	}
+	if keySig, err = newSigner.SignMapRoot(mapRoot); err != nil {
+		t.Fatalf("SignMapRoot failed: %v", err)
+	}
+	mapRoot.Signature = &sig
+	mapRoot.KeySignatures = []*trillian.KeySignature{{KeyId: "new", Signature: &keySig}}
+	for _, key := range []*ecdsa.PrivateKey{oldKey, newKey} {
+		if err := VerifyMapRootSignatures(key.Public(), hasher, mapRoot); err != nil {
+			t.Errorf("VerifyMapRootSignatures failed: %v", err)
+		}
+	}
+	if err := VerifyMapRootSignatures(otherKey.Public(), hasher, mapRoot); err == nil {
+		t.Errorf("VerifyMapRootSignatures accepted a root signed with other keys")
+	}
+}
+
+func TestKeySet(t *testing.T) {
+	var signers []*TrillianSigner
+	var treeKeys []*trillian.TreeKey
+	hasher := trillian.NewSHA256()
+	for i, id := range []string{"first", "second", "unknown"} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("GenerateKey failed: %v", err)
+		}
+		der, err := x509.MarshalPKIXPublicKey(key.Public())
+		if err != nil {
+			t.Fatalf("MarshalPKIXPublicKey failed: %v", err)
+		}
+		if id == "unknown" {
+			der = nil
+		}
+		signers = append(signers, NewTrillianSigner(hasher, trillian.SignatureAlgorithm_ECDSA, key))
+		treeKeys = append(treeKeys, &trillian.TreeKey{KeyId: id, PublicKeyDer: der, ActivateTimeNanos: int64(i * 1000)})
+	}
+	// The order the keys are given in doesn't matter
+	ks, err := NewKeySet([]*trillian.TreeKey{treeKeys[2], treeKeys[0], treeKeys[1]})
+	if err != nil {
+		t.Fatalf("NewKeySet failed: %v", err)
+	}
+
+	signed := func(timestamp int64, signer int, keySigner int) trillian.SignedLogRoot {
+		root := trillian.SignedLogRoot{TimestampNanos: timestamp, RootHash: []byte("root"), TreeSize: 42}
+		sig, err := signers[signer].SignLogRoot(root)
+		if err != nil {
+			t.Fatalf("SignLogRoot failed: %v", err)
+		}
+		root.Signature = &sig
+		if keySigner >= 0 {
+			keySig, err := signers[keySigner].SignLogRoot(root)
+			if err != nil {
+				t.Fatalf("SignLogRoot failed: %v", err)
+			}
+			root.KeySignatures = []*trillian.KeySignature{{KeyId: treeKeys[keySigner].KeyId, Signature: &keySig}}
+		}
+		return root
+	}
+	for _, test := range []struct {
+		desc string
+		root trillian.SignedLogRoot
+		ok   bool
+	}{
+		{desc: "first key", root: signed(500, 0, -1), ok: true},
+		{desc: "first key after rotation", root: signed(1500, 0, -1)},
+		{desc: "second key", root: signed(1500, 1, -1), ok: true},
+		{desc: "second key before activation", root: signed(500, 1, -1)},
+		{desc: "second key pending", root: signed(1500, 0, 1), ok: true},
+		{desc: "second key pending before activation", root: signed(500, 1, 1)},
+		{desc: "unknown public key", root: signed(2500, 1, -1)},
+	} {
+		err := ks.VerifyLogRoot(hasher, test.root)
+		if got := err == nil; got != test.ok {
+			t.Errorf("%s: VerifyLogRoot()=%v, want success %v", test.desc, err, test.ok)
+		}
+	}
+
+	mapRoot := trillian.SignedMapRoot{TimestampNanos: 1500, RootHash: []byte("root"), MapRevision: 7}
+	sig, err := signers[1].SignMapRoot(mapRoot)
+	if err != nil {
+		t.Fatalf("SignMapRoot failed: %v", err)
+	}
+	mapRoot.Signature = &sig
+	if err := ks.VerifyMapRoot(hasher, mapRoot); err != nil {
+		t.Errorf("VerifyMapRoot failed: %v", err)
+	}
+	mapRoot.TimestampNanos = 500
+	if err := ks.VerifyMapRoot(hasher, mapRoot); err == nil {
+		t.Errorf("VerifyMapRoot accepted a root signed before the key was activated")
+	}
+}
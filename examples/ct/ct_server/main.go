@@ -11,6 +11,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/google/trillian"
+	"github.com/google/trillian/client/discovery"
 	"github.com/google/trillian/crypto"
 	"github.com/google/trillian/examples/ct"
 	"github.com/google/trillian/util"
@@ -19,7 +20,7 @@ import (
 
 // TODO(Martin2112): We still have the treeid / log ID thing to think about + security etc.
 var logIDFlag = flag.Int64("log_id", 1, "The log id (tree id) to send to the backend")
-var rpcBackendFlag = flag.String("log_rpc_backend", "localhost:8090", "Backend Log RPC server to use")
+var rpcBackendFlag = flag.String("log_rpc_backend", "localhost:8090", "Backend Log RPC server to use, as a host:port address list or a consul://, etcd:// or kubernetes:// service")
 var rpcDeadlineFlag = flag.Duration("rpc_deadline", time.Second*10, "Deadline for backend RPC requests")
 var serverPortFlag = flag.Int("port", 8091, "Port to serve CT log requests on")
 var trustedRootPEMFlag = flag.String("trusted_roots", "", "File containing one or more concatenated trusted root certs in PEM format")
@@ -103,7 +104,7 @@ func main() {
 	// TODO(Martin2112): Support TLS and other stuff for RPC client and http server, this is just to
 	// get started. Uses a blocking connection so we don't start serving before we're connected
 	// to backend.
-	conn, err := grpc.Dial(*rpcBackendFlag, grpc.WithInsecure(), grpc.WithBlock())
+	conn, err := discovery.DialTarget(*rpcBackendFlag, grpc.WithInsecure(), grpc.WithBlock())
 
 	if err != nil {
 		glog.Fatalf("Could not connect to rpc server: %v", err)
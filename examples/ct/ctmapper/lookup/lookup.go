@@ -6,12 +6,13 @@ import (
 	"github.com/golang/glog"
 	"github.com/golang/protobuf/proto"
 	"github.com/google/trillian"
+	"github.com/google/trillian/client/discovery"
 	"github.com/google/trillian/examples/ct/ctmapper"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 )
 
-var mapServer = flag.String("map_server", "", "host:port for the map server")
+var mapServer = flag.String("map_server", "", "host:port for the map server, or a host:port list or consul://, etcd:// or kubernetes:// service")
 var mapID = flag.Int("map_id", -1, "Map ID to write to")
 
 func main() {
@@ -22,7 +23,7 @@ func main() {
 		return
 	}
 
-	conn, err := grpc.Dial(*mapServer, grpc.WithInsecure())
+	conn, err := discovery.DialTarget(*mapServer, grpc.WithInsecure())
 	if err != nil {
 		glog.Fatal(err)
 	}
@@ -10,15 +10,17 @@ import (
 	"github.com/google/certificate-transparency/go/client"
 	"github.com/google/certificate-transparency/go/x509"
 	"github.com/google/trillian"
+	"github.com/google/trillian/client/discovery"
 	"github.com/google/trillian/examples/ct/ctmapper"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 )
 
 var sourceLog = flag.String("source", "https://ct.googleapis.com/submariner", "Source CT Log")
-var mapServer = flag.String("map_server", "", "host:port for the map server")
+var mapServer = flag.String("map_server", "", "host:port for the map server, or a host:port list or consul://, etcd:// or kubernetes:// service")
 var mapID = flag.Int("map_id", -1, "Map ID to write to")
 var logBatchSize = flag.Int("log_batch_size", 256, "Max number of entries to process at a time from the CT Log")
+var initMap = flag.Bool("init_map", false, "Initialize the map before mapping, which must be done once for a new map")
 
 //TODO(al): factor this out into a reusable thing.
 
@@ -179,7 +181,7 @@ func (m *CTMapper) oneMapperRun() (bool, error) {
 
 func main() {
 	flag.Parse()
-	conn, err := grpc.Dial(*mapServer, grpc.WithInsecure())
+	conn, err := discovery.DialTarget(*mapServer, grpc.WithInsecure())
 	if err != nil {
 		glog.Fatal(err)
 	}
@@ -191,6 +193,12 @@ func main() {
 		vmap:  trillian.NewTrillianMapClient(conn),
 	}
 
+	if *initMap {
+		if _, err := mapper.vmap.InitMap(context.Background(), &trillian.InitMapRequest{MapId: mapper.mapID}); err != nil {
+			glog.Fatalf("Failed to initialize map: %v", err)
+		}
+	}
+
 	for {
 		moreToDo, err := mapper.oneMapperRun()
 		if err != nil {
@@ -0,0 +1,75 @@
+// Package gateway serves the read paths of the log and map APIs as HTTP/JSON,
+// for clients that can't use gRPC. The routes are those given by the
+// google.api.http options of trillian_api.proto, served by the grpc-gateway
+// handlers generated from them. Each is a GET request whose path names the
+// tree and whose query parameters set the other fields of the API request,
+// with repeated fields given more than once. Responses are returned as JSON
+// with the field names of the proto definitions. Bytes are base64 encoded in
+// both parameters and responses.
+//
+// The gateway doesn't charge quota itself. It names the client each request
+// is made for in the auth.ForwardedUserKey metadata, so that the log and map
+// servers charge the client rather than the gateway, if they're set to trust
+// the gateway's principal to forward users.
+package gateway
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/auth"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// NewHandler returns an http.Handler passing requests to logClient and
+// mapClient. Either may be nil, in which case the routes of that API aren't
+// served.
+func NewHandler(logClient trillian.TrillianLogClient, mapClient trillian.TrillianMapClient) (http.Handler, error) {
+	mux := runtime.NewServeMux(runtime.WithIncomingHeaderMatcher(headerMatcher), runtime.WithMetadata(forwardUser))
+	ctx := context.Background()
+	if logClient != nil {
+		if err := trillian.RegisterTrillianLogHandlerClient(ctx, mux, logClient); err != nil {
+			return nil, err
+		}
+	}
+	if mapClient != nil {
+		if err := trillian.RegisterTrillianMapHandlerClient(ctx, mux, mapClient); err != nil {
+			return nil, err
+		}
+	}
+	return mux, nil
+}
+
+// headerMatcher passes on the headers that grpc-gateway does by default,
+// except one that would name the forwarded user, which only the gateway may
+// set.
+func headerMatcher(key string) (string, bool) {
+	key, ok := runtime.DefaultHeaderMatcher(key)
+	if ok && strings.EqualFold(key, auth.ForwardedUserKey) {
+		return "", false
+	}
+	return key, ok
+}
+
+// forwardUser returns the metadata naming the client of r as the user the
+// request is forwarded for.
+func forwardUser(ctx context.Context, r *http.Request) metadata.MD {
+	return metadata.Pairs(auth.ForwardedUserKey, requestUser(r))
+}
+
+// requestUser returns the user who made r, which is the common name of their
+// verified client certificate, or else the host they connected from.
+func requestUser(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
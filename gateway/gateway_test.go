@@ -0,0 +1,150 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/auth"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+func newTestHandler(t *testing.T, logClient trillian.TrillianLogClient, mapClient trillian.TrillianMapClient) http.Handler {
+	h, err := NewHandler(logClient, mapClient)
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	return h
+}
+
+// get makes the request r, returning the status and the response, which is
+// only decoded if it's JSON.
+func get(t *testing.T, h http.Handler, r *http.Request) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	body, err := ioutil.ReadAll(w.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response to %s: %v", r.URL, err)
+	}
+	var resp map[string]interface{}
+	if w.Header().Get("Content-Type") == "application/json" {
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatalf("Response to %s isn't JSON: %q", r.URL, body)
+		}
+	}
+	return w.Code, resp
+}
+
+func TestLogRoutes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := trillian.NewMockTrillianLogClient(ctrl)
+	h := newTestHandler(t, client, nil)
+
+	// The generated handlers pass two call options with each request, which
+	// read the response's header and trailer
+	client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), &trillian.GetLatestSignedLogRootRequest{LogId: 5}, gomock.Any(), gomock.Any()).Return(
+		&trillian.GetLatestSignedLogRootResponse{SignedLogRoot: &trillian.SignedLogRoot{TreeSize: 10, RootHash: []byte("hash")}}, nil)
+	status, resp := get(t, h, httptest.NewRequest("GET", "/v1/logs/5/roots/latest", nil))
+	if status != http.StatusOK {
+		t.Fatalf("GET roots/latest status = %d, want %d: %v", status, http.StatusOK, resp)
+	}
+	root, ok := resp["signed_log_root"].(map[string]interface{})
+	if !ok || root["tree_size"] != "10" || root["root_hash"] != "aGFzaA==" {
+		t.Errorf("GET roots/latest = %v, want root of tree size 10 and hash aGFzaA==", resp)
+	}
+
+	client.EXPECT().GetLeavesByIndex(gomock.Any(), &trillian.GetLeavesByIndexRequest{LogId: 5, LeafIndex: []int64{1, 3}}, gomock.Any(), gomock.Any()).Return(
+		&trillian.GetLeavesByIndexResponse{}, nil)
+	if status, resp := get(t, h, httptest.NewRequest("GET", "/v1/logs/5/leaves?leaf_index=1&leaf_index=3", nil)); status != http.StatusOK {
+		t.Errorf("GET leaves status = %d, want %d: %v", status, http.StatusOK, resp)
+	}
+
+	client.EXPECT().GetInclusionProofByHash(gomock.Any(), &trillian.GetInclusionProofByHashRequest{LogId: 5, LeafHash: []byte{0xfb, 0xff}, TreeSize: 8}, gomock.Any(), gomock.Any()).Return(
+		&trillian.GetInclusionProofByHashResponse{}, nil)
+	if status, resp := get(t, h, httptest.NewRequest("GET", "/v1/logs/5/proofs/inclusion/by-hash?leaf_hash=-_8=&tree_size=8", nil)); status != http.StatusOK {
+		t.Errorf("GET proofs/inclusion/by-hash status = %d, want %d: %v", status, http.StatusOK, resp)
+	}
+
+	client.EXPECT().GetConsistencyProof(gomock.Any(), &trillian.GetConsistencyProofRequest{LogId: 5, FirstTreeSize: 2, SecondTreeSize: 8}, gomock.Any(), gomock.Any()).Return(
+		nil, grpc.Errorf(codes.InvalidArgument, "bad sizes"))
+	if status, resp := get(t, h, httptest.NewRequest("GET", "/v1/logs/5/proofs/consistency?first_tree_size=2&second_tree_size=8", nil)); status != http.StatusBadRequest || resp["error"] != "bad sizes" {
+		t.Errorf("GET proofs/consistency = %d %v, want %d with the server's error", status, resp, http.StatusBadRequest)
+	}
+
+	for _, test := range []struct {
+		method, path string
+		want         int
+	}{
+		{method: "GET", path: "/v1/logs/5/roots", want: http.StatusNotFound},
+		{method: "GET", path: "/v1/maps/5/roots/latest", want: http.StatusNotFound},
+		{method: "GET", path: "/v2/logs/5/roots/latest", want: http.StatusNotFound},
+		{method: "GET", path: "/v1/logs/abc/roots/latest", want: http.StatusBadRequest},
+		{method: "GET", path: "/v1/logs/5/leaves?leaf_index=x", want: http.StatusBadRequest},
+		{method: "GET", path: "/v1/logs/5/leaves/by-hash?leaf_hash=!", want: http.StatusBadRequest},
+		{method: "POST", path: "/v1/logs/5/roots/latest", want: http.StatusMethodNotAllowed},
+	} {
+		if status, resp := get(t, h, httptest.NewRequest(test.method, test.path, nil)); status != test.want {
+			t.Errorf("%s %s status = %d, want %d: %v", test.method, test.path, status, test.want, resp)
+		}
+	}
+}
+
+func TestMapRoutes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := trillian.NewMockTrillianMapClient(ctrl)
+	h := newTestHandler(t, nil, client)
+
+	client.EXPECT().GetLeaves(gomock.Any(), &trillian.GetMapLeavesRequest{MapId: 7, Key: [][]byte{[]byte("a"), []byte("b")}}, gomock.Any(), gomock.Any()).Return(
+		&trillian.GetMapLeavesResponse{}, nil)
+	if status, resp := get(t, h, httptest.NewRequest("GET", "/v1/maps/7/leaves?key=YQ==&key=Yg==", nil)); status != http.StatusOK {
+		t.Errorf("GET leaves status = %d, want %d: %v", status, http.StatusOK, resp)
+	}
+
+	client.EXPECT().GetMapLeavesWithProof(gomock.Any(), &trillian.GetMapLeavesRequest{MapId: 7, Key: [][]byte{[]byte("a")}, Revision: 3}, gomock.Any(), gomock.Any()).Return(
+		&trillian.GetMapLeavesWithProofResponse{}, nil)
+	if status, resp := get(t, h, httptest.NewRequest("GET", "/v1/maps/7/leaves/proofs?key=YQ==&revision=3", nil)); status != http.StatusOK {
+		t.Errorf("GET leaves/proofs status = %d, want %d: %v", status, http.StatusOK, resp)
+	}
+
+	if status, resp := get(t, h, httptest.NewRequest("GET", "/v1/logs/7/roots/latest", nil)); status != http.StatusNotFound {
+		t.Errorf("GET log route without a log client status = %d, want %d: %v", status, http.StatusNotFound, resp)
+	}
+}
+
+func TestForwardsUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := trillian.NewMockTrillianLogClient(ctrl)
+	h := newTestHandler(t, client, nil)
+
+	var users []string
+	client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, req *trillian.GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*trillian.GetLatestSignedLogRootResponse, error) {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			users = md[auth.ForwardedUserKey]
+			return &trillian.GetLatestSignedLogRootResponse{}, nil
+		})
+
+	// A client can't name someone else as the user
+	r := httptest.NewRequest("GET", "/v1/logs/5/roots/latest", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("Grpc-Metadata-"+auth.ForwardedUserKey, "alice")
+	if status, resp := get(t, h, r); status != http.StatusOK {
+		t.Fatalf("GET roots/latest status = %d, want %d: %v", status, http.StatusOK, resp)
+	}
+	if len(users) != 1 || users[0] != "192.0.2.1" {
+		t.Errorf("GET roots/latest forwarded users %v, want [192.0.2.1]", users)
+	}
+}
@@ -3,6 +3,7 @@ package trillian
 import (
 	"crypto"
 	_ "crypto/sha256" // Register the SHA256 algorithm
+	_ "crypto/sha512" // Register the SHA512 algorithm
 	"fmt"
 )
 
@@ -17,6 +18,8 @@ func NewHasher(alg HashAlgorithm) (Hasher, error) {
 	switch alg {
 	case HashAlgorithm_SHA256:
 		return Hasher{crypto.SHA256, alg}, nil
+	case HashAlgorithm_SHA512:
+		return Hasher{crypto.SHA512, alg}, nil
 	}
 	return Hasher{}, fmt.Errorf("unsupported hash algorithm %v", alg)
 }
@@ -38,6 +41,13 @@ func NewSHA256() Hasher {
 	return h
 }
 
+// NewSHA512t256 creates a Hasher instance for SHA-512/256. Its digests are the
+// same size as SHA-256's, which is the HashAlgorithm it reports as that's what
+// sets the depth of trees hashed with it.
+func NewSHA512t256() Hasher {
+	return Hasher{crypto.SHA512_256, HashAlgorithm_SHA256}
+}
+
 // HashAlgorithm returns an identifier for the underlying hash algorithm for a Hasher instance.
 func (h Hasher) HashAlgorithm() HashAlgorithm {
 	return h.alg
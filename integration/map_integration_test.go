@@ -37,6 +37,11 @@ func TestMapIntegration(t *testing.T) {
 	defer conn.Close()
 
 	{
+		// The map is new, so it has to be initialized before its root can be read
+		if _, err := client.InitMap(context.Background(), &trillian.InitMapRequest{MapId: *mapID}); err != nil {
+			t.Fatalf("Failed to initialize map: %v", err)
+		}
+
 		// Ensure we're starting with an empty map
 		r, err := client.GetSignedMapRoot(context.Background(), &trillian.GetSignedMapRootRequest{*mapID})
 		if err != nil {
@@ -0,0 +1,170 @@
+package log
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/monitoring"
+	"github.com/google/trillian/util"
+)
+
+// MergeDelayAlertFunc is called when the oldest leaf queued for the log treeID
+// has waited age to be integrated, which is close to the log's maximum merge
+// delay mmd.
+type MergeDelayAlertFunc func(treeID int64, age, mmd time.Duration)
+
+// MergeDelayMonitor watches how long leaves wait to be integrated into each log,
+// so that logs which promise a maximum merge delay (MMD), such as Certificate
+// Transparency logs, find out before they miss it. Sequencers report the
+// leaves they integrate and the oldest leaf still queued after each batch. A
+// monitor is shared by the sequencers of every log.
+type MergeDelayMonitor struct {
+	mmd        time.Duration
+	threshold  time.Duration
+	timeSource util.TimeSource
+	alert      MergeDelayAlertFunc
+
+	mergeDelay      monitoring.Histogram
+	oldestQueuedAge monitoring.Gauge
+
+	mu sync.Mutex
+	// oldest holds when the oldest queued leaf of each log with queued leaves
+	// was queued
+	oldest map[int64]int64
+	// alerted holds the logs that have been alerted on, until their oldest
+	// queued leaf is below the threshold again
+	alerted map[int64]bool
+}
+
+// NewMergeDelayMonitor creates a MergeDelayMonitor which alerts when a leaf has
+// been queued for alertFraction of mmd, with metrics created in mf. Alerts are
+// logged as errors unless SetAlertFunc is called.
+func NewMergeDelayMonitor(mf monitoring.MetricFactory, mmd time.Duration, alertFraction float64, timeSource util.TimeSource) *MergeDelayMonitor {
+	return &MergeDelayMonitor{
+		mmd:             mmd,
+		threshold:       time.Duration(float64(mmd) * alertFraction),
+		timeSource:      timeSource,
+		alert:           logMergeDelayAlert,
+		mergeDelay:      mf.NewHistogram("merge_delay_ms", "Time in milliseconds from leaves being queued to being integrated by log", "log_id"),
+		oldestQueuedAge: mf.NewGauge("oldest_queued_leaf_age_ms", "Time in milliseconds that the oldest queued leaf of each log had been queued for after its latest batch", "log_id"),
+		oldest:          make(map[int64]int64),
+		alerted:         make(map[int64]bool),
+	}
+}
+
+func logMergeDelayAlert(treeID int64, age, mmd time.Duration) {
+	glog.Errorf("%d: a leaf has been queued for %v, the log's maximum merge delay is %v", treeID, age, mmd)
+}
+
+// SetAlertFunc sets the function called when a log's oldest queued leaf reaches
+// the alert threshold, for example to page someone. It's called once each time
+// a log goes over the threshold.
+func (m *MergeDelayMonitor) SetAlertFunc(f MergeDelayAlertFunc) {
+	m.alert = f
+}
+
+// RecordIntegrated records the merge delays of leaves integrated into the log
+// treeID.
+func (m *MergeDelayMonitor) RecordIntegrated(treeID int64, leaves []trillian.LogLeaf) {
+	label := strconv.FormatInt(treeID, 10)
+	for _, leaf := range leaves {
+		if leaf.QueueTimestampNanos > 0 {
+			m.mergeDelay.Observe(float64(leaf.IntegrateTimestampNanos-leaf.QueueTimestampNanos)/float64(time.Millisecond), label)
+		}
+	}
+}
+
+// RecordOldestQueued records when the oldest leaf still queued for the log
+// treeID was queued, or zero if there are none, and alerts if it has been
+// queued for longer than the threshold.
+func (m *MergeDelayMonitor) RecordOldestQueued(treeID int64, queueTimestampNanos int64) {
+	var age time.Duration
+	if queueTimestampNanos > 0 {
+		age = m.timeSource.Now().Sub(time.Unix(0, queueTimestampNanos))
+	}
+	m.oldestQueuedAge.Set(float64(age)/float64(time.Millisecond), strconv.FormatInt(treeID, 10))
+
+	m.mu.Lock()
+	if queueTimestampNanos > 0 {
+		m.oldest[treeID] = queueTimestampNanos
+	} else {
+		delete(m.oldest, treeID)
+	}
+	over := queueTimestampNanos > 0 && age >= m.threshold
+	alert := over && !m.alerted[treeID]
+	if over {
+		m.alerted[treeID] = true
+	} else {
+		delete(m.alerted, treeID)
+	}
+	m.mu.Unlock()
+
+	if alert {
+		m.alert(treeID, age, m.mmd)
+	}
+}
+
+// Retain forgets the logs other than treeIDs, such as logs that another server
+// has taken over sequencing.
+func (m *MergeDelayMonitor) Retain(treeIDs []int64) {
+	keep := make(map[int64]bool)
+	for _, id := range treeIDs {
+		keep[id] = true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id := range m.oldest {
+		if !keep[id] {
+			delete(m.oldest, id)
+			delete(m.alerted, id)
+		}
+	}
+}
+
+// int64s sorts tree IDs.
+type int64s []int64
+
+func (s int64s) Len() int           { return len(s) }
+func (s int64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s int64s) Less(i, j int) bool { return s[i] < s[j] }
+
+// Check returns an error naming the logs whose oldest queued leaf has now been
+// queued for longer than the alert threshold. As the time is measured when
+// it's called, logs whose sequencing has stopped are included too.
+func (m *MergeDelayMonitor) Check() error {
+	now := m.timeSource.Now()
+	var late int64s
+	m.mu.Lock()
+	for id, queued := range m.oldest {
+		if now.Sub(time.Unix(0, queued)) >= m.threshold {
+			late = append(late, id)
+		}
+	}
+	m.mu.Unlock()
+	if len(late) == 0 {
+		return nil
+	}
+
+	sort.Sort(late)
+	ids := make([]string, 0, len(late))
+	for _, id := range late {
+		ids = append(ids, strconv.FormatInt(id, 10))
+	}
+	return fmt.Errorf("leaves queued for over %v, with a maximum merge delay of %v, in logs: %s", m.threshold, m.mmd, strings.Join(ids, ", "))
+}
+
+// ServeHTTP serves a health check, which fails if Check returns an error.
+func (m *MergeDelayMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := m.Check(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
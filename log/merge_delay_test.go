@@ -0,0 +1,121 @@
+package log
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/monitoring"
+	"github.com/google/trillian/util"
+)
+
+func TestMergeDelayMonitorRecordIntegrated(t *testing.T) {
+	m := NewMergeDelayMonitor(monitoring.InertMetricFactory{}, time.Hour, 0.8, util.FakeTimeSource{FakeTime: fakeTimeForTest})
+	now := fakeTimeForTest.UnixNano()
+	m.RecordIntegrated(1, []trillian.LogLeaf{
+		{QueueTimestampNanos: now - int64(3*time.Second), IntegrateTimestampNanos: now},
+		{QueueTimestampNanos: now - int64(time.Second), IntegrateTimestampNanos: now},
+		// Leaves without a queue timestamp aren't recorded
+		{IntegrateTimestampNanos: now},
+	})
+	if count, sum := m.mergeDelay.Info("1"); count != 2 || sum != 4000 {
+		t.Errorf("Recorded %d leaves integrated after %vms, want 2 after 4000ms", count, sum)
+	}
+	if count, _ := m.mergeDelay.Info("2"); count != 0 {
+		t.Errorf("Recorded %d leaves for another log, want 0", count)
+	}
+}
+
+func TestMergeDelayMonitorAlerts(t *testing.T) {
+	ts := &util.FakeTimeSource{FakeTime: fakeTimeForTest}
+	m := NewMergeDelayMonitor(monitoring.InertMetricFactory{}, 10*time.Second, 0.8, ts)
+	var alerts []time.Duration
+	m.SetAlertFunc(func(treeID int64, age, mmd time.Duration) {
+		if treeID != 1 || mmd != 10*time.Second {
+			t.Errorf("Alerted for log %d with mmd %v, want log 1 with mmd 10s", treeID, mmd)
+		}
+		alerts = append(alerts, age)
+	})
+	queued := fakeTimeForTest.Add(-5 * time.Second).UnixNano()
+
+	m.RecordOldestQueued(1, queued)
+	if got := m.oldestQueuedAge.Value("1"); got != 5000 {
+		t.Errorf("Recorded oldest queued leaf age %vms, want 5000ms", got)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("Alerted %v below the threshold", alerts)
+	}
+	if err := m.Check(); err != nil {
+		t.Errorf("Check() = %v below the threshold", err)
+	}
+
+	// The health check fails once the threshold is passed, even if the
+	// sequencer hasn't recorded anything since
+	ts.FakeTime = fakeTimeForTest.Add(3 * time.Second)
+	if err := m.Check(); err == nil {
+		t.Error("Check() succeeded over the threshold")
+	}
+
+	// Alerts are made once while the log stays over the threshold
+	m.RecordOldestQueued(1, queued)
+	m.RecordOldestQueued(1, queued)
+	if len(alerts) != 1 || alerts[0] != 8*time.Second {
+		t.Errorf("Alerted %v, want [8s]", alerts)
+	}
+
+	// And again once it's gone under and back over
+	m.RecordOldestQueued(1, 0)
+	if err := m.Check(); err != nil {
+		t.Errorf("Check() = %v with no queued leaves", err)
+	}
+	if got := m.oldestQueuedAge.Value("1"); got != 0 {
+		t.Errorf("Recorded oldest queued leaf age %vms with no queued leaves, want 0ms", got)
+	}
+	m.RecordOldestQueued(1, queued)
+	if len(alerts) != 2 {
+		t.Errorf("Alerted %d times, want 2", len(alerts))
+	}
+}
+
+func TestMergeDelayMonitorRetain(t *testing.T) {
+	ts := &util.FakeTimeSource{FakeTime: fakeTimeForTest}
+	m := NewMergeDelayMonitor(monitoring.InertMetricFactory{}, 10*time.Second, 0.5, ts)
+	m.SetAlertFunc(func(int64, time.Duration, time.Duration) {})
+	queued := fakeTimeForTest.UnixNano()
+	m.RecordOldestQueued(1, queued)
+	m.RecordOldestQueued(2, queued)
+	m.RecordOldestQueued(3, queued)
+
+	ts.FakeTime = fakeTimeForTest.Add(time.Minute)
+	if err, want := m.Check(), "leaves queued for over 5s, with a maximum merge delay of 10s, in logs: 1, 2, 3"; err == nil || err.Error() != want {
+		t.Errorf("Check() = %v, want %s", err, want)
+	}
+	m.Retain([]int64{2, 4})
+	if err, want := m.Check(), "leaves queued for over 5s, with a maximum merge delay of 10s, in logs: 2"; err == nil || err.Error() != want {
+		t.Errorf("Check() after Retain = %v, want %s", err, want)
+	}
+}
+
+func TestMergeDelayMonitorServeHTTP(t *testing.T) {
+	ts := &util.FakeTimeSource{FakeTime: fakeTimeForTest}
+	m := NewMergeDelayMonitor(monitoring.InertMetricFactory{}, 10*time.Second, 0.5, ts)
+	m.SetAlertFunc(func(int64, time.Duration, time.Duration) {})
+	m.RecordOldestQueued(1, fakeTimeForTest.UnixNano())
+
+	for _, test := range []struct {
+		after time.Duration
+		want  int
+	}{
+		{after: time.Second, want: http.StatusOK},
+		{after: time.Minute, want: http.StatusServiceUnavailable},
+	} {
+		ts.FakeTime = fakeTimeForTest.Add(test.after)
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+		if w.Code != test.want {
+			t.Errorf("ServeHTTP() after %v = %d, want %d: %s", test.after, w.Code, test.want, w.Body.String())
+		}
+	}
+}
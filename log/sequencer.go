@@ -3,12 +3,16 @@
 package log
 
 import (
+	"crypto/ed25519"
 	"fmt"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian"
 	"github.com/google/trillian/crypto"
 	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/monitoring"
+	"github.com/google/trillian/monitoring/trace"
 	"github.com/google/trillian/storage"
 	"github.com/google/trillian/util"
 )
@@ -17,11 +21,84 @@ import (
 // Leaves will be assigned unique sequence numbers when they are processed.
 // There is no strong ordering guarantee but in general entries will be processed
 // in order of submission to the log.
+//
+// Sequencers run in the background under a server.LogOperationManager, which
+// sets their batch size and interval, and a server.SequencerManager, which
+// sets their guard window. They stay in this package, rather than a separate
+// log/sequencer package, as the servers and tools already use them from here.
 type Sequencer struct {
 	hasher     merkle.TreeHasher
 	timeSource util.TimeSource
 	logStorage storage.LogStorage
 	keyManager crypto.KeyManager
+	// rootSigner signs new roots if set, instead of a signer using keyManager
+	rootSigner crypto.LogRootSigner
+	// maxClockSkew is how far a new root's timestamp may be behind the current one's
+	maxClockSkew time.Duration
+	// guardWindow is how long leaves must have been queued for before they're
+	// sequenced
+	guardWindow time.Duration
+	// metrics records the batches sequenced if set
+	metrics *SequencerMetrics
+	// tracer traces each batch sequenced if set
+	tracer *trace.Tracer
+	// preordered is set for logs whose leaves are added at their indices
+	preordered bool
+	// mergeDelays is told about the leaves of the log treeID if set
+	mergeDelays *MergeDelayMonitor
+	treeID      int64
+}
+
+// SequencerMetrics records the work done by sequencers. The metrics are created
+// once, by NewSequencerMetrics, and shared by the sequencers of every log.
+type SequencerMetrics struct {
+	batches        monitoring.Counter
+	batchSize      monitoring.Histogram
+	integrationLag monitoring.Histogram
+	signLatency    monitoring.Histogram
+}
+
+// NewSequencerMetrics creates the sequencer metrics in mf.
+func NewSequencerMetrics(mf monitoring.MetricFactory) *SequencerMetrics {
+	return &SequencerMetrics{
+		batches:        mf.NewCounter("sequencer_batches", "Number of sequencing passes over a log by result", "result"),
+		batchSize:      mf.NewHistogram("sequencer_batch_size", "Number of leaves integrated by passes that found leaves to sequence"),
+		integrationLag: mf.NewHistogram("sequencer_integration_lag_ms", "Time in milliseconds from leaves being queued to being integrated"),
+		signLatency:    mf.NewHistogram("sequencer_sign_latency_ms", "Latency of signing log roots in milliseconds by result", "result"),
+	}
+}
+
+// resultLabel returns the label value for the outcome of an operation.
+func resultLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// SetMetrics sets the metrics recording the batches sequenced and the roots
+// signed.
+func (s *Sequencer) SetMetrics(m *SequencerMetrics) {
+	s.metrics = m
+}
+
+// SetTracer sets the tracer which starts a trace for each batch sequenced.
+func (s *Sequencer) SetTracer(t *trace.Tracer) {
+	s.tracer = t
+}
+
+// SetMergeDelayMonitor makes the sequencer report the leaves it integrates, and
+// the oldest leaf left queued after each batch, to m as those of the log treeID.
+func (s *Sequencer) SetMergeDelayMonitor(m *MergeDelayMonitor, treeID int64) {
+	s.mergeDelays = m
+	s.treeID = treeID
+}
+
+// SetPreordered makes the sequencer integrate the leaves of a pre-ordered log,
+// which have been added at their indices by AddSequencedLeaves, rather than
+// dequeueing queued leaves and assigning them sequence numbers.
+func (s *Sequencer) SetPreordered(preordered bool) {
+	s.preordered = preordered
 }
 
 // maxTreeDepth sets an upper limit on the size of Log trees.
@@ -37,7 +114,27 @@ type CurrentRootExpiredFunc func(trillian.SignedLogRoot) bool
 
 // NewSequencer creates a new Sequencer instance for the specified inputs.
 func NewSequencer(hasher merkle.TreeHasher, timeSource util.TimeSource, logStorage storage.LogStorage, km crypto.KeyManager) *Sequencer {
-	return &Sequencer{hasher, timeSource, logStorage, km}
+	return &Sequencer{hasher: hasher, timeSource: timeSource, logStorage: logStorage, keyManager: km}
+}
+
+// NewSequencerWithRootSigner creates a new Sequencer instance which has its roots
+// signed by rootSigner, for example when the key is held by a separate signing service.
+func NewSequencerWithRootSigner(hasher merkle.TreeHasher, timeSource util.TimeSource, logStorage storage.LogStorage, rootSigner crypto.LogRootSigner) *Sequencer {
+	return &Sequencer{hasher: hasher, timeSource: timeSource, logStorage: logStorage, rootSigner: rootSigner}
+}
+
+// SetGuardWindow stops leaves being sequenced until they've been queued for at
+// least d, which gives personalities time to find and drop duplicates before
+// they're integrated.
+func (s *Sequencer) SetGuardWindow(d time.Duration) {
+	s.guardWindow = d
+}
+
+// SetMaxClockSkew allows new roots to have timestamps up to d earlier than the
+// current root's, rather than having to be later. It should only be needed
+// if the sequencer runs on several hosts whose clocks disagree.
+func (s *Sequencer) SetMaxClockSkew(d time.Duration) {
+	s.maxClockSkew = d
 }
 
 // TODO: This currently doesn't use the batch api for fetching the required nodes. This
@@ -120,25 +217,93 @@ func (s Sequencer) initMerkleTreeFromStorage(currentRoot trillian.SignedLogRoot,
 	return s.buildMerkleTreeFromStorageAtRoot(currentRoot, tx)
 }
 
-func (s Sequencer) signRoot(root trillian.SignedLogRoot) (trillian.DigitallySigned, error) {
+// consistencyProof returns a function serving the proofs that the tree of
+// treeSize leaves at treeRevision is consistent with its earlier sizes. The
+// nodes are read through tx, so they can include those it has just written.
+func consistencyProof(tx storage.TreeTX, treeSize, treeRevision int64) crypto.ConsistencyProofFunc {
+	return func(fromSize int64) ([][]byte, error) {
+		if fromSize == treeSize {
+			return nil, nil
+		}
+		nodeIDs, err := merkle.CalcConsistencyProofNodeAddresses(fromSize, treeSize, maxTreeDepth)
+		if err != nil {
+			return nil, err
+		}
+		nodes, err := tx.GetMerkleNodes(treeRevision, nodeIDs)
+		if err != nil {
+			return nil, err
+		}
+		if len(nodes) != len(nodeIDs) {
+			return nil, fmt.Errorf("expected %d nodes in proof but got %d", len(nodeIDs), len(nodes))
+		}
+		hashes := make([][]byte, 0, len(nodes))
+		for i, node := range nodes {
+			if !node.NodeID.Equivalent(nodeIDs[i]) {
+				return nil, fmt.Errorf("expected node %v at proof pos %d but got %v", nodeIDs[i], i, node.NodeID)
+			}
+			hashes = append(hashes, node.Hash)
+		}
+		return hashes, nil
+	}
+}
+
+// signRoot signs root, recording the time taken if the sequencer has metrics.
+// If the root signer is a crypto.LogRootKeySigner the root is also signed with
+// the log's keys that are waiting to be activated. If it's a
+// crypto.LogRootConsistencySigner it's given proof, which may be nil if the
+// root is no larger than the previous one.
+func (s Sequencer) signRoot(root trillian.SignedLogRoot, proof crypto.ConsistencyProofFunc) (_ trillian.DigitallySigned, _ []*trillian.KeySignature, err error) {
+	if s.metrics != nil {
+		defer func(start time.Time) {
+			s.metrics.signLatency.Observe(float64(time.Since(start).Nanoseconds())/float64(time.Millisecond), resultLabel(err))
+		}(time.Now())
+	}
+
+	if s.rootSigner != nil {
+		var signature trillian.DigitallySigned
+		if c, ok := s.rootSigner.(crypto.LogRootConsistencySigner); ok {
+			signature, err = c.SignLogRootConsistent(root, proof)
+		} else {
+			signature, err = s.rootSigner.SignLogRoot(root)
+		}
+		if err != nil {
+			glog.Warningf("root signer failed to sign root: %v", err)
+			return trillian.DigitallySigned{}, nil, err
+		}
+		keySigner, ok := s.rootSigner.(crypto.LogRootKeySigner)
+		if !ok {
+			return signature, nil, nil
+		}
+		keySignatures, err := keySigner.KeySignLogRoot(root)
+		if err != nil {
+			glog.Warningf("root signer failed to sign root with pending keys: %v", err)
+			return trillian.DigitallySigned{}, nil, err
+		}
+		return signature, keySignatures, nil
+	}
+
 	signer, err := s.keyManager.Signer()
 
 	if err != nil {
 		glog.Warningf("key manager failed to create crypto.Signer: %v", err)
-		return trillian.DigitallySigned{}, err
+		return trillian.DigitallySigned{}, nil, err
 	}
 
 	// TODO(Martin2112): Signature algorithm shouldn't be fixed here
-	trillianSigner := crypto.NewTrillianSigner(s.hasher.Hasher, trillian.SignatureAlgorithm_ECDSA, signer)
+	algorithm := trillian.SignatureAlgorithm_ECDSA
+	if _, ok := signer.(ed25519.PrivateKey); ok {
+		algorithm = trillian.SignatureAlgorithm_ED25519
+	}
+	trillianSigner := crypto.NewTrillianSigner(s.hasher.Hasher, algorithm, signer)
 
 	signature, err := trillianSigner.SignLogRoot(root)
 
 	if err != nil {
 		glog.Warningf("signer failed to sign root: %v", err)
-		return trillian.DigitallySigned{}, err
+		return trillian.DigitallySigned{}, nil, err
 	}
 
-	return signature, nil
+	return signature, nil, nil
 }
 
 // SequenceBatch wraps up all the operations needed to take a batch of queued leaves
@@ -147,19 +312,42 @@ func (s Sequencer) signRoot(root trillian.SignedLogRoot) (trillian.DigitallySign
 // which will fail if the tx was committed. Should only do this if we can hide the details of
 // the underlying storage transactions and it doesn't create other problems.
 func (s Sequencer) SequenceBatch(limit int, expiryFunc CurrentRootExpiredFunc) (int, error) {
+	span := s.tracer.StartSpan("sequencer.SequenceBatch")
+	defer span.Finish()
+
+	count, err := s.sequenceBatch(span, limit, expiryFunc)
+	// The oldest queued leaf is found even if the batch failed, as a log that
+	// can't be sequenced is just as likely to miss its merge delay
+	s.recordOldestQueued()
+	span.SetTag("leaves", count)
+	span.SetError(err)
+	if s.metrics != nil {
+		s.metrics.batches.Inc(resultLabel(err))
+		if err == nil && count > 0 {
+			s.metrics.batchSize.Observe(float64(count))
+		}
+	}
+	return count, err
+}
+
+func (s Sequencer) sequenceBatch(span *trace.Span, limit int, expiryFunc CurrentRootExpiredFunc) (int, error) {
 	tx, err := s.logStorage.Begin()
 
 	if err != nil {
 		glog.Warningf("Sequencer failed to start tx: %s", err)
 		return 0, err
 	}
+	trace.SetSpan(tx, span)
 
-	leaves, err := tx.DequeueLeaves(limit)
+	var leaves []trillian.LogLeaf
+	if !s.preordered {
+		leaves, err = tx.DequeueLeaves(limit, s.guardWindow)
 
-	if err != nil {
-		glog.Warningf("Sequencer failed to dequeue leaves: %s", err)
-		tx.Rollback()
-		return 0, err
+		if err != nil {
+			glog.Warningf("Sequencer failed to dequeue leaves: %s", err)
+			tx.Rollback()
+			return 0, err
+		}
 	}
 
 	// Get the latest known root from storage
@@ -171,6 +359,20 @@ func (s Sequencer) SequenceBatch(limit int, expiryFunc CurrentRootExpiredFunc) (
 		return 0, err
 	}
 
+	// The leaves of a pre-ordered log are integrated in order from the end of
+	// the tree, up to the first index that hasn't been added yet
+	if s.preordered {
+		leaves, err = tx.DequeueSequencedLeaves(currentRoot.TreeSize, limit)
+
+		if err != nil {
+			glog.Warningf("Sequencer failed to dequeue added leaves: %s", err)
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	span.SetTag("log_id", currentRoot.LogId)
+
 	// TODO(al): Have a better detection mechanism for there being no stored root.
 	if currentRoot.RootHash == nil {
 		glog.Warning("Fresh log - no previous TreeHeads exist.")
@@ -205,6 +407,7 @@ func (s Sequencer) SequenceBatch(limit int, expiryFunc CurrentRootExpiredFunc) (
 		tx.Rollback()
 		return 0, fmt.Errorf("got writeRevision of %d, but expected %d", got, want)
 	}
+	span.SetTag("revision", newVersion)
 
 	// Assign leaf sequence numbers and collate node updates
 	nodeMap, sequenceNumbers, err := s.sequenceLeaves(merkleTree, leaves)
@@ -218,8 +421,17 @@ func (s Sequencer) SequenceBatch(limit int, expiryFunc CurrentRootExpiredFunc) (
 			len(leaves)))
 	}
 
+	now := s.timeSource.Now().UnixNano()
 	for index := range sequenceNumbers {
+		// The leaves of a pre-ordered log already have their sequence numbers,
+		// which must be the positions they've been added at in the tree
+		if s.preordered && leaves[index].SequenceNumber != sequenceNumbers[index] {
+			tx.Rollback()
+			return 0, fmt.Errorf("leaf at index %d was added to the tree at %d", leaves[index].SequenceNumber, sequenceNumbers[index])
+		}
+		// The leaves are integrated at the time of the new root
 		leaves[index].SequenceNumber = sequenceNumbers[index]
+		leaves[index].IntegrateTimestampNanos = now
 	}
 
 	// Write the new sequence numbers to the leaves in the DB
@@ -255,14 +467,23 @@ func (s Sequencer) SequenceBatch(limit int, expiryFunc CurrentRootExpiredFunc) (
 	// Create the log root ready for signing
 	newLogRoot := trillian.SignedLogRoot{
 		RootHash:       merkleTree.CurrentRoot(),
-		TimestampNanos: s.timeSource.Now().UnixNano(),
+		TimestampNanos: now,
 		TreeSize:       merkleTree.Size(),
 		LogId:          currentRoot.LogId,
 		TreeRevision:   newVersion,
 	}
 
+	if err := storage.CheckLogRootFollows(currentRoot, newLogRoot, s.maxClockSkew); err != nil {
+		glog.Warningf("Sequencer refused to create root: %v", err)
+		tx.Rollback()
+		return 0, err
+	}
+
 	// Hash and sign the root, update it with the signature
-	signature, err := s.signRoot(newLogRoot)
+	signSpan := span.StartChild("sequencer.SignRoot")
+	signature, keySignatures, err := s.signRoot(newLogRoot, consistencyProof(tx, newLogRoot.TreeSize, newVersion))
+	signSpan.SetError(err)
+	signSpan.Finish()
 
 	if err != nil {
 		glog.Warningf("signer failed to sign root: %v", err)
@@ -271,6 +492,7 @@ func (s Sequencer) SequenceBatch(limit int, expiryFunc CurrentRootExpiredFunc) (
 	}
 
 	newLogRoot.Signature = &signature
+	newLogRoot.KeySignatures = keySignatures
 
 	err = tx.StoreSignedLogRoot(newLogRoot)
 
@@ -285,10 +507,105 @@ func (s Sequencer) SequenceBatch(limit int, expiryFunc CurrentRootExpiredFunc) (
 		return 0, err
 	}
 
+	if s.metrics != nil && !s.preordered {
+		for _, leaf := range leaves {
+			if leaf.QueueTimestampNanos > 0 {
+				s.metrics.integrationLag.Observe(float64(now-leaf.QueueTimestampNanos) / float64(time.Millisecond))
+			}
+		}
+	}
+	if s.mergeDelays != nil && !s.preordered {
+		s.mergeDelays.RecordIntegrated(s.treeID, leaves)
+	}
+
 	return len(leaves), nil
 }
 
-// SignRoot wraps up all the operations for creating a new log signed root.
+// recordOldestQueued reports the oldest leaf queued for the log to the merge
+// delay monitor, if there is one.
+func (s Sequencer) recordOldestQueued() {
+	if s.mergeDelays == nil || s.preordered {
+		return
+	}
+
+	tx, err := s.logStorage.Snapshot()
+	if err != nil {
+		glog.Warningf("%d: failed to start tx to find oldest queued leaf: %v", s.treeID, err)
+		return
+	}
+	oldest, err := tx.OldestQueuedLeafTimestampNanos()
+	if err != nil {
+		glog.Warningf("%d: failed to find oldest queued leaf: %v", s.treeID, err)
+		tx.Commit()
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		glog.Warningf("%d: failed to commit finding oldest queued leaf: %v", s.treeID, err)
+		return
+	}
+	s.mergeDelays.RecordOldestQueued(s.treeID, oldest)
+}
+
+// InitLog creates and stores a signed root for the empty log, at revision 0, so
+// that the log has a root before any leaves are sequenced. It fails with
+// storage.ErrTreeAlreadyInitialized if the log already has a root.
+func (s Sequencer) InitLog() (trillian.SignedLogRoot, error) {
+	tx, err := s.logStorage.Begin()
+
+	if err != nil {
+		glog.Warningf("init failed to start tx: %s", err)
+		return trillian.SignedLogRoot{}, err
+	}
+
+	currentRoot, err := tx.LatestSignedLogRoot()
+
+	if err != nil {
+		glog.Warningf("init failed to get latest root: %s", err)
+		tx.Rollback()
+		return trillian.SignedLogRoot{}, err
+	}
+
+	// A stored root always has a hash, even for an empty tree
+	if len(currentRoot.RootHash) > 0 {
+		tx.Rollback()
+		return trillian.SignedLogRoot{}, storage.ErrTreeAlreadyInitialized
+	}
+
+	newLogRoot := trillian.SignedLogRoot{
+		RootHash:       merkle.NewCompactMerkleTree(s.hasher).CurrentRoot(),
+		TimestampNanos: s.timeSource.Now().UnixNano(),
+		TreeSize:       0,
+		LogId:          currentRoot.LogId,
+		TreeRevision:   0,
+	}
+
+	signature, keySignatures, err := s.signRoot(newLogRoot, nil)
+
+	if err != nil {
+		glog.Warningf("init failed to sign root: %v", err)
+		tx.Rollback()
+		return trillian.SignedLogRoot{}, err
+	}
+
+	newLogRoot.Signature = &signature
+	newLogRoot.KeySignatures = keySignatures
+
+	if err := tx.StoreSignedLogRoot(newLogRoot); err != nil {
+		glog.Warningf("init failed to write root: %v", err)
+		tx.Rollback()
+		return trillian.SignedLogRoot{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return trillian.SignedLogRoot{}, err
+	}
+	return newLogRoot, nil
+}
+
+// SignRoot signs a root for the log when it has no new leaves to integrate, so
+// that clients can tell an idle log from a stalled one. The latest root is
+// re-signed with the current time, keeping its tree size, root hash and
+// revision, or if the log has no root yet its first root is created.
 func (s Sequencer) SignRoot() error {
 	tx, err := s.logStorage.Begin()
 
@@ -306,6 +623,10 @@ func (s Sequencer) SignRoot() error {
 		return err
 	}
 
+	if len(currentRoot.RootHash) > 0 {
+		return s.refreshRoot(tx, currentRoot)
+	}
+
 	// Initialize a Merkle Tree from the state in storage. This should fail if the tree is
 	// in a corrupt state.
 	merkleTree, err := s.initMerkleTreeFromStorage(currentRoot, tx)
@@ -324,8 +645,14 @@ func (s Sequencer) SignRoot() error {
 		TreeRevision:   currentRoot.TreeRevision + 1,
 	}
 
+	if err := storage.CheckLogRootFollows(currentRoot, newLogRoot, s.maxClockSkew); err != nil {
+		glog.Warningf("signer refused to create root: %v", err)
+		tx.Rollback()
+		return err
+	}
+
 	// Hash and sign the root
-	signature, err := s.signRoot(newLogRoot)
+	signature, keySignatures, err := s.signRoot(newLogRoot, nil)
 
 	if err != nil {
 		glog.Warningf("signer failed to sign root: %v", err)
@@ -334,6 +661,7 @@ func (s Sequencer) SignRoot() error {
 	}
 
 	newLogRoot.Signature = &signature
+	newLogRoot.KeySignatures = keySignatures
 
 	// Store the new root and we're done
 	if err := tx.StoreSignedLogRoot(newLogRoot); err != nil {
@@ -344,3 +672,39 @@ func (s Sequencer) SignRoot() error {
 
 	return tx.Commit()
 }
+
+// refreshRoot re-signs currentRoot with the current time and replaces it with
+// the result in tx, which it commits. The root's cosignatures are dropped, as
+// they don't cover the new timestamp, so the log has none until its witnesses
+// next follow it and cosign the refreshed root.
+func (s Sequencer) refreshRoot(tx storage.LogTX, currentRoot trillian.SignedLogRoot) error {
+	newLogRoot := currentRoot
+	newLogRoot.TimestampNanos = s.timeSource.Now().UnixNano()
+	newLogRoot.Signature = nil
+	newLogRoot.KeySignatures = nil
+
+	if err := storage.CheckLogRootRefresh(currentRoot, newLogRoot); err != nil {
+		glog.Warningf("signer refused to refresh root: %v", err)
+		tx.Rollback()
+		return err
+	}
+
+	signature, keySignatures, err := s.signRoot(newLogRoot, nil)
+
+	if err != nil {
+		glog.Warningf("signer failed to sign root: %v", err)
+		tx.Rollback()
+		return err
+	}
+
+	newLogRoot.Signature = &signature
+	newLogRoot.KeySignatures = keySignatures
+
+	if err := tx.RefreshSignedLogRoot(newLogRoot); err != nil {
+		glog.Warningf("signer failed to write refreshed root: %v", err)
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
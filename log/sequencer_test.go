@@ -3,6 +3,7 @@ package log
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/google/trillian"
 	"github.com/google/trillian/crypto"
 	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/monitoring"
 	"github.com/google/trillian/storage"
 	"github.com/google/trillian/testonly"
 	"github.com/google/trillian/util"
@@ -27,7 +29,7 @@ func rootNeverExpiresFunc(trillian.SignedLogRoot) bool {
 
 // These can be shared between tests as they're never modified
 var testLeaf16Hash = trillian.Hash{0, 1, 2, 3, 4, 5}
-var testLeaf16 = trillian.LogLeaf{Leaf: trillian.Leaf{LeafHash: testLeaf16Hash, LeafValue: nil, ExtraData: nil}, SequenceNumber: 16}
+var testLeaf16 = trillian.LogLeaf{Leaf: trillian.Leaf{LeafHash: testLeaf16Hash, LeafValue: nil, ExtraData: nil}, SequenceNumber: 16, IntegrateTimestampNanos: fakeTimeForTest.UnixNano()}
 
 // RootHash can't be nil because that's how the sequencer currently detects that there was no stored tree head.
 var testRoot16 = trillian.SignedLogRoot{TreeSize: 16, TreeRevision: 5, RootHash: []byte{}}
@@ -81,6 +83,7 @@ type testParameters struct {
 
 	beginFails   bool
 	dequeueLimit int
+	guardWindow  time.Duration
 
 	shouldCommit   bool
 	commitFails    bool
@@ -103,6 +106,7 @@ type testParameters struct {
 	skipStoreSignedRoot  bool
 	storeSignedRoot      *trillian.SignedLogRoot
 	storeSignedRootError error
+	refreshedRoot        *trillian.SignedLogRoot
 
 	setupSigner     bool
 	keyManagerError error
@@ -166,7 +170,7 @@ func createTestContext(ctrl *gomock.Controller, params testParameters) testConte
 	}
 
 	if !params.skipDequeue {
-		mockTx.EXPECT().DequeueLeaves(params.dequeueLimit).AnyTimes().Return(params.dequeuedLeaves, params.dequeuedError)
+		mockTx.EXPECT().DequeueLeaves(params.dequeueLimit, params.guardWindow).AnyTimes().Return(params.dequeuedLeaves, params.dequeuedError)
 	}
 
 	if params.latestSignedRoot != nil {
@@ -188,6 +192,9 @@ func createTestContext(ctrl *gomock.Controller, params testParameters) testConte
 			// At the moment if we're going to fail the operation we accept any root
 			mockTx.EXPECT().StoreSignedLogRoot(gomock.Any()).AnyTimes().Return(params.storeSignedRootError)
 		}
+		if params.refreshedRoot != nil {
+			mockTx.EXPECT().RefreshSignedLogRoot(*params.refreshedRoot).Return(params.storeSignedRootError)
+		}
 	}
 
 	mockKeyManager := crypto.NewMockKeyManager(ctrl)
@@ -414,6 +421,155 @@ func TestSequenceBatch(t *testing.T) {
 	}
 }
 
+func TestSequenceBatchPreordered(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The leaf was added at index 16, so it's dequeued from there, and gets the
+	// timestamp it's integrated at
+	leaf := testLeaf16
+	leaf.IntegrateTimestampNanos = 0
+	params := testParameters{writeRevision: testRoot16.TreeRevision + 1, skipDequeue: true, shouldCommit: true,
+		latestSignedRoot: &testRoot16, updatedLeaves: &[]trillian.LogLeaf{testLeaf16}, merkleNodesSet: &updatedNodes,
+		storeSignedRoot: &expectedSignedRoot, setupSigner: true,
+		dataToSign:    []byte{0x4f, 0x21, 0x7d, 0x10, 0xe2, 0x6, 0x9f, 0x10, 0x4d, 0x7e, 0x42, 0x75, 0x24, 0x3b, 0xb3, 0x5b, 0x63, 0xa6, 0x7, 0x8d, 0x6c, 0x97, 0x23, 0x4, 0x8, 0x5e, 0x3b, 0xe2, 0xc4, 0xb8, 0x7a, 0xa2},
+		signingResult: []byte("signed")}
+	c := createTestContext(ctrl, params)
+	c.mockTx.EXPECT().DequeueSequencedLeaves(int64(16), 10).Return([]trillian.LogLeaf{leaf}, nil)
+	c.sequencer.SetPreordered(true)
+
+	leafCount, err := c.sequencer.SequenceBatch(10, rootNeverExpiresFunc)
+	if err != nil {
+		t.Fatalf("Expected sequencing to succeed, but got err: %v", err)
+	}
+	if got, want := leafCount, 1; got != want {
+		t.Fatalf("Sequenced %d leaf, expected %d", got, want)
+	}
+}
+
+func TestSequenceBatchPreorderedWrongIndex(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	params := testParameters{writeRevision: testRoot16.TreeRevision + 1, skipDequeue: true, shouldRollback: true,
+		latestSignedRoot: &testRoot16}
+	c := createTestContext(ctrl, params)
+	c.mockTx.EXPECT().DequeueSequencedLeaves(int64(16), 10).Return([]trillian.LogLeaf{getLeaf42()}, nil)
+	c.sequencer.SetPreordered(true)
+
+	leafCount, err := c.sequencer.SequenceBatch(10, rootNeverExpiresFunc)
+	if leafCount != 0 || err == nil {
+		t.Fatalf("Sequenced %d leaves from the wrong index, err: %v", leafCount, err)
+	}
+}
+
+func TestSequenceBatchRecordsMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The leaf was queued two seconds before it's integrated, and outside the
+	// guard window
+	leaf := getLeaf42()
+	leaf.QueueTimestampNanos = fakeTimeForTest.Add(-2 * time.Second).UnixNano()
+	leaves := []trillian.LogLeaf{leaf}
+	updatedLeaf := testLeaf16
+	updatedLeaf.QueueTimestampNanos = leaf.QueueTimestampNanos
+	updatedLeaves := []trillian.LogLeaf{updatedLeaf}
+	params := testParameters{writeRevision: testRoot16.TreeRevision + 1, dequeueLimit: 1, guardWindow: time.Second, shouldCommit: true,
+		dequeuedLeaves: leaves, latestSignedRoot: &testRoot16,
+		updatedLeaves: &updatedLeaves, merkleNodesSet: &updatedNodes,
+		storeSignedRoot: &expectedSignedRoot, setupSigner: true,
+		dataToSign:    []byte{0x4f, 0x21, 0x7d, 0x10, 0xe2, 0x6, 0x9f, 0x10, 0x4d, 0x7e, 0x42, 0x75, 0x24, 0x3b, 0xb3, 0x5b, 0x63, 0xa6, 0x7, 0x8d, 0x6c, 0x97, 0x23, 0x4, 0x8, 0x5e, 0x3b, 0xe2, 0xc4, 0xb8, 0x7a, 0xa2},
+		signingResult: []byte("signed")}
+	c := createTestContext(ctrl, params)
+	m := NewSequencerMetrics(monitoring.InertMetricFactory{})
+	c.sequencer.SetMetrics(m)
+	c.sequencer.SetGuardWindow(time.Second)
+
+	if _, err := c.sequencer.SequenceBatch(1, rootNeverExpiresFunc); err != nil {
+		t.Fatalf("Expected sequencing to succeed, but got err: %v", err)
+	}
+	if got := m.batches.Value("ok"); got != 1 {
+		t.Errorf("Recorded %v successful batches, want 1", got)
+	}
+	if count, sum := m.batchSize.Info(); count != 1 || sum != 1 {
+		t.Errorf("Recorded %d batches of %v leaves, want 1 of 1", count, sum)
+	}
+	if count, _ := m.signLatency.Info("ok"); count != 1 {
+		t.Errorf("Recorded %d signings, want 1", count)
+	}
+	if count, sum := m.integrationLag.Info(); count != 1 || sum != 2000 {
+		t.Errorf("Recorded %d leaves integrated after %vms, want 1 after 2000ms", count, sum)
+	}
+}
+
+func TestSequenceBatchRecordsMergeDelays(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	leaf := getLeaf42()
+	leaf.QueueTimestampNanos = fakeTimeForTest.Add(-2 * time.Second).UnixNano()
+	leaves := []trillian.LogLeaf{leaf}
+	updatedLeaf := testLeaf16
+	updatedLeaf.QueueTimestampNanos = leaf.QueueTimestampNanos
+	updatedLeaves := []trillian.LogLeaf{updatedLeaf}
+	params := testParameters{writeRevision: testRoot16.TreeRevision + 1, dequeueLimit: 1, shouldCommit: true,
+		dequeuedLeaves: leaves, latestSignedRoot: &testRoot16,
+		updatedLeaves: &updatedLeaves, merkleNodesSet: &updatedNodes,
+		storeSignedRoot: &expectedSignedRoot, setupSigner: true,
+		dataToSign:    []byte{0x4f, 0x21, 0x7d, 0x10, 0xe2, 0x6, 0x9f, 0x10, 0x4d, 0x7e, 0x42, 0x75, 0x24, 0x3b, 0xb3, 0x5b, 0x63, 0xa6, 0x7, 0x8d, 0x6c, 0x97, 0x23, 0x4, 0x8, 0x5e, 0x3b, 0xe2, 0xc4, 0xb8, 0x7a, 0xa2},
+		signingResult: []byte("signed")}
+	c := createTestContext(ctrl, params)
+
+	// A leaf left behind in the queue has been waiting for 6s
+	snapshot := storage.NewMockReadOnlyLogTX(ctrl)
+	snapshot.EXPECT().OldestQueuedLeafTimestampNanos().Return(fakeTimeForTest.Add(-6*time.Second).UnixNano(), nil)
+	snapshot.EXPECT().Commit().Return(nil)
+	c.mockStorage.EXPECT().Snapshot().Return(snapshot, nil)
+
+	m := NewMergeDelayMonitor(monitoring.InertMetricFactory{}, 10*time.Second, 0.5, util.FakeTimeSource{FakeTime: fakeTimeForTest})
+	var alerts []int64
+	m.SetAlertFunc(func(treeID int64, age, mmd time.Duration) {
+		alerts = append(alerts, treeID)
+	})
+	c.sequencer.SetMergeDelayMonitor(m, 6962)
+
+	if _, err := c.sequencer.SequenceBatch(1, rootNeverExpiresFunc); err != nil {
+		t.Fatalf("Expected sequencing to succeed, but got err: %v", err)
+	}
+	if count, sum := m.mergeDelay.Info("6962"); count != 1 || sum != 2000 {
+		t.Errorf("Recorded %d leaves integrated after %vms, want 1 after 2000ms", count, sum)
+	}
+	if got := m.oldestQueuedAge.Value("6962"); got != 6000 {
+		t.Errorf("Recorded oldest queued leaf age %vms, want 6000ms", got)
+	}
+	if len(alerts) != 1 || alerts[0] != 6962 {
+		t.Errorf("Alerted for logs %v, want [6962]", alerts)
+	}
+}
+
+func TestSequenceBatchFailureRecordsOldestQueued(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := createTestContext(ctrl, testParameters{beginFails: true})
+	snapshot := storage.NewMockReadOnlyLogTX(ctrl)
+	snapshot.EXPECT().OldestQueuedLeafTimestampNanos().Return(fakeTimeForTest.Add(-6*time.Second).UnixNano(), nil)
+	snapshot.EXPECT().Commit().Return(nil)
+	c.mockStorage.EXPECT().Snapshot().Return(snapshot, nil)
+
+	m := NewMergeDelayMonitor(monitoring.InertMetricFactory{}, 10*time.Second, 0.5, util.FakeTimeSource{FakeTime: fakeTimeForTest})
+	c.sequencer.SetMergeDelayMonitor(m, 6962)
+
+	if _, err := c.sequencer.SequenceBatch(1, rootNeverExpiresFunc); err == nil {
+		t.Fatal("Expected sequencing to fail")
+	}
+	// A log that can't be sequenced still fails the health check
+	if err := m.Check(); err == nil {
+		t.Error("Check() succeeded with a leaf queued for 6s of a 10s maximum merge delay")
+	}
+}
+
 func TestSignBeginTxFails(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -538,3 +694,136 @@ func TestSignRootNoExistingRoot(t *testing.T) {
 		t.Fatalf("Expected signing to succeed, but got err: %v", err)
 	}
 }
+
+// fakeRootSigner signs every root with a fixed signature.
+type fakeRootSigner struct {
+	signed []trillian.SignedLogRoot
+}
+
+func (f *fakeRootSigner) SignLogRoot(root trillian.SignedLogRoot) (trillian.DigitallySigned, error) {
+	f.signed = append(f.signed, root)
+	return trillian.DigitallySigned{Signature: []byte("signed")}, nil
+}
+
+func TestSignRootWithRootSigner(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	params := testParameters{writeRevision: testRoot16.TreeRevision + 1,
+		shouldRollback:   true,
+		latestSignedRoot: &testRoot16,
+		storeSignedRoot:  &expectedSignedRoot16,
+		shouldCommit:     true}
+	c := createTestContext(ctrl, params)
+
+	// The key manager isn't used when there's a root signer
+	rootSigner := &fakeRootSigner{}
+	sequencer := NewSequencerWithRootSigner(c.sequencer.hasher, c.sequencer.timeSource, c.mockStorage, rootSigner)
+	if err := sequencer.SignRoot(); err != nil {
+		t.Fatalf("Expected signing to succeed, but got err: %v", err)
+	}
+	if len(rootSigner.signed) != 1 || rootSigner.signed[0].TreeSize != 16 {
+		t.Fatalf("Root signer signed %v, want one root of size 16", rootSigner.signed)
+	}
+}
+
+func TestSignRootRefreshesSignedRoot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	current := trillian.SignedLogRoot{TreeSize: 16, TreeRevision: 5, RootHash: []byte("root hash"), TimestampNanos: fakeTimeForTest.Add(-time.Hour).UnixNano()}
+	// The root is re-signed with a new timestamp, keeping its revision
+	want := current
+	want.TimestampNanos = fakeTimeForTest.UnixNano()
+	want.Signature = &trillian.DigitallySigned{Signature: []byte("signed")}
+	params := testParameters{writeRevision: current.TreeRevision + 1,
+		shouldRollback:   true,
+		latestSignedRoot: &current,
+		refreshedRoot:    &want,
+		shouldCommit:     true}
+	c := createTestContext(ctrl, params)
+
+	rootSigner := &fakeRootSigner{}
+	sequencer := NewSequencerWithRootSigner(c.sequencer.hasher, c.sequencer.timeSource, c.mockStorage, rootSigner)
+	if err := sequencer.SignRoot(); err != nil {
+		t.Fatalf("Expected signing to succeed, but got err: %v", err)
+	}
+	if len(rootSigner.signed) != 1 || rootSigner.signed[0].TreeRevision != 5 {
+		t.Fatalf("Root signer signed %v, want one root at revision 5", rootSigner.signed)
+	}
+}
+
+// fakeKeyRootSigner also signs every root with a pending key.
+type fakeKeyRootSigner struct {
+	fakeRootSigner
+}
+
+func (f *fakeKeyRootSigner) KeySignLogRoot(root trillian.SignedLogRoot) ([]*trillian.KeySignature, error) {
+	return []*trillian.KeySignature{{KeyId: "new key", Signature: &trillian.DigitallySigned{Signature: []byte("signed by new key")}}}, nil
+}
+
+func TestSignRootWithKeySignatures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	current := trillian.SignedLogRoot{TreeSize: 16, TreeRevision: 5, RootHash: []byte("root hash"), TimestampNanos: fakeTimeForTest.Add(-time.Hour).UnixNano(),
+		KeySignatures: []*trillian.KeySignature{{KeyId: "old key", Signature: &trillian.DigitallySigned{Signature: []byte("stale")}}}}
+	// The key signatures of the current root are replaced
+	want := current
+	want.TimestampNanos = fakeTimeForTest.UnixNano()
+	want.Signature = &trillian.DigitallySigned{Signature: []byte("signed")}
+	want.KeySignatures = []*trillian.KeySignature{{KeyId: "new key", Signature: &trillian.DigitallySigned{Signature: []byte("signed by new key")}}}
+	params := testParameters{writeRevision: current.TreeRevision + 1,
+		shouldRollback:   true,
+		latestSignedRoot: &current,
+		refreshedRoot:    &want,
+		shouldCommit:     true}
+	c := createTestContext(ctrl, params)
+
+	sequencer := NewSequencerWithRootSigner(c.sequencer.hasher, c.sequencer.timeSource, c.mockStorage, &fakeKeyRootSigner{})
+	if err := sequencer.SignRoot(); err != nil {
+		t.Fatalf("Expected signing to succeed, but got err: %v", err)
+	}
+}
+
+func TestInitLog(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	want := expectedSignedRoot0
+	want.TreeRevision = 0
+	params := testParameters{writeRevision: 1,
+		shouldRollback:   true,
+		latestSignedRoot: &trillian.SignedLogRoot{},
+		storeSignedRoot:  &want,
+		shouldCommit:     true}
+	c := createTestContext(ctrl, params)
+
+	rootSigner := &fakeRootSigner{}
+	sequencer := NewSequencerWithRootSigner(c.sequencer.hasher, c.sequencer.timeSource, c.mockStorage, rootSigner)
+	root, err := sequencer.InitLog()
+	if err != nil {
+		t.Fatalf("InitLog() = %v", err)
+	}
+	if !reflect.DeepEqual(root, want) {
+		t.Errorf("InitLog() = %v, want %v", root, want)
+	}
+	if len(rootSigner.signed) != 1 {
+		t.Errorf("Root signer signed %v, want one root", rootSigner.signed)
+	}
+}
+
+func TestInitLogAlreadyInitialized(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	params := testParameters{writeRevision: expectedSignedRoot.TreeRevision + 1,
+		shouldRollback:      true,
+		latestSignedRoot:    &expectedSignedRoot,
+		skipStoreSignedRoot: true}
+	c := createTestContext(ctrl, params)
+
+	if _, err := c.sequencer.InitLog(); err != storage.ErrTreeAlreadyInitialized {
+		t.Fatalf("InitLog() = %v, want %v", err, storage.ErrTreeAlreadyInitialized)
+	}
+}
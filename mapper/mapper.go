@@ -0,0 +1,228 @@
+// Package mapper keeps a map up to date with the entries of a source log. Each
+// leaf of the log is turned into map updates by a transform function, and the
+// position reached in the log is recorded in the MapperMetadata of the map root
+// written with those updates, so mapping resumes where it left off.
+package mapper
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+)
+
+// DefaultBatchSize is the number of log leaves mapped in each revision, unless
+// set otherwise.
+const DefaultBatchSize = 1000
+
+// TransformFunc returns the map updates caused by a leaf of the source log, which
+// may be none. Where several leaves mapped in one revision update the same key,
+// the value from the latest leaf is written.
+type TransformFunc func(leaf *trillian.LeafProto) ([]*trillian.KeyValue, error)
+
+// LeafDataByHash is a TransformFunc mapping the Merkle leaf hash of each leaf to
+// its data, so that log entries can be looked up by hash with a proof.
+func LeafDataByHash(leaf *trillian.LeafProto) ([]*trillian.KeyValue, error) {
+	return []*trillian.KeyValue{{Key: leaf.LeafHash, Value: &trillian.MapLeaf{LeafValue: leaf.LeafData}}}, nil
+}
+
+var (
+	// Must hold this lock before accessing the transforms map
+	transformsGuard sync.Mutex
+	// Map from name to the transforms that can be chosen by name
+	transforms = map[string]TransformFunc{
+		"leaf_data_by_hash": LeafDataByHash,
+	}
+)
+
+// RegisterTransform makes f available by name through GetTransform, replacing
+// any transform already registered with the name.
+func RegisterTransform(name string, f TransformFunc) {
+	transformsGuard.Lock()
+	defer transformsGuard.Unlock()
+
+	transforms[name] = f
+}
+
+// GetTransform returns the transform registered with name, or an error if there
+// isn't one.
+func GetTransform(name string) (TransformFunc, error) {
+	transformsGuard.Lock()
+	defer transformsGuard.Unlock()
+
+	f, ok := transforms[name]
+	if !ok {
+		return nil, fmt.Errorf("no map transform named %q", name)
+	}
+	return f, nil
+}
+
+// SourceLogID returns how the log with tree ID logID is recorded as the source
+// of a map in its MapperMetadata.
+func SourceLogID(logID int64) []byte {
+	return []byte(strconv.FormatInt(logID, 10))
+}
+
+// Mapper writes the updates caused by the leaves of a log to a map, in order of
+// their index. Leaves are only mapped once they are covered by a signed log
+// root. Each revision it writes is based on the one it read, so if anything else
+// writes to the map in between the write fails and is retried on the next pass.
+// The map server also refuses revisions whose leaves don't follow on from those
+// already mapped, so no leaf is skipped or mapped twice if mappers crash or race.
+type Mapper struct {
+	logClient trillian.TrillianLogClient
+	logID     int64
+	mapClient trillian.TrillianMapClient
+	mapID     int64
+	transform TransformFunc
+	batchSize int
+}
+
+// New creates a Mapper from the log logID, served by logClient, to the map mapID,
+// served by mapClient, which uses transform to turn leaves into updates.
+func New(logClient trillian.TrillianLogClient, logID int64, mapClient trillian.TrillianMapClient, mapID int64, transform TransformFunc) *Mapper {
+	return &Mapper{
+		logClient: logClient,
+		logID:     logID,
+		mapClient: mapClient,
+		mapID:     mapID,
+		transform: transform,
+		batchSize: DefaultBatchSize,
+	}
+}
+
+// SetBatchSize sets the maximum number of log leaves mapped in each revision.
+func (m *Mapper) SetBatchSize(n int) {
+	m.batchSize = n
+}
+
+// nextIndex returns the index of the first log leaf not mapped according to meta,
+// the metadata of the map's latest root.
+func (m *Mapper) nextIndex(meta *trillian.MapperMetadata) (int64, error) {
+	if meta == nil || len(meta.SourceLogId) == 0 {
+		return 0, nil
+	}
+	if !bytes.Equal(meta.SourceLogId, SourceLogID(m.logID)) {
+		return 0, fmt.Errorf("map %d is mapped from log %s, not log %d", m.mapID, meta.SourceLogId, m.logID)
+	}
+	return meta.HighestFullyCompletedSeq + 1, nil
+}
+
+// byLeafIndex allows sorting of leaves by their index in the log.
+type byLeafIndex []*trillian.LeafProto
+
+func (l byLeafIndex) Len() int           { return len(l) }
+func (l byLeafIndex) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l byLeafIndex) Less(i, j int) bool { return l[i].LeafIndex < l[j].LeafIndex }
+
+// MapBatch maps the next batch of log leaves that haven't been mapped, writing
+// them as a new revision of the map. It returns the number of leaves mapped,
+// which is zero if the map is up to date with the log's latest signed root.
+func (m *Mapper) MapBatch(ctx context.Context) (int, error) {
+	rootResp, err := m.mapClient.GetSignedMapRoot(ctx, &trillian.GetSignedMapRootRequest{MapId: m.mapID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get root of map %d: %v", m.mapID, err)
+	}
+	root := rootResp.MapRoot
+	start, err := m.nextIndex(root.Metadata)
+	if err != nil {
+		return 0, err
+	}
+
+	logRootResp, err := m.logClient.GetLatestSignedLogRoot(ctx, &trillian.GetLatestSignedLogRootRequest{LogId: m.logID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get root of log %d: %v", m.logID, err)
+	}
+	end := logRootResp.SignedLogRoot.TreeSize
+	if end-start > int64(m.batchSize) {
+		end = start + int64(m.batchSize)
+	}
+	if start >= end {
+		return 0, nil
+	}
+
+	leavesReq := &trillian.GetLeavesByIndexRequest{LogId: m.logID, LeafIndex: make([]int64, 0, end-start)}
+	for i := start; i < end; i++ {
+		leavesReq.LeafIndex = append(leavesReq.LeafIndex, i)
+	}
+	leavesResp, err := m.logClient.GetLeavesByIndex(ctx, leavesReq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get leaves [%d, %d) of log %d: %v", start, end, m.logID, err)
+	}
+	leaves := leavesResp.Leaves
+	if got, want := int64(len(leaves)), end-start; got != want {
+		return 0, fmt.Errorf("got %d leaves [%d, %d) of log %d, want %d", got, start, end, m.logID, want)
+	}
+	sort.Sort(byLeafIndex(leaves))
+
+	// Later updates of a key replace earlier ones, but keys are written in the
+	// order they were first updated
+	var keys []string
+	updates := make(map[string]*trillian.KeyValue)
+	for i, leaf := range leaves {
+		if leaf.LeafIndex != start+int64(i) {
+			return 0, fmt.Errorf("got leaf %d of log %d, want leaf %d", leaf.LeafIndex, m.logID, start+int64(i))
+		}
+		kvs, err := m.transform(leaf)
+		if err != nil {
+			return 0, fmt.Errorf("failed to transform leaf %d of log %d: %v", leaf.LeafIndex, m.logID, err)
+		}
+		for _, kv := range kvs {
+			if _, ok := updates[string(kv.Key)]; !ok {
+				keys = append(keys, string(kv.Key))
+			}
+			updates[string(kv.Key)] = kv
+		}
+	}
+
+	setReq := &trillian.SetMapLeavesRequest{
+		MapId:    m.mapID,
+		KeyValue: make([]*trillian.KeyValue, 0, len(keys)),
+		MapperData: &trillian.MapperMetadata{
+			SourceLogId:              SourceLogID(m.logID),
+			RevisionStartSeq:         start,
+			HighestFullyCompletedSeq: end - 1,
+		},
+		// The position in the log is only recorded if the map hasn't changed
+		// since it was read
+		Revision: root.MapRevision + 1,
+	}
+	for _, k := range keys {
+		setReq.KeyValue = append(setReq.KeyValue, updates[k])
+	}
+	if _, err := m.mapClient.SetLeaves(ctx, setReq); err != nil {
+		return 0, fmt.Errorf("failed to write leaves [%d, %d) of log %d to map %d: %v", start, end, m.logID, m.mapID, err)
+	}
+	glog.Infof("Mapped leaves [%d, %d) of log %d to %d keys at revision %d of map %d", start, end, m.logID, len(keys), setReq.Revision, m.mapID)
+	return len(leaves), nil
+}
+
+// Run maps batches of log leaves until done is closed. It waits for interval
+// whenever the map is up to date with the log, or a batch fails.
+func (m *Mapper) Run(done chan struct{}, interval time.Duration) {
+	for {
+		n, err := m.MapBatch(context.Background())
+		if err != nil {
+			glog.Warningf("Mapping log %d to map %d failed: %v", m.logID, m.mapID, err)
+		}
+		if n > 0 {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			continue
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
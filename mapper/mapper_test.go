@@ -0,0 +1,156 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+)
+
+const (
+	testLogID = int64(3)
+	testMapID = int64(7)
+)
+
+// indexTransform maps every leaf to the "latest" key, and to a key named after
+// its data.
+func indexTransform(leaf *trillian.LeafProto) ([]*trillian.KeyValue, error) {
+	value := &trillian.MapLeaf{LeafValue: []byte(fmt.Sprintf("%d", leaf.LeafIndex))}
+	return []*trillian.KeyValue{{Key: []byte("latest"), Value: value}, {Key: leaf.LeafData, Value: value}}, nil
+}
+
+func testLeaves(indices ...int64) []*trillian.LeafProto {
+	var leaves []*trillian.LeafProto
+	for _, i := range indices {
+		leaves = append(leaves, &trillian.LeafProto{LeafIndex: i, LeafData: []byte(fmt.Sprintf("leaf %d", i))})
+	}
+	return leaves
+}
+
+func expectRoots(logClient *trillian.MockTrillianLogClient, mapClient *trillian.MockTrillianMapClient, mapRevision int64, meta *trillian.MapperMetadata, treeSize int64) {
+	mapClient.EXPECT().GetSignedMapRoot(gomock.Any(), &trillian.GetSignedMapRootRequest{MapId: testMapID}).Return(
+		&trillian.GetSignedMapRootResponse{MapRoot: &trillian.SignedMapRoot{MapRevision: mapRevision, Metadata: meta}}, nil)
+	logClient.EXPECT().GetLatestSignedLogRoot(gomock.Any(), &trillian.GetLatestSignedLogRootRequest{LogId: testLogID}).Return(
+		&trillian.GetLatestSignedLogRootResponse{SignedLogRoot: &trillian.SignedLogRoot{TreeSize: treeSize}}, nil)
+}
+
+func TestMapBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	logClient := trillian.NewMockTrillianLogClient(ctrl)
+	mapClient := trillian.NewMockTrillianMapClient(ctrl)
+	m := New(logClient, testLogID, mapClient, testMapID, indexTransform)
+	m.SetBatchSize(2)
+
+	// The map has no metadata yet, so the first batch of the log is mapped
+	expectRoots(logClient, mapClient, 0, nil, 3)
+	logClient.EXPECT().GetLeavesByIndex(gomock.Any(), &trillian.GetLeavesByIndexRequest{LogId: testLogID, LeafIndex: []int64{0, 1}}).Return(
+		&trillian.GetLeavesByIndexResponse{Leaves: testLeaves(1, 0)}, nil)
+	mapClient.EXPECT().SetLeaves(gomock.Any(), &trillian.SetMapLeavesRequest{
+		MapId: testMapID,
+		KeyValue: []*trillian.KeyValue{
+			{Key: []byte("latest"), Value: &trillian.MapLeaf{LeafValue: []byte("1")}},
+			{Key: []byte("leaf 0"), Value: &trillian.MapLeaf{LeafValue: []byte("0")}},
+			{Key: []byte("leaf 1"), Value: &trillian.MapLeaf{LeafValue: []byte("1")}},
+		},
+		MapperData: &trillian.MapperMetadata{SourceLogId: []byte("3"), HighestFullyCompletedSeq: 1},
+		Revision:   1,
+	}).Return(&trillian.SetMapLeavesResponse{}, nil)
+
+	if n, err := m.MapBatch(context.Background()); n != 2 || err != nil {
+		t.Fatalf("MapBatch() = %d, %v, want 2, nil", n, err)
+	}
+
+	// The rest of the log is mapped next
+	expectRoots(logClient, mapClient, 1, &trillian.MapperMetadata{SourceLogId: []byte("3"), HighestFullyCompletedSeq: 1}, 3)
+	logClient.EXPECT().GetLeavesByIndex(gomock.Any(), &trillian.GetLeavesByIndexRequest{LogId: testLogID, LeafIndex: []int64{2}}).Return(
+		&trillian.GetLeavesByIndexResponse{Leaves: testLeaves(2)}, nil)
+	mapClient.EXPECT().SetLeaves(gomock.Any(), &trillian.SetMapLeavesRequest{
+		MapId: testMapID,
+		KeyValue: []*trillian.KeyValue{
+			{Key: []byte("latest"), Value: &trillian.MapLeaf{LeafValue: []byte("2")}},
+			{Key: []byte("leaf 2"), Value: &trillian.MapLeaf{LeafValue: []byte("2")}},
+		},
+		MapperData: &trillian.MapperMetadata{SourceLogId: []byte("3"), RevisionStartSeq: 2, HighestFullyCompletedSeq: 2},
+		Revision:   2,
+	}).Return(&trillian.SetMapLeavesResponse{}, nil)
+
+	if n, err := m.MapBatch(context.Background()); n != 1 || err != nil {
+		t.Fatalf("MapBatch() = %d, %v, want 1, nil", n, err)
+	}
+
+	// Once the map is up to date nothing more is read or written
+	expectRoots(logClient, mapClient, 2, &trillian.MapperMetadata{SourceLogId: []byte("3"), HighestFullyCompletedSeq: 2}, 3)
+
+	if n, err := m.MapBatch(context.Background()); n != 0 || err != nil {
+		t.Fatalf("MapBatch() = %d, %v, want 0, nil", n, err)
+	}
+}
+
+func TestMapBatchErrors(t *testing.T) {
+	for _, test := range []struct {
+		desc      string
+		meta      *trillian.MapperMetadata
+		leaves    []*trillian.LeafProto
+		transform TransformFunc
+	}{
+		{
+			desc: "other source log",
+			meta: &trillian.MapperMetadata{SourceLogId: []byte("4")},
+		},
+		{
+			desc:      "missing leaf",
+			leaves:    testLeaves(0),
+			transform: indexTransform,
+		},
+		{
+			desc:      "wrong leaf",
+			leaves:    testLeaves(0, 2),
+			transform: indexTransform,
+		},
+		{
+			desc:   "transform fails",
+			leaves: testLeaves(0, 1),
+			transform: func(*trillian.LeafProto) ([]*trillian.KeyValue, error) {
+				return nil, errors.New("bad leaf")
+			},
+		},
+	} {
+		ctrl := gomock.NewController(t)
+
+		logClient := trillian.NewMockTrillianLogClient(ctrl)
+		mapClient := trillian.NewMockTrillianMapClient(ctrl)
+		m := New(logClient, testLogID, mapClient, testMapID, test.transform)
+
+		mapClient.EXPECT().GetSignedMapRoot(gomock.Any(), gomock.Any()).Return(
+			&trillian.GetSignedMapRootResponse{MapRoot: &trillian.SignedMapRoot{Metadata: test.meta}}, nil)
+		if test.leaves != nil {
+			logClient.EXPECT().GetLatestSignedLogRoot(gomock.Any(), gomock.Any()).Return(
+				&trillian.GetLatestSignedLogRootResponse{SignedLogRoot: &trillian.SignedLogRoot{TreeSize: 2}}, nil)
+			logClient.EXPECT().GetLeavesByIndex(gomock.Any(), gomock.Any()).Return(
+				&trillian.GetLeavesByIndexResponse{Leaves: test.leaves}, nil)
+		}
+
+		if n, err := m.MapBatch(context.Background()); err == nil {
+			t.Errorf("%s: MapBatch() = %d, nil, want an error", test.desc, n)
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestGetTransform(t *testing.T) {
+	RegisterTransform("index", indexTransform)
+
+	for _, name := range []string{"leaf_data_by_hash", "index"} {
+		if _, err := GetTransform(name); err != nil {
+			t.Errorf("GetTransform(%q) failed: %v", name, err)
+		}
+	}
+	if _, err := GetTransform("missing"); err == nil {
+		t.Error("GetTransform of an unregistered transform succeeded")
+	}
+}
@@ -0,0 +1,60 @@
+package merkle
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/trillian"
+)
+
+// EmptyHashes is a table of the hashes of empty subtrees, indexed by height. The
+// entry at height 0 is the hash of an absent leaf, given by
+// TreeHasher.HashEmptyLeaf, and the entry at height h is the hash of a node
+// whose children are both empty subtrees of height h-1. The table covers every
+// height up to and including the root of a tree as deep as the hash size in
+// bits.
+//
+// Tables are shared by everything using equivalent TreeHashers and must not be
+// modified.
+type EmptyHashes []trillian.Hash
+
+// emptyHashTables holds the shared tables, keyed by hashing scheme and hash function.
+var emptyHashTables = struct {
+	sync.Mutex
+	tables map[string]EmptyHashes
+}{tables: make(map[string]EmptyHashes)}
+
+func init() {
+	// Nearly everything uses this so build it before any requests are served.
+	EmptyHashesFor(NewRFC6962TreeHasher(trillian.NewSHA256()))
+}
+
+// EmptyHashesFor returns the table of empty subtree hashes for th. The table is
+// calculated the first time it's needed and shared from then on.
+func EmptyHashesFor(th TreeHasher) EmptyHashes {
+	if len(th.scheme) == 0 {
+		// We can't tell which other hashers this one is equivalent to
+		return createEmptyHashes(th)
+	}
+	key := fmt.Sprintf("%s/%d", th.scheme, th.Hash)
+
+	emptyHashTables.Lock()
+	defer emptyHashTables.Unlock()
+
+	table, ok := emptyHashTables.tables[key]
+	if !ok {
+		table = createEmptyHashes(th)
+		emptyHashTables.tables[key] = table
+	}
+	return table
+}
+
+func createEmptyHashes(th TreeHasher) EmptyHashes {
+	numEntries := th.Size()*8 + 1
+	r := make(EmptyHashes, numEntries, numEntries)
+	r[0] = th.HashEmptyLeaf()
+	for i := 1; i < numEntries; i++ {
+		r[i] = th.HashChildren(r[i-1], r[i-1])
+	}
+	return r
+}
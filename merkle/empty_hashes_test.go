@@ -0,0 +1,56 @@
+package merkle
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/trillian"
+)
+
+func TestEmptyHashesRoot(t *testing.T) {
+	th := NewRFC6962TreeHasher(trillian.NewSHA256())
+	empty := EmptyHashesFor(th)
+
+	if got, want := len(empty), th.Size()*8+1; got != want {
+		t.Fatalf("Got table of %d entries, want %d", got, want)
+	}
+	if got, want := empty[0], th.HashLeaf([]byte{}); !bytes.Equal(got, want) {
+		t.Fatalf("Got empty leaf hash %x, want %x", got, want)
+	}
+	if got, want := empty[len(empty)-1], emptyMapRoot(); !bytes.Equal(got, want) {
+		t.Fatalf("Got empty root %x, want %x", got, want)
+	}
+	for h := 1; h < len(empty); h++ {
+		if got, want := empty[h], th.HashChildren(empty[h-1], empty[h-1]); !bytes.Equal(got, want) {
+			t.Fatalf("Wrong empty hash at height %d: got %x, want %x", h, got, want)
+		}
+	}
+}
+
+func TestEmptyHashesShared(t *testing.T) {
+	a := EmptyHashesFor(NewRFC6962TreeHasher(trillian.NewSHA256()))
+	b := NewMapHasher(NewRFC6962TreeHasher(trillian.NewSHA256())).EmptyHashes()
+
+	if &a[0] != &b[0] {
+		t.Fatalf("Expected equivalent hashers to share one table of empty hashes")
+	}
+
+	// A hasher we can't identify gets its own table
+	th := NewRFC6962TreeHasher(trillian.NewSHA256())
+	th.scheme = ""
+	if c := EmptyHashesFor(th); &a[0] == &c[0] {
+		t.Fatalf("Expected unidentified hasher not to use the shared table")
+	}
+}
+
+func TestMapHasherNullHashesMatchEmptyHashes(t *testing.T) {
+	mh := NewMapHasher(NewRFC6962TreeHasher(trillian.NewSHA256()))
+	empty := mh.EmptyHashes()
+
+	n := len(mh.nullHashes)
+	for i, h := range mh.nullHashes {
+		if got, want := h, empty[n-1-i]; !bytes.Equal(got, want) {
+			t.Fatalf("Null hash %d is %x, want %x", i, got, want)
+		}
+	}
+}
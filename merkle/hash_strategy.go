@@ -0,0 +1,94 @@
+package merkle
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+)
+
+// TreeHasherFactory creates the TreeHasher for a tree from the hash algorithm
+// and domain separation prefixes configured for it.
+type TreeHasherFactory func(alg trillian.HashAlgorithm, prefixes storage.TreeHashPrefixes) (TreeHasher, error)
+
+// hashStrategies holds the factories for each HashStrategy, keyed by strategy.
+var hashStrategies = struct {
+	sync.RWMutex
+	factories map[trillian.HashStrategy]TreeHasherFactory
+}{factories: map[trillian.HashStrategy]TreeHasherFactory{
+	trillian.HashStrategy_RFC6962:        newRFC6962StrategyHasher,
+	trillian.HashStrategy_SHA512_256:     newSHA512t256StrategyHasher,
+	trillian.HashStrategy_LIE_SHA512_256: newLIEStrategyHasher,
+}}
+
+// RegisterHashStrategy makes f the factory for trees which use strategy. It's
+// intended to be called from init functions, and panics if the strategy
+// already has a factory.
+func RegisterHashStrategy(strategy trillian.HashStrategy, f TreeHasherFactory) {
+	hashStrategies.Lock()
+	defer hashStrategies.Unlock()
+
+	if _, ok := hashStrategies.factories[strategy]; ok {
+		panic(fmt.Sprintf("hash strategy %v is already registered", strategy))
+	}
+	hashStrategies.factories[strategy] = f
+}
+
+// NewTreeHasherForStrategy creates the TreeHasher for a tree which uses
+// strategy, with the hash algorithm and domain separation prefixes configured
+// for the tree.
+func NewTreeHasherForStrategy(strategy trillian.HashStrategy, alg trillian.HashAlgorithm, prefixes storage.TreeHashPrefixes) (TreeHasher, error) {
+	hashStrategies.RLock()
+	f, ok := hashStrategies.factories[strategy]
+	hashStrategies.RUnlock()
+
+	if !ok {
+		return TreeHasher{}, fmt.Errorf("unsupported hash strategy %v", strategy)
+	}
+	return f(alg, prefixes)
+}
+
+func newRFC6962StrategyHasher(alg trillian.HashAlgorithm, prefixes storage.TreeHashPrefixes) (TreeHasher, error) {
+	hasher, err := trillian.NewHasher(alg)
+	if err != nil {
+		return TreeHasher{}, err
+	}
+	return NewTreeHasherForPrefixes(hasher, prefixes)
+}
+
+func newSHA512t256StrategyHasher(alg trillian.HashAlgorithm, prefixes storage.TreeHashPrefixes) (TreeHasher, error) {
+	if alg != trillian.HashAlgorithm_SHA256 {
+		return TreeHasher{}, fmt.Errorf("hash strategy %v needs hash algorithm %v, got %v", trillian.HashStrategy_SHA512_256, trillian.HashAlgorithm_SHA256, alg)
+	}
+	return NewTreeHasherForPrefixes(trillian.NewSHA512t256(), prefixes)
+}
+
+// Domain separation prefixes of the LIE_SHA512_256 strategy
+const (
+	lieLeafHashPrefix  = 'L'
+	lieNodeHashPrefix  = 'I'
+	lieEmptyHashPrefix = 'E'
+)
+
+func newLIEStrategyHasher(alg trillian.HashAlgorithm, prefixes storage.TreeHashPrefixes) (TreeHasher, error) {
+	if alg != trillian.HashAlgorithm_SHA256 {
+		return TreeHasher{}, fmt.Errorf("hash strategy %v needs hash algorithm %v, got %v", trillian.HashStrategy_LIE_SHA512_256, trillian.HashAlgorithm_SHA256, alg)
+	}
+	if !prefixes.IsDefault() {
+		return TreeHasher{}, fmt.Errorf("hash strategy %v can't be used with hash prefixes", trillian.HashStrategy_LIE_SHA512_256)
+	}
+
+	hasher := trillian.NewSHA512t256()
+	th, err := NewTreeHasher(hasher, []byte{lieLeafHashPrefix}, []byte{lieNodeHashPrefix})
+	if err != nil {
+		return TreeHasher{}, err
+	}
+	th.scheme = "lie"
+	th.emptyHasher = func() trillian.Hash {
+		return hasher.Digest([]byte{lieEmptyHashPrefix})
+	}
+	// Empty branches of maps are built up from the empty hash too
+	th.emptyLeafHasher = th.emptyHasher
+	return th, nil
+}
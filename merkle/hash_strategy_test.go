@@ -0,0 +1,148 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto"
+	"testing"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/testonly"
+)
+
+func TestNewTreeHasherForStrategy(t *testing.T) {
+	sha512t256 := trillian.NewSHA512t256()
+	customPrefixes := storage.TreeHashPrefixes{Leaf: []byte("leaf:"), Node: []byte("node:")}
+
+	for _, test := range []struct {
+		desc     string
+		strategy trillian.HashStrategy
+		alg      trillian.HashAlgorithm
+		prefixes storage.TreeHashPrefixes
+		wantErr  bool
+		// Expected hashes of the empty tree, the leaf "L123456" and the node
+		// with children "N123" and "N456"
+		empty, leaf, node []byte
+	}{
+		{
+			desc:     "rfc6962",
+			strategy: trillian.HashStrategy_RFC6962,
+			alg:      trillian.HashAlgorithm_SHA256,
+			empty:    testonly.MustHexDecode(rfc6962EmptyHashHex),
+			leaf:     testonly.MustHexDecode(rfc6962LeafL123456HashHex),
+			node:     testonly.MustHexDecode(rfc6962NodeN123N456HashHex),
+		},
+		{
+			desc:     "rfc6962 custom prefixes",
+			strategy: trillian.HashStrategy_RFC6962,
+			alg:      trillian.HashAlgorithm_SHA256,
+			prefixes: customPrefixes,
+			empty:    testonly.MustHexDecode(rfc6962EmptyHashHex),
+			leaf:     trillian.NewSHA256().Digest([]byte("leaf:L123456")),
+			node:     trillian.NewSHA256().Digest([]byte("node:N123N456")),
+		},
+		{
+			desc:     "sha512/256",
+			strategy: trillian.HashStrategy_SHA512_256,
+			alg:      trillian.HashAlgorithm_SHA256,
+			empty:    sha512t256.Digest([]byte{}),
+			leaf:     sha512t256.Digest([]byte("\x00L123456")),
+			node:     sha512t256.Digest([]byte("\x01N123N456")),
+		},
+		{
+			desc:     "sha512/256 custom prefixes",
+			strategy: trillian.HashStrategy_SHA512_256,
+			alg:      trillian.HashAlgorithm_SHA256,
+			prefixes: customPrefixes,
+			empty:    sha512t256.Digest([]byte{}),
+			leaf:     sha512t256.Digest([]byte("leaf:L123456")),
+			node:     sha512t256.Digest([]byte("node:N123N456")),
+		},
+		{
+			desc:     "sha512/256 wrong size",
+			strategy: trillian.HashStrategy_SHA512_256,
+			alg:      trillian.HashAlgorithm_SHA512,
+			wantErr:  true,
+		},
+		{
+			desc:     "lie",
+			strategy: trillian.HashStrategy_LIE_SHA512_256,
+			alg:      trillian.HashAlgorithm_SHA256,
+			empty:    sha512t256.Digest([]byte("E")),
+			leaf:     sha512t256.Digest([]byte("LL123456")),
+			node:     sha512t256.Digest([]byte("IN123N456")),
+		},
+		{
+			desc:     "lie custom prefixes",
+			strategy: trillian.HashStrategy_LIE_SHA512_256,
+			alg:      trillian.HashAlgorithm_SHA256,
+			prefixes: customPrefixes,
+			wantErr:  true,
+		},
+		{
+			desc:     "unknown strategy",
+			strategy: trillian.HashStrategy(-1),
+			alg:      trillian.HashAlgorithm_SHA256,
+			wantErr:  true,
+		},
+	} {
+		th, err := NewTreeHasherForStrategy(test.strategy, test.alg, test.prefixes)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%s: NewTreeHasherForStrategy()=_, %v, want error: %v", test.desc, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got, want := th.Size(), 32; got != want {
+			t.Errorf("%s: Size()=%d, want %d", test.desc, got, want)
+		}
+		if got := th.HashEmpty(); !bytes.Equal(got, test.empty) {
+			t.Errorf("%s: HashEmpty()=%x, want %x", test.desc, got, test.empty)
+		}
+		if got := th.HashLeaf([]byte("L123456")); !bytes.Equal(got, test.leaf) {
+			t.Errorf("%s: HashLeaf()=%x, want %x", test.desc, got, test.leaf)
+		}
+		if got := th.HashChildren([]byte("N123"), []byte("N456")); !bytes.Equal(got, test.node) {
+			t.Errorf("%s: HashChildren()=%x, want %x", test.desc, got, test.node)
+		}
+		wantEmptyLeaf := th.HashLeaf([]byte{})
+		if test.strategy == trillian.HashStrategy_LIE_SHA512_256 {
+			// Absent map leaves have the empty hash
+			wantEmptyLeaf = test.empty
+		}
+		if got := th.HashEmptyLeaf(); !bytes.Equal(got, wantEmptyLeaf) {
+			t.Errorf("%s: HashEmptyLeaf()=%x, want %x", test.desc, got, wantEmptyLeaf)
+		}
+		if got := EmptyHashesFor(th)[0]; !bytes.Equal(got, wantEmptyLeaf) {
+			t.Errorf("%s: EmptyHashesFor()[0]=%x, want %x", test.desc, got, wantEmptyLeaf)
+		}
+	}
+}
+
+func TestRegisterHashStrategy(t *testing.T) {
+	const strategy = trillian.HashStrategy(1000)
+	RegisterHashStrategy(strategy, func(alg trillian.HashAlgorithm, prefixes storage.TreeHashPrefixes) (TreeHasher, error) {
+		return NewTreeHasher(trillian.Hasher{Hash: crypto.SHA256}, []byte("test leaf"), []byte("test node"))
+	})
+	defer func() {
+		hashStrategies.Lock()
+		delete(hashStrategies.factories, strategy)
+		hashStrategies.Unlock()
+	}()
+
+	th, err := NewTreeHasherForStrategy(strategy, trillian.HashAlgorithm_SHA256, storage.TreeHashPrefixes{})
+	if err != nil {
+		t.Fatalf("NewTreeHasherForStrategy()=_, %v, want no error", err)
+	}
+	if got, want := th.HashLeaf([]byte("L123456")), trillian.NewSHA256().Digest([]byte("test leafL123456")); !bytes.Equal(got, want) {
+		t.Errorf("HashLeaf()=%x, want %x", got, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("RegisterHashStrategy() didn't panic for an existing strategy")
+		}
+	}()
+	RegisterHashStrategy(trillian.HashStrategy_RFC6962, nil)
+}
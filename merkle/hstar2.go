@@ -26,7 +26,7 @@ type HStar2LeafHash struct {
 // merkle tree.
 type HStar2 struct {
 	hasher          TreeHasher
-	hStarEmptyCache []trillian.Hash
+	hStarEmptyCache EmptyHashes
 }
 
 // NewHStar2 creates a new HStar2 tree calculator based on the passed in
@@ -34,7 +34,7 @@ type HStar2 struct {
 func NewHStar2(treeHasher TreeHasher) HStar2 {
 	return HStar2{
 		hasher:          treeHasher,
-		hStarEmptyCache: []trillian.Hash{treeHasher.HashLeaf([]byte(""))},
+		hStarEmptyCache: EmptyHashesFor(treeHasher),
 	}
 }
 
@@ -92,22 +92,11 @@ func (s *HStar2) HStar2Nodes(treeDepth, treeLevelOffset int, values []HStar2Leaf
 		})
 }
 
-// hStarEmpty calculates (and caches) the "null-hash" for the requested tree
-// level.
+// hStarEmpty returns the "null-hash" for the requested tree level from the
+// shared table of empty hashes.
 func (s *HStar2) hStarEmpty(n int) (trillian.Hash, error) {
-	if len(s.hStarEmptyCache) <= n {
-		emptyRoot, err := s.hStarEmpty(n - 1)
-		if err != nil {
-			return nil, err
-		}
-		h := s.hasher.HashChildren(emptyRoot, emptyRoot)
-		if len(s.hStarEmptyCache) != n {
-			return nil, fmt.Errorf("cache wrong size - expected %d, but cache contains %d entries", n, len(s.hStarEmptyCache))
-		}
-		s.hStarEmptyCache = append(s.hStarEmptyCache, h)
-	}
-	if n >= len(s.hStarEmptyCache) {
-		return nil, fmt.Errorf("cache too small - want level %d, but cache only contains %d entries", n, len(s.hStarEmptyCache))
+	if n < 0 || n >= len(s.hStarEmptyCache) {
+		return nil, fmt.Errorf("no empty hash for level %d, table only contains %d entries", n, len(s.hStarEmptyCache))
 	}
 	return s.hStarEmptyCache[n], nil
 }
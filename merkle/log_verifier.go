@@ -0,0 +1,123 @@
+package merkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/google/trillian"
+)
+
+// LogVerifier checks the inclusion and consistency proofs served by a log,
+// without needing any of the log's data.
+type LogVerifier struct {
+	hasher TreeHasher
+}
+
+// NewLogVerifier creates a LogVerifier for logs whose nodes are hashed with th.
+func NewLogVerifier(th TreeHasher) LogVerifier {
+	return LogVerifier{hasher: th}
+}
+
+// VerifyInclusionProof checks that proof shows the leaf with leafHash is at
+// leafIndex in the log of treeSize leaves with the given root. The proof is
+// ordered from the leaf upwards, as in RFC 6962.
+func (v LogVerifier) VerifyInclusionProof(leafIndex, treeSize int64, proof []trillian.Hash, root, leafHash trillian.Hash) error {
+	if leafIndex < 0 || leafIndex >= treeSize {
+		return fmt.Errorf("leaf index %d is outside a tree of size %d", leafIndex, treeSize)
+	}
+
+	fn, sn := leafIndex, treeSize-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return errors.New("inclusion proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = v.hasher.HashChildren(p, r)
+			// Skip the levels where the node has no sibling on the right
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = v.hasher.HashChildren(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return errors.New("inclusion proof is too short")
+	}
+
+	if !bytes.Equal(r, root) {
+		return RootHashMismatchError{ExpectedHash: root, ActualHash: r}
+	}
+	return nil
+}
+
+// VerifyConsistencyProof checks that proof shows the log of size1 leaves with
+// root1 is a prefix of the log of size2 leaves with root2, as in RFC 6962.
+func (v LogVerifier) VerifyConsistencyProof(size1, size2 int64, root1, root2 trillian.Hash, proof []trillian.Hash) error {
+	switch {
+	case size1 < 0 || size1 > size2:
+		return fmt.Errorf("tree size %d can't be consistent with size %d", size1, size2)
+	case size1 == size2:
+		if len(proof) > 0 {
+			return errors.New("consistency proof between trees of the same size should be empty")
+		}
+		if !bytes.Equal(root1, root2) {
+			return RootHashMismatchError{ExpectedHash: root2, ActualHash: root1}
+		}
+		return nil
+	case size1 == 0:
+		// Every tree is consistent with the empty tree
+		if len(proof) > 0 {
+			return errors.New("consistency proof from an empty tree should be empty")
+		}
+		return nil
+	case len(proof) == 0:
+		return errors.New("consistency proof is empty")
+	}
+
+	// The proof leaves out the old root where it's a complete subtree of the new tree
+	if size1&(size1-1) == 0 {
+		proof = append([]trillian.Hash{root1}, proof...)
+	}
+
+	fn, sn := size1-1, size2-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return errors.New("consistency proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = v.hasher.HashChildren(c, fr)
+			sr = v.hasher.HashChildren(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = v.hasher.HashChildren(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return errors.New("consistency proof is too short")
+	}
+
+	if !bytes.Equal(fr, root1) {
+		return RootHashMismatchError{ExpectedHash: root1, ActualHash: fr}
+	}
+	if !bytes.Equal(sr, root2) {
+		return RootHashMismatchError{ExpectedHash: root2, ActualHash: sr}
+	}
+	return nil
+}
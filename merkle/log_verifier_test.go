@@ -0,0 +1,100 @@
+package merkle
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/trillian"
+)
+
+// buildProofTree returns an in memory tree holding n leaves.
+func buildProofTree(n int) *InMemoryMerkleTree {
+	tree := NewInMemoryMerkleTree(NewRFC6962TreeHasher(trillian.NewSHA256()))
+	for i := 0; i < n; i++ {
+		tree.AddLeaf([]byte(fmt.Sprintf("leaf %d", i)))
+	}
+	return tree
+}
+
+func hashesOf(entries []TreeEntryDescriptor) []trillian.Hash {
+	hashes := make([]trillian.Hash, 0, len(entries))
+	for _, e := range entries {
+		hashes = append(hashes, e.Value.Hash())
+	}
+	return hashes
+}
+
+func TestVerifyInclusionProof(t *testing.T) {
+	const leaves = 20
+	th := NewRFC6962TreeHasher(trillian.NewSHA256())
+	v := NewLogVerifier(th)
+	tree := buildProofTree(leaves)
+
+	for size := int64(1); size <= leaves; size++ {
+		root := tree.RootAtSnapshot(int(size)).Hash()
+		for index := int64(0); index < size; index++ {
+			leafHash := th.HashLeaf([]byte(fmt.Sprintf("leaf %d", index)))
+			proof := hashesOf(tree.PathToRootAtSnapshot(int(index+1), int(size)))
+			if err := v.VerifyInclusionProof(index, size, proof, root, leafHash); err != nil {
+				t.Fatalf("VerifyInclusionProof(%d, %d) failed: %v", index, size, err)
+			}
+
+			if err := v.VerifyInclusionProof(index, size, proof, root, th.HashLeaf([]byte("other"))); err == nil {
+				t.Errorf("VerifyInclusionProof(%d, %d) accepted the wrong leaf", index, size)
+			}
+			if size > 1 {
+				if err := v.VerifyInclusionProof((index+1)%size, size, proof, root, leafHash); err == nil {
+					t.Errorf("VerifyInclusionProof(%d, %d) accepted the wrong index", index, size)
+				}
+				if err := v.VerifyInclusionProof(index, size, proof[:len(proof)-1], root, leafHash); err == nil {
+					t.Errorf("VerifyInclusionProof(%d, %d) accepted a truncated proof", index, size)
+				}
+			}
+			if err := v.VerifyInclusionProof(index, size, append(proof, leafHash), root, leafHash); err == nil {
+				t.Errorf("VerifyInclusionProof(%d, %d) accepted an extended proof", index, size)
+			}
+		}
+	}
+
+	if err := v.VerifyInclusionProof(5, 5, nil, tree.CurrentRoot().Hash(), nil); err == nil {
+		t.Errorf("VerifyInclusionProof accepted an index outside the tree")
+	}
+}
+
+func TestVerifyConsistencyProof(t *testing.T) {
+	const leaves = 20
+	v := NewLogVerifier(NewRFC6962TreeHasher(trillian.NewSHA256()))
+	tree := buildProofTree(leaves)
+
+	for size2 := int64(1); size2 <= leaves; size2++ {
+		root2 := tree.RootAtSnapshot(int(size2)).Hash()
+		for size1 := int64(1); size1 < size2; size1++ {
+			root1 := tree.RootAtSnapshot(int(size1)).Hash()
+			proof := hashesOf(tree.SnapshotConsistency(int(size1), int(size2)))
+			if err := v.VerifyConsistencyProof(size1, size2, root1, root2, proof); err != nil {
+				t.Fatalf("VerifyConsistencyProof(%d, %d) failed: %v", size1, size2, err)
+			}
+
+			if err := v.VerifyConsistencyProof(size1, size2, root2, root2, proof); err == nil {
+				t.Errorf("VerifyConsistencyProof(%d, %d) accepted the wrong old root", size1, size2)
+			}
+			if err := v.VerifyConsistencyProof(size1, size2, root1, root1, proof); err == nil {
+				t.Errorf("VerifyConsistencyProof(%d, %d) accepted the wrong new root", size1, size2)
+			}
+			if err := v.VerifyConsistencyProof(size1, size2, root1, root2, proof[:len(proof)-1]); err == nil {
+				t.Errorf("VerifyConsistencyProof(%d, %d) accepted a truncated proof", size1, size2)
+			}
+		}
+	}
+
+	root := tree.CurrentRoot().Hash()
+	if err := v.VerifyConsistencyProof(leaves, leaves, root, root, nil); err != nil {
+		t.Errorf("VerifyConsistencyProof failed for the same tree: %v", err)
+	}
+	if err := v.VerifyConsistencyProof(0, leaves, nil, root, nil); err != nil {
+		t.Errorf("VerifyConsistencyProof failed from the empty tree: %v", err)
+	}
+	if err := v.VerifyConsistencyProof(leaves, 1, root, root, nil); err == nil {
+		t.Errorf("VerifyConsistencyProof accepted a tree that shrank")
+	}
+}
@@ -29,12 +29,19 @@ func keyHasher(h trillian.Hasher) keyHashFunc {
 	}
 }
 
+// createNullHashes returns the null hashes ordered from just below the root down
+// to the leaves, taken from the shared table of empty hashes.
 func createNullHashes(th TreeHasher) []trillian.Hash {
+	empty := EmptyHashesFor(th)
 	numEntries := th.Size() * 8
 	r := make([]trillian.Hash, numEntries, numEntries)
-	r[numEntries-1] = th.HashLeaf([]byte{})
-	for i := numEntries - 2; i >= 0; i-- {
-		r[i] = th.HashChildren(r[i+1], r[i+1])
+	for i := range r {
+		r[i] = empty[numEntries-1-i]
 	}
 	return r
 }
+
+// EmptyHashes returns the shared table of empty subtree hashes for the map.
+func (m MapHasher) EmptyHashes() EmptyHashes {
+	return EmptyHashesFor(m.TreeHasher)
+}
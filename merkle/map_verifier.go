@@ -58,3 +58,107 @@ func VerifyMapInclusionProof(keyHash trillian.Hash, leafHash trillian.Hash, expe
 	}
 	return nil
 }
+
+// VerifyMapExclusionProof verifies that the key with keyHash has no value in the
+// map with root expectedRoot. A key without a value holds an empty leaf, so this
+// checks the proof as the inclusion proof of the empty leaf hash.
+//
+// Returns nil on a successful verification, and an error otherwise.
+func VerifyMapExclusionProof(keyHash trillian.Hash, expectedRoot trillian.Hash, proof []trillian.Hash, h MapHasher) error {
+	return VerifyMapInclusionProof(keyHash, h.EmptyHashes()[0], expectedRoot, proof, h)
+}
+
+// MapLeafUpdate is a leaf set by a revision of a map, with the proof of its
+// value in the previous revision.
+type MapLeafUpdate struct {
+	KeyHash trillian.Hash
+	// OldLeafHash is the leaf hash in the previous revision, the hash of an
+	// empty leaf if the key wasn't set.
+	OldLeafHash trillian.Hash
+	// NewLeafHash is the leaf hash set by the revision.
+	NewLeafHash trillian.Hash
+	// Proof is the inclusion proof for OldLeafHash in the previous revision.
+	Proof []trillian.Hash
+}
+
+// updatedNode is a node on the path from an updated leaf to the root.
+type updatedNode struct {
+	hash trillian.Hash
+	// proof is the proof of one of the updated leaves below the node. All of
+	// them share the proof elements above it.
+	proof []trillian.Hash
+}
+
+// VerifyMapUpdate verifies that newRoot is the root of the map with root
+// oldRoot after updates have been applied to it, and that no other leaves have
+// changed. Each update's old leaf hash is checked against oldRoot using its
+// inclusion proof, then the new root is calculated from the new leaf hashes and
+// the untouched parts of those proofs.
+//
+// Returns nil on a successful verification, and an error otherwise.
+func VerifyMapUpdate(oldRoot, newRoot trillian.Hash, updates []MapLeafUpdate, h MapHasher) error {
+	hBits := h.Size() * 8
+
+	nodes := make(map[string]updatedNode)
+	for _, u := range updates {
+		if _, ok := nodes[string(u.KeyHash)]; ok {
+			return fmt.Errorf("invalid update: key hash %x is updated more than once", u.KeyHash)
+		}
+		if err := VerifyMapInclusionProof(u.KeyHash, u.OldLeafHash, oldRoot, u.Proof, h); err != nil {
+			return fmt.Errorf("invalid update for key hash %x: %v", u.KeyHash, err)
+		}
+		if got, want := len(u.NewLeafHash)*8, hBits; got != want {
+			return fmt.Errorf("invalid newLeafHash length %d, expected %d", got, want)
+		}
+		nodes[string(u.KeyHash)] = updatedNode{hash: u.NewLeafHash, proof: u.Proof}
+	}
+	if len(nodes) == 0 {
+		if !bytes.Equal(oldRoot, newRoot) {
+			return fmt.Errorf("invalid update; no leaves changed but roothash changed from %v to %v", oldRoot, newRoot)
+		}
+		return nil
+	}
+
+	// Nodes are keyed by the key hash of the leaves below them, with the bits
+	// below the node's level cleared, so siblings differ only in the bit for
+	// their level.
+	for bit := 0; bit < hBits; bit++ {
+		parents := make(map[string]updatedNode)
+		for id, n := range nodes {
+			path := []byte(id)
+			byteIndex, mask := len(path)-1-bit/8, byte(1)<<uint(bit%8)
+
+			path[byteIndex] ^= mask
+			sibling, ok := nodes[string(path)]
+			path[byteIndex] ^= mask
+			var sibHash trillian.Hash
+			if ok {
+				sibHash = sibling.hash
+			} else if sibHash = n.proof[bit]; len(sibHash) == 0 {
+				sibHash = h.nullHashes[hBits-1-bit]
+			}
+
+			isRight := path[byteIndex]&mask != 0
+			path[byteIndex] &^= mask
+			if _, ok := parents[string(path)]; ok {
+				// Already calculated from the sibling
+				continue
+			}
+			var hash trillian.Hash
+			if isRight {
+				hash = h.HashChildren(sibHash, n.hash)
+			} else {
+				hash = h.HashChildren(n.hash, sibHash)
+			}
+			parents[string(path)] = updatedNode{hash: hash, proof: n.proof}
+		}
+		nodes = parents
+	}
+
+	for _, root := range nodes {
+		if got, want := root.hash, newRoot; !bytes.Equal(got, want) {
+			return fmt.Errorf("invalid update; calculated roothash %v but expected %v", got, want)
+		}
+	}
+	return nil
+}
@@ -314,3 +314,225 @@ var inclusionProofTestVector = []struct {
 		testonly.MustDecodeBase64("bEapbZbXfyhAZqLAFPpbx2KMX/m9FvHenwFJFIn2LHs="),
 	},
 }
+
+// testSparseTree holds the leaf hashes of a sparse Merkle tree by key hash, and
+// calculates its hashes the slow way.
+type testSparseTree map[string]trillian.Hash
+
+func testKeyBit(kh []byte, bit int) byte {
+	return (kh[len(kh)-1-bit/8] >> uint(bit%8)) & 1
+}
+
+// hash returns the hash of the subtree at height holding the keys.
+func (tr testSparseTree) hash(h MapHasher, keys []string, height int) trillian.Hash {
+	if len(keys) == 0 {
+		return h.EmptyHashes()[height]
+	}
+	if height == 0 {
+		return tr[keys[0]]
+	}
+	var left, right []string
+	for _, k := range keys {
+		if testKeyBit([]byte(k), height-1) == 0 {
+			left = append(left, k)
+		} else {
+			right = append(right, k)
+		}
+	}
+	return h.HashChildren(tr.hash(h, left, height-1), tr.hash(h, right, height-1))
+}
+
+func (tr testSparseTree) keys() []string {
+	var keys []string
+	for k := range tr {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (tr testSparseTree) root(h MapHasher) trillian.Hash {
+	return tr.hash(h, tr.keys(), h.Size()*8)
+}
+
+// proof returns the inclusion proof for kh, leaving empty subtrees out.
+func (tr testSparseTree) proof(h MapHasher, kh trillian.Hash) []trillian.Hash {
+	hBits := h.Size() * 8
+	proof := make([]trillian.Hash, hBits)
+	for bit := 0; bit < hBits; bit++ {
+		var sibs []string
+	keys:
+		for _, k := range tr.keys() {
+			for b := hBits - 1; b > bit; b-- {
+				if testKeyBit([]byte(k), b) != testKeyBit(kh, b) {
+					continue keys
+				}
+			}
+			if testKeyBit([]byte(k), bit) != testKeyBit(kh, bit) {
+				sibs = append(sibs, k)
+			}
+		}
+		if len(sibs) > 0 {
+			proof[bit] = tr.hash(h, sibs, bit)
+		}
+	}
+	return proof
+}
+
+func (tr testSparseTree) leafHash(h MapHasher, kh trillian.Hash) trillian.Hash {
+	if lh, ok := tr[string(kh)]; ok {
+		return lh
+	}
+	return h.EmptyHashes()[0]
+}
+
+// testUpdate returns an old tree, a new tree made by setting some of its
+// leaves, and the updates between them.
+func testUpdate(h MapHasher) (testSparseTree, testSparseTree, []MapLeafUpdate) {
+	sibling := h.HashKey([]byte("sibling"))
+	sibling2 := append(trillian.Hash{}, sibling...)
+	sibling2[len(sibling2)-1] ^= 1
+	old := testSparseTree{
+		string(h.HashKey([]byte("unchanged"))): h.HashLeaf([]byte("unchanged value")),
+		string(h.HashKey([]byte("changed"))):   h.HashLeaf([]byte("old value")),
+		string(h.HashKey([]byte("cleared"))):   h.HashLeaf([]byte("old value")),
+	}
+	set := testSparseTree{
+		string(h.HashKey([]byte("changed"))): h.HashLeaf([]byte("new value")),
+		string(h.HashKey([]byte("cleared"))): h.EmptyHashes()[0],
+		string(h.HashKey([]byte("added"))):   h.HashLeaf([]byte("added value")),
+		// Siblings at the bottom of the tree, neither of which was set before
+		string(sibling):  h.HashLeaf([]byte("sibling value")),
+		string(sibling2): h.HashLeaf([]byte("sibling value 2")),
+	}
+
+	updated := testSparseTree{}
+	for k, v := range old {
+		updated[k] = v
+	}
+	var updates []MapLeafUpdate
+	for k, v := range set {
+		kh := trillian.Hash(k)
+		updates = append(updates, MapLeafUpdate{
+			KeyHash:     kh,
+			OldLeafHash: old.leafHash(h, kh),
+			NewLeafHash: v,
+			Proof:       old.proof(h, kh),
+		})
+		updated[k] = v
+	}
+	return old, updated, updates
+}
+
+func TestVerifyMapUpdateWorks(t *testing.T) {
+	h := NewMapHasher(NewRFC6962TreeHasher(trillian.NewSHA256()))
+	old, updated, updates := testUpdate(h)
+	if err := VerifyMapUpdate(old.root(h), updated.root(h), updates, h); err != nil {
+		t.Errorf("update verification failed: %v", err)
+	}
+}
+
+func TestVerifyMapUpdateWorksWithNoUpdates(t *testing.T) {
+	h := NewMapHasher(NewRFC6962TreeHasher(trillian.NewSHA256()))
+	old, updated, _ := testUpdate(h)
+	if err := VerifyMapUpdate(old.root(h), old.root(h), nil, h); err != nil {
+		t.Errorf("update verification failed: %v", err)
+	}
+	if err := VerifyMapUpdate(old.root(h), updated.root(h), nil, h); err == nil {
+		t.Errorf("unexpectedly verified changed root with no updates")
+	}
+}
+
+func TestVerifyMapUpdateCatchesMissingUpdate(t *testing.T) {
+	h := NewMapHasher(NewRFC6962TreeHasher(trillian.NewSHA256()))
+	old, updated, updates := testUpdate(h)
+	if err := VerifyMapUpdate(old.root(h), updated.root(h), updates[1:], h); err == nil {
+		t.Errorf("unexpectedly verified update with a leaf missing")
+	}
+}
+
+func TestVerifyMapUpdateCatchesWrongNewLeaf(t *testing.T) {
+	h := NewMapHasher(NewRFC6962TreeHasher(trillian.NewSHA256()))
+	old, updated, updates := testUpdate(h)
+	updates[0].NewLeafHash = h.HashLeaf([]byte("wibble"))
+	if err := VerifyMapUpdate(old.root(h), updated.root(h), updates, h); err == nil {
+		t.Errorf("unexpectedly verified update with incorrect new leaf")
+	}
+}
+
+func TestVerifyMapUpdateCatchesWrongOldLeaf(t *testing.T) {
+	h := NewMapHasher(NewRFC6962TreeHasher(trillian.NewSHA256()))
+	old, updated, updates := testUpdate(h)
+	updates[0].OldLeafHash = h.HashLeaf([]byte("wibble"))
+	if err := VerifyMapUpdate(old.root(h), updated.root(h), updates, h); err == nil {
+		t.Errorf("unexpectedly verified update with incorrect old leaf")
+	}
+}
+
+func TestVerifyMapUpdateRejectsDuplicateKey(t *testing.T) {
+	h := NewMapHasher(NewRFC6962TreeHasher(trillian.NewSHA256()))
+	old, updated, updates := testUpdate(h)
+	updates = append(updates, updates[0])
+	if err := VerifyMapUpdate(old.root(h), updated.root(h), updates, h); err == nil {
+		t.Errorf("unexpectedly verified update with duplicate key")
+	}
+}
+
+func TestVerifyMapExclusionProof(t *testing.T) {
+	h := NewMapHasher(NewRFC6962TreeHasher(trillian.NewSHA256()))
+	present := h.HashKey([]byte("present"))
+	tr := testSparseTree{
+		string(present):                    h.HashLeaf([]byte("value")),
+		string(h.HashKey([]byte("other"))): h.HashLeaf([]byte("other value")),
+	}
+	root := tr.root(h)
+
+	absent := h.HashKey([]byte("absent"))
+	if err := VerifyMapExclusionProof(absent, root, tr.proof(h, absent), h); err != nil {
+		t.Errorf("exclusion proof verification failed: %v", err)
+	}
+	if err := VerifyMapExclusionProof(present, root, tr.proof(h, present), h); err == nil {
+		t.Errorf("unexpectedly verified exclusion proof for a key with a value")
+	}
+}
+
+func newSHA512MapHasher(t *testing.T) MapHasher {
+	hasher, err := trillian.NewHasher(trillian.HashAlgorithm_SHA512)
+	if err != nil {
+		t.Fatalf("NewHasher(SHA512) = %v", err)
+	}
+	return NewMapHasher(NewRFC6962TreeHasher(hasher))
+}
+
+func TestVerifyMapInclusionProofWithSHA512(t *testing.T) {
+	h := newSHA512MapHasher(t)
+	_, tree, _ := testUpdate(h)
+	root := tree.root(h)
+	for _, key := range []string{"changed", "added", "never set"} {
+		kh := h.HashKey([]byte(key))
+		proof := tree.proof(h, kh)
+		if got, want := len(proof), 512; got != want {
+			t.Fatalf("got proof with %d entries, want %d", got, want)
+		}
+		if err := VerifyMapInclusionProof(kh, tree.leafHash(h, kh), root, proof, h); err != nil {
+			t.Errorf("VerifyMapInclusionProof(%q) = %v", key, err)
+		}
+	}
+
+	// A proof from a SHA-256 map is too short.
+	sha256Hasher := NewMapHasher(NewRFC6962TreeHasher(trillian.NewSHA256()))
+	kh := h.HashKey([]byte("changed"))
+	if err := VerifyMapInclusionProof(kh, tree.leafHash(h, kh), root, make([]trillian.Hash, 256), h); err == nil {
+		t.Error("VerifyMapInclusionProof() accepted a 256 entry proof for a SHA-512 map")
+	}
+	if err := VerifyMapInclusionProof(kh, tree.leafHash(h, kh), root, tree.proof(h, kh), sha256Hasher); err == nil {
+		t.Error("VerifyMapInclusionProof() accepted a SHA-512 proof with a SHA-256 hasher")
+	}
+}
+
+func TestVerifyMapUpdateWorksWithSHA512(t *testing.T) {
+	h := newSHA512MapHasher(t)
+	old, updated, updates := testUpdate(h)
+	if err := VerifyMapUpdate(old.root(h), updated.root(h), updates, h); err != nil {
+		t.Errorf("update verification failed: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+// Package reference contains slow but obviously correct implementations of the
+// Merkle tree computations done by the merkle package, and known answer test
+// vectors for them.
+//
+// The log functions follow the recursive definitions in section 2.1 of RFC 6962
+// as closely as possible and the sparse functions simply walk every level of the
+// tree. Nothing here is optimized or meant for production use. It exists so that
+// the optimized implementations can be cross-checked against it, and so that
+// people writing clients in other languages have something simple to compare
+// their code with.
+package reference
+
+import (
+	"fmt"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/merkle"
+)
+
+// largestPowerOfTwoBelow returns the largest power of two smaller than n, which
+// must be greater than 1. This is k in the RFC 6962 definitions.
+func largestPowerOfTwoBelow(n int64) int64 {
+	k := int64(1)
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// RootHash returns the Merkle Tree Hash of the log holding leaves, MTH(D[n]) in
+// RFC 6962.
+func RootHash(th merkle.TreeHasher, leaves [][]byte) trillian.Hash {
+	n := int64(len(leaves))
+	switch n {
+	case 0:
+		return th.HashEmpty()
+	case 1:
+		return th.HashLeaf(leaves[0])
+	}
+
+	k := largestPowerOfTwoBelow(n)
+	return th.HashChildren(RootHash(th, leaves[:k]), RootHash(th, leaves[k:]))
+}
+
+// InclusionProof returns the audit path for the leaf at index in the log holding
+// leaves, PATH(m, D[n]) in RFC 6962. The path is ordered from the leaf up to the
+// root. Leaves are indexed from zero.
+func InclusionProof(th merkle.TreeHasher, leaves [][]byte, index int64) ([]trillian.Hash, error) {
+	n := int64(len(leaves))
+	if index < 0 || index >= n {
+		return nil, fmt.Errorf("leaf index %d out of range for tree of size %d", index, n)
+	}
+	return path(th, leaves, index), nil
+}
+
+func path(th merkle.TreeHasher, leaves [][]byte, m int64) []trillian.Hash {
+	n := int64(len(leaves))
+	if n == 1 {
+		return nil
+	}
+
+	k := largestPowerOfTwoBelow(n)
+	if m < k {
+		return append(path(th, leaves[:k], m), RootHash(th, leaves[k:]))
+	}
+	return append(path(th, leaves[k:], m-k), RootHash(th, leaves[:k]))
+}
+
+// ConsistencyProof returns the proof that the log of size1 leaves is a prefix of
+// the log holding leaves, PROOF(m, D[n]) in RFC 6962.
+func ConsistencyProof(th merkle.TreeHasher, leaves [][]byte, size1 int64) ([]trillian.Hash, error) {
+	n := int64(len(leaves))
+	if size1 < 0 || size1 > n {
+		return nil, fmt.Errorf("tree size %d out of range for tree of size %d", size1, n)
+	}
+	if size1 == 0 || size1 == n {
+		return nil, nil
+	}
+	return subproof(th, leaves, size1, true), nil
+}
+
+// subproof is SUBPROOF(m, D[n], b) in RFC 6962.
+func subproof(th merkle.TreeHasher, leaves [][]byte, m int64, b bool) []trillian.Hash {
+	n := int64(len(leaves))
+	if m == n {
+		if b {
+			return nil
+		}
+		return []trillian.Hash{RootHash(th, leaves)}
+	}
+
+	k := largestPowerOfTwoBelow(n)
+	if m <= k {
+		return append(subproof(th, leaves[:k], m, b), RootHash(th, leaves[k:]))
+	}
+	return append(subproof(th, leaves[k:], m-k, false), RootHash(th, leaves[:k]))
+}
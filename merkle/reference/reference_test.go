@@ -0,0 +1,284 @@
+package reference
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/merkle"
+)
+
+var updateVectors = flag.Bool("update_vectors", false, "Rewrite testdata/vectors.json from the Go test vectors")
+
+const vectorsFile = "testdata/vectors.json"
+
+func rfc6962Hasher() merkle.TreeHasher {
+	return merkle.NewRFC6962TreeHasher(trillian.NewSHA256())
+}
+
+func randomLeaves(r *rand.Rand, n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		leaves[i] = make([]byte, r.Intn(20))
+		r.Read(leaves[i])
+	}
+	return leaves
+}
+
+func hashesEqual(a, b []trillian.Hash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLogVectors(t *testing.T) {
+	th := rfc6962Hasher()
+
+	if got := RootHash(th, nil); !bytes.Equal(got, LogEmptyRoot) {
+		t.Errorf("RootHash(empty)=%x, want %x", got, LogEmptyRoot)
+	}
+	for i, want := range LogRoots {
+		if got := RootHash(th, LogLeaves[:i+1]); !bytes.Equal(got, want) {
+			t.Errorf("RootHash(size %d)=%x, want %x", i+1, got, want)
+		}
+	}
+
+	for _, v := range LogInclusionProofs {
+		got, err := InclusionProof(th, LogLeaves[:v.TreeSize], v.LeafIndex)
+		if err != nil {
+			t.Errorf("InclusionProof(%d, %d) failed: %v", v.LeafIndex, v.TreeSize, err)
+			continue
+		}
+		if !hashesEqual(got, v.Proof) {
+			t.Errorf("InclusionProof(%d, %d)=%x, want %x", v.LeafIndex, v.TreeSize, got, v.Proof)
+		}
+	}
+
+	for _, v := range LogConsistencyProofs {
+		got, err := ConsistencyProof(th, LogLeaves[:v.Size2], v.Size1)
+		if err != nil {
+			t.Errorf("ConsistencyProof(%d, %d) failed: %v", v.Size1, v.Size2, err)
+			continue
+		}
+		if !hashesEqual(got, v.Proof) {
+			t.Errorf("ConsistencyProof(%d, %d)=%x, want %x", v.Size1, v.Size2, got, v.Proof)
+		}
+	}
+}
+
+func TestLogProofRanges(t *testing.T) {
+	th := rfc6962Hasher()
+
+	for _, index := range []int64{-1, 3} {
+		if _, err := InclusionProof(th, LogLeaves[:3], index); err == nil {
+			t.Errorf("InclusionProof(%d) in tree of size 3 did not fail", index)
+		}
+	}
+	for _, size := range []int64{-1, 4} {
+		if _, err := ConsistencyProof(th, LogLeaves[:3], size); err == nil {
+			t.Errorf("ConsistencyProof(%d) to tree of size 3 did not fail", size)
+		}
+	}
+}
+
+// TestRootHashMatchesCompactTree cross-checks the roots calculated as leaves are
+// appended to the CompactMerkleTree used by the log sequencer.
+func TestRootHashMatchesCompactTree(t *testing.T) {
+	th := rfc6962Hasher()
+	leaves := randomLeaves(rand.New(rand.NewSource(1)), 100)
+
+	tree := merkle.NewCompactMerkleTree(th)
+	if got, want := tree.CurrentRoot(), RootHash(th, nil); !bytes.Equal(got, want) {
+		t.Fatalf("Empty compact tree root=%x, want %x", got, want)
+	}
+	for i, leaf := range leaves {
+		tree.AddLeaf(leaf, func(int, int64, trillian.Hash) {})
+		if got, want := tree.CurrentRoot(), RootHash(th, leaves[:i+1]); !bytes.Equal(got, want) {
+			t.Fatalf("Compact tree root at size %d=%x, want %x", i+1, got, want)
+		}
+	}
+}
+
+// TestProofsMatchInMemoryTree cross-checks the proofs from InMemoryMerkleTree,
+// which uses 1-based leaf indices.
+func TestProofsMatchInMemoryTree(t *testing.T) {
+	th := rfc6962Hasher()
+	leaves := randomLeaves(rand.New(rand.NewSource(2)), 40)
+
+	tree := merkle.NewInMemoryMerkleTree(th)
+	for _, leaf := range leaves {
+		tree.AddLeaf(leaf)
+	}
+
+	for size := int64(1); size <= int64(len(leaves)); size++ {
+		for index := int64(0); index < size; index++ {
+			want, err := InclusionProof(th, leaves[:size], index)
+			if err != nil {
+				t.Fatalf("InclusionProof(%d, %d) failed: %v", index, size, err)
+			}
+			var got []trillian.Hash
+			for _, e := range tree.PathToRootAtSnapshot(int(index+1), int(size)) {
+				got = append(got, e.Value.Hash())
+			}
+			if !hashesEqual(got, want) {
+				t.Fatalf("PathToRootAtSnapshot(%d, %d)=%x, want %x", index+1, size, got, want)
+			}
+		}
+
+		for size1 := int64(1); size1 < size; size1++ {
+			want, err := ConsistencyProof(th, leaves[:size], size1)
+			if err != nil {
+				t.Fatalf("ConsistencyProof(%d, %d) failed: %v", size1, size, err)
+			}
+			var got []trillian.Hash
+			for _, e := range tree.SnapshotConsistency(int(size1), int(size)) {
+				got = append(got, e.Value.Hash())
+			}
+			if !hashesEqual(got, want) {
+				t.Fatalf("SnapshotConsistency(%d, %d)=%x, want %x", size1, size, got, want)
+			}
+		}
+	}
+}
+
+func sparseLeaves(th merkle.TreeHasher, values map[string][]byte) []SparseLeaf {
+	var leaves []SparseLeaf
+	for k, v := range values {
+		kh := sha256.Sum256([]byte(k))
+		leaves = append(leaves, SparseLeaf{KeyHash: kh[:], LeafHash: th.HashLeaf(v)})
+	}
+	return leaves
+}
+
+func TestSparseVectors(t *testing.T) {
+	th := rfc6962Hasher()
+
+	root, err := SparseRootHash(th, nil)
+	if err != nil {
+		t.Fatalf("SparseRootHash(empty) failed: %v", err)
+	}
+	if !bytes.Equal(root, SparseEmptyRoot) {
+		t.Errorf("SparseRootHash(empty)=%x, want %x", root, SparseEmptyRoot)
+	}
+
+	values := make(map[string][]byte)
+	for i, v := range SparseSteps {
+		values[string(v.Key)] = v.Value
+		root, err := SparseRootHash(th, sparseLeaves(th, values))
+		if err != nil {
+			t.Fatalf("SparseRootHash at step %d failed: %v", i, err)
+		}
+		if !bytes.Equal(root, v.Root) {
+			t.Errorf("SparseRootHash at step %d=%x, want %x", i, root, v.Root)
+		}
+	}
+}
+
+func TestSparseRootHashErrors(t *testing.T) {
+	th := rfc6962Hasher()
+	kh := sha256.Sum256([]byte("key"))
+
+	for _, leaves := range [][]SparseLeaf{
+		{{KeyHash: []byte("short"), LeafHash: th.HashLeaf(nil)}},
+		{{KeyHash: kh[:], LeafHash: th.HashLeaf(nil)}, {KeyHash: kh[:], LeafHash: th.HashLeaf([]byte("x"))}},
+	} {
+		if _, err := SparseRootHash(th, leaves); err == nil {
+			t.Errorf("SparseRootHash(%v) did not fail", leaves)
+		}
+	}
+}
+
+// TestSparseMatchesHStar2 cross-checks the roots calculated by HStar2, and that
+// the reference proofs are accepted by the map verifier.
+func TestSparseMatchesHStar2(t *testing.T) {
+	th := rfc6962Hasher()
+	mh := merkle.NewMapHasher(th)
+	r := rand.New(rand.NewSource(3))
+
+	for _, n := range []int{1, 2, 5, 30} {
+		values := make(map[string][]byte)
+		for i := 0; i < n; i++ {
+			values[fmt.Sprintf("key-%d", r.Int())] = randomLeaves(r, 1)[0]
+		}
+		leaves := sparseLeaves(th, values)
+
+		want, err := SparseRootHash(th, leaves)
+		if err != nil {
+			t.Fatalf("SparseRootHash failed: %v", err)
+		}
+
+		var hsLeaves []merkle.HStar2LeafHash
+		for _, l := range leaves {
+			hsLeaves = append(hsLeaves, merkle.HStar2LeafHash{Index: new(big.Int).SetBytes(l.KeyHash), LeafHash: l.LeafHash})
+		}
+		hs := merkle.NewHStar2(th)
+		got, err := hs.HStar2Root(th.Size()*8, hsLeaves)
+		if err != nil {
+			t.Fatalf("HStar2Root failed: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("HStar2Root with %d leaves=%x, want %x", n, got, want)
+		}
+
+		for _, l := range leaves {
+			proof, err := SparseInclusionProof(th, leaves, l.KeyHash)
+			if err != nil {
+				t.Fatalf("SparseInclusionProof failed: %v", err)
+			}
+			if err := VerifySparseInclusionProof(th, l.KeyHash, l.LeafHash, want, proof); err != nil {
+				t.Fatalf("VerifySparseInclusionProof failed: %v", err)
+			}
+			if err := merkle.VerifyMapInclusionProof(l.KeyHash, l.LeafHash, want, proof, mh); err != nil {
+				t.Fatalf("VerifyMapInclusionProof rejected reference proof: %v", err)
+			}
+		}
+
+		// A key which isn't set must prove to hold the empty leaf
+		kh := sha256.Sum256([]byte("missing"))
+		proof, err := SparseInclusionProof(th, leaves, kh[:])
+		if err != nil {
+			t.Fatalf("SparseInclusionProof failed: %v", err)
+		}
+		if err := merkle.VerifyMapInclusionProof(kh[:], th.HashLeaf([]byte{}), want, proof, mh); err != nil {
+			t.Fatalf("VerifyMapInclusionProof rejected reference proof for missing key: %v", err)
+		}
+		if err := VerifySparseInclusionProof(th, kh[:], th.HashLeaf([]byte("wrong")), want, proof); err == nil {
+			t.Fatalf("VerifySparseInclusionProof accepted the wrong leaf")
+		}
+	}
+}
+
+// TestVectorsFile checks that the JSON copy of the vectors for other languages
+// is up to date. Run with -update_vectors to regenerate it.
+func TestVectorsFile(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+
+	if *updateVectors {
+		if err := ioutil.WriteFile(vectorsFile, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", vectorsFile, err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(vectorsFile)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", vectorsFile, err)
+	}
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Fatalf("%s is out of date, run the test with -update_vectors", vectorsFile)
+	}
+}
@@ -0,0 +1,151 @@
+package reference
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/merkle"
+)
+
+// SparseLeaf is a leaf in a sparse Merkle tree. The bits of KeyHash, most
+// significant first, give the path from the root to the leaf.
+type SparseLeaf struct {
+	KeyHash  trillian.Hash
+	LeafHash trillian.Hash
+}
+
+// sparseTree holds what's needed to walk a sparse tree as deep as the hash size.
+type sparseTree struct {
+	th    merkle.TreeHasher
+	depth int
+	// empty holds the hash of an empty subtree at each height, worked out here
+	// rather than taken from the merkle package as that's part of what's checked
+	empty []trillian.Hash
+}
+
+func newSparseTree(th merkle.TreeHasher, leaves []SparseLeaf) (*sparseTree, error) {
+	t := &sparseTree{th: th, depth: th.Size() * 8}
+
+	seen := make(map[string]bool)
+	for _, l := range leaves {
+		if got, want := len(l.KeyHash)*8, t.depth; got != want {
+			return nil, fmt.Errorf("key hash %x has %d bits, want %d", l.KeyHash, got, want)
+		}
+		if seen[string(l.KeyHash)] {
+			return nil, fmt.Errorf("key hash %x appears more than once", l.KeyHash)
+		}
+		seen[string(l.KeyHash)] = true
+	}
+
+	t.empty = []trillian.Hash{th.HashEmptyLeaf()}
+	for h := 1; h <= t.depth; h++ {
+		t.empty = append(t.empty, th.HashChildren(t.empty[h-1], t.empty[h-1]))
+	}
+
+	return t, nil
+}
+
+// bit returns the bit of keyHash at depth d below the root.
+func bit(keyHash trillian.Hash, d int) byte {
+	return (keyHash[d/8] >> uint(7-d%8)) & 1
+}
+
+// split divides leaves into those to the left and right of the node at depth d
+// above them.
+func split(leaves []SparseLeaf, d int) (left, right []SparseLeaf) {
+	for _, l := range leaves {
+		if bit(l.KeyHash, d) == 0 {
+			left = append(left, l)
+		} else {
+			right = append(right, l)
+		}
+	}
+	return left, right
+}
+
+// root returns the hash of the subtree at depth d which holds leaves.
+func (t *sparseTree) root(leaves []SparseLeaf, d int) trillian.Hash {
+	if len(leaves) == 0 {
+		return t.empty[t.depth-d]
+	}
+	if d == t.depth {
+		return leaves[0].LeafHash
+	}
+
+	left, right := split(leaves, d)
+	return t.th.HashChildren(t.root(left, d+1), t.root(right, d+1))
+}
+
+// SparseRootHash returns the root hash of the sparse Merkle tree holding leaves.
+// The tree is as deep as the hash size in bits, and every position without a
+// leaf holds the leaf hash of empty data.
+func SparseRootHash(th merkle.TreeHasher, leaves []SparseLeaf) (trillian.Hash, error) {
+	t, err := newSparseTree(th, leaves)
+	if err != nil {
+		return nil, err
+	}
+	return t.root(leaves, 0), nil
+}
+
+// SparseInclusionProof returns the inclusion proof for keyHash in the sparse
+// Merkle tree holding leaves. The proof holds the sibling of each node on the
+// path from the leaf up to the root, and unlike the proofs served by a map every
+// element is filled in, including those which are empty subtrees.
+func SparseInclusionProof(th merkle.TreeHasher, leaves []SparseLeaf, keyHash trillian.Hash) ([]trillian.Hash, error) {
+	t, err := newSparseTree(th, leaves)
+	if err != nil {
+		return nil, err
+	}
+	if got, want := len(keyHash)*8, t.depth; got != want {
+		return nil, fmt.Errorf("key hash %x has %d bits, want %d", keyHash, got, want)
+	}
+
+	proof := make([]trillian.Hash, t.depth)
+	for d := 0; d < t.depth; d++ {
+		left, right := split(leaves, d)
+		if bit(keyHash, d) == 0 {
+			proof[t.depth-d-1] = t.root(right, d+1)
+			leaves = left
+		} else {
+			proof[t.depth-d-1] = t.root(left, d+1)
+			leaves = right
+		}
+	}
+
+	return proof, nil
+}
+
+// VerifySparseInclusionProof checks that proof shows leafHash is held at keyHash
+// in the sparse Merkle tree with the given root. Empty proof elements stand for
+// empty subtrees.
+func VerifySparseInclusionProof(th merkle.TreeHasher, keyHash, leafHash, root trillian.Hash, proof []trillian.Hash) error {
+	t, err := newSparseTree(th, nil)
+	if err != nil {
+		return err
+	}
+	if got, want := len(keyHash)*8, t.depth; got != want {
+		return fmt.Errorf("key hash %x has %d bits, want %d", keyHash, got, want)
+	}
+	if got, want := len(proof), t.depth; got != want {
+		return fmt.Errorf("proof has %d elements, want %d", got, want)
+	}
+
+	h := leafHash
+	for height := 0; height < t.depth; height++ {
+		sibling := proof[height]
+		if len(sibling) == 0 {
+			sibling = t.empty[height]
+		}
+		if bit(keyHash, t.depth-height-1) == 0 {
+			h = th.HashChildren(h, sibling)
+		} else {
+			h = th.HashChildren(sibling, h)
+		}
+	}
+
+	if !bytes.Equal(h, root) {
+		return fmt.Errorf("proof gives root %x, want %x", h, root)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package reference
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+
+	"github.com/google/trillian"
+)
+
+// The known answers below all use SHA-256 with the RFC 6962 domain separation
+// prefixes. The log vectors come from the C++ Merkle tree tests and the sparse
+// vectors from the C++/Python sparse Merkle tree code, both in the
+// github.com/google/certificate-transparency repo.
+
+// InclusionProofVector is a known inclusion proof for the leaf at LeafIndex,
+// counting from zero, in the log of size TreeSize.
+type InclusionProofVector struct {
+	LeafIndex int64
+	TreeSize  int64
+	Proof     []trillian.Hash
+}
+
+// ConsistencyProofVector is a known consistency proof between the logs of sizes
+// Size1 and Size2.
+type ConsistencyProofVector struct {
+	Size1 int64
+	Size2 int64
+	Proof []trillian.Hash
+}
+
+// SparseVector is one step in building a known sparse Merkle tree. Key is hashed
+// with SHA-256 to find the leaf's position and Value is hashed as a leaf. Root is
+// the root hash after setting Key to Value and applying every earlier step.
+type SparseVector struct {
+	Key   []byte
+	Value []byte
+	Root  trillian.Hash
+}
+
+// Vectors holds all of the known answer test vectors, so they can be written out
+// for use outside of Go.
+type Vectors struct {
+	LogLeaves            [][]byte
+	LogEmptyRoot         trillian.Hash
+	LogRoots             []trillian.Hash
+	LogInclusionProofs   []InclusionProofVector
+	LogConsistencyProofs []ConsistencyProofVector
+	SparseEmptyRoot      trillian.Hash
+	SparseSteps          []SparseVector
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func mustBase64(s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func mustHexes(ss ...string) []trillian.Hash {
+	r := make([]trillian.Hash, len(ss))
+	for i, s := range ss {
+		r[i] = mustHex(s)
+	}
+	return r
+}
+
+// LogLeaves is the leaf data of the known log.
+var LogLeaves = [][]byte{
+	mustHex(""),
+	mustHex("00"),
+	mustHex("10"),
+	mustHex("2021"),
+	mustHex("3031"),
+	mustHex("40414243"),
+	mustHex("5051525354555657"),
+	mustHex("606162636465666768696a6b6c6d6e6f"),
+}
+
+// LogEmptyRoot is the root hash of a log with no leaves.
+var LogEmptyRoot = trillian.Hash(mustHex("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
+
+// LogRoots holds the root hash of the log made up of the first i+1 LogLeaves at
+// index i.
+var LogRoots = mustHexes(
+	"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+	"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+	"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+	"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+	"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+	"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+	"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+	"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+)
+
+// LogInclusionProofs holds known inclusion proofs in logs made up of LogLeaves.
+var LogInclusionProofs = []InclusionProofVector{
+	{LeafIndex: 0, TreeSize: 1, Proof: nil},
+	{LeafIndex: 0, TreeSize: 8, Proof: mustHexes(
+		"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+		"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+		"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4")},
+	{LeafIndex: 5, TreeSize: 8, Proof: mustHexes(
+		"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+		"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7")},
+	{LeafIndex: 2, TreeSize: 3, Proof: mustHexes(
+		"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125")},
+	{LeafIndex: 1, TreeSize: 5, Proof: mustHexes(
+		"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+		"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b")},
+}
+
+// LogConsistencyProofs holds known consistency proofs between logs made up of
+// LogLeaves.
+var LogConsistencyProofs = []ConsistencyProofVector{
+	{Size1: 1, Size2: 1, Proof: nil},
+	{Size1: 1, Size2: 8, Proof: mustHexes(
+		"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+		"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+		"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4")},
+	{Size1: 6, Size2: 8, Proof: mustHexes(
+		"0ebc5d3437fbe2db158b9f126a1d118e308181031d0a949f8dededebc558ef6a",
+		"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7")},
+	{Size1: 2, Size2: 5, Proof: mustHexes(
+		"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+		"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b")},
+}
+
+// SparseEmptyRoot is the root hash of a sparse Merkle tree with no leaves.
+var SparseEmptyRoot = trillian.Hash(mustBase64("xmifEIEqCYCXbZUz2Dh1KCFmFZVn7DUVVxbBQTr1PWo="))
+
+// SparseSteps builds a known sparse Merkle tree one key at a time.
+var SparseSteps = []SparseVector{
+	{Key: []byte("a"), Value: []byte("0"), Root: mustBase64("nP1psZp1bu3jrY5Yv89rI+w5ywe9lLqI2qZi5ibTSF0=")},
+	{Key: []byte("b"), Value: []byte("1"), Root: mustBase64("EJ1Rw6DQT9bDn2Zbn7u+9/j799PSdqT9gfBymS9MBZY=")},
+	{Key: []byte("a"), Value: []byte("2"), Root: mustBase64("2rAZz4HJAMJqJ5c8ClS4wEzTP71GTdjMZMe1rKWPA5o=")},
+}
+
+// AllVectors returns all of the known answer test vectors.
+func AllVectors() Vectors {
+	return Vectors{
+		LogLeaves:            LogLeaves,
+		LogEmptyRoot:         LogEmptyRoot,
+		LogRoots:             LogRoots,
+		LogInclusionProofs:   LogInclusionProofs,
+		LogConsistencyProofs: LogConsistencyProofs,
+		SparseEmptyRoot:      SparseEmptyRoot,
+		SparseSteps:          SparseSteps,
+	}
+}
+
+// WriteJSON writes all of the known answer test vectors to w as JSON. Byte
+// strings are base64 encoded.
+func WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(AllVectors(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"runtime"
 	"sync"
 
 	"github.com/google/trillian"
@@ -95,6 +96,10 @@ type subtreeWriter struct {
 	treeHasher TreeHasher
 
 	getSubtree getSubtreeFunc
+
+	// workers holds a token for each subtree being hashed, bounding how many
+	// subtrees of the tree are hashed at once.
+	workers chan struct{}
 }
 
 // getOrCreateChildSubtree returns, or creates and returns, a subtree for the
@@ -218,6 +223,11 @@ func (s *subtreeWriter) buildSubtree() {
 
 	}
 
+	// Waiting for the leaves above can block on child subtrees, so a worker is
+	// only taken once they're all in, otherwise the children might never get one
+	s.workers <- struct{}{}
+	defer func() { <-s.workers }()
+
 	// calculate new root, and intermediate nodes:
 	hs2 := NewHStar2(s.treeHasher)
 	treeDepthOffset := (s.treeHasher.Size()-len(s.prefix))*8 - s.subtreeDepth
@@ -300,8 +310,9 @@ func leafQueueSize(depths []int) int {
 	return 1 << uint(depths[0])
 }
 
-// newLocalSubtreeWriter creates a new local go-routine based subtree worker.
-func newLocalSubtreeWriter(rev int64, prefix []byte, depths []int, newTX newTXFunc, h TreeHasher) (Subtree, error) {
+// newLocalSubtreeWriter creates a new local go-routine based subtree worker,
+// which hashes the subtree once it can take a token from workers.
+func newLocalSubtreeWriter(rev int64, prefix []byte, depths []int, newTX newTXFunc, h TreeHasher, workers chan struct{}) (Subtree, error) {
 	tx, err := newTX()
 	if err != nil {
 		return nil, err
@@ -318,8 +329,9 @@ func newLocalSubtreeWriter(rev int64, prefix []byte, depths []int, newTX newTXFu
 		treeHasher:   h,
 		getSubtree: func(p []byte) (Subtree, error) {
 			myPrefix := bytes.Join([][]byte{prefix, p}, []byte{})
-			return newLocalSubtreeWriter(rev, myPrefix, depths[1:], newTX, h)
+			return newLocalSubtreeWriter(rev, myPrefix, depths[1:], newTX, h, workers)
 		},
+		workers: workers,
 	}
 	// TODO(al): probably shouldn't be spawning go routines willy-nilly like
 	// this, but it'll do for now.
@@ -327,13 +339,30 @@ func newLocalSubtreeWriter(rev int64, prefix []byte, depths []int, newTX newTXFu
 	return &tree, nil
 }
 
+// DefaultSparseMerkleTreeWorkers is the number of subtrees a
+// SparseMerkleTreeWriter hashes at once unless it's created with
+// NewSparseMerkleTreeWriterWithWorkers.
+var DefaultSparseMerkleTreeWorkers = runtime.NumCPU()
+
 // NewSparseMerkleTreeWriter returns a new SparseMerkleTreeWriter, which will
 // write data back into the tree at the specified revision, using the passed
 // in MapHasher to calulate/verify tree hashes, storing via tx.
 func NewSparseMerkleTreeWriter(rev int64, h MapHasher, newTX newTXFunc) (*SparseMerkleTreeWriter, error) {
+	return NewSparseMerkleTreeWriterWithWorkers(rev, h, DefaultSparseMerkleTreeWorkers, newTX)
+}
+
+// NewSparseMerkleTreeWriterWithWorkers returns a new SparseMerkleTreeWriter
+// like NewSparseMerkleTreeWriter, which hashes up to workers subtrees of the
+// tree at once. Values less than one use DefaultSparseMerkleTreeWorkers. The
+// root calculated doesn't depend on the number of workers, but unless it's one
+// the transactions returned by newTX may be used concurrently.
+func NewSparseMerkleTreeWriterWithWorkers(rev int64, h MapHasher, workers int, newTX newTXFunc) (*SparseMerkleTreeWriter, error) {
+	if workers < 1 {
+		workers = DefaultSparseMerkleTreeWorkers
+	}
 	// TODO(al): allow the tree layering sizes to be customisable somehow.
 	const topSubtreeSize = 8 // must be a multiple of 8 for now.
-	tree, err := newLocalSubtreeWriter(rev, []byte{}, []int{topSubtreeSize, h.Size()*8 - topSubtreeSize}, newTX, h.TreeHasher)
+	tree, err := newLocalSubtreeWriter(rev, []byte{}, []int{topSubtreeSize, h.Size()*8 - topSubtreeSize}, newTX, h.TreeHasher, make(chan struct{}, workers))
 	if err != nil {
 		return nil, err
 	}
@@ -347,7 +376,7 @@ func NewSparseMerkleTreeWriter(rev int64, h MapHasher, newTX newTXFunc) (*Sparse
 // RootAtRevision returns the sparse merkle tree root hash at the specified
 // revision, or ErrNoSuchRevision if the requested revision doesn't exist.
 func (s SparseMerkleTreeReader) RootAtRevision(rev int64) (trillian.Hash, error) {
-	rootNodeID := storage.NewEmptyNodeID(256)
+	rootNodeID := storage.NewEmptyNodeID(s.hasher.Size() * 8)
 	nodes, err := s.tx.GetMerkleNodes(rev, []storage.NodeID{rootNodeID})
 	if err != nil {
 		return nil, err
@@ -373,7 +402,12 @@ func (s SparseMerkleTreeReader) RootAtRevision(rev int64) (trillian.Hash, error)
 // specified key at the specified revision.
 // If the revision does not exist it will return ErrNoSuchRevision error.
 func (s SparseMerkleTreeReader) InclusionProof(rev int64, key trillian.Key) ([]trillian.Hash, error) {
-	kh := s.hasher.HashKey(key)
+	return s.InclusionProofForKeyHash(rev, s.hasher.HashKey(key))
+}
+
+// InclusionProofForKeyHash returns an inclusion (or non-inclusion) proof for
+// the key with the specified hash at the specified revision.
+func (s SparseMerkleTreeReader) InclusionProofForKeyHash(rev int64, kh trillian.Hash) ([]trillian.Hash, error) {
 	nid := storage.NewNodeIDFromHash(kh)
 	sibs := nid.Siblings()
 	nodes, err := s.tx.GetMerkleNodes(rev, sibs)
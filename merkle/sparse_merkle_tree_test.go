@@ -227,6 +227,46 @@ func TestInclusionProofForNullEntryInEmptyTree(t *testing.T) {
 
 // TODO(al): Add some more inclusion proof tests here
 
+func TestInclusionProofForNullEntryInEmptySHA512Tree(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	const rev = 100
+	h := newSHA512MapHasher(t)
+	tx := storage.NewMockMapTX(mockCtrl)
+	r := NewSparseMerkleTreeReader(rev, h, tx)
+	tx.EXPECT().GetMerkleNodes(int64(rev), gomock.Any()).Return([]storage.Node{}, nil)
+	proof, err := r.InclusionProof(rev, []byte("SomeArbitraryKey"))
+	if err != nil {
+		t.Fatalf("Got error while retrieving inclusion proof: %v", err)
+	}
+	if got, want := len(proof), 512; got != want {
+		t.Fatalf("Got proof of len %d, want %d", got, want)
+	}
+	kh := h.HashKey([]byte("SomeArbitraryKey"))
+	if err := VerifyMapInclusionProof(kh, h.EmptyHashes()[0], h.EmptyHashes()[512], proof, h); err != nil {
+		t.Errorf("VerifyMapInclusionProof() = %v", err)
+	}
+}
+
+func TestRootAtRevisionForSHA512Tree(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	h := newSHA512MapHasher(t)
+	tx := storage.NewMockMapTX(mockCtrl)
+	r := NewSparseMerkleTreeReader(100, h, tx)
+	node := storage.Node{NodeID: storage.NewEmptyNodeID(512), Hash: randomBytes(t, 64), NodeRevision: 14}
+	tx.EXPECT().GetMerkleNodes(int64(23), rootNodeMatcher{}).Return([]storage.Node{node}, nil)
+	root, err := r.RootAtRevision(23)
+	if err != nil {
+		t.Fatalf("RootAtRevision(23) = %v", err)
+	}
+	if !bytes.Equal(root, node.Hash) {
+		t.Errorf("RootAtRevision(23) = %x, want %x", root, node.Hash)
+	}
+}
+
 func TestInclusionProofGetsIncorrectNode(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -358,6 +398,41 @@ func (f nodeIDFuncMatcher) String() string {
 	return "matches function"
 }
 
+func TestSparseMerkleTreeWriterWithSHA512(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	const rev = 100
+	h := newSHA512MapHasher(t)
+	tx := storage.NewMockMapTX(mockCtrl)
+	tx.EXPECT().WriteRevision().AnyTimes().Return(int64(rev))
+	tx.EXPECT().Commit().AnyTimes().Return(nil)
+	tx.EXPECT().GetMerkleNodes(int64(rev), gomock.Any()).AnyTimes().Return([]storage.Node{}, nil)
+	tx.EXPECT().SetMerkleNodes(gomock.Any()).AnyTimes().Return(nil)
+	w, err := NewSparseMerkleTreeWriter(rev, h, newTX(tx))
+	if err != nil {
+		t.Fatalf("NewSparseMerkleTreeWriter() = %v", err)
+	}
+
+	tree := testSparseTree{}
+	var leaves []HashKeyValue
+	for _, kv := range []sparseKeyValue{{"key1", "value1"}, {"key2", "value2"}, {"key3", "value3"}} {
+		kh, lh := h.HashKey([]byte(kv.k)), h.HashLeaf([]byte(kv.v))
+		leaves = append(leaves, HashKeyValue{kh, lh})
+		tree[string(kh)] = lh
+	}
+	if err := w.SetLeaves(leaves); err != nil {
+		t.Fatalf("SetLeaves() = %v", err)
+	}
+	root, err := w.CalculateRoot()
+	if err != nil {
+		t.Fatalf("CalculateRoot() = %v", err)
+	}
+	if got, want := root, tree.root(h); !bytes.Equal(got, want) {
+		t.Errorf("CalculateRoot() = %x, want %x", got, want)
+	}
+}
+
 func testSparseTreeFetches(t *testing.T, vec sparseTestVector) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -595,3 +670,104 @@ func TestNodeIDFromAddress(t *testing.T) {
 		}
 	}
 }
+
+// memoryTreeTX holds the nodes set through it in memory. It only implements the
+// parts of storage.TreeTX used by SparseMerkleTreeWriter.
+type memoryTreeTX struct {
+	storage.TreeTX
+	mu    sync.Mutex
+	nodes map[memoryNodeKey]storage.Node
+}
+
+type memoryNodeKey struct {
+	path          string
+	prefixLenBits int
+}
+
+func memoryNodeKeyFor(id storage.NodeID) memoryNodeKey {
+	return memoryNodeKey{string(id.Path), id.PrefixLenBits}
+}
+
+func newMemoryTreeTX() *memoryTreeTX {
+	return &memoryTreeTX{nodes: make(map[memoryNodeKey]storage.Node)}
+}
+
+func (m *memoryTreeTX) GetMerkleNodes(treeRevision int64, ids []storage.NodeID) ([]storage.Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var nodes []storage.Node
+	for _, id := range ids {
+		if n, ok := m.nodes[memoryNodeKeyFor(id)]; ok {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, nil
+}
+
+func (m *memoryTreeTX) SetMerkleNodes(nodes []storage.Node) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, n := range nodes {
+		m.nodes[memoryNodeKeyFor(n.NodeID)] = n
+	}
+	return nil
+}
+
+func (m *memoryTreeTX) Commit() error {
+	return nil
+}
+
+// sparseTreeLeaves returns count leaves, and a testSparseTree holding them.
+func sparseTreeLeaves(h MapHasher, count int) ([]HashKeyValue, testSparseTree) {
+	tree := make(testSparseTree)
+	leaves := make([]HashKeyValue, 0, count)
+	for i := 0; i < count; i++ {
+		kh, lh := h.HashKey([]byte(fmt.Sprintf("key-%d", i))), h.HashLeaf([]byte(fmt.Sprintf("value-%d", i)))
+		leaves = append(leaves, HashKeyValue{kh, lh})
+		tree[string(kh)] = lh
+	}
+	return leaves, tree
+}
+
+func calculateSparseTreeRoot(h MapHasher, workers int, leaves []HashKeyValue) (trillian.Hash, error) {
+	tx := newMemoryTreeTX()
+	w, err := NewSparseMerkleTreeWriterWithWorkers(100, h, workers, func() (storage.TreeTX, error) { return tx, nil })
+	if err != nil {
+		return nil, err
+	}
+	if err := w.SetLeaves(leaves); err != nil {
+		return nil, err
+	}
+	return w.CalculateRoot()
+}
+
+func TestSparseMerkleTreeWriterWorkers(t *testing.T) {
+	h := NewMapHasher(NewRFC6962TreeHasher(trillian.NewSHA256()))
+	leaves, tree := sparseTreeLeaves(h, 200)
+	want := tree.root(h)
+
+	for _, workers := range []int{0, 1, 2, 16, 300} {
+		root, err := calculateSparseTreeRoot(h, workers, leaves)
+		if err != nil {
+			t.Fatalf("CalculateRoot() with %d workers = %v", workers, err)
+		}
+		if !bytes.Equal(root, want) {
+			t.Errorf("CalculateRoot() with %d workers = %x, want %x", workers, root, want)
+		}
+	}
+}
+
+func BenchmarkSparseMerkleTreeWriter(b *testing.B) {
+	h := NewMapHasher(NewRFC6962TreeHasher(trillian.NewSHA256()))
+	leaves, _ := sparseTreeLeaves(h, 1024)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := calculateSparseTreeRoot(h, workers, leaves); err != nil {
+					b.Fatalf("CalculateRoot() = %v", err)
+				}
+			}
+		})
+	}
+}
@@ -1,7 +1,12 @@
 package merkle
 
 import (
+	"bytes"
+	"fmt"
+	"hash"
+
 	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
 )
 
 // TODO(al): investigate whether we need configurable TreeHashers for
@@ -28,20 +33,72 @@ const (
 // TreeHasher is a set of domain separated hashers for creating merkle tree hashes.
 type TreeHasher struct {
 	trillian.Hasher
+	// scheme names the way leaves and nodes are hashed, hashers with the same
+	// scheme and algorithm produce the same hashes
+	scheme string
+	// leafPrefix and nodePrefix are the domain separation prefixes, used by the
+	// batch hashing methods
+	leafPrefix  []byte
+	nodePrefix  []byte
 	leafHasher  func([]byte) trillian.Hash
 	nodeHasher  func([]byte) trillian.Hash
 	emptyHasher func() trillian.Hash
+	// emptyLeafHasher gives the hash of an absent leaf of a sparse tree, if
+	// it's not the hash of an empty leaf
+	emptyLeafHasher func() trillian.Hash
 }
 
+// MaxHashPrefixLength is the longest domain separation prefix a TreeHasher may use.
+const MaxHashPrefixLength = 16
+
 // NewRFC6962TreeHasher creates a new TreeHasher based on the passed in hash function.
 // TODO(Martin2112): Move anything CT specific out of here to <handwave> look over there
 func NewRFC6962TreeHasher(hasher trillian.Hasher) TreeHasher {
+	th, err := NewTreeHasher(hasher, []byte{RFC6962LeafHashPrefix}, []byte{RFC6962NodeHashPrefix})
+	if err != nil {
+		// The RFC 6962 prefixes are always valid
+		panic(err)
+	}
+	return th
+}
+
+// NewTreeHasher creates a new TreeHasher based on the passed in hash function,
+// which prefixes leaf and node data with the given domain separation prefixes
+// before hashing it. This allows trees to be built which are compatible with
+// Merkle tree formats other than RFC 6962. The empty hash is the hash of no data.
+//
+// To keep leaf and node hashes apart the prefixes must be non-empty and neither
+// may be a prefix of the other. They can be at most MaxHashPrefixLength bytes.
+func NewTreeHasher(hasher trillian.Hasher, leafPrefix, nodePrefix []byte) (TreeHasher, error) {
+	if err := ValidateHashPrefixes(leafPrefix, nodePrefix); err != nil {
+		return TreeHasher{}, err
+	}
+
+	leafPrefix = append([]byte{}, leafPrefix...)
+	nodePrefix = append([]byte{}, nodePrefix...)
 	return TreeHasher{
 		Hasher:      hasher,
-		leafHasher:  rfc6962LeafHasher(hasher),
-		nodeHasher:  rfc6962NodeHasher(hasher),
+		scheme:      fmt.Sprintf("prefixed/%x/%x", leafPrefix, nodePrefix),
+		leafPrefix:  leafPrefix,
+		nodePrefix:  nodePrefix,
+		leafHasher:  prefixedHasher(hasher, leafPrefix),
+		nodeHasher:  prefixedHasher(hasher, nodePrefix),
 		emptyHasher: rfc6962EmptyHasher(hasher),
+	}, nil
+}
+
+// ValidateHashPrefixes checks that leafPrefix and nodePrefix can safely be used
+// as domain separation prefixes, see NewTreeHasher.
+func ValidateHashPrefixes(leafPrefix, nodePrefix []byte) error {
+	switch {
+	case len(leafPrefix) == 0 || len(nodePrefix) == 0:
+		return fmt.Errorf("hash prefixes must not be empty, got leaf prefix %x and node prefix %x", leafPrefix, nodePrefix)
+	case len(leafPrefix) > MaxHashPrefixLength || len(nodePrefix) > MaxHashPrefixLength:
+		return fmt.Errorf("hash prefixes must be at most %d bytes, got leaf prefix %x and node prefix %x", MaxHashPrefixLength, leafPrefix, nodePrefix)
+	case bytes.HasPrefix(leafPrefix, nodePrefix) || bytes.HasPrefix(nodePrefix, leafPrefix):
+		return fmt.Errorf("leaf prefix %x and node prefix %x must not be prefixes of each other", leafPrefix, nodePrefix)
 	}
+	return nil
 }
 
 // HashEmpty returns the hash of an empty element for the tree
@@ -49,6 +106,16 @@ func (t TreeHasher) HashEmpty() trillian.Hash {
 	return t.emptyHasher()
 }
 
+// HashEmptyLeaf returns the hash of an absent leaf of a sparse tree, which the
+// hashes of its empty branches are built up from. It's the hash of an empty
+// leaf, unless the hash strategy has its own empty branch hash.
+func (t TreeHasher) HashEmptyLeaf() trillian.Hash {
+	if t.emptyLeafHasher != nil {
+		return t.emptyLeafHasher()
+	}
+	return t.HashLeaf([]byte{})
+}
+
 // HashLeaf returns the merkle tree leaf hash of the data passed in through leaf.
 // The data in leaf is prefixed by the LeafHashPrefix.
 func (t TreeHasher) HashLeaf(leaf []byte) trillian.Hash {
@@ -61,6 +128,45 @@ func (t TreeHasher) HashChildren(l, r []byte) trillian.Hash {
 	return t.nodeHasher(append(append([]byte{}, l...), r...))
 }
 
+// HashLeaves returns the merkle tree leaf hash of each of the passed in leaves,
+// exactly as HashLeaf would. It's cheaper than calling HashLeaf for each one as
+// the underlying hash is set up once and the results share one allocation.
+func (t TreeHasher) HashLeaves(leaves [][]byte) []trillian.Hash {
+	return t.hashBatch(t.leafPrefix, len(leaves), func(h hash.Hash, i int) {
+		h.Write(leaves[i])
+	})
+}
+
+// HashChildrenBatch returns the inner merkle tree node hash of each pair of
+// children l[i] and r[i], exactly as HashChildren would. See HashLeaves.
+func (t TreeHasher) HashChildrenBatch(l, r [][]byte) ([]trillian.Hash, error) {
+	if len(l) != len(r) {
+		return nil, fmt.Errorf("got %d left children but %d right children", len(l), len(r))
+	}
+	return t.hashBatch(t.nodePrefix, len(l), func(h hash.Hash, i int) {
+		h.Write(l[i])
+		h.Write(r[i])
+	}), nil
+}
+
+// hashBatch returns n hashes, each of prefix followed by whatever write adds for
+// that index.
+func (t TreeHasher) hashBatch(prefix []byte, n int, write func(h hash.Hash, i int)) []trillian.Hash {
+	h := t.New()
+	out := make([]byte, 0, n*h.Size())
+	r := make([]trillian.Hash, n)
+	for i := 0; i < n; i++ {
+		h.Reset()
+		h.Write(prefix)
+		write(h, i)
+		start := len(out)
+		out = h.Sum(out)
+		// Limit the capacity so appending to one hash can't overwrite the next
+		r[i] = out[start:len(out):len(out)]
+	}
+	return r
+}
+
 type emptyHashFunc func() trillian.Hash
 type hashFunc func([]byte) trillian.Hash
 
@@ -71,16 +177,19 @@ func rfc6962EmptyHasher(h trillian.Hasher) emptyHashFunc {
 	}
 }
 
-// rfc6962LeafHasher builds a function to calculate leaf hashes based on the Hasher h for CT.
-func rfc6962LeafHasher(h trillian.Hasher) hashFunc {
+// prefixedHasher builds a function to calculate hashes of data with a domain
+// separation prefix, based on the Hasher h.
+func prefixedHasher(h trillian.Hasher, prefix []byte) hashFunc {
 	return func(b []byte) trillian.Hash {
-		return h.Digest(append([]byte{RFC6962LeafHashPrefix}, b...))
+		return h.Digest(append(append([]byte{}, prefix...), b...))
 	}
 }
 
-// rfc6962NodeHasher builds a function to calculate internal node hashes based on the Hasher h for CT.
-func rfc6962NodeHasher(h trillian.Hasher) hashFunc {
-	return func(b []byte) trillian.Hash {
-		return h.Digest(append([]byte{RFC6962NodeHashPrefix}, b...))
+// NewTreeHasherForPrefixes creates a TreeHasher using the domain separation
+// prefixes configured for a tree, or RFC 6962 hashing if it has none configured.
+func NewTreeHasherForPrefixes(hasher trillian.Hasher, prefixes storage.TreeHashPrefixes) (TreeHasher, error) {
+	if prefixes.IsDefault() {
+		return NewRFC6962TreeHasher(hasher), nil
 	}
+	return NewTreeHasher(hasher, prefixes.Leaf, prefixes.Node)
 }
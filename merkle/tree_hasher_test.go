@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
 	"github.com/google/trillian/testonly"
 )
 
@@ -30,3 +31,109 @@ func TestRfc6962Hasher(t *testing.T) {
 	ensureHashMatches(testonly.MustHexDecode(rfc6962LeafL123456HashHex), hasher.HashLeaf([]byte("L123456")), "RFC6962 Leaf", t)
 	ensureHashMatches(testonly.MustHexDecode(rfc6962NodeN123N456HashHex), hasher.HashChildren([]byte("N123"), []byte("N456")), "RFC6962 Node", t)
 }
+
+func TestHashLeavesMatchesHashLeaf(t *testing.T) {
+	hasher := NewRFC6962TreeHasher(trillian.NewSHA256())
+	leaves := [][]byte{[]byte("L123456"), {}, []byte("another leaf")}
+
+	hashes := hasher.HashLeaves(leaves)
+	if got, want := len(hashes), len(leaves); got != want {
+		t.Fatalf("Got %d hashes, want %d", got, want)
+	}
+	for i, leaf := range leaves {
+		ensureHashMatches(hasher.HashLeaf(leaf), hashes[i], "batch leaf", t)
+	}
+
+	// Appending to one hash must not disturb the next
+	_ = append(hashes[0], 0xff)
+	ensureHashMatches(hasher.HashLeaf(leaves[1]), hashes[1], "batch leaf after append", t)
+
+	if got := hasher.HashLeaves(nil); len(got) != 0 {
+		t.Fatalf("Got %d hashes for empty batch, want 0", len(got))
+	}
+}
+
+func TestHashChildrenBatchMatchesHashChildren(t *testing.T) {
+	hasher := NewRFC6962TreeHasher(trillian.NewSHA256())
+	l := [][]byte{[]byte("N123"), []byte("left")}
+	r := [][]byte{[]byte("N456"), []byte("right")}
+
+	hashes, err := hasher.HashChildrenBatch(l, r)
+	if err != nil {
+		t.Fatalf("HashChildrenBatch failed: %v", err)
+	}
+	ensureHashMatches(testonly.MustHexDecode(rfc6962NodeN123N456HashHex), hashes[0], "RFC6962 Node batch", t)
+	ensureHashMatches(hasher.HashChildren(l[1], r[1]), hashes[1], "batch node", t)
+
+	if _, err := hasher.HashChildrenBatch(l, r[:1]); err == nil {
+		t.Fatalf("Expected error for mismatched batch lengths")
+	}
+}
+
+func TestCustomPrefixHasher(t *testing.T) {
+	sha := trillian.NewSHA256()
+	hasher, err := NewTreeHasher(sha, []byte("leaf:"), []byte("node:"))
+	if err != nil {
+		t.Fatalf("NewTreeHasher failed: %v", err)
+	}
+
+	ensureHashMatches(testonly.MustHexDecode(rfc6962EmptyHashHex), hasher.HashEmpty(), "Custom Empty", t)
+	ensureHashMatches(sha.Digest([]byte("leaf:L123456")), hasher.HashLeaf([]byte("L123456")), "Custom Leaf", t)
+	ensureHashMatches(sha.Digest([]byte("node:N123N456")), hasher.HashChildren([]byte("N123"), []byte("N456")), "Custom Node", t)
+	ensureHashMatches(hasher.HashLeaf([]byte("L123456")), hasher.HashLeaves([][]byte{[]byte("L123456")})[0], "Custom Leaf batch", t)
+
+	rfc := NewRFC6962TreeHasher(sha)
+	if bytes.Equal(rfc.HashLeaf([]byte("L123456")), hasher.HashLeaf([]byte("L123456"))) {
+		t.Fatalf("Custom prefixes produced the RFC 6962 leaf hash")
+	}
+	emptyLeaf := hasher.HashLeaf([]byte{})
+	if got, want := EmptyHashesFor(hasher)[1], hasher.HashChildren(emptyLeaf, emptyLeaf); !bytes.Equal(got, want) {
+		t.Fatalf("Empty hashes not computed with custom prefixes, got %x, want %x", got, want)
+	}
+}
+
+func TestValidateHashPrefixes(t *testing.T) {
+	for _, test := range []struct {
+		leaf, node []byte
+		wantErr    bool
+	}{
+		{leaf: []byte{0}, node: []byte{1}},
+		{leaf: []byte("leaf"), node: []byte("node")},
+		{leaf: bytes.Repeat([]byte{1}, MaxHashPrefixLength), node: []byte{2}},
+		{leaf: nil, node: []byte{1}, wantErr: true},
+		{leaf: []byte{0}, node: []byte{}, wantErr: true},
+		{leaf: bytes.Repeat([]byte{1}, MaxHashPrefixLength+1), node: []byte{2}, wantErr: true},
+		{leaf: []byte{1}, node: []byte{1}, wantErr: true},
+		{leaf: []byte("ab"), node: []byte("abc"), wantErr: true},
+		{leaf: []byte("abc"), node: []byte("ab"), wantErr: true},
+	} {
+		err := ValidateHashPrefixes(test.leaf, test.node)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("ValidateHashPrefixes(%x, %x)=%v, want error: %v", test.leaf, test.node, err, test.wantErr)
+		}
+		if _, err := NewTreeHasher(trillian.NewSHA256(), test.leaf, test.node); (err != nil) != test.wantErr {
+			t.Errorf("NewTreeHasher(%x, %x)=%v, want error: %v", test.leaf, test.node, err, test.wantErr)
+		}
+	}
+}
+
+func TestNewTreeHasherForPrefixes(t *testing.T) {
+	sha := trillian.NewSHA256()
+
+	hasher, err := NewTreeHasherForPrefixes(sha, storage.TreeHashPrefixes{})
+	if err != nil {
+		t.Fatalf("NewTreeHasherForPrefixes failed for default prefixes: %v", err)
+	}
+	ensureHashMatches(testonly.MustHexDecode(rfc6962LeafL123456HashHex), hasher.HashLeaf([]byte("L123456")), "Default Leaf", t)
+
+	hasher, err = NewTreeHasherForPrefixes(sha, storage.TreeHashPrefixes{Leaf: []byte{0}, Node: []byte{1}})
+	if err != nil {
+		t.Fatalf("NewTreeHasherForPrefixes failed for explicit RFC 6962 prefixes: %v", err)
+	}
+	ensureHashMatches(testonly.MustHexDecode(rfc6962NodeN123N456HashHex), hasher.HashChildren([]byte("N123"), []byte("N456")), "Explicit Node", t)
+
+	// Only setting one of the prefixes is not allowed
+	if _, err := NewTreeHasherForPrefixes(sha, storage.TreeHashPrefixes{Leaf: []byte{0}}); err == nil {
+		t.Fatalf("Expected error when only the leaf prefix is set")
+	}
+}
@@ -30,6 +30,38 @@ func (_m *MockTrillianLogClient) EXPECT() *_MockTrillianLogClientRecorder {
 	return _m.recorder
 }
 
+func (_m *MockTrillianLogClient) AddLogRootCosignature(_param0 context.Context, _param1 *AddLogRootCosignatureRequest, _param2 ...grpc.CallOption) (*AddLogRootCosignatureResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "AddLogRootCosignature", _s...)
+	ret0, _ := ret[0].(*AddLogRootCosignatureResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogClientRecorder) AddLogRootCosignature(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AddLogRootCosignature", _s...)
+}
+
+func (_m *MockTrillianLogClient) AddSequencedLeaves(_param0 context.Context, _param1 *AddSequencedLeavesRequest, _param2 ...grpc.CallOption) (*AddSequencedLeavesResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "AddSequencedLeaves", _s...)
+	ret0, _ := ret[0].(*AddSequencedLeavesResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogClientRecorder) AddSequencedLeaves(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AddSequencedLeaves", _s...)
+}
+
 func (_m *MockTrillianLogClient) GetConsistencyProof(_param0 context.Context, _param1 *GetConsistencyProofRequest, _param2 ...grpc.CallOption) (*GetConsistencyProofResponse, error) {
 	_s := []interface{}{_param0, _param1}
 	for _, _x := range _param2 {
@@ -78,6 +110,22 @@ func (_mr *_MockTrillianLogClientRecorder) GetInclusionProof(arg0, arg1 interfac
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetInclusionProof", _s...)
 }
 
+func (_m *MockTrillianLogClient) GetInclusionProofBatch(_param0 context.Context, _param1 *GetInclusionProofBatchRequest, _param2 ...grpc.CallOption) (*GetInclusionProofBatchResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "GetInclusionProofBatch", _s...)
+	ret0, _ := ret[0].(*GetInclusionProofBatchResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogClientRecorder) GetInclusionProofBatch(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetInclusionProofBatch", _s...)
+}
+
 func (_m *MockTrillianLogClient) GetInclusionProofByHash(_param0 context.Context, _param1 *GetInclusionProofByHashRequest, _param2 ...grpc.CallOption) (*GetInclusionProofByHashResponse, error) {
 	_s := []interface{}{_param0, _param1}
 	for _, _x := range _param2 {
@@ -94,6 +142,22 @@ func (_mr *_MockTrillianLogClientRecorder) GetInclusionProofByHash(arg0, arg1 in
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetInclusionProofByHash", _s...)
 }
 
+func (_m *MockTrillianLogClient) GetLatestCheckpoint(_param0 context.Context, _param1 *GetLatestCheckpointRequest, _param2 ...grpc.CallOption) (*GetLatestCheckpointResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "GetLatestCheckpoint", _s...)
+	ret0, _ := ret[0].(*GetLatestCheckpointResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogClientRecorder) GetLatestCheckpoint(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLatestCheckpoint", _s...)
+}
+
 func (_m *MockTrillianLogClient) GetLatestSignedLogRoot(_param0 context.Context, _param1 *GetLatestSignedLogRootRequest, _param2 ...grpc.CallOption) (*GetLatestSignedLogRootResponse, error) {
 	_s := []interface{}{_param0, _param1}
 	for _, _x := range _param2 {
@@ -110,6 +174,22 @@ func (_mr *_MockTrillianLogClientRecorder) GetLatestSignedLogRoot(arg0, arg1 int
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLatestSignedLogRoot", _s...)
 }
 
+func (_m *MockTrillianLogClient) GetLeafIndexRangeByTime(_param0 context.Context, _param1 *GetLeafIndexRangeByTimeRequest, _param2 ...grpc.CallOption) (*GetLeafIndexRangeByTimeResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "GetLeafIndexRangeByTime", _s...)
+	ret0, _ := ret[0].(*GetLeafIndexRangeByTimeResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogClientRecorder) GetLeafIndexRangeByTime(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeafIndexRangeByTime", _s...)
+}
+
 func (_m *MockTrillianLogClient) GetLeavesByHash(_param0 context.Context, _param1 *GetLeavesByHashRequest, _param2 ...grpc.CallOption) (*GetLeavesByHashResponse, error) {
 	_s := []interface{}{_param0, _param1}
 	for _, _x := range _param2 {
@@ -142,6 +222,22 @@ func (_mr *_MockTrillianLogClientRecorder) GetLeavesByIndex(arg0, arg1 interface
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeavesByIndex", _s...)
 }
 
+func (_m *MockTrillianLogClient) GetLeavesByRange(_param0 context.Context, _param1 *GetLeavesByRangeRequest, _param2 ...grpc.CallOption) (TrillianLog_GetLeavesByRangeClient, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "GetLeavesByRange", _s...)
+	ret0, _ := ret[0].(TrillianLog_GetLeavesByRangeClient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogClientRecorder) GetLeavesByRange(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeavesByRange", _s...)
+}
+
 func (_m *MockTrillianLogClient) GetSequencedLeafCount(_param0 context.Context, _param1 *GetSequencedLeafCountRequest, _param2 ...grpc.CallOption) (*GetSequencedLeafCountResponse, error) {
 	_s := []interface{}{_param0, _param1}
 	for _, _x := range _param2 {
@@ -158,6 +254,38 @@ func (_mr *_MockTrillianLogClientRecorder) GetSequencedLeafCount(arg0, arg1 inte
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSequencedLeafCount", _s...)
 }
 
+func (_m *MockTrillianLogClient) GetTreeKeys(_param0 context.Context, _param1 *GetTreeKeysRequest, _param2 ...grpc.CallOption) (*GetTreeKeysResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "GetTreeKeys", _s...)
+	ret0, _ := ret[0].(*GetTreeKeysResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogClientRecorder) GetTreeKeys(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTreeKeys", _s...)
+}
+
+func (_m *MockTrillianLogClient) InitLog(_param0 context.Context, _param1 *InitLogRequest, _param2 ...grpc.CallOption) (*InitLogResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "InitLog", _s...)
+	ret0, _ := ret[0].(*InitLogResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogClientRecorder) InitLog(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "InitLog", _s...)
+}
+
 func (_m *MockTrillianLogClient) QueueLeaves(_param0 context.Context, _param1 *QueueLeavesRequest, _param2 ...grpc.CallOption) (*QueueLeavesResponse, error) {
 	_s := []interface{}{_param0, _param1}
 	for _, _x := range _param2 {
@@ -195,6 +323,28 @@ func (_m *MockTrillianLogServer) EXPECT() *_MockTrillianLogServerRecorder {
 	return _m.recorder
 }
 
+func (_m *MockTrillianLogServer) AddLogRootCosignature(_param0 context.Context, _param1 *AddLogRootCosignatureRequest) (*AddLogRootCosignatureResponse, error) {
+	ret := _m.ctrl.Call(_m, "AddLogRootCosignature", _param0, _param1)
+	ret0, _ := ret[0].(*AddLogRootCosignatureResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogServerRecorder) AddLogRootCosignature(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AddLogRootCosignature", arg0, arg1)
+}
+
+func (_m *MockTrillianLogServer) AddSequencedLeaves(_param0 context.Context, _param1 *AddSequencedLeavesRequest) (*AddSequencedLeavesResponse, error) {
+	ret := _m.ctrl.Call(_m, "AddSequencedLeaves", _param0, _param1)
+	ret0, _ := ret[0].(*AddSequencedLeavesResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogServerRecorder) AddSequencedLeaves(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AddSequencedLeaves", arg0, arg1)
+}
+
 func (_m *MockTrillianLogServer) GetConsistencyProof(_param0 context.Context, _param1 *GetConsistencyProofRequest) (*GetConsistencyProofResponse, error) {
 	ret := _m.ctrl.Call(_m, "GetConsistencyProof", _param0, _param1)
 	ret0, _ := ret[0].(*GetConsistencyProofResponse)
@@ -228,6 +378,17 @@ func (_mr *_MockTrillianLogServerRecorder) GetInclusionProof(arg0, arg1 interfac
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetInclusionProof", arg0, arg1)
 }
 
+func (_m *MockTrillianLogServer) GetInclusionProofBatch(_param0 context.Context, _param1 *GetInclusionProofBatchRequest) (*GetInclusionProofBatchResponse, error) {
+	ret := _m.ctrl.Call(_m, "GetInclusionProofBatch", _param0, _param1)
+	ret0, _ := ret[0].(*GetInclusionProofBatchResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogServerRecorder) GetInclusionProofBatch(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetInclusionProofBatch", arg0, arg1)
+}
+
 func (_m *MockTrillianLogServer) GetInclusionProofByHash(_param0 context.Context, _param1 *GetInclusionProofByHashRequest) (*GetInclusionProofByHashResponse, error) {
 	ret := _m.ctrl.Call(_m, "GetInclusionProofByHash", _param0, _param1)
 	ret0, _ := ret[0].(*GetInclusionProofByHashResponse)
@@ -239,6 +400,17 @@ func (_mr *_MockTrillianLogServerRecorder) GetInclusionProofByHash(arg0, arg1 in
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetInclusionProofByHash", arg0, arg1)
 }
 
+func (_m *MockTrillianLogServer) GetLatestCheckpoint(_param0 context.Context, _param1 *GetLatestCheckpointRequest) (*GetLatestCheckpointResponse, error) {
+	ret := _m.ctrl.Call(_m, "GetLatestCheckpoint", _param0, _param1)
+	ret0, _ := ret[0].(*GetLatestCheckpointResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogServerRecorder) GetLatestCheckpoint(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLatestCheckpoint", arg0, arg1)
+}
+
 func (_m *MockTrillianLogServer) GetLatestSignedLogRoot(_param0 context.Context, _param1 *GetLatestSignedLogRootRequest) (*GetLatestSignedLogRootResponse, error) {
 	ret := _m.ctrl.Call(_m, "GetLatestSignedLogRoot", _param0, _param1)
 	ret0, _ := ret[0].(*GetLatestSignedLogRootResponse)
@@ -250,6 +422,17 @@ func (_mr *_MockTrillianLogServerRecorder) GetLatestSignedLogRoot(arg0, arg1 int
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLatestSignedLogRoot", arg0, arg1)
 }
 
+func (_m *MockTrillianLogServer) GetLeafIndexRangeByTime(_param0 context.Context, _param1 *GetLeafIndexRangeByTimeRequest) (*GetLeafIndexRangeByTimeResponse, error) {
+	ret := _m.ctrl.Call(_m, "GetLeafIndexRangeByTime", _param0, _param1)
+	ret0, _ := ret[0].(*GetLeafIndexRangeByTimeResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogServerRecorder) GetLeafIndexRangeByTime(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeafIndexRangeByTime", arg0, arg1)
+}
+
 func (_m *MockTrillianLogServer) GetLeavesByHash(_param0 context.Context, _param1 *GetLeavesByHashRequest) (*GetLeavesByHashResponse, error) {
 	ret := _m.ctrl.Call(_m, "GetLeavesByHash", _param0, _param1)
 	ret0, _ := ret[0].(*GetLeavesByHashResponse)
@@ -272,6 +455,16 @@ func (_mr *_MockTrillianLogServerRecorder) GetLeavesByIndex(arg0, arg1 interface
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeavesByIndex", arg0, arg1)
 }
 
+func (_m *MockTrillianLogServer) GetLeavesByRange(_param0 *GetLeavesByRangeRequest, _param1 TrillianLog_GetLeavesByRangeServer) error {
+	ret := _m.ctrl.Call(_m, "GetLeavesByRange", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockTrillianLogServerRecorder) GetLeavesByRange(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeavesByRange", arg0, arg1)
+}
+
 func (_m *MockTrillianLogServer) GetSequencedLeafCount(_param0 context.Context, _param1 *GetSequencedLeafCountRequest) (*GetSequencedLeafCountResponse, error) {
 	ret := _m.ctrl.Call(_m, "GetSequencedLeafCount", _param0, _param1)
 	ret0, _ := ret[0].(*GetSequencedLeafCountResponse)
@@ -283,6 +476,28 @@ func (_mr *_MockTrillianLogServerRecorder) GetSequencedLeafCount(arg0, arg1 inte
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSequencedLeafCount", arg0, arg1)
 }
 
+func (_m *MockTrillianLogServer) GetTreeKeys(_param0 context.Context, _param1 *GetTreeKeysRequest) (*GetTreeKeysResponse, error) {
+	ret := _m.ctrl.Call(_m, "GetTreeKeys", _param0, _param1)
+	ret0, _ := ret[0].(*GetTreeKeysResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogServerRecorder) GetTreeKeys(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTreeKeys", arg0, arg1)
+}
+
+func (_m *MockTrillianLogServer) InitLog(_param0 context.Context, _param1 *InitLogRequest) (*InitLogResponse, error) {
+	ret := _m.ctrl.Call(_m, "InitLog", _param0, _param1)
+	ret0, _ := ret[0].(*InitLogResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogServerRecorder) InitLog(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "InitLog", arg0, arg1)
+}
+
 func (_m *MockTrillianLogServer) QueueLeaves(_param0 context.Context, _param1 *QueueLeavesRequest) (*QueueLeavesResponse, error) {
 	ret := _m.ctrl.Call(_m, "QueueLeaves", _param0, _param1)
 	ret0, _ := ret[0].(*QueueLeavesResponse)
@@ -315,6 +530,22 @@ func (_m *MockTrillianMapClient) EXPECT() *_MockTrillianMapClientRecorder {
 	return _m.recorder
 }
 
+func (_m *MockTrillianMapClient) AbandonMapRevision(_param0 context.Context, _param1 *AbandonMapRevisionRequest, _param2 ...grpc.CallOption) (*AbandonMapRevisionResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "AbandonMapRevision", _s...)
+	ret0, _ := ret[0].(*AbandonMapRevisionResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapClientRecorder) AbandonMapRevision(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AbandonMapRevision", _s...)
+}
+
 func (_m *MockTrillianMapClient) GetLeaves(_param0 context.Context, _param1 *GetMapLeavesRequest, _param2 ...grpc.CallOption) (*GetMapLeavesResponse, error) {
 	_s := []interface{}{_param0, _param1}
 	for _, _x := range _param2 {
@@ -331,6 +562,54 @@ func (_mr *_MockTrillianMapClientRecorder) GetLeaves(arg0, arg1 interface{}, arg
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeaves", _s...)
 }
 
+func (_m *MockTrillianMapClient) GetMapLeavesWithProof(_param0 context.Context, _param1 *GetMapLeavesRequest, _param2 ...grpc.CallOption) (*GetMapLeavesWithProofResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "GetMapLeavesWithProof", _s...)
+	ret0, _ := ret[0].(*GetMapLeavesWithProofResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapClientRecorder) GetMapLeavesWithProof(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMapLeavesWithProof", _s...)
+}
+
+func (_m *MockTrillianMapClient) GetMapRevisionTags(_param0 context.Context, _param1 *GetMapRevisionTagsRequest, _param2 ...grpc.CallOption) (*GetMapRevisionTagsResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "GetMapRevisionTags", _s...)
+	ret0, _ := ret[0].(*GetMapRevisionTagsResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapClientRecorder) GetMapRevisionTags(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMapRevisionTags", _s...)
+}
+
+func (_m *MockTrillianMapClient) GetMapUpdateProof(_param0 context.Context, _param1 *GetMapUpdateProofRequest, _param2 ...grpc.CallOption) (*GetMapUpdateProofResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "GetMapUpdateProof", _s...)
+	ret0, _ := ret[0].(*GetMapUpdateProofResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapClientRecorder) GetMapUpdateProof(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMapUpdateProof", _s...)
+}
+
 func (_m *MockTrillianMapClient) GetSignedMapRoot(_param0 context.Context, _param1 *GetSignedMapRootRequest, _param2 ...grpc.CallOption) (*GetSignedMapRootResponse, error) {
 	_s := []interface{}{_param0, _param1}
 	for _, _x := range _param2 {
@@ -347,6 +626,86 @@ func (_mr *_MockTrillianMapClientRecorder) GetSignedMapRoot(arg0, arg1 interface
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSignedMapRoot", _s...)
 }
 
+func (_m *MockTrillianMapClient) GetSignedMapRootByRevision(_param0 context.Context, _param1 *GetSignedMapRootByRevisionRequest, _param2 ...grpc.CallOption) (*GetSignedMapRootResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "GetSignedMapRootByRevision", _s...)
+	ret0, _ := ret[0].(*GetSignedMapRootResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapClientRecorder) GetSignedMapRootByRevision(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSignedMapRootByRevision", _s...)
+}
+
+func (_m *MockTrillianMapClient) GetTreeKeys(_param0 context.Context, _param1 *GetTreeKeysRequest, _param2 ...grpc.CallOption) (*GetTreeKeysResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "GetTreeKeys", _s...)
+	ret0, _ := ret[0].(*GetTreeKeysResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapClientRecorder) GetTreeKeys(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTreeKeys", _s...)
+}
+
+func (_m *MockTrillianMapClient) InitMap(_param0 context.Context, _param1 *InitMapRequest, _param2 ...grpc.CallOption) (*InitMapResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "InitMap", _s...)
+	ret0, _ := ret[0].(*InitMapResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapClientRecorder) InitMap(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "InitMap", _s...)
+}
+
+func (_m *MockTrillianMapClient) ListMapLeaves(_param0 context.Context, _param1 *ListMapLeavesRequest, _param2 ...grpc.CallOption) (TrillianMap_ListMapLeavesClient, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "ListMapLeaves", _s...)
+	ret0, _ := ret[0].(TrillianMap_ListMapLeavesClient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapClientRecorder) ListMapLeaves(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListMapLeaves", _s...)
+}
+
+func (_m *MockTrillianMapClient) PublishMapRevision(_param0 context.Context, _param1 *PublishMapRevisionRequest, _param2 ...grpc.CallOption) (*PublishMapRevisionResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "PublishMapRevision", _s...)
+	ret0, _ := ret[0].(*PublishMapRevisionResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapClientRecorder) PublishMapRevision(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "PublishMapRevision", _s...)
+}
+
 func (_m *MockTrillianMapClient) SetLeaves(_param0 context.Context, _param1 *SetMapLeavesRequest, _param2 ...grpc.CallOption) (*SetMapLeavesResponse, error) {
 	_s := []interface{}{_param0, _param1}
 	for _, _x := range _param2 {
@@ -363,6 +722,38 @@ func (_mr *_MockTrillianMapClientRecorder) SetLeaves(arg0, arg1 interface{}, arg
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetLeaves", _s...)
 }
 
+func (_m *MockTrillianMapClient) SetLeavesStream(_param0 context.Context, _param1 ...grpc.CallOption) (TrillianMap_SetLeavesStreamClient, error) {
+	_s := []interface{}{_param0}
+	for _, _x := range _param1 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "SetLeavesStream", _s...)
+	ret0, _ := ret[0].(TrillianMap_SetLeavesStreamClient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapClientRecorder) SetLeavesStream(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0}, arg1...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetLeavesStream", _s...)
+}
+
+func (_m *MockTrillianMapClient) TagMapRevision(_param0 context.Context, _param1 *TagMapRevisionRequest, _param2 ...grpc.CallOption) (*TagMapRevisionResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "TagMapRevision", _s...)
+	ret0, _ := ret[0].(*TagMapRevisionResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapClientRecorder) TagMapRevision(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "TagMapRevision", _s...)
+}
+
 // Mock of TrillianMapServer interface
 type MockTrillianMapServer struct {
 	ctrl     *gomock.Controller
@@ -384,6 +775,17 @@ func (_m *MockTrillianMapServer) EXPECT() *_MockTrillianMapServerRecorder {
 	return _m.recorder
 }
 
+func (_m *MockTrillianMapServer) AbandonMapRevision(_param0 context.Context, _param1 *AbandonMapRevisionRequest) (*AbandonMapRevisionResponse, error) {
+	ret := _m.ctrl.Call(_m, "AbandonMapRevision", _param0, _param1)
+	ret0, _ := ret[0].(*AbandonMapRevisionResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapServerRecorder) AbandonMapRevision(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AbandonMapRevision", arg0, arg1)
+}
+
 func (_m *MockTrillianMapServer) GetLeaves(_param0 context.Context, _param1 *GetMapLeavesRequest) (*GetMapLeavesResponse, error) {
 	ret := _m.ctrl.Call(_m, "GetLeaves", _param0, _param1)
 	ret0, _ := ret[0].(*GetMapLeavesResponse)
@@ -395,6 +797,39 @@ func (_mr *_MockTrillianMapServerRecorder) GetLeaves(arg0, arg1 interface{}) *go
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeaves", arg0, arg1)
 }
 
+func (_m *MockTrillianMapServer) GetMapLeavesWithProof(_param0 context.Context, _param1 *GetMapLeavesRequest) (*GetMapLeavesWithProofResponse, error) {
+	ret := _m.ctrl.Call(_m, "GetMapLeavesWithProof", _param0, _param1)
+	ret0, _ := ret[0].(*GetMapLeavesWithProofResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapServerRecorder) GetMapLeavesWithProof(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMapLeavesWithProof", arg0, arg1)
+}
+
+func (_m *MockTrillianMapServer) GetMapRevisionTags(_param0 context.Context, _param1 *GetMapRevisionTagsRequest) (*GetMapRevisionTagsResponse, error) {
+	ret := _m.ctrl.Call(_m, "GetMapRevisionTags", _param0, _param1)
+	ret0, _ := ret[0].(*GetMapRevisionTagsResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapServerRecorder) GetMapRevisionTags(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMapRevisionTags", arg0, arg1)
+}
+
+func (_m *MockTrillianMapServer) GetMapUpdateProof(_param0 context.Context, _param1 *GetMapUpdateProofRequest) (*GetMapUpdateProofResponse, error) {
+	ret := _m.ctrl.Call(_m, "GetMapUpdateProof", _param0, _param1)
+	ret0, _ := ret[0].(*GetMapUpdateProofResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapServerRecorder) GetMapUpdateProof(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMapUpdateProof", arg0, arg1)
+}
+
 func (_m *MockTrillianMapServer) GetSignedMapRoot(_param0 context.Context, _param1 *GetSignedMapRootRequest) (*GetSignedMapRootResponse, error) {
 	ret := _m.ctrl.Call(_m, "GetSignedMapRoot", _param0, _param1)
 	ret0, _ := ret[0].(*GetSignedMapRootResponse)
@@ -406,6 +841,60 @@ func (_mr *_MockTrillianMapServerRecorder) GetSignedMapRoot(arg0, arg1 interface
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSignedMapRoot", arg0, arg1)
 }
 
+func (_m *MockTrillianMapServer) GetSignedMapRootByRevision(_param0 context.Context, _param1 *GetSignedMapRootByRevisionRequest) (*GetSignedMapRootResponse, error) {
+	ret := _m.ctrl.Call(_m, "GetSignedMapRootByRevision", _param0, _param1)
+	ret0, _ := ret[0].(*GetSignedMapRootResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapServerRecorder) GetSignedMapRootByRevision(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSignedMapRootByRevision", arg0, arg1)
+}
+
+func (_m *MockTrillianMapServer) GetTreeKeys(_param0 context.Context, _param1 *GetTreeKeysRequest) (*GetTreeKeysResponse, error) {
+	ret := _m.ctrl.Call(_m, "GetTreeKeys", _param0, _param1)
+	ret0, _ := ret[0].(*GetTreeKeysResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapServerRecorder) GetTreeKeys(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTreeKeys", arg0, arg1)
+}
+
+func (_m *MockTrillianMapServer) InitMap(_param0 context.Context, _param1 *InitMapRequest) (*InitMapResponse, error) {
+	ret := _m.ctrl.Call(_m, "InitMap", _param0, _param1)
+	ret0, _ := ret[0].(*InitMapResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapServerRecorder) InitMap(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "InitMap", arg0, arg1)
+}
+
+func (_m *MockTrillianMapServer) ListMapLeaves(_param0 *ListMapLeavesRequest, _param1 TrillianMap_ListMapLeavesServer) error {
+	ret := _m.ctrl.Call(_m, "ListMapLeaves", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockTrillianMapServerRecorder) ListMapLeaves(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListMapLeaves", arg0, arg1)
+}
+
+func (_m *MockTrillianMapServer) PublishMapRevision(_param0 context.Context, _param1 *PublishMapRevisionRequest) (*PublishMapRevisionResponse, error) {
+	ret := _m.ctrl.Call(_m, "PublishMapRevision", _param0, _param1)
+	ret0, _ := ret[0].(*PublishMapRevisionResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapServerRecorder) PublishMapRevision(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "PublishMapRevision", arg0, arg1)
+}
+
 func (_m *MockTrillianMapServer) SetLeaves(_param0 context.Context, _param1 *SetMapLeavesRequest) (*SetMapLeavesResponse, error) {
 	ret := _m.ctrl.Call(_m, "SetLeaves", _param0, _param1)
 	ret0, _ := ret[0].(*SetMapLeavesResponse)
@@ -416,3 +905,24 @@ func (_m *MockTrillianMapServer) SetLeaves(_param0 context.Context, _param1 *Set
 func (_mr *_MockTrillianMapServerRecorder) SetLeaves(arg0, arg1 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetLeaves", arg0, arg1)
 }
+
+func (_m *MockTrillianMapServer) SetLeavesStream(_param0 TrillianMap_SetLeavesStreamServer) error {
+	ret := _m.ctrl.Call(_m, "SetLeavesStream", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockTrillianMapServerRecorder) SetLeavesStream(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetLeavesStream", arg0)
+}
+
+func (_m *MockTrillianMapServer) TagMapRevision(_param0 context.Context, _param1 *TagMapRevisionRequest) (*TagMapRevisionResponse, error) {
+	ret := _m.ctrl.Call(_m, "TagMapRevision", _param0, _param1)
+	ret0, _ := ret[0].(*TagMapRevisionResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianMapServerRecorder) TagMapRevision(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "TagMapRevision", arg0, arg1)
+}
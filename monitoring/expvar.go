@@ -0,0 +1,67 @@
+package monitoring
+
+import (
+	"expvar"
+)
+
+// ExpvarMetricFactory creates metrics which are published with expvar, so they
+// can be read from /debug/vars on the server's HTTP port. Metric names must be
+// unique within the process, as expvar can only publish a name once.
+type ExpvarMetricFactory struct {
+	// Prefix is added to the name of every metric.
+	Prefix string
+}
+
+// NewCounter creates a new Counter published with expvar.
+func (f ExpvarMetricFactory) NewCounter(name, help string, labelNames ...string) Counter {
+	c := newInertFloat(name, labelNames)
+	f.publish(name, labelNames, c.snapshot)
+	return c
+}
+
+// NewGauge creates a new Gauge published with expvar.
+func (f ExpvarMetricFactory) NewGauge(name, help string, labelNames ...string) Gauge {
+	g := newInertFloat(name, labelNames)
+	f.publish(name, labelNames, g.snapshot)
+	return g
+}
+
+// NewHistogram creates a new Histogram published with expvar. The count and sum
+// of the observations are published.
+func (f ExpvarMetricFactory) NewHistogram(name, help string, labelNames ...string) Histogram {
+	h := newInertHistogram(name, labelNames)
+	f.publish(name, labelNames, h.snapshot)
+	return h
+}
+
+// publish publishes the values returned by snapshot, which are keyed by label
+// values. A metric without labels is published as its single value.
+func (f ExpvarMetricFactory) publish(name string, labelNames []string, snapshot func() map[string]interface{}) {
+	expvar.Publish(f.Prefix+name, expvar.Func(func() interface{} {
+		vals := snapshot()
+		if len(labelNames) == 0 {
+			return vals[""]
+		}
+		return vals
+	}))
+}
+
+func (f *inertFloat) snapshot() map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	vals := make(map[string]interface{}, len(f.vals))
+	for k, v := range f.vals {
+		vals[k] = v
+	}
+	return vals
+}
+
+func (h *inertHistogram) snapshot() map[string]interface{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	vals := make(map[string]interface{}, len(h.counts))
+	for k, count := range h.counts {
+		vals[k] = map[string]interface{}{"count": count, "sum": h.sums[k]}
+	}
+	return vals
+}
@@ -0,0 +1,117 @@
+package monitoring
+
+import (
+	"sync"
+)
+
+// InertMetricFactory creates metrics which are only held in memory. Their values
+// can be read back, so they are useful in tests and when no monitoring system
+// has been set up.
+type InertMetricFactory struct{}
+
+// NewCounter creates a new inert Counter.
+func (InertMetricFactory) NewCounter(name, help string, labelNames ...string) Counter {
+	return newInertFloat(name, labelNames)
+}
+
+// NewGauge creates a new inert Gauge.
+func (InertMetricFactory) NewGauge(name, help string, labelNames ...string) Gauge {
+	return newInertFloat(name, labelNames)
+}
+
+// NewHistogram creates a new inert Histogram.
+func (InertMetricFactory) NewHistogram(name, help string, labelNames ...string) Histogram {
+	return newInertHistogram(name, labelNames)
+}
+
+// inertFloat is a Counter or Gauge held in memory.
+type inertFloat struct {
+	name       string
+	labelNames []string
+	mu         sync.Mutex
+	vals       map[string]float64
+}
+
+func newInertFloat(name string, labelNames []string) *inertFloat {
+	return &inertFloat{name: name, labelNames: labelNames, vals: make(map[string]float64)}
+}
+
+func (f *inertFloat) Inc(labelVals ...string) {
+	f.Add(1, labelVals...)
+}
+
+func (f *inertFloat) Dec(labelVals ...string) {
+	f.Add(-1, labelVals...)
+}
+
+func (f *inertFloat) Add(val float64, labelVals ...string) {
+	f.update(labelVals, func(v float64) float64 { return v + val })
+}
+
+func (f *inertFloat) Set(val float64, labelVals ...string) {
+	f.update(labelVals, func(float64) float64 { return val })
+}
+
+// update replaces the value for labelVals with the result of fn, returning the
+// new value.
+func (f *inertFloat) update(labelVals []string, fn func(float64) float64) (float64, bool) {
+	key, ok := labelKey(f.name, f.labelNames, labelVals)
+	if !ok {
+		return 0, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.vals[key] = fn(f.vals[key])
+	return f.vals[key], true
+}
+
+func (f *inertFloat) Value(labelVals ...string) float64 {
+	key, ok := labelKey(f.name, f.labelNames, labelVals)
+	if !ok {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.vals[key]
+}
+
+// inertHistogram is a Histogram held in memory. Only the count and sum of the
+// observations are kept.
+type inertHistogram struct {
+	name       string
+	labelNames []string
+	mu         sync.Mutex
+	counts     map[string]uint64
+	sums       map[string]float64
+}
+
+func newInertHistogram(name string, labelNames []string) *inertHistogram {
+	return &inertHistogram{name: name, labelNames: labelNames, counts: make(map[string]uint64), sums: make(map[string]float64)}
+}
+
+func (h *inertHistogram) Observe(val float64, labelVals ...string) {
+	h.observe(val, labelVals)
+}
+
+// observe records val, returning false if the label values were invalid.
+func (h *inertHistogram) observe(val float64, labelVals []string) bool {
+	key, ok := labelKey(h.name, h.labelNames, labelVals)
+	if !ok {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[key]++
+	h.sums[key] += val
+	return true
+}
+
+func (h *inertHistogram) Info(labelVals ...string) (uint64, float64) {
+	key, ok := labelKey(h.name, h.labelNames, labelVals)
+	if !ok {
+		return 0, 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.counts[key], h.sums[key]
+}
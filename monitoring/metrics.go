@@ -0,0 +1,93 @@
+package monitoring
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// Counter is a metric whose value only goes up, kept separately for each set
+// of label values.
+type Counter interface {
+	// Inc adds 1 to the counter for labelVals.
+	Inc(labelVals ...string)
+	// Add adds val, which must not be negative, to the counter for labelVals.
+	Add(val float64, labelVals ...string)
+	// Value returns the counter's value for labelVals.
+	Value(labelVals ...string) float64
+}
+
+// Gauge is a metric whose value can go up and down, kept separately for each
+// set of label values.
+type Gauge interface {
+	// Inc adds 1 to the gauge for labelVals.
+	Inc(labelVals ...string)
+	// Dec subtracts 1 from the gauge for labelVals.
+	Dec(labelVals ...string)
+	// Add adds val to the gauge for labelVals.
+	Add(val float64, labelVals ...string)
+	// Set sets the gauge for labelVals to val.
+	Set(val float64, labelVals ...string)
+	// Value returns the gauge's value for labelVals.
+	Value(labelVals ...string) float64
+}
+
+// Histogram records the distribution of observed values, kept separately for
+// each set of label values.
+type Histogram interface {
+	// Observe records val for labelVals.
+	Observe(val float64, labelVals ...string)
+	// Info returns the number and sum of the values observed for labelVals.
+	Info(labelVals ...string) (uint64, float64)
+}
+
+// MetricFactory creates metrics in a particular monitoring system. Every
+// update to a metric must give one value for each of the label names it was
+// created with, updates that don't are logged and dropped.
+type MetricFactory interface {
+	NewCounter(name, help string, labelNames ...string) Counter
+	NewGauge(name, help string, labelNames ...string) Gauge
+	NewHistogram(name, help string, labelNames ...string) Histogram
+}
+
+// Names of the metrics backends accepted by NewMetricFactory.
+const (
+	InertBackend  = ""
+	ExpvarBackend = "expvar"
+	StatsdBackend = "statsd"
+	// PrometheusBackend metrics are served on /metrics of the default HTTP mux
+	PrometheusBackend = "prometheus"
+)
+
+// NewMetricFactory returns the factory for the named backend, for selecting one
+// by flag. Names are prefixed with prefix, and statsd metrics are sent to
+// statsdAddress.
+func NewMetricFactory(backend, prefix, statsdAddress string) (MetricFactory, error) {
+	switch backend {
+	case InertBackend:
+		return InertMetricFactory{}, nil
+	case ExpvarBackend:
+		return ExpvarMetricFactory{Prefix: prefix}, nil
+	case StatsdBackend:
+		return NewStatsdMetricFactory(statsdAddress, prefix)
+	case PrometheusBackend:
+		registerPrometheusHandler.Do(func() {
+			http.Handle("/metrics", DefaultPrometheusRegistry)
+		})
+		return PrometheusMetricFactory{Prefix: prefix, Registry: DefaultPrometheusRegistry}, nil
+	}
+	return nil, fmt.Errorf("unknown metrics backend %q", backend)
+}
+
+// labelKey returns the key under which the values of a metric for labelVals are
+// kept. ok is false, and an error logged, if the wrong number of label values
+// are given.
+func labelKey(name string, labelNames, labelVals []string) (key string, ok bool) {
+	if len(labelVals) != len(labelNames) {
+		glog.Errorf("Metric %s has labels %v but got values %v, dropping update", name, labelNames, labelVals)
+		return "", false
+	}
+	return strings.Join(labelVals, ","), true
+}
@@ -0,0 +1,192 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+func TestInertMetrics(t *testing.T) {
+	mf := InertMetricFactory{}
+	c := mf.NewCounter("counter", "help", "method")
+	c.Inc("get")
+	c.Add(2, "get")
+	c.Inc("set")
+	// Updates with the wrong number of labels are dropped
+	c.Inc()
+	c.Inc("get", "extra")
+	if got, want := c.Value("get"), 3.0; got != want {
+		t.Errorf("Counter value for get = %v, want %v", got, want)
+	}
+	if got, want := c.Value("set"), 1.0; got != want {
+		t.Errorf("Counter value for set = %v, want %v", got, want)
+	}
+
+	g := mf.NewGauge("gauge", "help")
+	g.Set(5)
+	g.Inc()
+	g.Dec()
+	g.Dec()
+	g.Add(0.5)
+	if got, want := g.Value(), 4.5; got != want {
+		t.Errorf("Gauge value = %v, want %v", got, want)
+	}
+
+	h := mf.NewHistogram("histogram", "help", "method", "result")
+	h.Observe(10, "get", "ok")
+	h.Observe(30, "get", "ok")
+	h.Observe(5, "get", "error")
+	if count, sum := h.Info("get", "ok"); count != 2 || sum != 40 {
+		t.Errorf("Histogram info = %d, %v, want 2, 40", count, sum)
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	mf := ExpvarMetricFactory{Prefix: "test_expvar_"}
+	c := mf.NewCounter("counter", "help", "method")
+	c.Add(3, "get")
+	g := mf.NewGauge("gauge", "help")
+	g.Set(7)
+	h := mf.NewHistogram("histogram", "help", "method")
+	h.Observe(12, "get")
+
+	for _, test := range []struct {
+		name string
+		want string
+	}{
+		{name: "test_expvar_counter", want: `{"get":3}`},
+		{name: "test_expvar_gauge", want: `7`},
+		{name: "test_expvar_histogram", want: `{"get":{"count":1,"sum":12}}`},
+	} {
+		v := expvar.Get(test.name)
+		if v == nil {
+			t.Errorf("%s not published", test.name)
+			continue
+		}
+		var got, want interface{}
+		if err := json.Unmarshal([]byte(v.String()), &got); err != nil {
+			t.Errorf("%s published invalid JSON %s: %v", test.name, v, err)
+		}
+		json.Unmarshal([]byte(test.want), &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s published %s, want %s", test.name, v, test.want)
+		}
+	}
+}
+
+// recordingWriter keeps each write, which would be a datagram to statsd.
+type recordingWriter struct {
+	writes []string
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func TestStatsdMetrics(t *testing.T) {
+	w := &recordingWriter{}
+	mf := newStatsdMetricFactory(w, "trillian.")
+	c := mf.NewCounter("requests", "help", "method")
+	c.Inc("/trillian.TrillianLog/QueueLeaves")
+	c.Add(2, "/trillian.TrillianLog/QueueLeaves")
+	g := mf.NewGauge("queued", "help")
+	g.Set(5)
+	g.Dec()
+	h := mf.NewHistogram("latency", "help", "method")
+	h.Observe(12.5, "get")
+	// Dropped as the labels are wrong
+	h.Observe(1)
+
+	want := []string{
+		"trillian.requests._trillian_TrillianLog_QueueLeaves:1|c",
+		"trillian.requests._trillian_TrillianLog_QueueLeaves:2|c",
+		"trillian.queued:5|g",
+		"trillian.queued:4|g",
+		"trillian.latency.get:12.5|ms",
+	}
+	if !reflect.DeepEqual(w.writes, want) {
+		t.Errorf("Sent %q, want %q", w.writes, want)
+	}
+	if got, want := c.Value("/trillian.TrillianLog/QueueLeaves"), 3.0; got != want {
+		t.Errorf("Counter value = %v, want %v", got, want)
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	r := NewPrometheusRegistry()
+	mf := PrometheusMetricFactory{Prefix: "test_", Registry: r}
+	c := mf.NewCounter("requests", "Number of requests", "method")
+	c.Inc("get")
+	c.Add(2, "get")
+	c.Inc(`say "hi"`)
+	g := mf.NewGauge("queue.depth", "Requests waiting")
+	g.Set(3)
+	h := mf.NewHistogram("latency_ms", "Latency", "method")
+	h.Observe(1.5, "get")
+	h.Observe(15, "get")
+	h.Observe(1e6, "get")
+	if count, sum := h.Info("get"); count != 3 || sum != 1000016.5 {
+		t.Errorf("Histogram info = %d, %v, want 3, 1000016.5", count, sum)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, nil)
+	got := w.Body.String()
+	for _, want := range []string{
+		"# HELP test_requests Number of requests\n# TYPE test_requests counter\n",
+		"test_requests{method=\"get\"} 3\n",
+		`test_requests{method="say \"hi\""} 1` + "\n",
+		"# TYPE test_queue_depth gauge\ntest_queue_depth 3\n",
+		"# TYPE test_latency_ms histogram\n",
+		"test_latency_ms_bucket{method=\"get\",le=\"1\"} 0\n",
+		"test_latency_ms_bucket{method=\"get\",le=\"2\"} 1\n",
+		"test_latency_ms_bucket{method=\"get\",le=\"20\"} 2\n",
+		"test_latency_ms_bucket{method=\"get\",le=\"100000\"} 2\n",
+		"test_latency_ms_bucket{method=\"get\",le=\"+Inf\"} 3\n",
+		"test_latency_ms_sum{method=\"get\"} 1.0000165e+06\n",
+		"test_latency_ms_count{method=\"get\"} 3\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Prometheus metrics don't contain %q, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestNewMetricFactory(t *testing.T) {
+	for _, backend := range []string{InertBackend, ExpvarBackend, PrometheusBackend} {
+		if _, err := NewMetricFactory(backend, "", ""); err != nil {
+			t.Errorf("NewMetricFactory(%q) failed: %v", backend, err)
+		}
+	}
+	if _, err := NewMetricFactory("carrier-pigeon", "", ""); err == nil {
+		t.Errorf("NewMetricFactory with unknown backend succeeded")
+	}
+}
+
+func TestRPCStatsInterceptorReportsMetrics(t *testing.T) {
+	ts := util.IncrementingFakeTimeSource{BaseTime: fakeTime, Increments: []time.Duration{0, time.Millisecond * 500}}
+	stats := NewRPCStatsInterceptorWithMetrics(&ts, "test", "test", InertMetricFactory{})
+	handler := recordingUnaryHandler{resp: "OK"}
+	if _, err := stats.Interceptor()(context.Background(), "wibble", &grpc.UnaryServerInfo{FullMethod: "testmethod"}, handler.handler()); err != nil {
+		t.Fatalf("request handler returned an error unexpectedly: %v", err)
+	}
+
+	if got, want := stats.requests.count.Value("testmethod"), 1.0; got != want {
+		t.Errorf("Got request count %v, want %v", got, want)
+	}
+	if got, want := stats.requests.errors.Value("testmethod"), 0.0; got != want {
+		t.Errorf("Got error count %v, want %v", got, want)
+	}
+	if count, sum := stats.requests.latency.Info("testmethod", "ok"); count != 1 || sum != 500 {
+		t.Errorf("Got latency count %d and sum %v, want 1 and 500", count, sum)
+	}
+}
@@ -0,0 +1,269 @@
+package monitoring
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// DefaultPrometheusBuckets are the upper bounds of the buckets of Prometheus
+// histograms. They're spread out enough to cover latencies in milliseconds as
+// well as counts such as batch sizes.
+var DefaultPrometheusBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000, 20000, 50000, 100000}
+
+// PrometheusRegistry serves the metrics created by PrometheusMetricFactory in
+// the Prometheus text format, for a Prometheus server to scrape.
+type PrometheusRegistry struct {
+	mu      sync.Mutex
+	metrics map[string]prometheusMetric
+}
+
+// prometheusMetric is a metric that can be written in the text format.
+type prometheusMetric interface {
+	write(w io.Writer)
+}
+
+// NewPrometheusRegistry creates an empty PrometheusRegistry.
+func NewPrometheusRegistry() *PrometheusRegistry {
+	return &PrometheusRegistry{metrics: make(map[string]prometheusMetric)}
+}
+
+// DefaultPrometheusRegistry holds the metrics created through NewMetricFactory,
+// and is served on /metrics of the default HTTP mux.
+var DefaultPrometheusRegistry = NewPrometheusRegistry()
+
+var registerPrometheusHandler sync.Once
+
+// register adds m under name. A name can only be registered once, later
+// metrics with the same name are logged and not served.
+func (r *PrometheusRegistry) register(name string, m prometheusMetric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		glog.Errorf("Prometheus metric %s already registered, not serving the new one", name)
+		return
+	}
+	r.metrics[name] = m
+}
+
+// ServeHTTP writes every metric, ordered by name.
+func (r *PrometheusRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make(map[string]prometheusMetric, len(r.metrics))
+	for name, m := range r.metrics {
+		metrics[name] = m
+	}
+	r.mu.Unlock()
+
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		metrics[name].write(bw)
+	}
+	if err := bw.Flush(); err != nil {
+		glog.Warningf("Failed to write Prometheus metrics: %v", err)
+	}
+}
+
+// PrometheusMetricFactory creates metrics which are served by a
+// PrometheusRegistry.
+type PrometheusMetricFactory struct {
+	// Prefix is added to the name of every metric.
+	Prefix string
+	// Registry serves the metrics.
+	Registry *PrometheusRegistry
+}
+
+// NewCounter creates a new Counter served to Prometheus.
+func (f PrometheusMetricFactory) NewCounter(name, help string, labelNames ...string) Counter {
+	c := &prometheusFloat{desc: f.describe(name, help, "counter", labelNames), inertFloat: newInertFloat(name, labelNames), labels: make(map[string][]string)}
+	f.Registry.register(c.desc.name, c)
+	return c
+}
+
+// NewGauge creates a new Gauge served to Prometheus.
+func (f PrometheusMetricFactory) NewGauge(name, help string, labelNames ...string) Gauge {
+	g := &prometheusFloat{desc: f.describe(name, help, "gauge", labelNames), inertFloat: newInertFloat(name, labelNames), labels: make(map[string][]string)}
+	f.Registry.register(g.desc.name, g)
+	return g
+}
+
+// NewHistogram creates a new Histogram served to Prometheus, with
+// DefaultPrometheusBuckets.
+func (f PrometheusMetricFactory) NewHistogram(name, help string, labelNames ...string) Histogram {
+	h := &prometheusHistogram{desc: f.describe(name, help, "histogram", labelNames), inertHistogram: newInertHistogram(name, labelNames), labels: make(map[string][]string), buckets: make(map[string][]uint64)}
+	f.Registry.register(h.desc.name, h)
+	return h
+}
+
+// prometheusDesc is the description of a metric written before its values.
+type prometheusDesc struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+}
+
+func (f PrometheusMetricFactory) describe(name, help, kind string, labelNames []string) prometheusDesc {
+	names := make([]string, len(labelNames))
+	for i, l := range labelNames {
+		names[i] = prometheusName(l)
+	}
+	return prometheusDesc{name: prometheusName(f.Prefix + name), help: help, kind: kind, labelNames: names}
+}
+
+// writeHeader writes the HELP and TYPE lines of the metric.
+func (d prometheusDesc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+// labelPairs returns the labels of a sample for labelVals, followed by extra
+// which is already formatted.
+func (d prometheusDesc) labelPairs(labelVals []string, extra string) string {
+	var pairs []string
+	for i, v := range labelVals {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, d.labelNames[i], prometheusLabelReplacer.Replace(v)))
+	}
+	if len(extra) > 0 {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var prometheusLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusName replaces the characters that aren't allowed in Prometheus
+// metric and label names with underscores.
+func prometheusName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// formatFloat formats v as Prometheus expects, including infinities.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// prometheusFloat is a Counter or Gauge. The label values are kept separately
+// from the inert metric's keys, as they may contain the separator.
+type prometheusFloat struct {
+	*inertFloat
+	desc   prometheusDesc
+	labels map[string][]string
+}
+
+func (f *prometheusFloat) Inc(labelVals ...string) {
+	f.Add(1, labelVals...)
+}
+
+func (f *prometheusFloat) Dec(labelVals ...string) {
+	f.Add(-1, labelVals...)
+}
+
+func (f *prometheusFloat) Add(val float64, labelVals ...string) {
+	f.updateLabels(labelVals, func(v float64) float64 { return v + val })
+}
+
+func (f *prometheusFloat) Set(val float64, labelVals ...string) {
+	f.updateLabels(labelVals, func(float64) float64 { return val })
+}
+
+func (f *prometheusFloat) updateLabels(labelVals []string, fn func(float64) float64) {
+	f.update(labelVals, func(v float64) float64 {
+		key, _ := labelKey(f.name, f.labelNames, labelVals)
+		if _, ok := f.labels[key]; !ok {
+			f.labels[key] = append([]string(nil), labelVals...)
+		}
+		return fn(v)
+	})
+}
+
+func (f *prometheusFloat) write(w io.Writer) {
+	f.desc.writeHeader(w)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range sortedKeys(f.labels) {
+		fmt.Fprintf(w, "%s%s %s\n", f.desc.name, f.desc.labelPairs(f.labels[key], ""), formatFloat(f.vals[key]))
+	}
+}
+
+// prometheusHistogram counts the observations in each of
+// DefaultPrometheusBuckets, as well as their count and sum.
+type prometheusHistogram struct {
+	*inertHistogram
+	desc    prometheusDesc
+	labels  map[string][]string
+	buckets map[string][]uint64
+}
+
+func (h *prometheusHistogram) Observe(val float64, labelVals ...string) {
+	if !h.observe(val, labelVals) {
+		return
+	}
+	key, _ := labelKey(h.name, h.labelNames, labelVals)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.labels[key]; !ok {
+		h.labels[key] = append([]string(nil), labelVals...)
+		h.buckets[key] = make([]uint64, len(DefaultPrometheusBuckets))
+	}
+	if i := sort.SearchFloat64s(DefaultPrometheusBuckets, val); i < len(DefaultPrometheusBuckets) {
+		h.buckets[key][i]++
+	}
+}
+
+func (h *prometheusHistogram) write(w io.Writer) {
+	h.desc.writeHeader(w)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.labels) {
+		labelVals := h.labels[key]
+		// Prometheus buckets are cumulative
+		var cumulative uint64
+		for i, bound := range DefaultPrometheusBuckets {
+			cumulative += h.buckets[key][i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.desc.name, h.desc.labelPairs(labelVals, fmt.Sprintf(`le="%s"`, formatFloat(bound))), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.desc.name, h.desc.labelPairs(labelVals, `le="+Inf"`), h.counts[key])
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.desc.name, h.desc.labelPairs(labelVals, ""), formatFloat(h.sums[key]))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.desc.name, h.desc.labelPairs(labelVals, ""), h.counts[key])
+	}
+}
+
+// sortedKeys returns the keys of labels in order, so that samples are written
+// in the same order each time.
+func sortedKeys(labels map[string][]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
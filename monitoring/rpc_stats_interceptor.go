@@ -29,12 +29,34 @@ type RPCStatsInterceptor struct {
 	handlerRequestErrorCountMap       *expvar.Map
 	handlerRequestSucceededLatencyMap *expvar.Map
 	handlerRequestFailedLatencyMap    *expvar.Map
+	// The same stats, reported to the MetricFactory the interceptor was created with
+	requests *requestMetrics
+}
+
+// requestMetrics are the metrics the interceptor reports to a MetricFactory.
+type requestMetrics struct {
+	count   Counter
+	errors  Counter
+	latency Histogram
 }
 
 // NewRPCStatsInterceptor creates a new RPCStatsInterceptor for the given application/component, with
 // a specified time source.
 func NewRPCStatsInterceptor(timeSource util.TimeSource, application, component string) *RPCStatsInterceptor {
+	return NewRPCStatsInterceptorWithMetrics(timeSource, application, component, InertMetricFactory{})
+}
+
+// NewRPCStatsInterceptorWithMetrics creates a new RPCStatsInterceptor like
+// NewRPCStatsInterceptor, which also reports the statistics to metrics created
+// by mf. The metrics are named after application and component.
+func NewRPCStatsInterceptorWithMetrics(timeSource util.TimeSource, application, component string, mf MetricFactory) *RPCStatsInterceptor {
+	prefix := fmt.Sprintf("%s_%s_", application, component)
 	return &RPCStatsInterceptor{baseName: fmt.Sprintf("%s/%s", application, component), timeSource: timeSource,
+		requests: &requestMetrics{
+			count:   mf.NewCounter(prefix+"rpc_requests", "Number of requests received by method", "method"),
+			errors:  mf.NewCounter(prefix+"rpc_errors", "Number of requests that failed by method", "method"),
+			latency: mf.NewHistogram(prefix+"rpc_latency_ms", "Latency of requests in milliseconds by method and result", "method", "result"),
+		},
 		handlerRequestCountMap:            new(expvar.Map).Init(),
 		handlerRequestSucceededCountMap:   new(expvar.Map).Init(),
 		handlerRequestErrorCountMap:       new(expvar.Map).Init(),
@@ -60,6 +82,8 @@ func (r RPCStatsInterceptor) recordFailureLatency(method string, startTime time.
 	latency := r.timeSource.Now().Sub(startTime)
 	r.handlerRequestErrorCountMap.Add(method, 1)
 	r.handlerRequestFailedLatencyMap.Add(method, latency.Nanoseconds()/nanosToMillisDivisor)
+	r.requests.errors.Inc(method)
+	r.requests.latency.Observe(float64(latency.Nanoseconds()/nanosToMillisDivisor), method, "error")
 }
 
 // Interceptor returns a UnaryServerInterceptor that can be registered with an RPC server and
@@ -70,6 +94,7 @@ func (r RPCStatsInterceptor) Interceptor() grpc.UnaryServerInterceptor {
 
 		// Increase the request count for the method and start the clock
 		r.handlerRequestCountMap.Add(method, 1)
+		r.requests.count.Inc(method)
 		startTime := r.timeSource.Now()
 
 		defer func() {
@@ -91,6 +116,7 @@ func (r RPCStatsInterceptor) Interceptor() grpc.UnaryServerInterceptor {
 
 			r.handlerRequestSucceededCountMap.Add(method, 1)
 			r.handlerRequestSucceededLatencyMap.Add(method, latency.Nanoseconds()/nanosToMillisDivisor)
+			r.requests.latency.Observe(float64(latency.Nanoseconds()/nanosToMillisDivisor), method, "ok")
 		}
 
 		// Pass the result of the handler invocation back
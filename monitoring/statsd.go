@@ -0,0 +1,128 @@
+package monitoring
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// StatsdMetricFactory creates metrics which push every update to a statsd
+// server over UDP, for servers which can't be scraped. Label values are
+// appended to the metric name, as statsd has no labels. Gauges are sent as
+// their new value after each update.
+type StatsdMetricFactory struct {
+	prefix string
+	mu     *sync.Mutex
+	w      io.Writer
+}
+
+// NewStatsdMetricFactory creates a factory for metrics sent to the statsd server
+// at address. prefix is added to the name of every metric.
+func NewStatsdMetricFactory(address, prefix string) (StatsdMetricFactory, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return StatsdMetricFactory{}, err
+	}
+	return newStatsdMetricFactory(conn, prefix), nil
+}
+
+// newStatsdMetricFactory creates a factory which writes the statsd protocol
+// to w.
+func newStatsdMetricFactory(w io.Writer, prefix string) StatsdMetricFactory {
+	return StatsdMetricFactory{prefix: prefix, mu: &sync.Mutex{}, w: w}
+}
+
+// statsdNameReplacer replaces the characters that have a meaning in the statsd
+// protocol, or separate the parts of a name.
+var statsdNameReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", ".", "_", "/", "_", " ", "_")
+
+// send writes a single update for the named metric with labelVals.
+func (f StatsdMetricFactory) send(name string, labelVals []string, val interface{}, kind string) {
+	parts := []string{f.prefix + name}
+	for _, v := range labelVals {
+		parts = append(parts, statsdNameReplacer.Replace(v))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := fmt.Fprintf(f.w, "%s:%v|%s", strings.Join(parts, "."), val, kind); err != nil {
+		glog.Warningf("Failed to send metric %s to statsd: %v", name, err)
+	}
+}
+
+// NewCounter creates a new Counter sent to statsd.
+func (f StatsdMetricFactory) NewCounter(name, help string, labelNames ...string) Counter {
+	return &statsdCounter{f: f, inertFloat: newInertFloat(name, labelNames)}
+}
+
+// NewGauge creates a new Gauge sent to statsd.
+func (f StatsdMetricFactory) NewGauge(name, help string, labelNames ...string) Gauge {
+	return &statsdGauge{f: f, inertFloat: newInertFloat(name, labelNames)}
+}
+
+// NewHistogram creates a new Histogram sent to statsd as timer values, from
+// which statsd calculates percentiles.
+func (f StatsdMetricFactory) NewHistogram(name, help string, labelNames ...string) Histogram {
+	return &statsdHistogram{f: f, inertHistogram: newInertHistogram(name, labelNames)}
+}
+
+// statsdCounter keeps its value in memory too, so that it can be read back.
+type statsdCounter struct {
+	*inertFloat
+	f StatsdMetricFactory
+}
+
+func (c *statsdCounter) Inc(labelVals ...string) {
+	c.Add(1, labelVals...)
+}
+
+func (c *statsdCounter) Add(val float64, labelVals ...string) {
+	if _, ok := c.update(labelVals, func(v float64) float64 { return v + val }); ok {
+		c.f.send(c.name, labelVals, val, "c")
+	}
+}
+
+type statsdGauge struct {
+	*inertFloat
+	f StatsdMetricFactory
+}
+
+func (g *statsdGauge) Inc(labelVals ...string) {
+	g.Add(1, labelVals...)
+}
+
+func (g *statsdGauge) Dec(labelVals ...string) {
+	g.Add(-1, labelVals...)
+}
+
+func (g *statsdGauge) Add(val float64, labelVals ...string) {
+	g.updateAndSend(labelVals, func(v float64) float64 { return v + val })
+}
+
+func (g *statsdGauge) Set(val float64, labelVals ...string) {
+	g.updateAndSend(labelVals, func(float64) float64 { return val })
+}
+
+// updateAndSend sends the new value while the gauge is locked, so that
+// concurrent updates arrive in the order they were made.
+func (g *statsdGauge) updateAndSend(labelVals []string, fn func(float64) float64) {
+	g.update(labelVals, func(v float64) float64 {
+		v = fn(v)
+		g.f.send(g.name, labelVals, v, "g")
+		return v
+	})
+}
+
+type statsdHistogram struct {
+	*inertHistogram
+	f StatsdMetricFactory
+}
+
+func (h *statsdHistogram) Observe(val float64, labelVals ...string) {
+	if h.observe(val, labelVals) {
+		h.f.send(h.name, labelVals, val, "ms")
+	}
+}
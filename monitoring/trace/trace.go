@@ -0,0 +1,406 @@
+// Package trace records spans, the timed steps of handling a request, so that
+// a slow request can be followed from the RPC that started it through to the
+// storage operations it caused. Spans are passed down in a context, or set on
+// storage transactions, which don't take one.
+//
+// Traces are carried across RPCs in the TraceKey metadata, which the client
+// interceptors set from the span in the context of each call, so that the
+// spans of the server handling it join the client's trace. HTTP clients of the
+// gateway can set it with a Grpc-Metadata-X-Trillian-Trace header.
+//
+// Every method of Span can be called on a nil Span, which does nothing, so code
+// doesn't need to check whether it's being traced.
+package trace
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// TraceKey is the metadata key of the trace and span IDs of the client span an
+// RPC was made in, in hex and separated by a colon.
+const TraceKey = "x-trillian-trace"
+
+// pendingTTL is how long a LogExporter holds the spans of a trace whose root
+// hasn't finished.
+const pendingTTL = 10 * time.Minute
+
+// SpanData is the record of a finished span.
+type SpanData struct {
+	// TraceID is shared by every span started for the same request
+	TraceID uint64
+	// SpanID identifies the span within its trace
+	SpanID uint64
+	// ParentID is the span ID of the span's parent, or zero for the root span
+	ParentID uint64
+	// RemoteParent is set if the parent is a span of the client of the RPC
+	// the span was started for, so the span is the root of this server's
+	// part of the trace
+	RemoteParent bool
+	Name         string
+	Start        time.Time
+	End          time.Time
+	Tags         map[string]string
+}
+
+// Exporter receives spans as they finish.
+type Exporter interface {
+	ExportSpan(s SpanData)
+}
+
+// Tracer starts root spans, whose descendants are sent to its exporter when
+// they finish.
+type Tracer struct {
+	exporter Exporter
+
+	// Must hold this lock before using rand
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewTracer creates a Tracer which sends finished spans to exporter.
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// newID returns a random non-zero ID.
+func (t *Tracer) newID() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for {
+		if id := uint64(t.rand.Int63()); id != 0 {
+			return id
+		}
+	}
+}
+
+// StartSpan starts the root span of a new trace. A nil Tracer returns a nil
+// Span, so tracing can be turned off by not creating one.
+func (t *Tracer) StartSpan(name string) *Span {
+	if t == nil {
+		return nil
+	}
+	return &Span{tracer: t, data: SpanData{TraceID: t.newID(), SpanID: t.newID(), Name: name, Start: time.Now()}}
+}
+
+// startServerSpan starts the span of an RPC received in ctx. It's a child of
+// the client's span if that's given in ctx's TraceKey metadata, otherwise the
+// root of a new trace.
+func (t *Tracer) startServerSpan(ctx context.Context, name string) *Span {
+	if t == nil {
+		return nil
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md[TraceKey]) == 1 {
+		if traceID, parentID, ok := parseTraceKey(md[TraceKey][0]); ok {
+			return &Span{tracer: t, data: SpanData{TraceID: traceID, SpanID: t.newID(), ParentID: parentID, RemoteParent: true, Name: name, Start: time.Now()}}
+		}
+	}
+	return t.StartSpan(name)
+}
+
+// parseTraceKey parses the value of TraceKey metadata.
+func parseTraceKey(v string) (uint64, uint64, bool) {
+	parts := strings.Split(v, ":")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	traceID, err := strconv.ParseUint(parts[0], 16, 64)
+	if err != nil || traceID == 0 {
+		return 0, 0, false
+	}
+	spanID, err := strconv.ParseUint(parts[1], 16, 64)
+	if err != nil || spanID == 0 {
+		return 0, 0, false
+	}
+	return traceID, spanID, true
+}
+
+// Span is a step in handling a request, which is in progress until Finish is
+// called.
+type Span struct {
+	tracer *Tracer
+
+	// Must hold this lock before accessing data
+	mu   sync.Mutex
+	data SpanData
+}
+
+// StartChild starts a span for a step taken as part of s.
+func (s *Span) StartChild(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	return &Span{tracer: s.tracer, data: SpanData{TraceID: s.data.TraceID, SpanID: s.tracer.newID(), ParentID: s.data.SpanID, Name: name, Start: time.Now()}}
+}
+
+// SetTag records a value describing the span, such as the tree it was for.
+func (s *Span) SetTag(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Tags == nil {
+		s.data.Tags = make(map[string]string)
+	}
+	s.data.Tags[key] = fmt.Sprint(value)
+}
+
+// SetError tags the span with err, if it's not nil.
+func (s *Span) SetError(err error) {
+	if err != nil {
+		s.SetTag("error", err)
+	}
+}
+
+// Finish ends the span and exports it. Only the first call has any effect.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.data.End.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	s.tracer.exporter.ExportSpan(data)
+}
+
+type spanKey struct{}
+
+// NewContext returns a context holding s, so that the code it's passed to can
+// add child spans.
+func NewContext(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// FromContext returns the span held by ctx, or nil if it's not being traced.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// StartSpanFromContext starts a child of the span in ctx, and returns it along
+// with a context holding it. If ctx isn't being traced the span is nil.
+func StartSpanFromContext(ctx context.Context, name string) (*Span, context.Context) {
+	s := FromContext(ctx).StartChild(name)
+	if s == nil {
+		return nil, ctx
+	}
+	return s, NewContext(ctx, s)
+}
+
+// SpanSetter is implemented by storage transactions that record spans for
+// their operations. The spans are children of the one set.
+type SpanSetter interface {
+	SetSpan(s *Span)
+}
+
+// SetSpan sets the parent span of tx's operations, if it records them and s
+// isn't nil.
+func SetSpan(tx interface{}, s *Span) {
+	if setter, ok := tx.(SpanSetter); ok && s != nil {
+		setter.SetSpan(s)
+	}
+}
+
+// UnaryInterceptor returns a UnaryServerInterceptor which starts a span for
+// each request, named after its method, and passes it to the handler in its
+// context. The span continues the client's trace if it sent one.
+func (t *Tracer) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		s := t.startServerSpan(ctx, info.FullMethod)
+		defer s.Finish()
+		resp, err := handler(NewContext(ctx, s), req)
+		s.SetError(err)
+		return resp, err
+	}
+}
+
+// StreamInterceptor returns a StreamServerInterceptor which starts a span for
+// each stream, like UnaryInterceptor.
+func (t *Tracer) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		s := t.startServerSpan(stream.Context(), info.FullMethod)
+		defer s.Finish()
+		err := handler(srv, &tracedStream{ServerStream: stream, ctx: NewContext(stream.Context(), s)})
+		s.SetError(err)
+		return err
+	}
+}
+
+// tracedStream is a stream whose context holds its root span.
+type tracedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedStream) Context() context.Context {
+	return s.ctx
+}
+
+// outgoingContext returns ctx with the span it holds, if any, in the TraceKey
+// metadata of the calls made with it.
+func outgoingContext(ctx context.Context) context.Context {
+	s := FromContext(ctx)
+	if s == nil {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, TraceKey, fmt.Sprintf("%x:%x", s.data.TraceID, s.data.SpanID))
+}
+
+// UnaryClientInterceptor returns a UnaryClientInterceptor which sends the span
+// in the context of each call to the server, so that the server's spans join
+// its trace.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoingContext(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor returns a StreamClientInterceptor which sends the
+// span in the context of each stream to the server, like
+// UnaryClientInterceptor.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoingContext(ctx), desc, cc, method, opts...)
+	}
+}
+
+// LogExporter logs each trace that took at least a threshold once its root
+// span finishes, with its spans in the order they started and indented under
+// their parents. The root is the first span of the trace started by this
+// server, whose parent, if any, is the client's. Spans that finish after their
+// root, or whose root never finishes, are dropped after pendingTTL.
+type LogExporter struct {
+	threshold  time.Duration
+	timeSource util.TimeSource
+
+	// Must hold this lock before accessing the fields below
+	mu sync.Mutex
+	// pending holds the finished spans of each trace whose root is in progress
+	pending   map[uint64]*pendingTrace
+	lastSweep time.Time
+}
+
+// pendingTrace is the finished spans of a trace, and when the first of them
+// was exported.
+type pendingTrace struct {
+	spans []SpanData
+	added time.Time
+}
+
+// NewLogExporter creates a LogExporter for traces taking at least threshold.
+func NewLogExporter(threshold time.Duration) *LogExporter {
+	return &LogExporter{threshold: threshold, timeSource: util.SystemTimeSource{}, pending: make(map[uint64]*pendingTrace)}
+}
+
+// ExportSpan holds s until its root finishes.
+func (e *LogExporter) ExportSpan(s SpanData) {
+	e.mu.Lock()
+	now := e.timeSource.Now()
+	if now.Sub(e.lastSweep) >= pendingTTL {
+		for id, p := range e.pending {
+			if now.Sub(p.added) >= pendingTTL {
+				delete(e.pending, id)
+			}
+		}
+		e.lastSweep = now
+	}
+	if s.ParentID != 0 && !s.RemoteParent {
+		p, ok := e.pending[s.TraceID]
+		if !ok {
+			p = &pendingTrace{added: now}
+			e.pending[s.TraceID] = p
+		}
+		p.spans = append(p.spans, s)
+		e.mu.Unlock()
+		return
+	}
+	var spans []SpanData
+	if p, ok := e.pending[s.TraceID]; ok {
+		spans = p.spans
+	}
+	spans = append(spans, s)
+	delete(e.pending, s.TraceID)
+	e.mu.Unlock()
+
+	if s.End.Sub(s.Start) >= e.threshold {
+		glog.Infof("Trace %x:\n%s", s.TraceID, FormatTrace(spans))
+	}
+}
+
+// FormatTrace returns the spans of a trace with one line for each, ordered by
+// start time and indented under their parents. Each line gives the span's
+// name, when it started relative to the root, how long it took and its tags.
+func FormatTrace(spans []SpanData) string {
+	children := make(map[uint64][]SpanData)
+	var roots []SpanData
+	ids := make(map[uint64]bool)
+	for _, s := range spans {
+		ids[s.SpanID] = true
+	}
+	for _, s := range spans {
+		if s.ParentID == 0 || !ids[s.ParentID] {
+			roots = append(roots, s)
+		} else {
+			children[s.ParentID] = append(children[s.ParentID], s)
+		}
+	}
+	if len(roots) == 0 {
+		return ""
+	}
+	sort.Sort(byStart(roots))
+	start := roots[0].Start
+
+	var lines []string
+	var add func(s SpanData, depth int)
+	add = func(s SpanData, depth int) {
+		lines = append(lines, fmt.Sprintf("%s%s +%v %v%s", strings.Repeat("  ", depth), s.Name, s.Start.Sub(start), s.End.Sub(s.Start), formatTags(s.Tags)))
+		kids := children[s.SpanID]
+		sort.Sort(byStart(kids))
+		for _, c := range kids {
+			add(c, depth+1)
+		}
+	}
+	for _, r := range roots {
+		add(r, 0)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatTags returns the tags as " key=value" pairs, ordered by key.
+func formatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%s", k, tags[k])
+	}
+	return b.String()
+}
+
+// byStart orders spans by the time they started.
+type byStart []SpanData
+
+func (s byStart) Len() int           { return len(s) }
+func (s byStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byStart) Less(i, j int) bool { return s[i].Start.Before(s[j].Start) }
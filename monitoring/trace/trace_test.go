@@ -0,0 +1,224 @@
+package trace
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// recordingExporter keeps every span exported to it.
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *recordingExporter) ExportSpan(s SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+// spanTX records the span set on it, like a storage transaction.
+type spanTX struct {
+	span *Span
+}
+
+func (t *spanTX) SetSpan(s *Span) {
+	t.span = s
+}
+
+func TestSpans(t *testing.T) {
+	e := &recordingExporter{}
+	tracer := NewTracer(e)
+
+	root := tracer.StartSpan("root")
+	root.SetTag("tree_id", 5)
+	child := root.StartChild("child")
+	child.SetError(errors.New("failed"))
+	child.Finish()
+	root.Finish()
+	// Only the first Finish counts
+	root.Finish()
+
+	if got, want := len(e.spans), 2; got != want {
+		t.Fatalf("got %d spans, want %d", got, want)
+	}
+	c, r := e.spans[0], e.spans[1]
+	if r.ParentID != 0 || r.Name != "root" {
+		t.Errorf("got root span %+v, want root with no parent", r)
+	}
+	if c.TraceID != r.TraceID || c.ParentID != r.SpanID || c.SpanID == r.SpanID {
+		t.Errorf("got child span %+v of root %+v, want child in the same trace", c, r)
+	}
+	if got, want := r.Tags["tree_id"], "5"; got != want {
+		t.Errorf("got tree_id tag %q, want %q", got, want)
+	}
+	if got, want := c.Tags["error"], "failed"; got != want {
+		t.Errorf("got error tag %q, want %q", got, want)
+	}
+	if r.End.Before(r.Start) {
+		t.Errorf("root ended at %v, before it started at %v", r.End, r.Start)
+	}
+}
+
+func TestNilSpans(t *testing.T) {
+	var tracer *Tracer
+	s := tracer.StartSpan("root")
+	if s != nil {
+		t.Fatalf("nil tracer started span %+v", s)
+	}
+	// None of these may panic
+	s.SetTag("tree_id", 1)
+	s.SetError(errors.New("failed"))
+	s.StartChild("child").Finish()
+	s.Finish()
+
+	tx := &spanTX{}
+	SetSpan(tx, s)
+	if tx.span != nil {
+		t.Errorf("nil span set on transaction")
+	}
+	if s, ctx := StartSpanFromContext(context.Background(), "child"); s != nil || FromContext(ctx) != nil {
+		t.Errorf("untraced context started span %+v", s)
+	}
+}
+
+func TestContext(t *testing.T) {
+	e := &recordingExporter{}
+	root := NewTracer(e).StartSpan("root")
+	ctx := NewContext(context.Background(), root)
+	if got := FromContext(ctx); got != root {
+		t.Fatalf("FromContext()=%p, want %p", got, root)
+	}
+
+	child, childCtx := StartSpanFromContext(ctx, "child")
+	if got := FromContext(childCtx); got != child {
+		t.Errorf("FromContext(child)=%p, want %p", got, child)
+	}
+
+	tx := &spanTX{}
+	SetSpan(tx, child)
+	if tx.span != child {
+		t.Errorf("transaction span not set")
+	}
+	// Types without SetSpan are ignored
+	SetSpan(struct{}{}, child)
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	e := &recordingExporter{}
+	tracer := NewTracer(e)
+	info := &grpc.UnaryServerInfo{FullMethod: "/trillian.TrillianLog/QueueLeaves"}
+	wantErr := errors.New("failed")
+
+	_, err := tracer.UnaryInterceptor()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		s, _ := StartSpanFromContext(ctx, "storage")
+		s.Finish()
+		return nil, wantErr
+	})
+	if err != wantErr {
+		t.Fatalf("got error %v, want %v", err, wantErr)
+	}
+
+	if got, want := len(e.spans), 2; got != want {
+		t.Fatalf("got %d spans, want %d", got, want)
+	}
+	if got, want := e.spans[1].Name, info.FullMethod; got != want {
+		t.Errorf("got root span %q, want %q", got, want)
+	}
+	if got, want := e.spans[0].ParentID, e.spans[1].SpanID; got != want {
+		t.Errorf("got storage span parent %x, want %x", got, want)
+	}
+	if got, want := e.spans[1].Tags["error"], "failed"; got != want {
+		t.Errorf("got error tag %q, want %q", got, want)
+	}
+}
+
+func TestFormatTrace(t *testing.T) {
+	start := time.Unix(1000, 0)
+	spans := []SpanData{
+		{TraceID: 1, SpanID: 3, ParentID: 2, Name: "commit", Start: start.Add(3 * time.Millisecond), End: start.Add(4 * time.Millisecond)},
+		{TraceID: 1, SpanID: 4, ParentID: 2, Name: "read", Start: start.Add(time.Millisecond), End: start.Add(2 * time.Millisecond), Tags: map[string]string{"tree_id": "5", "revision": "7"}},
+		{TraceID: 1, SpanID: 2, Name: "rpc", Start: start, End: start.Add(5 * time.Millisecond)},
+	}
+
+	want := strings.Join([]string{
+		"rpc +0s 5ms",
+		"  read +1ms 1ms revision=7 tree_id=5",
+		"  commit +3ms 1ms",
+	}, "\n")
+	if got := FormatTrace(spans); got != want {
+		t.Errorf("FormatTrace()=\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLogExporter(t *testing.T) {
+	e := NewLogExporter(time.Hour)
+	ts := &util.FakeTimeSource{FakeTime: time.Unix(1000, 0)}
+	e.timeSource = ts
+	e.ExportSpan(SpanData{TraceID: 1, SpanID: 3, ParentID: 2, Name: "child"})
+	if got, want := len(e.pending[1].spans), 1; got != want {
+		t.Fatalf("got %d pending spans, want %d", got, want)
+	}
+	// The trace is dropped once its root finishes, even if it isn't logged
+	e.ExportSpan(SpanData{TraceID: 1, SpanID: 2, Name: "root"})
+	if len(e.pending) != 0 {
+		t.Errorf("got pending spans %v after root finished", e.pending)
+	}
+
+	// A span whose parent is the client's is the root
+	e.ExportSpan(SpanData{TraceID: 2, SpanID: 5, ParentID: 4, RemoteParent: true, Name: "rpc"})
+	if len(e.pending) != 0 {
+		t.Errorf("got pending spans %v after remote child finished", e.pending)
+	}
+
+	// Spans that finish after their root are dropped after pendingTTL
+	e.ExportSpan(SpanData{TraceID: 1, SpanID: 6, ParentID: 2, Name: "late"})
+	ts.FakeTime = ts.FakeTime.Add(pendingTTL / 2)
+	e.ExportSpan(SpanData{TraceID: 3, SpanID: 8, ParentID: 7, Name: "child"})
+	ts.FakeTime = ts.FakeTime.Add(pendingTTL / 2)
+	e.ExportSpan(SpanData{TraceID: 4, SpanID: 10, ParentID: 9, Name: "child"})
+	if _, ok := e.pending[1]; ok {
+		t.Errorf("late span still pending after %v", pendingTTL)
+	}
+	if _, ok := e.pending[3]; !ok {
+		t.Errorf("span pending for %v was dropped", pendingTTL/2)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	e := &recordingExporter{}
+	client := NewTracer(e).StartSpan("client")
+	var md metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	if err := UnaryClientInterceptor()(NewContext(context.Background(), client), "/trillian.TrillianLog/GetLeavesByIndex", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("UnaryClientInterceptor() failed: %v", err)
+	}
+
+	server := NewTracer(e)
+	info := &grpc.UnaryServerInfo{FullMethod: "/trillian.TrillianLog/GetLeavesByIndex"}
+	if _, err := server.UnaryInterceptor()(metadata.NewIncomingContext(context.Background(), md), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("UnaryInterceptor() failed: %v", err)
+	}
+	client.Finish()
+
+	if got, want := len(e.spans), 2; got != want {
+		t.Fatalf("got %d spans, want %d", got, want)
+	}
+	s, c := e.spans[0], e.spans[1]
+	if s.TraceID != c.TraceID || s.ParentID != c.SpanID || !s.RemoteParent {
+		t.Errorf("got server span %+v of client %+v, want remote child in the same trace", s, c)
+	}
+}
@@ -0,0 +1,171 @@
+// Package quota limits the load that clients can put on the servers, charging
+// each request tokens in proportion to the work it's estimated to cause.
+package quota
+
+import (
+	"github.com/google/trillian"
+)
+
+const (
+	// mapDepth is the depth of a map, which has a leaf for every SHA-256 key
+	// hash. Costs are estimated without looking the map up, so maps with longer
+	// key hashes are charged as if they were this deep
+	mapDepth = 256
+	// mapSubtreesPerPath is the number of subtrees read for a path from the map
+	// root to a leaf, given the default map strata
+	mapSubtreesPerPath = 11
+	// logStratumDepth is the depth of each log subtree
+	logStratumDepth = 8
+)
+
+// Cost is an estimate of the work a request causes, made before it's handled.
+type Cost struct {
+	// KeyHashes is the number of map keys hashed
+	KeyHashes int64
+	// ProofNodes is the number of nodes in the proofs returned
+	ProofNodes int64
+	// LeafBytes is the number of bytes of leaf data written, reads aren't
+	// included as their size isn't known in advance
+	LeafBytes int64
+	// SubtreeReads is the number of subtrees read from storage
+	SubtreeReads int64
+	// LeafReads is the number of leaves read from storage
+	LeafReads int64
+}
+
+// Add returns the sum of c and o.
+func (c Cost) Add(o Cost) Cost {
+	return Cost{
+		KeyHashes:    c.KeyHashes + o.KeyHashes,
+		ProofNodes:   c.ProofNodes + o.ProofNodes,
+		LeafBytes:    c.LeafBytes + o.LeafBytes,
+		SubtreeReads: c.SubtreeReads + o.SubtreeReads,
+		LeafReads:    c.LeafReads + o.LeafReads,
+	}
+}
+
+// CostModel sets the number of tokens charged for each part of a Cost.
+type CostModel struct {
+	PerRequest     int64
+	PerKeyHash     int64
+	PerProofNode   int64
+	PerLeafKB      int64
+	PerSubtreeRead int64
+	PerLeafRead    int64
+}
+
+// DefaultCostModel charges mostly for storage reads and proofs, so a request for
+// many keys or leaves costs about the same as the same number of requests for
+// one each.
+var DefaultCostModel = CostModel{
+	PerRequest:     1,
+	PerKeyHash:     1,
+	PerProofNode:   1,
+	PerLeafKB:      8,
+	PerSubtreeRead: 8,
+	PerLeafRead:    8,
+}
+
+// Tokens returns the number of tokens charged for a request of cost c.
+func (m CostModel) Tokens(c Cost) int64 {
+	// Leaf data is charged for each KB or part of one
+	leafKB := (c.LeafBytes + 1023) / 1024
+	return m.PerRequest + m.PerKeyHash*c.KeyHashes + m.PerProofNode*c.ProofNodes + m.PerLeafKB*leafKB + m.PerSubtreeRead*c.SubtreeReads + m.PerLeafRead*c.LeafReads
+}
+
+// logProofCost is the cost of proofs for count leaves in a log of treeSize leaves.
+func logProofCost(treeSize, count int64) Cost {
+	depth := int64(0)
+	for size := int64(1); size < treeSize; size <<= 1 {
+		depth++
+	}
+	subtrees := (depth + logStratumDepth - 1) / logStratumDepth
+	return Cost{ProofNodes: depth * count, SubtreeReads: subtrees * count}
+}
+
+// leafCost is the cost of queueing leaf.
+func leafCost(leaf *trillian.LeafProto) Cost {
+	return Cost{LeafBytes: int64(len(leaf.LeafData) + len(leaf.ExtraData))}
+}
+
+// mapProofCost is the cost of looking up count keys in a map, with their proofs.
+func mapProofCost(count int64) Cost {
+	return Cost{KeyHashes: count, ProofNodes: mapDepth * count, SubtreeReads: mapSubtreesPerPath * count}
+}
+
+// batchTokens returns the number of tokens charged for a batch of a streamed
+// response of cost c. The flat charge was made for the request.
+func (m CostModel) batchTokens(c Cost) int64 {
+	if c == (Cost{}) {
+		return 0
+	}
+	return m.Tokens(c) - m.PerRequest
+}
+
+// ResponseCost returns the cost of the leaves in resp, one of the batches of a
+// streamed response, which are read as the stream is sent. Other responses
+// cost nothing, as their cost was estimated from the request.
+func ResponseCost(resp interface{}) Cost {
+	switch resp := resp.(type) {
+	case *trillian.GetLeavesByRangeResponse:
+		return Cost{LeafReads: int64(len(resp.Leaves))}
+	case *trillian.ListMapLeavesResponse:
+		return Cost{LeafReads: int64(len(resp.Leaves))}
+	}
+	return Cost{}
+}
+
+// EstimateCost returns the estimated cost of handling req, which is one of the
+// log or map API requests. Requests of other types have no cost beyond the flat
+// charge for each request.
+func EstimateCost(req interface{}) Cost {
+	switch req := req.(type) {
+	case *trillian.QueueLeavesRequest:
+		var c Cost
+		for _, leaf := range req.Leaves {
+			c = c.Add(leafCost(leaf))
+		}
+		return c
+	case *trillian.AddSequencedLeavesRequest:
+		var c Cost
+		for _, leaf := range req.Leaves {
+			c = c.Add(leafCost(leaf))
+		}
+		return c
+	case *trillian.GetInclusionProofRequest:
+		return logProofCost(req.TreeSize, 1)
+	case *trillian.GetInclusionProofBatchRequest:
+		// Nodes shared between the proofs are only read once, so this is the most
+		// it costs
+		return logProofCost(req.TreeSize, int64(len(req.LeafIndex)))
+	case *trillian.GetInclusionProofByHashRequest:
+		// The leaf index is looked up from its hash first
+		return logProofCost(req.TreeSize, 1).Add(Cost{LeafReads: 1})
+	case *trillian.GetConsistencyProofRequest:
+		return logProofCost(req.SecondTreeSize, 1)
+	case *trillian.GetEntryAndProofRequest:
+		return logProofCost(req.TreeSize, 1).Add(Cost{LeafReads: 1})
+	case *trillian.GetLeavesByIndexRequest:
+		return Cost{LeafReads: int64(len(req.LeafIndex))}
+	case *trillian.GetLeavesByHashRequest:
+		return Cost{LeafReads: int64(len(req.LeafHash))}
+	case *trillian.GetLeavesByRangeRequest:
+		// The leaves are charged for as each batch of them is sent, see
+		// ResponseCost, as the size of an open ended range isn't known in advance
+		return Cost{}
+	case *trillian.GetMapLeavesRequest:
+		return mapProofCost(int64(len(req.Key)))
+	case *trillian.ListMapLeavesRequest:
+		// Like a range of log leaves, the leaves are charged for as they're sent
+		return Cost{}
+	case *trillian.SetMapLeavesRequest:
+		c := Cost{KeyHashes: int64(len(req.KeyValue)), SubtreeReads: mapSubtreesPerPath * int64(len(req.KeyValue))}
+		for _, kv := range req.KeyValue {
+			if kv.Value != nil {
+				c.LeafBytes += int64(len(kv.Value.LeafValue) + len(kv.Value.ExtraData))
+			}
+		}
+		return c
+	}
+	return Cost{}
+}
@@ -0,0 +1,75 @@
+package quota
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/trillian"
+)
+
+func TestManyKeysCostSameAsSeparateRequests(t *testing.T) {
+	const keys = 10000
+	many := &trillian.GetMapLeavesRequest{}
+	for i := 0; i < keys; i++ {
+		many.Key = append(many.Key, []byte(fmt.Sprintf("key%d", i)))
+	}
+	one := &trillian.GetMapLeavesRequest{Key: [][]byte{[]byte("key")}}
+
+	manyTokens := DefaultCostModel.Tokens(EstimateCost(many))
+	separateTokens := keys * DefaultCostModel.Tokens(EstimateCost(one))
+	// Only the flat charge for each request should differ
+	if diff := separateTokens - manyTokens; diff < 0 || diff > keys*DefaultCostModel.PerRequest {
+		t.Fatalf("%d keys in one request cost %d tokens, but %d in separate requests", keys, manyTokens, separateTokens)
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	for _, test := range []struct {
+		req  interface{}
+		want Cost
+	}{
+		{req: &trillian.GetInclusionProofRequest{TreeSize: 1000}, want: Cost{ProofNodes: 10, SubtreeReads: 2}},
+		{req: &trillian.GetInclusionProofRequest{TreeSize: 1024}, want: Cost{ProofNodes: 10, SubtreeReads: 2}},
+		{req: &trillian.GetInclusionProofBatchRequest{LeafIndex: []int64{1, 2, 3}, TreeSize: 1024}, want: Cost{ProofNodes: 30, SubtreeReads: 6}},
+		{req: &trillian.GetConsistencyProofRequest{FirstTreeSize: 2, SecondTreeSize: 256}, want: Cost{ProofNodes: 8, SubtreeReads: 1}},
+		{req: &trillian.GetEntryAndProofRequest{TreeSize: 2}, want: Cost{ProofNodes: 1, SubtreeReads: 1, LeafReads: 1}},
+		{req: &trillian.GetLeavesByIndexRequest{LeafIndex: []int64{1, 2, 3}}, want: Cost{LeafReads: 3}},
+		{req: &trillian.GetLeavesByRangeRequest{StartIndex: 10, Count: 5}, want: Cost{}},
+		{req: &trillian.QueueLeavesRequest{Leaves: []*trillian.LeafProto{{LeafData: make([]byte, 100), ExtraData: make([]byte, 20)}, {LeafData: make([]byte, 10)}}}, want: Cost{LeafBytes: 130}},
+		{req: &trillian.GetMapLeavesRequest{Key: [][]byte{[]byte("a"), []byte("b")}}, want: Cost{KeyHashes: 2, ProofNodes: 2 * mapDepth, SubtreeReads: 2 * mapSubtreesPerPath}},
+		{req: &trillian.ListMapLeavesRequest{MapId: 1}, want: Cost{}},
+		{req: &trillian.SetMapLeavesRequest{KeyValue: []*trillian.KeyValue{{Key: []byte("a"), Value: &trillian.MapLeaf{LeafValue: make([]byte, 50)}}}}, want: Cost{KeyHashes: 1, LeafBytes: 50, SubtreeReads: mapSubtreesPerPath}},
+		{req: &trillian.GetSignedMapRootRequest{}, want: Cost{}},
+	} {
+		if got := EstimateCost(test.req); got != test.want {
+			t.Errorf("EstimateCost(%T) = %+v, want %+v", test.req, got, test.want)
+		}
+	}
+}
+
+func TestResponseCost(t *testing.T) {
+	for _, test := range []struct {
+		resp interface{}
+		want Cost
+	}{
+		{resp: &trillian.GetLeavesByRangeResponse{Leaves: make([]*trillian.LeafProto, 3)}, want: Cost{LeafReads: 3}},
+		{resp: &trillian.ListMapLeavesResponse{Leaves: make([]*trillian.MapLeaf, 2)}, want: Cost{LeafReads: 2}},
+		{resp: &trillian.GetLeavesByIndexResponse{Leaves: make([]*trillian.LeafProto, 3)}, want: Cost{}},
+	} {
+		if got := ResponseCost(test.resp); got != test.want {
+			t.Errorf("ResponseCost(%T) = %+v, want %+v", test.resp, got, test.want)
+		}
+	}
+}
+
+func TestTokensRoundsUpLeafKB(t *testing.T) {
+	model := CostModel{PerRequest: 1, PerLeafKB: 10}
+	for _, test := range []struct {
+		bytes int64
+		want  int64
+	}{{0, 1}, {1, 11}, {1024, 11}, {1025, 21}} {
+		if got := model.Tokens(Cost{LeafBytes: test.bytes}); got != test.want {
+			t.Errorf("Tokens for %d leaf bytes = %d, want %d", test.bytes, got, test.want)
+		}
+	}
+}
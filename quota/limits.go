@@ -0,0 +1,97 @@
+package quota
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+)
+
+// Spec identifies the requests a QuotaLimit applies to. A TREE spec with a
+// tree ID of zero, or a USER spec with no user, is the default for every tree
+// or user without a limit of their own.
+type Spec struct {
+	Group  trillian.QuotaGroup
+	Kind   trillian.QuotaKind
+	TreeID int64
+	User   string
+}
+
+// SpecOf returns the Spec of a limit.
+func SpecOf(limit *trillian.QuotaLimit) Spec {
+	return Spec{Group: limit.Group, Kind: limit.Kind, TreeID: limit.TreeId, User: limit.User}
+}
+
+// LimitStore holds the quota limits shared by servers. It's implemented by
+// mysql.QuotaStorage and MemoryLimitStore.
+type LimitStore interface {
+	// ListQuotaLimits returns every limit.
+	ListQuotaLimits() ([]*trillian.QuotaLimit, error)
+	// SetQuotaLimit adds a limit, replacing any with the same spec.
+	SetQuotaLimit(limit *trillian.QuotaLimit) error
+	// DeleteQuotaLimit removes the limit with the given spec, if there is one.
+	DeleteQuotaLimit(group trillian.QuotaGroup, kind trillian.QuotaKind, treeID int64, user string) error
+}
+
+// MemoryLimitStore is a LimitStore for a single server, whose limits are lost
+// when it's restarted.
+type MemoryLimitStore struct {
+	// Must hold this lock before accessing the map
+	mu     sync.Mutex
+	limits map[Spec]*trillian.QuotaLimit
+}
+
+// NewMemoryLimitStore creates an empty MemoryLimitStore.
+func NewMemoryLimitStore() *MemoryLimitStore {
+	return &MemoryLimitStore{limits: make(map[Spec]*trillian.QuotaLimit)}
+}
+
+// ListQuotaLimits returns every limit, ordered by spec.
+func (s *MemoryLimitStore) ListQuotaLimits() ([]*trillian.QuotaLimit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limits := make([]*trillian.QuotaLimit, 0, len(s.limits))
+	for _, limit := range s.limits {
+		limits = append(limits, proto.Clone(limit).(*trillian.QuotaLimit))
+	}
+	sort.Sort(bySpec(limits))
+	return limits, nil
+}
+
+// SetQuotaLimit adds a limit, replacing any with the same spec.
+func (s *MemoryLimitStore) SetQuotaLimit(limit *trillian.QuotaLimit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limits[SpecOf(limit)] = proto.Clone(limit).(*trillian.QuotaLimit)
+	return nil
+}
+
+// DeleteQuotaLimit removes the limit with the given spec, if there is one.
+func (s *MemoryLimitStore) DeleteQuotaLimit(group trillian.QuotaGroup, kind trillian.QuotaKind, treeID int64, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.limits, Spec{Group: group, Kind: kind, TreeID: treeID, User: user})
+	return nil
+}
+
+// bySpec orders limits by group, kind, tree ID and then user.
+type bySpec []*trillian.QuotaLimit
+
+func (l bySpec) Len() int      { return len(l) }
+func (l bySpec) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l bySpec) Less(i, j int) bool {
+	a, b := l[i], l[j]
+	switch {
+	case a.Group != b.Group:
+		return a.Group < b.Group
+	case a.Kind != b.Kind:
+		return a.Kind < b.Kind
+	case a.TreeId != b.TreeId:
+		return a.TreeId < b.TreeId
+	}
+	return a.User < b.User
+}
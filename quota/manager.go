@@ -0,0 +1,425 @@
+package quota
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/auth"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+)
+
+// bucketSweepInterval is how often the buckets that have refilled are removed,
+// so that the buckets of users who've stopped making requests don't build up.
+const bucketSweepInterval = time.Minute
+
+// Manager charges requests against the global, per tree and per user limits
+// held in a LimitStore, and against the limit of the whole server if one is
+// set. Each Manager has its own token buckets, so a limit applies to each
+// server separately.
+type Manager struct {
+	store      LimitStore
+	model      CostModel
+	timeSource util.TimeSource
+	// principals maps client certificate identities to the users charged
+	principals auth.Principals
+	// forwarders are the principals whose requests are charged to the user
+	// they forward them for
+	forwarders map[string]bool
+
+	// Must hold this lock before accessing the fields below
+	mu     sync.Mutex
+	limits map[Spec]*trillian.QuotaLimit
+	// buckets holds the bucket of every tree and user that has been charged
+	// since it was last full, keyed by their own spec even when they're
+	// limited by the default
+	buckets map[Spec]*limitBucket
+	// lastSweep is when full buckets were last removed from buckets
+	lastSweep time.Time
+	// serverBucket is charged for every request, or nil if the server has no
+	// limit of its own
+	serverBucket *TokenBucket
+}
+
+// limitBucket is a TokenBucket and the limit it was created for.
+type limitBucket struct {
+	limit  *trillian.QuotaLimit
+	bucket *TokenBucket
+}
+
+// NewManager creates a Manager enforcing the limits in store, charging requests
+// the tokens that model gives for their estimated cost.
+func NewManager(store LimitStore, model CostModel, timeSource util.TimeSource) (*Manager, error) {
+	m := &Manager{store: store, model: model, timeSource: timeSource, buckets: make(map[Spec]*limitBucket), lastSweep: timeSource.Now()}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SetPrincipals makes the manager charge requests from clients with a verified
+// certificate to the principal their identity is mapped to, rather than to the
+// identity itself. It must be called before any requests are charged.
+func (m *Manager) SetPrincipals(p auth.Principals) {
+	m.principals = p
+}
+
+// SetForwarders makes the manager charge requests from the principals in f,
+// such as HTTP gateways, to the user named in their auth.ForwardedUserKey
+// metadata rather than to the principal itself, so that each of their clients
+// has its own per user limit. Requests from other principals are charged to
+// them whatever user they name. It must be called before any requests are
+// charged.
+func (m *Manager) SetForwarders(f map[string]bool) {
+	m.forwarders = f
+}
+
+// SetServerLimit makes the manager charge every request, whatever its kind,
+// tree and user, to a bucket refilled with tokensPerSecond up to burst tokens.
+// Unlike the limits in the store, it's only set for this server. It must be
+// called before any requests are charged.
+func (m *Manager) SetServerLimit(tokensPerSecond float64, burst int64) {
+	m.serverBucket = NewTokenBucket(tokensPerSecond, burst, m.timeSource)
+}
+
+// Reload reads the limits from the store. The buckets of trees and users whose
+// limit has changed are refilled, others keep their tokens.
+func (m *Manager) Reload() error {
+	list, err := m.store.ListQuotaLimits()
+	if err != nil {
+		return err
+	}
+	limits := make(map[Spec]*trillian.QuotaLimit)
+	for _, limit := range list {
+		limits[SpecOf(limit)] = limit
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limits = limits
+	for spec, b := range m.buckets {
+		if limit := m.limitFor(spec); limit == nil || !proto.Equal(limit, b.limit) {
+			delete(m.buckets, spec)
+		}
+	}
+	return nil
+}
+
+// Run calls Reload every interval until done is closed, so the limits set
+// through other servers take effect.
+func (m *Manager) Run(done <-chan struct{}, interval time.Duration) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+
+		if err := m.Reload(); err != nil {
+			glog.Warningf("Failed to reload quota limits: %v", err)
+		}
+	}
+}
+
+// ListQuotaLimits returns every limit in the store.
+func (m *Manager) ListQuotaLimits() ([]*trillian.QuotaLimit, error) {
+	return m.store.ListQuotaLimits()
+}
+
+// SetQuotaLimit adds a limit to the store, replacing any with the same spec,
+// and applies it.
+func (m *Manager) SetQuotaLimit(limit *trillian.QuotaLimit) error {
+	if err := m.store.SetQuotaLimit(limit); err != nil {
+		return err
+	}
+	return m.Reload()
+}
+
+// DeleteQuotaLimit removes a limit from the store, if there is one, and stops
+// applying it.
+func (m *Manager) DeleteQuotaLimit(group trillian.QuotaGroup, kind trillian.QuotaKind, treeID int64, user string) error {
+	if err := m.store.DeleteQuotaLimit(group, kind, treeID, user); err != nil {
+		return err
+	}
+	return m.Reload()
+}
+
+// limitFor returns the limit that applies to spec, which is its own or else
+// the default for its group, or nil if there is neither. Must hold m.mu.
+func (m *Manager) limitFor(spec Spec) *trillian.QuotaLimit {
+	if limit, ok := m.limits[spec]; ok {
+		return limit
+	}
+	def := Spec{Group: spec.Group, Kind: spec.Kind}
+	if def == spec {
+		return nil
+	}
+	return m.limits[def]
+}
+
+// bucketFor returns the bucket for spec, creating it if it's not yet been
+// charged, or nil if it's unlimited. Must hold m.mu.
+func (m *Manager) bucketFor(spec Spec) *TokenBucket {
+	if b, ok := m.buckets[spec]; ok {
+		return b.bucket
+	}
+	limit := m.limitFor(spec)
+	if limit == nil {
+		return nil
+	}
+	b := &limitBucket{limit: limit, bucket: NewTokenBucket(limit.TokensPerSecond, limit.Burst, m.timeSource)}
+	m.buckets[spec] = b
+	return b.bucket
+}
+
+// sweepBuckets removes the buckets that have refilled, as they'd be recreated
+// full if they're charged again, once every bucketSweepInterval. Must hold
+// m.mu.
+func (m *Manager) sweepBuckets() {
+	now := m.timeSource.Now()
+	if now.Sub(m.lastSweep) < bucketSweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for spec, b := range m.buckets {
+		if b.bucket.Full() {
+			delete(m.buckets, spec)
+		}
+	}
+}
+
+// Charge takes tokens from the server bucket, if there is one, the global
+// bucket of the given kind, and those of the tree and user if they're known.
+// It returns a ResourceExhausted error, and takes no tokens, if any of the
+// buckets is empty.
+func (m *Manager) Charge(kind trillian.QuotaKind, treeID int64, user string, tokens int64) error {
+	specs := []Spec{{Group: trillian.QuotaGroup_GLOBAL, Kind: kind}}
+	if treeID != 0 {
+		specs = append(specs, Spec{Group: trillian.QuotaGroup_TREE, Kind: kind, TreeID: treeID})
+	}
+	if len(user) > 0 {
+		specs = append(specs, Spec{Group: trillian.QuotaGroup_USER, Kind: kind, User: user})
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweepBuckets()
+	var charged []*TokenBucket
+	if m.serverBucket != nil {
+		if !m.serverBucket.Charge(tokens) {
+			return grpc.Errorf(codes.ResourceExhausted, "server quota exhausted, needs %d tokens", tokens)
+		}
+		charged = append(charged, m.serverBucket)
+	}
+	for _, spec := range specs {
+		b := m.bucketFor(spec)
+		if b == nil {
+			continue
+		}
+		if !b.Charge(tokens) {
+			for _, c := range charged {
+				c.Refund(tokens)
+			}
+			return grpc.Errorf(codes.ResourceExhausted, "%v %v quota exhausted, needs %d tokens", spec.Group, spec.Kind, tokens)
+		}
+		charged = append(charged, b)
+	}
+	return nil
+}
+
+// leavesOverQuotaKey is the context key of the leaves of a QueueLeavesRequest
+// that were over quota.
+type leavesOverQuotaKey struct{}
+
+// LeavesOverQuota returns the indices of the leaves of the QueueLeavesRequest
+// being handled in ctx that were over quota, which haven't been charged for and
+// shouldn't be queued. It's empty if every leaf was charged.
+func LeavesOverQuota(ctx context.Context) map[int]bool {
+	over, _ := ctx.Value(leavesOverQuotaKey{}).(map[int]bool)
+	return over
+}
+
+// chargeRequest charges for req, made by the client in ctx, and returns the
+// context to handle it in. The leaves of a QueueLeavesRequest are charged one
+// at a time, after the rest of the request, so that those over quota can be
+// refused without failing the others. They're recorded in the returned context
+// for LeavesOverQuota.
+func (m *Manager) chargeRequest(ctx context.Context, req interface{}) (context.Context, error) {
+	kind, treeID, _ := RequestTree(req)
+	user := m.requestUser(ctx)
+	queue, ok := req.(*trillian.QueueLeavesRequest)
+	if !ok {
+		return ctx, m.Charge(kind, treeID, user, m.model.Tokens(EstimateCost(req)))
+	}
+
+	if err := m.Charge(kind, treeID, user, m.model.Tokens(Cost{})); err != nil {
+		return ctx, err
+	}
+	over := make(map[int]bool)
+	for i, leaf := range queue.Leaves {
+		// The flat charge for the request has been made already
+		tokens := m.model.Tokens(leafCost(leaf)) - m.model.PerRequest
+		if err := m.Charge(kind, treeID, user, tokens); err != nil {
+			over[i] = true
+		}
+	}
+	if len(over) == 0 {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, leavesOverQuotaKey{}, over), nil
+}
+
+// UnaryInterceptor returns a UnaryServerInterceptor which charges each request
+// for its estimated cost, rejecting it with ResourceExhausted if it's over any
+// of its limits. Leaves of a QueueLeavesRequest that are over a limit don't
+// fail the request, they're passed to the handler for LeavesOverQuota.
+func (m *Manager) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := m.chargeRequest(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor returns a StreamServerInterceptor which charges for each
+// message received on a stream as if it were a separate request. The leaves in
+// each batch of a streamed response are charged, to the tree of the last
+// request received, as they're sent.
+func (m *Manager) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := stream.Context()
+		user := m.requestUser(ctx)
+		var kind trillian.QuotaKind
+		var treeID int64
+		return handler(srv, &chargingStream{ServerStream: stream, charge: func(msg interface{}) error {
+			kind, treeID, _ = RequestTree(msg)
+			_, err := m.chargeRequest(ctx, msg)
+			return err
+		}, chargeSent: func(msg interface{}) error {
+			if tokens := m.model.batchTokens(ResponseCost(msg)); tokens > 0 {
+				return m.Charge(kind, treeID, user, tokens)
+			}
+			return nil
+		}})
+	}
+}
+
+// chargingStream charges for each message as it's received, and for the
+// leaves in each message sent.
+type chargingStream struct {
+	grpc.ServerStream
+	charge     func(m interface{}) error
+	chargeSent func(m interface{}) error
+}
+
+func (s *chargingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.charge(m)
+}
+
+// SendMsg fails the stream, without sending m, once the buckets can't pay for
+// the leaves in it.
+func (s *chargingStream) SendMsg(m interface{}) error {
+	if err := s.chargeSent(m); err != nil {
+		return err
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// RequestTree returns the kind of req and the tree it's for. If req isn't one of
+// the log or map API requests ok is false, and it's a read of tree zero.
+func RequestTree(req interface{}) (kind trillian.QuotaKind, treeID int64, ok bool) {
+	switch req := req.(type) {
+	case *trillian.QueueLeavesRequest:
+		return trillian.QuotaKind_WRITE, req.LogId, true
+	case *trillian.AddSequencedLeavesRequest:
+		return trillian.QuotaKind_WRITE, req.LogId, true
+	case *trillian.InitLogRequest:
+		return trillian.QuotaKind_WRITE, req.LogId, true
+	case *trillian.AddLogRootCosignatureRequest:
+		return trillian.QuotaKind_WRITE, req.LogId, true
+	case *trillian.GetInclusionProofRequest:
+		return trillian.QuotaKind_READ, req.LogId, true
+	case *trillian.GetInclusionProofBatchRequest:
+		return trillian.QuotaKind_READ, req.LogId, true
+	case *trillian.GetInclusionProofByHashRequest:
+		return trillian.QuotaKind_READ, req.LogId, true
+	case *trillian.GetConsistencyProofRequest:
+		return trillian.QuotaKind_READ, req.LogId, true
+	case *trillian.GetLeavesByHashRequest:
+		return trillian.QuotaKind_READ, req.LogId, true
+	case *trillian.GetLeavesByIndexRequest:
+		return trillian.QuotaKind_READ, req.LogId, true
+	case *trillian.GetLeavesByRangeRequest:
+		return trillian.QuotaKind_READ, req.LogId, true
+	case *trillian.GetSequencedLeafCountRequest:
+		return trillian.QuotaKind_READ, req.LogId, true
+	case *trillian.GetLatestSignedLogRootRequest:
+		return trillian.QuotaKind_READ, req.LogId, true
+	case *trillian.GetLatestCheckpointRequest:
+		return trillian.QuotaKind_READ, req.LogId, true
+	case *trillian.GetEntryAndProofRequest:
+		return trillian.QuotaKind_READ, req.LogId, true
+	case *trillian.GetTreeKeysRequest:
+		return trillian.QuotaKind_READ, req.TreeId, true
+	case *trillian.GetLeafIndexRangeByTimeRequest:
+		return trillian.QuotaKind_READ, req.LogId, true
+	case *trillian.SetMapLeavesRequest:
+		return trillian.QuotaKind_WRITE, req.MapId, true
+	case *trillian.InitMapRequest:
+		return trillian.QuotaKind_WRITE, req.MapId, true
+	case *trillian.PublishMapRevisionRequest:
+		return trillian.QuotaKind_WRITE, req.MapId, true
+	case *trillian.AbandonMapRevisionRequest:
+		return trillian.QuotaKind_WRITE, req.MapId, true
+	case *trillian.TagMapRevisionRequest:
+		return trillian.QuotaKind_WRITE, req.MapId, true
+	case *trillian.GetMapLeavesRequest:
+		return trillian.QuotaKind_READ, req.MapId, true
+	case *trillian.GetSignedMapRootRequest:
+		return trillian.QuotaKind_READ, req.MapId, true
+	case *trillian.GetSignedMapRootByRevisionRequest:
+		return trillian.QuotaKind_READ, req.MapId, true
+	case *trillian.GetMapUpdateProofRequest:
+		return trillian.QuotaKind_READ, req.MapId, true
+	case *trillian.ListMapLeavesRequest:
+		return trillian.QuotaKind_READ, req.MapId, true
+	case *trillian.GetMapRevisionTagsRequest:
+		return trillian.QuotaKind_READ, req.MapId, true
+	}
+	return trillian.QuotaKind_READ, 0, false
+}
+
+// requestUser returns the user who made the request in ctx. This is the
+// principal of their verified client certificate, or else the host they
+// connected from. A forwarder's request is made by the user it names.
+func (m *Manager) requestUser(ctx context.Context) string {
+	if principal := m.principals.Principal(ctx); len(principal) > 0 {
+		if m.forwarders[principal] {
+			if user := auth.ForwardedUser(ctx); len(user) > 0 {
+				return user
+			}
+		}
+		return principal
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,330 @@
+package quota
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/auth"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func newTestManager(t *testing.T, limits ...*trillian.QuotaLimit) (*Manager, *util.FakeTimeSource) {
+	store := NewMemoryLimitStore()
+	for _, limit := range limits {
+		if err := store.SetQuotaLimit(limit); err != nil {
+			t.Fatalf("Failed to set limit: %v", err)
+		}
+	}
+	ts := &util.FakeTimeSource{FakeTime: time.Date(2016, 11, 1, 12, 0, 0, 0, time.UTC)}
+	m, err := NewManager(store, DefaultCostModel, ts)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	return m, ts
+}
+
+func TestManagerTreeLimits(t *testing.T) {
+	m, _ := newTestManager(t,
+		&trillian.QuotaLimit{Group: trillian.QuotaGroup_TREE, Kind: trillian.QuotaKind_WRITE, TokensPerSecond: 1, Burst: 10},
+		&trillian.QuotaLimit{Group: trillian.QuotaGroup_TREE, Kind: trillian.QuotaKind_WRITE, TreeId: 2, TokensPerSecond: 1, Burst: 100})
+
+	// Tree 1 is limited by the default, and tree 2 by its own limit
+	if err := m.Charge(trillian.QuotaKind_WRITE, 1, "", 10); err != nil {
+		t.Fatalf("Charge(tree 1)=%v, want no error", err)
+	}
+	if err := m.Charge(trillian.QuotaKind_WRITE, 1, "", 1); grpc.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Charge(tree 1) when exhausted=%v, want code %v", err, codes.ResourceExhausted)
+	}
+	// Each tree has its own bucket, even if it's limited by the default
+	if err := m.Charge(trillian.QuotaKind_WRITE, 3, "", 10); err != nil {
+		t.Fatalf("Charge(tree 3)=%v, want no error", err)
+	}
+	if err := m.Charge(trillian.QuotaKind_WRITE, 2, "", 50); err != nil {
+		t.Fatalf("Charge(tree 2)=%v, want no error", err)
+	}
+	// Reads aren't limited
+	if err := m.Charge(trillian.QuotaKind_READ, 1, "", 1000); err != nil {
+		t.Fatalf("Charge(read tree 1)=%v, want no error", err)
+	}
+}
+
+func TestManagerRefundsWhenOverLimit(t *testing.T) {
+	m, _ := newTestManager(t,
+		&trillian.QuotaLimit{Group: trillian.QuotaGroup_GLOBAL, Kind: trillian.QuotaKind_READ, TokensPerSecond: 1, Burst: 15},
+		&trillian.QuotaLimit{Group: trillian.QuotaGroup_USER, Kind: trillian.QuotaKind_READ, User: "alice", TokensPerSecond: 1, Burst: 5})
+
+	if err := m.Charge(trillian.QuotaKind_READ, 1, "alice", 10); err != nil {
+		t.Fatalf("Charge(alice)=%v, want no error", err)
+	}
+	// Alice is over her limit, and the global tokens she'd have used are kept
+	if err := m.Charge(trillian.QuotaKind_READ, 1, "alice", 5); grpc.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Charge(alice) when exhausted=%v, want code %v", err, codes.ResourceExhausted)
+	}
+	if err := m.Charge(trillian.QuotaKind_READ, 1, "bob", 5); err != nil {
+		t.Fatalf("Charge(bob)=%v, want no error", err)
+	}
+	if err := m.Charge(trillian.QuotaKind_READ, 1, "bob", 1); grpc.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Charge(bob) when globally exhausted=%v, want code %v", err, codes.ResourceExhausted)
+	}
+}
+
+func TestManagerServerLimit(t *testing.T) {
+	m, ts := newTestManager(t, &trillian.QuotaLimit{Group: trillian.QuotaGroup_USER, Kind: trillian.QuotaKind_WRITE, User: "alice", TokensPerSecond: 1, Burst: 5})
+	m.SetServerLimit(1, 10)
+
+	if err := m.Charge(trillian.QuotaKind_READ, 1, "bob", 10); err != nil {
+		t.Fatalf("Charge(bob)=%v, want no error", err)
+	}
+	// Every request is charged to the server bucket, whatever its kind
+	if err := m.Charge(trillian.QuotaKind_WRITE, 2, "carol", 1); grpc.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Charge(carol) when server exhausted=%v, want code %v", err, codes.ResourceExhausted)
+	}
+
+	// Tokens taken from the server bucket are refunded if another is empty
+	ts.FakeTime = ts.FakeTime.Add(10 * time.Second)
+	if err := m.Charge(trillian.QuotaKind_WRITE, 1, "alice", 5); err != nil {
+		t.Fatalf("Charge(alice)=%v, want no error", err)
+	}
+	if err := m.Charge(trillian.QuotaKind_WRITE, 1, "alice", 5); grpc.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Charge(alice) when exhausted=%v, want code %v", err, codes.ResourceExhausted)
+	}
+	if err := m.Charge(trillian.QuotaKind_READ, 1, "bob", 5); err != nil {
+		t.Fatalf("Charge(bob) with server tokens left=%v, want no error", err)
+	}
+}
+
+func TestManagerRemovesRefilledBuckets(t *testing.T) {
+	m, ts := newTestManager(t, &trillian.QuotaLimit{Group: trillian.QuotaGroup_USER, Kind: trillian.QuotaKind_READ, TokensPerSecond: 1, Burst: 10})
+
+	for _, user := range []string{"alice", "bob"} {
+		if err := m.Charge(trillian.QuotaKind_READ, 1, user, 10); err != nil {
+			t.Fatalf("Charge(%s)=%v, want no error", user, err)
+		}
+	}
+	if got := len(m.buckets); got != 2 {
+		t.Fatalf("Manager has %d buckets, want 2", got)
+	}
+
+	// Alice's bucket refills while she's idle, and is then removed, but Bob
+	// is still in debt after charging again
+	ts.FakeTime = ts.FakeTime.Add(bucketSweepInterval)
+	if err := m.Charge(trillian.QuotaKind_READ, 1, "bob", 100); err != nil {
+		t.Fatalf("Charge(bob)=%v, want no error", err)
+	}
+	ts.FakeTime = ts.FakeTime.Add(bucketSweepInterval)
+	if err := m.Charge(trillian.QuotaKind_READ, 1, "carol", 1); err != nil {
+		t.Fatalf("Charge(carol)=%v, want no error", err)
+	}
+	want := map[Spec]bool{
+		{Group: trillian.QuotaGroup_USER, Kind: trillian.QuotaKind_READ, User: "bob"}:   true,
+		{Group: trillian.QuotaGroup_USER, Kind: trillian.QuotaKind_READ, User: "carol"}: true,
+	}
+	got := make(map[Spec]bool)
+	for spec := range m.buckets {
+		got[spec] = true
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Manager has buckets %v, want %v", got, want)
+	}
+	if err := m.Charge(trillian.QuotaKind_READ, 1, "bob", 1); grpc.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Charge(bob) in debt=%v, want code %v", err, codes.ResourceExhausted)
+	}
+}
+
+func TestManagerAppliesChangedLimits(t *testing.T) {
+	m, ts := newTestManager(t, &trillian.QuotaLimit{Group: trillian.QuotaGroup_TREE, Kind: trillian.QuotaKind_READ, TreeId: 1, TokensPerSecond: 1, Burst: 10})
+
+	if err := m.Charge(trillian.QuotaKind_READ, 1, "", 10); err != nil {
+		t.Fatalf("Charge()=%v, want no error", err)
+	}
+	// Unchanged limits keep their buckets when reloaded
+	if err := m.Reload(); err != nil {
+		t.Fatalf("Reload()=%v, want no error", err)
+	}
+	if err := m.Charge(trillian.QuotaKind_READ, 1, "", 1); grpc.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Charge() after reload=%v, want code %v", err, codes.ResourceExhausted)
+	}
+
+	// A raised limit starts with a full bucket
+	if err := m.SetQuotaLimit(&trillian.QuotaLimit{Group: trillian.QuotaGroup_TREE, Kind: trillian.QuotaKind_READ, TreeId: 1, TokensPerSecond: 1, Burst: 20}); err != nil {
+		t.Fatalf("SetQuotaLimit()=%v, want no error", err)
+	}
+	if err := m.Charge(trillian.QuotaKind_READ, 1, "", 20); err != nil {
+		t.Fatalf("Charge() after raising limit=%v, want no error", err)
+	}
+	ts.FakeTime = ts.FakeTime.Add(time.Second)
+	if err := m.Charge(trillian.QuotaKind_READ, 1, "", 1); err != nil {
+		t.Fatalf("Charge() after refill=%v, want no error", err)
+	}
+
+	if err := m.DeleteQuotaLimit(trillian.QuotaGroup_TREE, trillian.QuotaKind_READ, 1, ""); err != nil {
+		t.Fatalf("DeleteQuotaLimit()=%v, want no error", err)
+	}
+	if err := m.Charge(trillian.QuotaKind_READ, 1, "", 1000); err != nil {
+		t.Fatalf("Charge() after deleting limit=%v, want no error", err)
+	}
+}
+
+func TestManagerChargesLeavesSeparately(t *testing.T) {
+	m, _ := newTestManager(t,
+		&trillian.QuotaLimit{Group: trillian.QuotaGroup_TREE, Kind: trillian.QuotaKind_WRITE, TreeId: 1, TokensPerSecond: 1, Burst: 10})
+	interceptor := m.UnaryInterceptor()
+	leaf := &trillian.LeafProto{LeafData: make([]byte, 100)}
+	req := &trillian.QueueLeavesRequest{LogId: 1, Leaves: []*trillian.LeafProto{leaf, leaf, leaf}}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return LeavesOverQuota(ctx), nil
+	}
+
+	// The request and the first leaf leave one token, which the second leaf
+	// takes, so the bucket is empty for the third
+	over, err := interceptor(context.Background(), req, &grpc.UnaryServerInfo{}, handler)
+	if err != nil {
+		t.Fatalf("interceptor()=%v, want no error", err)
+	}
+	if want := map[int]bool{2: true}; !reflect.DeepEqual(over, want) {
+		t.Errorf("LeavesOverQuota()=%v, want %v", over, want)
+	}
+
+	// The next request fails as a whole
+	if _, err := interceptor(context.Background(), req, &grpc.UnaryServerInfo{}, handler); grpc.Code(err) != codes.ResourceExhausted {
+		t.Errorf("second interceptor()=%v, want code %v", err, codes.ResourceExhausted)
+	}
+}
+
+// fakeServerStream is a server stream which receives req, and counts the
+// messages sent.
+type fakeServerStream struct {
+	grpc.ServerStream
+	req  *trillian.GetLeavesByRangeRequest
+	sent int
+}
+
+func (f *fakeServerStream) Context() context.Context {
+	return context.Background()
+}
+
+func (f *fakeServerStream) RecvMsg(m interface{}) error {
+	*m.(*trillian.GetLeavesByRangeRequest) = *f.req
+	return nil
+}
+
+func (f *fakeServerStream) SendMsg(m interface{}) error {
+	f.sent++
+	return nil
+}
+
+func TestManagerChargesStreamedBatches(t *testing.T) {
+	m, _ := newTestManager(t,
+		&trillian.QuotaLimit{Group: trillian.QuotaGroup_TREE, Kind: trillian.QuotaKind_READ, TreeId: 1, TokensPerSecond: 1, Burst: 100})
+	interceptor := m.StreamInterceptor()
+	// An open ended range, whose batches of 5 leaves cost 40 tokens each
+	stream := &fakeServerStream{req: &trillian.GetLeavesByRangeRequest{LogId: 1}}
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		var req trillian.GetLeavesByRangeRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		for {
+			if err := stream.SendMsg(&trillian.GetLeavesByRangeResponse{Leaves: make([]*trillian.LeafProto, 5)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The request and two batches leave 19 tokens, and the third batch puts
+	// the bucket in debt, so the fourth isn't sent
+	if err := interceptor(nil, stream, &grpc.StreamServerInfo{}, handler); grpc.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("interceptor()=%v, want code %v", err, codes.ResourceExhausted)
+	}
+	if want := 3; stream.sent != want {
+		t.Errorf("interceptor() sent %d batches, want %d", stream.sent, want)
+	}
+}
+
+// clientContext returns the context of an RPC from the client whose verified
+// certificate has the common name cn, with the metadata md.
+func clientContext(cn string, md metadata.MD) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	info := credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+	return metadata.NewIncomingContext(peer.NewContext(context.Background(), &peer.Peer{AuthInfo: info}), md)
+}
+
+func TestManagerChargesPrincipals(t *testing.T) {
+	m, _ := newTestManager(t,
+		&trillian.QuotaLimit{Group: trillian.QuotaGroup_USER, Kind: trillian.QuotaKind_READ, User: "ct", TokensPerSecond: 1, Burst: 10})
+	m.SetPrincipals(auth.Principals{"ct-1.example.com": "ct", "ct-2.example.com": "ct"})
+	interceptor := m.UnaryInterceptor()
+	req := &trillian.GetLeavesByIndexRequest{LogId: 1, LeafIndex: []int64{1, 2}}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+
+	// Both certificates are charged to the same principal
+	if _, err := interceptor(clientContext("ct-1.example.com", nil), req, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatalf("interceptor(ct-1)=%v, want no error", err)
+	}
+	if _, err := interceptor(clientContext("ct-2.example.com", nil), req, &grpc.UnaryServerInfo{}, handler); grpc.Code(err) != codes.ResourceExhausted {
+		t.Errorf("interceptor(ct-2)=%v, want code %v", err, codes.ResourceExhausted)
+	}
+}
+
+func TestManagerChargesForwardedUsers(t *testing.T) {
+	m, _ := newTestManager(t,
+		&trillian.QuotaLimit{Group: trillian.QuotaGroup_USER, Kind: trillian.QuotaKind_READ, User: "alice", TokensPerSecond: 1, Burst: 10},
+		&trillian.QuotaLimit{Group: trillian.QuotaGroup_USER, Kind: trillian.QuotaKind_READ, User: "other", TokensPerSecond: 1, Burst: 10})
+	m.SetForwarders(map[string]bool{"gateway": true})
+	interceptor := m.UnaryInterceptor()
+	// The read costs 17 tokens, which leaves a bucket of 10 in debt
+	req := &trillian.GetLeavesByIndexRequest{LogId: 1, LeafIndex: []int64{1, 2}}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+	forwarded := func(cn, user string) context.Context {
+		return clientContext(cn, metadata.Pairs(auth.ForwardedUserKey, user))
+	}
+
+	if _, err := interceptor(forwarded("gateway", "alice"), req, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatalf("interceptor(gateway for alice)=%v, want no error", err)
+	}
+	if _, err := interceptor(forwarded("gateway", "alice"), req, &grpc.UnaryServerInfo{}, handler); grpc.Code(err) != codes.ResourceExhausted {
+		t.Errorf("second interceptor(gateway for alice)=%v, want code %v", err, codes.ResourceExhausted)
+	}
+	// The gateway itself isn't limited, so another user it forwards for isn't
+	if _, err := interceptor(forwarded("gateway", "bob"), req, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Errorf("interceptor(gateway for bob)=%v, want no error", err)
+	}
+	// Other clients can't have their requests charged to someone else
+	if _, err := interceptor(forwarded("other", "bob"), req, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatalf("interceptor(other for bob)=%v, want no error", err)
+	}
+	if _, err := interceptor(forwarded("other", "bob"), req, &grpc.UnaryServerInfo{}, handler); grpc.Code(err) != codes.ResourceExhausted {
+		t.Errorf("second interceptor(other for bob)=%v, want code %v", err, codes.ResourceExhausted)
+	}
+}
+
+func TestRequestTree(t *testing.T) {
+	for _, test := range []struct {
+		req      interface{}
+		wantKind trillian.QuotaKind
+		wantTree int64
+		wantOK   bool
+	}{
+		{req: &trillian.QueueLeavesRequest{LogId: 1}, wantKind: trillian.QuotaKind_WRITE, wantTree: 1, wantOK: true},
+		{req: &trillian.GetLeavesByIndexRequest{LogId: 2}, wantKind: trillian.QuotaKind_READ, wantTree: 2, wantOK: true},
+		{req: &trillian.SetMapLeavesRequest{MapId: 3}, wantKind: trillian.QuotaKind_WRITE, wantTree: 3, wantOK: true},
+		{req: &trillian.GetMapLeavesRequest{MapId: 4}, wantKind: trillian.QuotaKind_READ, wantTree: 4, wantOK: true},
+		{req: &trillian.ListMapLeavesRequest{MapId: 5}, wantKind: trillian.QuotaKind_READ, wantTree: 5, wantOK: true},
+		{req: &trillian.ListTreesRequest{}, wantKind: trillian.QuotaKind_READ, wantTree: 0},
+	} {
+		if kind, tree, ok := RequestTree(test.req); kind != test.wantKind || tree != test.wantTree || ok != test.wantOK {
+			t.Errorf("RequestTree(%T)=%v, %d, %v, want %v, %d, %v", test.req, kind, tree, ok, test.wantKind, test.wantTree, test.wantOK)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package quota
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/trillian/util"
+)
+
+// TokenBucket holds up to a fixed number of tokens, and is refilled at a fixed
+// rate. A charge is allowed whenever there are tokens left, even if it costs
+// more than there are, leaving the bucket in debt until it's refilled. Large
+// requests are then allowed through, but hold back the requests that follow
+// them for as long as the same tokens spent on small requests would.
+type TokenBucket struct {
+	rate       float64
+	capacity   float64
+	timeSource util.TimeSource
+
+	// Must hold this lock before accessing the fields below
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a full TokenBucket holding up to capacity tokens,
+// which is refilled with rate tokens per second.
+func NewTokenBucket(rate float64, capacity int64, timeSource util.TimeSource) *TokenBucket {
+	return &TokenBucket{
+		rate:       rate,
+		capacity:   float64(capacity),
+		timeSource: timeSource,
+		tokens:     float64(capacity),
+		last:       timeSource.Now(),
+	}
+}
+
+// refill adds the tokens accrued since the bucket was last refilled. Must hold
+// b.mu.
+func (b *TokenBucket) refill() {
+	now := b.timeSource.Now()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+		b.last = now
+	}
+}
+
+// Charge takes tokens from the bucket, returning false and taking none if it's
+// empty.
+func (b *TokenBucket) Charge(tokens int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	if b.tokens <= 0 {
+		return false
+	}
+	b.tokens -= float64(tokens)
+	return true
+}
+
+// Refund returns tokens taken by an earlier charge, up to the bucket's capacity.
+func (b *TokenBucket) Refund(tokens int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += float64(tokens)
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+// Full returns whether the bucket has been refilled to its capacity, when it's
+// no different from a new bucket.
+func (b *TokenBucket) Full() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	return b.tokens >= b.capacity
+}
@@ -0,0 +1,48 @@
+package quota
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/trillian/util"
+)
+
+func TestTokenBucket(t *testing.T) {
+	ts := &util.FakeTimeSource{FakeTime: time.Date(2016, 11, 1, 12, 0, 0, 0, time.UTC)}
+	b := NewTokenBucket(10, 100, ts)
+
+	// A charge larger than the tokens left is allowed, and leaves a debt
+	if !b.Charge(60) || !b.Charge(60) {
+		t.Fatalf("Charge failed with tokens left")
+	}
+	if b.Charge(1) {
+		t.Fatalf("Charge succeeded with the bucket in debt")
+	}
+
+	// The debt of 20 is paid off after 2s
+	ts.FakeTime = ts.FakeTime.Add(2 * time.Second)
+	if b.Charge(1) {
+		t.Fatalf("Charge succeeded with the bucket empty")
+	}
+	ts.FakeTime = ts.FakeTime.Add(100 * time.Millisecond)
+	if !b.Charge(1) {
+		t.Fatalf("Charge failed after the bucket was refilled")
+	}
+
+	// The bucket never holds more than its capacity
+	ts.FakeTime = ts.FakeTime.Add(time.Hour)
+	if !b.Charge(100) {
+		t.Fatalf("Charge failed with a full bucket")
+	}
+	if b.Charge(1) {
+		t.Fatalf("Bucket held more than its capacity")
+	}
+
+	if b.Full() {
+		t.Fatalf("Full()=true for an empty bucket")
+	}
+	ts.FakeTime = ts.FakeTime.Add(10 * time.Second)
+	if !b.Full() {
+		t.Fatalf("Full()=false once the bucket was refilled")
+	}
+}
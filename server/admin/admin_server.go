@@ -0,0 +1,669 @@
+// Package admin provides the TrillianAdmin gRPC service, which creates and
+// configures the trees held in storage.
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
+	"encoding/binary"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/crypto/keys"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/quota"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/cache"
+	"github.com/google/trillian/storage/mysql"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// TreeStorage holds the trees managed by the server. It's implemented by
+// mysql.TreeAdminStorage, which returns sql.ErrNoRows for trees that don't
+// exist.
+type TreeStorage interface {
+	CreateTree(tree mysql.Tree, control mysql.TreeControl) error
+	GetTree(treeID int64) (mysql.Tree, error)
+	ListTrees() ([]mysql.Tree, error)
+	AddTreeKey(treeID int64, key mysql.TreeKey) error
+	GetTreeKeys(treeID int64) ([]mysql.TreeKey, error)
+	GetTreeControl(treeID int64) (mysql.TreeControl, bool, error)
+	SetTreeControl(treeID int64, control mysql.TreeControl) error
+	SoftDeleteTree(treeID int64, timestampNanos int64) error
+	UndeleteTree(treeID int64) error
+	PurgeDeletedTree(treeID int64, deletedBeforeNanos int64, purgeData func() error) (bool, error)
+}
+
+// Server implements the TrillianAdmin RPC API.
+type Server struct {
+	storage    TreeStorage
+	timeSource util.TimeSource
+	// newTreeID chooses the ID of trees created without one
+	newTreeID func() (int64, error)
+	// quotaLimits holds the quota limits, the quota RPCs are unimplemented if
+	// it's nil
+	quotaLimits quota.LimitStore
+	// keyProvider holds the keys that sign tree roots, public keys aren't
+	// recorded if it's nil
+	keyProvider keys.Provider
+	// signatureAlgorithm is the algorithm every tree's roots are signed with,
+	// if they're not signed with keys from keyProvider
+	signatureAlgorithm *trillian.SignatureAlgorithm
+	// treeChanged is called with the ID of each tree that's updated, deleted
+	// or undeleted, if it's not nil
+	treeChanged func(treeID int64)
+	// checkMapStrata is called with the strata of maps created with their own
+	// strata, if it's not nil, and they're rejected if it returns an error
+	checkMapStrata func(strata []int) error
+	// mapStorage opens the storage of a map, so that its retention policy can
+	// be read and changed. Map retention is unimplemented if it's nil
+	mapStorage func(treeID int64) (storage.MapStorage, error)
+}
+
+// NewServer creates a Server which manages the trees held by s, using
+// timeSource to record when trees are deleted.
+func NewServer(s TreeStorage, timeSource util.TimeSource) *Server {
+	return &Server{storage: s, timeSource: timeSource, newTreeID: randomTreeID}
+}
+
+// SetQuotaLimits sets the store of the limits managed by the quota RPCs. This
+// is usually the quota.Manager enforcing them, so changes take effect at once.
+func (s *Server) SetQuotaLimits(limits quota.LimitStore) {
+	s.quotaLimits = limits
+}
+
+// SetKeyProvider sets the provider of the keys that sign tree roots, so that
+// their public keys are recorded when they're added to trees and returned with
+// them. It should find keys in the same way as the servers signing the roots.
+func (s *Server) SetKeyProvider(p keys.Provider) {
+	s.keyProvider = p
+}
+
+// SetSignatureAlgorithm tells the server the algorithm that every tree's roots
+// are signed with, for servers signing all trees with the same key or signing
+// service rather than keys from a key provider. Trees can only be created with
+// that algorithm.
+func (s *Server) SetSignatureAlgorithm(alg trillian.SignatureAlgorithm) {
+	s.signatureAlgorithm = &alg
+}
+
+// SetTreeChangedFunc has f called with the ID of each tree that's updated,
+// deleted or undeleted, once the change is stored. Servers use it to evict
+// the tree's cached storage, so that they pick up the change straight away.
+func (s *Server) SetTreeChangedFunc(f func(treeID int64)) {
+	s.treeChanged = f
+}
+
+// SetMapStrataCheck has check called with the strata of maps created with
+// their own strata, which are rejected if it returns an error. Servers use it
+// to refuse maps their storage can't hold, such as sharded.CheckStrata.
+func (s *Server) SetMapStrataCheck(check func(strata []int) error) {
+	s.checkMapStrata = check
+}
+
+// SetMapStorage sets how the server opens the storage of maps, so that their
+// retention policies can be returned by GetTree and changed by UpdateTree.
+func (s *Server) SetMapStorage(f func(treeID int64) (storage.MapStorage, error)) {
+	s.mapStorage = f
+}
+
+// notifyTreeChanged calls treeChanged for treeID, if it's set.
+func (s *Server) notifyTreeChanged(treeID int64) {
+	if s.treeChanged != nil {
+		s.treeChanged(treeID)
+	}
+}
+
+// publicKey checks that the roots of a tree with the signature algorithm alg
+// can be signed with keyID, and returns its DER encoded public key, or nil if
+// the server has no key provider. Roots are signed with the algorithm of the
+// key, so trees can't be given a different one.
+func (s *Server) publicKey(keyID string, alg trillian.SignatureAlgorithm) ([]byte, error) {
+	if s.keyProvider == nil {
+		switch {
+		case s.signatureAlgorithm == nil:
+			return nil, grpc.Errorf(codes.FailedPrecondition, "the server can't tell which signature algorithm roots are signed with")
+		case *s.signatureAlgorithm != alg:
+			return nil, grpc.Errorf(codes.InvalidArgument, "roots are signed with %v, not %v", *s.signatureAlgorithm, alg)
+		}
+		return nil, nil
+	}
+	signer, err := s.keyProvider.Signer(keyID)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "failed to get key %q: %v", keyID, err)
+	}
+	keyAlg, err := crypto.SignatureAlgorithmForKey(signer.Public())
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "key %q: %v", keyID, err)
+	}
+	if keyAlg != alg {
+		return nil, grpc.Errorf(codes.InvalidArgument, "key %q signs with %v, not %v", keyID, keyAlg, alg)
+	}
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "failed to encode public key of %q: %v", keyID, err)
+	}
+	return der, nil
+}
+
+// randomTreeID returns a random positive tree ID. IDs are chosen at random so
+// that servers sharing storage don't need to coordinate, a clash makes the
+// creation fail.
+func randomTreeID() (int64, error) {
+	var b [8]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, err
+		}
+		if id := int64(binary.BigEndian.Uint64(b[:]) >> 1); id > 0 {
+			return id, nil
+		}
+	}
+}
+
+// treeTypes maps the tree types of the API to those held in storage.
+var treeTypes = map[trillian.TreeType]string{
+	trillian.TreeType_LOG:            mysql.LogTreeType,
+	trillian.TreeType_PREORDERED_LOG: mysql.PreorderedLogTreeType,
+	trillian.TreeType_MAP:            mysql.MapTreeType,
+}
+
+// toProto converts a tree held in storage to the API's representation. A tree
+// without a state is frozen if its control settings make it read only. Its key
+// ID is that of the latest of treeKeys to be activated by nowNanos.
+func toProto(tree mysql.Tree, control mysql.TreeControl, treeKeys []mysql.TreeKey, nowNanos int64) *trillian.Tree {
+	pb := &trillian.Tree{
+		TreeId:                tree.TreeID,
+		TreeState:             trillian.TreeState_ACTIVE,
+		HashAlgorithm:         tree.HashAlgorithm,
+		HashStrategy:          tree.HashStrategy,
+		SignatureAlgorithm:    tree.SignatureAlgorithm,
+		KeyId:                 tree.KeyID,
+		AllowsDuplicateLeaves: tree.AllowsDuplicateLeaves,
+		DuplicatePolicy:       tree.DuplicatePolicy,
+		LeafHashPrefix:        tree.HashPrefixes.Leaf,
+		NodeHashPrefix:        tree.HashPrefixes.Node,
+		Deleted:               tree.Deleted,
+		DeleteTimeNanos:       tree.DeleteTimeNanos,
+	}
+	for _, key := range treeKeys {
+		pb.Keys = append(pb.Keys, &trillian.TreeKey{KeyId: key.KeyID, PublicKeyDer: key.PublicKey, ActivateTimeNanos: key.ActivateTimeNanos})
+		// The first key is used until another is activated
+		if len(pb.Keys) == 1 || key.ActivateTimeNanos <= nowNanos {
+			pb.KeyId = key.KeyID
+		}
+	}
+	for _, depth := range tree.MapStrata {
+		pb.MapStrata = append(pb.MapStrata, int32(depth))
+	}
+	for t, name := range treeTypes {
+		if name == tree.TreeType {
+			pb.TreeType = t
+		}
+	}
+	if control.TreeState != trillian.TreeState_UNKNOWN_TREE_STATE {
+		pb.TreeState = control.TreeState
+	} else if control.ReadOnlyRequests {
+		pb.TreeState = trillian.TreeState_FROZEN
+	}
+	return pb
+}
+
+// KeyReader reads the keys of trees. It's implemented by
+// mysql.TreeAdminStorage.
+type KeyReader interface {
+	GetTreeKeys(treeID int64) ([]mysql.TreeKey, error)
+}
+
+// TreeKeys reads the keys of a tree from r, converted to the API's
+// representation, for the log and map servers to return to their clients. It
+// returns a NotFound error if the tree doesn't exist.
+func TreeKeys(r KeyReader, treeID int64) ([]*trillian.TreeKey, error) {
+	treeKeys, err := r.GetTreeKeys(treeID)
+	if err == sql.ErrNoRows {
+		return nil, grpc.Errorf(codes.NotFound, "tree %d not found", treeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	pb := make([]*trillian.TreeKey, 0, len(treeKeys))
+	for _, key := range treeKeys {
+		pb = append(pb, &trillian.TreeKey{KeyId: key.KeyID, PublicKeyDer: key.PublicKey, ActivateTimeNanos: key.ActivateTimeNanos})
+	}
+	return pb, nil
+}
+
+// getTree reads a tree and its control settings, returning a NotFound error
+// if it doesn't exist.
+func (s *Server) getTree(treeID int64) (*trillian.Tree, error) {
+	tree, err := s.storage.GetTree(treeID)
+	if err == sql.ErrNoRows {
+		return nil, grpc.Errorf(codes.NotFound, "tree %d not found", treeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	control, err := s.treeControl(treeID)
+	if err != nil {
+		return nil, err
+	}
+	return s.toProto(tree, control)
+}
+
+// toProto reads the keys of a tree and converts it to the API's representation.
+func (s *Server) toProto(tree mysql.Tree, control mysql.TreeControl) (*trillian.Tree, error) {
+	treeKeys, err := s.storage.GetTreeKeys(tree.TreeID)
+	if err != nil {
+		return nil, err
+	}
+	return toProto(tree, control, treeKeys, s.timeSource.Now().UnixNano()), nil
+}
+
+// treeControl returns the control settings of a tree, or the defaults if it
+// has none.
+func (s *Server) treeControl(treeID int64) (mysql.TreeControl, error) {
+	control, ok, err := s.storage.GetTreeControl(treeID)
+	if err != nil {
+		return mysql.TreeControl{}, err
+	}
+	if !ok {
+		return mysql.DefaultTreeControl, nil
+	}
+	return control, nil
+}
+
+// withMapRetention sets the map_retention of tree, if it's a map whose storage
+// the server can open.
+func (s *Server) withMapRetention(tree *trillian.Tree) error {
+	if tree.TreeType != trillian.TreeType_MAP || tree.Deleted || s.mapStorage == nil {
+		return nil
+	}
+	ms, err := s.mapStorage(tree.TreeId)
+	if err != nil {
+		return err
+	}
+	tx, err := ms.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	policy, err := tx.GetRetentionPolicy()
+	if err != nil {
+		return err
+	}
+	tree.MapRetention = &trillian.MapRetentionPolicy{MaxRevisions: policy.MaxRevisions, MaxAgeSeconds: int64(policy.MaxAge / time.Second)}
+	return nil
+}
+
+// setMapRetention sets the retention policy of map treeID.
+func (s *Server) setMapRetention(treeID int64, policy *trillian.MapRetentionPolicy) error {
+	ms, err := s.mapStorage(treeID)
+	if err != nil {
+		return err
+	}
+	tx, err := ms.Begin()
+	if err != nil {
+		return err
+	}
+	if err := tx.SetRetentionPolicy(storage.RetentionPolicy{MaxRevisions: policy.MaxRevisions, MaxAge: time.Duration(policy.MaxAgeSeconds) * time.Second}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// getUndeletedTree reads a tree, returning a FailedPrecondition error if it has
+// been deleted.
+func (s *Server) getUndeletedTree(treeID int64) (*trillian.Tree, error) {
+	tree, err := s.getTree(treeID)
+	if err != nil {
+		return nil, err
+	}
+	if tree.Deleted {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "tree %d is deleted", treeID)
+	}
+	return tree, nil
+}
+
+// ListTrees returns the trees, ordered by tree ID. Deleted trees are only
+// returned if requested.
+func (s *Server) ListTrees(ctx context.Context, req *trillian.ListTreesRequest) (*trillian.ListTreesResponse, error) {
+	trees, err := s.storage.ListTrees()
+	if err != nil {
+		return nil, err
+	}
+	resp := &trillian.ListTreesResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_OK}}
+	for _, tree := range trees {
+		if tree.Deleted && !req.ShowDeleted {
+			continue
+		}
+		control, err := s.treeControl(tree.TreeID)
+		if err != nil {
+			return nil, err
+		}
+		pb, err := s.toProto(tree, control)
+		if err != nil {
+			return nil, err
+		}
+		resp.Tree = append(resp.Tree, pb)
+	}
+	return resp, nil
+}
+
+// GetTree returns the parameters of a tree.
+func (s *Server) GetTree(ctx context.Context, req *trillian.GetTreeRequest) (*trillian.GetTreeResponse, error) {
+	tree, err := s.getTree(req.TreeId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.withMapRetention(tree); err != nil {
+		return nil, err
+	}
+	return &trillian.GetTreeResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_OK}, Tree: tree}, nil
+}
+
+// CreateTree creates an active tree with the requested parameters, choosing
+// its ID if it doesn't have one.
+func (s *Server) CreateTree(ctx context.Context, req *trillian.CreateTreeRequest) (*trillian.CreateTreeResponse, error) {
+	if req.Tree == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "no tree to create")
+	}
+	treeType, ok := treeTypes[req.Tree.TreeType]
+	if !ok {
+		return nil, grpc.Errorf(codes.InvalidArgument, "unsupported tree type %v", req.Tree.TreeType)
+	}
+	if req.Tree.TreeId < 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid tree ID %d", req.Tree.TreeId)
+	}
+	if len(req.Tree.KeyId) == 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "the tree must have a key ID")
+	}
+	if _, ok := trillian.SignatureAlgorithm_name[int32(req.Tree.SignatureAlgorithm)]; !ok {
+		return nil, grpc.Errorf(codes.InvalidArgument, "unsupported signature algorithm %v", req.Tree.SignatureAlgorithm)
+	}
+	policy := req.Tree.DuplicatePolicy
+	if _, ok := trillian.DuplicatePolicy_name[int32(policy)]; !ok {
+		return nil, grpc.Errorf(codes.InvalidArgument, "unsupported duplicate policy %v", policy)
+	}
+	// Allowing duplicate leaves is the same as the ALLOW_DUPLICATES policy
+	if req.Tree.AllowsDuplicateLeaves {
+		if policy == trillian.DuplicatePolicy_REJECT_DUPLICATES {
+			return nil, grpc.Errorf(codes.InvalidArgument, "a tree that allows duplicate leaves can't have duplicate policy %v", policy)
+		}
+		policy = trillian.DuplicatePolicy_ALLOW_DUPLICATES
+	}
+	tree := mysql.Tree{
+		TreeID:                req.Tree.TreeId,
+		KeyID:                 req.Tree.KeyId,
+		TreeType:              treeType,
+		HashAlgorithm:         req.Tree.HashAlgorithm,
+		HashStrategy:          req.Tree.HashStrategy,
+		SignatureAlgorithm:    req.Tree.SignatureAlgorithm,
+		AllowsDuplicateLeaves: policy == trillian.DuplicatePolicy_ALLOW_DUPLICATES,
+		DuplicatePolicy:       policy,
+	}
+	tree.HashPrefixes.Leaf = req.Tree.LeafHashPrefix
+	tree.HashPrefixes.Node = req.Tree.NodeHashPrefix
+	th, err := merkle.NewTreeHasherForStrategy(tree.HashStrategy, tree.HashAlgorithm, tree.HashPrefixes)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "invalid hashing parameters: %v", err)
+	}
+	if len(req.Tree.MapStrata) > 0 {
+		if treeType != mysql.MapTreeType {
+			return nil, grpc.Errorf(codes.InvalidArgument, "only maps have strata")
+		}
+		for _, depth := range req.Tree.MapStrata {
+			tree.MapStrata = append(tree.MapStrata, int(depth))
+		}
+		if err := cache.ValidateStrata(th.Size()*8, tree.MapStrata); err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "invalid map strata: %v", err)
+		}
+		if s.checkMapStrata != nil {
+			if err := s.checkMapStrata(tree.MapStrata); err != nil {
+				return nil, grpc.Errorf(codes.InvalidArgument, "invalid map strata: %v", err)
+			}
+		}
+	}
+	publicKey, err := s.publicKey(tree.KeyID, tree.SignatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	if tree.TreeID == 0 {
+		if tree.TreeID, err = s.newTreeID(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.storage.CreateTree(tree, mysql.DefaultTreeControl); err != nil {
+		glog.Warningf("Failed to create tree %d: %v", tree.TreeID, err)
+		return nil, err
+	}
+	if publicKey != nil {
+		if err := s.storage.AddTreeKey(tree.TreeID, mysql.TreeKey{KeyID: tree.KeyID, PublicKey: publicKey}); err != nil {
+			glog.Warningf("Failed to record public key of tree %d: %v", tree.TreeID, err)
+			return nil, err
+		}
+	}
+	glog.Infof("Created %s tree %d", tree.TreeType, tree.TreeID)
+	pb, err := s.toProto(tree, mysql.DefaultTreeControl)
+	if err != nil {
+		return nil, err
+	}
+	return &trillian.CreateTreeResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_OK}, Tree: pb}, nil
+}
+
+// UpdateTree adds a key to a tree and changes its state and, for a map, its
+// retention policy. The key is activated now or at the requested time, and
+// until then the tree's roots are signed with it as well as with the active
+// key, so clients can learn it before it's used. Frozen and archived trees are
+// made read only, and only logs can be drained.
+func (s *Server) UpdateTree(ctx context.Context, req *trillian.UpdateTreeRequest) (*trillian.UpdateTreeResponse, error) {
+	switch req.TreeState {
+	case trillian.TreeState_UNKNOWN_TREE_STATE, trillian.TreeState_ACTIVE, trillian.TreeState_FROZEN, trillian.TreeState_DRAINING, trillian.TreeState_ARCHIVED:
+	default:
+		return nil, grpc.Errorf(codes.InvalidArgument, "unsupported tree state %v", req.TreeState)
+	}
+	current, err := s.getUndeletedTree(req.TreeId)
+	if err != nil {
+		return nil, err
+	}
+	if req.TreeState == trillian.TreeState_DRAINING && current.TreeType == trillian.TreeType_MAP {
+		return nil, grpc.Errorf(codes.InvalidArgument, "map %d has no queued leaves to drain", req.TreeId)
+	}
+	var newKey *mysql.TreeKey
+	if len(req.KeyId) > 0 {
+		if newKey, err = s.newTreeKey(current, req.KeyId, req.KeyActivateTimeNanos); err != nil {
+			return nil, err
+		}
+	} else if req.KeyActivateTimeNanos != 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "a key activation time needs a key ID")
+	}
+	if r := req.MapRetention; r != nil {
+		switch {
+		case current.TreeType != trillian.TreeType_MAP:
+			return nil, grpc.Errorf(codes.InvalidArgument, "tree %d is a %v, only maps have a retention policy", req.TreeId, current.TreeType)
+		case r.MaxRevisions < 0 || r.MaxAgeSeconds < 0:
+			return nil, grpc.Errorf(codes.InvalidArgument, "map retention limits can't be negative")
+		case s.mapStorage == nil:
+			return nil, grpc.Errorf(codes.Unimplemented, "this server can't change map retention")
+		}
+	}
+
+	if newKey != nil {
+		if err := s.storage.AddTreeKey(req.TreeId, *newKey); err != nil {
+			return nil, err
+		}
+		glog.Infof("Added key %q to tree %d, activated at %v", newKey.KeyID, req.TreeId, time.Unix(0, newKey.ActivateTimeNanos))
+	}
+	if req.TreeState != trillian.TreeState_UNKNOWN_TREE_STATE {
+		control, err := s.treeControl(req.TreeId)
+		if err != nil {
+			return nil, err
+		}
+		control.SetTreeState(req.TreeState)
+		if err := s.storage.SetTreeControl(req.TreeId, control); err != nil {
+			return nil, err
+		}
+	}
+	if req.MapRetention != nil {
+		if err := s.setMapRetention(req.TreeId, req.MapRetention); err != nil {
+			return nil, err
+		}
+		glog.Infof("Set retention of map %d to %d revisions, %ds", req.TreeId, req.MapRetention.MaxRevisions, req.MapRetention.MaxAgeSeconds)
+	}
+	s.notifyTreeChanged(req.TreeId)
+
+	tree, err := s.getTree(req.TreeId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.withMapRetention(tree); err != nil {
+		return nil, err
+	}
+	glog.Infof("Updated tree %d, key %q, state %v", tree.TreeId, tree.KeyId, tree.TreeState)
+	return &trillian.UpdateTreeResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_OK}, Tree: tree}, nil
+}
+
+// newTreeKey checks that keyID can be added to tree, to be activated at
+// activateTimeNanos, or now if it's zero.
+func (s *Server) newTreeKey(tree *trillian.Tree, keyID string, activateTimeNanos int64) (*mysql.TreeKey, error) {
+	now := s.timeSource.Now().UnixNano()
+	if activateTimeNanos == 0 {
+		activateTimeNanos = now
+	}
+	if activateTimeNanos < now {
+		return nil, grpc.Errorf(codes.InvalidArgument, "key activation time %v is in the past", time.Unix(0, activateTimeNanos))
+	}
+	if n := len(tree.Keys); n > 0 && activateTimeNanos <= tree.Keys[n-1].ActivateTimeNanos {
+		return nil, grpc.Errorf(codes.InvalidArgument, "key activation time %v isn't after that of the tree's latest key, %v", time.Unix(0, activateTimeNanos), time.Unix(0, tree.Keys[n-1].ActivateTimeNanos))
+	}
+	// A tree's keys all sign with its signature algorithm
+	publicKey, err := s.publicKey(keyID, tree.SignatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &mysql.TreeKey{KeyID: keyID, PublicKey: publicKey, ActivateTimeNanos: activateTimeNanos}, nil
+}
+
+// DeleteTree soft deletes a tree. Its data is removed by a DeletedTreeGC once
+// the grace period has passed.
+func (s *Server) DeleteTree(ctx context.Context, req *trillian.DeleteTreeRequest) (*trillian.DeleteTreeResponse, error) {
+	if _, err := s.getUndeletedTree(req.TreeId); err != nil {
+		return nil, err
+	}
+	if err := s.storage.SoftDeleteTree(req.TreeId, s.timeSource.Now().UnixNano()); err != nil {
+		return nil, err
+	}
+	s.notifyTreeChanged(req.TreeId)
+	tree, err := s.getTree(req.TreeId)
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("Deleted tree %d", req.TreeId)
+	return &trillian.DeleteTreeResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_OK}, Tree: tree}, nil
+}
+
+// UndeleteTree reverses DeleteTree, if the tree's data hasn't been removed.
+func (s *Server) UndeleteTree(ctx context.Context, req *trillian.UndeleteTreeRequest) (*trillian.UndeleteTreeResponse, error) {
+	tree, err := s.getTree(req.TreeId)
+	if err != nil {
+		return nil, err
+	}
+	if !tree.Deleted {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "tree %d isn't deleted", req.TreeId)
+	}
+	if err := s.storage.UndeleteTree(req.TreeId); err != nil {
+		return nil, err
+	}
+	s.notifyTreeChanged(req.TreeId)
+	if tree, err = s.getTree(req.TreeId); err != nil {
+		return nil, err
+	}
+	glog.Infof("Undeleted tree %d", req.TreeId)
+	return &trillian.UndeleteTreeResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_OK}, Tree: tree}, nil
+}
+
+// checkQuotaEnabled returns an Unimplemented error if the server has no quota
+// limits to manage.
+func (s *Server) checkQuotaEnabled() error {
+	if s.quotaLimits == nil {
+		return grpc.Errorf(codes.Unimplemented, "quota isn't enabled on this server")
+	}
+	return nil
+}
+
+// checkQuotaSpec returns an InvalidArgument error if a tree ID or user is given
+// for a group that isn't limited by them.
+func checkQuotaSpec(group trillian.QuotaGroup, kind trillian.QuotaKind, treeID int64, user string) error {
+	if _, ok := trillian.QuotaGroup_name[int32(group)]; !ok {
+		return grpc.Errorf(codes.InvalidArgument, "unknown quota group %v", group)
+	}
+	if _, ok := trillian.QuotaKind_name[int32(kind)]; !ok {
+		return grpc.Errorf(codes.InvalidArgument, "unknown quota kind %v", kind)
+	}
+	if treeID < 0 {
+		return grpc.Errorf(codes.InvalidArgument, "invalid tree ID %d", treeID)
+	}
+	if treeID != 0 && group != trillian.QuotaGroup_TREE {
+		return grpc.Errorf(codes.InvalidArgument, "only TREE limits have a tree ID")
+	}
+	if len(user) > 0 && group != trillian.QuotaGroup_USER {
+		return grpc.Errorf(codes.InvalidArgument, "only USER limits have a user")
+	}
+	return nil
+}
+
+// ListQuotaLimits returns every quota limit.
+func (s *Server) ListQuotaLimits(ctx context.Context, req *trillian.ListQuotaLimitsRequest) (*trillian.ListQuotaLimitsResponse, error) {
+	if err := s.checkQuotaEnabled(); err != nil {
+		return nil, err
+	}
+	limits, err := s.quotaLimits.ListQuotaLimits()
+	if err != nil {
+		return nil, err
+	}
+	return &trillian.ListQuotaLimitsResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_OK}, Limit: limits}, nil
+}
+
+// SetQuotaLimit adds a quota limit, replacing any for the same requests.
+func (s *Server) SetQuotaLimit(ctx context.Context, req *trillian.SetQuotaLimitRequest) (*trillian.SetQuotaLimitResponse, error) {
+	if err := s.checkQuotaEnabled(); err != nil {
+		return nil, err
+	}
+	limit := req.Limit
+	if limit == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "no limit to set")
+	}
+	if err := checkQuotaSpec(limit.Group, limit.Kind, limit.TreeId, limit.User); err != nil {
+		return nil, err
+	}
+	if limit.TokensPerSecond < 0 || limit.Burst < 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "quota rate and burst can't be negative")
+	}
+	if err := s.quotaLimits.SetQuotaLimit(limit); err != nil {
+		return nil, err
+	}
+	glog.Infof("Set %v %v quota limit for tree %d, user %q to %v tokens/s, burst %d", limit.Group, limit.Kind, limit.TreeId, limit.User, limit.TokensPerSecond, limit.Burst)
+	return &trillian.SetQuotaLimitResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_OK}}, nil
+}
+
+// DeleteQuotaLimit removes a quota limit, if there is one.
+func (s *Server) DeleteQuotaLimit(ctx context.Context, req *trillian.DeleteQuotaLimitRequest) (*trillian.DeleteQuotaLimitResponse, error) {
+	if err := s.checkQuotaEnabled(); err != nil {
+		return nil, err
+	}
+	if err := checkQuotaSpec(req.Group, req.Kind, req.TreeId, req.User); err != nil {
+		return nil, err
+	}
+	if err := s.quotaLimits.DeleteQuotaLimit(req.Group, req.Kind, req.TreeId, req.User); err != nil {
+		return nil, err
+	}
+	glog.Infof("Deleted %v %v quota limit for tree %d, user %q", req.Group, req.Kind, req.TreeId, req.User)
+	return &trillian.DeleteQuotaLimitResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_OK}}, nil
+}
@@ -0,0 +1,703 @@
+package admin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto/keys"
+	"github.com/google/trillian/quota"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/memory"
+	"github.com/google/trillian/storage/mysql"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// fakeTreeStorage holds trees in memory, in the same way as
+// mysql.TreeAdminStorage holds them in the database.
+type fakeTreeStorage struct {
+	trees    map[int64]mysql.Tree
+	controls map[int64]mysql.TreeControl
+	keys     map[int64][]mysql.TreeKey
+}
+
+func newFakeTreeStorage() *fakeTreeStorage {
+	return &fakeTreeStorage{trees: make(map[int64]mysql.Tree), controls: make(map[int64]mysql.TreeControl), keys: make(map[int64][]mysql.TreeKey)}
+}
+
+func (f *fakeTreeStorage) CreateTree(tree mysql.Tree, control mysql.TreeControl) error {
+	if _, ok := f.trees[tree.TreeID]; ok {
+		return fmt.Errorf("tree %d already exists", tree.TreeID)
+	}
+	f.trees[tree.TreeID] = tree
+	f.controls[tree.TreeID] = control
+	return nil
+}
+
+func (f *fakeTreeStorage) GetTree(treeID int64) (mysql.Tree, error) {
+	tree, ok := f.trees[treeID]
+	if !ok {
+		return mysql.Tree{}, sql.ErrNoRows
+	}
+	return tree, nil
+}
+
+type byTreeID []mysql.Tree
+
+func (t byTreeID) Len() int           { return len(t) }
+func (t byTreeID) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t byTreeID) Less(i, j int) bool { return t[i].TreeID < t[j].TreeID }
+
+func (f *fakeTreeStorage) ListTrees() ([]mysql.Tree, error) {
+	var trees []mysql.Tree
+	for _, tree := range f.trees {
+		trees = append(trees, tree)
+	}
+	sort.Sort(byTreeID(trees))
+	return trees, nil
+}
+
+// getUndeletedTree returns storage.ErrTreeDeleted for deleted trees, as the
+// mysql storage does for changes to them.
+func (f *fakeTreeStorage) getUndeletedTree(treeID int64) (mysql.Tree, error) {
+	tree, err := f.GetTree(treeID)
+	if err != nil {
+		return mysql.Tree{}, err
+	}
+	if tree.Deleted {
+		return mysql.Tree{}, storage.ErrTreeDeleted
+	}
+	return tree, nil
+}
+
+func (f *fakeTreeStorage) AddTreeKey(treeID int64, key mysql.TreeKey) error {
+	tree, err := f.getUndeletedTree(treeID)
+	if err != nil {
+		return err
+	}
+	treeKeys, err := f.GetTreeKeys(treeID)
+	if err != nil {
+		return err
+	}
+	for i, k := range treeKeys {
+		if k.ActivateTimeNanos == key.ActivateTimeNanos {
+			treeKeys = append(treeKeys[:i], treeKeys[i+1:]...)
+			break
+		}
+	}
+	treeKeys = append(treeKeys, key)
+	sort.Sort(byActivateTime(treeKeys))
+	f.keys[treeID] = treeKeys
+	tree.KeyID = key.KeyID
+	f.trees[treeID] = tree
+	return nil
+}
+
+type byActivateTime []mysql.TreeKey
+
+func (k byActivateTime) Len() int           { return len(k) }
+func (k byActivateTime) Swap(i, j int)      { k[i], k[j] = k[j], k[i] }
+func (k byActivateTime) Less(i, j int) bool { return k[i].ActivateTimeNanos < k[j].ActivateTimeNanos }
+
+func (f *fakeTreeStorage) GetTreeKeys(treeID int64) ([]mysql.TreeKey, error) {
+	tree, err := f.GetTree(treeID)
+	if err != nil {
+		return nil, err
+	}
+	if treeKeys, ok := f.keys[treeID]; ok {
+		return append([]mysql.TreeKey(nil), treeKeys...), nil
+	}
+	return []mysql.TreeKey{{KeyID: tree.KeyID}}, nil
+}
+
+func (f *fakeTreeStorage) GetTreeControl(treeID int64) (mysql.TreeControl, bool, error) {
+	control, ok := f.controls[treeID]
+	return control, ok, nil
+}
+
+func (f *fakeTreeStorage) SetTreeControl(treeID int64, control mysql.TreeControl) error {
+	if _, err := f.getUndeletedTree(treeID); err != nil {
+		return err
+	}
+	f.controls[treeID] = control
+	return nil
+}
+
+func (f *fakeTreeStorage) SoftDeleteTree(treeID int64, timestampNanos int64) error {
+	tree, err := f.getUndeletedTree(treeID)
+	if err != nil {
+		return err
+	}
+	tree.Deleted, tree.DeleteTimeNanos = true, timestampNanos
+	f.trees[treeID] = tree
+	return nil
+}
+
+func (f *fakeTreeStorage) UndeleteTree(treeID int64) error {
+	tree, err := f.GetTree(treeID)
+	if err != nil {
+		return err
+	}
+	if !tree.Deleted {
+		return storage.ErrTreeNotDeleted
+	}
+	tree.Deleted, tree.DeleteTimeNanos = false, 0
+	f.trees[treeID] = tree
+	return nil
+}
+
+func (f *fakeTreeStorage) PurgeDeletedTree(treeID int64, deletedBeforeNanos int64, purgeData func() error) (bool, error) {
+	tree, ok := f.trees[treeID]
+	if !ok || !tree.Deleted || tree.DeleteTimeNanos >= deletedBeforeNanos {
+		return false, nil
+	}
+	if purgeData != nil {
+		if err := purgeData(); err != nil {
+			return false, err
+		}
+	}
+	delete(f.trees, treeID)
+	delete(f.controls, treeID)
+	delete(f.keys, treeID)
+	return true, nil
+}
+
+var fakeTime = time.Date(2016, 11, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestServer(s TreeStorage) *Server {
+	server := NewServer(s, util.FakeTimeSource{FakeTime: fakeTime})
+	server.SetSignatureAlgorithm(trillian.SignatureAlgorithm_ECDSA)
+	return server
+}
+
+func TestCreateTree(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		tree     *trillian.Tree
+		wantCode codes.Code
+		want     *trillian.Tree
+	}{
+		{
+			desc: "log",
+			tree: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key", TreeState: trillian.TreeState_FROZEN},
+			want: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key", TreeState: trillian.TreeState_ACTIVE, Keys: []*trillian.TreeKey{{KeyId: "key"}}},
+		},
+		{
+			desc: "map without ID",
+			tree: &trillian.Tree{TreeType: trillian.TreeType_MAP, KeyId: "key", HashStrategy: trillian.HashStrategy_LIE_SHA512_256},
+			want: &trillian.Tree{TreeId: 1234, TreeType: trillian.TreeType_MAP, KeyId: "key", HashStrategy: trillian.HashStrategy_LIE_SHA512_256, TreeState: trillian.TreeState_ACTIVE, Keys: []*trillian.TreeKey{{KeyId: "key"}}},
+		},
+		{
+			desc: "log rejecting duplicates",
+			tree: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key", DuplicatePolicy: trillian.DuplicatePolicy_REJECT_DUPLICATES},
+			want: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key", DuplicatePolicy: trillian.DuplicatePolicy_REJECT_DUPLICATES, TreeState: trillian.TreeState_ACTIVE, Keys: []*trillian.TreeKey{{KeyId: "key"}}},
+		},
+		{
+			desc: "log allowing duplicates",
+			tree: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key", AllowsDuplicateLeaves: true},
+			want: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key", AllowsDuplicateLeaves: true, DuplicatePolicy: trillian.DuplicatePolicy_ALLOW_DUPLICATES, TreeState: trillian.TreeState_ACTIVE, Keys: []*trillian.TreeKey{{KeyId: "key"}}},
+		},
+		{
+			desc: "log with allow duplicates policy",
+			tree: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key", DuplicatePolicy: trillian.DuplicatePolicy_ALLOW_DUPLICATES},
+			want: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key", AllowsDuplicateLeaves: true, DuplicatePolicy: trillian.DuplicatePolicy_ALLOW_DUPLICATES, TreeState: trillian.TreeState_ACTIVE, Keys: []*trillian.TreeKey{{KeyId: "key"}}},
+		},
+		{
+			desc: "pre-ordered log",
+			tree: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_PREORDERED_LOG, KeyId: "key"},
+			want: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_PREORDERED_LOG, KeyId: "key", TreeState: trillian.TreeState_ACTIVE, Keys: []*trillian.TreeKey{{KeyId: "key"}}},
+		},
+		{
+			desc: "map with strata",
+			tree: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_MAP, KeyId: "key", MapStrata: []int32{16, 8, 232}},
+			want: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_MAP, KeyId: "key", MapStrata: []int32{16, 8, 232}, TreeState: trillian.TreeState_ACTIVE, Keys: []*trillian.TreeKey{{KeyId: "key"}}},
+		},
+		{
+			desc:     "no tree",
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "unknown type",
+			tree:     &trillian.Tree{TreeId: 5, KeyId: "key"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "negative ID",
+			tree:     &trillian.Tree{TreeId: -5, TreeType: trillian.TreeType_LOG, KeyId: "key"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "no key",
+			tree:     &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "unknown signature algorithm",
+			tree:     &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key", SignatureAlgorithm: trillian.SignatureAlgorithm(100)},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "signature algorithm roots aren't signed with",
+			tree:     &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key", SignatureAlgorithm: trillian.SignatureAlgorithm_RSA},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "unknown duplicate policy",
+			tree:     &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key", DuplicatePolicy: trillian.DuplicatePolicy(100)},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "allowing and rejecting duplicates",
+			tree:     &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key", AllowsDuplicateLeaves: true, DuplicatePolicy: trillian.DuplicatePolicy_REJECT_DUPLICATES},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "invalid hashing",
+			tree:     &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key", HashAlgorithm: trillian.HashAlgorithm_SHA512, HashStrategy: trillian.HashStrategy_SHA512_256},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "log with strata",
+			tree:     &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key", MapStrata: []int32{8, 248}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "strata not adding up to map depth",
+			tree:     &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_MAP, KeyId: "key", MapStrata: []int32{8, 8}},
+			wantCode: codes.InvalidArgument,
+		},
+	} {
+		s := newTestServer(newFakeTreeStorage())
+		s.newTreeID = func() (int64, error) { return 1234, nil }
+
+		resp, err := s.CreateTree(context.Background(), &trillian.CreateTreeRequest{Tree: test.tree})
+		if test.wantCode != codes.OK {
+			if got := grpc.Code(err); got != test.wantCode {
+				t.Errorf("%s: CreateTree()=_, %v, want code %v", test.desc, err, test.wantCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: CreateTree()=_, %v, want no error", test.desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(resp.Tree, test.want) {
+			t.Errorf("%s: CreateTree()=%v, want %v", test.desc, resp.Tree, test.want)
+		}
+		got, err := s.GetTree(context.Background(), &trillian.GetTreeRequest{TreeId: test.want.TreeId})
+		if err != nil {
+			t.Errorf("%s: GetTree()=_, %v, want no error", test.desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Tree, test.want) {
+			t.Errorf("%s: GetTree()=%v, want %v", test.desc, got.Tree, test.want)
+		}
+	}
+}
+
+func TestCreateTreeUnknownSignatureAlgorithm(t *testing.T) {
+	// Without a key provider or signature algorithm the server can't check
+	// that roots will be signed as the tree says
+	s := NewServer(newFakeTreeStorage(), util.FakeTimeSource{FakeTime: fakeTime})
+	_, err := s.CreateTree(context.Background(), &trillian.CreateTreeRequest{Tree: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key"}})
+	if got, want := grpc.Code(err), codes.FailedPrecondition; got != want {
+		t.Errorf("CreateTree()=_, %v, want code %v", err, want)
+	}
+}
+
+func TestCreateTreeMapStrataCheck(t *testing.T) {
+	s := newTestServer(newFakeTreeStorage())
+	s.SetMapStrataCheck(func(strata []int) error {
+		if strata[0] != 8 {
+			return errors.New("top stratum isn't 8 levels")
+		}
+		return nil
+	})
+	for _, test := range []struct {
+		strata   []int32
+		wantCode codes.Code
+	}{
+		{strata: []int32{8, 248}, wantCode: codes.OK},
+		{strata: []int32{16, 240}, wantCode: codes.InvalidArgument},
+	} {
+		_, err := s.CreateTree(context.Background(), &trillian.CreateTreeRequest{Tree: &trillian.Tree{TreeType: trillian.TreeType_MAP, KeyId: "key", MapStrata: test.strata}})
+		if got := grpc.Code(err); got != test.wantCode {
+			t.Errorf("CreateTree(strata %v)=_, %v, want code %v", test.strata, err, test.wantCode)
+		}
+	}
+}
+
+func TestCreateTreeIDInUse(t *testing.T) {
+	s := newTestServer(newFakeTreeStorage())
+	req := &trillian.CreateTreeRequest{Tree: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key"}}
+	if _, err := s.CreateTree(context.Background(), req); err != nil {
+		t.Fatalf("CreateTree()=_, %v, want no error", err)
+	}
+	if _, err := s.CreateTree(context.Background(), req); err == nil {
+		t.Fatalf("CreateTree() with an ID in use succeeded, want error")
+	}
+}
+
+func TestUpdateTree(t *testing.T) {
+	fake := newFakeTreeStorage()
+	s := newTestServer(fake)
+	ctx := context.Background()
+	if _, err := s.CreateTree(ctx, &trillian.CreateTreeRequest{Tree: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key1"}}); err != nil {
+		t.Fatalf("CreateTree()=_, %v, want no error", err)
+	}
+	if _, err := s.CreateTree(ctx, &trillian.CreateTreeRequest{Tree: &trillian.Tree{TreeId: 7, TreeType: trillian.TreeType_MAP, KeyId: "key1"}}); err != nil {
+		t.Fatalf("CreateTree()=_, %v, want no error", err)
+	}
+	var changed []int64
+	s.SetTreeChangedFunc(func(treeID int64) { changed = append(changed, treeID) })
+
+	for _, test := range []struct {
+		desc      string
+		req       *trillian.UpdateTreeRequest
+		wantCode  codes.Code
+		wantKey   string
+		wantState trillian.TreeState
+		// wantReadOnly is whether the tree's requests are read only
+		wantReadOnly bool
+	}{
+		{
+			desc:         "freeze",
+			req:          &trillian.UpdateTreeRequest{TreeId: 5, TreeState: trillian.TreeState_FROZEN},
+			wantKey:      "key1",
+			wantState:    trillian.TreeState_FROZEN,
+			wantReadOnly: true,
+		},
+		{
+			desc:         "rotate key",
+			req:          &trillian.UpdateTreeRequest{TreeId: 5, KeyId: "key2"},
+			wantKey:      "key2",
+			wantState:    trillian.TreeState_FROZEN,
+			wantReadOnly: true,
+		},
+		{
+			desc:         "rotate key later",
+			req:          &trillian.UpdateTreeRequest{TreeId: 5, KeyId: "key3", KeyActivateTimeNanos: fakeTime.Add(time.Hour).UnixNano()},
+			wantKey:      "key2",
+			wantState:    trillian.TreeState_FROZEN,
+			wantReadOnly: true,
+		},
+		{
+			desc:     "key activated in the past",
+			req:      &trillian.UpdateTreeRequest{TreeId: 5, KeyId: "key4", KeyActivateTimeNanos: fakeTime.Add(-time.Second).UnixNano()},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "key activated before the latest key",
+			req:      &trillian.UpdateTreeRequest{TreeId: 5, KeyId: "key4", KeyActivateTimeNanos: fakeTime.Add(time.Minute).UnixNano()},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "activation time without key",
+			req:      &trillian.UpdateTreeRequest{TreeId: 5, KeyActivateTimeNanos: fakeTime.Add(2 * time.Hour).UnixNano()},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:      "unfreeze",
+			req:       &trillian.UpdateTreeRequest{TreeId: 5, TreeState: trillian.TreeState_ACTIVE},
+			wantKey:   "key2",
+			wantState: trillian.TreeState_ACTIVE,
+		},
+		{
+			desc:      "drain",
+			req:       &trillian.UpdateTreeRequest{TreeId: 5, TreeState: trillian.TreeState_DRAINING},
+			wantKey:   "key2",
+			wantState: trillian.TreeState_DRAINING,
+		},
+		{
+			desc:         "archive",
+			req:          &trillian.UpdateTreeRequest{TreeId: 5, TreeState: trillian.TreeState_ARCHIVED},
+			wantKey:      "key2",
+			wantState:    trillian.TreeState_ARCHIVED,
+			wantReadOnly: true,
+		},
+		{
+			desc:     "drain map",
+			req:      &trillian.UpdateTreeRequest{TreeId: 7, TreeState: trillian.TreeState_DRAINING},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "unknown state",
+			req:      &trillian.UpdateTreeRequest{TreeId: 5, TreeState: trillian.TreeState(100)},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "unknown tree",
+			req:      &trillian.UpdateTreeRequest{TreeId: 6, KeyId: "key2"},
+			wantCode: codes.NotFound,
+		},
+	} {
+		changed = nil
+		resp, err := s.UpdateTree(ctx, test.req)
+		if test.wantCode != codes.OK {
+			if got := grpc.Code(err); got != test.wantCode {
+				t.Errorf("%s: UpdateTree()=_, %v, want code %v", test.desc, err, test.wantCode)
+			}
+			if len(changed) != 0 {
+				t.Errorf("%s: UpdateTree() failed but reported trees %v changed", test.desc, changed)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: UpdateTree()=_, %v, want no error", test.desc, err)
+			continue
+		}
+		if want := []int64{test.req.TreeId}; !reflect.DeepEqual(changed, want) {
+			t.Errorf("%s: UpdateTree() reported trees %v changed, want %v", test.desc, changed, want)
+		}
+		if got := resp.Tree; got.KeyId != test.wantKey || got.TreeState != test.wantState {
+			t.Errorf("%s: UpdateTree()=%v, want key %q and state %v", test.desc, got, test.wantKey, test.wantState)
+		}
+		if got := fake.controls[5].ReadOnlyRequests; got != test.wantReadOnly {
+			t.Errorf("%s: UpdateTree() made requests read only: %v, want %v", test.desc, got, test.wantReadOnly)
+		}
+	}
+
+	// Every key is returned, so roots signed before the rotation can be verified
+	got, err := s.GetTree(ctx, &trillian.GetTreeRequest{TreeId: 5})
+	if err != nil {
+		t.Fatalf("GetTree()=_, %v, want no error", err)
+	}
+	wantKeys := []*trillian.TreeKey{
+		{KeyId: "key1"},
+		{KeyId: "key2", ActivateTimeNanos: fakeTime.UnixNano()},
+		{KeyId: "key3", ActivateTimeNanos: fakeTime.Add(time.Hour).UnixNano()},
+	}
+	if !reflect.DeepEqual(got.Tree.Keys, wantKeys) {
+		t.Errorf("GetTree() returned keys %v, want %v", got.Tree.Keys, wantKeys)
+	}
+}
+
+func TestUpdateMapRetention(t *testing.T) {
+	fake := newFakeTreeStorage()
+	s := newTestServer(fake)
+	ctx := context.Background()
+	if _, err := s.CreateTree(ctx, &trillian.CreateTreeRequest{Tree: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "key1"}}); err != nil {
+		t.Fatalf("CreateTree()=_, %v, want no error", err)
+	}
+	if _, err := s.CreateTree(ctx, &trillian.CreateTreeRequest{Tree: &trillian.Tree{TreeId: 7, TreeType: trillian.TreeType_MAP, KeyId: "key1"}}); err != nil {
+		t.Fatalf("CreateTree()=_, %v, want no error", err)
+	}
+	retention := &trillian.MapRetentionPolicy{MaxRevisions: 10, MaxAgeSeconds: 3600}
+
+	req := &trillian.UpdateTreeRequest{TreeId: 7, MapRetention: retention}
+	if _, err := s.UpdateTree(ctx, req); grpc.Code(err) != codes.Unimplemented {
+		t.Errorf("UpdateTree()=_, %v, want code %v without map storage", err, codes.Unimplemented)
+	}
+
+	db := memory.NewDatabase()
+	ms, err := memory.NewMapStorage(db, trillian.MapID{TreeID: 7})
+	if err != nil {
+		t.Fatalf("NewMapStorage()=_, %v", err)
+	}
+	s.SetMapStorage(func(treeID int64) (storage.MapStorage, error) {
+		if treeID != 7 {
+			return nil, fmt.Errorf("unexpected tree %d", treeID)
+		}
+		return ms, nil
+	})
+
+	for _, test := range []struct {
+		desc     string
+		req      *trillian.UpdateTreeRequest
+		wantCode codes.Code
+	}{
+		{
+			desc:     "log",
+			req:      &trillian.UpdateTreeRequest{TreeId: 5, MapRetention: retention},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "negative revisions",
+			req:      &trillian.UpdateTreeRequest{TreeId: 7, MapRetention: &trillian.MapRetentionPolicy{MaxRevisions: -1}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc:     "negative age",
+			req:      &trillian.UpdateTreeRequest{TreeId: 7, MapRetention: &trillian.MapRetentionPolicy{MaxAgeSeconds: -1}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			desc: "map",
+			req:  &trillian.UpdateTreeRequest{TreeId: 7, MapRetention: retention},
+		},
+	} {
+		resp, err := s.UpdateTree(ctx, test.req)
+		if got := grpc.Code(err); got != test.wantCode {
+			t.Errorf("%s: UpdateTree()=_, %v, want code %v", test.desc, err, test.wantCode)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := resp.Tree.MapRetention; !reflect.DeepEqual(got, retention) {
+			t.Errorf("%s: UpdateTree() returned retention %v, want %v", test.desc, got, retention)
+		}
+	}
+
+	resp, err := s.GetTree(ctx, &trillian.GetTreeRequest{TreeId: 7})
+	if err != nil {
+		t.Fatalf("GetTree()=_, %v, want no error", err)
+	}
+	if got := resp.Tree.MapRetention; !reflect.DeepEqual(got, retention) {
+		t.Errorf("GetTree() returned retention %v, want %v", got, retention)
+	}
+}
+func TestKeyProvider(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+	registry := keys.NewRegistry(nil)
+	registry.Register("test", keys.NewStaticProvider(key))
+	s := newTestServer(newFakeTreeStorage())
+	s.SetKeyProvider(registry)
+	ctx := context.Background()
+
+	if _, err := s.CreateTree(ctx, &trillian.CreateTreeRequest{Tree: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "missing:key"}}); grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("CreateTree() with unknown key=_, %v, want code %v", err, codes.InvalidArgument)
+	}
+	if _, err := s.CreateTree(ctx, &trillian.CreateTreeRequest{Tree: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "test:key1", SignatureAlgorithm: trillian.SignatureAlgorithm_ED25519}}); grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("CreateTree() with an ECDSA key and algorithm %v=_, %v, want code %v", trillian.SignatureAlgorithm_ED25519, err, codes.InvalidArgument)
+	}
+	resp, err := s.CreateTree(ctx, &trillian.CreateTreeRequest{Tree: &trillian.Tree{TreeId: 5, TreeType: trillian.TreeType_LOG, KeyId: "test:key1"}})
+	if err != nil {
+		t.Fatalf("CreateTree()=_, %v, want no error", err)
+	}
+	if want := []*trillian.TreeKey{{KeyId: "test:key1", PublicKeyDer: der}}; !reflect.DeepEqual(resp.Tree.Keys, want) {
+		t.Errorf("CreateTree() returned keys %v, want %v", resp.Tree.Keys, want)
+	}
+	if _, err := s.UpdateTree(ctx, &trillian.UpdateTreeRequest{TreeId: 5, KeyId: "missing:key"}); grpc.Code(err) != codes.InvalidArgument {
+		t.Errorf("UpdateTree() with unknown key=_, %v, want code %v", err, codes.InvalidArgument)
+	}
+	updated, err := s.UpdateTree(ctx, &trillian.UpdateTreeRequest{TreeId: 5, KeyId: "test:key2"})
+	if err != nil {
+		t.Fatalf("UpdateTree()=_, %v, want no error", err)
+	}
+	want := []*trillian.TreeKey{{KeyId: "test:key1", PublicKeyDer: der}, {KeyId: "test:key2", PublicKeyDer: der, ActivateTimeNanos: fakeTime.UnixNano()}}
+	if !reflect.DeepEqual(updated.Tree.Keys, want) {
+		t.Errorf("UpdateTree() returned keys %v, want %v", updated.Tree.Keys, want)
+	}
+}
+
+func TestListAndDeleteTrees(t *testing.T) {
+	s := newTestServer(newFakeTreeStorage())
+	ctx := context.Background()
+	for _, id := range []int64{7, 5, 6} {
+		if _, err := s.CreateTree(ctx, &trillian.CreateTreeRequest{Tree: &trillian.Tree{TreeId: id, TreeType: trillian.TreeType_MAP, KeyId: "key"}}); err != nil {
+			t.Fatalf("CreateTree(%d)=_, %v, want no error", id, err)
+		}
+	}
+	resp, err := s.DeleteTree(ctx, &trillian.DeleteTreeRequest{TreeId: 6})
+	if err != nil {
+		t.Fatalf("DeleteTree()=_, %v, want no error", err)
+	}
+	if !resp.Tree.Deleted || resp.Tree.DeleteTimeNanos != fakeTime.UnixNano() {
+		t.Errorf("DeleteTree()=%v, want tree deleted at %v", resp.Tree, fakeTime)
+	}
+	if _, err := s.DeleteTree(ctx, &trillian.DeleteTreeRequest{TreeId: 6}); grpc.Code(err) != codes.FailedPrecondition {
+		t.Errorf("DeleteTree() of deleted tree=_, %v, want code %v", err, codes.FailedPrecondition)
+	}
+	if _, err := s.DeleteTree(ctx, &trillian.DeleteTreeRequest{TreeId: 8}); grpc.Code(err) != codes.NotFound {
+		t.Errorf("DeleteTree() of unknown tree=_, %v, want code %v", err, codes.NotFound)
+	}
+	if _, err := s.UpdateTree(ctx, &trillian.UpdateTreeRequest{TreeId: 6, KeyId: "key2"}); grpc.Code(err) != codes.FailedPrecondition {
+		t.Errorf("UpdateTree() of deleted tree=_, %v, want code %v", err, codes.FailedPrecondition)
+	}
+
+	for _, test := range []struct {
+		showDeleted bool
+		want        []int64
+	}{
+		{showDeleted: false, want: []int64{5, 7}},
+		{showDeleted: true, want: []int64{5, 6, 7}},
+	} {
+		resp, err := s.ListTrees(ctx, &trillian.ListTreesRequest{ShowDeleted: test.showDeleted})
+		if err != nil {
+			t.Fatalf("ListTrees()=_, %v, want no error", err)
+		}
+		var ids []int64
+		for _, tree := range resp.Tree {
+			ids = append(ids, tree.TreeId)
+		}
+		if !reflect.DeepEqual(ids, test.want) {
+			t.Errorf("ListTrees(show deleted %v) returned trees %v, want %v", test.showDeleted, ids, test.want)
+		}
+	}
+
+	undeleted, err := s.UndeleteTree(ctx, &trillian.UndeleteTreeRequest{TreeId: 6})
+	if err != nil {
+		t.Fatalf("UndeleteTree()=_, %v, want no error", err)
+	}
+	if undeleted.Tree.Deleted || undeleted.Tree.DeleteTimeNanos != 0 {
+		t.Errorf("UndeleteTree()=%v, want undeleted tree", undeleted.Tree)
+	}
+	if _, err := s.UndeleteTree(ctx, &trillian.UndeleteTreeRequest{TreeId: 6}); grpc.Code(err) != codes.FailedPrecondition {
+		t.Errorf("UndeleteTree() of undeleted tree=_, %v, want code %v", err, codes.FailedPrecondition)
+	}
+	if _, err := s.UpdateTree(ctx, &trillian.UpdateTreeRequest{TreeId: 6, KeyId: "key2"}); err != nil {
+		t.Errorf("UpdateTree() of undeleted tree=_, %v, want no error", err)
+	}
+}
+
+func TestQuotaLimits(t *testing.T) {
+	s := newTestServer(newFakeTreeStorage())
+	ctx := context.Background()
+
+	if _, err := s.ListQuotaLimits(ctx, &trillian.ListQuotaLimitsRequest{}); grpc.Code(err) != codes.Unimplemented {
+		t.Fatalf("ListQuotaLimits() without quota=_, %v, want code %v", err, codes.Unimplemented)
+	}
+	s.SetQuotaLimits(quota.NewMemoryLimitStore())
+
+	tree := &trillian.QuotaLimit{Group: trillian.QuotaGroup_TREE, Kind: trillian.QuotaKind_WRITE, TreeId: 5, TokensPerSecond: 10, Burst: 100}
+	user := &trillian.QuotaLimit{Group: trillian.QuotaGroup_USER, Kind: trillian.QuotaKind_READ, User: "alice", TokensPerSecond: 1, Burst: 10}
+	for _, test := range []struct {
+		desc     string
+		limit    *trillian.QuotaLimit
+		wantCode codes.Code
+	}{
+		{desc: "tree", limit: tree},
+		{desc: "user", limit: user},
+		{desc: "no limit", wantCode: codes.InvalidArgument},
+		{desc: "global with tree", limit: &trillian.QuotaLimit{Group: trillian.QuotaGroup_GLOBAL, TreeId: 5}, wantCode: codes.InvalidArgument},
+		{desc: "tree with user", limit: &trillian.QuotaLimit{Group: trillian.QuotaGroup_TREE, TreeId: 5, User: "alice"}, wantCode: codes.InvalidArgument},
+		{desc: "unknown kind", limit: &trillian.QuotaLimit{Kind: trillian.QuotaKind(100)}, wantCode: codes.InvalidArgument},
+		{desc: "negative rate", limit: &trillian.QuotaLimit{TokensPerSecond: -1}, wantCode: codes.InvalidArgument},
+	} {
+		_, err := s.SetQuotaLimit(ctx, &trillian.SetQuotaLimitRequest{Limit: test.limit})
+		if got := grpc.Code(err); got != test.wantCode {
+			t.Errorf("%s: SetQuotaLimit()=_, %v, want code %v", test.desc, err, test.wantCode)
+		}
+	}
+
+	if _, err := s.DeleteQuotaLimit(ctx, &trillian.DeleteQuotaLimitRequest{Group: trillian.QuotaGroup_USER, Kind: trillian.QuotaKind_READ, User: "alice"}); err != nil {
+		t.Fatalf("DeleteQuotaLimit()=_, %v, want no error", err)
+	}
+	resp, err := s.ListQuotaLimits(ctx, &trillian.ListQuotaLimitsRequest{})
+	if err != nil {
+		t.Fatalf("ListQuotaLimits()=_, %v, want no error", err)
+	}
+	if want := []*trillian.QuotaLimit{tree}; !reflect.DeepEqual(resp.Limit, want) {
+		t.Errorf("ListQuotaLimits() returned %v, want %v", resp.Limit, want)
+	}
+}
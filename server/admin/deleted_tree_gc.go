@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/util"
+)
+
+// TreeDataDeleter removes the data of a tree from a database other than the
+// one holding its record, such as a storage backend the tree can be routed to
+// or a shard of a map. It's implemented by mysql.TreeAdminStorage.
+type TreeDataDeleter interface {
+	DeleteTree(treeID int64) error
+}
+
+// DeletedTreeGC removes the data of soft deleted trees once they've been
+// deleted for longer than a grace period, until then they can be undeleted.
+type DeletedTreeGC struct {
+	storage     TreeStorage
+	timeSource  util.TimeSource
+	gracePeriod time.Duration
+	// dataDeleters remove the data of purged trees from the other databases
+	dataDeleters []TreeDataDeleter
+}
+
+// NewDeletedTreeGC creates a DeletedTreeGC for the trees held by s, which
+// removes trees deleted more than gracePeriod ago according to timeSource.
+func NewDeletedTreeGC(s TreeStorage, timeSource util.TimeSource, gracePeriod time.Duration) *DeletedTreeGC {
+	return &DeletedTreeGC{storage: s, timeSource: timeSource, gracePeriod: gracePeriod}
+}
+
+// SetDataDeleters has the data of purged trees removed by each of d as well,
+// which should cover every database that trees can be routed to or sharded
+// across apart from the one holding their records. A tree that a database
+// doesn't hold is deleted from it without error.
+func (g *DeletedTreeGC) SetDataDeleters(d []TreeDataDeleter) {
+	g.dataDeleters = d
+}
+
+// purgeData removes the data of treeID from every database of dataDeleters.
+func (g *DeletedTreeGC) purgeData(treeID int64) error {
+	for _, d := range g.dataDeleters {
+		if err := d.DeleteTree(treeID); err != nil {
+			return fmt.Errorf("failed to remove data of tree %d: %v", treeID, err)
+		}
+	}
+	return nil
+}
+
+// RunOnce removes the data of every tree whose grace period has passed. It
+// returns the number of trees removed.
+func (g *DeletedTreeGC) RunOnce() (int, error) {
+	trees, err := g.storage.ListTrees()
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := g.timeSource.Now().Add(-g.gracePeriod).UnixNano()
+	purged := 0
+	for _, tree := range trees {
+		if !tree.Deleted || tree.DeleteTimeNanos >= cutoff {
+			continue
+		}
+		// The tree is checked again as it's purged, in case it's been undeleted
+		treeID := tree.TreeID
+		ok, err := g.storage.PurgeDeletedTree(treeID, cutoff, func() error { return g.purgeData(treeID) })
+		if err != nil {
+			return purged, err
+		}
+		if ok {
+			glog.Infof("Removed the data of tree %d, deleted at %v", tree.TreeID, time.Unix(0, tree.DeleteTimeNanos).UTC())
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// Run calls RunOnce every interval until done is closed.
+func (g *DeletedTreeGC) Run(done <-chan struct{}, interval time.Duration) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+
+		if _, err := g.RunOnce(); err != nil {
+			glog.Warningf("Deleted tree GC failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/storage/mysql"
+	"github.com/google/trillian/util"
+)
+
+func TestDeletedTreeGC(t *testing.T) {
+	s := newFakeTreeStorage()
+	for _, tree := range []mysql.Tree{
+		{TreeID: 1, TreeType: mysql.LogTreeType},
+		{TreeID: 2, TreeType: mysql.LogTreeType, Deleted: true, DeleteTimeNanos: fakeTime.Add(-2 * time.Hour).UnixNano()},
+		{TreeID: 3, TreeType: mysql.MapTreeType, Deleted: true, DeleteTimeNanos: fakeTime.Add(-30 * time.Minute).UnixNano()},
+	} {
+		if err := s.CreateTree(tree, mysql.DefaultTreeControl); err != nil {
+			t.Fatalf("CreateTree(%d)=%v, want no error", tree.TreeID, err)
+		}
+	}
+
+	ts := &util.FakeTimeSource{FakeTime: fakeTime}
+	gc := NewDeletedTreeGC(s, ts, time.Hour)
+	for _, test := range []struct {
+		now        time.Time
+		wantPurged int
+		wantTrees  []int64
+	}{
+		{now: fakeTime, wantPurged: 1, wantTrees: []int64{1, 3}},
+		{now: fakeTime, wantPurged: 0, wantTrees: []int64{1, 3}},
+		{now: fakeTime.Add(time.Hour), wantPurged: 1, wantTrees: []int64{1}},
+	} {
+		ts.FakeTime = test.now
+		purged, err := gc.RunOnce()
+		if err != nil {
+			t.Fatalf("RunOnce()=_, %v, want no error", err)
+		}
+		if purged != test.wantPurged {
+			t.Errorf("RunOnce() at %v purged %d trees, want %d", test.now, purged, test.wantPurged)
+		}
+		trees, err := s.ListTrees()
+		if err != nil {
+			t.Fatalf("ListTrees()=_, %v, want no error", err)
+		}
+		var ids []int64
+		for _, tree := range trees {
+			ids = append(ids, tree.TreeID)
+		}
+		if !reflect.DeepEqual(ids, test.wantTrees) {
+			t.Errorf("Trees after RunOnce() at %v are %v, want %v", test.now, ids, test.wantTrees)
+		}
+	}
+}
+
+// fakeDataDeleter records the trees whose data it's asked to delete.
+type fakeDataDeleter struct {
+	deleted []int64
+	err     error
+}
+
+func (f *fakeDataDeleter) DeleteTree(treeID int64) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.deleted = append(f.deleted, treeID)
+	return nil
+}
+
+func TestDeletedTreeGCDeletesData(t *testing.T) {
+	s := newFakeTreeStorage()
+	tree := mysql.Tree{TreeID: 2, TreeType: mysql.LogTreeType, Deleted: true, DeleteTimeNanos: fakeTime.Add(-2 * time.Hour).UnixNano()}
+	if err := s.CreateTree(tree, mysql.DefaultTreeControl); err != nil {
+		t.Fatalf("CreateTree()=%v, want no error", err)
+	}
+
+	backend := &fakeDataDeleter{}
+	shard := &fakeDataDeleter{err: errors.New("shard unavailable")}
+	gc := NewDeletedTreeGC(s, &util.FakeTimeSource{FakeTime: fakeTime}, time.Hour)
+	gc.SetDataDeleters([]TreeDataDeleter{backend, shard})
+
+	// The tree isn't removed until its data is removed from every database
+	if purged, err := gc.RunOnce(); err == nil || purged != 0 {
+		t.Fatalf("RunOnce()=%d, %v, want failure", purged, err)
+	}
+	if _, err := s.GetTree(tree.TreeID); err != nil {
+		t.Fatalf("GetTree() after failed purge=%v, want tree kept", err)
+	}
+
+	shard.err = nil
+	if purged, err := gc.RunOnce(); err != nil || purged != 1 {
+		t.Fatalf("RunOnce()=%d, %v, want 1 tree purged", purged, err)
+	}
+	for _, d := range []*fakeDataDeleter{backend, shard} {
+		if want := []int64{tree.TreeID}; !reflect.DeepEqual(d.deleted[len(d.deleted)-1:], want) {
+			t.Errorf("Data deleted for trees %v, want %v", d.deleted, want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/auth"
+	"github.com/google/trillian/client/discovery"
+	"github.com/google/trillian/gateway"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var httpPortFlag = flag.Int("http_port", 8095, "Port to serve HTTP/JSON requests on")
+var logServerFlag = flag.String("log_server", "", "host:port of the log server, or a host:port list or consul://, etcd:// or kubernetes:// service. If empty the log routes aren't served")
+var mapServerFlag = flag.String("map_server", "", "host:port of the map server, or a host:port list or consul://, etcd:// or kubernetes:// service. If empty the map routes aren't served")
+var rpcCAFileFlag = flag.String("rpc_ca_file", "", "If set, file containing the PEM encoded CA certificates that the log and map servers' certificates are checked against. Otherwise they're connected to without TLS")
+var rpcCertFileFlag = flag.String("rpc_cert_file", "", "If set with rpc_ca_file, file containing the PEM encoded certificate presented to the log and map servers. Its principal must be one of their forwarding_principals for clients to be charged quota rather than the gateway")
+var rpcKeyFileFlag = flag.String("rpc_key_file", "", "File containing the PEM encoded private key for rpc_cert_file")
+var tlsCertFileFlag = flag.String("tls_cert_file", "", "If set, file containing the PEM encoded certificate presented to HTTP clients, which must then use HTTPS")
+var tlsKeyFileFlag = flag.String("tls_key_file", "", "File containing the PEM encoded private key for tls_cert_file")
+var tlsClientCAFileFlag = flag.String("tls_client_ca_file", "", "If set with tls_cert_file, file containing the PEM encoded CA certificates that HTTP clients must present a certificate issued by. Requests are then forwarded for the certificate's common name rather than the client's host")
+
+// dial connects to the log or map server at target.
+func dial(target string) (*grpc.ClientConn, error) {
+	opt := grpc.WithInsecure()
+	switch {
+	case len(*rpcCertFileFlag) > 0:
+		if len(*rpcCAFileFlag) == 0 {
+			return nil, errors.New("rpc_cert_file requires rpc_ca_file")
+		}
+		config, err := auth.ClientTLSConfig(*rpcCertFileFlag, *rpcKeyFileFlag, *rpcCAFileFlag)
+		if err != nil {
+			return nil, err
+		}
+		opt = grpc.WithTransportCredentials(credentials.NewTLS(config))
+	case len(*rpcCAFileFlag) > 0:
+		creds, err := credentials.NewClientTLSFromFile(*rpcCAFileFlag, "")
+		if err != nil {
+			return nil, err
+		}
+		opt = grpc.WithTransportCredentials(creds)
+	}
+	return discovery.DialTarget(target, opt)
+}
+
+// tlsConfig returns the TLS configuration selected by the flags, or nil if
+// HTTP clients are served without TLS.
+func tlsConfig() (*tls.Config, error) {
+	if len(*tlsCertFileFlag) == 0 {
+		return nil, nil
+	}
+	if len(*tlsClientCAFileFlag) > 0 {
+		return auth.ServerTLSConfig(*tlsCertFileFlag, *tlsKeyFileFlag, *tlsClientCAFileFlag, true)
+	}
+	cert, err := tls.LoadX509KeyPair(*tlsCertFileFlag, *tlsKeyFileFlag)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+func main() {
+	flag.Parse()
+
+	if len(*logServerFlag) == 0 && len(*mapServerFlag) == 0 {
+		glog.Fatal("Neither log_server nor map_server given")
+	}
+	var logClient trillian.TrillianLogClient
+	if len(*logServerFlag) > 0 {
+		conn, err := dial(*logServerFlag)
+		if err != nil {
+			glog.Fatalf("Failed to dial log server: %v", err)
+		}
+		defer conn.Close()
+		logClient = trillian.NewTrillianLogClient(conn)
+	}
+	var mapClient trillian.TrillianMapClient
+	if len(*mapServerFlag) > 0 {
+		conn, err := dial(*mapServerFlag)
+		if err != nil {
+			glog.Fatalf("Failed to dial map server: %v", err)
+		}
+		defer conn.Close()
+		mapClient = trillian.NewTrillianMapClient(conn)
+	}
+
+	handler, err := gateway.NewHandler(logClient, mapClient)
+	if err != nil {
+		glog.Fatalf("Failed to create handler: %v", err)
+	}
+
+	config, err := tlsConfig()
+	if err != nil {
+		glog.Fatalf("Failed to load TLS configuration: %v", err)
+	}
+	glog.Infof("Creating HTTP server starting on port: %d", *httpPortFlag)
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *httpPortFlag))
+	if err != nil {
+		glog.Errorf("Failed to listen on the HTTP port: %d, because: %v", *httpPortFlag, err)
+		os.Exit(1)
+	}
+	if config != nil {
+		lis = tls.NewListener(lis, config)
+	}
+	httpServer := &http.Server{Handler: handler}
+
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-sigs
+		glog.Infof("Signal received: %v", sig)
+		lis.Close()
+	}()
+
+	if err := httpServer.Serve(lis); err != nil {
+		glog.Infof("HTTP server on port %d stopped: %v", *httpPortFlag, err)
+	}
+	glog.Infof("Stopping server, about to exit")
+}
@@ -1,11 +1,14 @@
 package server
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian"
 	"github.com/google/trillian/util"
+	"github.com/google/trillian/util/election"
+	"golang.org/x/net/context"
 )
 
 // LogOperation defines a task that operates on logs. Examples are scheduling, signing,
@@ -31,6 +34,14 @@ type LogOperationManagerContext struct {
 	oneShot bool
 	// timeSource allows us to mock this in tests
 	timeSource util.TimeSource
+	// electionFactory creates the mastership election for each log, if set only
+	// the logs this instance is master for are operated on
+	electionFactory election.Factory
+	// elections holds the running election for each log, keyed by tree ID
+	elections map[int64]election.MasterElection
+	// resignations receives the tree IDs whose mastership should be given up
+	// after the current pass, zero meaning every log
+	resignations chan int64
 }
 
 // LogOperationManager controls scheduling activities for logs. At the moment it's very simple
@@ -53,6 +64,107 @@ func NewLogOperationManagerForTest(done chan struct{}, sp LogStorageProviderFunc
 	return &LogOperationManager{context: LogOperationManagerContext{done: done, storageProvider: sp, batchSize: batchSize, sleepBetweenRuns: sleepBetweenRuns, signInterval: signInterval, timeSource: timeSource, oneShot: true}, logOperation: logOperation}
 }
 
+// NewLogOperationManagerWithElection creates a new LogOperationManager instance which
+// only operates on the logs that this instance wins the mastership election for.
+func NewLogOperationManagerWithElection(done chan struct{}, sp LogStorageProviderFunc, batchSize int, sleepBetweenRuns time.Duration, signInterval time.Duration, timeSource util.TimeSource, electionFactory election.Factory, logOperation LogOperation) *LogOperationManager {
+	lom := NewLogOperationManager(done, sp, batchSize, sleepBetweenRuns, signInterval, timeSource, logOperation)
+	lom.context.electionFactory = electionFactory
+	lom.context.elections = make(map[int64]election.MasterElection)
+	lom.context.resignations = make(chan int64, maxPendingResignations)
+	return lom
+}
+
+// maxPendingResignations is how many resignation requests can wait for the
+// current pass to finish.
+const maxPendingResignations = 100
+
+// ResignMastership asks the manager to give up mastership of the log with
+// treeID, or of every log if treeID is zero, once the current pass is complete.
+// Other instances can then take over the logs straight away, rather than
+// waiting for mastership to expire, which is useful for rebalancing logs
+// between instances. This instance campaigns again later, so logs that no
+// other instance takes over are sequenced again. It returns false if the
+// manager has no elections or has too many requests pending.
+func (l *LogOperationManager) ResignMastership(treeID int64) bool {
+	if l.context.resignations == nil {
+		return false
+	}
+	select {
+	case l.context.resignations <- treeID:
+		return true
+	default:
+		return false
+	}
+}
+
+// resign gives up mastership of the logs asked for since the last pass.
+func (l LogOperationManager) resign() {
+	for {
+		select {
+		case treeID := <-l.context.resignations:
+			for id, e := range l.context.elections {
+				if treeID != 0 && id != treeID {
+					continue
+				}
+				if err := e.Resign(context.Background()); err != nil {
+					glog.Warningf("%d: failed to resign mastership: %v", id, err)
+					continue
+				}
+				glog.Infof("%d: resigned mastership", id)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// masterLogs returns the logs in logIDs that this instance is master for,
+// starting elections for any logs that don't have one yet.
+func (l LogOperationManager) masterLogs(logIDs []trillian.LogID) []trillian.LogID {
+	if l.context.electionFactory == nil {
+		return logIDs
+	}
+
+	ctx := context.Background()
+	masterFor := make([]trillian.LogID, 0, len(logIDs))
+	for _, logID := range logIDs {
+		e, ok := l.context.elections[logID.TreeID]
+		if !ok {
+			var err error
+			e, err = l.context.electionFactory.NewElection(ctx, strconv.FormatInt(logID.TreeID, 10))
+			if err != nil {
+				glog.Warningf("%d: failed to create election: %v", logID.TreeID, err)
+				continue
+			}
+			if err := e.Start(ctx); err != nil {
+				glog.Warningf("%d: failed to start election: %v", logID.TreeID, err)
+				continue
+			}
+			l.context.elections[logID.TreeID] = e
+		}
+
+		master, err := e.IsMaster(ctx)
+		if err != nil {
+			glog.Warningf("%d: failed to check mastership: %v", logID.TreeID, err)
+			continue
+		}
+		if master {
+			masterFor = append(masterFor, logID)
+		}
+	}
+	return masterFor
+}
+
+// closeElections stops campaigning for all logs, giving up any mastership held.
+func (l LogOperationManager) closeElections() {
+	for treeID, e := range l.context.elections {
+		if err := e.Close(context.Background()); err != nil {
+			glog.Warningf("%d: failed to close election: %v", treeID, err)
+		}
+		delete(l.context.elections, treeID)
+	}
+}
+
 func (l LogOperationManager) getLogsAndExecutePass() bool {
 	// TODO(Martin2112) using log ID zero because we don't have an id for metadata ops
 	// this API could improved
@@ -85,8 +197,8 @@ func (l LogOperationManager) getLogsAndExecutePass() bool {
 		return false
 	}
 
-	// Process each active log once, exit if we've seen a quit signal
-	quit := l.logOperation.ExecutePass(logIDs, l.context)
+	// Process each active log we're master for once, exit if we've seen a quit signal
+	quit := l.logOperation.ExecutePass(l.masterLogs(logIDs), l.context)
 	if quit {
 		glog.Infof("Log operation manager shutting down")
 	}
@@ -94,22 +206,32 @@ func (l LogOperationManager) getLogsAndExecutePass() bool {
 	return quit
 }
 
-// OperationLoop starts the manager working. It continues until told to exit.
+// OperationLoop starts the manager working. It continues until told to exit,
+// when it finishes the work in progress and then gives up any mastership held.
 // TODO(Martin2112): No mechanism for error reporting etc., this is OK for v1 but needs work
 func (l LogOperationManager) OperationLoop() {
 	glog.Infof("Log operation manager starting")
 
 	// Outer loop, runs until terminated
 	for {
-		// Wait for the configured time before going for another pass
-		time.Sleep(l.context.sleepBetweenRuns)
+		// Wait for the configured time before going for another pass, unless
+		// told to exit in the meantime
+		select {
+		case <-l.context.done:
+			glog.Infof("Log operation manager shutting down")
+			l.closeElections()
+			return
+		case <-time.After(l.context.sleepBetweenRuns):
+		}
 
 		quit := l.getLogsAndExecutePass()
 
 		glog.Infof("Log operation manager pass complete")
+		l.resign()
 
 		// We might want to bail out early when testing
 		if quit || l.context.oneShot {
+			l.closeElections()
 			return
 		}
 	}
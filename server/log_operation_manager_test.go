@@ -3,12 +3,15 @@ package server
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/google/trillian"
 	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util/election"
+	"golang.org/x/net/context"
 )
 
 func TestLogOperationManagerBeginFails(t *testing.T) {
@@ -100,3 +103,132 @@ func TestLogOperationManagerPassesIDs(t *testing.T) {
 
 	lom.OperationLoop()
 }
+
+// fakeElectionFactory creates elections which are won for the trees in master.
+type fakeElectionFactory struct {
+	master   map[string]bool
+	resigned map[string]bool
+	closed   map[string]bool
+}
+
+func (f *fakeElectionFactory) NewElection(ctx context.Context, resourceID string) (election.MasterElection, error) {
+	return &fakeElection{f: f, resourceID: resourceID}, nil
+}
+
+type fakeElection struct {
+	f          *fakeElectionFactory
+	resourceID string
+}
+
+func (e *fakeElection) Start(ctx context.Context) error {
+	return nil
+}
+
+func (e *fakeElection) IsMaster(ctx context.Context) (bool, error) {
+	return e.f.master[e.resourceID], nil
+}
+
+func (e *fakeElection) WaitForMastership(ctx context.Context) error {
+	return nil
+}
+
+func (e *fakeElection) Resign(ctx context.Context) error {
+	e.f.resigned[e.resourceID] = true
+	return nil
+}
+
+func (e *fakeElection) Close(ctx context.Context) error {
+	e.f.closed[e.resourceID] = true
+	return nil
+}
+
+func TestLogOperationManagerOnlyPassesMasterIDs(t *testing.T) {
+	logID1 := trillian.LogID{TreeID: 451, LogID: []byte("id")}
+	logID2 := trillian.LogID{TreeID: 145, LogID: []byte("id2")}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTx := storage.NewMockLogTX(ctrl)
+	mockTx.EXPECT().GetActiveLogIDs().Return([]trillian.LogID{logID1, logID2}, nil)
+	mockTx.EXPECT().Commit().AnyTimes().Return(nil)
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+
+	mockLogOp := NewMockLogOperation(ctrl)
+	mockLogOp.EXPECT().ExecutePass([]trillian.LogID{logID2}, logOpMgrContextMatcher{50}).Return(false)
+
+	factory := &fakeElectionFactory{master: map[string]bool{"145": true}, resigned: make(map[string]bool), closed: make(map[string]bool)}
+	done := make(chan struct{})
+	lom := NewLogOperationManagerWithElection(done, mockStorageProviderForSequencer(mockStorage), 50, time.Second, time.Second, fakeTimeSource, factory, mockLogOp)
+	lom.context.oneShot = true
+
+	lom.OperationLoop()
+
+	// Mastership is given up when the manager exits
+	if want := map[string]bool{"451": true, "145": true}; !reflect.DeepEqual(factory.closed, want) {
+		t.Fatalf("Closed elections %v, want %v", factory.closed, want)
+	}
+}
+
+func TestLogOperationManagerResignsAfterPass(t *testing.T) {
+	logID1 := trillian.LogID{TreeID: 451, LogID: []byte("id")}
+	logID2 := trillian.LogID{TreeID: 145, LogID: []byte("id2")}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTx := storage.NewMockLogTX(ctrl)
+	mockTx.EXPECT().GetActiveLogIDs().Return([]trillian.LogID{logID1, logID2}, nil)
+	mockTx.EXPECT().Commit().AnyTimes().Return(nil)
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+
+	mockLogOp := NewMockLogOperation(ctrl)
+	mockLogOp.EXPECT().ExecutePass([]trillian.LogID{logID1, logID2}, logOpMgrContextMatcher{50}).Return(false)
+
+	factory := &fakeElectionFactory{master: map[string]bool{"451": true, "145": true}, resigned: make(map[string]bool), closed: make(map[string]bool)}
+	done := make(chan struct{})
+	lom := NewLogOperationManagerWithElection(done, mockStorageProviderForSequencer(mockStorage), 50, time.Second, time.Second, fakeTimeSource, factory, mockLogOp)
+	lom.context.oneShot = true
+
+	// The request is handled once the pass has operated on both logs
+	if !lom.ResignMastership(451) {
+		t.Fatalf("ResignMastership rejected the request")
+	}
+	lom.OperationLoop()
+
+	if want := map[string]bool{"451": true}; !reflect.DeepEqual(factory.resigned, want) {
+		t.Fatalf("Resigned elections %v, want %v", factory.resigned, want)
+	}
+}
+
+func TestLogOperationManagerResignWithoutElections(t *testing.T) {
+	lom := NewLogOperationManager(make(chan struct{}), nil, 50, time.Second, time.Second, fakeTimeSource, nil)
+	if lom.ResignMastership(0) {
+		t.Fatalf("ResignMastership accepted a request without elections")
+	}
+}
+
+func TestLogOperationManagerExitsWhileSleeping(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// No pass is made, as the manager is told to exit before its first one
+	mockLogOp := NewMockLogOperation(ctrl)
+
+	done := make(chan struct{})
+	lom := NewLogOperationManager(done, nil, 50, time.Hour, time.Second, fakeTimeSource, mockLogOp)
+	exited := make(chan struct{})
+	go func() {
+		lom.OperationLoop()
+		close(exited)
+	}()
+	close(done)
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("OperationLoop didn't exit after done was closed")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/client/discovery"
+	"github.com/google/trillian/mapper"
+	"google.golang.org/grpc"
+)
+
+var logServerFlag = flag.String("log_server", "", "host:port of the log server holding the source log, or a host:port list or consul://, etcd:// or kubernetes:// service")
+var logIDFlag = flag.Int64("log_id", 0, "Tree ID of the log to map from")
+var mapServerFlag = flag.String("map_server", "", "host:port of the map server holding the map, or a host:port list or consul://, etcd:// or kubernetes:// service")
+var mapIDFlag = flag.Int64("map_id", 0, "Tree ID of the map to write to. It must be initialized, and not be written to by anything else")
+var transformFlag = flag.String("transform", "leaf_data_by_hash", "Name of the function turning each log leaf into map updates. leaf_data_by_hash maps the Merkle leaf hash of each leaf to its data")
+var batchSizeFlag = flag.Int("batch_size", mapper.DefaultBatchSize, "Max number of log leaves mapped in each map revision")
+var pollIntervalFlag = flag.Duration("poll_interval", 10*time.Second, "Time to wait for new log leaves once the map has caught up with the log, or after a failure")
+
+func main() {
+	flag.Parse()
+
+	transform, err := mapper.GetTransform(*transformFlag)
+	if err != nil {
+		glog.Fatalf("Invalid transform: %v", err)
+	}
+
+	logConn, err := discovery.DialTarget(*logServerFlag, grpc.WithInsecure())
+	if err != nil {
+		glog.Fatalf("Failed to dial log server: %v", err)
+	}
+	defer logConn.Close()
+	mapConn, err := discovery.DialTarget(*mapServerFlag, grpc.WithInsecure())
+	if err != nil {
+		glog.Fatalf("Failed to dial map server: %v", err)
+	}
+	defer mapConn.Close()
+
+	m := mapper.New(trillian.NewTrillianLogClient(logConn), *logIDFlag, trillian.NewTrillianMapClient(mapConn), *mapIDFlag, transform)
+	m.SetBatchSize(*batchSizeFlag)
+
+	done := make(chan struct{})
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-sigs
+		glog.Infof("Signal received: %v", sig)
+		close(done)
+	}()
+
+	glog.Infof("Mapping log %d to map %d", *logIDFlag, *mapIDFlag)
+	m.Run(done, *pollIntervalFlag)
+}
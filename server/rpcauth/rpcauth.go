@@ -0,0 +1,61 @@
+// Package rpcauth holds the flags, shared by the log and map servers, that set
+// up TLS for their RPC clients and restrict the RPCs each client may make.
+package rpcauth
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+
+	"github.com/google/trillian/auth"
+)
+
+var adminAllowUnauthenticatedFlag = flag.Bool("admin_allow_unauthenticated", false, "If true the TrillianAdmin service is served without admin_principals, so any client can change trees. The port mustn't then be reachable by untrusted clients")
+var tlsCertFileFlag = flag.String("tls_cert_file", "", "If set, file containing the PEM encoded certificate presented to RPC clients, which must then connect with TLS and are identified by their certificates")
+var tlsKeyFileFlag = flag.String("tls_key_file", "", "File containing the PEM encoded private key for tls_cert_file")
+var tlsClientCAFileFlag = flag.String("tls_client_ca_file", "", "File containing the PEM encoded CA certificates that client certificates must be issued by, required with tls_cert_file")
+var requireClientCertFlag = flag.Bool("require_client_cert", true, "If false, clients without a certificate are also accepted when tls_cert_file is set. They have no identity, so can't make the RPCs restricted by admin_principals or write_principals")
+var principalsFlag = flag.String("principals", "", "Comma separated list of identity=principal pairs, mapping the common names of client certificates to the principals they're authorized and charged quota as. Other identities are their own principal")
+var adminPrincipalsFlag = flag.String("admin_principals", "", "If set, comma separated list of the principals allowed to call the TrillianAdmin service. Requires tls_cert_file")
+var writePrincipalsFlag = flag.String("write_principals", "", "If set, comma separated list of the principals allowed to call the RPCs that change trees. Requires tls_cert_file")
+var forwardingPrincipalsFlag = flag.String("forwarding_principals", "", "Comma separated list of the principals, such as the HTTP gateway, that make requests for their own clients and are trusted to name them in the x-trillian-forwarded-user metadata. Those clients are charged per user quota rather than the principal. Requires tls_cert_file")
+
+// Principals returns the mapping of client identities to principals given by
+// the principals flag.
+func Principals() (auth.Principals, error) {
+	return auth.ParsePrincipals(*principalsFlag)
+}
+
+// Forwarders returns the forwarding_principals, which may name the users they
+// make requests for.
+func Forwarders() map[string]bool {
+	return auth.ParseList(*forwardingPrincipalsFlag)
+}
+
+// CheckAdminService returns an error if the TrillianAdmin service would be
+// served to any client without admin_allow_unauthenticated being set.
+func CheckAdminService() error {
+	if len(*adminPrincipalsFlag) == 0 && !*adminAllowUnauthenticatedFlag {
+		return errors.New("enable_admin_service needs admin_principals, or admin_allow_unauthenticated to let any client change trees")
+	}
+	return nil
+}
+
+// New returns the TLS configuration of the RPC server and the policy
+// restricting its RPCs, which are nil if they're not enabled by the flags.
+func New(principals auth.Principals) (*tls.Config, *auth.Policy, error) {
+	if len(*tlsCertFileFlag) == 0 {
+		if len(*adminPrincipalsFlag) > 0 || len(*writePrincipalsFlag) > 0 || len(*forwardingPrincipalsFlag) > 0 {
+			return nil, nil, errors.New("admin_principals, write_principals and forwarding_principals require tls_cert_file")
+		}
+		return nil, nil, nil
+	}
+	tlsConfig, err := auth.ServerTLSConfig(*tlsCertFileFlag, *tlsKeyFileFlag, *tlsClientCAFileFlag, *requireClientCertFlag)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(*adminPrincipalsFlag) == 0 && len(*writePrincipalsFlag) == 0 {
+		return tlsConfig, nil, nil
+	}
+	return tlsConfig, &auth.Policy{Principals: principals, Admins: auth.ParseList(*adminPrincipalsFlag), Writers: auth.ParseList(*writePrincipalsFlag)}, nil
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -8,12 +9,39 @@ import (
 	"github.com/google/trillian/crypto"
 	"github.com/google/trillian/log"
 	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/monitoring/trace"
+	"github.com/google/trillian/storage"
 	"github.com/google/trillian/util"
 )
 
 // SequencerManager provides sequencing operations for a collection of Logs.
 type SequencerManager struct {
 	keyManager crypto.KeyManager
+	// rootSigner signs new roots if set, instead of keyManager's signer
+	rootSigner crypto.LogRootSigner
+	// rootSigners returns the signer of each log's new roots if set, instead
+	// of using rootSigner or keyManager for every log
+	rootSigners RootSignerFunc
+	// concurrency is how many logs are sequenced at once
+	concurrency int
+	// maxBatchesPerPass is how many batches of a log with a backlog of leaves
+	// can be sequenced in each pass
+	maxBatchesPerPass int
+	// passes is the number of passes started, which sets the log each one
+	// starts with
+	passes int
+	// maxClockSkew is passed to the sequencers, see Sequencer.SetMaxClockSkew
+	maxClockSkew time.Duration
+	// guardWindow is passed to the sequencers of logs without a sequence guard
+	// of their own, see Sequencer.SetGuardWindow
+	guardWindow time.Duration
+	// metrics is passed to the sequencers, see Sequencer.SetMetrics
+	metrics *log.SequencerMetrics
+	// mergeDelays is passed to the sequencers, see
+	// Sequencer.SetMergeDelayMonitor
+	mergeDelays *log.MergeDelayMonitor
+	// tracer is passed to the sequencers, see Sequencer.SetTracer
+	tracer *trace.Tracer
 }
 
 func isRootTooOld(ts util.TimeSource, maxAge time.Duration) log.CurrentRootExpiredFunc {
@@ -25,58 +53,282 @@ func isRootTooOld(ts util.TimeSource, maxAge time.Duration) log.CurrentRootExpir
 	}
 }
 
+// RootSignerFunc returns the signer of the roots of the log treeID.
+type RootSignerFunc func(treeID int64) (crypto.LogRootSigner, error)
+
 // NewSequencerManager creates a new SequencerManager instance based on the provided KeyManager instance.
 func NewSequencerManager(km crypto.KeyManager) *SequencerManager {
 	return &SequencerManager{keyManager: km}
 }
 
+// NewSequencerManagerWithRootSigner creates a new SequencerManager instance which
+// has new roots signed by rootSigner, such as a client of a remote signing service.
+// Up to concurrency logs are sequenced at once, so that a rootSigner which batches
+// signings can sign the roots of several logs together.
+func NewSequencerManagerWithRootSigner(rootSigner crypto.LogRootSigner, concurrency int) *SequencerManager {
+	return &SequencerManager{rootSigner: rootSigner, concurrency: concurrency}
+}
+
+// NewSequencerManagerWithRootSigners creates a new SequencerManager instance
+// which has the roots of each log signed by the signer that f returns for it,
+// such as one using a key of the log's own held in a hardware security module.
+func NewSequencerManagerWithRootSigners(f RootSignerFunc) *SequencerManager {
+	return &SequencerManager{rootSigners: f}
+}
+
+// SetConcurrency sets how many logs are sequenced at once.
+func (s *SequencerManager) SetConcurrency(n int) {
+	s.concurrency = n
+}
+
+// SetMaxBatchesPerPass lets a log whose batch was full be sequenced up to n
+// times in each pass, taking turns with the other logs, so that a backlog of
+// leaves is integrated without waiting for the following passes.
+func (s *SequencerManager) SetMaxBatchesPerPass(n int) {
+	s.maxBatchesPerPass = n
+}
+
+// SetMaxClockSkew sets how far the timestamps of new roots may be behind those
+// of the current roots, see log.Sequencer.SetMaxClockSkew.
+func (s *SequencerManager) SetMaxClockSkew(d time.Duration) {
+	s.maxClockSkew = d
+}
+
+// SetGuardWindow sets how long leaves must have been queued for before they're
+// sequenced, for logs that don't set their own sequence guard. See
+// log.Sequencer.SetGuardWindow.
+func (s *SequencerManager) SetGuardWindow(d time.Duration) {
+	s.guardWindow = d
+}
+
+// SetMetrics sets the metrics recording the work of the sequencers, see
+// log.Sequencer.SetMetrics.
+func (s *SequencerManager) SetMetrics(m *log.SequencerMetrics) {
+	s.metrics = m
+}
+
+// SetMergeDelayMonitor sets the monitor told how long leaves wait to be
+// integrated into each log, see log.Sequencer.SetMergeDelayMonitor.
+func (s *SequencerManager) SetMergeDelayMonitor(m *log.MergeDelayMonitor) {
+	s.mergeDelays = m
+}
+
+// SetTracer sets the tracer which traces the batches sequenced, see
+// log.Sequencer.SetTracer.
+func (s *SequencerManager) SetTracer(t *trace.Tracer) {
+	s.tracer = t
+}
+
 // Name returns the name of the object.
 func (s SequencerManager) Name() string {
 	return "Sequencer"
 }
 
-// ExecutePass performs sequencing for the specified set of Logs.
-func (s SequencerManager) ExecutePass(logIDs []trillian.LogID, context LogOperationManagerContext) bool {
+// ExecutePass performs sequencing for the specified set of Logs. The logs are
+// handed out to the workers in round-robin order, starting one log further on
+// each pass so that the same logs aren't always last when a pass is cut short.
+// A log whose batch was full is queued again behind the other logs, up to the
+// max batches per pass, and is never sequenced by two workers at once.
+func (s *SequencerManager) ExecutePass(logIDs []trillian.LogID, context LogOperationManagerContext) bool {
 	// TODO(Martin2112): Demote logging to verbose level
 	glog.Infof("Beginning sequencing run for %d active log(s)", len(logIDs))
 
-	successCount := 0
-	leavesAdded := 0
+	concurrency := s.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	maxBatches := s.maxBatchesPerPass
+	if maxBatches < 1 {
+		maxBatches = 1
+	}
 
-	for _, logID := range logIDs {
+	queue := make([]logRun, 0, len(logIDs))
+	if len(logIDs) > 0 {
+		start := s.passes % len(logIDs)
+		for i := range logIDs {
+			queue = append(queue, logRun{logID: logIDs[(start+i)%len(logIDs)]})
+		}
+	}
+	s.passes++
+	if s.mergeDelays != nil {
+		// Logs that this server no longer sequences are left to their new
+		// master's health check
+		treeIDs := make([]int64, 0, len(logIDs))
+		for _, logID := range logIDs {
+			treeIDs = append(treeIDs, logID.TreeID)
+		}
+		s.mergeDelays.Retain(treeIDs)
+	}
+
+	// Logs are handed out to the workers one at a time, so that no more are
+	// started once it's time to quit
+	runs := make(chan logRun)
+	results := make(chan logRun)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range runs {
+				run.leaves, run.ok = s.sequenceLog(run.logID, context)
+				run.batches++
+				results <- run
+			}
+		}()
+	}
+
+	batches, failures, leavesAdded := 0, 0, 0
+	inProgress := 0
+	done := context.done
+	quit := false
+	for len(queue) > 0 || inProgress > 0 {
 		// See if it's time to quit
 		select {
-		case <-context.done:
-			return true
+		case <-done:
+			quit = true
+			done = nil
 		default:
 		}
 
-		// TODO(Martin2112): Probably want to make the sequencer objects longer lived to
-		// avoid the cost of initializing their state each time but this works for now
-		storage, err := context.storageProvider(logID.TreeID)
+		// Once it's time to quit only the batches in progress are waited for
+		var next chan<- logRun
+		var run logRun
+		if len(queue) > 0 && !quit {
+			next = runs
+			run = queue[0]
+		} else if inProgress == 0 {
+			break
+		}
 
-		// TODO(Martin2112): Honour the sequencing enabled in log parameters, needs an API change
-		// so deferring it
-		if err != nil {
-			glog.Warningf("Storage provider failed for id: %v because: %v", logID, err)
-			continue
+		select {
+		case next <- run:
+			queue = queue[1:]
+			inProgress++
+		case result := <-results:
+			inProgress--
+			batches++
+			if !result.ok {
+				failures++
+				continue
+			}
+			leavesAdded += result.leaves
+			if context.batchSize > 0 && result.leaves >= context.batchSize && result.batches < maxBatches {
+				queue = append(queue, result)
+			}
+		case <-done:
+			quit = true
+			done = nil
 		}
+	}
+	close(runs)
+	wg.Wait()
+	if quit {
+		return true
+	}
 
-		// TODO(Martin2112): Allow for different tree hashers to be used by different logs
-		sequencer := log.NewSequencer(merkle.NewRFC6962TreeHasher(trillian.NewSHA256()), context.timeSource, storage, s.keyManager)
+	glog.Infof("Sequencing run completed %d batches for %d logs %d failed %d leaves integrated", batches, len(logIDs), failures, leavesAdded)
+
+	return false
+}
 
-		leaves, err := sequencer.SequenceBatch(context.batchSize, isRootTooOld(context.timeSource, context.signInterval))
+// logRun is a log being sequenced by a pass.
+type logRun struct {
+	logID trillian.LogID
+	// batches is the number of batches of the log sequenced so far this pass
+	batches int
+	// leaves is the number of leaves added by the latest batch, and ok whether
+	// it succeeded
+	leaves int
+	ok     bool
+}
 
-		if err != nil {
-			glog.Warningf("Error trying to sequence batch for: %v: %v", logID, err)
-			continue
-		}
+// sequenceLog sequences a batch of leaves for a log, and returns the number of
+// leaves added and whether it succeeded.
+func (s SequencerManager) sequenceLog(logID trillian.LogID, context LogOperationManagerContext) (int, bool) {
+	// TODO(Martin2112): Probably want to make the sequencer objects longer lived to
+	// avoid the cost of initializing their state each time but this works for now
+	storage, err := context.storageProvider(logID.TreeID)
 
-		successCount++
-		leavesAdded += leaves
+	// TODO(Martin2112): Honour the sequencing enabled in log parameters, needs an API change
+	// so deferring it
+	if err != nil {
+		glog.Warningf("Storage provider failed for id: %v because: %v", logID, err)
+		return 0, false
 	}
 
-	glog.Infof("Sequencing run completed %d succeeded %d failed %d leaves integrated", successCount, len(logIDs)-successCount, leavesAdded)
+	// Frozen logs can't be written and archived logs are retired, so neither is
+	// sequenced or has its root re-signed. Draining logs are sequenced until
+	// their queued leaves have all been integrated.
+	if state := storage.TreeState(); state == trillian.TreeState_FROZEN || state == trillian.TreeState_ARCHIVED {
+		glog.V(1).Infof("Not sequencing %v log: %v", state, logID)
+		return 0, true
+	}
 
-	return false
+	sequencer, err := s.newSequencer(logID.TreeID, storage, context.timeSource)
+	if err != nil {
+		glog.Warningf("Failed to create sequencer for: %v: %v", logID, err)
+		return 0, false
+	}
+
+	// A log's own sequence guard overrides the default guard window
+	guardWindow := s.guardWindow
+	if d := storage.SequenceGuard(); d > 0 {
+		guardWindow = d
+	}
+	sequencer.SetGuardWindow(guardWindow)
+
+	// A log's own max root duration overrides the sign interval
+	maxRootAge := context.signInterval
+	if d := storage.MaxRootDuration(); d > 0 {
+		maxRootAge = d
+	}
+	leaves, err := sequencer.SequenceBatch(context.batchSize, isRootTooOld(context.timeSource, maxRootAge))
+
+	if err != nil {
+		glog.Warningf("Error trying to sequence batch for: %v: %v", logID, err)
+		return 0, false
+	}
+
+	return leaves, true
+}
+
+// newSequencer creates a sequencer for the log treeID held in ls, which signs
+// roots with the log's own signer if there are per log signers, or else the
+// same way for every log.
+func (s SequencerManager) newSequencer(treeID int64, ls storage.LogStorage, timeSource util.TimeSource) (*log.Sequencer, error) {
+	hasher, err := merkle.NewTreeHasherForStrategy(ls.HashStrategy(), ls.HashAlgorithm(), ls.HashPrefixes())
+	if err != nil {
+		return nil, err
+	}
+
+	var sequencer *log.Sequencer
+	if s.rootSigners != nil {
+		signer, err := s.rootSigners(treeID)
+		if err != nil {
+			return nil, err
+		}
+		sequencer = log.NewSequencerWithRootSigner(hasher, timeSource, ls, signer)
+	} else if s.rootSigner != nil {
+		sequencer = log.NewSequencerWithRootSigner(hasher, timeSource, ls, s.rootSigner)
+	} else {
+		sequencer = log.NewSequencer(hasher, timeSource, ls, s.keyManager)
+	}
+	sequencer.SetMaxClockSkew(s.maxClockSkew)
+	sequencer.SetMetrics(s.metrics)
+	sequencer.SetTracer(s.tracer)
+	sequencer.SetMergeDelayMonitor(s.mergeDelays, treeID)
+	sequencer.SetPreordered(ls.TreeType() == trillian.TreeType_PREORDERED_LOG)
+	return sequencer, nil
+}
+
+// LogInitializer returns a LogInitFunc which signs the empty roots of new logs
+// with the same signer as the roots created by sequencing.
+func (s SequencerManager) LogInitializer(timeSource util.TimeSource) LogInitFunc {
+	return func(treeID int64, ls storage.LogStorage) (trillian.SignedLogRoot, error) {
+		sequencer, err := s.newSequencer(treeID, ls, timeSource)
+		if err != nil {
+			return trillian.SignedLogRoot{}, err
+		}
+		return sequencer.InitLog()
+	}
 }
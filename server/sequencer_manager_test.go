@@ -2,6 +2,7 @@ package server
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -20,6 +21,7 @@ var fakeTimeSource = util.FakeTimeSource{fakeTime}
 var testLogID1 = trillian.LogID{TreeID: 1, LogID: []byte("testroot")}
 var testLeaf0Hash = trillian.Hash{0, 1, 2, 3, 4, 5}
 var testLeaf0 = trillian.LogLeaf{Leaf: trillian.Leaf{LeafHash: testLeaf0Hash, LeafValue: nil, ExtraData: nil}, SequenceNumber: 0}
+var testLeaf0Sequenced = trillian.LogLeaf{Leaf: testLeaf0.Leaf, SequenceNumber: 0, IntegrateTimestampNanos: fakeTime.UnixNano()}
 var testRoot0 = trillian.SignedLogRoot{TreeSize: 0, TreeRevision: 0, LogId: testLogID1.LogID, RootHash: []byte{}, Signature: &trillian.DigitallySigned{SignatureAlgorithm: trillian.SignatureAlgorithm_ECDSA}}
 var updatedNodes0 = []storage.Node{{NodeID: storage.NodeID{Path: []uint8{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, PrefixLenBits: 64, PathLenBits: 64}, Hash: trillian.Hash{0x0, 0x1, 0x2, 0x3, 0x4, 0x5}, NodeRevision: 1}}
 var updatedRoot = trillian.SignedLogRoot{LogId: testLogID1.LogID, TimestampNanos: fakeTime.UnixNano(), RootHash: []uint8{0x0, 0x1, 0x2, 0x3, 0x4, 0x5}, TreeSize: 1, Signature: &trillian.DigitallySigned{SignatureAlgorithm: trillian.SignatureAlgorithm_ECDSA, Signature: []byte("signed")}, TreeRevision: 1}
@@ -46,6 +48,13 @@ func TestSequencerManagerSingleLogNoLeaves(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockStorage := storage.NewMockLogStorage(mockCtrl)
+	mockStorage.EXPECT().HashPrefixes().Return(storage.TreeHashPrefixes{})
+	mockStorage.EXPECT().HashStrategy().Return(trillian.HashStrategy_RFC6962)
+	mockStorage.EXPECT().HashAlgorithm().Return(trillian.HashAlgorithm_SHA256)
+	mockStorage.EXPECT().TreeType().Return(trillian.TreeType_LOG)
+	mockStorage.EXPECT().TreeState().Return(trillian.TreeState_ACTIVE)
+	mockStorage.EXPECT().MaxRootDuration().Return(time.Duration(0))
+	mockStorage.EXPECT().SequenceGuard().Return(time.Duration(0))
 	mockTx := storage.NewMockLogTX(mockCtrl)
 	logID := trillian.LogID{TreeID: 1, LogID: []byte("Test")}
 
@@ -53,7 +62,7 @@ func TestSequencerManagerSingleLogNoLeaves(t *testing.T) {
 	mockTx.EXPECT().Commit().Return(nil)
 	mockTx.EXPECT().WriteRevision().AnyTimes().Return(writeRev)
 	mockTx.EXPECT().LatestSignedLogRoot().Return(testRoot0, nil)
-	mockTx.EXPECT().DequeueLeaves(50).Return([]trillian.LogLeaf{}, nil)
+	mockTx.EXPECT().DequeueLeaves(50, time.Duration(0)).Return([]trillian.LogLeaf{}, nil)
 	mockKeyManager := crypto.NewMockKeyManager(mockCtrl)
 
 	sm := NewSequencerManager(mockKeyManager)
@@ -61,11 +70,49 @@ func TestSequencerManagerSingleLogNoLeaves(t *testing.T) {
 	sm.ExecutePass([]trillian.LogID{logID}, createTestContext(mockStorageProviderForSequencer(mockStorage)))
 }
 
+func TestSequencerManagerSequencesLogsConcurrently(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	// Every log is sequenced once, however the logs are shared between workers
+	mockStorage := storage.NewMockLogStorage(mockCtrl)
+	mockStorage.EXPECT().HashPrefixes().Times(3).Return(storage.TreeHashPrefixes{})
+	mockStorage.EXPECT().HashStrategy().Times(3).Return(trillian.HashStrategy_RFC6962)
+	mockStorage.EXPECT().HashAlgorithm().Times(3).Return(trillian.HashAlgorithm_SHA256)
+	mockStorage.EXPECT().TreeType().Times(3).Return(trillian.TreeType_LOG)
+	mockStorage.EXPECT().TreeState().Times(3).Return(trillian.TreeState_ACTIVE)
+	mockStorage.EXPECT().MaxRootDuration().Times(3).Return(time.Duration(0))
+	mockStorage.EXPECT().SequenceGuard().Times(3).Return(time.Duration(0))
+	mockTx := storage.NewMockLogTX(mockCtrl)
+	mockStorage.EXPECT().Begin().Times(3).Return(mockTx, nil)
+	mockTx.EXPECT().Commit().Times(3).Return(nil)
+	mockTx.EXPECT().WriteRevision().AnyTimes().Return(writeRev)
+	mockTx.EXPECT().LatestSignedLogRoot().Times(3).Return(testRoot0, nil)
+	mockTx.EXPECT().DequeueLeaves(50, time.Duration(0)).Times(3).Return([]trillian.LogLeaf{}, nil)
+	mockKeyManager := crypto.NewMockKeyManager(mockCtrl)
+
+	sm := NewSequencerManager(mockKeyManager)
+	sm.concurrency = 2
+
+	logIDs := []trillian.LogID{{TreeID: 1, LogID: []byte("1")}, {TreeID: 2, LogID: []byte("2")}, {TreeID: 3, LogID: []byte("3")}}
+	sp := func(int64) (storage.LogStorage, error) { return mockStorage, nil }
+	if quit := sm.ExecutePass(logIDs, createTestContext(sp)); quit {
+		t.Fatalf("ExecutePass returned quit")
+	}
+}
+
 func TestSequencerManagerSingleLogOneLeaf(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
 	mockStorage := storage.NewMockLogStorage(mockCtrl)
+	mockStorage.EXPECT().HashPrefixes().Return(storage.TreeHashPrefixes{})
+	mockStorage.EXPECT().HashStrategy().Return(trillian.HashStrategy_RFC6962)
+	mockStorage.EXPECT().HashAlgorithm().Return(trillian.HashAlgorithm_SHA256)
+	mockStorage.EXPECT().TreeType().Return(trillian.TreeType_LOG)
+	mockStorage.EXPECT().TreeState().Return(trillian.TreeState_ACTIVE)
+	mockStorage.EXPECT().MaxRootDuration().Return(time.Duration(0))
+	mockStorage.EXPECT().SequenceGuard().Return(time.Duration(0))
 	mockTx := storage.NewMockLogTX(mockCtrl)
 	mockKeyManager := crypto.NewMockKeyManager(mockCtrl)
 	logID := trillian.LogID{TreeID: 1, LogID: []byte("Test")}
@@ -76,9 +123,9 @@ func TestSequencerManagerSingleLogOneLeaf(t *testing.T) {
 	mockTx.EXPECT().Commit().Return(nil)
 	mockTx.EXPECT().Rollback().AnyTimes().Do(func() { panic(nil) })
 	mockTx.EXPECT().WriteRevision().AnyTimes().Return(testRoot0.TreeRevision + 1)
-	mockTx.EXPECT().DequeueLeaves(50).Return([]trillian.LogLeaf{testLeaf0}, nil)
+	mockTx.EXPECT().DequeueLeaves(50, time.Duration(0)).Return([]trillian.LogLeaf{testLeaf0}, nil)
 	mockTx.EXPECT().LatestSignedLogRoot().Return(testRoot0, nil)
-	mockTx.EXPECT().UpdateSequencedLeaves([]trillian.LogLeaf{testLeaf0}).Return(nil)
+	mockTx.EXPECT().UpdateSequencedLeaves([]trillian.LogLeaf{testLeaf0Sequenced}).Return(nil)
 	mockTx.EXPECT().SetMerkleNodes(updatedNodes0).Return(nil)
 	mockTx.EXPECT().StoreSignedLogRoot(updatedRoot).Return(nil)
 	mockStorage.EXPECT().Begin().Return(mockTx, nil)
@@ -92,6 +139,147 @@ func TestSequencerManagerSingleLogOneLeaf(t *testing.T) {
 	sm.ExecutePass([]trillian.LogID{logID}, createTestContext(mockStorageProviderForSequencer(mockStorage)))
 }
 
+// Tests that each pass starts with the log after the one the previous pass
+// started with.
+func TestSequencerManagerRoundRobin(t *testing.T) {
+	var order []int64
+	// The logs can't be opened, so are only recorded
+	sp := func(id int64) (storage.LogStorage, error) {
+		order = append(order, id)
+		return nil, fmt.Errorf("BADLOGID: %d", id)
+	}
+	logIDs := []trillian.LogID{{TreeID: 1}, {TreeID: 2}, {TreeID: 3}}
+
+	sm := NewSequencerManager(nil)
+	for _, want := range [][]int64{{1, 2, 3}, {2, 3, 1}, {3, 1, 2}, {1, 2, 3}} {
+		order = nil
+		sm.ExecutePass(logIDs, createTestContext(sp))
+		if !reflect.DeepEqual(order, want) {
+			t.Errorf("ExecutePass() sequenced logs %v, want %v", order, want)
+		}
+	}
+}
+
+// Tests that a log whose batch is full is sequenced again in the same pass, up
+// to the max batches per pass.
+func TestSequencerManagerFullBatchSequencedAgain(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(mockCtrl)
+	mockStorage.EXPECT().HashPrefixes().Times(2).Return(storage.TreeHashPrefixes{})
+	mockStorage.EXPECT().HashStrategy().Times(2).Return(trillian.HashStrategy_RFC6962)
+	mockStorage.EXPECT().HashAlgorithm().Times(2).Return(trillian.HashAlgorithm_SHA256)
+	mockStorage.EXPECT().TreeType().Times(2).Return(trillian.TreeType_LOG)
+	mockStorage.EXPECT().TreeState().Times(2).Return(trillian.TreeState_ACTIVE)
+	mockStorage.EXPECT().MaxRootDuration().Times(2).Return(time.Duration(0))
+	mockStorage.EXPECT().SequenceGuard().Times(2).Return(time.Duration(0))
+	mockTx := storage.NewMockLogTX(mockCtrl)
+	mockKeyManager := crypto.NewMockKeyManager(mockCtrl)
+	logID := trillian.LogID{TreeID: 1, LogID: []byte("Test")}
+	hasher := trillian.NewSHA256()
+
+	// The first batch is full, so the log is sequenced again, and the second
+	// finds nothing left to do
+	mockStorage.EXPECT().Begin().Times(2).Return(mockTx, nil)
+	mockTx.EXPECT().Commit().Times(2).Return(nil)
+	mockTx.EXPECT().WriteRevision().AnyTimes().Return(testRoot0.TreeRevision + 1)
+	mockTx.EXPECT().DequeueLeaves(1, time.Duration(0)).Return([]trillian.LogLeaf{testLeaf0}, nil)
+	mockTx.EXPECT().DequeueLeaves(1, time.Duration(0)).Return([]trillian.LogLeaf{}, nil)
+	mockTx.EXPECT().LatestSignedLogRoot().Return(testRoot0, nil)
+	mockTx.EXPECT().LatestSignedLogRoot().Return(updatedRoot, nil)
+	mockTx.EXPECT().UpdateSequencedLeaves([]trillian.LogLeaf{testLeaf0Sequenced}).Return(nil)
+	mockTx.EXPECT().SetMerkleNodes(updatedNodes0).Return(nil)
+	mockTx.EXPECT().StoreSignedLogRoot(updatedRoot).Return(nil)
+
+	mockSigner := crypto.NewMockSigner(mockCtrl)
+	mockSigner.EXPECT().Sign(gomock.Any(), []byte{0x13, 0xa6, 0xf3, 0xcb, 0xa2, 0x82, 0x52, 0xfc, 0x5a, 0x98, 0xfe, 0x81, 0x7c, 0xb7, 0xaf, 0x68, 0x1f, 0x83, 0x30, 0xcf, 0x80, 0x71, 0x1e, 0x9e, 0x16, 0xf6, 0x1e, 0x55, 0xcf, 0x78, 0xa, 0xb9}, hasher).Return([]byte("signed"), nil)
+	mockKeyManager.EXPECT().Signer().Return(mockSigner, nil)
+
+	sm := NewSequencerManager(mockKeyManager)
+	sm.SetMaxBatchesPerPass(3)
+
+	tc := createTestContext(mockStorageProviderForSequencer(mockStorage))
+	tc.batchSize = 1
+	if quit := sm.ExecutePass([]trillian.LogID{logID}, tc); quit {
+		t.Fatalf("ExecutePass returned quit")
+	}
+}
+
+// Tests that leaves are dequeued with the default guard window, unless the log
+// has a sequence guard of its own.
+func TestSequencerManagerGuardWindow(t *testing.T) {
+	for _, test := range []struct {
+		logGuard time.Duration
+		want     time.Duration
+	}{
+		{logGuard: 0, want: time.Minute},
+		{logGuard: 10 * time.Second, want: 10 * time.Second},
+	} {
+		mockCtrl := gomock.NewController(t)
+
+		mockStorage := storage.NewMockLogStorage(mockCtrl)
+		mockStorage.EXPECT().HashPrefixes().Return(storage.TreeHashPrefixes{})
+		mockStorage.EXPECT().HashStrategy().Return(trillian.HashStrategy_RFC6962)
+		mockStorage.EXPECT().HashAlgorithm().Return(trillian.HashAlgorithm_SHA256)
+		mockStorage.EXPECT().TreeType().Return(trillian.TreeType_LOG)
+		mockStorage.EXPECT().TreeState().Return(trillian.TreeState_ACTIVE)
+		mockStorage.EXPECT().MaxRootDuration().Return(time.Duration(0))
+		mockStorage.EXPECT().SequenceGuard().Return(test.logGuard)
+		mockTx := storage.NewMockLogTX(mockCtrl)
+		logID := trillian.LogID{TreeID: 1, LogID: []byte("Test")}
+
+		mockStorage.EXPECT().Begin().Return(mockTx, nil)
+		mockTx.EXPECT().Commit().Return(nil)
+		mockTx.EXPECT().WriteRevision().AnyTimes().Return(writeRev)
+		mockTx.EXPECT().LatestSignedLogRoot().Return(testRoot0, nil)
+		mockTx.EXPECT().DequeueLeaves(50, test.want).Return([]trillian.LogLeaf{}, nil)
+
+		sm := NewSequencerManager(crypto.NewMockKeyManager(mockCtrl))
+		sm.SetGuardWindow(time.Minute)
+		sm.ExecutePass([]trillian.LogID{logID}, createTestContext(mockStorageProviderForSequencer(mockStorage)))
+		mockCtrl.Finish()
+	}
+}
+
+// Tests that frozen and archived logs are left alone, while draining logs are
+// still sequenced.
+func TestSequencerManagerTreeStates(t *testing.T) {
+	for _, test := range []struct {
+		state     trillian.TreeState
+		sequenced bool
+	}{
+		{state: trillian.TreeState_FROZEN},
+		{state: trillian.TreeState_ARCHIVED},
+		{state: trillian.TreeState_DRAINING, sequenced: true},
+	} {
+		mockCtrl := gomock.NewController(t)
+
+		mockStorage := storage.NewMockLogStorage(mockCtrl)
+		mockStorage.EXPECT().TreeState().Return(test.state)
+		logID := trillian.LogID{TreeID: 1, LogID: []byte("Test")}
+
+		if test.sequenced {
+			mockStorage.EXPECT().HashPrefixes().Return(storage.TreeHashPrefixes{})
+			mockStorage.EXPECT().HashStrategy().Return(trillian.HashStrategy_RFC6962)
+			mockStorage.EXPECT().HashAlgorithm().Return(trillian.HashAlgorithm_SHA256)
+			mockStorage.EXPECT().TreeType().Return(trillian.TreeType_LOG)
+			mockStorage.EXPECT().MaxRootDuration().Return(time.Duration(0))
+			mockStorage.EXPECT().SequenceGuard().Return(time.Duration(0))
+			mockTx := storage.NewMockLogTX(mockCtrl)
+			mockStorage.EXPECT().Begin().Return(mockTx, nil)
+			mockTx.EXPECT().Commit().Return(nil)
+			mockTx.EXPECT().WriteRevision().AnyTimes().Return(writeRev)
+			mockTx.EXPECT().LatestSignedLogRoot().Return(testRoot0, nil)
+			mockTx.EXPECT().DequeueLeaves(50, time.Duration(0)).Return([]trillian.LogLeaf{}, nil)
+		}
+
+		sm := NewSequencerManager(crypto.NewMockKeyManager(mockCtrl))
+		sm.ExecutePass([]trillian.LogID{logID}, createTestContext(mockStorageProviderForSequencer(mockStorage)))
+		mockCtrl.Finish()
+	}
+}
+
 // Tests that a new root is signed if it's due even when there is no work to sequence.
 // The various failure cases of SignRoot() are tested in the sequencer tests. This is
 // an interaction test.
@@ -100,6 +288,13 @@ func TestSignsIfNoWorkAndRootExpired(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockStorage := storage.NewMockLogStorage(mockCtrl)
+	mockStorage.EXPECT().HashPrefixes().Return(storage.TreeHashPrefixes{})
+	mockStorage.EXPECT().HashStrategy().Return(trillian.HashStrategy_RFC6962)
+	mockStorage.EXPECT().HashAlgorithm().Return(trillian.HashAlgorithm_SHA256)
+	mockStorage.EXPECT().TreeType().Return(trillian.TreeType_LOG)
+	mockStorage.EXPECT().TreeState().Return(trillian.TreeState_ACTIVE)
+	mockStorage.EXPECT().MaxRootDuration().Return(time.Duration(0))
+	mockStorage.EXPECT().SequenceGuard().Return(time.Duration(0))
 	mockTx := storage.NewMockLogTX(mockCtrl)
 	mockKeyManager := crypto.NewMockKeyManager(mockCtrl)
 	logID := trillian.LogID{TreeID: 1, LogID: []byte("Test")}
@@ -109,7 +304,7 @@ func TestSignsIfNoWorkAndRootExpired(t *testing.T) {
 	mockTx.EXPECT().WriteRevision().AnyTimes().Return(writeRev)
 	mockTx.EXPECT().Commit().AnyTimes().Return(nil)
 	mockTx.EXPECT().LatestSignedLogRoot().AnyTimes().Return(testRoot0, nil)
-	mockTx.EXPECT().DequeueLeaves(50).Return([]trillian.LogLeaf{}, nil)
+	mockTx.EXPECT().DequeueLeaves(50, time.Duration(0)).Return([]trillian.LogLeaf{}, nil)
 	mockTx.EXPECT().StoreSignedLogRoot(updatedRootSignOnly).AnyTimes().Return(nil)
 
 	mockSigner := crypto.NewMockSigner(mockCtrl)
@@ -124,6 +319,82 @@ func TestSignsIfNoWorkAndRootExpired(t *testing.T) {
 	sm.ExecutePass([]trillian.LogID{logID}, tc)
 }
 
+// Tests that a log's own max root duration overrides the sign interval, so its
+// root is re-signed when there is no work.
+func TestSignsIfNoWorkAndRootOlderThanMaxRootDuration(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(mockCtrl)
+	mockStorage.EXPECT().HashPrefixes().Return(storage.TreeHashPrefixes{})
+	mockStorage.EXPECT().HashStrategy().Return(trillian.HashStrategy_RFC6962)
+	mockStorage.EXPECT().HashAlgorithm().Return(trillian.HashAlgorithm_SHA256)
+	mockStorage.EXPECT().TreeType().Return(trillian.TreeType_LOG)
+	mockStorage.EXPECT().TreeState().Return(trillian.TreeState_ACTIVE)
+	mockStorage.EXPECT().MaxRootDuration().Return(time.Second * 5)
+	mockStorage.EXPECT().SequenceGuard().Return(time.Duration(0))
+	mockTx := storage.NewMockLogTX(mockCtrl)
+	mockKeyManager := crypto.NewMockKeyManager(mockCtrl)
+	logID := trillian.LogID{TreeID: 1, LogID: []byte("Test")}
+	hasher := trillian.NewSHA256()
+
+	mockStorage.EXPECT().Begin().Times(2).Return(mockTx, nil)
+	mockTx.EXPECT().WriteRevision().AnyTimes().Return(writeRev)
+	mockTx.EXPECT().Commit().Times(2).Return(nil)
+	mockTx.EXPECT().LatestSignedLogRoot().Times(2).Return(testRoot0, nil)
+	mockTx.EXPECT().DequeueLeaves(50, time.Duration(0)).Return([]trillian.LogLeaf{}, nil)
+	mockTx.EXPECT().StoreSignedLogRoot(updatedRootSignOnly).Return(nil)
+
+	mockSigner := crypto.NewMockSigner(mockCtrl)
+	mockSigner.EXPECT().Sign(gomock.Any(), []byte{0xeb, 0x7d, 0xa1, 0x4f, 0x1e, 0x60, 0x91, 0x24, 0xa, 0xf7, 0x1c, 0xcd, 0xdb, 0xd4, 0xca, 0x38, 0x4b, 0x12, 0xe4, 0xa3, 0xcf, 0x80, 0x5, 0x55, 0x17, 0x71, 0x35, 0xaf, 0x80, 0x11, 0xa, 0x87}, hasher).Return([]byte("signed"), nil)
+	mockKeyManager.EXPECT().Signer().Return(mockSigner, nil)
+
+	sm := NewSequencerManager(mockKeyManager)
+
+	// The context's sign interval is 100 years, so only the log's setting can expire the root
+	sm.ExecutePass([]trillian.LogID{logID}, createTestContext(mockStorageProviderForSequencer(mockStorage)))
+}
+
+// Tests that a log's roots are signed by its own signer when there are per log
+// signers.
+func TestSignsWithLogRootSigner(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(mockCtrl)
+	mockStorage.EXPECT().HashPrefixes().Return(storage.TreeHashPrefixes{})
+	mockStorage.EXPECT().HashStrategy().Return(trillian.HashStrategy_RFC6962)
+	mockStorage.EXPECT().HashAlgorithm().Return(trillian.HashAlgorithm_SHA256)
+	mockStorage.EXPECT().TreeType().Return(trillian.TreeType_LOG)
+	mockStorage.EXPECT().TreeState().Return(trillian.TreeState_ACTIVE)
+	mockStorage.EXPECT().MaxRootDuration().Return(time.Duration(0))
+	mockStorage.EXPECT().SequenceGuard().Return(time.Duration(0))
+	mockTx := storage.NewMockLogTX(mockCtrl)
+	logID := trillian.LogID{TreeID: 1, LogID: []byte("Test")}
+	hasher := trillian.NewSHA256()
+
+	mockStorage.EXPECT().Begin().Times(2).Return(mockTx, nil)
+	mockTx.EXPECT().WriteRevision().AnyTimes().Return(writeRev)
+	mockTx.EXPECT().Commit().Times(2).Return(nil)
+	mockTx.EXPECT().LatestSignedLogRoot().Times(2).Return(testRoot0, nil)
+	mockTx.EXPECT().DequeueLeaves(50, time.Duration(0)).Return([]trillian.LogLeaf{}, nil)
+	mockTx.EXPECT().StoreSignedLogRoot(updatedRootSignOnly).Return(nil)
+
+	mockSigner := crypto.NewMockSigner(mockCtrl)
+	mockSigner.EXPECT().Sign(gomock.Any(), []byte{0xeb, 0x7d, 0xa1, 0x4f, 0x1e, 0x60, 0x91, 0x24, 0xa, 0xf7, 0x1c, 0xcd, 0xdb, 0xd4, 0xca, 0x38, 0x4b, 0x12, 0xe4, 0xa3, 0xcf, 0x80, 0x5, 0x55, 0x17, 0x71, 0x35, 0xaf, 0x80, 0x11, 0xa, 0x87}, hasher).Return([]byte("signed"), nil)
+
+	sm := NewSequencerManagerWithRootSigners(func(treeID int64) (crypto.LogRootSigner, error) {
+		if treeID != logID.TreeID {
+			t.Errorf("Root signer requested for log %d, want %d", treeID, logID.TreeID)
+		}
+		return crypto.NewTrillianSigner(hasher, trillian.SignatureAlgorithm_ECDSA, mockSigner), nil
+	})
+
+	tc := createTestContext(mockStorageProviderForSequencer(mockStorage))
+	tc.signInterval = time.Second * 5
+	sm.ExecutePass([]trillian.LogID{logID}, tc)
+}
+
 func mockStorageProviderForSequencer(mockStorage storage.LogStorage) LogStorageProviderFunc {
 	return func(id int64) (storage.LogStorage, error) {
 		if id >= 0 && id <= 1 {
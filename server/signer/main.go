@@ -0,0 +1,164 @@
+package main
+
+import (
+	gocrypto "crypto"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/auth"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/signer"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var serverPortFlag = flag.Int("port", 8092, "Port to serve signing requests on")
+var privateKeyFile = flag.String("private_key_file", "", "File containing a PEM encoded private key")
+var privateKeyPassword = flag.String("private_key_password", "", "Password for server private key")
+var nextKeyIDFlag = flag.String("next_key_id", "", "ID of the key in next_private_key_file in the keys of the trees this server signs. If set, roots are also signed with that key while the trees are moved over to it")
+var nextPrivateKeyFile = flag.String("next_private_key_file", "", "File containing the PEM encoded private key that will replace private_key_file")
+var nextPrivateKeyPassword = flag.String("next_private_key_password", "", "Password for next_private_key_file")
+var tlsCertFileFlag = flag.String("tls_cert_file", "", "File containing the PEM encoded certificate this server presents to clients")
+var tlsKeyFileFlag = flag.String("tls_key_file", "", "File containing the PEM encoded private key for tls_cert_file")
+var clientCAFileFlag = flag.String("client_ca_file", "", "File containing the PEM encoded CA certificates that client certificates must be issued by")
+var thresholdFlag = flag.Int("threshold", 0, "If more than 0, roots are signed under a threshold scheme, needing this many of threshold_signers to sign each one")
+var thresholdSignersFlag = flag.String("threshold_signers", "", "Comma separated host:port addresses of all the signers taking part in threshold signing, in key index order, with this server's own entry given as self. They're connected to with the certificate in tls_cert_file, and must have certificates issued by client_ca_file")
+var thresholdTimeoutFlag = flag.Duration("threshold_timeout", 5*time.Second, "Time allowed for each request to another signer taking part in threshold signing")
+var rootStateDirFlag = flag.String("root_state_dir", "", "Directory in which the last root signed for each log is recorded. A root is only signed if it's consistent with the last one, so the directory must be kept across restarts")
+var allowedClientsFlag = flag.String("allowed_clients", "", "Comma separated list of the client certificate common names allowed to have roots signed. If empty any client with a valid certificate is allowed")
+
+// newThresholdSigner creates the signer used to coordinate threshold signing,
+// made up of this server's own key and the other signers in threshold_signers.
+func newThresholdSigner(keyManager, nextKeyManager crypto.KeyManager, hasher trillian.Hasher, store signer.RootStore) (*signer.ThresholdSigner, error) {
+	tlsConfig, err := auth.ClientTLSConfig(*tlsCertFileFlag, *tlsKeyFileFlag, *clientCAFileFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	var signers []crypto.LogRootSigner
+	var keys []gocrypto.PublicKey
+	for i, addr := range strings.Split(*thresholdSignersFlag, ",") {
+		if addr == "self" {
+			s, key, err := signer.LocalRootSigner(keyManager, hasher)
+			if err != nil {
+				return nil, err
+			}
+			if nextKeyManager != nil {
+				next, _, err := signer.LocalRootSigner(nextKeyManager, hasher)
+				if err != nil {
+					return nil, err
+				}
+				s = signer.NewRotatingSigner(s, *nextKeyIDFlag, next)
+			}
+			consistent := signer.NewConsistentSigner(s, store, merkle.NewRFC6962TreeHasher(hasher))
+			signers, keys = append(signers, consistent), append(keys, key)
+			continue
+		}
+
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+		if err != nil {
+			return nil, err
+		}
+		client := signer.NewClient(conn, *thresholdTimeoutFlag)
+		key, err := client.PublicKey(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get public key of signer %d: %v", i, err)
+		}
+		signers, keys = append(signers, client), append(keys, key)
+	}
+	return signer.NewThresholdSigner(signers, keys, *thresholdFlag, hasher)
+}
+
+func awaitSignal(rpcServer *grpc.Server) {
+	// Arrange notification for the standard set of signals used to terminate a server
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	// Now block main and wait for a signal
+	sig := <-sigs
+	glog.Infof("Signal received: %v", sig)
+
+	// Bring down the RPC server, which will unblock main
+	rpcServer.Stop()
+}
+
+func main() {
+	flag.Parse()
+
+	glog.Info("**** Signer Server Starting ****")
+
+	keyManager, err := crypto.LoadPasswordProtectedPrivateKey(*privateKeyFile, *privateKeyPassword)
+	if err != nil {
+		glog.Fatalf("Failed to load server key: %v", err)
+	}
+
+	var nextKeyManager crypto.KeyManager
+	if len(*nextKeyIDFlag) > 0 {
+		if nextKeyManager, err = crypto.LoadPasswordProtectedPrivateKey(*nextPrivateKeyFile, *nextPrivateKeyPassword); err != nil {
+			glog.Fatalf("Failed to load next key: %v", err)
+		}
+	}
+
+	if *rootStateDirFlag == "" {
+		glog.Fatal("root_state_dir must be set")
+	}
+	store, err := signer.NewFileRootStore(*rootStateDirFlag)
+	if err != nil {
+		glog.Fatalf("Failed to open root state: %v", err)
+	}
+
+	// Clients must authenticate, so TLS is always used
+	tlsConfig, err := auth.ServerTLSConfig(*tlsCertFileFlag, *tlsKeyFileFlag, *clientCAFileFlag, true)
+	if err != nil {
+		glog.Fatalf("Failed to set up TLS: %v", err)
+	}
+
+	var allowedClients []string
+	if len(*allowedClientsFlag) > 0 {
+		allowedClients = strings.Split(*allowedClientsFlag, ",")
+	}
+
+	glog.Infof("Creating RPC server starting on port: %d", *serverPortFlag)
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *serverPortFlag))
+	if err != nil {
+		glog.Errorf("Failed to listen on the server port: %d, because: %v", *serverPortFlag, err)
+		os.Exit(1)
+	}
+
+	hasher := trillian.NewSHA256()
+	signerServer := signer.NewServer(keyManager, hasher, allowedClients)
+	if nextKeyManager != nil {
+		signerServer.SetNextKey(*nextKeyIDFlag, nextKeyManager)
+	}
+	// TODO: Support logs with other hash strategies
+	if err := signerServer.SetRootStore(store, merkle.NewRFC6962TreeHasher(hasher)); err != nil {
+		glog.Fatalf("Failed to set up root state: %v", err)
+	}
+	if *thresholdFlag > 0 {
+		thresholdSigner, err := newThresholdSigner(keyManager, nextKeyManager, hasher, store)
+		if err != nil {
+			glog.Fatalf("Failed to set up threshold signing: %v", err)
+		}
+		signerServer = signer.NewThresholdServer(thresholdSigner, keyManager, hasher, allowedClients)
+	}
+
+	rpcServer := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	signer.RegisterSignerServer(rpcServer, signerServer)
+
+	go awaitSignal(rpcServer)
+	if err := rpcServer.Serve(lis); err != nil {
+		glog.Errorf("RPC server terminated on port %d: %v", *serverPortFlag, err)
+		os.Exit(1)
+	}
+	glog.Infof("Stopping server, about to exit")
+}
@@ -1,12 +1,20 @@
 package server
 
 import (
+	"bytes"
+	gocrypto "crypto"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/golang/protobuf/proto"
 	"github.com/google/trillian"
+	"github.com/google/trillian/checkpoint"
+	"github.com/google/trillian/crypto"
 	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/monitoring/trace"
+	"github.com/google/trillian/quota"
 	"github.com/google/trillian/storage"
 	"golang.org/x/net/context"
 )
@@ -17,12 +25,47 @@ import (
 // Pass this as a fixed value to proof calculations. It's used as the max depth of the tree
 const proofMaxBitLen = 64
 
+// maxQueueLeaves is the most leaves that can be queued in one request
+const maxQueueLeaves = 1000
+
+// maxWitnessIDLength is the longest witness ID a cosignature can be stored
+// with, which is the size of the WitnessId column
+const maxWitnessIDLength = 255
+
+// leavesByRangeBatchSize is the most leaves that GetLeavesByRange reads in one
+// transaction and sends in one response
+const leavesByRangeBatchSize = 1000
+
 // LogStorageProviderFunc decouples the server from storage implementations
 type LogStorageProviderFunc func(int64) (storage.LogStorage, error)
 
+// LogInitFunc creates and stores the signed root of the empty log treeID, held
+// in s
+type LogInitFunc func(treeID int64, s storage.LogStorage) (trillian.SignedLogRoot, error)
+
+// WitnessKeyFunc returns the public key of the witness witnessID of the log
+// logID, or false if the witness isn't known to the log.
+type WitnessKeyFunc func(logID int64, witnessID string) (gocrypto.PublicKey, bool)
+
+// TreeKeysFunc returns the keys of the tree treeID, ordered by activation time.
+type TreeKeysFunc func(treeID int64) ([]*trillian.TreeKey, error)
+
+// CheckpointSignerFunc returns the signer of the checkpoints of the log logID.
+type CheckpointSignerFunc func(logID int64) (*checkpoint.Signer, error)
+
 // TrillianLogServer implements the RPC API defined in the proto
 type TrillianLogServer struct {
 	storageProvider LogStorageProviderFunc
+	// initFunc creates the roots of new logs, InitLog fails if it's not set
+	initFunc LogInitFunc
+	// witnessKeys returns the keys cosignatures are checked with, no
+	// cosignatures are accepted if it's not set
+	witnessKeys WitnessKeyFunc
+	// treeKeys returns the keys of each log, GetTreeKeys fails if it's not set
+	treeKeys TreeKeysFunc
+	// checkpointSigner signs the checkpoints of each log, GetLatestCheckpoint
+	// fails if it's not set
+	checkpointSigner CheckpointSignerFunc
 }
 
 // NewTrillianLogServer creates a new RPC server backed by a LogStorageProvider.
@@ -30,32 +73,242 @@ func NewTrillianLogServer(p LogStorageProviderFunc) *TrillianLogServer {
 	return &TrillianLogServer{storageProvider: p}
 }
 
+// SetLogInitializer sets the function that InitLog uses to create the roots of
+// new logs. The server doesn't hold a signing key itself, so InitLog fails
+// unless this has been set.
+func (t *TrillianLogServer) SetLogInitializer(f LogInitFunc) {
+	t.initFunc = f
+}
+
+// SetWitnessKeys sets the function that AddLogRootCosignature uses to find the
+// key of the witness that made a cosignature. Cosignatures by witnesses it
+// doesn't know, or while it isn't set, are refused.
+func (t *TrillianLogServer) SetWitnessKeys(f WitnessKeyFunc) {
+	t.witnessKeys = f
+}
+
+// SetTreeKeys sets the function that GetTreeKeys uses to read the keys of each
+// log.
+func (t *TrillianLogServer) SetTreeKeys(f TreeKeysFunc) {
+	t.treeKeys = f
+}
+
+// SetCheckpointSigner sets the function that GetLatestCheckpoint uses to find
+// the signer of each log's checkpoints. Checkpoints are signed notes, so need
+// the log's key rather than the signature of its root.
+func (t *TrillianLogServer) SetCheckpointSigner(f CheckpointSignerFunc) {
+	t.checkpointSigner = f
+}
+
+// GetTreeKeys returns the public keys of a log, which clients need to check
+// its roots. Unlike the admin service's GetTree it's open to all clients.
+func (t *TrillianLogServer) GetTreeKeys(ctx context.Context, req *trillian.GetTreeKeysRequest) (*trillian.GetTreeKeysResponse, error) {
+	if t.treeKeys == nil {
+		return nil, errors.New("log server is not able to read tree keys")
+	}
+	// Only the keys of logs this server serves are returned
+	if _, err := t.storageProvider(req.TreeId); err != nil {
+		return nil, err
+	}
+	keys, err := t.treeKeys(req.TreeId)
+	if err != nil {
+		return nil, err
+	}
+	return &trillian.GetTreeKeysResponse{Keys: keys}, nil
+}
+
+// InitLog creates and stores a signed root for a new log, with size 0 and
+// revision 0, so that the log has a root before any leaves are sequenced.
+func (t *TrillianLogServer) InitLog(ctx context.Context, req *trillian.InitLogRequest) (*trillian.InitLogResponse, error) {
+	if t.initFunc == nil {
+		return nil, errors.New("log server is not able to sign roots")
+	}
+
+	s, err := t.storageProvider(req.LogId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := t.initFunc(req.LogId, s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &trillian.InitLogResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), Created: &root}, nil
+}
+
 // QueueLeaves submits a batch of leaves to the log for later integration into the underlying tree.
+// The response has the result for each leaf: leaves already in a log that doesn't allow duplicates
+// aren't queued again, and leaves that are over the write quota aren't queued at all. Duplicates
+// are returned as the existing leaf if the log merges them, or as submitted if it rejects them.
+// Leaves can only be queued to active logs.
 func (t *TrillianLogServer) QueueLeaves(ctx context.Context, req *trillian.QueueLeavesRequest) (*trillian.QueueLeavesResponse, error) {
-	leaves := protosToLeaves(req.Leaves)
-
-	if len(leaves) == 0 {
+	if len(req.Leaves) == 0 {
 		return &trillian.QueueLeavesResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, "Must queue at least one leaf")}, nil
 	}
 
-	tx, err := t.prepareStorageTx(req.LogId)
+	if len(req.Leaves) > maxQueueLeaves {
+		return &trillian.QueueLeavesResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, fmt.Sprintf("Can queue at most %d leaves in one request", maxQueueLeaves))}, nil
+	}
 
+	s, err := t.storageProvider(req.LogId)
 	if err != nil {
 		return nil, err
 	}
 
-	err = tx.QueueLeaves(leaves)
+	if state := s.TreeState(); state != trillian.TreeState_ACTIVE {
+		return &trillian.QueueLeavesResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, fmt.Sprintf("Log %d is %v, leaves can only be queued to active logs", req.LogId, state))}, nil
+	}
+
+	queued := make([]*trillian.QueuedLeaf, len(req.Leaves))
+	overQuota := quota.LeavesOverQuota(ctx)
+	var protos []*trillian.LeafProto
+	// indices holds the index in the request of each leaf in protos
+	var indices []int
+	for i, leaf := range req.Leaves {
+		if overQuota[i] {
+			queued[i] = &trillian.QueuedLeaf{Leaf: leaf, Status: trillian.QueuedLeaf_QUOTA_EXCEEDED}
+			continue
+		}
+		protos = append(protos, leaf)
+		indices = append(indices, i)
+	}
+
+	if len(protos) > 0 {
+		existing, err := t.queueLeaves(ctx, req.LogId, protosToLeaves(protos))
+		if err != nil {
+			return nil, err
+		}
+
+		// The policy is only needed if there are duplicates
+		var policy *trillian.DuplicatePolicy
+		for i, index := range indices {
+			if existing[i] != nil {
+				if policy == nil {
+					p := s.DuplicatePolicy()
+					policy = &p
+				}
+				if *policy == trillian.DuplicatePolicy_REJECT_DUPLICATES {
+					queued[index] = &trillian.QueuedLeaf{Leaf: protos[i], Status: trillian.QueuedLeaf_DUPLICATE_REJECTED}
+					continue
+				}
+				queued[index] = &trillian.QueuedLeaf{Leaf: leafToProto(*existing[i]), Status: trillian.QueuedLeaf_DUPLICATE}
+				continue
+			}
+			queued[index] = &trillian.QueuedLeaf{Leaf: protos[i], Status: trillian.QueuedLeaf_OK}
+		}
+	}
+
+	return &trillian.QueueLeavesResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), QueuedLeaves: queued}, nil
+}
+
+// queueLeaves queues leaves to the log logID in a single transaction, returning
+// the existing leaf for each that's a duplicate, or nil.
+func (t *TrillianLogServer) queueLeaves(ctx context.Context, logID int64, leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
+	tx, err := t.prepareStorageTx(ctx, logID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := tx.QueueLeaves(leaves)
 
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
+	if got, want := len(existing), len(leaves); got != want {
+		tx.Rollback()
+		return nil, fmt.Errorf("storage returned %d results for %d queued leaves", got, want)
+	}
+
 	if err := t.commitAndLog(tx, "QueueLeaves"); err != nil {
 		return nil, err
 	}
 
-	return &trillian.QueueLeavesResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK)}, nil
+	return existing, nil
+}
+
+// AddSequencedLeaves adds leaves to a pre-ordered log at the indices given in the request, which
+// must be contiguous and in order. The response has the result for each leaf: leaves that are
+// already at their index are returned as the existing leaf. The request fails, and no leaves are
+// added, if any index already holds a different leaf.
+func (t *TrillianLogServer) AddSequencedLeaves(ctx context.Context, req *trillian.AddSequencedLeavesRequest) (*trillian.AddSequencedLeavesResponse, error) {
+	if len(req.Leaves) == 0 {
+		return &trillian.AddSequencedLeavesResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, "Must add at least one leaf")}, nil
+	}
+
+	if len(req.Leaves) > maxQueueLeaves {
+		return &trillian.AddSequencedLeavesResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, fmt.Sprintf("Can add at most %d leaves in one request", maxQueueLeaves))}, nil
+	}
+
+	for i, leaf := range req.Leaves {
+		if leaf.LeafIndex < 0 || leaf.LeafIndex != req.Leaves[0].LeafIndex+int64(i) {
+			return &trillian.AddSequencedLeavesResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, "Leaf indices must be contiguous and in order")}, nil
+		}
+	}
+
+	s, err := t.storageProvider(req.LogId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if s.TreeType() != trillian.TreeType_PREORDERED_LOG {
+		return &trillian.AddSequencedLeavesResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, "Leaves can only be added at their indices to pre-ordered logs")}, nil
+	}
+
+	if state := s.TreeState(); state != trillian.TreeState_ACTIVE {
+		return &trillian.AddSequencedLeavesResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, fmt.Sprintf("Log %d is %v, leaves can only be added to active logs", req.LogId, state))}, nil
+	}
+
+	// The leaves are timestamped when they're added, as they'll be integrated
+	// in the order they already have
+	leaves := protosToLeaves(req.Leaves)
+	now := time.Now().UnixNano()
+	for i := range leaves {
+		leaves[i].IntegrateTimestampNanos = now
+	}
+
+	tx, err := t.prepareStorageTx(ctx, req.LogId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := tx.AddSequencedLeaves(leaves)
+
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if got, want := len(existing), len(leaves); got != want {
+		tx.Rollback()
+		return nil, fmt.Errorf("storage returned %d results for %d added leaves", got, want)
+	}
+
+	results := make([]*trillian.QueuedLeaf, len(leaves))
+	for i, leaf := range existing {
+		if leaf == nil {
+			results[i] = &trillian.QueuedLeaf{Leaf: req.Leaves[i], Status: trillian.QueuedLeaf_OK}
+			continue
+		}
+		if !bytes.Equal(leaf.LeafHash, leaves[i].LeafHash) {
+			tx.Rollback()
+			return &trillian.AddSequencedLeavesResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, fmt.Sprintf("A different leaf is already at index %d", leaf.SequenceNumber))}, nil
+		}
+		results[i] = &trillian.QueuedLeaf{Leaf: leafToProto(*leaf), Status: trillian.QueuedLeaf_DUPLICATE}
+	}
+
+	if err := t.commitAndLog(tx, "AddSequencedLeaves"); err != nil {
+		return nil, err
+	}
+
+	return &trillian.AddSequencedLeavesResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), Results: results}, nil
 }
 
 // GetInclusionProof obtains the proof of inclusion in the tree for a leaf that has been sequenced.
@@ -76,7 +329,7 @@ func (t *TrillianLogServer) GetInclusionProof(ctx context.Context, req *trillian
 
 	// Next we need to make sure the requested tree size corresponds to an STH, so that we
 	// have a usable tree revision
-	tx, err := t.prepareStorageTx(req.LogId)
+	tx, err := t.prepareStorageTx(ctx, req.LogId)
 
 	if err != nil {
 		return nil, err
@@ -122,7 +375,7 @@ func (t *TrillianLogServer) GetInclusionProofByHash(ctx context.Context, req *tr
 
 	// Next we need to make sure the requested tree size corresponds to an STH, so that we
 	// have a usable tree revision
-	tx, err := t.prepareStorageTx(req.LogId)
+	tx, err := t.prepareStorageTx(ctx, req.LogId)
 
 	if err != nil {
 		return nil, err
@@ -148,6 +401,11 @@ func (t *TrillianLogServer) GetInclusionProofByHash(ctx context.Context, req *tr
 	proofs := make([]*trillian.ProofProto, 0, len(leaves))
 
 	for _, leaf := range leaves {
+		// Leaves with the same hash may have been added after the tree reached
+		// the requested size, and they can't be proved at that size
+		if leaf.SequenceNumber >= req.TreeSize {
+			continue
+		}
 		proof, err := getInclusionProofForLeafIndexAtRevision(tx, treeRevision, req.TreeSize, leaf.SequenceNumber)
 
 		if err != nil {
@@ -170,6 +428,110 @@ func (t *TrillianLogServer) GetInclusionProofByHash(ctx context.Context, req *tr
 	return &response, nil
 }
 
+// GetInclusionProofBatch obtains proofs of inclusion for several leaves in a tree of the
+// same size. They're all built in one transaction, and the nodes shared between them, such
+// as those near the root, are only read once.
+func (t *TrillianLogServer) GetInclusionProofBatch(ctx context.Context, req *trillian.GetInclusionProofBatchRequest) (*trillian.GetInclusionProofBatchResponse, error) {
+	// Reject obviously invalid tree sizes and leaf indices
+	if req.TreeSize <= 0 {
+		return nil, fmt.Errorf("invalid tree size for proof batch: %d", req.TreeSize)
+	}
+
+	if len(req.LeafIndex) == 0 {
+		return nil, errors.New("no leaf indices in proof batch")
+	}
+
+	// Work out the nodes of every proof, and the distinct nodes that need to be read
+	proofNodeIDs := make([][]storage.NodeID, 0, len(req.LeafIndex))
+	var fetchIDs []storage.NodeID
+	fetchPos := make(map[string]int)
+
+	for _, leafIndex := range req.LeafIndex {
+		if leafIndex < 0 || leafIndex >= req.TreeSize {
+			return nil, fmt.Errorf("leaf index %d does not exist in tree of size %d", leafIndex, req.TreeSize)
+		}
+
+		nodeIDs, err := merkle.CalcInclusionProofNodeAddresses(req.TreeSize, leafIndex, proofMaxBitLen)
+
+		if err != nil {
+			return nil, err
+		}
+
+		proofNodeIDs = append(proofNodeIDs, nodeIDs)
+
+		for _, id := range nodeIDs {
+			if _, ok := fetchPos[id.String()]; !ok {
+				fetchPos[id.String()] = len(fetchIDs)
+				fetchIDs = append(fetchIDs, id)
+			}
+		}
+	}
+
+	// Next we need to make sure the requested tree size corresponds to an STH, so that we
+	// have a usable tree revision
+	tx, err := t.prepareStorageTx(ctx, req.LogId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	treeRevision, err := tx.GetTreeRevisionAtSize(req.TreeSize)
+
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	nodes, err := tx.GetMerkleNodes(treeRevision, fetchIDs)
+
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if len(nodes) != len(fetchIDs) {
+		tx.Rollback()
+		return nil, fmt.Errorf("expected %d nodes for proof batch but got %d", len(fetchIDs), len(nodes))
+	}
+
+	nodeProtos := make([]*trillian.NodeProto, 0, len(nodes))
+
+	for i, node := range nodes {
+		// additional check that the correct node was returned
+		if !node.NodeID.Equivalent(fetchIDs[i]) {
+			tx.Rollback()
+			return nil, fmt.Errorf("expected node %v at pos %d but got %v", fetchIDs[i], i, node.NodeID)
+		}
+
+		nodeProto, err := nodeToProto(node)
+
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		nodeProtos = append(nodeProtos, nodeProto)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	proofs := make([]*trillian.ProofProto, 0, len(req.LeafIndex))
+
+	for i, leafIndex := range req.LeafIndex {
+		proof := &trillian.ProofProto{LeafIndex: leafIndex, ProofNode: make([]*trillian.NodeProto, 0, len(proofNodeIDs[i]))}
+
+		for _, id := range proofNodeIDs[i] {
+			proof.ProofNode = append(proof.ProofNode, nodeProtos[fetchPos[id.String()]])
+		}
+
+		proofs = append(proofs, proof)
+	}
+
+	return &trillian.GetInclusionProofBatchResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), Proof: proofs}, nil
+}
+
 // GetConsistencyProof obtains a proof that two versions of the tree are consistent with each
 // other and that the later tree includes all the entries of the prior one. For more details
 // see the example trees in RFC 6962.
@@ -183,19 +545,40 @@ func (t *TrillianLogServer) GetConsistencyProof(ctx context.Context, req *trilli
 		return nil, fmt.Errorf("second tree size must be > 0 but was %d", req.SecondTreeSize)
 	}
 
-	if req.SecondTreeSize <= req.FirstTreeSize {
-		return nil, fmt.Errorf("second tree size (%d) must be > first tree size (%d)", req.SecondTreeSize, req.FirstTreeSize)
+	if req.SecondTreeSize < req.FirstTreeSize {
+		return nil, fmt.Errorf("second tree size (%d) must be >= first tree size (%d)", req.SecondTreeSize, req.FirstTreeSize)
 	}
 
-	nodeIDs, err := merkle.CalcConsistencyProofNodeAddresses(req.FirstTreeSize, req.SecondTreeSize, proofMaxBitLen)
+	tx, err := t.prepareStorageTx(ctx, req.LogId)
 
 	if err != nil {
 		return nil, err
 	}
 
-	tx, err := t.prepareStorageTx(req.LogId)
+	root, err := tx.LatestSignedLogRoot()
 
 	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if req.SecondTreeSize > root.TreeSize {
+		tx.Rollback()
+		return nil, fmt.Errorf("second tree size (%d) must be <= current tree size (%d)", req.SecondTreeSize, root.TreeSize)
+	}
+
+	// A tree is trivially consistent with itself, the proof is empty
+	if req.FirstTreeSize == req.SecondTreeSize {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return &trillian.GetConsistencyProofResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), Proof: &trillian.ProofProto{}}, nil
+	}
+
+	nodeIDs, err := merkle.CalcConsistencyProofNodeAddresses(req.FirstTreeSize, req.SecondTreeSize, proofMaxBitLen)
+
+	if err != nil {
+		tx.Rollback()
 		return nil, err
 	}
 
@@ -237,7 +620,7 @@ func (t *TrillianLogServer) GetConsistencyProof(ctx context.Context, req *trilli
 // GetLatestSignedLogRoot obtains the latest published tree root for the Merkle Tree that
 // underlies the log.
 func (t *TrillianLogServer) GetLatestSignedLogRoot(ctx context.Context, req *trillian.GetLatestSignedLogRootRequest) (*trillian.GetLatestSignedLogRootResponse, error) {
-	tx, err := t.prepareStorageTx(req.LogId)
+	tx, err := t.prepareStorageTx(ctx, req.LogId)
 
 	if err != nil {
 		return nil, err
@@ -250,17 +633,127 @@ func (t *TrillianLogServer) GetLatestSignedLogRoot(ctx context.Context, req *tri
 		return nil, err
 	}
 
+	// Every stored root has a hash, even the root of an empty log
+	var cosigs []trillian.Cosignature
+	if len(signedRoot.RootHash) > 0 {
+		if cosigs, err = tx.GetLogRootCosignatures(signedRoot.TreeRevision); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
 	if err := t.commitAndLog(tx, "GetLatestSignedLogRoot"); err != nil {
 		return nil, err
 	}
 
+	if len(signedRoot.RootHash) == 0 {
+		return nil, storage.ErrTreeNeedsInit
+	}
+
+	for i := range cosigs {
+		signedRoot.Cosignatures = append(signedRoot.Cosignatures, &cosigs[i])
+	}
+
 	return &trillian.GetLatestSignedLogRootResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), SignedLogRoot: &signedRoot}, nil
 }
 
+// GetLatestCheckpoint returns the latest signed root of the log, along with its
+// cosignatures, as a checkpoint signed with the log's key.
+func (t *TrillianLogServer) GetLatestCheckpoint(ctx context.Context, req *trillian.GetLatestCheckpointRequest) (*trillian.GetLatestCheckpointResponse, error) {
+	if t.checkpointSigner == nil {
+		return nil, errors.New("log server is not able to sign checkpoints")
+	}
+	resp, err := t.GetLatestSignedLogRoot(ctx, &trillian.GetLatestSignedLogRootRequest{LogId: req.LogId})
+	if err != nil {
+		return nil, err
+	}
+	signer, err := t.checkpointSigner(req.LogId)
+	if err != nil {
+		return nil, err
+	}
+
+	cp, err := checkpoint.Marshal(*resp.SignedLogRoot, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &trillian.GetLatestCheckpointResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), Checkpoint: cp}, nil
+}
+
+// AddLogRootCosignature stores a witness's signature of the log's latest root,
+// to be returned with the root. The witness must be one of the log's known
+// witnesses, and the signature must verify with its key.
+func (t *TrillianLogServer) AddLogRootCosignature(ctx context.Context, req *trillian.AddLogRootCosignatureRequest) (*trillian.AddLogRootCosignatureResponse, error) {
+	if req.Root == nil {
+		return nil, errors.New("no cosigned root in request")
+	}
+
+	cosig := req.Cosignature
+	if cosig == nil || cosig.Signature == nil || len(cosig.Signature.Signature) == 0 {
+		return nil, errors.New("no cosignature in request")
+	}
+
+	if len(cosig.WitnessId) == 0 || len(cosig.WitnessId) > maxWitnessIDLength {
+		return nil, fmt.Errorf("witness ID must be between 1 and %d bytes long", maxWitnessIDLength)
+	}
+	// The ID names the witness's signature line in checkpoints
+	if !checkpoint.ValidName(cosig.WitnessId) {
+		return nil, fmt.Errorf("witness ID %q must not contain spaces or plus signs", cosig.WitnessId)
+	}
+
+	var witnessKey gocrypto.PublicKey
+	if t.witnessKeys != nil {
+		witnessKey, _ = t.witnessKeys(req.LogId, cosig.WitnessId)
+	}
+	if witnessKey == nil {
+		return nil, fmt.Errorf("%q is not a witness of log %d", cosig.WitnessId, req.LogId)
+	}
+	hasher, err := trillian.NewHasher(cosig.Signature.HashAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("cosignature hash algorithm: %v", err)
+	}
+
+	tx, err := t.prepareStorageTx(ctx, req.LogId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := tx.LatestSignedLogRoot()
+
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Only the latest root can be cosigned, as it's the one clients are given
+	if req.Root.TreeRevision != root.TreeRevision || req.Root.TreeSize != root.TreeSize ||
+		req.Root.TimestampNanos != root.TimestampNanos || !bytes.Equal(req.Root.RootHash, root.RootHash) {
+		tx.Rollback()
+		return nil, fmt.Errorf("cosigned root at revision %d is not the latest root of the log, which is at revision %d", req.Root.TreeRevision, root.TreeRevision)
+	}
+
+	if err := crypto.VerifyLogRoot(witnessKey, hasher, root, *cosig.Signature); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("cosignature by %q is invalid: %v", cosig.WitnessId, err)
+	}
+
+	if err := tx.StoreLogRootCosignature(root.TreeRevision, trillian.Cosignature{WitnessId: cosig.WitnessId, Signature: cosig.Signature}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := t.commitAndLog(tx, "AddLogRootCosignature"); err != nil {
+		return nil, err
+	}
+
+	return &trillian.AddLogRootCosignatureResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK)}, nil
+}
+
 // GetSequencedLeafCount returns the number of leaves that have been integrated into the Merkle
 // Tree. This can be zero for a log containing no entries.
 func (t *TrillianLogServer) GetSequencedLeafCount(ctx context.Context, req *trillian.GetSequencedLeafCountRequest) (*trillian.GetSequencedLeafCountResponse, error) {
-	tx, err := t.prepareStorageTx(req.LogId)
+	tx, err := t.prepareStorageTx(ctx, req.LogId)
 
 	if err != nil {
 		return nil, err
@@ -289,7 +782,7 @@ func (t *TrillianLogServer) GetLeavesByIndex(ctx context.Context, req *trillian.
 		return &trillian.GetLeavesByIndexResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, "Invalid -ve leaf index in request")}, nil
 	}
 
-	tx, err := t.prepareStorageTx(req.LogId)
+	tx, err := t.prepareStorageTx(ctx, req.LogId)
 
 	if err != nil {
 		return nil, err
@@ -311,6 +804,92 @@ func (t *TrillianLogServer) GetLeavesByIndex(ctx context.Context, req *trillian.
 	return &trillian.GetLeavesByIndexResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), Leaves: leafProtos}, nil
 }
 
+// GetLeavesByRange streams the leaves of a log in order from the start index of the
+// request. The range is limited to the size of the latest signed root when the call
+// is made, so it only covers leaves that a follower can verify. Leaves are read in
+// batches, each in its own transaction, so a long stream doesn't hold one open.
+func (t *TrillianLogServer) GetLeavesByRange(req *trillian.GetLeavesByRangeRequest, stream trillian.TrillianLog_GetLeavesByRangeServer) error {
+	if req.StartIndex < 0 || req.Count < 0 {
+		return fmt.Errorf("invalid leaf range: start %d count %d", req.StartIndex, req.Count)
+	}
+
+	ctx := stream.Context()
+
+	tx, err := t.prepareStorageTx(ctx, req.LogId)
+
+	if err != nil {
+		return err
+	}
+
+	root, err := tx.LatestSignedLogRoot()
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := t.commitAndLog(tx, "GetLeavesByRange"); err != nil {
+		return err
+	}
+
+	end := root.TreeSize
+	if req.Count > 0 && req.StartIndex+req.Count < end {
+		end = req.StartIndex + req.Count
+	}
+
+	for next := req.StartIndex; next < end; {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		count := end - next
+		if count > leavesByRangeBatchSize {
+			count = leavesByRangeBatchSize
+		}
+
+		leaves, err := t.getLeavesByRange(ctx, req.LogId, next, count)
+
+		if err != nil {
+			return err
+		}
+
+		// All the leaves up to the size of a signed root have been sequenced
+		if len(leaves) == 0 {
+			return fmt.Errorf("log %d has no leaf at index %d, below tree size %d", req.LogId, next, root.TreeSize)
+		}
+
+		if err := stream.Send(&trillian.GetLeavesByRangeResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), Leaves: leavesToProtos(leaves)}); err != nil {
+			return err
+		}
+
+		next += int64(len(leaves))
+	}
+
+	return nil
+}
+
+// getLeavesByRange reads one batch of leaves for GetLeavesByRange.
+func (t *TrillianLogServer) getLeavesByRange(ctx context.Context, logID, start, count int64) ([]trillian.LogLeaf, error) {
+	tx, err := t.prepareStorageTx(ctx, logID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	leaves, err := tx.GetLeavesByRange(start, count)
+
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := t.commitAndLog(tx, "GetLeavesByRange"); err != nil {
+		return nil, err
+	}
+
+	return leaves, nil
+}
+
 // GetLeavesByHash obtains one or more leaves based on their tree hash. It is not possible
 // to fetch leaves that have been queued but not yet integrated. Logs may accept duplicate
 // entries so this may return more results than the number of hashes in the request.
@@ -319,7 +898,7 @@ func (t *TrillianLogServer) GetLeavesByHash(ctx context.Context, req *trillian.G
 		return &trillian.GetLeavesByHashResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, "Must supply at least one hash and none must be empty")}, nil
 	}
 
-	tx, err := t.prepareStorageTx(req.LogId)
+	tx, err := t.prepareStorageTx(ctx, req.LogId)
 
 	if err != nil {
 		return nil, err
@@ -341,6 +920,33 @@ func (t *TrillianLogServer) GetLeavesByHash(ctx context.Context, req *trillian.G
 	return &trillian.GetLeavesByHashResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), Leaves: leafProtos}, nil
 }
 
+// GetLeafIndexRangeByTime returns the range of indices of the leaves that were integrated into the
+// log within a window of time.
+func (t *TrillianLogServer) GetLeafIndexRangeByTime(ctx context.Context, req *trillian.GetLeafIndexRangeByTimeRequest) (*trillian.GetLeafIndexRangeByTimeResponse, error) {
+	if req.EndTimestampNanos < req.StartTimestampNanos {
+		return nil, fmt.Errorf("invalid time window for GetLeafIndexRangeByTime, end %d is before start %d", req.EndTimestampNanos, req.StartTimestampNanos)
+	}
+
+	tx, err := t.prepareStorageTx(ctx, req.LogId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	begin, end, err := tx.GetLeafIndexRangeByTime(req.StartTimestampNanos, req.EndTimestampNanos)
+
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := t.commitAndLog(tx, "GetLeafIndexRangeByTime"); err != nil {
+		return nil, err
+	}
+
+	return &trillian.GetLeafIndexRangeByTimeResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), BeginIndex: begin, EndIndex: end}, nil
+}
+
 // GetEntryAndProof returns both a Merkle Leaf entry and an inclusion proof for a given index
 // and tree size.
 func (t *TrillianLogServer) GetEntryAndProof(ctx context.Context, req *trillian.GetEntryAndProofRequest) (*trillian.GetEntryAndProofResponse, error) {
@@ -359,7 +965,7 @@ func (t *TrillianLogServer) GetEntryAndProof(ctx context.Context, req *trillian.
 
 	// Next we need to make sure the requested tree size corresponds to an STH, so that we
 	// have a usable tree revision
-	tx, err := t.prepareStorageTx(req.LogId)
+	tx, err := t.prepareStorageTx(ctx, req.LogId)
 
 	if err != nil {
 		return nil, err
@@ -407,7 +1013,9 @@ func (t *TrillianLogServer) GetEntryAndProof(ctx context.Context, req *trillian.
 		Leaf:   leafProtos[0]}, nil
 }
 
-func (t *TrillianLogServer) prepareStorageTx(treeID int64) (storage.LogTX, error) {
+// prepareStorageTx begins a transaction on the log's storage. If the request
+// is being traced, the transaction's operations are added to its span.
+func (t *TrillianLogServer) prepareStorageTx(ctx context.Context, treeID int64) (storage.LogTX, error) {
 	s, err := t.storageProvider(treeID)
 
 	if err != nil {
@@ -420,6 +1028,10 @@ func (t *TrillianLogServer) prepareStorageTx(treeID int64) (storage.LogTX, error
 		return nil, err
 	}
 
+	span := trace.FromContext(ctx)
+	span.SetTag("log_id", treeID)
+	trace.SetSpan(tx, span)
+
 	return tx, err
 }
 
@@ -460,7 +1072,7 @@ func protosToLeaves(protos []*trillian.LeafProto) []trillian.LogLeaf {
 
 // TODO: Fill in the log leaf specific fields when we've implemented signed timestamps
 func leafToProto(leaf trillian.LogLeaf) *trillian.LeafProto {
-	return &trillian.LeafProto{LeafIndex: leaf.SequenceNumber, LeafHash: leaf.LeafHash, LeafData: leaf.LeafValue, ExtraData: leaf.ExtraData}
+	return &trillian.LeafProto{LeafIndex: leaf.SequenceNumber, LeafHash: leaf.LeafHash, LeafData: leaf.LeafValue, ExtraData: leaf.ExtraData, IntegrateTimestampNanos: leaf.IntegrateTimestampNanos}
 }
 
 func leavesToProtos(leaves []trillian.LogLeaf) []*trillian.LeafProto {
@@ -541,14 +1153,25 @@ func fetchNodesAndBuildProof(tx storage.LogTX, treeRevision, leafIndex int64, pr
 			return trillian.ProofProto{}, fmt.Errorf("expected node %v at proof pos %d but got %v", proofNodeIDs[i], i, node.NodeID)
 		}
 
-		idBytes, err := proto.Marshal(node.NodeID.AsProto())
+		nodeProto, err := nodeToProto(node)
 
 		if err != nil {
 			return trillian.ProofProto{}, err
 		}
 
-		proof = append(proof, &trillian.NodeProto{NodeId: idBytes, NodeHash: node.Hash, NodeRevision: node.NodeRevision})
+		proof = append(proof, nodeProto)
 	}
 
 	return trillian.ProofProto{LeafIndex: leafIndex, ProofNode: proof}, nil
 }
+
+// nodeToProto converts a node read from storage into the form it takes in a proof.
+func nodeToProto(node storage.Node) (*trillian.NodeProto, error) {
+	idBytes, err := proto.Marshal(node.NodeID.AsProto())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &trillian.NodeProto{NodeId: idBytes, NodeHash: node.Hash, NodeRevision: node.NodeRevision}, nil
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	gocrypto "crypto"
 	"errors"
 	"fmt"
 	"strings"
@@ -9,9 +10,15 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/golang/protobuf/proto"
 	"github.com/google/trillian"
+	"github.com/google/trillian/checkpoint"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/quota"
 	"github.com/google/trillian/storage"
 	"github.com/google/trillian/testonly"
+	"github.com/google/trillian/util"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
 )
 
 var logID1 = int64(1)
@@ -228,7 +235,7 @@ func TestQueueLeavesStorageError(t *testing.T) {
 
 	test := newParameterizedTest(ctrl, "QueueLeaves",
 		func(t *storage.MockLogTX) {
-			t.EXPECT().QueueLeaves([]trillian.LogLeaf{leaf1}).Return(errors.New("STORAGE"))
+			t.EXPECT().QueueLeaves([]trillian.LogLeaf{leaf1}).Return(nil, errors.New("STORAGE"))
 		},
 		func(s *TrillianLogServer) error {
 			_, err := s.QueueLeaves(context.Background(), &queueRequest0)
@@ -258,7 +265,7 @@ func TestQueueLeavesCommitFails(t *testing.T) {
 
 	test := newParameterizedTest(ctrl, "QueueLeaves",
 		func(t *storage.MockLogTX) {
-			t.EXPECT().QueueLeaves([]trillian.LogLeaf{leaf1}).Return(nil)
+			t.EXPECT().QueueLeaves([]trillian.LogLeaf{leaf1}).Return([]*trillian.LogLeaf{nil}, nil)
 		},
 		func(s *TrillianLogServer) error {
 			_, err := s.QueueLeaves(context.Background(), &queueRequest0)
@@ -275,8 +282,9 @@ func TestQueueLeaves(t *testing.T) {
 	mockStorage := storage.NewMockLogStorage(ctrl)
 	mockTx := storage.NewMockLogTX(ctrl)
 
+	mockStorage.EXPECT().TreeState().Return(trillian.TreeState_ACTIVE)
 	mockStorage.EXPECT().Begin().Return(mockTx, nil)
-	mockTx.EXPECT().QueueLeaves([]trillian.LogLeaf{leaf1}).Return(nil)
+	mockTx.EXPECT().QueueLeaves([]trillian.LogLeaf{leaf1}).Return([]*trillian.LogLeaf{nil}, nil)
 	mockTx.EXPECT().Commit().Return(nil)
 	mockTx.EXPECT().IsOpen().AnyTimes().Return(false)
 
@@ -291,6 +299,122 @@ func TestQueueLeaves(t *testing.T) {
 	if expected, got := trillian.TrillianApiStatusCode_OK, resp.Status.StatusCode; expected != got {
 		t.Fatalf("Expected app level ok status but got: %v", resp.Status.StatusCode)
 	}
+
+	want := []*trillian.QueuedLeaf{{Leaf: &expectedLeaf1, Status: trillian.QueuedLeaf_OK}}
+	if got := resp.QueuedLeaves; len(got) != 1 || !proto.Equal(got[0], want[0]) {
+		t.Fatalf("Expected queued leaves %v but got: %v", want, got)
+	}
+}
+
+func TestQueueLeavesPerLeafStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The tree's quota runs out after the request and the first two leaves
+	quotaManager, err := quota.NewManager(quota.NewMemoryLimitStore(), quota.DefaultCostModel, util.SystemTimeSource{})
+	if err != nil {
+		t.Fatalf("Failed to create quota manager: %v", err)
+	}
+	limit := &trillian.QuotaLimit{Group: trillian.QuotaGroup_TREE, Kind: trillian.QuotaKind_WRITE, TreeId: logID1, TokensPerSecond: 0.001, Burst: 10}
+	if err := quotaManager.SetQuotaLimit(limit); err != nil {
+		t.Fatalf("Failed to set quota limit: %v", err)
+	}
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+
+	// The first leaf is already sequenced
+	existing := trillian.LogLeaf{SequenceNumber: 5, Leaf: leaf1.Leaf}
+	mockStorage.EXPECT().TreeState().Return(trillian.TreeState_ACTIVE)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().QueueLeaves([]trillian.LogLeaf{leaf1, leaf3}).Return([]*trillian.LogLeaf{&existing, nil}, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+	mockTx.EXPECT().IsOpen().AnyTimes().Return(false)
+	mockStorage.EXPECT().DuplicatePolicy().Return(trillian.DuplicatePolicy_MERGE_DUPLICATES)
+
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+	overQuotaLeaf := &trillian.LeafProto{LeafHash: []byte("hash4"), LeafData: []byte("value4")}
+	req := &trillian.QueueLeavesRequest{LogId: logID1, Leaves: []*trillian.LeafProto{&expectedLeaf1, &expectedLeaf3, overQuotaLeaf}}
+
+	resp, err := quotaManager.UnaryInterceptor()(context.Background(), req, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return server.QueueLeaves(ctx, req.(*trillian.QueueLeavesRequest))
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to queue leaves: %v", err)
+	}
+
+	want := []*trillian.QueuedLeaf{
+		{Leaf: &trillian.LeafProto{LeafIndex: 5, LeafHash: []byte("hash"), LeafData: []byte("value"), ExtraData: []byte("extra")}, Status: trillian.QueuedLeaf_DUPLICATE},
+		{Leaf: &expectedLeaf3, Status: trillian.QueuedLeaf_OK},
+		{Leaf: overQuotaLeaf, Status: trillian.QueuedLeaf_QUOTA_EXCEEDED},
+	}
+	got := resp.(*trillian.QueueLeavesResponse).QueuedLeaves
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d queued leaves but got: %v", len(want), got)
+	}
+	for i := range want {
+		if !proto.Equal(got[i], want[i]) {
+			t.Errorf("Expected queued leaf %d: %v but got: %v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestQueueLeavesDuplicatesRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+
+	existing := trillian.LogLeaf{SequenceNumber: 5, Leaf: leaf1.Leaf}
+	mockStorage.EXPECT().TreeState().Return(trillian.TreeState_ACTIVE)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().QueueLeaves([]trillian.LogLeaf{leaf1, leaf3}).Return([]*trillian.LogLeaf{&existing, nil}, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+	mockTx.EXPECT().IsOpen().AnyTimes().Return(false)
+	mockStorage.EXPECT().DuplicatePolicy().Return(trillian.DuplicatePolicy_REJECT_DUPLICATES)
+
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+	req := &trillian.QueueLeavesRequest{LogId: logID1, Leaves: []*trillian.LeafProto{&expectedLeaf1, &expectedLeaf3}}
+	resp, err := server.QueueLeaves(context.Background(), req)
+
+	if err != nil {
+		t.Fatalf("Failed to queue leaves: %v", err)
+	}
+
+	// The rejected duplicate is returned as it was submitted
+	want := []*trillian.QueuedLeaf{
+		{Leaf: &expectedLeaf1, Status: trillian.QueuedLeaf_DUPLICATE_REJECTED},
+		{Leaf: &expectedLeaf3, Status: trillian.QueuedLeaf_OK},
+	}
+	if len(resp.QueuedLeaves) != len(want) {
+		t.Fatalf("Expected %d queued leaves but got: %v", len(want), resp.QueuedLeaves)
+	}
+	for i := range want {
+		if !proto.Equal(resp.QueuedLeaves[i], want[i]) {
+			t.Errorf("Expected queued leaf %d: %v but got: %v", i, want[i], resp.QueuedLeaves[i])
+		}
+	}
+}
+
+func TestQueueLeavesTooManyLeavesRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+
+	req := &trillian.QueueLeavesRequest{LogId: logID1}
+	for i := 0; i <= maxQueueLeaves; i++ {
+		req.Leaves = append(req.Leaves, &expectedLeaf1)
+	}
+	resp, err := server.QueueLeaves(context.Background(), req)
+
+	if err != nil || resp.Status.StatusCode != trillian.TrillianApiStatusCode_ERROR {
+		t.Fatalf("Allowed %d leaves to be queued", len(req.Leaves))
+	}
 }
 
 func TestQueueLeavesNoLeavesRejected(t *testing.T) {
@@ -308,6 +432,23 @@ func TestQueueLeavesNoLeavesRejected(t *testing.T) {
 	}
 }
 
+func TestQueueLeavesInactiveLogRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, state := range []trillian.TreeState{trillian.TreeState_FROZEN, trillian.TreeState_DRAINING, trillian.TreeState_ARCHIVED} {
+		mockStorage := storage.NewMockLogStorage(ctrl)
+		mockStorage.EXPECT().TreeState().Return(state)
+		server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+
+		resp, err := server.QueueLeaves(context.Background(), &queueRequest0)
+
+		if err != nil || resp.Status.StatusCode != trillian.TrillianApiStatusCode_ERROR {
+			t.Errorf("Allowed leaves to be queued to a %v log: %v, %v", state, resp, err)
+		}
+	}
+}
+
 func TestQueueLeavesBeginFailsCausesError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -322,6 +463,129 @@ func TestQueueLeavesBeginFailsCausesError(t *testing.T) {
 	test.executeBeginFailsTest(t)
 }
 
+func TestAddSequencedLeaves(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+
+	leaf4 := trillian.LeafProto{LeafIndex: 4, LeafHash: []byte("hash4"), LeafData: []byte("value4")}
+	existing := trillian.LogLeaf{SequenceNumber: 3, IntegrateTimestampNanos: 1234, Leaf: leaf3.Leaf}
+	mockStorage.EXPECT().TreeType().Return(trillian.TreeType_PREORDERED_LOG)
+	mockStorage.EXPECT().TreeState().Return(trillian.TreeState_ACTIVE)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().AddSequencedLeaves(gomock.Any()).Do(func(leaves []trillian.LogLeaf) {
+		for i, leaf := range leaves {
+			if leaf.SequenceNumber != int64(3+i) || leaf.IntegrateTimestampNanos == 0 {
+				t.Errorf("AddSequencedLeaves() leaf %d: %v, want index %d with a timestamp", i, leaf, 3+i)
+			}
+		}
+	}).Return([]*trillian.LogLeaf{&existing, nil}, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+	mockTx.EXPECT().IsOpen().AnyTimes().Return(false)
+
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+	req := &trillian.AddSequencedLeavesRequest{LogId: logID1, Leaves: []*trillian.LeafProto{&expectedLeaf3, &leaf4}}
+	resp, err := server.AddSequencedLeaves(context.Background(), req)
+
+	if err != nil || resp.Status.StatusCode != trillian.TrillianApiStatusCode_OK {
+		t.Fatalf("Failed to add sequenced leaves: %v, %v", resp, err)
+	}
+
+	// The duplicate is returned as the leaf already in the log
+	want := []*trillian.QueuedLeaf{
+		{Leaf: &trillian.LeafProto{LeafIndex: 3, LeafHash: []byte("hash3"), LeafData: []byte("value3"), ExtraData: []byte("extra3"), IntegrateTimestampNanos: 1234}, Status: trillian.QueuedLeaf_DUPLICATE},
+		{Leaf: &leaf4, Status: trillian.QueuedLeaf_OK},
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("Expected %d results but got: %v", len(want), resp.Results)
+	}
+	for i := range want {
+		if !proto.Equal(resp.Results[i], want[i]) {
+			t.Errorf("Expected result %d: %v but got: %v", i, want[i], resp.Results[i])
+		}
+	}
+}
+
+func TestAddSequencedLeavesConflictRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+
+	existing := trillian.LogLeaf{SequenceNumber: 3, Leaf: leaf1.Leaf}
+	mockStorage.EXPECT().TreeType().Return(trillian.TreeType_PREORDERED_LOG)
+	mockStorage.EXPECT().TreeState().Return(trillian.TreeState_ACTIVE)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().AddSequencedLeaves(gomock.Any()).Return([]*trillian.LogLeaf{&existing}, nil)
+	mockTx.EXPECT().Rollback().Return(nil)
+
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+	req := &trillian.AddSequencedLeavesRequest{LogId: logID1, Leaves: []*trillian.LeafProto{&expectedLeaf3}}
+	resp, err := server.AddSequencedLeaves(context.Background(), req)
+
+	if err != nil || resp.Status.StatusCode != trillian.TrillianApiStatusCode_ERROR {
+		t.Fatalf("Allowed a different leaf to be added at an index in use: %v, %v", resp, err)
+	}
+}
+
+func TestAddSequencedLeavesFrozenLogRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockStorage.EXPECT().TreeType().Return(trillian.TreeType_PREORDERED_LOG)
+	mockStorage.EXPECT().TreeState().Return(trillian.TreeState_FROZEN)
+
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+	req := &trillian.AddSequencedLeavesRequest{LogId: logID1, Leaves: []*trillian.LeafProto{&expectedLeaf3}}
+	resp, err := server.AddSequencedLeaves(context.Background(), req)
+
+	if err != nil || resp.Status.StatusCode != trillian.TrillianApiStatusCode_ERROR {
+		t.Fatalf("Allowed leaves to be added to a frozen log: %v, %v", resp, err)
+	}
+}
+
+func TestAddSequencedLeavesInvalidRequestRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+
+	for _, leaves := range [][]*trillian.LeafProto{
+		nil,
+		{&expectedLeaf1, &expectedLeaf3},
+		{&expectedLeaf3, &expectedLeaf1},
+		{{LeafIndex: -1, LeafHash: []byte("hash")}},
+	} {
+		req := &trillian.AddSequencedLeavesRequest{LogId: logID1, Leaves: leaves}
+		resp, err := server.AddSequencedLeaves(context.Background(), req)
+
+		if err != nil || resp.Status.StatusCode != trillian.TrillianApiStatusCode_ERROR {
+			t.Errorf("Allowed leaves %v to be added: %v, %v", leaves, resp, err)
+		}
+	}
+}
+
+func TestAddSequencedLeavesNotPreorderedRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockStorage.EXPECT().TreeType().Return(trillian.TreeType_LOG)
+
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+	req := &trillian.AddSequencedLeavesRequest{LogId: logID1, Leaves: []*trillian.LeafProto{&expectedLeaf1}}
+	resp, err := server.AddSequencedLeaves(context.Background(), req)
+
+	if err != nil || resp.Status.StatusCode != trillian.TrillianApiStatusCode_ERROR {
+		t.Fatalf("Allowed leaves to be added at their indices to a log that isn't pre-ordered: %v, %v", resp, err)
+	}
+}
+
 func TestGetLatestSignedLogRootBeginFails(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -391,8 +655,10 @@ func TestGetLatestSignedLogRoot(t *testing.T) {
 	mockStorage := storage.NewMockLogStorage(ctrl)
 	mockTx := storage.NewMockLogTX(ctrl)
 
+	cosig := trillian.Cosignature{WitnessId: "witness", Signature: &trillian.DigitallySigned{Signature: []byte("cosig")}}
 	mockStorage.EXPECT().Begin().Return(mockTx, nil)
 	mockTx.EXPECT().LatestSignedLogRoot().Return(signedRoot1, nil)
+	mockTx.EXPECT().GetLogRootCosignatures(signedRoot1.TreeRevision).Return([]trillian.Cosignature{cosig}, nil)
 	mockTx.EXPECT().Commit().Return(nil)
 
 	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
@@ -407,8 +673,380 @@ func TestGetLatestSignedLogRoot(t *testing.T) {
 		t.Fatalf("Expected app level ok status but got: %v", resp.Status.StatusCode)
 	}
 
-	if !proto.Equal(&signedRoot1, resp.SignedLogRoot) {
-		t.Fatalf("Log root proto mismatch:\n%v\n%v", signedRoot1, resp.SignedLogRoot)
+	want := signedRoot1
+	want.Cosignatures = []*trillian.Cosignature{&cosig}
+	if !proto.Equal(&want, resp.SignedLogRoot) {
+		t.Fatalf("Log root proto mismatch:\n%v\n%v", want, resp.SignedLogRoot)
+	}
+}
+
+func TestGetLatestSignedLogRootNotInitialized(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().LatestSignedLogRoot().Return(trillian.SignedLogRoot{}, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+
+	if _, err := server.GetLatestSignedLogRoot(context.Background(), &getLogRootRequest1); err != storage.ErrTreeNeedsInit {
+		t.Fatalf("GetLatestSignedLogRoot() = %v, want %v", err, storage.ErrTreeNeedsInit)
+	}
+}
+
+func TestGetLatestCheckpoint(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+
+	root := signedRoot1
+	root.Signature = &trillian.DigitallySigned{Signature: []byte("sig")}
+	cosig := trillian.Cosignature{WitnessId: "witness", Signature: &trillian.DigitallySigned{Signature: []byte("cosig")}}
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().LatestSignedLogRoot().Return(root, nil)
+	mockTx.EXPECT().GetLogRootCosignatures(root.TreeRevision).Return([]trillian.Cosignature{cosig}, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+	if _, err := server.GetLatestCheckpoint(context.Background(), &trillian.GetLatestCheckpointRequest{LogId: logID1}); err == nil {
+		t.Fatal("GetLatestCheckpoint() without a checkpoint signer succeeded, want an error")
+	}
+
+	key, err := crypto.GenerateKey(trillian.SignatureAlgorithm_ECDSA)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	server.SetCheckpointSigner(func(logID int64) (*checkpoint.Signer, error) {
+		return checkpoint.NewSigner(checkpoint.Origin(logID), key)
+	})
+	resp, err := server.GetLatestCheckpoint(context.Background(), &trillian.GetLatestCheckpointRequest{LogId: logID1})
+	if err != nil {
+		t.Fatalf("GetLatestCheckpoint() = %v", err)
+	}
+
+	got, err := checkpoint.Open(resp.Checkpoint, checkpoint.Origin(logID1), key.Public())
+	if err != nil {
+		t.Fatalf("Failed to open checkpoint %q: %v", resp.Checkpoint, err)
+	}
+	// The checkpoint holds the log's signature of its text instead of the
+	// root's signature
+	want := root
+	want.Signature = nil
+	want.Cosignatures = []*trillian.Cosignature{&cosig}
+	if !proto.Equal(&want, &got) {
+		t.Errorf("Checkpoint root mismatch:\n%v\n%v", want, got)
+	}
+}
+
+func TestAddLogRootCosignature(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+
+	witnessKey, err := crypto.GenerateKey(trillian.SignatureAlgorithm_ECDSA)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	server.SetWitnessKeys(func(logID int64, witnessID string) (gocrypto.PublicKey, bool) {
+		if logID != logID1 || witnessID != "witness" {
+			return nil, false
+		}
+		return witnessKey.Public(), true
+	})
+
+	root := signedRoot1
+	root.TreeRevision = 5
+	sig, err := crypto.NewTrillianSigner(trillian.NewSHA256(), trillian.SignatureAlgorithm_ECDSA, witnessKey).SignLogRoot(root)
+	if err != nil {
+		t.Fatalf("SignLogRoot failed: %v", err)
+	}
+	cosig := trillian.Cosignature{WitnessId: "witness", Signature: &sig}
+
+	// Requests without a root or a signed cosignature, by a witness the log
+	// doesn't know, or with an ID checkpoints can't hold, are refused
+	for _, req := range []*trillian.AddLogRootCosignatureRequest{
+		{LogId: logID1, Cosignature: &cosig},
+		{LogId: logID1, Root: &root, Cosignature: &trillian.Cosignature{WitnessId: "witness"}},
+		{LogId: logID1, Root: &root, Cosignature: &trillian.Cosignature{Signature: cosig.Signature}},
+		{LogId: logID1, Root: &root, Cosignature: &trillian.Cosignature{WitnessId: "other", Signature: cosig.Signature}},
+		{LogId: logID1, Root: &root, Cosignature: &trillian.Cosignature{WitnessId: "a witness", Signature: cosig.Signature}},
+		{LogId: logID2, Root: &root, Cosignature: &cosig},
+	} {
+		if _, err := server.AddLogRootCosignature(context.Background(), req); err == nil {
+			t.Errorf("AddLogRootCosignature(%v) succeeded, want an error", req)
+		}
+	}
+
+	// A root that isn't the latest one can't be cosigned
+	older := root
+	older.TreeRevision, older.TreeSize = 4, 6
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().LatestSignedLogRoot().Return(root, nil)
+	mockTx.EXPECT().Rollback().Return(nil)
+
+	if _, err := server.AddLogRootCosignature(context.Background(), &trillian.AddLogRootCosignatureRequest{LogId: logID1, Root: &older, Cosignature: &cosig}); err == nil {
+		t.Error("AddLogRootCosignature() of an older root succeeded, want an error")
+	}
+
+	// Nor can a cosignature that isn't of the root
+	badSig := sig
+	badSig.Signature = []byte("cosig")
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().LatestSignedLogRoot().Return(root, nil)
+	mockTx.EXPECT().Rollback().Return(nil)
+
+	if _, err := server.AddLogRootCosignature(context.Background(), &trillian.AddLogRootCosignatureRequest{LogId: logID1, Root: &root, Cosignature: &trillian.Cosignature{WitnessId: "witness", Signature: &badSig}}); err == nil {
+		t.Error("AddLogRootCosignature() with a bad signature succeeded, want an error")
+	}
+
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().LatestSignedLogRoot().Return(root, nil)
+	mockTx.EXPECT().StoreLogRootCosignature(int64(5), cosig).Return(nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	resp, err := server.AddLogRootCosignature(context.Background(), &trillian.AddLogRootCosignatureRequest{LogId: logID1, Root: &root, Cosignature: &cosig})
+	if err != nil {
+		t.Fatalf("AddLogRootCosignature() = %v", err)
+	}
+	if got, want := resp.Status.StatusCode, trillian.TrillianApiStatusCode_OK; got != want {
+		t.Errorf("AddLogRootCosignature() status = %v, want %v", got, want)
+	}
+}
+
+func TestInitLog(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+
+	if _, err := server.InitLog(context.Background(), &trillian.InitLogRequest{LogId: logID1}); err == nil {
+		t.Fatal("InitLog() succeeded without a log initializer")
+	}
+
+	server.SetLogInitializer(func(treeID int64, s storage.LogStorage) (trillian.SignedLogRoot, error) {
+		if treeID != logID1 {
+			t.Errorf("Log initializer called for log %d, want %d", treeID, logID1)
+		}
+		if s != mockStorage {
+			t.Errorf("Log initializer called with storage %v, want %v", s, mockStorage)
+		}
+		return signedRoot1, nil
+	})
+	resp, err := server.InitLog(context.Background(), &trillian.InitLogRequest{LogId: logID1})
+	if err != nil {
+		t.Fatalf("InitLog() = %v", err)
+	}
+	if !proto.Equal(&signedRoot1, resp.Created) {
+		t.Errorf("InitLog() created %v, want %v", resp.Created, signedRoot1)
+	}
+
+	if _, err := server.InitLog(context.Background(), &trillian.InitLogRequest{LogId: logID2}); err == nil || !strings.Contains(err.Error(), "BADLOGID") {
+		t.Errorf("InitLog() for unknown log = %v, want storage provider error", err)
+	}
+}
+
+func TestGetTreeKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+
+	if _, err := server.GetTreeKeys(context.Background(), &trillian.GetTreeKeysRequest{TreeId: logID1}); err == nil {
+		t.Fatal("GetTreeKeys() succeeded without tree keys")
+	}
+
+	keys := []*trillian.TreeKey{{KeyId: "old"}, {KeyId: "new", ActivateTimeNanos: 1000}}
+	server.SetTreeKeys(func(treeID int64) ([]*trillian.TreeKey, error) {
+		if treeID != logID1 {
+			t.Errorf("Tree keys read for tree %d, want %d", treeID, logID1)
+		}
+		return keys, nil
+	})
+	resp, err := server.GetTreeKeys(context.Background(), &trillian.GetTreeKeysRequest{TreeId: logID1})
+	if err != nil {
+		t.Fatalf("GetTreeKeys() = %v", err)
+	}
+	if !proto.Equal(resp, &trillian.GetTreeKeysResponse{Keys: keys}) {
+		t.Errorf("GetTreeKeys() = %v, want keys %v", resp, keys)
+	}
+
+	if _, err := server.GetTreeKeys(context.Background(), &trillian.GetTreeKeysRequest{TreeId: logID2}); err == nil || !strings.Contains(err.Error(), "BADLOGID") {
+		t.Errorf("GetTreeKeys() for unknown log = %v, want storage provider error", err)
+	}
+}
+
+func TestGetLeafIndexRangeByTime(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().GetLeafIndexRangeByTime(int64(100), int64(200)).Return(int64(3), int64(7), nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+
+	resp, err := server.GetLeafIndexRangeByTime(context.Background(), &trillian.GetLeafIndexRangeByTimeRequest{LogId: logID1, StartTimestampNanos: 100, EndTimestampNanos: 200})
+	if err != nil {
+		t.Fatalf("GetLeafIndexRangeByTime() = %v", err)
+	}
+	if resp.BeginIndex != 3 || resp.EndIndex != 7 {
+		t.Errorf("GetLeafIndexRangeByTime() = [%d, %d), want [3, 7)", resp.BeginIndex, resp.EndIndex)
+	}
+}
+
+func TestGetLeafIndexRangeByTimeInvalidWindow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+
+	if _, err := server.GetLeafIndexRangeByTime(context.Background(), &trillian.GetLeafIndexRangeByTimeRequest{LogId: logID1, StartTimestampNanos: 200, EndTimestampNanos: 100}); err == nil {
+		t.Fatal("GetLeafIndexRangeByTime() succeeded with end before start")
+	}
+}
+
+func TestGetLeafIndexRangeByTimeStorageFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	test := newParameterizedTest(ctrl, "GetLeafIndexRangeByTime",
+		func(t *storage.MockLogTX) {
+			t.EXPECT().GetLeafIndexRangeByTime(int64(100), int64(200)).Return(int64(0), int64(0), errors.New("STORAGE"))
+		},
+		func(s *TrillianLogServer) error {
+			_, err := s.GetLeafIndexRangeByTime(context.Background(), &trillian.GetLeafIndexRangeByTimeRequest{LogId: logID1, StartTimestampNanos: 100, EndTimestampNanos: 200})
+			return err
+		})
+
+	test.executeStorageFailureTest(t)
+}
+
+// fakeLeavesByRangeStream is a GetLeavesByRange server stream which keeps the
+// responses sent on it.
+type fakeLeavesByRangeStream struct {
+	grpc.ServerStream
+	ctx   context.Context
+	resps []*trillian.GetLeavesByRangeResponse
+}
+
+func (f *fakeLeavesByRangeStream) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeLeavesByRangeStream) Send(resp *trillian.GetLeavesByRangeResponse) error {
+	f.resps = append(f.resps, resp)
+	return nil
+}
+
+// makeLeafRange returns count leaves with consecutive indices from start.
+func makeLeafRange(start, count int64) []trillian.LogLeaf {
+	leaves := make([]trillian.LogLeaf, 0, count)
+	for i := start; i < start+count; i++ {
+		leaves = append(leaves, trillian.LogLeaf{SequenceNumber: i, Leaf: trillian.Leaf{LeafHash: []byte(fmt.Sprintf("hash%d", i))}})
+	}
+	return leaves
+}
+
+func TestGetLeavesByRange(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		req      trillian.GetLeavesByRangeRequest
+		treeSize int64
+		// reads are the start and count of each batch read from storage
+		reads [][2]int64
+	}{
+		{desc: "to tree size", req: trillian.GetLeavesByRangeRequest{LogId: logID1, StartIndex: 1}, treeSize: 7, reads: [][2]int64{{1, 6}}},
+		{desc: "count", req: trillian.GetLeavesByRangeRequest{LogId: logID1, StartIndex: 2, Count: 3}, treeSize: 7, reads: [][2]int64{{2, 3}}},
+		{desc: "count beyond tree size", req: trillian.GetLeavesByRangeRequest{LogId: logID1, StartIndex: 5, Count: 10}, treeSize: 7, reads: [][2]int64{{5, 2}}},
+		{desc: "batches", req: trillian.GetLeavesByRangeRequest{LogId: logID1, StartIndex: 10}, treeSize: 2510, reads: [][2]int64{{10, 1000}, {1010, 1000}, {2010, 500}}},
+		{desc: "start at tree size", req: trillian.GetLeavesByRangeRequest{LogId: logID1, StartIndex: 7}, treeSize: 7},
+	} {
+		ctrl := gomock.NewController(t)
+
+		mockStorage := storage.NewMockLogStorage(ctrl)
+		mockTx := storage.NewMockLogTX(ctrl)
+		mockStorage.EXPECT().Begin().Times(len(test.reads)+1).Return(mockTx, nil)
+		mockTx.EXPECT().LatestSignedLogRoot().Return(trillian.SignedLogRoot{TreeSize: test.treeSize}, nil)
+		for _, r := range test.reads {
+			mockTx.EXPECT().GetLeavesByRange(r[0], r[1]).Return(makeLeafRange(r[0], r[1]), nil)
+		}
+		mockTx.EXPECT().Commit().Times(len(test.reads) + 1).Return(nil)
+
+		server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+		stream := &fakeLeavesByRangeStream{ctx: context.Background()}
+		if err := server.GetLeavesByRange(&test.req, stream); err != nil {
+			t.Errorf("%s: GetLeavesByRange() = %v", test.desc, err)
+			ctrl.Finish()
+			continue
+		}
+
+		if got, want := len(stream.resps), len(test.reads); got != want {
+			t.Errorf("%s: got %d responses, want %d", test.desc, got, want)
+		}
+		next := test.req.StartIndex
+		for _, resp := range stream.resps {
+			for _, leaf := range resp.Leaves {
+				if leaf.LeafIndex != next {
+					t.Errorf("%s: got leaf %d, want %d", test.desc, leaf.LeafIndex, next)
+				}
+				next++
+			}
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestGetLeavesByRangeInvalidRange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+
+	for _, req := range []trillian.GetLeavesByRangeRequest{
+		{LogId: logID1, StartIndex: -1},
+		{LogId: logID1, StartIndex: 1, Count: -3},
+	} {
+		if err := server.GetLeavesByRange(&req, &fakeLeavesByRangeStream{ctx: context.Background()}); err == nil {
+			t.Errorf("GetLeavesByRange(%v) succeeded, want error", req)
+		}
+	}
+}
+
+func TestGetLeavesByRangeStorageError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+	mockStorage.EXPECT().Begin().Times(2).Return(mockTx, nil)
+	mockTx.EXPECT().LatestSignedLogRoot().Return(trillian.SignedLogRoot{TreeSize: 7}, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+	mockTx.EXPECT().GetLeavesByRange(int64(0), int64(7)).Return(nil, errors.New("STORAGE"))
+	mockTx.EXPECT().Rollback().Return(nil)
+
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+	stream := &fakeLeavesByRangeStream{ctx: context.Background()}
+	if err := server.GetLeavesByRange(&trillian.GetLeavesByRangeRequest{LogId: logID1}, stream); err == nil || !strings.Contains(err.Error(), "STORAGE") {
+		t.Fatalf("Expected storage error but got: %v", err)
+	}
+	if len(stream.resps) != 0 {
+		t.Fatalf("Got %d responses after a storage error, want none", len(stream.resps))
 	}
 }
 
@@ -733,6 +1371,128 @@ func TestGetProofByHash(t *testing.T) {
 	}
 }
 
+func TestGetProofByHashSkipsLeavesBeyondTreeSize(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+
+	// The hash also matches a leaf added once the tree was bigger than 7
+	mockTx.EXPECT().GetTreeRevisionAtSize(getInclusionProofByHashRequest7.TreeSize).Return(int64(3), nil)
+	mockTx.EXPECT().GetLeavesByHash([]trillian.Hash{[]byte("ahash")}, false).Return([]trillian.LogLeaf{{SequenceNumber: 2}, {SequenceNumber: 9}}, nil)
+	mockTx.EXPECT().GetMerkleNodes(int64(3), nodeIdsInclusionSize7Index2).Return([]storage.Node{
+		{NodeID: nodeIdsInclusionSize7Index2[0], NodeRevision: 3, Hash: []byte("nodehash0")},
+		{NodeID: nodeIdsInclusionSize7Index2[1], NodeRevision: 2, Hash: []byte("nodehash1")},
+		{NodeID: nodeIdsInclusionSize7Index2[2], NodeRevision: 3, Hash: []byte("nodehash2")}}, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+
+	proofResponse, err := server.GetInclusionProofByHash(context.Background(), &getInclusionProofByHashRequest7)
+
+	if err != nil {
+		t.Fatalf("get inclusion proof by hash should have succeeded but we got: %v", err)
+	}
+
+	if got := len(proofResponse.Proof); got != 1 || proofResponse.Proof[0].LeafIndex != 2 {
+		t.Fatalf("expected a proof for leaf 2 only but got: %v", proofResponse.Proof)
+	}
+}
+
+func TestGetInclusionProofBatchRejectsBadRequests(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+
+	for _, request := range []trillian.GetInclusionProofBatchRequest{
+		{LogId: logID1, TreeSize: 0, LeafIndex: []int64{0}},
+		{LogId: logID1, TreeSize: 7},
+		{LogId: logID1, TreeSize: 7, LeafIndex: []int64{2, -1}},
+		{LogId: logID1, TreeSize: 7, LeafIndex: []int64{2, 7}},
+	} {
+		_, err := server.GetInclusionProofBatch(context.Background(), &request)
+
+		if err == nil {
+			t.Fatalf("get inclusion proof batch accepted invalid request: %v", request)
+		}
+	}
+}
+
+func TestGetInclusionProofBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+
+	// The proofs of leaves 2 and 3 share all but their first node, which are
+	// only read once
+	var fetchIDs []storage.NodeID
+	var fetched []storage.Node
+	for i, leafIndex := range []int64{2, 3} {
+		nodeIDs, err := merkle.CalcInclusionProofNodeAddresses(7, leafIndex, proofMaxBitLen)
+
+		if err != nil {
+			t.Fatalf("failed to calculate proof nodes: %v", err)
+		}
+
+		for j, id := range nodeIDs {
+			if i == 0 || j == 0 {
+				fetchIDs = append(fetchIDs, id)
+				fetched = append(fetched, storage.Node{NodeID: id, NodeRevision: 3, Hash: []byte(id.String())})
+			}
+		}
+	}
+	mockTx.EXPECT().GetTreeRevisionAtSize(int64(7)).Return(int64(3), nil)
+	mockTx.EXPECT().GetMerkleNodes(int64(3), fetchIDs).Return(fetched, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+
+	response, err := server.GetInclusionProofBatch(context.Background(), &trillian.GetInclusionProofBatchRequest{LogId: logID1, TreeSize: 7, LeafIndex: []int64{2, 3}})
+
+	if err != nil {
+		t.Fatalf("get inclusion proof batch should have succeeded but we got: %v", err)
+	}
+
+	if response.Status == nil || response.Status.StatusCode != trillian.TrillianApiStatusCode_OK {
+		t.Fatalf("server response was not successful: %v", response)
+	}
+
+	if got, want := len(response.Proof), 2; got != want {
+		t.Fatalf("expected %d proofs but got: %d", want, got)
+	}
+
+	for i, leafIndex := range []int64{2, 3} {
+		nodeIDs, err := merkle.CalcInclusionProofNodeAddresses(7, leafIndex, proofMaxBitLen)
+
+		if err != nil {
+			t.Fatalf("failed to calculate proof nodes: %v", err)
+		}
+
+		expectedProof := trillian.ProofProto{LeafIndex: leafIndex}
+
+		for _, id := range nodeIDs {
+			nodeProto, err := nodeToProto(storage.Node{NodeID: id, NodeRevision: 3, Hash: []byte(id.String())})
+
+			if err != nil {
+				t.Fatalf("failed to convert node: %v", err)
+			}
+
+			expectedProof.ProofNode = append(expectedProof.ProofNode, nodeProto)
+		}
+
+		if !proto.Equal(response.Proof[i], &expectedProof) {
+			t.Errorf("expected proof: %v but got: %v", expectedProof, response.Proof[i])
+		}
+	}
+}
+
 func TestGetProofByIndexBadTreeSize(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -1272,6 +2032,7 @@ func TestGetConsistencyProofGetTreeRevision1Fails(t *testing.T) {
 
 	test := newParameterizedTest(ctrl, "GetConsistencyProof",
 		func(t *storage.MockLogTX) {
+			t.EXPECT().LatestSignedLogRoot().Return(trillian.SignedLogRoot{TreeSize: 25}, nil)
 			t.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest25.FirstTreeSize).Return(int64(0), errors.New("STORAGE"))
 		},
 		func(s *TrillianLogServer) error {
@@ -1288,6 +2049,7 @@ func TestGetConsistencyProofGetTreeRevision2Fails(t *testing.T) {
 
 	test := newParameterizedTest(ctrl, "GetConsistencyProof",
 		func(t *storage.MockLogTX) {
+			t.EXPECT().LatestSignedLogRoot().Return(trillian.SignedLogRoot{TreeSize: 25}, nil)
 			t.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest25.FirstTreeSize).Return(int64(11), nil)
 			t.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest25.SecondTreeSize).Return(int64(0), errors.New("STORAGE"))
 		},
@@ -1305,6 +2067,7 @@ func TestGetConsistencyProofGetNodesFails(t *testing.T) {
 
 	test := newParameterizedTest(ctrl, "GetConsistencyProof",
 		func(t *storage.MockLogTX) {
+			t.EXPECT().LatestSignedLogRoot().Return(trillian.SignedLogRoot{TreeSize: 25}, nil)
 			t.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest7.FirstTreeSize).Return(int64(3), nil)
 			t.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest7.SecondTreeSize).Return(int64(5), nil)
 			t.EXPECT().GetMerkleNodes(int64(5), nodeIdsConsistencySize4ToSize7).Return([]storage.Node{}, errors.New("STORAGE"))
@@ -1325,6 +2088,7 @@ func TestGetConsistencyProofGetNodesReturnsWrongCount(t *testing.T) {
 	mockTx := storage.NewMockLogTX(ctrl)
 	mockStorage.EXPECT().Begin().Return(mockTx, nil)
 
+	mockTx.EXPECT().LatestSignedLogRoot().Return(trillian.SignedLogRoot{TreeSize: 25}, nil)
 	mockTx.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest7.FirstTreeSize).Return(int64(3), nil)
 	mockTx.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest7.SecondTreeSize).Return(int64(5), nil)
 	// The server expects one node from storage but we return two
@@ -1348,6 +2112,7 @@ func TestGetConsistencyProofGetNodesReturnsWrongNode(t *testing.T) {
 	mockTx := storage.NewMockLogTX(ctrl)
 	mockStorage.EXPECT().Begin().Return(mockTx, nil)
 
+	mockTx.EXPECT().LatestSignedLogRoot().Return(trillian.SignedLogRoot{TreeSize: 25}, nil)
 	mockTx.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest7.FirstTreeSize).Return(int64(3), nil)
 	mockTx.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest7.SecondTreeSize).Return(int64(5), nil)
 	// Return an unexpected node that wasn't requested
@@ -1369,6 +2134,7 @@ func TestGetConsistencyProofCommitFails(t *testing.T) {
 
 	test := newParameterizedTest(ctrl, "GetConsistencyProof",
 		func(t *storage.MockLogTX) {
+			t.EXPECT().LatestSignedLogRoot().Return(trillian.SignedLogRoot{TreeSize: 25}, nil)
 			t.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest7.FirstTreeSize).Return(int64(3), nil)
 			t.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest7.SecondTreeSize).Return(int64(5), nil)
 			t.EXPECT().GetMerkleNodes(int64(5), nodeIdsConsistencySize4ToSize7).Return([]storage.Node{{NodeID: testonly.MustCreateNodeIDForTreeCoords(2, 1, 64), NodeRevision: 3}}, nil)
@@ -1381,6 +2147,55 @@ func TestGetConsistencyProofCommitFails(t *testing.T) {
 	test.executeCommitFailsTest(t)
 }
 
+func TestGetConsistencyProofBeyondTreeSize(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+
+	mockTx.EXPECT().LatestSignedLogRoot().Return(trillian.SignedLogRoot{TreeSize: 24}, nil)
+	mockTx.EXPECT().Rollback().Return(nil)
+
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+
+	_, err := server.GetConsistencyProof(context.Background(), &getConsistencyProofRequest25)
+
+	if err == nil || !strings.Contains(err.Error(), "current tree size") {
+		t.Fatalf("get consistency proof returned no or wrong error for a size beyond the tree: %v", err)
+	}
+}
+
+func TestGetConsistencyProofSameSize(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+
+	// No nodes are needed to prove a tree consistent with itself
+	mockTx.EXPECT().LatestSignedLogRoot().Return(trillian.SignedLogRoot{TreeSize: 25}, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
+
+	response, err := server.GetConsistencyProof(context.Background(), &trillian.GetConsistencyProofRequest{LogId: logID1, FirstTreeSize: 10, SecondTreeSize: 10})
+
+	if err != nil {
+		t.Fatalf("failed to get consistency proof: %v", err)
+	}
+
+	if response.Status == nil || response.Status.StatusCode != trillian.TrillianApiStatusCode_OK {
+		t.Fatalf("server response was not successful: %v", response)
+	}
+
+	if len(response.Proof.ProofNode) != 0 {
+		t.Fatalf("expected an empty proof but got: %v", response.Proof)
+	}
+}
+
 func TestGetConsistencyProof(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -1389,6 +2204,7 @@ func TestGetConsistencyProof(t *testing.T) {
 	mockTx := storage.NewMockLogTX(ctrl)
 	mockStorage.EXPECT().Begin().Return(mockTx, nil)
 
+	mockTx.EXPECT().LatestSignedLogRoot().Return(trillian.SignedLogRoot{TreeSize: 25}, nil)
 	mockTx.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest7.FirstTreeSize).Return(int64(3), nil)
 	mockTx.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest7.SecondTreeSize).Return(int64(5), nil)
 	mockTx.EXPECT().GetMerkleNodes(int64(5), nodeIdsConsistencySize4ToSize7).Return([]storage.Node{{NodeID: testonly.MustCreateNodeIDForTreeCoords(2, 1, 64), NodeRevision: 3, Hash: []byte("nodehash")}}, nil)
@@ -1439,6 +2255,7 @@ func (p *parameterizedTest) executeCommitFailsTest(t *testing.T) {
 	mockStorage := storage.NewMockLogStorage(p.ctrl)
 	mockTx := storage.NewMockLogTX(p.ctrl)
 
+	mockStorage.EXPECT().TreeState().AnyTimes().Return(trillian.TreeState_ACTIVE)
 	mockStorage.EXPECT().Begin().Return(mockTx, nil)
 	p.prepareTx(mockTx)
 	mockTx.EXPECT().Commit().Return(errors.New("Bang!"))
@@ -1470,6 +2287,7 @@ func (p *parameterizedTest) executeStorageFailureTest(t *testing.T) {
 	mockStorage := storage.NewMockLogStorage(p.ctrl)
 	mockTx := storage.NewMockLogTX(p.ctrl)
 
+	mockStorage.EXPECT().TreeState().AnyTimes().Return(trillian.TreeState_ACTIVE)
 	mockStorage.EXPECT().Begin().Return(mockTx, nil)
 	p.prepareTx(mockTx)
 	mockTx.EXPECT().Rollback().Return(nil)
@@ -1487,6 +2305,7 @@ func (p *parameterizedTest) executeBeginFailsTest(t *testing.T) {
 	mockStorage := storage.NewMockLogStorage(p.ctrl)
 	mockTx := storage.NewMockLogTX(p.ctrl)
 
+	mockStorage.EXPECT().TreeState().AnyTimes().Return(trillian.TreeState_ACTIVE)
 	mockStorage.EXPECT().Begin().Return(mockTx, errors.New("TX"))
 
 	server := NewTrillianLogServer(mockStorageProviderfunc(mockStorage))
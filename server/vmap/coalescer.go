@@ -0,0 +1,157 @@
+package vmap
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// setLeavesFunc writes a revision of a map containing the leaves in req.
+type setLeavesFunc func(req *trillian.SetMapLeavesRequest) (*trillian.SetMapLeavesResponse, error)
+
+// pendingWrite is a SetLeaves request waiting for its revision to be written.
+type pendingWrite struct {
+	req  *trillian.SetMapLeavesRequest
+	resp *trillian.SetMapLeavesResponse
+	err  error
+	done chan struct{}
+}
+
+// writeWindow holds the writes to a map waiting for its window to close, and
+// the mapper metadata of the revision they'll be written in.
+type writeWindow struct {
+	writes     []*pendingWrite
+	mapperData *trillian.MapperMetadata
+}
+
+// writeCoalescer folds the SetLeaves requests for a map that arrive within a
+// window of each other into a single revision. Without it every request writes
+// its own revision, so a chatty writer quickly builds up revisions and copies of
+// the nodes near the root that differ by only a few leaves.
+type writeCoalescer struct {
+	window    time.Duration
+	setLeaves setLeavesFunc
+
+	// Must hold this lock before accessing open
+	mu sync.Mutex
+	// open holds the window of each map that has writes waiting
+	open map[int64]*writeWindow
+}
+
+func newWriteCoalescer(window time.Duration, setLeaves setLeavesFunc) *writeCoalescer {
+	return &writeCoalescer{window: window, setLeaves: setLeaves, open: make(map[int64]*writeWindow)}
+}
+
+// SetLeaves adds req to the open window for its map, opening one if needed, and
+// waits for the revision holding it to be written. The revision is written once
+// the window closes, and each request in it gets its own copy of the response.
+//
+// The mapper metadata of the requests in a window is merged, so the revision
+// covers the log entries applied by all of them. A request whose metadata
+// can't be merged, because it's for another log or doesn't follow on from the
+// entries of the requests already waiting, fails with FailedPrecondition.
+//
+// If ctx is done first SetLeaves returns its error, but the leaves may still be
+// written.
+func (c *writeCoalescer) SetLeaves(ctx context.Context, req *trillian.SetMapLeavesRequest) (*trillian.SetMapLeavesResponse, error) {
+	w := &pendingWrite{req: req, done: make(chan struct{})}
+
+	c.mu.Lock()
+	win, ok := c.open[req.MapId]
+	if !ok {
+		win = &writeWindow{}
+		c.open[req.MapId] = win
+		time.AfterFunc(c.window, func() { c.close(req.MapId) })
+	}
+	mapperData, err := mergeMapperData(win.mapperData, req.MapperData)
+	if err != nil {
+		c.mu.Unlock()
+		return nil, grpc.Errorf(codes.FailedPrecondition, "mapper metadata can't be written with the writes waiting for map %d: %v", req.MapId, err)
+	}
+	win.mapperData = mapperData
+	win.writes = append(win.writes, w)
+	c.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return w.resp, w.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// close closes the open window of map mapID and writes its revision.
+func (c *writeCoalescer) close(mapID int64) {
+	c.mu.Lock()
+	win := c.open[mapID]
+	delete(c.open, mapID)
+	c.mu.Unlock()
+	if len(win.writes) > 0 {
+		c.write(mapID, win)
+	}
+}
+
+// write writes the leaves of the writes in win as one revision, and completes
+// them. Where several writes set the same key, the one that arrived last wins.
+func (c *writeCoalescer) write(mapID int64, win *writeWindow) {
+	defer func() {
+		for _, w := range win.writes {
+			close(w.done)
+		}
+	}()
+
+	combined := &trillian.SetMapLeavesRequest{MapId: mapID, MapperData: win.mapperData}
+	indices := make(map[string]int)
+	for _, w := range win.writes {
+		for _, kv := range w.req.KeyValue {
+			if i, ok := indices[string(kv.Key)]; ok {
+				combined.KeyValue[i] = kv
+				continue
+			}
+			indices[string(kv.Key)] = len(combined.KeyValue)
+			combined.KeyValue = append(combined.KeyValue, kv)
+		}
+	}
+
+	resp, err := c.setLeaves(combined)
+	for _, w := range win.writes {
+		if err != nil {
+			w.err = err
+			continue
+		}
+		w.resp = proto.Clone(resp).(*trillian.SetMapLeavesResponse)
+	}
+}
+
+// mergeMapperData returns the mapper metadata of a revision applying the log
+// entries of a and then those of b, either of which may be nil. Metadata with
+// a source log can only be merged with metadata from the same log whose entries
+// follow on from its own, and metadata without one only with identical
+// metadata.
+func mergeMapperData(a, b *trillian.MapperMetadata) (*trillian.MapperMetadata, error) {
+	if a == nil {
+		return b, nil
+	}
+	if b == nil || proto.Equal(a, b) {
+		return a, nil
+	}
+	if len(a.SourceLogId) == 0 || len(b.SourceLogId) == 0 {
+		return nil, errors.New("metadata differs")
+	}
+	if err := storage.CheckMapperMetadataFollows(a, b); err != nil {
+		return nil, err
+	}
+	return &trillian.MapperMetadata{
+		SourceLogId:                  a.SourceLogId,
+		HighestFullyCompletedSeq:     b.HighestFullyCompletedSeq,
+		HighestPartiallyCompletedSeq: b.HighestPartiallyCompletedSeq,
+		RevisionStartSeq:             a.RevisionStartSeq,
+	}, nil
+}
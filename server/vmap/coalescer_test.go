@@ -0,0 +1,163 @@
+package vmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestWriteCoalescerFoldsWrites(t *testing.T) {
+	var mu sync.Mutex
+	var written []*trillian.SetMapLeavesRequest
+	c := newWriteCoalescer(100*time.Millisecond, func(req *trillian.SetMapLeavesRequest) (*trillian.SetMapLeavesResponse, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		written = append(written, req)
+		return &trillian.SetMapLeavesResponse{MapRoot: &trillian.SignedMapRoot{MapRevision: int64(len(written))}}, nil
+	})
+
+	reqs := []*trillian.SetMapLeavesRequest{
+		{MapId: 1, KeyValue: []*trillian.KeyValue{
+			{Key: []byte("a"), Value: &trillian.MapLeaf{LeafValue: []byte("first")}},
+			{Key: []byte("b"), Value: &trillian.MapLeaf{LeafValue: []byte("b")}},
+		}},
+		{MapId: 1, KeyValue: []*trillian.KeyValue{{Key: []byte("a"), Value: &trillian.MapLeaf{LeafValue: []byte("second")}}}},
+		{MapId: 2, KeyValue: []*trillian.KeyValue{{Key: []byte("a"), Value: &trillian.MapLeaf{LeafValue: []byte("other map")}}}},
+	}
+	resps := make([]*trillian.SetMapLeavesResponse, len(reqs))
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func(i int, req *trillian.SetMapLeavesRequest) {
+			defer wg.Done()
+			resp, err := c.SetLeaves(context.Background(), req)
+			if err != nil {
+				t.Errorf("SetLeaves(%d) failed: %v", i, err)
+			}
+			resps[i] = resp
+		}(i, req)
+		// Keep the arrival order of the writes to map 1
+		time.Sleep(10 * time.Millisecond)
+	}
+	wg.Wait()
+
+	if len(written) != 2 {
+		t.Fatalf("Wrote %d revisions, want one per map", len(written))
+	}
+	if resps[0] == resps[1] {
+		t.Errorf("Writes to the same map share a response")
+	}
+	if resps[0].MapRoot.MapRevision != resps[1].MapRoot.MapRevision || resps[0].MapRoot.MapRevision == resps[2].MapRoot.MapRevision {
+		t.Errorf("Writes to the same map got different revisions, or different maps the same one")
+	}
+	for _, req := range written {
+		if req.MapId != 1 {
+			continue
+		}
+		if len(req.KeyValue) != 2 {
+			t.Fatalf("Revision for map 1 has %d leaves, want 2", len(req.KeyValue))
+		}
+		if got := string(req.KeyValue[0].Value.LeafValue); got != "second" {
+			t.Errorf("Key a has value %q, want the later write", got)
+		}
+	}
+}
+
+func TestWriteCoalescerMergesMapperData(t *testing.T) {
+	var mu sync.Mutex
+	var written []*trillian.SetMapLeavesRequest
+	c := newWriteCoalescer(100*time.Millisecond, func(req *trillian.SetMapLeavesRequest) (*trillian.SetMapLeavesResponse, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		written = append(written, req)
+		return &trillian.SetMapLeavesResponse{}, nil
+	})
+
+	reqs := []*trillian.SetMapLeavesRequest{
+		{MapId: 1, MapperData: &trillian.MapperMetadata{SourceLogId: []byte("log"), RevisionStartSeq: 0, HighestFullyCompletedSeq: 9}},
+		// Doesn't follow on from the first
+		{MapId: 1, MapperData: &trillian.MapperMetadata{SourceLogId: []byte("log"), RevisionStartSeq: 5, HighestFullyCompletedSeq: 19}},
+		{MapId: 1, MapperData: &trillian.MapperMetadata{SourceLogId: []byte("log"), RevisionStartSeq: 10, HighestFullyCompletedSeq: 19}},
+		{MapId: 1},
+	}
+	errs := make([]error, len(reqs))
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func(i int, req *trillian.SetMapLeavesRequest) {
+			defer wg.Done()
+			_, errs[i] = c.SetLeaves(context.Background(), req)
+		}(i, req)
+		time.Sleep(10 * time.Millisecond)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if got, want := grpc.Code(err), codes.OK; i == 1 {
+			want = codes.FailedPrecondition
+			if got != want {
+				t.Errorf("SetLeaves(%d)=%v, want code %v", i, err, want)
+			}
+		} else if got != want {
+			t.Errorf("SetLeaves(%d)=%v, want no error", i, err)
+		}
+	}
+	if len(written) != 1 {
+		t.Fatalf("Wrote %d revisions, want 1", len(written))
+	}
+	want := &trillian.MapperMetadata{SourceLogId: []byte("log"), RevisionStartSeq: 0, HighestFullyCompletedSeq: 19}
+	if got := written[0].MapperData; !proto.Equal(got, want) {
+		t.Errorf("Revision has mapper metadata %v, want %v", got, want)
+	}
+}
+
+func TestWriteCoalescerStopsWaiting(t *testing.T) {
+	written := make(chan struct{})
+	c := newWriteCoalescer(100*time.Millisecond, func(req *trillian.SetMapLeavesRequest) (*trillian.SetMapLeavesResponse, error) {
+		close(written)
+		return &trillian.SetMapLeavesResponse{}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: 1}); err != context.Canceled {
+		t.Errorf("SetLeaves() with a cancelled context = %v, want %v", err, context.Canceled)
+	}
+	// The write is still made
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		t.Errorf("Window of the cancelled write wasn't written")
+	}
+}
+
+func TestSetLeavesCoalesced(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTx, provider := setupEmptyMap(ctrl)
+	mockTx.EXPECT().SetMerkleNodes(gomock.Any()).AnyTimes().Return(nil)
+	mockTx.EXPECT().Commit().AnyTimes().Return(nil)
+	// Both requests are written in one revision
+	mockTx.EXPECT().StoreSignedMapRoot(gomock.Any()).Times(1).Return(nil)
+
+	server := NewTrillianMapServerWithCoalescing(provider, nil, 100*time.Millisecond)
+	var wg sync.WaitGroup
+	for _, kv := range testKeyValues {
+		wg.Add(1)
+		go func(kv *trillian.KeyValue) {
+			defer wg.Done()
+			if _, err := server.SetLeaves(context.Background(), &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: []*trillian.KeyValue{kv}}); err != nil {
+				t.Errorf("SetLeaves failed: %v", err)
+			}
+		}(kv)
+	}
+	wg.Wait()
+}
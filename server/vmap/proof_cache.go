@@ -0,0 +1,114 @@
+package vmap
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/google/trillian"
+)
+
+// proofCacheKey identifies a cached inclusion proof.
+type proofCacheKey struct {
+	treeID   int64
+	revision int64
+	keyHash  string
+}
+
+type proofCacheEntry struct {
+	key   proofCacheKey
+	proof []trillian.Hash
+}
+
+// ProofCache holds recently generated map inclusion proofs so that repeated
+// requests for the same keys don't each need a fresh walk of the subtrees.
+// When full the least recently used proof is evicted. It is safe for concurrent
+// use.
+//
+// A proof at a published revision never changes, so only proofs for published
+// revisions are cached. Revision numbers can be reused after the map head is
+// reverted, so all the proofs for a map are invalidated whenever a new revision
+// is written.
+// Writes made through another server are not seen, so maps that are written by
+// more than one server should not share a cache with a long lifetime.
+type ProofCache struct {
+	maxEntries int
+	// Must hold this lock before accessing the fields below
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[proofCacheKey]*list.Element
+}
+
+// NewProofCache creates a ProofCache holding at most maxEntries proofs.
+func NewProofCache(maxEntries int) *ProofCache {
+	return &ProofCache{
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    make(map[proofCacheKey]*list.Element),
+	}
+}
+
+// Get returns the cached proof for keyHash in the map at revision, if any.
+func (c *ProofCache) Get(treeID, revision int64, keyHash trillian.Hash) ([]trillian.Hash, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[proofCacheKey{treeID, revision, string(keyHash)}]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+
+	return e.Value.(*proofCacheEntry).proof, true
+}
+
+// Put adds the proof for keyHash in the map at revision to the cache. The proof
+// must not be modified afterwards.
+func (c *ProofCache) Put(treeID, revision int64, keyHash trillian.Hash, proof []trillian.Hash) {
+	if c.maxEntries <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := proofCacheKey{treeID, revision, string(keyHash)}
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*proofCacheEntry).proof = proof
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&proofCacheEntry{key: key, proof: proof})
+
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// InvalidateTree removes all the cached proofs for a map. It must be called when
+// a new revision of the map is written.
+func (c *ProofCache) InvalidateTree(treeID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for e := c.lru.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*proofCacheEntry).key.treeID == treeID {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+// Len returns the number of proofs currently cached.
+func (c *ProofCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+func (c *ProofCache) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.entries, e.Value.(*proofCacheEntry).key)
+}
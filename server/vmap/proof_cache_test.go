@@ -0,0 +1,89 @@
+package vmap
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/trillian"
+)
+
+var testProof = []trillian.Hash{trillian.Hash("sibling1"), trillian.Hash("sibling2")}
+
+func TestProofCacheGetPut(t *testing.T) {
+	c := NewProofCache(10)
+
+	if _, ok := c.Get(1, 2, trillian.Hash("key")); ok {
+		t.Fatalf("Unexpected proof in empty cache")
+	}
+
+	c.Put(1, 2, trillian.Hash("key"), testProof)
+
+	proof, ok := c.Get(1, 2, trillian.Hash("key"))
+	if !ok {
+		t.Fatalf("Expected cached proof to be found")
+	}
+	if !reflect.DeepEqual(proof, testProof) {
+		t.Fatalf("Got proof %v, want %v", proof, testProof)
+	}
+
+	// Proofs are specific to the tree, revision and key
+	for _, k := range []struct {
+		treeID, revision int64
+		keyHash          string
+	}{{2, 2, "key"}, {1, 3, "key"}, {1, 2, "other"}} {
+		if _, ok := c.Get(k.treeID, k.revision, trillian.Hash(k.keyHash)); ok {
+			t.Errorf("Unexpected proof found for %v", k)
+		}
+	}
+}
+
+func TestProofCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewProofCache(2)
+
+	c.Put(1, 1, trillian.Hash("a"), testProof)
+	c.Put(1, 1, trillian.Hash("b"), testProof)
+	// Touching a makes b the least recently used
+	if _, ok := c.Get(1, 1, trillian.Hash("a")); !ok {
+		t.Fatalf("Expected proof for a to be cached")
+	}
+	c.Put(1, 1, trillian.Hash("c"), testProof)
+
+	if got, want := c.Len(), 2; got != want {
+		t.Fatalf("Cache holds %d proofs, want %d", got, want)
+	}
+	if _, ok := c.Get(1, 1, trillian.Hash("b")); ok {
+		t.Fatalf("Expected proof for b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(1, 1, trillian.Hash(key)); !ok {
+			t.Errorf("Expected proof for %s to be cached", key)
+		}
+	}
+}
+
+func TestProofCacheInvalidateTree(t *testing.T) {
+	c := NewProofCache(10)
+
+	c.Put(1, 1, trillian.Hash("a"), testProof)
+	c.Put(1, 2, trillian.Hash("b"), testProof)
+	c.Put(2, 1, trillian.Hash("a"), testProof)
+
+	c.InvalidateTree(1)
+
+	if got, want := c.Len(), 1; got != want {
+		t.Fatalf("Cache holds %d proofs after invalidation, want %d", got, want)
+	}
+	if _, ok := c.Get(2, 1, trillian.Hash("a")); !ok {
+		t.Fatalf("Expected proof for other tree to remain cached")
+	}
+}
+
+func TestProofCacheDisabled(t *testing.T) {
+	c := NewProofCache(0)
+
+	c.Put(1, 1, trillian.Hash("a"), testProof)
+
+	if _, ok := c.Get(1, 1, trillian.Hash("a")); ok {
+		t.Fatalf("Unexpected proof in zero sized cache")
+	}
+}
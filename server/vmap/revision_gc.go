@@ -0,0 +1,133 @@
+package vmap
+
+import (
+	"github.com/golang/glog"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util"
+)
+
+// RevisionGarbageCollector enforces map retention policies by pruning revisions
+// that fall outside them.
+type RevisionGarbageCollector struct {
+	timeSource util.TimeSource
+}
+
+// NewRevisionGarbageCollector creates a new RevisionGarbageCollector which uses
+// timeSource to decide which revisions are too old to keep.
+func NewRevisionGarbageCollector(timeSource util.TimeSource) *RevisionGarbageCollector {
+	return &RevisionGarbageCollector{timeSource: timeSource}
+}
+
+// PruneMap prunes the revisions of the map held in s that its retention policy no
+// longer requires. It returns the oldest revision retained after pruning.
+func (r *RevisionGarbageCollector) PruneMap(s storage.MapStorage) (oldest int64, err error) {
+	tx, err := s.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		if e := tx.Commit(); e != nil {
+			glog.Warningf("Commit failed for revision GC: %v", e)
+			oldest, err = 0, e
+		}
+	}()
+
+	policy, err := tx.GetRetentionPolicy()
+	if err != nil {
+		return 0, err
+	}
+
+	oldest, err = tx.OldestRetainedRevision()
+	if err != nil {
+		return 0, err
+	}
+
+	root, err := tx.LatestSignedMapRoot()
+	if err != nil {
+		return 0, err
+	}
+
+	// Work out the earliest revision each part of the policy requires to be kept,
+	// the latest revision is always kept.
+	cutoff := oldest
+	if policy.MaxRevisions > 0 {
+		if c := root.MapRevision - policy.MaxRevisions + 1; c > cutoff {
+			cutoff = c
+		}
+	}
+	if policy.MaxAge > 0 {
+		c, err := tx.EarliestRevisionSince(r.timeSource.Now().Add(-policy.MaxAge).UnixNano())
+		if err != nil {
+			return 0, err
+		}
+		if c > cutoff {
+			cutoff = c
+		}
+	}
+	if cutoff > root.MapRevision {
+		cutoff = root.MapRevision
+	}
+
+	if cutoff <= oldest {
+		return oldest, nil
+	}
+
+	if err = tx.PruneRevisionsBefore(cutoff); err != nil {
+		return 0, err
+	}
+
+	glog.Infof("Pruned map %d revisions before %d", s.MapID().TreeID, cutoff)
+
+	return cutoff, nil
+}
+
+// DeleteSupersededLeaves deletes the leaves and subtrees of the map held in s that
+// were superseded before its oldest retained revision, so are no longer needed.
+// Nothing is deleted while the map has restored revisions, as reads at them may
+// need the data. It returns the number of leaves deleted.
+func (r *RevisionGarbageCollector) DeleteSupersededLeaves(s storage.MapStorage) (deleted int64, err error) {
+	tx, err := s.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		if e := tx.Commit(); e != nil {
+			glog.Warningf("Commit failed for superseded leaf GC: %v", e)
+			deleted, err = 0, e
+		}
+	}()
+
+	restored, err := tx.GetRestoredRevisions()
+	if err != nil {
+		return 0, err
+	}
+	if len(restored) > 0 {
+		return 0, nil
+	}
+
+	oldest, err := tx.OldestRetainedRevision()
+	if err != nil {
+		return 0, err
+	}
+	if oldest <= 0 {
+		return 0, nil
+	}
+
+	if deleted, err = tx.DeleteMapLeavesBelowRevision(oldest); err != nil {
+		return 0, err
+	}
+
+	if deleted > 0 {
+		glog.Infof("Deleted %d superseded leaves of map %d below revision %d", deleted, s.MapID().TreeID, oldest)
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,103 @@
+package vmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util"
+)
+
+var fakeTime = time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func TestPruneMap(t *testing.T) {
+	var tests = []struct {
+		desc       string
+		policy     storage.RetentionPolicy
+		oldest     int64
+		latest     int64
+		sinceRev   int64
+		wantOldest int64
+	}{
+		{desc: "no policy", oldest: 0, latest: 10, wantOldest: 0},
+		{desc: "max revisions", policy: storage.RetentionPolicy{MaxRevisions: 3}, oldest: 2, latest: 10, wantOldest: 8},
+		{desc: "max revisions already pruned", policy: storage.RetentionPolicy{MaxRevisions: 3}, oldest: 8, latest: 10, wantOldest: 8},
+		{desc: "max revisions more than exist", policy: storage.RetentionPolicy{MaxRevisions: 30}, oldest: 0, latest: 10, wantOldest: 0},
+		{desc: "max age", policy: storage.RetentionPolicy{MaxAge: time.Hour}, oldest: 0, latest: 10, sinceRev: 9, wantOldest: 9},
+		{desc: "both, age wins", policy: storage.RetentionPolicy{MaxRevisions: 5, MaxAge: time.Hour}, oldest: 0, latest: 10, sinceRev: 9, wantOldest: 9},
+		{desc: "both, revisions win", policy: storage.RetentionPolicy{MaxRevisions: 1, MaxAge: time.Hour}, oldest: 0, latest: 10, sinceRev: 4, wantOldest: 10},
+	}
+
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+
+		mockStorage := storage.NewMockMapStorage(ctrl)
+		mockTx := storage.NewMockMapTX(ctrl)
+		mockStorage.EXPECT().Begin().Return(mockTx, nil)
+		mockStorage.EXPECT().MapID().AnyTimes().Return(trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+		mockTx.EXPECT().GetRetentionPolicy().Return(test.policy, nil)
+		mockTx.EXPECT().OldestRetainedRevision().Return(test.oldest, nil)
+		mockTx.EXPECT().LatestSignedMapRoot().Return(trillian.SignedMapRoot{MapRevision: test.latest}, nil)
+		if test.policy.MaxAge > 0 {
+			mockTx.EXPECT().EarliestRevisionSince(fakeTime.Add(-test.policy.MaxAge).UnixNano()).Return(test.sinceRev, nil)
+		}
+		if test.wantOldest != test.oldest {
+			mockTx.EXPECT().PruneRevisionsBefore(test.wantOldest).Return(nil)
+		}
+		mockTx.EXPECT().Commit().Return(nil)
+
+		gc := NewRevisionGarbageCollector(util.FakeTimeSource{FakeTime: fakeTime})
+		oldest, err := gc.PruneMap(mockStorage)
+		if err != nil {
+			t.Errorf("%s: PruneMap failed: %v", test.desc, err)
+		}
+		if got, want := oldest, test.wantOldest; got != want {
+			t.Errorf("%s: got oldest revision %d, want %d", test.desc, got, want)
+		}
+
+		ctrl.Finish()
+	}
+}
+
+func TestDeleteSupersededLeaves(t *testing.T) {
+	var tests = []struct {
+		desc        string
+		restored    map[int64]int64
+		oldest      int64
+		wantDeleted int64
+	}{
+		{desc: "nothing pruned", oldest: 0},
+		{desc: "pruned", oldest: 5, wantDeleted: 12},
+		{desc: "restored", restored: map[int64]int64{2: 1000}, oldest: 5},
+	}
+
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+
+		mockStorage := storage.NewMockMapStorage(ctrl)
+		mockTx := storage.NewMockMapTX(ctrl)
+		mockStorage.EXPECT().Begin().Return(mockTx, nil)
+		mockStorage.EXPECT().MapID().AnyTimes().Return(trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+		mockTx.EXPECT().GetRestoredRevisions().Return(test.restored, nil)
+		if len(test.restored) == 0 {
+			mockTx.EXPECT().OldestRetainedRevision().Return(test.oldest, nil)
+		}
+		if test.wantDeleted > 0 {
+			mockTx.EXPECT().DeleteMapLeavesBelowRevision(test.oldest).Return(test.wantDeleted, nil)
+		}
+		mockTx.EXPECT().Commit().Return(nil)
+
+		gc := NewRevisionGarbageCollector(util.FakeTimeSource{FakeTime: fakeTime})
+		deleted, err := gc.DeleteSupersededLeaves(mockStorage)
+		if err != nil {
+			t.Errorf("%s: DeleteSupersededLeaves failed: %v", test.desc, err)
+		}
+		if got, want := deleted, test.wantDeleted; got != want {
+			t.Errorf("%s: deleted %d leaves, want %d", test.desc, got, want)
+		}
+
+		ctrl.Finish()
+	}
+}
@@ -0,0 +1,129 @@
+package vmap
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage"
+)
+
+// StagedRecovery is what RecoverStagedRevision did with a map's staged revision.
+type StagedRecovery int
+
+const (
+	// NothingStaged means the map had no staged revision.
+	NothingStaged StagedRecovery = iota
+	// StagedReplayed means the staged revision was rewritten from its journal,
+	// which reproduced the staged root, and it's still staged to be published.
+	StagedReplayed
+	// StagedRolledBack means the journal of the staged revision didn't match its
+	// root, so the revision was abandoned.
+	StagedRolledBack
+)
+
+func (r StagedRecovery) String() string {
+	switch r {
+	case NothingStaged:
+		return "nothing staged"
+	case StagedReplayed:
+		return "replayed"
+	case StagedRolledBack:
+		return "rolled back"
+	}
+	return "unknown"
+}
+
+// RecoverStagedRevision makes sure that the revision staged for the map held in
+// s, if there is one, is complete after a writer failed or the server restarted.
+// The leaves written at the staged revision are its journal, recording the key
+// hash and leaf hash of everything it sets. The revision's nodes are discarded
+// and rewritten from the journal, which is deterministic, and if that gives the
+// staged root the revision is staged again to be published as normal. If it
+// doesn't the journal itself is incomplete, and the revision is rolled back.
+// This must only be done when nothing else is writing to the map, such as by
+// the server elected master of the map when it opens it. Mastership is a lease
+// that's only renewed while the master is running, so a crashed master's
+// revision is recovered by the server that takes over.
+func RecoverStagedRevision(s storage.MapStorage) (StagedRecovery, error) {
+	hasher, err := newMapHasher(s)
+	if err != nil {
+		return NothingStaged, err
+	}
+
+	tx, err := s.Begin()
+	if err != nil {
+		return NothingStaged, err
+	}
+	staged, ok, err := tx.StagedSignedMapRoot()
+	if err != nil || !ok {
+		tx.Rollback()
+		return NothingStaged, err
+	}
+
+	journal, err := tx.GetChangedLeaves(staged.MapRevision)
+	if err != nil {
+		tx.Rollback()
+		return NothingStaged, err
+	}
+	root, err := replayJournal(tx, hasher, journal)
+	if err != nil {
+		tx.Rollback()
+		return NothingStaged, err
+	}
+	if bytes.Equal(root, staged.RootHash) {
+		if err := tx.StageSignedMapRoot(staged); err != nil {
+			tx.Rollback()
+			return NothingStaged, err
+		}
+		if err := tx.Commit(); err != nil {
+			return NothingStaged, err
+		}
+		return StagedReplayed, nil
+	}
+	tx.Rollback()
+
+	glog.Warningf("%d: journal of staged revision %d gives root %x, not %x, rolling it back", s.MapID().TreeID, staged.MapRevision, root, staged.RootHash)
+	tx, err = s.Begin()
+	if err != nil {
+		return NothingStaged, err
+	}
+	if err := tx.AbandonStagedMapRoot(); err != nil {
+		tx.Rollback()
+		return NothingStaged, err
+	}
+	if err := tx.Commit(); err != nil {
+		return NothingStaged, err
+	}
+	return StagedRolledBack, nil
+}
+
+// replayJournal abandons the revision staged in tx and writes the leaves in
+// journal, and the nodes calculated from them, at the same revision. It returns
+// the new root hash, the revision is left unstaged.
+func replayJournal(tx storage.MapTX, hasher merkle.MapHasher, journal []trillian.MapLeaf) ([]byte, error) {
+	if err := tx.AbandonStagedMapRoot(); err != nil {
+		return nil, err
+	}
+	if err := tx.SetLeaves(journal); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	smtWriter, err := merkle.NewSparseMerkleTreeWriter(tx.WriteRevision(), hasher, func() (storage.TreeTX, error) {
+		return sharedTreeTX{TreeTX: tx, mu: &mu}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	leaves := make([]merkle.HashKeyValue, 0, len(journal))
+	for _, leaf := range journal {
+		leaves = append(leaves, merkle.HashKeyValue{HashedKey: leaf.KeyHash, HashedValue: leaf.LeafHash})
+	}
+	if err := smtWriter.SetLeaves(leaves); err != nil {
+		return nil, err
+	}
+	return smtWriter.CalculateRoot()
+}
@@ -0,0 +1,99 @@
+package vmap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/memory"
+	"golang.org/x/net/context"
+)
+
+// stageLeaves creates a map in memory storage with testKeyValues staged at
+// revision 1, and returns its storage and the staged root.
+func stageLeaves(t *testing.T) (storage.MapStorage, *trillian.SignedMapRoot) {
+	ctx := context.Background()
+	s, err := memory.NewMapStorage(memory.NewDatabase(), trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+	if err != nil {
+		t.Fatalf("Failed to create map storage: %v", err)
+	}
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return s, nil })
+	if _, err := server.InitMap(ctx, &trillian.InitMapRequest{MapId: testMapID}); err != nil {
+		t.Fatalf("InitMap failed: %v", err)
+	}
+	resp, err := server.SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues, Stage: true})
+	if err != nil {
+		t.Fatalf("SetLeaves failed: %v", err)
+	}
+	return s, resp.MapRoot
+}
+
+func stagedRoot(t *testing.T, s storage.MapStorage) (trillian.SignedMapRoot, bool) {
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin() = %v", err)
+	}
+	defer tx.Rollback()
+	root, ok, err := tx.StagedSignedMapRoot()
+	if err != nil {
+		t.Fatalf("StagedSignedMapRoot() = %v", err)
+	}
+	return root, ok
+}
+
+func TestRecoverStagedRevisionNothingStaged(t *testing.T) {
+	s, err := memory.NewMapStorage(memory.NewDatabase(), trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+	if err != nil {
+		t.Fatalf("Failed to create map storage: %v", err)
+	}
+	if got, err := RecoverStagedRevision(s); err != nil || got != NothingStaged {
+		t.Errorf("RecoverStagedRevision() = %v, %v, want %v", got, err, NothingStaged)
+	}
+}
+
+func TestRecoverStagedRevisionReplays(t *testing.T) {
+	s, want := stageLeaves(t)
+
+	if got, err := RecoverStagedRevision(s); err != nil || got != StagedReplayed {
+		t.Fatalf("RecoverStagedRevision() = %v, %v, want %v", got, err, StagedReplayed)
+	}
+	root, ok := stagedRoot(t, s)
+	if !ok || root.MapRevision != want.MapRevision || !bytes.Equal(root.RootHash, want.RootHash) {
+		t.Fatalf("Staged root after recovery = %v, %v, want %v", root, ok, want)
+	}
+
+	// The replayed revision can be published and read as normal
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return s, nil })
+	if _, err := server.PublishMapRevision(context.Background(), &trillian.PublishMapRevisionRequest{MapId: testMapID, Revision: root.MapRevision}); err != nil {
+		t.Fatalf("PublishMapRevision failed: %v", err)
+	}
+	resp, err := server.GetLeaves(context.Background(), &trillian.GetMapLeavesRequest{MapId: testMapID, Key: [][]byte{testKeyValues[0].Key}, Revision: -1})
+	if err != nil || len(resp.KeyValue) != 1 || !bytes.Equal(resp.KeyValue[0].KeyValue.Value.LeafValue, testKeyValues[0].Value.LeafValue) {
+		t.Errorf("GetLeaves() after replay = %v, %v, want %v", resp, err, testKeyValues[0])
+	}
+}
+
+func TestRecoverStagedRevisionRollsBackBadJournal(t *testing.T) {
+	s, _ := stageLeaves(t)
+
+	// A leaf that the staged root doesn't include is written at its revision
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin() = %v", err)
+	}
+	keyHash := bytes.Repeat([]byte{1}, 32)
+	if err := tx.Set(keyHash, trillian.MapLeaf{KeyHash: keyHash, LeafHash: bytes.Repeat([]byte{2}, 32), LeafValue: []byte("stray")}); err != nil {
+		t.Fatalf("Set() = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	if got, err := RecoverStagedRevision(s); err != nil || got != StagedRolledBack {
+		t.Fatalf("RecoverStagedRevision() = %v, %v, want %v", got, err, StagedRolledBack)
+	}
+	if root, ok := stagedRoot(t, s); ok {
+		t.Errorf("Revision %d is still staged after being rolled back", root.MapRevision)
+	}
+}
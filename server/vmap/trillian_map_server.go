@@ -2,14 +2,22 @@ package vmap
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
 	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/monitoring/trace"
 	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 )
 
 var (
@@ -22,9 +30,19 @@ var (
 // TODO: There is no access control in the server yet and clients could easily modify
 // any tree.
 
+// listMapLeavesBatchSize is the most leaves that ListMapLeaves reads in one
+// snapshot and sends in one response.
+const listMapLeavesBatchSize = 1000
+
 // MapStorageProviderFunc decouples the server from storage implementations
 type MapStorageProviderFunc func(int64) (storage.MapStorage, error)
 
+// RootSignerFunc returns the signer of a map's roots.
+type RootSignerFunc func(mapID int64) (crypto.MapRootSigner, error)
+
+// TreeKeysFunc returns the keys of the tree treeID, ordered by activation time.
+type TreeKeysFunc func(treeID int64) ([]*trillian.TreeKey, error)
+
 // TrillianMapServer implements the RPC API defined in the proto
 type TrillianMapServer struct {
 	storageProvider MapStorageProviderFunc
@@ -32,11 +50,135 @@ type TrillianMapServer struct {
 	storageMapGuard sync.Mutex
 	// Map from tree ID to storage impl for that map
 	storageMap map[int64]storage.MapStorage
+	// Inclusion proofs served recently, may be nil if caching is disabled
+	proofCache *ProofCache
+	// Folds SetLeaves requests into shared revisions, nil if coalescing is disabled
+	coalescer *writeCoalescer
+	// Gives the timestamps of new roots
+	timeSource util.TimeSource
+	// How far a new root's timestamp may be behind the current root's
+	maxClockSkew time.Duration
+	// Gives the signer of each map's roots, nil if roots are left unsigned
+	rootSigners RootSignerFunc
+	// Gives the keys of each map, GetTreeKeys fails if it's not set
+	treeKeys TreeKeysFunc
+	// Max number of subtrees hashed at once when writing a revision, zero uses
+	// merkle.DefaultSparseMerkleTreeWorkers
+	hashWorkers int
 }
 
 // NewTrillianMapServer creates a new RPC server backed by a MapStorageProvider.
 func NewTrillianMapServer(p MapStorageProviderFunc) *TrillianMapServer {
-	return &TrillianMapServer{storageProvider: p, storageMap: make(map[int64]storage.MapStorage)}
+	return NewTrillianMapServerWithProofCache(p, nil)
+}
+
+// NewTrillianMapServerWithProofCache creates a new RPC server backed by a
+// MapStorageProvider, which caches the inclusion proofs it serves in c. If c is
+// nil no caching is done.
+func NewTrillianMapServerWithProofCache(p MapStorageProviderFunc, c *ProofCache) *TrillianMapServer {
+	return NewTrillianMapServerWithCoalescing(p, c, 0)
+}
+
+// NewTrillianMapServerWithCoalescing creates a new RPC server like
+// NewTrillianMapServerWithProofCache, which folds the SetLeaves requests for a
+// map that arrive within window of the first into a single revision. If window
+// is zero every request writes its own revision. Dry runs, staged writes and
+// streamed writes are never coalesced.
+func NewTrillianMapServerWithCoalescing(p MapStorageProviderFunc, c *ProofCache, window time.Duration) *TrillianMapServer {
+	return NewTrillianMapServerWithTimeSource(p, c, window, util.SystemTimeSource{})
+}
+
+// NewTrillianMapServerWithTimeSource creates a new RPC server like
+// NewTrillianMapServerWithCoalescing, which timestamps the roots it creates
+// with the time from timeSource.
+func NewTrillianMapServerWithTimeSource(p MapStorageProviderFunc, c *ProofCache, window time.Duration, timeSource util.TimeSource) *TrillianMapServer {
+	t := &TrillianMapServer{storageProvider: p, storageMap: make(map[int64]storage.MapStorage), proofCache: c, timeSource: timeSource}
+	if window > 0 {
+		t.coalescer = newWriteCoalescer(window, t.setAllLeaves)
+	}
+	return t
+}
+
+// SetMaxClockSkew allows new roots to have timestamps up to d earlier than the
+// current root's, rather than having to be later. Roots further behind are
+// refused with codes.FailedPrecondition.
+func (t *TrillianMapServer) SetMaxClockSkew(d time.Duration) {
+	t.maxClockSkew = d
+}
+
+// SetHashWorkers sets the maximum number of subtrees hashed at once while the
+// root of each revision written is calculated. Zero, the default, uses
+// merkle.DefaultSparseMerkleTreeWorkers.
+func (t *TrillianMapServer) SetHashWorkers(n int) {
+	t.hashWorkers = n
+}
+
+// SetRootSigners has the roots of each map signed by the signer f returns for
+// it. Until this is called roots are stored with an empty signature.
+func (t *TrillianMapServer) SetRootSigners(f RootSignerFunc) {
+	t.rootSigners = f
+}
+
+// SetTreeKeys sets the function that GetTreeKeys uses to read the keys of each
+// map.
+func (t *TrillianMapServer) SetTreeKeys(f TreeKeysFunc) {
+	t.treeKeys = f
+}
+
+// signRoot signs root with the signer of map mapID, if there are root signers,
+// and with the map's keys waiting to be activated if the signer is a
+// crypto.MapRootKeySigner.
+func (t *TrillianMapServer) signRoot(mapID int64, root *trillian.SignedMapRoot) error {
+	if t.rootSigners == nil {
+		return nil
+	}
+	signer, err := t.rootSigners(mapID)
+	if err != nil {
+		return fmt.Errorf("failed to get root signer for map %d: %v", mapID, err)
+	}
+	sig, err := signer.SignMapRoot(*root)
+	if err != nil {
+		return fmt.Errorf("failed to sign root for map %d: %v", mapID, err)
+	}
+	root.Signature = &sig
+	if keySigner, ok := signer.(crypto.MapRootKeySigner); ok {
+		if root.KeySignatures, err = keySigner.KeySignMapRoot(*root); err != nil {
+			return fmt.Errorf("failed to sign root for map %d with pending keys: %v", mapID, err)
+		}
+	}
+	return nil
+}
+
+// checkRootFollows checks that root can be stored after the latest root in tx,
+// returning codes.FailedPrecondition if it can't.
+func (t *TrillianMapServer) checkRootFollows(tx storage.MapTX, root trillian.SignedMapRoot) error {
+	current, err := tx.LatestSignedMapRoot()
+	if err != nil {
+		return err
+	}
+	if err := storage.CheckMapRootFollows(current, root, t.maxClockSkew); err != nil {
+		return grpc.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+	return nil
+}
+
+// mapperMetadataFor returns the mapper metadata of the root written for req. It
+// fails with FailedPrecondition if the log entries req records applying don't
+// follow on from those of the latest root in tx, so that a mapper which has
+// crashed or raced with another must reread the root and carry on from there.
+// Writes without metadata keep the latest root's, as they apply no log entries.
+func mapperMetadataFor(tx storage.MapTX, req *trillian.SetMapLeavesRequest) (*trillian.MapperMetadata, error) {
+	current, err := tx.LatestSignedMapRoot()
+	if err != nil {
+		return nil, err
+	}
+	if req.MapperData == nil {
+		return current.Metadata, nil
+	}
+	if err := storage.CheckMapperMetadataFollows(current.Metadata, req.MapperData); err != nil {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "map %d: %v", req.MapId, err)
+	}
+	return req.MapperData, nil
 }
 
 func (t *TrillianMapServer) getStorageForMap(mapID int64) (storage.MapStorage, error) {
@@ -50,16 +192,62 @@ func (t *TrillianMapServer) getStorageForMap(mapID int64) (storage.MapStorage, e
 	}
 
 	s, err := t.storageProvider(mapID)
+	if err != nil {
+		return nil, err
+	}
+	t.storageMap[mapID] = s
+	return s, nil
+}
+
+// EvictStorage drops the cached storage of mapID, so that it's fetched from
+// the storage provider again the next time it's used.
+func (t *TrillianMapServer) EvictStorage(mapID int64) {
+	t.storageMapGuard.Lock()
+	defer t.storageMapGuard.Unlock()
+
+	delete(t.storageMap, mapID)
+}
 
+// getHasherForMap returns a MapHasher using the hash strategy, algorithm and
+// domain separation prefixes configured for the map held in s.
+func (t *TrillianMapServer) getHasherForMap(s storage.ReadOnlyMapStorage) (merkle.MapHasher, error) {
+	return newMapHasher(s)
+}
+
+// newMapHasher returns the MapHasher for the map held in s.
+func newMapHasher(s storage.ReadOnlyMapStorage) (merkle.MapHasher, error) {
+	th, err := merkle.NewTreeHasherForStrategy(s.HashStrategy(), s.HashAlgorithm(), s.HashPrefixes())
 	if err != nil {
-		t.storageMap[mapID] = s
+		return merkle.MapHasher{}, fmt.Errorf("map %d: %v", s.MapID().TreeID, err)
+	}
+	return merkle.NewMapHasher(th), nil
+}
+
+// snapshotAtLeast returns a snapshot of the map held in s which, if s may read
+// from a lagging replica, has reached revision.
+func snapshotAtLeast(s storage.MapStorage, revision int64) (storage.ReadOnlyMapTX, error) {
+	if r, ok := s.(storage.MapRevisionSnapshotter); ok && revision > 0 {
+		return r.SnapshotAtLeast(revision)
+	}
+	return s.Snapshot()
+}
+
+// minRevision returns the earliest revision of the map that req can be served
+// from, which is the revision it reads or its min_revision.
+func minRevision(req *trillian.GetMapLeavesRequest) int64 {
+	if len(req.RevisionTag) == 0 && req.Revision >= 0 {
+		return req.Revision
 	}
-	return s, err
+	return req.MinRevision
 }
 
-func (t *TrillianMapServer) getHasherForMap(mapID int64) (merkle.MapHasher, error) {
-	// TODO(al): actually return tailored hashers.
-	return merkle.NewMapHasher(merkle.NewRFC6962TreeHasher(trillian.NewSHA256())), nil
+// checkMinRevision returns an error if the latest root of the map is older than
+// the min_revision of a request.
+func checkMinRevision(mapID int64, root trillian.SignedMapRoot, minRevision int64) error {
+	if root.MapRevision < minRevision {
+		return grpc.Errorf(codes.FailedPrecondition, "map %d is at revision %d, not %d", mapID, root.MapRevision, minRevision)
+	}
+	return nil
 }
 
 // GetLeaves implements the GetLeaves RPC method.
@@ -69,10 +257,11 @@ func (t *TrillianMapServer) GetLeaves(ctx context.Context, req *trillian.GetMapL
 		return nil, err
 	}
 
-	tx, err := s.Snapshot()
+	tx, err := snapshotAtLeast(s, minRevision(req))
 	if err != nil {
 		return nil, err
 	}
+	traceTX(ctx, tx, req.MapId)
 	defer func() {
 		e := tx.Commit()
 		if e != nil && err == nil {
@@ -80,24 +269,36 @@ func (t *TrillianMapServer) GetLeaves(ctx context.Context, req *trillian.GetMapL
 		}
 	}()
 
-	kh, err := t.getHasherForMap(req.MapId)
+	kh, err := t.getHasherForMap(s)
 	if err != nil {
 		return nil, err
 	}
 
-	var root *trillian.SignedMapRoot
-
-	if req.Revision < 0 {
+	revision := req.Revision
+	if len(req.RevisionTag) > 0 {
+		if revision, err = tx.GetRevisionForTag(req.RevisionTag); err != nil {
+			return nil, err
+		}
+	}
+	var root trillian.SignedMapRoot
+	if revision < 0 {
 		// need to know the newest published revision
-		r, err := tx.LatestSignedMapRoot()
-		if err != nil {
+		if root, err = tx.LatestSignedMapRoot(); err != nil {
 			return nil, err
 		}
-		root = &r
-		req.Revision = root.MapRevision
+		if err := checkMinRevision(req.MapId, root, req.MinRevision); err != nil {
+			return nil, err
+		}
+		revision = root.MapRevision
+	} else if root, err = tx.GetSignedMapRoot(revision); err == storage.ErrMapRootNotFound {
+		// Revisions which are staged or still being written can't be read
+		return nil, grpc.Errorf(codes.NotFound, "map %d has no published revision %d", req.MapId, revision)
+	} else if err != nil {
+		return nil, err
 	}
 
-	smtReader := merkle.NewSparseMerkleTreeReader(req.Revision, kh, tx)
+	trace.FromContext(ctx).SetTag("revision", revision)
+	smtReader := merkle.NewSparseMerkleTreeReader(revision, kh, tx)
 
 	resp = &trillian.GetMapLeavesResponse{
 		KeyValue: make([]*trillian.KeyValueInclusion, 0, len(req.Key)),
@@ -111,7 +312,7 @@ func (t *TrillianMapServer) GetLeaves(ctx context.Context, req *trillian.GetMapL
 		hashToKey[string(keyHash)] = key
 	}
 
-	leaves, err := tx.Get(req.Revision, keyHashes)
+	leaves, err := tx.Get(revision, keyHashes)
 	if err != nil {
 		return nil, err
 	}
@@ -125,7 +326,7 @@ func (t *TrillianMapServer) GetLeaves(ctx context.Context, req *trillian.GetMapL
 			glog.Warningf("Retrieved unrequested leaf with keyhash: %v, skipping", leaf.KeyHash)
 			continue
 		}
-		proof, err := smtReader.InclusionProof(req.Revision, key)
+		proof, err := t.inclusionProof(smtReader, req.MapId, root, key, leaf.KeyHash)
 		if err != nil {
 			return nil, err
 		}
@@ -146,8 +347,161 @@ func (t *TrillianMapServer) GetLeaves(ctx context.Context, req *trillian.GetMapL
 	return resp, nil
 }
 
+// GetMapLeavesWithProof implements the GetMapLeavesWithProof RPC method. It
+// returns a proof for every requested key, including those with no value, along
+// with the signed root of the revision read so that the proofs can be checked.
+func (t *TrillianMapServer) GetMapLeavesWithProof(ctx context.Context, req *trillian.GetMapLeavesRequest) (resp *trillian.GetMapLeavesWithProofResponse, err error) {
+	s, err := t.getStorageForMap(req.MapId)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := snapshotAtLeast(s, minRevision(req))
+	if err != nil {
+		return nil, err
+	}
+	traceTX(ctx, tx, req.MapId)
+	defer func() {
+		e := tx.Commit()
+		if e != nil && err == nil {
+			resp, err = nil, e
+		}
+	}()
+
+	kh, err := t.getHasherForMap(s)
+	if err != nil {
+		return nil, err
+	}
+
+	revision := req.Revision
+	if len(req.RevisionTag) > 0 {
+		if revision, err = tx.GetRevisionForTag(req.RevisionTag); err != nil {
+			return nil, err
+		}
+	}
+
+	var root trillian.SignedMapRoot
+	if revision < 0 {
+		if root, err = tx.LatestSignedMapRoot(); err == nil {
+			err = checkMinRevision(req.MapId, root, req.MinRevision)
+		}
+	} else {
+		root, err = tx.GetSignedMapRoot(revision)
+	}
+	if err != nil {
+		return nil, err
+	}
+	trace.FromContext(ctx).SetTag("revision", root.MapRevision)
+	// Every stored root has a hash, even the root of an empty map
+	if len(root.RootHash) == 0 {
+		return nil, storage.ErrTreeNeedsInit
+	}
+	revision = root.MapRevision
+
+	keyHashes := make([]trillian.Hash, 0, len(req.Key))
+	for _, key := range req.Key {
+		keyHashes = append(keyHashes, kh.HashKey(key))
+	}
+
+	leaves, err := tx.Get(revision, keyHashes)
+	if err != nil {
+		return nil, err
+	}
+	hashToLeaf := make(map[string]*trillian.MapLeaf)
+	for i := range leaves {
+		hashToLeaf[string(leaves[i].KeyHash)] = &leaves[i]
+	}
+
+	smtReader := merkle.NewSparseMerkleTreeReader(revision, kh, tx)
+
+	resp = &trillian.GetMapLeavesWithProofResponse{
+		LeafProof: make([]*trillian.MapLeafProof, 0, len(req.Key)),
+		MapRoot:   &root,
+	}
+	for i, key := range req.Key {
+		// Keys without a value get a proof of the empty leaf
+		proof, err := t.inclusionProof(smtReader, req.MapId, root, key, keyHashes[i])
+		if err != nil {
+			return nil, err
+		}
+		lp := &trillian.MapLeafProof{
+			Key:       key,
+			Leaf:      hashToLeaf[string(keyHashes[i])],
+			Inclusion: make([][]byte, 0, len(proof)),
+		}
+		for _, p := range proof {
+			lp.Inclusion = append(lp.Inclusion, []byte(p))
+		}
+		resp.LeafProof = append(resp.LeafProof, lp)
+	}
+
+	glog.Infof("Proved %d keys, %d with values, at revision %d of map %d", len(req.Key), len(leaves), revision, req.MapId)
+	return resp, nil
+}
+
 // SetLeaves implements the SetLeaves RPC method.
-func (t *TrillianMapServer) SetLeaves(ctx context.Context, req *trillian.SetMapLeavesRequest) (resp *trillian.SetMapLeavesResponse, err error) {
+func (t *TrillianMapServer) SetLeaves(ctx context.Context, req *trillian.SetMapLeavesRequest) (*trillian.SetMapLeavesResponse, error) {
+	if t.coalescer != nil && !req.DryRun && !req.Stage && req.Revision == 0 {
+		return t.coalescer.SetLeaves(ctx, req)
+	}
+	return t.setLeaves(ctx, req, func(add addLeavesFunc) error {
+		return add(req.KeyValue)
+	})
+}
+
+// setAllLeaves writes a new revision of a map holding the leaves in req. It's
+// used for coalesced writes, which aren't traced as they serve several requests.
+func (t *TrillianMapServer) setAllLeaves(req *trillian.SetMapLeavesRequest) (*trillian.SetMapLeavesResponse, error) {
+	return t.setLeaves(context.Background(), req, func(add addLeavesFunc) error {
+		return add(req.KeyValue)
+	})
+}
+
+// SetLeavesStream implements the SetLeavesStream RPC method.
+func (t *TrillianMapServer) SetLeavesStream(stream trillian.TrillianMap_SetLeavesStreamServer) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return errors.New("SetLeavesStream received no requests")
+	}
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.setLeaves(stream.Context(), first, func(add addLeavesFunc) error {
+		if err := add(first.KeyValue); err != nil {
+			return err
+		}
+		for {
+			req, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if req.MapId != 0 && req.MapId != first.MapId {
+				return fmt.Errorf("SetLeavesStream request for map %d in stream for map %d", req.MapId, first.MapId)
+			}
+			if err := add(req.KeyValue); err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(resp)
+}
+
+// addLeavesFunc adds a batch of leaves to the revision being written.
+type addLeavesFunc func([]*trillian.KeyValue) error
+
+// setLeaves writes a new revision of a map using the options in req. The leaves
+// are supplied by calling add from readLeaves as many times as needed. The
+// leaves, nodes and root are all written in one transaction, and nothing is
+// committed unless every batch is added successfully.
+func (t *TrillianMapServer) setLeaves(ctx context.Context, req *trillian.SetMapLeavesRequest, readLeaves func(add addLeavesFunc) error) (resp *trillian.SetMapLeavesResponse, err error) {
 	s, err := t.getStorageForMap(req.MapId)
 	if err != nil {
 		return nil, err
@@ -157,6 +511,7 @@ func (t *TrillianMapServer) SetLeaves(ctx context.Context, req *trillian.SetMapL
 	if err != nil {
 		return nil, err
 	}
+	traceTX(ctx, tx, req.MapId)
 	defer func() {
 		if err != nil {
 			// Something went wrong, we should rollback and not return any partial/wrong data
@@ -164,55 +519,128 @@ func (t *TrillianMapServer) SetLeaves(ctx context.Context, req *trillian.SetMapL
 			tx.Rollback()
 			return
 		}
+		if req.DryRun {
+			// Nothing from a dry run may be persisted
+			if e := tx.Rollback(); e != nil {
+				resp = nil
+				err = e
+			}
+			return
+		}
 		// try to commit the tx
 		e := tx.Commit()
 		if e != nil {
 			// don't return partial/uncommited/wrong data:
 			resp = nil
 			err = e
+			return
 		}
+		t.invalidateProofs(req.MapId)
 	}()
 
-	hasher, err := t.getHasherForMap(req.MapId)
+	if req.DryRun && req.Stage {
+		return nil, errors.New("SetLeaves request cannot be both a dry run and staged")
+	}
+
+	// No new revision can be written while one is staged as it would be at the same revision
+	if staged, ok, err := tx.StagedSignedMapRoot(); err != nil {
+		return nil, err
+	} else if ok {
+		return nil, fmt.Errorf("map %d has staged revision %d which must be published or abandoned first", req.MapId, staged.MapRevision)
+	}
+
+	if req.Revision != 0 && req.Revision != tx.WriteRevision() {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "map %d would be written at revision %d, not %d", req.MapId, tx.WriteRevision(), req.Revision)
+	}
+
+	metadata, err := mapperMetadataFor(tx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher, err := t.getHasherForMap(s)
 	if err != nil {
 		return nil, err
 	}
 
-	glog.Infof("Writing at revision %d", tx.WriteRevision())
+	trace.FromContext(ctx).SetTag("revision", tx.WriteRevision())
+	if req.DryRun {
+		glog.Infof("Dry run calculating root for revision %d", tx.WriteRevision())
+	} else {
+		glog.Infof("Writing at revision %d", tx.WriteRevision())
+	}
 
-	smtWriter, err := merkle.NewSparseMerkleTreeWriter(tx.WriteRevision(), hasher, func() (storage.TreeTX, error) {
-		return s.Begin()
+	// The subtrees are written concurrently, so they share the transaction
+	// through a sharedTreeTX and every other use of it until the root has been
+	// calculated must hold mu
+	var mu sync.Mutex
+	smtWriter, err := merkle.NewSparseMerkleTreeWriterWithWorkers(tx.WriteRevision(), hasher, t.hashWorkers, func() (storage.TreeTX, error) {
+		return sharedTreeTX{TreeTX: tx, mu: &mu}, nil
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	leaves := make([]merkle.HashKeyValue, 0, len(req.KeyValue))
-	for i := 0; i < len(req.KeyValue); i++ {
-		kv := req.KeyValue[i]
-		keyHash := hasher.HashKey(kv.Key)
-		valHash := hasher.HashLeaf(kv.Value.LeafValue)
-		leaves = append(leaves, merkle.HashKeyValue{keyHash, valHash})
-		if err = tx.Set(keyHash, *kv.Value); err != nil {
-			return nil, err
+	err = readLeaves(func(kvs []*trillian.KeyValue) error {
+		leaves := make([]merkle.HashKeyValue, 0, len(kvs))
+		mapLeaves := make([]trillian.MapLeaf, 0, len(kvs))
+		for _, kv := range kvs {
+			keyHash := hasher.HashKey(kv.Key)
+			// Only the leaf value is committed to by the tree, ExtraData is stored
+			// and returned with the leaf but is not covered by any hash.
+			valHash := hasher.HashLeaf(kv.Value.LeafValue)
+			leaves = append(leaves, merkle.HashKeyValue{keyHash, valHash})
+			leaf := *kv.Value
+			leaf.KeyHash = keyHash
+			leaf.LeafHash = valHash
+			mapLeaves = append(mapLeaves, leaf)
 		}
-	}
-	if err = smtWriter.SetLeaves(leaves); err != nil {
+		mu.Lock()
+		err := tx.SetLeaves(mapLeaves)
+		mu.Unlock()
+		if err != nil {
+			return err
+		}
+		return smtWriter.SetLeaves(leaves)
+	})
+	if err != nil {
 		return nil, err
 	}
 	rootHash, err := smtWriter.CalculateRoot()
+	if err != nil {
+		return nil, err
+	}
 
 	newRoot := trillian.SignedMapRoot{
-		TimestampNanos: time.Now().UnixNano(),
+		TimestampNanos: t.timeSource.Now().UnixNano(),
 		RootHash:       rootHash,
 		MapId:          s.MapID().MapID,
 		MapRevision:    tx.WriteRevision(),
-		Metadata:       req.MapperData,
-		// TODO(al): Actually sign stuff, etc!
-		Signature: &trillian.DigitallySigned{},
+		Metadata:       metadata,
+		Signature:      &trillian.DigitallySigned{},
+	}
+
+	if req.DryRun {
+		// The projected root is returned unsigned and is not stored.
+		newRoot.Signature = nil
+		return &trillian.SetMapLeavesResponse{MapRoot: &newRoot}, nil
+	}
+
+	if req.Stage {
+		// The root will be signed when the staged revision is published.
+		newRoot.Signature = nil
+		if err = tx.StageSignedMapRoot(newRoot); err != nil {
+			return nil, err
+		}
+		return &trillian.SetMapLeavesResponse{MapRoot: &newRoot}, nil
 	}
 
-	// TODO(al): need an smtWriter.Rollback() or similar I think.
+	if err = t.signRoot(req.MapId, &newRoot); err != nil {
+		return nil, err
+	}
+	if err = t.checkRootFollows(tx, newRoot); err != nil {
+		return nil, err
+	}
 	if err = tx.StoreSignedMapRoot(newRoot); err != nil {
 		return nil, err
 	}
@@ -229,10 +657,11 @@ func (t *TrillianMapServer) GetSignedMapRoot(ctx context.Context, req *trillian.
 		return nil, err
 	}
 
-	tx, err := s.Snapshot()
+	tx, err := snapshotAtLeast(s, req.MinRevision)
 	if err != nil {
 		return nil, err
 	}
+	traceTX(ctx, tx, req.MapId)
 	defer func() {
 		// try to commit the tx
 		e := tx.Commit()
@@ -245,6 +674,13 @@ func (t *TrillianMapServer) GetSignedMapRoot(ctx context.Context, req *trillian.
 	if err != nil {
 		return nil, err
 	}
+	if err := checkMinRevision(req.MapId, r, req.MinRevision); err != nil {
+		return nil, err
+	}
+	// Every stored root has a hash, even the root of an empty map
+	if len(r.RootHash) == 0 {
+		return nil, storage.ErrTreeNeedsInit
+	}
 
 	resp = &trillian.GetSignedMapRootResponse{
 		MapRoot: &r,
@@ -252,6 +688,623 @@ func (t *TrillianMapServer) GetSignedMapRoot(ctx context.Context, req *trillian.
 	return resp, err
 }
 
+// GetTreeKeys returns the public keys of a map, which clients need to check
+// its roots. Unlike the admin service's GetTree it's open to all clients.
+func (t *TrillianMapServer) GetTreeKeys(ctx context.Context, req *trillian.GetTreeKeysRequest) (*trillian.GetTreeKeysResponse, error) {
+	if t.treeKeys == nil {
+		return nil, errors.New("map server is not able to read tree keys")
+	}
+	// Only the keys of maps this server serves are returned
+	if _, err := t.getStorageForMap(req.TreeId); err != nil {
+		return nil, err
+	}
+	keys, err := t.treeKeys(req.TreeId)
+	if err != nil {
+		return nil, err
+	}
+	return &trillian.GetTreeKeysResponse{Keys: keys}, nil
+}
+
+// GetSignedMapRootByRevision implements the GetSignedMapRootByRevision RPC
+// method. It returns the root published for an earlier revision of the map so
+// that clients can verify data they were served at that revision.
+func (t *TrillianMapServer) GetSignedMapRootByRevision(ctx context.Context, req *trillian.GetSignedMapRootByRevisionRequest) (resp *trillian.GetSignedMapRootResponse, err error) {
+	if req.Revision < 0 {
+		return nil, fmt.Errorf("map %d: invalid revision %d", req.MapId, req.Revision)
+	}
+
+	s, err := t.getStorageForMap(req.MapId)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := snapshotAtLeast(s, req.Revision)
+	if err != nil {
+		return nil, err
+	}
+	traceTX(ctx, tx, req.MapId)
+	defer func() {
+		// try to commit the tx
+		e := tx.Commit()
+		if e != nil && err == nil {
+			resp, err = nil, e
+		}
+	}()
+
+	r, err := tx.GetSignedMapRoot(req.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	resp = &trillian.GetSignedMapRootResponse{
+		MapRoot: &r,
+	}
+	return resp, nil
+}
+
+// InitMap implements the InitMap RPC method. It stores the root of the empty
+// map at revision 0, so the first revision written is revision 1 as before.
+func (t *TrillianMapServer) InitMap(ctx context.Context, req *trillian.InitMapRequest) (resp *trillian.InitMapResponse, err error) {
+	s, err := t.getStorageForMap(req.MapId)
+	if err != nil {
+		return nil, err
+	}
+	hasher, err := t.getHasherForMap(s)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.Begin()
+	if err != nil {
+		return nil, err
+	}
+	traceTX(ctx, tx, req.MapId)
+	defer func() {
+		if err != nil {
+			resp = nil
+			tx.Rollback()
+			return
+		}
+		if e := t.commitAndLog(tx, "InitMap"); e != nil {
+			resp, err = nil, e
+		}
+	}()
+
+	current, err := tx.LatestSignedMapRoot()
+	if err != nil {
+		return nil, err
+	}
+	if len(current.RootHash) > 0 {
+		return nil, storage.ErrTreeAlreadyInitialized
+	}
+
+	newRoot := trillian.SignedMapRoot{
+		TimestampNanos: t.timeSource.Now().UnixNano(),
+		RootHash:       hasher.EmptyHashes()[hasher.Size()*8],
+		MapId:          s.MapID().MapID,
+		MapRevision:    0,
+		Signature:      &trillian.DigitallySigned{},
+	}
+	if err = t.signRoot(req.MapId, &newRoot); err != nil {
+		return nil, err
+	}
+	if err = tx.StoreSignedMapRoot(newRoot); err != nil {
+		return nil, err
+	}
+
+	glog.Infof("Initialized map %d", req.MapId)
+
+	resp = &trillian.InitMapResponse{
+		Status:  buildStatus(trillian.TrillianApiStatusCode_OK),
+		Created: &newRoot,
+	}
+	return resp, nil
+}
+
+// TagMapRevision implements the TagMapRevision RPC method.
+func (t *TrillianMapServer) TagMapRevision(ctx context.Context, req *trillian.TagMapRevisionRequest) (resp *trillian.TagMapRevisionResponse, err error) {
+	if len(req.Tag) == 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "no tag given")
+	}
+	s, err := t.getStorageForMap(req.MapId)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.Begin()
+	if err != nil {
+		return nil, err
+	}
+	traceTX(ctx, tx, req.MapId)
+	defer func() {
+		if err != nil {
+			resp = nil
+			tx.Rollback()
+			return
+		}
+		if e := t.commitAndLog(tx, "TagMapRevision"); e != nil {
+			resp, err = nil, e
+		}
+	}()
+
+	switch revision, err := tx.GetRevisionForTag(req.Tag); {
+	case err == storage.ErrTagNotFound:
+	case err != nil:
+		return nil, err
+	case revision == req.Revision:
+		return &trillian.TagMapRevisionResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK)}, nil
+	default:
+		return nil, grpc.Errorf(codes.AlreadyExists, "tag %q of map %d is already on revision %d", req.Tag, req.MapId, revision)
+	}
+	if _, err := tx.GetSignedMapRoot(req.Revision); err == storage.ErrMapRootNotFound {
+		return nil, grpc.Errorf(codes.NotFound, "map %d has no published revision %d", req.MapId, req.Revision)
+	} else if err != nil {
+		return nil, err
+	}
+	if err := tx.TagMapRevision(req.Tag, req.Revision, t.timeSource.Now().UnixNano()); err != nil {
+		return nil, err
+	}
+
+	glog.Infof("Tagged revision %d of map %d as %q", req.Revision, req.MapId, req.Tag)
+	return &trillian.TagMapRevisionResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK)}, nil
+}
+
+// GetMapRevisionTags implements the GetMapRevisionTags RPC method.
+func (t *TrillianMapServer) GetMapRevisionTags(ctx context.Context, req *trillian.GetMapRevisionTagsRequest) (resp *trillian.GetMapRevisionTagsResponse, err error) {
+	s, err := t.getStorageForMap(req.MapId)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	traceTX(ctx, tx, req.MapId)
+	defer func() {
+		e := tx.Commit()
+		if e != nil && err == nil {
+			resp, err = nil, e
+		}
+	}()
+
+	tags, err := tx.GetRevisionTags()
+	if err != nil {
+		return nil, err
+	}
+	resp = &trillian.GetMapRevisionTagsResponse{
+		Status: buildStatus(trillian.TrillianApiStatusCode_OK),
+		Tags:   make([]*trillian.MapRevisionTag, 0, len(tags)),
+	}
+	for tag, revision := range tags {
+		resp.Tags = append(resp.Tags, &trillian.MapRevisionTag{Tag: tag, Revision: revision})
+	}
+	sort.Slice(resp.Tags, func(i, j int) bool { return resp.Tags[i].Tag < resp.Tags[j].Tag })
+	return resp, nil
+}
+
+// RefreshRoot re-signs the latest root of map mapID with the current time if
+// it's at least maxAge old, keeping its revision and root hash, so that clients
+// can tell an idle map from one that has stopped being served. It returns
+// whether the root was refreshed. Maps without a root aren't refreshed.
+func (t *TrillianMapServer) RefreshRoot(mapID int64, maxAge time.Duration) (refreshed bool, err error) {
+	s, err := t.getStorageForMap(mapID)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := s.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		if e := t.commitAndLog(tx, "RefreshRoot"); e != nil {
+			refreshed, err = false, e
+		}
+	}()
+
+	current, err := tx.LatestSignedMapRoot()
+	if err != nil {
+		return false, err
+	}
+	now := t.timeSource.Now()
+	if len(current.RootHash) == 0 || now.Sub(time.Unix(0, current.TimestampNanos)) < maxAge {
+		return false, nil
+	}
+
+	newRoot := current
+	newRoot.TimestampNanos = now.UnixNano()
+	newRoot.Signature = &trillian.DigitallySigned{}
+	newRoot.KeySignatures = nil
+	if err = t.signRoot(mapID, &newRoot); err != nil {
+		return false, err
+	}
+	if err = storage.CheckMapRootRefresh(current, newRoot); err != nil {
+		return false, err
+	}
+	if err = tx.RefreshSignedMapRoot(newRoot); err != nil {
+		return false, err
+	}
+
+	glog.V(1).Infof("Refreshed root of map %d at revision %d", mapID, newRoot.MapRevision)
+	return true, nil
+}
+
+// sharedTreeTX is used by the subtree writers of a SetLeaves request to write
+// their nodes in the request's own transaction, so that the nodes are only
+// stored along with the new root. Calls are serialised by mu as the subtrees
+// are written concurrently, and the transaction is only committed or rolled
+// back by the request.
+type sharedTreeTX struct {
+	storage.TreeTX
+	mu *sync.Mutex
+}
+
+// GetMerkleNodes reads nodes through the shared transaction.
+func (s sharedTreeTX) GetMerkleNodes(treeRevision int64, ids []storage.NodeID) ([]storage.Node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.TreeTX.GetMerkleNodes(treeRevision, ids)
+}
+
+// SetMerkleNodes writes nodes through the shared transaction.
+func (s sharedTreeTX) SetMerkleNodes(nodes []storage.Node) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.TreeTX.SetMerkleNodes(nodes)
+}
+
+// Commit does nothing, the nodes are committed with the rest of the request.
+func (s sharedTreeTX) Commit() error {
+	return nil
+}
+
+// Rollback does nothing, the request rolls back the shared transaction if it fails.
+func (s sharedTreeTX) Rollback() error {
+	return nil
+}
+
+// PublishMapRevision implements the PublishMapRevision RPC method.
+func (t *TrillianMapServer) PublishMapRevision(ctx context.Context, req *trillian.PublishMapRevisionRequest) (resp *trillian.PublishMapRevisionResponse, err error) {
+	s, err := t.getStorageForMap(req.MapId)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.Begin()
+	if err != nil {
+		return nil, err
+	}
+	traceTX(ctx, tx, req.MapId)
+	defer func() {
+		if err != nil {
+			resp = nil
+			tx.Rollback()
+			return
+		}
+		if e := t.commitAndLog(tx, "PublishMapRevision"); e != nil {
+			resp, err = nil, e
+			return
+		}
+		t.invalidateProofs(req.MapId)
+	}()
+
+	staged, err := t.getStagedRoot(tx, req.MapId, req.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	newRoot := trillian.SignedMapRoot{
+		TimestampNanos: t.timeSource.Now().UnixNano(),
+		RootHash:       staged.RootHash,
+		MapId:          s.MapID().MapID,
+		MapRevision:    staged.MapRevision,
+		Metadata:       staged.Metadata,
+		Signature:      &trillian.DigitallySigned{},
+	}
+
+	if err = t.signRoot(req.MapId, &newRoot); err != nil {
+		return nil, err
+	}
+	if err = t.checkRootFollows(tx, newRoot); err != nil {
+		return nil, err
+	}
+	if err = tx.PublishStagedMapRoot(newRoot); err != nil {
+		return nil, err
+	}
+
+	glog.Infof("Published staged revision %d for map %d", newRoot.MapRevision, req.MapId)
+
+	resp = &trillian.PublishMapRevisionResponse{
+		MapRoot: &newRoot,
+	}
+	return resp, nil
+}
+
+// AbandonMapRevision implements the AbandonMapRevision RPC method.
+func (t *TrillianMapServer) AbandonMapRevision(ctx context.Context, req *trillian.AbandonMapRevisionRequest) (resp *trillian.AbandonMapRevisionResponse, err error) {
+	s, err := t.getStorageForMap(req.MapId)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.Begin()
+	if err != nil {
+		return nil, err
+	}
+	traceTX(ctx, tx, req.MapId)
+	defer func() {
+		if err != nil {
+			resp = nil
+			tx.Rollback()
+			return
+		}
+		if e := t.commitAndLog(tx, "AbandonMapRevision"); e != nil {
+			resp, err = nil, e
+			return
+		}
+		t.invalidateProofs(req.MapId)
+	}()
+
+	if _, err = t.getStagedRoot(tx, req.MapId, req.Revision); err != nil {
+		return nil, err
+	}
+
+	if err = tx.AbandonStagedMapRoot(); err != nil {
+		return nil, err
+	}
+
+	glog.Infof("Abandoned staged revision %d for map %d", req.Revision, req.MapId)
+
+	return &trillian.AbandonMapRevisionResponse{}, nil
+}
+
+// GetMapUpdateProof implements the GetMapUpdateProof RPC method.
+func (t *TrillianMapServer) GetMapUpdateProof(ctx context.Context, req *trillian.GetMapUpdateProofRequest) (resp *trillian.GetMapUpdateProofResponse, err error) {
+	s, err := t.getStorageForMap(req.MapId)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	traceTX(ctx, tx, req.MapId)
+	defer func() {
+		e := tx.Commit()
+		if e != nil && err == nil {
+			resp, err = nil, e
+		}
+	}()
+
+	hasher, err := t.getHasherForMap(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only published revisions can be proved
+	root, err := tx.LatestSignedMapRoot()
+	if err != nil {
+		return nil, err
+	}
+	if req.Revision <= 0 || req.Revision > root.MapRevision {
+		return nil, fmt.Errorf("map %d: revision %d is not in the published range 1 to %d", req.MapId, req.Revision, root.MapRevision)
+	}
+	oldRevision := req.Revision - 1
+	trace.FromContext(ctx).SetTag("revision", req.Revision)
+
+	smtReader := merkle.NewSparseMerkleTreeReader(req.Revision, hasher, tx)
+	newRoot, err := smtReader.RootAtRevision(req.Revision)
+	if err != nil {
+		return nil, err
+	}
+	oldRoot, err := smtReader.RootAtRevision(oldRevision)
+	if err == merkle.ErrNoSuchRevision {
+		// Nothing had been written to the map
+		oldRoot = hasher.EmptyHashes()[hasher.Size()*8]
+	} else if err != nil {
+		return nil, err
+	}
+
+	changed, err := tx.GetChangedLeaves(req.Revision)
+	if err != nil {
+		return nil, err
+	}
+	keyHashes := make([]trillian.Hash, 0, len(changed))
+	for _, leaf := range changed {
+		keyHashes = append(keyHashes, leaf.KeyHash)
+	}
+	old, err := tx.Get(oldRevision, keyHashes)
+	if err != nil {
+		return nil, err
+	}
+	oldLeafHashes := make(map[string]trillian.Hash)
+	for _, leaf := range old {
+		oldLeafHashes[string(leaf.KeyHash)] = hasher.HashLeaf(leaf.LeafValue)
+	}
+
+	resp = &trillian.GetMapUpdateProofResponse{
+		OldRootHash: oldRoot,
+		NewRootHash: newRoot,
+		Update:      make([]*trillian.MapLeafUpdate, 0, len(changed)),
+	}
+	for _, leaf := range changed {
+		leaf := leaf
+		oldLeafHash, ok := oldLeafHashes[string(leaf.KeyHash)]
+		if !ok {
+			oldLeafHash = hasher.HashEmptyLeaf()
+		}
+		proof, err := smtReader.InclusionProofForKeyHash(oldRevision, leaf.KeyHash)
+		if err != nil {
+			return nil, err
+		}
+		u := &trillian.MapLeafUpdate{
+			KeyHash:     leaf.KeyHash,
+			OldLeafHash: oldLeafHash,
+			Inclusion:   make([][]byte, 0, len(proof)),
+			NewLeaf:     &leaf,
+		}
+		for _, p := range proof {
+			u.Inclusion = append(u.Inclusion, []byte(p))
+		}
+		resp.Update = append(resp.Update, u)
+	}
+
+	glog.Infof("Proved %d leaves updated by revision %d of map %d", len(changed), req.Revision, req.MapId)
+
+	return resp, nil
+}
+
+// ListMapLeaves implements the ListMapLeaves RPC method. It streams the leaves
+// of a published revision in key hash order, with the revision's signed root in
+// the first response. Leaves are read in batches, each in its own snapshot, so a
+// long listing doesn't hold one open.
+func (t *TrillianMapServer) ListMapLeaves(req *trillian.ListMapLeavesRequest, stream trillian.TrillianMap_ListMapLeavesServer) error {
+	ctx := stream.Context()
+	s, err := t.getStorageForMap(req.MapId)
+	if err != nil {
+		return err
+	}
+
+	root, err := t.listedMapRoot(ctx, s, req.MapId, req.Revision)
+	if err != nil {
+		return err
+	}
+	trace.FromContext(ctx).SetTag("revision", root.MapRevision)
+
+	after := trillian.Hash(req.AfterKeyHash)
+	for first := true; ; first = false {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		leaves, err := t.listMapLeaves(ctx, s, req.MapId, root.MapRevision, after)
+		if err != nil {
+			return err
+		}
+
+		resp := &trillian.ListMapLeavesResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK)}
+		if first {
+			resp.MapRoot = &root
+		}
+		for i := range leaves {
+			// Keys set to an empty value have been deleted
+			if len(leaves[i].LeafValue) > 0 {
+				resp.Leaves = append(resp.Leaves, &leaves[i])
+			}
+		}
+		// The root is always sent, even if there are no leaves
+		if first || len(resp.Leaves) > 0 {
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+		}
+
+		if len(leaves) < listMapLeavesBatchSize {
+			return nil
+		}
+		after = leaves[len(leaves)-1].KeyHash
+	}
+}
+
+// listedMapRoot returns the published root of the revision that ListMapLeaves
+// lists, which is the latest if revision is negative.
+func (t *TrillianMapServer) listedMapRoot(ctx context.Context, s storage.MapStorage, mapID, revision int64) (root trillian.SignedMapRoot, err error) {
+	tx, err := s.Snapshot()
+	if err != nil {
+		return trillian.SignedMapRoot{}, err
+	}
+	traceTX(ctx, tx, mapID)
+	defer func() {
+		e := tx.Commit()
+		if e != nil && err == nil {
+			root, err = trillian.SignedMapRoot{}, e
+		}
+	}()
+
+	if revision < 0 {
+		return tx.LatestSignedMapRoot()
+	}
+	return tx.GetSignedMapRoot(revision)
+}
+
+// listMapLeaves reads one batch of leaves for ListMapLeaves.
+func (t *TrillianMapServer) listMapLeaves(ctx context.Context, s storage.MapStorage, mapID, revision int64, after trillian.Hash) (leaves []trillian.MapLeaf, err error) {
+	tx, err := s.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	traceTX(ctx, tx, mapID)
+	defer func() {
+		e := tx.Commit()
+		if e != nil && err == nil {
+			leaves, err = nil, e
+		}
+	}()
+
+	return tx.ListLeaves(revision, after, listMapLeavesBatchSize)
+}
+
+// inclusionProof returns the inclusion proof for key at the revision of root,
+// using the proof cache if one has been set up. root must be a published root
+// read from storage, as later revisions can still be written or abandoned by
+// other servers and so their proofs can't be cached.
+func (t *TrillianMapServer) inclusionProof(smtReader *merkle.SparseMerkleTreeReader, mapID int64, root trillian.SignedMapRoot, key trillian.Key, keyHash trillian.Hash) ([]trillian.Hash, error) {
+	revision := root.MapRevision
+	if t.proofCache != nil {
+		if proof, ok := t.proofCache.Get(mapID, revision, keyHash); ok {
+			return proof, nil
+		}
+	}
+
+	proof, err := smtReader.InclusionProof(revision, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.proofCache != nil {
+		t.proofCache.Put(mapID, revision, keyHash, proof)
+	}
+	return proof, nil
+}
+
+// invalidateProofs drops any cached proofs for a map after a new revision of it
+// has been written.
+func (t *TrillianMapServer) invalidateProofs(mapID int64) {
+	if t.proofCache != nil {
+		t.proofCache.InvalidateTree(mapID)
+	}
+}
+
+// getStagedRoot returns the staged root for a map, checking that it is for the
+// expected revision.
+func (t *TrillianMapServer) getStagedRoot(tx storage.MapTX, mapID, revision int64) (trillian.SignedMapRoot, error) {
+	staged, ok, err := tx.StagedSignedMapRoot()
+	if err != nil {
+		return trillian.SignedMapRoot{}, err
+	}
+	if !ok {
+		return trillian.SignedMapRoot{}, storage.ErrNoStagedRevision
+	}
+	if staged.MapRevision != revision {
+		return trillian.SignedMapRoot{}, fmt.Errorf("map %d has staged revision %d, not %d", mapID, staged.MapRevision, revision)
+	}
+	return staged, nil
+}
+
+// traceTX tags the request's span with the map it's for, and adds the
+// operations of tx to it.
+func traceTX(ctx context.Context, tx interface{}, mapID int64) {
+	span := trace.FromContext(ctx)
+	span.SetTag("map_id", mapID)
+	trace.SetSpan(tx, span)
+}
+
 func buildStatus(code trillian.TrillianApiStatusCode) *trillian.TrillianApiStatus {
 	return &trillian.TrillianApiStatus{StatusCode: code}
 }
@@ -0,0 +1,1271 @@
+package vmap
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/memory"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const testMapID int64 = 7
+
+var testKeyValues = []*trillian.KeyValue{
+	{Key: []byte("key1"), Value: &trillian.MapLeaf{LeafValue: []byte("value1")}},
+	{Key: []byte("key2"), Value: &trillian.MapLeaf{LeafValue: []byte("value2")}},
+}
+
+// setupEmptyMap returns a storage provider for a map where no nodes have been
+// stored. All transactions share the returned mock TX.
+func setupEmptyMap(ctrl *gomock.Controller) (*storage.MockMapTX, MapStorageProviderFunc) {
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockTx := storage.NewMockMapTX(ctrl)
+
+	mockStorage.EXPECT().Begin().AnyTimes().Return(mockTx, nil)
+	mockStorage.EXPECT().MapID().AnyTimes().Return(trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+	mockStorage.EXPECT().HashPrefixes().AnyTimes().Return(storage.TreeHashPrefixes{})
+	mockStorage.EXPECT().HashStrategy().AnyTimes().Return(trillian.HashStrategy_RFC6962)
+	mockStorage.EXPECT().HashAlgorithm().AnyTimes().Return(trillian.HashAlgorithm_SHA256)
+	mockTx.EXPECT().WriteRevision().AnyTimes().Return(int64(1))
+	mockTx.EXPECT().StagedSignedMapRoot().AnyTimes().Return(trillian.SignedMapRoot{}, false, nil)
+	mockTx.EXPECT().LatestSignedMapRoot().AnyTimes().Return(trillian.SignedMapRoot{}, nil)
+	mockTx.EXPECT().GetMerkleNodes(int64(1), gomock.Any()).AnyTimes().Return([]storage.Node{}, nil)
+	// Each batch of leaves is set in one call
+	mockTx.EXPECT().SetLeaves(gomock.Any()).MinTimes(1).MaxTimes(len(testKeyValues)).Return(nil)
+
+	return mockTx, func(int64) (storage.MapStorage, error) { return mockStorage, nil }
+}
+
+func TestGetStorageForMapRetriesFailure(t *testing.T) {
+	s, err := memory.NewMapStorage(memory.NewDatabase(), trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+	if err != nil {
+		t.Fatalf("Failed to create map storage: %v", err)
+	}
+	opened := 0
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) {
+		opened++
+		if opened == 1 {
+			return nil, errors.New("unavailable")
+		}
+		return s, nil
+	})
+
+	if _, err := server.getStorageForMap(testMapID); err == nil {
+		t.Fatalf("getStorageForMap() succeeded when the storage couldn't be opened")
+	}
+	for i := 0; i < 2; i++ {
+		if got, err := server.getStorageForMap(testMapID); err != nil || got != s {
+			t.Fatalf("getStorageForMap()=%v, %v, want the storage", got, err)
+		}
+	}
+	if opened != 2 {
+		t.Errorf("Storage opened %d times, want 2", opened)
+	}
+}
+
+func TestSetLeavesDryRunStoresNothing(t *testing.T) {
+	ctx := context.Background()
+
+	// First do a real write to find out what the root should be
+	ctrl := gomock.NewController(t)
+	mockTx, provider := setupEmptyMap(ctrl)
+	mockTx.EXPECT().SetMerkleNodes(gomock.Any()).AnyTimes().Return(nil)
+	mockTx.EXPECT().Commit().AnyTimes().Return(nil)
+	mockTx.EXPECT().StoreSignedMapRoot(gomock.Any()).Return(nil)
+
+	resp, err := NewTrillianMapServer(provider).SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues})
+	if err != nil {
+		t.Fatalf("SetLeaves failed: %v", err)
+	}
+	wantRoot := resp.MapRoot.RootHash
+	ctrl.Finish()
+
+	// A dry run must roll everything back and not store a signed root
+	ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+	mockTx, provider = setupEmptyMap(ctrl)
+	mockTx.EXPECT().SetMerkleNodes(gomock.Any()).AnyTimes().Return(nil)
+	mockTx.EXPECT().Rollback().MinTimes(1).Return(nil)
+
+	resp, err = NewTrillianMapServer(provider).SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues, DryRun: true})
+	if err != nil {
+		t.Fatalf("SetLeaves dry run failed: %v", err)
+	}
+	if got := resp.MapRoot.RootHash; !bytes.Equal(got, wantRoot) {
+		t.Fatalf("Dry run root hash mismatch, got %x, want %x", got, wantRoot)
+	}
+	if resp.MapRoot.Signature != nil {
+		t.Fatalf("Dry run root should not be signed: %v", resp.MapRoot.Signature)
+	}
+}
+
+func TestSetLeavesUsesTimeSource(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTx, provider := setupEmptyMap(ctrl)
+	mockTx.EXPECT().SetMerkleNodes(gomock.Any()).AnyTimes().Return(nil)
+	mockTx.EXPECT().Commit().AnyTimes().Return(nil)
+	mockTx.EXPECT().StoreSignedMapRoot(gomock.Any()).Return(nil)
+
+	now := time.Unix(1234, 5678)
+	server := NewTrillianMapServerWithTimeSource(provider, nil, 0, util.FakeTimeSource{FakeTime: now})
+	resp, err := server.SetLeaves(context.Background(), &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues})
+	if err != nil {
+		t.Fatalf("SetLeaves failed: %v", err)
+	}
+	if got, want := resp.MapRoot.TimestampNanos, now.UnixNano(); got != want {
+		t.Errorf("Root has timestamp %d, want %d", got, want)
+	}
+}
+
+func TestSetLeavesSignsRoot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTx, provider := setupEmptyMap(ctrl)
+	mockTx.EXPECT().SetMerkleNodes(gomock.Any()).AnyTimes().Return(nil)
+	mockTx.EXPECT().Commit().AnyTimes().Return(nil)
+	var stored trillian.SignedMapRoot
+	mockTx.EXPECT().StoreSignedMapRoot(gomock.Any()).Do(func(root trillian.SignedMapRoot) { stored = root }).Return(nil)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	hasher := trillian.NewSHA256()
+	server := NewTrillianMapServer(provider)
+	server.SetRootSigners(func(mapID int64) (crypto.MapRootSigner, error) {
+		if mapID != testMapID {
+			t.Errorf("Root signer requested for map %d, want %d", mapID, testMapID)
+		}
+		return crypto.NewTrillianSigner(hasher, trillian.SignatureAlgorithm_ECDSA, key), nil
+	})
+
+	resp, err := server.SetLeaves(context.Background(), &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues})
+	if err != nil {
+		t.Fatalf("SetLeaves failed: %v", err)
+	}
+	if err := crypto.VerifyMapRoot(key.Public(), hasher, *resp.MapRoot, *resp.MapRoot.Signature); err != nil {
+		t.Errorf("VerifyMapRoot failed: %v", err)
+	}
+	if !bytes.Equal(stored.Signature.Signature, resp.MapRoot.Signature.Signature) {
+		t.Errorf("Stored root has signature %x, want %x", stored.Signature.Signature, resp.MapRoot.Signature.Signature)
+	}
+}
+
+func TestSetLeavesStageDoesNotPublish(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTx, provider := setupEmptyMap(ctrl)
+	mockTx.EXPECT().SetMerkleNodes(gomock.Any()).AnyTimes().Return(nil)
+	mockTx.EXPECT().Commit().AnyTimes().Return(nil)
+	mockTx.EXPECT().StageSignedMapRoot(gomock.Any()).Return(nil)
+
+	resp, err := NewTrillianMapServer(provider).SetLeaves(context.Background(), &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues, Stage: true})
+	if err != nil {
+		t.Fatalf("SetLeaves stage failed: %v", err)
+	}
+	if got, want := resp.MapRoot.MapRevision, int64(1); got != want {
+		t.Fatalf("Staged root has revision %d, want %d", got, want)
+	}
+}
+
+func TestSetLeavesFailsWhileRevisionStaged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().StagedSignedMapRoot().Return(trillian.SignedMapRoot{MapRevision: 1}, true, nil)
+	mockTx.EXPECT().Rollback().Return(nil)
+
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return mockStorage, nil })
+	if _, err := server.SetLeaves(context.Background(), &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues}); err == nil {
+		t.Fatalf("Expected SetLeaves to fail with a staged revision")
+	}
+}
+
+func TestSetLeavesRevisionPrecondition(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().StagedSignedMapRoot().Return(trillian.SignedMapRoot{}, false, nil)
+	mockTx.EXPECT().WriteRevision().AnyTimes().Return(int64(3))
+	mockTx.EXPECT().Rollback().Return(nil)
+
+	// Another writer has already written revision 2
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return mockStorage, nil })
+	_, err := server.SetLeaves(context.Background(), &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues, Revision: 2})
+	if got, want := grpc.Code(err), codes.FailedPrecondition; got != want {
+		t.Fatalf("SetLeaves at the wrong revision returned %v, want code %v", err, want)
+	}
+}
+
+func TestSetLeavesFailureWritesNoNodes(t *testing.T) {
+	ctx := context.Background()
+	s, err := memory.NewMapStorage(memory.NewDatabase(), trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+	if err != nil {
+		t.Fatalf("Failed to create map storage: %v", err)
+	}
+	provider := func(int64) (storage.MapStorage, error) { return s, nil }
+	atTime := func(secs int64) *TrillianMapServer {
+		return NewTrillianMapServerWithTimeSource(provider, nil, 0, util.FakeTimeSource{FakeTime: time.Unix(secs, 0)})
+	}
+	if _, err := atTime(1000).InitMap(ctx, &trillian.InitMapRequest{MapId: testMapID}); err != nil {
+		t.Fatalf("InitMap failed: %v", err)
+	}
+	resp, err := atTime(3000).SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues, Revision: 1})
+	if err != nil {
+		t.Fatalf("SetLeaves failed: %v", err)
+	}
+
+	// The second root would be older than the first, so it can't be stored
+	// after the nodes for it have been calculated
+	update := []*trillian.KeyValue{{Key: []byte("key1"), Value: &trillian.MapLeaf{LeafValue: []byte("value3")}}}
+	if _, err := atTime(2000).SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: update}); err == nil {
+		t.Fatal("SetLeaves with a root older than the current one succeeded")
+	}
+
+	tx, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() = %v", err)
+	}
+	defer tx.Commit()
+	nodes, err := tx.GetMerkleNodes(2, []storage.NodeID{storage.NewEmptyNodeID(256)})
+	if err != nil || len(nodes) != 1 {
+		t.Fatalf("GetMerkleNodes() = %v, %v, want the root node", nodes, err)
+	}
+	if got, want := nodes[0].Hash, resp.MapRoot.RootHash; !bytes.Equal(got, want) {
+		t.Errorf("Root node at revision 2 has hash %x, want %x from revision 1 as nothing from the failed write should be stored", got, want)
+	}
+}
+
+func TestSetLeavesMapperMetadataFollows(t *testing.T) {
+	ctx := context.Background()
+	s, err := memory.NewMapStorage(memory.NewDatabase(), trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+	if err != nil {
+		t.Fatalf("Failed to create map storage: %v", err)
+	}
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return s, nil })
+	if _, err := server.InitMap(ctx, &trillian.InitMapRequest{MapId: testMapID}); err != nil {
+		t.Fatalf("InitMap failed: %v", err)
+	}
+	mapped := &trillian.MapperMetadata{SourceLogId: []byte("log"), HighestFullyCompletedSeq: 4}
+	if _, err := server.SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues, MapperData: mapped}); err != nil {
+		t.Fatalf("SetLeaves failed: %v", err)
+	}
+
+	// A write that isn't from the log keeps the position reached in it
+	update := []*trillian.KeyValue{{Key: []byte("key1"), Value: &trillian.MapLeaf{LeafValue: []byte("value3")}}}
+	resp, err := server.SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: update})
+	if err != nil {
+		t.Fatalf("SetLeaves failed: %v", err)
+	}
+	if got := resp.MapRoot.Metadata; !reflect.DeepEqual(got, mapped) {
+		t.Errorf("Root written without metadata has metadata %v, want %v", got, mapped)
+	}
+
+	// Applying log entries 3 and 4 again is refused, as is skipping 5
+	for _, start := range []int64{3, 6} {
+		meta := &trillian.MapperMetadata{SourceLogId: []byte("log"), RevisionStartSeq: start, HighestFullyCompletedSeq: 9}
+		_, err := server.SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: update, MapperData: meta})
+		if got, want := grpc.Code(err), codes.FailedPrecondition; got != want {
+			t.Errorf("SetLeaves applying log entries from %d returned %v, want code %v", start, err, want)
+		}
+	}
+	meta := &trillian.MapperMetadata{SourceLogId: []byte("log"), RevisionStartSeq: 5, HighestFullyCompletedSeq: 9}
+	if _, err := server.SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: update, MapperData: meta}); err != nil {
+		t.Errorf("SetLeaves applying the next log entries failed: %v", err)
+	}
+}
+
+func setupStagedMap(ctrl *gomock.Controller, staged bool) (*storage.MockMapTX, *TrillianMapServer) {
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockStorage.EXPECT().MapID().AnyTimes().Return(trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+	mockTx.EXPECT().StagedSignedMapRoot().Return(trillian.SignedMapRoot{MapRevision: 3, RootHash: []byte("root")}, staged, nil)
+	mockTx.EXPECT().LatestSignedMapRoot().AnyTimes().Return(trillian.SignedMapRoot{MapRevision: 2}, nil)
+
+	return mockTx, NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return mockStorage, nil })
+}
+
+func TestPublishMapRevision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTx, server := setupStagedMap(ctrl, true)
+	mockTx.EXPECT().PublishStagedMapRoot(gomock.Any()).Return(nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	resp, err := server.PublishMapRevision(context.Background(), &trillian.PublishMapRevisionRequest{MapId: testMapID, Revision: 3})
+	if err != nil {
+		t.Fatalf("PublishMapRevision failed: %v", err)
+	}
+	if got, want := resp.MapRoot.RootHash, []byte("root"); !bytes.Equal(got, want) {
+		t.Fatalf("Published root hash %x, want %x", got, want)
+	}
+	if resp.MapRoot.Signature == nil {
+		t.Fatalf("Published root should have a signature")
+	}
+}
+
+func TestPublishMapRevisionWrongRevision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTx, server := setupStagedMap(ctrl, true)
+	mockTx.EXPECT().Rollback().Return(nil)
+
+	if _, err := server.PublishMapRevision(context.Background(), &trillian.PublishMapRevisionRequest{MapId: testMapID, Revision: 2}); err == nil {
+		t.Fatalf("Expected PublishMapRevision to fail for revision which is not staged")
+	}
+}
+
+func TestAbandonMapRevision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTx, server := setupStagedMap(ctrl, true)
+	mockTx.EXPECT().AbandonStagedMapRoot().Return(nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	if _, err := server.AbandonMapRevision(context.Background(), &trillian.AbandonMapRevisionRequest{MapId: testMapID, Revision: 3}); err != nil {
+		t.Fatalf("AbandonMapRevision failed: %v", err)
+	}
+}
+
+func TestAbandonMapRevisionNothingStaged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTx, server := setupStagedMap(ctrl, false)
+	mockTx.EXPECT().Rollback().Return(nil)
+
+	if _, err := server.AbandonMapRevision(context.Background(), &trillian.AbandonMapRevisionRequest{MapId: testMapID, Revision: 3}); err != storage.ErrNoStagedRevision {
+		t.Fatalf("Expected ErrNoStagedRevision but got: %v", err)
+	}
+}
+
+func TestGetLeavesByRevisionTag(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockStorage.EXPECT().HashPrefixes().AnyTimes().Return(storage.TreeHashPrefixes{})
+	mockStorage.EXPECT().HashStrategy().AnyTimes().Return(trillian.HashStrategy_RFC6962)
+	mockStorage.EXPECT().HashAlgorithm().AnyTimes().Return(trillian.HashAlgorithm_SHA256)
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+	mockTx.EXPECT().GetRevisionForTag("audit").Return(int64(5), nil)
+	mockTx.EXPECT().GetSignedMapRoot(int64(5)).Return(trillian.SignedMapRoot{MapRevision: 5}, nil)
+	mockTx.EXPECT().Get(int64(5), gomock.Any()).Return([]trillian.MapLeaf{}, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return mockStorage, nil })
+	req := &trillian.GetMapLeavesRequest{MapId: testMapID, Key: [][]byte{[]byte("key1")}, Revision: 2, RevisionTag: "audit"}
+	if _, err := server.GetLeaves(context.Background(), req); err != nil {
+		t.Fatalf("GetLeaves failed: %v", err)
+	}
+	if req.Revision != 2 {
+		t.Errorf("GetLeaves changed the request's revision to %d", req.Revision)
+	}
+}
+
+func TestGetLeavesByUnknownRevisionTag(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockStorage.EXPECT().HashPrefixes().AnyTimes().Return(storage.TreeHashPrefixes{})
+	mockStorage.EXPECT().HashStrategy().AnyTimes().Return(trillian.HashStrategy_RFC6962)
+	mockStorage.EXPECT().HashAlgorithm().AnyTimes().Return(trillian.HashAlgorithm_SHA256)
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+	mockTx.EXPECT().GetRevisionForTag("missing").Return(int64(0), storage.ErrTagNotFound)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return mockStorage, nil })
+	req := &trillian.GetMapLeavesRequest{MapId: testMapID, Key: [][]byte{[]byte("key1")}, RevisionTag: "missing"}
+	if _, err := server.GetLeaves(context.Background(), req); err != storage.ErrTagNotFound {
+		t.Fatalf("Expected ErrTagNotFound but got: %v", err)
+	}
+}
+
+func TestGetLeavesUnpublishedRevision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockStorage.EXPECT().HashPrefixes().AnyTimes().Return(storage.TreeHashPrefixes{})
+	mockStorage.EXPECT().HashStrategy().AnyTimes().Return(trillian.HashStrategy_RFC6962)
+	mockStorage.EXPECT().HashAlgorithm().AnyTimes().Return(trillian.HashAlgorithm_SHA256)
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+	// Revision 6 is staged, so has no published root
+	mockTx.EXPECT().GetSignedMapRoot(int64(6)).Return(trillian.SignedMapRoot{}, storage.ErrMapRootNotFound)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return mockStorage, nil })
+	req := &trillian.GetMapLeavesRequest{MapId: testMapID, Key: [][]byte{[]byte("key1")}, Revision: 6}
+	if _, err := server.GetLeaves(context.Background(), req); grpc.Code(err) != codes.NotFound {
+		t.Fatalf("GetLeaves() of a staged revision = %v, want code %v", err, codes.NotFound)
+	}
+}
+
+func TestSetLeavesExtraDataNotHashed(t *testing.T) {
+	ctx := context.Background()
+
+	var roots [][]byte
+	for _, extra := range []string{"", "content-type: text/plain"} {
+		ctrl := gomock.NewController(t)
+
+		mockStorage := storage.NewMockMapStorage(ctrl)
+		mockStorage.EXPECT().HashPrefixes().AnyTimes().Return(storage.TreeHashPrefixes{})
+		mockStorage.EXPECT().HashStrategy().AnyTimes().Return(trillian.HashStrategy_RFC6962)
+		mockStorage.EXPECT().HashAlgorithm().AnyTimes().Return(trillian.HashAlgorithm_SHA256)
+		mockTx := storage.NewMockMapTX(ctrl)
+		mockStorage.EXPECT().Begin().AnyTimes().Return(mockTx, nil)
+		mockStorage.EXPECT().MapID().AnyTimes().Return(trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+		mockTx.EXPECT().WriteRevision().AnyTimes().Return(int64(1))
+		mockTx.EXPECT().StagedSignedMapRoot().AnyTimes().Return(trillian.SignedMapRoot{}, false, nil)
+		mockTx.EXPECT().LatestSignedMapRoot().AnyTimes().Return(trillian.SignedMapRoot{}, nil)
+		mockTx.EXPECT().GetMerkleNodes(int64(1), gomock.Any()).AnyTimes().Return([]storage.Node{}, nil)
+		mockTx.EXPECT().SetMerkleNodes(gomock.Any()).AnyTimes().Return(nil)
+		mockTx.EXPECT().Rollback().AnyTimes().Return(nil)
+
+		want := []byte(extra)
+		mockTx.EXPECT().SetLeaves(gomock.Any()).Do(func(leaves []trillian.MapLeaf) {
+			for _, leaf := range leaves {
+				if !bytes.Equal(leaf.ExtraData, want) {
+					t.Errorf("Stored leaf with ExtraData %s, want %s", leaf.ExtraData, want)
+				}
+				if len(leaf.LeafHash) == 0 || len(leaf.KeyHash) == 0 {
+					t.Errorf("Stored leaf without LeafHash or KeyHash: %v", leaf)
+				}
+			}
+		}).Return(nil)
+
+		kv := []*trillian.KeyValue{{Key: []byte("key1"), Value: &trillian.MapLeaf{LeafValue: []byte("value1"), ExtraData: want}}}
+		server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return mockStorage, nil })
+		resp, err := server.SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: kv, DryRun: true})
+		if err != nil {
+			t.Fatalf("SetLeaves failed: %v", err)
+		}
+		roots = append(roots, resp.MapRoot.RootHash)
+		ctrl.Finish()
+	}
+
+	if !bytes.Equal(roots[0], roots[1]) {
+		t.Fatalf("ExtraData changed the map root: %x vs %x", roots[0], roots[1])
+	}
+}
+
+func TestGetLeavesUsesProofCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockStorage.EXPECT().HashPrefixes().AnyTimes().Return(storage.TreeHashPrefixes{})
+	mockStorage.EXPECT().HashStrategy().AnyTimes().Return(trillian.HashStrategy_RFC6962)
+	mockStorage.EXPECT().HashAlgorithm().AnyTimes().Return(trillian.HashAlgorithm_SHA256)
+	hasher, err := NewTrillianMapServer(nil).getHasherForMap(mockStorage)
+	if err != nil {
+		t.Fatalf("Failed to get hasher: %v", err)
+	}
+	leaf := trillian.MapLeaf{KeyHash: hasher.HashKey([]byte("key1")), LeafValue: []byte("value1")}
+
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Snapshot().Times(2).Return(mockTx, nil)
+	mockTx.EXPECT().GetSignedMapRoot(int64(5)).Times(2).Return(trillian.SignedMapRoot{MapRevision: 5}, nil)
+	mockTx.EXPECT().Get(int64(5), gomock.Any()).Times(2).Return([]trillian.MapLeaf{leaf}, nil)
+	// The proof nodes should only be read for the first request
+	mockTx.EXPECT().GetMerkleNodes(int64(5), gomock.Any()).Return([]storage.Node{}, nil)
+	mockTx.EXPECT().Commit().Times(2).Return(nil)
+
+	cache := NewProofCache(10)
+	server := NewTrillianMapServerWithProofCache(func(int64) (storage.MapStorage, error) { return mockStorage, nil }, cache)
+	for i := 0; i < 2; i++ {
+		req := &trillian.GetMapLeavesRequest{MapId: testMapID, Key: [][]byte{[]byte("key1")}, Revision: 5}
+		resp, err := server.GetLeaves(context.Background(), req)
+		if err != nil {
+			t.Fatalf("GetLeaves failed: %v", err)
+		}
+		if got, want := len(resp.KeyValue), 1; got != want {
+			t.Fatalf("Got %d leaves, want %d", got, want)
+		}
+	}
+	if got, want := cache.Len(), 1; got != want {
+		t.Fatalf("Cache holds %d proofs, want %d", got, want)
+	}
+}
+
+func TestPublishMapRevisionRefusesRootBehindCurrent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockStorage.EXPECT().MapID().AnyTimes().Return(trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+	mockTx.EXPECT().StagedSignedMapRoot().Return(trillian.SignedMapRoot{MapRevision: 3, RootHash: []byte("root")}, true, nil)
+	mockTx.EXPECT().Rollback().Return(nil)
+
+	now := time.Unix(1000, 0)
+	current := trillian.SignedMapRoot{MapRevision: 2, TimestampNanos: now.Add(time.Minute).UnixNano()}
+	mockTx.EXPECT().LatestSignedMapRoot().Return(current, nil)
+
+	server := NewTrillianMapServerWithTimeSource(func(int64) (storage.MapStorage, error) { return mockStorage, nil }, nil, 0, util.FakeTimeSource{FakeTime: now})
+	_, err := server.PublishMapRevision(context.Background(), &trillian.PublishMapRevisionRequest{MapId: testMapID, Revision: 3})
+	if got, want := grpc.Code(err), codes.FailedPrecondition; got != want {
+		t.Fatalf("PublishMapRevision() = %v, want code %v", err, want)
+	}
+}
+
+func TestPublishMapRevisionInvalidatesProofCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTx, server := setupStagedMap(ctrl, true)
+	mockTx.EXPECT().PublishStagedMapRoot(gomock.Any()).Return(nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	server.proofCache = NewProofCache(10)
+	server.proofCache.Put(testMapID, 3, trillian.Hash("key"), testProof)
+
+	if _, err := server.PublishMapRevision(context.Background(), &trillian.PublishMapRevisionRequest{MapId: testMapID, Revision: 3}); err != nil {
+		t.Fatalf("PublishMapRevision failed: %v", err)
+	}
+	if got := server.proofCache.Len(); got != 0 {
+		t.Fatalf("Expected proof cache to be invalidated but it holds %d proofs", got)
+	}
+}
+
+// fakeSetLeavesStream is a SetLeavesStream server stream which returns reqs and
+// then io.EOF.
+type fakeSetLeavesStream struct {
+	grpc.ServerStream
+	reqs []*trillian.SetMapLeavesRequest
+	resp *trillian.SetMapLeavesResponse
+}
+
+func (f *fakeSetLeavesStream) Recv() (*trillian.SetMapLeavesRequest, error) {
+	if len(f.reqs) == 0 {
+		return nil, io.EOF
+	}
+	req := f.reqs[0]
+	f.reqs = f.reqs[1:]
+	return req, nil
+}
+
+func (f *fakeSetLeavesStream) Context() context.Context {
+	return context.Background()
+}
+
+func (f *fakeSetLeavesStream) SendAndClose(resp *trillian.SetMapLeavesResponse) error {
+	f.resp = resp
+	return nil
+}
+
+// fakeListMapLeavesStream is a ListMapLeaves server stream which keeps the
+// responses sent.
+type fakeListMapLeavesStream struct {
+	grpc.ServerStream
+	resps []*trillian.ListMapLeavesResponse
+}
+
+func (f *fakeListMapLeavesStream) Context() context.Context {
+	return context.Background()
+}
+
+func (f *fakeListMapLeavesStream) Send(resp *trillian.ListMapLeavesResponse) error {
+	f.resps = append(f.resps, resp)
+	return nil
+}
+
+func TestListMapLeaves(t *testing.T) {
+	ctx := context.Background()
+	s, err := memory.NewMapStorage(memory.NewDatabase(), trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+	if err != nil {
+		t.Fatalf("Failed to create map storage: %v", err)
+	}
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return s, nil })
+	if _, err := server.InitMap(ctx, &trillian.InitMapRequest{MapId: testMapID}); err != nil {
+		t.Fatalf("InitMap failed: %v", err)
+	}
+	if _, err := server.SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues}); err != nil {
+		t.Fatalf("SetLeaves failed: %v", err)
+	}
+	// The second revision deletes one key, changes another and adds a third
+	update := []*trillian.KeyValue{
+		{Key: []byte("key1"), Value: &trillian.MapLeaf{}},
+		{Key: []byte("key2"), Value: &trillian.MapLeaf{LeafValue: []byte("value2b")}},
+		{Key: []byte("key3"), Value: &trillian.MapLeaf{LeafValue: []byte("value3")}},
+	}
+	if _, err := server.SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: update}); err != nil {
+		t.Fatalf("SetLeaves failed: %v", err)
+	}
+	hasher, err := server.getHasherForMap(s)
+	if err != nil {
+		t.Fatalf("Failed to get hasher: %v", err)
+	}
+
+	for _, test := range []struct {
+		revision int64
+		want     map[string]string
+	}{
+		{revision: -1, want: map[string]string{"key2": "value2b", "key3": "value3"}},
+		{revision: 1, want: map[string]string{"key1": "value1", "key2": "value2"}},
+		{revision: 0, want: map[string]string{}},
+	} {
+		stream := &fakeListMapLeavesStream{}
+		if err := server.ListMapLeaves(&trillian.ListMapLeavesRequest{MapId: testMapID, Revision: test.revision}, stream); err != nil {
+			t.Errorf("ListMapLeaves(%d) failed: %v", test.revision, err)
+			continue
+		}
+		if len(stream.resps) != 1 || stream.resps[0].MapRoot == nil {
+			t.Errorf("ListMapLeaves(%d) sent %v, want one response with the root", test.revision, stream.resps)
+			continue
+		}
+		resp := stream.resps[0]
+
+		wantLeaves := make(map[string]string)
+		for key, value := range test.want {
+			wantLeaves[string(hasher.HashKey([]byte(key)))] = value
+		}
+		var hsLeaves []merkle.HStar2LeafHash
+		for i, leaf := range resp.Leaves {
+			if i > 0 && bytes.Compare(resp.Leaves[i-1].KeyHash, leaf.KeyHash) >= 0 {
+				t.Errorf("ListMapLeaves(%d) listed key hash %x after %x", test.revision, leaf.KeyHash, resp.Leaves[i-1].KeyHash)
+			}
+			if got, want := string(leaf.LeafValue), wantLeaves[string(leaf.KeyHash)]; got != want {
+				t.Errorf("ListMapLeaves(%d) listed value %q for key hash %x, want %q", test.revision, got, leaf.KeyHash, want)
+			}
+			hsLeaves = append(hsLeaves, merkle.HStar2LeafHash{Index: new(big.Int).SetBytes(leaf.KeyHash), LeafHash: hasher.HashLeaf(leaf.LeafValue)})
+		}
+		if got, want := len(resp.Leaves), len(test.want); got != want {
+			t.Errorf("ListMapLeaves(%d) listed %d leaves, want %d", test.revision, got, want)
+		}
+
+		// The listed leaves are enough to calculate the root
+		hs := merkle.NewHStar2(hasher.TreeHasher)
+		root, err := hs.HStar2Root(hasher.Size()*8, hsLeaves)
+		if err != nil {
+			t.Errorf("ListMapLeaves(%d): HStar2Root failed: %v", test.revision, err)
+			continue
+		}
+		if !bytes.Equal(root, resp.MapRoot.RootHash) {
+			t.Errorf("ListMapLeaves(%d): calculated root %x, want %x", test.revision, root, resp.MapRoot.RootHash)
+		}
+	}
+
+	// A listing can be continued after the last key hash received
+	stream := &fakeListMapLeavesStream{}
+	if err := server.ListMapLeaves(&trillian.ListMapLeavesRequest{MapId: testMapID, Revision: -1}, stream); err != nil {
+		t.Fatalf("ListMapLeaves failed: %v", err)
+	}
+	all := stream.resps[0].Leaves
+	stream = &fakeListMapLeavesStream{}
+	if err := server.ListMapLeaves(&trillian.ListMapLeavesRequest{MapId: testMapID, Revision: -1, AfterKeyHash: all[0].KeyHash}, stream); err != nil {
+		t.Fatalf("ListMapLeaves after %x failed: %v", all[0].KeyHash, err)
+	}
+	if got, want := stream.resps[0].Leaves, all[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListMapLeaves after %x listed %v, want %v", all[0].KeyHash, got, want)
+	}
+}
+
+func TestListMapLeavesUnpublishedRevision(t *testing.T) {
+	s, err := memory.NewMapStorage(memory.NewDatabase(), trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+	if err != nil {
+		t.Fatalf("Failed to create map storage: %v", err)
+	}
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return s, nil })
+	if _, err := server.InitMap(context.Background(), &trillian.InitMapRequest{MapId: testMapID}); err != nil {
+		t.Fatalf("InitMap failed: %v", err)
+	}
+	if err := server.ListMapLeaves(&trillian.ListMapLeavesRequest{MapId: testMapID, Revision: 1}, &fakeListMapLeavesStream{}); err == nil {
+		t.Fatal("ListMapLeaves of an unpublished revision succeeded")
+	}
+}
+
+func TestGetMapUpdateProof(t *testing.T) {
+	ctx := context.Background()
+
+	// Write the first revision to find out what its root should be
+	ctrl := gomock.NewController(t)
+	mockTx, provider := setupEmptyMap(ctrl)
+	mockTx.EXPECT().SetMerkleNodes(gomock.Any()).AnyTimes().Return(nil)
+	mockTx.EXPECT().Commit().AnyTimes().Return(nil)
+	mockTx.EXPECT().StoreSignedMapRoot(gomock.Any()).Return(nil)
+	setResp, err := NewTrillianMapServer(provider).SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues})
+	if err != nil {
+		t.Fatalf("SetLeaves failed: %v", err)
+	}
+	newRoot := setResp.MapRoot.RootHash
+	ctrl.Finish()
+
+	ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockStorage.EXPECT().HashPrefixes().AnyTimes().Return(storage.TreeHashPrefixes{})
+	mockStorage.EXPECT().HashStrategy().AnyTimes().Return(trillian.HashStrategy_RFC6962)
+	mockStorage.EXPECT().HashAlgorithm().AnyTimes().Return(trillian.HashAlgorithm_SHA256)
+	hasher, err := NewTrillianMapServer(nil).getHasherForMap(mockStorage)
+	if err != nil {
+		t.Fatalf("Failed to get hasher: %v", err)
+	}
+	var changed []trillian.MapLeaf
+	for _, kv := range testKeyValues {
+		changed = append(changed, trillian.MapLeaf{KeyHash: hasher.HashKey(kv.Key), LeafValue: kv.Value.LeafValue})
+	}
+
+	mockTx = storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+	mockTx.EXPECT().LatestSignedMapRoot().Return(trillian.SignedMapRoot{MapRevision: 1, RootHash: newRoot}, nil)
+	mockTx.EXPECT().GetMerkleNodes(int64(1), gomock.Any()).Return([]storage.Node{{NodeID: storage.NewEmptyNodeID(256), Hash: newRoot, NodeRevision: 1}}, nil)
+	// Nothing was written before the first revision
+	mockTx.EXPECT().GetMerkleNodes(int64(0), gomock.Any()).AnyTimes().Return([]storage.Node{}, nil)
+	mockTx.EXPECT().GetChangedLeaves(int64(1)).Return(changed, nil)
+	mockTx.EXPECT().Get(int64(0), gomock.Any()).Return([]trillian.MapLeaf{}, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return mockStorage, nil })
+	resp, err := server.GetMapUpdateProof(ctx, &trillian.GetMapUpdateProofRequest{MapId: testMapID, Revision: 1})
+	if err != nil {
+		t.Fatalf("GetMapUpdateProof failed: %v", err)
+	}
+	if got, want := len(resp.Update), len(testKeyValues); got != want {
+		t.Fatalf("Got %d updates, want %d", got, want)
+	}
+
+	var updates []merkle.MapLeafUpdate
+	for _, u := range resp.Update {
+		proof := make([]trillian.Hash, 0, len(u.Inclusion))
+		for _, p := range u.Inclusion {
+			proof = append(proof, p)
+		}
+		updates = append(updates, merkle.MapLeafUpdate{
+			KeyHash:     u.KeyHash,
+			OldLeafHash: u.OldLeafHash,
+			NewLeafHash: hasher.HashLeaf(u.NewLeaf.LeafValue),
+			Proof:       proof,
+		})
+	}
+	if err := merkle.VerifyMapUpdate(resp.OldRootHash, resp.NewRootHash, updates, hasher); err != nil {
+		t.Fatalf("Failed to verify update proof: %v", err)
+	}
+	if !bytes.Equal(resp.NewRootHash, newRoot) {
+		t.Fatalf("Got new root %x, want %x", resp.NewRootHash, newRoot)
+	}
+}
+
+func TestGetMapUpdateProofUnpublishedRevision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockStorage.EXPECT().HashPrefixes().AnyTimes().Return(storage.TreeHashPrefixes{})
+	mockStorage.EXPECT().HashStrategy().AnyTimes().Return(trillian.HashStrategy_RFC6962)
+	mockStorage.EXPECT().HashAlgorithm().AnyTimes().Return(trillian.HashAlgorithm_SHA256)
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Snapshot().Times(2).Return(mockTx, nil)
+	mockTx.EXPECT().LatestSignedMapRoot().Times(2).Return(trillian.SignedMapRoot{MapRevision: 3}, nil)
+	mockTx.EXPECT().Commit().Times(2).Return(nil)
+
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return mockStorage, nil })
+	for _, rev := range []int64{0, 4} {
+		if _, err := server.GetMapUpdateProof(context.Background(), &trillian.GetMapUpdateProofRequest{MapId: testMapID, Revision: rev}); err == nil {
+			t.Errorf("GetMapUpdateProof for revision %d succeeded", rev)
+		}
+	}
+}
+
+func TestSetLeavesStreamMatchesSetLeaves(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockTx, provider := setupEmptyMap(ctrl)
+	mockTx.EXPECT().SetMerkleNodes(gomock.Any()).AnyTimes().Return(nil)
+	mockTx.EXPECT().Commit().AnyTimes().Return(nil)
+	mockTx.EXPECT().StoreSignedMapRoot(gomock.Any()).Return(nil)
+
+	resp, err := NewTrillianMapServer(provider).SetLeaves(context.Background(), &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues})
+	if err != nil {
+		t.Fatalf("SetLeaves failed: %v", err)
+	}
+	wantRoot := resp.MapRoot.RootHash
+	ctrl.Finish()
+
+	// The same leaves sent one per request must give the same root
+	ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+	mockTx, provider = setupEmptyMap(ctrl)
+	mockTx.EXPECT().SetMerkleNodes(gomock.Any()).AnyTimes().Return(nil)
+	mockTx.EXPECT().Commit().AnyTimes().Return(nil)
+	mockTx.EXPECT().StoreSignedMapRoot(gomock.Any()).Return(nil)
+
+	stream := &fakeSetLeavesStream{reqs: []*trillian.SetMapLeavesRequest{
+		{MapId: testMapID, KeyValue: testKeyValues[:1]},
+		{KeyValue: testKeyValues[1:]},
+	}}
+	if err := NewTrillianMapServer(provider).SetLeavesStream(stream); err != nil {
+		t.Fatalf("SetLeavesStream failed: %v", err)
+	}
+	if stream.resp == nil {
+		t.Fatalf("SetLeavesStream did not send a response")
+	}
+	if got := stream.resp.MapRoot.RootHash; !bytes.Equal(got, wantRoot) {
+		t.Fatalf("Streamed root hash mismatch, got %x, want %x", got, wantRoot)
+	}
+}
+
+func TestSetLeavesStreamWrongMapRollsBack(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTx, provider := setupEmptyMap(ctrl)
+	mockTx.EXPECT().SetMerkleNodes(gomock.Any()).AnyTimes().Return(nil)
+	mockTx.EXPECT().Commit().AnyTimes().Return(nil)
+	mockTx.EXPECT().Rollback().MinTimes(1).Return(nil)
+
+	stream := &fakeSetLeavesStream{reqs: []*trillian.SetMapLeavesRequest{
+		{MapId: testMapID, KeyValue: testKeyValues},
+		{MapId: testMapID + 1},
+	}}
+	if err := NewTrillianMapServer(provider).SetLeavesStream(stream); err == nil {
+		t.Fatalf("Expected SetLeavesStream to fail for a request to another map")
+	}
+	if stream.resp != nil {
+		t.Fatalf("SetLeavesStream sent a response after failing: %v", stream.resp)
+	}
+}
+
+func TestSetLeavesStreamEmpty(t *testing.T) {
+	if err := NewTrillianMapServer(nil).SetLeavesStream(&fakeSetLeavesStream{}); err == nil {
+		t.Fatalf("Expected SetLeavesStream to fail with no requests")
+	}
+}
+
+// setupMapForInit returns a server for a map whose latest root is current.
+func setupMapForInit(ctrl *gomock.Controller, current trillian.SignedMapRoot) (*storage.MockMapTX, *TrillianMapServer) {
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockStorage.EXPECT().MapID().AnyTimes().Return(trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+	mockStorage.EXPECT().HashPrefixes().AnyTimes().Return(storage.TreeHashPrefixes{})
+	mockStorage.EXPECT().HashStrategy().AnyTimes().Return(trillian.HashStrategy_RFC6962)
+	mockStorage.EXPECT().HashAlgorithm().AnyTimes().Return(trillian.HashAlgorithm_SHA256)
+	mockTx.EXPECT().LatestSignedMapRoot().Return(current, nil)
+
+	return mockTx, NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return mockStorage, nil })
+}
+
+func TestTagMapRevision(t *testing.T) {
+	for _, test := range []struct {
+		desc      string
+		tagged    int64
+		published bool
+		want      codes.Code
+	}{
+		{desc: "new tag", tagged: -1, published: true, want: codes.OK},
+		{desc: "same revision", tagged: 3, want: codes.OK},
+		{desc: "other revision", tagged: 2, want: codes.AlreadyExists},
+		{desc: "unpublished", tagged: -1, want: codes.NotFound},
+	} {
+		ctrl := gomock.NewController(t)
+
+		mockStorage := storage.NewMockMapStorage(ctrl)
+		mockTx := storage.NewMockMapTX(ctrl)
+		mockStorage.EXPECT().Begin().Return(mockTx, nil)
+		if test.tagged < 0 {
+			mockTx.EXPECT().GetRevisionForTag("audit").Return(int64(0), storage.ErrTagNotFound)
+			if test.published {
+				mockTx.EXPECT().GetSignedMapRoot(int64(3)).Return(trillian.SignedMapRoot{MapRevision: 3}, nil)
+				mockTx.EXPECT().TagMapRevision("audit", int64(3), int64(1234)).Return(nil)
+			} else {
+				mockTx.EXPECT().GetSignedMapRoot(int64(3)).Return(trillian.SignedMapRoot{}, storage.ErrMapRootNotFound)
+			}
+		} else {
+			mockTx.EXPECT().GetRevisionForTag("audit").Return(test.tagged, nil)
+		}
+		if test.want == codes.OK {
+			mockTx.EXPECT().Commit().Return(nil)
+		} else {
+			mockTx.EXPECT().Rollback().Return(nil)
+		}
+
+		server := NewTrillianMapServerWithTimeSource(func(int64) (storage.MapStorage, error) { return mockStorage, nil }, nil, 0, util.FakeTimeSource{FakeTime: time.Unix(0, 1234)})
+		_, err := server.TagMapRevision(context.Background(), &trillian.TagMapRevisionRequest{MapId: testMapID, Tag: "audit", Revision: 3})
+		if got := grpc.Code(err); got != test.want {
+			t.Errorf("%s: TagMapRevision()=%v, want code %v", test.desc, err, test.want)
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestGetMapRevisionTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+	mockTx.EXPECT().GetRevisionTags().Return(map[string]int64{"release": 9, "audit": 5}, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return mockStorage, nil })
+	resp, err := server.GetMapRevisionTags(context.Background(), &trillian.GetMapRevisionTagsRequest{MapId: testMapID})
+	if err != nil {
+		t.Fatalf("GetMapRevisionTags failed: %v", err)
+	}
+	want := []*trillian.MapRevisionTag{{Tag: "audit", Revision: 5}, {Tag: "release", Revision: 9}}
+	if !reflect.DeepEqual(resp.Tags, want) {
+		t.Errorf("GetMapRevisionTags()=%v, want %v", resp.Tags, want)
+	}
+}
+
+func TestInitMap(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTx, server := setupMapForInit(ctrl, trillian.SignedMapRoot{})
+	var stored trillian.SignedMapRoot
+	mockTx.EXPECT().StoreSignedMapRoot(gomock.Any()).Do(func(root trillian.SignedMapRoot) { stored = root }).Return(nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	resp, err := server.InitMap(context.Background(), &trillian.InitMapRequest{MapId: testMapID})
+	if err != nil {
+		t.Fatalf("InitMap failed: %v", err)
+	}
+	hasher := merkle.NewMapHasher(merkle.NewRFC6962TreeHasher(trillian.NewSHA256()))
+	if got, want := resp.Created.RootHash, hasher.EmptyHashes()[256]; !bytes.Equal(got, want) {
+		t.Errorf("Created root hash %x, want empty map root %x", got, want)
+	}
+	if got, want := resp.Created.MapRevision, int64(0); got != want {
+		t.Errorf("Created root has revision %d, want %d", got, want)
+	}
+	if !bytes.Equal(stored.RootHash, resp.Created.RootHash) {
+		t.Errorf("Stored root hash %x, want %x", stored.RootHash, resp.Created.RootHash)
+	}
+}
+
+func TestInitMapAlreadyInitialized(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTx, server := setupMapForInit(ctrl, trillian.SignedMapRoot{MapRevision: 2, RootHash: []byte("root")})
+	mockTx.EXPECT().Rollback().Return(nil)
+
+	if _, err := server.InitMap(context.Background(), &trillian.InitMapRequest{MapId: testMapID}); err != storage.ErrTreeAlreadyInitialized {
+		t.Fatalf("Expected ErrTreeAlreadyInitialized but got: %v", err)
+	}
+}
+
+func TestRefreshRoot(t *testing.T) {
+	ctx := context.Background()
+	s, err := memory.NewMapStorage(memory.NewDatabase(), trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+	if err != nil {
+		t.Fatalf("Failed to create map storage: %v", err)
+	}
+	timeSource := &util.FakeTimeSource{FakeTime: time.Unix(100, 0)}
+	server := NewTrillianMapServerWithTimeSource(func(int64) (storage.MapStorage, error) { return s, nil }, nil, 0, timeSource)
+
+	// Maps without a root are left alone
+	if refreshed, err := server.RefreshRoot(testMapID, time.Minute); err != nil || refreshed {
+		t.Errorf("RefreshRoot() of an uninitialized map = %v, %v, want false, nil", refreshed, err)
+	}
+	if _, err := server.InitMap(ctx, &trillian.InitMapRequest{MapId: testMapID}); err != nil {
+		t.Fatalf("InitMap failed: %v", err)
+	}
+	timeSource.FakeTime = time.Unix(110, 0)
+	resp, err := server.SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues})
+	if err != nil {
+		t.Fatalf("SetLeaves failed: %v", err)
+	}
+	written := resp.MapRoot
+
+	timeSource.FakeTime = time.Unix(130, 0)
+	if refreshed, err := server.RefreshRoot(testMapID, time.Minute); err != nil || refreshed {
+		t.Errorf("RefreshRoot() of a fresh root = %v, %v, want false, nil", refreshed, err)
+	}
+	timeSource.FakeTime = time.Unix(170, 0)
+	if refreshed, err := server.RefreshRoot(testMapID, time.Minute); err != nil || !refreshed {
+		t.Fatalf("RefreshRoot() of an old root = %v, %v, want true, nil", refreshed, err)
+	}
+
+	got, err := server.GetSignedMapRoot(ctx, &trillian.GetSignedMapRootRequest{MapId: testMapID})
+	if err != nil {
+		t.Fatalf("GetSignedMapRoot failed: %v", err)
+	}
+	if want := time.Unix(170, 0).UnixNano(); got.MapRoot.TimestampNanos != want {
+		t.Errorf("Refreshed root has timestamp %d, want %d", got.MapRoot.TimestampNanos, want)
+	}
+	if got.MapRoot.MapRevision != written.MapRevision || !bytes.Equal(got.MapRoot.RootHash, written.RootHash) {
+		t.Errorf("Refreshed root is revision %d with hash %x, want revision %d with hash %x", got.MapRoot.MapRevision, got.MapRoot.RootHash, written.MapRevision, written.RootHash)
+	}
+}
+
+func TestGetSignedMapRootNotInitialized(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+	mockTx.EXPECT().LatestSignedMapRoot().Return(trillian.SignedMapRoot{}, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return mockStorage, nil })
+	if _, err := server.GetSignedMapRoot(context.Background(), &trillian.GetSignedMapRootRequest{MapId: testMapID}); err != storage.ErrTreeNeedsInit {
+		t.Fatalf("Expected ErrTreeNeedsInit but got: %v", err)
+	}
+}
+
+// replicaMapStorage is a map storage whose snapshots at least a revision come
+// from snapshotAtLeast.
+type replicaMapStorage struct {
+	*storage.MockMapStorage
+	snapshotAtLeast storage.ReadOnlyMapTX
+	revision        int64
+}
+
+func (s *replicaMapStorage) SnapshotAtLeast(revision int64) (storage.ReadOnlyMapTX, error) {
+	s.revision = revision
+	return s.snapshotAtLeast, nil
+}
+
+func TestGetSignedMapRootMinRevision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	root := trillian.SignedMapRoot{MapRevision: 3, RootHash: []byte("root3")}
+	for _, test := range []struct {
+		minRevision int64
+		wantCode    codes.Code
+	}{
+		{minRevision: 0, wantCode: codes.OK},
+		{minRevision: 3, wantCode: codes.OK},
+		{minRevision: 4, wantCode: codes.FailedPrecondition},
+	} {
+		mockStorage := storage.NewMockMapStorage(ctrl)
+		mockTx := storage.NewMockMapTX(ctrl)
+		s := &replicaMapStorage{MockMapStorage: mockStorage, snapshotAtLeast: mockTx, revision: -1}
+		if test.minRevision == 0 {
+			mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+		}
+		mockTx.EXPECT().LatestSignedMapRoot().Return(root, nil)
+		mockTx.EXPECT().Commit().Return(nil)
+
+		server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return s, nil })
+		_, err := server.GetSignedMapRoot(context.Background(), &trillian.GetSignedMapRootRequest{MapId: testMapID, MinRevision: test.minRevision})
+		if got := grpc.Code(err); got != test.wantCode {
+			t.Errorf("GetSignedMapRoot(min revision %d)=_, %v, want code %v", test.minRevision, err, test.wantCode)
+		}
+		if test.minRevision > 0 && s.revision != test.minRevision {
+			t.Errorf("GetSignedMapRoot(min revision %d) read a snapshot at least %d", test.minRevision, s.revision)
+		}
+	}
+}
+
+func TestGetSignedMapRootByRevision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	root := trillian.SignedMapRoot{MapRevision: 3, RootHash: []byte("root3")}
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+	mockTx.EXPECT().GetSignedMapRoot(int64(3)).Return(root, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return mockStorage, nil })
+	resp, err := server.GetSignedMapRootByRevision(context.Background(), &trillian.GetSignedMapRootByRevisionRequest{MapId: testMapID, Revision: 3})
+	if err != nil {
+		t.Fatalf("GetSignedMapRootByRevision failed: %v", err)
+	}
+	if got, want := resp.MapRoot.MapRevision, root.MapRevision; got != want {
+		t.Errorf("Got root for revision %d, want %d", got, want)
+	}
+	if !bytes.Equal(resp.MapRoot.RootHash, root.RootHash) {
+		t.Errorf("Got root hash %x, want %x", resp.MapRoot.RootHash, root.RootHash)
+	}
+}
+
+func TestGetSignedMapRootByRevisionPruned(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pruned := storage.RevisionOutOfRangeError{Revision: 1, OldestRetained: 4}
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+	mockTx.EXPECT().GetSignedMapRoot(int64(1)).Return(trillian.SignedMapRoot{}, pruned)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return mockStorage, nil })
+	if _, err := server.GetSignedMapRootByRevision(context.Background(), &trillian.GetSignedMapRootByRevisionRequest{MapId: testMapID, Revision: 1}); err != pruned {
+		t.Fatalf("Expected %v but got: %v", pruned, err)
+	}
+}
+
+func TestGetSignedMapRootByRevisionNegative(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return mockStorage, nil })
+	if _, err := server.GetSignedMapRootByRevision(context.Background(), &trillian.GetSignedMapRootByRevisionRequest{MapId: testMapID, Revision: -1}); err == nil {
+		t.Fatal("GetSignedMapRootByRevision() with negative revision succeeded, want error")
+	}
+}
+
+func TestGetMapLeavesWithProof(t *testing.T) {
+	ctx := context.Background()
+	s, err := memory.NewMapStorage(memory.NewDatabase(), trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+	if err != nil {
+		t.Fatalf("Failed to create map storage: %v", err)
+	}
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return s, nil })
+	if _, err := server.InitMap(ctx, &trillian.InitMapRequest{MapId: testMapID}); err != nil {
+		t.Fatalf("InitMap failed: %v", err)
+	}
+	if _, err := server.SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues}); err != nil {
+		t.Fatalf("SetLeaves failed: %v", err)
+	}
+	hasher, err := server.getHasherForMap(s)
+	if err != nil {
+		t.Fatalf("Failed to get hasher: %v", err)
+	}
+
+	keys := [][]byte{[]byte("key1"), []byte("absent"), []byte("key2")}
+	for _, test := range []struct {
+		revision int64
+		values   []string
+	}{
+		{revision: -1, values: []string{"value1", "", "value2"}},
+		{revision: 1, values: []string{"value1", "", "value2"}},
+		// Nothing was set in the empty map
+		{revision: 0, values: []string{"", "", ""}},
+	} {
+		resp, err := server.GetMapLeavesWithProof(ctx, &trillian.GetMapLeavesRequest{MapId: testMapID, Key: keys, Revision: test.revision})
+		if err != nil {
+			t.Errorf("GetMapLeavesWithProof(%d) failed: %v", test.revision, err)
+			continue
+		}
+		if got, want := len(resp.LeafProof), len(keys); got != want {
+			t.Errorf("GetMapLeavesWithProof(%d) returned %d proofs, want %d", test.revision, got, want)
+			continue
+		}
+		for i, lp := range resp.LeafProof {
+			if !bytes.Equal(lp.Key, keys[i]) {
+				t.Errorf("GetMapLeavesWithProof(%d): proof %d is for key %s, want %s", test.revision, i, lp.Key, keys[i])
+			}
+			proof := make([]trillian.Hash, 0, len(lp.Inclusion))
+			for _, p := range lp.Inclusion {
+				proof = append(proof, p)
+			}
+			kh := hasher.HashKey(keys[i])
+			if test.values[i] == "" {
+				if lp.Leaf != nil {
+					t.Errorf("GetMapLeavesWithProof(%d): got leaf %v for key %s, want none", test.revision, lp.Leaf, keys[i])
+				}
+				if err := merkle.VerifyMapExclusionProof(kh, resp.MapRoot.RootHash, proof, hasher); err != nil {
+					t.Errorf("GetMapLeavesWithProof(%d): failed to verify exclusion of key %s: %v", test.revision, keys[i], err)
+				}
+				continue
+			}
+			if lp.Leaf == nil || string(lp.Leaf.LeafValue) != test.values[i] {
+				t.Errorf("GetMapLeavesWithProof(%d): got leaf %v for key %s, want value %q", test.revision, lp.Leaf, keys[i], test.values[i])
+				continue
+			}
+			if err := merkle.VerifyMapInclusionProof(kh, hasher.HashLeaf(lp.Leaf.LeafValue), resp.MapRoot.RootHash, proof, hasher); err != nil {
+				t.Errorf("GetMapLeavesWithProof(%d): failed to verify inclusion of key %s: %v", test.revision, keys[i], err)
+			}
+		}
+	}
+}
+
+func TestGetMapLeavesWithProofUnpublishedRevision(t *testing.T) {
+	ctx := context.Background()
+	s, err := memory.NewMapStorage(memory.NewDatabase(), trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+	if err != nil {
+		t.Fatalf("Failed to create map storage: %v", err)
+	}
+	server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return s, nil })
+	if _, err := server.InitMap(ctx, &trillian.InitMapRequest{MapId: testMapID}); err != nil {
+		t.Fatalf("InitMap failed: %v", err)
+	}
+
+	if _, err := server.GetMapLeavesWithProof(ctx, &trillian.GetMapLeavesRequest{MapId: testMapID, Key: [][]byte{[]byte("key1")}, Revision: 3}); err != storage.ErrMapRootNotFound {
+		t.Fatalf("Expected ErrMapRootNotFound but got: %v", err)
+	}
+}
+
+func TestSetLeavesUsesMapHashStrategy(t *testing.T) {
+	ctx := context.Background()
+	roots := make(map[trillian.HashStrategy][]byte)
+	for _, strategy := range []trillian.HashStrategy{trillian.HashStrategy_RFC6962, trillian.HashStrategy_LIE_SHA512_256} {
+		db := memory.NewDatabase()
+		db.SetTreeOptions(testMapID, memory.TreeOptions{HashStrategy: strategy})
+		s, err := memory.NewMapStorage(db, trillian.MapID{MapID: []byte("map"), TreeID: testMapID})
+		if err != nil {
+			t.Fatalf("Failed to create map storage: %v", err)
+		}
+		server := NewTrillianMapServer(func(int64) (storage.MapStorage, error) { return s, nil })
+		if _, err := server.InitMap(ctx, &trillian.InitMapRequest{MapId: testMapID}); err != nil {
+			t.Fatalf("%v: InitMap failed: %v", strategy, err)
+		}
+		if _, err := server.SetLeaves(ctx, &trillian.SetMapLeavesRequest{MapId: testMapID, KeyValue: testKeyValues}); err != nil {
+			t.Fatalf("%v: SetLeaves failed: %v", strategy, err)
+		}
+
+		key := []byte("key1")
+		resp, err := server.GetMapLeavesWithProof(ctx, &trillian.GetMapLeavesRequest{MapId: testMapID, Key: [][]byte{key}, Revision: -1})
+		if err != nil {
+			t.Fatalf("%v: GetMapLeavesWithProof failed: %v", strategy, err)
+		}
+		lp := resp.LeafProof[0]
+		if lp.Leaf == nil {
+			t.Fatalf("%v: got no leaf for key %s", strategy, key)
+		}
+		proof := make([]trillian.Hash, 0, len(lp.Inclusion))
+		for _, p := range lp.Inclusion {
+			proof = append(proof, p)
+		}
+
+		// The proof must verify with a hasher built independently for the strategy
+		th, err := merkle.NewTreeHasherForStrategy(strategy, trillian.HashAlgorithm_SHA256, storage.TreeHashPrefixes{})
+		if err != nil {
+			t.Fatalf("%v: NewTreeHasherForStrategy failed: %v", strategy, err)
+		}
+		hasher := merkle.NewMapHasher(th)
+		if err := merkle.VerifyMapInclusionProof(hasher.HashKey(key), hasher.HashLeaf(lp.Leaf.LeafValue), resp.MapRoot.RootHash, proof, hasher); err != nil {
+			t.Errorf("%v: failed to verify inclusion of key %s: %v", strategy, key, err)
+		}
+		roots[strategy] = resp.MapRoot.RootHash
+	}
+
+	if bytes.Equal(roots[trillian.HashStrategy_RFC6962], roots[trillian.HashStrategy_LIE_SHA512_256]) {
+		t.Errorf("Maps with different hash strategies have the same root %x", roots[trillian.HashStrategy_RFC6962])
+	}
+}
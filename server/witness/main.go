@@ -0,0 +1,167 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/client/discovery"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/signer"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/witness"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+var serverPortFlag = flag.Int("port", 8093, "Port to serve witness RPC requests on")
+var witnessIDFlag = flag.String("witness_id", "", "Name of this witness, which its cosignatures are made under")
+var privateKeyFile = flag.String("private_key_file", "", "File containing the PEM encoded private key that cosigns roots")
+var privateKeyPassword = flag.String("private_key_password", "", "Password for the private key")
+var logsFlag = flag.String("logs", "", "Comma separated list of the IDs of the logs that are witnessed. Each log's roots are checked with the keys of its tree, unless it's given as log_id=public_key_file, naming the PEM file holding the only public key that signs its roots")
+var logServerFlag = flag.String("log_server", "", "If set, host:port of the log server holding the logs, or a host:port list or consul://, etcd:// or kubernetes:// service. Each log's latest root is then checked every poll_interval, and the cosignature stored with the log")
+var adminServerFlag = flag.String("admin_server", "", "host:port or service of the TrillianAdmin server the logs' trees are read from, to find how they're hashed and the keys that sign them. Defaults to log_server")
+var stateDirFlag = flag.String("state_dir", "", "Existing directory the latest root witnessed of each log is kept in, so a restarted witness carries on checking the logs against them. If empty the roots are only held in memory, and the first root seen of each log after a restart is trusted")
+var pollIntervalFlag = flag.Duration("poll_interval", time.Minute, "Time between checks of each log's latest root when log_server is set")
+
+// addLogs makes w watch the logs in the logs flag, hashed and signed as set by
+// their trees read from admin, and returns their IDs.
+func addLogs(w *witness.Witness, admin trillian.TrillianAdminClient) ([]int64, error) {
+	var logIDs []int64
+	for _, l := range strings.Split(*logsFlag, ",") {
+		parts := strings.SplitN(l, "=", 2)
+		logID, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log ID %q: %v", parts[0], err)
+		}
+		resp, err := admin.GetTree(context.Background(), &trillian.GetTreeRequest{TreeId: logID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tree of log %d: %v", logID, err)
+		}
+		tree := resp.Tree
+		if tree == nil {
+			return nil, fmt.Errorf("no tree returned for log %d", logID)
+		}
+		prefixes := storage.TreeHashPrefixes{Leaf: tree.LeafHashPrefix, Node: tree.NodeHashPrefix}
+		th, err := merkle.NewTreeHasherForStrategy(tree.HashStrategy, tree.HashAlgorithm, prefixes)
+		if err != nil {
+			return nil, fmt.Errorf("log %d: %v", logID, err)
+		}
+		var keys *crypto.KeySet
+		if len(parts) == 2 {
+			publicKey, err := crypto.LoadPublicKeyFile(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("failed to load public key of log %d: %v", logID, err)
+			}
+			keys = crypto.NewKeySetForKey(publicKey)
+		} else if keys, err = crypto.NewKeySet(tree.Keys); err != nil {
+			return nil, fmt.Errorf("invalid keys for log %d: %v", logID, err)
+		}
+		w.AddLogWithKeys(logID, th, keys)
+		logIDs = append(logIDs, logID)
+	}
+	return logIDs, nil
+}
+
+// followLogs has w check the latest root of each log until done is closed.
+func followLogs(w *witness.Witness, client trillian.TrillianLogClient, logIDs []int64, done chan struct{}) {
+	for {
+		for _, logID := range logIDs {
+			root, err := w.Follow(context.Background(), client, logID)
+			if err != nil {
+				glog.Warningf("Failed to witness log %d: %v", logID, err)
+				continue
+			}
+			glog.V(1).Infof("Cosigned root of log %d at tree size %d", logID, root.TreeSize)
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(*pollIntervalFlag):
+		}
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if len(*witnessIDFlag) == 0 {
+		glog.Fatal("No witness_id given")
+	}
+	keyManager, err := crypto.LoadPasswordProtectedPrivateKey(*privateKeyFile, *privateKeyPassword)
+	if err != nil {
+		glog.Fatalf("Failed to load witness key: %v", err)
+	}
+	rootSigner, _, err := signer.LocalRootSigner(keyManager, trillian.NewSHA256())
+	if err != nil {
+		glog.Fatalf("Failed to create signer: %v", err)
+	}
+
+	w := witness.New(*witnessIDFlag, rootSigner)
+	if len(*stateDirFlag) > 0 {
+		store, err := witness.NewFileRootStore(*stateDirFlag)
+		if err != nil {
+			glog.Fatalf("Invalid state_dir: %v", err)
+		}
+		w.SetRootStore(store)
+	}
+
+	adminServer := *adminServerFlag
+	if len(adminServer) == 0 {
+		adminServer = *logServerFlag
+	}
+	if len(adminServer) == 0 {
+		glog.Fatal("No admin_server or log_server given to read the logs' trees from")
+	}
+	adminConn, err := discovery.DialTarget(adminServer, grpc.WithInsecure())
+	if err != nil {
+		glog.Fatalf("Failed to dial admin server: %v", err)
+	}
+	defer adminConn.Close()
+	logIDs, err := addLogs(w, trillian.NewTrillianAdminClient(adminConn))
+	if err != nil {
+		glog.Fatalf("Invalid logs: %v", err)
+	}
+
+	glog.Infof("Creating RPC server starting on port: %d", *serverPortFlag)
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *serverPortFlag))
+	if err != nil {
+		glog.Errorf("Failed to listen on the server port: %d, because: %v", *serverPortFlag, err)
+		os.Exit(1)
+	}
+	rpcServer := grpc.NewServer()
+	trillian.RegisterTrillianWitnessServer(rpcServer, witness.NewServer(w))
+
+	done := make(chan struct{})
+	if len(*logServerFlag) > 0 {
+		conn, err := discovery.DialTarget(*logServerFlag, grpc.WithInsecure())
+		if err != nil {
+			glog.Fatalf("Failed to dial log server: %v", err)
+		}
+		defer conn.Close()
+		go followLogs(w, trillian.NewTrillianLogClient(conn), logIDs, done)
+	}
+
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-sigs
+		glog.Infof("Signal received: %v", sig)
+		close(done)
+		rpcServer.Stop()
+	}()
+
+	if err := rpcServer.Serve(lis); err != nil {
+		glog.Errorf("RPC server terminated on port %d: %v", *serverPortFlag, err)
+	}
+	glog.Infof("Stopping server, about to exit")
+}
@@ -0,0 +1,238 @@
+package signer
+
+import (
+	gocrypto "crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Client has log roots signed by a remote Signer service. It implements
+// crypto.LogRootSigner so it can be used by the sequencer, and
+// crypto.LogRootBatchSigner so the roots of several logs can be signed together.
+// It also implements the consistency versions of both, sending the proofs that
+// a signer checking consistency needs, and crypto.LogRootKeySigner, returning
+// the signatures the signer made with its keys that aren't active yet.
+type Client struct {
+	client SignerClient
+	// timeout limits how long each request can take
+	timeout time.Duration
+
+	// Must hold this lock before accessing keySignatures
+	mu sync.Mutex
+	// keySignatures holds the key signatures returned with the roots signed
+	// recently, by rootKey, until they're collected by KeySignLogRoot
+	keySignatures map[string][]*trillian.KeySignature
+}
+
+// maxPendingKeySignatures is the most roots whose key signatures are held for
+// KeySignLogRoot. They're all dropped if more are signed without being
+// collected, and KeySignLogRoot then has the roots signed again.
+const maxPendingKeySignatures = MaxRootsPerRequest
+
+// NewClient creates a Client which makes requests over cc, each of which must
+// complete within timeout.
+func NewClient(cc *grpc.ClientConn, timeout time.Duration) *Client {
+	return &Client{client: NewSignerClient(cc), timeout: timeout, keySignatures: make(map[string][]*trillian.KeySignature)}
+}
+
+// rootKey identifies a root by the fields that are signed.
+func rootKey(root trillian.SignedLogRoot) string {
+	return fmt.Sprintf("%x/%d/%d/%x", root.LogId, root.TreeSize, root.TimestampNanos, root.RootHash)
+}
+
+// holdKeySignatures keeps the key signatures of root until they're collected.
+func (c *Client) holdKeySignatures(root trillian.SignedLogRoot, keySignatures []*trillian.KeySignature) {
+	if len(keySignatures) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.keySignatures) >= maxPendingKeySignatures {
+		c.keySignatures = make(map[string][]*trillian.KeySignature)
+	}
+	c.keySignatures[rootKey(root)] = keySignatures
+}
+
+// KeySignLogRoot returns the signatures of root made with the signer's keys
+// that aren't active yet. They're returned along with the signature of a root,
+// so a root signed just before by this client isn't sent again.
+func (c *Client) KeySignLogRoot(root trillian.SignedLogRoot) ([]*trillian.KeySignature, error) {
+	key := rootKey(root)
+	c.mu.Lock()
+	keySignatures, ok := c.keySignatures[key]
+	delete(c.keySignatures, key)
+	c.mu.Unlock()
+	if ok {
+		return keySignatures, nil
+	}
+	resp, err := c.signRoot(root, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.KeySignatures, nil
+}
+
+// SignLogRoot asks the signer to sign root, and returns the signature. A
+// signer checking consistency won't sign a root which needs a proof.
+func (c *Client) SignLogRoot(root trillian.SignedLogRoot) (trillian.DigitallySigned, error) {
+	return c.signLogRoot(root, nil)
+}
+
+// SignLogRootConsistent asks the signer to sign root, sending proofs that it's
+// consistent with each of the roots the signer signed before.
+func (c *Client) SignLogRootConsistent(root trillian.SignedLogRoot, proof crypto.ConsistencyProofFunc) (trillian.DigitallySigned, error) {
+	sizes, err := c.SignedTreeSizes([][]byte{root.LogId})
+	if err != nil {
+		return trillian.DigitallySigned{}, err
+	}
+	proofs, err := proofsFor(root.TreeSize, sizes[0], proof)
+	if err != nil {
+		return trillian.DigitallySigned{}, err
+	}
+	return c.signLogRoot(root, proofs)
+}
+
+func (c *Client) signLogRoot(root trillian.SignedLogRoot, proofs []*ConsistencyProof) (trillian.DigitallySigned, error) {
+	resp, err := c.signRoot(root, proofs)
+	if err != nil {
+		return trillian.DigitallySigned{}, err
+	}
+	c.holdKeySignatures(root, resp.KeySignatures)
+	return *resp.Signature, nil
+}
+
+// signRoot makes a SignRoot request, checking that it returns a signature.
+func (c *Client) signRoot(root trillian.SignedLogRoot, proofs []*ConsistencyProof) (*SignRootResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	// Any existing signatures aren't needed
+	root.Signature = nil
+	root.KeySignatures = nil
+	resp, err := c.client.SignRoot(ctx, &SignRootRequest{Root: &root, ConsistencyProofs: proofs})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Signature == nil {
+		return nil, errors.New("signer returned no signature")
+	}
+	return resp, nil
+}
+
+// SignLogRoots asks the signer to sign roots in one request, and returns their
+// signatures in the same order.
+func (c *Client) SignLogRoots(roots []trillian.SignedLogRoot) ([]trillian.DigitallySigned, error) {
+	return c.signLogRoots(roots, nil)
+}
+
+// SignLogRootsConsistent asks the signer to sign roots in one request, sending
+// proofs that each is consistent with the roots the signer signed before.
+func (c *Client) SignLogRootsConsistent(roots []trillian.SignedLogRoot, proofs []crypto.ConsistencyProofFunc) ([]trillian.DigitallySigned, error) {
+	if len(proofs) != len(roots) {
+		return nil, fmt.Errorf("got %d consistency proofs for %d roots", len(proofs), len(roots))
+	}
+	logIDs := make([][]byte, 0, len(roots))
+	for _, root := range roots {
+		logIDs = append(logIDs, root.LogId)
+	}
+	sizes, err := c.SignedTreeSizes(logIDs)
+	if err != nil {
+		return nil, err
+	}
+	consistency := make([]*RootConsistency, 0, len(roots))
+	for i, root := range roots {
+		p, err := proofsFor(root.TreeSize, sizes[i], proofs[i])
+		if err != nil {
+			return nil, err
+		}
+		consistency = append(consistency, &RootConsistency{Proofs: p})
+	}
+	return c.signLogRoots(roots, consistency)
+}
+
+func (c *Client) signLogRoots(roots []trillian.SignedLogRoot, consistency []*RootConsistency) ([]trillian.DigitallySigned, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	req := &SignRootsRequest{Roots: make([]*trillian.SignedLogRoot, 0, len(roots)), Consistency: consistency}
+	for _, root := range roots {
+		// Any existing signatures aren't needed
+		root.Signature = nil
+		root.KeySignatures = nil
+		r := root
+		req.Roots = append(req.Roots, &r)
+	}
+	resp, err := c.client.SignRoots(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Signatures) != len(roots) {
+		return nil, fmt.Errorf("signer returned %d signatures for %d roots", len(resp.Signatures), len(roots))
+	}
+	if len(resp.KeySignatures) > 0 && len(resp.KeySignatures) != len(roots) {
+		return nil, fmt.Errorf("signer returned key signatures for %d roots, asked for %d", len(resp.KeySignatures), len(roots))
+	}
+	signatures := make([]trillian.DigitallySigned, 0, len(roots))
+	for _, signature := range resp.Signatures {
+		if signature == nil {
+			return nil, errors.New("signer returned no signature")
+		}
+		signatures = append(signatures, *signature)
+	}
+	for i, ks := range resp.KeySignatures {
+		if ks != nil {
+			c.holdKeySignatures(roots[i], ks.KeySignatures)
+		}
+	}
+	return signatures, nil
+}
+
+// SignedTreeSizes returns the sizes of the last roots the signer signed for
+// each of logIDs, which new roots must be proven consistent with. A signer
+// that doesn't check consistency needs no proofs.
+func (c *Client) SignedTreeSizes(logIDs [][]byte) ([][]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	resp, err := c.client.GetSignedTreeSizes(ctx, &GetSignedTreeSizesRequest{LogIds: logIDs})
+	if grpc.Code(err) == codes.Unimplemented {
+		return make([][]int64, len(logIDs)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Sizes) != len(logIDs) {
+		return nil, fmt.Errorf("signer returned sizes for %d logs, asked for %d", len(resp.Sizes), len(logIDs))
+	}
+	sizes := make([][]int64, 0, len(logIDs))
+	for _, s := range resp.Sizes {
+		if s == nil {
+			sizes = append(sizes, nil)
+			continue
+		}
+		sizes = append(sizes, s.TreeSizes)
+	}
+	return sizes, nil
+}
+
+// PublicKey returns the public key that the signer's signatures can be
+// verified with.
+func (c *Client) PublicKey(ctx context.Context) (gocrypto.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	resp, err := c.client.GetPublicKey(ctx, &GetPublicKeyRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParsePKIXPublicKey(resp.PublicKey)
+}
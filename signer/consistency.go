@@ -0,0 +1,269 @@
+package signer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// RootStore records the last root a signer signed for each log.
+type RootStore interface {
+	// LastRoot returns the last root signed for the log, or nil if none has been.
+	LastRoot(logID []byte) (*trillian.SignedLogRoot, error)
+	// SetLastRoot records root as the last one signed for its log.
+	SetLastRoot(root trillian.SignedLogRoot) error
+}
+
+// FileRootStore is a RootStore which keeps the last root of each log in a file
+// of its own, so the record survives the signer being restarted.
+type FileRootStore struct {
+	dir string
+}
+
+// NewFileRootStore creates a FileRootStore keeping its files in dir, which
+// must already exist.
+func NewFileRootStore(dir string) (*FileRootStore, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &FileRootStore{dir: dir}, nil
+}
+
+func (f *FileRootStore) path(logID []byte) string {
+	return filepath.Join(f.dir, hex.EncodeToString(logID)+".root")
+}
+
+// LastRoot implements RootStore.
+func (f *FileRootStore) LastRoot(logID []byte) (*trillian.SignedLogRoot, error) {
+	data, err := ioutil.ReadFile(f.path(logID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var root trillian.SignedLogRoot
+	if err := proto.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("corrupt root for log %x: %v", logID, err)
+	}
+	return &root, nil
+}
+
+// SetLastRoot implements RootStore. The file is replaced by a rename, so a
+// crash leaves either the old root or the new one.
+func (f *FileRootStore) SetLastRoot(root trillian.SignedLogRoot) error {
+	root.Signature = nil
+	data, err := proto.Marshal(&root)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(f.dir, "tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(root.LogId))
+}
+
+// ConsistentSigner only signs a root of a log that's consistent with the last
+// root it signed for that log, which it records in a RootStore. A log can then
+// only present a split view if it gets a signer to forget what it signed.
+type ConsistentSigner struct {
+	signer   crypto.LogRootSigner
+	store    RootStore
+	verifier merkle.LogVerifier
+
+	// mu is held while a root is checked, signed and recorded, so two roots
+	// can't both be checked against the same last root
+	mu sync.Mutex
+}
+
+// NewConsistentSigner creates a ConsistentSigner which signs with signer, and
+// checks consistency proofs for trees hashed with th.
+func NewConsistentSigner(signer crypto.LogRootSigner, store RootStore, th merkle.TreeHasher) *ConsistentSigner {
+	return &ConsistentSigner{signer: signer, store: store, verifier: merkle.NewLogVerifier(th)}
+}
+
+// SignLogRoot signs root if it's no larger than the last root signed for the
+// log, or is the first root signed for it.
+func (c *ConsistentSigner) SignLogRoot(root trillian.SignedLogRoot) (trillian.DigitallySigned, error) {
+	return c.SignLogRootConsistent(root, nil)
+}
+
+// SignLogRootConsistent signs root once proof shows it's consistent with the
+// last root signed for the log, and records it as the last root.
+func (c *ConsistentSigner) SignLogRootConsistent(root trillian.SignedLogRoot, proof crypto.ConsistencyProofFunc) (trillian.DigitallySigned, error) {
+	if len(root.LogId) == 0 {
+		// There's nothing to keep track of the root by, but the empty tree
+		// made when a log is created is consistent with any other
+		if root.TreeSize > 0 {
+			return trillian.DigitallySigned{}, errors.New("root has no log ID")
+		}
+		return c.signer.SignLogRoot(root)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last, err := c.store.LastRoot(root.LogId)
+	if err != nil {
+		return trillian.DigitallySigned{}, err
+	}
+	if last != nil {
+		if err := c.checkConsistent(*last, root, proof); err != nil {
+			return trillian.DigitallySigned{}, err
+		}
+	}
+
+	signature, err := c.signer.SignLogRoot(root)
+	if err != nil {
+		return trillian.DigitallySigned{}, err
+	}
+	// The signature isn't released until the root is recorded, or a restart
+	// could let an inconsistent root be signed
+	if err := c.store.SetLastRoot(root); err != nil {
+		return trillian.DigitallySigned{}, err
+	}
+	return signature, nil
+}
+
+// KeySignLogRoot returns the signatures of root by keys that aren't active
+// yet, if the signer is a crypto.LogRootKeySigner. Only the last root signed
+// for the log can be signed this way, so the consistency checks can't be
+// avoided.
+func (c *ConsistentSigner) KeySignLogRoot(root trillian.SignedLogRoot) ([]*trillian.KeySignature, error) {
+	k, ok := c.signer.(crypto.LogRootKeySigner)
+	if !ok {
+		return nil, nil
+	}
+	if len(root.LogId) > 0 {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		last, err := c.store.LastRoot(root.LogId)
+		if err != nil {
+			return nil, err
+		}
+		if last == nil || last.TreeSize != root.TreeSize || !bytes.Equal(last.RootHash, root.RootHash) {
+			return nil, grpc.Errorf(codes.FailedPrecondition, "root of log %x isn't the last one signed", root.LogId)
+		}
+	} else if root.TreeSize > 0 {
+		return nil, errors.New("root has no log ID")
+	}
+	return k.KeySignLogRoot(root)
+}
+
+// checkConsistent returns an error unless root is consistent with last.
+func (c *ConsistentSigner) checkConsistent(last, root trillian.SignedLogRoot, proof crypto.ConsistencyProofFunc) error {
+	switch {
+	case root.TreeSize < last.TreeSize:
+		return grpc.Errorf(codes.FailedPrecondition, "log %x has signed tree size %d, won't sign smaller size %d", root.LogId, last.TreeSize, root.TreeSize)
+	case root.TreeSize == last.TreeSize:
+		if !bytes.Equal(root.RootHash, last.RootHash) {
+			return grpc.Errorf(codes.FailedPrecondition, "log %x has a signed root of size %d with a different hash", root.LogId, root.TreeSize)
+		}
+		return nil
+	case last.TreeSize == 0:
+		// Every tree is consistent with the empty tree
+		return nil
+	case proof == nil:
+		return grpc.Errorf(codes.FailedPrecondition, "log %x needs a consistency proof from signed tree size %d", root.LogId, last.TreeSize)
+	}
+
+	hashes, err := proof(last.TreeSize)
+	if err != nil {
+		return err
+	}
+	proofHashes := make([]trillian.Hash, 0, len(hashes))
+	for _, h := range hashes {
+		proofHashes = append(proofHashes, h)
+	}
+	if err := c.verifier.VerifyConsistencyProof(last.TreeSize, root.TreeSize, last.RootHash, root.RootHash, proofHashes); err != nil {
+		return grpc.Errorf(codes.FailedPrecondition, "root of log %x isn't consistent with signed tree size %d: %v", root.LogId, last.TreeSize, err)
+	}
+	return nil
+}
+
+// SignedTreeSizes returns the size of the last root signed for each of logIDs,
+// with no size for a log that hasn't had one signed.
+func (c *ConsistentSigner) SignedTreeSizes(logIDs [][]byte) ([][]int64, error) {
+	sizes := make([][]int64, 0, len(logIDs))
+	for _, logID := range logIDs {
+		last, err := c.store.LastRoot(logID)
+		if err != nil {
+			return nil, err
+		}
+		if last == nil {
+			sizes = append(sizes, nil)
+			continue
+		}
+		sizes = append(sizes, []int64{last.TreeSize})
+	}
+	return sizes, nil
+}
+
+// treeSizer is implemented by signers that can say which tree sizes roots must
+// be proven consistent with.
+type treeSizer interface {
+	SignedTreeSizes(logIDs [][]byte) ([][]int64, error)
+}
+
+// proofsFor calls proof for each of sizes that a root of treeSize needs a
+// consistency proof from. The sizes proofs aren't needed from are skipped.
+func proofsFor(treeSize int64, sizes []int64, proof crypto.ConsistencyProofFunc) ([]*ConsistencyProof, error) {
+	var proofs []*ConsistencyProof
+	for _, size := range sizes {
+		if size <= 0 || size >= treeSize {
+			continue
+		}
+		if proof == nil {
+			return nil, fmt.Errorf("no consistency proof from tree size %d", size)
+		}
+		hashes, err := proof(size)
+		if err != nil {
+			return nil, err
+		}
+		proofs = append(proofs, &ConsistencyProof{FirstTreeSize: size, Hashes: hashes})
+	}
+	return proofs, nil
+}
+
+// proofFunc returns a ConsistencyProofFunc serving proofs.
+func proofFunc(proofs []*ConsistencyProof) crypto.ConsistencyProofFunc {
+	return func(fromSize int64) ([][]byte, error) {
+		for _, p := range proofs {
+			if p != nil && p.FirstTreeSize == fromSize {
+				return p.Hashes, nil
+			}
+		}
+		return nil, grpc.Errorf(codes.FailedPrecondition, "no consistency proof from tree size %d", fromSize)
+	}
+}
@@ -0,0 +1,160 @@
+package signer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// testLog builds roots of a log held in memory, and the proofs between them.
+type testLog struct {
+	tree *merkle.InMemoryMerkleTree
+}
+
+func newTestLog(name string, size int) *testLog {
+	l := &testLog{tree: merkle.NewInMemoryMerkleTree(merkle.NewRFC6962TreeHasher(trillian.NewSHA256()))}
+	for i := 0; i < size; i++ {
+		l.tree.AddLeaf([]byte(fmt.Sprintf("%s %d", name, i)))
+	}
+	return l
+}
+
+func (l *testLog) root(size int) trillian.SignedLogRoot {
+	return trillian.SignedLogRoot{LogId: []byte("log"), TreeSize: int64(size), RootHash: l.tree.RootAtSnapshot(size).Hash()}
+}
+
+// proof serves the consistency proofs for the root of size.
+func (l *testLog) proof(size int) crypto.ConsistencyProofFunc {
+	return func(fromSize int64) ([][]byte, error) {
+		var hashes [][]byte
+		for _, d := range l.tree.SnapshotConsistency(int(fromSize), size) {
+			hashes = append(hashes, d.Value.Hash())
+		}
+		return hashes, nil
+	}
+}
+
+func newTestConsistentSigner(t *testing.T, dir string) *ConsistentSigner {
+	store, err := NewFileRootStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileRootStore failed: %v", err)
+	}
+	signers, _ := newTestSigners(t, 1)
+	return NewConsistentSigner(signers[0], store, merkle.NewRFC6962TreeHasher(trillian.NewSHA256()))
+}
+
+func TestConsistentSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roots")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := newTestLog("leaf", 10)
+	// The same log ID, but with different leaves
+	forked := newTestLog("fork", 11)
+
+	c := newTestConsistentSigner(t, dir)
+	// The first root seen needs no proof
+	if _, err := c.SignLogRoot(l.root(4)); err != nil {
+		t.Fatalf("SignLogRoot(first root) failed: %v", err)
+	}
+
+	for _, test := range []struct {
+		desc  string
+		root  trillian.SignedLogRoot
+		proof crypto.ConsistencyProofFunc
+		ok    bool
+	}{
+		{desc: "same root", root: l.root(4), ok: true},
+		{desc: "no proof", root: l.root(6)},
+		{desc: "smaller", root: l.root(3), proof: l.proof(3)},
+		{desc: "forked", root: forked.root(11), proof: forked.proof(11)},
+		{desc: "wrong proof", root: l.root(8), proof: l.proof(7)},
+		{desc: "consistent", root: l.root(8), proof: l.proof(8), ok: true},
+		{desc: "same size, different hash", root: forked.root(8)},
+	} {
+		_, err := c.SignLogRootConsistent(test.root, test.proof)
+		if got := err == nil; got != test.ok {
+			t.Errorf("%s: SignLogRootConsistent()=%v, want success %v", test.desc, err, test.ok)
+		}
+		if err != nil && grpc.Code(err) != codes.FailedPrecondition {
+			t.Errorf("%s: SignLogRootConsistent()=%v, want FailedPrecondition", test.desc, err)
+		}
+	}
+
+	// A new signer using the same directory remembers the last root signed
+	c = newTestConsistentSigner(t, dir)
+	sizes, err := c.SignedTreeSizes([][]byte{[]byte("log"), []byte("other")})
+	if err != nil {
+		t.Fatalf("SignedTreeSizes failed: %v", err)
+	}
+	if len(sizes) != 2 || len(sizes[0]) != 1 || sizes[0][0] != 8 || len(sizes[1]) != 0 {
+		t.Errorf("SignedTreeSizes()=%v, want [[8] []]", sizes)
+	}
+	if _, err := c.SignLogRootConsistent(l.root(10), l.proof(9)); err == nil {
+		t.Errorf("SignLogRootConsistent() after restart accepted a proof from the wrong size")
+	}
+	if _, err := c.SignLogRootConsistent(l.root(10), l.proof(10)); err != nil {
+		t.Errorf("SignLogRootConsistent() after restart failed: %v", err)
+	}
+}
+
+func TestThresholdSignerPassesProofs(t *testing.T) {
+	var signers []crypto.LogRootSigner
+	hasher := trillian.NewSHA256()
+	l := newTestLog("leaf", 10)
+
+	local, pubKeys := newTestSigners(t, 2)
+	for i, s := range local {
+		dir, err := ioutil.TempDir("", "roots")
+		if err != nil {
+			t.Fatalf("TempDir failed: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		store, err := NewFileRootStore(dir)
+		if err != nil {
+			t.Fatalf("NewFileRootStore failed: %v", err)
+		}
+		c := NewConsistentSigner(s, store, merkle.NewRFC6962TreeHasher(hasher))
+		// The signers have each seen a different root
+		if _, err := c.SignLogRoot(l.root(3 + i)); err != nil {
+			t.Fatalf("SignLogRoot failed: %v", err)
+		}
+		signers = append(signers, c)
+	}
+
+	ts, err := NewThresholdSigner(signers, pubKeys, 2, hasher)
+	if err != nil {
+		t.Fatalf("NewThresholdSigner failed: %v", err)
+	}
+	sizes, err := ts.SignedTreeSizes([][]byte{[]byte("log")})
+	if err != nil {
+		t.Fatalf("SignedTreeSizes failed: %v", err)
+	}
+	if len(sizes) != 1 || len(sizes[0]) != 2 {
+		t.Fatalf("SignedTreeSizes()=%v, want sizes from both signers", sizes)
+	}
+
+	if _, err := ts.SignLogRoot(l.root(10)); err == nil {
+		t.Errorf("SignLogRoot() without proofs succeeded")
+	}
+	sig, err := ts.SignLogRootConsistent(l.root(10), l.proof(10))
+	if err != nil {
+		t.Fatalf("SignLogRootConsistent failed: %v", err)
+	}
+	v, err := NewThresholdVerifier(pubKeys, 2, hasher)
+	if err != nil {
+		t.Fatalf("NewThresholdVerifier failed: %v", err)
+	}
+	if err := v.VerifyLogRoot(l.root(10), sig); err != nil {
+		t.Errorf("VerifyLogRoot failed: %v", err)
+	}
+}
@@ -0,0 +1,345 @@
+// Package signer provides a gRPC service that signs log roots, so that the
+// private key can be held on separate, hardened hosts from the log servers.
+// Clients are authenticated by their TLS certificates.
+package signer
+
+import (
+	gocrypto "crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Server implements the Signer service with a key held by a KeyManager.
+type Server struct {
+	keyManager crypto.KeyManager
+	hasher     trillian.Hasher
+	// allowedClients holds the common names of the client certificates that
+	// may use the service, any verified client may if it is empty
+	allowedClients map[string]bool
+	// threshold makes threshold signatures, with the help of other signers,
+	// if set. Otherwise roots are signed with the key held by keyManager.
+	threshold *ThresholdSigner
+	// consistent signs roots with the key held by keyManager once they're
+	// shown to be consistent with the roots it signed before, if set
+	consistent *ConsistentSigner
+	// nextKeyManager holds the key that will replace keyManager's, which
+	// roots are also signed with, if set. nextKeyID is the ID of its key.
+	nextKeyManager crypto.KeyManager
+	nextKeyID      string
+}
+
+// NewServer creates a Server which signs with the key held by km. Only the
+// clients presenting a certificate with one of the common names in
+// allowedClients may use it, or any client with a verified certificate if
+// allowedClients is empty.
+func NewServer(km crypto.KeyManager, hasher trillian.Hasher, allowedClients []string) *Server {
+	allowed := make(map[string]bool)
+	for _, name := range allowedClients {
+		allowed[name] = true
+	}
+	return &Server{keyManager: km, hasher: hasher, allowedClients: allowed}
+}
+
+// NewThresholdServer creates a Server which coordinates threshold signing,
+// returning the signatures made by ts. This server's own key, held by km,
+// should be one of those used by ts. The requests to other signers are made
+// by this server, so the clients need only make a request to one of them.
+func NewThresholdServer(ts *ThresholdSigner, km crypto.KeyManager, hasher trillian.Hasher, allowedClients []string) *Server {
+	s := NewServer(km, hasher, allowedClients)
+	s.threshold = ts
+	return s
+}
+
+// LocalRootSigner returns a signer for roots using the key held by km, and the
+// public key to verify its signatures with.
+func LocalRootSigner(km crypto.KeyManager, hasher trillian.Hasher) (crypto.LogRootSigner, gocrypto.PublicKey, error) {
+	signer, err := km.Signer()
+	if err != nil {
+		return nil, nil, err
+	}
+	algorithm, err := crypto.SignatureAlgorithmForKey(signer.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	return crypto.NewTrillianSigner(hasher, algorithm, signer), signer.Public(), nil
+}
+
+// RotatingSigner signs roots with the current key of a signer, and also with
+// the key that will replace it, giving those signatures as key signatures so
+// that verifiers can start trusting the new key before it's activated.
+type RotatingSigner struct {
+	crypto.LogRootSigner
+	nextKeyID string
+	next      crypto.LogRootSigner
+}
+
+// NewRotatingSigner creates a RotatingSigner signing with current, and with
+// next, whose key has the ID nextKeyID in the keys of the trees it signs.
+func NewRotatingSigner(current crypto.LogRootSigner, nextKeyID string, next crypto.LogRootSigner) *RotatingSigner {
+	return &RotatingSigner{LogRootSigner: current, nextKeyID: nextKeyID, next: next}
+}
+
+// KeySignLogRoot implements crypto.LogRootKeySigner.
+func (r *RotatingSigner) KeySignLogRoot(root trillian.SignedLogRoot) ([]*trillian.KeySignature, error) {
+	signature, err := r.next.SignLogRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	return []*trillian.KeySignature{{KeyId: r.nextKeyID, Signature: &signature}}, nil
+}
+
+// SetNextKey makes the server also sign roots with the key held by km, which
+// has the ID keyID in the keys of the trees the server signs, while the trees
+// are moved over to it. It must be called before SetRootStore.
+func (s *Server) SetNextKey(keyID string, km crypto.KeyManager) {
+	s.nextKeyID, s.nextKeyManager = keyID, km
+}
+
+// localSigner returns the signer using the server's own keys, which is a
+// RotatingSigner if the server has a next key.
+func (s *Server) localSigner() (crypto.LogRootSigner, error) {
+	signer, _, err := LocalRootSigner(s.keyManager, s.hasher)
+	if err != nil || s.nextKeyManager == nil {
+		return signer, err
+	}
+	next, _, err := LocalRootSigner(s.nextKeyManager, s.hasher)
+	if err != nil {
+		return nil, err
+	}
+	return NewRotatingSigner(signer, s.nextKeyID, next), nil
+}
+
+// SetRootStore makes the server record the last root it signs for each log in
+// store, and only sign a root that's consistent with it, checking the proofs
+// for trees hashed with th. It has no effect on a server coordinating
+// threshold signing, whose own signer should be a ConsistentSigner instead.
+func (s *Server) SetRootStore(store RootStore, th merkle.TreeHasher) error {
+	signer, err := s.localSigner()
+	if err != nil {
+		return err
+	}
+	s.consistent = NewConsistentSigner(signer, store, th)
+	return nil
+}
+
+// rootSigner returns the signer used to sign roots.
+func (s *Server) rootSigner() (crypto.LogRootSigner, error) {
+	if s.threshold != nil {
+		return s.threshold, nil
+	}
+	if s.consistent != nil {
+		return s.consistent, nil
+	}
+	return s.localSigner()
+}
+
+// signRoot signs root with signer, passing on the consistency proofs if the
+// signer checks them. It also returns the key signatures of root if the signer
+// is a crypto.LogRootKeySigner.
+func signRoot(signer crypto.LogRootSigner, root trillian.SignedLogRoot, proofs []*ConsistencyProof) (trillian.DigitallySigned, []*trillian.KeySignature, error) {
+	var signature trillian.DigitallySigned
+	var err error
+	if c, ok := signer.(crypto.LogRootConsistencySigner); ok {
+		signature, err = c.SignLogRootConsistent(root, proofFunc(proofs))
+	} else {
+		signature, err = signer.SignLogRoot(root)
+	}
+	if err != nil {
+		return trillian.DigitallySigned{}, nil, err
+	}
+	keySignatures, err := keySignRoot(signer, root)
+	if err != nil {
+		return trillian.DigitallySigned{}, nil, err
+	}
+	return signature, keySignatures, nil
+}
+
+// keySignRoot returns the key signatures of root if signer is a
+// crypto.LogRootKeySigner.
+func keySignRoot(signer crypto.LogRootSigner, root trillian.SignedLogRoot) ([]*trillian.KeySignature, error) {
+	k, ok := signer.(crypto.LogRootKeySigner)
+	if !ok {
+		return nil, nil
+	}
+	return k.KeySignLogRoot(root)
+}
+
+// authorize checks that the client which made the request in ctx presented a
+// verified certificate that is allowed to use the service.
+func (s *Server) authorize(ctx context.Context) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return grpc.Errorf(codes.Unauthenticated, "no peer information")
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return grpc.Errorf(codes.Unauthenticated, "client certificate required")
+	}
+	if len(s.allowedClients) == 0 {
+		return nil
+	}
+	name := info.State.VerifiedChains[0][0].Subject.CommonName
+	if !s.allowedClients[name] {
+		glog.Warningf("Rejected signing request from client %q", name)
+		return grpc.Errorf(codes.PermissionDenied, "client %q may not use the signer", name)
+	}
+	return nil
+}
+
+// SignRoot implements SignerServer.
+func (s *Server) SignRoot(ctx context.Context, req *SignRootRequest) (*SignRootResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if req.Root == nil {
+		return nil, errors.New("no root to sign")
+	}
+
+	signer, err := s.rootSigner()
+	if err != nil {
+		return nil, err
+	}
+	signature, keySignatures, err := signRoot(signer, *req.Root, req.ConsistencyProofs)
+	if err != nil {
+		return nil, err
+	}
+	return &SignRootResponse{Signature: &signature, KeySignatures: keySignatures}, nil
+}
+
+// MaxRootsPerRequest is the most roots that can be signed by one SignRoots request.
+const MaxRootsPerRequest = 1000
+
+// SignRoots implements SignerServer. Each root gets its own signature, made
+// with the same key as SignRoot would use or by the threshold signers, so a
+// batch takes as many signing operations as separate requests. Only the
+// requests themselves are saved.
+func (s *Server) SignRoots(ctx context.Context, req *SignRootsRequest) (*SignRootsResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if len(req.Roots) > MaxRootsPerRequest {
+		return nil, fmt.Errorf("%d roots is more than the limit of %d", len(req.Roots), MaxRootsPerRequest)
+	}
+	if len(req.Consistency) > 0 && len(req.Consistency) != len(req.Roots) {
+		return nil, fmt.Errorf("got consistency proofs for %d roots but %d roots", len(req.Consistency), len(req.Roots))
+	}
+	proofs := func(i int) []*ConsistencyProof {
+		if len(req.Consistency) == 0 || req.Consistency[i] == nil {
+			return nil
+		}
+		return req.Consistency[i].Proofs
+	}
+
+	roots := make([]trillian.SignedLogRoot, 0, len(req.Roots))
+	for i, root := range req.Roots {
+		if root == nil {
+			return nil, fmt.Errorf("no root to sign at index %d", i)
+		}
+		roots = append(roots, *root)
+	}
+
+	var signed []trillian.DigitallySigned
+	keySigned := make([][]*trillian.KeySignature, len(roots))
+	if s.threshold != nil {
+		var err error
+		funcs := make([]crypto.ConsistencyProofFunc, 0, len(roots))
+		for i := range roots {
+			funcs = append(funcs, proofFunc(proofs(i)))
+		}
+		if signed, err = s.threshold.SignLogRootsConsistent(roots, funcs); err != nil {
+			return nil, err
+		}
+		for i, root := range roots {
+			if keySigned[i], err = s.threshold.KeySignLogRoot(root); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		signer, err := s.rootSigner()
+		if err != nil {
+			return nil, err
+		}
+		for i, root := range roots {
+			signature, keySignatures, err := signRoot(signer, root, proofs(i))
+			if err != nil {
+				return nil, err
+			}
+			signed = append(signed, signature)
+			keySigned[i] = keySignatures
+		}
+	}
+
+	resp := &SignRootsResponse{Signatures: make([]*trillian.DigitallySigned, 0, len(signed))}
+	for i := range signed {
+		resp.Signatures = append(resp.Signatures, &signed[i])
+	}
+	for _, keySignatures := range keySigned {
+		if len(keySignatures) > 0 {
+			for _, k := range keySigned {
+				resp.KeySignatures = append(resp.KeySignatures, &RootKeySignatures{KeySignatures: k})
+			}
+			break
+		}
+	}
+	return resp, nil
+}
+
+// GetSignedTreeSizes implements SignerServer.
+func (s *Server) GetSignedTreeSizes(ctx context.Context, req *GetSignedTreeSizesRequest) (*GetSignedTreeSizesResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if len(req.LogIds) > MaxRootsPerRequest {
+		return nil, fmt.Errorf("%d logs is more than the limit of %d", len(req.LogIds), MaxRootsPerRequest)
+	}
+
+	signer, err := s.rootSigner()
+	if err != nil {
+		return nil, err
+	}
+	resp := &GetSignedTreeSizesResponse{Sizes: make([]*SignedTreeSizes, 0, len(req.LogIds))}
+	sizer, ok := signer.(treeSizer)
+	if !ok {
+		// Roots aren't checked for consistency, so no proofs are needed
+		for range req.LogIds {
+			resp.Sizes = append(resp.Sizes, &SignedTreeSizes{})
+		}
+		return resp, nil
+	}
+	sizes, err := sizer.SignedTreeSizes(req.LogIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sizes {
+		resp.Sizes = append(resp.Sizes, &SignedTreeSizes{TreeSizes: s})
+	}
+	return resp, nil
+}
+
+// GetPublicKey implements SignerServer.
+func (s *Server) GetPublicKey(ctx context.Context, req *GetPublicKeyRequest) (*GetPublicKeyResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	signer, err := s.keyManager.Signer()
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &GetPublicKeyResponse{PublicKey: der}, nil
+}
@@ -0,0 +1,558 @@
+// Code generated by protoc-gen-go.
+// source: github.com/google/trillian/signer/signer.proto
+// DO NOT EDIT!
+
+/*
+Package signer is a generated protocol buffer package.
+
+It is generated from these files:
+	github.com/google/trillian/signer/signer.proto
+
+It has these top-level messages:
+	ConsistencyProof
+	SignRootRequest
+	SignRootResponse
+	SignRootsRequest
+	RootConsistency
+	SignRootsResponse
+	RootKeySignatures
+	GetSignedTreeSizesRequest
+	SignedTreeSizes
+	GetSignedTreeSizesResponse
+	GetPublicKeyRequest
+	GetPublicKeyResponse
+	SignatureShare
+	ThresholdSignature
+*/
+package signer
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import trillian "github.com/google/trillian"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+// ConsistencyProof shows that a root is consistent with an earlier size of the
+// same log.
+type ConsistencyProof struct {
+	// The size of the earlier tree.
+	FirstTreeSize int64 `protobuf:"varint,1,opt,name=first_tree_size,json=firstTreeSize" json:"first_tree_size,omitempty"`
+	// The hashes of the proof, as served by GetConsistencyProof.
+	Hashes [][]byte `protobuf:"bytes,2,rep,name=hashes,proto3" json:"hashes,omitempty"`
+}
+
+func (m *ConsistencyProof) Reset()                    { *m = ConsistencyProof{} }
+func (m *ConsistencyProof) String() string            { return proto.CompactTextString(m) }
+func (*ConsistencyProof) ProtoMessage()               {}
+func (*ConsistencyProof) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+type SignRootRequest struct {
+	// The log root to sign. Its signature is ignored.
+	Root *trillian.SignedLogRoot `protobuf:"bytes,1,opt,name=root" json:"root,omitempty"`
+	// Proofs that the root is consistent with the roots the signer signed
+	// before, one from each of the sizes returned by GetSignedTreeSizes.
+	ConsistencyProofs []*ConsistencyProof `protobuf:"bytes,2,rep,name=consistency_proofs,json=consistencyProofs" json:"consistency_proofs,omitempty"`
+}
+
+func (m *SignRootRequest) Reset()                    { *m = SignRootRequest{} }
+func (m *SignRootRequest) String() string            { return proto.CompactTextString(m) }
+func (*SignRootRequest) ProtoMessage()               {}
+func (*SignRootRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *SignRootRequest) GetRoot() *trillian.SignedLogRoot {
+	if m != nil {
+		return m.Root
+	}
+	return nil
+}
+
+func (m *SignRootRequest) GetConsistencyProofs() []*ConsistencyProof {
+	if m != nil {
+		return m.ConsistencyProofs
+	}
+	return nil
+}
+
+type SignRootResponse struct {
+	Signature *trillian.DigitallySigned `protobuf:"bytes,1,opt,name=signature" json:"signature,omitempty"`
+	// Signatures of the root by the signer's keys that aren't active yet.
+	KeySignatures []*trillian.KeySignature `protobuf:"bytes,2,rep,name=key_signatures,json=keySignatures" json:"key_signatures,omitempty"`
+}
+
+func (m *SignRootResponse) Reset()                    { *m = SignRootResponse{} }
+func (m *SignRootResponse) String() string            { return proto.CompactTextString(m) }
+func (*SignRootResponse) ProtoMessage()               {}
+func (*SignRootResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *SignRootResponse) GetSignature() *trillian.DigitallySigned {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+func (m *SignRootResponse) GetKeySignatures() []*trillian.KeySignature {
+	if m != nil {
+		return m.KeySignatures
+	}
+	return nil
+}
+
+type SignRootsRequest struct {
+	// The log roots to sign, usually of different logs. Their signatures are
+	// ignored.
+	Roots []*trillian.SignedLogRoot `protobuf:"bytes,1,rep,name=roots" json:"roots,omitempty"`
+	// The consistency proofs for each root, in the same order as roots.
+	Consistency []*RootConsistency `protobuf:"bytes,2,rep,name=consistency" json:"consistency,omitempty"`
+}
+
+func (m *SignRootsRequest) Reset()                    { *m = SignRootsRequest{} }
+func (m *SignRootsRequest) String() string            { return proto.CompactTextString(m) }
+func (*SignRootsRequest) ProtoMessage()               {}
+func (*SignRootsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *SignRootsRequest) GetRoots() []*trillian.SignedLogRoot {
+	if m != nil {
+		return m.Roots
+	}
+	return nil
+}
+
+func (m *SignRootsRequest) GetConsistency() []*RootConsistency {
+	if m != nil {
+		return m.Consistency
+	}
+	return nil
+}
+
+// RootConsistency holds the proofs that a root is consistent with the roots
+// the signer signed before.
+type RootConsistency struct {
+	Proofs []*ConsistencyProof `protobuf:"bytes,1,rep,name=proofs" json:"proofs,omitempty"`
+}
+
+func (m *RootConsistency) Reset()                    { *m = RootConsistency{} }
+func (m *RootConsistency) String() string            { return proto.CompactTextString(m) }
+func (*RootConsistency) ProtoMessage()               {}
+func (*RootConsistency) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *RootConsistency) GetProofs() []*ConsistencyProof {
+	if m != nil {
+		return m.Proofs
+	}
+	return nil
+}
+
+type SignRootsResponse struct {
+	// The signatures of the roots, in the same order as the request.
+	Signatures []*trillian.DigitallySigned `protobuf:"bytes,1,rep,name=signatures" json:"signatures,omitempty"`
+	// The signatures of the roots by the signer's keys that aren't active yet,
+	// in the same order as the request. Empty if the signer has no such keys.
+	KeySignatures []*RootKeySignatures `protobuf:"bytes,2,rep,name=key_signatures,json=keySignatures" json:"key_signatures,omitempty"`
+}
+
+func (m *SignRootsResponse) Reset()                    { *m = SignRootsResponse{} }
+func (m *SignRootsResponse) String() string            { return proto.CompactTextString(m) }
+func (*SignRootsResponse) ProtoMessage()               {}
+func (*SignRootsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *SignRootsResponse) GetSignatures() []*trillian.DigitallySigned {
+	if m != nil {
+		return m.Signatures
+	}
+	return nil
+}
+
+func (m *SignRootsResponse) GetKeySignatures() []*RootKeySignatures {
+	if m != nil {
+		return m.KeySignatures
+	}
+	return nil
+}
+
+// RootKeySignatures holds the signatures of a root by keys that aren't active
+// yet.
+type RootKeySignatures struct {
+	KeySignatures []*trillian.KeySignature `protobuf:"bytes,1,rep,name=key_signatures,json=keySignatures" json:"key_signatures,omitempty"`
+}
+
+func (m *RootKeySignatures) Reset()                    { *m = RootKeySignatures{} }
+func (m *RootKeySignatures) String() string            { return proto.CompactTextString(m) }
+func (*RootKeySignatures) ProtoMessage()               {}
+func (*RootKeySignatures) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *RootKeySignatures) GetKeySignatures() []*trillian.KeySignature {
+	if m != nil {
+		return m.KeySignatures
+	}
+	return nil
+}
+
+type GetSignedTreeSizesRequest struct {
+	LogIds [][]byte `protobuf:"bytes,1,rep,name=log_ids,json=logIds,proto3" json:"log_ids,omitempty"`
+}
+
+func (m *GetSignedTreeSizesRequest) Reset()                    { *m = GetSignedTreeSizesRequest{} }
+func (m *GetSignedTreeSizesRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetSignedTreeSizesRequest) ProtoMessage()               {}
+func (*GetSignedTreeSizesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+// SignedTreeSizes holds the sizes of a log's trees that new roots must be
+// proven consistent with.
+type SignedTreeSizes struct {
+	TreeSizes []int64 `protobuf:"varint,1,rep,name=tree_sizes,json=treeSizes" json:"tree_sizes,omitempty"`
+}
+
+func (m *SignedTreeSizes) Reset()                    { *m = SignedTreeSizes{} }
+func (m *SignedTreeSizes) String() string            { return proto.CompactTextString(m) }
+func (*SignedTreeSizes) ProtoMessage()               {}
+func (*SignedTreeSizes) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+type GetSignedTreeSizesResponse struct {
+	// The sizes for each log, in the same order as the request. They're empty
+	// for logs that haven't had a root signed.
+	Sizes []*SignedTreeSizes `protobuf:"bytes,1,rep,name=sizes" json:"sizes,omitempty"`
+}
+
+func (m *GetSignedTreeSizesResponse) Reset()                    { *m = GetSignedTreeSizesResponse{} }
+func (m *GetSignedTreeSizesResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetSignedTreeSizesResponse) ProtoMessage()               {}
+func (*GetSignedTreeSizesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *GetSignedTreeSizesResponse) GetSizes() []*SignedTreeSizes {
+	if m != nil {
+		return m.Sizes
+	}
+	return nil
+}
+
+type GetPublicKeyRequest struct {
+}
+
+func (m *GetPublicKeyRequest) Reset()                    { *m = GetPublicKeyRequest{} }
+func (m *GetPublicKeyRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetPublicKeyRequest) ProtoMessage()               {}
+func (*GetPublicKeyRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+type GetPublicKeyResponse struct {
+	// The DER encoded public key that signatures can be verified with.
+	PublicKey []byte `protobuf:"bytes,1,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
+}
+
+func (m *GetPublicKeyResponse) Reset()                    { *m = GetPublicKeyResponse{} }
+func (m *GetPublicKeyResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetPublicKeyResponse) ProtoMessage()               {}
+func (*GetPublicKeyResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+// SignatureShare is the signature of one signer taking part in threshold
+// signing.
+type SignatureShare struct {
+	// The index of the signer's key in the set of keys that can make shares.
+	KeyIndex  int32                     `protobuf:"varint,1,opt,name=key_index,json=keyIndex" json:"key_index,omitempty"`
+	Signature *trillian.DigitallySigned `protobuf:"bytes,2,opt,name=signature" json:"signature,omitempty"`
+}
+
+func (m *SignatureShare) Reset()                    { *m = SignatureShare{} }
+func (m *SignatureShare) String() string            { return proto.CompactTextString(m) }
+func (*SignatureShare) ProtoMessage()               {}
+func (*SignatureShare) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+func (m *SignatureShare) GetSignature() *trillian.DigitallySigned {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+// ThresholdSignature is the signature of a root signed by several signers,
+// which is only valid if it holds valid shares from at least a threshold number
+// of them. It's serialized into the signature of a DigitallySigned using the
+// THRESHOLD algorithm.
+type ThresholdSignature struct {
+	// The shares, in increasing order of key index.
+	Shares []*SignatureShare `protobuf:"bytes,1,rep,name=shares" json:"shares,omitempty"`
+}
+
+func (m *ThresholdSignature) Reset()                    { *m = ThresholdSignature{} }
+func (m *ThresholdSignature) String() string            { return proto.CompactTextString(m) }
+func (*ThresholdSignature) ProtoMessage()               {}
+func (*ThresholdSignature) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+
+func (m *ThresholdSignature) GetShares() []*SignatureShare {
+	if m != nil {
+		return m.Shares
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*ConsistencyProof)(nil), "signer.ConsistencyProof")
+	proto.RegisterType((*SignRootRequest)(nil), "signer.SignRootRequest")
+	proto.RegisterType((*SignRootResponse)(nil), "signer.SignRootResponse")
+	proto.RegisterType((*SignRootsRequest)(nil), "signer.SignRootsRequest")
+	proto.RegisterType((*RootConsistency)(nil), "signer.RootConsistency")
+	proto.RegisterType((*SignRootsResponse)(nil), "signer.SignRootsResponse")
+	proto.RegisterType((*RootKeySignatures)(nil), "signer.RootKeySignatures")
+	proto.RegisterType((*GetSignedTreeSizesRequest)(nil), "signer.GetSignedTreeSizesRequest")
+	proto.RegisterType((*SignedTreeSizes)(nil), "signer.SignedTreeSizes")
+	proto.RegisterType((*GetSignedTreeSizesResponse)(nil), "signer.GetSignedTreeSizesResponse")
+	proto.RegisterType((*GetPublicKeyRequest)(nil), "signer.GetPublicKeyRequest")
+	proto.RegisterType((*GetPublicKeyResponse)(nil), "signer.GetPublicKeyResponse")
+	proto.RegisterType((*SignatureShare)(nil), "signer.SignatureShare")
+	proto.RegisterType((*ThresholdSignature)(nil), "signer.ThresholdSignature")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion3
+
+// Client API for Signer service
+
+type SignerClient interface {
+	// SignRoot signs a log root in the same way as the log server does when it
+	// holds the key itself.
+	SignRoot(ctx context.Context, in *SignRootRequest, opts ...grpc.CallOption) (*SignRootResponse, error)
+	// SignRoots signs several log roots in one request, so that a log server
+	// sequencing many logs makes fewer requests. Each root is still signed
+	// separately, there's no signature over the batch. It fails unless all the
+	// roots can be signed.
+	SignRoots(ctx context.Context, in *SignRootsRequest, opts ...grpc.CallOption) (*SignRootsResponse, error)
+	// GetSignedTreeSizes returns the sizes of the last roots signed for logs.
+	// A root of a larger tree is only signed with proofs that it's consistent
+	// with each of them, and a root of a smaller tree is never signed, so the
+	// signer can't be made to sign two views of a log that disagree.
+	GetSignedTreeSizes(ctx context.Context, in *GetSignedTreeSizesRequest, opts ...grpc.CallOption) (*GetSignedTreeSizesResponse, error)
+	// GetPublicKey returns the public key corresponding to the signing key.
+	GetPublicKey(ctx context.Context, in *GetPublicKeyRequest, opts ...grpc.CallOption) (*GetPublicKeyResponse, error)
+}
+
+type signerClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewSignerClient(cc *grpc.ClientConn) SignerClient {
+	return &signerClient{cc}
+}
+
+func (c *signerClient) SignRoot(ctx context.Context, in *SignRootRequest, opts ...grpc.CallOption) (*SignRootResponse, error) {
+	out := new(SignRootResponse)
+	err := grpc.Invoke(ctx, "/signer.Signer/SignRoot", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signerClient) SignRoots(ctx context.Context, in *SignRootsRequest, opts ...grpc.CallOption) (*SignRootsResponse, error) {
+	out := new(SignRootsResponse)
+	err := grpc.Invoke(ctx, "/signer.Signer/SignRoots", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signerClient) GetSignedTreeSizes(ctx context.Context, in *GetSignedTreeSizesRequest, opts ...grpc.CallOption) (*GetSignedTreeSizesResponse, error) {
+	out := new(GetSignedTreeSizesResponse)
+	err := grpc.Invoke(ctx, "/signer.Signer/GetSignedTreeSizes", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *signerClient) GetPublicKey(ctx context.Context, in *GetPublicKeyRequest, opts ...grpc.CallOption) (*GetPublicKeyResponse, error) {
+	out := new(GetPublicKeyResponse)
+	err := grpc.Invoke(ctx, "/signer.Signer/GetPublicKey", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Signer service
+
+type SignerServer interface {
+	// SignRoot signs a log root in the same way as the log server does when it
+	// holds the key itself.
+	SignRoot(context.Context, *SignRootRequest) (*SignRootResponse, error)
+	// SignRoots signs several log roots in one request, so that a log server
+	// sequencing many logs makes fewer requests. Each root is still signed
+	// separately, there's no signature over the batch. It fails unless all the
+	// roots can be signed.
+	SignRoots(context.Context, *SignRootsRequest) (*SignRootsResponse, error)
+	// GetSignedTreeSizes returns the sizes of the last roots signed for logs.
+	// A root of a larger tree is only signed with proofs that it's consistent
+	// with each of them, and a root of a smaller tree is never signed, so the
+	// signer can't be made to sign two views of a log that disagree.
+	GetSignedTreeSizes(context.Context, *GetSignedTreeSizesRequest) (*GetSignedTreeSizesResponse, error)
+	// GetPublicKey returns the public key corresponding to the signing key.
+	GetPublicKey(context.Context, *GetPublicKeyRequest) (*GetPublicKeyResponse, error)
+}
+
+func RegisterSignerServer(s *grpc.Server, srv SignerServer) {
+	s.RegisterService(&_Signer_serviceDesc, srv)
+}
+
+func _Signer_SignRoot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignRootRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignerServer).SignRoot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/signer.Signer/SignRoot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignerServer).SignRoot(ctx, req.(*SignRootRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Signer_SignRoots_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignRootsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignerServer).SignRoots(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/signer.Signer/SignRoots",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignerServer).SignRoots(ctx, req.(*SignRootsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Signer_GetSignedTreeSizes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSignedTreeSizesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignerServer).GetSignedTreeSizes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/signer.Signer/GetSignedTreeSizes",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignerServer).GetSignedTreeSizes(ctx, req.(*GetSignedTreeSizesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Signer_GetPublicKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPublicKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SignerServer).GetPublicKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/signer.Signer/GetPublicKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SignerServer).GetPublicKey(ctx, req.(*GetPublicKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Signer_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "signer.Signer",
+	HandlerType: (*SignerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SignRoot",
+			Handler:    _Signer_SignRoot_Handler,
+		},
+		{
+			MethodName: "SignRoots",
+			Handler:    _Signer_SignRoots_Handler,
+		},
+		{
+			MethodName: "GetSignedTreeSizes",
+			Handler:    _Signer_GetSignedTreeSizes_Handler,
+		},
+		{
+			MethodName: "GetPublicKey",
+			Handler:    _Signer_GetPublicKey_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: fileDescriptor0,
+}
+
+func init() { proto.RegisterFile("github.com/google/trillian/signer/signer.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 649 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x94, 0x55, 0xdf, 0x4f, 0x13, 0x41,
+	0x10, 0xf6, 0xa8, 0x9c, 0x74, 0x5a, 0x28, 0xac, 0x0a, 0x6d, 0x91, 0x04, 0xf7, 0xc1, 0xa0, 0x86,
+	0x83, 0xa0, 0xc6, 0xf0, 0x60, 0x34, 0x40, 0x42, 0x48, 0x7d, 0x68, 0xb6, 0xbc, 0x9a, 0xa6, 0xb4,
+	0xd3, 0xeb, 0xa6, 0xc7, 0x6d, 0xbd, 0xdd, 0x26, 0x1e, 0xf1, 0xdd, 0xc4, 0x27, 0xff, 0x1d, 0xff,
+	0x3b, 0x73, 0x3f, 0xf6, 0x6e, 0x7b, 0x2d, 0x55, 0x9f, 0x60, 0x66, 0xbe, 0x99, 0xf9, 0xe6, 0x9b,
+	0xd9, 0x1e, 0x38, 0x2e, 0x57, 0xa3, 0xe9, 0x8d, 0xd3, 0x17, 0xb7, 0x47, 0xae, 0x10, 0xae, 0x87,
+	0x47, 0x2a, 0xe0, 0x9e, 0xc7, 0x7b, 0xfe, 0x91, 0xe4, 0xae, 0x8f, 0x41, 0xfa, 0xc7, 0x99, 0x04,
+	0x42, 0x09, 0x62, 0x27, 0x56, 0xf3, 0xe5, 0x92, 0x3c, 0xfd, 0x4f, 0x92, 0x42, 0x19, 0x6c, 0x9e,
+	0x0b, 0x5f, 0x72, 0xa9, 0xd0, 0xef, 0x87, 0xed, 0x40, 0x88, 0x21, 0x79, 0x01, 0xb5, 0x21, 0x0f,
+	0xa4, 0xea, 0xaa, 0x00, 0xb1, 0x2b, 0xf9, 0x1d, 0xd6, 0xad, 0x7d, 0xeb, 0xa0, 0xc4, 0xd6, 0x63,
+	0xf7, 0x75, 0x80, 0xd8, 0xe1, 0x77, 0x48, 0xb6, 0xc1, 0x1e, 0xf5, 0xe4, 0x08, 0x65, 0x7d, 0x65,
+	0xbf, 0x74, 0x50, 0x65, 0xa9, 0x45, 0x7f, 0x58, 0x50, 0xeb, 0x70, 0xd7, 0x67, 0x42, 0x28, 0x86,
+	0x5f, 0xa7, 0x28, 0x15, 0x79, 0x0d, 0x0f, 0x03, 0x21, 0x54, 0x5c, 0xa8, 0x72, 0xb2, 0xe3, 0x64,
+	0x34, 0x22, 0x20, 0x0e, 0x3e, 0x0b, 0x37, 0x46, 0xc7, 0x20, 0x72, 0x09, 0xa4, 0x9f, 0x93, 0xea,
+	0x4e, 0x22, 0x56, 0x49, 0x93, 0xca, 0x49, 0xdd, 0x49, 0x47, 0x2e, 0xd2, 0x66, 0x5b, 0xfd, 0x82,
+	0x47, 0xd2, 0x9f, 0x16, 0x6c, 0xe6, 0x4c, 0xe4, 0x44, 0xf8, 0x12, 0xc9, 0x7b, 0x28, 0x47, 0x25,
+	0x7a, 0x6a, 0x1a, 0x60, 0xca, 0xa7, 0x91, 0xf3, 0xb9, 0xe0, 0x2e, 0x57, 0x3d, 0xcf, 0x0b, 0x13,
+	0x62, 0x2c, 0xc7, 0x92, 0x0f, 0xb0, 0x31, 0xc6, 0xb0, 0x9b, 0x39, 0x34, 0xa5, 0xed, 0x3c, 0xbb,
+	0x85, 0x61, 0x47, 0x87, 0xd9, 0xfa, 0xd8, 0xb0, 0x24, 0xfd, 0x9e, 0x73, 0x91, 0x5a, 0x96, 0x43,
+	0x58, 0x8d, 0x26, 0x96, 0x75, 0x6b, 0xbf, 0xb4, 0x4c, 0x97, 0x04, 0x45, 0x4e, 0xa1, 0x62, 0x0c,
+	0x99, 0xb6, 0xdf, 0xd1, 0x8a, 0x44, 0x48, 0x43, 0x15, 0x66, 0x62, 0xe9, 0x39, 0xd4, 0x0a, 0x71,
+	0x72, 0x0c, 0x76, 0x2a, 0xad, 0xf5, 0x17, 0x69, 0x53, 0x1c, 0xfd, 0x65, 0xc1, 0x96, 0x31, 0x43,
+	0x2a, 0xe8, 0x29, 0x80, 0xa1, 0x49, 0x52, 0x6b, 0x89, 0xa2, 0x06, 0x98, 0x7c, 0xba, 0x47, 0xd2,
+	0x86, 0x39, 0x93, 0x29, 0xaa, 0x2c, 0xaa, 0xca, 0x60, 0x6b, 0x0e, 0xb3, 0x60, 0x53, 0xd6, 0xff,
+	0x6c, 0xea, 0x2d, 0x34, 0x2e, 0x51, 0x25, 0x74, 0xf5, 0xb5, 0x67, 0x2b, 0xdb, 0x81, 0x47, 0x9e,
+	0x70, 0xbb, 0x7c, 0x90, 0x14, 0xad, 0x32, 0xdb, 0x13, 0xee, 0xd5, 0x40, 0xd2, 0x63, 0xa8, 0x15,
+	0x52, 0xc8, 0x1e, 0x40, 0xf6, 0x86, 0x12, 0x78, 0x89, 0x95, 0x95, 0x0e, 0xd3, 0x16, 0x34, 0x17,
+	0xf5, 0x49, 0x65, 0x3d, 0x84, 0xd5, 0x3c, 0xcf, 0x58, 0x73, 0x11, 0x9f, 0xa0, 0xe8, 0x53, 0x78,
+	0x7c, 0x89, 0xaa, 0x3d, 0xbd, 0xf1, 0x78, 0xbf, 0x85, 0x61, 0x4a, 0x97, 0xbe, 0x83, 0x27, 0xb3,
+	0xee, 0xb4, 0xfa, 0x1e, 0xc0, 0x24, 0x76, 0x76, 0xc7, 0x18, 0xc6, 0xcf, 0xa0, 0xca, 0xca, 0x13,
+	0x0d, 0xa3, 0x43, 0xd8, 0xc8, 0x04, 0xe9, 0x8c, 0x7a, 0x01, 0x92, 0x5d, 0x28, 0x47, 0x9a, 0x72,
+	0x7f, 0x80, 0xdf, 0x62, 0xfc, 0x2a, 0x5b, 0x1b, 0x63, 0x78, 0x15, 0xd9, 0xb3, 0x6f, 0x6a, 0xe5,
+	0xdf, 0xdf, 0x14, 0xbd, 0x00, 0x72, 0x3d, 0x0a, 0x50, 0x8e, 0x84, 0x37, 0xc8, 0x1a, 0x12, 0x07,
+	0x6c, 0x19, 0x35, 0xcd, 0xf7, 0x66, 0xcc, 0x9e, 0x73, 0x62, 0x29, 0xea, 0xe4, 0xf7, 0x0a, 0xd8,
+	0x71, 0xed, 0x80, 0x7c, 0x84, 0x35, 0x7d, 0xa1, 0x64, 0x46, 0x32, 0xe3, 0xd7, 0xa8, 0x59, 0x9f,
+	0x0f, 0x24, 0xb2, 0xd0, 0x07, 0xe4, 0x0c, 0xca, 0xda, 0x2b, 0xc9, 0x1c, 0x50, 0x9f, 0x41, 0xb3,
+	0xb1, 0x20, 0x92, 0xd5, 0xf8, 0x02, 0x64, 0x7e, 0xb1, 0xe4, 0xb9, 0x4e, 0xb9, 0xf7, 0xb8, 0x9a,
+	0x74, 0x19, 0x24, 0x2b, 0xdf, 0x82, 0xaa, 0xb9, 0x53, 0xb2, 0x6b, 0x64, 0x15, 0x0f, 0xa0, 0xf9,
+	0x6c, 0x71, 0x50, 0x17, 0x3b, 0x7b, 0x05, 0x8d, 0xbe, 0xb8, 0x75, 0x92, 0xef, 0x84, 0x33, 0xfb,
+	0x79, 0x38, 0xab, 0x24, 0xaa, 0xb6, 0x23, 0xa3, 0x6d, 0xdd, 0xd8, 0xb1, 0xf7, 0xcd, 0x9f, 0x01,
+	0x00, 0xb0, 0x3b, 0x99, 0x32, 0x99, 0x06, 0x00, 0x00,
+}
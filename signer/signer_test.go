@@ -0,0 +1,336 @@
+package signer
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/auth"
+	"github.com/google/trillian/crypto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+)
+
+// recordingSigner signs with an ECDSA key and records the digests it signs.
+type recordingSigner struct {
+	key     *ecdsa.PrivateKey
+	mu      sync.Mutex
+	digests [][]byte
+}
+
+func (r *recordingSigner) Public() gocrypto.PublicKey {
+	return r.key.Public()
+}
+
+func (r *recordingSigner) Sign(rand io.Reader, digest []byte, opts gocrypto.SignerOpts) ([]byte, error) {
+	r.mu.Lock()
+	r.digests = append(r.digests, digest)
+	r.mu.Unlock()
+	return r.key.Sign(rand, digest, opts)
+}
+
+// signerKeyManager is a KeyManager that only provides a Signer.
+type signerKeyManager struct {
+	signer gocrypto.Signer
+}
+
+func (k signerKeyManager) Signer() (gocrypto.Signer, error) {
+	return k.signer, nil
+}
+
+func (k signerKeyManager) GetPublicKey() (gocrypto.PublicKey, error) {
+	return nil, errors.New("not loaded")
+}
+
+func (k signerKeyManager) GetRawPublicKey() ([]byte, error) {
+	return nil, errors.New("not loaded")
+}
+
+// testCA issues the certificates used by the tests, writing them and their
+// keys to PEM files in dir.
+type testCA struct {
+	t    *testing.T
+	dir  string
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestCA(t *testing.T, dir string) *testCA {
+	ca := &testCA{t: t, dir: dir}
+	ca.key, ca.cert = ca.issue("ca", "Test CA", nil)
+	return ca
+}
+
+// issue creates a certificate for commonName, signed by the CA or self-signed
+// if the CA hasn't been created yet, and writes it to name.crt and name.key.
+func (ca *testCA) issue(name, commonName string, ips []net.IP) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		ca.t.Fatalf("GenerateKey failed: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  ips,
+	}
+	parent, parentKey := template, key
+	if ca.cert == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		parent, parentKey = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		ca.t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		ca.t.Fatalf("ParseCertificate failed: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		ca.t.Fatalf("MarshalECPrivateKey failed: %v", err)
+	}
+	ca.write(name+".crt", "CERTIFICATE", der)
+	ca.write(name+".key", "EC PRIVATE KEY", keyDER)
+	return key, cert
+}
+
+func (ca *testCA) write(name, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := ioutil.WriteFile(filepath.Join(ca.dir, name), data, 0600); err != nil {
+		ca.t.Fatalf("WriteFile failed: %v", err)
+	}
+}
+
+func (ca *testCA) path(name string) string {
+	return filepath.Join(ca.dir, name)
+}
+
+// startServer runs a signing service for rs, which only allows the client
+// named "log-server".
+func startServer(t *testing.T, ca *testCA, rs *recordingSigner) (string, func()) {
+	return startSignerServer(t, ca, NewServer(signerKeyManager{rs}, trillian.NewSHA256(), []string{"log-server"}))
+}
+
+// startSignerServer runs the signing service signer.
+func startSignerServer(t *testing.T, ca *testCA, signer *Server) (string, func()) {
+	ca.issue("server", "signer", []net.IP{net.ParseIP("127.0.0.1")})
+	config, err := auth.ServerTLSConfig(ca.path("server.crt"), ca.path("server.key"), ca.path("ca.crt"), true)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig failed: %v", err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(config)))
+	RegisterSignerServer(s, signer)
+	go s.Serve(lis)
+	return lis.Addr().String(), s.Stop
+}
+
+func dialAs(t *testing.T, ca *testCA, addr, clientName string) *grpc.ClientConn {
+	ca.issue(clientName, clientName, nil)
+	config, err := auth.ClientTLSConfig(ca.path(clientName+".crt"), ca.path(clientName+".key"), ca.path("ca.crt"))
+	if err != nil {
+		t.Fatalf("ClientTLSConfig failed: %v", err)
+	}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	return conn
+}
+
+func TestSignRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signer")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	rs := &recordingSigner{key: key}
+	ca := newTestCA(t, dir)
+	addr, stop := startServer(t, ca, rs)
+	defer stop()
+
+	conn := dialAs(t, ca, addr, "log-server")
+	defer conn.Close()
+	client := NewClient(conn, 10*time.Second)
+
+	root := trillian.SignedLogRoot{TimestampNanos: 1000, RootHash: []byte("root"), TreeSize: 42, LogId: []byte("log")}
+	signature, err := client.SignLogRoot(root)
+	if err != nil {
+		t.Fatalf("SignLogRoot failed: %v", err)
+	}
+	if signature.SignatureAlgorithm != trillian.SignatureAlgorithm_ECDSA || len(signature.Signature) == 0 {
+		t.Fatalf("SignLogRoot returned unexpected signature %v", signature)
+	}
+
+	// The root is hashed in the same way as when the key is held locally
+	if _, err := crypto.NewTrillianSigner(trillian.NewSHA256(), trillian.SignatureAlgorithm_ECDSA, rs).SignLogRoot(root); err != nil {
+		t.Fatalf("local SignLogRoot failed: %v", err)
+	}
+	if len(rs.digests) != 2 || !bytes.Equal(rs.digests[0], rs.digests[1]) {
+		t.Fatalf("Remote and local signers signed different digests: %x", rs.digests)
+	}
+
+	// Roots signed together are hashed in the same way
+	roots := []trillian.SignedLogRoot{root, {TimestampNanos: 2000, RootHash: []byte("other"), TreeSize: 7, LogId: []byte("other")}}
+	signatures, err := client.SignLogRoots(roots)
+	if err != nil {
+		t.Fatalf("SignLogRoots failed: %v", err)
+	}
+	if len(signatures) != 2 || len(rs.digests) != 4 || !bytes.Equal(rs.digests[0], rs.digests[2]) || bytes.Equal(rs.digests[2], rs.digests[3]) {
+		t.Fatalf("SignLogRoots returned %d signatures of digests %x", len(signatures), rs.digests[2:])
+	}
+
+	pub, err := client.PublicKey(context.Background())
+	if err != nil {
+		t.Fatalf("PublicKey failed: %v", err)
+	}
+	if !reflect.DeepEqual(pub, key.Public()) {
+		t.Fatalf("PublicKey returned %v, want %v", pub, key.Public())
+	}
+}
+
+func TestSignRootWithNextKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signer")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var signers []*recordingSigner
+	for i := 0; i < 2; i++ {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("GenerateKey failed: %v", err)
+		}
+		signers = append(signers, &recordingSigner{key: key})
+	}
+	current, next := signers[0], signers[1]
+	s := NewServer(signerKeyManager{current}, trillian.NewSHA256(), nil)
+	s.SetNextKey("next", signerKeyManager{next})
+	ca := newTestCA(t, dir)
+	addr, stop := startSignerServer(t, ca, s)
+	defer stop()
+
+	conn := dialAs(t, ca, addr, "log-server")
+	defer conn.Close()
+	client := NewClient(conn, 10*time.Second)
+
+	root := trillian.SignedLogRoot{TimestampNanos: 1000, RootHash: []byte("root"), TreeSize: 42, LogId: []byte("log")}
+	signature, err := client.SignLogRoot(root)
+	if err != nil {
+		t.Fatalf("SignLogRoot failed: %v", err)
+	}
+	if err := crypto.VerifyLogRoot(current.Public(), trillian.NewSHA256(), root, signature); err != nil {
+		t.Errorf("SignLogRoot signed with the wrong key: %v", err)
+	}
+	// The key signatures come with the signature, so aren't asked for again
+	keySignatures, err := client.KeySignLogRoot(root)
+	if err != nil {
+		t.Fatalf("KeySignLogRoot failed: %v", err)
+	}
+	if len(keySignatures) != 1 || keySignatures[0].KeyId != "next" || keySignatures[0].Signature == nil {
+		t.Fatalf("KeySignLogRoot()=%v, want one signature by next", keySignatures)
+	}
+	if err := crypto.VerifyLogRoot(next.Public(), trillian.NewSHA256(), root, *keySignatures[0].Signature); err != nil {
+		t.Errorf("KeySignLogRoot signed with the wrong key: %v", err)
+	}
+	if got := len(next.digests); got != 1 {
+		t.Errorf("next key signed %d digests, want 1", got)
+	}
+
+	roots := []trillian.SignedLogRoot{root, {TimestampNanos: 2000, RootHash: []byte("other"), TreeSize: 7, LogId: []byte("other")}}
+	if _, err := client.SignLogRoots(roots); err != nil {
+		t.Fatalf("SignLogRoots failed: %v", err)
+	}
+	for _, r := range roots {
+		if keySignatures, err := client.KeySignLogRoot(r); err != nil || len(keySignatures) != 1 {
+			t.Errorf("KeySignLogRoot() after SignLogRoots=%v, %v, want one signature", keySignatures, err)
+		}
+	}
+	if got := len(next.digests); got != 3 {
+		t.Errorf("next key signed %d digests, want 3", got)
+	}
+
+	// A root that wasn't signed before is sent to be signed
+	other := trillian.SignedLogRoot{TimestampNanos: 3000, RootHash: []byte("root"), TreeSize: 43, LogId: []byte("log")}
+	if keySignatures, err := client.KeySignLogRoot(other); err != nil || len(keySignatures) != 1 {
+		t.Errorf("KeySignLogRoot(unsigned root)=%v, %v, want one signature", keySignatures, err)
+	}
+}
+
+func TestSignRootRejectsClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signer")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	rs := &recordingSigner{key: key}
+	ca := newTestCA(t, dir)
+	addr, stop := startServer(t, ca, rs)
+	defer stop()
+
+	// A client with a valid certificate that isn't allowed
+	conn := dialAs(t, ca, addr, "other")
+	defer conn.Close()
+	if _, err := NewClient(conn, 10*time.Second).SignLogRoot(trillian.SignedLogRoot{}); grpc.Code(err) != codes.PermissionDenied {
+		t.Fatalf("SignLogRoot by other client returned %v, want PermissionDenied", err)
+	}
+
+	// A client without a certificate can't connect at all
+	config, err := auth.ClientTLSConfig(ca.path("other.crt"), ca.path("other.key"), ca.path("ca.crt"))
+	if err != nil {
+		t.Fatalf("ClientTLSConfig failed: %v", err)
+	}
+	config.Certificates = nil
+	anonymous, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer anonymous.Close()
+	if _, err := NewClient(anonymous, 10*time.Second).SignLogRoot(trillian.SignedLogRoot{}); err == nil {
+		t.Fatalf("SignLogRoot without a client certificate succeeded")
+	}
+
+	if len(rs.digests) != 0 {
+		t.Fatalf("Signer signed %d digests for rejected clients", len(rs.digests))
+	}
+}
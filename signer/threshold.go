@@ -0,0 +1,286 @@
+package signer
+
+import (
+	gocrypto "crypto"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+)
+
+// ThresholdSigner signs roots under a t-of-n threshold scheme. It asks each of
+// n signers, usually separate signing services each holding their own key, to
+// sign a root, and combines the first t valid signatures into a
+// ThresholdSignature. No single signer can then produce a root that verifiers
+// accept on its own. Where the signers are signing services, they should sign
+// with their own key only, rather than coordinate threshold signing themselves.
+type ThresholdSigner struct {
+	// signers[i] signs with the private key for keys[i]
+	signers   []crypto.LogRootSigner
+	keys      []gocrypto.PublicKey
+	threshold int
+	hasher    trillian.Hasher
+}
+
+// NewThresholdSigner creates a ThresholdSigner which needs threshold of the
+// signers to sign each root. The shares are checked against keys, which holds
+// the public key of each signer.
+func NewThresholdSigner(signers []crypto.LogRootSigner, keys []gocrypto.PublicKey, threshold int, hasher trillian.Hasher) (*ThresholdSigner, error) {
+	if len(signers) != len(keys) {
+		return nil, fmt.Errorf("got %d signers but %d keys", len(signers), len(keys))
+	}
+	if threshold < 1 || threshold > len(signers) {
+		return nil, fmt.Errorf("threshold %d must be between 1 and the number of signers %d", threshold, len(signers))
+	}
+	return &ThresholdSigner{signers: signers, keys: keys, threshold: threshold, hasher: hasher}, nil
+}
+
+// signerResult holds the signatures a signer made for a batch of roots.
+type signerResult struct {
+	index      int
+	signatures []trillian.DigitallySigned
+	err        error
+}
+
+// signAll asks every signer to sign roots, in batches where they support it,
+// passing on the consistency proofs to the signers that check them. The
+// results are sent to the returned channel as they arrive.
+func (t *ThresholdSigner) signAll(roots []trillian.SignedLogRoot, proofs []crypto.ConsistencyProofFunc) <-chan signerResult {
+	// Buffered so signers still working after the threshold is reached don't block
+	results := make(chan signerResult, len(t.signers))
+	for i, s := range t.signers {
+		go func(i int, s crypto.LogRootSigner) {
+			if b, ok := s.(crypto.LogRootBatchSigner); ok && len(roots) > 1 {
+				var signatures []trillian.DigitallySigned
+				var err error
+				if c, ok := s.(crypto.LogRootBatchConsistencySigner); ok {
+					signatures, err = c.SignLogRootsConsistent(roots, proofs)
+				} else {
+					signatures, err = b.SignLogRoots(roots)
+				}
+				if err == nil && len(signatures) != len(roots) {
+					err = fmt.Errorf("got %d signatures for %d roots", len(signatures), len(roots))
+				}
+				results <- signerResult{index: i, signatures: signatures, err: err}
+				return
+			}
+			signatures := make([]trillian.DigitallySigned, 0, len(roots))
+			for j, root := range roots {
+				var signature trillian.DigitallySigned
+				var err error
+				if c, ok := s.(crypto.LogRootConsistencySigner); ok {
+					signature, err = c.SignLogRootConsistent(root, proofs[j])
+				} else {
+					signature, err = s.SignLogRoot(root)
+				}
+				if err != nil {
+					results <- signerResult{index: i, err: err}
+					return
+				}
+				signatures = append(signatures, signature)
+			}
+			results <- signerResult{index: i, signatures: signatures}
+		}(i, s)
+	}
+	return results
+}
+
+// SignLogRoots signs roots, returning a threshold signature for each of them.
+// It returns as soon as enough signers have made valid signatures of every
+// root, and fails if too few can.
+func (t *ThresholdSigner) SignLogRoots(roots []trillian.SignedLogRoot) ([]trillian.DigitallySigned, error) {
+	return t.SignLogRootsConsistent(roots, make([]crypto.ConsistencyProofFunc, len(roots)))
+}
+
+// SignLogRootsConsistent is like SignLogRoots, but passes proofs on to the
+// signers that only sign roots consistent with those they signed before.
+// proofs holds the proof function for each root.
+func (t *ThresholdSigner) SignLogRootsConsistent(roots []trillian.SignedLogRoot, proofs []crypto.ConsistencyProofFunc) ([]trillian.DigitallySigned, error) {
+	if len(proofs) != len(roots) {
+		return nil, fmt.Errorf("got %d consistency proofs for %d roots", len(proofs), len(roots))
+	}
+	shares := make([][]*SignatureShare, len(roots))
+	succeeded, failed := 0, 0
+	results := t.signAll(roots, proofs)
+	for succeeded < t.threshold {
+		r := <-results
+		if err := t.check(r, roots); err != nil {
+			glog.Warningf("Signer %d failed to sign %d roots: %v", r.index, len(roots), err)
+			failed++
+			if len(t.signers)-failed < t.threshold {
+				return nil, fmt.Errorf("only %d of %d signers could sign, %d are needed", len(t.signers)-failed, len(t.signers), t.threshold)
+			}
+			continue
+		}
+		for i := range roots {
+			signature := r.signatures[i]
+			shares[i] = append(shares[i], &SignatureShare{KeyIndex: int32(r.index), Signature: &signature})
+		}
+		succeeded++
+	}
+
+	signatures := make([]trillian.DigitallySigned, 0, len(roots))
+	for _, s := range shares {
+		signature, err := combineShares(s, t.hasher)
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, signature)
+	}
+	return signatures, nil
+}
+
+// check returns an error unless r holds a valid signature of every root. A
+// signature that doesn't verify could come from a faulty or compromised
+// signer, so none of its signatures are used.
+func (t *ThresholdSigner) check(r signerResult, roots []trillian.SignedLogRoot) error {
+	if r.err != nil {
+		return r.err
+	}
+	for i, signature := range r.signatures {
+		if err := crypto.VerifyLogRoot(t.keys[r.index], t.hasher, roots[i], signature); err != nil {
+			return fmt.Errorf("invalid signature: %v", err)
+		}
+	}
+	return nil
+}
+
+// SignLogRoot signs root, returning a threshold signature.
+func (t *ThresholdSigner) SignLogRoot(root trillian.SignedLogRoot) (trillian.DigitallySigned, error) {
+	signatures, err := t.SignLogRoots([]trillian.SignedLogRoot{root})
+	if err != nil {
+		return trillian.DigitallySigned{}, err
+	}
+	return signatures[0], nil
+}
+
+// SignLogRootConsistent is like SignLogRoot, but passes proof on to the
+// signers that only sign roots consistent with those they signed before.
+func (t *ThresholdSigner) SignLogRootConsistent(root trillian.SignedLogRoot, proof crypto.ConsistencyProofFunc) (trillian.DigitallySigned, error) {
+	signatures, err := t.SignLogRootsConsistent([]trillian.SignedLogRoot{root}, []crypto.ConsistencyProofFunc{proof})
+	if err != nil {
+		return trillian.DigitallySigned{}, err
+	}
+	return signatures[0], nil
+}
+
+// KeySignLogRoot returns the signatures of root by the keys of each signer
+// that aren't active yet, from the signers that are crypto.LogRootKeySigners.
+// A signer that fails is left out, as it could fail to sign the root too.
+func (t *ThresholdSigner) KeySignLogRoot(root trillian.SignedLogRoot) ([]*trillian.KeySignature, error) {
+	var keySignatures []*trillian.KeySignature
+	for i, s := range t.signers {
+		k, ok := s.(crypto.LogRootKeySigner)
+		if !ok {
+			continue
+		}
+		signatures, err := k.KeySignLogRoot(root)
+		if err != nil {
+			glog.Warningf("Signer %d failed to sign root with its pending keys: %v", i, err)
+			continue
+		}
+		keySignatures = append(keySignatures, signatures...)
+	}
+	return keySignatures, nil
+}
+
+// SignedTreeSizes returns, for each of logIDs, the sizes of the last roots
+// signed by any of the signers, which new roots must be proven consistent
+// with. A signer that can't be asked is left out, as it couldn't sign either.
+func (t *ThresholdSigner) SignedTreeSizes(logIDs [][]byte) ([][]int64, error) {
+	seen := make([]map[int64]bool, len(logIDs))
+	sizes := make([][]int64, len(logIDs))
+	for i, s := range t.signers {
+		sizer, ok := s.(treeSizer)
+		if !ok {
+			continue
+		}
+		signerSizes, err := sizer.SignedTreeSizes(logIDs)
+		if err == nil && len(signerSizes) != len(logIDs) {
+			err = fmt.Errorf("got sizes for %d logs, asked for %d", len(signerSizes), len(logIDs))
+		}
+		if err != nil {
+			glog.Warningf("Failed to get signed tree sizes from signer %d: %v", i, err)
+			continue
+		}
+		for j, logSizes := range signerSizes {
+			for _, size := range logSizes {
+				if seen[j] == nil {
+					seen[j] = make(map[int64]bool)
+				}
+				if !seen[j][size] {
+					seen[j][size] = true
+					sizes[j] = append(sizes[j], size)
+				}
+			}
+		}
+	}
+	return sizes, nil
+}
+
+// combineShares serializes shares into the signature of a DigitallySigned.
+func combineShares(shares []*SignatureShare, hasher trillian.Hasher) (trillian.DigitallySigned, error) {
+	sort.Sort(byKeyIndex(shares))
+	data, err := proto.Marshal(&ThresholdSignature{Shares: shares})
+	if err != nil {
+		return trillian.DigitallySigned{}, err
+	}
+	return trillian.DigitallySigned{
+		SignatureAlgorithm: trillian.SignatureAlgorithm_THRESHOLD,
+		HashAlgorithm:      hasher.HashAlgorithm(),
+		Signature:          data,
+	}, nil
+}
+
+type byKeyIndex []*SignatureShare
+
+func (b byKeyIndex) Len() int           { return len(b) }
+func (b byKeyIndex) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byKeyIndex) Less(i, j int) bool { return b[i].KeyIndex < b[j].KeyIndex }
+
+// ThresholdVerifier checks the threshold signatures of roots.
+type ThresholdVerifier struct {
+	keys      []gocrypto.PublicKey
+	threshold int
+	hasher    trillian.Hasher
+}
+
+// NewThresholdVerifier creates a ThresholdVerifier which accepts signatures
+// holding valid shares made with at least threshold of keys.
+func NewThresholdVerifier(keys []gocrypto.PublicKey, threshold int, hasher trillian.Hasher) (*ThresholdVerifier, error) {
+	if threshold < 1 || threshold > len(keys) {
+		return nil, fmt.Errorf("threshold %d must be between 1 and the number of keys %d", threshold, len(keys))
+	}
+	return &ThresholdVerifier{keys: keys, threshold: threshold, hasher: hasher}, nil
+}
+
+// VerifyLogRoot checks that sig is a threshold signature of root.
+func (v *ThresholdVerifier) VerifyLogRoot(root trillian.SignedLogRoot, sig trillian.DigitallySigned) error {
+	if sig.SignatureAlgorithm != trillian.SignatureAlgorithm_THRESHOLD {
+		return fmt.Errorf("signature algorithm %v isn't THRESHOLD", sig.SignatureAlgorithm)
+	}
+	var ts ThresholdSignature
+	if err := proto.Unmarshal(sig.Signature, &ts); err != nil {
+		return fmt.Errorf("malformed threshold signature: %v", err)
+	}
+
+	// Each key only counts once, however many shares it made
+	valid := make(map[int32]bool)
+	for _, share := range ts.Shares {
+		if share.KeyIndex < 0 || int(share.KeyIndex) >= len(v.keys) || share.Signature == nil {
+			return errors.New("malformed signature share")
+		}
+		if err := crypto.VerifyLogRoot(v.keys[share.KeyIndex], v.hasher, root, *share.Signature); err != nil {
+			return fmt.Errorf("invalid signature share for key %d: %v", share.KeyIndex, err)
+		}
+		valid[share.KeyIndex] = true
+	}
+	if len(valid) < v.threshold {
+		return fmt.Errorf("signature has shares from %d keys, %d are needed", len(valid), v.threshold)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package signer
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+)
+
+// failingRootSigner fails to sign every root.
+type failingRootSigner struct{}
+
+func (failingRootSigner) SignLogRoot(root trillian.SignedLogRoot) (trillian.DigitallySigned, error) {
+	return trillian.DigitallySigned{}, errors.New("signer unavailable")
+}
+
+// newTestSigners creates n signers with their own keys.
+func newTestSigners(t *testing.T, n int) ([]crypto.LogRootSigner, []gocrypto.PublicKey) {
+	var signers []crypto.LogRootSigner
+	var keys []gocrypto.PublicKey
+	for i := 0; i < n; i++ {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("GenerateKey failed: %v", err)
+		}
+		signers = append(signers, crypto.NewTrillianSigner(trillian.NewSHA256(), trillian.SignatureAlgorithm_ECDSA, key))
+		keys = append(keys, key.Public())
+	}
+	return signers, keys
+}
+
+func TestThresholdSigning(t *testing.T) {
+	hasher := trillian.NewSHA256()
+	signers, keys := newTestSigners(t, 3)
+	// One signer is down, and another signs with the wrong key
+	wrong, _ := newTestSigners(t, 1)
+	signers[0], signers[2] = failingRootSigner{}, wrong[0]
+
+	root := trillian.SignedLogRoot{TimestampNanos: 1000, RootHash: []byte("root"), TreeSize: 42}
+	ts, err := NewThresholdSigner(signers, keys, 2, hasher)
+	if err != nil {
+		t.Fatalf("NewThresholdSigner failed: %v", err)
+	}
+	if _, err := ts.SignLogRoot(root); err == nil {
+		t.Fatalf("SignLogRoot succeeded with only one good signer")
+	}
+
+	// With a good second signer there are enough shares
+	good, goodKeys := newTestSigners(t, 1)
+	signers[2], keys[2] = good[0], goodKeys[0]
+	ts, err = NewThresholdSigner(signers, keys, 2, hasher)
+	if err != nil {
+		t.Fatalf("NewThresholdSigner failed: %v", err)
+	}
+	sig, err := ts.SignLogRoot(root)
+	if err != nil {
+		t.Fatalf("SignLogRoot failed: %v", err)
+	}
+
+	v, err := NewThresholdVerifier(keys, 2, hasher)
+	if err != nil {
+		t.Fatalf("NewThresholdVerifier failed: %v", err)
+	}
+	if err := v.VerifyLogRoot(root, sig); err != nil {
+		t.Fatalf("VerifyLogRoot failed: %v", err)
+	}
+	changed := root
+	changed.RootHash = []byte("fork")
+	if err := v.VerifyLogRoot(changed, sig); err == nil {
+		t.Fatalf("VerifyLogRoot accepted the signature for a different root")
+	}
+
+	// Two shares aren't enough when all three are needed
+	v, err = NewThresholdVerifier(keys, 3, hasher)
+	if err != nil {
+		t.Fatalf("NewThresholdVerifier failed: %v", err)
+	}
+	if err := v.VerifyLogRoot(root, sig); err == nil {
+		t.Fatalf("VerifyLogRoot accepted 2 shares with a threshold of 3")
+	}
+}
+
+func TestThresholdSigningBatch(t *testing.T) {
+	hasher := trillian.NewSHA256()
+	signers, keys := newTestSigners(t, 3)
+	ts, err := NewThresholdSigner(signers, keys, 3, hasher)
+	if err != nil {
+		t.Fatalf("NewThresholdSigner failed: %v", err)
+	}
+
+	roots := []trillian.SignedLogRoot{{TreeSize: 1, RootHash: []byte("one")}, {TreeSize: 2, RootHash: []byte("two")}}
+	sigs, err := ts.SignLogRoots(roots)
+	if err != nil {
+		t.Fatalf("SignLogRoots failed: %v", err)
+	}
+	v, err := NewThresholdVerifier(keys, 3, hasher)
+	if err != nil {
+		t.Fatalf("NewThresholdVerifier failed: %v", err)
+	}
+	for i, root := range roots {
+		if err := v.VerifyLogRoot(root, sigs[i]); err != nil {
+			t.Errorf("VerifyLogRoot(%d) failed: %v", i, err)
+		}
+	}
+	// The signatures aren't interchangeable
+	if err := v.VerifyLogRoot(roots[0], sigs[1]); err == nil {
+		t.Errorf("VerifyLogRoot accepted the signature of another root")
+	}
+}
+
+func TestThresholdVerifierRejectsSingleSignature(t *testing.T) {
+	hasher := trillian.NewSHA256()
+	signers, keys := newTestSigners(t, 2)
+	root := trillian.SignedLogRoot{TreeSize: 1, RootHash: []byte("one")}
+	sig, err := signers[0].SignLogRoot(root)
+	if err != nil {
+		t.Fatalf("SignLogRoot failed: %v", err)
+	}
+	v, err := NewThresholdVerifier(keys, 1, hasher)
+	if err != nil {
+		t.Fatalf("NewThresholdVerifier failed: %v", err)
+	}
+	if err := v.VerifyLogRoot(root, sig); err == nil {
+		t.Fatalf("VerifyLogRoot accepted an ordinary signature")
+	}
+}
+
+func TestNewThresholdSignerValidates(t *testing.T) {
+	signers, keys := newTestSigners(t, 2)
+	for _, threshold := range []int{0, 3} {
+		if _, err := NewThresholdSigner(signers, keys, threshold, trillian.NewSHA256()); err == nil {
+			t.Errorf("NewThresholdSigner(threshold %d) succeeded", threshold)
+		}
+	}
+	if _, err := NewThresholdSigner(signers, keys[:1], 1, trillian.NewSHA256()); err == nil {
+		t.Errorf("NewThresholdSigner succeeded with too few keys")
+	}
+}
+
+func TestThresholdSignerKeySigns(t *testing.T) {
+	signers, keys := newTestSigners(t, 3)
+	next, nextKeys := newTestSigners(t, 1)
+	// One signer is moving to a new key, and another is down
+	signers[0] = NewRotatingSigner(signers[0], "next", next[0])
+	signers[2] = failingRotatingSigner()
+	ts, err := NewThresholdSigner(signers, keys, 2, trillian.NewSHA256())
+	if err != nil {
+		t.Fatalf("NewThresholdSigner failed: %v", err)
+	}
+
+	root := trillian.SignedLogRoot{TimestampNanos: 1000, RootHash: []byte("root"), TreeSize: 42}
+	keySignatures, err := ts.KeySignLogRoot(root)
+	if err != nil {
+		t.Fatalf("KeySignLogRoot failed: %v", err)
+	}
+	if len(keySignatures) != 1 || keySignatures[0].KeyId != "next" || keySignatures[0].Signature == nil {
+		t.Fatalf("KeySignLogRoot()=%v, want one signature by next", keySignatures)
+	}
+	if err := crypto.VerifyLogRoot(nextKeys[0], trillian.NewSHA256(), root, *keySignatures[0].Signature); err != nil {
+		t.Errorf("KeySignLogRoot signed with the wrong key: %v", err)
+	}
+}
+
+// failingRotatingSigner returns a RotatingSigner that fails to sign.
+func failingRotatingSigner() *RotatingSigner {
+	return NewRotatingSigner(failingRootSigner{}, "failing", failingRootSigner{})
+}
@@ -0,0 +1,284 @@
+// Package archive moves the data for pruned map revisions out of hot storage
+// into compressed segments held in an ObjectStore, and can temporarily restore
+// it so that old revisions can be read again, for example by an auditor.
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util"
+)
+
+// Archiver archives and restores map revisions which have been pruned by the
+// revision garbage collector.
+type Archiver struct {
+	store      ObjectStore
+	timeSource util.TimeSource
+}
+
+// NewArchiver creates a new Archiver which writes segments to store and uses
+// timeSource to decide when restored revisions have expired.
+func NewArchiver(store ObjectStore, timeSource util.TimeSource) *Archiver {
+	return &Archiver{store: store, timeSource: timeSource}
+}
+
+// segmentName returns the name of the object a map revision is archived in.
+func segmentName(treeID, revision int64) string {
+	return fmt.Sprintf("map-%d-rev-%d.seg.gz", treeID, revision)
+}
+
+func encodeSegment(segment *storage.ArchiveSegment) ([]byte, error) {
+	data, err := proto.Marshal(segment)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decodeSegment(data []byte) (*storage.ArchiveSegment, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var segment storage.ArchiveSegment
+	if err := proto.Unmarshal(raw, &segment); err != nil {
+		return nil, err
+	}
+
+	return &segment, nil
+}
+
+// withTX runs f inside a transaction on s, committing it if f succeeds.
+func withTX(s storage.MapStorage, f func(storage.MapTX) error) error {
+	tx, err := s.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ArchiveMap archives each pruned revision of the map held in s which has not
+// already been archived. Revisions covered by an active restore are left alone.
+// It returns the number of revisions archived.
+func (a *Archiver) ArchiveMap(s storage.MapStorage) (int, error) {
+	var first, limit int64
+	err := withTX(s, func(tx storage.MapTX) error {
+		oldest, err := tx.OldestRetainedRevision()
+		if err != nil {
+			return err
+		}
+
+		archived, err := tx.GetArchivedRevisions()
+		if err != nil {
+			return err
+		}
+
+		restored, err := tx.GetRestoredRevisions()
+		if err != nil {
+			return err
+		}
+
+		// Revision 0 is the empty map so there's never anything to archive there
+		first = 1
+		for rev := range archived {
+			if rev >= first {
+				first = rev + 1
+			}
+		}
+		for rev := range restored {
+			if rev >= first {
+				first = rev + 1
+			}
+		}
+		limit = oldest
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for rev := first; rev < limit; rev++ {
+		if err := a.archiveRevision(s, rev); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	if count > 0 {
+		glog.Infof("Archived map %d revisions %d to %d", s.MapID().TreeID, first, limit-1)
+	}
+
+	return count, nil
+}
+
+// archiveRevision moves the archivable data for a single revision into the
+// object store. The segment is written before the data is removed so a failure
+// part way through never loses anything.
+func (a *Archiver) archiveRevision(s storage.MapStorage, revision int64) error {
+	return withTX(s, func(tx storage.MapTX) error {
+		segment, err := tx.GetArchivableRevision(revision)
+		if err != nil {
+			return err
+		}
+
+		// Nothing was superseded at this revision, record that it's been
+		// archived without writing an empty segment.
+		name := ""
+		if len(segment.Leaves) > 0 || len(segment.Subtrees) > 0 {
+			name = segmentName(segment.TreeId, revision)
+			data, err := encodeSegment(segment)
+			if err != nil {
+				return err
+			}
+			if err := a.store.Put(name, data); err != nil {
+				glog.Warningf("Failed to write archive segment %s: %v", name, err)
+				return err
+			}
+		}
+
+		return tx.ArchiveRevision(revision, name)
+	})
+}
+
+// Restore rehydrates the map held in s so that revision can be read again until
+// ttl has passed, after which ExpireRestores will archive it again.
+func (a *Archiver) Restore(s storage.MapStorage, revision int64, ttl time.Duration) error {
+	return withTX(s, func(tx storage.MapTX) error {
+		oldest, err := tx.OldestRetainedRevision()
+		if err != nil {
+			return err
+		}
+		if revision >= oldest {
+			return fmt.Errorf("revision %d has not been pruned, oldest retained revision is %d", revision, oldest)
+		}
+
+		archived, err := tx.GetArchivedRevisions()
+		if err != nil {
+			return err
+		}
+
+		// Reading at revision can need data from any earlier revision
+		for rev, name := range archived {
+			if rev > revision || len(name) == 0 {
+				continue
+			}
+
+			data, err := a.store.Get(name)
+			if err != nil {
+				glog.Warningf("Failed to read archive segment %s: %v", name, err)
+				return err
+			}
+
+			segment, err := decodeSegment(data)
+			if err != nil {
+				return fmt.Errorf("failed to decode archive segment %s: %v", name, err)
+			}
+			if segment.Revision != rev {
+				return fmt.Errorf("archive segment %s holds revision %d, expected %d", name, segment.Revision, rev)
+			}
+
+			if err := tx.RestoreArchivedRevision(segment); err != nil {
+				return err
+			}
+		}
+
+		expires := a.timeSource.Now().Add(ttl).UnixNano()
+		if err := tx.SetRevisionRestored(revision, expires); err != nil {
+			return err
+		}
+
+		glog.Infof("Restored map %d revision %d until %s", s.MapID().TreeID, revision, time.Unix(0, expires).UTC())
+
+		return nil
+	})
+}
+
+// ExpireRestores removes the data restored for any revisions of the map held in
+// s whose restore has expired, unless it is still needed by another restore.
+// It returns the number of restores which expired.
+func (a *Archiver) ExpireRestores(s storage.MapStorage) (int, error) {
+	count := 0
+	err := withTX(s, func(tx storage.MapTX) error {
+		restored, err := tx.GetRestoredRevisions()
+		if err != nil {
+			return err
+		}
+
+		now := a.timeSource.Now().UnixNano()
+		maxActive := int64(-1)
+		for rev, expires := range restored {
+			if expires > now {
+				if rev > maxActive {
+					maxActive = rev
+				}
+				continue
+			}
+			if err := tx.ClearRevisionRestored(rev); err != nil {
+				return err
+			}
+			count++
+		}
+
+		if count == 0 {
+			return nil
+		}
+
+		archived, err := tx.GetArchivedRevisions()
+		if err != nil {
+			return err
+		}
+
+		// Revisions up to the latest active restore are still needed
+		for rev, name := range archived {
+			if rev <= maxActive {
+				continue
+			}
+			if err := tx.ArchiveRevision(rev, name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if count > 0 {
+		glog.Infof("Expired %d restored revisions of map %d", count, s.MapID().TreeID)
+	}
+
+	return count, nil
+}
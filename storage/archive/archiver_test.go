@@ -0,0 +1,260 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util"
+)
+
+const testTreeID = int64(7)
+
+var fakeTime = time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// memoryObjectStore is an ObjectStore which holds segments in a map.
+type memoryObjectStore map[string][]byte
+
+func (m memoryObjectStore) Put(name string, data []byte) error {
+	m[name] = data
+	return nil
+}
+
+func (m memoryObjectStore) Get(name string) ([]byte, error) {
+	data, ok := m[name]
+	if !ok {
+		return nil, fmt.Errorf("no segment named %s", name)
+	}
+	return data, nil
+}
+
+func testSegment(revision int64) *storage.ArchiveSegment {
+	return &storage.ArchiveSegment{
+		TreeId:   testTreeID,
+		Revision: revision,
+		Leaves:   []*storage.ArchivedLeaf{{KeyHash: []byte("key"), LeafData: []byte(fmt.Sprintf("leaf %d", revision))}},
+		Subtrees: []*storage.SubtreeProto{{Prefix: []byte{1}, Depth: 8}},
+	}
+}
+
+func newMocks(ctrl *gomock.Controller) (*storage.MockMapStorage, *storage.MockMapTX) {
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().MapID().AnyTimes().Return(trillian.MapID{MapID: []byte("map"), TreeID: testTreeID})
+	return mockStorage, mockTx
+}
+
+func TestSegmentRoundTrip(t *testing.T) {
+	segment := testSegment(3)
+
+	data, err := encodeSegment(segment)
+	if err != nil {
+		t.Fatalf("encodeSegment failed: %v", err)
+	}
+	got, err := decodeSegment(data)
+	if err != nil {
+		t.Fatalf("decodeSegment failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, segment) {
+		t.Fatalf("Segment did not round trip, got %v, want %v", got, segment)
+	}
+
+	if _, err := decodeSegment([]byte("not gzip")); err == nil {
+		t.Fatalf("Expected error decoding corrupt segment")
+	}
+}
+
+func TestArchiveMap(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage, mockTx := newMocks(ctrl)
+	// Revisions 1 and 2 are already archived, 5 is the oldest retained
+	mockStorage.EXPECT().Begin().Times(3).Return(mockTx, nil)
+	mockTx.EXPECT().OldestRetainedRevision().Return(int64(5), nil)
+	mockTx.EXPECT().GetArchivedRevisions().Return(map[int64]string{1: "", 2: segmentName(testTreeID, 2)}, nil)
+	mockTx.EXPECT().GetRestoredRevisions().Return(map[int64]int64{}, nil)
+	mockTx.EXPECT().GetArchivableRevision(int64(3)).Return(testSegment(3), nil)
+	mockTx.EXPECT().ArchiveRevision(int64(3), segmentName(testTreeID, 3)).Return(nil)
+	// Nothing was superseded at revision 4 so no segment is written
+	mockTx.EXPECT().GetArchivableRevision(int64(4)).Return(&storage.ArchiveSegment{TreeId: testTreeID, Revision: 4}, nil)
+	mockTx.EXPECT().ArchiveRevision(int64(4), "").Return(nil)
+	mockTx.EXPECT().Commit().Times(3).Return(nil)
+
+	store := make(memoryObjectStore)
+	a := NewArchiver(store, util.FakeTimeSource{FakeTime: fakeTime})
+	count, err := a.ArchiveMap(mockStorage)
+	if err != nil {
+		t.Fatalf("ArchiveMap failed: %v", err)
+	}
+	if got, want := count, 2; got != want {
+		t.Fatalf("Archived %d revisions, want %d", got, want)
+	}
+	if got, want := len(store), 1; got != want {
+		t.Fatalf("Wrote %d segments, want %d", got, want)
+	}
+	segment, err := decodeSegment(store[segmentName(testTreeID, 3)])
+	if err != nil {
+		t.Fatalf("Failed to decode written segment: %v", err)
+	}
+	if !reflect.DeepEqual(segment, testSegment(3)) {
+		t.Fatalf("Wrong segment written, got %v, want %v", segment, testSegment(3))
+	}
+}
+
+func TestArchiveMapSkipsRestored(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage, mockTx := newMocks(ctrl)
+	// Revision 3 is restored so nothing up to it can be archived yet
+	mockStorage.EXPECT().Begin().Times(2).Return(mockTx, nil)
+	mockTx.EXPECT().OldestRetainedRevision().Return(int64(5), nil)
+	mockTx.EXPECT().GetArchivedRevisions().Return(map[int64]string{1: ""}, nil)
+	mockTx.EXPECT().GetRestoredRevisions().Return(map[int64]int64{3: fakeTime.UnixNano()}, nil)
+	mockTx.EXPECT().GetArchivableRevision(int64(4)).Return(&storage.ArchiveSegment{TreeId: testTreeID, Revision: 4}, nil)
+	mockTx.EXPECT().ArchiveRevision(int64(4), "").Return(nil)
+	mockTx.EXPECT().Commit().Times(2).Return(nil)
+
+	a := NewArchiver(make(memoryObjectStore), util.FakeTimeSource{FakeTime: fakeTime})
+	if count, err := a.ArchiveMap(mockStorage); err != nil || count != 1 {
+		t.Fatalf("ArchiveMap()=%d, %v, want 1, nil", count, err)
+	}
+}
+
+func TestArchiveMapStoreFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage, mockTx := newMocks(ctrl)
+	mockStorage.EXPECT().Begin().Times(2).Return(mockTx, nil)
+	mockTx.EXPECT().OldestRetainedRevision().Return(int64(2), nil)
+	mockTx.EXPECT().GetArchivedRevisions().Return(map[int64]string{}, nil)
+	mockTx.EXPECT().GetRestoredRevisions().Return(map[int64]int64{}, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+	mockTx.EXPECT().GetArchivableRevision(int64(1)).Return(testSegment(1), nil)
+	// The data must not be removed if the segment could not be written
+	mockTx.EXPECT().Rollback().Return(nil)
+
+	a := NewArchiver(failingObjectStore{}, util.FakeTimeSource{FakeTime: fakeTime})
+	if _, err := a.ArchiveMap(mockStorage); err == nil {
+		t.Fatalf("Expected ArchiveMap to fail when the segment can't be written")
+	}
+}
+
+type failingObjectStore struct{}
+
+func (failingObjectStore) Put(string, []byte) error   { return errors.New("put failed") }
+func (failingObjectStore) Get(string) ([]byte, error) { return nil, errors.New("get failed") }
+
+func TestRestore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := make(memoryObjectStore)
+	for _, rev := range []int64{2, 4} {
+		data, err := encodeSegment(testSegment(rev))
+		if err != nil {
+			t.Fatalf("encodeSegment failed: %v", err)
+		}
+		store[segmentName(testTreeID, rev)] = data
+	}
+
+	mockStorage, mockTx := newMocks(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().OldestRetainedRevision().Return(int64(6), nil)
+	mockTx.EXPECT().GetArchivedRevisions().Return(map[int64]string{
+		1: "",
+		2: segmentName(testTreeID, 2),
+		4: segmentName(testTreeID, 4),
+	}, nil)
+	// Only segments up to the requested revision are needed
+	mockTx.EXPECT().RestoreArchivedRevision(testSegment(2)).Return(nil)
+	mockTx.EXPECT().SetRevisionRestored(int64(3), fakeTime.Add(time.Hour).UnixNano()).Return(nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	a := NewArchiver(store, util.FakeTimeSource{FakeTime: fakeTime})
+	if err := a.Restore(mockStorage, 3, time.Hour); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+}
+
+func TestRestoreRetainedRevision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage, mockTx := newMocks(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().OldestRetainedRevision().Return(int64(6), nil)
+	mockTx.EXPECT().Rollback().Return(nil)
+
+	a := NewArchiver(make(memoryObjectStore), util.FakeTimeSource{FakeTime: fakeTime})
+	if err := a.Restore(mockStorage, 6, time.Hour); err == nil {
+		t.Fatalf("Expected Restore of a retained revision to fail")
+	}
+}
+
+func TestRestoreWrongSegment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	data, err := encodeSegment(testSegment(9))
+	if err != nil {
+		t.Fatalf("encodeSegment failed: %v", err)
+	}
+	store := memoryObjectStore{"seg": data}
+
+	mockStorage, mockTx := newMocks(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().OldestRetainedRevision().Return(int64(6), nil)
+	mockTx.EXPECT().GetArchivedRevisions().Return(map[int64]string{2: "seg"}, nil)
+	mockTx.EXPECT().Rollback().Return(nil)
+
+	a := NewArchiver(store, util.FakeTimeSource{FakeTime: fakeTime})
+	if err := a.Restore(mockStorage, 3, time.Hour); err == nil {
+		t.Fatalf("Expected Restore to fail when the segment holds the wrong revision")
+	}
+}
+
+func TestExpireRestores(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage, mockTx := newMocks(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	// The restore of revision 4 has expired but revision 2 is still restored
+	mockTx.EXPECT().GetRestoredRevisions().Return(map[int64]int64{
+		2: fakeTime.Add(time.Minute).UnixNano(),
+		4: fakeTime.Add(-time.Minute).UnixNano(),
+	}, nil)
+	mockTx.EXPECT().ClearRevisionRestored(int64(4)).Return(nil)
+	mockTx.EXPECT().GetArchivedRevisions().Return(map[int64]string{1: "a", 2: "b", 3: "", 4: "d"}, nil)
+	mockTx.EXPECT().ArchiveRevision(int64(3), "").Return(nil)
+	mockTx.EXPECT().ArchiveRevision(int64(4), "d").Return(nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	a := NewArchiver(make(memoryObjectStore), util.FakeTimeSource{FakeTime: fakeTime})
+	if count, err := a.ExpireRestores(mockStorage); err != nil || count != 1 {
+		t.Fatalf("ExpireRestores()=%d, %v, want 1, nil", count, err)
+	}
+}
+
+func TestExpireRestoresNoneExpired(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage, mockTx := newMocks(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().GetRestoredRevisions().Return(map[int64]int64{2: fakeTime.Add(time.Minute).UnixNano()}, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	a := NewArchiver(make(memoryObjectStore), util.FakeTimeSource{FakeTime: fakeTime})
+	if count, err := a.ExpireRestores(mockStorage); err != nil || count != 0 {
+		t.Fatalf("ExpireRestores()=%d, %v, want 0, nil", count, err)
+	}
+}
@@ -0,0 +1,64 @@
+package archive
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ObjectStore holds archive segments outside of the main storage. Segments are
+// written once and never modified.
+type ObjectStore interface {
+	// Put stores data under name.
+	Put(name string, data []byte) error
+	// Get returns the data stored under name.
+	Get(name string) ([]byte, error)
+}
+
+// DirectoryObjectStore is an ObjectStore which keeps each segment in a file
+// under a local directory. This could be a mounted network filesystem.
+type DirectoryObjectStore struct {
+	dir string
+}
+
+// NewDirectoryObjectStore creates a DirectoryObjectStore rooted at dir, which
+// will be created if it does not already exist.
+func NewDirectoryObjectStore(dir string) (*DirectoryObjectStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DirectoryObjectStore{dir: dir}, nil
+}
+
+func (d *DirectoryObjectStore) path(name string) (string, error) {
+	if len(name) == 0 || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid segment name: %q", name)
+	}
+	return filepath.Join(d.dir, name), nil
+}
+
+// Put stores data under name. The file is written to a temporary name first so
+// a partially written segment is never visible.
+func (d *DirectoryObjectStore) Put(name string, data []byte) error {
+	path, err := d.path(name)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Get returns the data stored under name.
+func (d *DirectoryObjectStore) Get(name string) ([]byte, error) {
+	path, err := d.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path)
+}
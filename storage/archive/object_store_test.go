@@ -0,0 +1,41 @@
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDirectoryObjectStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewDirectoryObjectStore(dir)
+	if err != nil {
+		t.Fatalf("NewDirectoryObjectStore failed: %v", err)
+	}
+
+	if err := store.Put("seg", []byte("data")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	got, err := store.Get("seg")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !bytes.Equal(got, []byte("data")) {
+		t.Fatalf("Get returned %v, want %v", got, []byte("data"))
+	}
+
+	if _, err := store.Get("missing"); err == nil {
+		t.Fatalf("Expected Get of a missing segment to fail")
+	}
+	for _, name := range []string{"", "..", "a/b"} {
+		if err := store.Put(name, nil); err == nil {
+			t.Errorf("Expected Put(%q) to fail", name)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+)
+
+// leafCacheKey identifies the value of a key at a map revision.
+type leafCacheKey struct {
+	treeID   int64
+	revision int64
+	keyHash  string
+}
+
+type leafCacheEntry struct {
+	key leafCacheKey
+	// leaf is nil if the key has no value at the revision
+	leaf *trillian.MapLeaf
+}
+
+// MapLeafCacheStats reports how effective a MapLeafCache has been.
+type MapLeafCacheStats struct {
+	// Entries is the number of keys currently cached.
+	Entries int
+	// Hits is the number of keys read which were answered from the cache.
+	Hits int64
+	// Misses is the number of keys read which had to be fetched from storage.
+	Misses int64
+	// Evictions is the number of keys dropped to keep within the size limit.
+	Evictions int64
+}
+
+// HitRate returns the fraction of keys read which were answered from the cache.
+func (s MapLeafCacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// MapLeafCache is a read-through cache of the values returned by map Get calls,
+// keyed by tree, revision and key hash. It's installed as a storage wrapper, see
+// Wrapper. When full the least recently used value is evicted. It is safe for
+// concurrent use and may be shared between maps.
+//
+// The values at a published revision never change, so only reads at explicit
+// revisions no later than the latest root seen by the transaction are cached.
+// Later revisions may still be written, or be abandoned and written again, by
+// other servers. A transaction which writes to a map, or which abandons,
+// reverts or prunes revisions, invalidates everything cached for that map when it
+// commits as revision numbers can be reused. Changes made through another process
+// are not seen so the cache should not be used where maps are reverted out of
+// band.
+type MapLeafCache struct {
+	maxEntries int
+	// Must hold this lock before accessing the fields below
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[leafCacheKey]*list.Element
+	// generations is bumped for a tree whenever it's invalidated, so that values
+	// read before the invalidation are not cached after it
+	generations map[int64]int64
+	stats       MapLeafCacheStats
+}
+
+// NewMapLeafCache creates a MapLeafCache holding at most maxEntries values.
+func NewMapLeafCache(maxEntries int) *MapLeafCache {
+	return &MapLeafCache{
+		maxEntries:  maxEntries,
+		lru:         list.New(),
+		entries:     make(map[leafCacheKey]*list.Element),
+		generations: make(map[int64]int64),
+	}
+}
+
+// Stats returns the current cache statistics.
+func (c *MapLeafCache) Stats() MapLeafCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// InvalidateTree removes all the cached values for a map.
+func (c *MapLeafCache) InvalidateTree(treeID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generations[treeID]++
+	for e := c.lru.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*leafCacheEntry).key.treeID == treeID {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+// lookup returns the cached leaves for keyHashes at revision, and the key hashes
+// which were not cached. The tree's current generation is also returned and must
+// be passed to add.
+func (c *MapLeafCache) lookup(treeID, revision int64, keyHashes []trillian.Hash) ([]trillian.MapLeaf, []trillian.Hash, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var leaves []trillian.MapLeaf
+	var missing []trillian.Hash
+	for _, keyHash := range keyHashes {
+		e, ok := c.entries[leafCacheKey{treeID, revision, string(keyHash)}]
+		if !ok {
+			c.stats.Misses++
+			missing = append(missing, keyHash)
+			continue
+		}
+		c.stats.Hits++
+		c.lru.MoveToFront(e)
+		if leaf := e.Value.(*leafCacheEntry).leaf; leaf != nil {
+			leaves = append(leaves, *leaf)
+		}
+	}
+
+	return leaves, missing, c.generations[treeID]
+}
+
+// add caches the leaves read from storage for keyHashes at revision. Keys with no
+// leaf are cached as having no value. Nothing is cached if the tree has been
+// invalidated since generation was returned by lookup.
+func (c *MapLeafCache) add(treeID, revision, generation int64, keyHashes []trillian.Hash, leaves []trillian.MapLeaf) {
+	if c.maxEntries <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generations[treeID] != generation {
+		return
+	}
+
+	byKey := make(map[string]*trillian.MapLeaf)
+	for i := range leaves {
+		leaf := leaves[i]
+		byKey[string(leaf.KeyHash)] = &leaf
+	}
+
+	for _, keyHash := range keyHashes {
+		key := leafCacheKey{treeID, revision, string(keyHash)}
+		if e, ok := c.entries[key]; ok {
+			e.Value.(*leafCacheEntry).leaf = byKey[key.keyHash]
+			c.lru.MoveToFront(e)
+			continue
+		}
+		c.entries[key] = c.lru.PushFront(&leafCacheEntry{key: key, leaf: byKey[key.keyHash]})
+	}
+
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *MapLeafCache) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.entries, e.Value.(*leafCacheEntry).key)
+}
+
+// get reads keyHashes at revision, from the cache where possible and otherwise
+// through getter.
+func (c *MapLeafCache) get(treeID, revision int64, keyHashes []trillian.Hash, getter storage.Getter) ([]trillian.MapLeaf, error) {
+	leaves, missing, generation := c.lookup(treeID, revision, keyHashes)
+	if len(missing) == 0 {
+		return leaves, nil
+	}
+
+	read, err := getter.Get(revision, missing)
+	if err != nil {
+		return nil, err
+	}
+	c.add(treeID, revision, generation, missing, read)
+
+	return append(leaves, read...), nil
+}
+
+// Wrapper returns a MapStorageWrapper which caches Get calls made through the
+// transactions of the wrapped storage in c.
+func (c *MapLeafCache) Wrapper() storage.MapStorageWrapper {
+	return func(s storage.MapStorage) storage.MapStorage {
+		treeID := s.MapID().TreeID
+		return storage.WrapMapTXs(storage.MapTXWrappers{
+			TX: func(tx storage.MapTX) storage.MapTX {
+				return &cachingMapTX{MapTX: tx, cache: c, treeID: treeID}
+			},
+			Snapshot: func(tx storage.ReadOnlyMapTX) storage.ReadOnlyMapTX {
+				return &cachingReadOnlyMapTX{ReadOnlyMapTX: tx, cache: c, treeID: treeID}
+			},
+		})(s)
+	}
+}
+
+// publishedRevision remembers the revision of the latest root seen by a
+// transaction, which reads at no later revision may be cached.
+type publishedRevision struct {
+	revision int64
+	known    bool
+}
+
+// get returns the revision of the latest root in tx, reading it the first time.
+func (p *publishedRevision) get(tx storage.ReadOnlyMapTX) (int64, error) {
+	if !p.known {
+		root, err := tx.LatestSignedMapRoot()
+		if err != nil {
+			return 0, err
+		}
+		p.revision, p.known = root.MapRevision, true
+	}
+	return p.revision, nil
+}
+
+type cachingReadOnlyMapTX struct {
+	storage.ReadOnlyMapTX
+	cache     *MapLeafCache
+	treeID    int64
+	published publishedRevision
+}
+
+func (t *cachingReadOnlyMapTX) Get(revision int64, keyHashes []trillian.Hash) ([]trillian.MapLeaf, error) {
+	// The latest revision changes as the map is written so can't be cached
+	if revision < 0 {
+		return t.ReadOnlyMapTX.Get(revision, keyHashes)
+	}
+	published, err := t.published.get(t.ReadOnlyMapTX)
+	if err != nil {
+		return nil, err
+	}
+	if revision > published {
+		return t.ReadOnlyMapTX.Get(revision, keyHashes)
+	}
+	return t.cache.get(t.treeID, revision, keyHashes, t.ReadOnlyMapTX)
+}
+
+// cachingMapTX caches reads like cachingReadOnlyMapTX, and invalidates the cache
+// for the map if it commits any change that could alter what a revision holds.
+type cachingMapTX struct {
+	storage.MapTX
+	cache     *MapLeafCache
+	treeID    int64
+	dirty     bool
+	published publishedRevision
+}
+
+func (t *cachingMapTX) Get(revision int64, keyHashes []trillian.Hash) ([]trillian.MapLeaf, error) {
+	// Reads at the write revision can see this transaction's own uncommitted
+	// writes, as can reads at any revision once it has reverted or pruned some
+	if revision < 0 || revision >= t.WriteRevision() || t.dirty {
+		return t.MapTX.Get(revision, keyHashes)
+	}
+	published, err := t.published.get(t.MapTX)
+	if err != nil {
+		return nil, err
+	}
+	if revision > published {
+		return t.MapTX.Get(revision, keyHashes)
+	}
+	return t.cache.get(t.treeID, revision, keyHashes, t.MapTX)
+}
+
+func (t *cachingMapTX) Commit() error {
+	if err := t.MapTX.Commit(); err != nil {
+		return err
+	}
+	if t.dirty {
+		t.cache.InvalidateTree(t.treeID)
+	}
+	return nil
+}
+
+func (t *cachingMapTX) Set(keyHash trillian.Hash, value trillian.MapLeaf) error {
+	t.dirty = true
+	return t.MapTX.Set(keyHash, value)
+}
+
+func (t *cachingMapTX) SetLeaves(leaves []trillian.MapLeaf) error {
+	t.dirty = true
+	return t.MapTX.SetLeaves(leaves)
+}
+
+func (t *cachingMapTX) StoreSignedMapRoot(root trillian.SignedMapRoot) error {
+	t.dirty = true
+	return t.MapTX.StoreSignedMapRoot(root)
+}
+
+func (t *cachingMapTX) StageSignedMapRoot(root trillian.SignedMapRoot) error {
+	t.dirty = true
+	return t.MapTX.StageSignedMapRoot(root)
+}
+
+func (t *cachingMapTX) PublishStagedMapRoot(root trillian.SignedMapRoot) error {
+	t.dirty = true
+	return t.MapTX.PublishStagedMapRoot(root)
+}
+
+func (t *cachingMapTX) AbandonStagedMapRoot() error {
+	t.dirty = true
+	return t.MapTX.AbandonStagedMapRoot()
+}
+
+func (t *cachingMapTX) RevertMapHead(revision int64, reason string, timestampNanos int64) (storage.MapHeadRevert, error) {
+	t.dirty = true
+	return t.MapTX.RevertMapHead(revision, reason, timestampNanos)
+}
+
+func (t *cachingMapTX) PruneRevisionsBefore(revision int64) error {
+	t.dirty = true
+	return t.MapTX.PruneRevisionsBefore(revision)
+}
+
+func (t *cachingMapTX) ClearRevisionRestored(revision int64) error {
+	t.dirty = true
+	return t.MapTX.ClearRevisionRestored(revision)
+}
@@ -0,0 +1,248 @@
+package cache
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+)
+
+const testLeafCacheTreeID = int64(3)
+
+var (
+	cachedKey1  = trillian.Hash("key1")
+	cachedKey2  = trillian.Hash("key2")
+	cachedLeaf1 = trillian.MapLeaf{KeyHash: cachedKey1, LeafValue: []byte("value1")}
+)
+
+func newCachedMapStorage(ctrl *gomock.Controller, c *MapLeafCache) (storage.MapStorage, *storage.MockMapStorage) {
+	mockStorage := storage.NewMockMapStorage(ctrl)
+	mockStorage.EXPECT().MapID().AnyTimes().Return(trillian.MapID{MapID: []byte("map"), TreeID: testLeafCacheTreeID})
+	return storage.WrapMapStorage(mockStorage, c.Wrapper()), mockStorage
+}
+
+func TestMapLeafCacheReadThrough(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := NewMapLeafCache(10)
+	s, mockStorage := newCachedMapStorage(ctrl, c)
+
+	mockTx := storage.NewMockReadOnlyMapTX(ctrl)
+	mockStorage.EXPECT().Snapshot().Times(2).Return(mockTx, nil)
+	mockTx.EXPECT().LatestSignedMapRoot().Times(2).Return(trillian.SignedMapRoot{MapRevision: 4}, nil)
+	// key2 has no value, which should be cached too so only one read is made
+	mockTx.EXPECT().Get(int64(4), []trillian.Hash{cachedKey1, cachedKey2}).Return([]trillian.MapLeaf{cachedLeaf1}, nil)
+
+	for i := 0; i < 2; i++ {
+		tx, err := s.Snapshot()
+		if err != nil {
+			t.Fatalf("Snapshot failed: %v", err)
+		}
+		leaves, err := tx.Get(4, []trillian.Hash{cachedKey1, cachedKey2})
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if got, want := leaves, []trillian.MapLeaf{cachedLeaf1}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Get returned %v, want %v", got, want)
+		}
+	}
+
+	stats := c.Stats()
+	if got, want := stats, (MapLeafCacheStats{Entries: 2, Hits: 2, Misses: 2}); got != want {
+		t.Fatalf("Got stats %+v, want %+v", got, want)
+	}
+	if got, want := stats.HitRate(), 0.5; got != want {
+		t.Fatalf("Got hit rate %v, want %v", got, want)
+	}
+}
+
+func TestMapLeafCachePartialHit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := NewMapLeafCache(10)
+	c.add(testLeafCacheTreeID, 4, 0, []trillian.Hash{cachedKey1}, []trillian.MapLeaf{cachedLeaf1})
+	s, mockStorage := newCachedMapStorage(ctrl, c)
+
+	mockTx := storage.NewMockReadOnlyMapTX(ctrl)
+	mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+	mockTx.EXPECT().LatestSignedMapRoot().Return(trillian.SignedMapRoot{MapRevision: 5}, nil)
+	// Only the key which isn't cached is read from storage
+	mockTx.EXPECT().Get(int64(4), []trillian.Hash{cachedKey2}).Return([]trillian.MapLeaf{}, nil)
+
+	tx, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if _, err := tx.Get(4, []trillian.Hash{cachedKey1, cachedKey2}); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+}
+
+func TestMapLeafCacheLatestRevisionNotCached(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := NewMapLeafCache(10)
+	s, mockStorage := newCachedMapStorage(ctrl, c)
+
+	mockTx := storage.NewMockReadOnlyMapTX(ctrl)
+	mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+	mockTx.EXPECT().Get(int64(-1), gomock.Any()).Return([]trillian.MapLeaf{cachedLeaf1}, nil)
+
+	tx, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if _, err := tx.Get(-1, []trillian.Hash{cachedKey1}); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got := c.Stats().Entries; got != 0 {
+		t.Fatalf("Expected nothing cached for the latest revision but got %d entries", got)
+	}
+}
+
+func TestMapLeafCacheUnpublishedRevisionNotCached(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := NewMapLeafCache(10)
+	s, mockStorage := newCachedMapStorage(ctrl, c)
+
+	mockTx := storage.NewMockReadOnlyMapTX(ctrl)
+	mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+	// Revision 5 may be staged, or still be written by another server
+	mockTx.EXPECT().LatestSignedMapRoot().Return(trillian.SignedMapRoot{MapRevision: 4}, nil)
+	mockTx.EXPECT().Get(int64(5), gomock.Any()).Times(2).Return([]trillian.MapLeaf{cachedLeaf1}, nil)
+
+	tx, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := tx.Get(5, []trillian.Hash{cachedKey1}); err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+	}
+	if got := c.Stats().Entries; got != 0 {
+		t.Fatalf("Expected nothing cached for an unpublished revision but got %d entries", got)
+	}
+}
+
+func TestMapLeafCacheWriteRevisionNotCached(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := NewMapLeafCache(10)
+	s, mockStorage := newCachedMapStorage(ctrl, c)
+
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().WriteRevision().AnyTimes().Return(int64(5))
+	mockTx.EXPECT().Get(int64(5), gomock.Any()).Return([]trillian.MapLeaf{}, nil)
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if _, err := tx.Get(5, []trillian.Hash{cachedKey1}); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got := c.Stats().Entries; got != 0 {
+		t.Fatalf("Expected nothing cached for the write revision but got %d entries", got)
+	}
+}
+
+func TestMapLeafCacheInvalidatedByWrite(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := NewMapLeafCache(10)
+	c.add(testLeafCacheTreeID, 4, 0, []trillian.Hash{cachedKey1}, []trillian.MapLeaf{cachedLeaf1})
+	c.add(testLeafCacheTreeID+1, 4, 0, []trillian.Hash{cachedKey1}, []trillian.MapLeaf{cachedLeaf1})
+	s, mockStorage := newCachedMapStorage(ctrl, c)
+
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().Set(cachedKey2, gomock.Any()).Return(nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := tx.Set(cachedKey2, trillian.MapLeaf{}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, want := c.Stats().Entries, 2; got != want {
+		t.Fatalf("Cache invalidated before commit, got %d entries, want %d", got, want)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if got, want := c.Stats().Entries, 1; got != want {
+		t.Fatalf("Got %d entries after commit, want %d", got, want)
+	}
+}
+
+func TestMapLeafCacheNotInvalidatedByFailedCommit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := NewMapLeafCache(10)
+	c.add(testLeafCacheTreeID, 4, 0, []trillian.Hash{cachedKey1}, []trillian.MapLeaf{cachedLeaf1})
+	s, mockStorage := newCachedMapStorage(ctrl, c)
+
+	mockTx := storage.NewMockMapTX(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().AbandonStagedMapRoot().Return(nil)
+	mockTx.EXPECT().Commit().Return(errors.New("commit failed"))
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := tx.AbandonStagedMapRoot(); err != nil {
+		t.Fatalf("AbandonStagedMapRoot failed: %v", err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Fatalf("Expected commit to fail")
+	}
+	if got, want := c.Stats().Entries, 1; got != want {
+		t.Fatalf("Got %d entries after failed commit, want %d", got, want)
+	}
+}
+
+func TestMapLeafCacheStaleReadNotCached(t *testing.T) {
+	c := NewMapLeafCache(10)
+
+	_, missing, generation := c.lookup(testLeafCacheTreeID, 4, []trillian.Hash{cachedKey1})
+	if len(missing) != 1 {
+		t.Fatalf("Expected key to be missing from empty cache")
+	}
+	// The tree is written to while the read is in progress
+	c.InvalidateTree(testLeafCacheTreeID)
+	c.add(testLeafCacheTreeID, 4, generation, missing, []trillian.MapLeaf{cachedLeaf1})
+
+	if got := c.Stats().Entries; got != 0 {
+		t.Fatalf("Expected value read before invalidation not to be cached but got %d entries", got)
+	}
+}
+
+func TestMapLeafCacheEviction(t *testing.T) {
+	c := NewMapLeafCache(1)
+
+	c.add(testLeafCacheTreeID, 4, 0, []trillian.Hash{cachedKey1}, []trillian.MapLeaf{cachedLeaf1})
+	c.add(testLeafCacheTreeID, 4, 0, []trillian.Hash{cachedKey2}, nil)
+
+	if got, want := c.Stats(), (MapLeafCacheStats{Entries: 1, Evictions: 1}); got != want {
+		t.Fatalf("Got stats %+v, want %+v", got, want)
+	}
+	if _, missing, _ := c.lookup(testLeafCacheTreeID, 4, []trillian.Hash{cachedKey1}); len(missing) != 1 {
+		t.Fatalf("Expected least recently used key to be evicted")
+	}
+}
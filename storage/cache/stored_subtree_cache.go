@@ -0,0 +1,277 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/google/trillian/monitoring"
+)
+
+// storedSubtreeID identifies a subtree of a tree, whatever its revision.
+type storedSubtreeID struct {
+	treeID int64
+	id     string
+}
+
+// storedSubtreeKey identifies the subtree with a given ID written at a node
+// revision.
+type storedSubtreeKey struct {
+	storedSubtreeID
+	nodeRevision int64
+}
+
+type storedSubtreeEntry struct {
+	key storedSubtreeKey
+	// readRevision is the latest tree revision the subtree has been read at. It's
+	// the stored subtree at every revision from its node revision to readRevision.
+	readRevision int64
+	// data is the subtree as stored, or nil if there's no subtree with the ID up
+	// to readRevision, when the node revision is noSubtreeRevision
+	data []byte
+}
+
+// noSubtreeRevision is the node revision of entries for subtrees that don't
+// exist at the revisions they were read at.
+const noSubtreeRevision = -1
+
+// size returns the number of bytes counted against the cache's limit for e.
+func (e *storedSubtreeEntry) size() int64 {
+	return int64(len(e.key.id) + len(e.data))
+}
+
+// StoredSubtreeCacheStats reports how effective a StoredSubtreeCache has been.
+type StoredSubtreeCacheStats struct {
+	// Entries is the number of subtrees currently cached.
+	Entries int
+	// Bytes is the size of the subtrees currently cached.
+	Bytes int64
+	// Hits is the number of subtrees read which were answered from the cache.
+	Hits int64
+	// Misses is the number of subtrees read which had to be fetched from storage.
+	Misses int64
+	// Evictions is the number of subtrees dropped to keep within the size limit.
+	Evictions int64
+}
+
+// HitRate returns the fraction of subtrees read which were answered from the
+// cache.
+func (s StoredSubtreeCacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// StoredSubtreeCacheMetrics reports the same figures as StoredSubtreeCacheStats
+// to a monitoring system. The metrics are created once, by
+// NewStoredSubtreeCacheMetrics, and set on the cache with SetMetrics.
+type StoredSubtreeCacheMetrics struct {
+	entries   monitoring.Gauge
+	bytes     monitoring.Gauge
+	hits      monitoring.Counter
+	misses    monitoring.Counter
+	evictions monitoring.Counter
+}
+
+// NewStoredSubtreeCacheMetrics creates the stored subtree cache metrics in mf.
+func NewStoredSubtreeCacheMetrics(mf monitoring.MetricFactory) *StoredSubtreeCacheMetrics {
+	return &StoredSubtreeCacheMetrics{
+		entries:   mf.NewGauge("subtree_cache_entries", "Number of subtrees held in the stored subtree cache"),
+		bytes:     mf.NewGauge("subtree_cache_bytes", "Size in bytes of the subtrees held in the stored subtree cache"),
+		hits:      mf.NewCounter("subtree_cache_hits", "Number of subtrees read which were answered from the stored subtree cache"),
+		misses:    mf.NewCounter("subtree_cache_misses", "Number of subtrees read which had to be fetched from storage"),
+		evictions: mf.NewCounter("subtree_cache_evictions", "Number of subtrees dropped from the stored subtree cache to keep within its size limit"),
+	}
+}
+
+// StoredSubtreeCache is a cache of the subtrees read by storage, keyed by tree,
+// subtree ID and the node revision they were written at, which outlives
+// transactions so that each doesn't start cold. Each entry remembers the latest
+// tree revision it has been read at, and answers reads at any revision from its
+// node revision to that one, so a subtree that's unchanged as a tree grows is
+// only held once. Unlike SubtreeCache, which holds a transaction's working copy
+// of the subtrees it touches, it holds subtrees as they're stored. When its size
+// limit is reached the least recently used subtrees are evicted. It is safe for
+// concurrent use and may be shared between trees.
+//
+// A subtree read at a revision only changes if subtrees are written or deleted at
+// or before that revision, so storage must call InvalidateTree once a transaction
+// which did so has committed. New subtrees are written beyond the revisions that
+// have been published, so reads at those stay valid as trees grow. Subtrees
+// deleted through another process, as when a map is reverted or pruned, are not
+// seen so the cache should not be used where that's done out of band.
+type StoredSubtreeCache struct {
+	maxBytes int64
+	// Must hold this lock before accessing the fields below
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[storedSubtreeKey]*list.Element
+	// revisions holds the entries of each subtree, whatever their node revision
+	revisions map[storedSubtreeID][]*list.Element
+	bytes     int64
+	// generations is bumped for a tree whenever it's invalidated, so that
+	// subtrees read before the invalidation are not cached after it
+	generations map[int64]int64
+	stats       StoredSubtreeCacheStats
+	metrics     *StoredSubtreeCacheMetrics
+}
+
+// NewStoredSubtreeCache creates a StoredSubtreeCache holding at most maxBytes of
+// subtrees.
+func NewStoredSubtreeCache(maxBytes int64) *StoredSubtreeCache {
+	return &StoredSubtreeCache{
+		maxBytes:    maxBytes,
+		lru:         list.New(),
+		entries:     make(map[storedSubtreeKey]*list.Element),
+		revisions:   make(map[storedSubtreeID][]*list.Element),
+		generations: make(map[int64]int64),
+	}
+}
+
+// SetMetrics makes the cache report its size, hits, misses and evictions in m.
+func (c *StoredSubtreeCache) SetMetrics(m *StoredSubtreeCacheMetrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.metrics = m
+	m.entries.Set(float64(c.lru.Len()))
+	m.bytes.Set(float64(c.bytes))
+}
+
+// Stats returns the current cache statistics.
+func (c *StoredSubtreeCache) Stats() StoredSubtreeCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	stats.Bytes = c.bytes
+	return stats
+}
+
+// Generation returns the number of times a tree has been invalidated. It should be
+// read before the storage reads the subtrees to be cached, and passed to Add.
+func (c *StoredSubtreeCache) Generation(treeID int64) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generations[treeID]
+}
+
+// InvalidateTree forgets what the subtrees of a tree are at fromRevision and
+// later. Subtrees written before it are kept for reads at earlier revisions.
+func (c *StoredSubtreeCache) InvalidateTree(treeID, fromRevision int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generations[treeID]++
+	for e := c.lru.Front(); e != nil; {
+		next := e.Next()
+		if entry := e.Value.(*storedSubtreeEntry); entry.key.treeID == treeID && entry.readRevision >= fromRevision {
+			if entry.key.nodeRevision >= fromRevision || fromRevision == 0 {
+				c.remove(e)
+			} else {
+				entry.readRevision = fromRevision - 1
+			}
+		}
+		e = next
+	}
+	c.updateSize()
+}
+
+// Get returns the subtree with id read at revision of a tree, which is nil if
+// there's no such subtree, and whether it was cached.
+func (c *StoredSubtreeCache) Get(treeID, revision int64, id []byte) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range c.revisions[storedSubtreeID{treeID, string(id)}] {
+		if entry := e.Value.(*storedSubtreeEntry); entry.key.nodeRevision <= revision && revision <= entry.readRevision {
+			c.stats.Hits++
+			if c.metrics != nil {
+				c.metrics.hits.Inc()
+			}
+			c.lru.MoveToFront(e)
+			return entry.data, true
+		}
+	}
+	c.stats.Misses++
+	if c.metrics != nil {
+		c.metrics.misses.Inc()
+	}
+	return nil, false
+}
+
+// Add caches the subtree with id read at readRevision of a tree, which was
+// written at nodeRevision. data is nil, and nodeRevision is ignored, if there's
+// no such subtree. data must not be modified afterwards. Nothing is cached if the
+// tree has been invalidated since generation was returned by Generation.
+func (c *StoredSubtreeCache) Add(treeID, readRevision, nodeRevision, generation int64, id, data []byte) {
+	if c.maxBytes <= 0 {
+		return
+	}
+	if data == nil {
+		nodeRevision = noSubtreeRevision
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generations[treeID] != generation {
+		return
+	}
+
+	key := storedSubtreeKey{storedSubtreeID{treeID, string(id)}, nodeRevision}
+	if e, ok := c.entries[key]; ok {
+		// The same subtree has now been read at another revision
+		if entry := e.Value.(*storedSubtreeEntry); readRevision > entry.readRevision {
+			entry.readRevision = readRevision
+		}
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	entry := &storedSubtreeEntry{key: key, readRevision: readRevision, data: data}
+	e := c.lru.PushFront(entry)
+	c.entries[key] = e
+	c.revisions[key.storedSubtreeID] = append(c.revisions[key.storedSubtreeID], e)
+	c.bytes += entry.size()
+
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+		if c.metrics != nil {
+			c.metrics.evictions.Inc()
+		}
+	}
+	c.updateSize()
+}
+
+func (c *StoredSubtreeCache) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*storedSubtreeEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size()
+
+	elems := c.revisions[entry.key.storedSubtreeID]
+	for i, other := range elems {
+		if other == e {
+			elems = append(elems[:i], elems[i+1:]...)
+			break
+		}
+	}
+	if len(elems) == 0 {
+		delete(c.revisions, entry.key.storedSubtreeID)
+	} else {
+		c.revisions[entry.key.storedSubtreeID] = elems
+	}
+}
+
+// updateSize reports the number and size of the cached subtrees in the
+// metrics, if they're set. Must hold c.mu.
+func (c *StoredSubtreeCache) updateSize() {
+	if c.metrics == nil {
+		return
+	}
+	c.metrics.entries.Set(float64(c.lru.Len()))
+	c.metrics.bytes.Set(float64(c.bytes))
+}
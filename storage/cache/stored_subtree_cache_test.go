@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/trillian/monitoring"
+)
+
+const testSubtreeCacheTreeID = int64(5)
+
+var (
+	storedSubtreeID1 = []byte{0x01}
+	storedSubtreeID2 = []byte{0x02}
+	storedSubtreeID3 = []byte{0x03}
+)
+
+func TestStoredSubtreeCacheGet(t *testing.T) {
+	c := NewStoredSubtreeCache(100)
+	gen := c.Generation(testSubtreeCacheTreeID)
+	c.Add(testSubtreeCacheTreeID, 4, 2, gen, storedSubtreeID1, []byte("subtree1"))
+	// A subtree which doesn't exist is cached as such
+	c.Add(testSubtreeCacheTreeID, 4, 0, gen, storedSubtreeID2, nil)
+
+	if data, ok := c.Get(testSubtreeCacheTreeID, 4, storedSubtreeID1); !ok || !bytes.Equal(data, []byte("subtree1")) {
+		t.Errorf("Get(subtree1) = %q, %v, want %q, true", data, ok, "subtree1")
+	}
+	// The subtree is the same at the revisions since it was written
+	if data, ok := c.Get(testSubtreeCacheTreeID, 2, storedSubtreeID1); !ok || !bytes.Equal(data, []byte("subtree1")) {
+		t.Errorf("Get(subtree1) at its node revision = %q, %v, want %q, true", data, ok, "subtree1")
+	}
+	if data, ok := c.Get(testSubtreeCacheTreeID, 1, storedSubtreeID2); !ok || data != nil {
+		t.Errorf("Get(subtree2) = %q, %v, want nil, true", data, ok)
+	}
+	// Revisions before the subtree was written, or after it was read, and other
+	// trees aren't known
+	if _, ok := c.Get(testSubtreeCacheTreeID, 1, storedSubtreeID1); ok {
+		t.Error("Get(subtree1) before its node revision was cached")
+	}
+	if _, ok := c.Get(testSubtreeCacheTreeID, 5, storedSubtreeID1); ok {
+		t.Error("Get(subtree1) after its read revision was cached")
+	}
+	if _, ok := c.Get(testSubtreeCacheTreeID+1, 4, storedSubtreeID1); ok {
+		t.Error("Get(subtree1) of another tree was cached")
+	}
+
+	stats := c.Stats()
+	if got, want := stats, (StoredSubtreeCacheStats{Entries: 2, Bytes: 10, Hits: 3, Misses: 3}); got != want {
+		t.Fatalf("Got stats %+v, want %+v", got, want)
+	}
+	if got, want := stats.HitRate(), 0.5; got != want {
+		t.Fatalf("Got hit rate %v, want %v", got, want)
+	}
+}
+
+func TestStoredSubtreeCacheNodeRevisions(t *testing.T) {
+	c := NewStoredSubtreeCache(100)
+	c.Add(testSubtreeCacheTreeID, 4, 2, 0, storedSubtreeID1, []byte("sub1"))
+	// Reading the same node revision later extends the revisions it answers,
+	// without holding the subtree twice
+	c.Add(testSubtreeCacheTreeID, 6, 2, 0, storedSubtreeID1, []byte("sub1"))
+	c.Add(testSubtreeCacheTreeID, 9, 8, 0, storedSubtreeID1, []byte("new1"))
+
+	for _, test := range []struct {
+		revision int64
+		want     string
+		wantOK   bool
+	}{
+		{revision: 1},
+		{revision: 2, want: "sub1", wantOK: true},
+		{revision: 6, want: "sub1", wantOK: true},
+		{revision: 7},
+		{revision: 8, want: "new1", wantOK: true},
+		{revision: 9, want: "new1", wantOK: true},
+		{revision: 10},
+	} {
+		if data, ok := c.Get(testSubtreeCacheTreeID, test.revision, storedSubtreeID1); ok != test.wantOK || string(data) != test.want {
+			t.Errorf("Get(subtree1) at %d = %q, %v, want %q, %v", test.revision, data, ok, test.want, test.wantOK)
+		}
+	}
+	if got, want := c.Stats().Bytes, int64(10); got != want {
+		t.Errorf("Got %d bytes cached, want %d", got, want)
+	}
+}
+
+func TestStoredSubtreeCacheEviction(t *testing.T) {
+	// Room for two of the subtrees, which are 5 bytes each with their IDs
+	c := NewStoredSubtreeCache(10)
+	c.Add(testSubtreeCacheTreeID, 4, 1, 0, storedSubtreeID1, []byte("sub1"))
+	c.Add(testSubtreeCacheTreeID, 4, 1, 0, storedSubtreeID2, []byte("sub2"))
+	// Using subtree1 leaves subtree2 as the least recently used
+	c.Get(testSubtreeCacheTreeID, 4, storedSubtreeID1)
+	c.Add(testSubtreeCacheTreeID, 4, 1, 0, storedSubtreeID3, []byte("sub3"))
+
+	if _, ok := c.Get(testSubtreeCacheTreeID, 4, storedSubtreeID2); ok {
+		t.Error("Least recently used subtree wasn't evicted")
+	}
+	for _, id := range [][]byte{storedSubtreeID1, storedSubtreeID3} {
+		if _, ok := c.Get(testSubtreeCacheTreeID, 4, id); !ok {
+			t.Errorf("Subtree %x was evicted", id)
+		}
+	}
+	if got, want := c.Stats(), (StoredSubtreeCacheStats{Entries: 2, Bytes: 10, Hits: 3, Misses: 1, Evictions: 1}); got != want {
+		t.Fatalf("Got stats %+v, want %+v", got, want)
+	}
+}
+
+func TestStoredSubtreeCacheInvalidateTree(t *testing.T) {
+	c := NewStoredSubtreeCache(100)
+	c.Add(testSubtreeCacheTreeID, 5, 2, 0, storedSubtreeID1, []byte("sub1"))
+	c.Add(testSubtreeCacheTreeID, 5, 4, 0, storedSubtreeID2, []byte("sub2"))
+	c.Add(testSubtreeCacheTreeID+1, 5, 2, 0, storedSubtreeID1, []byte("sub1"))
+
+	c.InvalidateTree(testSubtreeCacheTreeID, 4)
+
+	if _, ok := c.Get(testSubtreeCacheTreeID, 4, storedSubtreeID1); ok {
+		t.Error("Subtree at the invalidated revision is still cached")
+	}
+	if _, ok := c.Get(testSubtreeCacheTreeID, 3, storedSubtreeID1); !ok {
+		t.Error("Subtree before the invalidated revision was removed")
+	}
+	if _, ok := c.Get(testSubtreeCacheTreeID, 5, storedSubtreeID2); ok {
+		t.Error("Subtree written at the invalidated revision is still cached")
+	}
+	if _, ok := c.Get(testSubtreeCacheTreeID+1, 4, storedSubtreeID1); !ok {
+		t.Error("Subtree of another tree was removed")
+	}
+	if got, want := c.Stats().Bytes, int64(10); got != want {
+		t.Errorf("Got %d bytes cached, want %d", got, want)
+	}
+}
+
+func TestStoredSubtreeCacheStaleReadNotCached(t *testing.T) {
+	c := NewStoredSubtreeCache(100)
+	gen := c.Generation(testSubtreeCacheTreeID)
+	// The tree is written to after the subtree was read, but before it's added
+	c.InvalidateTree(testSubtreeCacheTreeID, 0)
+	c.Add(testSubtreeCacheTreeID, 4, 1, gen, storedSubtreeID1, []byte("sub1"))
+
+	if _, ok := c.Get(testSubtreeCacheTreeID, 4, storedSubtreeID1); ok {
+		t.Error("Subtree read before the tree was invalidated was cached")
+	}
+}
+
+func TestStoredSubtreeCacheMetrics(t *testing.T) {
+	c := NewStoredSubtreeCache(100)
+	c.SetMetrics(NewStoredSubtreeCacheMetrics(monitoring.InertMetricFactory{}))
+	c.Add(testSubtreeCacheTreeID, 4, 1, 0, storedSubtreeID1, []byte("sub1"))
+	c.Get(testSubtreeCacheTreeID, 4, storedSubtreeID1)
+	c.Get(testSubtreeCacheTreeID, 4, storedSubtreeID2)
+
+	m := c.metrics
+	if got, want := m.entries.Value(), 1.0; got != want {
+		t.Errorf("Got %v entries, want %v", got, want)
+	}
+	if got, want := m.bytes.Value(), 5.0; got != want {
+		t.Errorf("Got %v bytes, want %v", got, want)
+	}
+	if got, want := m.hits.Value(), 1.0; got != want {
+		t.Errorf("Got %v hits, want %v", got, want)
+	}
+	if got, want := m.misses.Value(), 1.0; got != want {
+		t.Errorf("Got %v misses, want %v", got, want)
+	}
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FormatStrata returns strata depths as a comma separated list from the root,
+// with runs of the same depth abbreviated, so the strata of a SHA-256 map are
+// 8x10,176. ParseStrata reads it back.
+func FormatStrata(strata []int) string {
+	var parts []string
+	for i := 0; i < len(strata); {
+		n := 1
+		for i+n < len(strata) && strata[i+n] == strata[i] {
+			n++
+		}
+		if n == 1 {
+			parts = append(parts, fmt.Sprint(strata[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%dx%d", strata[i], n))
+		}
+		i += n
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseStrata parses a comma separated list of strata depths, where depthxN is
+// N strata of that depth, as written by FormatStrata. An empty string results in
+// no strata. The depths aren't checked, see ValidateStrata.
+func ParseStrata(s string) ([]int, error) {
+	if len(strings.TrimSpace(s)) == 0 {
+		return nil, nil
+	}
+
+	var strata []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		depthStr, countStr := part, "1"
+		if i := strings.Index(part, "x"); i >= 0 {
+			depthStr, countStr = part[:i], part[i+1:]
+		}
+		depth, err := strconv.Atoi(depthStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stratum depth %q", part)
+		}
+		count, err := strconv.Atoi(countStr)
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("invalid stratum count %q", part)
+		}
+		for i := 0; i < count; i++ {
+			strata = append(strata, depth)
+		}
+	}
+	return strata, nil
+}
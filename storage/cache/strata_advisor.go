@@ -0,0 +1,272 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/trillian"
+)
+
+// KeyProfile describes how a map's key hashes are spread through its tree, by
+// the number of distinct prefixes of each length that they have. The number of
+// distinct prefixes as long as a stratum's root is the number of subtrees
+// stored for the stratum.
+type KeyProfile struct {
+	// Depth is the depth of the tree, the number of bits in a key hash.
+	Depth int
+	// prefixes[i] is the number of distinct 8*i bit prefixes of the keys.
+	prefixes []float64
+}
+
+// Keys returns the number of distinct keys in the profile.
+func (p KeyProfile) Keys() float64 {
+	return p.prefixes[len(p.prefixes)-1]
+}
+
+// occupied returns the expected number of bins that n balls thrown at random
+// land in.
+func occupied(bins, n float64) float64 {
+	if n <= 0 {
+		return 0
+	}
+	return -bins * math.Expm1(n*math.Log1p(-1/bins))
+}
+
+// UniformKeyProfile returns the expected profile of keys spread uniformly over
+// a tree depth bits deep, which is what hashed keys should look like.
+func UniformKeyProfile(depth int, keys int64) KeyProfile {
+	p := KeyProfile{Depth: depth, prefixes: make([]float64, depth/8+1)}
+	for i := range p.prefixes {
+		p.prefixes[i] = occupied(math.Ldexp(1, 8*i), float64(keys))
+	}
+	return p
+}
+
+type hashSorter []trillian.Hash
+
+func (h hashSorter) Len() int           { return len(h) }
+func (h hashSorter) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h hashSorter) Less(i, j int) bool { return bytes.Compare(h[i], h[j]) < 0 }
+
+// KeyProfileFromHashes returns the profile of a set of key hashes, which must
+// all be the same length. Duplicates are only counted once.
+func KeyProfileFromHashes(keyHashes []trillian.Hash) (KeyProfile, error) {
+	if len(keyHashes) == 0 {
+		return KeyProfile{}, errors.New("no key hashes to profile")
+	}
+	size := len(keyHashes[0])
+	sorted := make([]trillian.Hash, len(keyHashes))
+	for i, kh := range keyHashes {
+		if len(kh) != size {
+			return KeyProfile{}, fmt.Errorf("key hash %x has %d bytes, expected %d", kh, len(kh), size)
+		}
+		sorted[i] = kh
+	}
+	sort.Sort(hashSorter(sorted))
+
+	// Neighbouring keys whose first n bytes match share their prefixes of up to
+	// 8*n bits, and every longer prefix of the second is new.
+	p := KeyProfile{Depth: size * 8, prefixes: make([]float64, size+1)}
+	p.prefixes[0] = 1
+	for i := 1; i < len(sorted); i++ {
+		n := 0
+		for n < size && sorted[i-1][n] == sorted[i][n] {
+			n++
+		}
+		for j := n + 1; j <= size; j++ {
+			p.prefixes[j]++
+		}
+	}
+	for j := 1; j <= size; j++ {
+		p.prefixes[j]++
+	}
+	return p, nil
+}
+
+// Workload describes how a map is used.
+type Workload struct {
+	// Lookups is the number of keys looked up with inclusion proofs.
+	Lookups float64
+	// Writes is the number of keys set, over the same period as Lookups.
+	Writes float64
+	// WriteBatch is the mean number of keys set in each revision.
+	WriteBatch float64
+}
+
+// CostModel gives the time taken by the storage operations that a map's
+// strata affect.
+type CostModel struct {
+	// SubtreeRead and SubtreeWrite are the cost of reading or writing a
+	// subtree row, however large it is.
+	SubtreeRead, SubtreeWrite time.Duration
+	// KBRead and KBWritten are the cost of each kilobyte of subtree data.
+	KBRead, KBWritten time.Duration
+	// Hash is the cost of a hash. Subtrees only store their leaves, so their
+	// internal nodes are hashed again each time they're read.
+	Hash time.Duration
+}
+
+// DefaultCostModel is a rough guide to the costs for MySQL on local SSDs.
+var DefaultCostModel = CostModel{
+	SubtreeRead:  200 * time.Microsecond,
+	SubtreeWrite: 500 * time.Microsecond,
+	KBRead:       10 * time.Microsecond,
+	KBWritten:    30 * time.Microsecond,
+	Hash:         time.Microsecond,
+}
+
+// StrataEstimate is the projected effect of storing a map in a set of strata.
+type StrataEstimate struct {
+	Strata []int
+	// SubtreesPerLookup, KBPerLookup and HashesPerLookup are the subtrees read
+	// to look up a key with its proof, their size, and the hashes needed to
+	// rebuild them.
+	SubtreesPerLookup, KBPerLookup, HashesPerLookup float64
+	// SubtreesPerRevision and KBPerRevision are the subtrees written by each
+	// revision, and their size. They have to be read first.
+	SubtreesPerRevision, KBPerRevision float64
+	// StoredKB is the size of the subtrees making up one revision of the tree.
+	// Each revision writes another KBPerRevision.
+	StoredKB float64
+	// LookupLatency and RevisionLatency are the projected storage time to look
+	// up a key and to write a revision.
+	LookupLatency, RevisionLatency time.Duration
+	// Cost is the projected storage time for the whole workload.
+	Cost time.Duration
+}
+
+// entryOverhead is the size of a subtree leaf's protobuf map entry, other than
+// its key and hash.
+const entryOverhead = 6
+
+// entryBytes returns the size of a leaf of a subtree depth levels deep.
+func entryBytes(depth, hashBytes int) float64 {
+	suffixBytes := 1 + depth/8
+	// Suffixes are base64 encoded
+	return float64(4*((suffixBytes+2)/3) + hashBytes + entryOverhead)
+}
+
+// internalNodes returns the number of internal nodes in a subtree depth levels
+// deep with leaves at random positions.
+func internalNodes(leaves float64, depth int) float64 {
+	n := 0.0
+	for h := 1; h <= depth; h++ {
+		n += occupied(math.Ldexp(1, depth-h), leaves)
+	}
+	return n
+}
+
+func scaleDuration(d time.Duration, n float64) time.Duration {
+	return time.Duration(float64(d) * n)
+}
+
+// EstimateStrata projects the cost of the workload on a map with profile p,
+// stored in the given strata.
+func EstimateStrata(p KeyProfile, w Workload, m CostModel, strata []int) (StrataEstimate, error) {
+	if err := ValidateStrata(p.Depth, strata); err != nil {
+		return StrataEstimate{}, err
+	}
+	e := StrataEstimate{Strata: strata}
+	hashBytes := p.Depth / 8
+	revisionHashes := 0.0
+	top := 0
+	for _, depth := range strata {
+		bottom := top + depth/8
+		subtrees := p.prefixes[top]
+		top = bottom
+		if subtrees == 0 {
+			continue
+		}
+		leaves := p.prefixes[bottom] / subtrees
+		kb := leaves * entryBytes(depth, hashBytes) / 1024
+		hashes := internalNodes(leaves, depth)
+
+		e.SubtreesPerLookup++
+		e.KBPerLookup += kb
+		e.HashesPerLookup += hashes
+
+		written := occupied(subtrees, w.WriteBatch)
+		e.SubtreesPerRevision += written
+		e.KBPerRevision += written * kb
+		revisionHashes += written * hashes
+
+		e.StoredKB += subtrees * kb
+	}
+
+	e.LookupLatency = scaleDuration(m.SubtreeRead, e.SubtreesPerLookup) +
+		scaleDuration(m.KBRead, e.KBPerLookup) +
+		scaleDuration(m.Hash, e.HashesPerLookup)
+	e.RevisionLatency = scaleDuration(m.SubtreeRead+m.SubtreeWrite, e.SubtreesPerRevision) +
+		scaleDuration(m.KBRead+m.KBWritten, e.KBPerRevision) +
+		scaleDuration(m.Hash, revisionHashes)
+	e.Cost = scaleDuration(e.LookupLatency, w.Lookups)
+	if w.WriteBatch > 0 {
+		e.Cost += scaleDuration(e.RevisionLatency, w.Writes/w.WriteBatch)
+	}
+	return e, nil
+}
+
+// maxTopStrata is the most strata of 8 levels that AdviseStrata considers
+// putting at the top of a tree.
+const maxTopStrata = 16
+
+// candidateStrata returns the strata AdviseStrata chooses from: up to
+// maxTopStrata strata of 8 levels at the top of the tree, where it's dense,
+// then strata of equal depth beneath them. Any remainder goes in a shallower
+// stratum at the bottom.
+func candidateStrata(depth int) [][]int {
+	var candidates [][]int
+	seen := make(map[string]bool)
+	for top := 0; top <= maxTopStrata && top*8 <= depth; top++ {
+		for d := 8; d <= MaxStratumDepth; d += 8 {
+			strata := make([]int, 0, top+depth/d+1)
+			for i := 0; i < top; i++ {
+				strata = append(strata, 8)
+			}
+			for left := depth - top*8; left > 0; left -= d {
+				if left < d {
+					strata = append(strata, left)
+					break
+				}
+				strata = append(strata, d)
+			}
+			if key := fmt.Sprint(strata); !seen[key] {
+				seen[key] = true
+				candidates = append(candidates, strata)
+			}
+		}
+	}
+	return candidates
+}
+
+type byCost []StrataEstimate
+
+func (e byCost) Len() int      { return len(e) }
+func (e byCost) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e byCost) Less(i, j int) bool {
+	if e[i].Cost != e[j].Cost {
+		return e[i].Cost < e[j].Cost
+	}
+	return len(e[i].Strata) < len(e[j].Strata)
+}
+
+// AdviseStrata estimates the cost of the workload on a map with profile p for
+// a range of strata, and returns the estimates cheapest first. The first is the
+// recommended strata for the map. The estimates are only as good as the cost
+// model, so strata that are close in cost should be treated as equivalent.
+func AdviseStrata(p KeyProfile, w Workload, m CostModel) ([]StrataEstimate, error) {
+	var estimates []StrataEstimate
+	for _, strata := range candidateStrata(p.Depth) {
+		e, err := EstimateStrata(p, w, m, strata)
+		if err != nil {
+			return nil, err
+		}
+		estimates = append(estimates, e)
+	}
+	sort.Sort(byCost(estimates))
+	return estimates, nil
+}
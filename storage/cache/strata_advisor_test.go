@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/google/trillian"
+)
+
+func TestKeyProfileFromHashes(t *testing.T) {
+	p, err := KeyProfileFromHashes([]trillian.Hash{{0x01, 0x00}, {0x00, 0x01}, {0x00, 0x00}, {0x01, 0x00}})
+	if err != nil {
+		t.Fatalf("KeyProfileFromHashes() = %v", err)
+	}
+	if got, want := p.Depth, 16; got != want {
+		t.Errorf("got depth %d, want %d", got, want)
+	}
+	if got, want := p.prefixes, []float64{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got prefix counts %v, want %v", got, want)
+	}
+	if got, want := p.Keys(), 3.0; got != want {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+
+	if _, err := KeyProfileFromHashes(nil); err == nil {
+		t.Error("KeyProfileFromHashes(nil) succeeded")
+	}
+	if _, err := KeyProfileFromHashes([]trillian.Hash{{0x01, 0x00}, {0x01}}); err == nil {
+		t.Error("KeyProfileFromHashes() succeeded for hashes of different lengths")
+	}
+}
+
+func TestUniformKeyProfile(t *testing.T) {
+	p := UniformKeyProfile(256, 1000000)
+	for _, test := range []struct {
+		bytes int
+		want  float64
+	}{
+		{bytes: 0, want: 1},
+		// Every 8 bit prefix is used
+		{bytes: 1, want: 256},
+		// A few keys share 24 bit prefixes
+		{bytes: 3, want: 16777216 * (1 - math.Exp(-1000000/16777216.0))},
+		{bytes: 32, want: 1000000},
+	} {
+		if got := p.prefixes[test.bytes]; math.Abs(got-test.want) > test.want*1e-6 {
+			t.Errorf("got %v distinct %d byte prefixes, want %v", got, test.bytes, test.want)
+		}
+	}
+	if got := UniformKeyProfile(256, 0).Keys(); got != 0 {
+		t.Errorf("got %v keys in empty profile", got)
+	}
+}
+
+func TestEstimateStrata(t *testing.T) {
+	p := UniformKeyProfile(256, 1000000)
+	w := Workload{Lookups: 1000, Writes: 100, WriteBatch: 10}
+	flat, err := EstimateStrata(p, w, DefaultCostModel, []int{8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 176})
+	if err != nil {
+		t.Fatalf("EstimateStrata() = %v", err)
+	}
+	if got, want := flat.SubtreesPerLookup, 11.0; got != want {
+		t.Errorf("got %v subtrees per lookup, want %v", got, want)
+	}
+	// Below the root, which is shared, keys written together are nearly always
+	// in different subtrees.
+	if got := flat.SubtreesPerRevision; got < 100 || got > 101 {
+		t.Errorf("got %v subtrees per revision, want about 101", got)
+	}
+	if want := scaleDuration(flat.LookupLatency, 1000) + scaleDuration(flat.RevisionLatency, 10); flat.Cost != want {
+		t.Errorf("got cost %v, want %v", flat.Cost, want)
+	}
+
+	// Deeper strata mean fewer subtrees to read, but bigger ones
+	deep, err := EstimateStrata(p, w, DefaultCostModel, []int{8, 248})
+	if err != nil {
+		t.Fatalf("EstimateStrata() = %v", err)
+	}
+	if deep.SubtreesPerLookup >= flat.SubtreesPerLookup || deep.KBPerLookup <= flat.KBPerLookup {
+		t.Errorf("got %v subtrees and %vKB per lookup for deep strata, want fewer and bigger than %v and %vKB", deep.SubtreesPerLookup, deep.KBPerLookup, flat.SubtreesPerLookup, flat.KBPerLookup)
+	}
+
+	if _, err := EstimateStrata(p, w, DefaultCostModel, []int{8, 8}); err == nil {
+		t.Error("EstimateStrata() succeeded with strata that don't cover the tree")
+	}
+}
+
+func TestAdviseStrata(t *testing.T) {
+	for _, p := range []KeyProfile{UniformKeyProfile(256, 10000000), UniformKeyProfile(512, 1000)} {
+		w := Workload{Lookups: 1000, Writes: 100, WriteBatch: 100}
+		estimates, err := AdviseStrata(p, w, DefaultCostModel)
+		if err != nil {
+			t.Fatalf("AdviseStrata() = %v", err)
+		}
+		if len(estimates) == 0 {
+			t.Fatal("AdviseStrata() made no estimates")
+		}
+		for i, e := range estimates {
+			if err := ValidateStrata(p.Depth, e.Strata); err != nil {
+				t.Errorf("AdviseStrata() suggested invalid strata %v: %v", e.Strata, err)
+			}
+			if i > 0 && e.Cost < estimates[i-1].Cost {
+				t.Errorf("AdviseStrata() estimate %d costs %v, less than the one before it", i, e.Cost)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/trillian/storage"
+)
+
+func TestFormatStrata(t *testing.T) {
+	for _, test := range []struct {
+		strata []int
+		want   string
+	}{
+		{nil, ""},
+		{[]int{256}, "256"},
+		{[]int{8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 176}, "8x10,176"},
+		{[]int{8, 16, 16, 8, 208}, "8,16x2,8,208"},
+	} {
+		if got := FormatStrata(test.strata); got != test.want {
+			t.Errorf("FormatStrata(%v) = %q, want %q", test.strata, got, test.want)
+		}
+	}
+}
+
+func TestParseStrata(t *testing.T) {
+	for _, test := range []struct {
+		s       string
+		want    []int
+		wantErr bool
+	}{
+		{s: ""},
+		{s: "256", want: []int{256}},
+		{s: "8x10,176", want: []int{8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 176}},
+		{s: " 8, 16x2 ,8,208", want: []int{8, 16, 16, 8, 208}},
+		{s: "8,,176", wantErr: true},
+		{s: "eight", wantErr: true},
+		{s: "8x", wantErr: true},
+		{s: "8x0,256", wantErr: true},
+	} {
+		got, err := ParseStrata(test.s)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("ParseStrata(%q) = %v, %v, want error %v", test.s, got, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseStrata(%q) = %v, want %v", test.s, got, test.want)
+		}
+	}
+}
+
+func TestStorageStrataAreValid(t *testing.T) {
+	for _, test := range []struct {
+		desc   string
+		strata storage.StrataFunc
+	}{
+		{desc: "LogStrata", strata: storage.LogStrata},
+		{desc: "MapStrata", strata: storage.MapStrata},
+	} {
+		for _, hashSize := range []int{32, 48, 64} {
+			depth, strata := test.strata(hashSize)
+			if err := ValidateStrata(depth, strata); err != nil {
+				t.Errorf("%s(%d) gave invalid strata: %v", test.desc, hashSize, err)
+			}
+		}
+	}
+}
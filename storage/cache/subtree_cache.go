@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
-	"math/big"
 	"sync"
 
 	"github.com/golang/glog"
@@ -45,6 +44,8 @@ type SubtreeCache struct {
 	mutex *sync.RWMutex
 
 	populateSubtree storage.PopulateSubtreeFunc
+	// preloadFanOut is the maximum number of concurrent fetches made by Preload.
+	preloadFanOut int
 }
 
 // Suffix represents the tail of a NodeID, indexing into the Subtree which
@@ -63,37 +64,33 @@ func (s Suffix) serialize() string {
 	return base64.StdEncoding.EncodeToString(r)
 }
 
-// NewSubtreeCache returns a newly intialised cache ready for use.
+// NewSubtreeCache returns a newly intialised cache ready for use, for a tree
+// 256 levels deep.
 // populateSubtree is a function which knows how to populate a subtree's
 // internal nodes given its leaves, and will be called for each subtree loaded
 // from storage.
-// TODO(al): consider supporting different sized subtrees - for now everything's subtrees of 8 levels.
 func NewSubtreeCache(strataDepths []int, populateSubtree storage.PopulateSubtreeFunc) SubtreeCache {
-	// TODO(al): pass this in
-	maxTreeDepth := 256
+	return NewSubtreeCacheForDepth(256, strataDepths, populateSubtree)
+}
+
+// NewSubtreeCacheForDepth returns a newly intialised cache for a tree
+// treeDepth levels deep, which for maps is the number of bits in the key hash.
+// It panics if the strata aren't valid for the depth, see ValidateStrata.
+// TODO(al): consider supporting different sized subtrees - for now everything's subtrees of 8 levels.
+func NewSubtreeCacheForDepth(treeDepth int, strataDepths []int, populateSubtree storage.PopulateSubtreeFunc) SubtreeCache {
+	if err := ValidateStrata(treeDepth, strataDepths); err != nil {
+		panic(err)
+	}
 	// Precalculate strata information based on the passed in strata depths:
-	sInfo := make([]stratumInfo, 0, maxTreeDepth/8)
+	sInfo := make([]stratumInfo, 0, treeDepth/8)
 	t := 0
 	for _, sDepth := range strataDepths {
-		// Verify the stratum depth makes sense:
-		if sDepth <= 0 {
-			panic(fmt.Errorf("got invalid strata depth of %d: can't be <= 0", sDepth))
-		}
-		if sDepth%8 != 0 {
-			panic(fmt.Errorf("got strata depth of %d, must be a multiple of 8", sDepth))
-		}
-
 		pb := t / 8
 		for i := 0; i < sDepth; i += 8 {
 			sInfo = append(sInfo, stratumInfo{pb, sDepth})
 			t += 8
 		}
 	}
-	// TODO(al): This needs to be passed in, particularly for Map use cases where
-	// we need to know it matches the number of bits in the chosen hash function.
-	if got, want := t, maxTreeDepth; got != want {
-		panic(fmt.Errorf("strata indicate tree of depth %d, but expected %d", got, want))
-	}
 
 	return SubtreeCache{
 		stratumInfo:     sInfo,
@@ -101,7 +98,35 @@ func NewSubtreeCache(strataDepths []int, populateSubtree storage.PopulateSubtree
 		dirtyPrefixes:   make(map[string]bool),
 		mutex:           new(sync.RWMutex),
 		populateSubtree: populateSubtree,
+		preloadFanOut:   DefaultPreloadFanOut,
+	}
+}
+
+// MaxStratumDepth is the deepest a single stratum can be, as the number of bits
+// in a Suffix is held in a byte.
+const MaxStratumDepth = 248
+
+// ValidateStrata returns an error unless every stratum depth is a positive
+// multiple of 8 no deeper than MaxStratumDepth, and together they add up to
+// treeDepth.
+func ValidateStrata(treeDepth int, strataDepths []int) error {
+	t := 0
+	for _, sDepth := range strataDepths {
+		if sDepth <= 0 {
+			return fmt.Errorf("got invalid strata depth of %d: can't be <= 0", sDepth)
+		}
+		if sDepth%8 != 0 {
+			return fmt.Errorf("got strata depth of %d, must be a multiple of 8", sDepth)
+		}
+		if sDepth > MaxStratumDepth {
+			return fmt.Errorf("got strata depth of %d, can't be more than %d", sDepth, MaxStratumDepth)
+		}
+		t += sDepth
 	}
+	if got, want := t, treeDepth; got != want {
+		return fmt.Errorf("strata indicate tree of depth %d, but expected %d", got, want)
+	}
+	return nil
 }
 
 func (s *SubtreeCache) stratumInfoForPrefixLength(numBits int) stratumInfo {
@@ -129,13 +154,30 @@ func (s *SubtreeCache) splitNodeID(id storage.NodeID) ([]byte, Suffix) {
 	return a[:prefixSplit], sfx
 }
 
+// DefaultPreloadFanOut is the number of concurrent subtree fetches Preload makes
+// unless changed with SetPreloadFanOut.
+const DefaultPreloadFanOut = 4
+
+// SetPreloadFanOut sets the maximum number of concurrent subtree fetches made by
+// Preload. Values less than one are treated as one.
+func (s *SubtreeCache) SetPreloadFanOut(n int) {
+	if n < 1 {
+		n = 1
+	}
+	s.preloadFanOut = n
+}
+
 // Preload populates the cache based on a specified set of NodeIDs.
+// The subtrees needed are fetched in up to the preload fan out batches, which
+// are fetched and populated concurrently, so getSubtrees must be safe to call
+// from multiple goroutines. Subtrees which storage doesn't hold are cached as
+// empty so that they won't be fetched again one at a time by GetNodeHash.
 func (s *SubtreeCache) Preload(ids []storage.NodeID, getSubtrees func(id []storage.NodeID) ([]*storage.SubtreeProto, error)) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	// Figure out the set of subtrees we need:
-	want := make(map[string]*storage.NodeID)
+	want := make(map[string]storage.NodeID)
 	for _, id := range ids {
 		id := id
 		px, _ := s.splitNodeID(id)
@@ -144,25 +186,88 @@ func (s *SubtreeCache) Preload(ids []storage.NodeID, getSubtrees func(id []stora
 		// TODO(al): fix for non-uniform strata
 		id.PrefixLenBits = len(px) * 8
 		if !ok {
-			want[pxKey] = &id
+			want[pxKey] = id
 		}
 	}
+	if len(want) == 0 {
+		return nil
+	}
 
 	list := make([]storage.NodeID, 0, len(want))
 	for _, v := range want {
-		list = append(list, *v)
+		list = append(list, v)
 	}
-	subtrees, err := getSubtrees(list)
-	if err != nil {
-		return err
+
+	fanOut := s.preloadFanOut
+	if fanOut < 1 {
+		fanOut = 1
+	}
+	batchSize := (len(list) + fanOut - 1) / fanOut
+	var batches [][]storage.NodeID
+	for len(list) > 0 {
+		n := batchSize
+		if n > len(list) {
+			n = len(list)
+		}
+		batches = append(batches, list[:n])
+		list = list[n:]
+	}
+
+	results := make([][]*storage.SubtreeProto, len(batches))
+	errs := make([]error, len(batches))
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		wg.Add(1)
+		go func(i int, batch []storage.NodeID) {
+			defer wg.Done()
+			subtrees, err := getSubtrees(batch)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			for _, t := range subtrees {
+				if err := s.populateSubtree(t); err != nil {
+					errs[i] = err
+					return
+				}
+			}
+			results[i] = subtrees
+		}(i, batch)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
 	}
-	for _, t := range subtrees {
-		s.populateSubtree(t)
-		s.subtrees[string(t.Prefix)] = t
+	for _, subtrees := range results {
+		for _, t := range subtrees {
+			s.subtrees[string(t.Prefix)] = t
+			delete(want, string(t.Prefix))
+		}
+	}
+
+	// Anything left has never been written
+	for pxKey, id := range want {
+		s.subtrees[pxKey] = s.newEmptySubtree(id.Path[:len(pxKey)], id.PrefixLenBits)
 	}
 	return nil
 }
 
+// newEmptySubtree returns an empty subtree with the given prefix, for use when
+// storage doesn't hold one yet.
+func (s *SubtreeCache) newEmptySubtree(px []byte, prefixLenBits int) *storage.SubtreeProto {
+	sInfo := s.stratumInfoForPrefixLength(prefixLenBits)
+	glog.V(1).Infof("Creating new empty subtree for %v, with depth %d", px, sInfo.depth)
+	return &storage.SubtreeProto{
+		Prefix:        px,
+		Depth:         int32(sInfo.depth),
+		Leaves:        make(map[string][]byte),
+		InternalNodes: make(map[string][]byte),
+	}
+}
+
 // GetNodeHash retrieves the previously written hash and corresponding tree
 // revision for the given node ID.
 func (s *SubtreeCache) GetNodeHash(id storage.NodeID, getSubtree GetSubtreeFunc) (trillian.Hash, error) {
@@ -185,18 +290,11 @@ func (s *SubtreeCache) getNodeHashUnderLock(id storage.NodeID, getSubtree GetSub
 		if err != nil {
 			return nil, err
 		}
-		sInfo := s.stratumInfoForPrefixLength(subID.PrefixLenBits)
 		if c == nil {
-			glog.V(1).Infof("Creating new empty subtree for %v, with depth %d", px, sInfo.depth)
 			// storage didn't have one for us, so we'll store an empty proto here
 			// incase we try to update it later on (we won't flush it back to
 			// storage unless it's been written to.)
-			c = &storage.SubtreeProto{
-				Prefix:        px,
-				Depth:         int32(sInfo.depth),
-				Leaves:        make(map[string][]byte),
-				InternalNodes: make(map[string][]byte),
-			}
+			c = s.newEmptySubtree(px, subID.PrefixLenBits)
 		} else {
 			if err := s.populateSubtree(c); err != nil {
 				return nil, err
@@ -311,13 +409,22 @@ func makeSuffixKey(depth int, index int64) (string, error) {
 // PopulateMapSubtreeNodes re-creates Map subtree's InternalNodes from the
 // subtree Leaves map.
 //
-// This uses HStar2 to repopulate internal nodes.
+// The nodes are calculated a level at a time from the leaves up, so that each
+// level can be hashed as a single batch. Empty branches are filled in from the
+// shared table of empty hashes and are not stored. This produces the same nodes
+// as HStar2.
 func PopulateMapSubtreeNodes(treeHasher merkle.TreeHasher) storage.PopulateSubtreeFunc {
 	return func(st *storage.SubtreeProto) error {
 		st.InternalNodes = make(map[string][]byte)
 		rootID := storage.NewNodeIDFromHash(st.Prefix)
 		fullTreeDepth := treeHasher.Size() * 8
-		leaves := make([]merkle.HStar2LeafHash, 0, len(st.Leaves))
+		depth := int(st.Depth)
+		// offset is the height in the full tree of the bottom of this subtree.
+		offset := fullTreeDepth - rootID.PrefixLenBits - depth
+		empty := merkle.EmptyHashesFor(treeHasher)
+
+		// level holds the non-empty nodes at the current height, by index.
+		level := make(map[int64]trillian.Hash, len(st.Leaves))
 		for k64, v := range st.Leaves {
 			k, err := base64.StdEncoding.DecodeString(k64)
 			if err != nil {
@@ -326,31 +433,61 @@ func PopulateMapSubtreeNodes(treeHasher merkle.TreeHasher) storage.PopulateSubtr
 			if k[0]%8 != 0 {
 				return fmt.Errorf("unexpected non-leaf suffix found: %x", k)
 			}
-			leaves = append(leaves, merkle.HStar2LeafHash{
-				LeafHash: v,
-				Index:    big.NewInt(int64(k[1])),
-			})
+			index := int64(k[1])
+			if _, ok := level[index]; ok {
+				return fmt.Errorf("found more than one leaf at index %d", index)
+			}
+			level[index] = v
 		}
-		hs2 := merkle.NewHStar2(treeHasher)
-		offset := fullTreeDepth - rootID.PrefixLenBits - int(st.Depth)
-		root, err := hs2.HStar2Nodes(int(st.Depth), offset, leaves,
-			func(depth int, index *big.Int) (trillian.Hash, error) {
-				return nil, nil
-			},
-			func(depth int, index *big.Int, h trillian.Hash) error {
-				i := index.Int64()
-				sfx, err := makeSuffixKey(depth, i)
+
+		for height := 0; height < depth; height++ {
+			parents := make(map[int64]bool, len(level))
+			for index := range level {
+				parents[index>>1] = true
+			}
+
+			emptyChild := empty[height+offset]
+			indices := make([]int64, 0, len(parents))
+			lefts := make([][]byte, 0, len(parents))
+			rights := make([][]byte, 0, len(parents))
+			for p := range parents {
+				l, ok := level[2*p]
+				if !ok {
+					l = emptyChild
+				}
+				r, ok := level[2*p+1]
+				if !ok {
+					r = emptyChild
+				}
+				indices = append(indices, p)
+				lefts = append(lefts, l)
+				rights = append(rights, r)
+			}
+
+			hashes, err := treeHasher.HashChildrenBatch(lefts, rights)
+			if err != nil {
+				return err
+			}
+
+			next := make(map[int64]trillian.Hash, len(indices))
+			for i, p := range indices {
+				next[p] = hashes[i]
+				// Nodes are keyed by the index of their leftmost leaf
+				sfx, err := makeSuffixKey(depth-height-1, p<<uint(height+1))
 				if err != nil {
 					return err
 				}
-				st.InternalNodes[sfx] = h
-				return nil
-			})
-		if err != nil {
-			return err
+				st.InternalNodes[sfx] = hashes[i]
+			}
+			level = next
+		}
+
+		root, ok := level[0]
+		if !ok {
+			root = empty[depth+offset]
 		}
 		st.RootHash = root
-		return err
+		return nil
 	}
 }
 
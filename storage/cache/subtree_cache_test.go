@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -97,6 +99,71 @@ func noFetch(id storage.NodeID) (*storage.SubtreeProto, error) {
 	return nil, errors.New("not supposed to read anything")
 }
 
+func TestPreloadFetchesConcurrently(t *testing.T) {
+	for _, fanOut := range []int{1, 2, DefaultPreloadFanOut, 20} {
+		c := NewSubtreeCache(defaultMapStrata, PopulateMapSubtreeNodes(merkle.NewRFC6962TreeHasher(trillian.NewSHA256())))
+		c.SetPreloadFanOut(fanOut)
+
+		nodeID := storage.NewNodeIDFromHash(bytes.Repeat([]byte{0x5a}, 32))
+		sibs := nodeID.Siblings()
+
+		var mu sync.Mutex
+		calls := 0
+		fetched := make(map[string]bool)
+		err := c.Preload(sibs, func(ids []storage.NodeID) ([]*storage.SubtreeProto, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			for _, id := range ids {
+				px := string(id.Path[:id.PrefixLenBits/8])
+				if fetched[px] {
+					t.Errorf("fan out %d: subtree %x fetched more than once", fanOut, px)
+				}
+				fetched[px] = true
+			}
+			// Storage holds only the root subtree
+			if fetched[""] {
+				return []*storage.SubtreeProto{{Prefix: []byte{}, Depth: 8}}, nil
+			}
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("fan out %d: Preload failed: %v", fanOut, err)
+		}
+
+		// There is one subtree per stratum along the path
+		if got, want := len(fetched), len(defaultMapStrata); got != want {
+			t.Errorf("fan out %d: fetched %d subtrees, want %d", fanOut, got, want)
+		}
+		maxCalls := fanOut
+		if maxCalls > len(defaultMapStrata) {
+			maxCalls = len(defaultMapStrata)
+		}
+		if calls > maxCalls {
+			t.Errorf("fan out %d: made %d fetches, want at most %d", fanOut, calls, maxCalls)
+		}
+
+		// Everything, including subtrees storage didn't have, should now be cached
+		for _, sib := range sibs {
+			if _, err := c.GetNodeHash(sib, noFetch); err != nil {
+				t.Fatalf("fan out %d: GetNodeHash after Preload failed: %v", fanOut, err)
+			}
+		}
+	}
+}
+
+func TestPreloadError(t *testing.T) {
+	c := NewSubtreeCache(defaultMapStrata, PopulateMapSubtreeNodes(merkle.NewRFC6962TreeHasher(trillian.NewSHA256())))
+
+	nodeID := storage.NewNodeIDFromHash(bytes.Repeat([]byte{0x5a}, 32))
+	err := c.Preload(nodeID.Siblings(), func(ids []storage.NodeID) ([]*storage.SubtreeProto, error) {
+		return nil, errors.New("fetch failed")
+	})
+	if err == nil {
+		t.Fatalf("Expected Preload to return fetch error")
+	}
+}
+
 func TestCacheFlush(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -239,6 +306,67 @@ func TestRepopulateMapSubtreeKAT(t *testing.T) {
 	}
 }
 
+// populateMapSubtreeWithHStar2 populates st's internal nodes one hash at a time
+// using HStar2, to check the batched population against.
+func populateMapSubtreeWithHStar2(t *testing.T, hasher merkle.TreeHasher, st *storage.SubtreeProto) {
+	st.InternalNodes = make(map[string][]byte)
+	rootID := storage.NewNodeIDFromHash(st.Prefix)
+	leaves := make([]merkle.HStar2LeafHash, 0, len(st.Leaves))
+	for k64, v := range st.Leaves {
+		k, err := base64.StdEncoding.DecodeString(k64)
+		if err != nil {
+			t.Fatalf("invalid leaf key: %v", err)
+		}
+		leaves = append(leaves, merkle.HStar2LeafHash{LeafHash: v, Index: big.NewInt(int64(k[1]))})
+	}
+	hs2 := merkle.NewHStar2(hasher)
+	offset := hasher.Size()*8 - rootID.PrefixLenBits - int(st.Depth)
+	root, err := hs2.HStar2Nodes(int(st.Depth), offset, leaves,
+		func(int, *big.Int) (trillian.Hash, error) { return nil, nil },
+		func(depth int, index *big.Int, h trillian.Hash) error {
+			sfx, err := makeSuffixKey(depth, index.Int64())
+			if err != nil {
+				return err
+			}
+			st.InternalNodes[sfx] = h
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("HStar2Nodes failed: %v", err)
+	}
+	st.RootHash = root
+}
+
+func TestPopulateMapSubtreeMatchesHStar2(t *testing.T) {
+	hasher := merkle.NewRFC6962TreeHasher(trillian.NewSHA256())
+	populate := PopulateMapSubtreeNodes(hasher)
+
+	for _, indices := range [][]int{{}, {0}, {255}, {3, 4}, {0, 1, 2, 128, 200, 255}} {
+		leaves := make(map[string][]byte)
+		for _, i := range indices {
+			sfx, err := makeSuffixKey(8, int64(i))
+			if err != nil {
+				t.Fatalf("makeSuffixKey failed: %v", err)
+			}
+			leaves[sfx] = hasher.HashLeaf([]byte(fmt.Sprintf("leaf %d", i)))
+		}
+
+		got := &storage.SubtreeProto{Prefix: []byte{0x12, 0x34}, Depth: 8, Leaves: leaves}
+		want := &storage.SubtreeProto{Prefix: []byte{0x12, 0x34}, Depth: 8, Leaves: leaves}
+		if err := populate(got); err != nil {
+			t.Fatalf("%v: populate failed: %v", indices, err)
+		}
+		populateMapSubtreeWithHStar2(t, hasher, want)
+
+		if !bytes.Equal(got.RootHash, want.RootHash) {
+			t.Errorf("%v: got root %x, want %x", indices, got.RootHash, want.RootHash)
+		}
+		if !reflect.DeepEqual(got.InternalNodes, want.InternalNodes) {
+			t.Errorf("%v: got internal nodes %v, want %v", indices, got.InternalNodes, want.InternalNodes)
+		}
+	}
+}
+
 func TestRepopulateLogSubtree(t *testing.T) {
 	hasher := merkle.NewRFC6962TreeHasher(trillian.NewSHA256())
 	populateTheThing := PopulateLogSubtreeNodes(hasher)
@@ -393,3 +521,63 @@ func TestGetStratumInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateStrata(t *testing.T) {
+	for _, tc := range []struct {
+		depth   int
+		strata  []int
+		wantErr bool
+	}{
+		{depth: 256, strata: defaultMapStrata},
+		{depth: 256, strata: defaultLogStrata},
+		{depth: 512, strata: []int{8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 176, 176, 80}},
+		{depth: 512, strata: []int{8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 432}, wantErr: true},
+		{depth: 512, strata: defaultMapStrata, wantErr: true},
+		{depth: 256, strata: []int{8, 0, 248}, wantErr: true},
+		{depth: 256, strata: []int{8, -8, 256}, wantErr: true},
+		{depth: 256, strata: []int{4, 252}, wantErr: true},
+	} {
+		if err := ValidateStrata(tc.depth, tc.strata); (err != nil) != tc.wantErr {
+			t.Errorf("ValidateStrata(%d, %v) = %v, want error %v", tc.depth, tc.strata, err, tc.wantErr)
+		}
+	}
+}
+
+func TestGetStratumInfoForDeeperTree(t *testing.T) {
+	h, err := trillian.NewHasher(trillian.HashAlgorithm_SHA512)
+	if err != nil {
+		t.Fatalf("NewHasher() = %v", err)
+	}
+	strata := []int{8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 176, 176, 80}
+	c := NewSubtreeCacheForDepth(512, strata, PopulateMapSubtreeNodes(merkle.NewRFC6962TreeHasher(h)))
+	for _, tv := range []struct {
+		depth int
+		info  stratumInfo
+	}{
+		{79, stratumInfo{9, 8}},
+		{80, stratumInfo{10, 176}},
+		{255, stratumInfo{10, 176}},
+		{256, stratumInfo{32, 176}},
+		{432, stratumInfo{54, 80}},
+		{511, stratumInfo{54, 80}},
+	} {
+		if got, want := c.stratumInfoForPrefixLength(tv.depth), tv.info; !reflect.DeepEqual(got, want) {
+			t.Errorf("stratumInfoForPrefixLength(%d) = %#v, want %#v", tv.depth, got, want)
+		}
+	}
+
+	// The leaf at the bottom of the tree is in the last stratum.
+	id := storage.NewNodeIDFromHash(h.Digest([]byte("key")))
+	if prefix, _ := c.splitNodeID(id); len(prefix) != 54 {
+		t.Errorf("splitNodeID() gave prefix of %d bytes, want 54", len(prefix))
+	}
+}
+
+func TestNewSubtreeCacheForDepthPanicsOnBadStrata(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("NewSubtreeCacheForDepth() didn't panic for strata not matching the depth")
+		}
+	}()
+	NewSubtreeCacheForDepth(512, defaultMapStrata, PopulateMapSubtreeNodes(merkle.NewRFC6962TreeHasher(trillian.NewSHA256())))
+}
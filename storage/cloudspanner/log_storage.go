@@ -0,0 +1,950 @@
+package cloudspanner
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/cache"
+	"golang.org/x/net/context"
+)
+
+const getTreePropertiesSQL = "SELECT AllowsDuplicateLeaves, DuplicatePolicy, TreeType FROM Trees WHERE TreeId=@tree"
+const getTreeParametersSQL = "SELECT ReadOnlyRequests, SequenceGuardSeconds, MaxRootDurationSeconds, TreeState FROM TreeControl WHERE TreeId=@tree"
+const selectQueuedLeavesSQL = `SELECT LeafHash, MessageId, Payload, QueueTimestampNanos
+	 FROM Unsequenced@{FORCE_INDEX=UnsequencedQueueTimestampIdx}
+	 WHERE TreeId=@tree AND QueueTimestampNanos<=@cutoff AND MessageId NOT IN UNNEST(@dequeued)
+	 ORDER BY QueueTimestampNanos DESC, LeafHash ASC LIMIT @limit`
+const selectUnsequencedLeavesByHashSQL = `SELECT LeafHash, Payload FROM Unsequenced
+	 WHERE TreeId=@tree AND LeafHash IN UNNEST(@hashes) AND MessageId NOT IN UNNEST(@dequeued)`
+const selectOldestQueuedLeafSQL = `SELECT MIN(QueueTimestampNanos) FROM Unsequenced
+	 WHERE TreeId=@tree AND MessageId NOT IN UNNEST(@dequeued)`
+const selectSequencedLeafCountSQL = "SELECT COUNT(*) FROM SequencedLeafData WHERE TreeId=@tree"
+const selectLeafIndexRangeByTimeSQL = `SELECT MIN(SequenceNumber), MAX(SequenceNumber)
+	 FROM SequencedLeafData
+	 WHERE TreeId=@tree AND IntegrateTimestampNanos>=@start AND IntegrateTimestampNanos<@end`
+const selectLeafCountBeforeTimeSQL = `SELECT COUNT(*) FROM SequencedLeafData
+	 WHERE TreeId=@tree AND IntegrateTimestampNanos<@start`
+const selectLatestSignedLogRootSQL = `SELECT TreeHeadTimestamp, TreeSize, RootHash, TreeRevision, RootSignature
+	 FROM TreeHead WHERE TreeId=@tree AND TreeHeadTimestamp NOT IN UNNEST(@deleted)
+	 ORDER BY TreeRevision DESC LIMIT 1`
+const selectLatestTreeRevisionSQL = `SELECT TreeRevision FROM TreeHead WHERE TreeId=@tree
+	 ORDER BY TreeRevision DESC LIMIT 1`
+const selectLogRootCosignaturesSQL = `SELECT WitnessId, Signature FROM TreeHeadCosignature
+	 WHERE TreeId=@tree AND TreeRevision=@revision ORDER BY WitnessId`
+const selectLeavesByIndexSQL = `SELECT l.LeafHash, l.TheData, s.SequenceNumber, s.IntegrateTimestampNanos
+	 FROM SequencedLeafData s INNER JOIN LeafData l ON l.TreeId=s.TreeId AND l.LeafHash=s.LeafHash
+	 WHERE s.TreeId=@tree AND s.SequenceNumber IN UNNEST(@indices)`
+const selectLeavesByRangeSQL = `SELECT l.LeafHash, l.TheData, s.SequenceNumber, s.IntegrateTimestampNanos
+	 FROM SequencedLeafData s INNER JOIN LeafData l ON l.TreeId=s.TreeId AND l.LeafHash=s.LeafHash
+	 WHERE s.TreeId=@tree AND s.SequenceNumber>=@start
+	 ORDER BY s.SequenceNumber LIMIT @count`
+const selectLeavesByHashSQL = `SELECT l.LeafHash, l.TheData, s.SequenceNumber, s.IntegrateTimestampNanos
+	 FROM SequencedLeafData@{FORCE_INDEX=SequencedLeafHashIdx} s INNER JOIN LeafData l ON l.TreeId=s.TreeId AND l.LeafHash=s.LeafHash
+	 WHERE s.TreeId=@tree AND s.LeafHash IN UNNEST(@hashes)`
+
+// Same as above except with leaves ordered by sequence so we only incur this cost when necessary
+const selectLeavesByHashOrderedBySequenceSQL = selectLeavesByHashSQL + " ORDER BY s.SequenceNumber"
+
+const selectStagedLeavesByIndexSQL = `SELECT l.LeafHash, l.TheData, s.SequenceNumber, 0
+	 FROM StagedLeafData s INNER JOIN LeafData l ON l.TreeId=s.TreeId AND l.LeafHash=s.LeafHash
+	 WHERE s.TreeId=@tree AND s.SequenceNumber IN UNNEST(@indices) AND s.SequenceNumber NOT IN UNNEST(@dequeued)`
+const selectStagedLeavesByRangeSQL = `SELECT l.LeafHash, l.TheData, s.SequenceNumber, 0
+	 FROM StagedLeafData s INNER JOIN LeafData l ON l.TreeId=s.TreeId AND l.LeafHash=s.LeafHash
+	 WHERE s.TreeId=@tree AND s.SequenceNumber>=@start AND s.SequenceNumber NOT IN UNNEST(@dequeued)
+	 ORDER BY s.SequenceNumber LIMIT @count`
+
+const selectActiveLogsSQL = "SELECT TreeId, KeyId FROM Trees WHERE TreeType IN ('LOG', 'PREORDERED_LOG')"
+const selectActiveLogsWithUnsequencedSQL = `SELECT t.TreeId, t.KeyId FROM Trees t
+	 WHERE t.TreeType IN ('LOG', 'PREORDERED_LOG')
+	 AND (EXISTS (SELECT 1 FROM Unsequenced u WHERE u.TreeId=t.TreeId)
+	 OR EXISTS (SELECT 1 FROM StagedLeafData s WHERE s.TreeId=t.TreeId))`
+
+var treeHeadColumns = []string{"TreeId", "TreeHeadTimestamp", "TreeSize", "RootHash", "TreeRevision", "RootSignature"}
+var treeHeadCosignatureColumns = []string{"TreeId", "TreeRevision", "WitnessId", "Signature"}
+var leafDataColumns = []string{"TreeId", "LeafHash", "TheData"}
+var unsequencedColumns = []string{"TreeId", "LeafHash", "MessageId", "Payload", "QueueTimestampNanos"}
+var sequencedLeafDataColumns = []string{"TreeId", "SequenceNumber", "LeafHash", "IntegrateTimestampNanos"}
+var stagedLeafDataColumns = []string{"TreeId", "SequenceNumber", "LeafHash"}
+
+type spannerLogStorage struct {
+	*spannerTreeStorage
+
+	logID           trillian.LogID
+	allowDuplicates bool
+	duplicatePolicy trillian.DuplicatePolicy
+	preordered      bool
+	readOnly        bool
+	treeState       trillian.TreeState
+	// sequenceGuard is zero if the log uses the sequencer's default
+	sequenceGuard time.Duration
+	// maxRootDuration is zero if the log uses the signer's default
+	maxRootDuration time.Duration
+}
+
+// NewLogStorage creates a LogStorage for the log id in the Spanner database
+// that client is connected to.
+func NewLogStorage(client *spanner.Client, id trillian.LogID) (storage.LogStorage, error) {
+	ts, err := newTreeStorage(client, id.TreeID, storage.LogStrata, cache.PopulateLogSubtreeNodes)
+	if err != nil {
+		glog.Warningf("Couldn't create a new treeStorage: %s", err)
+		return nil, err
+	}
+	ts.readHeadRevision = func(ctx context.Context, r rowReader) (int64, error) {
+		revision := int64(-1)
+		_, err := queryRow(ctx, r, selectLatestTreeRevisionSQL, map[string]interface{}{"tree": id.TreeID}, &revision)
+		return revision, err
+	}
+
+	s := spannerLogStorage{
+		spannerTreeStorage: ts,
+		logID:              id,
+	}
+
+	ctx := context.Background()
+	params := map[string]interface{}{"tree": id.TreeID}
+
+	// Logs without a Trees row merge duplicates, as in the MySQL storage
+	var policyName, treeType spanner.NullString
+	if _, err := queryRow(ctx, client.Single(), getTreePropertiesSQL, params, &s.allowDuplicates, &policyName, &treeType); err != nil {
+		glog.Warningf("Failed to get trees row for id %v: %s", id, err)
+		return nil, err
+	}
+	if s.duplicatePolicy, err = storage.ParseDuplicatePolicy(policyName.StringVal, s.allowDuplicates); err != nil {
+		glog.Warningf("Tree %v has a bad duplicate policy: %s", id, err)
+		return nil, err
+	}
+	s.allowDuplicates = s.duplicatePolicy == trillian.DuplicatePolicy_ALLOW_DUPLICATES
+	s.preordered = treeType.StringVal == trillian.TreeType_PREORDERED_LOG.String()
+
+	var readOnly spanner.NullBool
+	var sequenceGuard, maxRootDuration spanner.NullInt64
+	var stateName spanner.NullString
+	found, err := queryRow(ctx, client.Single(), getTreeParametersSQL, params, &readOnly, &sequenceGuard, &maxRootDuration, &stateName)
+	if err != nil {
+		glog.Warningf("Failed to get tree control for id %v: %s", id, err)
+		return nil, err
+	}
+	if !found {
+		glog.Warningf("*** Opening storage for log: %v but it has no params configured ***", id)
+	}
+	if s.treeState, err = storage.ParseTreeState(stateName.StringVal, readOnly.Bool); err != nil {
+		glog.Warningf("Tree %v has a bad state: %s", id, err)
+		return nil, err
+	}
+	s.readOnly = storage.ReadOnlyTreeState(s.treeState)
+	s.sequenceGuard = time.Duration(sequenceGuard.Int64) * time.Second
+	s.maxRootDuration = time.Duration(maxRootDuration.Int64) * time.Second
+
+	return &s, nil
+}
+
+// MaxRootDuration returns how old the log's latest root can get before it's re-signed.
+func (m *spannerLogStorage) MaxRootDuration() time.Duration {
+	return m.maxRootDuration
+}
+
+// SequenceGuard returns how long leaves stay queued before they're sequenced.
+func (m *spannerLogStorage) SequenceGuard() time.Duration {
+	return m.sequenceGuard
+}
+
+// DuplicatePolicy returns what the log does with leaves already in it.
+func (m *spannerLogStorage) DuplicatePolicy() trillian.DuplicatePolicy {
+	return m.duplicatePolicy
+}
+
+// TreeState returns whether the log is active, frozen, draining or archived.
+func (m *spannerLogStorage) TreeState() trillian.TreeState {
+	return m.treeState
+}
+
+// TreeType returns whether the log is pre-ordered.
+func (m *spannerLogStorage) TreeType() trillian.TreeType {
+	if m.preordered {
+		return trillian.TreeType_PREORDERED_LOG
+	}
+	return trillian.TreeType_LOG
+}
+
+func (m *spannerLogStorage) beginInternal() (*logTX, error) {
+	ttx, err := m.beginTreeTx()
+	if err != nil {
+		return nil, err
+	}
+	return &logTX{
+		treeTX:    ttx,
+		ls:        m,
+		dequeued:  make(map[string]bool),
+		sequenced: make(map[int64]trillian.LogLeaf),
+		staged:    make(map[int64]*trillian.LogLeaf),
+		cosigs:    make(map[int64]map[string]*trillian.Cosignature),
+	}, nil
+}
+
+func (m *spannerLogStorage) Begin() (storage.LogTX, error) {
+	// Reject attempts to start a writable transaction in read only mode. Anything that
+	// doesn't write is a part of Snapshot so is still available via that API.
+	if m.readOnly {
+		return nil, storage.ErrReadOnly
+	}
+
+	return m.beginInternal()
+}
+
+func (m *spannerLogStorage) Snapshot() (storage.ReadOnlyLogTX, error) {
+	return m.beginInternal()
+}
+
+type logTX struct {
+	treeTX
+	ls *spannerLogStorage
+
+	// The rows the transaction has written and deleted, as Spanner doesn't
+	// show a transaction its own buffered mutations. Reads merge them with the
+	// rows they read.
+
+	// queued are the leaves queued by the transaction
+	queued []queuedLeaf
+	// dequeued holds the message IDs of the queued leaves it has dequeued
+	dequeued map[string]bool
+	// sequenced are the leaves it has sequenced, by sequence number
+	sequenced map[int64]trillian.LogLeaf
+	// staged are the leaves it has staged, by sequence number, with nil for
+	// those it has dequeued
+	staged map[int64]*trillian.LogLeaf
+	// stagedDequeued are the sequence numbers of the staged leaves it has
+	// dequeued
+	stagedDequeued deletedKeys
+	// root is the latest root it has stored, if any
+	root *trillian.SignedLogRoot
+	// deletedHeads are the timestamps of the roots it has deleted
+	deletedHeads deletedKeys
+	// cosigs are the cosignatures it has stored by tree revision and witness,
+	// with nil for those it has deleted
+	cosigs map[int64]map[string]*trillian.Cosignature
+}
+
+// queuedLeaf is a leaf queued by a transaction.
+type queuedLeaf struct {
+	leaf      trillian.LogLeaf
+	messageID []byte
+}
+
+// dequeuedParam returns the message IDs of the dequeued leaves as a query
+// parameter, which is never NULL.
+func (t *logTX) dequeuedParam() [][]byte {
+	ret := make([][]byte, 0, len(t.dequeued))
+	for id := range t.dequeued {
+		ret = append(ret, []byte(id))
+	}
+	return ret
+}
+
+// dequeue buffers the removal of a queued leaf.
+func (t *logTX) dequeue(leafHash, messageID []byte) {
+	t.buffer(spanner.Delete("Unsequenced", spanner.Key{t.ls.logID.TreeID, leafHash, messageID}))
+	t.dequeued[string(messageID)] = true
+}
+
+// pendingQueued returns the leaves queued by the transaction that it hasn't
+// dequeued.
+func (t *logTX) pendingQueued() []queuedLeaf {
+	var ret []queuedLeaf
+	for _, q := range t.queued {
+		if !t.dequeued[string(q.messageID)] {
+			ret = append(ret, q)
+		}
+	}
+	return ret
+}
+
+func (t *logTX) WriteRevision() int64 {
+	return t.treeTX.writeRevision
+}
+
+// DequeueLeaves returns queued leaves and deletes them from the queue when the
+// transaction commits. As the leaves are sequenced at the write revision two
+// sequencers can't both commit the same leaves.
+func (t *logTX) DequeueLeaves(limit int, guardWindow time.Duration) ([]trillian.LogLeaf, error) {
+	cutoff := time.Now().Add(-guardWindow).UnixNano()
+	params := map[string]interface{}{
+		"tree":     t.ls.logID.TreeID,
+		"cutoff":   cutoff,
+		"limit":    int64(limit),
+		"dequeued": t.dequeuedParam(),
+	}
+
+	var candidates []queuedLeaf
+	err := t.query(selectQueuedLeavesSQL, params, func(row *spanner.Row) error {
+		var leafHash, messageID, payload []byte
+		var queueTimestamp int64
+		if err := row.Columns(&leafHash, &messageID, &payload, &queueTimestamp); err != nil {
+			glog.Warningf("Error scanning work rows: %s", err)
+			return err
+		}
+
+		if len(leafHash) != t.ts.hashSizeBytes {
+			return errors.New("Dequeued a leaf with incorrect hash size")
+		}
+
+		candidates = append(candidates, queuedLeaf{
+			leaf: trillian.LogLeaf{
+				Leaf: trillian.Leaf{
+					LeafHash:  leafHash,
+					LeafValue: payload,
+				},
+				QueueTimestampNanos: queueTimestamp,
+			},
+			messageID: messageID,
+		})
+		return nil
+	})
+	if err != nil {
+		glog.Warningf("Failed to select rows for work: %s", err)
+		return nil, err
+	}
+
+	for _, q := range t.pendingQueued() {
+		if q.leaf.QueueTimestampNanos <= cutoff {
+			candidates = append(candidates, q)
+		}
+	}
+	// In the same order as the query
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i].leaf, candidates[j].leaf
+		if a.QueueTimestampNanos != b.QueueTimestampNanos {
+			return a.QueueTimestampNanos > b.QueueTimestampNanos
+		}
+		return bytes.Compare(a.LeafHash, b.LeafHash) < 0
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	leaves := make([]trillian.LogLeaf, 0, len(candidates))
+	for _, q := range candidates {
+		// The convention is that if leaf processing succeeds (by committing this tx)
+		// then the unsequenced entries for them are removed
+		t.dequeue(q.leaf.LeafHash, q.messageID)
+		leaves = append(leaves, q.leaf)
+	}
+
+	if len(leaves) > 0 {
+		t.writesRevision = true
+	}
+	return leaves, nil
+}
+
+func (t *logTX) QueueLeaves(leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
+	// Don't accept batches if any of the leaves are invalid.
+	for _, leaf := range leaves {
+		if len(leaf.LeafHash) != t.ts.hashSizeBytes {
+			return nil, fmt.Errorf("Queued leaf must have a hash of length %d", t.ts.hashSizeBytes)
+		}
+	}
+
+	existing := make([]*trillian.LogLeaf, len(leaves))
+	if !t.ls.allowDuplicates {
+		var err error
+		if existing, err = t.findDuplicates(leaves); err != nil {
+			return nil, err
+		}
+	}
+
+	queueTimestamp := time.Now().UnixNano()
+	for i, leaf := range leaves {
+		if existing[i] != nil {
+			continue
+		}
+
+		// The leaf data is shared by duplicates of the leaf, and is the same for
+		// each of them, so overwriting it is harmless
+		t.buffer(spanner.InsertOrUpdate("LeafData", leafDataColumns,
+			[]interface{}{t.ls.logID.TreeID, []byte(leaf.LeafHash), leaf.LeafValue}))
+
+		// Message ids only need to guard against duplicates for the time that entries are
+		// in the unsequenced queue, which should be short, but we'll still use a strong hash.
+		hasher := sha256.New()
+
+		// We use a fixed zero message id if the log disallows duplicates otherwise a random one.
+		// Duplicates have been skipped above, but the fixed id still collides if another
+		// transaction queues the same leaf concurrently, so only one of them can commit.
+		messageIDBytes := make([]byte, 8)
+
+		if t.ls.allowDuplicates {
+			if _, err := rand.Read(messageIDBytes); err != nil {
+				glog.Warningf("Failed to get a random message id: %s", err)
+				return nil, err
+			}
+		}
+
+		hasher.Write(messageIDBytes)
+		hasher.Write(t.ls.logID.LogID)
+		hasher.Write(leaf.LeafHash)
+		messageID := hasher.Sum(nil)
+
+		t.buffer(spanner.Insert("Unsequenced", unsequencedColumns,
+			[]interface{}{t.ls.logID.TreeID, []byte(leaf.LeafHash), messageID, leaf.LeafValue, queueTimestamp}))
+		queued := trillian.LogLeaf{Leaf: trillian.Leaf{LeafHash: leaf.LeafHash, LeafValue: leaf.LeafValue}, QueueTimestampNanos: queueTimestamp}
+		t.queued = append(t.queued, queuedLeaf{leaf: queued, messageID: messageID})
+	}
+
+	return existing, nil
+}
+
+// findDuplicates returns the existing leaf for each of leaves whose hash is
+// already sequenced or queued, or is earlier in leaves, and nil for the others.
+// It's only used for logs that don't allow duplicates, so each hash is in the
+// log at most once.
+func (t *logTX) findDuplicates(leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
+	existing := make([]*trillian.LogLeaf, len(leaves))
+	if len(leaves) == 0 {
+		return existing, nil
+	}
+
+	hashes := make([]trillian.Hash, 0, len(leaves))
+	rawHashes := make([][]byte, 0, len(leaves))
+	for _, leaf := range leaves {
+		hashes = append(hashes, leaf.LeafHash)
+		rawHashes = append(rawHashes, []byte(leaf.LeafHash))
+	}
+	sequenced, err := t.GetLeavesByHash(hashes, false)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]*trillian.LogLeaf)
+	for i := range sequenced {
+		found[string(sequenced[i].LeafHash)] = &sequenced[i]
+	}
+
+	params := map[string]interface{}{"tree": t.ls.logID.TreeID, "hashes": rawHashes, "dequeued": t.dequeuedParam()}
+	err = t.query(selectUnsequencedLeavesByHashSQL, params, func(row *spanner.Row) error {
+		var leafHash, payload []byte
+		if err := row.Columns(&leafHash, &payload); err != nil {
+			return err
+		}
+		if _, ok := found[string(leafHash)]; !ok {
+			found[string(leafHash)] = &trillian.LogLeaf{Leaf: trillian.Leaf{LeafHash: leafHash, LeafValue: payload}, SequenceNumber: -1}
+		}
+		return nil
+	})
+	if err != nil {
+		glog.Warningf("Error reading from Unsequenced: %s", err)
+		return nil, err
+	}
+	for _, q := range t.pendingQueued() {
+		if _, ok := found[string(q.leaf.LeafHash)]; !ok {
+			found[string(q.leaf.LeafHash)] = &trillian.LogLeaf{Leaf: q.leaf.Leaf, SequenceNumber: -1}
+		}
+	}
+
+	for i, leaf := range leaves {
+		if dup, ok := found[string(leaf.LeafHash)]; ok {
+			existing[i] = dup
+			continue
+		}
+		// Any later leaves with the same hash are duplicates of this one
+		found[string(leaf.LeafHash)] = &trillian.LogLeaf{Leaf: leaf.Leaf, SequenceNumber: -1}
+	}
+
+	return existing, nil
+}
+
+func (t *logTX) GetSequencedLeafCount() (int64, error) {
+	var sequencedLeafCount int64
+
+	_, err := t.queryRow(selectSequencedLeafCountSQL, map[string]interface{}{"tree": t.ls.logID.TreeID}, &sequencedLeafCount)
+
+	if err != nil {
+		glog.Warningf("Error getting sequenced leaf count: %s", err)
+		return 0, err
+	}
+
+	return sequencedLeafCount + int64(len(t.sequenced)), nil
+}
+
+// readLeaves returns the leaves read by a leaf query.
+func (t *logTX) readLeaves(sql string, params map[string]interface{}) ([]trillian.LogLeaf, error) {
+	ret := make([]trillian.LogLeaf, 0)
+	err := t.query(sql, params, func(row *spanner.Row) error {
+		var leaf trillian.LogLeaf
+		var leafHash []byte
+		if err := row.Columns(&leafHash, &leaf.LeafValue, &leaf.SequenceNumber, &leaf.IntegrateTimestampNanos); err != nil {
+			glog.Warningf("Failed to scan merkle leaves: %s", err)
+			return err
+		}
+
+		if got, want := len(leafHash), t.ts.hashSizeBytes; got != want {
+			return fmt.Errorf("Scanned leaf does not have hash length %d, got %d", want, got)
+		}
+
+		leaf.LeafHash = leafHash
+		ret = append(ret, leaf)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (t *logTX) GetLeavesByIndex(leaves []int64) ([]trillian.LogLeaf, error) {
+	stored := make([]int64, 0, len(leaves))
+	for _, index := range leaves {
+		if _, ok := t.sequenced[index]; !ok {
+			stored = append(stored, index)
+		}
+	}
+	params := map[string]interface{}{"tree": t.ls.logID.TreeID, "indices": stored}
+	ret, err := t.readLeaves(selectLeavesByIndexSQL, params)
+	if err != nil {
+		glog.Warningf("Failed to get leaves by idx: %s", err)
+		return nil, err
+	}
+	for _, index := range leaves {
+		if leaf, ok := t.sequenced[index]; ok {
+			ret = append(ret, leaf)
+		}
+	}
+
+	if len(ret) != len(leaves) {
+		return nil, fmt.Errorf("expected %d leaves, but saw %d", len(leaves), len(ret))
+	}
+	return ret, nil
+}
+
+func (t *logTX) GetLeavesByRange(start, count int64) ([]trillian.LogLeaf, error) {
+	if start < 0 || count <= 0 {
+		return nil, fmt.Errorf("invalid range start=%d count=%d", start, count)
+	}
+	params := map[string]interface{}{"tree": t.ls.logID.TreeID, "start": start, "count": count}
+	ret, err := t.readLeaves(selectLeavesByRangeSQL, params)
+	if err != nil {
+		glog.Warningf("Failed to get leaves by range: %s", err)
+		return nil, err
+	}
+	// The leaves sequenced by the transaction follow the stored ones
+	for index := start + int64(len(ret)); index < start+count; index++ {
+		leaf, ok := t.sequenced[index]
+		if !ok {
+			break
+		}
+		ret = append(ret, leaf)
+	}
+
+	// Leaves are sequenced without gaps so the range is contiguous
+	for i, leaf := range ret {
+		if got, want := leaf.SequenceNumber, start+int64(i); got != want {
+			return nil, fmt.Errorf("expected leaf at index %d, but saw %d", want, got)
+		}
+	}
+	return ret, nil
+}
+
+func (t *logTX) OldestQueuedLeafTimestampNanos() (int64, error) {
+	var oldest spanner.NullInt64
+
+	_, err := t.queryRow(selectOldestQueuedLeafSQL, map[string]interface{}{"tree": t.ls.logID.TreeID, "dequeued": t.dequeuedParam()}, &oldest)
+
+	if err != nil {
+		glog.Warningf("Error getting oldest queued leaf: %s", err)
+		return 0, err
+	}
+	for _, q := range t.pendingQueued() {
+		if !oldest.Valid || q.leaf.QueueTimestampNanos < oldest.Int64 {
+			oldest = spanner.NullInt64{Int64: q.leaf.QueueTimestampNanos, Valid: true}
+		}
+	}
+
+	return oldest.Int64, nil
+}
+
+func (t *logTX) GetLeafIndexRangeByTime(startNanos, endNanos int64) (int64, int64, error) {
+	var first, last spanner.NullInt64
+
+	params := map[string]interface{}{"tree": t.ls.logID.TreeID, "start": startNanos, "end": endNanos}
+	_, err := t.queryRow(selectLeafIndexRangeByTimeSQL, params, &first, &last)
+
+	if err != nil {
+		glog.Warningf("Error getting leaf index range by time: %s", err)
+		return 0, 0, err
+	}
+	var pendingBefore int64
+	for index, leaf := range t.sequenced {
+		switch {
+		case leaf.IntegrateTimestampNanos < startNanos:
+			pendingBefore++
+		case leaf.IntegrateTimestampNanos < endNanos:
+			if !first.Valid || index < first.Int64 {
+				first = spanner.NullInt64{Int64: index, Valid: true}
+			}
+			if !last.Valid || index > last.Int64 {
+				last = spanner.NullInt64{Int64: index, Valid: true}
+			}
+		}
+	}
+
+	return storage.LeafIndexRange(first.Int64, last.Int64, first.Valid && last.Valid, func() (int64, error) {
+		var count int64
+		_, err := t.queryRow(selectLeafCountBeforeTimeSQL, params, &count)
+		if err != nil {
+			glog.Warningf("Error getting leaf count before time: %s", err)
+		}
+		return count + pendingBefore, err
+	})
+}
+
+func (t *logTX) GetLeavesByHash(leafHashes []trillian.Hash, orderBySequence bool) ([]trillian.LogLeaf, error) {
+	hashes := make([][]byte, 0, len(leafHashes))
+	for _, hash := range leafHashes {
+		hashes = append(hashes, []byte(hash))
+	}
+
+	sql := selectLeavesByHashSQL
+	if orderBySequence {
+		sql = selectLeavesByHashOrderedBySequenceSQL
+	}
+
+	// The tree could include duplicates so we don't know how many results will be returned
+	ret, err := t.readLeaves(sql, map[string]interface{}{"tree": t.ls.logID.TreeID, "hashes": hashes})
+	if err != nil {
+		glog.Warningf("Failed to get leaves by hash: %s", err)
+		return nil, err
+	}
+
+	want := make(map[string]bool)
+	for _, hash := range hashes {
+		want[string(hash)] = true
+	}
+	for _, leaf := range t.sequenced {
+		if want[string(leaf.LeafHash)] {
+			ret = append(ret, leaf)
+		}
+	}
+	if orderBySequence {
+		sort.SliceStable(ret, func(i, j int) bool { return ret[i].SequenceNumber < ret[j].SequenceNumber })
+	}
+	return ret, nil
+}
+
+func (t *logTX) LatestSignedLogRoot() (trillian.SignedLogRoot, error) {
+	var timestamp, treeSize, treeRevision int64
+	var rootHash, rootSignatureBytes []byte
+	var rootSignature trillian.DigitallySigned
+
+	params := map[string]interface{}{"tree": t.ls.logID.TreeID, "deleted": t.deletedHeads.param()}
+	found, err := t.queryRow(selectLatestSignedLogRootSQL, params,
+		&timestamp, &treeSize, &rootHash, &treeRevision, &rootSignatureBytes)
+	if err != nil {
+		glog.Warningf("Failed to read latest root: %v", err)
+		return trillian.SignedLogRoot{}, err
+	}
+	if t.root != nil && (!found || t.root.TimestampNanos > timestamp) {
+		return *t.root, nil
+	}
+
+	// It's possible there are no roots for this tree yet
+	if !found {
+		return trillian.SignedLogRoot{}, nil
+	}
+
+	keySignatures, err := storage.UnmarshalRootSignature(rootSignatureBytes, &rootSignature)
+	if err != nil {
+		glog.Warningf("Failed to unmarshall root signature: %v", err)
+		return trillian.SignedLogRoot{}, err
+	}
+
+	return trillian.SignedLogRoot{
+		RootHash:       rootHash,
+		TimestampNanos: timestamp,
+		TreeRevision:   treeRevision,
+		Signature:      &rootSignature,
+		KeySignatures:  keySignatures,
+		LogId:          t.ls.logID.LogID,
+		TreeSize:       treeSize,
+	}, nil
+}
+
+func (t *logTX) GetLogRootCosignatures(treeRevision int64) ([]trillian.Cosignature, error) {
+	var ret []trillian.Cosignature
+	err := t.query(selectLogRootCosignaturesSQL, map[string]interface{}{"tree": t.ls.logID.TreeID, "revision": treeRevision}, func(row *spanner.Row) error {
+		var witnessID string
+		var signatureBytes []byte
+		if err := row.Columns(&witnessID, &signatureBytes); err != nil {
+			return err
+		}
+		var signature trillian.DigitallySigned
+		if err := proto.Unmarshal(signatureBytes, &signature); err != nil {
+			return err
+		}
+		ret = append(ret, trillian.Cosignature{WitnessId: witnessID, Signature: &signature})
+		return nil
+	})
+	if err != nil {
+		glog.Warningf("Failed to read cosignatures: %v", err)
+		return nil, err
+	}
+
+	pending := t.cosigs[treeRevision]
+	if len(pending) == 0 {
+		return ret, nil
+	}
+	merged := make([]trillian.Cosignature, 0, len(ret)+len(pending))
+	for _, cosig := range ret {
+		if _, ok := pending[cosig.WitnessId]; !ok {
+			merged = append(merged, cosig)
+		}
+	}
+	for _, cosig := range pending {
+		if cosig != nil {
+			merged = append(merged, *cosig)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].WitnessId < merged[j].WitnessId })
+	return merged, nil
+}
+
+// setCosignature records a cosignature stored by the transaction, or deleted
+// if cosig is nil.
+func (t *logTX) setCosignature(treeRevision int64, witnessID string, cosig *trillian.Cosignature) {
+	cosigs, ok := t.cosigs[treeRevision]
+	if !ok {
+		cosigs = make(map[string]*trillian.Cosignature)
+		t.cosigs[treeRevision] = cosigs
+	}
+	cosigs[witnessID] = cosig
+}
+
+func (t *logTX) StoreLogRootCosignature(treeRevision int64, cosig trillian.Cosignature) error {
+	signatureBytes, err := proto.Marshal(cosig.Signature)
+	if err != nil {
+		glog.Warningf("Failed to marshal cosignature: %v %v", cosig.Signature, err)
+		return err
+	}
+
+	t.buffer(spanner.InsertOrUpdate("TreeHeadCosignature", treeHeadCosignatureColumns, []interface{}{t.ls.logID.TreeID, treeRevision,
+		cosig.WitnessId, signatureBytes}))
+	t.setCosignature(treeRevision, cosig.WitnessId, &cosig)
+	return nil
+}
+
+func (t *logTX) StoreSignedLogRoot(root trillian.SignedLogRoot) error {
+	signatureBytes, err := storage.MarshalRootSignature(root.Signature, root.KeySignatures)
+
+	if err != nil {
+		glog.Warningf("Failed to marshal root signature: %v %v", root.Signature, err)
+		return err
+	}
+
+	t.buffer(spanner.Insert("TreeHead", treeHeadColumns, []interface{}{t.ls.logID.TreeID, root.TimestampNanos, root.TreeSize,
+		root.RootHash, root.TreeRevision, signatureBytes}))
+	t.setRoot(root)
+	t.writesRevision = true
+
+	return nil
+}
+
+// setRoot records a root stored by the transaction, which is the latest root
+// unless a later one has been stored.
+func (t *logTX) setRoot(root trillian.SignedLogRoot) {
+	root.LogId = t.ls.logID.LogID
+	if t.root == nil || root.TimestampNanos >= t.root.TimestampNanos {
+		t.root = &root
+	}
+}
+
+// GetTreeRevisionAtSize returns the revision of a root stored by the
+// transaction of treeSize, or of a stored one.
+func (t *logTX) GetTreeRevisionAtSize(treeSize int64) (int64, error) {
+	if t.root != nil && t.root.TreeSize == treeSize && treeSize > 0 {
+		return t.root.TreeRevision, nil
+	}
+	return t.treeTX.GetTreeRevisionAtSize(treeSize)
+}
+
+func (t *logTX) RefreshSignedLogRoot(root trillian.SignedLogRoot) error {
+	current, err := t.LatestSignedLogRoot()
+	if err != nil {
+		return err
+	}
+	if current.TreeRevision != root.TreeRevision || current.TreeSize != root.TreeSize || !bytes.Equal(current.RootHash, root.RootHash) {
+		return fmt.Errorf("refreshed root at revision %d does not match the latest root at revision %d", root.TreeRevision, current.TreeRevision)
+	}
+	cosigs, err := t.GetLogRootCosignatures(root.TreeRevision)
+	if err != nil {
+		return err
+	}
+
+	signatureBytes, err := storage.MarshalRootSignature(root.Signature, root.KeySignatures)
+	if err != nil {
+		glog.Warningf("Failed to marshal root signature: %v %v", root.Signature, err)
+		return err
+	}
+
+	// The timestamp is part of the key, so the root is replaced rather than updated
+	t.buffer(spanner.Delete("TreeHead", spanner.Key{t.ls.logID.TreeID, current.TimestampNanos}))
+	t.deletedHeads.add(current.TimestampNanos)
+	t.root = nil
+	t.buffer(spanner.Insert("TreeHead", treeHeadColumns, []interface{}{t.ls.logID.TreeID, root.TimestampNanos, root.TreeSize,
+		root.RootHash, root.TreeRevision, signatureBytes}))
+	t.setRoot(root)
+	for _, cosig := range cosigs {
+		t.buffer(spanner.Delete("TreeHeadCosignature", spanner.Key{t.ls.logID.TreeID, root.TreeRevision, cosig.WitnessId}))
+		t.setCosignature(root.TreeRevision, cosig.WitnessId, nil)
+	}
+	// Refreshing a root that's no longer the head would make it the latest again
+	t.writesRevision = true
+
+	return nil
+}
+
+func (t *logTX) UpdateSequencedLeaves(leaves []trillian.LogLeaf) error {
+	for _, leaf := range leaves {
+		// This should fail on insert but catch it early
+		if len(leaf.LeafHash) != t.ts.hashSizeBytes {
+			return errors.New("Sequenced leaf has incorrect hash size")
+		}
+
+		t.buffer(spanner.Insert("SequencedLeafData", sequencedLeafDataColumns, []interface{}{t.ls.logID.TreeID,
+			leaf.SequenceNumber, []byte(leaf.LeafHash), leaf.IntegrateTimestampNanos}))
+		t.sequenced[leaf.SequenceNumber] = trillian.LogLeaf{
+			Leaf:                    trillian.Leaf{LeafHash: leaf.LeafHash, LeafValue: leaf.LeafValue},
+			SequenceNumber:          leaf.SequenceNumber,
+			IntegrateTimestampNanos: leaf.IntegrateTimestampNanos,
+		}
+	}
+	if len(leaves) > 0 {
+		t.writesRevision = true
+	}
+
+	return nil
+}
+
+// AddSequencedLeaves stages leaves at their sequence numbers, except for those
+// whose index already holds a leaf, until they're integrated. A leaf at the
+// same index as an earlier one in leaves is returned as a duplicate of it.
+func (t *logTX) AddSequencedLeaves(leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
+	indices := make([]int64, 0, len(leaves))
+	for _, leaf := range leaves {
+		if len(leaf.LeafHash) != t.ts.hashSizeBytes {
+			return nil, errors.New("Sequenced leaf has incorrect hash size")
+		}
+		if leaf.SequenceNumber < 0 {
+			return nil, fmt.Errorf("invalid sequence number %d", leaf.SequenceNumber)
+		}
+		indices = append(indices, leaf.SequenceNumber)
+	}
+
+	existing := make([]*trillian.LogLeaf, len(leaves))
+	if len(leaves) == 0 {
+		return existing, nil
+	}
+	params := map[string]interface{}{"tree": t.ls.logID.TreeID, "indices": indices, "dequeued": t.stagedDequeued.param()}
+	found := make(map[int64]*trillian.LogLeaf)
+	for _, sql := range []string{selectLeavesByIndexSQL, selectStagedLeavesByIndexSQL} {
+		stored, err := t.readLeaves(sql, params)
+		if err != nil {
+			glog.Warningf("Failed to get leaves by idx: %s", err)
+			return nil, err
+		}
+		for i := range stored {
+			found[stored[i].SequenceNumber] = &stored[i]
+		}
+	}
+	for _, index := range indices {
+		if leaf, ok := t.sequenced[index]; ok {
+			found[index] = &leaf
+		} else if leaf := t.staged[index]; leaf != nil {
+			found[index] = leaf
+		}
+	}
+
+	for i, leaf := range leaves {
+		if dup, ok := found[leaf.SequenceNumber]; ok {
+			existing[i] = dup
+			continue
+		}
+		t.buffer(spanner.InsertOrUpdate("LeafData", leafDataColumns,
+			[]interface{}{t.ls.logID.TreeID, []byte(leaf.LeafHash), leaf.LeafValue}))
+		t.buffer(spanner.Insert("StagedLeafData", stagedLeafDataColumns, []interface{}{t.ls.logID.TreeID,
+			leaf.SequenceNumber, []byte(leaf.LeafHash)}))
+		staged := trillian.LogLeaf{Leaf: trillian.Leaf{LeafHash: leaf.LeafHash, LeafValue: leaf.LeafValue}, SequenceNumber: leaf.SequenceNumber}
+		t.staged[leaf.SequenceNumber] = &staged
+		found[leaf.SequenceNumber] = &staged
+	}
+	return existing, nil
+}
+
+// DequeueSequencedLeaves returns the staged leaves at contiguous indices from
+// start, up to limit of them, and removes them from StagedLeafData.
+func (t *logTX) DequeueSequencedLeaves(start int64, limit int) ([]trillian.LogLeaf, error) {
+	params := map[string]interface{}{"tree": t.ls.logID.TreeID, "start": start, "count": int64(limit), "dequeued": t.stagedDequeued.param()}
+	staged, err := t.readLeaves(selectStagedLeavesByRangeSQL, params)
+	if err != nil {
+		glog.Warningf("Failed to get staged leaves: %s", err)
+		return nil, err
+	}
+	for index, leaf := range t.staged {
+		if leaf != nil && index >= start {
+			staged = append(staged, *leaf)
+		}
+	}
+	sort.Slice(staged, func(i, j int) bool { return staged[i].SequenceNumber < staged[j].SequenceNumber })
+
+	ret := make([]trillian.LogLeaf, 0, len(staged))
+	for _, leaf := range staged {
+		// Only the leaves before the first gap can be integrated
+		if leaf.SequenceNumber != start+int64(len(ret)) {
+			break
+		}
+		if len(ret) == limit {
+			break
+		}
+		t.buffer(spanner.Delete("StagedLeafData", spanner.Key{t.ls.logID.TreeID, leaf.SequenceNumber}))
+		t.staged[leaf.SequenceNumber] = nil
+		t.stagedDequeued.add(leaf.SequenceNumber)
+		ret = append(ret, leaf)
+	}
+	return ret, nil
+}
+
+func (t *logTX) getActiveLogIDsInternal(sql string) ([]trillian.LogID, error) {
+	logIDs := make([]trillian.LogID, 0)
+	err := t.query(sql, nil, func(row *spanner.Row) error {
+		var logID []byte
+		var treeID int64
+
+		if err := row.Columns(&treeID, &logID); err != nil {
+			return err
+		}
+
+		logIDs = append(logIDs, trillian.LogID{LogID: logID, TreeID: treeID})
+		return nil
+	})
+	if err != nil {
+		return []trillian.LogID{}, err
+	}
+
+	return logIDs, nil
+}
+
+// GetActiveLogIDs returns a list of the IDs of all configured logs
+func (t *logTX) GetActiveLogIDs() ([]trillian.LogID, error) {
+	return t.getActiveLogIDsInternal(selectActiveLogsSQL)
+}
+
+// GetActiveLogIDsWithPendingWork returns a list of the IDs of all configured logs
+// that have queued or staged leaves that need to be integrated
+func (t *logTX) GetActiveLogIDsWithPendingWork() ([]trillian.LogID, error) {
+	return t.getActiveLogIDsInternal(selectActiveLogsWithUnsequencedSQL)
+}
@@ -0,0 +1,1335 @@
+package cloudspanner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/cache"
+	"golang.org/x/net/context"
+)
+
+// The statements reading MapHead leave out the roots the transaction has
+// deleted, whose timestamps are in @deleted
+const selectLatestSignedMapRootSQL = `SELECT MapHeadTimestamp, RootHash, MapRevision, RootSignature, MapperData
+	 FROM MapHead WHERE TreeId=@tree AND MapHeadTimestamp NOT IN UNNEST(@deleted)
+	 ORDER BY MapRevision DESC LIMIT 1`
+const selectSignedMapRootSQL = `SELECT MapHeadTimestamp, RootHash, MapRevision, RootSignature, MapperData
+	 FROM MapHead WHERE TreeId=@tree AND MapRevision=@revision AND MapHeadTimestamp NOT IN UNNEST(@deleted)`
+const selectLatestMapRevisionSQL = `SELECT MapRevision FROM MapHead WHERE TreeId=@tree
+	 ORDER BY MapRevision DESC LIMIT 1`
+
+const selectMapLeafSQL = `SELECT x.KeyHash, x.MaxRevision, l.TheData
+	 FROM (SELECT KeyHash, MAX(MapRevision) AS MaxRevision
+	       FROM MapLeaf
+	       WHERE TreeId=@tree AND KeyHash IN UNNEST(@keys) AND MapRevision<=@revision
+	       GROUP BY KeyHash) AS x
+	 INNER JOIN MapLeaf l ON l.TreeId=@tree AND l.KeyHash=x.KeyHash AND l.MapRevision=x.MaxRevision`
+const selectChangedMapLeavesSQL = `SELECT KeyHash, TheData FROM MapLeaf@{FORCE_INDEX=MapLeafRevisionIdx}
+	 WHERE TreeId=@tree AND MapRevision=@revision
+	 ORDER BY KeyHash`
+
+// The leaves of a map at a revision are the latest rows for each key at or
+// before it.
+const selectMapLeavesAtRevisionSQL = `SELECT l.KeyHash, l.MapRevision, l.TheData FROM MapLeaf l
+	 WHERE l.TreeId=@tree AND l.KeyHash>@after AND l.MapRevision<=@revision AND NOT EXISTS (
+	   SELECT 1 FROM MapLeaf n
+	   WHERE n.TreeId=l.TreeId AND n.KeyHash=l.KeyHash AND n.MapRevision>l.MapRevision AND n.MapRevision<=@revision)
+	 ORDER BY l.KeyHash LIMIT @count`
+
+const selectMapStagedHeadSQL = `SELECT MapRevision, RootHash, StagedTimestamp, MapperData
+	 FROM MapStagedHead WHERE TreeId=@tree`
+
+const selectMapHeadRevisionCountSQL = `SELECT COUNT(*) FROM MapHead
+	 WHERE TreeId=@tree AND MapRevision=@revision AND MapHeadTimestamp NOT IN UNNEST(@deleted)`
+const selectMaxRevertedRevisionSQL = "SELECT COALESCE(MAX(FromRevision), -1) FROM MapHeadRevert WHERE TreeId=@tree"
+const selectMapHeadRevertsSQL = `SELECT RevertTimestamp, FromRevision, ToRevision, Reason
+	 FROM MapHeadRevert WHERE TreeId=@tree
+	 ORDER BY RevertTimestamp ASC`
+const selectAbandonedMapRevisionTagsSQL = "SELECT RevertTimestamp, Tag, MapRevision FROM AbandonedMapRevisionTag WHERE TreeId=@tree"
+
+// These statements select the rows written after a revision, which are
+// removed when a map is reverted to it or when a partial revision is removed.
+const selectMapHeadsAfterRevisionSQL = `SELECT MapHeadTimestamp, RootHash, MapRevision, RootSignature, MapperData
+	 FROM MapHead WHERE TreeId=@tree AND MapRevision>@revision AND MapHeadTimestamp NOT IN UNNEST(@deleted)`
+const selectMapLeavesAfterRevisionSQL = `SELECT KeyHash, MapRevision, TheData FROM MapLeaf@{FORCE_INDEX=MapLeafRevisionIdx}
+	 WHERE TreeId=@tree AND MapRevision>@revision`
+const selectSubtreesAfterRevisionSQL = `SELECT SubtreeId, SubtreeRevision, Nodes FROM Subtree
+	 WHERE TreeId=@tree AND SubtreeRevision>@revision`
+const selectMapRevisionTagsAfterRevisionSQL = "SELECT Tag, MapRevision, TagTimestamp FROM MapRevisionTag WHERE TreeId=@tree AND MapRevision>@revision"
+
+const selectMapRevisionForTagSQL = "SELECT MapRevision FROM MapRevisionTag WHERE TreeId=@tree AND Tag=@tag"
+const selectMapRevisionTagsSQL = "SELECT Tag, MapRevision FROM MapRevisionTag WHERE TreeId=@tree"
+
+const selectTreeRetentionSQL = "SELECT MaxRevisions, MaxAgeSeconds, OldestRetainedRevision FROM TreeRetention WHERE TreeId=@tree"
+const selectEarliestMapRevisionSinceSQL = `SELECT MIN(MapRevision) FROM MapHead
+	 WHERE TreeId=@tree AND MapHeadTimestamp>=@timestamp AND MapHeadTimestamp NOT IN UNNEST(@deleted)`
+const selectMapHeadsBeforeRevisionSQL = `SELECT MapHeadTimestamp FROM MapHead
+	 WHERE TreeId=@tree AND MapRevision<@revision AND MapHeadTimestamp NOT IN UNNEST(@deleted)`
+
+// Archivable data at a revision is that which has been superseded by a write at a
+// later revision no later than the oldest retained revision.
+const selectArchivableMapLeavesSQL = `SELECT l.KeyHash, l.TheData FROM MapLeaf l
+	 WHERE l.TreeId=@tree AND l.MapRevision=@revision AND EXISTS (
+	   SELECT 1 FROM MapLeaf n
+	   WHERE n.TreeId=l.TreeId AND n.KeyHash=l.KeyHash AND n.MapRevision>l.MapRevision AND n.MapRevision<=@oldest)`
+const selectArchivableSubtreesSQL = `SELECT s.SubtreeId, s.Nodes FROM Subtree s
+	 WHERE s.TreeId=@tree AND s.SubtreeRevision=@revision AND EXISTS (
+	   SELECT 1 FROM Subtree n
+	   WHERE n.TreeId=s.TreeId AND n.SubtreeId=s.SubtreeId AND n.SubtreeRevision>s.SubtreeRevision AND n.SubtreeRevision<=@oldest)`
+
+// Superseded data below a revision is that written before it which has been
+// overwritten at a later revision no later than it.
+const selectSupersededMapLeavesSQL = `SELECT l.KeyHash, l.MapRevision FROM MapLeaf l
+	 WHERE l.TreeId=@tree AND l.MapRevision<@revision AND EXISTS (
+	   SELECT 1 FROM MapLeaf n
+	   WHERE n.TreeId=l.TreeId AND n.KeyHash=l.KeyHash AND n.MapRevision>l.MapRevision AND n.MapRevision<=@revision)`
+const selectSupersededSubtreesSQL = `SELECT s.SubtreeId, s.SubtreeRevision FROM Subtree s
+	 WHERE s.TreeId=@tree AND s.SubtreeRevision<@revision AND EXISTS (
+	   SELECT 1 FROM Subtree n
+	   WHERE n.TreeId=s.TreeId AND n.SubtreeId=s.SubtreeId AND n.SubtreeRevision>s.SubtreeRevision AND n.SubtreeRevision<=@revision)`
+
+const selectArchivedRevisionsSQL = "SELECT MapRevision, SegmentName FROM ArchivedRevision WHERE TreeId=@tree"
+const selectRestoredRevisionsSQL = "SELECT MapRevision, ExpiresTimestamp FROM RestoredRevision WHERE TreeId=@tree"
+
+var mapHeadColumns = []string{"TreeId", "MapHeadTimestamp", "RootHash", "MapRevision", "RootSignature", "MapperData"}
+var mapLeafColumns = []string{"TreeId", "KeyHash", "MapRevision", "TheData"}
+var mapStagedHeadColumns = []string{"TreeId", "MapRevision", "RootHash", "StagedTimestamp", "MapperData"}
+var mapHeadRevertColumns = []string{"TreeId", "RevertTimestamp", "FromRevision", "ToRevision", "Reason"}
+var abandonedMapHeadColumns = []string{"TreeId", "RevertTimestamp", "MapHeadTimestamp", "RootHash", "MapRevision", "RootSignature", "MapperData"}
+var abandonedMapLeafColumns = []string{"TreeId", "RevertTimestamp", "KeyHash", "MapRevision", "TheData"}
+var abandonedSubtreeColumns = []string{"TreeId", "RevertTimestamp", "SubtreeId", "SubtreeRevision", "Nodes"}
+var abandonedMapRevisionTagColumns = []string{"TreeId", "RevertTimestamp", "Tag", "MapRevision", "TagTimestamp"}
+var mapRevisionTagColumns = []string{"TreeId", "Tag", "MapRevision", "TagTimestamp"}
+var treeRetentionPolicyColumns = []string{"TreeId", "MaxRevisions", "MaxAgeSeconds"}
+var oldestRetainedRevisionColumns = []string{"TreeId", "OldestRetainedRevision"}
+var archivedRevisionColumns = []string{"TreeId", "MapRevision", "SegmentName"}
+var restoredRevisionColumns = []string{"TreeId", "MapRevision", "ExpiresTimestamp"}
+
+// maxTagLength is the size of the Tag column
+const maxTagLength = 255
+
+type spannerMapStorage struct {
+	*spannerTreeStorage
+
+	mapID trillian.MapID
+}
+
+func (m *spannerMapStorage) MapID() trillian.MapID {
+	return m.mapID
+}
+
+// NewMapStorage creates a MapStorage for the map id in the Spanner database
+// that client is connected to. Maps are stored in the same strata as in the
+// MySQL storage.
+func NewMapStorage(client *spanner.Client, id trillian.MapID) (storage.MapStorage, error) {
+	ts, err := newTreeStorage(client, id.TreeID, storage.MapStrata, cache.PopulateMapSubtreeNodes)
+	if err != nil {
+		glog.Warningf("Couldn't create a new treeStorage: %s", err)
+		return nil, err
+	}
+	ts.readHeadRevision = func(ctx context.Context, r rowReader) (int64, error) {
+		params := map[string]interface{}{"tree": id.TreeID}
+		revision := int64(-1)
+		if _, err := queryRow(ctx, r, selectLatestMapRevisionSQL, params, &revision); err != nil {
+			return 0, err
+		}
+		// Revisions abandoned by a revert are never written again
+		var reverted int64
+		if _, err := queryRow(ctx, r, selectMaxRevertedRevisionSQL, params, &reverted); err != nil {
+			return 0, err
+		}
+		if reverted > revision {
+			revision = reverted
+		}
+		return revision, nil
+	}
+
+	return &spannerMapStorage{
+		spannerTreeStorage: ts,
+		mapID:              id,
+	}, nil
+}
+
+func (m *spannerMapStorage) Begin() (storage.MapTX, error) {
+	ttx, err := m.beginTreeTx()
+	if err != nil {
+		return nil, err
+	}
+	return &mapTX{
+		treeTX:   ttx,
+		ms:       m,
+		leaves:   make(revisionedRows),
+		heads:    make(map[int64]trillian.SignedMapRoot),
+		tags:     make(map[string]*revisionTag),
+		restored: make(map[int64]*int64),
+		archived: make(map[int64]string),
+	}, nil
+}
+
+func (m *spannerMapStorage) Snapshot() (storage.ReadOnlyMapTX, error) {
+	return m.Begin()
+}
+
+type mapTX struct {
+	treeTX
+	ms *spannerMapStorage
+
+	// The rest are the rows the transaction has written or deleted, which its
+	// reads are merged with
+
+	leaves revisionedRows
+	// heads holds the roots stored by timestamp, and deletedHeads the
+	// timestamps of the stored roots that have been deleted
+	heads        map[int64]trillian.SignedMapRoot
+	deletedHeads deletedKeys
+	// staged is the staged root if stagedSet, nil if it has been removed
+	staged    *trillian.SignedMapRoot
+	stagedSet bool
+	reverts   []storage.MapHeadRevert
+	// tags holds each tag written, nil if it has been deleted
+	tags           map[string]*revisionTag
+	retention      *storage.RetentionPolicy
+	oldestRetained *int64
+	// restored holds the expiry of each revision restored, nil if it's no
+	// longer restored
+	restored map[int64]*int64
+	archived map[int64]string
+}
+
+// params returns query parameters for the map, with name and value pairs from kv.
+func (m *mapTX) params(kv ...interface{}) map[string]interface{} {
+	p := map[string]interface{}{"tree": m.ms.mapID.TreeID}
+	for i := 0; i+1 < len(kv); i += 2 {
+		p[kv[i].(string)] = kv[i+1]
+	}
+	return p
+}
+
+func (m *mapTX) WriteRevision() int64 {
+	return m.treeTX.writeRevision
+}
+
+func (m *mapTX) Set(keyHash trillian.Hash, value trillian.MapLeaf) error {
+	flatValue, err := proto.Marshal(&value)
+	if err != nil {
+		return err
+	}
+
+	m.buffer(spanner.Insert("MapLeaf", mapLeafColumns, []interface{}{m.ms.mapID.TreeID, []byte(keyHash), m.writeRevision, flatValue}))
+	m.leaves.set(keyHash, m.writeRevision, flatValue)
+	m.writesRevision = true
+	return nil
+}
+
+// SetLeaves buffers the leaves like Set. Buffered mutations are all applied in
+// one round trip when the transaction commits.
+func (m *mapTX) SetLeaves(leaves []trillian.MapLeaf) error {
+	for _, leaf := range leaves {
+		if err := m.Set(leaf.KeyHash, leaf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoredFrom reports whether any revision from revision on has been
+// restored from archive.
+func (m *mapTX) restoredFrom(revision int64) (bool, error) {
+	restored, err := m.GetRestoredRevisions()
+	if err != nil {
+		return false, err
+	}
+	for rev := range restored {
+		if rev >= revision {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkReadable returns a RevisionOutOfRangeError if revision has been pruned
+// and has not been restored from archive.
+func (m *mapTX) checkReadable(revision int64) error {
+	oldest, err := m.OldestRetainedRevision()
+	if err != nil {
+		return err
+	}
+	return storage.CheckRevisionReadable(revision, oldest, m.restoredFrom)
+}
+
+func (m *mapTX) Get(revision int64, keyHashes []trillian.Hash) ([]trillian.MapLeaf, error) {
+	if revision >= 0 {
+		if err := m.checkReadable(revision); err != nil {
+			return nil, err
+		}
+	} else {
+		// A negative revision reads the latest value of each key
+		revision = math.MaxInt64
+	}
+
+	if len(keyHashes) == 0 {
+		return nil, nil
+	}
+	keys := make([][]byte, 0, len(keyHashes))
+	for _, k := range keyHashes {
+		keys = append(keys, []byte(k))
+	}
+
+	stored, err := m.readLeafRows(selectMapLeafSQL, m.params("keys", keys, "revision", m.storedRevision(revision)))
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]trillian.MapLeaf, 0, len(keyHashes))
+	for _, row := range mergeLatest(stored, m.leaves.subset(keys), revision) {
+		// Leaves set to an empty value have been deleted
+		if len(row.data) == 0 {
+			continue
+		}
+		mapLeaf, err := unmarshalMapLeaf(row)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, mapLeaf)
+	}
+	return ret, nil
+}
+
+// storedRevision returns the revision to read stored leaves and subtrees at
+// for a read at revision, leaving out those the transaction has deleted.
+func (m *mapTX) storedRevision(revision int64) int64 {
+	if revision > m.readLimit {
+		return m.readLimit
+	}
+	return revision
+}
+
+// readLeafRows returns the map leaves selected by sql, which must select their
+// key hash, revision and data.
+func (m *mapTX) readLeafRows(sql string, params map[string]interface{}) ([]revisionedRow, error) {
+	var rows []revisionedRow
+	err := m.query(sql, params, func(row *spanner.Row) error {
+		var r revisionedRow
+		if err := row.Columns(&r.id, &r.revision, &r.data); err != nil {
+			return err
+		}
+		rows = append(rows, r)
+		return nil
+	})
+	return rows, err
+}
+
+func unmarshalMapLeaf(row revisionedRow) (trillian.MapLeaf, error) {
+	var mapLeaf trillian.MapLeaf
+	if err := proto.Unmarshal(row.data, &mapLeaf); err != nil {
+		return trillian.MapLeaf{}, err
+	}
+	mapLeaf.KeyHash = row.id
+	return mapLeaf, nil
+}
+
+func (m *mapTX) GetChangedLeaves(revision int64) ([]trillian.MapLeaf, error) {
+	if err := m.checkReadable(revision); err != nil {
+		return nil, err
+	}
+
+	var stored []revisionedRow
+	if revision <= m.readLimit {
+		err := m.query(selectChangedMapLeavesSQL, m.params("revision", revision), func(row *spanner.Row) error {
+			r := revisionedRow{revision: revision}
+			if err := row.Columns(&r.id, &r.data); err != nil {
+				return err
+			}
+			stored = append(stored, r)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ret []trillian.MapLeaf
+	for _, row := range mergeAt(stored, m.leaves, revision) {
+		mapLeaf, err := unmarshalMapLeaf(row)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, mapLeaf)
+	}
+	return ret, nil
+}
+
+func (m *mapTX) ListLeaves(revision int64, afterKeyHash trillian.Hash, count int) ([]trillian.MapLeaf, error) {
+	if err := m.checkReadable(revision); err != nil {
+		return nil, err
+	}
+
+	// A nil key hash would be NULL, which no key hash sorts after
+	after := []byte(afterKeyHash)
+	if after == nil {
+		after = []byte{}
+	}
+	stored, err := m.readLeafRows(selectMapLeavesAtRevisionSQL, m.params("after", after, "revision", m.storedRevision(revision), "count", int64(count)))
+	if err != nil {
+		return nil, err
+	}
+	// Any stored leaf that would be listed ahead of the transaction's own is
+	// among the first count stored
+	pending := m.leaves.filter(func(id []byte) bool { return bytes.Compare(id, after) > 0 })
+	ret := make([]trillian.MapLeaf, 0, count)
+	for _, row := range mergeLatest(stored, pending, revision) {
+		if len(ret) == count {
+			break
+		}
+		mapLeaf, err := unmarshalMapLeaf(row)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, mapLeaf)
+	}
+	return ret, nil
+}
+
+// unmarshalMapperMetadata decodes stored mapper metadata, which is nil if
+// there's none.
+func unmarshalMapperMetadata(b []byte) (*trillian.MapperMetadata, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	mapperMeta := &trillian.MapperMetadata{}
+	if err := proto.Unmarshal(b, mapperMeta); err != nil {
+		glog.Warningf("Failed to unmarshal Metadata; %v", err)
+		return nil, err
+	}
+	return mapperMeta, nil
+}
+
+// marshalMapperMetadata encodes mapper metadata for storage.
+func marshalMapperMetadata(mapperMeta *trillian.MapperMetadata) ([]byte, error) {
+	if mapperMeta == nil {
+		return nil, nil
+	}
+	b, err := proto.Marshal(mapperMeta)
+	if err != nil {
+		glog.Warningf("Failed to marshal MetaData: %v %v", mapperMeta, err)
+		return nil, err
+	}
+	return b, nil
+}
+
+// readMapRoot reads the root selected from MapHead by sql. ok is false if no
+// root was selected.
+func (m *mapTX) readMapRoot(sql string, params map[string]interface{}) (root trillian.SignedMapRoot, ok bool, err error) {
+	var timestamp, mapRevision int64
+	var rootHash, rootSignatureBytes, mapperMetaBytes []byte
+	var rootSignature trillian.DigitallySigned
+
+	found, err := m.queryRow(sql, params,
+		&timestamp, &rootHash, &mapRevision, &rootSignatureBytes, &mapperMetaBytes)
+	if err != nil {
+		glog.Warningf("Failed to read map root: %v", err)
+		return trillian.SignedMapRoot{}, false, err
+	}
+	if !found {
+		return trillian.SignedMapRoot{}, false, nil
+	}
+
+	keySignatures, err := storage.UnmarshalRootSignature(rootSignatureBytes, &rootSignature)
+	if err != nil {
+		glog.Warningf("Failed to unmarshal root signature: %v", err)
+		return trillian.SignedMapRoot{}, false, err
+	}
+
+	mapperMeta, err := unmarshalMapperMetadata(mapperMetaBytes)
+	if err != nil {
+		return trillian.SignedMapRoot{}, false, err
+	}
+
+	return trillian.SignedMapRoot{
+		RootHash:       rootHash,
+		TimestampNanos: timestamp,
+		MapRevision:    mapRevision,
+		Signature:      &rootSignature,
+		KeySignatures:  keySignatures,
+		MapId:          m.ms.mapID.MapID,
+		Metadata:       mapperMeta,
+	}, true, nil
+}
+
+func (m *mapTX) LatestSignedMapRoot() (trillian.SignedMapRoot, error) {
+	// It's possible there are no roots for this tree yet
+	root, ok, err := m.readMapRoot(selectLatestSignedMapRootSQL, m.params("deleted", m.deletedHeads.param()))
+	if err != nil {
+		return trillian.SignedMapRoot{}, err
+	}
+	for _, head := range m.heads {
+		if !ok || head.TimestampNanos > root.TimestampNanos {
+			root, ok = head, true
+		}
+	}
+	return root, nil
+}
+
+func (m *mapTX) GetSignedMapRoot(revision int64) (trillian.SignedMapRoot, error) {
+	for _, head := range m.heads {
+		if head.MapRevision == revision {
+			return head, nil
+		}
+	}
+	root, ok, err := m.readMapRoot(selectSignedMapRootSQL, m.params("revision", revision, "deleted", m.deletedHeads.param()))
+	if err != nil || ok {
+		return root, err
+	}
+
+	// The roots of pruned revisions are removed
+	oldest, err := m.OldestRetainedRevision()
+	if err != nil {
+		return trillian.SignedMapRoot{}, err
+	}
+	if revision < oldest {
+		return trillian.SignedMapRoot{}, storage.RevisionOutOfRangeError{Revision: revision, OldestRetained: oldest}
+	}
+	return trillian.SignedMapRoot{}, storage.ErrMapRootNotFound
+}
+
+func (m *mapTX) StoreSignedMapRoot(root trillian.SignedMapRoot) error {
+	signatureBytes, err := storage.MarshalRootSignature(root.Signature, root.KeySignatures)
+	if err != nil {
+		glog.Warningf("Failed to marshal root signature: %v %v", root.Signature, err)
+		return err
+	}
+
+	mapperMetaBytes, err := marshalMapperMetadata(root.Metadata)
+	if err != nil {
+		return err
+	}
+
+	m.buffer(spanner.Insert("MapHead", mapHeadColumns, []interface{}{m.ms.mapID.TreeID, root.TimestampNanos, root.RootHash,
+		root.MapRevision, signatureBytes, mapperMetaBytes}))
+	m.heads[root.TimestampNanos] = root
+	m.writesRevision = true
+	return nil
+}
+
+// deleteHead buffers the deletion of the root with the timestamp.
+func (m *mapTX) deleteHead(timestampNanos int64) {
+	m.buffer(spanner.Delete("MapHead", spanner.Key{m.ms.mapID.TreeID, timestampNanos}))
+	delete(m.heads, timestampNanos)
+	m.deletedHeads.add(timestampNanos)
+}
+
+// publishedRootCount returns the number of roots published for revision.
+func (m *mapTX) publishedRootCount(revision int64) (int64, error) {
+	var count int64
+	if _, err := m.queryRow(selectMapHeadRevisionCountSQL, m.params("revision", revision, "deleted", m.deletedHeads.param()), &count); err != nil {
+		return 0, err
+	}
+	for _, head := range m.heads {
+		if head.MapRevision == revision {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mapTX) RefreshSignedMapRoot(root trillian.SignedMapRoot) error {
+	current, err := m.LatestSignedMapRoot()
+	if err != nil {
+		return err
+	}
+	if current.MapRevision != root.MapRevision || !bytes.Equal(current.RootHash, root.RootHash) {
+		return fmt.Errorf("refreshed root at revision %d does not match the latest root at revision %d", root.MapRevision, current.MapRevision)
+	}
+
+	signatureBytes, err := storage.MarshalRootSignature(root.Signature, root.KeySignatures)
+	if err != nil {
+		glog.Warningf("Failed to marshal root signature: %v %v", root.Signature, err)
+		return err
+	}
+
+	mapperMetaBytes, err := marshalMapperMetadata(root.Metadata)
+	if err != nil {
+		return err
+	}
+
+	// The timestamp is part of the key, so the root is replaced rather than updated
+	m.deleteHead(current.TimestampNanos)
+	m.buffer(spanner.Insert("MapHead", mapHeadColumns, []interface{}{m.ms.mapID.TreeID, root.TimestampNanos, root.RootHash,
+		root.MapRevision, signatureBytes, mapperMetaBytes}))
+	m.heads[root.TimestampNanos] = root
+	// Refreshing a root that's no longer the head would make it the latest again
+	m.writesRevision = true
+	return nil
+}
+
+func (m *mapTX) StagedSignedMapRoot() (trillian.SignedMapRoot, bool, error) {
+	if m.stagedSet {
+		if m.staged == nil {
+			return trillian.SignedMapRoot{}, false, nil
+		}
+		return *m.staged, true, nil
+	}
+
+	var timestamp, mapRevision int64
+	var rootHash, mapperMetaBytes []byte
+
+	found, err := m.queryRow(selectMapStagedHeadSQL, m.params(), &mapRevision, &rootHash, &timestamp, &mapperMetaBytes)
+	if err != nil {
+		glog.Warningf("Failed to read staged map root: %v", err)
+		return trillian.SignedMapRoot{}, false, err
+	}
+	if !found {
+		return trillian.SignedMapRoot{}, false, nil
+	}
+
+	mapperMeta, err := unmarshalMapperMetadata(mapperMetaBytes)
+	if err != nil {
+		return trillian.SignedMapRoot{}, false, err
+	}
+
+	return trillian.SignedMapRoot{
+		RootHash:       rootHash,
+		TimestampNanos: timestamp,
+		MapRevision:    mapRevision,
+		MapId:          m.ms.mapID.MapID,
+		Metadata:       mapperMeta,
+	}, true, nil
+}
+
+func (m *mapTX) StageSignedMapRoot(root trillian.SignedMapRoot) error {
+	if root.MapRevision != m.writeRevision {
+		return fmt.Errorf("can only stage root for write revision %d, but got revision %d", m.writeRevision, root.MapRevision)
+	}
+
+	mapperMetaBytes, err := marshalMapperMetadata(root.Metadata)
+	if err != nil {
+		return err
+	}
+
+	// The insert fails when the transaction commits if a revision is already staged
+	m.buffer(spanner.Insert("MapStagedHead", mapStagedHeadColumns, []interface{}{m.ms.mapID.TreeID, root.MapRevision,
+		root.RootHash, root.TimestampNanos, mapperMetaBytes}))
+	// As when it's read back, only the parts of the root that are stored
+	m.setStaged(&trillian.SignedMapRoot{
+		RootHash:       root.RootHash,
+		TimestampNanos: root.TimestampNanos,
+		MapRevision:    root.MapRevision,
+		MapId:          m.ms.mapID.MapID,
+		Metadata:       root.Metadata,
+	})
+	m.writesRevision = true
+	return nil
+}
+
+// setStaged records the staged root written by the transaction, nil if it
+// has been removed.
+func (m *mapTX) setStaged(root *trillian.SignedMapRoot) {
+	m.staged = root
+	m.stagedSet = true
+}
+
+func (m *mapTX) PublishStagedMapRoot(root trillian.SignedMapRoot) error {
+	staged, ok, err := m.StagedSignedMapRoot()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return storage.ErrNoStagedRevision
+	}
+	if staged.MapRevision != root.MapRevision || !bytes.Equal(staged.RootHash, root.RootHash) {
+		return fmt.Errorf("root for revision %d does not match staged root for revision %d", root.MapRevision, staged.MapRevision)
+	}
+
+	if err := m.StoreSignedMapRoot(root); err != nil {
+		return err
+	}
+
+	m.buffer(spanner.Delete("MapStagedHead", spanner.Key{m.ms.mapID.TreeID}))
+	m.setStaged(nil)
+	return nil
+}
+
+// deleteRowsAfter buffers the deletion of the leaves and subtrees written after
+// revision, and returns how many there were. If revertTimestamp is non-zero
+// they're first copied to the Abandoned tables for that revert.
+func (m *mapTX) deleteRowsAfter(revision int64, revertTimestamp int64) (int64, error) {
+	treeID := m.ms.mapID.TreeID
+	params := m.params("revision", revision)
+	var leaves, subtrees []revisionedRow
+	if revision < m.readLimit {
+		var err error
+		if leaves, err = m.readLeafRows(selectMapLeavesAfterRevisionSQL, params); err != nil {
+			return 0, err
+		}
+		err = m.query(selectSubtreesAfterRevisionSQL, params, func(row *spanner.Row) error {
+			var r revisionedRow
+			if err := row.Columns(&r.id, &r.revision, &r.data); err != nil {
+				return err
+			}
+			subtrees = append(subtrees, r)
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		m.readLimit = revision
+	}
+	// The rows written by the transaction are deleted after they're inserted
+	leaves = append(leaves, m.leaves.removeAfter(revision)...)
+	subtrees = append(subtrees, m.subtrees.removeAfter(revision)...)
+
+	for _, r := range leaves {
+		if revertTimestamp != 0 {
+			m.buffer(spanner.Insert("AbandonedMapLeaf", abandonedMapLeafColumns, []interface{}{treeID, revertTimestamp, r.id, r.revision, r.data}))
+		}
+		m.buffer(spanner.Delete("MapLeaf", spanner.Key{treeID, r.id, r.revision}))
+	}
+	for _, r := range subtrees {
+		if revertTimestamp != 0 {
+			m.buffer(spanner.Insert("AbandonedSubtree", abandonedSubtreeColumns, []interface{}{treeID, revertTimestamp, r.id, r.revision, r.data}))
+		}
+		m.buffer(spanner.Delete("Subtree", spanner.Key{treeID, r.id, r.revision}))
+	}
+	return int64(len(leaves) + len(subtrees)), nil
+}
+
+func (m *mapTX) AbandonStagedMapRoot() error {
+	staged, ok, err := m.StagedSignedMapRoot()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return storage.ErrNoStagedRevision
+	}
+
+	// Only the staged revision can have been written after the latest root
+	if _, err := m.deleteRowsAfter(staged.MapRevision-1, 0); err != nil {
+		glog.Warningf("Failed to delete data for staged revision %d: %s", staged.MapRevision, err)
+		return err
+	}
+
+	m.buffer(spanner.Delete("MapStagedHead", spanner.Key{m.ms.mapID.TreeID}))
+	m.setStaged(nil)
+	return nil
+}
+
+func (m *mapTX) RevertMapHead(revision int64, reason string, timestampNanos int64) (storage.MapHeadRevert, error) {
+	if _, ok, err := m.StagedSignedMapRoot(); err != nil {
+		return storage.MapHeadRevert{}, err
+	} else if ok {
+		return storage.MapHeadRevert{}, errors.New("cannot revert map with a staged revision")
+	}
+
+	latest, err := m.LatestSignedMapRoot()
+	if err != nil {
+		return storage.MapHeadRevert{}, err
+	}
+	if revision < 0 || revision >= latest.MapRevision {
+		return storage.MapHeadRevert{}, fmt.Errorf("can only revert to a revision before the latest (%d), got %d", latest.MapRevision, revision)
+	}
+
+	count, err := m.publishedRootCount(revision)
+	if err != nil {
+		return storage.MapHeadRevert{}, err
+	}
+	if count != 1 {
+		return storage.MapHeadRevert{}, fmt.Errorf("no published root for revision %d", revision)
+	}
+
+	revert := storage.MapHeadRevert{
+		TimestampNanos: timestampNanos,
+		FromRevision:   latest.MapRevision,
+		ToRevision:     revision,
+		Reason:         reason,
+	}
+
+	treeID := m.ms.mapID.TreeID
+	m.buffer(spanner.Insert("MapHeadRevert", mapHeadRevertColumns, []interface{}{treeID, timestampNanos, revert.FromRevision, revert.ToRevision, reason}))
+
+	if err = m.abandonHeadsAfter(revision, timestampNanos); err == nil {
+		_, err = m.deleteRowsAfter(revision, timestampNanos)
+	}
+	// Tags must not end up referring to revisions written after the revert, so
+	// they're removed and recorded with it
+	abandoned := make(map[string]revisionTag)
+	if err == nil {
+		err = m.query(selectMapRevisionTagsAfterRevisionSQL, m.params("revision", revision), func(row *spanner.Row) error {
+			var tag string
+			var t revisionTag
+			if err := row.Columns(&tag, &t.revision, &t.timestampNanos); err != nil {
+				return err
+			}
+			// The transaction's own view of a tag it has written or deleted wins
+			if _, ok := m.tags[tag]; !ok {
+				abandoned[tag] = t
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		glog.Warningf("Failed to revert map head to revision %d: %s", revision, err)
+		return storage.MapHeadRevert{}, err
+	}
+	for tag, t := range m.tags {
+		if t != nil && t.revision > revision {
+			abandoned[tag] = *t
+		}
+	}
+	for tag, t := range abandoned {
+		if revert.AbandonedTags == nil {
+			revert.AbandonedTags = make(map[string]int64)
+		}
+		revert.AbandonedTags[tag] = t.revision
+		m.buffer(spanner.Insert("AbandonedMapRevisionTag", abandonedMapRevisionTagColumns, []interface{}{treeID, timestampNanos, tag, t.revision, t.timestampNanos}))
+		m.deleteTag(tag)
+	}
+	m.reverts = append(m.reverts, revert)
+
+	// Subsequent writes in this transaction follow the abandoned revisions,
+	// which aren't reused, and the revert must not race with a write of the
+	// next revision
+	m.writeRevision = latest.MapRevision + 1
+	m.writesRevision = true
+
+	return revert, nil
+}
+
+// abandonHeadsAfter buffers the deletion of the roots after revision, which
+// are first copied to AbandonedMapHead for the revert at timestampNanos.
+func (m *mapTX) abandonHeadsAfter(revision int64, timestampNanos int64) error {
+	treeID := m.ms.mapID.TreeID
+	var timestamps []int64
+	err := m.query(selectMapHeadsAfterRevisionSQL, m.params("revision", revision, "deleted", m.deletedHeads.param()), func(row *spanner.Row) error {
+		var headTimestamp, headRevision int64
+		var rootHash, rootSignature, mapperData []byte
+		if err := row.Columns(&headTimestamp, &rootHash, &headRevision, &rootSignature, &mapperData); err != nil {
+			return err
+		}
+		m.buffer(spanner.Insert("AbandonedMapHead", abandonedMapHeadColumns, []interface{}{treeID, timestampNanos, headTimestamp, rootHash, headRevision, rootSignature, mapperData}))
+		timestamps = append(timestamps, headTimestamp)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, head := range m.heads {
+		if head.MapRevision <= revision {
+			continue
+		}
+		rootSignature, err := storage.MarshalRootSignature(head.Signature, head.KeySignatures)
+		if err != nil {
+			return err
+		}
+		mapperData, err := marshalMapperMetadata(head.Metadata)
+		if err != nil {
+			return err
+		}
+		m.buffer(spanner.Insert("AbandonedMapHead", abandonedMapHeadColumns, []interface{}{treeID, timestampNanos, head.TimestampNanos, head.RootHash, head.MapRevision, rootSignature, mapperData}))
+		timestamps = append(timestamps, head.TimestampNanos)
+	}
+	for _, timestamp := range timestamps {
+		m.deleteHead(timestamp)
+	}
+	return nil
+}
+
+func (m *mapTX) SkipMapRevisions(revision int64, reason string, timestampNanos int64) error {
+	switch {
+	case revision+1 < m.writeRevision:
+		return fmt.Errorf("revisions up to %d are already in use, can't skip to %d", m.writeRevision-1, revision)
+	case revision+1 == m.writeRevision:
+		return nil
+	}
+	if _, ok, err := m.StagedSignedMapRoot(); err != nil {
+		return err
+	} else if ok {
+		return errors.New("cannot skip revisions of map with a staged revision")
+	}
+
+	latest, err := m.LatestSignedMapRoot()
+	if err != nil {
+		return err
+	}
+	// The skip is recorded as a revert of the skipped revisions to the latest
+	m.buffer(spanner.Insert("MapHeadRevert", mapHeadRevertColumns, []interface{}{m.ms.mapID.TreeID, timestampNanos, revision, latest.MapRevision, reason}))
+	m.reverts = append(m.reverts, storage.MapHeadRevert{TimestampNanos: timestampNanos, FromRevision: revision, ToRevision: latest.MapRevision, Reason: reason})
+	m.writeRevision = revision + 1
+	m.writesRevision = true
+	return nil
+}
+
+// RemovePartialRevisions implements storage.PartialRevisionRemover.
+func (m *mapTX) RemovePartialRevisions() (int64, error) {
+	root, err := m.LatestSignedMapRoot()
+	if err != nil {
+		return 0, err
+	}
+	revision := root.MapRevision
+	if staged, ok, err := m.StagedSignedMapRoot(); err != nil {
+		return 0, err
+	} else if ok && staged.MapRevision > revision {
+		revision = staged.MapRevision
+	}
+
+	removed, err := m.deleteRowsAfter(revision, 0)
+	if err != nil {
+		glog.Warningf("Failed to remove revisions after %d: %s", revision, err)
+		return 0, err
+	}
+	return removed, nil
+}
+
+func (m *mapTX) MapHeadReverts() ([]storage.MapHeadRevert, error) {
+	ret := make([]storage.MapHeadRevert, 0)
+	err := m.query(selectMapHeadRevertsSQL, m.params(), func(row *spanner.Row) error {
+		var revert storage.MapHeadRevert
+		if err := row.Columns(&revert.TimestampNanos, &revert.FromRevision, &revert.ToRevision, &revert.Reason); err != nil {
+			return err
+		}
+		ret = append(ret, revert)
+		return nil
+	})
+	if err == nil {
+		err = m.query(selectAbandonedMapRevisionTagsSQL, m.params(), func(row *spanner.Row) error {
+			var timestampNanos, revision int64
+			var tag string
+			if err := row.Columns(&timestampNanos, &tag, &revision); err != nil {
+				return err
+			}
+			for i := range ret {
+				if ret[i].TimestampNanos == timestampNanos {
+					if ret[i].AbandonedTags == nil {
+						ret[i].AbandonedTags = make(map[string]int64)
+					}
+					ret[i].AbandonedTags[tag] = revision
+				}
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		glog.Warningf("Failed to read map head reverts: %s", err)
+		return nil, err
+	}
+
+	ret = append(ret, m.reverts...)
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].TimestampNanos < ret[j].TimestampNanos })
+	return ret, nil
+}
+
+func (m *mapTX) GetRevisionForTag(tag string) (int64, error) {
+	if t, ok := m.tags[tag]; ok {
+		if t == nil {
+			return 0, storage.ErrTagNotFound
+		}
+		return t.revision, nil
+	}
+
+	var revision int64
+	found, err := m.queryRow(selectMapRevisionForTagSQL, m.params("tag", tag), &revision)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, storage.ErrTagNotFound
+	}
+
+	return revision, nil
+}
+
+func (m *mapTX) GetRevisionTags() (map[string]int64, error) {
+	ret := make(map[string]int64)
+	err := m.query(selectMapRevisionTagsSQL, m.params(), func(row *spanner.Row) error {
+		var tag string
+		var revision int64
+		if err := row.Columns(&tag, &revision); err != nil {
+			return err
+		}
+		ret[tag] = revision
+		return nil
+	})
+	if err != nil {
+		glog.Warningf("Failed to read map revision tags: %s", err)
+		return nil, err
+	}
+
+	for tag, t := range m.tags {
+		if t == nil {
+			delete(ret, tag)
+		} else {
+			ret[tag] = t.revision
+		}
+	}
+	return ret, nil
+}
+
+func (m *mapTX) TagMapRevision(tag string, revision int64, timestampNanos int64) error {
+	if len(tag) == 0 || len(tag) > maxTagLength {
+		return fmt.Errorf("map revision tag must be between 1 and %d bytes long", maxTagLength)
+	}
+
+	count, err := m.publishedRootCount(revision)
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return fmt.Errorf("no published root for revision %d", revision)
+	}
+
+	// The insert fails when the transaction commits if the tag already exists
+	m.buffer(spanner.Insert("MapRevisionTag", mapRevisionTagColumns, []interface{}{m.ms.mapID.TreeID, tag, revision, timestampNanos}))
+	m.tags[tag] = &revisionTag{revision: revision, timestampNanos: timestampNanos}
+	return nil
+}
+
+// revisionTag is the revision and timestamp of a map revision tag.
+type revisionTag struct {
+	revision       int64
+	timestampNanos int64
+}
+
+// deleteTag buffers the deletion of tag.
+func (m *mapTX) deleteTag(tag string) {
+	m.buffer(spanner.Delete("MapRevisionTag", spanner.Key{m.ms.mapID.TreeID, tag}))
+	m.tags[tag] = nil
+}
+
+// getRetention returns the retention settings for the map, which are the zero
+// values if none have been stored.
+func (m *mapTX) getRetention() (storage.RetentionPolicy, int64, error) {
+	var maxRevisions, maxAgeSeconds, oldest spanner.NullInt64
+	if _, err := m.queryRow(selectTreeRetentionSQL, m.params(), &maxRevisions, &maxAgeSeconds, &oldest); err != nil {
+		glog.Warningf("Failed to read tree retention: %s", err)
+		return storage.RetentionPolicy{}, 0, err
+	}
+
+	policy := storage.RetentionPolicy{
+		MaxRevisions: maxRevisions.Int64,
+		MaxAge:       time.Duration(maxAgeSeconds.Int64) * time.Second,
+	}
+	if m.retention != nil {
+		policy = *m.retention
+	}
+	if m.oldestRetained != nil {
+		return policy, *m.oldestRetained, nil
+	}
+	return policy, oldest.Int64, nil
+}
+
+func (m *mapTX) GetRetentionPolicy() (storage.RetentionPolicy, error) {
+	policy, _, err := m.getRetention()
+	return policy, err
+}
+
+func (m *mapTX) SetRetentionPolicy(policy storage.RetentionPolicy) error {
+	if policy.MaxRevisions < 0 || policy.MaxAge < 0 {
+		return fmt.Errorf("invalid retention policy: %+v", policy)
+	}
+
+	m.buffer(spanner.InsertOrUpdate("TreeRetention", treeRetentionPolicyColumns,
+		[]interface{}{m.ms.mapID.TreeID, policy.MaxRevisions, int64(policy.MaxAge / time.Second)}))
+	// The stored policy is read back to the second
+	policy.MaxAge = policy.MaxAge / time.Second * time.Second
+	m.retention = &policy
+	return nil
+}
+
+func (m *mapTX) OldestRetainedRevision() (int64, error) {
+	_, oldest, err := m.getRetention()
+	return oldest, err
+}
+
+func (m *mapTX) EarliestRevisionSince(timestampNanos int64) (int64, error) {
+	var revision spanner.NullInt64
+	if _, err := m.queryRow(selectEarliestMapRevisionSinceSQL, m.params("timestamp", timestampNanos, "deleted", m.deletedHeads.param()), &revision); err != nil {
+		return 0, err
+	}
+	for _, head := range m.heads {
+		if head.TimestampNanos >= timestampNanos && (!revision.Valid || head.MapRevision < revision.Int64) {
+			revision = spanner.NullInt64{Int64: head.MapRevision, Valid: true}
+		}
+	}
+	if revision.Valid {
+		return revision.Int64, nil
+	}
+
+	root, err := m.LatestSignedMapRoot()
+	if err != nil {
+		return 0, err
+	}
+	return root.MapRevision, nil
+}
+
+func (m *mapTX) PruneRevisionsBefore(revision int64) error {
+	root, err := m.LatestSignedMapRoot()
+	if err != nil {
+		return err
+	}
+	if revision > root.MapRevision {
+		return fmt.Errorf("cannot prune revisions before %d, latest revision is %d", revision, root.MapRevision)
+	}
+
+	// The oldest retained revision never moves backwards
+	oldest, err := m.OldestRetainedRevision()
+	if err != nil {
+		return err
+	}
+	if revision > oldest {
+		m.buffer(spanner.InsertOrUpdate("TreeRetention", oldestRetainedRevisionColumns, []interface{}{m.ms.mapID.TreeID, revision}))
+		m.oldestRetained = &revision
+	}
+
+	var timestamps []int64
+	err = m.query(selectMapHeadsBeforeRevisionSQL, m.params("revision", revision, "deleted", m.deletedHeads.param()), func(row *spanner.Row) error {
+		var headTimestamp int64
+		if err := row.Columns(&headTimestamp); err != nil {
+			return err
+		}
+		timestamps = append(timestamps, headTimestamp)
+		return nil
+	})
+	if err != nil {
+		glog.Warningf("Failed to prune map roots before revision %d: %s", revision, err)
+		return err
+	}
+	for _, head := range m.heads {
+		if head.MapRevision < revision {
+			timestamps = append(timestamps, head.TimestampNanos)
+		}
+	}
+	for _, timestamp := range timestamps {
+		m.deleteHead(timestamp)
+	}
+
+	return nil
+}
+
+// checkDeletable returns an error if the data superseded before revision can't
+// be deleted, see DeleteMapLeavesBelowRevision.
+func (m *mapTX) checkDeletable(revision int64) error {
+	oldest, err := m.OldestRetainedRevision()
+	if err != nil {
+		return err
+	}
+	return storage.CheckRevisionDeletable(revision, oldest, m.restoredFrom)
+}
+
+// deleteSuperseded buffers the deletion of the rows of the named table
+// returned by sql, which must select their ID and revision columns. It returns
+// the number of rows deleted.
+func (m *mapTX) deleteSuperseded(table, sql string, revision int64) (int64, error) {
+	treeID := m.ms.mapID.TreeID
+	var deleted int64
+	err := m.query(sql, m.params("revision", revision), func(row *spanner.Row) error {
+		var id []byte
+		var rev int64
+		if err := row.Columns(&id, &rev); err != nil {
+			return err
+		}
+		m.buffer(spanner.Delete(table, spanner.Key{treeID, id, rev}))
+		deleted++
+		return nil
+	})
+	if err != nil {
+		glog.Warningf("Failed to read superseded rows of %s: %s", table, err)
+		return 0, err
+	}
+	return deleted, nil
+}
+
+func (m *mapTX) DeleteMapLeavesBelowRevision(revision int64) (int64, error) {
+	if err := m.checkDeletable(revision); err != nil {
+		return 0, err
+	}
+
+	deleted, err := m.deleteSuperseded("MapLeaf", selectSupersededMapLeavesSQL, revision)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := m.deleteSuperseded("Subtree", selectSupersededSubtreesSQL, revision); err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// checkArchivable returns the oldest retained revision, which revision must be before.
+func (m *mapTX) checkArchivable(revision int64) (int64, error) {
+	oldest, err := m.OldestRetainedRevision()
+	if err != nil {
+		return 0, err
+	}
+	return oldest, storage.CheckRevisionArchivable(revision, oldest)
+}
+
+// getArchivableLeaves returns the leaves written at revision that are superseded
+// by the oldest retained revision.
+func (m *mapTX) getArchivableLeaves(revision, oldest int64) ([]*storage.ArchivedLeaf, error) {
+	var leaves []*storage.ArchivedLeaf
+	err := m.query(selectArchivableMapLeavesSQL, m.params("revision", revision, "oldest", oldest), func(row *spanner.Row) error {
+		var keyHash, data []byte
+		if err := row.Columns(&keyHash, &data); err != nil {
+			return err
+		}
+		leaves = append(leaves, &storage.ArchivedLeaf{KeyHash: keyHash, LeafData: data})
+		return nil
+	})
+	if err != nil {
+		glog.Warningf("Failed to read archivable map leaves: %s", err)
+		return nil, err
+	}
+	return leaves, nil
+}
+
+// getArchivableSubtrees returns the subtrees written at revision that are
+// superseded by the oldest retained revision.
+func (m *mapTX) getArchivableSubtrees(revision, oldest int64) ([]*storage.SubtreeProto, error) {
+	var subtrees []*storage.SubtreeProto
+	err := m.query(selectArchivableSubtreesSQL, m.params("revision", revision, "oldest", oldest), func(row *spanner.Row) error {
+		var subtreeID, nodesRaw []byte
+		if err := row.Columns(&subtreeID, &nodesRaw); err != nil {
+			return err
+		}
+		var subtree storage.SubtreeProto
+		if err := proto.Unmarshal(nodesRaw, &subtree); err != nil {
+			glog.Warningf("Failed to unmarshal SubtreeProto: %s", err)
+			return err
+		}
+		subtree.Prefix = subtreeID
+		subtrees = append(subtrees, &subtree)
+		return nil
+	})
+	if err != nil {
+		glog.Warningf("Failed to read archivable subtrees: %s", err)
+		return nil, err
+	}
+	return subtrees, nil
+}
+
+func (m *mapTX) GetArchivableRevision(revision int64) (*storage.ArchiveSegment, error) {
+	oldest, err := m.checkArchivable(revision)
+	if err != nil {
+		return nil, err
+	}
+
+	segment := &storage.ArchiveSegment{TreeId: m.ms.mapID.TreeID, Revision: revision}
+	if segment.Leaves, err = m.getArchivableLeaves(revision, oldest); err != nil {
+		return nil, err
+	}
+	if segment.Subtrees, err = m.getArchivableSubtrees(revision, oldest); err != nil {
+		return nil, err
+	}
+	return segment, nil
+}
+
+func (m *mapTX) ArchiveRevision(revision int64, segment string) error {
+	archivable, err := m.GetArchivableRevision(revision)
+	if err != nil {
+		return err
+	}
+
+	treeID := m.ms.mapID.TreeID
+	for _, leaf := range archivable.Leaves {
+		m.buffer(spanner.Delete("MapLeaf", spanner.Key{treeID, leaf.KeyHash, revision}))
+	}
+	for _, subtree := range archivable.Subtrees {
+		m.buffer(spanner.Delete("Subtree", spanner.Key{treeID, subtree.Prefix, revision}))
+	}
+
+	m.buffer(spanner.InsertOrUpdate("ArchivedRevision", archivedRevisionColumns, []interface{}{treeID, revision, segment}))
+	m.archived[revision] = segment
+	return nil
+}
+
+func (m *mapTX) GetArchivedRevisions() (map[int64]string, error) {
+	ret := make(map[int64]string)
+	err := m.query(selectArchivedRevisionsSQL, m.params(), func(row *spanner.Row) error {
+		var revision int64
+		var segment string
+		if err := row.Columns(&revision, &segment); err != nil {
+			return err
+		}
+		ret[revision] = segment
+		return nil
+	})
+	if err != nil {
+		glog.Warningf("Failed to read archived revisions: %s", err)
+		return nil, err
+	}
+
+	for revision, segment := range m.archived {
+		ret[revision] = segment
+	}
+	return ret, nil
+}
+
+func (m *mapTX) RestoreArchivedRevision(segment *storage.ArchiveSegment) error {
+	if segment.TreeId != m.ms.mapID.TreeID {
+		return fmt.Errorf("archive segment is for tree %d, not %d", segment.TreeId, m.ms.mapID.TreeID)
+	}
+
+	// Restoring rows that are already present rewrites them with the same data
+	for _, leaf := range segment.Leaves {
+		m.buffer(spanner.InsertOrUpdate("MapLeaf", mapLeafColumns, []interface{}{segment.TreeId, leaf.KeyHash, segment.Revision, leaf.LeafData}))
+		m.leaves.set(leaf.KeyHash, segment.Revision, leaf.LeafData)
+	}
+
+	for _, subtree := range segment.Subtrees {
+		subtreeID := subtree.Prefix
+		if subtreeID == nil {
+			subtreeID = []byte{}
+		}
+		subtreeBytes, err := proto.Marshal(subtree)
+		if err != nil {
+			return err
+		}
+		m.buffer(spanner.InsertOrUpdate("Subtree", subtreeColumns, []interface{}{segment.TreeId, subtreeID, segment.Revision, subtreeBytes}))
+		m.subtrees.set(subtreeID, segment.Revision, subtreeBytes)
+	}
+
+	return nil
+}
+
+func (m *mapTX) SetRevisionRestored(revision int64, expiresNanos int64) error {
+	m.buffer(spanner.InsertOrUpdate("RestoredRevision", restoredRevisionColumns, []interface{}{m.ms.mapID.TreeID, revision, expiresNanos}))
+	m.restored[revision] = &expiresNanos
+	return nil
+}
+
+func (m *mapTX) GetRestoredRevisions() (map[int64]int64, error) {
+	ret := make(map[int64]int64)
+	err := m.query(selectRestoredRevisionsSQL, m.params(), func(row *spanner.Row) error {
+		var revision, expires int64
+		if err := row.Columns(&revision, &expires); err != nil {
+			return err
+		}
+		ret[revision] = expires
+		return nil
+	})
+	if err != nil {
+		glog.Warningf("Failed to read restored revisions: %s", err)
+		return nil, err
+	}
+
+	for revision, expires := range m.restored {
+		if expires == nil {
+			delete(ret, revision)
+		} else {
+			ret[revision] = *expires
+		}
+	}
+	return ret, nil
+}
+
+func (m *mapTX) ClearRevisionRestored(revision int64) error {
+	m.buffer(spanner.Delete("RestoredRevision", spanner.Key{m.ms.mapID.TreeID, revision}))
+	m.restored[revision] = nil
+	return nil
+}
@@ -0,0 +1,161 @@
+package cloudspanner
+
+import (
+	"bytes"
+	"sort"
+)
+
+// revisionedRows holds the rows of a table keyed by ID and revision, such as
+// map leaves or subtrees, that a transaction has written. Spanner doesn't show
+// a transaction its own buffered mutations, so reads merge these with the rows
+// they read.
+type revisionedRows map[string]map[int64][]byte
+
+// revisionedRow is a row of a revisionedRows.
+type revisionedRow struct {
+	id       []byte
+	revision int64
+	data     []byte
+}
+
+func (r revisionedRows) set(id []byte, revision int64, data []byte) {
+	revisions, ok := r[string(id)]
+	if !ok {
+		revisions = make(map[int64][]byte)
+		r[string(id)] = revisions
+	}
+	revisions[revision] = data
+}
+
+// latest returns the row for id with the highest revision no later than
+// revision, if there is one.
+func (r revisionedRows) latest(id []byte, revision int64) (revisionedRow, bool) {
+	found := false
+	var ret revisionedRow
+	for rev, data := range r[string(id)] {
+		if rev <= revision && (!found || rev > ret.revision) {
+			ret = revisionedRow{id: id, revision: rev, data: data}
+			found = true
+		}
+	}
+	return ret, found
+}
+
+// ids returns the IDs that have rows, in order.
+func (r revisionedRows) ids() [][]byte {
+	ids := make([][]byte, 0, len(r))
+	for id := range r {
+		ids = append(ids, []byte(id))
+	}
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i], ids[j]) < 0 })
+	return ids
+}
+
+// filter returns the rows whose IDs keep returns true for.
+func (r revisionedRows) filter(keep func(id []byte) bool) revisionedRows {
+	ret := make(revisionedRows)
+	for id, revisions := range r {
+		if keep([]byte(id)) {
+			ret[id] = revisions
+		}
+	}
+	return ret
+}
+
+// subset returns the rows of ids.
+func (r revisionedRows) subset(ids [][]byte) revisionedRows {
+	want := make(map[string]bool)
+	for _, id := range ids {
+		want[string(id)] = true
+	}
+	return r.filter(func(id []byte) bool { return want[string(id)] })
+}
+
+// removeAfter removes and returns the rows with revisions after revision.
+func (r revisionedRows) removeAfter(revision int64) []revisionedRow {
+	var removed []revisionedRow
+	for id, revisions := range r {
+		for rev, data := range revisions {
+			if rev > revision {
+				removed = append(removed, revisionedRow{id: []byte(id), revision: rev, data: data})
+				delete(revisions, rev)
+			}
+		}
+		if len(revisions) == 0 {
+			delete(r, id)
+		}
+	}
+	return removed
+}
+
+// mergeLatest combines the latest row of each ID read from the database with
+// the rows written by the transaction, returning the latest row for each ID at
+// or before revision ordered by ID. A row written by the transaction replaces
+// a stored one at the same revision.
+func mergeLatest(stored []revisionedRow, pending revisionedRows, revision int64) []revisionedRow {
+	latest := make(map[string]revisionedRow)
+	for _, row := range stored {
+		latest[string(row.id)] = row
+	}
+	for _, id := range pending.ids() {
+		row, ok := pending.latest(id, revision)
+		if !ok {
+			continue
+		}
+		if s, ok := latest[string(id)]; ok && s.revision > row.revision {
+			continue
+		}
+		latest[string(id)] = row
+	}
+	ret := make([]revisionedRow, 0, len(latest))
+	for _, row := range latest {
+		ret = append(ret, row)
+	}
+	sort.Slice(ret, func(i, j int) bool { return bytes.Compare(ret[i].id, ret[j].id) < 0 })
+	return ret
+}
+
+// mergeAt combines the rows at revision read from the database with those
+// written by the transaction, ordered by ID.
+func mergeAt(stored []revisionedRow, pending revisionedRows, revision int64) []revisionedRow {
+	rows := make(revisionedRows)
+	for _, row := range stored {
+		rows.set(row.id, revision, row.data)
+	}
+	for id, revisions := range pending {
+		if data, ok := revisions[revision]; ok {
+			rows.set([]byte(id), revision, data)
+		}
+	}
+	ret := make([]revisionedRow, 0, len(rows))
+	for _, id := range rows.ids() {
+		ret = append(ret, revisionedRow{id: id, revision: revision, data: rows[string(id)][revision]})
+	}
+	return ret
+}
+
+// deletedKeys is the set of keys of a table's rows that a transaction has
+// deleted, which reads of the table leave out. The keys are kept in a slice to
+// be passed as a query parameter, which is never NULL.
+type deletedKeys struct {
+	keys []int64
+	set  map[int64]bool
+}
+
+func (d *deletedKeys) add(key int64) {
+	if d.set == nil {
+		d.set = make(map[int64]bool)
+	}
+	if !d.set[key] {
+		d.set[key] = true
+		d.keys = append(d.keys, key)
+	}
+}
+
+// param returns the deleted keys as a query parameter.
+func (d *deletedKeys) param() []int64 {
+	if d.keys == nil {
+		return []int64{}
+	}
+	return d.keys
+}
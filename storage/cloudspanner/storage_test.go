@@ -0,0 +1,121 @@
+package cloudspanner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/trillian"
+)
+
+func TestMapTXParams(t *testing.T) {
+	m := &mapTX{ms: &spannerMapStorage{mapID: trillian.MapID{TreeID: 7}}}
+
+	got := m.params("revision", int64(3), "keys", [][]byte{{1}})
+	want := map[string]interface{}{"tree": int64(7), "revision": int64(3), "keys": [][]byte{{1}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("params() = %v, want %v", got, want)
+	}
+}
+
+func TestRevisionedRowsLatest(t *testing.T) {
+	rows := make(revisionedRows)
+	rows.set([]byte("a"), 2, []byte("a2"))
+	rows.set([]byte("a"), 5, []byte("a5"))
+
+	for _, test := range []struct {
+		revision int64
+		want     string
+		ok       bool
+	}{
+		{revision: 1},
+		{revision: 2, want: "a2", ok: true},
+		{revision: 4, want: "a2", ok: true},
+		{revision: 5, want: "a5", ok: true},
+	} {
+		row, ok := rows.latest([]byte("a"), test.revision)
+		if ok != test.ok || string(row.data) != test.want {
+			t.Errorf("latest(a, %d) = %q, %v, want %q, %v", test.revision, row.data, ok, test.want, test.ok)
+		}
+	}
+	if _, ok := rows.latest([]byte("b"), 5); ok {
+		t.Errorf("latest(b, 5) found a row that wasn't set")
+	}
+}
+
+func TestRevisionedRowsRemoveAfter(t *testing.T) {
+	rows := make(revisionedRows)
+	rows.set([]byte("a"), 2, []byte("a2"))
+	rows.set([]byte("a"), 5, []byte("a5"))
+	rows.set([]byte("b"), 6, []byte("b6"))
+
+	removed := rows.removeAfter(4)
+	if got, want := len(removed), 2; got != want {
+		t.Errorf("removeAfter(4) removed %d rows, want %d", got, want)
+	}
+	if got, want := rows.ids(), [][]byte{[]byte("a")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ids() after removeAfter(4) = %q, want %q", got, want)
+	}
+	if row, _ := rows.latest([]byte("a"), 10); string(row.data) != "a2" {
+		t.Errorf("latest(a, 10) after removeAfter(4) = %q, want a2", row.data)
+	}
+}
+
+func TestMergeLatest(t *testing.T) {
+	stored := []revisionedRow{
+		{id: []byte("a"), revision: 3, data: []byte("stored a3")},
+		{id: []byte("c"), revision: 1, data: []byte("stored c1")},
+		{id: []byte("d"), revision: 4, data: []byte("stored d4")},
+	}
+	pending := make(revisionedRows)
+	pending.set([]byte("a"), 4, []byte("pending a4"))
+	pending.set([]byte("b"), 4, []byte("pending b4"))
+	pending.set([]byte("c"), 6, []byte("pending c6"))
+	pending.set([]byte("d"), 2, []byte("pending d2"))
+
+	got := mergeLatest(stored, pending, 4)
+	want := []revisionedRow{
+		{id: []byte("a"), revision: 4, data: []byte("pending a4")},
+		{id: []byte("b"), revision: 4, data: []byte("pending b4")},
+		// The pending row is after the revision read
+		{id: []byte("c"), revision: 1, data: []byte("stored c1")},
+		// The stored row is later than the pending one
+		{id: []byte("d"), revision: 4, data: []byte("stored d4")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeLatest() = %v, want %v", got, want)
+	}
+}
+
+func TestMergeAt(t *testing.T) {
+	stored := []revisionedRow{
+		{id: []byte("b"), revision: 4, data: []byte("stored b")},
+		{id: []byte("c"), revision: 4, data: []byte("stored c")},
+	}
+	pending := make(revisionedRows)
+	pending.set([]byte("a"), 4, []byte("pending a"))
+	pending.set([]byte("c"), 4, []byte("pending c"))
+	pending.set([]byte("d"), 5, []byte("pending d"))
+
+	got := mergeAt(stored, pending, 4)
+	want := []revisionedRow{
+		{id: []byte("a"), revision: 4, data: []byte("pending a")},
+		{id: []byte("b"), revision: 4, data: []byte("stored b")},
+		{id: []byte("c"), revision: 4, data: []byte("pending c")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeAt() = %v, want %v", got, want)
+	}
+}
+
+func TestDeletedKeys(t *testing.T) {
+	var d deletedKeys
+	if got := d.param(); got == nil || len(got) != 0 {
+		t.Errorf("param() with no keys = %#v, want an empty slice", got)
+	}
+	d.add(3)
+	d.add(1)
+	d.add(3)
+	if got, want := d.param(), []int64{3, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("param() = %v, want %v", got, want)
+	}
+}
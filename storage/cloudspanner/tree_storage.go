@@ -0,0 +1,434 @@
+// Package cloudspanner implements LogStorage and MapStorage on Cloud Spanner,
+// for trees too large to keep in a single MySQL database. The schema is in
+// spanner.sdl, and trees are stored in subtrees of the same strata as in the
+// MySQL storage.
+//
+// Transactions read from a strong snapshot taken when they begin, and their
+// writes are buffered as mutations that are applied when they commit. Spanner
+// doesn't show a transaction its buffered mutations, so the transactions also
+// keep the rows they've written and deleted, which their reads are merged with.
+package cloudspanner
+
+import (
+	"fmt"
+	"math"
+
+	"cloud.google.com/go/spanner"
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/cache"
+	"golang.org/x/net/context"
+)
+
+const selectTreeHashingSQL = "SELECT TreeHasherType, HashStrategy, LeafHashPrefix, NodeHashPrefix FROM Trees WHERE TreeId=@tree"
+const selectTreeStrataSQL = "SELECT MapStrata FROM Trees WHERE TreeId=@tree"
+const selectTreeRevisionAtSizeSQL = `SELECT TreeRevision FROM TreeHead
+	 WHERE TreeId=@tree AND TreeSize=@size
+	 ORDER BY TreeRevision DESC LIMIT 1`
+const selectSubtreeSQL = `SELECT x.SubtreeId, x.MaxRevision, s.Nodes
+	 FROM (SELECT SubtreeId, MAX(SubtreeRevision) AS MaxRevision
+	       FROM Subtree
+	       WHERE TreeId=@tree AND SubtreeId IN UNNEST(@ids) AND SubtreeRevision<=@revision
+	       GROUP BY SubtreeId) AS x
+	 INNER JOIN Subtree s ON s.TreeId=@tree AND s.SubtreeId=x.SubtreeId AND s.SubtreeRevision=x.MaxRevision`
+
+var subtreeColumns = []string{"TreeId", "SubtreeId", "SubtreeRevision", "Nodes"}
+
+// rowReader is implemented by both read-only and read-write Spanner transactions.
+type rowReader interface {
+	Query(ctx context.Context, statement spanner.Statement) *spanner.RowIterator
+}
+
+// queryRow scans the first row returned by sql into ptrs, and returns false if
+// there are no rows.
+func queryRow(ctx context.Context, r rowReader, sql string, params map[string]interface{}, ptrs ...interface{}) (bool, error) {
+	found := false
+	err := r.Query(ctx, spanner.Statement{SQL: sql, Params: params}).Do(func(row *spanner.Row) error {
+		if found {
+			return nil
+		}
+		found = true
+		return row.Columns(ptrs...)
+	})
+	return found, err
+}
+
+// spannerTreeStorage is shared between the log and map storage, and contains
+// the functionality which is common to both.
+type spannerTreeStorage struct {
+	client          *spanner.Client
+	treeID          int64
+	hashSizeBytes   int
+	hashAlgorithm   trillian.HashAlgorithm
+	hashStrategy    trillian.HashStrategy
+	hashPrefixes    storage.TreeHashPrefixes
+	populateSubtree storage.PopulateSubtreeFunc
+	treeDepth       int
+	strataDepths    []int
+
+	// readHeadRevision returns the last revision the tree has used, which is
+	// that of its latest root unless later revisions of a map were reverted,
+	// or -1 if it has none. It's read again when committing transactions that
+	// write at the next revision, to check that nothing else wrote it first.
+	readHeadRevision func(ctx context.Context, r rowReader) (int64, error)
+}
+
+func newTreeStorage(client *spanner.Client, treeID int64, strata storage.StrataFunc, populate func(merkle.TreeHasher) storage.PopulateSubtreeFunc) (*spannerTreeStorage, error) {
+	alg, strategy, prefixes, err := readTreeHashing(client, treeID)
+	if err != nil {
+		return nil, err
+	}
+
+	th, err := merkle.NewTreeHasherForStrategy(strategy, alg, prefixes)
+	if err != nil {
+		return nil, fmt.Errorf("tree %d has invalid hashing config: %v", treeID, err)
+	}
+
+	treeDepth, strataDepths := strata(th.Size())
+	treeStrata, err := readTreeStrata(client, treeID)
+	if err != nil {
+		return nil, err
+	}
+	if len(treeStrata) > 0 {
+		strataDepths = treeStrata
+	}
+	if err := cache.ValidateStrata(treeDepth, strataDepths); err != nil {
+		return nil, fmt.Errorf("tree %d has invalid strata: %v", treeID, err)
+	}
+
+	return &spannerTreeStorage{
+		client:          client,
+		treeID:          treeID,
+		hashSizeBytes:   th.Size(),
+		hashAlgorithm:   alg,
+		hashStrategy:    strategy,
+		hashPrefixes:    prefixes,
+		populateSubtree: populate(th),
+		treeDepth:       treeDepth,
+		strataDepths:    strataDepths,
+	}, nil
+}
+
+// readTreeHashing returns the hash algorithm, hash strategy and domain
+// separation prefixes stored in the tree's record. Trees without a record use
+// SHA-256 with the default strategy and prefixes.
+func readTreeHashing(client *spanner.Client, treeID int64) (trillian.HashAlgorithm, trillian.HashStrategy, storage.TreeHashPrefixes, error) {
+	var hasherType, strategyName string
+	var prefixes storage.TreeHashPrefixes
+	found, err := queryRow(context.Background(), client.Single(), selectTreeHashingSQL, map[string]interface{}{"tree": treeID},
+		&hasherType, &strategyName, &prefixes.Leaf, &prefixes.Node)
+	switch {
+	case err != nil:
+		glog.Warningf("Failed to read hashing config for tree %d: %s", treeID, err)
+		return 0, 0, storage.TreeHashPrefixes{}, err
+	case !found:
+		return trillian.HashAlgorithm_SHA256, trillian.HashStrategy_RFC6962, prefixes, nil
+	}
+	alg, ok := trillian.HashAlgorithm_value[hasherType]
+	if !ok {
+		return 0, 0, storage.TreeHashPrefixes{}, fmt.Errorf("tree %d has unknown hasher type %q", treeID, hasherType)
+	}
+	strategy, ok := trillian.HashStrategy_value[strategyName]
+	if !ok {
+		return 0, 0, storage.TreeHashPrefixes{}, fmt.Errorf("tree %d has unknown hash strategy %q", treeID, strategyName)
+	}
+	return trillian.HashAlgorithm(alg), trillian.HashStrategy(strategy), prefixes, nil
+}
+
+// readTreeStrata returns the strata depths stored in the tree's record. Trees
+// without a record, or strata, use the default strata.
+func readTreeStrata(client *spanner.Client, treeID int64) ([]int, error) {
+	var strata spanner.NullString
+	if _, err := queryRow(context.Background(), client.Single(), selectTreeStrataSQL, map[string]interface{}{"tree": treeID}, &strata); err != nil {
+		glog.Warningf("Failed to read strata for tree %d: %s", treeID, err)
+		return nil, err
+	}
+	depths, err := cache.ParseStrata(strata.StringVal)
+	if err != nil {
+		return nil, fmt.Errorf("tree %d has invalid strata: %v", treeID, err)
+	}
+	return depths, nil
+}
+
+// HashAlgorithm returns the hash algorithm configured for the tree.
+func (m *spannerTreeStorage) HashAlgorithm() trillian.HashAlgorithm {
+	return m.hashAlgorithm
+}
+
+// HashStrategy returns the hash strategy configured for the tree.
+func (m *spannerTreeStorage) HashStrategy() trillian.HashStrategy {
+	return m.hashStrategy
+}
+
+// HashPrefixes returns the domain separation prefixes configured for the tree.
+func (m *spannerTreeStorage) HashPrefixes() storage.TreeHashPrefixes {
+	return m.hashPrefixes
+}
+
+// beginTreeTx starts a transaction reading from a strong snapshot of the
+// database, with the write revision following the latest root's.
+func (m *spannerTreeStorage) beginTreeTx() (treeTX, error) {
+	ctx := context.Background()
+	snapshot := m.client.ReadOnlyTransaction()
+	head, err := m.readHeadRevision(ctx, snapshot)
+	if err != nil {
+		glog.Warningf("Could not start tree TX: %s", err)
+		snapshot.Close()
+		return treeTX{}, err
+	}
+	// As in the MySQL storage, trees without a root are written at revision 1
+	writeRevision := head + 1
+	if head < 0 {
+		writeRevision = 1
+	}
+	return treeTX{
+		ctx:           ctx,
+		snapshot:      snapshot,
+		ts:            m,
+		subtreeCache:  cache.NewSubtreeCacheForDepth(m.treeDepth, m.strataDepths, m.populateSubtree),
+		headRevision:  head,
+		writeRevision: writeRevision,
+		readLimit:     math.MaxInt64,
+		subtrees:      make(revisionedRows),
+	}, nil
+}
+
+type treeTX struct {
+	closed        bool
+	ctx           context.Context
+	snapshot      *spanner.ReadOnlyTransaction
+	ts            *spannerTreeStorage
+	subtreeCache  cache.SubtreeCache
+	mutations     []*spanner.Mutation
+	headRevision  int64
+	writeRevision int64
+	// writesRevision is set once the transaction has written data belonging to
+	// writeRevision, which must then still follow the head when it commits
+	writesRevision bool
+	// readLimit is the last revision whose stored leaves and subtrees are still
+	// read, as the transaction has deleted those of later revisions
+	readLimit int64
+	// subtrees are the subtrees restored by the transaction, the others it
+	// writes are held by the subtree cache
+	subtrees revisionedRows
+}
+
+func (t *treeTX) query(sql string, params map[string]interface{}, f func(*spanner.Row) error) error {
+	return t.snapshot.Query(t.ctx, spanner.Statement{SQL: sql, Params: params}).Do(f)
+}
+
+func (t *treeTX) queryRow(sql string, params map[string]interface{}, ptrs ...interface{}) (bool, error) {
+	return queryRow(t.ctx, t.snapshot, sql, params, ptrs...)
+}
+
+// buffer adds mutations to be applied when the transaction commits.
+func (t *treeTX) buffer(ms ...*spanner.Mutation) {
+	t.mutations = append(t.mutations, ms...)
+}
+
+func (t *treeTX) getSubtree(treeRevision int64, nodeID storage.NodeID) (*storage.SubtreeProto, error) {
+	s, err := t.getSubtrees(treeRevision, []storage.NodeID{nodeID})
+	if err != nil {
+		return nil, err
+	}
+	switch len(s) {
+	case 0:
+		return nil, nil
+	case 1:
+		return s[0], nil
+	default:
+		return nil, fmt.Errorf("got %d subtrees, but expected 1", len(s))
+	}
+}
+
+// GetStoredSubtree implements storage.SubtreeInspector. The subtree's internal
+// nodes aren't populated.
+func (t *treeTX) GetStoredSubtree(treeRevision int64, id storage.NodeID) (*storage.SubtreeProto, error) {
+	return t.getSubtree(treeRevision, id)
+}
+
+func (t *treeTX) getSubtrees(treeRevision int64, nodeIDs []storage.NodeID) ([]*storage.SubtreeProto, error) {
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([][]byte, 0, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		if nodeID.PrefixLenBits%8 != 0 {
+			return nil, fmt.Errorf("invalid subtree ID - not multiple of 8: %d", nodeID.PrefixLenBits)
+		}
+		ids = append(ids, nodeID.Path[:nodeID.PrefixLenBits/8])
+	}
+
+	readRevision := treeRevision
+	if readRevision > t.readLimit {
+		readRevision = t.readLimit
+	}
+	params := map[string]interface{}{"tree": t.ts.treeID, "ids": ids, "revision": readRevision}
+	var stored []revisionedRow
+	err := t.query(selectSubtreeSQL, params, func(row *spanner.Row) error {
+		var r revisionedRow
+		if err := row.Columns(&r.id, &r.revision, &r.data); err != nil {
+			return err
+		}
+		stored = append(stored, r)
+		return nil
+	})
+	if err != nil {
+		glog.Warningf("Failed to get merkle subtrees: %s", err)
+		return nil, err
+	}
+
+	rows := mergeLatest(stored, t.subtrees.subset(ids), treeRevision)
+	ret := make([]*storage.SubtreeProto, 0, len(rows))
+	for _, r := range rows {
+		var subtree storage.SubtreeProto
+		if err := proto.Unmarshal(r.data, &subtree); err != nil {
+			glog.Warningf("Failed to unmarshal SubtreeProto: %s", err)
+			return nil, err
+		}
+		if subtree.Prefix == nil {
+			subtree.Prefix = []byte{}
+		}
+		ret = append(ret, &subtree)
+	}
+
+	// The InternalNodes cache is nil here, but the SubtreeCache (which called
+	// this method) will re-populate it.
+	return ret, nil
+}
+
+func (t *treeTX) storeSubtrees(subtrees []*storage.SubtreeProto) error {
+	if len(subtrees) == 0 {
+		glog.Warning("attempted to store 0 subtrees...")
+		return nil
+	}
+
+	for _, s := range subtrees {
+		if s.Prefix == nil {
+			panic(fmt.Errorf("nil prefix on %v", s))
+		}
+		// Ensure we're not storing the internal nodes, since we'll just recalculate
+		// them when we read this subtree back.
+		s.InternalNodes = nil
+		subtreeBytes, err := proto.Marshal(s)
+		if err != nil {
+			return err
+		}
+		t.buffer(spanner.Insert("Subtree", subtreeColumns, []interface{}{t.ts.treeID, s.Prefix, t.writeRevision, subtreeBytes}))
+	}
+	t.writesRevision = true
+	return nil
+}
+
+// GetTreeRevisionAtSize returns the max node version for a tree at a particular size.
+// It is an error to request tree sizes larger than the currently published tree size.
+// This only works for sizes where there is a stored tree head.
+func (t *treeTX) GetTreeRevisionAtSize(treeSize int64) (int64, error) {
+	// Negative size is not sensible and a zero sized tree has no nodes so no revisions
+	if treeSize <= 0 {
+		return 0, fmt.Errorf("Invalid tree size: %d", treeSize)
+	}
+
+	var treeRevision int64
+	found, err := t.queryRow(selectTreeRevisionAtSizeSQL, map[string]interface{}{"tree": t.ts.treeID, "size": treeSize}, &treeRevision)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("no tree head for size %d", treeSize)
+	}
+	return treeRevision, nil
+}
+
+func (t *treeTX) GetMerkleNodes(treeRevision int64, nodeIDs []storage.NodeID) ([]storage.Node, error) {
+	// Snapshot reads can run concurrently, so the preload's fetches aren't serialized
+	err := t.subtreeCache.Preload(nodeIDs, func(ids []storage.NodeID) ([]*storage.SubtreeProto, error) {
+		return t.getSubtrees(treeRevision, ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]storage.Node, 0, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		h, err := t.subtreeCache.GetNodeHash(
+			nodeID,
+			func(n storage.NodeID) (*storage.SubtreeProto, error) {
+				return t.getSubtree(treeRevision, n)
+			})
+		if err != nil {
+			return nil, err
+		}
+		if h != nil {
+			ret = append(ret, storage.Node{
+				NodeID: nodeID,
+				Hash:   h,
+			})
+		}
+	}
+
+	return ret, nil
+}
+
+func (t *treeTX) SetMerkleNodes(nodes []storage.Node) error {
+	for _, n := range nodes {
+		err := t.subtreeCache.SetNodeHash(n.NodeID, n.Hash,
+			func(nID storage.NodeID) (*storage.SubtreeProto, error) {
+				return t.getSubtree(t.writeRevision, nID)
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply writes the transaction's mutations in a read-write transaction. Spanner
+// runs it again if the transaction is aborted, e.g. by a conflicting one, so it
+// repeats the check that the tree's head hasn't moved each time.
+func (t *treeTX) apply(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+	if t.writesRevision {
+		head, err := t.ts.readHeadRevision(ctx, txn)
+		if err != nil {
+			return err
+		}
+		if head != t.headRevision {
+			return fmt.Errorf("tree %d head moved to revision %d while writing revision %d", t.ts.treeID, head, t.writeRevision)
+		}
+	}
+	return txn.BufferWrite(t.mutations)
+}
+
+func (t *treeTX) Commit() error {
+	t.closed = true
+	defer t.snapshot.Close()
+
+	if err := t.subtreeCache.Flush(t.storeSubtrees); err != nil {
+		glog.Warningf("TX commit flush error: %s", err)
+		return err
+	}
+	if len(t.mutations) == 0 {
+		return nil
+	}
+
+	_, err := t.ts.client.ReadWriteTransaction(t.ctx, t.apply)
+	if err != nil {
+		glog.Warningf("TX commit error: %s", err)
+	}
+	return err
+}
+
+func (t *treeTX) Rollback() error {
+	t.closed = true
+	t.mutations = nil
+	t.snapshot.Close()
+	return nil
+}
+
+func (t *treeTX) IsOpen() bool {
+	return !t.closed
+}
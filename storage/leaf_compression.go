@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/golang/snappy"
+)
+
+// LeafCompression is how a tree's leaf data is compressed when it's stored.
+// Each stored value records the compression it was written with, so changing a
+// tree's compression only affects new rows and old ones can still be read.
+type LeafCompression int
+
+const (
+	// NoCompression stores leaf data as it is.
+	NoCompression LeafCompression = iota
+	// SnappyCompression compresses leaf data with snappy.
+	SnappyCompression
+)
+
+// String returns the name of c as accepted by ParseLeafCompression.
+func (c LeafCompression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case SnappyCompression:
+		return "snappy"
+	}
+	return fmt.Sprintf("LeafCompression(%d)", int(c))
+}
+
+// ParseLeafCompression returns the compression called name.
+func ParseLeafCompression(name string) (LeafCompression, error) {
+	switch name {
+	case "", "none":
+		return NoCompression, nil
+	case "snappy":
+		return SnappyCompression, nil
+	}
+	return NoCompression, fmt.Errorf("unknown leaf compression %q", name)
+}
+
+// CompressLeafData returns data compressed with c.
+func CompressLeafData(c LeafCompression, data []byte) ([]byte, error) {
+	switch c {
+	case NoCompression:
+		return data, nil
+	case SnappyCompression:
+		return snappy.Encode(nil, data), nil
+	}
+	return nil, fmt.Errorf("unknown leaf compression %d", int(c))
+}
+
+// DecompressLeafData returns the original data that was compressed with c.
+func DecompressLeafData(c LeafCompression, data []byte) ([]byte, error) {
+	switch c {
+	case NoCompression:
+		return data, nil
+	case SnappyCompression:
+		decoded, err := snappy.Decode(nil, data)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt snappy leaf data: %v", err)
+		}
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("unknown leaf compression %d", int(c))
+}
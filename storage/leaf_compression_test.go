@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLeafDataRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"key": "value"}`), 100)
+	for _, c := range []LeafCompression{NoCompression, SnappyCompression} {
+		compressed, err := CompressLeafData(c, data)
+		if err != nil {
+			t.Fatalf("CompressLeafData(%v) = %v", c, err)
+		}
+		if c != NoCompression && len(compressed) >= len(data) {
+			t.Errorf("CompressLeafData(%v) gave %d bytes from %d", c, len(compressed), len(data))
+		}
+		got, err := DecompressLeafData(c, compressed)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("DecompressLeafData(%v) = %x, %v, want %x", c, got, err, data)
+		}
+	}
+}
+
+func TestLeafDataUnknownCompression(t *testing.T) {
+	if _, err := CompressLeafData(LeafCompression(99), []byte("data")); err == nil {
+		t.Error("CompressLeafData() with unknown compression succeeded")
+	}
+	if _, err := DecompressLeafData(LeafCompression(99), []byte("data")); err == nil {
+		t.Error("DecompressLeafData() with unknown compression succeeded")
+	}
+	if _, err := DecompressLeafData(SnappyCompression, []byte{0xff, 0xff, 0xff}); err == nil {
+		t.Error("DecompressLeafData() of corrupt data succeeded")
+	}
+}
+
+func TestParseLeafCompression(t *testing.T) {
+	for _, c := range []LeafCompression{NoCompression, SnappyCompression} {
+		if got, err := ParseLeafCompression(c.String()); err != nil || got != c {
+			t.Errorf("ParseLeafCompression(%q) = %v, %v, want %v", c.String(), got, err, c)
+		}
+	}
+	if _, err := ParseLeafCompression("zip"); err == nil {
+		t.Error("ParseLeafCompression(zip) succeeded")
+	}
+}
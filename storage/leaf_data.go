@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// LeafDataStore holds large leaf data outside of a tree's database. Data is
+// stored under the hex SHA-256 hash of its contents, so it's written once and
+// never modified, and the same data can be shared by any number of leaves and
+// trees.
+type LeafDataStore interface {
+	// Put stores data under name.
+	Put(name string, data []byte) error
+	// Get returns the data stored under name.
+	Get(name string) ([]byte, error)
+}
+
+// externalLeafData is set in the format of leaf data that's held in a
+// LeafDataStore, in which case the stored value is the hash it's held under.
+const externalLeafData = 0x80
+
+// leafFormatMarker starts values written by EncodeProto with a format byte.
+// A marshalled proto never starts with a zero byte, as it isn't a valid field
+// key, so values written as plain protos can't be mistaken for ones with a
+// format byte.
+const leafFormatMarker = 0
+
+// LeafDataCodec converts leaf data to and from the values stored in a tree's
+// database. Each value has a format recording how it was written, so values
+// written with any settings can be read whatever the settings are now.
+type LeafDataCodec struct {
+	// Compression is how new leaf data is compressed.
+	Compression LeafCompression
+	// Store, if set, holds leaf data that's more than ExternalBytes long once
+	// compressed, and the database only holds its hash. Data is written to the
+	// store before the row referring to it, outside of any transaction, so data
+	// may be left in the store that nothing refers to. It's never removed as
+	// other leaves may share it.
+	Store         LeafDataStore
+	ExternalBytes int
+}
+
+// Encode returns the value to store for data, and its format.
+func (c LeafDataCodec) Encode(data []byte) ([]byte, int, error) {
+	value, err := CompressLeafData(c.Compression, data)
+	if err != nil {
+		return nil, 0, err
+	}
+	format := int(c.Compression)
+	if c.Store == nil || c.ExternalBytes <= 0 || len(value) <= c.ExternalBytes {
+		return value, format, nil
+	}
+
+	hash := sha256.Sum256(value)
+	if err := c.Store.Put(hex.EncodeToString(hash[:]), value); err != nil {
+		return nil, 0, fmt.Errorf("failed to store leaf data: %v", err)
+	}
+	return hash[:], format | externalLeafData, nil
+}
+
+// Decode returns the data of a value written by Encode with the given format,
+// fetching it from the LeafDataStore if it's held there.
+func (c LeafDataCodec) Decode(value []byte, format int) ([]byte, error) {
+	if format&externalLeafData != 0 {
+		if c.Store == nil {
+			return nil, errors.New("leaf data is held in a LeafDataStore, but none is configured")
+		}
+		name := hex.EncodeToString(value)
+		data, err := c.Store.Get(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch leaf data %s: %v", name, err)
+		}
+		if hash := sha256.Sum256(data); !bytes.Equal(hash[:], value) {
+			return nil, fmt.Errorf("leaf data %s has hash %x", name, hash)
+		}
+		value = data
+	}
+	return DecompressLeafData(LeafCompression(format&^externalLeafData), value)
+}
+
+// EncodeProto returns the value to store for a marshalled proto. If it's not
+// stored as it is the value starts with a zero byte, then its format. Empty
+// data is stored as it is.
+func (c LeafDataCodec) EncodeProto(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	value, format, err := c.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	if format == int(NoCompression) {
+		return value, nil
+	}
+	return append([]byte{leafFormatMarker, byte(format)}, value...), nil
+}
+
+// DecodeProto returns the marshalled proto in a value written by EncodeProto.
+func (c LeafDataCodec) DecodeProto(value []byte) ([]byte, error) {
+	if len(value) == 0 || value[0] != leafFormatMarker {
+		return value, nil
+	}
+	if len(value) < 2 {
+		return nil, errors.New("leaf data has no format byte")
+	}
+	return c.Decode(value[2:], int(value[1]))
+}
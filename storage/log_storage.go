@@ -1,6 +1,9 @@
 package storage
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/google/trillian"
 )
 
@@ -22,6 +25,7 @@ type LogTX interface {
 	LeafReader
 	LeafQueuer
 	LeafDequeuer
+	SequencedLeafAdder
 	LogMetadata
 }
 
@@ -32,6 +36,15 @@ type ReadOnlyLogStorage interface {
 	// and values read through it should only be propagated if Commit returns
 	// without error.
 	Snapshot() (ReadOnlyLogTX, error)
+
+	// HashPrefixes returns the domain separation prefixes configured for the log.
+	HashPrefixes() TreeHashPrefixes
+
+	// HashAlgorithm returns the hash algorithm configured for the log.
+	HashAlgorithm() trillian.HashAlgorithm
+
+	// HashStrategy returns the hash strategy configured for the log.
+	HashStrategy() trillian.HashStrategy
 }
 
 // LogStorage should be implemented by concrete storage mechanisms which want to support Logs.
@@ -43,19 +56,65 @@ type LogStorage interface {
 	// the returned object, and values read through it should only be propagated
 	// if Commit returns without error.
 	Begin() (LogTX, error)
+
+	// MaxRootDuration returns how long the log may go without a new root before the
+	// latest one is re-signed, or zero to use the signer's default interval.
+	MaxRootDuration() time.Duration
+
+	// SequenceGuard returns how long leaves must have been queued for before
+	// they're sequenced, or zero to use the sequencer's default guard window.
+	SequenceGuard() time.Duration
+
+	// DuplicatePolicy returns what the log does with leaves that are queued
+	// when they're already in it. QueueLeaves only queues duplicates for logs
+	// that allow them.
+	DuplicatePolicy() trillian.DuplicatePolicy
+
+	// TreeType returns LOG, or PREORDERED_LOG if the log's leaves are added at
+	// their indices by AddSequencedLeaves rather than being queued.
+	TreeType() trillian.TreeType
+
+	// TreeState returns whether the log is ACTIVE, FROZEN, DRAINING or
+	// ARCHIVED. Only active logs accept new leaves, and only active and
+	// draining logs are sequenced. Begin fails for frozen and archived logs.
+	TreeState() trillian.TreeState
 }
 
 // LeafQueuer provides a write-only interface for the queueing (but not necesarily integration) of leaves.
 type LeafQueuer interface {
-	// QueueLeaves enqueues leaves for later integration into the tree.
-	QueueLeaves(leaves []trillian.LogLeaf) error
+	// QueueLeaves enqueues leaves for later integration into the tree. Unless the
+	// log's DuplicatePolicy allows duplicates, a leaf whose hash is already
+	// sequenced or queued, or is earlier in leaves, isn't queued again. The result holds an
+	// entry for each leaf: the existing leaf if it's a duplicate, with a
+	// SequenceNumber of -1 if it's not been sequenced yet, or else nil.
+	QueueLeaves(leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error)
+}
+
+// SequencedLeafAdder provides a write-only interface for adding leaves that
+// have been sequenced outside the log, for pre-ordered logs.
+type SequencedLeafAdder interface {
+	// AddSequencedLeaves stores leaves at the indices given by their sequence
+	// numbers, ready to be integrated into the tree in order of index. Until
+	// they're integrated they aren't returned by any LeafReader method. A leaf
+	// isn't stored if its index already holds one, integrated or not. The
+	// result holds an entry for each leaf: the leaf already at its index, which
+	// may differ from it, or else nil.
+	AddSequencedLeaves(leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error)
 }
 
 // LeafDequeuer provides an interface for reading previously queued leaves for integration into the tree.
 type LeafDequeuer interface {
 	// DequeueLeaves will return between [0, limit] leaves from the queue.
 	// Leaves which have been dequeued within a Rolled-back Tx will become available for dequeing again.
-	DequeueLeaves(limit int) ([]trillian.LogLeaf, error)
+	// Leaves queued less than guardWindow ago are not returned, which gives
+	// personalities time to de-duplicate them before they're integrated.
+	// The leaves have their QueueTimestampNanos set.
+	DequeueLeaves(limit int, guardWindow time.Duration) ([]trillian.LogLeaf, error)
+	// DequeueSequencedLeaves returns up to limit of the leaves added to a
+	// pre-ordered log by AddSequencedLeaves, at contiguous indices from start,
+	// and removes them from those waiting to be integrated. Like dequeued
+	// leaves they're integrated with UpdateSequencedLeaves.
+	DequeueSequencedLeaves(start int64, limit int) ([]trillian.LogLeaf, error)
 	UpdateSequencedLeaves([]trillian.LogLeaf) error
 }
 
@@ -66,23 +125,45 @@ type LeafReader interface {
 	GetSequencedLeafCount() (int64, error)
 	// GetLeavesByIndex returns leaf metadata and data for a set of specified sequenced leaf indexes.
 	GetLeavesByIndex(leaves []int64) ([]trillian.LogLeaf, error)
+	// GetLeavesByRange returns up to count sequenced leaves in order of their index,
+	// starting at start. Fewer are returned if the log ends before the range does,
+	// so the next range can be read from the index after the last leaf returned.
+	GetLeavesByRange(start, count int64) ([]trillian.LogLeaf, error)
 	// GetLeavesByHash looks up sequenced leaf metadata and data by their hash. If the tree permits
 	// duplicate leaves callers must be prepared to handle multiple results with the same hash
 	// but different sequence numbers. If orderBySequence is true then the returned data
 	// will be in sequence number order.
 	GetLeavesByHash(leafHashes []trillian.Hash, orderBySequence bool) ([]trillian.LogLeaf, error)
+	// GetLeafIndexRangeByTime returns the range of indices [begin, end) of the leaves integrated
+	// at or after startNanos and before endNanos. If there are none then begin and end are both
+	// the index of the next leaf integrated after the window.
+	GetLeafIndexRangeByTime(startNanos, endNanos int64) (begin, end int64, err error)
+	// OldestQueuedLeafTimestampNanos returns when the leaf that has been queued
+	// the longest was queued, or zero if no leaves are queued.
+	OldestQueuedLeafTimestampNanos() (int64, error)
 }
 
 // LogRootReader provides an interface for reading SignedLogRoots.
 type LogRootReader interface {
 	// LatestSignedLogRoot returns the most recent SignedLogRoot, if any.
 	LatestSignedLogRoot() (trillian.SignedLogRoot, error)
+	// GetLogRootCosignatures returns the witness signatures stored for the root
+	// at treeRevision, in order of witness ID.
+	GetLogRootCosignatures(treeRevision int64) ([]trillian.Cosignature, error)
 }
 
 // LogRootWriter provides an interface for storing new SignedLogRoots.
 type LogRootWriter interface {
 	// StoreSignedLogRoot stores a freshly created SignedLogRoot.
 	StoreSignedLogRoot(root trillian.SignedLogRoot) error
+	// RefreshSignedLogRoot replaces the latest SignedLogRoot with root, which
+	// re-signs it with a new timestamp and has the same revision, tree size and
+	// root hash. The cosignatures of the replaced root are discarded, as they
+	// don't cover the new timestamp.
+	RefreshSignedLogRoot(root trillian.SignedLogRoot) error
+	// StoreLogRootCosignature stores a witness's signature of the root at
+	// treeRevision, replacing any signature of it already stored for the witness.
+	StoreLogRootCosignature(treeRevision int64, cosig trillian.Cosignature) error
 }
 
 // LogMetadata provides access to information about the logs in storage
@@ -93,3 +174,58 @@ type LogMetadata interface {
 	// pending queued leaves that need to be integrated into the log.
 	GetActiveLogIDsWithPendingWork() ([]trillian.LogID, error)
 }
+
+// ParseDuplicatePolicy returns the duplicate policy named name, as held in the
+// DuplicatePolicy column of the Trees table, where an empty name is the
+// default. Logs with AllowsDuplicateLeaves set allow duplicates whatever their
+// policy, as they did before there were policies.
+func ParseDuplicatePolicy(name string, allowsDuplicates bool) (trillian.DuplicatePolicy, error) {
+	if allowsDuplicates {
+		return trillian.DuplicatePolicy_ALLOW_DUPLICATES, nil
+	}
+	if len(name) == 0 {
+		return trillian.DuplicatePolicy_MERGE_DUPLICATES, nil
+	}
+	policy, ok := trillian.DuplicatePolicy_value[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown duplicate policy %q", name)
+	}
+	return trillian.DuplicatePolicy(policy), nil
+}
+
+// ParseTreeState returns the tree state named name, as held in the TreeState
+// column of the TreeControl table. Trees without a state, which were created
+// before there were states, are FROZEN if their requests are read only, or
+// else ACTIVE.
+func ParseTreeState(name string, readOnly bool) (trillian.TreeState, error) {
+	if len(name) == 0 {
+		if readOnly {
+			return trillian.TreeState_FROZEN, nil
+		}
+		return trillian.TreeState_ACTIVE, nil
+	}
+	state, ok := trillian.TreeState_value[name]
+	if !ok || trillian.TreeState(state) == trillian.TreeState_UNKNOWN_TREE_STATE {
+		return 0, fmt.Errorf("unknown tree state %q", name)
+	}
+	return trillian.TreeState(state), nil
+}
+
+// ReadOnlyTreeState returns whether the requests of trees in state are read
+// only, so that nothing can write to them.
+func ReadOnlyTreeState(state trillian.TreeState) bool {
+	return state == trillian.TreeState_FROZEN || state == trillian.TreeState_ARCHIVED
+}
+
+// LeafIndexRange returns the range [begin, end) of the indices of the leaves
+// integrated in a window of time, given the first and last of them, if found.
+// When nothing was integrated in the window countBefore is used instead, as
+// leaves are integrated in order so the next one's index is the number
+// integrated before the window.
+func LeafIndexRange(first, last int64, found bool, countBefore func() (int64, error)) (int64, int64, error) {
+	if found {
+		return first, last + 1, nil
+	}
+	count, err := countBefore()
+	return count, count, err
+}
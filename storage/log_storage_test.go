@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLeafIndexRange(t *testing.T) {
+	countBefore := func() (int64, error) { return 7, nil }
+	for _, test := range []struct {
+		desc               string
+		first, last        int64
+		found              bool
+		wantBegin, wantEnd int64
+	}{
+		{desc: "integrated in window", first: 3, last: 5, found: true, wantBegin: 3, wantEnd: 6},
+		{desc: "none in window", found: false, wantBegin: 7, wantEnd: 7},
+	} {
+		begin, end, err := LeafIndexRange(test.first, test.last, test.found, countBefore)
+		if err != nil || begin != test.wantBegin || end != test.wantEnd {
+			t.Errorf("%s: LeafIndexRange() = [%d, %d), %v, want [%d, %d)", test.desc, begin, end, err, test.wantBegin, test.wantEnd)
+		}
+	}
+
+	failed := errors.New("failed")
+	if _, _, err := LeafIndexRange(0, 0, false, func() (int64, error) { return 0, failed }); err != failed {
+		t.Errorf("LeafIndexRange() = %v, want %v", err, failed)
+	}
+}
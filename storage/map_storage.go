@@ -8,7 +8,10 @@ import (
 type ReadOnlyMapTX interface {
 	ReadOnlyTreeTX
 	MapRootReader
+	MapRevisionTagReader
 	Getter
+	ChangedLeafReader
+	MapLeafLister
 }
 
 // MapTX is the transactional interface for reading/modifying a Map.
@@ -19,7 +22,15 @@ type MapTX interface {
 	TreeTX
 	MapRootReader
 	MapRootWriter
+	MapStager
+	MapHeadReverter
+	MapRevisionTagReader
+	MapRevisionTagWriter
+	MapRetention
+	MapArchiver
 	Getter
+	ChangedLeafReader
+	MapLeafLister
 	Setter
 }
 
@@ -33,6 +44,17 @@ type ReadOnlyMapStorage interface {
 
 	// Returns the MapID this storage relates to.
 	MapID() trillian.MapID
+
+	// HashPrefixes returns the domain separation prefixes configured for the map.
+	HashPrefixes() TreeHashPrefixes
+
+	// HashAlgorithm returns the hash algorithm configured for the map. Key
+	// hashes are as long as its digests, so it also sets the depth of the tree.
+	HashAlgorithm() trillian.HashAlgorithm
+
+	// HashStrategy returns the hash strategy configured for the map, which
+	// says how its leaves and nodes are hashed with its hash algorithm.
+	HashStrategy() trillian.HashStrategy
 }
 
 // MapStorage should be implemented by concrete storage mechanisms which want to support Maps
@@ -49,6 +71,10 @@ type MapStorage interface {
 type Setter interface {
 	// Set sets key to leaf
 	Set(keyHash trillian.Hash, value trillian.MapLeaf) error
+	// SetLeaves sets each leaf's KeyHash to the leaf. It's equivalent to calling
+	// Set for each of them, but writes them in as few round trips as the storage
+	// allows.
+	SetLeaves(leaves []trillian.MapLeaf) error
 }
 
 // Getter allows access to the values stored in the map.
@@ -62,14 +88,179 @@ type Getter interface {
 	Get(revision int64, keyHash []trillian.Hash) ([]trillian.MapLeaf, error)
 }
 
+// ChangedLeafReader lists the leaves written at a revision, so that the
+// changes between consecutive revisions can be proven.
+type ChangedLeafReader interface {
+	// GetChangedLeaves returns the leaves that were set at revision, ordered by
+	// key hash. Leaves that were set to an empty value are included.
+	GetChangedLeaves(revision int64) ([]trillian.MapLeaf, error)
+}
+
+// MapLeafLister lists every leaf of a map at a revision, so that its contents
+// can be exported and its root calculated independently.
+type MapLeafLister interface {
+	// ListLeaves returns up to count leaves holding the value of each key at
+	// revision, which is the latest set at or before it, ordered by key hash.
+	// Only keys whose hashes sort after afterKeyHash are listed, or all keys if
+	// it's empty, so a listing can be continued from the last key returned.
+	// Keys that were set to an empty value are included.
+	ListLeaves(revision int64, afterKeyHash trillian.Hash, count int) ([]trillian.MapLeaf, error)
+}
+
 // MapRootReader provides access to the map roots.
 type MapRootReader interface {
 	// LatestSignedMapRoot returns the most recently created SignedMapRoot.
 	LatestSignedMapRoot() (trillian.SignedMapRoot, error)
+	// GetSignedMapRoot returns the SignedMapRoot published for revision. It
+	// returns ErrMapRootNotFound if there isn't one, or a RevisionOutOfRangeError
+	// if the revision has been pruned.
+	GetSignedMapRoot(revision int64) (trillian.SignedMapRoot, error)
 }
 
 // MapRootWriter allows the storage of new SignedMapRoots
 type MapRootWriter interface {
 	// StoreSignedMapRoot stores root.
 	StoreSignedMapRoot(root trillian.SignedMapRoot) error
+	// RefreshSignedMapRoot replaces the latest SignedMapRoot with root, which
+	// re-signs it with a new timestamp and has the same revision and root hash.
+	RefreshSignedMapRoot(root trillian.SignedMapRoot) error
+}
+
+// MapStager allows a map revision to be created in two phases. The leaves and
+// nodes for the revision are written and its root is staged, then later the
+// root is either published, making the revision readable, or abandoned. At most
+// one revision of a map can be staged at a time.
+type MapStager interface {
+	// StagedSignedMapRoot returns the root of the currently staged revision.
+	// ok will be false if no revision is staged.
+	StagedSignedMapRoot() (root trillian.SignedMapRoot, ok bool, err error)
+	// StageSignedMapRoot records root as staged. The root must be for the
+	// revision being written by this transaction.
+	StageSignedMapRoot(root trillian.SignedMapRoot) error
+	// PublishStagedMapRoot stores root, which must match the staged revision and
+	// root hash, as the latest SignedMapRoot and clears the staged revision.
+	PublishStagedMapRoot(root trillian.SignedMapRoot) error
+	// AbandonStagedMapRoot discards the staged revision, along with the leaves
+	// and nodes that were written for it.
+	AbandonStagedMapRoot() error
+}
+
+// MapHeadRevert records the serving head of a map being reverted to an earlier revision.
+type MapHeadRevert struct {
+	// TimestampNanos is when the revert was made.
+	TimestampNanos int64
+	// FromRevision was the latest published revision before the revert.
+	FromRevision int64
+	// ToRevision is the revision that the map was reverted to.
+	ToRevision int64
+	// Reason is the explanation given for the revert.
+	Reason string
+	// AbandonedTags holds the revision of each tag which was removed because it
+	// was on an abandoned revision, so that clients no longer finding a tag can
+	// see why. It's nil if there were none.
+	AbandonedTags map[string]int64
+}
+
+// MapHeadReverter allows the serving head of a map to be rolled back, for example
+// to recover from a mapper publishing bad data.
+type MapHeadReverter interface {
+	// RevertMapHead makes revision the latest published revision of the map.
+	// The roots, leaves and nodes of later revisions are kept but marked as
+	// abandoned so they are no longer served, and the revert is recorded. Any
+	// tags attached to the abandoned revisions are removed, and recorded in the
+	// revert's AbandonedTags. The abandoned
+	// revisions are never written again, the next revision written follows
+	// the latest revision before the revert. A map with a staged revision
+	// cannot be reverted.
+	RevertMapHead(revision int64, reason string, timestampNanos int64) (MapHeadRevert, error)
+	// SkipMapRevisions makes the next revision written follow revision,
+	// without publishing anything, and records this as a revert to the latest
+	// revision. It keeps stores which hold parts of the same map in step when
+	// only some of them have reverted revisions. Revisions already written
+	// can't be skipped to.
+	SkipMapRevisions(revision int64, reason string, timestampNanos int64) error
+	// MapHeadReverts returns all the reverts made to the map, oldest first.
+	MapHeadReverts() ([]MapHeadRevert, error)
+}
+
+// MapRevisionTagReader resolves human readable tags to map revisions.
+type MapRevisionTagReader interface {
+	// GetRevisionForTag returns the map revision which tag was attached to.
+	// ErrTagNotFound is returned if there is no such tag.
+	GetRevisionForTag(tag string) (int64, error)
+	// GetRevisionTags returns all the tags for the map, keyed by tag.
+	GetRevisionTags() (map[string]int64, error)
+}
+
+// MapRevisionTagWriter allows human readable tags to be attached to map revisions.
+type MapRevisionTagWriter interface {
+	// TagMapRevision attaches tag to revision, which must have been published.
+	// Tags provide a stable reference so they cannot be moved once set.
+	TagMapRevision(tag string, revision int64, timestampNanos int64) error
+}
+
+// MapRetention provides access to the retention policy for a map and allows old
+// revisions to be pruned. Reads at pruned revisions fail with a
+// RevisionOutOfRangeError.
+type MapRetention interface {
+	// GetRetentionPolicy returns the retention policy for the map. The zero
+	// policy, which retains everything, is returned if none has been set.
+	GetRetentionPolicy() (RetentionPolicy, error)
+	// SetRetentionPolicy sets the retention policy for the map.
+	SetRetentionPolicy(policy RetentionPolicy) error
+	// OldestRetainedRevision returns the earliest revision of the map that can be read.
+	OldestRetainedRevision() (int64, error)
+	// EarliestRevisionSince returns the earliest published revision with a root
+	// timestamp at or after timestampNanos, or the latest revision if there is none.
+	EarliestRevisionSince(timestampNanos int64) (int64, error)
+	// PruneRevisionsBefore makes revisions earlier than revision unreadable and
+	// removes their roots. It cannot prune the latest published revision.
+	PruneRevisionsBefore(revision int64) error
+	// DeleteMapLeavesBelowRevision deletes the leaves and subtrees written before
+	// revision which were superseded by a write at or before it, as they aren't
+	// needed to read revision or any later one. The revision must not be after
+	// the oldest retained revision, and the map mustn't have restored revisions.
+	// It returns the number of leaves deleted.
+	DeleteMapLeavesBelowRevision(revision int64) (int64, error)
+}
+
+// MapRevisionSnapshotter is implemented by map storage whose snapshots may be
+// read from a replica that lags behind the map.
+type MapRevisionSnapshotter interface {
+	// SnapshotAtLeast is Snapshot, but only reads a replica once it has
+	// reached revision.
+	SnapshotAtLeast(revision int64) (ReadOnlyMapTX, error)
+}
+
+// MapStrataReader is implemented by map storage that can say which strata the
+// map's subtrees are stored in.
+type MapStrataReader interface {
+	// StrataDepths returns the depths of the map's strata, from the root.
+	StrataDepths() []int
+}
+
+// MapArchiver allows the data for pruned map revisions to be moved out of hot
+// storage, and to be restored so that those revisions can be read again.
+// Only data which is not needed to read any retained revision is archived.
+type MapArchiver interface {
+	// GetArchivableRevision returns the leaves and subtrees written at revision
+	// which are not needed to read any retained revision. The revision must be
+	// before the oldest retained revision.
+	GetArchivableRevision(revision int64) (*ArchiveSegment, error)
+	// ArchiveRevision removes the data returned by GetArchivableRevision from
+	// hot storage and records that it is held in the named segment. It may be
+	// called again to remove the data after the revision has been restored.
+	ArchiveRevision(revision int64, segment string) error
+	// GetArchivedRevisions returns the segment name for each archived revision.
+	GetArchivedRevisions() (map[int64]string, error)
+	// RestoreArchivedRevision puts the data in segment back into hot storage.
+	RestoreArchivedRevision(segment *ArchiveSegment) error
+	// SetRevisionRestored allows reads at revision, and any earlier revision,
+	// despite them having been pruned. The data for all archived revisions up to
+	// revision must have been restored. expiresNanos is when it can be archived again.
+	SetRevisionRestored(revision int64, expiresNanos int64) error
+	// GetRestoredRevisions returns the expiry time of each restored revision.
+	GetRestoredRevisions() (map[int64]int64, error)
+	// ClearRevisionRestored stops reads at a restored revision being allowed.
+	ClearRevisionRestored(revision int64) error
 }
@@ -0,0 +1,385 @@
+// Package memory implements LogStorage and MapStorage in memory, so that tests,
+// examples and demos can run without a database. Nothing is persisted.
+//
+// Transactions have snapshot isolation. Each reads the database as it was
+// committed when the transaction began, along with its own writes, which are
+// applied when it commits. A transaction can't commit if a row it writes was
+// changed by another one that committed after it began, in which case Commit
+// returns a ConflictError.
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+)
+
+// ConflictError is returned when committing a transaction whose writes clash
+// with ones committed since it started, or that would duplicate a unique key.
+// It stands for the errors that reject the same writes in the MySQL storage.
+type ConflictError struct {
+	What string
+}
+
+func (e ConflictError) Error() string {
+	return fmt.Sprintf("memory: conflicting write: %s", e.What)
+}
+
+// TreeOptions holds the settings of a tree that the MySQL storage keeps in the
+// Trees and TreeControl tables.
+type TreeOptions struct {
+	// TreeType is PREORDERED_LOG for pre-ordered logs, other logs are LOG
+	TreeType              trillian.TreeType
+	HashAlgorithm         trillian.HashAlgorithm
+	HashStrategy          trillian.HashStrategy
+	HashPrefixes          storage.TreeHashPrefixes
+	AllowsDuplicateLeaves bool
+	// DuplicatePolicy is ALLOW_DUPLICATES if AllowsDuplicateLeaves is set
+	DuplicatePolicy  trillian.DuplicatePolicy
+	ReadOnlyRequests bool
+	// TreeState is FROZEN if it's not set and ReadOnlyRequests is, or else
+	// ACTIVE. Frozen and archived logs are read only.
+	TreeState trillian.TreeState
+	// SequenceGuard is how long leaves must have been queued for before
+	// they're dequeued
+	SequenceGuard time.Duration
+	// MaxRootDuration is zero if the log uses the signer's default
+	MaxRootDuration time.Duration
+}
+
+// Database holds the trees stored in memory. Storage opened on the same
+// Database shares their contents, like storage opened on the same MySQL
+// database. It's safe for concurrent use.
+type Database struct {
+	// Must hold the mutex before accessing the fields below
+	mu sync.Mutex
+	// commits is the number of transactions that have written to the
+	// database, and identifies the state each one left it in
+	commits int64
+	trees   map[int64]*tree
+}
+
+// NewDatabase creates an empty Database.
+func NewDatabase() *Database {
+	return &Database{trees: make(map[int64]*tree)}
+}
+
+// SetTreeOptions sets the options for treeID. They're read when storage for
+// the tree is opened, and trees without options use the zero TreeOptions.
+func (d *Database) SetTreeOptions(treeID int64, opts TreeOptions) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.getTree(treeID).opts = opts
+}
+
+// getTree returns the tree for treeID, creating it if it doesn't exist. The
+// caller must hold d.mu.
+func (d *Database) getTree(treeID int64) *tree {
+	t, ok := d.trees[treeID]
+	if !ok {
+		t = &tree{id: treeID, tables: make(map[string]*table)}
+		d.trees[treeID] = t
+	}
+	return t
+}
+
+// openTree returns the tree for treeID and its options. If logID is set the
+// tree is recorded as a log, to be listed in the active logs.
+func (d *Database) openTree(treeID int64, logID []byte) (*tree, TreeOptions) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t := d.getTree(treeID)
+	if logID != nil {
+		t.logID = logID
+	}
+	return t, t.opts
+}
+
+type tree struct {
+	id    int64
+	opts  TreeOptions
+	logID []byte
+	// tables maps table names to their rows
+	tables map[string]*table
+}
+
+// table returns the named table, creating it if it doesn't exist. The caller
+// must hold the Database's mutex.
+func (t *tree) table(name string) *table {
+	tb, ok := t.tables[name]
+	if !ok {
+		tb = &table{rows: make(map[rowKey][]*version), revisions: make(map[string][]int64)}
+		t.tables[name] = tb
+	}
+	return tb
+}
+
+// rowKey is a row's primary key. Rows with the same group are revisions of the
+// same thing, such as a map leaf, and tables whose rows aren't revisioned only
+// use the group.
+type rowKey struct {
+	group    string
+	revision int64
+}
+
+// version is a value that a row held, which is visible to transactions that
+// began after the commit that created it, and before the one that deleted it.
+type version struct {
+	created, deleted int64
+	value            interface{}
+}
+
+// visibleAt returns whether the version is visible to a transaction that
+// began when commits transactions had been committed.
+func (v *version) visibleAt(commits int64) bool {
+	return v.created <= commits && (v.deleted == 0 || v.deleted > commits)
+}
+
+type table struct {
+	rows map[rowKey][]*version
+	// revisions lists the revisions that each group has had rows at, ascending
+	revisions map[string][]int64
+}
+
+// get returns the value of key visible at commits.
+func (tb *table) get(key rowKey, commits int64) (interface{}, bool) {
+	vs := tb.rows[key]
+	for i := len(vs) - 1; i >= 0; i-- {
+		if vs[i].visibleAt(commits) {
+			return vs[i].value, true
+		}
+	}
+	return nil, false
+}
+
+// write records that key was set to value, or deleted if value is nil, by
+// commit.
+func (tb *table) write(key rowKey, value interface{}, commit int64) {
+	vs := tb.rows[key]
+	if len(vs) > 0 && vs[len(vs)-1].deleted == 0 {
+		vs[len(vs)-1].deleted = commit
+	}
+	if value == nil {
+		return
+	}
+	if len(vs) == 0 {
+		revs := tb.revisions[key.group]
+		i := sort.Search(len(revs), func(i int) bool { return revs[i] >= key.revision })
+		revs = append(revs, 0)
+		copy(revs[i+1:], revs[i:])
+		revs[i] = key.revision
+		tb.revisions[key.group] = revs
+	}
+	tb.rows[key] = append(vs, &version{created: commit, value: value})
+}
+
+// changedSince returns whether key has been written by a commit after commits.
+func (tb *table) changedSince(key rowKey, commits int64) bool {
+	vs := tb.rows[key]
+	if len(vs) == 0 {
+		return false
+	}
+	last := vs[len(vs)-1]
+	return last.created > commits || last.deleted > commits
+}
+
+// pendingWrite is a write that a transaction will make when it commits. A nil
+// value deletes the row.
+type pendingWrite struct {
+	value interface{}
+	// insert is set if the row mustn't exist when the write is made
+	insert bool
+}
+
+// dbTX is a transaction on a tree's tables. Its methods must only be called
+// while it's open.
+type dbTX struct {
+	db *Database
+	t  *tree
+	// snapshot is the number of commits made when the transaction began
+	snapshot int64
+	// writes holds the pending writes to each table
+	writes map[string]map[rowKey]*pendingWrite
+}
+
+func (d *Database) begin(t *tree) dbTX {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return dbTX{db: d, t: t, snapshot: d.commits, writes: make(map[string]map[rowKey]*pendingWrite)}
+}
+
+// get returns the value of key in the named table.
+func (tx *dbTX) get(name string, key rowKey) (interface{}, bool) {
+	if w, ok := tx.writes[name][key]; ok {
+		return w.value, w.value != nil
+	}
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	return tx.t.table(name).get(key, tx.snapshot)
+}
+
+// latest returns the revision and value of the latest row in group at or
+// before maxRevision.
+func (tx *dbTX) latest(name, group string, maxRevision int64) (int64, interface{}, bool) {
+	best := rowKey{revision: -1}
+	var bestValue interface{}
+	for key, w := range tx.writes[name] {
+		if key.group == group && key.revision <= maxRevision && key.revision > best.revision && w.value != nil {
+			best, bestValue = key, w.value
+		}
+	}
+
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	tb := tx.t.table(name)
+	revs := tb.revisions[group]
+	for i := len(revs) - 1; i >= 0 && revs[i] > best.revision; i-- {
+		if revs[i] > maxRevision {
+			continue
+		}
+		key := rowKey{group, revs[i]}
+		if _, ok := tx.writes[name][key]; ok {
+			// Any pending write has been considered above
+			continue
+		}
+		if v, ok := tb.get(key, tx.snapshot); ok {
+			return key.revision, v, true
+		}
+	}
+	return best.revision, bestValue, bestValue != nil
+}
+
+// scan calls f with each row of the named table, in no particular order.
+func (tx *dbTX) scan(name string, f func(key rowKey, value interface{}) error) error {
+	var rows []rowKey
+	var values []interface{}
+	tx.db.mu.Lock()
+	for key := range tx.t.table(name).rows {
+		if _, ok := tx.writes[name][key]; ok {
+			continue
+		}
+		if v, ok := tx.t.table(name).get(key, tx.snapshot); ok {
+			rows = append(rows, key)
+			values = append(values, v)
+		}
+	}
+	tx.db.mu.Unlock()
+
+	for key, w := range tx.writes[name] {
+		if w.value != nil {
+			rows = append(rows, key)
+			values = append(values, w.value)
+		}
+	}
+	for i, key := range rows {
+		if err := f(key, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *dbTX) pending(name string) map[rowKey]*pendingWrite {
+	ws, ok := tx.writes[name]
+	if !ok {
+		ws = make(map[rowKey]*pendingWrite)
+		tx.writes[name] = ws
+	}
+	return ws
+}
+
+// insert adds a row to the named table, which mustn't already have one with key.
+func (tx *dbTX) insert(name string, key rowKey, value interface{}) error {
+	if _, ok := tx.get(name, key); ok {
+		return ConflictError{fmt.Sprintf("%s already has a row with key %q, %d", name, key.group, key.revision)}
+	}
+	ws := tx.pending(name)
+	_, replacesDelete := ws[key]
+	ws[key] = &pendingWrite{value: value, insert: !replacesDelete}
+	return nil
+}
+
+// put adds a row to the named table, or replaces the one with key.
+func (tx *dbTX) put(name string, key rowKey, value interface{}) {
+	tx.pending(name)[key] = &pendingWrite{value: value}
+}
+
+// delete removes the row with key from the named table, if there is one.
+func (tx *dbTX) delete(name string, key rowKey) {
+	if w, ok := tx.writes[name][key]; ok && w.insert {
+		delete(tx.writes[name], key)
+		return
+	}
+	tx.pending(name)[key] = &pendingWrite{}
+}
+
+// commit applies the transaction's writes, unless one of the rows it writes
+// has been changed since the transaction began.
+func (tx *dbTX) commit() error {
+	if len(tx.writes) == 0 {
+		return nil
+	}
+
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	for name, ws := range tx.writes {
+		tb := tx.t.table(name)
+		for key := range ws {
+			if tb.changedSince(key, tx.snapshot) {
+				return ConflictError{fmt.Sprintf("%s row with key %q, %d was changed by another transaction", name, key.group, key.revision)}
+			}
+		}
+	}
+
+	tx.db.commits++
+	for name, ws := range tx.writes {
+		tb := tx.t.table(name)
+		for key, w := range ws {
+			tb.write(key, w.value, tx.db.commits)
+		}
+	}
+	tx.writes = nil
+	return nil
+}
+
+// logs returns the trees that have been opened as logs, and their log IDs.
+func (d *Database) logs() ([]*tree, []trillian.LogID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var trees []*tree
+	var ids []trillian.LogID
+	for _, t := range d.trees {
+		if t.logID != nil {
+			trees = append(trees, t)
+			ids = append(ids, trillian.LogID{LogID: t.logID, TreeID: t.id})
+		}
+	}
+	return trees, ids
+}
+
+// hasRows returns whether the named table of t has rows visible to the
+// transaction.
+func (tx *dbTX) hasRows(t *tree, name string) bool {
+	if t == tx.t {
+		found := false
+		tx.scan(name, func(rowKey, interface{}) error {
+			found = true
+			return nil
+		})
+		return found
+	}
+
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	tb := t.table(name)
+	for key := range tb.rows {
+		if _, ok := tb.get(key, tx.snapshot); ok {
+			return true
+		}
+	}
+	return false
+}
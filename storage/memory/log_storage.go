@@ -0,0 +1,621 @@
+package memory
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/cache"
+)
+
+// Log table names, which are the same as the MySQL storage's.
+const (
+	leafDataTable          = "LeafData"
+	sequencedLeafDataTable = "SequencedLeafData"
+	unsequencedTable       = "Unsequenced"
+	stagedLeafDataTable    = "StagedLeafData"
+	cosignatureTable       = "TreeHeadCosignature"
+)
+
+// queuedLeaf is a row of the Unsequenced table.
+type queuedLeaf struct {
+	leafHash       []byte
+	payload        []byte
+	queueTimestamp time.Time
+}
+
+// sequencedLeaf is a row of the SequencedLeafData or StagedLeafData tables. The
+// leaf's data is in the LeafData table.
+type sequencedLeaf struct {
+	leafHash                []byte
+	integrateTimestampNanos int64
+}
+
+type memoryLogStorage struct {
+	*memoryTreeStorage
+
+	logID trillian.LogID
+}
+
+// NewLogStorage creates a LogStorage for the log id in db. The log's options
+// are read from db when it's opened.
+func NewLogStorage(db *Database, id trillian.LogID) (storage.LogStorage, error) {
+	ts, err := newTreeStorage(db, id.TreeID, id.LogID, storage.LogStrata, cache.PopulateLogSubtreeNodes)
+	if err != nil {
+		glog.Warningf("Couldn't create a new treeStorage: %s", err)
+		return nil, err
+	}
+
+	return &memoryLogStorage{
+		memoryTreeStorage: ts,
+		logID:             id,
+	}, nil
+}
+
+// MaxRootDuration returns how old the log's latest root can get before it's re-signed.
+func (m *memoryLogStorage) MaxRootDuration() time.Duration {
+	return m.opts.MaxRootDuration
+}
+
+// SequenceGuard returns how long leaves stay queued before they're sequenced.
+func (m *memoryLogStorage) SequenceGuard() time.Duration {
+	return m.opts.SequenceGuard
+}
+
+// TreeState returns whether the log is active, frozen, draining or archived.
+func (m *memoryLogStorage) TreeState() trillian.TreeState {
+	if m.opts.TreeState != trillian.TreeState_UNKNOWN_TREE_STATE {
+		return m.opts.TreeState
+	}
+	if m.opts.ReadOnlyRequests {
+		return trillian.TreeState_FROZEN
+	}
+	return trillian.TreeState_ACTIVE
+}
+
+// TreeType returns whether the log is pre-ordered.
+func (m *memoryLogStorage) TreeType() trillian.TreeType {
+	if m.opts.TreeType == trillian.TreeType_PREORDERED_LOG {
+		return trillian.TreeType_PREORDERED_LOG
+	}
+	return trillian.TreeType_LOG
+}
+
+// DuplicatePolicy returns what the log does with leaves already in it.
+func (m *memoryLogStorage) DuplicatePolicy() trillian.DuplicatePolicy {
+	if m.opts.AllowsDuplicateLeaves {
+		return trillian.DuplicatePolicy_ALLOW_DUPLICATES
+	}
+	return m.opts.DuplicatePolicy
+}
+
+func (m *memoryLogStorage) beginInternal() *logTX {
+	ret := &logTX{
+		treeTX: m.beginTreeTx(),
+		ls:     m,
+	}
+	ret.treeTX.writeRevision = ret.latestRoot().TreeRevision + 1
+	return ret
+}
+
+func (m *memoryLogStorage) Begin() (storage.LogTX, error) {
+	// Reject attempts to start a writable transaction in read only mode. Anything that
+	// doesn't write is a part of Snapshot so is still available via that API.
+	if storage.ReadOnlyTreeState(m.TreeState()) {
+		return nil, storage.ErrReadOnly
+	}
+
+	return m.beginInternal(), nil
+}
+
+func (m *memoryLogStorage) Snapshot() (storage.ReadOnlyLogTX, error) {
+	return m.beginInternal(), nil
+}
+
+type logTX struct {
+	treeTX
+	ls *memoryLogStorage
+}
+
+func (t *logTX) WriteRevision() int64 {
+	return t.treeTX.writeRevision
+}
+
+// dequeuedLeaf is a queued leaf and the key of its row in the Unsequenced table.
+type dequeuedLeaf struct {
+	key rowKey
+	queuedLeaf
+}
+
+type byQueueOrder []dequeuedLeaf
+
+// The order is the same as the MySQL storage's, newest first.
+func (l byQueueOrder) Len() int      { return len(l) }
+func (l byQueueOrder) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byQueueOrder) Less(i, j int) bool {
+	if !l[i].queueTimestamp.Equal(l[j].queueTimestamp) {
+		return l[i].queueTimestamp.After(l[j].queueTimestamp)
+	}
+	return bytes.Compare(l[i].leafHash, l[j].leafHash) < 0
+}
+
+// DequeueLeaves returns queued leaves and removes them from the queue when the
+// transaction commits. A leaf dequeued by two transactions can only be
+// sequenced by the first of them to commit.
+func (t *logTX) DequeueLeaves(limit int, guardWindow time.Duration) ([]trillian.LogLeaf, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+
+	// Leaves queued within the guard window aren't dequeued yet
+	cutoff := time.Now().Add(-guardWindow)
+	var queued byQueueOrder
+	t.scan(unsequencedTable, func(key rowKey, v interface{}) error {
+		if q := v.(queuedLeaf); !q.queueTimestamp.After(cutoff) {
+			queued = append(queued, dequeuedLeaf{key, q})
+		}
+		return nil
+	})
+	sort.Sort(queued)
+
+	leaves := make([]trillian.LogLeaf, 0, limit)
+	for _, q := range queued {
+		if len(leaves) >= limit {
+			break
+		}
+		// The convention is that if leaf processing succeeds (by committing this tx)
+		// then the unsequenced entries for them are removed
+		t.delete(unsequencedTable, q.key)
+		leaves = append(leaves, trillian.LogLeaf{
+			Leaf: trillian.Leaf{
+				LeafHash:  q.leafHash,
+				LeafValue: q.payload,
+			},
+			QueueTimestampNanos: q.queueTimestamp.UnixNano(),
+		})
+	}
+	return leaves, nil
+}
+
+func (t *logTX) QueueLeaves(leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	// Don't accept batches if any of the leaves are invalid.
+	for _, leaf := range leaves {
+		if len(leaf.LeafHash) != t.ts.hashSizeBytes {
+			return nil, fmt.Errorf("Queued leaf must have a hash of length %d", t.ts.hashSizeBytes)
+		}
+	}
+
+	// Leaves that are already sequenced are found by hash. Those that are queued
+	// have the fixed message id below, so they're found by their key.
+	sequenced := make(map[string]*trillian.LogLeaf)
+	allowDuplicates := t.ls.DuplicatePolicy() == trillian.DuplicatePolicy_ALLOW_DUPLICATES
+	if !allowDuplicates {
+		hashes := make([]trillian.Hash, 0, len(leaves))
+		for _, leaf := range leaves {
+			hashes = append(hashes, leaf.LeafHash)
+		}
+		found, err := t.GetLeavesByHash(hashes, false)
+		if err != nil {
+			return nil, err
+		}
+		for i := range found {
+			sequenced[string(found[i].LeafHash)] = &found[i]
+		}
+	}
+
+	existing := make([]*trillian.LogLeaf, len(leaves))
+	now := time.Now()
+	for i, leaf := range leaves {
+		if dup, ok := sequenced[string(leaf.LeafHash)]; ok {
+			existing[i] = dup
+			continue
+		}
+
+		leafHash := append([]byte{}, leaf.LeafHash...)
+		payload := append([]byte{}, leaf.LeafValue...)
+
+		// We use a fixed zero message id if the log disallows duplicates otherwise a random one.
+		// A queued duplicate, including one earlier in this batch, has the same key.
+		messageIDBytes := make([]byte, 8)
+
+		if allowDuplicates {
+			if _, err := rand.Read(messageIDBytes); err != nil {
+				glog.Warningf("Failed to get a random message id: %s", err)
+				return nil, err
+			}
+		}
+
+		hasher := sha256.New()
+		hasher.Write(messageIDBytes)
+		hasher.Write(t.ls.logID.LogID)
+		hasher.Write(leafHash)
+		messageID := hasher.Sum(nil)
+
+		key := rowKey{group: string(leafHash) + string(messageID)}
+		if v, ok := t.get(unsequencedTable, key); ok {
+			q := v.(queuedLeaf)
+			existing[i] = &trillian.LogLeaf{Leaf: trillian.Leaf{LeafHash: q.leafHash, LeafValue: q.payload}, SequenceNumber: -1}
+			continue
+		}
+
+		// The leaf data is shared by duplicates of the leaf, so it's only written once
+		if _, ok := t.get(leafDataTable, rowKey{group: string(leafHash)}); !ok {
+			t.put(leafDataTable, rowKey{group: string(leafHash)}, payload)
+		}
+
+		if err := t.insert(unsequencedTable, key, queuedLeaf{leafHash: leafHash, payload: payload, queueTimestamp: now}); err != nil {
+			glog.Warningf("Error inserting into Unsequenced: %s", err)
+			return nil, err
+		}
+	}
+
+	return existing, nil
+}
+
+func (t *logTX) GetSequencedLeafCount() (int64, error) {
+	if err := t.check(); err != nil {
+		return 0, err
+	}
+	var count int64
+	t.scan(sequencedLeafDataTable, func(rowKey, interface{}) error {
+		count++
+		return nil
+	})
+	return count, nil
+}
+
+// readLeaf returns the leaf sequenced, or staged, at key.
+func (t *logTX) readLeaf(key rowKey, s sequencedLeaf) (trillian.LogLeaf, error) {
+	data, ok := t.get(leafDataTable, rowKey{group: string(s.leafHash)})
+	if !ok {
+		return trillian.LogLeaf{}, fmt.Errorf("no data for leaf %x", s.leafHash)
+	}
+	return trillian.LogLeaf{
+		Leaf: trillian.Leaf{
+			LeafHash:  append([]byte{}, s.leafHash...),
+			LeafValue: append([]byte{}, data.([]byte)...),
+		},
+		SequenceNumber:          key.revision,
+		IntegrateTimestampNanos: s.integrateTimestampNanos,
+	}, nil
+}
+
+func (t *logTX) GetLeavesByIndex(leaves []int64) ([]trillian.LogLeaf, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	ret := make([]trillian.LogLeaf, 0, len(leaves))
+	for _, index := range leaves {
+		key := rowKey{revision: index}
+		v, ok := t.get(sequencedLeafDataTable, key)
+		if !ok {
+			continue
+		}
+		leaf, err := t.readLeaf(key, v.(sequencedLeaf))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, leaf)
+	}
+
+	if len(ret) != len(leaves) {
+		return nil, fmt.Errorf("expected %d leaves, but saw %d", len(leaves), len(ret))
+	}
+	return ret, nil
+}
+
+func (t *logTX) GetLeavesByRange(start, count int64) ([]trillian.LogLeaf, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	if start < 0 || count <= 0 {
+		return nil, fmt.Errorf("invalid range start=%d count=%d", start, count)
+	}
+	// Leaves are sequenced without gaps so the range ends at the first missing index
+	var ret []trillian.LogLeaf
+	for index := start; index < start+count; index++ {
+		key := rowKey{revision: index}
+		v, ok := t.get(sequencedLeafDataTable, key)
+		if !ok {
+			break
+		}
+		leaf, err := t.readLeaf(key, v.(sequencedLeaf))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, leaf)
+	}
+	return ret, nil
+}
+
+func (t *logTX) GetLeafIndexRangeByTime(startNanos, endNanos int64) (int64, int64, error) {
+	if err := t.check(); err != nil {
+		return 0, 0, err
+	}
+	first, last := int64(math.MaxInt64), int64(-1)
+	var before int64
+	t.scan(sequencedLeafDataTable, func(key rowKey, v interface{}) error {
+		ts := v.(sequencedLeaf).integrateTimestampNanos
+		switch {
+		case ts < startNanos:
+			before++
+		case ts < endNanos:
+			if key.revision < first {
+				first = key.revision
+			}
+			if key.revision > last {
+				last = key.revision
+			}
+		}
+		return nil
+	})
+
+	return storage.LeafIndexRange(first, last, last >= 0, func() (int64, error) {
+		return before, nil
+	})
+}
+
+func (t *logTX) GetLeavesByHash(leafHashes []trillian.Hash, orderBySequence bool) ([]trillian.LogLeaf, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]bool)
+	for _, hash := range leafHashes {
+		hashes[string(hash)] = true
+	}
+
+	// The tree could include duplicates so we don't know how many results will be returned
+	ret := make([]trillian.LogLeaf, 0)
+	err := t.scan(sequencedLeafDataTable, func(key rowKey, v interface{}) error {
+		s := v.(sequencedLeaf)
+		if !hashes[string(s.leafHash)] {
+			return nil
+		}
+		leaf, err := t.readLeaf(key, s)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, leaf)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if orderBySequence {
+		sort.Sort(bySequence(ret))
+	}
+	return ret, nil
+}
+
+type bySequence []trillian.LogLeaf
+
+func (l bySequence) Len() int           { return len(l) }
+func (l bySequence) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l bySequence) Less(i, j int) bool { return l[i].SequenceNumber < l[j].SequenceNumber }
+
+// latestRoot returns the root with the highest revision, or the zero root if
+// there are none.
+func (t *logTX) latestRoot() trillian.SignedLogRoot {
+	if _, v, ok := t.latest(treeHeadTable, "", math.MaxInt64); ok {
+		return v.(trillian.SignedLogRoot)
+	}
+	return trillian.SignedLogRoot{}
+}
+
+func (t *logTX) LatestSignedLogRoot() (trillian.SignedLogRoot, error) {
+	if err := t.check(); err != nil {
+		return trillian.SignedLogRoot{}, err
+	}
+	return t.latestRoot(), nil
+}
+
+func (t *logTX) GetLogRootCosignatures(treeRevision int64) ([]trillian.Cosignature, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	var ret []trillian.Cosignature
+	t.scan(cosignatureTable, func(key rowKey, v interface{}) error {
+		if key.revision == treeRevision {
+			ret = append(ret, v.(trillian.Cosignature))
+		}
+		return nil
+	})
+	sort.Sort(byWitnessID(ret))
+	return ret, nil
+}
+
+type byWitnessID []trillian.Cosignature
+
+func (c byWitnessID) Len() int           { return len(c) }
+func (c byWitnessID) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byWitnessID) Less(i, j int) bool { return c[i].WitnessId < c[j].WitnessId }
+
+func (t *logTX) StoreLogRootCosignature(treeRevision int64, cosig trillian.Cosignature) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	t.put(cosignatureTable, rowKey{group: cosig.WitnessId, revision: treeRevision}, cosig)
+	return nil
+}
+
+func (t *logTX) StoreSignedLogRoot(root trillian.SignedLogRoot) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	// There can only be one root at any tree revision
+	if err := t.insert(treeHeadTable, rowKey{revision: root.TreeRevision}, root); err != nil {
+		glog.Warningf("Failed to store signed root: %s", err)
+		return err
+	}
+	return nil
+}
+
+func (t *logTX) RefreshSignedLogRoot(root trillian.SignedLogRoot) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	_, v, ok := t.latest(treeHeadTable, "", math.MaxInt64)
+	if !ok {
+		return errors.New("log has no root to refresh")
+	}
+	if current := v.(trillian.SignedLogRoot); current.TreeRevision != root.TreeRevision || current.TreeSize != root.TreeSize || !bytes.Equal(current.RootHash, root.RootHash) {
+		return fmt.Errorf("refreshed root at revision %d does not match the latest root at revision %d", root.TreeRevision, current.TreeRevision)
+	}
+	t.put(treeHeadTable, rowKey{revision: root.TreeRevision}, root)
+
+	// The cosignatures don't cover the new timestamp
+	var witnesses []string
+	t.scan(cosignatureTable, func(key rowKey, v interface{}) error {
+		if key.revision == root.TreeRevision {
+			witnesses = append(witnesses, key.group)
+		}
+		return nil
+	})
+	for _, id := range witnesses {
+		t.delete(cosignatureTable, rowKey{group: id, revision: root.TreeRevision})
+	}
+	return nil
+}
+
+// OldestQueuedLeafTimestampNanos returns when the longest queued leaf was
+// queued, or zero if there are none.
+func (t *logTX) OldestQueuedLeafTimestampNanos() (int64, error) {
+	if err := t.check(); err != nil {
+		return 0, err
+	}
+	var oldest time.Time
+	t.scan(unsequencedTable, func(key rowKey, v interface{}) error {
+		if q := v.(queuedLeaf); oldest.IsZero() || q.queueTimestamp.Before(oldest) {
+			oldest = q.queueTimestamp
+		}
+		return nil
+	})
+	if oldest.IsZero() {
+		return 0, nil
+	}
+	return oldest.UnixNano(), nil
+}
+
+func (t *logTX) UpdateSequencedLeaves(leaves []trillian.LogLeaf) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	for _, leaf := range leaves {
+		// This should fail on insert but catch it early
+		if len(leaf.LeafHash) != t.ts.hashSizeBytes {
+			return errors.New("Sequenced leaf has incorrect hash size")
+		}
+
+		s := sequencedLeaf{leafHash: append([]byte{}, leaf.LeafHash...), integrateTimestampNanos: leaf.IntegrateTimestampNanos}
+		if err := t.insert(sequencedLeafDataTable, rowKey{revision: leaf.SequenceNumber}, s); err != nil {
+			glog.Warningf("Failed to update sequenced leaves: %s", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddSequencedLeaves stages leaves at their sequence numbers, except for those
+// whose index already holds a leaf, until they're integrated.
+func (t *logTX) AddSequencedLeaves(leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	for _, leaf := range leaves {
+		if len(leaf.LeafHash) != t.ts.hashSizeBytes {
+			return nil, errors.New("Sequenced leaf has incorrect hash size")
+		}
+		if leaf.SequenceNumber < 0 {
+			return nil, fmt.Errorf("invalid sequence number %d", leaf.SequenceNumber)
+		}
+	}
+
+	existing := make([]*trillian.LogLeaf, len(leaves))
+	for i, leaf := range leaves {
+		key := rowKey{revision: leaf.SequenceNumber}
+		v, ok := t.get(sequencedLeafDataTable, key)
+		if !ok {
+			v, ok = t.get(stagedLeafDataTable, key)
+		}
+		if ok {
+			dup, err := t.readLeaf(key, v.(sequencedLeaf))
+			if err != nil {
+				return nil, err
+			}
+			existing[i] = &dup
+			continue
+		}
+
+		leafHash := append([]byte{}, leaf.LeafHash...)
+		if _, ok := t.get(leafDataTable, rowKey{group: string(leafHash)}); !ok {
+			t.put(leafDataTable, rowKey{group: string(leafHash)}, append([]byte{}, leaf.LeafValue...))
+		}
+		if err := t.insert(stagedLeafDataTable, key, sequencedLeaf{leafHash: leafHash}); err != nil {
+			glog.Warningf("Failed to add sequenced leaf: %s", err)
+			return nil, err
+		}
+	}
+	return existing, nil
+}
+
+// DequeueSequencedLeaves returns the staged leaves at contiguous indices from
+// start, up to limit of them, and removes them from the staged leaves.
+func (t *logTX) DequeueSequencedLeaves(start int64, limit int) ([]trillian.LogLeaf, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	var ret []trillian.LogLeaf
+	for index := start; index < start+int64(limit); index++ {
+		key := rowKey{revision: index}
+		v, ok := t.get(stagedLeafDataTable, key)
+		if !ok {
+			break
+		}
+		leaf, err := t.readLeaf(key, v.(sequencedLeaf))
+		if err != nil {
+			return nil, err
+		}
+		t.delete(stagedLeafDataTable, key)
+		ret = append(ret, leaf)
+	}
+	return ret, nil
+}
+
+// GetActiveLogIDs returns a list of the IDs of all the logs that have been
+// opened in the database
+func (t *logTX) GetActiveLogIDs() ([]trillian.LogID, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	_, ids := t.db.logs()
+	return ids, nil
+}
+
+// GetActiveLogIDsWithPendingWork returns a list of the IDs of all the logs
+// that have queued or staged leaves that need to be integrated
+func (t *logTX) GetActiveLogIDsWithPendingWork() ([]trillian.LogID, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	trees, ids := t.db.logs()
+	ret := make([]trillian.LogID, 0)
+	for i, tr := range trees {
+		if t.hasRows(tr, unsequencedTable) || t.hasRows(tr, stagedLeafDataTable) {
+			ret = append(ret, ids[i])
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,812 @@
+package memory
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/cache"
+)
+
+// Map table names, which are the same as the MySQL storage's. The SQL storage
+// also keeps copies of the rows removed by reverts in Abandoned tables, for
+// operators to inspect. There's nothing to inspect them with here, so they're
+// not kept.
+const (
+	mapHeadTable          = "MapHead"
+	mapLeafTable          = "MapLeaf"
+	mapStagedHeadTable    = "MapStagedHead"
+	mapHeadRevertTable    = "MapHeadRevert"
+	mapRevisionTagTable   = "MapRevisionTag"
+	treeRetentionTable    = "TreeRetention"
+	archivedRevisionTable = "ArchivedRevision"
+	restoredRevisionTable = "RestoredRevision"
+)
+
+// Keys of the TreeRetention table's rows
+var (
+	retentionPolicyKey        = rowKey{group: "policy"}
+	oldestRetainedRevisionKey = rowKey{group: "oldest"}
+)
+
+// maxTagLength is the size of the MySQL storage's Tag column
+const maxTagLength = 255
+
+type memoryMapStorage struct {
+	*memoryTreeStorage
+
+	mapID trillian.MapID
+}
+
+func (m *memoryMapStorage) MapID() trillian.MapID {
+	return m.mapID
+}
+
+// NewMapStorage creates a MapStorage for the map id in db. Maps are stored in
+// the same strata as in the MySQL storage.
+func NewMapStorage(db *Database, id trillian.MapID) (storage.MapStorage, error) {
+	ts, err := newTreeStorage(db, id.TreeID, nil, storage.MapStrata, cache.PopulateMapSubtreeNodes)
+	if err != nil {
+		glog.Warningf("Couldn't create a new treeStorage: %s", err)
+		return nil, err
+	}
+
+	return &memoryMapStorage{
+		memoryTreeStorage: ts,
+		mapID:             id,
+	}, nil
+}
+
+func (m *memoryMapStorage) Begin() (storage.MapTX, error) {
+	ret := &mapTX{
+		treeTX: m.beginTreeTx(),
+		ms:     m,
+	}
+	ret.treeTX.writeRevision = ret.latestRoot().MapRevision + 1
+	// Revisions abandoned by a revert are never written again
+	ret.scan(mapHeadRevertTable, func(_ rowKey, v interface{}) error {
+		if from := v.(storage.MapHeadRevert).FromRevision; from >= ret.treeTX.writeRevision {
+			ret.treeTX.writeRevision = from + 1
+		}
+		return nil
+	})
+	return ret, nil
+}
+
+func (m *memoryMapStorage) Snapshot() (storage.ReadOnlyMapTX, error) {
+	return m.Begin()
+}
+
+type mapTX struct {
+	treeTX
+	ms *memoryMapStorage
+}
+
+func (m *mapTX) WriteRevision() int64 {
+	return m.treeTX.writeRevision
+}
+
+func (m *mapTX) Set(keyHash trillian.Hash, value trillian.MapLeaf) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	flatValue, err := proto.Marshal(&value)
+	if err != nil {
+		return err
+	}
+	return m.insert(mapLeafTable, rowKey{string(keyHash), m.writeRevision}, flatValue)
+}
+
+func (m *mapTX) SetLeaves(leaves []trillian.MapLeaf) error {
+	for _, leaf := range leaves {
+		if err := m.Set(leaf.KeyHash, leaf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkReadable returns a RevisionOutOfRangeError if revision has been pruned
+// and has not been restored from archive.
+func (m *mapTX) checkReadable(revision int64) error {
+	oldest := m.oldestRetainedRevision()
+	if revision < oldest {
+		// A pruned revision can still be read while it is restored from archive
+		restored := false
+		m.scan(restoredRevisionTable, func(key rowKey, _ interface{}) error {
+			if key.revision >= revision {
+				restored = true
+			}
+			return nil
+		})
+		if !restored {
+			return storage.RevisionOutOfRangeError{Revision: revision, OldestRetained: oldest}
+		}
+	}
+	return nil
+}
+
+// unmarshalMapLeaf decodes a leaf stored under keyHash.
+func unmarshalMapLeaf(keyHash string, flatData []byte) (trillian.MapLeaf, error) {
+	var mapLeaf trillian.MapLeaf
+	if err := proto.Unmarshal(flatData, &mapLeaf); err != nil {
+		return trillian.MapLeaf{}, err
+	}
+	mapLeaf.KeyHash = []byte(keyHash)
+	return mapLeaf, nil
+}
+
+func (m *mapTX) Get(revision int64, keyHashes []trillian.Hash) ([]trillian.MapLeaf, error) {
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	if revision >= 0 {
+		if err := m.checkReadable(revision); err != nil {
+			return nil, err
+		}
+	} else {
+		// A negative revision reads the latest value of each key
+		revision = math.MaxInt64
+	}
+
+	ret := make([]trillian.MapLeaf, 0, len(keyHashes))
+	for _, k := range keyHashes {
+		_, v, ok := m.latest(mapLeafTable, string(k), revision)
+		// Leaves set to an empty value have been deleted
+		if !ok || len(v.([]byte)) == 0 {
+			continue
+		}
+		mapLeaf, err := unmarshalMapLeaf(string(k), v.([]byte))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, mapLeaf)
+	}
+	return ret, nil
+}
+
+type byKeyHash []trillian.MapLeaf
+
+func (l byKeyHash) Len() int           { return len(l) }
+func (l byKeyHash) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l byKeyHash) Less(i, j int) bool { return bytes.Compare(l[i].KeyHash, l[j].KeyHash) < 0 }
+
+func (m *mapTX) GetChangedLeaves(revision int64) ([]trillian.MapLeaf, error) {
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	if err := m.checkReadable(revision); err != nil {
+		return nil, err
+	}
+
+	var ret []trillian.MapLeaf
+	err := m.scan(mapLeafTable, func(key rowKey, v interface{}) error {
+		if key.revision != revision {
+			return nil
+		}
+		mapLeaf, err := unmarshalMapLeaf(key.group, v.([]byte))
+		if err != nil {
+			return err
+		}
+		ret = append(ret, mapLeaf)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byKeyHash(ret))
+	return ret, nil
+}
+
+func (m *mapTX) ListLeaves(revision int64, afterKeyHash trillian.Hash, count int) ([]trillian.MapLeaf, error) {
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	if err := m.checkReadable(revision); err != nil {
+		return nil, err
+	}
+
+	// Find the latest row of each key at or before revision
+	latest := make(map[string]rowKey)
+	values := make(map[string][]byte)
+	err := m.scan(mapLeafTable, func(key rowKey, v interface{}) error {
+		if key.revision > revision || key.group <= string(afterKeyHash) {
+			return nil
+		}
+		if l, ok := latest[key.group]; !ok || key.revision > l.revision {
+			latest[key.group] = key
+			values[key.group] = v.([]byte)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []trillian.MapLeaf
+	for keyHash, v := range values {
+		mapLeaf, err := unmarshalMapLeaf(keyHash, v)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, mapLeaf)
+	}
+	sort.Sort(byKeyHash(ret))
+	if len(ret) > count {
+		ret = ret[:count]
+	}
+	return ret, nil
+}
+
+// latestRoot returns the root with the highest revision, or the zero root if
+// there are none.
+func (m *mapTX) latestRoot() trillian.SignedMapRoot {
+	if _, v, ok := m.latest(mapHeadTable, "", math.MaxInt64); ok {
+		return v.(trillian.SignedMapRoot)
+	}
+	return trillian.SignedMapRoot{}
+}
+
+func (m *mapTX) LatestSignedMapRoot() (trillian.SignedMapRoot, error) {
+	if err := m.check(); err != nil {
+		return trillian.SignedMapRoot{}, err
+	}
+	return m.latestRoot(), nil
+}
+
+func (m *mapTX) GetSignedMapRoot(revision int64) (trillian.SignedMapRoot, error) {
+	if err := m.check(); err != nil {
+		return trillian.SignedMapRoot{}, err
+	}
+	if v, ok := m.get(mapHeadTable, rowKey{revision: revision}); ok {
+		return v.(trillian.SignedMapRoot), nil
+	}
+	if oldest := m.oldestRetainedRevision(); revision < oldest {
+		return trillian.SignedMapRoot{}, storage.RevisionOutOfRangeError{Revision: revision, OldestRetained: oldest}
+	}
+	return trillian.SignedMapRoot{}, storage.ErrMapRootNotFound
+}
+
+func (m *mapTX) StoreSignedMapRoot(root trillian.SignedMapRoot) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	// There can only be one root at any map revision
+	if err := m.insert(mapHeadTable, rowKey{revision: root.MapRevision}, root); err != nil {
+		glog.Warningf("Failed to store signed map root: %s", err)
+		return err
+	}
+	return nil
+}
+
+func (m *mapTX) RefreshSignedMapRoot(root trillian.SignedMapRoot) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	_, v, ok := m.latest(mapHeadTable, "", math.MaxInt64)
+	if !ok {
+		return errors.New("map has no root to refresh")
+	}
+	if current := v.(trillian.SignedMapRoot); current.MapRevision != root.MapRevision || !bytes.Equal(current.RootHash, root.RootHash) {
+		return fmt.Errorf("refreshed root at revision %d does not match the latest root at revision %d", root.MapRevision, current.MapRevision)
+	}
+	m.put(mapHeadTable, rowKey{revision: root.MapRevision}, root)
+	return nil
+}
+
+func (m *mapTX) StagedSignedMapRoot() (trillian.SignedMapRoot, bool, error) {
+	if err := m.check(); err != nil {
+		return trillian.SignedMapRoot{}, false, err
+	}
+	v, ok := m.get(mapStagedHeadTable, rowKey{})
+	if !ok {
+		return trillian.SignedMapRoot{}, false, nil
+	}
+	return v.(trillian.SignedMapRoot), true, nil
+}
+
+func (m *mapTX) StageSignedMapRoot(root trillian.SignedMapRoot) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	if root.MapRevision != m.writeRevision {
+		return fmt.Errorf("can only stage root for write revision %d, but got revision %d", m.writeRevision, root.MapRevision)
+	}
+
+	// Staged roots aren't signed until they're published
+	root.Signature = nil
+	if err := m.insert(mapStagedHeadTable, rowKey{}, root); err != nil {
+		glog.Warningf("Failed to stage map root: %s", err)
+		return err
+	}
+	return nil
+}
+
+func (m *mapTX) PublishStagedMapRoot(root trillian.SignedMapRoot) error {
+	staged, ok, err := m.StagedSignedMapRoot()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return storage.ErrNoStagedRevision
+	}
+	if staged.MapRevision != root.MapRevision || !bytes.Equal(staged.RootHash, root.RootHash) {
+		return fmt.Errorf("root for revision %d does not match staged root for revision %d", root.MapRevision, staged.MapRevision)
+	}
+
+	if err := m.StoreSignedMapRoot(root); err != nil {
+		return err
+	}
+
+	m.delete(mapStagedHeadTable, rowKey{})
+	return nil
+}
+
+// deleteRowsAfter deletes the leaves and subtrees written after revision, and
+// returns how many there were.
+func (m *mapTX) deleteRowsAfter(revision int64) int64 {
+	count := int64(0)
+	for _, name := range []string{mapLeafTable, subtreeTable} {
+		var keys []rowKey
+		m.scan(name, func(key rowKey, _ interface{}) error {
+			if key.revision > revision {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+		for _, key := range keys {
+			m.delete(name, key)
+		}
+		count += int64(len(keys))
+	}
+	return count
+}
+
+func (m *mapTX) AbandonStagedMapRoot() error {
+	staged, ok, err := m.StagedSignedMapRoot()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return storage.ErrNoStagedRevision
+	}
+
+	// Only the staged revision can have been written after the latest root
+	m.deleteRowsAfter(staged.MapRevision - 1)
+	m.delete(mapStagedHeadTable, rowKey{})
+	return nil
+}
+
+// hasRoot returns whether there's a published root for revision.
+func (m *mapTX) hasRoot(revision int64) bool {
+	_, ok := m.get(mapHeadTable, rowKey{revision: revision})
+	return ok
+}
+
+func (m *mapTX) RevertMapHead(revision int64, reason string, timestampNanos int64) (storage.MapHeadRevert, error) {
+	if _, ok, err := m.StagedSignedMapRoot(); err != nil {
+		return storage.MapHeadRevert{}, err
+	} else if ok {
+		return storage.MapHeadRevert{}, errors.New("cannot revert map with a staged revision")
+	}
+
+	latest := m.latestRoot()
+	if revision < 0 || revision >= latest.MapRevision {
+		return storage.MapHeadRevert{}, fmt.Errorf("can only revert to a revision before the latest (%d), got %d", latest.MapRevision, revision)
+	}
+	if !m.hasRoot(revision) {
+		return storage.MapHeadRevert{}, fmt.Errorf("no published root for revision %d", revision)
+	}
+
+	revert := storage.MapHeadRevert{
+		TimestampNanos: timestampNanos,
+		FromRevision:   latest.MapRevision,
+		ToRevision:     revision,
+		Reason:         reason,
+	}
+
+	// Tags must not end up referring to revisions written after the revert, so
+	// they're removed and recorded with it
+	var tags []rowKey
+	m.scan(mapRevisionTagTable, func(key rowKey, v interface{}) error {
+		if v.(int64) > revision {
+			if revert.AbandonedTags == nil {
+				revert.AbandonedTags = make(map[string]int64)
+			}
+			revert.AbandonedTags[key.group] = v.(int64)
+			tags = append(tags, key)
+		}
+		return nil
+	})
+	for _, key := range tags {
+		m.delete(mapRevisionTagTable, key)
+	}
+
+	if err := m.insert(mapHeadRevertTable, rowKey{revision: timestampNanos}, revert); err != nil {
+		glog.Warningf("Failed to record map head revert: %s", err)
+		return storage.MapHeadRevert{}, err
+	}
+
+	var heads []rowKey
+	m.scan(mapHeadTable, func(key rowKey, _ interface{}) error {
+		if key.revision > revision {
+			heads = append(heads, key)
+		}
+		return nil
+	})
+	for _, key := range heads {
+		m.delete(mapHeadTable, key)
+	}
+	m.deleteRowsAfter(revision)
+
+	// Subsequent writes in this transaction follow the abandoned revisions,
+	// which aren't reused
+	m.writeRevision = latest.MapRevision + 1
+
+	return revert, nil
+}
+
+func (m *mapTX) SkipMapRevisions(revision int64, reason string, timestampNanos int64) error {
+	switch {
+	case revision+1 < m.writeRevision:
+		return fmt.Errorf("revisions up to %d are already in use, can't skip to %d", m.writeRevision-1, revision)
+	case revision+1 == m.writeRevision:
+		return nil
+	}
+	if _, ok, err := m.StagedSignedMapRoot(); err != nil {
+		return err
+	} else if ok {
+		return errors.New("cannot skip revisions of map with a staged revision")
+	}
+
+	// The skip is recorded as a revert of the skipped revisions to the latest
+	revert := storage.MapHeadRevert{
+		TimestampNanos: timestampNanos,
+		FromRevision:   revision,
+		ToRevision:     m.latestRoot().MapRevision,
+		Reason:         reason,
+	}
+	if err := m.insert(mapHeadRevertTable, rowKey{revision: timestampNanos}, revert); err != nil {
+		glog.Warningf("Failed to record skip of map revisions: %s", err)
+		return err
+	}
+	m.writeRevision = revision + 1
+	return nil
+}
+
+// RemovePartialRevisions implements storage.PartialRevisionRemover.
+func (m *mapTX) RemovePartialRevisions() (int64, error) {
+	if err := m.check(); err != nil {
+		return 0, err
+	}
+	revision := m.latestRoot().MapRevision
+	if v, ok := m.get(mapStagedHeadTable, rowKey{}); ok && v.(trillian.SignedMapRoot).MapRevision > revision {
+		revision = v.(trillian.SignedMapRoot).MapRevision
+	}
+
+	return m.deleteRowsAfter(revision), nil
+}
+
+type byRevertTime []storage.MapHeadRevert
+
+func (r byRevertTime) Len() int           { return len(r) }
+func (r byRevertTime) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byRevertTime) Less(i, j int) bool { return r[i].TimestampNanos < r[j].TimestampNanos }
+
+func (m *mapTX) MapHeadReverts() ([]storage.MapHeadRevert, error) {
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	ret := make([]storage.MapHeadRevert, 0)
+	m.scan(mapHeadRevertTable, func(_ rowKey, v interface{}) error {
+		ret = append(ret, v.(storage.MapHeadRevert))
+		return nil
+	})
+	sort.Sort(byRevertTime(ret))
+	return ret, nil
+}
+
+func (m *mapTX) GetRevisionForTag(tag string) (int64, error) {
+	if err := m.check(); err != nil {
+		return 0, err
+	}
+	v, ok := m.get(mapRevisionTagTable, rowKey{group: tag})
+	if !ok {
+		return 0, storage.ErrTagNotFound
+	}
+	return v.(int64), nil
+}
+
+func (m *mapTX) GetRevisionTags() (map[string]int64, error) {
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	ret := make(map[string]int64)
+	m.scan(mapRevisionTagTable, func(key rowKey, v interface{}) error {
+		ret[key.group] = v.(int64)
+		return nil
+	})
+	return ret, nil
+}
+
+func (m *mapTX) TagMapRevision(tag string, revision int64, timestampNanos int64) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	if len(tag) == 0 || len(tag) > maxTagLength {
+		return fmt.Errorf("map revision tag must be between 1 and %d bytes long", maxTagLength)
+	}
+	if !m.hasRoot(revision) {
+		return fmt.Errorf("no published root for revision %d", revision)
+	}
+
+	// Tags can't be moved once they've been attached to a revision
+	if err := m.insert(mapRevisionTagTable, rowKey{group: tag}, revision); err != nil {
+		glog.Warningf("Failed to tag map revision: %s", err)
+		return err
+	}
+	return nil
+}
+
+func (m *mapTX) GetRetentionPolicy() (storage.RetentionPolicy, error) {
+	if err := m.check(); err != nil {
+		return storage.RetentionPolicy{}, err
+	}
+	if v, ok := m.get(treeRetentionTable, retentionPolicyKey); ok {
+		return v.(storage.RetentionPolicy), nil
+	}
+	return storage.RetentionPolicy{}, nil
+}
+
+func (m *mapTX) SetRetentionPolicy(policy storage.RetentionPolicy) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	if policy.MaxRevisions < 0 || policy.MaxAge < 0 {
+		return fmt.Errorf("invalid retention policy: %+v", policy)
+	}
+
+	m.put(treeRetentionTable, retentionPolicyKey, policy)
+	return nil
+}
+
+func (m *mapTX) oldestRetainedRevision() int64 {
+	if v, ok := m.get(treeRetentionTable, oldestRetainedRevisionKey); ok {
+		return v.(int64)
+	}
+	return 0
+}
+
+func (m *mapTX) OldestRetainedRevision() (int64, error) {
+	if err := m.check(); err != nil {
+		return 0, err
+	}
+	return m.oldestRetainedRevision(), nil
+}
+
+func (m *mapTX) EarliestRevisionSince(timestampNanos int64) (int64, error) {
+	if err := m.check(); err != nil {
+		return 0, err
+	}
+	revision := int64(-1)
+	m.scan(mapHeadTable, func(key rowKey, v interface{}) error {
+		if v.(trillian.SignedMapRoot).TimestampNanos >= timestampNanos && (revision < 0 || key.revision < revision) {
+			revision = key.revision
+		}
+		return nil
+	})
+	if revision >= 0 {
+		return revision, nil
+	}
+
+	return m.latestRoot().MapRevision, nil
+}
+
+func (m *mapTX) PruneRevisionsBefore(revision int64) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	root := m.latestRoot()
+	if revision > root.MapRevision {
+		return fmt.Errorf("cannot prune revisions before %d, latest revision is %d", revision, root.MapRevision)
+	}
+
+	// The oldest retained revision never moves backwards
+	if revision > m.oldestRetainedRevision() {
+		m.put(treeRetentionTable, oldestRetainedRevisionKey, revision)
+	}
+
+	var heads []rowKey
+	m.scan(mapHeadTable, func(key rowKey, _ interface{}) error {
+		if key.revision < revision {
+			heads = append(heads, key)
+		}
+		return nil
+	})
+	for _, key := range heads {
+		m.delete(mapHeadTable, key)
+	}
+	return nil
+}
+
+// checkDeletable returns an error if the data superseded before revision can't
+// be deleted, see DeleteMapLeavesBelowRevision.
+func (m *mapTX) checkDeletable(revision int64) error {
+	if oldest := m.oldestRetainedRevision(); revision > oldest {
+		return fmt.Errorf("cannot delete map leaves below revision %d, oldest retained revision is %d", revision, oldest)
+	}
+	restored := false
+	m.scan(restoredRevisionTable, func(rowKey, interface{}) error {
+		restored = true
+		return nil
+	})
+	if restored {
+		return fmt.Errorf("cannot delete map leaves below revision %d while revisions are restored", revision)
+	}
+	return nil
+}
+
+// supersededRows returns the keys of the rows of the named table written
+// before revision that are superseded by a write at or before it.
+func (m *mapTX) supersededRows(name string, revision int64) []rowKey {
+	var keys []rowKey
+	m.scan(name, func(key rowKey, _ interface{}) error {
+		if key.revision >= revision {
+			return nil
+		}
+		if latest, _, ok := m.latest(name, key.group, revision); ok && latest > key.revision {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys
+}
+
+func (m *mapTX) DeleteMapLeavesBelowRevision(revision int64) (int64, error) {
+	if err := m.check(); err != nil {
+		return 0, err
+	}
+	if err := m.checkDeletable(revision); err != nil {
+		return 0, err
+	}
+
+	leaves := m.supersededRows(mapLeafTable, revision)
+	for _, key := range leaves {
+		m.delete(mapLeafTable, key)
+	}
+	for _, key := range m.supersededRows(subtreeTable, revision) {
+		m.delete(subtreeTable, key)
+	}
+	return int64(len(leaves)), nil
+}
+
+// archivableRows returns the keys and values of the rows of the named table
+// written at revision that are superseded by the oldest retained revision.
+func (m *mapTX) archivableRows(name string, revision, oldest int64) ([]rowKey, []interface{}) {
+	var keys []rowKey
+	var values []interface{}
+	m.scan(name, func(key rowKey, v interface{}) error {
+		if key.revision != revision {
+			return nil
+		}
+		if latest, _, ok := m.latest(name, key.group, oldest); ok && latest > revision {
+			keys = append(keys, key)
+			values = append(values, v)
+		}
+		return nil
+	})
+	return keys, values
+}
+
+func (m *mapTX) GetArchivableRevision(revision int64) (*storage.ArchiveSegment, error) {
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	oldest := m.oldestRetainedRevision()
+	if revision >= oldest {
+		return nil, fmt.Errorf("revision %d cannot be archived as it is retained, oldest retained revision is %d", revision, oldest)
+	}
+
+	segment := &storage.ArchiveSegment{TreeId: m.ms.mapID.TreeID, Revision: revision}
+	keys, values := m.archivableRows(mapLeafTable, revision, oldest)
+	for i, key := range keys {
+		segment.Leaves = append(segment.Leaves, &storage.ArchivedLeaf{KeyHash: []byte(key.group), LeafData: values[i].([]byte)})
+	}
+	keys, values = m.archivableRows(subtreeTable, revision, oldest)
+	for i, key := range keys {
+		subtree, err := unmarshalSubtree(values[i].([]byte))
+		if err != nil {
+			return nil, err
+		}
+		subtree.Prefix = []byte(key.group)
+		segment.Subtrees = append(segment.Subtrees, subtree)
+	}
+	return segment, nil
+}
+
+func (m *mapTX) ArchiveRevision(revision int64, segment string) error {
+	archivable, err := m.GetArchivableRevision(revision)
+	if err != nil {
+		return err
+	}
+
+	for _, leaf := range archivable.Leaves {
+		m.delete(mapLeafTable, rowKey{string(leaf.KeyHash), revision})
+	}
+	for _, subtree := range archivable.Subtrees {
+		m.delete(subtreeTable, rowKey{string(subtree.Prefix), revision})
+	}
+
+	m.put(archivedRevisionTable, rowKey{revision: revision}, segment)
+	return nil
+}
+
+func (m *mapTX) GetArchivedRevisions() (map[int64]string, error) {
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	ret := make(map[int64]string)
+	m.scan(archivedRevisionTable, func(key rowKey, v interface{}) error {
+		ret[key.revision] = v.(string)
+		return nil
+	})
+	return ret, nil
+}
+
+func (m *mapTX) RestoreArchivedRevision(segment *storage.ArchiveSegment) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	if segment.TreeId != m.ms.mapID.TreeID {
+		return fmt.Errorf("archive segment is for tree %d, not %d", segment.TreeId, m.ms.mapID.TreeID)
+	}
+
+	// Restoring rows that are already present rewrites them with the same data
+	for _, leaf := range segment.Leaves {
+		m.put(mapLeafTable, rowKey{string(leaf.KeyHash), segment.Revision}, append([]byte{}, leaf.LeafData...))
+	}
+
+	for _, subtree := range segment.Subtrees {
+		subtreeBytes, err := proto.Marshal(subtree)
+		if err != nil {
+			return err
+		}
+		m.put(subtreeTable, rowKey{string(subtree.Prefix), segment.Revision}, subtreeBytes)
+	}
+
+	return nil
+}
+
+func (m *mapTX) SetRevisionRestored(revision int64, expiresNanos int64) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	m.put(restoredRevisionTable, rowKey{revision: revision}, expiresNanos)
+	return nil
+}
+
+func (m *mapTX) GetRestoredRevisions() (map[int64]int64, error) {
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	ret := make(map[int64]int64)
+	m.scan(restoredRevisionTable, func(key rowKey, v interface{}) error {
+		ret[key.revision] = v.(int64)
+		return nil
+	})
+	return ret, nil
+}
+
+func (m *mapTX) ClearRevisionRestored(revision int64) error {
+	if err := m.check(); err != nil {
+		return err
+	}
+	m.delete(restoredRevisionTable, rowKey{revision: revision})
+	return nil
+}
@@ -0,0 +1,905 @@
+package memory
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+)
+
+var logID = trillian.LogID{LogID: []byte("log"), TreeID: 1}
+var mapID = trillian.MapID{MapID: []byte("map"), TreeID: 2}
+
+func leafHash(data string) []byte {
+	h := sha256.Sum256([]byte(data))
+	return h[:]
+}
+
+func mustLogStorage(t *testing.T, db *Database) storage.LogStorage {
+	s, err := NewLogStorage(db, logID)
+	if err != nil {
+		t.Fatalf("NewLogStorage() = %v", err)
+	}
+	return s
+}
+
+func mustBeginLog(t *testing.T, s storage.LogStorage) storage.LogTX {
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin() = %v", err)
+	}
+	return tx
+}
+
+func queueLeaves(t *testing.T, s storage.LogStorage, data ...string) {
+	tx := mustBeginLog(t, s)
+	var leaves []trillian.LogLeaf
+	for _, d := range data {
+		leaves = append(leaves, trillian.LogLeaf{Leaf: trillian.Leaf{LeafHash: leafHash(d), LeafValue: []byte(d)}})
+	}
+	if _, err := tx.QueueLeaves(leaves); err != nil {
+		t.Fatalf("QueueLeaves() = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	s := mustLogStorage(t, NewDatabase())
+
+	before, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() = %v", err)
+	}
+	defer before.Commit()
+
+	tx := mustBeginLog(t, s)
+	root := trillian.SignedLogRoot{TreeSize: 1, TreeRevision: 1, TimestampNanos: 10}
+	if err := tx.StoreSignedLogRoot(root); err != nil {
+		t.Fatalf("StoreSignedLogRoot() = %v", err)
+	}
+	// The transaction reads its own writes before they're committed
+	if got, err := tx.LatestSignedLogRoot(); err != nil || got.TreeRevision != 1 {
+		t.Errorf("LatestSignedLogRoot() in writing tx = %v, %v, want revision 1", got, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	if got, err := before.LatestSignedLogRoot(); err != nil || got.TreeRevision != 0 {
+		t.Errorf("LatestSignedLogRoot() in earlier snapshot = %v, %v, want revision 0", got, err)
+	}
+
+	after, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() = %v", err)
+	}
+	defer after.Commit()
+	if got, err := after.LatestSignedLogRoot(); err != nil || got.TreeRevision != 1 {
+		t.Errorf("LatestSignedLogRoot() in later snapshot = %v, %v, want revision 1", got, err)
+	}
+}
+
+func TestLatestSignedLogRootEarlierTimestamp(t *testing.T) {
+	s := mustLogStorage(t, NewDatabase())
+
+	// Roots may go back in time within the sequencer's max clock skew
+	for _, root := range []trillian.SignedLogRoot{
+		{TreeSize: 1, TreeRevision: 1, TimestampNanos: 20},
+		{TreeSize: 2, TreeRevision: 2, TimestampNanos: 10},
+	} {
+		tx := mustBeginLog(t, s)
+		if err := tx.StoreSignedLogRoot(root); err != nil {
+			t.Fatalf("StoreSignedLogRoot() = %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit() = %v", err)
+		}
+	}
+
+	tx := mustBeginLog(t, s)
+	defer tx.Commit()
+	if got, err := tx.LatestSignedLogRoot(); err != nil || got.TreeRevision != 2 {
+		t.Errorf("LatestSignedLogRoot() = %v, %v, want revision 2", got, err)
+	}
+	if tx.WriteRevision() != 3 {
+		t.Errorf("WriteRevision() = %d, want 3", tx.WriteRevision())
+	}
+}
+
+func TestConcurrentRootsConflict(t *testing.T) {
+	s := mustLogStorage(t, NewDatabase())
+
+	tx1 := mustBeginLog(t, s)
+	tx2 := mustBeginLog(t, s)
+	for _, tx := range []storage.LogTX{tx1, tx2} {
+		if err := tx.StoreSignedLogRoot(trillian.SignedLogRoot{TreeRevision: tx.WriteRevision()}); err != nil {
+			t.Fatalf("StoreSignedLogRoot() = %v", err)
+		}
+	}
+
+	if err := tx1.Commit(); err != nil {
+		t.Fatalf("first Commit() = %v", err)
+	}
+	if err, ok := tx2.Commit().(ConflictError); !ok {
+		t.Errorf("second Commit() = %v, want ConflictError", err)
+	}
+	if tx2.IsOpen() {
+		t.Error("IsOpen() = true after failed commit, want false")
+	}
+}
+
+func TestQueueAndDequeueLeaves(t *testing.T) {
+	s := mustLogStorage(t, NewDatabase())
+	queueLeaves(t, s, "a", "b", "c")
+
+	tx := mustBeginLog(t, s)
+	leaves, err := tx.DequeueLeaves(2, 0)
+	if err != nil {
+		t.Fatalf("DequeueLeaves() = %v", err)
+	}
+	if got, want := len(leaves), 2; got != want {
+		t.Fatalf("DequeueLeaves() returned %d leaves, want %d", got, want)
+	}
+	for i := range leaves {
+		leaves[i].SequenceNumber = int64(i)
+	}
+	if err := tx.UpdateSequencedLeaves(leaves); err != nil {
+		t.Fatalf("UpdateSequencedLeaves() = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	tx = mustBeginLog(t, s)
+	defer tx.Commit()
+	if got, err := tx.GetSequencedLeafCount(); err != nil || got != 2 {
+		t.Errorf("GetSequencedLeafCount() = %d, %v, want 2", got, err)
+	}
+	got, err := tx.GetLeavesByIndex([]int64{0, 1})
+	if err != nil {
+		t.Fatalf("GetLeavesByIndex() = %v", err)
+	}
+	for i, leaf := range got {
+		if !bytes.Equal(leaf.LeafHash, leaves[i].LeafHash) || !bytes.Equal(leaf.LeafValue, leaves[i].LeafValue) {
+			t.Errorf("GetLeavesByIndex()[%d] = %v, want %v", i, leaf, leaves[i])
+		}
+	}
+	if remaining, err := tx.DequeueLeaves(10, 0); err != nil || len(remaining) != 1 {
+		t.Errorf("DequeueLeaves() after commit = %v, %v, want one leaf", remaining, err)
+	}
+}
+
+func TestGetLeavesByRange(t *testing.T) {
+	s := mustLogStorage(t, NewDatabase())
+	queueLeaves(t, s, "a", "b", "c", "d")
+
+	tx := mustBeginLog(t, s)
+	leaves, err := tx.DequeueLeaves(4, 0)
+	if err != nil {
+		t.Fatalf("DequeueLeaves() = %v", err)
+	}
+	for i := range leaves {
+		leaves[i].SequenceNumber = int64(i)
+	}
+	if err := tx.UpdateSequencedLeaves(leaves); err != nil {
+		t.Fatalf("UpdateSequencedLeaves() = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	tx = mustBeginLog(t, s)
+	defer tx.Commit()
+	for _, test := range []struct {
+		start, count int64
+		want         int
+	}{
+		{start: 0, count: 2, want: 2},
+		{start: 1, count: 10, want: 3},
+		{start: 4, count: 1, want: 0},
+	} {
+		got, err := tx.GetLeavesByRange(test.start, test.count)
+		if err != nil || len(got) != test.want {
+			t.Errorf("GetLeavesByRange(%d, %d) = %v, %v, want %d leaves", test.start, test.count, got, err, test.want)
+			continue
+		}
+		for i, leaf := range got {
+			want := leaves[test.start+int64(i)]
+			if leaf.SequenceNumber != want.SequenceNumber || !bytes.Equal(leaf.LeafHash, want.LeafHash) {
+				t.Errorf("GetLeavesByRange(%d, %d)[%d] = %v, want %v", test.start, test.count, i, leaf, want)
+			}
+		}
+	}
+	if _, err := tx.GetLeavesByRange(-1, 1); err == nil {
+		t.Error("GetLeavesByRange(-1, 1) succeeded, want error")
+	}
+}
+
+func TestConcurrentDequeueConflicts(t *testing.T) {
+	s := mustLogStorage(t, NewDatabase())
+	queueLeaves(t, s, "a")
+
+	tx1 := mustBeginLog(t, s)
+	tx2 := mustBeginLog(t, s)
+	for _, tx := range []storage.LogTX{tx1, tx2} {
+		if leaves, err := tx.DequeueLeaves(1, 0); err != nil || len(leaves) != 1 {
+			t.Fatalf("DequeueLeaves() = %v, %v, want one leaf", leaves, err)
+		}
+	}
+	if err := tx1.Commit(); err != nil {
+		t.Fatalf("first Commit() = %v", err)
+	}
+	if err, ok := tx2.Commit().(ConflictError); !ok {
+		t.Errorf("second Commit() = %v, want ConflictError", err)
+	}
+}
+
+func TestQueueDuplicateLeaves(t *testing.T) {
+	for _, opts := range []TreeOptions{
+		{},
+		{DuplicatePolicy: trillian.DuplicatePolicy_REJECT_DUPLICATES},
+		{AllowsDuplicateLeaves: true},
+		{DuplicatePolicy: trillian.DuplicatePolicy_ALLOW_DUPLICATES},
+	} {
+		db := NewDatabase()
+		db.SetTreeOptions(logID.TreeID, opts)
+		s := mustLogStorage(t, db)
+		allowDuplicates := s.DuplicatePolicy() == trillian.DuplicatePolicy_ALLOW_DUPLICATES
+		if want := opts.AllowsDuplicateLeaves || opts.DuplicatePolicy == trillian.DuplicatePolicy_ALLOW_DUPLICATES; allowDuplicates != want {
+			t.Errorf("DuplicatePolicy() = %v with options %+v", s.DuplicatePolicy(), opts)
+		}
+
+		// Leaf a is sequenced, and b is queued
+		queueLeaves(t, s, "a")
+		tx := mustBeginLog(t, s)
+		leaves, err := tx.DequeueLeaves(1, 0)
+		if err != nil || len(leaves) != 1 {
+			t.Fatalf("DequeueLeaves() = %v, %v, want one leaf", leaves, err)
+		}
+		if err := tx.UpdateSequencedLeaves(leaves); err != nil {
+			t.Fatalf("UpdateSequencedLeaves() = %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit() = %v", err)
+		}
+		queueLeaves(t, s, "b")
+
+		tx = mustBeginLog(t, s)
+		var batch []trillian.LogLeaf
+		for _, d := range []string{"a", "b", "c", "c"} {
+			batch = append(batch, trillian.LogLeaf{Leaf: trillian.Leaf{LeafHash: leafHash(d), LeafValue: []byte(d)}})
+		}
+		existing, err := tx.QueueLeaves(batch)
+		if err != nil {
+			t.Fatalf("allowDuplicates=%v: QueueLeaves() = %v", allowDuplicates, err)
+		}
+		if got, want := len(existing), len(batch); got != want {
+			t.Fatalf("allowDuplicates=%v: QueueLeaves() returned %d results, want %d", allowDuplicates, got, want)
+		}
+		wantSequence := []int64{0, -1, 0, -1}
+		for i, leaf := range existing {
+			if got, want := leaf != nil, !allowDuplicates && i != 2; got != want {
+				t.Errorf("allowDuplicates=%v: QueueLeaves()[%d] = %v, want duplicate: %v", allowDuplicates, i, leaf, want)
+				continue
+			}
+			if leaf == nil {
+				continue
+			}
+			if !bytes.Equal(leaf.LeafValue, batch[i].LeafValue) || leaf.SequenceNumber != wantSequence[i] {
+				t.Errorf("allowDuplicates=%v: QueueLeaves()[%d] = %v, want leaf %q with sequence number %d", allowDuplicates, i, leaf, batch[i].LeafValue, wantSequence[i])
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit() = %v", err)
+		}
+
+		tx = mustBeginLog(t, s)
+		queued, err := tx.DequeueLeaves(10, 0)
+		if err != nil {
+			t.Fatalf("DequeueLeaves() = %v", err)
+		}
+		want := 2
+		if allowDuplicates {
+			want = 5
+		}
+		if got := len(queued); got != want {
+			t.Errorf("allowDuplicates=%v: %d leaves queued, want %d", allowDuplicates, got, want)
+		}
+		tx.Rollback()
+	}
+}
+
+func TestAddSequencedLeaves(t *testing.T) {
+	db := NewDatabase()
+	db.SetTreeOptions(logID.TreeID, TreeOptions{TreeType: trillian.TreeType_PREORDERED_LOG})
+	s := mustLogStorage(t, db)
+	if got, want := s.TreeType(), trillian.TreeType_PREORDERED_LOG; got != want {
+		t.Errorf("TreeType() = %v, want %v", got, want)
+	}
+
+	addLeaves := func(start int64, data ...string) []*trillian.LogLeaf {
+		tx := mustBeginLog(t, s)
+		var leaves []trillian.LogLeaf
+		for i, d := range data {
+			leaves = append(leaves, trillian.LogLeaf{SequenceNumber: start + int64(i), Leaf: trillian.Leaf{LeafHash: leafHash(d), LeafValue: []byte(d)}})
+		}
+		existing, err := tx.AddSequencedLeaves(leaves)
+		if err != nil {
+			t.Fatalf("AddSequencedLeaves(%d, %v) = %v", start, data, err)
+		}
+		if got, want := len(existing), len(leaves); got != want {
+			t.Fatalf("AddSequencedLeaves(%d, %v) returned %d results, want %d", start, data, got, want)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit() = %v", err)
+		}
+		return existing
+	}
+
+	// Leaves a and b are at 0 and 1, and d is beyond a gap at 3
+	addLeaves(0, "a", "b")
+	addLeaves(3, "d")
+	values := func(leaves []trillian.LogLeaf) string {
+		var values []string
+		for _, leaf := range leaves {
+			values = append(values, string(leaf.LeafValue))
+		}
+		return strings.Join(values, "")
+	}
+	dequeueValues := func() string {
+		tx := mustBeginLog(t, s)
+		defer tx.Rollback()
+		leaves, err := tx.DequeueSequencedLeaves(0, 10)
+		if err != nil {
+			t.Fatalf("DequeueSequencedLeaves() = %v", err)
+		}
+		return values(leaves)
+	}
+	if got, want := dequeueValues(), "ab"; got != want {
+		t.Errorf("DequeueSequencedLeaves() = %q, want %q up to the gap", got, want)
+	}
+
+	existing := addLeaves(1, "x", "c")
+	if existing[0] == nil || !bytes.Equal(existing[0].LeafValue, []byte("b")) || existing[0].SequenceNumber != 1 {
+		t.Errorf("AddSequencedLeaves()[0] = %v, want leaf b at 1", existing[0])
+	}
+	if existing[1] != nil {
+		t.Errorf("AddSequencedLeaves()[1] = %v, want nil", existing[1])
+	}
+
+	// The leaves can't be read until they're integrated
+	tx := mustBeginLog(t, s)
+	if leaves, err := tx.GetLeavesByRange(0, 10); err != nil || len(leaves) != 0 {
+		t.Errorf("GetLeavesByRange() before integration = %v, %v, want no leaves", leaves, err)
+	}
+	leaves, err := tx.DequeueSequencedLeaves(0, 10)
+	if err != nil {
+		t.Fatalf("DequeueSequencedLeaves() = %v", err)
+	}
+	if got, want := values(leaves), "abcd"; got != want {
+		t.Errorf("DequeueSequencedLeaves() = %q, want %q", got, want)
+	}
+	for i := range leaves {
+		leaves[i].IntegrateTimestampNanos = 1000
+	}
+	if err := tx.UpdateSequencedLeaves(leaves); err != nil {
+		t.Fatalf("UpdateSequencedLeaves() = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	tx = mustBeginLog(t, s)
+	leaves, err = tx.GetLeavesByRange(0, 10)
+	if err != nil {
+		t.Fatalf("GetLeavesByRange() = %v", err)
+	}
+	if got, want := values(leaves), "abcd"; got != want {
+		t.Errorf("GetLeavesByRange() = %q, want %q", got, want)
+	}
+	if leaves, err := tx.DequeueSequencedLeaves(0, 10); err != nil || len(leaves) != 0 {
+		t.Errorf("DequeueSequencedLeaves() after integration = %v, %v, want no leaves", leaves, err)
+	}
+	tx.Commit()
+
+	// An integrated leaf is found at its index too
+	existing = addLeaves(0, "y")
+	if existing[0] == nil || !bytes.Equal(existing[0].LeafValue, []byte("a")) || existing[0].IntegrateTimestampNanos != 1000 {
+		t.Errorf("AddSequencedLeaves()[0] = %v, want integrated leaf a", existing[0])
+	}
+
+	tx = mustBeginLog(t, s)
+	defer tx.Rollback()
+	if _, err := tx.AddSequencedLeaves([]trillian.LogLeaf{{SequenceNumber: -1, Leaf: trillian.Leaf{LeafHash: leafHash("e")}}}); err == nil {
+		t.Error("AddSequencedLeaves() at -1 succeeded, want error")
+	}
+}
+
+func TestSequenceGuard(t *testing.T) {
+	db := NewDatabase()
+	db.SetTreeOptions(logID.TreeID, TreeOptions{SequenceGuard: time.Hour})
+	s := mustLogStorage(t, db)
+	if got, want := s.SequenceGuard(), time.Hour; got != want {
+		t.Errorf("SequenceGuard() = %v, want %v", got, want)
+	}
+	queueLeaves(t, s, "a")
+
+	tx := mustBeginLog(t, s)
+	defer tx.Rollback()
+	if leaves, err := tx.DequeueLeaves(10, s.SequenceGuard()); err != nil || len(leaves) != 0 {
+		t.Errorf("DequeueLeaves() inside guard window = %v, %v, want no leaves", leaves, err)
+	}
+	leaves, err := tx.DequeueLeaves(10, 0)
+	if err != nil || len(leaves) != 1 {
+		t.Fatalf("DequeueLeaves() without a guard window = %v, %v, want one leaf", leaves, err)
+	}
+	if age := time.Since(time.Unix(0, leaves[0].QueueTimestampNanos)); age < 0 || age > time.Minute {
+		t.Errorf("DequeueLeaves() returned a leaf queued %v ago", age)
+	}
+}
+
+func TestOldestQueuedLeafTimestampNanos(t *testing.T) {
+	s := mustLogStorage(t, NewDatabase())
+	tx := mustBeginLog(t, s)
+	if got, err := tx.OldestQueuedLeafTimestampNanos(); err != nil || got != 0 {
+		t.Errorf("OldestQueuedLeafTimestampNanos() with an empty queue = %d, %v, want 0", got, err)
+	}
+	tx.Rollback()
+
+	queueLeaves(t, s, "a")
+	queueLeaves(t, s, "b")
+	tx = mustBeginLog(t, s)
+	defer tx.Rollback()
+	leaves, err := tx.DequeueLeaves(10, 0)
+	if err != nil || len(leaves) != 2 {
+		t.Fatalf("DequeueLeaves() = %v, %v, want two leaves", leaves, err)
+	}
+	oldest := leaves[0].QueueTimestampNanos
+	if leaves[1].QueueTimestampNanos < oldest {
+		oldest = leaves[1].QueueTimestampNanos
+	}
+
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() = %v", err)
+	}
+	defer snapshot.Commit()
+	if got, err := snapshot.OldestQueuedLeafTimestampNanos(); err != nil || got != oldest {
+		t.Errorf("OldestQueuedLeafTimestampNanos() = %d, %v, want %d", got, err, oldest)
+	}
+}
+
+func TestReadOnlyRequests(t *testing.T) {
+	db := NewDatabase()
+	db.SetTreeOptions(logID.TreeID, TreeOptions{ReadOnlyRequests: true})
+	s := mustLogStorage(t, db)
+
+	if _, err := s.Begin(); err != storage.ErrReadOnly {
+		t.Errorf("Begin() = %v, want %v", err, storage.ErrReadOnly)
+	}
+	if _, err := s.Snapshot(); err != nil {
+		t.Errorf("Snapshot() = %v", err)
+	}
+}
+
+func TestTreeStates(t *testing.T) {
+	for _, test := range []struct {
+		opts     TreeOptions
+		want     trillian.TreeState
+		readOnly bool
+	}{
+		{opts: TreeOptions{}, want: trillian.TreeState_ACTIVE},
+		{opts: TreeOptions{ReadOnlyRequests: true}, want: trillian.TreeState_FROZEN, readOnly: true},
+		{opts: TreeOptions{TreeState: trillian.TreeState_DRAINING}, want: trillian.TreeState_DRAINING},
+		{opts: TreeOptions{TreeState: trillian.TreeState_ARCHIVED}, want: trillian.TreeState_ARCHIVED, readOnly: true},
+	} {
+		db := NewDatabase()
+		db.SetTreeOptions(logID.TreeID, test.opts)
+		s := mustLogStorage(t, db)
+
+		if got := s.TreeState(); got != test.want {
+			t.Errorf("TreeState() with %+v = %v, want %v", test.opts, got, test.want)
+		}
+		tx, err := s.Begin()
+		if test.readOnly {
+			if err != storage.ErrReadOnly {
+				t.Errorf("Begin() of %v log = %v, want %v", test.want, err, storage.ErrReadOnly)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Begin() of %v log = %v", test.want, err)
+			continue
+		}
+		tx.Rollback()
+	}
+}
+
+func TestActiveLogs(t *testing.T) {
+	db := NewDatabase()
+	s := mustLogStorage(t, db)
+	if _, err := NewMapStorage(db, mapID); err != nil {
+		t.Fatalf("NewMapStorage() = %v", err)
+	}
+
+	tx := mustBeginLog(t, s)
+	if ids, err := tx.GetActiveLogIDs(); err != nil || len(ids) != 1 || ids[0].TreeID != logID.TreeID {
+		t.Errorf("GetActiveLogIDs() = %v, %v, want [%v]", ids, err, logID)
+	}
+	if ids, err := tx.GetActiveLogIDsWithPendingWork(); err != nil || len(ids) != 0 {
+		t.Errorf("GetActiveLogIDsWithPendingWork() = %v, %v, want none", ids, err)
+	}
+	tx.Commit()
+
+	queueLeaves(t, s, "a")
+	tx = mustBeginLog(t, s)
+	defer tx.Commit()
+	if ids, err := tx.GetActiveLogIDsWithPendingWork(); err != nil || len(ids) != 1 {
+		t.Errorf("GetActiveLogIDsWithPendingWork() = %v, %v, want [%v]", ids, err, logID)
+	}
+}
+
+func TestLogRootCosignatures(t *testing.T) {
+	s := mustLogStorage(t, NewDatabase())
+
+	tx := mustBeginLog(t, s)
+	for _, c := range []trillian.Cosignature{
+		{WitnessId: "w2", Signature: &trillian.DigitallySigned{Signature: []byte("w2 at 5")}},
+		{WitnessId: "w1", Signature: &trillian.DigitallySigned{Signature: []byte("old w1 at 5")}},
+		{WitnessId: "w1", Signature: &trillian.DigitallySigned{Signature: []byte("w1 at 5")}},
+	} {
+		if err := tx.StoreLogRootCosignature(5, c); err != nil {
+			t.Fatalf("StoreLogRootCosignature() = %v", err)
+		}
+	}
+	if err := tx.StoreLogRootCosignature(6, trillian.Cosignature{WitnessId: "w1", Signature: &trillian.DigitallySigned{Signature: []byte("w1 at 6")}}); err != nil {
+		t.Fatalf("StoreLogRootCosignature() = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	tx = mustBeginLog(t, s)
+	defer tx.Commit()
+	cosigs, err := tx.GetLogRootCosignatures(5)
+	if err != nil {
+		t.Fatalf("GetLogRootCosignatures() = %v", err)
+	}
+	var got []string
+	for _, c := range cosigs {
+		got = append(got, string(c.Signature.Signature))
+	}
+	if want := []string{"w1 at 5", "w2 at 5"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("GetLogRootCosignatures(5) = %v, want %v", got, want)
+	}
+}
+
+func TestRefreshSignedLogRoot(t *testing.T) {
+	s := mustLogStorage(t, NewDatabase())
+
+	tx := mustBeginLog(t, s)
+	if err := tx.RefreshSignedLogRoot(trillian.SignedLogRoot{TreeRevision: 0, TimestampNanos: 5}); err == nil {
+		t.Error("RefreshSignedLogRoot() of a log without a root succeeded")
+	}
+	root := trillian.SignedLogRoot{TreeSize: 3, TreeRevision: 1, RootHash: []byte("root"), TimestampNanos: 10}
+	if err := tx.StoreSignedLogRoot(root); err != nil {
+		t.Fatalf("StoreSignedLogRoot() = %v", err)
+	}
+	if err := tx.StoreLogRootCosignature(1, trillian.Cosignature{WitnessId: "w1", Signature: &trillian.DigitallySigned{Signature: []byte("w1 at 1")}}); err != nil {
+		t.Fatalf("StoreLogRootCosignature() = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	tx = mustBeginLog(t, s)
+	moved := root
+	moved.TreeSize, moved.TimestampNanos = 4, 20
+	if err := tx.RefreshSignedLogRoot(moved); err == nil {
+		t.Error("RefreshSignedLogRoot() of a root with a different tree size succeeded")
+	}
+	refreshed := root
+	refreshed.TimestampNanos = 20
+	if err := tx.RefreshSignedLogRoot(refreshed); err != nil {
+		t.Fatalf("RefreshSignedLogRoot() = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	tx = mustBeginLog(t, s)
+	defer tx.Commit()
+	if got, err := tx.LatestSignedLogRoot(); err != nil || got.TimestampNanos != 20 || got.TreeRevision != 1 || got.TreeSize != 3 {
+		t.Errorf("LatestSignedLogRoot() = %v, %v, want revision 1 of size 3 at 20", got, err)
+	}
+	// The cosignatures were of the old timestamp
+	if cosigs, err := tx.GetLogRootCosignatures(1); err != nil || len(cosigs) != 0 {
+		t.Errorf("GetLogRootCosignatures(1) = %v, %v, want none", cosigs, err)
+	}
+	if tx.WriteRevision() != 2 {
+		t.Errorf("WriteRevision() = %d, want 2", tx.WriteRevision())
+	}
+}
+
+func TestMerkleNodes(t *testing.T) {
+	s := mustLogStorage(t, NewDatabase())
+	nodeID, err := storage.NewNodeIDForTreeCoords(0, 0, 64)
+	if err != nil {
+		t.Fatalf("NewNodeIDForTreeCoords() = %v", err)
+	}
+	hash := leafHash("node")
+
+	tx := mustBeginLog(t, s)
+	if err := tx.SetMerkleNodes([]storage.Node{{NodeID: nodeID, Hash: hash, NodeRevision: tx.WriteRevision()}}); err != nil {
+		t.Fatalf("SetMerkleNodes() = %v", err)
+	}
+	if err := tx.StoreSignedLogRoot(trillian.SignedLogRoot{TreeSize: 1, TreeRevision: tx.WriteRevision()}); err != nil {
+		t.Fatalf("StoreSignedLogRoot() = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	tx = mustBeginLog(t, s)
+	defer tx.Commit()
+	nodes, err := tx.GetMerkleNodes(1, []storage.NodeID{nodeID})
+	if err != nil {
+		t.Fatalf("GetMerkleNodes() = %v", err)
+	}
+	if len(nodes) != 1 || !bytes.Equal(nodes[0].Hash, hash) {
+		t.Errorf("GetMerkleNodes() = %v, want hash %x", nodes, hash)
+	}
+	if rev, err := tx.GetTreeRevisionAtSize(1); err != nil || rev != 1 {
+		t.Errorf("GetTreeRevisionAtSize(1) = %d, %v, want 1", rev, err)
+	}
+}
+
+func mustBeginMap(t *testing.T, s storage.MapStorage) storage.MapTX {
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin() = %v", err)
+	}
+	return tx
+}
+
+// writeMapRevision sets key to value and publishes a root for the next revision.
+func writeMapRevision(t *testing.T, s storage.MapStorage, key []byte, value string) {
+	tx := mustBeginMap(t, s)
+	if err := tx.Set(key, trillian.MapLeaf{LeafValue: []byte(value)}); err != nil {
+		t.Fatalf("Set() = %v", err)
+	}
+	if err := tx.StoreSignedMapRoot(trillian.SignedMapRoot{MapRevision: tx.WriteRevision(), TimestampNanos: tx.WriteRevision()}); err != nil {
+		t.Fatalf("StoreSignedMapRoot() = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+}
+
+func TestMapRevisions(t *testing.T) {
+	s, err := NewMapStorage(NewDatabase(), mapID)
+	if err != nil {
+		t.Fatalf("NewMapStorage() = %v", err)
+	}
+	key := leafHash("key")
+	writeMapRevision(t, s, key, "one")
+	writeMapRevision(t, s, key, "two")
+
+	tx := mustBeginMap(t, s)
+	for _, test := range []struct {
+		revision int64
+		want     string
+	}{
+		{revision: 1, want: "one"},
+		{revision: 2, want: "two"},
+		{revision: -1, want: "two"},
+	} {
+		leaves, err := tx.Get(test.revision, []trillian.Hash{key})
+		if err != nil || len(leaves) != 1 || string(leaves[0].LeafValue) != test.want {
+			t.Errorf("Get(%d) = %v, %v, want %q", test.revision, leaves, err, test.want)
+		}
+	}
+	changed, err := tx.GetChangedLeaves(2)
+	if err != nil || len(changed) != 1 || !bytes.Equal(changed[0].KeyHash, key) {
+		t.Errorf("GetChangedLeaves(2) = %v, %v, want the key", changed, err)
+	}
+
+	if err := tx.TagMapRevision("kept", 1, 50); err != nil {
+		t.Fatalf("TagMapRevision() = %v", err)
+	}
+	if err := tx.TagMapRevision("abandoned", 2, 50); err != nil {
+		t.Fatalf("TagMapRevision() = %v", err)
+	}
+	revert, err := tx.RevertMapHead(1, "test", 100)
+	if err != nil {
+		t.Fatalf("RevertMapHead() = %v", err)
+	}
+	wantTags := map[string]int64{"abandoned": 2}
+	if !reflect.DeepEqual(revert.AbandonedTags, wantTags) {
+		t.Errorf("RevertMapHead().AbandonedTags = %v, want %v", revert.AbandonedTags, wantTags)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	tx = mustBeginMap(t, s)
+	defer tx.Commit()
+	if root, err := tx.LatestSignedMapRoot(); err != nil || root.MapRevision != 1 {
+		t.Errorf("LatestSignedMapRoot() after revert = %v, %v, want revision 1", root, err)
+	}
+	if leaves, err := tx.Get(-1, []trillian.Hash{key}); err != nil || len(leaves) != 1 || string(leaves[0].LeafValue) != "one" {
+		t.Errorf("Get(-1) after revert = %v, %v, want %q", leaves, err, "one")
+	}
+	if reverts, err := tx.MapHeadReverts(); err != nil || len(reverts) != 1 {
+		t.Errorf("MapHeadReverts() = %v, %v, want one revert", reverts, err)
+	} else if !reflect.DeepEqual(reverts[0].AbandonedTags, wantTags) {
+		t.Errorf("MapHeadReverts()[0].AbandonedTags = %v, want %v", reverts[0].AbandonedTags, wantTags)
+	}
+	if tags, err := tx.GetRevisionTags(); err != nil || !reflect.DeepEqual(tags, map[string]int64{"kept": 1}) {
+		t.Errorf("GetRevisionTags() after revert = %v, %v, want only the kept tag", tags, err)
+	}
+	// The reverted revision isn't written again
+	if got, want := tx.WriteRevision(), int64(3); got != want {
+		t.Errorf("WriteRevision() after revert = %d, want %d", got, want)
+	}
+}
+
+func TestStageAndAbandonMapRoot(t *testing.T) {
+	s, err := NewMapStorage(NewDatabase(), mapID)
+	if err != nil {
+		t.Fatalf("NewMapStorage() = %v", err)
+	}
+	key := leafHash("key")
+
+	tx := mustBeginMap(t, s)
+	if err := tx.Set(key, trillian.MapLeaf{LeafValue: []byte("staged")}); err != nil {
+		t.Fatalf("Set() = %v", err)
+	}
+	if err := tx.StageSignedMapRoot(trillian.SignedMapRoot{MapRevision: tx.WriteRevision()}); err != nil {
+		t.Fatalf("StageSignedMapRoot() = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	tx = mustBeginMap(t, s)
+	if _, ok, err := tx.StagedSignedMapRoot(); err != nil || !ok {
+		t.Errorf("StagedSignedMapRoot() = %v, %v, want a staged root", ok, err)
+	}
+	if err := tx.AbandonStagedMapRoot(); err != nil {
+		t.Fatalf("AbandonStagedMapRoot() = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	tx = mustBeginMap(t, s)
+	defer tx.Commit()
+	if leaves, err := tx.Get(-1, []trillian.Hash{key}); err != nil || len(leaves) != 0 {
+		t.Errorf("Get() after abandon = %v, %v, want no leaves", leaves, err)
+	}
+	if err := tx.AbandonStagedMapRoot(); err != storage.ErrNoStagedRevision {
+		t.Errorf("AbandonStagedMapRoot() = %v, want %v", err, storage.ErrNoStagedRevision)
+	}
+}
+
+func TestGetSignedMapRoot(t *testing.T) {
+	s, err := NewMapStorage(NewDatabase(), mapID)
+	if err != nil {
+		t.Fatalf("NewMapStorage() = %v", err)
+	}
+	key := leafHash("key")
+	writeMapRevision(t, s, key, "one")
+	writeMapRevision(t, s, key, "two")
+	writeMapRevision(t, s, key, "three")
+
+	tx := mustBeginMap(t, s)
+	if err := tx.PruneRevisionsBefore(2); err != nil {
+		t.Fatalf("PruneRevisionsBefore() = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	tx = mustBeginMap(t, s)
+	defer tx.Commit()
+	if root, err := tx.GetSignedMapRoot(2); err != nil || root.MapRevision != 2 {
+		t.Errorf("GetSignedMapRoot(2) = %v, %v, want revision 2", root, err)
+	}
+	if _, err := tx.GetSignedMapRoot(1); err != (storage.RevisionOutOfRangeError{Revision: 1, OldestRetained: 2}) {
+		t.Errorf("GetSignedMapRoot(1) = %v, want RevisionOutOfRangeError", err)
+	}
+	if _, err := tx.GetSignedMapRoot(4); err != storage.ErrMapRootNotFound {
+		t.Errorf("GetSignedMapRoot(4) = %v, want ErrMapRootNotFound", err)
+	}
+}
+
+func TestRefreshSignedMapRoot(t *testing.T) {
+	s, err := NewMapStorage(NewDatabase(), mapID)
+	if err != nil {
+		t.Fatalf("NewMapStorage() = %v", err)
+	}
+	key := leafHash("key")
+	writeMapRevision(t, s, key, "one")
+	writeMapRevision(t, s, key, "two")
+
+	tx := mustBeginMap(t, s)
+	if err := tx.RefreshSignedMapRoot(trillian.SignedMapRoot{MapRevision: 1, TimestampNanos: 10}); err == nil {
+		t.Error("RefreshSignedMapRoot() of an earlier revision succeeded")
+	}
+	if err := tx.RefreshSignedMapRoot(trillian.SignedMapRoot{MapRevision: 2, TimestampNanos: 10}); err != nil {
+		t.Fatalf("RefreshSignedMapRoot() = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	tx = mustBeginMap(t, s)
+	defer tx.Commit()
+	if root, err := tx.LatestSignedMapRoot(); err != nil || root.MapRevision != 2 || root.TimestampNanos != 10 {
+		t.Errorf("LatestSignedMapRoot() = %v, %v, want revision 2 at 10", root, err)
+	}
+	if tx.WriteRevision() != 3 {
+		t.Errorf("WriteRevision() = %d, want 3", tx.WriteRevision())
+	}
+}
+
+func TestDeleteMapLeavesBelowRevision(t *testing.T) {
+	s, err := NewMapStorage(NewDatabase(), mapID)
+	if err != nil {
+		t.Fatalf("NewMapStorage() = %v", err)
+	}
+	key, other := leafHash("key"), leafHash("other")
+	writeMapRevision(t, s, other, "kept")
+	writeMapRevision(t, s, key, "one")
+	writeMapRevision(t, s, key, "two")
+	writeMapRevision(t, s, key, "three")
+
+	tx := mustBeginMap(t, s)
+	if err := tx.PruneRevisionsBefore(4); err != nil {
+		t.Fatalf("PruneRevisionsBefore() = %v", err)
+	}
+	if _, err := tx.DeleteMapLeavesBelowRevision(5); err == nil {
+		t.Errorf("DeleteMapLeavesBelowRevision(5) succeeded above the oldest retained revision")
+	}
+	if err := tx.SetRevisionRestored(3, 100); err != nil {
+		t.Fatalf("SetRevisionRestored() = %v", err)
+	}
+	if _, err := tx.DeleteMapLeavesBelowRevision(4); err == nil {
+		t.Errorf("DeleteMapLeavesBelowRevision(4) succeeded with a restored revision")
+	}
+	if err := tx.ClearRevisionRestored(3); err != nil {
+		t.Fatalf("ClearRevisionRestored() = %v", err)
+	}
+	// The values set at revisions 3 and 4 supersede the ones set at 2 and 3
+	if deleted, err := tx.DeleteMapLeavesBelowRevision(4); err != nil || deleted != 2 {
+		t.Errorf("DeleteMapLeavesBelowRevision(4) = %d, %v, want 2", deleted, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+
+	tx = mustBeginMap(t, s)
+	defer tx.Commit()
+	leaves, err := tx.Get(4, []trillian.Hash{key, other})
+	if err != nil || len(leaves) != 2 {
+		t.Fatalf("Get(4) = %v, %v, want 2 leaves", leaves, err)
+	}
+	for _, leaf := range leaves {
+		if want := map[string]string{string(key): "three", string(other): "kept"}[string(leaf.KeyHash)]; string(leaf.LeafValue) != want {
+			t.Errorf("Get(4) returned %q for %x, want %q", leaf.LeafValue, leaf.KeyHash, want)
+		}
+	}
+	for rev := int64(2); rev <= 3; rev++ {
+		if segment, err := tx.GetArchivableRevision(rev); err != nil || len(segment.Leaves) != 0 || len(segment.Subtrees) != 0 {
+			t.Errorf("GetArchivableRevision(%d) = %v, %v, want nothing left to archive", rev, segment, err)
+		}
+	}
+}
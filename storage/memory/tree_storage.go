@@ -0,0 +1,281 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/cache"
+)
+
+// Table names, which are the same as the MySQL storage's.
+const (
+	subtreeTable  = "Subtree"
+	treeHeadTable = "TreeHead"
+)
+
+var errClosed = errors.New("memory: transaction is closed")
+
+// memoryTreeStorage is shared between the log and map storage, and contains
+// the functionality which is common to both.
+type memoryTreeStorage struct {
+	db              *Database
+	t               *tree
+	opts            TreeOptions
+	hashSizeBytes   int
+	populateSubtree storage.PopulateSubtreeFunc
+	treeDepth       int
+	strataDepths    []int
+}
+
+func newTreeStorage(db *Database, treeID int64, logID []byte, strata storage.StrataFunc, populate func(merkle.TreeHasher) storage.PopulateSubtreeFunc) (*memoryTreeStorage, error) {
+	t, opts := db.openTree(treeID, logID)
+
+	th, err := merkle.NewTreeHasherForStrategy(opts.HashStrategy, opts.HashAlgorithm, opts.HashPrefixes)
+	if err != nil {
+		return nil, fmt.Errorf("tree %d has invalid hashing config: %v", treeID, err)
+	}
+
+	treeDepth, strataDepths := strata(th.Size())
+	if err := cache.ValidateStrata(treeDepth, strataDepths); err != nil {
+		return nil, fmt.Errorf("tree %d has invalid strata: %v", treeID, err)
+	}
+
+	return &memoryTreeStorage{
+		db:              db,
+		t:               t,
+		opts:            opts,
+		hashSizeBytes:   th.Size(),
+		populateSubtree: populate(th),
+		treeDepth:       treeDepth,
+		strataDepths:    strataDepths,
+	}, nil
+}
+
+// HashAlgorithm returns the hash algorithm configured for the tree.
+func (m *memoryTreeStorage) HashAlgorithm() trillian.HashAlgorithm {
+	return m.opts.HashAlgorithm
+}
+
+// HashStrategy returns the hash strategy configured for the tree.
+func (m *memoryTreeStorage) HashStrategy() trillian.HashStrategy {
+	return m.opts.HashStrategy
+}
+
+// HashPrefixes returns the domain separation prefixes configured for the tree.
+func (m *memoryTreeStorage) HashPrefixes() storage.TreeHashPrefixes {
+	return m.opts.HashPrefixes
+}
+
+func (m *memoryTreeStorage) beginTreeTx() treeTX {
+	return treeTX{
+		dbTX:          m.db.begin(m.t),
+		ts:            m,
+		open:          true,
+		subtreeCache:  cache.NewSubtreeCacheForDepth(m.treeDepth, m.strataDepths, m.populateSubtree),
+		writeRevision: -1,
+	}
+}
+
+type treeTX struct {
+	dbTX
+	ts            *memoryTreeStorage
+	open          bool
+	subtreeCache  cache.SubtreeCache
+	writeRevision int64
+}
+
+// check returns an error if the transaction is closed.
+func (t *treeTX) check() error {
+	if !t.open {
+		return errClosed
+	}
+	return nil
+}
+
+func (t *treeTX) getSubtree(treeRevision int64, nodeID storage.NodeID) (*storage.SubtreeProto, error) {
+	s, err := t.getSubtrees(treeRevision, []storage.NodeID{nodeID})
+	if err != nil {
+		return nil, err
+	}
+	switch len(s) {
+	case 0:
+		return nil, nil
+	case 1:
+		return s[0], nil
+	default:
+		return nil, fmt.Errorf("got %d subtrees, but expected 1", len(s))
+	}
+}
+
+// GetStoredSubtree implements storage.SubtreeInspector. The subtree's internal
+// nodes aren't populated.
+func (t *treeTX) GetStoredSubtree(treeRevision int64, id storage.NodeID) (*storage.SubtreeProto, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	return t.getSubtree(treeRevision, id)
+}
+
+// unmarshalSubtree decodes a stored subtree. Subtrees are stored marshalled, as
+// they are in MySQL, so that callers can't change the stored copy.
+func unmarshalSubtree(b []byte) (*storage.SubtreeProto, error) {
+	var subtree storage.SubtreeProto
+	if err := proto.Unmarshal(b, &subtree); err != nil {
+		glog.Warningf("Failed to unmarshal SubtreeProto: %s", err)
+		return nil, err
+	}
+	if subtree.Prefix == nil {
+		subtree.Prefix = []byte{}
+	}
+	return &subtree, nil
+}
+
+func (t *treeTX) getSubtrees(treeRevision int64, nodeIDs []storage.NodeID) ([]*storage.SubtreeProto, error) {
+	ret := make([]*storage.SubtreeProto, 0, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		if nodeID.PrefixLenBits%8 != 0 {
+			return nil, fmt.Errorf("invalid subtree ID - not multiple of 8: %d", nodeID.PrefixLenBits)
+		}
+		group := string(nodeID.Path[:nodeID.PrefixLenBits/8])
+		if _, v, ok := t.latest(subtreeTable, group, treeRevision); ok {
+			subtree, err := unmarshalSubtree(v.([]byte))
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, subtree)
+		}
+	}
+
+	// The InternalNodes cache is nil here, but the SubtreeCache (which called
+	// this method) will re-populate it.
+	return ret, nil
+}
+
+func (t *treeTX) storeSubtrees(subtrees []*storage.SubtreeProto) error {
+	if len(subtrees) == 0 {
+		glog.Warning("attempted to store 0 subtrees...")
+		return nil
+	}
+
+	for _, s := range subtrees {
+		if s.Prefix == nil {
+			panic(fmt.Errorf("nil prefix on %v", s))
+		}
+		// Ensure we're not storing the internal nodes, since we'll just recalculate
+		// them when we read this subtree back.
+		s.InternalNodes = nil
+		subtreeBytes, err := proto.Marshal(s)
+		if err != nil {
+			return err
+		}
+		if err := t.insert(subtreeTable, rowKey{string(s.Prefix), t.writeRevision}, subtreeBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTreeRevisionAtSize returns the max node version for a tree at a particular size.
+// It is an error to request tree sizes larger than the currently published tree size.
+// This only works for sizes where there is a stored tree head.
+func (t *treeTX) GetTreeRevisionAtSize(treeSize int64) (int64, error) {
+	if err := t.check(); err != nil {
+		return 0, err
+	}
+	// Negative size is not sensible and a zero sized tree has no nodes so no revisions
+	if treeSize <= 0 {
+		return 0, fmt.Errorf("Invalid tree size: %d", treeSize)
+	}
+
+	treeRevision := int64(-1)
+	t.scan(treeHeadTable, func(key rowKey, v interface{}) error {
+		if v.(trillian.SignedLogRoot).TreeSize == treeSize && key.revision > treeRevision {
+			treeRevision = key.revision
+		}
+		return nil
+	})
+	if treeRevision < 0 {
+		return 0, fmt.Errorf("no tree head for size %d", treeSize)
+	}
+	return treeRevision, nil
+}
+
+func (t *treeTX) GetMerkleNodes(treeRevision int64, nodeIDs []storage.NodeID) ([]storage.Node, error) {
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+	err := t.subtreeCache.Preload(nodeIDs, func(ids []storage.NodeID) ([]*storage.SubtreeProto, error) {
+		return t.getSubtrees(treeRevision, ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]storage.Node, 0, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		h, err := t.subtreeCache.GetNodeHash(
+			nodeID,
+			func(n storage.NodeID) (*storage.SubtreeProto, error) {
+				return t.getSubtree(treeRevision, n)
+			})
+		if err != nil {
+			return nil, err
+		}
+		if h != nil {
+			ret = append(ret, storage.Node{
+				NodeID: nodeID,
+				Hash:   h,
+			})
+		}
+	}
+
+	return ret, nil
+}
+
+func (t *treeTX) SetMerkleNodes(nodes []storage.Node) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		err := t.subtreeCache.SetNodeHash(n.NodeID, n.Hash,
+			func(nID storage.NodeID) (*storage.SubtreeProto, error) {
+				return t.getSubtree(t.writeRevision, nID)
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *treeTX) Commit() error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	t.open = false
+	if t.writeRevision > -1 {
+		if err := t.subtreeCache.Flush(t.storeSubtrees); err != nil {
+			glog.Warningf("TX commit flush error: %s", err)
+			return err
+		}
+	}
+	return t.commit()
+}
+
+func (t *treeTX) Rollback() error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	t.open = false
+	t.writes = nil
+	return nil
+}
+
+func (t *treeTX) IsOpen() bool {
+	return t.open
+}
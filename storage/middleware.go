@@ -0,0 +1,180 @@
+package storage
+
+// LogStorageWrapper decorates a LogStorage with additional behaviour, for example
+// metrics, tracing, fault injection or caching. Wrappers should delegate to the
+// LogStorage they are given for anything they do not handle themselves, which is
+// most easily done by embedding it.
+type LogStorageWrapper func(LogStorage) LogStorage
+
+// MapStorageWrapper decorates a MapStorage with additional behaviour. See
+// LogStorageWrapper.
+type MapStorageWrapper func(MapStorage) MapStorage
+
+// WrapLogStorage layers the wrappers around s. The first wrapper in the list
+// will be the outermost, so it sees each call first and its result last.
+func WrapLogStorage(s LogStorage, wrappers ...LogStorageWrapper) LogStorage {
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		s = wrappers[i](s)
+	}
+	return s
+}
+
+// WrapMapStorage layers the wrappers around s. The first wrapper in the list
+// will be the outermost, so it sees each call first and its result last.
+func WrapMapStorage(s MapStorage, wrappers ...MapStorageWrapper) MapStorage {
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		s = wrappers[i](s)
+	}
+	return s
+}
+
+// LogTXWrappers holds functions used to decorate the transactions created by a
+// LogStorage. Either may be nil, in which case those transactions are returned
+// unchanged.
+type LogTXWrappers struct {
+	// TX is applied to transactions returned by Begin.
+	TX func(LogTX) LogTX
+	// Snapshot is applied to transactions returned by Snapshot.
+	Snapshot func(ReadOnlyLogTX) ReadOnlyLogTX
+}
+
+// MapTXWrappers holds functions used to decorate the transactions created by a
+// MapStorage. Either may be nil, in which case those transactions are returned
+// unchanged.
+type MapTXWrappers struct {
+	// TX is applied to transactions returned by Begin.
+	TX func(MapTX) MapTX
+	// Snapshot is applied to transactions returned by Snapshot.
+	Snapshot func(ReadOnlyMapTX) ReadOnlyMapTX
+}
+
+// WrapLogTXs returns a LogStorageWrapper which decorates every transaction the
+// underlying storage creates. This covers the common case where the concern
+// being added only cares about operations performed within transactions. The
+// optional interfaces of the underlying transactions, such as SubtreeInspector,
+// are kept by the decorated ones, calling the underlying transaction directly
+// unless the decoration implements them itself.
+func WrapLogTXs(w LogTXWrappers) LogStorageWrapper {
+	return func(s LogStorage) LogStorage {
+		return &txWrappingLogStorage{LogStorage: s, wrappers: w}
+	}
+}
+
+// WrapMapTXs returns a MapStorageWrapper which decorates every transaction the
+// underlying storage creates. As with WrapLogTXs, the optional interfaces of the
+// underlying transactions, such as PartialRevisionRemover, are kept.
+func WrapMapTXs(w MapTXWrappers) MapStorageWrapper {
+	return func(s MapStorage) MapStorage {
+		return &txWrappingMapStorage{MapStorage: s, wrappers: w}
+	}
+}
+
+type txWrappingLogStorage struct {
+	LogStorage
+	wrappers LogTXWrappers
+}
+
+func (t *txWrappingLogStorage) Begin() (LogTX, error) {
+	tx, err := t.LogStorage.Begin()
+	if err != nil || t.wrappers.TX == nil {
+		return tx, err
+	}
+	return withLogTXInterfaces(tx, t.wrappers.TX(tx)), nil
+}
+
+func (t *txWrappingLogStorage) Snapshot() (ReadOnlyLogTX, error) {
+	tx, err := t.LogStorage.Snapshot()
+	if err != nil || t.wrappers.Snapshot == nil {
+		return tx, err
+	}
+	return t.wrappers.Snapshot(tx), nil
+}
+
+type txWrappingMapStorage struct {
+	MapStorage
+	wrappers MapTXWrappers
+}
+
+func (t *txWrappingMapStorage) Begin() (MapTX, error) {
+	tx, err := t.MapStorage.Begin()
+	if err != nil || t.wrappers.TX == nil {
+		return tx, err
+	}
+	return withMapTXInterfaces(tx, t.wrappers.TX(tx)), nil
+}
+
+func (t *txWrappingMapStorage) Snapshot() (ReadOnlyMapTX, error) {
+	tx, err := t.MapStorage.Snapshot()
+	if err != nil || t.wrappers.Snapshot == nil {
+		return tx, err
+	}
+	return t.wrappers.Snapshot(tx), nil
+}
+
+// SnapshotAtLeast implements MapRevisionSnapshotter, whether or not the
+// wrapped storage does.
+func (t *txWrappingMapStorage) SnapshotAtLeast(revision int64) (ReadOnlyMapTX, error) {
+	s, ok := t.MapStorage.(MapRevisionSnapshotter)
+	if !ok {
+		return t.Snapshot()
+	}
+	tx, err := s.SnapshotAtLeast(revision)
+	if err != nil || t.wrappers.Snapshot == nil {
+		return tx, err
+	}
+	return t.wrappers.Snapshot(tx), nil
+}
+
+// withLogTXInterfaces returns wrapped, which decorates tx, adding the optional
+// interfaces tx implements that wrapped doesn't.
+func withLogTXInterfaces(tx, wrapped LogTX) LogTX {
+	inspector, ok := tx.(SubtreeInspector)
+	if _, has := wrapped.(SubtreeInspector); !ok || has {
+		return wrapped
+	}
+	return &inspectingLogTX{LogTX: wrapped, SubtreeInspector: inspector}
+}
+
+type inspectingLogTX struct {
+	LogTX
+	SubtreeInspector
+}
+
+// withMapTXInterfaces returns wrapped, which decorates tx, adding the optional
+// interfaces tx implements that wrapped doesn't.
+func withMapTXInterfaces(tx, wrapped MapTX) MapTX {
+	inspector, inspect := tx.(SubtreeInspector)
+	if _, has := wrapped.(SubtreeInspector); has {
+		inspect = false
+	}
+	remover, remove := tx.(PartialRevisionRemover)
+	if _, has := wrapped.(PartialRevisionRemover); has {
+		remove = false
+	}
+
+	switch {
+	case inspect && remove:
+		return &inspectingRemovingMapTX{MapTX: wrapped, SubtreeInspector: inspector, PartialRevisionRemover: remover}
+	case inspect:
+		return &inspectingMapTX{MapTX: wrapped, SubtreeInspector: inspector}
+	case remove:
+		return &removingMapTX{MapTX: wrapped, PartialRevisionRemover: remover}
+	}
+	return wrapped
+}
+
+type inspectingMapTX struct {
+	MapTX
+	SubtreeInspector
+}
+
+type removingMapTX struct {
+	MapTX
+	PartialRevisionRemover
+}
+
+type inspectingRemovingMapTX struct {
+	MapTX
+	SubtreeInspector
+	PartialRevisionRemover
+}
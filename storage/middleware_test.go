@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+)
+
+// recordingLogStorage notes its name each time Begin is called, then delegates.
+type recordingLogStorage struct {
+	LogStorage
+	name  string
+	calls *[]string
+}
+
+func (r *recordingLogStorage) Begin() (LogTX, error) {
+	*r.calls = append(*r.calls, r.name)
+	return r.LogStorage.Begin()
+}
+
+func recordingWrapper(name string, calls *[]string) LogStorageWrapper {
+	return func(s LogStorage) LogStorage {
+		return &recordingLogStorage{LogStorage: s, name: name, calls: calls}
+	}
+}
+
+// countingLogTX counts the number of commits made through it.
+type countingLogTX struct {
+	LogTX
+	commits *int
+}
+
+func (c *countingLogTX) Commit() error {
+	*c.commits++
+	return c.LogTX.Commit()
+}
+
+func TestWrapLogStorageOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := NewMockLogStorage(ctrl)
+	mockTx := NewMockLogTX(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+
+	var calls []string
+	s := WrapLogStorage(mockStorage, recordingWrapper("outer", &calls), recordingWrapper("inner", &calls))
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error from Begin: %v", err)
+	}
+	if tx != mockTx {
+		t.Fatalf("Expected wrapped storage to return the underlying tx")
+	}
+	if got, want := calls, []string{"outer", "inner"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Wrappers called in wrong order, got %v, want %v", got, want)
+	}
+}
+
+func TestWrapLogStorageNoWrappers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := NewMockLogStorage(ctrl)
+
+	if got := WrapLogStorage(mockStorage); got != mockStorage {
+		t.Fatalf("Expected unwrapped storage to be returned unchanged, got %v", got)
+	}
+}
+
+func TestWrapLogTXs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := NewMockLogStorage(ctrl)
+	mockTx := NewMockLogTX(ctrl)
+	mockSnapshot := NewMockReadOnlyLogTX(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockStorage.EXPECT().Snapshot().Return(mockSnapshot, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+
+	commits := 0
+	s := WrapLogStorage(mockStorage, WrapLogTXs(LogTXWrappers{
+		TX: func(tx LogTX) LogTX { return &countingLogTX{LogTX: tx, commits: &commits} },
+	}))
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error from Begin: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error from Commit: %v", err)
+	}
+	if commits != 1 {
+		t.Fatalf("Expected 1 commit via wrapped tx but got: %d", commits)
+	}
+
+	// No snapshot wrapper was supplied so the original should come back
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("Unexpected error from Snapshot: %v", err)
+	}
+	if snapshot != mockSnapshot {
+		t.Fatalf("Expected unwrapped snapshot to be returned unchanged")
+	}
+}
+
+func TestWrapLogTXsBeginError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := NewMockLogStorage(ctrl)
+	mockStorage.EXPECT().Begin().Return(nil, errors.New("begin failed"))
+
+	called := false
+	s := WrapLogStorage(mockStorage, WrapLogTXs(LogTXWrappers{
+		TX: func(tx LogTX) LogTX { called = true; return tx },
+	}))
+
+	if _, err := s.Begin(); err == nil {
+		t.Fatalf("Expected error from Begin to be propagated")
+	}
+	if called {
+		t.Fatalf("TX wrapper should not be called when Begin fails")
+	}
+}
+
+func TestWrapMapTXs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mapID := trillian.MapID{MapID: []byte("map"), TreeID: 5}
+	mockStorage := NewMockMapStorage(ctrl)
+	mockTx := NewMockMapTX(ctrl)
+	mockSnapshot := NewMockReadOnlyMapTX(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockStorage.EXPECT().Snapshot().Return(mockSnapshot, nil)
+	mockStorage.EXPECT().MapID().Return(mapID)
+
+	var wrappedTx, wrappedSnapshot bool
+	s := WrapMapStorage(mockStorage, WrapMapTXs(MapTXWrappers{
+		TX:       func(tx MapTX) MapTX { wrappedTx = true; return tx },
+		Snapshot: func(tx ReadOnlyMapTX) ReadOnlyMapTX { wrappedSnapshot = true; return tx },
+	}))
+
+	if _, err := s.Begin(); err != nil {
+		t.Fatalf("Unexpected error from Begin: %v", err)
+	}
+	if _, err := s.Snapshot(); err != nil {
+		t.Fatalf("Unexpected error from Snapshot: %v", err)
+	}
+	if !wrappedTx || !wrappedSnapshot {
+		t.Fatalf("Expected both tx wrappers to be called, got tx=%v snapshot=%v", wrappedTx, wrappedSnapshot)
+	}
+
+	// Methods not handled by the wrapper are delegated
+	if got := s.MapID(); !reflect.DeepEqual(got, mapID) {
+		t.Fatalf("Expected MapID to be delegated, got %v want %v", got, mapID)
+	}
+}
+
+// removingMockMapTX is a MapTX which is also a PartialRevisionRemover.
+type removingMockMapTX struct {
+	*MockMapTX
+	removed bool
+}
+
+func (t *removingMockMapTX) RemovePartialRevisions() (int64, error) {
+	t.removed = true
+	return 1, nil
+}
+
+// decoratedMapTX is a decorated MapTX which doesn't implement any optional
+// interfaces itself.
+type decoratedMapTX struct {
+	MapTX
+}
+
+func TestWrapMapTXsKeepsOptionalInterfaces(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := NewMockMapStorage(ctrl)
+	mockTx := &removingMockMapTX{MockMapTX: NewMockMapTX(ctrl)}
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+
+	s := WrapMapStorage(mockStorage, WrapMapTXs(MapTXWrappers{
+		TX: func(tx MapTX) MapTX { return &decoratedMapTX{tx} },
+	}))
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error from Begin: %v", err)
+	}
+	remover, ok := tx.(PartialRevisionRemover)
+	if !ok {
+		t.Fatalf("Wrapped transaction %T isn't a PartialRevisionRemover", tx)
+	}
+	if _, err := remover.RemovePartialRevisions(); err != nil || !mockTx.removed {
+		t.Fatalf("RemovePartialRevisions() = %v, removed %v, want the underlying transaction's", err, mockTx.removed)
+	}
+	if _, ok := tx.(SubtreeInspector); ok {
+		t.Errorf("Wrapped transaction %T is a SubtreeInspector, but the underlying one isn't", tx)
+	}
+}
+
+// replicaMapStorage is a MapStorage which is also a MapRevisionSnapshotter.
+type replicaMapStorage struct {
+	*MockMapStorage
+	revision int64
+}
+
+func (s *replicaMapStorage) SnapshotAtLeast(revision int64) (ReadOnlyMapTX, error) {
+	s.revision = revision
+	return s.Snapshot()
+}
+
+func TestWrapMapTXsSnapshotAtLeast(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := NewMockMapStorage(ctrl)
+	mockStorage.EXPECT().Snapshot().Times(2).Return(NewMockReadOnlyMapTX(ctrl), nil)
+	wrapped := 0
+	wrappers := WrapMapTXs(MapTXWrappers{
+		Snapshot: func(tx ReadOnlyMapTX) ReadOnlyMapTX { wrapped++; return tx },
+	})
+
+	// Storage that isn't a MapRevisionSnapshotter gives its latest snapshot
+	if _, err := WrapMapStorage(mockStorage, wrappers).(MapRevisionSnapshotter).SnapshotAtLeast(5); err != nil {
+		t.Fatalf("SnapshotAtLeast failed: %v", err)
+	}
+	replica := &replicaMapStorage{MockMapStorage: mockStorage}
+	if _, err := WrapMapStorage(replica, wrappers).(MapRevisionSnapshotter).SnapshotAtLeast(5); err != nil {
+		t.Fatalf("SnapshotAtLeast failed: %v", err)
+	}
+	if replica.revision != 5 {
+		t.Errorf("SnapshotAtLeast(5) passed on revision %d", replica.revision)
+	}
+	if wrapped != 2 {
+		t.Errorf("Snapshot wrapper called %d times, want 2", wrapped)
+	}
+}
@@ -4,6 +4,8 @@
 package storage
 
 import (
+	time "time"
+
 	gomock "github.com/golang/mock/gomock"
 	trillian "github.com/google/trillian"
 )
@@ -29,6 +31,17 @@ func (_m *MockLogTX) EXPECT() *_MockLogTXRecorder {
 	return _m.recorder
 }
 
+func (_m *MockLogTX) AddSequencedLeaves(_param0 []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
+	ret := _m.ctrl.Call(_m, "AddSequencedLeaves", _param0)
+	ret0, _ := ret[0].([]*trillian.LogLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockLogTXRecorder) AddSequencedLeaves(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AddSequencedLeaves", arg0)
+}
+
 func (_m *MockLogTX) Commit() error {
 	ret := _m.ctrl.Call(_m, "Commit")
 	ret0, _ := ret[0].(error)
@@ -39,15 +52,26 @@ func (_mr *_MockLogTXRecorder) Commit() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Commit")
 }
 
-func (_m *MockLogTX) DequeueLeaves(_param0 int) ([]trillian.LogLeaf, error) {
-	ret := _m.ctrl.Call(_m, "DequeueLeaves", _param0)
+func (_m *MockLogTX) DequeueLeaves(_param0 int, _param1 time.Duration) ([]trillian.LogLeaf, error) {
+	ret := _m.ctrl.Call(_m, "DequeueLeaves", _param0, _param1)
+	ret0, _ := ret[0].([]trillian.LogLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockLogTXRecorder) DequeueLeaves(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DequeueLeaves", arg0, arg1)
+}
+
+func (_m *MockLogTX) DequeueSequencedLeaves(_param0 int64, _param1 int) ([]trillian.LogLeaf, error) {
+	ret := _m.ctrl.Call(_m, "DequeueSequencedLeaves", _param0, _param1)
 	ret0, _ := ret[0].([]trillian.LogLeaf)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-func (_mr *_MockLogTXRecorder) DequeueLeaves(arg0 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "DequeueLeaves", arg0)
+func (_mr *_MockLogTXRecorder) DequeueSequencedLeaves(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DequeueSequencedLeaves", arg0, arg1)
 }
 
 func (_m *MockLogTX) GetActiveLogIDs() ([]trillian.LogID, error) {
@@ -72,6 +96,18 @@ func (_mr *_MockLogTXRecorder) GetActiveLogIDsWithPendingWork() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetActiveLogIDsWithPendingWork")
 }
 
+func (_m *MockLogTX) GetLeafIndexRangeByTime(_param0 int64, _param1 int64) (int64, int64, error) {
+	ret := _m.ctrl.Call(_m, "GetLeafIndexRangeByTime", _param0, _param1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockLogTXRecorder) GetLeafIndexRangeByTime(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeafIndexRangeByTime", arg0, arg1)
+}
+
 func (_m *MockLogTX) GetLeavesByHash(_param0 []trillian.Hash, _param1 bool) ([]trillian.LogLeaf, error) {
 	ret := _m.ctrl.Call(_m, "GetLeavesByHash", _param0, _param1)
 	ret0, _ := ret[0].([]trillian.LogLeaf)
@@ -94,6 +130,28 @@ func (_mr *_MockLogTXRecorder) GetLeavesByIndex(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeavesByIndex", arg0)
 }
 
+func (_m *MockLogTX) GetLeavesByRange(_param0 int64, _param1 int64) ([]trillian.LogLeaf, error) {
+	ret := _m.ctrl.Call(_m, "GetLeavesByRange", _param0, _param1)
+	ret0, _ := ret[0].([]trillian.LogLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockLogTXRecorder) GetLeavesByRange(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeavesByRange", arg0, arg1)
+}
+
+func (_m *MockLogTX) GetLogRootCosignatures(_param0 int64) ([]trillian.Cosignature, error) {
+	ret := _m.ctrl.Call(_m, "GetLogRootCosignatures", _param0)
+	ret0, _ := ret[0].([]trillian.Cosignature)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockLogTXRecorder) GetLogRootCosignatures(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLogRootCosignatures", arg0)
+}
+
 func (_m *MockLogTX) GetMerkleNodes(_param0 int64, _param1 []NodeID) ([]Node, error) {
 	ret := _m.ctrl.Call(_m, "GetMerkleNodes", _param0, _param1)
 	ret0, _ := ret[0].([]Node)
@@ -148,16 +206,38 @@ func (_mr *_MockLogTXRecorder) LatestSignedLogRoot() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "LatestSignedLogRoot")
 }
 
-func (_m *MockLogTX) QueueLeaves(_param0 []trillian.LogLeaf) error {
+func (_m *MockLogTX) OldestQueuedLeafTimestampNanos() (int64, error) {
+	ret := _m.ctrl.Call(_m, "OldestQueuedLeafTimestampNanos")
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockLogTXRecorder) OldestQueuedLeafTimestampNanos() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "OldestQueuedLeafTimestampNanos")
+}
+
+func (_m *MockLogTX) QueueLeaves(_param0 []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
 	ret := _m.ctrl.Call(_m, "QueueLeaves", _param0)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].([]*trillian.LogLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 func (_mr *_MockLogTXRecorder) QueueLeaves(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "QueueLeaves", arg0)
 }
 
+func (_m *MockLogTX) RefreshSignedLogRoot(_param0 trillian.SignedLogRoot) error {
+	ret := _m.ctrl.Call(_m, "RefreshSignedLogRoot", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockLogTXRecorder) RefreshSignedLogRoot(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RefreshSignedLogRoot", arg0)
+}
+
 func (_m *MockLogTX) Rollback() error {
 	ret := _m.ctrl.Call(_m, "Rollback")
 	ret0, _ := ret[0].(error)
@@ -178,6 +258,16 @@ func (_mr *_MockLogTXRecorder) SetMerkleNodes(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetMerkleNodes", arg0)
 }
 
+func (_m *MockLogTX) StoreLogRootCosignature(_param0 int64, _param1 trillian.Cosignature) error {
+	ret := _m.ctrl.Call(_m, "StoreLogRootCosignature", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockLogTXRecorder) StoreLogRootCosignature(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "StoreLogRootCosignature", arg0, arg1)
+}
+
 func (_m *MockLogTX) StoreSignedLogRoot(_param0 trillian.SignedLogRoot) error {
 	ret := _m.ctrl.Call(_m, "StoreSignedLogRoot", _param0)
 	ret0, _ := ret[0].(error)
@@ -229,6 +319,36 @@ func (_m *MockMapTX) EXPECT() *_MockMapTXRecorder {
 	return _m.recorder
 }
 
+func (_m *MockMapTX) AbandonStagedMapRoot() error {
+	ret := _m.ctrl.Call(_m, "AbandonStagedMapRoot")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMapTXRecorder) AbandonStagedMapRoot() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AbandonStagedMapRoot")
+}
+
+func (_m *MockMapTX) ArchiveRevision(_param0 int64, _param1 string) error {
+	ret := _m.ctrl.Call(_m, "ArchiveRevision", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMapTXRecorder) ArchiveRevision(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ArchiveRevision", arg0, arg1)
+}
+
+func (_m *MockMapTX) ClearRevisionRestored(_param0 int64) error {
+	ret := _m.ctrl.Call(_m, "ClearRevisionRestored", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMapTXRecorder) ClearRevisionRestored(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ClearRevisionRestored", arg0)
+}
+
 func (_m *MockMapTX) Commit() error {
 	ret := _m.ctrl.Call(_m, "Commit")
 	ret0, _ := ret[0].(error)
@@ -239,6 +359,28 @@ func (_mr *_MockMapTXRecorder) Commit() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Commit")
 }
 
+func (_m *MockMapTX) DeleteMapLeavesBelowRevision(_param0 int64) (int64, error) {
+	ret := _m.ctrl.Call(_m, "DeleteMapLeavesBelowRevision", _param0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMapTXRecorder) DeleteMapLeavesBelowRevision(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteMapLeavesBelowRevision", arg0)
+}
+
+func (_m *MockMapTX) EarliestRevisionSince(_param0 int64) (int64, error) {
+	ret := _m.ctrl.Call(_m, "EarliestRevisionSince", _param0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMapTXRecorder) EarliestRevisionSince(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "EarliestRevisionSince", arg0)
+}
+
 func (_m *MockMapTX) Get(_param0 int64, _param1 []trillian.Hash) ([]trillian.MapLeaf, error) {
 	ret := _m.ctrl.Call(_m, "Get", _param0, _param1)
 	ret0, _ := ret[0].([]trillian.MapLeaf)
@@ -250,6 +392,39 @@ func (_mr *_MockMapTXRecorder) Get(arg0, arg1 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Get", arg0, arg1)
 }
 
+func (_m *MockMapTX) GetArchivableRevision(_param0 int64) (*ArchiveSegment, error) {
+	ret := _m.ctrl.Call(_m, "GetArchivableRevision", _param0)
+	ret0, _ := ret[0].(*ArchiveSegment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMapTXRecorder) GetArchivableRevision(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetArchivableRevision", arg0)
+}
+
+func (_m *MockMapTX) GetArchivedRevisions() (map[int64]string, error) {
+	ret := _m.ctrl.Call(_m, "GetArchivedRevisions")
+	ret0, _ := ret[0].(map[int64]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMapTXRecorder) GetArchivedRevisions() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetArchivedRevisions")
+}
+
+func (_m *MockMapTX) GetChangedLeaves(_param0 int64) ([]trillian.MapLeaf, error) {
+	ret := _m.ctrl.Call(_m, "GetChangedLeaves", _param0)
+	ret0, _ := ret[0].([]trillian.MapLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMapTXRecorder) GetChangedLeaves(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetChangedLeaves", arg0)
+}
+
 func (_m *MockMapTX) GetMerkleNodes(_param0 int64, _param1 []NodeID) ([]Node, error) {
 	ret := _m.ctrl.Call(_m, "GetMerkleNodes", _param0, _param1)
 	ret0, _ := ret[0].([]Node)
@@ -261,6 +436,61 @@ func (_mr *_MockMapTXRecorder) GetMerkleNodes(arg0, arg1 interface{}) *gomock.Ca
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMerkleNodes", arg0, arg1)
 }
 
+func (_m *MockMapTX) GetRestoredRevisions() (map[int64]int64, error) {
+	ret := _m.ctrl.Call(_m, "GetRestoredRevisions")
+	ret0, _ := ret[0].(map[int64]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMapTXRecorder) GetRestoredRevisions() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetRestoredRevisions")
+}
+
+func (_m *MockMapTX) GetRetentionPolicy() (RetentionPolicy, error) {
+	ret := _m.ctrl.Call(_m, "GetRetentionPolicy")
+	ret0, _ := ret[0].(RetentionPolicy)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMapTXRecorder) GetRetentionPolicy() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetRetentionPolicy")
+}
+
+func (_m *MockMapTX) GetRevisionForTag(_param0 string) (int64, error) {
+	ret := _m.ctrl.Call(_m, "GetRevisionForTag", _param0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMapTXRecorder) GetRevisionForTag(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetRevisionForTag", arg0)
+}
+
+func (_m *MockMapTX) GetRevisionTags() (map[string]int64, error) {
+	ret := _m.ctrl.Call(_m, "GetRevisionTags")
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMapTXRecorder) GetRevisionTags() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetRevisionTags")
+}
+
+func (_m *MockMapTX) GetSignedMapRoot(_param0 int64) (trillian.SignedMapRoot, error) {
+	ret := _m.ctrl.Call(_m, "GetSignedMapRoot", _param0)
+	ret0, _ := ret[0].(trillian.SignedMapRoot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMapTXRecorder) GetSignedMapRoot(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSignedMapRoot", arg0)
+}
+
 func (_m *MockMapTX) GetTreeRevisionAtSize(_param0 int64) (int64, error) {
 	ret := _m.ctrl.Call(_m, "GetTreeRevisionAtSize", _param0)
 	ret0, _ := ret[0].(int64)
@@ -293,6 +523,90 @@ func (_mr *_MockMapTXRecorder) LatestSignedMapRoot() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "LatestSignedMapRoot")
 }
 
+func (_m *MockMapTX) ListLeaves(_param0 int64, _param1 trillian.Hash, _param2 int) ([]trillian.MapLeaf, error) {
+	ret := _m.ctrl.Call(_m, "ListLeaves", _param0, _param1, _param2)
+	ret0, _ := ret[0].([]trillian.MapLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMapTXRecorder) ListLeaves(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListLeaves", arg0, arg1, arg2)
+}
+
+func (_m *MockMapTX) MapHeadReverts() ([]MapHeadRevert, error) {
+	ret := _m.ctrl.Call(_m, "MapHeadReverts")
+	ret0, _ := ret[0].([]MapHeadRevert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMapTXRecorder) MapHeadReverts() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "MapHeadReverts")
+}
+
+func (_m *MockMapTX) OldestRetainedRevision() (int64, error) {
+	ret := _m.ctrl.Call(_m, "OldestRetainedRevision")
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMapTXRecorder) OldestRetainedRevision() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "OldestRetainedRevision")
+}
+
+func (_m *MockMapTX) PruneRevisionsBefore(_param0 int64) error {
+	ret := _m.ctrl.Call(_m, "PruneRevisionsBefore", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMapTXRecorder) PruneRevisionsBefore(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "PruneRevisionsBefore", arg0)
+}
+
+func (_m *MockMapTX) PublishStagedMapRoot(_param0 trillian.SignedMapRoot) error {
+	ret := _m.ctrl.Call(_m, "PublishStagedMapRoot", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMapTXRecorder) PublishStagedMapRoot(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "PublishStagedMapRoot", arg0)
+}
+
+func (_m *MockMapTX) RefreshSignedMapRoot(_param0 trillian.SignedMapRoot) error {
+	ret := _m.ctrl.Call(_m, "RefreshSignedMapRoot", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMapTXRecorder) RefreshSignedMapRoot(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RefreshSignedMapRoot", arg0)
+}
+
+func (_m *MockMapTX) RestoreArchivedRevision(_param0 *ArchiveSegment) error {
+	ret := _m.ctrl.Call(_m, "RestoreArchivedRevision", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMapTXRecorder) RestoreArchivedRevision(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RestoreArchivedRevision", arg0)
+}
+
+func (_m *MockMapTX) RevertMapHead(_param0 int64, _param1 string, _param2 int64) (MapHeadRevert, error) {
+	ret := _m.ctrl.Call(_m, "RevertMapHead", _param0, _param1, _param2)
+	ret0, _ := ret[0].(MapHeadRevert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMapTXRecorder) RevertMapHead(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RevertMapHead", arg0, arg1, arg2)
+}
+
 func (_m *MockMapTX) Rollback() error {
 	ret := _m.ctrl.Call(_m, "Rollback")
 	ret0, _ := ret[0].(error)
@@ -313,6 +627,16 @@ func (_mr *_MockMapTXRecorder) Set(arg0, arg1 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Set", arg0, arg1)
 }
 
+func (_m *MockMapTX) SetLeaves(_param0 []trillian.MapLeaf) error {
+	ret := _m.ctrl.Call(_m, "SetLeaves", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMapTXRecorder) SetLeaves(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetLeaves", arg0)
+}
+
 func (_m *MockMapTX) SetMerkleNodes(_param0 []Node) error {
 	ret := _m.ctrl.Call(_m, "SetMerkleNodes", _param0)
 	ret0, _ := ret[0].(error)
@@ -323,6 +647,58 @@ func (_mr *_MockMapTXRecorder) SetMerkleNodes(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetMerkleNodes", arg0)
 }
 
+func (_m *MockMapTX) SetRetentionPolicy(_param0 RetentionPolicy) error {
+	ret := _m.ctrl.Call(_m, "SetRetentionPolicy", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMapTXRecorder) SetRetentionPolicy(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetRetentionPolicy", arg0)
+}
+
+func (_m *MockMapTX) SetRevisionRestored(_param0 int64, _param1 int64) error {
+	ret := _m.ctrl.Call(_m, "SetRevisionRestored", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMapTXRecorder) SetRevisionRestored(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetRevisionRestored", arg0, arg1)
+}
+
+func (_m *MockMapTX) SkipMapRevisions(_param0 int64, _param1 string, _param2 int64) error {
+	ret := _m.ctrl.Call(_m, "SkipMapRevisions", _param0, _param1, _param2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMapTXRecorder) SkipMapRevisions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SkipMapRevisions", arg0, arg1, arg2)
+}
+
+func (_m *MockMapTX) StageSignedMapRoot(_param0 trillian.SignedMapRoot) error {
+	ret := _m.ctrl.Call(_m, "StageSignedMapRoot", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMapTXRecorder) StageSignedMapRoot(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "StageSignedMapRoot", arg0)
+}
+
+func (_m *MockMapTX) StagedSignedMapRoot() (trillian.SignedMapRoot, bool, error) {
+	ret := _m.ctrl.Call(_m, "StagedSignedMapRoot")
+	ret0, _ := ret[0].(trillian.SignedMapRoot)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockMapTXRecorder) StagedSignedMapRoot() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "StagedSignedMapRoot")
+}
+
 func (_m *MockMapTX) StoreSignedMapRoot(_param0 trillian.SignedMapRoot) error {
 	ret := _m.ctrl.Call(_m, "StoreSignedMapRoot", _param0)
 	ret0, _ := ret[0].(error)
@@ -333,6 +709,16 @@ func (_mr *_MockMapTXRecorder) StoreSignedMapRoot(arg0 interface{}) *gomock.Call
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "StoreSignedMapRoot", arg0)
 }
 
+func (_m *MockMapTX) TagMapRevision(_param0 string, _param1 int64, _param2 int64) error {
+	ret := _m.ctrl.Call(_m, "TagMapRevision", _param0, _param1, _param2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMapTXRecorder) TagMapRevision(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "TagMapRevision", arg0, arg1, arg2)
+}
+
 func (_m *MockMapTX) WriteRevision() int64 {
 	ret := _m.ctrl.Call(_m, "WriteRevision")
 	ret0, _ := ret[0].(int64)
@@ -374,6 +760,18 @@ func (_mr *_MockReadOnlyLogTXRecorder) Commit() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Commit")
 }
 
+func (_m *MockReadOnlyLogTX) GetLeafIndexRangeByTime(_param0 int64, _param1 int64) (int64, int64, error) {
+	ret := _m.ctrl.Call(_m, "GetLeafIndexRangeByTime", _param0, _param1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockReadOnlyLogTXRecorder) GetLeafIndexRangeByTime(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeafIndexRangeByTime", arg0, arg1)
+}
+
 func (_m *MockReadOnlyLogTX) GetLeavesByHash(_param0 []trillian.Hash, _param1 bool) ([]trillian.LogLeaf, error) {
 	ret := _m.ctrl.Call(_m, "GetLeavesByHash", _param0, _param1)
 	ret0, _ := ret[0].([]trillian.LogLeaf)
@@ -396,6 +794,28 @@ func (_mr *_MockReadOnlyLogTXRecorder) GetLeavesByIndex(arg0 interface{}) *gomoc
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeavesByIndex", arg0)
 }
 
+func (_m *MockReadOnlyLogTX) GetLeavesByRange(_param0 int64, _param1 int64) ([]trillian.LogLeaf, error) {
+	ret := _m.ctrl.Call(_m, "GetLeavesByRange", _param0, _param1)
+	ret0, _ := ret[0].([]trillian.LogLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyLogTXRecorder) GetLeavesByRange(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeavesByRange", arg0, arg1)
+}
+
+func (_m *MockReadOnlyLogTX) GetLogRootCosignatures(_param0 int64) ([]trillian.Cosignature, error) {
+	ret := _m.ctrl.Call(_m, "GetLogRootCosignatures", _param0)
+	ret0, _ := ret[0].([]trillian.Cosignature)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyLogTXRecorder) GetLogRootCosignatures(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLogRootCosignatures", arg0)
+}
+
 func (_m *MockReadOnlyLogTX) GetMerkleNodes(_param0 int64, _param1 []NodeID) ([]Node, error) {
 	ret := _m.ctrl.Call(_m, "GetMerkleNodes", _param0, _param1)
 	ret0, _ := ret[0].([]Node)
@@ -440,6 +860,17 @@ func (_mr *_MockReadOnlyLogTXRecorder) LatestSignedLogRoot() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "LatestSignedLogRoot")
 }
 
+func (_m *MockReadOnlyLogTX) OldestQueuedLeafTimestampNanos() (int64, error) {
+	ret := _m.ctrl.Call(_m, "OldestQueuedLeafTimestampNanos")
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyLogTXRecorder) OldestQueuedLeafTimestampNanos() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "OldestQueuedLeafTimestampNanos")
+}
+
 // Mock of ReadOnlyMapTX interface
 type MockReadOnlyMapTX struct {
 	ctrl     *gomock.Controller
@@ -482,6 +913,17 @@ func (_mr *_MockReadOnlyMapTXRecorder) Get(arg0, arg1 interface{}) *gomock.Call
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Get", arg0, arg1)
 }
 
+func (_m *MockReadOnlyMapTX) GetChangedLeaves(_param0 int64) ([]trillian.MapLeaf, error) {
+	ret := _m.ctrl.Call(_m, "GetChangedLeaves", _param0)
+	ret0, _ := ret[0].([]trillian.MapLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyMapTXRecorder) GetChangedLeaves(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetChangedLeaves", arg0)
+}
+
 func (_m *MockReadOnlyMapTX) GetMerkleNodes(_param0 int64, _param1 []NodeID) ([]Node, error) {
 	ret := _m.ctrl.Call(_m, "GetMerkleNodes", _param0, _param1)
 	ret0, _ := ret[0].([]Node)
@@ -493,6 +935,39 @@ func (_mr *_MockReadOnlyMapTXRecorder) GetMerkleNodes(arg0, arg1 interface{}) *g
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMerkleNodes", arg0, arg1)
 }
 
+func (_m *MockReadOnlyMapTX) GetRevisionForTag(_param0 string) (int64, error) {
+	ret := _m.ctrl.Call(_m, "GetRevisionForTag", _param0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyMapTXRecorder) GetRevisionForTag(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetRevisionForTag", arg0)
+}
+
+func (_m *MockReadOnlyMapTX) GetRevisionTags() (map[string]int64, error) {
+	ret := _m.ctrl.Call(_m, "GetRevisionTags")
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyMapTXRecorder) GetRevisionTags() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetRevisionTags")
+}
+
+func (_m *MockReadOnlyMapTX) GetSignedMapRoot(_param0 int64) (trillian.SignedMapRoot, error) {
+	ret := _m.ctrl.Call(_m, "GetSignedMapRoot", _param0)
+	ret0, _ := ret[0].(trillian.SignedMapRoot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyMapTXRecorder) GetSignedMapRoot(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSignedMapRoot", arg0)
+}
+
 func (_m *MockReadOnlyMapTX) GetTreeRevisionAtSize(_param0 int64) (int64, error) {
 	ret := _m.ctrl.Call(_m, "GetTreeRevisionAtSize", _param0)
 	ret0, _ := ret[0].(int64)
@@ -515,6 +990,17 @@ func (_mr *_MockReadOnlyMapTXRecorder) LatestSignedMapRoot() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "LatestSignedMapRoot")
 }
 
+func (_m *MockReadOnlyMapTX) ListLeaves(_param0 int64, _param1 trillian.Hash, _param2 int) ([]trillian.MapLeaf, error) {
+	ret := _m.ctrl.Call(_m, "ListLeaves", _param0, _param1, _param2)
+	ret0, _ := ret[0].([]trillian.MapLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyMapTXRecorder) ListLeaves(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListLeaves", arg0, arg1, arg2)
+}
+
 // Mock of MapStorage interface
 type MockMapStorage struct {
 	ctrl     *gomock.Controller
@@ -547,6 +1033,36 @@ func (_mr *_MockMapStorageRecorder) Begin() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Begin")
 }
 
+func (_m *MockMapStorage) HashAlgorithm() trillian.HashAlgorithm {
+	ret := _m.ctrl.Call(_m, "HashAlgorithm")
+	ret0, _ := ret[0].(trillian.HashAlgorithm)
+	return ret0
+}
+
+func (_mr *_MockMapStorageRecorder) HashAlgorithm() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "HashAlgorithm")
+}
+
+func (_m *MockMapStorage) HashPrefixes() TreeHashPrefixes {
+	ret := _m.ctrl.Call(_m, "HashPrefixes")
+	ret0, _ := ret[0].(TreeHashPrefixes)
+	return ret0
+}
+
+func (_mr *_MockMapStorageRecorder) HashPrefixes() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "HashPrefixes")
+}
+
+func (_m *MockMapStorage) HashStrategy() trillian.HashStrategy {
+	ret := _m.ctrl.Call(_m, "HashStrategy")
+	ret0, _ := ret[0].(trillian.HashStrategy)
+	return ret0
+}
+
+func (_mr *_MockMapStorageRecorder) HashStrategy() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "HashStrategy")
+}
+
 func (_m *MockMapStorage) MapID() trillian.MapID {
 	ret := _m.ctrl.Call(_m, "MapID")
 	ret0, _ := ret[0].(trillian.MapID)
@@ -600,6 +1116,66 @@ func (_mr *_MockLogStorageRecorder) Begin() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Begin")
 }
 
+func (_m *MockLogStorage) DuplicatePolicy() trillian.DuplicatePolicy {
+	ret := _m.ctrl.Call(_m, "DuplicatePolicy")
+	ret0, _ := ret[0].(trillian.DuplicatePolicy)
+	return ret0
+}
+
+func (_mr *_MockLogStorageRecorder) DuplicatePolicy() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DuplicatePolicy")
+}
+
+func (_m *MockLogStorage) HashAlgorithm() trillian.HashAlgorithm {
+	ret := _m.ctrl.Call(_m, "HashAlgorithm")
+	ret0, _ := ret[0].(trillian.HashAlgorithm)
+	return ret0
+}
+
+func (_mr *_MockLogStorageRecorder) HashAlgorithm() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "HashAlgorithm")
+}
+
+func (_m *MockLogStorage) HashPrefixes() TreeHashPrefixes {
+	ret := _m.ctrl.Call(_m, "HashPrefixes")
+	ret0, _ := ret[0].(TreeHashPrefixes)
+	return ret0
+}
+
+func (_mr *_MockLogStorageRecorder) HashPrefixes() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "HashPrefixes")
+}
+
+func (_m *MockLogStorage) HashStrategy() trillian.HashStrategy {
+	ret := _m.ctrl.Call(_m, "HashStrategy")
+	ret0, _ := ret[0].(trillian.HashStrategy)
+	return ret0
+}
+
+func (_mr *_MockLogStorageRecorder) HashStrategy() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "HashStrategy")
+}
+
+func (_m *MockLogStorage) MaxRootDuration() time.Duration {
+	ret := _m.ctrl.Call(_m, "MaxRootDuration")
+	ret0, _ := ret[0].(time.Duration)
+	return ret0
+}
+
+func (_mr *_MockLogStorageRecorder) MaxRootDuration() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "MaxRootDuration")
+}
+
+func (_m *MockLogStorage) SequenceGuard() time.Duration {
+	ret := _m.ctrl.Call(_m, "SequenceGuard")
+	ret0, _ := ret[0].(time.Duration)
+	return ret0
+}
+
+func (_mr *_MockLogStorageRecorder) SequenceGuard() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SequenceGuard")
+}
+
 func (_m *MockLogStorage) Snapshot() (ReadOnlyLogTX, error) {
 	ret := _m.ctrl.Call(_m, "Snapshot")
 	ret0, _ := ret[0].(ReadOnlyLogTX)
@@ -610,3 +1186,23 @@ func (_m *MockLogStorage) Snapshot() (ReadOnlyLogTX, error) {
 func (_mr *_MockLogStorageRecorder) Snapshot() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Snapshot")
 }
+
+func (_m *MockLogStorage) TreeState() trillian.TreeState {
+	ret := _m.ctrl.Call(_m, "TreeState")
+	ret0, _ := ret[0].(trillian.TreeState)
+	return ret0
+}
+
+func (_mr *_MockLogStorageRecorder) TreeState() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "TreeState")
+}
+
+func (_m *MockLogStorage) TreeType() trillian.TreeType {
+	ret := _m.ctrl.Call(_m, "TreeType")
+	ret0, _ := ret[0].(trillian.TreeType)
+	return ret0
+}
+
+func (_mr *_MockLogStorageRecorder) TreeType() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "TreeType")
+}
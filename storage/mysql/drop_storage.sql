@@ -4,10 +4,24 @@ DROP TABLE IF EXISTS Unsequenced;
 DROP TABLE IF EXISTS Subtree;
 DROP TABLE IF EXISTS SequencedLeafData;
 DROP TABLE IF EXISTS TreeHead;
+DROP TABLE IF EXISTS TreeHeadCosignature;
 DROP TABLE IF EXISTS LeafData;
 DROP TABLE IF EXISTS MapLeaf;
 DROP TABLE IF EXISTS MapHead;
+DROP TABLE IF EXISTS MapStagedHead;
+DROP TABLE IF EXISTS AbandonedMapHead;
+DROP TABLE IF EXISTS AbandonedMapLeaf;
+DROP TABLE IF EXISTS AbandonedSubtree;
+DROP TABLE IF EXISTS AbandonedMapRevisionTag;
+DROP TABLE IF EXISTS MapHeadRevert;
+DROP TABLE IF EXISTS MapRevisionTag;
+DROP TABLE IF EXISTS TreeRetention;
+DROP TABLE IF EXISTS ArchivedRevision;
+DROP TABLE IF EXISTS RestoredRevision;
+DROP TABLE IF EXISTS TreeRoute;
+DROP TABLE IF EXISTS QuotaLimit;
 DROP TABLE IF EXISTS TreeControl;
+DROP TABLE IF EXISTS TreeKey;
 DROP TABLE IF EXISTS MapHead;
 DROP TABLE IF EXISTS MapLeaf;
 DROP TABLE IF EXISTS Trees;
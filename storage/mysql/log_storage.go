@@ -6,40 +6,81 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/golang/protobuf/proto"
 	"github.com/google/trillian"
-	"github.com/google/trillian/merkle"
 	"github.com/google/trillian/storage"
 	"github.com/google/trillian/storage/cache"
 )
 
-const getTreePropertiesSQL string = "SELECT AllowsDuplicateLeaves FROM Trees WHERE TreeId=?"
-const getTreeParametersSQL string = "SELECT ReadOnlyRequests From TreeControl WHERE TreeID=?"
-const selectQueuedLeavesSQL string = `SELECT LeafHash,Payload
+const getTreePropertiesSQL string = "SELECT AllowsDuplicateLeaves,DuplicatePolicy,TreeType FROM Trees WHERE TreeId=?"
+const getTreeParametersSQL string = "SELECT ReadOnlyRequests,SequenceGuardSeconds,MaxRootDurationSeconds,TreeState From TreeControl WHERE TreeID=?"
+const selectQueuedLeavesSQL string = `SELECT LeafHash,Payload,CAST(UNIX_TIMESTAMP(QueueTimestamp)*1000000 AS SIGNED)
 		 FROM Unsequenced
-		 WHERE TreeID=?
+		 WHERE TreeID=? AND QueueTimestamp<=TIMESTAMPADD(MICROSECOND,-?,CURRENT_TIMESTAMP(6))
 		 ORDER BY QueueTimestamp DESC,LeafHash ASC LIMIT ?`
-const insertUnsequencedLeafSQL string = `INSERT INTO LeafData(TreeId,LeafHash,TheData)
-		 VALUES(?,?,?) ON DUPLICATE KEY UPDATE LeafHash=LeafHash`
+const selectOldestQueuedLeafSQL string = "SELECT COALESCE(CAST(UNIX_TIMESTAMP(MIN(QueueTimestamp))*1000000 AS SIGNED),0) FROM Unsequenced WHERE TreeId=?"
+const insertUnsequencedLeafSQL string = `INSERT INTO LeafData(TreeId,LeafHash,TheData,DataFormat)
+		 VALUES(?,?,?,?) ON DUPLICATE KEY UPDATE LeafHash=LeafHash`
 const insertUnsequencedEntrySQL string = `INSERT INTO Unsequenced(TreeId,LeafHash,MessageId,Payload)
      VALUES(?,?,?,?)`
-const insertSequencedLeafSQL string = `INSERT INTO SequencedLeafData(TreeId,LeafHash,SequenceNumber)
-		 VALUES(?,?,?)`
+const insertSequencedLeafSQL string = `INSERT INTO SequencedLeafData(TreeId,LeafHash,SequenceNumber,IntegrateTimestampNanos)
+		 VALUES(?,?,?,?)`
+const selectLeafAtIndexSQL string = `SELECT l.LeafHash,l.TheData,l.DataFormat,s.IntegrateTimestampNanos
+		     FROM LeafData l,SequencedLeafData s
+		     WHERE l.LeafHash = s.LeafHash
+		     AND s.SequenceNumber = ? AND l.TreeId = ? AND s.TreeId = l.TreeId`
+const insertStagedLeafSQL string = "INSERT INTO StagedLeafData(TreeId,LeafHash,SequenceNumber) VALUES(?,?,?)"
+const selectStagedLeafAtIndexSQL string = `SELECT l.LeafHash,l.TheData,l.DataFormat
+		     FROM LeafData l,StagedLeafData s
+		     WHERE l.LeafHash = s.LeafHash
+		     AND s.SequenceNumber = ? AND l.TreeId = ? AND s.TreeId = l.TreeId`
+const selectStagedLeavesSQL string = `SELECT l.LeafHash,l.TheData,l.DataFormat,s.SequenceNumber,0
+		     FROM LeafData l,StagedLeafData s
+		     WHERE l.LeafHash = s.LeafHash
+		     AND s.SequenceNumber >= ? AND l.TreeId = ? AND s.TreeId = l.TreeId
+		     ORDER BY s.SequenceNumber LIMIT ? FOR UPDATE`
+const deleteStagedLeavesSQL string = "DELETE FROM StagedLeafData WHERE TreeId=? AND SequenceNumber>=? AND SequenceNumber<?"
 const selectSequencedLeafCountSQL string = "SELECT COUNT(*) FROM SequencedLeafData WHERE TreeId=?"
+const selectLeafIndexRangeByTimeSQL string = `SELECT MIN(SequenceNumber),MAX(SequenceNumber)
+		 FROM SequencedLeafData
+		 WHERE TreeId=? AND IntegrateTimestampNanos>=? AND IntegrateTimestampNanos<?`
+const selectLeafCountBeforeTimeSQL string = `SELECT COUNT(*) FROM SequencedLeafData
+		 WHERE TreeId=? AND IntegrateTimestampNanos<?`
 const selectLatestSignedLogRootSQL string = `SELECT TreeHeadTimestamp,TreeSize,RootHash,TreeRevision,RootSignature
 		 FROM TreeHead WHERE TreeId=?
-		 ORDER BY TreeHeadTimestamp DESC LIMIT 1`
+		 ORDER BY TreeRevision DESC LIMIT 1`
+const selectLogRootCosignaturesSQL string = `SELECT WitnessId,Signature FROM TreeHeadCosignature
+		 WHERE TreeId=? AND TreeRevision=? ORDER BY WitnessId`
+const insertLogRootCosignatureSQL string = `INSERT INTO TreeHeadCosignature(TreeId,TreeRevision,WitnessId,Signature)
+		 VALUES(?,?,?,?) ON DUPLICATE KEY UPDATE Signature=VALUES(Signature)`
+const deleteLogRootCosignaturesSQL string = "DELETE FROM TreeHeadCosignature WHERE TreeId=? AND TreeRevision=?"
+const refreshTreeHeadSQL string = `UPDATE TreeHead SET TreeHeadTimestamp=?,RootSignature=?
+		 WHERE TreeId=? AND TreeRevision=? AND TreeSize=? AND RootHash=?`
+const selectLeavesByRangeSQL string = `SELECT l.LeafHash,l.TheData,l.DataFormat,s.SequenceNumber,s.IntegrateTimestampNanos
+		     FROM LeafData l,SequencedLeafData s
+		     WHERE l.LeafHash = s.LeafHash
+		     AND s.SequenceNumber >= ? AND l.TreeId = ? AND s.TreeId = l.TreeId
+		     ORDER BY s.SequenceNumber LIMIT ?`
 
 // These statements need to be expanded to provide the correct number of parameter placeholders
 // for a particular case
 const deleteUnsequencedSQL string = "DELETE FROM Unsequenced WHERE LeafHash IN (<placeholder>) AND TreeId = ?"
-const selectLeavesByIndexSQL string = `SELECT l.LeafHash,l.TheData,s.SequenceNumber
+const selectLeavesByIndexSQL string = `SELECT l.LeafHash,l.TheData,l.DataFormat,s.SequenceNumber,s.IntegrateTimestampNanos
 		     FROM LeafData l,SequencedLeafData s
 		     WHERE l.LeafHash = s.LeafHash
 		     AND s.SequenceNumber IN (` + placeholderSQL + `) AND l.TreeId = ? AND s.TreeId = l.TreeId`
-const selectLeavesByHashSQL string = `SELECT l.LeafHash,l.TheData,s.SequenceNumber
+
+// Leaves are written to LeafData when they're queued, so it has every leaf that's
+// queued or sequenced, and those without a sequence number are still queued.
+const selectQueuedOrSequencedLeavesByHashSQL string = `SELECT l.LeafHash,l.TheData,l.DataFormat,COALESCE(s.SequenceNumber,-1),COALESCE(s.IntegrateTimestampNanos,0)
+		     FROM LeafData l LEFT JOIN SequencedLeafData s
+		     ON s.TreeId = l.TreeId AND s.LeafHash = l.LeafHash
+		     WHERE l.LeafHash IN (` + placeholderSQL + `) AND l.TreeId = ?`
+const selectLeavesByHashSQL string = `SELECT l.LeafHash,l.TheData,l.DataFormat,s.SequenceNumber,s.IntegrateTimestampNanos
 		     FROM LeafData l,SequencedLeafData s
 		     WHERE l.LeafHash = s.LeafHash
 		     AND l.LeafHash IN (` + placeholderSQL + `) AND l.TreeId = ? AND s.TreeId = l.TreeId`
@@ -47,21 +88,33 @@ const selectLeavesByHashSQL string = `SELECT l.LeafHash,l.TheData,s.SequenceNumb
 // Same as above except with leaves ordered by sequence so we only incur this cost when necessary
 const selectLeavesByHashOrderedBySequenceSQL string = selectLeavesByHashSQL + " ORDER BY s.SequenceNumber"
 
-var defaultLogStrata = []int{8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8}
-
 type mySQLLogStorage struct {
 	*mySQLTreeStorage
 
 	logID           trillian.LogID
 	allowDuplicates bool
-	readOnly        bool
+	duplicatePolicy trillian.DuplicatePolicy
+	preordered      bool
+	// Must hold this lock before accessing control or controlRead
+	controlMu sync.Mutex
+	control   logControl
+	// controlRead is when control was read, it's read again once it's older
+	// than treeControlTTL
+	controlRead time.Time
+	// replica, if set, is the log's storage in a read replica of the database,
+	// which serves snapshots when it's up to date
+	replica *mySQLLogStorage
 }
 
 // NewLogStorage creates a mySQLLogStorage instance for the specified MySQL URL.
 func NewLogStorage(id trillian.LogID, dbURL string) (storage.LogStorage, error) {
-	// TODO(al): pass this through/configure from DB
-	th := merkle.NewRFC6962TreeHasher(trillian.NewSHA256())
-	ts, err := newTreeStorage(id.TreeID, dbURL, th.Size(), defaultLogStrata, cache.PopulateLogSubtreeNodes(th))
+	return NewLogStorageWithOptions(id, dbURL, Options{})
+}
+
+// NewLogStorageWithOptions creates a mySQLLogStorage instance for the specified
+// MySQL URL, configured with the supplied options.
+func NewLogStorageWithOptions(id trillian.LogID, dbURL string, opts Options) (storage.LogStorage, error) {
+	ts, err := newTreeStorage(id.TreeID, dbURL, opts, storage.LogStrata, cache.PopulateLogSubtreeNodes)
 	if err != nil {
 		glog.Warningf("Couldn't create a new treeStorage: %s", err)
 		return nil, err
@@ -74,38 +127,155 @@ func NewLogStorage(id trillian.LogID, dbURL string) (storage.LogStorage, error)
 
 	// TODO: This should not default but it would currently complicate testing and can be
 	// implemented later when the create tree API has been defined.
-	if err := s.db.QueryRow(getTreePropertiesSQL, id.TreeID).Scan(&s.allowDuplicates); err == sql.ErrNoRows {
+	var policyName, treeType string
+	if err := s.db.QueryRow(getTreePropertiesSQL, id.TreeID).Scan(&s.allowDuplicates, &policyName, &treeType); err == sql.ErrNoRows {
 		s.allowDuplicates = false
 	} else if err != nil {
 		glog.Warningf("Failed to get trees row for id %v: %s", id, err)
 		return nil, err
+	} else if s.duplicatePolicy, err = storage.ParseDuplicatePolicy(policyName, s.allowDuplicates); err != nil {
+		glog.Warningf("Tree %v has a bad duplicate policy: %s", id, err)
+		return nil, err
 	}
+	s.allowDuplicates = s.duplicatePolicy == trillian.DuplicatePolicy_ALLOW_DUPLICATES
+	s.preordered = treeType == PreorderedLogTreeType
 
-	err = s.db.QueryRow(getTreeParametersSQL, id.TreeID).Scan(&s.readOnly)
-
+	var configured bool
+	if s.control, configured, err = readLogControl(s.db, id); err != nil {
+		return nil, err
+	}
+	s.controlRead = time.Now()
 	// TODO(Martin2112): It's probably not ok for the log to have no parameters set. Enforce this when
 	// we have an admin API and / or we're further along.
-	if err == sql.ErrNoRows {
+	if !configured {
 		glog.Warningf("*** Opening storage for log: %v but it has no params configured ***", id)
 	}
 
+	if len(opts.ReadReplicaURI) > 0 {
+		replicaOpts := opts
+		replicaOpts.ReadReplicaURI = ""
+		replica, err := NewLogStorageWithOptions(id, opts.ReadReplicaURI, replicaOpts)
+		if err != nil {
+			glog.Warningf("Couldn't open log %v in read replica: %s", id, err)
+			return nil, err
+		}
+		s.replica = replica.(*mySQLLogStorage)
+	}
+
 	return &s, nil
 }
 
-func (m *mySQLLogStorage) getLeavesByIndexStmt(num int) (*sql.Stmt, error) {
-	return m.getStmt(selectLeavesByIndexSQL, num, "?", "?")
+// Close closes the log's connections to the database and any read replica.
+func (m *mySQLLogStorage) Close() error {
+	if m.replica != nil {
+		if err := m.replica.Close(); err != nil {
+			glog.Warningf("Failed to close read replica of log %v: %s", m.logID, err)
+		}
+	}
+	return m.mySQLTreeStorage.Close()
+}
+
+// treeControlTTL is how long the settings read from a log's TreeControl row
+// are used before they're read again, so that changes such as freezing the log
+// are picked up by servers that have it open.
+const treeControlTTL = 5 * time.Second
+
+// logControl holds the settings of a log from its TreeControl row.
+type logControl struct {
+	readOnly  bool
+	treeState trillian.TreeState
+	// sequenceGuard is zero if the log uses the sequencer's default
+	sequenceGuard time.Duration
+	// maxRootDuration is zero if the log uses the signer's default
+	maxRootDuration time.Duration
+}
+
+// readLogControl reads the settings of log id from its TreeControl row, and
+// returns whether it has one. Logs without a row have the default settings.
+func readLogControl(db *sql.DB, id trillian.LogID) (logControl, bool, error) {
+	var c logControl
+	var sequenceGuard, maxRootDuration sql.NullInt64
+	var stateName sql.NullString
+	err := db.QueryRow(getTreeParametersSQL, id.TreeID).Scan(&c.readOnly, &sequenceGuard, &maxRootDuration, &stateName)
+	configured := err != sql.ErrNoRows
+	if err != nil && configured {
+		glog.Warningf("Failed to read params of log %v: %s", id, err)
+		return logControl{}, false, err
+	}
+	c.sequenceGuard = time.Duration(sequenceGuard.Int64) * time.Second
+	c.maxRootDuration = time.Duration(maxRootDuration.Int64) * time.Second
+
+	// The state decides whether the log is read only, trees created before
+	// there were states have a state given by ReadOnlyRequests
+	if c.treeState, err = storage.ParseTreeState(stateName.String, c.readOnly); err != nil {
+		glog.Warningf("Tree %v has a bad state: %s", id, err)
+		return logControl{}, false, err
+	}
+	c.readOnly = storage.ReadOnlyTreeState(c.treeState)
+	return c, configured, nil
+}
+
+// treeControl returns the log's settings, which are read again if they're
+// older than treeControlTTL. The old settings are kept if they can't be read.
+func (m *mySQLLogStorage) treeControl() logControl {
+	m.controlMu.Lock()
+	defer m.controlMu.Unlock()
+
+	if now := time.Now(); now.Sub(m.controlRead) >= treeControlTTL {
+		if c, _, err := readLogControl(m.db, m.logID); err == nil {
+			m.control = c
+			m.controlRead = now
+		}
+	}
+	return m.control
+}
+
+// MaxRootDuration returns how old the log's latest root can get before it's re-signed.
+func (m *mySQLLogStorage) MaxRootDuration() time.Duration {
+	return m.treeControl().maxRootDuration
+}
+
+// SequenceGuard returns how long leaves stay queued before they're sequenced.
+func (m *mySQLLogStorage) SequenceGuard() time.Duration {
+	return m.treeControl().sequenceGuard
+}
+
+// DuplicatePolicy returns what the log does with leaves already in it.
+func (m *mySQLLogStorage) DuplicatePolicy() trillian.DuplicatePolicy {
+	return m.duplicatePolicy
+}
+
+// TreeState returns whether the log is active, frozen, draining or archived.
+func (m *mySQLLogStorage) TreeState() trillian.TreeState {
+	return m.treeControl().treeState
+}
+
+// TreeType returns whether the log is pre-ordered.
+func (m *mySQLLogStorage) TreeType() trillian.TreeType {
+	if m.preordered {
+		return trillian.TreeType_PREORDERED_LOG
+	}
+	return trillian.TreeType_LOG
+}
+
+func (m *mySQLLogStorage) getLeavesByIndexStmt(indices []interface{}) (*sql.Stmt, []interface{}, error) {
+	return m.getInStmt(selectLeavesByIndexSQL, indices)
 }
 
-func (m *mySQLLogStorage) getLeavesByHashStmt(num int, orderBySequence bool) (*sql.Stmt, error) {
+func (m *mySQLLogStorage) getLeavesByHashStmt(hashes []interface{}, orderBySequence bool) (*sql.Stmt, []interface{}, error) {
 	if orderBySequence {
-		return m.getStmt(selectLeavesByHashOrderedBySequenceSQL, num, "?", "?")
+		return m.getInStmt(selectLeavesByHashOrderedBySequenceSQL, hashes)
 	}
 
-	return m.getStmt(selectLeavesByHashSQL, num, "?", "?")
+	return m.getInStmt(selectLeavesByHashSQL, hashes)
+}
+
+func (m *mySQLLogStorage) getQueuedOrSequencedLeavesByHashStmt(hashes []interface{}) (*sql.Stmt, []interface{}, error) {
+	return m.getInStmt(selectQueuedOrSequencedLeavesByHashSQL, hashes)
 }
 
-func (m *mySQLLogStorage) getDeleteUnsequencedStmt(num int) (*sql.Stmt, error) {
-	return m.getStmt(deleteUnsequencedSQL, num, "?", "?")
+func (m *mySQLLogStorage) getDeleteUnsequencedStmt(hashes []interface{}) (*sql.Stmt, []interface{}, error) {
+	return m.getInStmt(deleteUnsequencedSQL, hashes)
 }
 
 func (m *mySQLLogStorage) LatestSVignedLogRoot() (trillian.SignedLogRoot, error) {
@@ -167,6 +337,7 @@ func (m *mySQLLogStorage) beginInternal() (storage.LogTX, error) {
 	}
 
 	ret.treeTX.writeRevision = root.TreeRevision + 1
+	m.noteRevision(root.TreeRevision)
 
 	return ret, nil
 }
@@ -174,14 +345,30 @@ func (m *mySQLLogStorage) beginInternal() (storage.LogTX, error) {
 func (m *mySQLLogStorage) Begin() (storage.LogTX, error) {
 	// Reject attempts to start a writable transaction in read only mode. Anything that
 	// doesn't write is a part of Snapshot so is still available via that API.
-	if m.readOnly {
+	if m.treeControl().readOnly {
 		return nil, storage.ErrReadOnly
 	}
 
 	return m.beginInternal()
 }
 
+// Snapshot implements storage.LogStorage. If the log has a read replica the
+// snapshot is of the replica, unless its latest root is older than the latest
+// one the storage has seen.
 func (m *mySQLLogStorage) Snapshot() (storage.ReadOnlyLogTX, error) {
+	if m.replica != nil {
+		tx, err := m.replica.beginInternal()
+		if err != nil {
+			glog.Warningf("Failed to read log %v from read replica, using primary: %s", m.logID, err)
+		} else if revision := tx.WriteRevision() - 1; !m.isFresh(revision) {
+			glog.V(1).Infof("Read replica of log %v is at revision %d, using primary", m.logID, revision)
+			tx.Rollback()
+		} else {
+			m.noteRevision(revision)
+			return tx.(storage.ReadOnlyLogTX), nil
+		}
+	}
+
 	tx, err := m.beginInternal()
 	if err != nil {
 		return nil, err
@@ -198,16 +385,21 @@ func (t *logTX) WriteRevision() int64 {
 	return t.treeTX.writeRevision
 }
 
-func (t *logTX) DequeueLeaves(limit int) ([]trillian.LogLeaf, error) {
-	stx, err := t.tx.Prepare(selectQueuedLeavesSQL)
+func (t *logTX) DequeueLeaves(limit int, guardWindow time.Duration) ([]trillian.LogLeaf, error) {
+	span := t.startSpan("mysql.DequeueLeaves")
+	span.SetTag("limit", limit)
+	defer span.Finish()
+
+	stx, err := t.prepare(selectQueuedLeavesSQL)
 
 	if err != nil {
 		glog.Warningf("Failed to prepare dequeue select: %s", err)
 		return nil, err
 	}
+	defer stx.Close()
 
 	leaves := make([]trillian.LogLeaf, 0, limit)
-	rows, err := stx.Query(t.ls.logID.TreeID, limit)
+	rows, err := stx.Query(t.ls.logID.TreeID, int64(guardWindow/time.Microsecond), limit)
 
 	if err != nil {
 		glog.Warningf("Failed to select rows for work: %s", err)
@@ -219,8 +411,10 @@ func (t *logTX) DequeueLeaves(limit int) ([]trillian.LogLeaf, error) {
 	for rows.Next() {
 		var leafHash []byte
 		var payload []byte
+		// Microseconds since the epoch
+		var queueTimestamp int64
 
-		err := rows.Scan(&leafHash, &payload)
+		err := rows.Scan(&leafHash, &payload, &queueTimestamp)
 
 		if err != nil {
 			glog.Warningf("Error scanning work rows: %s", err)
@@ -237,7 +431,8 @@ func (t *logTX) DequeueLeaves(limit int) ([]trillian.LogLeaf, error) {
 				LeafValue: payload,
 				ExtraData: nil,
 			},
-			SequenceNumber: 0,
+			SequenceNumber:      0,
+			QueueTimestampNanos: queueTimestamp * int64(time.Microsecond),
 		}
 		leaves = append(leaves, leaf)
 	}
@@ -259,25 +454,39 @@ func (t *logTX) DequeueLeaves(limit int) ([]trillian.LogLeaf, error) {
 	return leaves, nil
 }
 
-func (t *logTX) QueueLeaves(leaves []trillian.LogLeaf) error {
-	// Don't accept batches if any of the leaves are invalid.
-	for _, leaf := range leaves {
-		if len(leaf.LeafHash) != t.ts.hashSizeBytes {
-			return fmt.Errorf("Queued leaf must have a hash of length %d", t.ts.hashSizeBytes)
+func (t *logTX) QueueLeaves(leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
+	span := t.startSpan("mysql.QueueLeaves")
+	span.SetTag("leaves", len(leaves))
+	defer span.Finish()
+
+	// The leaf hashes are recomputed rather than trusting the ones supplied, as
+	// they identify the leaves in the tree and decide which are duplicates.
+	hashed := make([]trillian.LogLeaf, len(leaves))
+	for i, leaf := range leaves {
+		hashed[i] = leaf
+		hashed[i].LeafHash = t.ts.treeHasher.HashLeaf(leaf.LeafValue)
+	}
+	leaves = hashed
+
+	existing := make([]*trillian.LogLeaf, len(leaves))
+	if !t.ls.allowDuplicates {
+		var err error
+		if existing, err = t.findDuplicates(leaves); err != nil {
+			return nil, err
 		}
 	}
 
-	for _, leaf := range leaves {
+	for i, leaf := range leaves {
+		if existing[i] != nil {
+			continue
+		}
+
 		// Create the unsequenced leaf data entry. We don't use INSERT IGNORE because this
 		// can suppress errors unrelated to key collisions. We don't use REPLACE because
 		// if there's ever a hash collision it will do the wrong thing and it also
 		// causes a DELETE / INSERT, which is undesirable.
-		_, err := t.tx.Exec(insertUnsequencedLeafSQL, t.ls.logID.TreeID,
-			[]byte(leaf.LeafHash), leaf.LeafValue)
-
-		if err != nil {
-			glog.Warningf("Error inserting into LeafData: %s", err)
-			return err
+		if err := t.insertLeafData(leaf); err != nil {
+			return nil, err
 		}
 
 		// Create the work queue entry
@@ -287,8 +496,8 @@ func (t *logTX) QueueLeaves(leaves []trillian.LogLeaf) error {
 		hasher := sha256.New()
 
 		// We use a fixed zero message id if the log disallows duplicates otherwise a random one.
-		// the fixed id will collide if dups submitted when not allowed so the insert won't succeed
-		// and everything will get rolled back
+		// Duplicates have been skipped above, but the fixed id still collides if another
+		// transaction queues the same leaf concurrently, so only one of them will succeed
 		messageIDBytes := make([]byte, 8)
 
 		if t.ls.allowDuplicates {
@@ -296,7 +505,7 @@ func (t *logTX) QueueLeaves(leaves []trillian.LogLeaf) error {
 
 			if err != nil {
 				glog.Warningf("Failed to get a random message id: %s", err)
-				return err
+				return nil, err
 			}
 		}
 
@@ -305,18 +514,100 @@ func (t *logTX) QueueLeaves(leaves []trillian.LogLeaf) error {
 		hasher.Write(leaf.LeafHash)
 		messageID := hasher.Sum(nil)
 
-		_, err = t.tx.Exec(insertUnsequencedEntrySQL,
+		_, err := t.tx.Exec(insertUnsequencedEntrySQL,
 			t.ls.logID.TreeID, []byte(leaf.LeafHash), messageID, leaf.LeafValue)
 
 		if err != nil {
 			glog.Warningf("Error inserting into Unsequenced: %s", err)
-			return err
+			return nil, err
 		}
 	}
 
+	return existing, nil
+}
+
+// insertLeafData writes the data of leaf to LeafData, compressed and possibly
+// held in the LeafDataStore as configured for the log, unless the log already
+// has data with its hash.
+func (t *logTX) insertLeafData(leaf trillian.LogLeaf) error {
+	data, format, err := t.ts.leafData.Encode(leaf.LeafValue)
+	if err != nil {
+		return err
+	}
+	if _, err := t.tx.Exec(insertUnsequencedLeafSQL, t.ls.logID.TreeID, []byte(leaf.LeafHash), data, format); err != nil {
+		glog.Warningf("Error inserting into LeafData: %s", err)
+		return err
+	}
+	return nil
+}
+
+// scanLeaf reads a row of one of the statements selecting sequenced leaves
+// into leaf, decoding its data.
+func (t *logTX) scanLeaf(rows *sql.Rows, leaf *trillian.LogLeaf) error {
+	var format int
+	if err := rows.Scan(&leaf.LeafHash, &leaf.LeafValue, &format, &leaf.SequenceNumber, &leaf.IntegrateTimestampNanos); err != nil {
+		glog.Warningf("Failed to scan merkle leaves: %s", err)
+		return err
+	}
+	value, err := t.ts.leafData.Decode(leaf.LeafValue, format)
+	if err != nil {
+		return err
+	}
+	leaf.LeafValue = value
 	return nil
 }
 
+// findDuplicates returns the existing leaf for each of leaves whose hash is
+// already sequenced or queued, or is earlier in leaves, and nil for the others.
+// Queued leaves have a sequence number of -1. It's only used for logs that
+// don't allow duplicates, so each hash is in the log at most once.
+func (t *logTX) findDuplicates(leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
+	existing := make([]*trillian.LogLeaf, len(leaves))
+	if len(leaves) == 0 {
+		return existing, nil
+	}
+
+	hashes := make([]interface{}, 0, len(leaves))
+	for _, leaf := range leaves {
+		hashes = append(hashes, []byte(leaf.LeafHash))
+	}
+	tmpl, args, err := t.ls.getQueuedOrSequencedLeavesByHashStmt(hashes)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, t.ls.logID.TreeID)
+	rows, err := t.tx.Stmt(tmpl).Query(args...)
+	if err != nil {
+		glog.Warningf("Failed to query for duplicate leaves: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[string]*trillian.LogLeaf)
+	for rows.Next() {
+		leaf := &trillian.LogLeaf{}
+		if err := t.scanLeaf(rows, leaf); err != nil {
+			return nil, err
+		}
+		found[string(leaf.LeafHash)] = leaf
+	}
+	if err := rows.Err(); err != nil {
+		glog.Warningf("Failed to read duplicate leaves: %s", err)
+		return nil, err
+	}
+
+	for i, leaf := range leaves {
+		if dup, ok := found[string(leaf.LeafHash)]; ok {
+			existing[i] = dup
+			continue
+		}
+		// Any later leaves with the same hash are duplicates of this one
+		found[string(leaf.LeafHash)] = &trillian.LogLeaf{Leaf: leaf.Leaf, SequenceNumber: -1}
+	}
+
+	return existing, nil
+}
+
 func (t *logTX) GetSequencedLeafCount() (int64, error) {
 	var sequencedLeafCount int64
 
@@ -330,15 +621,15 @@ func (t *logTX) GetSequencedLeafCount() (int64, error) {
 }
 
 func (t *logTX) GetLeavesByIndex(leaves []int64) ([]trillian.LogLeaf, error) {
-	tmpl, err := t.ls.getLeavesByIndexStmt(len(leaves))
+	indices := make([]interface{}, 0, len(leaves))
+	for _, nodeID := range leaves {
+		indices = append(indices, interface{}(int64(nodeID)))
+	}
+	tmpl, args, err := t.ls.getLeavesByIndexStmt(indices)
 	if err != nil {
 		return nil, err
 	}
 	stx := t.tx.Stmt(tmpl)
-	args := make([]interface{}, 0)
-	for _, nodeID := range leaves {
-		args = append(args, interface{}(int64(nodeID)))
-	}
 	args = append(args, interface{}(t.ls.logID.TreeID))
 	rows, err := stx.Query(args...)
 	if err != nil {
@@ -351,8 +642,7 @@ func (t *logTX) GetLeavesByIndex(leaves []int64) ([]trillian.LogLeaf, error) {
 
 	defer rows.Close()
 	for rows.Next() {
-		if err := rows.Scan(&ret[num].LeafHash, &ret[num].LeafValue, &ret[num].SequenceNumber); err != nil {
-			glog.Warningf("Failed to scan merkle leaves: %s", err)
+		if err := t.scanLeaf(rows, &ret[num]); err != nil {
 			return nil, err
 		}
 
@@ -369,17 +659,71 @@ func (t *logTX) GetLeavesByIndex(leaves []int64) ([]trillian.LogLeaf, error) {
 	return ret, nil
 }
 
+func (t *logTX) GetLeavesByRange(start, count int64) ([]trillian.LogLeaf, error) {
+	if start < 0 || count <= 0 {
+		return nil, fmt.Errorf("invalid range start=%d count=%d", start, count)
+	}
+	rows, err := t.tx.Query(selectLeavesByRangeSQL, start, t.ls.logID.TreeID, count)
+	if err != nil {
+		glog.Warningf("Failed to get leaves by range: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]trillian.LogLeaf, 0, count)
+	for rows.Next() {
+		var leaf trillian.LogLeaf
+		if err := t.scanLeaf(rows, &leaf); err != nil {
+			return nil, err
+		}
+
+		if got, want := len(leaf.LeafHash), t.ts.hashSizeBytes; got != want {
+			return nil, fmt.Errorf("Scanned leaf does not have hash length %d, got %d", want, got)
+		}
+		// Leaves are sequenced without gaps so the range is contiguous
+		if got, want := leaf.SequenceNumber, start+int64(len(ret)); got != want {
+			return nil, fmt.Errorf("expected leaf at index %d, but saw %d", want, got)
+		}
+
+		ret = append(ret, leaf)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (t *logTX) GetLeafIndexRangeByTime(startNanos, endNanos int64) (int64, int64, error) {
+	var first, last sql.NullInt64
+
+	err := t.tx.QueryRow(selectLeafIndexRangeByTimeSQL, t.ls.logID.TreeID, startNanos, endNanos).Scan(&first, &last)
+
+	if err != nil {
+		glog.Warningf("Error getting leaf index range by time: %s", err)
+		return 0, 0, err
+	}
+
+	return storage.LeafIndexRange(first.Int64, last.Int64, first.Valid && last.Valid, func() (int64, error) {
+		var count int64
+		err := t.tx.QueryRow(selectLeafCountBeforeTimeSQL, t.ls.logID.TreeID, startNanos).Scan(&count)
+		if err != nil {
+			glog.Warningf("Error getting leaf count before time: %s", err)
+		}
+		return count, err
+	})
+}
+
 func (t *logTX) GetLeavesByHash(leafHashes []trillian.Hash, orderBySequence bool) ([]trillian.LogLeaf, error) {
-	tmpl, err := t.ls.getLeavesByHashStmt(len(leafHashes), orderBySequence)
+	hashes := make([]interface{}, 0, len(leafHashes))
+	for _, hash := range leafHashes {
+		hashes = append(hashes, interface{}([]byte(hash)))
+	}
+	tmpl, args, err := t.ls.getLeavesByHashStmt(hashes, orderBySequence)
 
 	if err != nil {
 		return nil, err
 	}
 	stx := t.tx.Stmt(tmpl)
-	args := make([]interface{}, 0)
-	for _, hash := range leafHashes {
-		args = append(args, interface{}([]byte(hash)))
-	}
 	args = append(args, interface{}(t.ls.logID.TreeID))
 	rows, err := stx.Query(args...)
 	if err != nil {
@@ -394,8 +738,7 @@ func (t *logTX) GetLeavesByHash(leafHashes []trillian.Hash, orderBySequence bool
 	for rows.Next() {
 		leaf := trillian.LogLeaf{}
 
-		if err := rows.Scan(&leaf.LeafHash, &leaf.LeafValue, &leaf.SequenceNumber); err != nil {
-			glog.Warningf("Failed to scan merkle leaves: %s", err)
+		if err := t.scanLeaf(rows, &leaf); err != nil {
 			return nil, err
 		}
 
@@ -423,7 +766,7 @@ func (t *logTX) LatestSignedLogRoot() (trillian.SignedLogRoot, error) {
 		return trillian.SignedLogRoot{}, nil
 	}
 
-	err = proto.Unmarshal(rootSignatureBytes, &rootSignature)
+	keySignatures, err := storage.UnmarshalRootSignature(rootSignatureBytes, &rootSignature)
 
 	if err != nil {
 		glog.Warningf("Failed to unmarshall root signature: %v", err)
@@ -435,13 +778,53 @@ func (t *logTX) LatestSignedLogRoot() (trillian.SignedLogRoot, error) {
 		TimestampNanos: timestamp,
 		TreeRevision:   treeRevision,
 		Signature:      &rootSignature,
+		KeySignatures:  keySignatures,
 		LogId:          t.ls.logID.LogID,
 		TreeSize:       treeSize,
 	}, nil
 }
 
+func (t *logTX) GetLogRootCosignatures(treeRevision int64) ([]trillian.Cosignature, error) {
+	rows, err := t.tx.Query(selectLogRootCosignaturesSQL, t.ls.logID.TreeID, treeRevision)
+	if err != nil {
+		glog.Warningf("Failed to read cosignatures: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []trillian.Cosignature
+	for rows.Next() {
+		var witnessID string
+		var signatureBytes []byte
+		if err := rows.Scan(&witnessID, &signatureBytes); err != nil {
+			return nil, err
+		}
+		var signature trillian.DigitallySigned
+		if err := proto.Unmarshal(signatureBytes, &signature); err != nil {
+			glog.Warningf("Failed to unmarshal cosignature: %v", err)
+			return nil, err
+		}
+		ret = append(ret, trillian.Cosignature{WitnessId: witnessID, Signature: &signature})
+	}
+	return ret, rows.Err()
+}
+
+func (t *logTX) StoreLogRootCosignature(treeRevision int64, cosig trillian.Cosignature) error {
+	signatureBytes, err := proto.Marshal(cosig.Signature)
+	if err != nil {
+		glog.Warningf("Failed to marshal cosignature: %v %v", cosig.Signature, err)
+		return err
+	}
+
+	if _, err := t.tx.Exec(insertLogRootCosignatureSQL, t.ls.logID.TreeID, treeRevision, cosig.WitnessId, signatureBytes); err != nil {
+		glog.Warningf("Failed to store cosignature: %s", err)
+		return err
+	}
+	return nil
+}
+
 func (t *logTX) StoreSignedLogRoot(root trillian.SignedLogRoot) error {
-	signatureBytes, err := proto.Marshal(root.Signature)
+	signatureBytes, err := storage.MarshalRootSignature(root.Signature, root.KeySignatures)
 
 	if err != nil {
 		glog.Warningf("Failed to marshal root signature: %v %v", root.Signature, err)
@@ -454,11 +837,49 @@ func (t *logTX) StoreSignedLogRoot(root trillian.SignedLogRoot) error {
 	if err != nil {
 		glog.Warningf("Failed to store signed root: %s", err)
 	}
+	t.rootRevision = root.TreeRevision
 
 	return checkResultOkAndRowCountIs(res, err, 1)
 }
 
+func (t *logTX) RefreshSignedLogRoot(root trillian.SignedLogRoot) error {
+	signatureBytes, err := storage.MarshalRootSignature(root.Signature, root.KeySignatures)
+	if err != nil {
+		glog.Warningf("Failed to marshal root signature: %v %v", root.Signature, err)
+		return err
+	}
+
+	res, err := t.tx.Exec(refreshTreeHeadSQL, root.TimestampNanos, signatureBytes, t.ls.logID.TreeID,
+		root.TreeRevision, root.TreeSize, root.RootHash)
+	if err != nil {
+		glog.Warningf("Failed to refresh signed root: %s", err)
+	}
+	if err := checkResultOkAndRowCountIs(res, err, 1); err != nil {
+		return err
+	}
+	t.rootRevision = root.TreeRevision
+
+	if _, err := t.tx.Exec(deleteLogRootCosignaturesSQL, t.ls.logID.TreeID, root.TreeRevision); err != nil {
+		glog.Warningf("Failed to delete cosignatures of refreshed root: %s", err)
+		return err
+	}
+	return nil
+}
+
+func (t *logTX) OldestQueuedLeafTimestampNanos() (int64, error) {
+	var oldest int64
+	if err := t.tx.QueryRow(selectOldestQueuedLeafSQL, t.ls.logID.TreeID).Scan(&oldest); err != nil {
+		glog.Warningf("Failed to get oldest queued leaf: %s", err)
+		return 0, err
+	}
+	return oldest * int64(time.Microsecond), nil
+}
+
 func (t *logTX) UpdateSequencedLeaves(leaves []trillian.LogLeaf) error {
+	span := t.startSpan("mysql.UpdateSequencedLeaves")
+	span.SetTag("leaves", len(leaves))
+	defer span.Finish()
+
 	// TODO: In theory we can do this with CASE / WHEN in one SQL statement but it's more fiddly
 	// and can be implemented later if necessary
 	for _, leaf := range leaves {
@@ -468,7 +889,7 @@ func (t *logTX) UpdateSequencedLeaves(leaves []trillian.LogLeaf) error {
 		}
 
 		_, err := t.tx.Exec(insertSequencedLeafSQL, t.ls.logID.TreeID, []byte(leaf.LeafHash),
-			leaf.SequenceNumber)
+			leaf.SequenceNumber, leaf.IntegrateTimestampNanos)
 
 		if err != nil {
 			glog.Warningf("Failed to update sequenced leaves: %s", err)
@@ -479,17 +900,116 @@ func (t *logTX) UpdateSequencedLeaves(leaves []trillian.LogLeaf) error {
 	return nil
 }
 
+// AddSequencedLeaves stages leaves at their sequence numbers, except for those
+// whose index already holds a leaf, until they're integrated.
+func (t *logTX) AddSequencedLeaves(leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
+	span := t.startSpan("mysql.AddSequencedLeaves")
+	span.SetTag("leaves", len(leaves))
+	defer span.Finish()
+
+	for _, leaf := range leaves {
+		if len(leaf.LeafHash) != t.ts.hashSizeBytes {
+			return nil, errors.New("Sequenced leaf has incorrect hash size")
+		}
+		if leaf.SequenceNumber < 0 {
+			return nil, fmt.Errorf("invalid sequence number %d", leaf.SequenceNumber)
+		}
+	}
+
+	existing := make([]*trillian.LogLeaf, len(leaves))
+	for i, leaf := range leaves {
+		dup, err := t.leafAtIndex(leaf.SequenceNumber)
+		if err != nil {
+			return nil, err
+		}
+		if dup != nil {
+			existing[i] = dup
+			continue
+		}
+
+		if err := t.insertLeafData(leaf); err != nil {
+			return nil, err
+		}
+		if _, err := t.tx.Exec(insertStagedLeafSQL, t.ls.logID.TreeID, []byte(leaf.LeafHash), leaf.SequenceNumber); err != nil {
+			glog.Warningf("Error inserting into StagedLeafData: %s", err)
+			return nil, err
+		}
+	}
+
+	return existing, nil
+}
+
+// leafAtIndex returns the leaf integrated or staged at index, or nil if there
+// isn't one.
+func (t *logTX) leafAtIndex(index int64) (*trillian.LogLeaf, error) {
+	leaf := trillian.LogLeaf{SequenceNumber: index}
+	var format int
+	err := t.tx.QueryRow(selectLeafAtIndexSQL, index, t.ls.logID.TreeID).Scan(&leaf.LeafHash, &leaf.LeafValue, &format, &leaf.IntegrateTimestampNanos)
+	if err == sql.ErrNoRows {
+		err = t.tx.QueryRow(selectStagedLeafAtIndexSQL, index, t.ls.logID.TreeID).Scan(&leaf.LeafHash, &leaf.LeafValue, &format)
+	}
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		glog.Warningf("Failed to read leaf %d: %s", index, err)
+		return nil, err
+	}
+	if leaf.LeafValue, err = t.ts.leafData.Decode(leaf.LeafValue, format); err != nil {
+		return nil, err
+	}
+	return &leaf, nil
+}
+
+// DequeueSequencedLeaves returns the staged leaves at contiguous indices from
+// start, up to limit of them, and removes them from StagedLeafData.
+func (t *logTX) DequeueSequencedLeaves(start int64, limit int) ([]trillian.LogLeaf, error) {
+	rows, err := t.tx.Query(selectStagedLeavesSQL, start, t.ls.logID.TreeID, limit)
+	if err != nil {
+		glog.Warningf("Failed to select staged leaves: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []trillian.LogLeaf
+	for rows.Next() {
+		var leaf trillian.LogLeaf
+		if err := t.scanLeaf(rows, &leaf); err != nil {
+			return nil, err
+		}
+		// Only the leaves before the first gap can be integrated
+		if leaf.SequenceNumber != start+int64(len(ret)) {
+			break
+		}
+		ret = append(ret, leaf)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(ret) == 0 {
+		return ret, nil
+	}
+	result, err := t.tx.Exec(deleteStagedLeavesSQL, t.ls.logID.TreeID, start, start+int64(len(ret)))
+	if err := checkResultOkAndRowCountIs(result, err, int64(len(ret))); err != nil {
+		glog.Warningf("Failed to delete staged leaves: %s", err)
+		return nil, err
+	}
+	return ret, nil
+}
+
 func (t *logTX) removeSequencedLeaves(leaves []trillian.LogLeaf) error {
-	tmpl, err := t.ls.getDeleteUnsequencedStmt(len(leaves))
+	hashes := make([]interface{}, 0, len(leaves))
+	for _, leaf := range leaves {
+		hashes = append(hashes, interface{}([]byte(leaf.LeafHash)))
+	}
+	tmpl, args, err := t.ls.getDeleteUnsequencedStmt(hashes)
 	if err != nil {
 		glog.Warningf("Failed to get delete statement for sequenced work: %s", err)
 		return err
 	}
 	stx := t.tx.Stmt(tmpl)
-	args := make([]interface{}, 0)
-	for _, leaf := range leaves {
-		args = append(args, interface{}([]byte(leaf.LeafHash)))
-	}
 	args = append(args, interface{}(t.ls.logID.TreeID))
 	result, err := stx.Exec(args...)
 
@@ -542,7 +1062,7 @@ func (t *logTX) GetActiveLogIDs() ([]trillian.LogID, error) {
 }
 
 // GetActiveLogIDsWithPendingWork returns a list of the IDs of all configured logs
-// that have queued unsequenced leaves that need to be integrated
+// that have queued or staged leaves that need to be integrated
 func (t *logTX) GetActiveLogIDsWithPendingWork() ([]trillian.LogID, error) {
 	return t.getActiveLogIDsInternal(selectActiveLogsWithUnsequencedSQL)
 }
@@ -0,0 +1,153 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/cache"
+	"github.com/google/trillian/storage/sqlhooks"
+)
+
+// Options holds configuration that applies to MySQL storage instances.
+type Options struct {
+	// SessionVariables are MySQL system variables that will be set on every
+	// connection opened by the storage, e.g. "innodb_lock_wait_timeout" -> "5" or
+	// "time_zone" -> "'+00:00'". Values are passed to SET as is so string values
+	// must include their quotes. These are applied on top of, and can override,
+	// defaultSessionVariables.
+	SessionVariables map[string]string
+
+	// StatementHook, if set, is called after every statement run by the
+	// storage, e.g. to record metrics or log slow queries.
+	StatementHook sqlhooks.Hook
+
+	// StatementCacheMetrics, if set, counts the hits and misses of the
+	// storage's prepared statement cache.
+	StatementCacheMetrics *StatementCacheMetrics
+
+	// TransactionMetrics, if set, records the number and duration of the
+	// storage's tree transactions.
+	TransactionMetrics *TransactionMetrics
+
+	// LeafDataStore, if set, holds leaf data that's more than
+	// ExternalLeafDataBytes long, rather than the database. It must also be
+	// set to read leaf data that was written to it before.
+	LeafDataStore         storage.LeafDataStore
+	ExternalLeafDataBytes int
+
+	// ReadReplicaURI, if set, is a read replica of the database at the URI the
+	// storage is opened with. Snapshots are read from it, unless its latest
+	// root is older than the latest one the storage has seen in either, so
+	// they never go backwards and include the storage's own writes, or than
+	// the revision a map snapshot is asked to reach. Otherwise snapshots, and
+	// all transactions, use the primary.
+	ReadReplicaURI string
+
+	// SubtreeCache, if set, holds the subtrees read by the storage between
+	// transactions. It can be shared by any number of storage instances, as long
+	// as each tree's subtrees are held in one database.
+	SubtreeCache *cache.StoredSubtreeCache
+}
+
+// defaultSessionVariables are set on every connection unless overridden in Options.
+var defaultSessionVariables = map[string]string{
+	"sql_mode": "'STRICT_ALL_TABLES'",
+}
+
+var sessionVariableNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseSessionVariables parses a semicolon separated list of name=value pairs,
+// as might be supplied by a command line flag, into a map suitable for use as
+// Options.SessionVariables. Semicolons rather than commas separate the pairs,
+// as values such as sql_mode are themselves comma separated lists. An empty
+// string results in an empty map.
+func ParseSessionVariables(vars string) (map[string]string, error) {
+	result := make(map[string]string)
+
+	if len(strings.TrimSpace(vars)) == 0 {
+		return result, nil
+	}
+
+	for _, pair := range strings.Split(vars, ";") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("session variable not in name=value form: %s", pair)
+		}
+
+		name := strings.TrimSpace(parts[0])
+		if !sessionVariableNameRE.MatchString(name) {
+			return nil, fmt.Errorf("invalid session variable name: %s", name)
+		}
+
+		result[name] = strings.TrimSpace(parts[1])
+	}
+
+	return result, nil
+}
+
+// sessionVariables merges the defaults with any variables set in the options.
+func (o Options) sessionVariables() (map[string]string, error) {
+	vars := make(map[string]string)
+
+	for name, value := range defaultSessionVariables {
+		vars[name] = value
+	}
+
+	for name, value := range o.SessionVariables {
+		if !sessionVariableNameRE.MatchString(name) {
+			return nil, fmt.Errorf("invalid session variable name: %s", name)
+		}
+		vars[name] = value
+	}
+
+	return vars, nil
+}
+
+// dsnWithSessionVariables returns dbURL with the supplied variables appended as
+// DSN parameters. The MySQL driver issues a SET for each parameter it does not
+// recognise whenever it opens a new connection so, unlike executing SET against
+// the pool, the variables apply to every connection that the pool creates.
+func dsnWithSessionVariables(dbURL string, vars map[string]string) string {
+	if len(vars) == 0 {
+		return dbURL
+	}
+
+	// Sort so the resulting DSN is stable
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	params := make([]string, 0, len(names))
+	for _, name := range names {
+		params = append(params, name+"="+url.QueryEscape(vars[name]))
+	}
+
+	separator := "?"
+	if strings.Contains(dbURL, "?") {
+		separator = "&"
+	}
+
+	return dbURL + separator + strings.Join(params, "&")
+}
+
+// ErrorCode is a sqlhooks.ErrorCodeFunc returning the MySQL error number of a
+// server error, "bad_conn" for a broken connection or "error" for anything else.
+func ErrorCode(err error) string {
+	if err == driver.ErrBadConn {
+		return "bad_conn"
+	}
+	// The driver formats server errors as "Error <number>: <message>"
+	var number int
+	if _, scanErr := fmt.Sscanf(err.Error(), "Error %d:", &number); scanErr == nil {
+		return strconv.Itoa(number)
+	}
+	return sqlhooks.GenericErrorCode(err)
+}
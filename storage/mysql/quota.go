@@ -0,0 +1,73 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/google/trillian"
+)
+
+const selectQuotaLimitsSQL string = `SELECT QuotaGroup, QuotaKind, TreeId, QuotaUser, TokensPerSecond, Burst FROM QuotaLimit
+	ORDER BY QuotaGroup, QuotaKind, TreeId, QuotaUser`
+const setQuotaLimitSQL string = `INSERT INTO QuotaLimit(QuotaGroup, QuotaKind, TreeId, QuotaUser, TokensPerSecond, Burst) VALUES(?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE TokensPerSecond=VALUES(TokensPerSecond), Burst=VALUES(Burst)`
+const deleteQuotaLimitSQL string = "DELETE FROM QuotaLimit WHERE QuotaGroup=? AND QuotaKind=? AND TreeId=? AND QuotaUser=?"
+
+// QuotaStorage holds the quota limits shared by servers, in the QuotaLimit
+// table of the database used for administration. It implements
+// quota.LimitStore.
+type QuotaStorage struct {
+	db *sql.DB
+}
+
+// NewQuotaStorage creates a QuotaStorage for the database at dbURL.
+func NewQuotaStorage(dbURL string, opts Options) (*QuotaStorage, error) {
+	db, err := openDB(dbURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &QuotaStorage{db: db}, nil
+}
+
+// ListQuotaLimits returns every limit, ordered by group, kind, tree and user.
+func (s *QuotaStorage) ListQuotaLimits() ([]*trillian.QuotaLimit, error) {
+	rows, err := s.db.Query(selectQuotaLimitsSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var limits []*trillian.QuotaLimit
+	for rows.Next() {
+		var group, kind string
+		limit := &trillian.QuotaLimit{}
+		if err := rows.Scan(&group, &kind, &limit.TreeId, &limit.User, &limit.TokensPerSecond, &limit.Burst); err != nil {
+			return nil, err
+		}
+		g, ok := trillian.QuotaGroup_value[group]
+		if !ok {
+			return nil, fmt.Errorf("unknown quota group %q", group)
+		}
+		k, ok := trillian.QuotaKind_value[kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown quota kind %q", kind)
+		}
+		limit.Group = trillian.QuotaGroup(g)
+		limit.Kind = trillian.QuotaKind(k)
+		limits = append(limits, limit)
+	}
+	return limits, rows.Err()
+}
+
+// SetQuotaLimit adds a limit, replacing any with the same group, kind, tree
+// and user.
+func (s *QuotaStorage) SetQuotaLimit(limit *trillian.QuotaLimit) error {
+	_, err := s.db.Exec(setQuotaLimitSQL, limit.Group.String(), limit.Kind.String(), limit.TreeId, limit.User, limit.TokensPerSecond, limit.Burst)
+	return err
+}
+
+// DeleteQuotaLimit removes a limit, if there is one.
+func (s *QuotaStorage) DeleteQuotaLimit(group trillian.QuotaGroup, kind trillian.QuotaKind, treeID int64, user string) error {
+	_, err := s.db.Exec(deleteQuotaLimitSQL, group.String(), kind.String(), treeID, user)
+	return err
+}
@@ -0,0 +1,96 @@
+package mysql
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/monitoring"
+	"github.com/google/trillian/storage/sqlhooks"
+)
+
+// StatementCacheMetrics counts the lookups in the storage's prepared statement
+// caches. The metrics are created once, by NewStatementCacheMetrics, and can be
+// shared by any number of storage instances through Options.
+type StatementCacheMetrics struct {
+	hits   monitoring.Counter
+	misses monitoring.Counter
+}
+
+// NewStatementCacheMetrics creates the statement cache metrics in mf. They're
+// labelled by statement as given by sqlhooks.StatementName.
+func NewStatementCacheMetrics(mf monitoring.MetricFactory) *StatementCacheMetrics {
+	return &StatementCacheMetrics{
+		hits:   mf.NewCounter("mysql_stmt_cache_hits", "Number of prepared statements found in the cache by statement", "statement"),
+		misses: mf.NewCounter("mysql_stmt_cache_misses", "Number of statements prepared on a cache miss by statement", "statement"),
+	}
+}
+
+// stmtCache holds the statements prepared on a database, keyed by their SQL
+// text and the number of values in their placeholder list, so that each is
+// prepared once and then shared by every transaction. The database prepares a
+// statement on each connection the first time it's used there. It's safe for
+// concurrent use.
+type stmtCache struct {
+	db      *sql.DB
+	metrics *StatementCacheMetrics
+
+	// Must hold the mutex before manipulating the statement map. It only needs to be
+	// held while the statements are built, not while they execute, and this will be
+	// a short time.
+	mu         sync.Mutex
+	statements map[string]map[int]*sql.Stmt
+}
+
+// newStmtCache creates a cache for db. Lookups are counted in metrics, which
+// can be nil.
+func newStmtCache(db *sql.DB, metrics *StatementCacheMetrics) *stmtCache {
+	return &stmtCache{
+		db:         db,
+		metrics:    metrics,
+		statements: make(map[string]map[int]*sql.Stmt),
+	}
+}
+
+// get returns statement prepared with its placeholder expanded to num values,
+// as by expandPlaceholderSQL. A num of zero is for statements that have no
+// placeholder, which are prepared as they are.
+func (c *stmtCache) get(statement string, num int, first, rest string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s := c.statements[statement][num]; s != nil {
+		// TODO(al,martin): we'll possibly need to expire Stmts from the cache,
+		// e.g. when DB connections break etc.
+		c.count(true, statement)
+		return s, nil
+	}
+	c.count(false, statement)
+
+	query := statement
+	if num > 0 {
+		query = expandPlaceholderSQL(statement, num, first, rest)
+	}
+	s, err := c.db.Prepare(query)
+	if err != nil {
+		glog.Warningf("Failed to prepare statement %d: %s", num, err)
+		return nil, err
+	}
+
+	if c.statements[statement] == nil {
+		c.statements[statement] = make(map[int]*sql.Stmt)
+	}
+	c.statements[statement][num] = s
+	return s, nil
+}
+
+func (c *stmtCache) count(hit bool, statement string) {
+	if c.metrics == nil {
+		return
+	}
+	if hit {
+		c.metrics.hits.Inc(sqlhooks.StatementName(statement))
+	} else {
+		c.metrics.misses.Inc(sqlhooks.StatementName(statement))
+	}
+}
@@ -10,10 +10,25 @@
 CREATE TABLE IF NOT EXISTS Trees(
   TreeId                INTEGER NOT NULL,
   KeyId                 VARBINARY(255) NOT NULL,
-  TreeType              ENUM('LOG', 'MAP')  NOT NULL,
-  LeafHasherType        ENUM('SHA256') NOT NULL,
-  TreeHasherType        ENUM('SHA256') NOT NULL,
+  TreeType              ENUM('LOG', 'MAP', 'PREORDERED_LOG')  NOT NULL,
+  LeafHasherType        ENUM('SHA256', 'SHA512') NOT NULL,
+  -- The hash algorithm also sets the depth of a map, which is the size of its key hashes
+  TreeHasherType        ENUM('SHA256', 'SHA512') NOT NULL,
+  -- How leaves and nodes are hashed with the hash algorithm
+  HashStrategy          ENUM('RFC6962', 'SHA512_256', 'LIE_SHA512_256') NOT NULL DEFAULT 'RFC6962',
+  -- The algorithm of the key that signs the tree's roots
+  SignatureAlgorithm    ENUM('ECDSA', 'RSA', 'THRESHOLD', 'ED25519') NOT NULL DEFAULT 'ECDSA',
   AllowsDuplicateLeaves BOOLEAN NOT NULL DEFAULT 0,
+  -- What a log does with leaves already in it, ALLOW_DUPLICATES if AllowsDuplicateLeaves is set
+  DuplicatePolicy       ENUM('MERGE_DUPLICATES', 'REJECT_DUPLICATES', 'ALLOW_DUPLICATES') NOT NULL DEFAULT 'MERGE_DUPLICATES',
+  -- Domain separation prefixes for leaf and node hashes, NULL for RFC 6962
+  LeafHashPrefix        VARBINARY(16),
+  NodeHashPrefix        VARBINARY(16),
+  -- Depths of a map's strata from the root, e.g. 8x10,176, NULL for the default
+  MapStrata             VARCHAR(255),
+  -- Soft deleted trees aren't served, their data is removed after a grace period
+  Deleted               BOOLEAN NOT NULL DEFAULT 0,
+  DeleteTimeNanos       BIGINT,
   PRIMARY KEY(TreeId)
 );
 
@@ -26,10 +41,32 @@ CREATE TABLE IF NOT EXISTS TreeControl(
   SequencingEnabled       BOOLEAN,
   SequenceIntervalSeconds INTEGER,
   SignIntervalSeconds     INTEGER,
+  -- Queued leaves are only sequenced once they're this old
+  SequenceGuardSeconds    INTEGER,
+  -- If set the latest root is re-signed when it's this old, even if it's unchanged
+  MaxRootDurationSeconds  INTEGER,
+  -- How new leaf data is compressed, see storage.LeafCompression. NULL is none.
+  LeafCompression         INTEGER,
+  -- If NULL the tree is FROZEN if ReadOnlyRequests is set, or else ACTIVE
+  TreeState               ENUM('ACTIVE', 'FROZEN', 'DRAINING', 'ARCHIVED'),
   PRIMARY KEY(TreeId),
   FOREIGN KEY(TreeId) REFERENCES Trees(TreeId)
 );
 
+-- The keys that have signed or will sign a tree's roots, each used from its
+-- activation time until the next key's. Roots are signed with both keys while
+-- a key is waiting to be activated. Trees without a row have only ever used
+-- the key in Trees.KeyId.
+CREATE TABLE IF NOT EXISTS TreeKey(
+  TreeId               INTEGER NOT NULL,
+  KeyId                VARBINARY(255) NOT NULL,
+  -- DER encoded public key, NULL if it wasn't known when the key was added
+  PublicKey            VARBINARY(4096),
+  ActivateTimeNanos    BIGINT NOT NULL,
+  PRIMARY KEY(TreeId, ActivateTimeNanos),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
 CREATE TABLE IF NOT EXISTS Subtree(
   TreeId               INTEGER NOT NULL,
   SubtreeId            VARBINARY(255) NOT NULL,
@@ -46,13 +83,24 @@ CREATE TABLE IF NOT EXISTS TreeHead(
   TreeHeadTimestamp    BIGINT,
   TreeSize             BIGINT,
   RootHash             VARBINARY(255) NOT NULL,
-  RootSignature        VARBINARY(255) NOT NULL,
+  RootSignature        VARBINARY(1024) NOT NULL,
   TreeRevision         BIGINT,
   PRIMARY KEY(TreeId, TreeHeadTimestamp),
   UNIQUE INDEX TreeRevisionIdx(TreeId, TreeRevision),
   FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
 );
 
+-- Witness signatures of the TreeHead at each revision. Signature is a
+-- marshaled DigitallySigned.
+CREATE TABLE IF NOT EXISTS TreeHeadCosignature(
+  TreeId               INTEGER NOT NULL,
+  TreeRevision         BIGINT NOT NULL,
+  WitnessId            VARCHAR(255) NOT NULL,
+  Signature            VARBINARY(1024) NOT NULL,
+  PRIMARY KEY(TreeId, TreeRevision, WitnessId),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
 
 -- ---------------------------------------------
 -- Log specific stuff here
@@ -68,6 +116,11 @@ CREATE TABLE IF NOT EXISTS LeafData(
   TreeId               INTEGER NOT NULL,
   LeafHash             VARBINARY(255) NOT NULL,
   TheData              BLOB NOT NULL,
+  -- The storage.LeafCompression TheData was written with, so rows written
+  -- before a log's compression was changed can still be read. If 0x80 is also
+  -- set TheData is the SHA-256 hash of the data held in the LeafDataStore,
+  -- which is why the column is unsigned
+  DataFormat           TINYINT UNSIGNED NOT NULL DEFAULT 0,
   PRIMARY KEY(TreeId, LeafHash),
   INDEX LeafHashIdx(LeafHash),
   FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
@@ -79,6 +132,21 @@ CREATE TABLE IF NOT EXISTS LeafData(
 -- on the log parameters and we can't insert into this table until we have the sequence number
 -- which is not available at the time we queue the entry.
 CREATE TABLE IF NOT EXISTS SequencedLeafData(
+  TreeId               INTEGER NOT NULL,
+  SequenceNumber       BIGINT UNSIGNED NOT NULL,
+  LeafHash             VARBINARY(255) NOT NULL,
+  -- The timestamp of the root the leaf was integrated in, zero for leaves
+  -- sequenced before this was recorded
+  IntegrateTimestampNanos BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY(TreeId, SequenceNumber),
+  INDEX IntegrateTimestampIdx(TreeId, IntegrateTimestampNanos),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE,
+  FOREIGN KEY(LeafHash) REFERENCES LeafData(LeafHash)
+);
+
+-- Leaves added to a pre-ordered log at their indices, which aren't readable
+-- until the sequencer integrates them and moves them to SequencedLeafData.
+CREATE TABLE IF NOT EXISTS StagedLeafData(
   TreeId               INTEGER NOT NULL,
   SequenceNumber       BIGINT UNSIGNED NOT NULL,
   LeafHash             VARBINARY(255) NOT NULL,
@@ -95,8 +163,11 @@ CREATE TABLE IF NOT EXISTS Unsequenced(
   -- we can try to stomp dupe submissions.
   MessageId            BINARY(32) NOT NULL,
   Payload              BLOB NOT NULL,
-  QueueTimestamp       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  PRIMARY KEY (TreeId, LeafHash, MessageId)
+  -- Held to the microsecond, so that queueing delays under a second are seen
+  QueueTimestamp       TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  PRIMARY KEY (TreeId, LeafHash, MessageId),
+  -- Leaves are dequeued, and the oldest found, in queue order
+  INDEX QueueTimestampIdx(TreeId, QueueTimestamp)
 );
 
 
@@ -110,6 +181,8 @@ CREATE TABLE IF NOT EXISTS MapLeaf(
   -- MapRevision is stored negated to invert ordering in the primary key index
   -- st. more recent revisions come first.
   MapRevision           BIGINT NOT NULL,
+  -- A marshalled MapLeaf, or if it starts with a zero byte a format byte then
+  -- the MapLeaf written as in LeafData.DataFormat
   TheData               BLOB NOT NULL,
   PRIMARY KEY(TreeId, KeyHash, MapRevision),
   FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
@@ -121,10 +194,154 @@ CREATE TABLE IF NOT EXISTS MapHead(
   MapHeadTimestamp     BIGINT,
   RootHash             VARBINARY(255) NOT NULL,
   MapRevision          BIGINT,
-  RootSignature        VARBINARY(255) NOT NULL,
+  RootSignature        VARBINARY(1024) NOT NULL,
   MapperData           BLOB,
   PRIMARY KEY(TreeId, MapHeadTimestamp),
   UNIQUE INDEX TreeRevisionIdx(TreeId, MapRevision),
   FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
 );
 
+-- A map revision which has been written but not yet published. There can be at
+-- most one per tree. The revision becomes readable when its root is moved into
+-- MapHead, or is removed along with its leaves and nodes if abandoned.
+CREATE TABLE IF NOT EXISTS MapStagedHead(
+  TreeId               INTEGER NOT NULL,
+  MapRevision          BIGINT NOT NULL,
+  RootHash             VARBINARY(255) NOT NULL,
+  StagedTimestamp      BIGINT NOT NULL,
+  MapperData           BLOB,
+  PRIMARY KEY(TreeId),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+-- Each row records the serving head of a map being reverted to an earlier
+-- revision. The data for the revisions after ToRevision is moved into the
+-- Abandoned tables below, tagged with the RevertTimestamp, rather than deleted.
+CREATE TABLE IF NOT EXISTS MapHeadRevert(
+  TreeId               INTEGER NOT NULL,
+  RevertTimestamp      BIGINT NOT NULL,
+  FromRevision         BIGINT NOT NULL,
+  ToRevision           BIGINT NOT NULL,
+  Reason               VARCHAR(1024) NOT NULL,
+  PRIMARY KEY(TreeId, RevertTimestamp),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS AbandonedMapHead(
+  TreeId               INTEGER NOT NULL,
+  RevertTimestamp      BIGINT NOT NULL,
+  MapHeadTimestamp     BIGINT,
+  RootHash             VARBINARY(255) NOT NULL,
+  MapRevision          BIGINT,
+  RootSignature        VARBINARY(1024) NOT NULL,
+  MapperData           BLOB,
+  PRIMARY KEY(TreeId, RevertTimestamp, MapRevision),
+  FOREIGN KEY(TreeId, RevertTimestamp) REFERENCES MapHeadRevert(TreeId, RevertTimestamp) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS AbandonedMapLeaf(
+  TreeId                INTEGER NOT NULL,
+  RevertTimestamp       BIGINT NOT NULL,
+  KeyHash               VARBINARY(255) NOT NULL,
+  -- Negated, as in MapLeaf
+  MapRevision           BIGINT NOT NULL,
+  TheData               BLOB NOT NULL,
+  PRIMARY KEY(TreeId, RevertTimestamp, KeyHash, MapRevision),
+  FOREIGN KEY(TreeId, RevertTimestamp) REFERENCES MapHeadRevert(TreeId, RevertTimestamp) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS AbandonedSubtree(
+  TreeId               INTEGER NOT NULL,
+  RevertTimestamp      BIGINT NOT NULL,
+  SubtreeId            VARBINARY(255) NOT NULL,
+  Nodes                VARBINARY(32768) NOT NULL,
+  SubtreeRevision      INTEGER NOT NULL,
+  PRIMARY KEY(TreeId, RevertTimestamp, SubtreeId, SubtreeRevision),
+  FOREIGN KEY(TreeId, RevertTimestamp) REFERENCES MapHeadRevert(TreeId, RevertTimestamp) ON DELETE CASCADE
+);
+
+-- Tags which were removed because they were on revisions abandoned by a revert.
+CREATE TABLE IF NOT EXISTS AbandonedMapRevisionTag(
+  TreeId               INTEGER NOT NULL,
+  RevertTimestamp      BIGINT NOT NULL,
+  Tag                  VARCHAR(255) NOT NULL,
+  MapRevision          BIGINT NOT NULL,
+  TagTimestamp         BIGINT NOT NULL,
+  PRIMARY KEY(TreeId, RevertTimestamp, Tag),
+  FOREIGN KEY(TreeId, RevertTimestamp) REFERENCES MapHeadRevert(TreeId, RevertTimestamp) ON DELETE CASCADE
+);
+
+-- Human readable names for map revisions. Tags are not changed once created.
+CREATE TABLE IF NOT EXISTS MapRevisionTag(
+  TreeId               INTEGER NOT NULL,
+  Tag                  VARCHAR(255) NOT NULL,
+  MapRevision          BIGINT NOT NULL,
+  TagTimestamp         BIGINT NOT NULL,
+  PRIMARY KEY(TreeId, Tag),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+-- The retention policy for a tree and the earliest revision that is still
+-- readable. Trees without a row retain all revisions.
+CREATE TABLE IF NOT EXISTS TreeRetention(
+  TreeId                 INTEGER NOT NULL,
+  -- Zero means there is no limit
+  MaxRevisions           BIGINT NOT NULL DEFAULT 0,
+  MaxAgeSeconds          BIGINT NOT NULL DEFAULT 0,
+  OldestRetainedRevision BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY(TreeId),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+-- Map revisions whose data has been moved to archive segments in object storage.
+CREATE TABLE IF NOT EXISTS ArchivedRevision(
+  TreeId               INTEGER NOT NULL,
+  MapRevision          BIGINT NOT NULL,
+  -- Empty if there was no data to archive at this revision
+  SegmentName          VARCHAR(1024) NOT NULL,
+  PRIMARY KEY(TreeId, MapRevision),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+-- Pruned map revisions which have been temporarily restored from archive and
+-- can be read until they expire.
+CREATE TABLE IF NOT EXISTS RestoredRevision(
+  TreeId               INTEGER NOT NULL,
+  MapRevision          BIGINT NOT NULL,
+  ExpiresTimestamp     BIGINT NOT NULL,
+  PRIMARY KEY(TreeId, MapRevision),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+-- ---------------------------------------------
+-- Routing stuff here
+-- ---------------------------------------------
+
+-- Assigns trees to the named storage backend that holds their data, where
+-- servers are configured with more than one database. Backend names are mapped
+-- to databases by server configuration. Trees without a row are held in the
+-- database containing this table. There's no foreign key as the tree is usually
+-- in another database.
+CREATE TABLE IF NOT EXISTS TreeRoute(
+  TreeId               INTEGER NOT NULL,
+  Backend              VARCHAR(64) NOT NULL,
+  PRIMARY KEY(TreeId)
+);
+
+-- ---------------------------------------------
+-- Quota stuff here
+-- ---------------------------------------------
+
+-- Limits on the tokens charged to requests. A TREE limit with a TreeId of zero,
+-- or a USER limit with an empty QuotaUser, is the default for every tree or
+-- user without a limit of their own. There's no foreign key as limits can be
+-- set for trees held in other databases.
+CREATE TABLE IF NOT EXISTS QuotaLimit(
+  QuotaGroup           ENUM('GLOBAL', 'TREE', 'USER') NOT NULL,
+  QuotaKind            ENUM('READ', 'WRITE') NOT NULL,
+  TreeId               INTEGER NOT NULL,
+  QuotaUser            VARCHAR(255) NOT NULL,
+  TokensPerSecond      DOUBLE NOT NULL,
+  Burst                BIGINT NOT NULL,
+  PRIMARY KEY(QuotaGroup, QuotaKind, TreeId, QuotaUser)
+);
@@ -4,24 +4,32 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"reflect"
 	"runtime/debug"
-	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/golang/glog"
 	"github.com/golang/protobuf/proto"
 	"github.com/google/trillian"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/monitoring"
 	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/archive"
+	"github.com/google/trillian/storage/cache"
 )
 
 // TODO(al): add checking to all the Commit() calls in here.
 
-var allTables = []string{"Unsequenced", "TreeHead", "SequencedLeafData", "LeafData", "Subtree", "TreeControl", "Trees", "MapLeaf", "MapHead"}
+var allTables = []string{"Unsequenced", "TreeHead", "SequencedLeafData", "StagedLeafData", "LeafData", "Subtree", "TreeControl", "TreeKey", "Trees", "MapLeaf", "MapHead", "MapStagedHead", "AbandonedMapHead", "AbandonedMapLeaf", "AbandonedSubtree", "AbandonedMapRevisionTag", "MapHeadRevert", "MapRevisionTag", "TreeRetention", "ArchivedRevision", "RestoredRevision", "TreeRoute", "QuotaLimit"}
 
 // Must be 32 bytes to match sha256 length if it was a real hash
 var dummyHash = []byte("hashxxxxhashxxxxhashxxxxhashxxxx")
@@ -226,6 +234,99 @@ func TestNodeRoundTrip(t *testing.T) {
 	}
 }
 
+func TestGetStoredSubtree(t *testing.T) {
+	logID := createLogID("TestGetStoredSubtree")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	s := prepareTestLogStorage(logID, t)
+
+	nodesToStore := createSomeNodes("TestGetStoredSubtree", logID.logID.TreeID)
+	nodeIDs := make([]storage.NodeID, len(nodesToStore))
+	for i := range nodesToStore {
+		nodeIDs[i] = nodesToStore[i].NodeID
+	}
+
+	tx := beginLogTx(s, t)
+	forceWriteRevision(100, tx)
+	if _, err := tx.GetMerkleNodes(99, nodeIDs); err != nil {
+		t.Fatalf("Failed to read nodes: %s", err)
+	}
+	if err := tx.SetMerkleNodes(nodesToStore); err != nil {
+		t.Fatalf("Failed to store nodes: %s", err)
+	}
+	commit(tx, t)
+
+	tx = beginLogTx(s, t)
+	defer commit(tx, t)
+	inspector, ok := tx.(storage.SubtreeInspector)
+	if !ok {
+		t.Fatalf("%T doesn't implement SubtreeInspector", tx)
+	}
+
+	subtree, err := inspector.GetStoredSubtree(100, storage.NewEmptyNodeID(8))
+	if err != nil {
+		t.Fatalf("GetStoredSubtree() = %v", err)
+	}
+	if subtree == nil || len(subtree.Leaves) != len(nodesToStore) {
+		t.Errorf("GetStoredSubtree() = %v, want a subtree holding %d leaves", subtree, len(nodesToStore))
+	}
+
+	subtree, err = inspector.GetStoredSubtree(99, storage.NewEmptyNodeID(8))
+	if err != nil || subtree != nil {
+		t.Errorf("GetStoredSubtree() before the nodes were stored = %v, %v, want nil, nil", subtree, err)
+	}
+}
+
+func TestSubtreeCacheSharedBetweenTransactions(t *testing.T) {
+	logID := createLogID("TestSubtreeCacheSharedBetweenTransactions")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	subtrees := cache.NewStoredSubtreeCache(1 << 20)
+	s, err := NewLogStorageWithOptions(logID.logID, "test:zaphod@tcp(127.0.0.1:3306)/test", Options{SubtreeCache: subtrees})
+	if err != nil {
+		t.Fatalf("Failed to open log storage: %s", err)
+	}
+
+	nodesToStore := createSomeNodes("TestSubtreeCacheSharedBetweenTransactions", logID.logID.TreeID)
+	nodeIDs := make([]storage.NodeID, len(nodesToStore))
+	for i := range nodesToStore {
+		nodeIDs[i] = nodesToStore[i].NodeID
+	}
+
+	tx := beginLogTx(s, t)
+	forceWriteRevision(100, tx)
+	if _, err := tx.GetMerkleNodes(99, nodeIDs); err != nil {
+		t.Fatalf("Failed to read nodes: %s", err)
+	}
+	if err := tx.SetMerkleNodes(nodesToStore); err != nil {
+		t.Fatalf("Failed to store nodes: %s", err)
+	}
+	// Reads at the write revision aren't cached
+	if _, err := tx.GetMerkleNodes(100, nodeIDs); err != nil {
+		t.Fatalf("Failed to read nodes: %s", err)
+	}
+	commit(tx, t)
+	missesBefore := subtrees.Stats().Misses
+
+	// Each transaction reads the nodes, but only the first goes to the database
+	for i := 0; i < 2; i++ {
+		tx := beginLogTx(s, t)
+		readNodes, err := tx.GetMerkleNodes(100, nodeIDs)
+		if err != nil {
+			t.Fatalf("Failed to read nodes: %s", err)
+		}
+		if err := nodesAreEqual(readNodes, nodesToStore); err != nil {
+			t.Fatalf("Read back different nodes from the ones stored: %s", err)
+		}
+		commit(tx, t)
+	}
+
+	stats := subtrees.Stats()
+	if stats.Entries == 0 || stats.Hits != stats.Misses-missesBefore {
+		t.Errorf("Got subtree cache stats %+v with %d misses before reading, want a hit for each subtree missed", stats, missesBefore)
+	}
+}
+
 // Explicit test for node id conversion to / from protos.
 func TestNodeIDSerialization(t *testing.T) {
 	nodeID := storage.NodeID{[]byte("hello"), 3, 40}
@@ -248,8 +349,8 @@ func TestNodeIDSerialization(t *testing.T) {
 	}
 }
 
-func TestQueueDuplicateLeafFails(t *testing.T) {
-	logID := createLogID("TestQueueDuplicateLeafFails")
+func TestQueueDuplicateLeaves(t *testing.T) {
+	logID := createLogID("TestQueueDuplicateLeaves")
 	db := prepareTestLogDB(logID, t)
 	defer db.Close()
 	s := prepareTestLogStorage(logID, t)
@@ -258,17 +359,55 @@ func TestQueueDuplicateLeafFails(t *testing.T) {
 
 	leaves := createTestLeaves(5, 10)
 
-	if err := tx.QueueLeaves(leaves); err != nil {
+	if existing, err := tx.QueueLeaves(leaves); err != nil {
+		t.Fatalf("Failed to queue leaves: %v", err)
+	} else if len(existing) != len(leaves) {
+		t.Fatalf("Got %d results for %d leaves", len(existing), len(leaves))
+	}
+
+	// The first two of these are queued already
+	leaves2 := createTestLeaves(8, 10)[3:]
+
+	existing, err := tx.QueueLeaves(leaves2)
+	if err != nil {
 		t.Fatalf("Failed to queue leaves: %v", err)
 	}
+	for i, leaf := range existing {
+		if got, want := leaf != nil, i < 2; got != want {
+			t.Errorf("Leaf %d: got duplicate %v, want %v", i, got, want)
+			continue
+		}
+		if leaf != nil && (!bytes.Equal(leaf.LeafHash, leaves2[i].LeafHash) || leaf.SequenceNumber != -1) {
+			t.Errorf("Leaf %d: got existing leaf %v, want queued leaf with hash %x", i, leaf, leaves2[i].LeafHash)
+		}
+	}
+}
+
+func TestQueueLeavesRecomputesHashes(t *testing.T) {
+	logID := createLogID("TestQueueLeavesRecomputesHashes")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	s := prepareTestLogStorage(logID, t)
+	tx := beginLogTx(s, t)
+	defer tx.Commit()
 
-	leaves2 := createTestLeaves(5, 12)
+	leaves := createTestLeaves(2, 10)
+	// The supplied hashes are ignored, so neither of these hides the other
+	forged := []trillian.LogLeaf{leaves[0], leaves[1]}
+	forged[0].LeafHash = leaves[1].LeafHash
+	forged[1].LeafHash = dummyHash
 
-	if err := tx.QueueLeaves(leaves2); err == nil {
-		t.Fatal("Allowed duplicate leaves to be inserted")
+	if _, err := tx.QueueLeaves(forged); err != nil {
+		t.Fatalf("Failed to queue leaves: %v", err)
+	}
 
-		if !strings.Contains(err.Error(), "Duplicate") {
-			t.Fatalf("Got the wrong type of error: %v", err)
+	existing, err := tx.QueueLeaves(leaves)
+	if err != nil {
+		t.Fatalf("Failed to queue leaves: %v", err)
+	}
+	for i, leaf := range existing {
+		if leaf == nil || !bytes.Equal(leaf.LeafHash, leaves[i].LeafHash) || !bytes.Equal(leaf.LeafValue, leaves[i].LeafValue) {
+			t.Errorf("Leaf %d: got existing leaf %v, want queued leaf with hash %x", i, leaf, leaves[i].LeafHash)
 		}
 	}
 }
@@ -283,7 +422,7 @@ func TestQueueLeaves(t *testing.T) {
 
 	leaves := createTestLeaves(leavesToInsert, 20)
 
-	if err := tx.QueueLeaves(leaves); err != nil {
+	if _, err := tx.QueueLeaves(leaves); err != nil {
 		t.Fatalf("Failed to queue leaves: %v", err)
 	}
 
@@ -310,7 +449,7 @@ func TestDequeueLeavesNoneQueued(t *testing.T) {
 	tx := beginLogTx(s, t)
 	defer tx.Commit()
 
-	leaves, err := tx.DequeueLeaves(999)
+	leaves, err := tx.DequeueLeaves(999, 0)
 
 	if err != nil {
 		t.Fatalf("Didn't expect an error on dequeue with no work to be done: %v", err)
@@ -333,7 +472,7 @@ func TestDequeueLeaves(t *testing.T) {
 
 		leaves := createTestLeaves(leavesToInsert, 20)
 
-		if err := tx.QueueLeaves(leaves); err != nil {
+		if _, err := tx.QueueLeaves(leaves); err != nil {
 			t.Fatalf("Failed to queue leaves: %v", err)
 		}
 
@@ -344,7 +483,7 @@ func TestDequeueLeaves(t *testing.T) {
 		// Now try to dequeue them
 		tx2 := beginLogTx(s, t)
 		defer failIfTXStillOpen(t, "TestDequeLeaves", tx2)
-		leaves2, err := tx2.DequeueLeaves(99)
+		leaves2, err := tx2.DequeueLeaves(99, 0)
 
 		if err != nil {
 			t.Fatalf("Failed to dequeue leaves: %v", err)
@@ -364,7 +503,7 @@ func TestDequeueLeaves(t *testing.T) {
 		tx3 := beginLogTx(s, t)
 		defer tx3.Rollback()
 
-		leaves3, err := tx3.DequeueLeaves(99)
+		leaves3, err := tx3.DequeueLeaves(99, 0)
 
 		if err != nil {
 			t.Fatalf("Failed to dequeue leaves (second time): %v", err)
@@ -376,6 +515,66 @@ func TestDequeueLeaves(t *testing.T) {
 	}
 }
 
+func TestDequeueLeavesGuardWindow(t *testing.T) {
+	logID := createLogID("TestDequeueLeavesGuardWindow")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+
+	// Leaves must be queued for an hour before they're dequeued
+	if _, err := db.Exec("INSERT INTO TreeControl(TreeId, SequenceGuardSeconds) VALUES(?, 3600)", logID.logID.TreeID); err != nil {
+		t.Fatalf("Failed to set guard window: %v", err)
+	}
+	s := prepareTestLogStorage(logID, t)
+
+	{
+		tx := beginLogTx(s, t)
+		defer failIfTXStillOpen(t, "TestDequeueLeavesGuardWindow", tx)
+
+		if _, err := tx.QueueLeaves(createTestLeaves(leavesToInsert, 20)); err != nil {
+			t.Fatalf("Failed to queue leaves: %v", err)
+		}
+
+		commit(tx, t)
+	}
+
+	{
+		tx2 := beginLogTx(s, t)
+		defer tx2.Rollback()
+
+		leaves, err := tx2.DequeueLeaves(99, s.SequenceGuard())
+		if err != nil {
+			t.Fatalf("Failed to dequeue leaves: %v", err)
+		}
+		if len(leaves) != 0 {
+			t.Fatalf("Dequeued %d leaves inside the guard window, expected none", len(leaves))
+		}
+	}
+
+	// Once the guard is removed the leaves can be dequeued
+	if _, err := db.Exec("UPDATE TreeControl SET SequenceGuardSeconds=0 WHERE TreeId=?", logID.logID.TreeID); err != nil {
+		t.Fatalf("Failed to clear guard window: %v", err)
+	}
+	s = prepareTestLogStorage(logID, t)
+
+	{
+		tx3 := beginLogTx(s, t)
+		defer tx3.Rollback()
+
+		leaves, err := tx3.DequeueLeaves(99, s.SequenceGuard())
+		if err != nil {
+			t.Fatalf("Failed to dequeue leaves: %v", err)
+		}
+		if len(leaves) != leavesToInsert {
+			t.Fatalf("Dequeued %d leaves but expected to get %d", len(leaves), leavesToInsert)
+		}
+		for _, leaf := range leaves {
+			if age := time.Since(time.Unix(0, leaf.QueueTimestampNanos)); age < -time.Minute || age > time.Minute {
+				t.Errorf("Dequeued a leaf queued %v ago", age)
+			}
+		}
+	}
+}
+
 func TestDequeueLeavesTwoBatches(t *testing.T) {
 	logID := createLogID("TestDequeueLeavesTwoBatches")
 	db := prepareTestLogDB(logID, t)
@@ -391,7 +590,7 @@ func TestDequeueLeavesTwoBatches(t *testing.T) {
 
 		leaves := createTestLeaves(leavesToInsert, 20)
 
-		if err := tx.QueueLeaves(leaves); err != nil {
+		if _, err := tx.QueueLeaves(leaves); err != nil {
 			t.Fatalf("Failed to queue leaves: %v", err)
 		}
 
@@ -402,7 +601,7 @@ func TestDequeueLeavesTwoBatches(t *testing.T) {
 		// Now try to dequeue some of them
 		tx2 := beginLogTx(s, t)
 		defer failIfTXStillOpen(t, "TestDequeueLeavesTwoBatches-tx2", tx2)
-		leaves2, err := tx2.DequeueLeaves(leavesToDequeue1)
+		leaves2, err := tx2.DequeueLeaves(leavesToDequeue1, 0)
 
 		if err != nil {
 			t.Fatalf("Failed to dequeue leaves: %v", err)
@@ -419,7 +618,7 @@ func TestDequeueLeavesTwoBatches(t *testing.T) {
 		// Now try to dequeue the rest of them
 		tx3 := beginLogTx(s, t)
 		defer failIfTXStillOpen(t, "TestDequeueLeavesTwoBatches-tx3", tx3)
-		leaves3, err := tx3.DequeueLeaves(leavesToDequeue2)
+		leaves3, err := tx3.DequeueLeaves(leavesToDequeue2, 0)
 
 		if err != nil {
 			t.Fatalf("Failed to dequeue leaves: %v", err)
@@ -443,7 +642,7 @@ func TestDequeueLeavesTwoBatches(t *testing.T) {
 		tx4 := beginLogTx(s, t)
 		defer failIfTXStillOpen(t, "TestDequeueLeavesTwoBatches-tx4", tx4)
 
-		leaves5, err := tx4.DequeueLeaves(99)
+		leaves5, err := tx4.DequeueLeaves(99, 0)
 
 		if err != nil {
 			t.Fatalf("Failed to dequeue leaves (second time): %v", err)
@@ -542,6 +741,153 @@ func TestGetLeavesByIndex(t *testing.T) {
 	checkLeafContents(leaves[0], sequenceNumber, dummyHash, data, t)
 }
 
+func TestGetLeavesByRange(t *testing.T) {
+	// Create fake leaves as if they had been sequenced
+	logID := createLogID("TestGetLeavesByRange")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+
+	hashes := [][]byte{dummyHash, dummyHash2, dummyHash3}
+	for i, hash := range hashes {
+		createFakeLeaf(db, logID.logID, hash, []byte(fmt.Sprintf("data%d", i)), int64(i), t)
+	}
+
+	s := prepareTestLogStorage(logID, t)
+	tx := beginLogTx(s, t)
+	defer tx.Commit()
+
+	// The range stops at the end of the log
+	leaves, err := tx.GetLeavesByRange(1, 5)
+
+	if err != nil {
+		t.Fatalf("Unexpected error getting leaves by range: %v", err)
+	}
+
+	if len(leaves) != 2 {
+		t.Fatalf("Got %d leaves but expected two", len(leaves))
+	}
+
+	for i, leaf := range leaves {
+		checkLeafContents(leaf, int64(i+1), hashes[i+1], []byte(fmt.Sprintf("data%d", i+1)), t)
+	}
+}
+
+func TestGetLeavesByRangeMixedCompression(t *testing.T) {
+	// A leaf written before the log's data was compressed
+	logID := createLogID("TestGetLeavesByRangeMixedCompression")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	createFakeLeaf(db, logID.logID, dummyHash, []byte("data0"), 0, t)
+
+	if _, err := db.Exec("INSERT INTO TreeControl(TreeId, LeafCompression) VALUES(?, ?)", logID.logID.TreeID, int(storage.SnappyCompression)); err != nil {
+		t.Fatalf("Failed to set leaf compression: %v", err)
+	}
+	s := prepareTestLogStorage(logID, t)
+	tx := beginLogTx(s, t)
+	addAndIntegrateLeaves(tx, 1, []trillian.LogLeaf{{Leaf: trillian.Leaf{LeafHash: dummyHash2, LeafValue: []byte("data1")}, SequenceNumber: 1}}, t)
+	commit(tx, t)
+
+	var format int
+	if err := db.QueryRow("SELECT DataFormat FROM LeafData WHERE TreeId=? AND LeafHash=?", logID.logID.TreeID, dummyHash2).Scan(&format); err != nil {
+		t.Fatalf("Failed to read data format: %v", err)
+	}
+	if got, want := storage.LeafCompression(format), storage.SnappyCompression; got != want {
+		t.Errorf("Leaf written with compression %v, want %v", got, want)
+	}
+
+	tx = beginLogTx(s, t)
+	defer tx.Commit()
+	leaves, err := tx.GetLeavesByRange(0, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error getting leaves by range: %v", err)
+	}
+	if len(leaves) != 2 {
+		t.Fatalf("Got %d leaves but expected two", len(leaves))
+	}
+	for i, hash := range [][]byte{dummyHash, dummyHash2} {
+		checkLeafContents(leaves[i], int64(i), hash, []byte(fmt.Sprintf("data%d", i)), t)
+	}
+}
+
+func TestGetLeavesByRangeExternalLeafData(t *testing.T) {
+	logID := createLogID("TestGetLeavesByRangeExternalLeafData")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+
+	dir, err := ioutil.TempDir("", "leafdata")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := archive.NewDirectoryObjectStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to create leaf data store: %v", err)
+	}
+	s, err := NewLogStorageWithOptions(logID.logID, "test:zaphod@tcp(127.0.0.1:3306)/test", Options{LeafDataStore: store, ExternalLeafDataBytes: 5})
+	if err != nil {
+		t.Fatalf("Failed to open log storage: %v", err)
+	}
+
+	// Only the longer leaf is held in the store
+	tx := beginLogTx(s, t)
+	data := [][]byte{[]byte("data0"), []byte("longer data1")}
+	leaves := []trillian.LogLeaf{
+		{Leaf: trillian.Leaf{LeafHash: dummyHash, LeafValue: data[0]}, SequenceNumber: 0},
+		{Leaf: trillian.Leaf{LeafHash: dummyHash2, LeafValue: data[1]}, SequenceNumber: 1},
+	}
+	addAndIntegrateLeaves(tx, 0, leaves, t)
+	commit(tx, t)
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 1 {
+		t.Errorf("Leaf data store holds %v, %v, want one leaf", files, err)
+	}
+	// The format has the top bit of the byte set for external data
+	var format int
+	if err := db.QueryRow("SELECT DataFormat FROM LeafData WHERE TreeId=? AND LeafHash=?", logID.logID.TreeID, dummyHash2).Scan(&format); err != nil {
+		t.Fatalf("Failed to read data format: %v", err)
+	}
+	if format&0x80 == 0 {
+		t.Errorf("Externally held leaf has data format %#x, want 0x80 set", format)
+	}
+
+	tx = beginLogTx(s, t)
+	defer tx.Commit()
+	got, err := tx.GetLeavesByRange(0, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error getting leaves by range: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Got %d leaves but expected two", len(got))
+	}
+	for i, leaf := range leaves {
+		checkLeafContents(got[i], int64(i), leaf.LeafHash, data[i], t)
+	}
+}
+
+// addAndIntegrateLeaves adds leaves to a pre-ordered log from index start, and
+// integrates them as the sequencer would.
+func addAndIntegrateLeaves(tx storage.LogTX, start int64, leaves []trillian.LogLeaf, t *testing.T) {
+	if _, err := tx.AddSequencedLeaves(leaves); err != nil {
+		t.Fatalf("Failed to add leaves: %v", err)
+	}
+	// Nothing can be read until the leaves are integrated
+	if got, err := tx.GetLeavesByRange(start, int64(len(leaves))); err != nil || len(got) != 0 {
+		t.Fatalf("GetLeavesByRange() before integration=%v, %v, want no leaves", got, err)
+	}
+	added, err := tx.DequeueSequencedLeaves(start, len(leaves))
+	if err != nil {
+		t.Fatalf("Failed to dequeue added leaves: %v", err)
+	}
+	if len(added) != len(leaves) {
+		t.Fatalf("Dequeued %d added leaves, want %d", len(added), len(leaves))
+	}
+	for i := range added {
+		added[i].IntegrateTimestampNanos = int64(i + 1)
+	}
+	if err := tx.UpdateSequencedLeaves(added); err != nil {
+		t.Fatalf("Failed to integrate leaves: %v", err)
+	}
+}
+
 func openTestDBOrDie() *sql.DB {
 	db, err := sql.Open("mysql", "test:zaphod@tcp(127.0.0.1:3306)/test")
 	if err != nil {
@@ -604,6 +950,78 @@ func TestLatestSignedLogRoot(t *testing.T) {
 	}
 }
 
+func TestLatestSignedLogRootEarlierTimestamp(t *testing.T) {
+	logID := createLogID("TestLatestSignedLogRootEarlierTimestamp")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	s := prepareTestLogStorage(logID, t)
+
+	// Roots may go back in time within the sequencer's max clock skew
+	roots := []trillian.SignedLogRoot{
+		{LogId: logID.logID.LogID, TimestampNanos: 98765, TreeSize: 16, TreeRevision: 5, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}},
+		{LogId: logID.logID.LogID, TimestampNanos: 98000, TreeSize: 17, TreeRevision: 6, RootHash: []byte(dummyHash2), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}},
+	}
+	for _, root := range roots {
+		tx := beginLogTx(s, t)
+		if err := tx.StoreSignedLogRoot(root); err != nil {
+			t.Fatalf("Failed to store signed root: %v", err)
+		}
+		commit(tx, t)
+	}
+
+	tx := beginLogTx(s, t)
+	defer tx.Rollback()
+	root, err := tx.LatestSignedLogRoot()
+	if err != nil {
+		t.Fatalf("Failed to read back latest log root: %v", err)
+	}
+	if !proto.Equal(&root, &roots[1]) {
+		t.Fatalf("LatestSignedLogRoot() = %v, want %v", root, roots[1])
+	}
+	if got, want := tx.WriteRevision(), int64(7); got != want {
+		t.Errorf("WriteRevision() = %d, want %d", got, want)
+	}
+}
+
+func TestLogRootCosignatures(t *testing.T) {
+	logID := createLogID("TestLogRootCosignatures")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	s := prepareTestLogStorage(logID, t)
+	tx := beginLogTx(s, t)
+	defer tx.Rollback()
+
+	w1 := trillian.Cosignature{WitnessId: "w1", Signature: &trillian.DigitallySigned{Signature: []byte("w1")}}
+	w2 := trillian.Cosignature{WitnessId: "w2", Signature: &trillian.DigitallySigned{Signature: []byte("w2")}}
+	// Storing a witness's signature again replaces it
+	for _, c := range []trillian.Cosignature{w2, {WitnessId: "w1", Signature: &trillian.DigitallySigned{Signature: []byte("old")}}, w1} {
+		if err := tx.StoreLogRootCosignature(5, c); err != nil {
+			t.Fatalf("Failed to store cosignature: %v", err)
+		}
+	}
+	if err := tx.StoreLogRootCosignature(6, w1); err != nil {
+		t.Fatalf("Failed to store cosignature: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit cosignatures: %v", err)
+	}
+
+	{
+		tx2 := beginLogTx(s, t)
+		defer tx2.Rollback()
+		cosigs, err := tx2.GetLogRootCosignatures(5)
+
+		if err != nil {
+			t.Fatalf("Failed to read back cosignatures: %v", err)
+		}
+
+		if len(cosigs) != 2 || !proto.Equal(&cosigs[0], &w1) || !proto.Equal(&cosigs[1], &w2) {
+			t.Fatalf("Got cosignatures %v, want %v and %v", cosigs, w1, w2)
+		}
+	}
+}
+
 func TestGetTreeRevisionAtNonExistentSizeError(t *testing.T) {
 	// Have to set all this up though we won't actually write anything
 	logID := createLogID("TestGetTreeRevisionAtSize")
@@ -800,6 +1218,34 @@ func TestLatestSignedMapRootNoneWritten(t *testing.T) {
 	}
 }
 
+func TestStatementCacheMetrics(t *testing.T) {
+	mapID := createMapID("TestStatementCacheMetrics")
+	db := prepareTestMapDB(mapID, t)
+	defer db.Close()
+	metrics := NewStatementCacheMetrics(monitoring.InertMetricFactory{})
+	s, err := NewMapStorageWithOptions(mapID.mapID, "test:zaphod@tcp(127.0.0.1:3306)/test", Options{StatementCacheMetrics: metrics})
+	if err != nil {
+		t.Fatalf("Failed to open map storage: %s", err)
+	}
+
+	// The statement is prepared by the first transaction and reused by the second
+	for i := 0; i < 2; i++ {
+		tx := beginMapTx(s, t)
+		if _, err := tx.LatestSignedMapRoot(); err != nil {
+			t.Fatalf("Failed to read map root: %v", err)
+		}
+		tx.Rollback()
+	}
+
+	const name = "SELECT MapHead"
+	if got, want := metrics.misses.Value(name), 1.0; got != want {
+		t.Errorf("Got %v cache misses for %s, want %v", got, name, want)
+	}
+	if got := metrics.hits.Value(name); got < 1 {
+		t.Errorf("Got %v cache hits for %s, want at least 1", got, name)
+	}
+}
+
 func TestLatestSignedMapRoot(t *testing.T) {
 	mapID := createMapID("TestLatestSignedMapRoot")
 	db := prepareTestMapDB(mapID, t)
@@ -834,19 +1280,54 @@ func TestLatestSignedMapRoot(t *testing.T) {
 	}
 }
 
-func TestDuplicateSignedMapRoot(t *testing.T) {
-	mapID := createMapID("TestDuplicateSignedMapRoot")
+func TestLatestSignedMapRootEarlierTimestamp(t *testing.T) {
+	mapID := createMapID("TestLatestSignedMapRootEarlierTimestamp")
 	db := prepareTestMapDB(mapID, t)
 	defer db.Close()
 	s := prepareTestMapStorage(mapID, t)
-	tx := beginMapTx(s, t)
-	defer tx.Commit()
-
-	// TODO: Tidy up the map id as it looks silly chained 3 times like this
-	root := trillian.SignedMapRoot{MapId: mapID.mapID.MapID, TimestampNanos: 98765, MapRevision: 5, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}}
 
-	if err := tx.StoreSignedMapRoot(root); err != nil {
-		t.Fatalf("Failed to store signed map root: %v", err)
+	// Roots may go back in time within the map server's max clock skew
+	roots := []trillian.SignedMapRoot{
+		{MapId: mapID.mapID.MapID, TimestampNanos: 98765, MapRevision: 5, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}},
+		{MapId: mapID.mapID.MapID, TimestampNanos: 98000, MapRevision: 6, RootHash: []byte(dummyHash2), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}},
+	}
+	for _, root := range roots {
+		tx := beginMapTx(s, t)
+		if err := tx.StoreSignedMapRoot(root); err != nil {
+			t.Fatalf("Failed to store signed root: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit new map root: %v", err)
+		}
+	}
+
+	tx := beginMapTx(s, t)
+	defer tx.Rollback()
+	root, err := tx.LatestSignedMapRoot()
+	if err != nil {
+		t.Fatalf("Failed to read back latest map root: %v", err)
+	}
+	if !proto.Equal(&root, &roots[1]) {
+		t.Fatalf("LatestSignedMapRoot() = %v, want %v", root, roots[1])
+	}
+	if got, want := tx.WriteRevision(), int64(7); got != want {
+		t.Errorf("WriteRevision() = %d, want %d", got, want)
+	}
+}
+
+func TestDuplicateSignedMapRoot(t *testing.T) {
+	mapID := createMapID("TestDuplicateSignedMapRoot")
+	db := prepareTestMapDB(mapID, t)
+	defer db.Close()
+	s := prepareTestMapStorage(mapID, t)
+	tx := beginMapTx(s, t)
+	defer tx.Commit()
+
+	// TODO: Tidy up the map id as it looks silly chained 3 times like this
+	root := trillian.SignedMapRoot{MapId: mapID.mapID.MapID, TimestampNanos: 98765, MapRevision: 5, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}}
+
+	if err := tx.StoreSignedMapRoot(root); err != nil {
+		t.Fatalf("Failed to store signed map root: %v", err)
 	}
 
 	// Shouldn't be able to do it again
@@ -894,6 +1375,42 @@ func TestMapRootUpdate(t *testing.T) {
 	}
 }
 
+func TestGetSignedMapRoot(t *testing.T) {
+	mapID := createMapID("TestGetSignedMapRoot")
+	db := prepareTestMapDB(mapID, t)
+	defer db.Close()
+	s := prepareTestMapStorage(mapID, t)
+	tx := beginMapTx(s, t)
+	defer tx.Commit()
+
+	var roots []trillian.SignedMapRoot
+	for rev := int64(5); rev <= 6; rev++ {
+		root := trillian.SignedMapRoot{MapId: mapID.mapID.MapID, TimestampNanos: 98760 + rev, MapRevision: rev, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}}
+		if err := tx.StoreSignedMapRoot(root); err != nil {
+			t.Fatalf("Failed to store signed map root: %v", err)
+		}
+		roots = append(roots, root)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit new map roots: %v", err)
+	}
+
+	tx = beginMapTx(s, t)
+	// Reading an earlier revision should give its root, not the latest one
+	root, err := tx.GetSignedMapRoot(5)
+	if err != nil {
+		t.Fatalf("Failed to read map root at revision 5: %v", err)
+	}
+	if !proto.Equal(&roots[0], &root) {
+		t.Fatalf("Root round trip failed: <%v> and: <%v>", roots[0], root)
+	}
+
+	if _, err := tx.GetSignedMapRoot(7); err != storage.ErrMapRootNotFound {
+		t.Fatalf("Expected ErrMapRootNotFound for unpublished revision but got: %v", err)
+	}
+}
+
 var keyHash = trillian.Hash([]byte("A Key Hash"))
 var mapLeaf = trillian.MapLeaf{
 	KeyHash:   keyHash,
@@ -1048,129 +1565,1451 @@ func TestMapSetGetMultipleRevisions(t *testing.T) {
 	}
 }
 
-func TestGetActiveLogIDs(t *testing.T) {
-	// Have to wipe everything to ensure we start with zero log trees configured
+func TestMapGetChangedLeaves(t *testing.T) {
 	cleanTestDB()
 
-	// This creates one tree
-	logID := createLogID("TestGetActiveLogIDs")
-	db := prepareTestLogDB(logID, t)
+	mapID := createMapID("TestMapGetChangedLeaves")
+	db := prepareTestMapDB(mapID, t)
 	defer db.Close()
+	s := prepareTestMapStorage(mapID, t)
 
-	s := prepareTestLogStorage(logID, t)
-	tx := beginLogTx(s, t)
-
-	logIDs, err := tx.GetActiveLogIDs()
+	keyHashes := []trillian.Hash{[]byte("key 1"), []byte("key 2"), []byte("key 3")}
+	// Revision 0 sets all the keys, revision 1 changes the first and clears the last
+	revisions := [][]trillian.MapLeaf{
+		{
+			{KeyHash: keyHashes[0], LeafValue: []byte("value 1")},
+			{KeyHash: keyHashes[1], LeafValue: []byte("value 2")},
+			{KeyHash: keyHashes[2], LeafValue: []byte("value 3")},
+		},
+		{
+			{KeyHash: keyHashes[2]},
+			{KeyHash: keyHashes[0], LeafValue: []byte("new value 1")},
+		},
+	}
+	for i, leaves := range revisions {
+		tx := beginMapTx(s, t)
+		tx.(*mapTX).treeTX.writeRevision = int64(i)
+		for _, leaf := range leaves {
+			if err := tx.Set(leaf.KeyHash, leaf); err != nil {
+				t.Fatalf("Failed to set %v: %v", leaf.KeyHash, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+	}
 
+	tx := beginMapTx(s, t)
+	defer tx.Commit()
+	changed, err := tx.GetChangedLeaves(1)
 	if err != nil {
-		t.Fatalf("Failed to get log ids: %v", err)
+		t.Fatalf("Failed to get changed leaves: %v", err)
+	}
+	want := []trillian.MapLeaf{revisions[1][1], revisions[1][0]}
+	if got, want := len(changed), len(want); got != want {
+		t.Fatalf("Got %d changed leaves, want %d", got, want)
+	}
+	for i := range want {
+		if got, want := &changed[i], &want[i]; !proto.Equal(got, want) {
+			t.Errorf("Got changed leaf %v, want %v", got, want)
+		}
 	}
+}
 
-	if got, want := len(logIDs), 1; got != want {
-		t.Fatalf("Got %d logID(s), wanted %d", got, want)
+func TestMapListLeaves(t *testing.T) {
+	cleanTestDB()
+
+	mapID := createMapID("TestMapListLeaves")
+	db := prepareTestMapDB(mapID, t)
+	defer db.Close()
+	s := prepareTestMapStorage(mapID, t)
+
+	keyHashes := []trillian.Hash{[]byte("key 1"), []byte("key 2"), []byte("key 3")}
+	// Revision 0 sets the first two keys, revision 2 changes the first and sets
+	// the last
+	revisions := map[int64][]trillian.MapLeaf{
+		0: {
+			{KeyHash: keyHashes[0], LeafValue: []byte("value 1")},
+			{KeyHash: keyHashes[1], LeafValue: []byte("value 2")},
+		},
+		2: {
+			{KeyHash: keyHashes[2], LeafValue: []byte("value 3")},
+			{KeyHash: keyHashes[0], LeafValue: []byte("new value 1")},
+		},
+	}
+	for rev, leaves := range revisions {
+		tx := beginMapTx(s, t)
+		tx.(*mapTX).treeTX.writeRevision = rev
+		if err := tx.SetLeaves(leaves); err != nil {
+			t.Fatalf("Failed to set leaves: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+	}
+
+	tx := beginMapTx(s, t)
+	defer tx.Commit()
+	for _, test := range []struct {
+		revision int64
+		after    trillian.Hash
+		count    int
+		want     []trillian.MapLeaf
+	}{
+		{revision: 0, count: 10, want: revisions[0]},
+		{revision: 1, count: 10, want: revisions[0]},
+		{revision: 2, count: 10, want: []trillian.MapLeaf{revisions[2][1], revisions[0][1], revisions[2][0]}},
+		{revision: 2, count: 2, want: []trillian.MapLeaf{revisions[2][1], revisions[0][1]}},
+		{revision: 2, after: keyHashes[1], count: 2, want: []trillian.MapLeaf{revisions[2][0]}},
+		{revision: 2, after: keyHashes[2], count: 2},
+	} {
+		leaves, err := tx.ListLeaves(test.revision, test.after, test.count)
+		if err != nil {
+			t.Fatalf("ListLeaves(%d, %s, %d) failed: %v", test.revision, test.after, test.count, err)
+		}
+		if got, want := len(leaves), len(test.want); got != want {
+			t.Fatalf("ListLeaves(%d, %s, %d) returned %d leaves, want %d", test.revision, test.after, test.count, got, want)
+		}
+		for i := range test.want {
+			if got, want := &leaves[i], &test.want[i]; !proto.Equal(got, want) {
+				t.Errorf("ListLeaves(%d, %s, %d) returned leaf %v, want %v", test.revision, test.after, test.count, got, want)
+			}
+		}
 	}
 }
 
-func TestGetActiveLogIDsWithPendingWork(t *testing.T) {
-	// Have to wipe everything to ensure we start with zero log trees configured
+func TestMapStageAndPublish(t *testing.T) {
 	cleanTestDB()
-	logID := createLogID("TestGetActiveLogIDsWithPendingWork")
-	db := prepareTestLogDB(logID, t)
+
+	mapID := createMapID("TestMapStageAndPublish")
+	db := prepareTestMapDB(mapID, t)
 	defer db.Close()
+	s := prepareTestMapStorage(mapID, t)
 
-	s := prepareTestLogStorage(logID, t)
-	tx := beginLogTx(s, t)
+	staged := trillian.SignedMapRoot{MapId: mapID.mapID.MapID, TimestampNanos: 98765, MapRevision: 1, RootHash: []byte(dummyHash)}
 
-	logIDs, err := tx.GetActiveLogIDsWithPendingWork()
-	tx.Commit()
+	{
+		tx := beginMapTx(s, t)
 
-	if err != nil || len(logIDs) != 0 {
-		t.Fatalf("Should have had no logs with unsequenced work but got: %v %v", logIDs, err)
+		if err := tx.Set(keyHash, mapLeaf); err != nil {
+			t.Fatalf("Failed to set %v to %v: %v", keyHash, mapLeaf, err)
+		}
+		if err := tx.StageSignedMapRoot(staged); err != nil {
+			t.Fatalf("Failed to stage map root: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
 	}
 
 	{
-		tx := beginLogTx(s, t)
-		defer failIfTXStillOpen(t, "TestGetActiveLogIDsFiltered", tx)
+		tx := beginMapTx(s, t)
 
-		leaves := createTestLeaves(leavesToInsert, 2)
+		// Staged revision must not be visible as the latest root
+		root, err := tx.LatestSignedMapRoot()
+		if err != nil {
+			t.Fatalf("Failed to read latest map root: %v", err)
+		}
+		if root.MapRevision != 0 {
+			t.Fatalf("Staged revision was published: %v", root)
+		}
 
-		if err := tx.QueueLeaves(leaves); err != nil {
-			t.Fatalf("Failed to queue leaves: %v", err)
+		got, ok, err := tx.StagedSignedMapRoot()
+		if err != nil || !ok {
+			t.Fatalf("Failed to read staged map root: %v %v", ok, err)
+		}
+		if !proto.Equal(&got, &staged) {
+			t.Fatalf("Staged root round trip failed: <%v> and: <%v>", got, staged)
 		}
 
-		commit(tx, t)
+		published := staged
+		published.TimestampNanos++
+		published.Signature = &trillian.DigitallySigned{Signature: []byte("notempty")}
+		if err := tx.PublishStagedMapRoot(published); err != nil {
+			t.Fatalf("Failed to publish staged root: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+
+		tx = beginMapTx(s, t)
+		defer tx.Commit()
+		root, err = tx.LatestSignedMapRoot()
+		if err != nil {
+			t.Fatalf("Failed to read latest map root: %v", err)
+		}
+		if !proto.Equal(&root, &published) {
+			t.Fatalf("Published root round trip failed: <%v> and: <%v>", root, published)
+		}
+		if _, ok, err := tx.StagedSignedMapRoot(); err != nil || ok {
+			t.Fatalf("Expected no staged revision after publish: %v %v", ok, err)
+		}
 	}
+}
 
-	// We should now see the logID that we just created work for
-	tx = beginLogTx(s, t)
+func TestMapStageAndAbandon(t *testing.T) {
+	cleanTestDB()
 
-	logIDs, err = tx.GetActiveLogIDsWithPendingWork()
-	tx.Commit()
+	mapID := createMapID("TestMapStageAndAbandon")
+	db := prepareTestMapDB(mapID, t)
+	defer db.Close()
+	s := prepareTestMapStorage(mapID, t)
 
-	if err != nil || len(logIDs) != 1 {
-		t.Fatalf("Should have had one log with unsequenced work but got: %v", logIDs)
-	}
+	{
+		tx := beginMapTx(s, t)
 
-	expected, got := logID.logID.TreeID, logIDs[0].TreeID
-	if expected != got {
-		t.Fatalf("Expected to see tree ID: %d but got: %d", expected, got)
+		if err := tx.AbandonStagedMapRoot(); err != storage.ErrNoStagedRevision {
+			t.Fatalf("Expected ErrNoStagedRevision but got: %v", err)
+		}
+		if err := tx.Set(keyHash, mapLeaf); err != nil {
+			t.Fatalf("Failed to set %v to %v: %v", keyHash, mapLeaf, err)
+		}
+		if err := tx.StageSignedMapRoot(trillian.SignedMapRoot{MapRevision: 1, RootHash: []byte(dummyHash)}); err != nil {
+			t.Fatalf("Failed to stage map root: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
 	}
-}
 
-func TestGetSequencedLeafCount(t *testing.T) {
-	// We'll create leaves for two different trees
-	logID := createLogID("TestGetSequencedLeafCount")
-	logID2 := createLogID("TestGetSequencedLeafCount2")
+	{
+		tx := beginMapTx(s, t)
+
+		if err := tx.AbandonStagedMapRoot(); err != nil {
+			t.Fatalf("Failed to abandon staged root: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+	}
 
 	{
-		db := prepareTestLogDB(logID, t)
+		tx := beginMapTx(s, t)
+		defer tx.Commit()
 
-		// Create fake leaf as if it had been sequenced
-		defer db.Close()
+		readValues, err := tx.Get(1, []trillian.Hash{keyHash})
+		if err != nil {
+			t.Fatalf("Failed to get %v:  %v", keyHash, err)
+		}
+		if got, want := len(readValues), 0; got != want {
+			t.Fatalf("Got %d values from abandoned revision, expected %d", got, want)
+		}
 
-		data := []byte("some data")
+		// The revision can now be written again
+		if err := tx.Set(keyHash, mapLeaf); err != nil {
+			t.Fatalf("Failed to set %v to %v after abandon: %v", keyHash, mapLeaf, err)
+		}
+	}
+}
 
-		createFakeLeaf(db, logID.logID, dummyHash, data, sequenceNumber, t)
+func TestRevertMapHead(t *testing.T) {
+	cleanTestDB()
 
-		// Create fake leaves for second tree as if they had been sequenced
-		db2 := prepareTestLogDB(logID2, t)
-		defer db2.Close()
+	mapID := createMapID("TestRevertMapHead")
+	db := prepareTestMapDB(mapID, t)
+	defer db.Close()
+	s := prepareTestMapStorage(mapID, t)
 
-		data2 := []byte("some data 2")
-		data3 := []byte("some data 3")
+	// Write three revisions, each setting the same key
+	roots := make([]trillian.SignedMapRoot, 0, 3)
+	for rev := int64(1); rev <= 3; rev++ {
+		tx := beginMapTx(s, t)
+		if got := tx.WriteRevision(); got != rev {
+			t.Fatalf("Got write revision %d, want %d", got, rev)
+		}
+		leaf := mapLeaf
+		leaf.LeafValue = []byte(fmt.Sprintf("Value %d", rev))
+		if err := tx.Set(keyHash, leaf); err != nil {
+			t.Fatalf("Failed to set %v to %v: %v", keyHash, leaf, err)
+		}
+		root := trillian.SignedMapRoot{MapId: mapID.mapID.MapID, TimestampNanos: 1000 + rev, MapRevision: rev, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}}
+		if err := tx.StoreSignedMapRoot(root); err != nil {
+			t.Fatalf("Failed to store signed map root: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		roots = append(roots, root)
+	}
 
-		createFakeLeaf(db2, logID2.logID, dummyHash2, data2, sequenceNumber, t)
-		createFakeLeaf(db2, logID2.logID, dummyHash3, data3, sequenceNumber+1, t)
+	{
+		tx := beginMapTx(s, t)
+		if _, err := tx.RevertMapHead(3, "not earlier", 2000); err == nil {
+			t.Fatalf("Unexpectedly reverted to the latest revision")
+		}
+		// Tags on the abandoned revisions are removed, but recorded with the revert
+		if err := tx.TagMapRevision("kept", 1, 1500); err != nil {
+			t.Fatalf("Failed to tag revision 1: %v", err)
+		}
+		if err := tx.TagMapRevision("abandoned", 3, 1500); err != nil {
+			t.Fatalf("Failed to tag revision 3: %v", err)
+		}
+		revert, err := tx.RevertMapHead(1, "bad mapper", 2000)
+		if err != nil {
+			t.Fatalf("Failed to revert map head: %v", err)
+		}
+		if got, want := revert, (storage.MapHeadRevert{TimestampNanos: 2000, FromRevision: 3, ToRevision: 1, Reason: "bad mapper", AbandonedTags: map[string]int64{"abandoned": 3}}); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Got revert %v, want %v", got, want)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
 	}
 
-	// Read back the leaf counts from both trees
-	s := prepareTestLogStorage(logID, t)
-	tx := beginLogTx(s, t)
-	count1, err := tx.GetSequencedLeafCount()
-	tx.Commit()
+	{
+		tx := beginMapTx(s, t)
+		defer tx.Commit()
 
-	if err != nil {
-		t.Fatalf("unexpected error getting leaf count: %v", err)
-	}
+		root, err := tx.LatestSignedMapRoot()
+		if err != nil {
+			t.Fatalf("Failed to read back map root: %v", err)
+		}
+		if !proto.Equal(&root, &roots[0]) {
+			t.Fatalf("Got root <%v> after revert, want <%v>", root, roots[0])
+		}
+		// The abandoned revisions aren't written again
+		if got, want := tx.WriteRevision(), int64(4); got != want {
+			t.Fatalf("Got write revision %d after revert, want %d", got, want)
+		}
 
-	if want, got := int64(1), count1; want != got {
-		t.Fatalf("expected %d sequenced for logId but got %d", want, got)
-	}
+		readValues, err := tx.Get(3, []trillian.Hash{keyHash})
+		if err != nil {
+			t.Fatalf("Failed to get %v:  %v", keyHash, err)
+		}
+		if got, want := string(readValues[0].LeafValue), "Value 1"; got != want {
+			t.Fatalf("Got value %s after revert, want %s", got, want)
+		}
 
-	s = prepareTestLogStorage(logID2, t)
-	tx = beginLogTx(s, t)
-	count2, err := tx.GetSequencedLeafCount()
-	tx.Commit()
+		reverts, err := tx.MapHeadReverts()
+		if err != nil {
+			t.Fatalf("Failed to read map head reverts: %v", err)
+		}
+		if got, want := len(reverts), 1; got != want {
+			t.Fatalf("Got %d reverts, want %d", got, want)
+		}
+		if got, want := reverts[0].AbandonedTags, map[string]int64{"abandoned": 3}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Got abandoned tags %v, want %v", got, want)
+		}
+		tags, err := tx.GetRevisionTags()
+		if err != nil {
+			t.Fatalf("Failed to read revision tags: %v", err)
+		}
+		if got, want := tags, map[string]int64{"kept": 1}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Got tags %v after revert, want %v", got, want)
+		}
 
-	if err != nil {
-		t.Fatalf("unexpected error getting leaf count2: %v", err)
+		// The abandoned revisions must be retained
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM AbandonedMapHead WHERE TreeId=?", mapID.mapID.TreeID).Scan(&count); err != nil {
+			t.Fatalf("Failed to count abandoned map heads: %v", err)
+		}
+		if got, want := count, 2; got != want {
+			t.Fatalf("Got %d abandoned map heads, want %d", got, want)
+		}
 	}
 
-	if want, got := int64(2), count2; want != got {
+	{
+		tx := beginMapTx(s, t)
+		if err := tx.SkipMapRevisions(2, "too early", 3000); err == nil {
+			t.Fatalf("Unexpectedly skipped to a revision already in use")
+		}
+		if err := tx.SkipMapRevisions(5, "shard repair", 3000); err != nil {
+			t.Fatalf("Failed to skip map revisions: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+
+		tx = beginMapTx(s, t)
+		defer tx.Commit()
+		if got, want := tx.WriteRevision(), int64(6); got != want {
+			t.Fatalf("Got write revision %d after skip, want %d", got, want)
+		}
+	}
+}
+
+func TestRemovePartialRevisions(t *testing.T) {
+	cleanTestDB()
+
+	mapID := createMapID("TestRemovePartialRevisions")
+	db := prepareTestMapDB(mapID, t)
+	defer db.Close()
+	s := prepareTestMapStorage(mapID, t)
+	nodes := createSomeNodes("TestRemovePartialRevisions", mapID.mapID.TreeID)
+
+	{
+		tx := beginMapTx(s, t)
+		if err := tx.StoreSignedMapRoot(trillian.SignedMapRoot{MapId: mapID.mapID.MapID, TimestampNanos: 1000, MapRevision: 1, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}}); err != nil {
+			t.Fatalf("Failed to store signed map root: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+	}
+
+	// Nodes for revision 2 are committed in their own transaction, as the
+	// sparse Merkle tree writer does, but its root never is
+	{
+		tx := beginMapTx(s, t)
+		if err := tx.SetMerkleNodes(nodes); err != nil {
+			t.Fatalf("Failed to set nodes: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+	}
+
+	{
+		tx := beginMapTx(s, t)
+		removed, err := tx.(storage.PartialRevisionRemover).RemovePartialRevisions()
+		if err != nil {
+			t.Fatalf("Failed to remove partial revisions: %v", err)
+		}
+		if removed == 0 {
+			t.Fatalf("No rows of the partial revision were removed")
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+	}
+
+	// Revision 2 can now be written in full
+	{
+		tx := beginMapTx(s, t)
+		if got, want := tx.WriteRevision(), int64(2); got != want {
+			t.Fatalf("Got write revision %d, want %d", got, want)
+		}
+		if err := tx.SetMerkleNodes(nodes); err != nil {
+			t.Fatalf("Failed to set nodes: %v", err)
+		}
+		if err := tx.StoreSignedMapRoot(trillian.SignedMapRoot{MapId: mapID.mapID.MapID, TimestampNanos: 1001, MapRevision: 2, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}}); err != nil {
+			t.Fatalf("Failed to store signed map root: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit revision 2: %v", err)
+		}
+	}
+}
+
+func TestMapRevisionTags(t *testing.T) {
+	cleanTestDB()
+
+	mapID := createMapID("TestMapRevisionTags")
+	db := prepareTestMapDB(mapID, t)
+	defer db.Close()
+	s := prepareTestMapStorage(mapID, t)
+
+	tx := beginMapTx(s, t)
+	defer tx.Commit()
+
+	if err := tx.TagMapRevision("too-soon", 5, 100); err == nil {
+		t.Fatalf("Unexpectedly tagged unpublished revision")
+	}
+
+	root := trillian.SignedMapRoot{MapId: mapID.mapID.MapID, TimestampNanos: 98765, MapRevision: 5, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}}
+	if err := tx.StoreSignedMapRoot(root); err != nil {
+		t.Fatalf("Failed to store signed map root: %v", err)
+	}
+
+	if err := tx.TagMapRevision("2016-Q4-audit", 5, 100); err != nil {
+		t.Fatalf("Failed to tag revision: %v", err)
+	}
+	// Tags can't be moved once set
+	if err := tx.TagMapRevision("2016-Q4-audit", 5, 101); err == nil {
+		t.Fatalf("Unexpectedly allowed duplicate tag")
+	}
+
+	rev, err := tx.GetRevisionForTag("2016-Q4-audit")
+	if err != nil {
+		t.Fatalf("Failed to read back tag: %v", err)
+	}
+	if got, want := rev, int64(5); got != want {
+		t.Fatalf("Got revision %d for tag, want %d", got, want)
+	}
+
+	if _, err := tx.GetRevisionForTag("unknown"); err != storage.ErrTagNotFound {
+		t.Fatalf("Expected ErrTagNotFound but got: %v", err)
+	}
+
+	tags, err := tx.GetRevisionTags()
+	if err != nil {
+		t.Fatalf("Failed to read tags: %v", err)
+	}
+	if got, want := tags, map[string]int64{"2016-Q4-audit": 5}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Got tags %v, want %v", got, want)
+	}
+}
+
+func TestMapRetentionPolicyRoundTrip(t *testing.T) {
+	mapID := createMapID("TestMapRetentionPolicyRoundTrip")
+	db := prepareTestMapDB(mapID, t)
+	defer db.Close()
+	s := prepareTestMapStorage(mapID, t)
+	tx := beginMapTx(s, t)
+	defer tx.Commit()
+
+	policy, err := tx.GetRetentionPolicy()
+	if err != nil {
+		t.Fatalf("Failed to get retention policy: %v", err)
+	}
+	if got, want := policy, (storage.RetentionPolicy{}); got != want {
+		t.Fatalf("Got default retention policy %v, want %v", got, want)
+	}
+
+	want := storage.RetentionPolicy{MaxRevisions: 10, MaxAge: time.Hour}
+	if err := tx.SetRetentionPolicy(want); err != nil {
+		t.Fatalf("Failed to set retention policy: %v", err)
+	}
+	if policy, err = tx.GetRetentionPolicy(); err != nil {
+		t.Fatalf("Failed to get retention policy: %v", err)
+	}
+	if policy != want {
+		t.Fatalf("Got retention policy %v, want %v", policy, want)
+	}
+}
+
+func TestMapHashPrefixes(t *testing.T) {
+	mapID := createMapID("TestMapHashPrefixes")
+	db := prepareTestMapDB(mapID, t)
+	defer db.Close()
+
+	if got := prepareTestMapStorage(mapID, t).HashPrefixes(); !got.IsDefault() {
+		t.Fatalf("Got hash prefixes %v for new tree, want default", got)
+	}
+
+	want := storage.TreeHashPrefixes{Leaf: []byte("leaf"), Node: []byte("node")}
+	if _, err := db.Exec("UPDATE Trees SET LeafHashPrefix=?, NodeHashPrefix=? WHERE TreeId=?", want.Leaf, want.Node, mapID.mapID.TreeID); err != nil {
+		t.Fatalf("Failed to set hash prefixes: %v", err)
+	}
+	if got := prepareTestMapStorage(mapID, t).HashPrefixes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Got hash prefixes %v, want %v", got, want)
+	}
+
+	// A tree whose prefixes would not keep leaves and nodes apart can't be opened
+	if _, err := db.Exec("UPDATE Trees SET NodeHashPrefix=? WHERE TreeId=?", want.Leaf, mapID.mapID.TreeID); err != nil {
+		t.Fatalf("Failed to set hash prefixes: %v", err)
+	}
+	if _, err := NewMapStorage(mapID.mapID, "test:zaphod@tcp(127.0.0.1:3306)/test"); err == nil {
+		t.Fatalf("Expected error opening map with invalid hash prefixes")
+	}
+}
+
+func TestMapTreeStrata(t *testing.T) {
+	mapID := createMapID("TestMapTreeStrata")
+	db := prepareTestMapDB(mapID, t)
+	defer db.Close()
+
+	_, defaultStrata := storage.MapStrata(32)
+	if got := prepareTestMapStorage(mapID, t).(*mySQLMapStorage).strataDepths; !reflect.DeepEqual(got, defaultStrata) {
+		t.Fatalf("Got strata %v for new tree, want %v", got, defaultStrata)
+	}
+
+	want := []int{16, 16, 8, 216}
+	if _, err := db.Exec("UPDATE Trees SET MapStrata='16x2,8,216' WHERE TreeId=?", mapID.mapID.TreeID); err != nil {
+		t.Fatalf("Failed to set strata: %v", err)
+	}
+	if got := prepareTestMapStorage(mapID, t).(*mySQLMapStorage).strataDepths; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Got strata %v, want %v", got, want)
+	}
+
+	// A tree whose strata don't add up to its depth can't be opened
+	if _, err := db.Exec("UPDATE Trees SET MapStrata='8x10' WHERE TreeId=?", mapID.mapID.TreeID); err != nil {
+		t.Fatalf("Failed to set strata: %v", err)
+	}
+	if _, err := NewMapStorage(mapID.mapID, "test:zaphod@tcp(127.0.0.1:3306)/test"); err == nil {
+		t.Fatalf("Expected error opening map with invalid strata")
+	}
+}
+
+func TestMapHashAlgorithm(t *testing.T) {
+	mapID := createMapID("TestMapHashAlgorithm")
+	db := prepareTestMapDB(mapID, t)
+	defer db.Close()
+
+	if got, want := prepareTestMapStorage(mapID, t).HashAlgorithm(), trillian.HashAlgorithm_SHA256; got != want {
+		t.Fatalf("Got hash algorithm %v for new tree, want %v", got, want)
+	}
+
+	if _, err := db.Exec("UPDATE Trees SET LeafHasherType='SHA512', TreeHasherType='SHA512' WHERE TreeId=?", mapID.mapID.TreeID); err != nil {
+		t.Fatalf("Failed to set hash algorithm: %v", err)
+	}
+	s := prepareTestMapStorage(mapID, t)
+	if got, want := s.HashAlgorithm(), trillian.HashAlgorithm_SHA512; got != want {
+		t.Fatalf("Got hash algorithm %v, want %v", got, want)
+	}
+
+	// Leaves and nodes at the bottom of the deeper tree can be written and read back
+	keyHash := bytes.Repeat([]byte{0x5a}, 64)
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Failed to Begin: %v", err)
+	}
+	leaf := trillian.MapLeaf{KeyHash: keyHash, LeafHash: bytes.Repeat([]byte{1}, 64), LeafValue: []byte("value")}
+	if err := tx.Set(keyHash, leaf); err != nil {
+		t.Fatalf("Failed to Set: %v", err)
+	}
+	node := storage.Node{NodeID: storage.NewNodeIDFromHash(keyHash), Hash: bytes.Repeat([]byte{2}, 64), NodeRevision: tx.WriteRevision()}
+	if err := tx.SetMerkleNodes([]storage.Node{node}); err != nil {
+		t.Fatalf("Failed to SetMerkleNodes: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to Commit: %v", err)
+	}
+
+	tx2, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Failed to Begin: %v", err)
+	}
+	defer tx2.Commit()
+	nodes, err := tx2.GetMerkleNodes(node.NodeRevision, []storage.NodeID{node.NodeID})
+	if err != nil {
+		t.Fatalf("Failed to GetMerkleNodes: %v", err)
+	}
+	if len(nodes) != 1 || !bytes.Equal(nodes[0].Hash, node.Hash) {
+		t.Fatalf("Got nodes %v, want %v", nodes, node)
+	}
+}
+
+func TestTreeRoutes(t *testing.T) {
+	cleanTestDB()
+
+	s, err := NewTreeRouteStorage("test:zaphod@tcp(127.0.0.1:3306)/test", Options{})
+	if err != nil {
+		t.Fatalf("Failed to open tree route storage: %v", err)
+	}
+
+	if err := s.SetTreeRoute(10, "east"); err != nil {
+		t.Fatalf("Failed to set route: %v", err)
+	}
+	if err := s.SetTreeRoute(11, "east"); err != nil {
+		t.Fatalf("Failed to set route: %v", err)
+	}
+	// Setting a route again moves the tree
+	if err := s.SetTreeRoute(10, "west"); err != nil {
+		t.Fatalf("Failed to replace route: %v", err)
+	}
+	if err := s.SetTreeRoute(12, "west"); err != nil {
+		t.Fatalf("Failed to set route: %v", err)
+	}
+	if err := s.DeleteTreeRoute(12); err != nil {
+		t.Fatalf("Failed to delete route: %v", err)
+	}
+
+	routes, err := s.GetTreeRoutes()
+	if err != nil {
+		t.Fatalf("Failed to read routes: %v", err)
+	}
+	if want := map[int64]string{10: "west", 11: "east"}; !reflect.DeepEqual(routes, want) {
+		t.Fatalf("Got routes %v, want %v", routes, want)
+	}
+}
+
+func TestQuotaLimits(t *testing.T) {
+	cleanTestDB()
+
+	s, err := NewQuotaStorage("test:zaphod@tcp(127.0.0.1:3306)/test", Options{})
+	if err != nil {
+		t.Fatalf("Failed to open quota storage: %v", err)
+	}
+
+	global := &trillian.QuotaLimit{Group: trillian.QuotaGroup_GLOBAL, Kind: trillian.QuotaKind_WRITE, TokensPerSecond: 100, Burst: 1000}
+	tree := &trillian.QuotaLimit{Group: trillian.QuotaGroup_TREE, Kind: trillian.QuotaKind_READ, TreeId: 10, TokensPerSecond: 10, Burst: 100}
+	user := &trillian.QuotaLimit{Group: trillian.QuotaGroup_USER, Kind: trillian.QuotaKind_READ, User: "alice", TokensPerSecond: 1, Burst: 10}
+	for _, limit := range []*trillian.QuotaLimit{user, tree, global} {
+		if err := s.SetQuotaLimit(limit); err != nil {
+			t.Fatalf("Failed to set limit: %v", err)
+		}
+	}
+	// Setting a limit again replaces it
+	tree.TokensPerSecond = 20.5
+	if err := s.SetQuotaLimit(tree); err != nil {
+		t.Fatalf("Failed to replace limit: %v", err)
+	}
+	if err := s.DeleteQuotaLimit(trillian.QuotaGroup_GLOBAL, trillian.QuotaKind_WRITE, 0, ""); err != nil {
+		t.Fatalf("Failed to delete limit: %v", err)
+	}
+
+	limits, err := s.ListQuotaLimits()
+	if err != nil {
+		t.Fatalf("Failed to read limits: %v", err)
+	}
+	if want := []*trillian.QuotaLimit{tree, user}; !reflect.DeepEqual(limits, want) {
+		t.Fatalf("Got limits %v, want %v", limits, want)
+	}
+}
+
+func TestTreeAdmin(t *testing.T) {
+	cleanTestDB()
+
+	s, err := NewTreeAdminStorage("test:zaphod@tcp(127.0.0.1:3306)/test", Options{})
+	if err != nil {
+		t.Fatalf("Failed to open tree admin storage: %v", err)
+	}
+
+	logTree := Tree{TreeID: 20, KeyID: "key1", TreeType: LogTreeType}
+	mapTree := Tree{TreeID: 21, KeyID: "key1", TreeType: MapTreeType, SignatureAlgorithm: trillian.SignatureAlgorithm_RSA, HashPrefixes: storage.TreeHashPrefixes{Leaf: []byte{0}, Node: []byte{1}}}
+	for _, tree := range []Tree{logTree, mapTree} {
+		if err := s.CreateTree(tree, DefaultTreeControl); err != nil {
+			t.Fatalf("Failed to create tree %d: %v", tree.TreeID, err)
+		}
+	}
+	if err := s.CreateTree(logTree, DefaultTreeControl); err == nil {
+		t.Fatalf("Created tree with an ID already in use")
+	}
+	// Only maps have strata, and they must add up to the map's depth
+	for _, tree := range []Tree{
+		{TreeID: 22, KeyID: "key1", TreeType: LogTreeType, MapStrata: []int{8, 248}},
+		{TreeID: 22, KeyID: "key1", TreeType: MapTreeType, MapStrata: []int{8, 240}},
+		{TreeID: 22, KeyID: "key1", TreeType: MapTreeType, MapStrata: []int{4, 252}},
+	} {
+		if err := s.CreateTree(tree, DefaultTreeControl); err == nil {
+			t.Fatalf("Created %s tree with strata %v", tree.TreeType, tree.MapStrata)
+		}
+	}
+	strataTree := Tree{TreeID: 23, KeyID: "key1", TreeType: MapTreeType, MapStrata: []int{16, 8, 232}}
+	if err := s.CreateTree(strataTree, DefaultTreeControl); err != nil {
+		t.Fatalf("Failed to create tree with strata: %v", err)
+	}
+	if got, err := s.GetTree(strataTree.TreeID); err != nil || !reflect.DeepEqual(got, strataTree) {
+		t.Fatalf("GetTree() = %+v, %v, want %+v", got, err, strataTree)
+	}
+	if err := s.DeleteTree(strataTree.TreeID); err != nil {
+		t.Fatalf("Failed to delete tree: %v", err)
+	}
+
+	trees, err := s.ListTrees()
+	if err != nil {
+		t.Fatalf("Failed to list trees: %v", err)
+	}
+	if want := []Tree{logTree, mapTree}; !reflect.DeepEqual(trees, want) {
+		t.Fatalf("Listed trees %v, want %v", trees, want)
+	}
+
+	// Freeze the log and give it a new key
+	frozen := DefaultTreeControl
+	frozen.SetTreeState(trillian.TreeState_FROZEN)
+	frozen.SequenceGuardSeconds = 30
+	frozen.MaxRootDurationSeconds = 3600
+	if err := s.SetTreeControl(logTree.TreeID, frozen); err != nil {
+		t.Fatalf("Failed to set tree control: %v", err)
+	}
+	if err := s.SetKeyID(logTree.TreeID, "key2"); err != nil {
+		t.Fatalf("Failed to set key ID: %v", err)
+	}
+	treeKeys, err := s.GetTreeKeys(logTree.TreeID)
+	if err != nil || len(treeKeys) != 2 || !reflect.DeepEqual(treeKeys[0], TreeKey{KeyID: "key1"}) || treeKeys[1].KeyID != "key2" || treeKeys[1].ActivateTimeNanos <= 0 {
+		t.Fatalf("GetTreeKeys() = %+v, %v, want key1 then key2", treeKeys, err)
+	}
+	// Keys can be added to be activated later, with their public keys, and the
+	// latest key added is the tree's key ID
+	nextKey := TreeKey{KeyID: "key3", PublicKey: []byte("public key"), ActivateTimeNanos: treeKeys[1].ActivateTimeNanos + 1000}
+	if err := s.AddTreeKey(logTree.TreeID, nextKey); err != nil {
+		t.Fatalf("Failed to add tree key: %v", err)
+	}
+	if got, err := s.GetTreeKeys(logTree.TreeID); err != nil || !reflect.DeepEqual(got, append(treeKeys, nextKey)) {
+		t.Fatalf("GetTreeKeys() = %+v, %v, want %+v", got, err, append(treeKeys, nextKey))
+	}
+	if got, err := s.GetTreeKeys(mapTree.TreeID); err != nil || !reflect.DeepEqual(got, []TreeKey{{KeyID: "key1"}}) {
+		t.Fatalf("GetTreeKeys() of map = %+v, %v, want only key1", got, err)
+	}
+	status, err := s.GetTreeStatus(logTree.TreeID)
+	if err != nil {
+		t.Fatalf("Failed to get tree status: %v", err)
+	}
+	if status.Tree.KeyID != "key3" || status.Control == nil || *status.Control != frozen || status.LatestRevision != -1 {
+		t.Fatalf("Got unexpected status %+v", status)
+	}
+	ls, err := NewLogStorage(trillian.LogID{LogID: []byte("log"), TreeID: logTree.TreeID}, "test:zaphod@tcp(127.0.0.1:3306)/test")
+	if err != nil {
+		t.Fatalf("Failed to open frozen log: %v", err)
+	}
+	if got := ls.TreeState(); got != trillian.TreeState_FROZEN {
+		t.Fatalf("Frozen log has state %v", got)
+	}
+	if _, err := ls.Begin(); err != storage.ErrReadOnly {
+		t.Fatalf("Begin() of frozen log = %v, want %v", err, storage.ErrReadOnly)
+	}
+
+	// A draining log can still be written by the sequencer
+	draining := frozen
+	draining.SetTreeState(trillian.TreeState_DRAINING)
+	if err := s.SetTreeControl(logTree.TreeID, draining); err != nil {
+		t.Fatalf("Failed to set tree control: %v", err)
+	}
+	if control, _, err := s.GetTreeControl(logTree.TreeID); err != nil || control != draining {
+		t.Fatalf("GetTreeControl() = %+v, %v, want %+v", control, err, draining)
+	}
+	ls, err = NewLogStorage(trillian.LogID{LogID: []byte("log"), TreeID: logTree.TreeID}, "test:zaphod@tcp(127.0.0.1:3306)/test")
+	if err != nil {
+		t.Fatalf("Failed to open draining log: %v", err)
+	}
+	if got := ls.TreeState(); got != trillian.TreeState_DRAINING {
+		t.Fatalf("Draining log has state %v", got)
+	}
+	tx, err := ls.Begin()
+	if err != nil {
+		t.Fatalf("Begin() of draining log = %v", err)
+	}
+	tx.Rollback()
+
+	if err := s.DeleteTree(logTree.TreeID); err != nil {
+		t.Fatalf("Failed to delete tree: %v", err)
+	}
+	if _, err := s.GetTree(logTree.TreeID); err != sql.ErrNoRows {
+		t.Fatalf("Got %v for deleted tree, want ErrNoRows", err)
+	}
+	if err := s.SetKeyID(logTree.TreeID, "key3"); err != sql.ErrNoRows {
+		t.Fatalf("Got %v setting key of deleted tree, want ErrNoRows", err)
+	}
+	if _, err := s.GetTreeKeys(logTree.TreeID); err != sql.ErrNoRows {
+		t.Fatalf("Got %v getting keys of deleted tree, want ErrNoRows", err)
+	}
+}
+
+func TestTreeAdminSoftDelete(t *testing.T) {
+	cleanTestDB()
+
+	s, err := NewTreeAdminStorage("test:zaphod@tcp(127.0.0.1:3306)/test", Options{})
+	if err != nil {
+		t.Fatalf("Failed to open tree admin storage: %v", err)
+	}
+	mapTree := Tree{TreeID: 23, KeyID: "key1", TreeType: MapTreeType}
+	if err := s.CreateTree(mapTree, DefaultTreeControl); err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+
+	// Storage opened before the tree is deleted can't be used after
+	ms, err := NewMapStorage(trillian.MapID{MapID: []byte("map"), TreeID: mapTree.TreeID}, "test:zaphod@tcp(127.0.0.1:3306)/test")
+	if err != nil {
+		t.Fatalf("Failed to open map storage: %v", err)
+	}
+	if err := s.SoftDeleteTree(mapTree.TreeID, 1000); err != nil {
+		t.Fatalf("Failed to soft delete tree: %v", err)
+	}
+	if _, err := ms.Begin(); err != storage.ErrTreeDeleted {
+		t.Fatalf("Got %v beginning transaction on deleted map, want ErrTreeDeleted", err)
+	}
+	tree, err := s.GetTree(mapTree.TreeID)
+	if err != nil {
+		t.Fatalf("Failed to get deleted tree: %v", err)
+	}
+	if !tree.Deleted || tree.DeleteTimeNanos != 1000 {
+		t.Fatalf("Got tree %+v, want deleted at 1000", tree)
+	}
+	if err := s.SoftDeleteTree(mapTree.TreeID, 2000); err != storage.ErrTreeDeleted {
+		t.Fatalf("Got %v deleting deleted tree, want ErrTreeDeleted", err)
+	}
+	if err := s.SetKeyID(mapTree.TreeID, "key2"); err != storage.ErrTreeDeleted {
+		t.Fatalf("Got %v setting key of deleted tree, want ErrTreeDeleted", err)
+	}
+	if _, err := NewMapStorage(trillian.MapID{MapID: []byte("map"), TreeID: mapTree.TreeID}, "test:zaphod@tcp(127.0.0.1:3306)/test"); err != storage.ErrTreeDeleted {
+		t.Fatalf("Got %v opening deleted map, want ErrTreeDeleted", err)
+	}
+
+	if err := s.UndeleteTree(mapTree.TreeID); err != nil {
+		t.Fatalf("Failed to undelete tree: %v", err)
+	}
+	if err := s.UndeleteTree(mapTree.TreeID); err != storage.ErrTreeNotDeleted {
+		t.Fatalf("Got %v undeleting tree, want ErrTreeNotDeleted", err)
+	}
+	if purged, err := s.PurgeDeletedTree(mapTree.TreeID, 5000, nil); err != nil || purged {
+		t.Fatalf("PurgeDeletedTree() of undeleted tree=%v, %v, want false, nil", purged, err)
+	}
+
+	if err := s.SoftDeleteTree(mapTree.TreeID, 3000); err != nil {
+		t.Fatalf("Failed to soft delete tree: %v", err)
+	}
+	for _, test := range []struct {
+		before     int64
+		wantPurged bool
+	}{
+		{before: 3000, wantPurged: false},
+		{before: 3001, wantPurged: true},
+		{before: 3001, wantPurged: false},
+	} {
+		if purged, err := s.PurgeDeletedTree(mapTree.TreeID, test.before, nil); err != nil || purged != test.wantPurged {
+			t.Fatalf("PurgeDeletedTree(%d)=%v, %v, want %v, nil", test.before, purged, err, test.wantPurged)
+		}
+	}
+	if _, err := s.GetTree(mapTree.TreeID); err != sql.ErrNoRows {
+		t.Fatalf("Got %v for purged tree, want ErrNoRows", err)
+	}
+}
+
+func TestTreeStats(t *testing.T) {
+	cleanTestDB()
+
+	s, err := NewTreeAdminStorage("test:zaphod@tcp(127.0.0.1:3306)/test", Options{})
+	if err != nil {
+		t.Fatalf("Failed to open tree admin storage: %v", err)
+	}
+	logTree := Tree{TreeID: 22, KeyID: "key1", TreeType: LogTreeType}
+	if err := s.CreateTree(logTree, DefaultTreeControl); err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+
+	stats, err := s.GetTreeStats(logTree.TreeID)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if want := (TreeStats{TreeID: logTree.TreeID, TreeType: LogTreeType}); !reflect.DeepEqual(stats, want) {
+		t.Fatalf("Got stats %+v for empty tree, want %+v", stats, want)
+	}
+
+	db := openTestDBOrDie()
+	defer db.Close()
+	logID := trillian.LogID{LogID: []byte("log"), TreeID: logTree.TreeID}
+	createFakeLeaf(db, logID, []byte("hash1"), []byte("data1"), 0, t)
+	createFakeLeaf(db, logID, []byte("hash2"), []byte("data2"), 1, t)
+	for rev := int64(1); rev <= 2; rev++ {
+		if _, err := db.Exec("INSERT INTO TreeHead(TreeId, TreeHeadTimestamp, TreeSize, RootHash, TreeRevision, RootSignature) VALUES(?, ?, ?, 'root', ?, 'sig')",
+			logTree.TreeID, rev*1000, rev, rev); err != nil {
+			t.Fatalf("Failed to create tree head: %v", err)
+		}
+	}
+
+	stats, err = s.GetTreeStats(logTree.TreeID)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	want := TreeStats{
+		TreeID:     logTree.TreeID,
+		TreeType:   LogTreeType,
+		Leaves:     2,
+		Revisions:  2,
+		OldestRoot: &RootStats{Revision: 1, TimestampNanos: 1000},
+		NewestRoot: &RootStats{Revision: 2, TimestampNanos: 2000},
+		LeafBytes:  30,
+		RootBytes:  14,
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("Got stats %+v, want %+v", stats, want)
+	}
+	if got, want := stats.TotalBytes(), int64(44); got != want {
+		t.Errorf("TotalBytes() = %d, want %d", got, want)
+	}
+}
+
+func TestMapPruneRevisions(t *testing.T) {
+	cleanTestDB()
+
+	mapID := createMapID("TestMapPruneRevisions")
+	db := prepareTestMapDB(mapID, t)
+	defer db.Close()
+	s := prepareTestMapStorage(mapID, t)
+
+	for rev := int64(1); rev <= 3; rev++ {
+		tx := beginMapTx(s, t)
+		leaf := mapLeaf
+		leaf.LeafValue = []byte(fmt.Sprintf("Value %d", rev))
+		if err := tx.Set(keyHash, leaf); err != nil {
+			t.Fatalf("Failed to set %v to %v: %v", keyHash, leaf, err)
+		}
+		root := trillian.SignedMapRoot{MapId: mapID.mapID.MapID, TimestampNanos: 1000 * rev, MapRevision: rev, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}}
+		if err := tx.StoreSignedMapRoot(root); err != nil {
+			t.Fatalf("Failed to store signed map root: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+	}
+
+	tx := beginMapTx(s, t)
+	defer tx.Commit()
+
+	if rev, err := tx.EarliestRevisionSince(1500); err != nil || rev != 2 {
+		t.Fatalf("EarliestRevisionSince(1500)=%d, %v, want 2, nil", rev, err)
+	}
+	if rev, err := tx.EarliestRevisionSince(5000); err != nil || rev != 3 {
+		t.Fatalf("EarliestRevisionSince(5000)=%d, %v, want 3, nil", rev, err)
+	}
+
+	if err := tx.PruneRevisionsBefore(4); err == nil {
+		t.Fatalf("Unexpectedly pruned the latest revision")
+	}
+	if err := tx.PruneRevisionsBefore(3); err != nil {
+		t.Fatalf("Failed to prune revisions: %v", err)
+	}
+	if oldest, err := tx.OldestRetainedRevision(); err != nil || oldest != 3 {
+		t.Fatalf("OldestRetainedRevision()=%d, %v, want 3, nil", oldest, err)
+	}
+
+	_, err := tx.Get(2, []trillian.Hash{keyHash})
+	if _, ok := err.(storage.RevisionOutOfRangeError); !ok {
+		t.Fatalf("Expected RevisionOutOfRangeError reading pruned revision but got: %v", err)
+	}
+
+	readValues, err := tx.Get(3, []trillian.Hash{keyHash})
+	if err != nil {
+		t.Fatalf("Failed to get %v:  %v", keyHash, err)
+	}
+	if got, want := string(readValues[0].LeafValue), "Value 3"; got != want {
+		t.Fatalf("Got value %s, want %s", got, want)
+	}
+}
+
+func TestMapDeleteLeavesBelowRevision(t *testing.T) {
+	cleanTestDB()
+
+	mapID := createMapID("TestMapDeleteLeavesBelowRevision")
+	db := prepareTestMapDB(mapID, t)
+	defer db.Close()
+	s := prepareTestMapStorage(mapID, t)
+
+	for rev := int64(1); rev <= 3; rev++ {
+		tx := beginMapTx(s, t)
+		leaf := mapLeaf
+		leaf.LeafValue = []byte(fmt.Sprintf("Value %d", rev))
+		if err := tx.Set(keyHash, leaf); err != nil {
+			t.Fatalf("Failed to set %v to %v: %v", keyHash, leaf, err)
+		}
+		root := trillian.SignedMapRoot{MapId: mapID.mapID.MapID, TimestampNanos: 1000 * rev, MapRevision: rev, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}}
+		if err := tx.StoreSignedMapRoot(root); err != nil {
+			t.Fatalf("Failed to store signed map root: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+	}
+
+	tx := beginMapTx(s, t)
+	defer tx.Commit()
+
+	if _, err := tx.DeleteMapLeavesBelowRevision(3); err == nil {
+		t.Fatalf("Unexpectedly deleted leaves of retained revisions")
+	}
+	if err := tx.PruneRevisionsBefore(3); err != nil {
+		t.Fatalf("Failed to prune revisions: %v", err)
+	}
+	if deleted, err := tx.DeleteMapLeavesBelowRevision(3); err != nil || deleted != 2 {
+		t.Fatalf("DeleteMapLeavesBelowRevision(3)=%d, %v, want 2, nil", deleted, err)
+	}
+
+	// The superseded values are gone, so there is nothing left to archive
+	if segment, err := tx.GetArchivableRevision(1); err != nil || len(segment.Leaves) != 0 {
+		t.Fatalf("GetArchivableRevision(1)=%v, %v, want no leaves", segment, err)
+	}
+
+	readValues, err := tx.Get(3, []trillian.Hash{keyHash})
+	if err != nil {
+		t.Fatalf("Failed to get %v:  %v", keyHash, err)
+	}
+	if got, want := string(readValues[0].LeafValue), "Value 3"; got != want {
+		t.Fatalf("Got value %s, want %s", got, want)
+	}
+}
+
+func TestMapArchiveAndRestore(t *testing.T) {
+	cleanTestDB()
+
+	mapID := createMapID("TestMapArchiveAndRestore")
+	db := prepareTestMapDB(mapID, t)
+	defer db.Close()
+	s := prepareTestMapStorage(mapID, t)
+
+	for rev := int64(1); rev <= 3; rev++ {
+		tx := beginMapTx(s, t)
+		leaf := mapLeaf
+		leaf.LeafValue = []byte(fmt.Sprintf("Value %d", rev))
+		if err := tx.Set(keyHash, leaf); err != nil {
+			t.Fatalf("Failed to set %v to %v: %v", keyHash, leaf, err)
+		}
+		root := trillian.SignedMapRoot{MapId: mapID.mapID.MapID, TimestampNanos: 1000 * rev, MapRevision: rev, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}}
+		if err := tx.StoreSignedMapRoot(root); err != nil {
+			t.Fatalf("Failed to store signed map root: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+	}
+
+	tx := beginMapTx(s, t)
+	defer tx.Commit()
+
+	if _, err := tx.GetArchivableRevision(1); err == nil {
+		t.Fatalf("Unexpectedly allowed a retained revision to be archived")
+	}
+	if err := tx.PruneRevisionsBefore(3); err != nil {
+		t.Fatalf("Failed to prune revisions: %v", err)
+	}
+
+	segment, err := tx.GetArchivableRevision(1)
+	if err != nil {
+		t.Fatalf("Failed to get archivable revision: %v", err)
+	}
+	if got, want := len(segment.Leaves), 1; got != want {
+		t.Fatalf("Got %d archivable leaves, want %d", got, want)
+	}
+	if err := tx.ArchiveRevision(1, "seg1"); err != nil {
+		t.Fatalf("Failed to archive revision: %v", err)
+	}
+	if archived, err := tx.GetArchivedRevisions(); err != nil || !reflect.DeepEqual(archived, map[int64]string{1: "seg1"}) {
+		t.Fatalf("GetArchivedRevisions()=%v, %v, want map[1:seg1], nil", archived, err)
+	}
+
+	// Once archived there is nothing left to archive for the revision
+	if again, err := tx.GetArchivableRevision(1); err != nil || len(again.Leaves) != 0 {
+		t.Fatalf("GetArchivableRevision(1)=%v, %v, want no leaves", again, err)
+	}
+
+	if _, err := tx.Get(1, []trillian.Hash{keyHash}); err == nil {
+		t.Fatalf("Unexpectedly read a pruned revision")
+	}
+
+	if err := tx.RestoreArchivedRevision(segment); err != nil {
+		t.Fatalf("Failed to restore revision: %v", err)
+	}
+	if err := tx.SetRevisionRestored(1, 5000); err != nil {
+		t.Fatalf("Failed to mark revision restored: %v", err)
+	}
+	if restored, err := tx.GetRestoredRevisions(); err != nil || !reflect.DeepEqual(restored, map[int64]int64{1: 5000}) {
+		t.Fatalf("GetRestoredRevisions()=%v, %v, want map[1:5000], nil", restored, err)
+	}
+
+	readValues, err := tx.Get(1, []trillian.Hash{keyHash})
+	if err != nil {
+		t.Fatalf("Failed to get restored revision: %v", err)
+	}
+	if got, want := string(readValues[0].LeafValue), "Value 1"; got != want {
+		t.Fatalf("Got value %s, want %s", got, want)
+	}
+
+	if err := tx.ClearRevisionRestored(1); err != nil {
+		t.Fatalf("Failed to clear restored revision: %v", err)
+	}
+	if _, err := tx.Get(1, []trillian.Hash{keyHash}); err == nil {
+		t.Fatalf("Unexpectedly read a revision after its restore was cleared")
+	}
+}
+
+func TestGetActiveLogIDs(t *testing.T) {
+	// Have to wipe everything to ensure we start with zero log trees configured
+	cleanTestDB()
+
+	// This creates one tree
+	logID := createLogID("TestGetActiveLogIDs")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+
+	s := prepareTestLogStorage(logID, t)
+	tx := beginLogTx(s, t)
+
+	logIDs, err := tx.GetActiveLogIDs()
+
+	if err != nil {
+		t.Fatalf("Failed to get log ids: %v", err)
+	}
+
+	if got, want := len(logIDs), 1; got != want {
+		t.Fatalf("Got %d logID(s), wanted %d", got, want)
+	}
+}
+
+func TestGetActiveLogIDsWithPendingWork(t *testing.T) {
+	// Have to wipe everything to ensure we start with zero log trees configured
+	cleanTestDB()
+	logID := createLogID("TestGetActiveLogIDsWithPendingWork")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+
+	s := prepareTestLogStorage(logID, t)
+	tx := beginLogTx(s, t)
+
+	logIDs, err := tx.GetActiveLogIDsWithPendingWork()
+	tx.Commit()
+
+	if err != nil || len(logIDs) != 0 {
+		t.Fatalf("Should have had no logs with unsequenced work but got: %v %v", logIDs, err)
+	}
+
+	{
+		tx := beginLogTx(s, t)
+		defer failIfTXStillOpen(t, "TestGetActiveLogIDsFiltered", tx)
+
+		leaves := createTestLeaves(leavesToInsert, 2)
+
+		if _, err := tx.QueueLeaves(leaves); err != nil {
+			t.Fatalf("Failed to queue leaves: %v", err)
+		}
+
+		commit(tx, t)
+	}
+
+	// We should now see the logID that we just created work for
+	tx = beginLogTx(s, t)
+
+	logIDs, err = tx.GetActiveLogIDsWithPendingWork()
+	tx.Commit()
+
+	if err != nil || len(logIDs) != 1 {
+		t.Fatalf("Should have had one log with unsequenced work but got: %v", logIDs)
+	}
+
+	expected, got := logID.logID.TreeID, logIDs[0].TreeID
+	if expected != got {
+		t.Fatalf("Expected to see tree ID: %d but got: %d", expected, got)
+	}
+}
+
+func TestGetSequencedLeafCount(t *testing.T) {
+	// We'll create leaves for two different trees
+	logID := createLogID("TestGetSequencedLeafCount")
+	logID2 := createLogID("TestGetSequencedLeafCount2")
+
+	{
+		db := prepareTestLogDB(logID, t)
+
+		// Create fake leaf as if it had been sequenced
+		defer db.Close()
+
+		data := []byte("some data")
+
+		createFakeLeaf(db, logID.logID, dummyHash, data, sequenceNumber, t)
+
+		// Create fake leaves for second tree as if they had been sequenced
+		db2 := prepareTestLogDB(logID2, t)
+		defer db2.Close()
+
+		data2 := []byte("some data 2")
+		data3 := []byte("some data 3")
+
+		createFakeLeaf(db2, logID2.logID, dummyHash2, data2, sequenceNumber, t)
+		createFakeLeaf(db2, logID2.logID, dummyHash3, data3, sequenceNumber+1, t)
+	}
+
+	// Read back the leaf counts from both trees
+	s := prepareTestLogStorage(logID, t)
+	tx := beginLogTx(s, t)
+	count1, err := tx.GetSequencedLeafCount()
+	tx.Commit()
+
+	if err != nil {
+		t.Fatalf("unexpected error getting leaf count: %v", err)
+	}
+
+	if want, got := int64(1), count1; want != got {
+		t.Fatalf("expected %d sequenced for logId but got %d", want, got)
+	}
+
+	s = prepareTestLogStorage(logID2, t)
+	tx = beginLogTx(s, t)
+	count2, err := tx.GetSequencedLeafCount()
+	tx.Commit()
+
+	if err != nil {
+		t.Fatalf("unexpected error getting leaf count2: %v", err)
+	}
+
+	if want, got := int64(2), count2; want != got {
 		t.Fatalf("expected %d sequenced for logId2 but got %d", want, got)
 	}
 }
 
+func TestGetLeafIndexRangeByTime(t *testing.T) {
+	logID := createLogID("TestGetLeafIndexRangeByTime")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+
+	// Three leaves in two batches, at times 100 and 200
+	hashes := [][]byte{dummyHash, dummyHash2, dummyHash3}
+	for _, hash := range hashes {
+		if _, err := db.Exec("INSERT INTO LeafData(TreeId, LeafHash, TheData) VALUES(?,?,?)", logID.logID.TreeID, hash, []byte("data")); err != nil {
+			t.Fatalf("Failed to create test leaf data: %v", err)
+		}
+	}
+	s := prepareTestLogStorage(logID, t)
+	tx := beginLogTx(s, t)
+	var leaves []trillian.LogLeaf
+	for i, hash := range hashes {
+		ts := int64(100)
+		if i > 0 {
+			ts = 200
+		}
+		leaves = append(leaves, trillian.LogLeaf{Leaf: trillian.Leaf{LeafHash: hash}, SequenceNumber: int64(i), IntegrateTimestampNanos: ts})
+	}
+	if err := tx.UpdateSequencedLeaves(leaves); err != nil {
+		t.Fatalf("Failed to update sequenced leaves: %v", err)
+	}
+	commit(tx, t)
+
+	tx = beginLogTx(s, t)
+	defer tx.Commit()
+	for _, test := range []struct {
+		start, end         int64
+		wantBegin, wantEnd int64
+	}{
+		{start: 0, end: 1000, wantBegin: 0, wantEnd: 3},
+		{start: 100, end: 200, wantBegin: 0, wantEnd: 1},
+		{start: 150, end: 250, wantBegin: 1, wantEnd: 3},
+		{start: 0, end: 100, wantBegin: 0, wantEnd: 0},
+		{start: 150, end: 160, wantBegin: 1, wantEnd: 1},
+		{start: 300, end: 400, wantBegin: 3, wantEnd: 3},
+	} {
+		begin, end, err := tx.GetLeafIndexRangeByTime(test.start, test.end)
+		if err != nil {
+			t.Errorf("GetLeafIndexRangeByTime(%d, %d) = %v", test.start, test.end, err)
+			continue
+		}
+		if begin != test.wantBegin || end != test.wantEnd {
+			t.Errorf("GetLeafIndexRangeByTime(%d, %d) = [%d, %d), want [%d, %d)", test.start, test.end, begin, end, test.wantBegin, test.wantEnd)
+		}
+	}
+
+	got, err := tx.GetLeavesByIndex([]int64{2})
+	if err != nil {
+		t.Fatalf("GetLeavesByIndex() = %v", err)
+	}
+	if got, want := got[0].IntegrateTimestampNanos, int64(200); got != want {
+		t.Errorf("Got leaf integrated at %d, want %d", got, want)
+	}
+}
+
+func TestReplicaFreshness(t *testing.T) {
+	s := mySQLTreeStorage{latestRevision: -1}
+	// Until a root has been seen the primary is read
+	if s.isFresh(10) {
+		t.Error("Replica is fresh before any root has been seen")
+	}
+
+	s.noteRevision(5)
+	s.noteRevision(3)
+	for _, test := range []struct {
+		revision int64
+		want     bool
+	}{
+		{revision: 4, want: false},
+		{revision: 5, want: true},
+		{revision: 6, want: true},
+	} {
+		if got := s.isFresh(test.revision); got != test.want {
+			t.Errorf("isFresh(%d) after seeing revision 5 = %v, want %v", test.revision, got, test.want)
+		}
+	}
+}
+
+func TestLogSnapshotReadReplica(t *testing.T) {
+	logID := createLogID("TestLogSnapshotReadReplica")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+
+	// The test database stands in for its own replica
+	uri := "test:zaphod@tcp(127.0.0.1:3306)/test"
+	ls, err := NewLogStorageWithOptions(logID.logID, uri, Options{ReadReplicaURI: uri})
+	if err != nil {
+		t.Fatalf("Failed to open log storage: %v", err)
+	}
+	s := ls.(*mySQLLogStorage)
+	if s.replica == nil {
+		t.Fatal("Log storage has no read replica")
+	}
+
+	tx := beginLogTx(s, t)
+	root := trillian.SignedLogRoot{LogId: logID.logID.LogID, TimestampNanos: 98765, TreeSize: 16, TreeRevision: 5, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}}
+	if err := tx.StoreSignedLogRoot(root); err != nil {
+		t.Fatalf("Failed to store signed root: %v", err)
+	}
+	commit(tx, t)
+	if !s.isFresh(5) || s.isFresh(4) {
+		t.Errorf("Committing root 5 didn't make it the minimum for the replica")
+	}
+
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() = %v", err)
+	}
+	defer snapshot.Commit()
+	got, err := snapshot.LatestSignedLogRoot()
+	if err != nil || got.TreeRevision != 5 {
+		t.Errorf("LatestSignedLogRoot() from snapshot = %v, %v, want revision 5", got, err)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want string
+	}{
+		{err: errors.New("Error 1062: Duplicate entry 'x' for key 'PRIMARY'"), want: "1062"},
+		{err: driver.ErrBadConn, want: "bad_conn"},
+		{err: errors.New("something else"), want: "error"},
+	} {
+		if got := ErrorCode(test.err); got != test.want {
+			t.Errorf("ErrorCode(%v) = %q, want %q", test.err, got, test.want)
+		}
+	}
+}
+
+func TestParseSessionVariables(t *testing.T) {
+	var tests = []struct {
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"innodb_lock_wait_timeout=5", map[string]string{"innodb_lock_wait_timeout": "5"}, false},
+		{"time_zone='+00:00'; sql_mode = 'TRADITIONAL'", map[string]string{"time_zone": "'+00:00'", "sql_mode": "'TRADITIONAL'"}, false},
+		{"sql_mode='STRICT_ALL_TABLES,NO_ZERO_DATE';innodb_lock_wait_timeout=5", map[string]string{"sql_mode": "'STRICT_ALL_TABLES,NO_ZERO_DATE'", "innodb_lock_wait_timeout": "5"}, false},
+		{"innodb_lock_wait_timeout", nil, true},
+		{"bad name=1", nil, true},
+		{"x;DROP TABLE Trees=1", nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseSessionVariables(test.input)
+
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseSessionVariables(%s): expected error but got: %v", test.input, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("ParseSessionVariables(%s): unexpected error: %v", test.input, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(test.want, got) {
+			t.Errorf("ParseSessionVariables(%s): got %v, want %v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestDSNWithSessionVariables(t *testing.T) {
+	var tests = []struct {
+		dsn  string
+		vars map[string]string
+		want string
+	}{
+		{"user@tcp(host:3306)/db", nil, "user@tcp(host:3306)/db"},
+		{"user@tcp(host:3306)/db", map[string]string{"sql_mode": "'STRICT_ALL_TABLES'"}, "user@tcp(host:3306)/db?sql_mode=%27STRICT_ALL_TABLES%27"},
+		{"user@tcp(host:3306)/db?parseTime=true", map[string]string{"time_zone": "'+00:00'", "innodb_lock_wait_timeout": "5"}, "user@tcp(host:3306)/db?parseTime=true&innodb_lock_wait_timeout=5&time_zone=%27%2B00%3A00%27"},
+	}
+
+	for _, test := range tests {
+		if got := dsnWithSessionVariables(test.dsn, test.vars); got != test.want {
+			t.Errorf("dsnWithSessionVariables(%s, %v): got %s, want %s", test.dsn, test.vars, got, test.want)
+		}
+	}
+}
+
+func TestOptionsSessionVariablesOverrideDefaults(t *testing.T) {
+	opts := Options{SessionVariables: map[string]string{"sql_mode": "'TRADITIONAL'", "innodb_lock_wait_timeout": "5"}}
+	vars, err := opts.sessionVariables()
+	if err != nil {
+		t.Fatalf("Unexpected error getting session variables: %v", err)
+	}
+
+	want := map[string]string{"sql_mode": "'TRADITIONAL'", "innodb_lock_wait_timeout": "5"}
+	if !reflect.DeepEqual(want, vars) {
+		t.Fatalf("Got session variables %v, want %v", vars, want)
+	}
+
+	if _, err := (Options{SessionVariables: map[string]string{"a b": "1"}}).sessionVariables(); err == nil {
+		t.Fatalf("Expected error for invalid session variable name")
+	}
+}
+
 func ensureAllLeafHashesDistinct(leaves []trillian.LogLeaf, t *testing.T) {
 	// All the hashes should be distinct. If only we had maps with slices as keys or sets
 	// or pretty much any kind of usable data structures we could do this properly.
@@ -1283,12 +3122,12 @@ func cleanTestDB() {
 // Creates some test leaves with predictable data
 func createTestLeaves(n, startSeq int64) []trillian.LogLeaf {
 	leaves := make([]trillian.LogLeaf, 0)
-	hasher := trillian.NewSHA256()
+	hasher := merkle.NewRFC6962TreeHasher(trillian.NewSHA256())
 
 	for l := int64(0); l < n; l++ {
 		lv := fmt.Sprintf("Leaf %d", l)
-		leaf := trillian.LogLeaf{trillian.Leaf{
-			hasher.Digest([]byte(lv)), []byte(lv), []byte(fmt.Sprintf("Extra %d", l))}, int64(startSeq + l)}
+		leaf := trillian.LogLeaf{Leaf: trillian.Leaf{
+			LeafHash: hasher.HashLeaf([]byte(lv)), LeafValue: []byte(lv), ExtraData: []byte(fmt.Sprintf("Extra %d", l))}, SequenceNumber: int64(startSeq + l)}
 		leaves = append(leaves, leaf)
 	}
 
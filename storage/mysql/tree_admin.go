@@ -0,0 +1,645 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/cache"
+)
+
+const insertTreeSQL string = `INSERT INTO Trees(TreeId, KeyId, TreeType, LeafHasherType, TreeHasherType, HashStrategy, SignatureAlgorithm, AllowsDuplicateLeaves, DuplicatePolicy, LeafHashPrefix, NodeHashPrefix, MapStrata)
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+const selectTreeSQL string = `SELECT TreeId, KeyId, TreeType, TreeHasherType, HashStrategy, SignatureAlgorithm, AllowsDuplicateLeaves, DuplicatePolicy, LeafHashPrefix, NodeHashPrefix, MapStrata, Deleted, DeleteTimeNanos
+	FROM Trees WHERE TreeId=?`
+const selectTreesSQL string = `SELECT TreeId, KeyId, TreeType, TreeHasherType, HashStrategy, SignatureAlgorithm, AllowsDuplicateLeaves, DuplicatePolicy, LeafHashPrefix, NodeHashPrefix, MapStrata, Deleted, DeleteTimeNanos
+	FROM Trees ORDER BY TreeId`
+const updateTreeKeyIDSQL string = "UPDATE Trees SET KeyId=? WHERE TreeId=? AND Deleted=0"
+const selectTreeKeysSQL string = "SELECT KeyId, PublicKey, ActivateTimeNanos FROM TreeKey WHERE TreeId=? ORDER BY ActivateTimeNanos"
+const selectTreeForUpdateSQL string = "SELECT KeyId, Deleted FROM Trees WHERE TreeId=? FOR UPDATE"
+const insertFirstTreeKeySQL string = "INSERT IGNORE INTO TreeKey(TreeId, KeyId, ActivateTimeNanos) VALUES(?, ?, 0)"
+const insertTreeKeySQL string = `INSERT INTO TreeKey(TreeId, KeyId, PublicKey, ActivateTimeNanos) VALUES(?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE KeyId=VALUES(KeyId), PublicKey=VALUES(PublicKey)`
+const softDeleteTreeSQL string = "UPDATE Trees SET Deleted=1, DeleteTimeNanos=? WHERE TreeId=? AND Deleted=0"
+const undeleteTreeSQL string = "UPDATE Trees SET Deleted=0, DeleteTimeNanos=NULL WHERE TreeId=? AND Deleted=1"
+const selectTreeDeleteTimeForUpdateSQL string = "SELECT Deleted, DeleteTimeNanos FROM Trees WHERE TreeId=? FOR UPDATE"
+const setTreeControlSQL string = `INSERT INTO TreeControl(TreeId, ReadOnlyRequests, SigningEnabled, SequencingEnabled, SequenceIntervalSeconds, SignIntervalSeconds, SequenceGuardSeconds, MaxRootDurationSeconds, LeafCompression, TreeState)
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE ReadOnlyRequests=VALUES(ReadOnlyRequests), SigningEnabled=VALUES(SigningEnabled),
+		SequencingEnabled=VALUES(SequencingEnabled), SequenceIntervalSeconds=VALUES(SequenceIntervalSeconds),
+		SignIntervalSeconds=VALUES(SignIntervalSeconds), SequenceGuardSeconds=VALUES(SequenceGuardSeconds),
+		MaxRootDurationSeconds=VALUES(MaxRootDurationSeconds), LeafCompression=VALUES(LeafCompression),
+		TreeState=VALUES(TreeState)`
+const selectTreeControlSQL string = `SELECT ReadOnlyRequests, SigningEnabled, SequencingEnabled, SequenceIntervalSeconds, SignIntervalSeconds, SequenceGuardSeconds, MaxRootDurationSeconds, LeafCompression, TreeState
+	FROM TreeControl WHERE TreeId=?`
+const selectLatestLogHeadSQL string = `SELECT TreeRevision, TreeSize, TreeHeadTimestamp
+	FROM TreeHead WHERE TreeId=? ORDER BY TreeRevision DESC LIMIT 1`
+const selectLatestMapHeadSQL string = `SELECT MapRevision, MapHeadTimestamp
+	FROM MapHead WHERE TreeId=? ORDER BY MapRevision DESC LIMIT 1`
+const selectUnsequencedCountSQL string = "SELECT COUNT(*) FROM Unsequenced WHERE TreeId=?"
+const selectLogHeadStatsSQL string = `SELECT COUNT(*), MIN(TreeRevision), MAX(TreeRevision), MIN(TreeHeadTimestamp), MAX(TreeHeadTimestamp),
+	COALESCE(SUM(LENGTH(RootHash) + LENGTH(RootSignature)), 0)
+	FROM TreeHead WHERE TreeId=?`
+const selectMapHeadStatsSQL string = `SELECT COUNT(*), MIN(MapRevision), MAX(MapRevision), MIN(MapHeadTimestamp), MAX(MapHeadTimestamp),
+	COALESCE(SUM(LENGTH(RootHash) + LENGTH(RootSignature) + COALESCE(LENGTH(MapperData), 0)), 0)
+	FROM MapHead WHERE TreeId=?`
+const selectSequencedStatsSQL string = `SELECT COUNT(*), COALESCE(SUM(LENGTH(LeafHash)), 0)
+	FROM SequencedLeafData WHERE TreeId=?`
+const selectLeafDataBytesSQL string = "SELECT COALESCE(SUM(LENGTH(LeafHash) + LENGTH(TheData)), 0) FROM LeafData WHERE TreeId=?"
+const selectUnsequencedStatsSQL string = `SELECT COUNT(*), COALESCE(SUM(LENGTH(LeafHash) + LENGTH(MessageId) + LENGTH(Payload)), 0)
+	FROM Unsequenced WHERE TreeId=?`
+const selectMapLeafStatsSQL string = `SELECT COUNT(DISTINCT KeyHash), COUNT(*), COALESCE(SUM(LENGTH(KeyHash) + LENGTH(TheData)), 0)
+	FROM MapLeaf WHERE TreeId=?`
+const selectSubtreeStatsSQL string = `SELECT COUNT(*), COALESCE(SUM(LENGTH(SubtreeId) + LENGTH(Nodes)), 0)
+	FROM Subtree WHERE TreeId=?`
+
+// deleteTreeSQL removes the rows of a tree from the tables that aren't cleared
+// by the cascade from Trees, or which must be cleared first.
+var deleteTreeSQL = []string{
+	"DELETE FROM Unsequenced WHERE TreeId=?",
+	"DELETE FROM SequencedLeafData WHERE TreeId=?",
+	"DELETE FROM StagedLeafData WHERE TreeId=?",
+	"DELETE FROM TreeControl WHERE TreeId=?",
+	"DELETE FROM Trees WHERE TreeId=?",
+}
+
+// Tree types, as held in the TreeType column of the Trees table.
+const (
+	LogTreeType = "LOG"
+	MapTreeType = "MAP"
+	// PreorderedLogTreeType is a log whose leaves are added at their indices
+	// rather than queued
+	PreorderedLogTreeType = "PREORDERED_LOG"
+)
+
+// Tree holds the parameters of a tree, which shouldn't change once it has been
+// created.
+type Tree struct {
+	TreeID int64
+	// KeyID identifies the key most recently added to sign the tree's roots,
+	// which may not be active yet. GetTreeKeys returns when each key is used.
+	KeyID    string
+	TreeType string
+	// HashAlgorithm is used for the tree's leaves and nodes, and a map's key
+	// hashes, so it sets the depth of a map
+	HashAlgorithm trillian.HashAlgorithm
+	// HashStrategy says how the tree's leaves and nodes are hashed with its
+	// hash algorithm
+	HashStrategy trillian.HashStrategy
+	// SignatureAlgorithm is the algorithm of the key that signs the tree's roots
+	SignatureAlgorithm trillian.SignatureAlgorithm
+	// AllowsDuplicateLeaves is set if DuplicatePolicy is ALLOW_DUPLICATES, and
+	// is the same as it when creating a tree
+	AllowsDuplicateLeaves bool
+	DuplicatePolicy       trillian.DuplicatePolicy
+	HashPrefixes          storage.TreeHashPrefixes
+	// MapStrata are the depths of the strata a map's nodes are stored in, from
+	// the root. If empty the default strata for the hash algorithm are used.
+	MapStrata []int
+	// Deleted is set if the tree has been soft deleted, at DeleteTimeNanos.
+	// Deleted trees aren't served and can't be changed, but can be undeleted
+	// until their data is removed by DeleteTree.
+	Deleted         bool
+	DeleteTimeNanos int64
+}
+
+// TreeKey is a key that signs a tree's roots from its activation time until
+// the next key's.
+type TreeKey struct {
+	KeyID string
+	// PublicKey is the DER encoded public key, nil if it isn't known
+	PublicKey         []byte
+	ActivateTimeNanos int64
+}
+
+// TreeControl holds the settings of a tree that can be changed while it's in
+// use. A read only tree is frozen or archived, it can still be read but not
+// written.
+type TreeControl struct {
+	// TreeState is whether the tree is active, frozen, draining or archived.
+	// It's FROZEN if it's not set and ReadOnlyRequests is, or else ACTIVE, and
+	// should be changed with SetTreeState so ReadOnlyRequests matches it.
+	TreeState               trillian.TreeState
+	ReadOnlyRequests        bool
+	SigningEnabled          bool
+	SequencingEnabled       bool
+	SequenceIntervalSeconds int
+	SignIntervalSeconds     int
+	// SequenceGuardSeconds is how long leaves stay queued before the sequencer
+	// integrates them, so duplicates and cancellations have time to settle.
+	SequenceGuardSeconds int
+	// MaxRootDurationSeconds is how old a tree's latest root can get before it's
+	// re-signed with a new timestamp, so clients can tell an idle tree from a
+	// stalled one. The revision isn't changed. If it's zero the signer's default
+	// interval is used for logs and the map server's max_root_age for maps.
+	MaxRootDurationSeconds int
+	// LeafCompression is how leaf data written to the tree is compressed. Data
+	// already written keeps the compression it was written with. Only MySQL
+	// storage compresses leaf data.
+	LeafCompression storage.LeafCompression
+}
+
+// DefaultTreeControl is the control given to new trees, which are writable.
+var DefaultTreeControl = TreeControl{TreeState: trillian.TreeState_ACTIVE, SigningEnabled: true, SequencingEnabled: true}
+
+// SetTreeState sets the state of the tree, and makes its requests read only if
+// it's frozen or archived.
+func (c *TreeControl) SetTreeState(state trillian.TreeState) {
+	c.TreeState = state
+	c.ReadOnlyRequests = storage.ReadOnlyTreeState(state)
+}
+
+// TreeStatus summarizes the state of a tree.
+type TreeStatus struct {
+	Tree Tree
+	// Control is nil if the tree has no control settings
+	Control *TreeControl
+	// LatestRevision is the revision of the latest root, or -1 if there is none
+	LatestRevision int64
+	// LatestTimestampNanos is when the latest root was created
+	LatestTimestampNanos int64
+	// LatestTreeSize is the size of a log at its latest root
+	LatestTreeSize int64
+	// Unsequenced is the number of leaves queued for a log but not sequenced
+	Unsequenced int64
+}
+
+// TreeStats gives the amount of data held for a tree, for capacity planning.
+// Byte counts are of the data in the tree's rows and don't include indexes or
+// the storage engine's overheads.
+type TreeStats struct {
+	TreeID   int64
+	TreeType string
+	// Leaves is the number of sequenced leaves of a log, or keys of a map
+	Leaves int64
+	// LeafVersions is the number of values held for a map's keys across all
+	// of its revisions
+	LeafVersions int64
+	// Unsequenced is the number of leaves queued for a log but not sequenced
+	Unsequenced int64
+	// Revisions is the number of roots stored
+	Revisions int64
+	// Subtrees is the number of stored subtrees, across all revisions
+	Subtrees int64
+	// OldestRoot and NewestRoot are nil if the tree has no roots
+	OldestRoot, NewestRoot *RootStats
+	LeafBytes              int64
+	UnsequencedBytes       int64
+	SubtreeBytes           int64
+	RootBytes              int64
+}
+
+// RootStats identifies a stored root.
+type RootStats struct {
+	Revision       int64
+	TimestampNanos int64
+}
+
+// TotalBytes returns the total size of the data held for the tree.
+func (s TreeStats) TotalBytes() int64 {
+	return s.LeafBytes + s.UnsequencedBytes + s.SubtreeBytes + s.RootBytes
+}
+
+// TreeAdminStorage creates and configures the trees in a database.
+type TreeAdminStorage struct {
+	db *sql.DB
+}
+
+// NewTreeAdminStorage creates a TreeAdminStorage for the database at dbURL.
+func NewTreeAdminStorage(dbURL string, opts Options) (*TreeAdminStorage, error) {
+	db, err := openDB(dbURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &TreeAdminStorage{db: db}, nil
+}
+
+// CreateTree creates a tree with the given control settings. It fails if the
+// tree ID is already in use.
+func (s *TreeAdminStorage) CreateTree(tree Tree, control TreeControl) error {
+	if tree.TreeType != LogTreeType && tree.TreeType != PreorderedLogTreeType && tree.TreeType != MapTreeType {
+		return fmt.Errorf("unknown tree type: %s", tree.TreeType)
+	}
+	th, err := merkle.NewTreeHasherForStrategy(tree.HashStrategy, tree.HashAlgorithm, tree.HashPrefixes)
+	if err != nil {
+		return err
+	}
+	var strata sql.NullString
+	if len(tree.MapStrata) > 0 {
+		if tree.TreeType != MapTreeType {
+			return fmt.Errorf("only maps have strata, not %s trees", tree.TreeType)
+		}
+		if err := cache.ValidateStrata(th.Size()*8, tree.MapStrata); err != nil {
+			return err
+		}
+		strata = sql.NullString{String: cache.FormatStrata(tree.MapStrata), Valid: true}
+	}
+	if _, ok := trillian.SignatureAlgorithm_name[int32(tree.SignatureAlgorithm)]; !ok {
+		return fmt.Errorf("unknown signature algorithm: %v", tree.SignatureAlgorithm)
+	}
+	if _, ok := trillian.DuplicatePolicy_name[int32(tree.DuplicatePolicy)]; !ok {
+		return fmt.Errorf("unknown duplicate policy: %v", tree.DuplicatePolicy)
+	}
+	policy := tree.DuplicatePolicy
+	if tree.AllowsDuplicateLeaves {
+		policy = trillian.DuplicatePolicy_ALLOW_DUPLICATES
+	}
+	allowDuplicates := policy == trillian.DuplicatePolicy_ALLOW_DUPLICATES
+	hasherType := tree.HashAlgorithm.String()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(insertTreeSQL, tree.TreeID, tree.KeyID, tree.TreeType, hasherType, hasherType, tree.HashStrategy.String(), tree.SignatureAlgorithm.String(), allowDuplicates, policy.String(), tree.HashPrefixes.Leaf, tree.HashPrefixes.Node, strata); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := setTreeControl(tx, tree.TreeID, control); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetTree returns the parameters of a tree, or sql.ErrNoRows if it doesn't exist.
+func (s *TreeAdminStorage) GetTree(treeID int64) (Tree, error) {
+	return scanTree(s.db.QueryRow(selectTreeSQL, treeID))
+}
+
+// ListTrees returns the parameters of every tree, ordered by tree ID.
+func (s *TreeAdminStorage) ListTrees() ([]Tree, error) {
+	rows, err := s.db.Query(selectTreesSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trees []Tree
+	for rows.Next() {
+		tree, err := scanTree(rows)
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, tree)
+	}
+	return trees, rows.Err()
+}
+
+// scanTree reads a tree from a row returned by selectTreeSQL or selectTreesSQL.
+func scanTree(row interface {
+	Scan(dest ...interface{}) error
+}) (Tree, error) {
+	var tree Tree
+	var hasherType, strategyName, signatureName, policyName string
+	var strata sql.NullString
+	var deleteTime sql.NullInt64
+	if err := row.Scan(&tree.TreeID, &tree.KeyID, &tree.TreeType, &hasherType, &strategyName, &signatureName, &tree.AllowsDuplicateLeaves, &policyName, &tree.HashPrefixes.Leaf, &tree.HashPrefixes.Node, &strata, &tree.Deleted, &deleteTime); err != nil {
+		return Tree{}, err
+	}
+	tree.DeleteTimeNanos = deleteTime.Int64
+	mapStrata, err := cache.ParseStrata(strata.String)
+	if err != nil {
+		return Tree{}, fmt.Errorf("tree %d has invalid strata: %v", tree.TreeID, err)
+	}
+	tree.MapStrata = mapStrata
+	alg, ok := trillian.HashAlgorithm_value[hasherType]
+	if !ok {
+		return Tree{}, fmt.Errorf("tree %d has unknown hasher type %q", tree.TreeID, hasherType)
+	}
+	tree.HashAlgorithm = trillian.HashAlgorithm(alg)
+	strategy, ok := trillian.HashStrategy_value[strategyName]
+	if !ok {
+		return Tree{}, fmt.Errorf("tree %d has unknown hash strategy %q", tree.TreeID, strategyName)
+	}
+	tree.HashStrategy = trillian.HashStrategy(strategy)
+	signature, ok := trillian.SignatureAlgorithm_value[signatureName]
+	if !ok {
+		return Tree{}, fmt.Errorf("tree %d has unknown signature algorithm %q", tree.TreeID, signatureName)
+	}
+	tree.SignatureAlgorithm = trillian.SignatureAlgorithm(signature)
+	policy, err := storage.ParseDuplicatePolicy(policyName, tree.AllowsDuplicateLeaves)
+	if err != nil {
+		return Tree{}, fmt.Errorf("tree %d: %v", tree.TreeID, err)
+	}
+	tree.DuplicatePolicy = policy
+	tree.AllowsDuplicateLeaves = policy == trillian.DuplicatePolicy_ALLOW_DUPLICATES
+	return tree, nil
+}
+
+// SetKeyID changes the key used to sign a tree's roots from now on. Roots
+// signed before the change are still signed with the old key. Deleted trees
+// can't be changed.
+func (s *TreeAdminStorage) SetKeyID(treeID int64, keyID string) error {
+	return s.AddTreeKey(treeID, TreeKey{KeyID: keyID, ActivateTimeNanos: time.Now().UnixNano()})
+}
+
+// AddTreeKey adds a key to sign a tree's roots from its activation time,
+// replacing any key with the same activation time, and makes it the tree's
+// KeyID. The key the tree was created with is kept as active since time zero.
+// Deleted trees can't be changed.
+func (s *TreeAdminStorage) AddTreeKey(treeID int64, key TreeKey) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	var keyID string
+	var deleted bool
+	if err := tx.QueryRow(selectTreeForUpdateSQL, treeID).Scan(&keyID, &deleted); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if deleted {
+		tx.Rollback()
+		return storage.ErrTreeDeleted
+	}
+	for _, query := range []struct {
+		sql  string
+		args []interface{}
+	}{
+		{insertFirstTreeKeySQL, []interface{}{treeID, keyID}},
+		{insertTreeKeySQL, []interface{}{treeID, key.KeyID, key.PublicKey, key.ActivateTimeNanos}},
+		{updateTreeKeyIDSQL, []interface{}{key.KeyID, treeID}},
+	} {
+		if _, err := tx.Exec(query.sql, query.args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTreeKeys returns the keys that have signed or will sign a tree's roots,
+// ordered by activation time. A tree which has never had a key added has only
+// the key it was created with. It returns sql.ErrNoRows if the tree doesn't
+// exist.
+func (s *TreeAdminStorage) GetTreeKeys(treeID int64) ([]TreeKey, error) {
+	rows, err := s.db.Query(selectTreeKeysSQL, treeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var treeKeys []TreeKey
+	for rows.Next() {
+		var key TreeKey
+		if err := rows.Scan(&key.KeyID, &key.PublicKey, &key.ActivateTimeNanos); err != nil {
+			return nil, err
+		}
+		treeKeys = append(treeKeys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(treeKeys) > 0 {
+		return treeKeys, nil
+	}
+	tree, err := s.GetTree(treeID)
+	if err != nil {
+		return nil, err
+	}
+	return []TreeKey{{KeyID: tree.KeyID}}, nil
+}
+
+// checkNotDeleted returns sql.ErrNoRows if the tree doesn't exist, or
+// storage.ErrTreeDeleted if it has been soft deleted.
+func (s *TreeAdminStorage) checkNotDeleted(treeID int64) error {
+	tree, err := s.GetTree(treeID)
+	if err != nil {
+		return err
+	}
+	if tree.Deleted {
+		return storage.ErrTreeDeleted
+	}
+	return nil
+}
+
+// SetTreeControl replaces the control settings of a tree. Deleted trees can't
+// be changed.
+func (s *TreeAdminStorage) SetTreeControl(treeID int64, control TreeControl) error {
+	if err := s.checkNotDeleted(treeID); err != nil {
+		return err
+	}
+	return setTreeControl(s.db, treeID, control)
+}
+
+func setTreeControl(db interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, treeID int64, control TreeControl) error {
+	// Trees without a state keep it unset, so it still follows ReadOnlyRequests
+	var state interface{}
+	if control.TreeState != trillian.TreeState_UNKNOWN_TREE_STATE {
+		state = control.TreeState.String()
+	}
+	_, err := db.Exec(setTreeControlSQL, treeID, control.ReadOnlyRequests, control.SigningEnabled, control.SequencingEnabled, control.SequenceIntervalSeconds, control.SignIntervalSeconds, control.SequenceGuardSeconds, control.MaxRootDurationSeconds, int(control.LeafCompression), state)
+	return err
+}
+
+// GetTreeControl returns the control settings of a tree, and false if it has none.
+func (s *TreeAdminStorage) GetTreeControl(treeID int64) (TreeControl, bool, error) {
+	var c TreeControl
+	// The columns allow NULLs, which are read as false or zero
+	var readOnly, signing, sequencing sql.NullBool
+	var sequenceInterval, signInterval, sequenceGuard, maxRootDuration, compression sql.NullInt64
+	var state sql.NullString
+	err := s.db.QueryRow(selectTreeControlSQL, treeID).Scan(&readOnly, &signing, &sequencing, &sequenceInterval, &signInterval, &sequenceGuard, &maxRootDuration, &compression, &state)
+	if err == sql.ErrNoRows {
+		return TreeControl{}, false, nil
+	}
+	if err != nil {
+		return TreeControl{}, false, err
+	}
+	c.ReadOnlyRequests = readOnly.Bool
+	c.SigningEnabled = signing.Bool
+	c.SequencingEnabled = sequencing.Bool
+	c.SequenceIntervalSeconds = int(sequenceInterval.Int64)
+	c.SignIntervalSeconds = int(signInterval.Int64)
+	c.SequenceGuardSeconds = int(sequenceGuard.Int64)
+	c.MaxRootDurationSeconds = int(maxRootDuration.Int64)
+	c.LeafCompression = storage.LeafCompression(compression.Int64)
+	if c.TreeState, err = storage.ParseTreeState(state.String, c.ReadOnlyRequests); err != nil {
+		return TreeControl{}, false, err
+	}
+	return c, true, nil
+}
+
+// GetTreeStatus returns the parameters, settings and latest root of a tree.
+func (s *TreeAdminStorage) GetTreeStatus(treeID int64) (TreeStatus, error) {
+	tree, err := s.GetTree(treeID)
+	if err != nil {
+		return TreeStatus{}, err
+	}
+	status := TreeStatus{Tree: tree, LatestRevision: -1}
+
+	control, ok, err := s.GetTreeControl(treeID)
+	if err != nil {
+		return TreeStatus{}, err
+	}
+	if ok {
+		status.Control = &control
+	}
+
+	switch tree.TreeType {
+	case LogTreeType, PreorderedLogTreeType:
+		err = s.db.QueryRow(selectLatestLogHeadSQL, treeID).Scan(&status.LatestRevision, &status.LatestTreeSize, &status.LatestTimestampNanos)
+		if err == nil || err == sql.ErrNoRows {
+			err = s.db.QueryRow(selectUnsequencedCountSQL, treeID).Scan(&status.Unsequenced)
+		}
+	case MapTreeType:
+		err = s.db.QueryRow(selectLatestMapHeadSQL, treeID).Scan(&status.LatestRevision, &status.LatestTimestampNanos)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return TreeStatus{}, err
+	}
+	return status, nil
+}
+
+// SoftDeleteTree marks a tree as deleted at timestampNanos, so that it's no
+// longer served, without removing its data. It returns storage.ErrTreeDeleted
+// if the tree is already deleted.
+func (s *TreeAdminStorage) SoftDeleteTree(treeID int64, timestampNanos int64) error {
+	if err := s.checkNotDeleted(treeID); err != nil {
+		return err
+	}
+	return s.updateDeleted(softDeleteTreeSQL, storage.ErrTreeDeleted, timestampNanos, treeID)
+}
+
+// UndeleteTree reverses SoftDeleteTree. It returns storage.ErrTreeNotDeleted if
+// the tree isn't deleted.
+func (s *TreeAdminStorage) UndeleteTree(treeID int64) error {
+	tree, err := s.GetTree(treeID)
+	if err != nil {
+		return err
+	}
+	if !tree.Deleted {
+		return storage.ErrTreeNotDeleted
+	}
+	return s.updateDeleted(undeleteTreeSQL, storage.ErrTreeNotDeleted, treeID)
+}
+
+// updateDeleted runs query, which changes whether a tree is deleted, returning
+// errRace if the tree was changed concurrently so that no row was updated.
+func (s *TreeAdminStorage) updateDeleted(query string, errRace error, args ...interface{}) error {
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errRace
+	}
+	return nil
+}
+
+// DeleteTree removes a tree and all of its data. This can't be undone.
+func (s *TreeAdminStorage) DeleteTree(treeID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := deleteTree(tx, treeID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeDeletedTree removes a tree and all of its data if it was soft deleted
+// before deletedBeforeNanos, returning whether it was removed. The tree is
+// locked while it's checked so that it can't be undeleted as it's removed.
+// If purgeData isn't nil it's called while the tree is locked, before the
+// tree is removed, to remove the tree's data from other databases. The tree
+// is left deleted but not removed if it fails, so the purge can be retried.
+func (s *TreeAdminStorage) PurgeDeletedTree(treeID int64, deletedBeforeNanos int64, purgeData func() error) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	var deleted bool
+	var deleteTime sql.NullInt64
+	err = tx.QueryRow(selectTreeDeleteTimeForUpdateSQL, treeID).Scan(&deleted, &deleteTime)
+	if err == sql.ErrNoRows {
+		return false, tx.Rollback()
+	}
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if !deleted || deleteTime.Int64 >= deletedBeforeNanos {
+		return false, tx.Rollback()
+	}
+	if purgeData != nil {
+		if err := purgeData(); err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+	if err := deleteTree(tx, treeID); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func deleteTree(tx *sql.Tx, treeID int64) error {
+	for _, query := range deleteTreeSQL {
+		if _, err := tx.Exec(query, treeID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTreeStats counts the data held for a tree. This reads all of the tree's
+// rows so can be slow for large trees.
+func (s *TreeAdminStorage) GetTreeStats(treeID int64) (TreeStats, error) {
+	tree, err := s.GetTree(treeID)
+	if err != nil {
+		return TreeStats{}, err
+	}
+	stats := TreeStats{TreeID: treeID, TreeType: tree.TreeType}
+
+	headSQL := selectLogHeadStatsSQL
+	if tree.TreeType == MapTreeType {
+		headSQL = selectMapHeadStatsSQL
+	}
+	// The minimums and maximums are NULL if there are no roots
+	var minRevision, maxRevision, minTimestamp, maxTimestamp sql.NullInt64
+	if err := s.db.QueryRow(headSQL, treeID).Scan(&stats.Revisions, &minRevision, &maxRevision, &minTimestamp, &maxTimestamp, &stats.RootBytes); err != nil {
+		return TreeStats{}, err
+	}
+	if stats.Revisions > 0 {
+		stats.OldestRoot = &RootStats{Revision: minRevision.Int64, TimestampNanos: minTimestamp.Int64}
+		stats.NewestRoot = &RootStats{Revision: maxRevision.Int64, TimestampNanos: maxTimestamp.Int64}
+	}
+
+	if err := s.db.QueryRow(selectSubtreeStatsSQL, treeID).Scan(&stats.Subtrees, &stats.SubtreeBytes); err != nil {
+		return TreeStats{}, err
+	}
+
+	switch tree.TreeType {
+	case LogTreeType, PreorderedLogTreeType:
+		var sequencedBytes, leafDataBytes int64
+		if err := s.db.QueryRow(selectSequencedStatsSQL, treeID).Scan(&stats.Leaves, &sequencedBytes); err != nil {
+			return TreeStats{}, err
+		}
+		if err := s.db.QueryRow(selectLeafDataBytesSQL, treeID).Scan(&leafDataBytes); err != nil {
+			return TreeStats{}, err
+		}
+		stats.LeafBytes = sequencedBytes + leafDataBytes
+		if err := s.db.QueryRow(selectUnsequencedStatsSQL, treeID).Scan(&stats.Unsequenced, &stats.UnsequencedBytes); err != nil {
+			return TreeStats{}, err
+		}
+	case MapTreeType:
+		if err := s.db.QueryRow(selectMapLeafStatsSQL, treeID).Scan(&stats.Leaves, &stats.LeafVersions, &stats.LeafBytes); err != nil {
+			return TreeStats{}, err
+		}
+	}
+	return stats, nil
+}
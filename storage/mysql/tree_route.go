@@ -0,0 +1,58 @@
+package mysql
+
+import (
+	"database/sql"
+)
+
+const selectTreeRoutesSQL string = "SELECT TreeId, Backend FROM TreeRoute"
+const setTreeRouteSQL string = `INSERT INTO TreeRoute(TreeId, Backend) VALUES(?, ?)
+	ON DUPLICATE KEY UPDATE Backend=VALUES(Backend)`
+const deleteTreeRouteSQL string = "DELETE FROM TreeRoute WHERE TreeId=?"
+
+// TreeRouteStorage holds the assignment of trees to storage backends, in the
+// TreeRoute table of the database used for administration.
+type TreeRouteStorage struct {
+	db *sql.DB
+}
+
+// NewTreeRouteStorage creates a TreeRouteStorage for the database at dbURL.
+func NewTreeRouteStorage(dbURL string, opts Options) (*TreeRouteStorage, error) {
+	db, err := openDB(dbURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &TreeRouteStorage{db: db}, nil
+}
+
+// GetTreeRoutes returns the backend name for every tree which has been routed,
+// keyed by tree ID.
+func (s *TreeRouteStorage) GetTreeRoutes() (map[int64]string, error) {
+	rows, err := s.db.Query(selectTreeRoutesSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	routes := make(map[int64]string)
+	for rows.Next() {
+		var treeID int64
+		var backend string
+		if err := rows.Scan(&treeID, &backend); err != nil {
+			return nil, err
+		}
+		routes[treeID] = backend
+	}
+	return routes, rows.Err()
+}
+
+// SetTreeRoute assigns a tree to the named backend, replacing any existing route.
+func (s *TreeRouteStorage) SetTreeRoute(treeID int64, backend string) error {
+	_, err := s.db.Exec(setTreeRouteSQL, treeID, backend)
+	return err
+}
+
+// DeleteTreeRoute removes the route for a tree, so it's held by the default backend.
+func (s *TreeRouteStorage) DeleteTreeRoute(treeID int64) error {
+	_, err := s.db.Exec(deleteTreeRouteSQL, treeID)
+	return err
+}
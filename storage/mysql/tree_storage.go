@@ -5,21 +5,34 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/golang/protobuf/proto"
 	"github.com/google/trillian"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/monitoring"
+	"github.com/google/trillian/monitoring/trace"
 	"github.com/google/trillian/storage"
 	"github.com/google/trillian/storage/cache"
+	"github.com/google/trillian/storage/sqlhooks"
 )
 
 // These statements are fixed
 const insertSubtreeMultiSQL string = `INSERT INTO Subtree(TreeId, SubtreeId, Nodes, SubtreeRevision) ` + placeholderSQL
 const insertTreeHeadSQL string = `INSERT INTO TreeHead(TreeId,TreeHeadTimestamp,TreeSize,RootHash,TreeRevision,RootSignature)
 		 VALUES(?,?,?,?,?,?)`
+const selectTreeHashingSQL string = "SELECT TreeHasherType, HashStrategy, LeafHashPrefix, NodeHashPrefix FROM Trees WHERE TreeId=?"
+const selectTreeLeafCompressionSQL string = "SELECT LeafCompression FROM TreeControl WHERE TreeId=?"
+const selectTreeStrataSQL string = "SELECT MapStrata FROM Trees WHERE TreeId=?"
+const selectTreeDeletedSQL string = "SELECT Deleted FROM Trees WHERE TreeId=?"
 const selectTreeRevisionAtSizeSQL string = "SELECT TreeRevision FROM TreeHead WHERE TreeId=? AND TreeSize=? ORDER BY TreeRevision DESC LIMIT 1"
-const selectActiveLogsSQL string = "select TreeId, KeyId from Trees where TreeType='LOG'"
-const selectActiveLogsWithUnsequencedSQL string = "SELECT DISTINCT t.TreeId, t.KeyId from Trees t INNER JOIN Unsequenced u WHERE TreeType='LOG' AND t.TreeId=u.TreeId"
+const selectActiveLogsSQL string = "select TreeId, KeyId from Trees where TreeType IN ('LOG','PREORDERED_LOG') and Deleted=0"
+const selectActiveLogsWithUnsequencedSQL string = `SELECT t.TreeId, t.KeyId FROM Trees t
+		 WHERE t.TreeType IN ('LOG','PREORDERED_LOG') AND t.Deleted=0
+		 AND (EXISTS (SELECT 1 FROM Unsequenced u WHERE u.TreeId=t.TreeId)
+		 OR EXISTS (SELECT 1 FROM StagedLeafData s WHERE s.TreeId=t.TreeId))`
 
 const selectSubtreeSQL string = `SELECT x.SubtreeId, x.MaxRevision, Subtree.Nodes
 				 FROM (SELECT n.SubtreeId, max(n.SubtreeRevision) AS MaxRevision
@@ -37,54 +50,252 @@ const placeholderSQL string = "<placeholder>"
 // mySQLTreeStorage is shared between the mySQLLog- and (forthcoming) mySQLMap-
 // Storage implementations, and contains functionality which is common to both,
 type mySQLTreeStorage struct {
-	treeID          int64
-	db              *sql.DB
-	hashSizeBytes   int
+	treeID        int64
+	db            *sql.DB
+	hashSizeBytes int
+	hashAlgorithm trillian.HashAlgorithm
+	hashStrategy  trillian.HashStrategy
+	hashPrefixes  storage.TreeHashPrefixes
+	// treeHasher hashes the tree's leaves and nodes as configured for it
+	treeHasher      merkle.TreeHasher
 	populateSubtree storage.PopulateSubtreeFunc
+	// leafData converts leaf data to and from what's stored in the database
+	leafData storage.LeafDataCodec
+
+	stmts        *stmtCache
+	treeDepth    int
+	strataDepths []int
+	// txMetrics records the storage's transactions if set
+	txMetrics *TransactionMetrics
+	// latestRevision is the highest root revision seen in the tree, which a
+	// read replica must have reached to serve snapshots, or -1 if it's not
+	// known. It's accessed atomically.
+	latestRevision int64
+	// storedSubtrees caches subtrees read from the database if set
+	storedSubtrees *cache.StoredSubtreeCache
+}
 
-	// Must hold the mutex before manipulating the statement map. Sharing a lock because
-	// it only needs to be held while the statements are built, not while they execute and
-	// this will be a short time. These maps are from the number of placeholder '?'
-	// in the query to the statement that should be used.
-	statementMutex sync.Mutex
-	statements     map[string]map[int]*sql.Stmt
-	strataDepths   []int
+// TransactionMetrics records the number and duration of the storage's
+// transactions. The metrics are created once, by NewTransactionMetrics, and can
+// be shared by any number of storage instances through Options.
+type TransactionMetrics struct {
+	open    monitoring.Gauge
+	latency monitoring.Histogram
 }
 
-func openDB(dbURL string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dbURL)
+// NewTransactionMetrics creates the transaction metrics in mf.
+func NewTransactionMetrics(mf monitoring.MetricFactory) *TransactionMetrics {
+	return &TransactionMetrics{
+		open:    mf.NewGauge("mysql_open_transactions", "Number of tree transactions in progress"),
+		latency: mf.NewHistogram("mysql_transaction_latency_ms", "Time from the start of tree transactions to their end in milliseconds by outcome", "result"),
+	}
+}
+
+func openDB(dbURL string, opts Options) (*sql.DB, error) {
+	vars, err := opts.sessionVariables()
+	if err != nil {
+		glog.Warningf("Bad session variables in MySQL storage options: %s", err)
+		return nil, err
+	}
+
+	var db *sql.DB
+	if opts.StatementHook != nil {
+		db, err = sqlhooks.Open("mysql", dsnWithSessionVariables(dbURL, vars), opts.StatementHook)
+	} else {
+		db, err = sql.Open("mysql", dsnWithSessionVariables(dbURL, vars))
+	}
 	if err != nil {
 		// Don't log uri as it could contain credentials
 		glog.Warningf("Could not open MySQL database, check config: %s", err)
 		return nil, err
 	}
 
-	if _, err := db.Exec("SET sql_mode = 'STRICT_ALL_TABLES'"); err != nil {
-		glog.Warningf("Failed to set strict mode on mysql db: %s", err)
+	// Make sure that a connection can be made with the session variables applied,
+	// rather than failing later on first use
+	if err := db.Ping(); err != nil {
+		glog.Warningf("Failed to connect to mysql db with session variables: %s", err)
 		return nil, err
 	}
 
 	return db, nil
 }
 
-func newTreeStorage(treeID int64, dbURL string, hashSizeBytes int, strataDepths []int, populateSubtree storage.PopulateSubtreeFunc) (*mySQLTreeStorage, error) {
-	db, err := openDB(dbURL)
+func newTreeStorage(treeID int64, dbURL string, opts Options, strata storage.StrataFunc, populate func(merkle.TreeHasher) storage.PopulateSubtreeFunc) (*mySQLTreeStorage, error) {
+	db, err := openDB(dbURL, opts)
+	if err != nil {
+		return &mySQLTreeStorage{}, err
+	}
+
+	if err := checkTreeNotDeleted(db, treeID); err != nil {
+		db.Close()
+		return &mySQLTreeStorage{}, err
+	}
+
+	alg, strategy, prefixes, err := readTreeHashing(db, treeID)
+	if err != nil {
+		db.Close()
+		return &mySQLTreeStorage{}, err
+	}
+
+	th, err := merkle.NewTreeHasherForStrategy(strategy, alg, prefixes)
+	if err != nil {
+		db.Close()
+		return &mySQLTreeStorage{}, fmt.Errorf("tree %d has invalid hashing config: %v", treeID, err)
+	}
+
+	compression, err := readLeafCompression(db, treeID)
+	if err != nil {
+		db.Close()
+		return &mySQLTreeStorage{}, err
+	}
+
+	treeDepth, strataDepths := strata(th.Size())
+	treeStrata, err := readTreeStrata(db, treeID)
 	if err != nil {
+		db.Close()
 		return &mySQLTreeStorage{}, err
 	}
+	if len(treeStrata) > 0 {
+		strataDepths = treeStrata
+	}
+	if err := cache.ValidateStrata(treeDepth, strataDepths); err != nil {
+		db.Close()
+		return &mySQLTreeStorage{}, fmt.Errorf("tree %d has invalid strata: %v", treeID, err)
+	}
 
 	s := mySQLTreeStorage{
 		treeID:          treeID,
 		db:              db,
-		hashSizeBytes:   hashSizeBytes,
-		populateSubtree: populateSubtree,
-		statements:      make(map[string]map[int]*sql.Stmt),
+		hashSizeBytes:   th.Size(),
+		hashAlgorithm:   alg,
+		hashStrategy:    strategy,
+		hashPrefixes:    prefixes,
+		treeHasher:      th,
+		populateSubtree: populate(th),
+		leafData:        storage.LeafDataCodec{Compression: compression, Store: opts.LeafDataStore, ExternalBytes: opts.ExternalLeafDataBytes},
+		stmts:           newStmtCache(db, opts.StatementCacheMetrics),
+		treeDepth:       treeDepth,
 		strataDepths:    strataDepths,
+		txMetrics:       opts.TransactionMetrics,
+		latestRevision:  -1,
+		storedSubtrees:  opts.SubtreeCache,
 	}
 
 	return &s, nil
 }
 
+// rowQuerier is implemented by sql.DB and sql.Tx.
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// checkTreeNotDeleted returns storage.ErrTreeDeleted if the tree has been soft
+// deleted. Trees without a record aren't deleted.
+func checkTreeNotDeleted(q rowQuerier, treeID int64) error {
+	var deleted bool
+	err := q.QueryRow(selectTreeDeletedSQL, treeID).Scan(&deleted)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil
+	case err != nil:
+		return err
+	case deleted:
+		return storage.ErrTreeDeleted
+	}
+	return nil
+}
+
+// readTreeHashing returns the hash algorithm, hash strategy and domain
+// separation prefixes stored in the tree's record. Trees without a record use
+// SHA-256 with the default strategy and prefixes.
+func readTreeHashing(db *sql.DB, treeID int64) (trillian.HashAlgorithm, trillian.HashStrategy, storage.TreeHashPrefixes, error) {
+	var hasherType, strategyName string
+	var prefixes storage.TreeHashPrefixes
+	// TODO: This should not default but it would currently complicate testing and can be
+	// implemented later when the create tree API has been defined.
+	err := db.QueryRow(selectTreeHashingSQL, treeID).Scan(&hasherType, &strategyName, &prefixes.Leaf, &prefixes.Node)
+	switch {
+	case err == sql.ErrNoRows:
+		return trillian.HashAlgorithm_SHA256, trillian.HashStrategy_RFC6962, prefixes, nil
+	case err != nil:
+		glog.Warningf("Failed to read hashing config for tree %d: %s", treeID, err)
+		return 0, 0, storage.TreeHashPrefixes{}, err
+	}
+	alg, ok := trillian.HashAlgorithm_value[hasherType]
+	if !ok {
+		return 0, 0, storage.TreeHashPrefixes{}, fmt.Errorf("tree %d has unknown hasher type %q", treeID, hasherType)
+	}
+	strategy, ok := trillian.HashStrategy_value[strategyName]
+	if !ok {
+		return 0, 0, storage.TreeHashPrefixes{}, fmt.Errorf("tree %d has unknown hash strategy %q", treeID, strategyName)
+	}
+	return trillian.HashAlgorithm(alg), trillian.HashStrategy(strategy), prefixes, nil
+}
+
+// readTreeStrata returns the strata depths stored in the tree's record. Trees
+// without a record, or strata, use the default strata.
+func readTreeStrata(db *sql.DB, treeID int64) ([]int, error) {
+	var strata sql.NullString
+	err := db.QueryRow(selectTreeStrataSQL, treeID).Scan(&strata)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		glog.Warningf("Failed to read strata for tree %d: %s", treeID, err)
+		return nil, err
+	}
+	depths, err := cache.ParseStrata(strata.String)
+	if err != nil {
+		return nil, fmt.Errorf("tree %d has invalid strata: %v", treeID, err)
+	}
+	return depths, nil
+}
+
+// readLeafCompression returns how the tree's leaf data should be compressed.
+// Trees without control settings aren't compressed.
+func readLeafCompression(db *sql.DB, treeID int64) (storage.LeafCompression, error) {
+	var compression sql.NullInt64
+	err := db.QueryRow(selectTreeLeafCompressionSQL, treeID).Scan(&compression)
+	switch {
+	case err == sql.ErrNoRows:
+		return storage.NoCompression, nil
+	case err != nil:
+		glog.Warningf("Failed to read leaf compression for tree %d: %s", treeID, err)
+		return storage.NoCompression, err
+	}
+	c := storage.LeafCompression(compression.Int64)
+	if _, err := storage.CompressLeafData(c, nil); err != nil {
+		return storage.NoCompression, fmt.Errorf("tree %d has invalid leaf compression: %v", treeID, err)
+	}
+	return c, nil
+}
+
+// HashAlgorithm returns the hash algorithm configured for the tree.
+func (m *mySQLTreeStorage) HashAlgorithm() trillian.HashAlgorithm {
+	return m.hashAlgorithm
+}
+
+// HashStrategy returns the hash strategy configured for the tree.
+func (m *mySQLTreeStorage) HashStrategy() trillian.HashStrategy {
+	return m.hashStrategy
+}
+
+// StrataDepths implements storage.MapStrataReader.
+func (m *mySQLTreeStorage) StrataDepths() []int {
+	return m.strataDepths
+}
+
+// HashPrefixes returns the domain separation prefixes configured for the tree.
+func (m *mySQLTreeStorage) HashPrefixes() storage.TreeHashPrefixes {
+	return m.hashPrefixes
+}
+
+// Close closes the tree's connections to the database. Transactions can't be
+// started once it's called.
+func (m *mySQLTreeStorage) Close() error {
+	return m.db.Close()
+}
+
 // expandPlaceholderSQL expands an sql statement by adding a specified number of '?'
 // placeholder slots. At most one placeholder will be expanded.
 func expandPlaceholderSQL(sql string, num int, first, rest string) string {
@@ -146,56 +357,81 @@ func encodeNodeID(n storage.NodeID) ([]byte, error) {
 	return marshalledBytes, nil
 }
 
-// getStmt creates and caches sql.Stmt structs based on the passed in statement
-// and number of bound arguments.
-// TODO(al,martin): consider pulling this all out as a separate unit for reuse
-// elsewhere.
+// getStmt returns the statement, with its placeholder expanded to num values,
+// from the storage's statement cache. Callers should use one of the
+// storage.StatementShapes for num, see getInStmt.
 func (m *mySQLTreeStorage) getStmt(statement string, num int, first, rest string) (*sql.Stmt, error) {
-	m.statementMutex.Lock()
-	defer m.statementMutex.Unlock()
-
-	if m.statements[statement] != nil {
-		if m.statements[statement][num] != nil {
-			// TODO(al,martin): we'll possibly need to expire Stmts from the cache,
-			// e.g. when DB connections break etc.
-			return m.statements[statement][num], nil
-		}
-	} else {
-		m.statements[statement] = make(map[int]*sql.Stmt)
-	}
-
-	s, err := m.db.Prepare(expandPlaceholderSQL(statement, num, first, rest))
+	return m.stmts.get(statement, num, first, rest)
+}
 
+// getInStmt returns the statement to use for an IN clause holding values, and
+// the values padded to fit it. The values must be the first arguments of the
+// statement.
+func (m *mySQLTreeStorage) getInStmt(statement string, values []interface{}) (*sql.Stmt, []interface{}, error) {
+	padded := storage.PadInValues(values)
+	s, err := m.getStmt(statement, len(padded), "?", "?")
 	if err != nil {
-		glog.Warningf("Failed to prepare statement %d: %s", num, err)
-		return nil, err
+		return nil, nil, err
 	}
-
-	m.statements[statement][num] = s
-
-	return s, nil
+	return s, padded, nil
 }
 
-func (m *mySQLTreeStorage) getSubtreeStmt(num int) (*sql.Stmt, error) {
-	return m.getStmt(selectSubtreeSQL, num, "?", "?")
+func (m *mySQLTreeStorage) getSubtreeStmt(nodeIDs []interface{}) (*sql.Stmt, []interface{}, error) {
+	return m.getInStmt(selectSubtreeSQL, nodeIDs)
 }
 
 func (m *mySQLTreeStorage) setSubtreeStmt(num int) (*sql.Stmt, error) {
 	return m.getStmt(insertSubtreeMultiSQL, num, "VALUES(?, ?, ?, ?)", "(?, ?, ?, ?)")
 }
 
+// noteRevision records that the tree has reached revision.
+func (m *mySQLTreeStorage) noteRevision(revision int64) {
+	for {
+		latest := atomic.LoadInt64(&m.latestRevision)
+		if revision <= latest || atomic.CompareAndSwapInt64(&m.latestRevision, latest, revision) {
+			return
+		}
+	}
+}
+
+// isFresh returns whether a read replica whose latest root has revision has
+// caught up with the tree as far as the storage has seen it. If the storage
+// hasn't seen a root yet no replica is fresh, so the primary is read first.
+func (m *mySQLTreeStorage) isFresh(revision int64) bool {
+	latest := atomic.LoadInt64(&m.latestRevision)
+	return latest >= 0 && revision >= latest
+}
+
 func (m *mySQLTreeStorage) beginTreeTx() (treeTX, error) {
 	t, err := m.db.Begin()
 	if err != nil {
 		glog.Warningf("Could not start tree TX: %s", err)
 		return treeTX{}, err
 	}
-	return treeTX{
-		tx:            t,
-		ts:            m,
-		subtreeCache:  cache.NewSubtreeCache(m.strataDepths, m.populateSubtree),
-		writeRevision: -1,
-	}, nil
+	// The tree is checked in every transaction, as storage is kept open and
+	// the tree can be deleted while it is
+	if err := checkTreeNotDeleted(t, m.treeID); err != nil {
+		t.Rollback()
+		return treeTX{}, err
+	}
+	if m.txMetrics != nil {
+		m.txMetrics.open.Inc()
+	}
+	tx := treeTX{
+		tx:                  t,
+		ts:                  m,
+		subtreeCache:        cache.NewSubtreeCacheForDepth(m.treeDepth, m.strataDepths, m.populateSubtree),
+		writeRevision:       -1,
+		rootRevision:        -1,
+		subtreesChangedFrom: -1,
+		start:               time.Now(),
+	}
+	if m.storedSubtrees != nil {
+		// Taken before anything is read, so nothing older than the
+		// transaction's view of the database can be cached
+		tx.subtreeGeneration = m.storedSubtrees.Generation(m.treeID)
+	}
+	return tx, nil
 }
 
 type treeTX struct {
@@ -204,6 +440,59 @@ type treeTX struct {
 	ts            *mySQLTreeStorage
 	subtreeCache  cache.SubtreeCache
 	writeRevision int64
+	// rootRevision is the revision of a root written by the transaction, or -1
+	// if it writes none, which the tree reaches once it's committed. If
+	// revisionReset is set the tree has gone back to an earlier revision.
+	rootRevision  int64
+	revisionReset bool
+	// subtreesChangedFrom is the earliest revision the transaction has written or
+	// deleted subtrees at, or -1 if it hasn't. Subtrees read at that revision or
+	// later aren't added to the storage's stored subtree cache, and are removed
+	// from it once the transaction commits. subtreeGeneration is the cache's
+	// generation for the tree when the transaction began.
+	subtreesChangedFrom int64
+	subtreeGeneration   int64
+	// start is when the transaction began, and ended is set once its end has
+	// been recorded, for its metrics
+	start time.Time
+	ended bool
+	// span is the parent of the spans recorded for the transaction's
+	// operations, if it's being traced
+	span *trace.Span
+}
+
+// SetSpan implements trace.SpanSetter.
+func (t *treeTX) SetSpan(s *trace.Span) {
+	t.span = s
+}
+
+// startSpan starts a span for an operation of the transaction, which is nil if
+// it's not being traced.
+func (t *treeTX) startSpan(name string) *trace.Span {
+	s := t.span.StartChild(name)
+	s.SetTag("tree_id", t.ts.treeID)
+	return s
+}
+
+// recordEnd records the end of the transaction in the storage's metrics, if
+// it has them and it's not already been recorded. result is its outcome, such
+// as "commit".
+func (t *treeTX) recordEnd(result string) {
+	if m := t.ts.txMetrics; m != nil && !t.ended {
+		t.ended = true
+		m.open.Dec()
+		m.latency.Observe(float64(time.Since(t.start).Nanoseconds())/float64(time.Millisecond), result)
+	}
+}
+
+// prepare returns statement, which has no placeholder, from the storage's
+// statement cache for use in the transaction. The caller must close it.
+func (t *treeTX) prepare(statement string) (*sql.Stmt, error) {
+	s, err := t.ts.stmts.get(statement, 0, "", "")
+	if err != nil {
+		return nil, err
+	}
+	return t.tx.Stmt(s), nil
 }
 
 func (t *treeTX) getSubtree(treeRevision int64, nodeID storage.NodeID) (*storage.SubtreeProto, error) {
@@ -221,21 +510,26 @@ func (t *treeTX) getSubtree(treeRevision int64, nodeID storage.NodeID) (*storage
 	}
 }
 
+// GetStoredSubtree implements storage.SubtreeInspector. The subtree's internal
+// nodes aren't populated.
+func (t *treeTX) GetStoredSubtree(treeRevision int64, id storage.NodeID) (*storage.SubtreeProto, error) {
+	return t.getSubtree(treeRevision, id)
+}
+
 func (t *treeTX) getSubtrees(treeRevision int64, nodeIDs []storage.NodeID) ([]*storage.SubtreeProto, error) {
 	if len(nodeIDs) == 0 {
 		return nil, nil
 	}
+	span := t.startSpan("mysql.GetSubtrees")
+	span.SetTag("revision", treeRevision)
+	span.SetTag("subtrees", len(nodeIDs))
+	defer span.Finish()
 
-	tmpl, err := t.ts.getSubtreeStmt(len(nodeIDs))
-	if err != nil {
-		return nil, err
-	}
-	stx := t.tx.Stmt(tmpl)
-	defer stx.Close()
-
-	args := make([]interface{}, 0, len(nodeIDs)+3)
+	ret := make([]*storage.SubtreeProto, 0, len(nodeIDs))
+	ids := make([]interface{}, 0, len(nodeIDs))
+	cached := t.cachesSubtrees(treeRevision)
 
-	// populate args with nodeIDs
+	// populate args with nodeIDs, other than those which are cached
 	for _, nodeID := range nodeIDs {
 		if nodeID.PrefixLenBits%8 != 0 {
 			return nil, fmt.Errorf("invalid subtree ID - not multiple of 8: %d", nodeID.PrefixLenBits)
@@ -243,14 +537,45 @@ func (t *treeTX) getSubtrees(treeRevision int64, nodeIDs []storage.NodeID) ([]*s
 
 		nodeIDBytes := nodeID.Path[:nodeID.PrefixLenBits/8]
 
-		args = append(args, interface{}(nodeIDBytes))
+		if cached {
+			if nodesRaw, ok := t.ts.storedSubtrees.Get(t.ts.treeID, treeRevision, nodeIDBytes); ok {
+				if nodesRaw != nil {
+					subtree, err := unmarshalSubtree(nodesRaw)
+					if err != nil {
+						return nil, err
+					}
+					ret = append(ret, subtree)
+				}
+				continue
+			}
+		}
+
+		ids = append(ids, interface{}(nodeIDBytes))
+	}
+	span.SetTag("cached", len(nodeIDs)-len(ids))
+	if len(ids) == 0 {
+		return ret, nil
+	}
+
+	tmpl, args, err := t.ts.getSubtreeStmt(ids)
+	if err != nil {
+		return nil, err
 	}
 
 	args = append(args, interface{}(t.ts.treeID))
 	args = append(args, interface{}(treeRevision))
 	args = append(args, interface{}(t.ts.treeID))
 
-	rows, err := stx.Query(args...)
+	var rows *sql.Rows
+	if t.readsCommitted(treeRevision) {
+		// The subtrees are the same outside the transaction, so are read on a
+		// connection of their own from the pool
+		rows, err = tmpl.Query(args...)
+	} else {
+		stx := t.tx.Stmt(tmpl)
+		defer stx.Close()
+		rows, err = stx.Query(args...)
+	}
 	if err != nil {
 		glog.Warningf("Failed to get merkle subtrees: %s", err)
 		return nil, err
@@ -263,8 +588,7 @@ func (t *treeTX) getSubtrees(treeRevision int64, nodeIDs []storage.NodeID) ([]*s
 		return nil, rows.Err()
 	}
 
-	ret := make([]*storage.SubtreeProto, 0, len(nodeIDs))
-
+	found := make(map[string]bool)
 	for rows.Next() {
 
 		var subtreeIDBytes []byte
@@ -274,15 +598,30 @@ func (t *treeTX) getSubtrees(treeRevision int64, nodeIDs []storage.NodeID) ([]*s
 			glog.Warningf("Failed to scan merkle subtree: %s", err)
 			return nil, err
 		}
-		var subtree storage.SubtreeProto
-		if err := proto.Unmarshal(nodesRaw, &subtree); err != nil {
-			glog.Warningf("Failed to unmarshal SubtreeProto: %s", err)
+		subtree, err := unmarshalSubtree(nodesRaw)
+		if err != nil {
 			return nil, err
 		}
-		if subtree.Prefix == nil {
-			subtree.Prefix = []byte{}
+		ret = append(ret, subtree)
+
+		if cached {
+			t.ts.storedSubtrees.Add(t.ts.treeID, treeRevision, subtreeRev, t.subtreeGeneration, subtreeIDBytes, nodesRaw)
+			found[string(subtreeIDBytes)] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		glog.Warningf("Failed to read merkle subtrees: %s", err)
+		return nil, err
+	}
+
+	// Subtrees which don't exist at the revision are cached as such too, as they
+	// are common in sparse trees
+	if cached {
+		for _, id := range ids {
+			if nodeIDBytes := id.([]byte); !found[string(nodeIDBytes)] {
+				t.ts.storedSubtrees.Add(t.ts.treeID, treeRevision, 0, t.subtreeGeneration, nodeIDBytes, nil)
+			}
 		}
-		ret = append(ret, &subtree)
 	}
 
 	// The InternalNodes cache is nil here, but the SubtreeCache (which called
@@ -290,15 +629,62 @@ func (t *treeTX) getSubtrees(treeRevision int64, nodeIDs []storage.NodeID) ([]*s
 	return ret, nil
 }
 
+// unmarshalSubtree returns the subtree stored as nodesRaw.
+func unmarshalSubtree(nodesRaw []byte) (*storage.SubtreeProto, error) {
+	var subtree storage.SubtreeProto
+	if err := proto.Unmarshal(nodesRaw, &subtree); err != nil {
+		glog.Warningf("Failed to unmarshal SubtreeProto: %s", err)
+		return nil, err
+	}
+	if subtree.Prefix == nil {
+		subtree.Prefix = []byte{}
+	}
+	return &subtree, nil
+}
+
+// cachesSubtrees returns whether subtrees read at treeRevision are held in the
+// storage's stored subtree cache. Reads at the write revision can see subtrees
+// that haven't been published, and reads at revisions whose subtrees the
+// transaction has changed see its uncommitted changes, so neither are cached.
+func (t *treeTX) cachesSubtrees(treeRevision int64) bool {
+	return t.ts.storedSubtrees != nil && t.readsCommitted(treeRevision)
+}
+
+// readsCommitted returns whether the subtrees the transaction reads at
+// treeRevision are those committed to the database, rather than ones it has
+// written or deleted itself.
+func (t *treeTX) readsCommitted(treeRevision int64) bool {
+	switch {
+	case treeRevision < 0:
+		return false
+	case t.writeRevision >= 0 && treeRevision >= t.writeRevision:
+		return false
+	case t.subtreesChangedFrom >= 0 && treeRevision >= t.subtreesChangedFrom:
+		return false
+	}
+	return true
+}
+
+// changeSubtreesFrom records that the transaction has written or deleted
+// subtrees at revision and later.
+func (t *treeTX) changeSubtreesFrom(revision int64) {
+	if t.subtreesChangedFrom < 0 || revision < t.subtreesChangedFrom {
+		t.subtreesChangedFrom = revision
+	}
+}
+
 func (t *treeTX) storeSubtrees(subtrees []*storage.SubtreeProto) error {
 	if len(subtrees) == 0 {
 		glog.Warning("attempted to store 0 subtrees...")
 		return nil
 	}
+	span := t.startSpan("mysql.StoreSubtrees")
+	span.SetTag("revision", t.writeRevision)
+	span.SetTag("subtrees", len(subtrees))
+	defer span.Finish()
+	t.changeSubtreesFrom(t.writeRevision)
 
-	// TODO(al): probably need to be able to batch this in the case where we have
-	// a really large number of subtrees to store.
-	args := make([]interface{}, 0, len(subtrees))
+	args := make([]interface{}, 0, len(subtrees)*4)
 	for _, s := range subtrees {
 		if s.Prefix == nil {
 			panic(fmt.Errorf("nil prefix on %v", s))
@@ -316,19 +702,31 @@ func (t *treeTX) storeSubtrees(subtrees []*storage.SubtreeProto) error {
 		args = append(args, t.writeRevision)
 	}
 
-	tmpl, err := t.ts.setSubtreeStmt(len(subtrees))
+	// Inserted rows can't be padded, so they're written in batches of the
+	// statement shapes
+	const argsPerSubtree = 4
+	for _, num := range storage.SplitIntoShapes(len(subtrees)) {
+		if err := t.storeSubtreeBatch(num, args[:num*argsPerSubtree]); err != nil {
+			return err
+		}
+		args = args[num*argsPerSubtree:]
+	}
+	return nil
+}
+
+// storeSubtreeBatch inserts num subtrees with args.
+func (t *treeTX) storeSubtreeBatch(num int, args []interface{}) error {
+	tmpl, err := t.ts.setSubtreeStmt(num)
 	if err != nil {
 		return err
 	}
 	stx := t.tx.Stmt(tmpl)
 	defer stx.Close()
 
-	r, err := stx.Exec(args...)
-	if err != nil {
+	if _, err := stx.Exec(args...); err != nil {
 		glog.Warningf("Failed to set merkle subtrees: %s", err)
 		return err
 	}
-	_, err = r.RowsAffected()
 	return nil
 }
 
@@ -370,7 +768,16 @@ func (t *treeTX) GetTreeRevisionAtSize(treeSize int64) (int64, error) {
 }
 
 func (t *treeTX) GetMerkleNodes(treeRevision int64, nodeIDs []storage.NodeID) ([]storage.Node, error) {
+	// The preload runs its fetches concurrently. Committed subtrees are read on
+	// separate connections, but the transaction's connection can only run one
+	// query at a time, so its queries are serialized here.
+	concurrent := t.readsCommitted(treeRevision)
+	var queryMutex sync.Mutex
 	err := t.subtreeCache.Preload(nodeIDs, func(ids []storage.NodeID) ([]*storage.SubtreeProto, error) {
+		if !concurrent {
+			queryMutex.Lock()
+			defer queryMutex.Unlock()
+		}
 		return t.getSubtrees(treeRevision, ids)
 	})
 	if err != nil {
@@ -413,6 +820,8 @@ func (t *treeTX) SetMerkleNodes(nodes []storage.Node) error {
 }
 
 func (t *treeTX) Commit() error {
+	span := t.startSpan("mysql.Commit")
+	defer span.Finish()
 	if t.writeRevision > -1 {
 		t.subtreeCache.Flush(t.storeSubtrees)
 	}
@@ -421,6 +830,18 @@ func (t *treeTX) Commit() error {
 
 	if err != nil {
 		glog.Warningf("TX commit error: %s", err)
+		span.SetError(err)
+		t.recordEnd("commit_failed")
+	} else {
+		t.recordEnd("commit")
+		if t.revisionReset {
+			atomic.StoreInt64(&t.ts.latestRevision, -1)
+		} else if t.rootRevision >= 0 {
+			t.ts.noteRevision(t.rootRevision)
+		}
+		if t.subtreesChangedFrom >= 0 && t.ts.storedSubtrees != nil {
+			t.ts.storedSubtrees.InvalidateTree(t.ts.treeID, t.subtreesChangedFrom)
+		}
 	}
 
 	return err
@@ -432,6 +853,9 @@ func (t *treeTX) Rollback() error {
 
 	if err != nil {
 		glog.Warningf("TX rollback error: %s", err)
+		t.recordEnd("rollback_failed")
+	} else {
+		t.recordEnd("rollback")
 	}
 
 	return err
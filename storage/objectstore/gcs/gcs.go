@@ -0,0 +1,58 @@
+// Package gcs holds objects, such as archive segments and large leaf data, in
+// a Google Cloud Storage bucket.
+package gcs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/net/context"
+)
+
+// Timeout is how long each read or write of an object is allowed to take.
+var Timeout = time.Minute
+
+// ObjectStore keeps each object in a Cloud Storage object named by its name,
+// after an optional prefix.
+type ObjectStore struct {
+	bucket *storage.BucketHandle
+	prefix string
+}
+
+// New creates an ObjectStore that keeps objects in bucket, with names starting
+// with prefix.
+func New(bucket *storage.BucketHandle, prefix string) *ObjectStore {
+	return &ObjectStore{bucket: bucket, prefix: prefix}
+}
+
+// Put stores data under name. The object is only visible once it has been
+// written completely.
+func (o *ObjectStore) Put(name string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	w := o.bucket.Object(o.prefix + name).NewWriter(ctx)
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write object %s: %v", name, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to write object %s: %v", name, err)
+	}
+	return nil
+}
+
+// Get returns the data stored under name.
+func (o *ObjectStore) Get(name string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	r, err := o.bucket.Object(o.prefix + name).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %v", name, err)
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,51 @@
+// Package objectstore opens the stores that hold objects outside of a tree's
+// database, such as archive segments and large leaf data, given by a flag.
+package objectstore
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	gcstorage "cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/google/trillian/storage/archive"
+	"github.com/google/trillian/storage/objectstore/gcs"
+	"github.com/google/trillian/storage/objectstore/s3"
+	"golang.org/x/net/context"
+)
+
+// Open returns the store at location, which is one of:
+//
+//	gs://bucket/prefix for objects in a Google Cloud Storage bucket
+//	s3://bucket/prefix for objects in an Amazon S3 bucket
+//	a local directory, which is created if it doesn't exist
+//
+// Object names follow the prefix, which may be empty. Cloud credentials are
+// found as the standard libraries for each do by default.
+func Open(location string) (archive.ObjectStore, error) {
+	u, err := url.Parse(location)
+	if err != nil || (u.Scheme != "gs" && u.Scheme != "s3") {
+		return archive.NewDirectoryObjectStore(location)
+	}
+	if len(u.Host) == 0 {
+		return nil, fmt.Errorf("object store %q has no bucket", location)
+	}
+	prefix := strings.TrimPrefix(u.Path, "/")
+
+	switch u.Scheme {
+	case "gs":
+		client, err := gcstorage.NewClient(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Cloud Storage client: %v", err)
+		}
+		return gcs.New(client.Bucket(u.Host), prefix), nil
+	default:
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AWS session: %v", err)
+		}
+		return s3.New(awss3.New(sess), u.Host, prefix), nil
+	}
+}
@@ -0,0 +1,36 @@
+package objectstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "objectstore")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := Open(filepath.Join(dir, "leaves"))
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	if err := store.Put("name", []byte("data")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if got, err := ioutil.ReadFile(filepath.Join(dir, "leaves", "name")); err != nil || !bytes.Equal(got, []byte("data")) {
+		t.Errorf("Object file holds %q, %v, want %q", got, err, "data")
+	}
+}
+
+func TestOpenNoBucket(t *testing.T) {
+	for _, location := range []string{"gs:///prefix", "s3://"} {
+		if _, err := Open(location); err == nil {
+			t.Errorf("Open(%q) succeeded, want an error", location)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Package s3 holds objects, such as archive segments and large leaf data, in
+// an Amazon S3 bucket.
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Client is the part of the S3 API used by ObjectStore, which *s3.S3 provides.
+type Client interface {
+	PutObject(*s3.PutObjectInput) (*s3.PutObjectOutput, error)
+	GetObject(*s3.GetObjectInput) (*s3.GetObjectOutput, error)
+}
+
+// ObjectStore keeps each object in an S3 object keyed by its name, after an
+// optional prefix.
+type ObjectStore struct {
+	client Client
+	bucket string
+	prefix string
+}
+
+// New creates an ObjectStore that keeps objects in bucket through client, with
+// keys starting with prefix.
+func New(client Client, bucket, prefix string) *ObjectStore {
+	return &ObjectStore{client: client, bucket: bucket, prefix: prefix}
+}
+
+// Put stores data under name.
+func (o *ObjectStore) Put(name string, data []byte) error {
+	_, err := o.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(o.bucket),
+		Key:    aws.String(o.prefix + name),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write object %s: %v", name, err)
+	}
+	return nil
+}
+
+// Get returns the data stored under name.
+func (o *ObjectStore) Get(name string) ([]byte, error) {
+	out, err := o.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(o.bucket),
+		Key:    aws.String(o.prefix + name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %v", name, err)
+	}
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
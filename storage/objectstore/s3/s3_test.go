@@ -0,0 +1,50 @@
+package s3
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// fakeClient holds objects in memory, keyed by bucket and key.
+type fakeClient map[string][]byte
+
+func (f fakeClient) PutObject(in *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	data, err := ioutil.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f[aws.StringValue(in.Bucket)+"/"+aws.StringValue(in.Key)] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f fakeClient) GetObject(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	data, ok := f[aws.StringValue(in.Bucket)+"/"+aws.StringValue(in.Key)]
+	if !ok {
+		return nil, errors.New(s3.ErrCodeNoSuchKey)
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func TestObjectStore(t *testing.T) {
+	client := make(fakeClient)
+	store := New(client, "bucket", "leaves/")
+
+	if err := store.Put("name", []byte("data")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, ok := client["bucket/leaves/name"]; !ok {
+		t.Errorf("Put stored %v, want the object at leaves/name in bucket", client)
+	}
+	got, err := store.Get("name")
+	if err != nil || !bytes.Equal(got, []byte("data")) {
+		t.Errorf("Get() = %q, %v, want %q", got, err, "data")
+	}
+	if _, err := store.Get("missing"); err == nil {
+		t.Error("Expected Get of a missing object to fail")
+	}
+}
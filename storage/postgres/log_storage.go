@@ -0,0 +1,846 @@
+package postgres
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/cache"
+)
+
+var getTreePropertiesSQL = rebind("SELECT AllowsDuplicateLeaves,DuplicatePolicy,TreeType FROM Trees WHERE TreeId=?")
+var getTreeParametersSQL = rebind("SELECT ReadOnlyRequests,SequenceGuardSeconds,MaxRootDurationSeconds,TreeState FROM TreeControl WHERE TreeId=?")
+var selectQueuedLeavesSQL = rebind(`SELECT LeafHash,Payload,EXTRACT(EPOCH FROM QueueTimestamp::timestamptz)
+		 FROM Unsequenced
+		 WHERE TreeId=? AND QueueTimestamp<=LOCALTIMESTAMP-make_interval(secs => ?)
+		 ORDER BY QueueTimestamp DESC,LeafHash ASC LIMIT ?`)
+var selectOldestQueuedLeafSQL = rebind("SELECT COALESCE(EXTRACT(EPOCH FROM MIN(QueueTimestamp)::timestamptz),0) FROM Unsequenced WHERE TreeId=?")
+var insertUnsequencedLeafSQL = rebind(`INSERT INTO LeafData(TreeId,LeafHash,TheData)
+		 VALUES(?,?,?) ON CONFLICT (TreeId,LeafHash) DO NOTHING`)
+var insertUnsequencedEntrySQL = rebind(`INSERT INTO Unsequenced(TreeId,LeafHash,MessageId,Payload)
+		 VALUES(?,?,?,?)`)
+var insertSequencedLeafSQL = rebind(`INSERT INTO SequencedLeafData(TreeId,LeafHash,SequenceNumber,IntegrateTimestampNanos)
+		 VALUES(?,?,?,?)`)
+var selectLeafAtIndexSQL = rebind(`SELECT l.LeafHash,l.TheData,s.IntegrateTimestampNanos
+		     FROM LeafData l,SequencedLeafData s
+		     WHERE l.LeafHash = s.LeafHash
+		     AND s.SequenceNumber = ? AND l.TreeId = ? AND s.TreeId = l.TreeId`)
+var insertStagedLeafSQL = rebind("INSERT INTO StagedLeafData(TreeId,LeafHash,SequenceNumber) VALUES(?,?,?)")
+var selectStagedLeafAtIndexSQL = rebind(`SELECT l.LeafHash,l.TheData
+		     FROM LeafData l,StagedLeafData s
+		     WHERE l.LeafHash = s.LeafHash
+		     AND s.SequenceNumber = ? AND l.TreeId = ? AND s.TreeId = l.TreeId`)
+var selectStagedLeavesSQL = rebind(`SELECT l.LeafHash,l.TheData,s.SequenceNumber
+		     FROM LeafData l,StagedLeafData s
+		     WHERE l.LeafHash = s.LeafHash
+		     AND s.SequenceNumber >= ? AND l.TreeId = ? AND s.TreeId = l.TreeId
+		     ORDER BY s.SequenceNumber LIMIT ? FOR UPDATE OF s`)
+var deleteStagedLeavesSQL = rebind("DELETE FROM StagedLeafData WHERE TreeId=? AND SequenceNumber>=? AND SequenceNumber<?")
+var selectUnsequencedLeafSQL = rebind("SELECT Payload FROM Unsequenced WHERE TreeId=? AND LeafHash=? LIMIT 1")
+var selectSequencedLeafCountSQL = rebind("SELECT COUNT(*) FROM SequencedLeafData WHERE TreeId=?")
+var selectLeafIndexRangeByTimeSQL = rebind(`SELECT MIN(SequenceNumber),MAX(SequenceNumber)
+		 FROM SequencedLeafData
+		 WHERE TreeId=? AND IntegrateTimestampNanos>=? AND IntegrateTimestampNanos<?`)
+var selectLeafCountBeforeTimeSQL = rebind(`SELECT COUNT(*) FROM SequencedLeafData
+		 WHERE TreeId=? AND IntegrateTimestampNanos<?`)
+var selectLatestSignedLogRootSQL = rebind(`SELECT TreeHeadTimestamp,TreeSize,RootHash,TreeRevision,RootSignature
+		 FROM TreeHead WHERE TreeId=?
+		 ORDER BY TreeRevision DESC LIMIT 1`)
+var selectLogRootCosignaturesSQL = rebind(`SELECT WitnessId,Signature FROM TreeHeadCosignature
+		 WHERE TreeId=? AND TreeRevision=? ORDER BY WitnessId`)
+var insertLogRootCosignatureSQL = rebind(`INSERT INTO TreeHeadCosignature(TreeId,TreeRevision,WitnessId,Signature)
+		 VALUES(?,?,?,?) ON CONFLICT (TreeId, TreeRevision, WitnessId) DO UPDATE SET Signature=EXCLUDED.Signature`)
+var deleteLogRootCosignaturesSQL = rebind("DELETE FROM TreeHeadCosignature WHERE TreeId=? AND TreeRevision=?")
+var refreshTreeHeadSQL = rebind(`UPDATE TreeHead SET TreeHeadTimestamp=?,RootSignature=?
+		 WHERE TreeId=? AND TreeRevision=? AND TreeSize=? AND RootHash=?`)
+var selectLeavesByRangeSQL = rebind(`SELECT l.LeafHash,l.TheData,s.SequenceNumber,s.IntegrateTimestampNanos
+		     FROM LeafData l,SequencedLeafData s
+		     WHERE l.LeafHash = s.LeafHash
+		     AND s.SequenceNumber >= ? AND l.TreeId = ? AND s.TreeId = l.TreeId
+		     ORDER BY s.SequenceNumber LIMIT ?`)
+
+// These statements need to be expanded to provide the correct number of parameter placeholders
+// for a particular case
+const deleteUnsequencedSQL string = "DELETE FROM Unsequenced WHERE LeafHash IN (" + placeholderSQL + ") AND TreeId = ?"
+const selectLeavesByIndexSQL string = `SELECT l.LeafHash,l.TheData,s.SequenceNumber,s.IntegrateTimestampNanos
+		     FROM LeafData l,SequencedLeafData s
+		     WHERE l.LeafHash = s.LeafHash
+		     AND s.SequenceNumber IN (` + placeholderSQL + `) AND l.TreeId = ? AND s.TreeId = l.TreeId`
+const selectLeavesByHashSQL string = `SELECT l.LeafHash,l.TheData,s.SequenceNumber,s.IntegrateTimestampNanos
+		     FROM LeafData l,SequencedLeafData s
+		     WHERE l.LeafHash = s.LeafHash
+		     AND l.LeafHash IN (` + placeholderSQL + `) AND l.TreeId = ? AND s.TreeId = l.TreeId`
+
+// Same as above except with leaves ordered by sequence so we only incur this cost when necessary
+const selectLeavesByHashOrderedBySequenceSQL string = selectLeavesByHashSQL + " ORDER BY s.SequenceNumber"
+
+type postgresLogStorage struct {
+	*postgresTreeStorage
+
+	logID           trillian.LogID
+	allowDuplicates bool
+	duplicatePolicy trillian.DuplicatePolicy
+	preordered      bool
+	readOnly        bool
+	treeState       trillian.TreeState
+	// sequenceGuard is zero if the log uses the sequencer's default
+	sequenceGuard time.Duration
+	// maxRootDuration is zero if the log uses the signer's default
+	maxRootDuration time.Duration
+}
+
+// NewLogStorage creates a LogStorage for the log id in the Postgres database at dbURL.
+func NewLogStorage(id trillian.LogID, dbURL string) (storage.LogStorage, error) {
+	return NewLogStorageWithOptions(id, dbURL, Options{})
+}
+
+// NewLogStorageWithOptions creates a LogStorage for the log id in the Postgres
+// database at dbURL, configured with the supplied options.
+func NewLogStorageWithOptions(id trillian.LogID, dbURL string, opts Options) (storage.LogStorage, error) {
+	ts, err := newTreeStorage(id.TreeID, dbURL, opts, storage.LogStrata, cache.PopulateLogSubtreeNodes)
+	if err != nil {
+		glog.Warningf("Couldn't create a new treeStorage: %s", err)
+		return nil, err
+	}
+
+	s := postgresLogStorage{
+		postgresTreeStorage: ts,
+		logID:               id,
+	}
+
+	// Logs without a Trees row merge duplicates, as in the MySQL storage
+	var policyName, treeType string
+	if err := s.db.QueryRow(getTreePropertiesSQL, id.TreeID).Scan(&s.allowDuplicates, &policyName, &treeType); err != nil && err != sql.ErrNoRows {
+		glog.Warningf("Failed to get trees row for id %v: %s", id, err)
+		s.db.Close()
+		return nil, err
+	}
+	if s.duplicatePolicy, err = storage.ParseDuplicatePolicy(policyName, s.allowDuplicates); err != nil {
+		glog.Warningf("Tree %v has a bad duplicate policy: %s", id, err)
+		s.db.Close()
+		return nil, err
+	}
+	s.allowDuplicates = s.duplicatePolicy == trillian.DuplicatePolicy_ALLOW_DUPLICATES
+	s.preordered = treeType == trillian.TreeType_PREORDERED_LOG.String()
+
+	var readOnly sql.NullBool
+	var sequenceGuard, maxRootDuration sql.NullInt64
+	var stateName sql.NullString
+	err = s.db.QueryRow(getTreeParametersSQL, id.TreeID).Scan(&readOnly, &sequenceGuard, &maxRootDuration, &stateName)
+	switch {
+	case err == sql.ErrNoRows:
+		glog.Warningf("*** Opening storage for log: %v but it has no params configured ***", id)
+	case err != nil:
+		glog.Warningf("Failed to get tree control for id %v: %s", id, err)
+		s.db.Close()
+		return nil, err
+	}
+	if s.treeState, err = storage.ParseTreeState(stateName.String, readOnly.Bool); err != nil {
+		glog.Warningf("Tree %v has a bad state: %s", id, err)
+		s.db.Close()
+		return nil, err
+	}
+	s.readOnly = storage.ReadOnlyTreeState(s.treeState)
+	s.sequenceGuard = time.Duration(sequenceGuard.Int64) * time.Second
+	s.maxRootDuration = time.Duration(maxRootDuration.Int64) * time.Second
+
+	return &s, nil
+}
+
+// MaxRootDuration returns how old the log's latest root can get before it's re-signed.
+func (m *postgresLogStorage) MaxRootDuration() time.Duration {
+	return m.maxRootDuration
+}
+
+// SequenceGuard returns how long leaves stay queued before they're sequenced.
+func (m *postgresLogStorage) SequenceGuard() time.Duration {
+	return m.sequenceGuard
+}
+
+// DuplicatePolicy returns what the log does with leaves already in it.
+func (m *postgresLogStorage) DuplicatePolicy() trillian.DuplicatePolicy {
+	return m.duplicatePolicy
+}
+
+// TreeState returns whether the log is active, frozen, draining or archived.
+func (m *postgresLogStorage) TreeState() trillian.TreeState {
+	return m.treeState
+}
+
+// TreeType returns whether the log is pre-ordered.
+func (m *postgresLogStorage) TreeType() trillian.TreeType {
+	if m.preordered {
+		return trillian.TreeType_PREORDERED_LOG
+	}
+	return trillian.TreeType_LOG
+}
+
+func (m *postgresLogStorage) getLeavesByIndexStmt(indices []interface{}) (*sql.Stmt, []interface{}, error) {
+	return m.getInStmt(selectLeavesByIndexSQL, indices)
+}
+
+func (m *postgresLogStorage) getLeavesByHashStmt(hashes []interface{}, orderBySequence bool) (*sql.Stmt, []interface{}, error) {
+	if orderBySequence {
+		return m.getInStmt(selectLeavesByHashOrderedBySequenceSQL, hashes)
+	}
+
+	return m.getInStmt(selectLeavesByHashSQL, hashes)
+}
+
+func (m *postgresLogStorage) getDeleteUnsequencedStmt(hashes []interface{}) (*sql.Stmt, []interface{}, error) {
+	return m.getInStmt(deleteUnsequencedSQL, hashes)
+}
+
+func (m *postgresLogStorage) beginInternal() (storage.LogTX, error) {
+	ttx, err := m.beginTreeTx()
+	if err != nil {
+		return nil, err
+	}
+	ret := &logTX{
+		treeTX: ttx,
+		ls:     m,
+	}
+
+	root, err := ret.LatestSignedLogRoot()
+	if err != nil {
+		ttx.Rollback()
+		return nil, err
+	}
+
+	ret.treeTX.writeRevision = root.TreeRevision + 1
+
+	return ret, nil
+}
+
+func (m *postgresLogStorage) Begin() (storage.LogTX, error) {
+	// Reject attempts to start a writable transaction in read only mode. Anything that
+	// doesn't write is a part of Snapshot so is still available via that API.
+	if m.readOnly {
+		return nil, storage.ErrReadOnly
+	}
+
+	return m.beginInternal()
+}
+
+func (m *postgresLogStorage) Snapshot() (storage.ReadOnlyLogTX, error) {
+	tx, err := m.beginInternal()
+	if err != nil {
+		return nil, err
+	}
+	return tx.(storage.ReadOnlyLogTX), err
+}
+
+type logTX struct {
+	treeTX
+	ls *postgresLogStorage
+}
+
+func (t *logTX) WriteRevision() int64 {
+	return t.treeTX.writeRevision
+}
+
+func (t *logTX) DequeueLeaves(limit int, guardWindow time.Duration) ([]trillian.LogLeaf, error) {
+	rows, err := t.tx.Query(selectQueuedLeavesSQL, t.ls.logID.TreeID, guardWindow.Seconds(), limit)
+	if err != nil {
+		glog.Warningf("Failed to select rows for work: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	leaves := make([]trillian.LogLeaf, 0, limit)
+	for rows.Next() {
+		var leafHash []byte
+		var payload []byte
+		var queueTimestamp float64
+
+		if err := rows.Scan(&leafHash, &payload, &queueTimestamp); err != nil {
+			glog.Warningf("Error scanning work rows: %s", err)
+			return nil, err
+		}
+
+		if len(leafHash) != t.ts.hashSizeBytes {
+			return nil, errors.New("Dequeued a leaf with incorrect hash size")
+		}
+
+		leaves = append(leaves, trillian.LogLeaf{
+			Leaf: trillian.Leaf{
+				LeafHash:  leafHash,
+				LeafValue: payload,
+			},
+			QueueTimestampNanos: int64(queueTimestamp * float64(time.Second)),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// The connection can't run another statement until the rows are closed
+	rows.Close()
+
+	// The convention is that if leaf processing succeeds (by committing this tx)
+	// then the unsequenced entries for them are removed
+	if len(leaves) > 0 {
+		if err := t.removeSequencedLeaves(leaves); err != nil {
+			return nil, err
+		}
+	}
+
+	return leaves, nil
+}
+
+func (t *logTX) QueueLeaves(leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
+	// Don't accept batches if any of the leaves are invalid.
+	for _, leaf := range leaves {
+		if len(leaf.LeafHash) != t.ts.hashSizeBytes {
+			return nil, fmt.Errorf("Queued leaf must have a hash of length %d", t.ts.hashSizeBytes)
+		}
+	}
+
+	existing := make([]*trillian.LogLeaf, len(leaves))
+	if !t.ls.allowDuplicates {
+		var err error
+		if existing, err = t.findDuplicates(leaves); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, leaf := range leaves {
+		if existing[i] != nil {
+			continue
+		}
+
+		// The leaf data is shared by duplicates of the leaf, so it's only inserted once
+		if _, err := t.tx.Exec(insertUnsequencedLeafSQL, t.ls.logID.TreeID, []byte(leaf.LeafHash), leaf.LeafValue); err != nil {
+			glog.Warningf("Error inserting into LeafData: %s", err)
+			return nil, err
+		}
+
+		// Message ids only need to guard against duplicates for the time that entries are
+		// in the unsequenced queue, which should be short, but we'll still use a strong hash.
+		hasher := sha256.New()
+
+		// We use a fixed zero message id if the log disallows duplicates otherwise a random one.
+		// Duplicates have been skipped above, but the fixed id still collides if another
+		// transaction queues the same leaf concurrently, so only one of them will succeed.
+		messageIDBytes := make([]byte, 8)
+
+		if t.ls.allowDuplicates {
+			if _, err := rand.Read(messageIDBytes); err != nil {
+				glog.Warningf("Failed to get a random message id: %s", err)
+				return nil, err
+			}
+		}
+
+		hasher.Write(messageIDBytes)
+		hasher.Write(t.ls.logID.LogID)
+		hasher.Write(leaf.LeafHash)
+		messageID := hasher.Sum(nil)
+
+		if _, err := t.tx.Exec(insertUnsequencedEntrySQL, t.ls.logID.TreeID, []byte(leaf.LeafHash), messageID, leaf.LeafValue); err != nil {
+			glog.Warningf("Error inserting into Unsequenced: %s", err)
+			return nil, err
+		}
+	}
+
+	return existing, nil
+}
+
+// findDuplicates returns the existing leaf for each of leaves whose hash is
+// already sequenced or queued, or is earlier in leaves, and nil for the others.
+// It's only used for logs that don't allow duplicates, so each hash is in the
+// log at most once.
+func (t *logTX) findDuplicates(leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
+	existing := make([]*trillian.LogLeaf, len(leaves))
+	if len(leaves) == 0 {
+		return existing, nil
+	}
+
+	hashes := make([]trillian.Hash, 0, len(leaves))
+	for _, leaf := range leaves {
+		hashes = append(hashes, leaf.LeafHash)
+	}
+	sequenced, err := t.GetLeavesByHash(hashes, false)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]*trillian.LogLeaf)
+	for i := range sequenced {
+		found[string(sequenced[i].LeafHash)] = &sequenced[i]
+	}
+
+	for i, leaf := range leaves {
+		if dup, ok := found[string(leaf.LeafHash)]; ok {
+			existing[i] = dup
+			continue
+		}
+
+		var payload []byte
+		err := t.tx.QueryRow(selectUnsequencedLeafSQL, t.ls.logID.TreeID, []byte(leaf.LeafHash)).Scan(&payload)
+		switch {
+		case err == sql.ErrNoRows:
+			// Any later leaves with the same hash are duplicates of this one
+			found[string(leaf.LeafHash)] = &trillian.LogLeaf{Leaf: leaf.Leaf, SequenceNumber: -1}
+		case err != nil:
+			glog.Warningf("Error reading from Unsequenced: %s", err)
+			return nil, err
+		default:
+			existing[i] = &trillian.LogLeaf{Leaf: trillian.Leaf{LeafHash: leaf.LeafHash, LeafValue: payload}, SequenceNumber: -1}
+			found[string(leaf.LeafHash)] = existing[i]
+		}
+	}
+
+	return existing, nil
+}
+
+func (t *logTX) GetSequencedLeafCount() (int64, error) {
+	var sequencedLeafCount int64
+
+	err := t.tx.QueryRow(selectSequencedLeafCountSQL, t.ls.logID.TreeID).Scan(&sequencedLeafCount)
+
+	if err != nil {
+		glog.Warningf("Error getting sequenced leaf count: %s", err)
+	}
+
+	return sequencedLeafCount, err
+}
+
+func (t *logTX) GetLeavesByIndex(leaves []int64) ([]trillian.LogLeaf, error) {
+	indices := make([]interface{}, 0, len(leaves))
+	for _, index := range leaves {
+		indices = append(indices, interface{}(index))
+	}
+	tmpl, args, err := t.ls.getLeavesByIndexStmt(indices)
+	if err != nil {
+		return nil, err
+	}
+	stx := t.tx.Stmt(tmpl)
+	defer stx.Close()
+	args = append(args, interface{}(t.ls.logID.TreeID))
+	rows, err := stx.Query(args...)
+	if err != nil {
+		glog.Warningf("Failed to get leaves by idx: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]trillian.LogLeaf, len(leaves))
+	num := 0
+	for rows.Next() {
+		if num == len(ret) {
+			return nil, fmt.Errorf("expected %d leaves, but saw more", len(leaves))
+		}
+		if err := rows.Scan(&ret[num].LeafHash, &ret[num].LeafValue, &ret[num].SequenceNumber, &ret[num].IntegrateTimestampNanos); err != nil {
+			glog.Warningf("Failed to scan merkle leaves: %s", err)
+			return nil, err
+		}
+
+		if got, want := len(ret[num].LeafHash), t.ts.hashSizeBytes; got != want {
+			return nil, fmt.Errorf("Scanned leaf does not have hash length %d, got %d", want, got)
+		}
+
+		num++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if num != len(leaves) {
+		return nil, fmt.Errorf("expected %d leaves, but saw %d", len(leaves), num)
+	}
+	return ret, nil
+}
+
+func (t *logTX) GetLeavesByRange(start, count int64) ([]trillian.LogLeaf, error) {
+	if start < 0 || count <= 0 {
+		return nil, fmt.Errorf("invalid range start=%d count=%d", start, count)
+	}
+	rows, err := t.tx.Query(selectLeavesByRangeSQL, start, t.ls.logID.TreeID, count)
+	if err != nil {
+		glog.Warningf("Failed to get leaves by range: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]trillian.LogLeaf, 0, count)
+	for rows.Next() {
+		var leaf trillian.LogLeaf
+		if err := rows.Scan(&leaf.LeafHash, &leaf.LeafValue, &leaf.SequenceNumber, &leaf.IntegrateTimestampNanos); err != nil {
+			glog.Warningf("Failed to scan merkle leaves: %s", err)
+			return nil, err
+		}
+
+		if got, want := len(leaf.LeafHash), t.ts.hashSizeBytes; got != want {
+			return nil, fmt.Errorf("Scanned leaf does not have hash length %d, got %d", want, got)
+		}
+		// Leaves are sequenced without gaps so the range is contiguous
+		if got, want := leaf.SequenceNumber, start+int64(len(ret)); got != want {
+			return nil, fmt.Errorf("expected leaf at index %d, but saw %d", want, got)
+		}
+
+		ret = append(ret, leaf)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (t *logTX) GetLeafIndexRangeByTime(startNanos, endNanos int64) (int64, int64, error) {
+	var first, last sql.NullInt64
+
+	err := t.tx.QueryRow(selectLeafIndexRangeByTimeSQL, t.ls.logID.TreeID, startNanos, endNanos).Scan(&first, &last)
+
+	if err != nil {
+		glog.Warningf("Error getting leaf index range by time: %s", err)
+		return 0, 0, err
+	}
+
+	return storage.LeafIndexRange(first.Int64, last.Int64, first.Valid && last.Valid, func() (int64, error) {
+		var count int64
+		err := t.tx.QueryRow(selectLeafCountBeforeTimeSQL, t.ls.logID.TreeID, startNanos).Scan(&count)
+		if err != nil {
+			glog.Warningf("Error getting leaf count before time: %s", err)
+		}
+		return count, err
+	})
+}
+
+func (t *logTX) GetLeavesByHash(leafHashes []trillian.Hash, orderBySequence bool) ([]trillian.LogLeaf, error) {
+	hashes := make([]interface{}, 0, len(leafHashes))
+	for _, hash := range leafHashes {
+		hashes = append(hashes, interface{}([]byte(hash)))
+	}
+	tmpl, args, err := t.ls.getLeavesByHashStmt(hashes, orderBySequence)
+	if err != nil {
+		return nil, err
+	}
+	stx := t.tx.Stmt(tmpl)
+	defer stx.Close()
+	args = append(args, interface{}(t.ls.logID.TreeID))
+	rows, err := stx.Query(args...)
+	if err != nil {
+		glog.Warningf("Failed to get leaves by hash: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	// The tree could include duplicates so we don't know how many results will be returned
+	ret := make([]trillian.LogLeaf, 0)
+	for rows.Next() {
+		leaf := trillian.LogLeaf{}
+
+		if err := rows.Scan(&leaf.LeafHash, &leaf.LeafValue, &leaf.SequenceNumber, &leaf.IntegrateTimestampNanos); err != nil {
+			glog.Warningf("Failed to scan merkle leaves: %s", err)
+			return nil, err
+		}
+
+		if got, want := len(leaf.LeafHash), t.ls.hashSizeBytes; got != want {
+			return nil, fmt.Errorf("Scanned leaf does not have hash length %d, got %d", want, got)
+		}
+
+		ret = append(ret, leaf)
+	}
+
+	return ret, rows.Err()
+}
+
+func (t *logTX) LatestSignedLogRoot() (trillian.SignedLogRoot, error) {
+	var timestamp, treeSize, treeRevision int64
+	var rootHash, rootSignatureBytes []byte
+	var rootSignature trillian.DigitallySigned
+
+	err := t.tx.QueryRow(
+		selectLatestSignedLogRootSQL, t.ls.logID.TreeID).Scan(
+		&timestamp, &treeSize, &rootHash, &treeRevision, &rootSignatureBytes)
+
+	// It's possible there are no roots for this tree yet
+	if err == sql.ErrNoRows {
+		return trillian.SignedLogRoot{}, nil
+	} else if err != nil {
+		glog.Warningf("Failed to read latest root: %v", err)
+		return trillian.SignedLogRoot{}, err
+	}
+
+	keySignatures, err := storage.UnmarshalRootSignature(rootSignatureBytes, &rootSignature)
+	if err != nil {
+		glog.Warningf("Failed to unmarshall root signature: %v", err)
+		return trillian.SignedLogRoot{}, err
+	}
+
+	return trillian.SignedLogRoot{
+		RootHash:       rootHash,
+		TimestampNanos: timestamp,
+		TreeRevision:   treeRevision,
+		Signature:      &rootSignature,
+		KeySignatures:  keySignatures,
+		LogId:          t.ls.logID.LogID,
+		TreeSize:       treeSize,
+	}, nil
+}
+
+func (t *logTX) GetLogRootCosignatures(treeRevision int64) ([]trillian.Cosignature, error) {
+	rows, err := t.tx.Query(selectLogRootCosignaturesSQL, t.ls.logID.TreeID, treeRevision)
+	if err != nil {
+		glog.Warningf("Failed to read cosignatures: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []trillian.Cosignature
+	for rows.Next() {
+		var witnessID string
+		var signatureBytes []byte
+		if err := rows.Scan(&witnessID, &signatureBytes); err != nil {
+			return nil, err
+		}
+		var signature trillian.DigitallySigned
+		if err := proto.Unmarshal(signatureBytes, &signature); err != nil {
+			glog.Warningf("Failed to unmarshal cosignature: %v", err)
+			return nil, err
+		}
+		ret = append(ret, trillian.Cosignature{WitnessId: witnessID, Signature: &signature})
+	}
+	return ret, rows.Err()
+}
+
+func (t *logTX) StoreLogRootCosignature(treeRevision int64, cosig trillian.Cosignature) error {
+	signatureBytes, err := proto.Marshal(cosig.Signature)
+	if err != nil {
+		glog.Warningf("Failed to marshal cosignature: %v %v", cosig.Signature, err)
+		return err
+	}
+
+	if _, err := t.tx.Exec(insertLogRootCosignatureSQL, t.ls.logID.TreeID, treeRevision, cosig.WitnessId, signatureBytes); err != nil {
+		glog.Warningf("Failed to store cosignature: %s", err)
+		return err
+	}
+	return nil
+}
+
+func (t *logTX) StoreSignedLogRoot(root trillian.SignedLogRoot) error {
+	signatureBytes, err := storage.MarshalRootSignature(root.Signature, root.KeySignatures)
+
+	if err != nil {
+		glog.Warningf("Failed to marshal root signature: %v %v", root.Signature, err)
+		return err
+	}
+
+	res, err := t.tx.Exec(insertTreeHeadSQL, t.ls.logID.TreeID, root.TimestampNanos, root.TreeSize,
+		root.RootHash, root.TreeRevision, signatureBytes)
+
+	if err != nil {
+		glog.Warningf("Failed to store signed root: %s", err)
+	}
+
+	return checkResultOkAndRowCountIs(res, err, 1)
+}
+
+func (t *logTX) RefreshSignedLogRoot(root trillian.SignedLogRoot) error {
+	signatureBytes, err := storage.MarshalRootSignature(root.Signature, root.KeySignatures)
+	if err != nil {
+		glog.Warningf("Failed to marshal root signature: %v %v", root.Signature, err)
+		return err
+	}
+
+	res, err := t.tx.Exec(refreshTreeHeadSQL, root.TimestampNanos, signatureBytes, t.ls.logID.TreeID,
+		root.TreeRevision, root.TreeSize, root.RootHash)
+	if err != nil {
+		glog.Warningf("Failed to refresh signed root: %s", err)
+	}
+	if err := checkResultOkAndRowCountIs(res, err, 1); err != nil {
+		return err
+	}
+
+	if _, err := t.tx.Exec(deleteLogRootCosignaturesSQL, t.ls.logID.TreeID, root.TreeRevision); err != nil {
+		glog.Warningf("Failed to delete cosignatures of refreshed root: %s", err)
+		return err
+	}
+	return nil
+}
+
+func (t *logTX) OldestQueuedLeafTimestampNanos() (int64, error) {
+	var oldest float64
+	if err := t.tx.QueryRow(selectOldestQueuedLeafSQL, t.ls.logID.TreeID).Scan(&oldest); err != nil {
+		glog.Warningf("Failed to get oldest queued leaf: %s", err)
+		return 0, err
+	}
+	return int64(oldest * float64(time.Second)), nil
+}
+
+func (t *logTX) UpdateSequencedLeaves(leaves []trillian.LogLeaf) error {
+	for _, leaf := range leaves {
+		// This should fail on insert but catch it early
+		if len(leaf.LeafHash) != t.ts.hashSizeBytes {
+			return errors.New("Sequenced leaf has incorrect hash size")
+		}
+
+		_, err := t.tx.Exec(insertSequencedLeafSQL, t.ls.logID.TreeID, []byte(leaf.LeafHash),
+			leaf.SequenceNumber, leaf.IntegrateTimestampNanos)
+
+		if err != nil {
+			glog.Warningf("Failed to update sequenced leaves: %s", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddSequencedLeaves stages leaves at their sequence numbers, except for those
+// whose index already holds a leaf, until they're integrated.
+func (t *logTX) AddSequencedLeaves(leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
+	for _, leaf := range leaves {
+		if len(leaf.LeafHash) != t.ts.hashSizeBytes {
+			return nil, errors.New("Sequenced leaf has incorrect hash size")
+		}
+		if leaf.SequenceNumber < 0 {
+			return nil, fmt.Errorf("invalid sequence number %d", leaf.SequenceNumber)
+		}
+	}
+
+	existing := make([]*trillian.LogLeaf, len(leaves))
+	for i, leaf := range leaves {
+		dup, err := t.leafAtIndex(leaf.SequenceNumber)
+		if err != nil {
+			return nil, err
+		}
+		if dup != nil {
+			existing[i] = dup
+			continue
+		}
+
+		if _, err := t.tx.Exec(insertUnsequencedLeafSQL, t.ls.logID.TreeID, []byte(leaf.LeafHash), leaf.LeafValue); err != nil {
+			glog.Warningf("Error inserting into LeafData: %s", err)
+			return nil, err
+		}
+		if _, err := t.tx.Exec(insertStagedLeafSQL, t.ls.logID.TreeID, []byte(leaf.LeafHash), leaf.SequenceNumber); err != nil {
+			glog.Warningf("Error inserting into StagedLeafData: %s", err)
+			return nil, err
+		}
+	}
+
+	return existing, nil
+}
+
+// leafAtIndex returns the leaf integrated or staged at index, or nil if there
+// isn't one.
+func (t *logTX) leafAtIndex(index int64) (*trillian.LogLeaf, error) {
+	leaf := trillian.LogLeaf{SequenceNumber: index}
+	err := t.tx.QueryRow(selectLeafAtIndexSQL, index, t.ls.logID.TreeID).Scan(&leaf.LeafHash, &leaf.LeafValue, &leaf.IntegrateTimestampNanos)
+	if err == sql.ErrNoRows {
+		err = t.tx.QueryRow(selectStagedLeafAtIndexSQL, index, t.ls.logID.TreeID).Scan(&leaf.LeafHash, &leaf.LeafValue)
+	}
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		glog.Warningf("Failed to read leaf %d: %s", index, err)
+		return nil, err
+	}
+	return &leaf, nil
+}
+
+// DequeueSequencedLeaves returns the staged leaves at contiguous indices from
+// start, up to limit of them, and removes them from StagedLeafData.
+func (t *logTX) DequeueSequencedLeaves(start int64, limit int) ([]trillian.LogLeaf, error) {
+	rows, err := t.tx.Query(selectStagedLeavesSQL, start, t.ls.logID.TreeID, limit)
+	if err != nil {
+		glog.Warningf("Failed to select staged leaves: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []trillian.LogLeaf
+	for rows.Next() {
+		var leaf trillian.LogLeaf
+		if err := rows.Scan(&leaf.LeafHash, &leaf.LeafValue, &leaf.SequenceNumber); err != nil {
+			glog.Warningf("Failed to scan staged leaves: %s", err)
+			return nil, err
+		}
+		// Only the leaves before the first gap can be integrated
+		if leaf.SequenceNumber != start+int64(len(ret)) {
+			break
+		}
+		ret = append(ret, leaf)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(ret) == 0 {
+		return ret, nil
+	}
+	result, err := t.tx.Exec(deleteStagedLeavesSQL, t.ls.logID.TreeID, start, start+int64(len(ret)))
+	if err := checkResultOkAndRowCountIs(result, err, int64(len(ret))); err != nil {
+		glog.Warningf("Failed to delete staged leaves: %s", err)
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (t *logTX) removeSequencedLeaves(leaves []trillian.LogLeaf) error {
+	hashes := make([]interface{}, 0, len(leaves))
+	for _, leaf := range leaves {
+		hashes = append(hashes, interface{}([]byte(leaf.LeafHash)))
+	}
+	tmpl, args, err := t.ls.getDeleteUnsequencedStmt(hashes)
+	if err != nil {
+		glog.Warningf("Failed to get delete statement for sequenced work: %s", err)
+		return err
+	}
+	stx := t.tx.Stmt(tmpl)
+	defer stx.Close()
+	args = append(args, interface{}(t.ls.logID.TreeID))
+	result, err := stx.Exec(args...)
+
+	if err != nil {
+		// Error is handled by checkResultOkAndRowCountIs() below
+		glog.Warningf("Failed to delete sequenced work: %s", err)
+	}
+
+	return checkResultOkAndRowCountIs(result, err, int64(len(leaves)))
+}
+
+func (t *logTX) getActiveLogIDsInternal(sql string) ([]trillian.LogID, error) {
+	rows, err := t.tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logIDs := make([]trillian.LogID, 0)
+	for rows.Next() {
+		var logID []byte
+		var treeID int64
+
+		if err := rows.Scan(&treeID, &logID); err != nil {
+			return []trillian.LogID{}, err
+		}
+
+		logIDs = append(logIDs, trillian.LogID{LogID: logID, TreeID: treeID})
+	}
+
+	if rows.Err() != nil {
+		return []trillian.LogID{}, rows.Err()
+	}
+
+	return logIDs, nil
+}
+
+// GetActiveLogIDs returns a list of the IDs of all configured logs
+func (t *logTX) GetActiveLogIDs() ([]trillian.LogID, error) {
+	return t.getActiveLogIDsInternal(selectActiveLogsSQL)
+}
+
+// GetActiveLogIDsWithPendingWork returns a list of the IDs of all configured logs
+// that have queued or staged leaves that need to be integrated
+func (t *logTX) GetActiveLogIDsWithPendingWork() ([]trillian.LogID, error) {
+	return t.getActiveLogIDsInternal(selectActiveLogsWithUnsequencedSQL)
+}
@@ -0,0 +1,1151 @@
+package postgres
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/cache"
+)
+
+var insertMapHeadSQL = rebind(`INSERT INTO MapHead(TreeId, MapHeadTimestamp, RootHash, MapRevision, RootSignature, MapperData)
+	VALUES(?, ?, ?, ?, ?, ?)`)
+
+var refreshMapHeadSQL = rebind(`UPDATE MapHead SET MapHeadTimestamp=?, RootSignature=?
+		 WHERE TreeId=? AND MapRevision=? AND RootHash=?`)
+
+var selectLatestSignedMapRootSQL = rebind(`SELECT MapHeadTimestamp, RootHash, MapRevision, RootSignature, MapperData
+		 FROM MapHead WHERE TreeId=?
+		 ORDER BY MapRevision DESC LIMIT 1`)
+var selectSignedMapRootSQL = rebind(`SELECT MapHeadTimestamp, RootHash, MapRevision, RootSignature, MapperData
+		 FROM MapHead WHERE TreeId=? AND MapRevision=?`)
+
+var insertMapLeafSQL = rebind(`INSERT INTO MapLeaf(TreeId, KeyHash, MapRevision, TheData) VALUES (?, ?, ?, ?)`)
+
+const insertMapLeafMultiSQL = `INSERT INTO MapLeaf(TreeId, KeyHash, MapRevision, TheData) ` + placeholderSQL
+
+// Note that MapRevision is stored negated, so the latest revision at or before
+// the one asked for has the lowest stored value at or above its negation.
+const selectMapLeafSQL string = `SELECT DISTINCT ON (KeyHash) KeyHash, MapRevision, TheData
+	 FROM MapLeaf
+	 WHERE KeyHash IN (` + placeholderSQL + `) AND
+	       TreeId = ? AND
+	       MapRevision >= ?
+	 ORDER BY KeyHash, MapRevision`
+
+var selectChangedMapLeavesSQL = rebind(`SELECT KeyHash, TheData FROM MapLeaf
+	 WHERE TreeId=? AND MapRevision=?
+	 ORDER BY KeyHash`)
+
+// The leaves of a map at a revision are the latest rows for each key at or
+// before it, picked in the same way as by selectMapLeafSQL.
+var selectMapLeavesAtRevisionSQL = rebind(`SELECT DISTINCT ON (KeyHash) KeyHash, TheData FROM MapLeaf
+	 WHERE TreeId=? AND KeyHash>? AND MapRevision>=?
+	 ORDER BY KeyHash, MapRevision LIMIT ?`)
+
+var insertMapStagedHeadSQL = rebind(`INSERT INTO MapStagedHead(TreeId, MapRevision, RootHash, StagedTimestamp, MapperData)
+	VALUES(?, ?, ?, ?, ?)`)
+var selectMapStagedHeadSQL = rebind(`SELECT MapRevision, RootHash, StagedTimestamp, MapperData
+	 FROM MapStagedHead WHERE TreeId=?`)
+var deleteMapStagedHeadSQL = rebind("DELETE FROM MapStagedHead WHERE TreeId=? AND MapRevision=?")
+
+// Note that MapRevision is stored negated in MapLeaf but SubtreeRevision is not
+var deleteMapLeavesAtRevisionSQL = rebind("DELETE FROM MapLeaf WHERE TreeId=? AND MapRevision=?")
+var deleteSubtreesAtRevisionSQL = rebind("DELETE FROM Subtree WHERE TreeId=? AND SubtreeRevision=?")
+
+// These statements are used to revert a map to an earlier revision. The data for
+// later revisions is copied into the Abandoned tables and then removed. The
+// revert timestamps are cast as Postgres can't tell their type from the SELECT.
+var selectMapHeadRevisionCountSQL = rebind("SELECT COUNT(*) FROM MapHead WHERE TreeId=? AND MapRevision=?")
+var insertMapHeadRevertSQL = rebind(`INSERT INTO MapHeadRevert(TreeId, RevertTimestamp, FromRevision, ToRevision, Reason)
+	VALUES(?, ?, ?, ?, ?)`)
+var selectMaxRevertedRevisionSQL = rebind("SELECT COALESCE(MAX(FromRevision), 0) FROM MapHeadRevert WHERE TreeId=?")
+var selectMapHeadRevertsSQL = rebind(`SELECT RevertTimestamp, FromRevision, ToRevision, Reason
+	 FROM MapHeadRevert WHERE TreeId=?
+	 ORDER BY RevertTimestamp ASC`)
+var abandonMapHeadsSQL = rebind(`INSERT INTO AbandonedMapHead(TreeId, RevertTimestamp, MapHeadTimestamp, RootHash, MapRevision, RootSignature, MapperData)
+	SELECT TreeId, CAST(? AS BIGINT), MapHeadTimestamp, RootHash, MapRevision, RootSignature, MapperData
+	FROM MapHead WHERE TreeId=? AND MapRevision>?`)
+var deleteMapHeadsAfterRevisionSQL = rebind("DELETE FROM MapHead WHERE TreeId=? AND MapRevision>?")
+
+// Note that MapRevision is stored negated, so later revisions are less than the negated revision
+var abandonMapLeavesSQL = rebind(`INSERT INTO AbandonedMapLeaf(TreeId, RevertTimestamp, KeyHash, MapRevision, TheData)
+	SELECT TreeId, CAST(? AS BIGINT), KeyHash, MapRevision, TheData
+	FROM MapLeaf WHERE TreeId=? AND MapRevision<?`)
+var deleteMapLeavesAfterRevisionSQL = rebind("DELETE FROM MapLeaf WHERE TreeId=? AND MapRevision<?")
+var abandonSubtreesSQL = rebind(`INSERT INTO AbandonedSubtree(TreeId, RevertTimestamp, SubtreeId, Nodes, SubtreeRevision)
+	SELECT TreeId, CAST(? AS BIGINT), SubtreeId, Nodes, SubtreeRevision
+	FROM Subtree WHERE TreeId=? AND SubtreeRevision>?`)
+var deleteSubtreesAfterRevisionSQL = rebind("DELETE FROM Subtree WHERE TreeId=? AND SubtreeRevision>?")
+var abandonMapRevisionTagsSQL = rebind(`INSERT INTO AbandonedMapRevisionTag(TreeId, RevertTimestamp, Tag, MapRevision, TagTimestamp)
+	SELECT TreeId, ?, Tag, MapRevision, TagTimestamp
+	FROM MapRevisionTag WHERE TreeId=? AND MapRevision>?`)
+var deleteMapRevisionTagsAfterRevisionSQL = rebind("DELETE FROM MapRevisionTag WHERE TreeId=? AND MapRevision>?")
+var selectAbandonedMapRevisionTagsSQL = rebind("SELECT RevertTimestamp, Tag, MapRevision FROM AbandonedMapRevisionTag WHERE TreeId=?")
+
+var insertMapRevisionTagSQL = rebind(`INSERT INTO MapRevisionTag(TreeId, Tag, MapRevision, TagTimestamp)
+	VALUES(?, ?, ?, ?)`)
+var selectMapRevisionForTagSQL = rebind("SELECT MapRevision FROM MapRevisionTag WHERE TreeId=? AND Tag=?")
+var selectMapRevisionTagsSQL = rebind("SELECT Tag, MapRevision FROM MapRevisionTag WHERE TreeId=?")
+
+var selectTreeRetentionSQL = rebind("SELECT MaxRevisions, MaxAgeSeconds, OldestRetainedRevision FROM TreeRetention WHERE TreeId=?")
+var setTreeRetentionPolicySQL = rebind(`INSERT INTO TreeRetention(TreeId, MaxRevisions, MaxAgeSeconds) VALUES(?, ?, ?)
+	ON CONFLICT (TreeId) DO UPDATE SET MaxRevisions=EXCLUDED.MaxRevisions, MaxAgeSeconds=EXCLUDED.MaxAgeSeconds`)
+var setOldestRetainedRevisionSQL = rebind(`INSERT INTO TreeRetention(TreeId, OldestRetainedRevision) VALUES(?, ?)
+	ON CONFLICT (TreeId) DO UPDATE SET OldestRetainedRevision=GREATEST(TreeRetention.OldestRetainedRevision, EXCLUDED.OldestRetainedRevision)`)
+var selectEarliestMapRevisionSinceSQL = rebind("SELECT MIN(MapRevision) FROM MapHead WHERE TreeId=? AND MapHeadTimestamp>=?")
+var deleteMapHeadsBeforeRevisionSQL = rebind("DELETE FROM MapHead WHERE TreeId=? AND MapRevision<?")
+
+// Archivable data at a revision is that which has been superseded by a write at a
+// later revision no later than the oldest retained revision. Note that MapRevision
+// is stored negated in MapLeaf so the comparisons are reversed there.
+var selectArchivableMapLeavesSQL = rebind(`SELECT l.KeyHash, l.TheData FROM MapLeaf l
+	 WHERE l.TreeId=? AND l.MapRevision=? AND EXISTS (
+	   SELECT 1 FROM MapLeaf n
+	   WHERE n.TreeId=l.TreeId AND n.KeyHash=l.KeyHash AND n.MapRevision<l.MapRevision AND n.MapRevision>=?)`)
+var deleteArchivableMapLeavesSQL = rebind(`DELETE FROM MapLeaf l USING MapLeaf n
+	 WHERE n.TreeId=l.TreeId AND n.KeyHash=l.KeyHash
+	 AND l.TreeId=? AND l.MapRevision=? AND n.MapRevision<l.MapRevision AND n.MapRevision>=?`)
+var selectArchivableSubtreesSQL = rebind(`SELECT s.SubtreeId, s.Nodes FROM Subtree s
+	 WHERE s.TreeId=? AND s.SubtreeRevision=? AND EXISTS (
+	   SELECT 1 FROM Subtree n
+	   WHERE n.TreeId=s.TreeId AND n.SubtreeId=s.SubtreeId AND n.SubtreeRevision>s.SubtreeRevision AND n.SubtreeRevision<=?)`)
+var deleteArchivableSubtreesSQL = rebind(`DELETE FROM Subtree s USING Subtree n
+	 WHERE n.TreeId=s.TreeId AND n.SubtreeId=s.SubtreeId
+	 AND s.TreeId=? AND s.SubtreeRevision=? AND n.SubtreeRevision>s.SubtreeRevision AND n.SubtreeRevision<=?`)
+
+// Superseded data below a revision is that written before it which has been
+// overwritten at a later revision no later than it.
+var deleteSupersededMapLeavesSQL = rebind(`DELETE FROM MapLeaf l USING MapLeaf n
+	 WHERE n.TreeId=l.TreeId AND n.KeyHash=l.KeyHash
+	 AND l.TreeId=? AND l.MapRevision>? AND n.MapRevision<l.MapRevision AND n.MapRevision>=?`)
+var deleteSupersededSubtreesSQL = rebind(`DELETE FROM Subtree s USING Subtree n
+	 WHERE n.TreeId=s.TreeId AND n.SubtreeId=s.SubtreeId
+	 AND s.TreeId=? AND s.SubtreeRevision<? AND n.SubtreeRevision>s.SubtreeRevision AND n.SubtreeRevision<=?`)
+
+var insertArchivedRevisionSQL = rebind(`INSERT INTO ArchivedRevision(TreeId, MapRevision, SegmentName) VALUES(?, ?, ?)
+	ON CONFLICT (TreeId, MapRevision) DO UPDATE SET SegmentName=EXCLUDED.SegmentName`)
+var selectArchivedRevisionsSQL = rebind("SELECT MapRevision, SegmentName FROM ArchivedRevision WHERE TreeId=?")
+var restoreMapLeafSQL = rebind("INSERT INTO MapLeaf(TreeId, KeyHash, MapRevision, TheData) VALUES(?, ?, ?, ?) ON CONFLICT DO NOTHING")
+var restoreSubtreeSQL = rebind("INSERT INTO Subtree(TreeId, SubtreeId, Nodes, SubtreeRevision) VALUES(?, ?, ?, ?) ON CONFLICT DO NOTHING")
+var insertRestoredRevisionSQL = rebind(`INSERT INTO RestoredRevision(TreeId, MapRevision, ExpiresTimestamp) VALUES(?, ?, ?)
+	ON CONFLICT (TreeId, MapRevision) DO UPDATE SET ExpiresTimestamp=EXCLUDED.ExpiresTimestamp`)
+var selectRestoredRevisionsSQL = rebind("SELECT MapRevision, ExpiresTimestamp FROM RestoredRevision WHERE TreeId=?")
+var selectRestoredRevisionCountSQL = rebind("SELECT COUNT(*) FROM RestoredRevision WHERE TreeId=? AND MapRevision>=?")
+var deleteRestoredRevisionSQL = rebind("DELETE FROM RestoredRevision WHERE TreeId=? AND MapRevision=?")
+
+// maxTagLength is the size of the Tag column
+const maxTagLength = 255
+
+type postgresMapStorage struct {
+	*postgresTreeStorage
+
+	mapID trillian.MapID
+}
+
+func (m *postgresMapStorage) MapID() trillian.MapID {
+	return m.mapID
+}
+
+// NewMapStorage creates a MapStorage for the map id in the Postgres database at dbURL.
+func NewMapStorage(id trillian.MapID, dbURL string) (storage.MapStorage, error) {
+	return NewMapStorageWithOptions(id, dbURL, Options{})
+}
+
+// NewMapStorageWithOptions creates a MapStorage for the map id in the Postgres
+// database at dbURL, configured with the supplied options. Maps are stored in
+// the same strata as in the MySQL storage.
+func NewMapStorageWithOptions(id trillian.MapID, dbURL string, opts Options) (storage.MapStorage, error) {
+	ts, err := newTreeStorage(id.TreeID, dbURL, opts, storage.MapStrata, cache.PopulateMapSubtreeNodes)
+	if err != nil {
+		glog.Warningf("Couldn't create a new treeStorage: %s", err)
+		return nil, err
+	}
+
+	return &postgresMapStorage{
+		postgresTreeStorage: ts,
+		mapID:               id,
+	}, nil
+}
+
+func (m *postgresMapStorage) Begin() (storage.MapTX, error) {
+	ttx, err := m.beginTreeTx()
+	if err != nil {
+		return nil, err
+	}
+	ret := &mapTX{
+		treeTX: ttx,
+		ms:     m,
+	}
+
+	root, err := ret.LatestSignedMapRoot()
+	if err != nil {
+		ttx.Rollback()
+		return nil, err
+	}
+
+	// Revisions abandoned by a revert are never written again
+	var reverted int64
+	if err := ret.tx.QueryRow(selectMaxRevertedRevisionSQL, m.mapID.TreeID).Scan(&reverted); err != nil {
+		ttx.Rollback()
+		return nil, err
+	}
+	ret.treeTX.writeRevision = root.MapRevision + 1
+	if reverted >= ret.treeTX.writeRevision {
+		ret.treeTX.writeRevision = reverted + 1
+	}
+
+	return ret, nil
+}
+
+func (m *postgresMapStorage) Snapshot() (storage.ReadOnlyMapTX, error) {
+	tx, err := m.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return tx.(storage.ReadOnlyMapTX), err
+}
+
+type mapTX struct {
+	treeTX
+	ms *postgresMapStorage
+}
+
+func (m *mapTX) WriteRevision() int64 {
+	return m.treeTX.writeRevision
+}
+
+func (m *mapTX) Set(keyHash trillian.Hash, value trillian.MapLeaf) error {
+	flatValue, err := proto.Marshal(&value)
+	if err != nil {
+		return err
+	}
+
+	// Note: MapRevision is stored negated:
+	_, err = m.tx.Exec(insertMapLeafSQL, m.ms.mapID.TreeID, []byte(keyHash), -m.writeRevision, flatValue)
+	return err
+}
+
+func (m *postgresMapStorage) setMapLeafStmt(num int) (*sql.Stmt, error) {
+	return m.getStmt(insertMapLeafMultiSQL, num, "VALUES(?, ?, ?, ?)", "(?, ?, ?, ?)")
+}
+
+func (m *mapTX) SetLeaves(leaves []trillian.MapLeaf) error {
+	const argsPerLeaf = 4
+	args := make([]interface{}, 0, len(leaves)*argsPerLeaf)
+	for i := range leaves {
+		flatValue, err := proto.Marshal(&leaves[i])
+		if err != nil {
+			return err
+		}
+		// Note: MapRevision is stored negated:
+		args = append(args, m.ms.mapID.TreeID, []byte(leaves[i].KeyHash), -m.writeRevision, flatValue)
+	}
+
+	// Inserted rows can't be padded, so they're written in batches of the
+	// statement shapes
+	for _, num := range storage.SplitIntoShapes(len(leaves)) {
+		if err := m.setLeafBatch(num, args[:num*argsPerLeaf]); err != nil {
+			return err
+		}
+		args = args[num*argsPerLeaf:]
+	}
+	return nil
+}
+
+// setLeafBatch inserts num leaves with args.
+func (m *mapTX) setLeafBatch(num int, args []interface{}) error {
+	tmpl, err := m.ms.setMapLeafStmt(num)
+	if err != nil {
+		return err
+	}
+	stx := m.tx.Stmt(tmpl)
+	defer stx.Close()
+
+	if _, err := stx.Exec(args...); err != nil {
+		glog.Warningf("Failed to set map leaves: %s", err)
+		return err
+	}
+	return nil
+}
+
+// restoredFrom reports whether any revision from revision on has been
+// restored from archive.
+func (m *mapTX) restoredFrom(revision int64) (bool, error) {
+	var restored int64
+	if err := m.tx.QueryRow(selectRestoredRevisionCountSQL, m.ms.mapID.TreeID, revision).Scan(&restored); err != nil {
+		return false, err
+	}
+	return restored > 0, nil
+}
+
+// checkReadable returns a RevisionOutOfRangeError if revision has been pruned
+// and has not been restored from archive.
+func (m *mapTX) checkReadable(revision int64) error {
+	oldest, err := m.OldestRetainedRevision()
+	if err != nil {
+		return err
+	}
+	return storage.CheckRevisionReadable(revision, oldest, m.restoredFrom)
+}
+
+func (m *mapTX) Get(revision int64, keyHashes []trillian.Hash) ([]trillian.MapLeaf, error) {
+	if revision >= 0 {
+		if err := m.checkReadable(revision); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(keyHashes) == 0 {
+		return nil, nil
+	}
+	hashes := make([]interface{}, 0, len(keyHashes))
+	for _, k := range keyHashes {
+		hashes = append(hashes, []byte(k))
+	}
+	stmt, args, err := m.ms.getInStmt(selectMapLeafSQL, hashes)
+	if err != nil {
+		return nil, err
+	}
+	stx := m.tx.Stmt(stmt)
+	defer stx.Close()
+
+	// Note: MapRevision is negated when stored to cause more recent revisions to
+	// appear earlier in query results.
+	args = append(args, m.ms.mapID.TreeID, -revision)
+
+	rows, err := stx.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]trillian.MapLeaf, 0, len(keyHashes))
+	for rows.Next() {
+		var mapKeyHash trillian.Hash
+		var mapRevision int64
+		var flatData []byte
+		if err := rows.Scan(&mapKeyHash, &mapRevision, &flatData); err != nil {
+			return nil, err
+		}
+		// Leaves set to an empty value have been deleted
+		if len(flatData) == 0 {
+			continue
+		}
+		var mapLeaf trillian.MapLeaf
+		if err := proto.Unmarshal(flatData, &mapLeaf); err != nil {
+			return nil, err
+		}
+		mapLeaf.KeyHash = mapKeyHash
+		ret = append(ret, mapLeaf)
+	}
+	return ret, rows.Err()
+}
+
+func (m *mapTX) GetChangedLeaves(revision int64) ([]trillian.MapLeaf, error) {
+	if err := m.checkReadable(revision); err != nil {
+		return nil, err
+	}
+
+	// Note: MapRevision is stored negated.
+	rows, err := m.tx.Query(selectChangedMapLeavesSQL, m.ms.mapID.TreeID, -revision)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []trillian.MapLeaf
+	for rows.Next() {
+		var keyHash trillian.Hash
+		var flatData []byte
+		if err := rows.Scan(&keyHash, &flatData); err != nil {
+			return nil, err
+		}
+		var mapLeaf trillian.MapLeaf
+		if err := proto.Unmarshal(flatData, &mapLeaf); err != nil {
+			return nil, err
+		}
+		mapLeaf.KeyHash = keyHash
+		ret = append(ret, mapLeaf)
+	}
+	return ret, rows.Err()
+}
+
+func (m *mapTX) ListLeaves(revision int64, afterKeyHash trillian.Hash, count int) ([]trillian.MapLeaf, error) {
+	if err := m.checkReadable(revision); err != nil {
+		return nil, err
+	}
+
+	// A nil key hash would be NULL, which no key hash sorts after
+	after := []byte(afterKeyHash)
+	if after == nil {
+		after = []byte{}
+	}
+	// Note: MapRevision is stored negated.
+	rows, err := m.tx.Query(selectMapLeavesAtRevisionSQL, m.ms.mapID.TreeID, after, -revision, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]trillian.MapLeaf, 0, count)
+	for rows.Next() {
+		var keyHash trillian.Hash
+		var flatData []byte
+		if err := rows.Scan(&keyHash, &flatData); err != nil {
+			return nil, err
+		}
+		var mapLeaf trillian.MapLeaf
+		if err := proto.Unmarshal(flatData, &mapLeaf); err != nil {
+			return nil, err
+		}
+		mapLeaf.KeyHash = keyHash
+		ret = append(ret, mapLeaf)
+	}
+	return ret, rows.Err()
+}
+
+// unmarshalMapperMetadata decodes stored mapper metadata, which is nil if
+// there's none.
+func unmarshalMapperMetadata(b []byte) (*trillian.MapperMetadata, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	mapperMeta := &trillian.MapperMetadata{}
+	if err := proto.Unmarshal(b, mapperMeta); err != nil {
+		glog.Warningf("Failed to unmarshal Metadata; %v", err)
+		return nil, err
+	}
+	return mapperMeta, nil
+}
+
+// marshalMapperMetadata encodes mapper metadata for storage.
+func marshalMapperMetadata(mapperMeta *trillian.MapperMetadata) ([]byte, error) {
+	if mapperMeta == nil {
+		return nil, nil
+	}
+	b, err := proto.Marshal(mapperMeta)
+	if err != nil {
+		glog.Warningf("Failed to marshal MetaData: %v %v", mapperMeta, err)
+		return nil, err
+	}
+	return b, nil
+}
+
+// scanMapRoot reads a root selected from MapHead. ok is false if no root was
+// selected.
+func (m *mapTX) scanMapRoot(row *sql.Row) (root trillian.SignedMapRoot, ok bool, err error) {
+	var timestamp, mapRevision int64
+	var rootHash, rootSignatureBytes, mapperMetaBytes []byte
+	var rootSignature trillian.DigitallySigned
+
+	err = row.Scan(&timestamp, &rootHash, &mapRevision, &rootSignatureBytes, &mapperMetaBytes)
+	if err == sql.ErrNoRows {
+		return trillian.SignedMapRoot{}, false, nil
+	} else if err != nil {
+		glog.Warningf("Failed to read map root: %v", err)
+		return trillian.SignedMapRoot{}, false, err
+	}
+
+	keySignatures, err := storage.UnmarshalRootSignature(rootSignatureBytes, &rootSignature)
+	if err != nil {
+		glog.Warningf("Failed to unmarshal root signature: %v", err)
+		return trillian.SignedMapRoot{}, false, err
+	}
+
+	mapperMeta, err := unmarshalMapperMetadata(mapperMetaBytes)
+	if err != nil {
+		return trillian.SignedMapRoot{}, false, err
+	}
+
+	return trillian.SignedMapRoot{
+		RootHash:       rootHash,
+		TimestampNanos: timestamp,
+		MapRevision:    mapRevision,
+		Signature:      &rootSignature,
+		KeySignatures:  keySignatures,
+		MapId:          m.ms.mapID.MapID,
+		Metadata:       mapperMeta,
+	}, true, nil
+}
+
+func (m *mapTX) LatestSignedMapRoot() (trillian.SignedMapRoot, error) {
+	// It's possible there are no roots for this tree yet
+	root, _, err := m.scanMapRoot(m.tx.QueryRow(selectLatestSignedMapRootSQL, m.ms.mapID.TreeID))
+	return root, err
+}
+
+func (m *mapTX) GetSignedMapRoot(revision int64) (trillian.SignedMapRoot, error) {
+	root, ok, err := m.scanMapRoot(m.tx.QueryRow(selectSignedMapRootSQL, m.ms.mapID.TreeID, revision))
+	if err != nil || ok {
+		return root, err
+	}
+
+	// The roots of pruned revisions are removed
+	oldest, err := m.OldestRetainedRevision()
+	if err != nil {
+		return trillian.SignedMapRoot{}, err
+	}
+	if revision < oldest {
+		return trillian.SignedMapRoot{}, storage.RevisionOutOfRangeError{Revision: revision, OldestRetained: oldest}
+	}
+	return trillian.SignedMapRoot{}, storage.ErrMapRootNotFound
+}
+
+func (m *mapTX) StoreSignedMapRoot(root trillian.SignedMapRoot) error {
+	signatureBytes, err := storage.MarshalRootSignature(root.Signature, root.KeySignatures)
+	if err != nil {
+		glog.Warningf("Failed to marshal root signature: %v %v", root.Signature, err)
+		return err
+	}
+
+	mapperMetaBytes, err := marshalMapperMetadata(root.Metadata)
+	if err != nil {
+		return err
+	}
+
+	res, err := m.tx.Exec(insertMapHeadSQL, m.ms.mapID.TreeID, root.TimestampNanos, root.RootHash, root.MapRevision, signatureBytes, mapperMetaBytes)
+	if err != nil {
+		glog.Warningf("Failed to store signed map root: %s", err)
+	}
+
+	return checkResultOkAndRowCountIs(res, err, 1)
+}
+
+func (m *mapTX) RefreshSignedMapRoot(root trillian.SignedMapRoot) error {
+	signatureBytes, err := storage.MarshalRootSignature(root.Signature, root.KeySignatures)
+	if err != nil {
+		glog.Warningf("Failed to marshal root signature: %v %v", root.Signature, err)
+		return err
+	}
+
+	res, err := m.tx.Exec(refreshMapHeadSQL, root.TimestampNanos, signatureBytes, m.ms.mapID.TreeID, root.MapRevision, root.RootHash)
+	if err != nil {
+		glog.Warningf("Failed to refresh signed map root: %s", err)
+	}
+
+	return checkResultOkAndRowCountIs(res, err, 1)
+}
+
+func (m *mapTX) StagedSignedMapRoot() (trillian.SignedMapRoot, bool, error) {
+	var timestamp, mapRevision int64
+	var rootHash, mapperMetaBytes []byte
+
+	err := m.tx.QueryRow(selectMapStagedHeadSQL, m.ms.mapID.TreeID).Scan(
+		&mapRevision, &rootHash, &timestamp, &mapperMetaBytes)
+	if err == sql.ErrNoRows {
+		return trillian.SignedMapRoot{}, false, nil
+	} else if err != nil {
+		glog.Warningf("Failed to read staged map root: %v", err)
+		return trillian.SignedMapRoot{}, false, err
+	}
+
+	mapperMeta, err := unmarshalMapperMetadata(mapperMetaBytes)
+	if err != nil {
+		return trillian.SignedMapRoot{}, false, err
+	}
+
+	return trillian.SignedMapRoot{
+		RootHash:       rootHash,
+		TimestampNanos: timestamp,
+		MapRevision:    mapRevision,
+		MapId:          m.ms.mapID.MapID,
+		Metadata:       mapperMeta,
+	}, true, nil
+}
+
+func (m *mapTX) StageSignedMapRoot(root trillian.SignedMapRoot) error {
+	if root.MapRevision != m.writeRevision {
+		return fmt.Errorf("can only stage root for write revision %d, but got revision %d", m.writeRevision, root.MapRevision)
+	}
+
+	mapperMetaBytes, err := marshalMapperMetadata(root.Metadata)
+	if err != nil {
+		return err
+	}
+
+	res, err := m.tx.Exec(insertMapStagedHeadSQL, m.ms.mapID.TreeID, root.MapRevision, root.RootHash, root.TimestampNanos, mapperMetaBytes)
+	if err != nil {
+		glog.Warningf("Failed to stage map root: %s", err)
+	}
+
+	return checkResultOkAndRowCountIs(res, err, 1)
+}
+
+func (m *mapTX) PublishStagedMapRoot(root trillian.SignedMapRoot) error {
+	staged, ok, err := m.StagedSignedMapRoot()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return storage.ErrNoStagedRevision
+	}
+	if staged.MapRevision != root.MapRevision || !bytes.Equal(staged.RootHash, root.RootHash) {
+		return fmt.Errorf("root for revision %d does not match staged root for revision %d", root.MapRevision, staged.MapRevision)
+	}
+
+	if err := m.StoreSignedMapRoot(root); err != nil {
+		return err
+	}
+
+	res, err := m.tx.Exec(deleteMapStagedHeadSQL, m.ms.mapID.TreeID, staged.MapRevision)
+	return checkResultOkAndRowCountIs(res, err, 1)
+}
+
+func (m *mapTX) AbandonStagedMapRoot() error {
+	staged, ok, err := m.StagedSignedMapRoot()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return storage.ErrNoStagedRevision
+	}
+
+	// Note: MapRevision is stored negated in MapLeaf
+	if _, err := m.tx.Exec(deleteMapLeavesAtRevisionSQL, m.ms.mapID.TreeID, -staged.MapRevision); err != nil {
+		glog.Warningf("Failed to delete leaves for staged revision %d: %s", staged.MapRevision, err)
+		return err
+	}
+	if _, err := m.tx.Exec(deleteSubtreesAtRevisionSQL, m.ms.mapID.TreeID, staged.MapRevision); err != nil {
+		glog.Warningf("Failed to delete subtrees for staged revision %d: %s", staged.MapRevision, err)
+		return err
+	}
+
+	res, err := m.tx.Exec(deleteMapStagedHeadSQL, m.ms.mapID.TreeID, staged.MapRevision)
+	return checkResultOkAndRowCountIs(res, err, 1)
+}
+
+func (m *mapTX) RevertMapHead(revision int64, reason string, timestampNanos int64) (storage.MapHeadRevert, error) {
+	if _, ok, err := m.StagedSignedMapRoot(); err != nil {
+		return storage.MapHeadRevert{}, err
+	} else if ok {
+		return storage.MapHeadRevert{}, errors.New("cannot revert map with a staged revision")
+	}
+
+	latest, err := m.LatestSignedMapRoot()
+	if err != nil {
+		return storage.MapHeadRevert{}, err
+	}
+	if revision < 0 || revision >= latest.MapRevision {
+		return storage.MapHeadRevert{}, fmt.Errorf("can only revert to a revision before the latest (%d), got %d", latest.MapRevision, revision)
+	}
+
+	var count int
+	if err := m.tx.QueryRow(selectMapHeadRevisionCountSQL, m.ms.mapID.TreeID, revision).Scan(&count); err != nil {
+		return storage.MapHeadRevert{}, err
+	}
+	if count != 1 {
+		return storage.MapHeadRevert{}, fmt.Errorf("no published root for revision %d", revision)
+	}
+
+	revert := storage.MapHeadRevert{
+		TimestampNanos: timestampNanos,
+		FromRevision:   latest.MapRevision,
+		ToRevision:     revision,
+		Reason:         reason,
+	}
+
+	res, err := m.tx.Exec(insertMapHeadRevertSQL, m.ms.mapID.TreeID, timestampNanos, revert.FromRevision, revert.ToRevision, reason)
+	if err := checkResultOkAndRowCountIs(res, err, 1); err != nil {
+		glog.Warningf("Failed to record map head revert: %s", err)
+		return storage.MapHeadRevert{}, err
+	}
+
+	treeID := m.ms.mapID.TreeID
+	for _, stmt := range []struct {
+		sql  string
+		args []interface{}
+	}{
+		{abandonMapHeadsSQL, []interface{}{timestampNanos, treeID, revision}},
+		{deleteMapHeadsAfterRevisionSQL, []interface{}{treeID, revision}},
+		// Note: MapRevision is stored negated in MapLeaf
+		{abandonMapLeavesSQL, []interface{}{timestampNanos, treeID, -revision}},
+		{deleteMapLeavesAfterRevisionSQL, []interface{}{treeID, -revision}},
+		{abandonSubtreesSQL, []interface{}{timestampNanos, treeID, revision}},
+		{deleteSubtreesAfterRevisionSQL, []interface{}{treeID, revision}},
+		// Tags must not end up referring to revisions written after the revert
+		{abandonMapRevisionTagsSQL, []interface{}{timestampNanos, treeID, revision}},
+		{deleteMapRevisionTagsAfterRevisionSQL, []interface{}{treeID, revision}},
+	} {
+		if _, err := m.tx.Exec(stmt.sql, stmt.args...); err != nil {
+			glog.Warningf("Failed to revert map head to revision %d: %s", revision, err)
+			return storage.MapHeadRevert{}, err
+		}
+	}
+	abandoned, err := m.abandonedTags()
+	if err != nil {
+		return storage.MapHeadRevert{}, err
+	}
+	revert.AbandonedTags = abandoned[timestampNanos]
+
+	// Subsequent writes in this transaction follow the abandoned revisions,
+	// which aren't reused
+	m.writeRevision = latest.MapRevision + 1
+
+	return revert, nil
+}
+
+func (m *mapTX) SkipMapRevisions(revision int64, reason string, timestampNanos int64) error {
+	switch {
+	case revision+1 < m.writeRevision:
+		return fmt.Errorf("revisions up to %d are already in use, can't skip to %d", m.writeRevision-1, revision)
+	case revision+1 == m.writeRevision:
+		return nil
+	}
+	if _, ok, err := m.StagedSignedMapRoot(); err != nil {
+		return err
+	} else if ok {
+		return errors.New("cannot skip revisions of map with a staged revision")
+	}
+
+	latest, err := m.LatestSignedMapRoot()
+	if err != nil {
+		return err
+	}
+	// The skip is recorded as a revert of the skipped revisions to the latest
+	res, err := m.tx.Exec(insertMapHeadRevertSQL, m.ms.mapID.TreeID, timestampNanos, revision, latest.MapRevision, reason)
+	if err := checkResultOkAndRowCountIs(res, err, 1); err != nil {
+		glog.Warningf("Failed to record skip of map revisions: %s", err)
+		return err
+	}
+	m.writeRevision = revision + 1
+	return nil
+}
+
+// RemovePartialRevisions implements storage.PartialRevisionRemover.
+func (m *mapTX) RemovePartialRevisions() (int64, error) {
+	root, err := m.LatestSignedMapRoot()
+	if err != nil {
+		return 0, err
+	}
+	revision := root.MapRevision
+	if staged, ok, err := m.StagedSignedMapRoot(); err != nil {
+		return 0, err
+	} else if ok && staged.MapRevision > revision {
+		revision = staged.MapRevision
+	}
+
+	treeID := m.ms.mapID.TreeID
+	removed := int64(0)
+	for _, stmt := range []struct {
+		sql  string
+		args []interface{}
+	}{
+		// Note: MapRevision is stored negated in MapLeaf
+		{deleteMapLeavesAfterRevisionSQL, []interface{}{treeID, -revision}},
+		{deleteSubtreesAfterRevisionSQL, []interface{}{treeID, revision}},
+	} {
+		res, err := m.tx.Exec(stmt.sql, stmt.args...)
+		if err != nil {
+			glog.Warningf("Failed to remove revisions after %d: %s", revision, err)
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+func (m *mapTX) MapHeadReverts() ([]storage.MapHeadRevert, error) {
+	rows, err := m.tx.Query(selectMapHeadRevertsSQL, m.ms.mapID.TreeID)
+	if err != nil {
+		glog.Warningf("Failed to read map head reverts: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]storage.MapHeadRevert, 0)
+	for rows.Next() {
+		var revert storage.MapHeadRevert
+		if err := rows.Scan(&revert.TimestampNanos, &revert.FromRevision, &revert.ToRevision, &revert.Reason); err != nil {
+			return nil, err
+		}
+		ret = append(ret, revert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	abandoned, err := m.abandonedTags()
+	if err != nil {
+		return nil, err
+	}
+	for i := range ret {
+		ret[i].AbandonedTags = abandoned[ret[i].TimestampNanos]
+	}
+	return ret, nil
+}
+
+// abandonedTags returns the tags removed by each revert of the map, keyed by
+// the revert's timestamp.
+func (m *mapTX) abandonedTags() (map[int64]map[string]int64, error) {
+	rows, err := m.tx.Query(selectAbandonedMapRevisionTagsSQL, m.ms.mapID.TreeID)
+	if err != nil {
+		glog.Warningf("Failed to read abandoned map revision tags: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make(map[int64]map[string]int64)
+	for rows.Next() {
+		var timestampNanos, revision int64
+		var tag string
+		if err := rows.Scan(&timestampNanos, &tag, &revision); err != nil {
+			return nil, err
+		}
+		if ret[timestampNanos] == nil {
+			ret[timestampNanos] = make(map[string]int64)
+		}
+		ret[timestampNanos][tag] = revision
+	}
+
+	return ret, rows.Err()
+}
+
+func (m *mapTX) GetRevisionForTag(tag string) (int64, error) {
+	var revision int64
+	err := m.tx.QueryRow(selectMapRevisionForTagSQL, m.ms.mapID.TreeID, tag).Scan(&revision)
+	if err == sql.ErrNoRows {
+		return 0, storage.ErrTagNotFound
+	}
+
+	return revision, err
+}
+
+func (m *mapTX) GetRevisionTags() (map[string]int64, error) {
+	rows, err := m.tx.Query(selectMapRevisionTagsSQL, m.ms.mapID.TreeID)
+	if err != nil {
+		glog.Warningf("Failed to read map revision tags: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make(map[string]int64)
+	for rows.Next() {
+		var tag string
+		var revision int64
+		if err := rows.Scan(&tag, &revision); err != nil {
+			return nil, err
+		}
+		ret[tag] = revision
+	}
+
+	return ret, rows.Err()
+}
+
+func (m *mapTX) TagMapRevision(tag string, revision int64, timestampNanos int64) error {
+	if len(tag) == 0 || len(tag) > maxTagLength {
+		return fmt.Errorf("map revision tag must be between 1 and %d bytes long", maxTagLength)
+	}
+
+	var count int
+	if err := m.tx.QueryRow(selectMapHeadRevisionCountSQL, m.ms.mapID.TreeID, revision).Scan(&count); err != nil {
+		return err
+	}
+	if count != 1 {
+		return fmt.Errorf("no published root for revision %d", revision)
+	}
+
+	res, err := m.tx.Exec(insertMapRevisionTagSQL, m.ms.mapID.TreeID, tag, revision, timestampNanos)
+	if err != nil {
+		glog.Warningf("Failed to tag map revision %d: %s", revision, err)
+	}
+
+	return checkResultOkAndRowCountIs(res, err, 1)
+}
+
+// getRetention returns the retention settings for the map, which are the zero
+// values if none have been stored.
+func (m *mapTX) getRetention() (storage.RetentionPolicy, int64, error) {
+	var maxRevisions, maxAgeSeconds, oldest int64
+	err := m.tx.QueryRow(selectTreeRetentionSQL, m.ms.mapID.TreeID).Scan(&maxRevisions, &maxAgeSeconds, &oldest)
+	if err == sql.ErrNoRows {
+		return storage.RetentionPolicy{}, 0, nil
+	} else if err != nil {
+		glog.Warningf("Failed to read tree retention: %s", err)
+		return storage.RetentionPolicy{}, 0, err
+	}
+
+	policy := storage.RetentionPolicy{
+		MaxRevisions: maxRevisions,
+		MaxAge:       time.Duration(maxAgeSeconds) * time.Second,
+	}
+	return policy, oldest, nil
+}
+
+func (m *mapTX) GetRetentionPolicy() (storage.RetentionPolicy, error) {
+	policy, _, err := m.getRetention()
+	return policy, err
+}
+
+func (m *mapTX) SetRetentionPolicy(policy storage.RetentionPolicy) error {
+	if policy.MaxRevisions < 0 || policy.MaxAge < 0 {
+		return fmt.Errorf("invalid retention policy: %+v", policy)
+	}
+
+	_, err := m.tx.Exec(setTreeRetentionPolicySQL, m.ms.mapID.TreeID, policy.MaxRevisions, int64(policy.MaxAge/time.Second))
+	if err != nil {
+		glog.Warningf("Failed to set tree retention policy: %s", err)
+	}
+	return err
+}
+
+func (m *mapTX) OldestRetainedRevision() (int64, error) {
+	_, oldest, err := m.getRetention()
+	return oldest, err
+}
+
+func (m *mapTX) EarliestRevisionSince(timestampNanos int64) (int64, error) {
+	var revision sql.NullInt64
+	if err := m.tx.QueryRow(selectEarliestMapRevisionSinceSQL, m.ms.mapID.TreeID, timestampNanos).Scan(&revision); err != nil {
+		return 0, err
+	}
+	if revision.Valid {
+		return revision.Int64, nil
+	}
+
+	root, err := m.LatestSignedMapRoot()
+	if err != nil {
+		return 0, err
+	}
+	return root.MapRevision, nil
+}
+
+func (m *mapTX) PruneRevisionsBefore(revision int64) error {
+	root, err := m.LatestSignedMapRoot()
+	if err != nil {
+		return err
+	}
+	if revision > root.MapRevision {
+		return fmt.Errorf("cannot prune revisions before %d, latest revision is %d", revision, root.MapRevision)
+	}
+
+	if _, err := m.tx.Exec(setOldestRetainedRevisionSQL, m.ms.mapID.TreeID, revision); err != nil {
+		glog.Warningf("Failed to set oldest retained revision: %s", err)
+		return err
+	}
+
+	if _, err := m.tx.Exec(deleteMapHeadsBeforeRevisionSQL, m.ms.mapID.TreeID, revision); err != nil {
+		glog.Warningf("Failed to prune map roots before revision %d: %s", revision, err)
+		return err
+	}
+
+	return nil
+}
+
+// checkDeletable returns an error if the data superseded before revision can't
+// be deleted, see DeleteMapLeavesBelowRevision.
+func (m *mapTX) checkDeletable(revision int64) error {
+	oldest, err := m.OldestRetainedRevision()
+	if err != nil {
+		return err
+	}
+	return storage.CheckRevisionDeletable(revision, oldest, m.restoredFrom)
+}
+
+func (m *mapTX) DeleteMapLeavesBelowRevision(revision int64) (int64, error) {
+	if err := m.checkDeletable(revision); err != nil {
+		return 0, err
+	}
+
+	// Note: MapRevision is stored negated in MapLeaf
+	result, err := m.tx.Exec(deleteSupersededMapLeavesSQL, m.ms.mapID.TreeID, -revision, -revision)
+	if err != nil {
+		glog.Warningf("Failed to delete superseded map leaves: %s", err)
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := m.tx.Exec(deleteSupersededSubtreesSQL, m.ms.mapID.TreeID, revision, revision); err != nil {
+		glog.Warningf("Failed to delete superseded subtrees: %s", err)
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// checkArchivable returns the oldest retained revision, which revision must be before.
+func (m *mapTX) checkArchivable(revision int64) (int64, error) {
+	oldest, err := m.OldestRetainedRevision()
+	if err != nil {
+		return 0, err
+	}
+	return oldest, storage.CheckRevisionArchivable(revision, oldest)
+}
+
+// getArchivableLeaves returns the leaves written at revision that are superseded
+// by the oldest retained revision.
+func (m *mapTX) getArchivableLeaves(revision, oldest int64) ([]*storage.ArchivedLeaf, error) {
+	// Note: MapRevision is stored negated in MapLeaf
+	rows, err := m.tx.Query(selectArchivableMapLeavesSQL, m.ms.mapID.TreeID, -revision, -oldest)
+	if err != nil {
+		glog.Warningf("Failed to read archivable map leaves: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var leaves []*storage.ArchivedLeaf
+	for rows.Next() {
+		var leaf storage.ArchivedLeaf
+		if err := rows.Scan(&leaf.KeyHash, &leaf.LeafData); err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, &leaf)
+	}
+	return leaves, rows.Err()
+}
+
+// getArchivableSubtrees returns the subtrees written at revision that are
+// superseded by the oldest retained revision.
+func (m *mapTX) getArchivableSubtrees(revision, oldest int64) ([]*storage.SubtreeProto, error) {
+	rows, err := m.tx.Query(selectArchivableSubtreesSQL, m.ms.mapID.TreeID, revision, oldest)
+	if err != nil {
+		glog.Warningf("Failed to read archivable subtrees: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subtrees []*storage.SubtreeProto
+	for rows.Next() {
+		var subtreeID, nodesRaw []byte
+		if err := rows.Scan(&subtreeID, &nodesRaw); err != nil {
+			return nil, err
+		}
+		var subtree storage.SubtreeProto
+		if err := proto.Unmarshal(nodesRaw, &subtree); err != nil {
+			glog.Warningf("Failed to unmarshal SubtreeProto: %s", err)
+			return nil, err
+		}
+		subtree.Prefix = subtreeID
+		subtrees = append(subtrees, &subtree)
+	}
+	return subtrees, rows.Err()
+}
+
+func (m *mapTX) GetArchivableRevision(revision int64) (*storage.ArchiveSegment, error) {
+	oldest, err := m.checkArchivable(revision)
+	if err != nil {
+		return nil, err
+	}
+
+	segment := &storage.ArchiveSegment{TreeId: m.ms.mapID.TreeID, Revision: revision}
+	if segment.Leaves, err = m.getArchivableLeaves(revision, oldest); err != nil {
+		return nil, err
+	}
+	if segment.Subtrees, err = m.getArchivableSubtrees(revision, oldest); err != nil {
+		return nil, err
+	}
+	return segment, nil
+}
+
+func (m *mapTX) ArchiveRevision(revision int64, segment string) error {
+	oldest, err := m.checkArchivable(revision)
+	if err != nil {
+		return err
+	}
+
+	// Note: MapRevision is stored negated in MapLeaf
+	if _, err := m.tx.Exec(deleteArchivableMapLeavesSQL, m.ms.mapID.TreeID, -revision, -oldest); err != nil {
+		glog.Warningf("Failed to delete archived map leaves: %s", err)
+		return err
+	}
+	if _, err := m.tx.Exec(deleteArchivableSubtreesSQL, m.ms.mapID.TreeID, revision, oldest); err != nil {
+		glog.Warningf("Failed to delete archived subtrees: %s", err)
+		return err
+	}
+
+	_, err = m.tx.Exec(insertArchivedRevisionSQL, m.ms.mapID.TreeID, revision, segment)
+	return err
+}
+
+func (m *mapTX) GetArchivedRevisions() (map[int64]string, error) {
+	rows, err := m.tx.Query(selectArchivedRevisionsSQL, m.ms.mapID.TreeID)
+	if err != nil {
+		glog.Warningf("Failed to read archived revisions: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make(map[int64]string)
+	for rows.Next() {
+		var revision int64
+		var segment string
+		if err := rows.Scan(&revision, &segment); err != nil {
+			return nil, err
+		}
+		ret[revision] = segment
+	}
+
+	return ret, rows.Err()
+}
+
+func (m *mapTX) RestoreArchivedRevision(segment *storage.ArchiveSegment) error {
+	if segment.TreeId != m.ms.mapID.TreeID {
+		return fmt.Errorf("archive segment is for tree %d, not %d", segment.TreeId, m.ms.mapID.TreeID)
+	}
+
+	for _, leaf := range segment.Leaves {
+		// Note: MapRevision is stored negated in MapLeaf
+		if _, err := m.tx.Exec(restoreMapLeafSQL, segment.TreeId, leaf.KeyHash, -segment.Revision, leaf.LeafData); err != nil {
+			glog.Warningf("Failed to restore map leaf: %s", err)
+			return err
+		}
+	}
+
+	for _, subtree := range segment.Subtrees {
+		subtreeID := subtree.Prefix
+		if subtreeID == nil {
+			subtreeID = []byte{}
+		}
+		subtreeBytes, err := proto.Marshal(subtree)
+		if err != nil {
+			return err
+		}
+		if _, err := m.tx.Exec(restoreSubtreeSQL, segment.TreeId, subtreeID, subtreeBytes, segment.Revision); err != nil {
+			glog.Warningf("Failed to restore subtree: %s", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *mapTX) SetRevisionRestored(revision int64, expiresNanos int64) error {
+	_, err := m.tx.Exec(insertRestoredRevisionSQL, m.ms.mapID.TreeID, revision, expiresNanos)
+	return err
+}
+
+func (m *mapTX) GetRestoredRevisions() (map[int64]int64, error) {
+	rows, err := m.tx.Query(selectRestoredRevisionsSQL, m.ms.mapID.TreeID)
+	if err != nil {
+		glog.Warningf("Failed to read restored revisions: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make(map[int64]int64)
+	for rows.Next() {
+		var revision, expires int64
+		if err := rows.Scan(&revision, &expires); err != nil {
+			return nil, err
+		}
+		ret[revision] = expires
+	}
+
+	return ret, rows.Err()
+}
+
+func (m *mapTX) ClearRevisionRestored(revision int64) error {
+	_, err := m.tx.Exec(deleteRestoredRevisionSQL, m.ms.mapID.TreeID, revision)
+	return err
+}
@@ -0,0 +1,17 @@
+package postgres
+
+import (
+	"github.com/google/trillian/storage/sqlhooks"
+)
+
+// driverName is the name the Postgres database/sql driver must be registered
+// under. The storage doesn't import a driver itself, binaries that use it must,
+// e.g. with import _ "github.com/lib/pq".
+const driverName = "postgres"
+
+// Options holds configuration that applies to Postgres storage instances.
+type Options struct {
+	// StatementHook, if set, is called after every statement run by the
+	// storage, e.g. to record metrics or log slow queries.
+	StatementHook sqlhooks.Hook
+}
@@ -0,0 +1,281 @@
+-- PostgreSQL version of the tree schema. It has the same tables and columns as
+-- the MySQL schema, so the two can be kept in step.
+
+-- ---------------------------------------------
+-- Tree stuff here
+-- ---------------------------------------------
+
+
+-- Tree parameters should not be changed after creation. Doing so can
+-- render the data in the tree unusable or inconsistent.
+CREATE TABLE IF NOT EXISTS Trees(
+  TreeId                BIGINT NOT NULL,
+  KeyId                 BYTEA NOT NULL,
+  TreeType              VARCHAR(14) NOT NULL CHECK (TreeType IN ('LOG', 'MAP', 'PREORDERED_LOG')),
+  LeafHasherType        VARCHAR(6) NOT NULL CHECK (LeafHasherType IN ('SHA256', 'SHA512')),
+  -- The hash algorithm also sets the depth of a map, which is the size of its key hashes
+  TreeHasherType        VARCHAR(6) NOT NULL CHECK (TreeHasherType IN ('SHA256', 'SHA512')),
+  -- How leaves and nodes are hashed with the hash algorithm
+  HashStrategy          VARCHAR(20) NOT NULL DEFAULT 'RFC6962' CHECK (HashStrategy IN ('RFC6962', 'SHA512_256', 'LIE_SHA512_256')),
+  AllowsDuplicateLeaves BOOLEAN NOT NULL DEFAULT FALSE,
+  -- What a log does with leaves already in it, ALLOW_DUPLICATES if AllowsDuplicateLeaves is set
+  DuplicatePolicy       VARCHAR(20) NOT NULL DEFAULT 'MERGE_DUPLICATES' CHECK (DuplicatePolicy IN ('MERGE_DUPLICATES', 'REJECT_DUPLICATES', 'ALLOW_DUPLICATES')),
+  -- Domain separation prefixes for leaf and node hashes, NULL for RFC 6962
+  LeafHashPrefix        BYTEA,
+  NodeHashPrefix        BYTEA,
+  -- Depths of a map's strata from the root, e.g. 8x10,176, NULL for the default
+  MapStrata             VARCHAR(255),
+  PRIMARY KEY(TreeId)
+);
+
+-- This table contains tree parameters that can be changed at runtime such as for
+-- administrative purposes.
+CREATE TABLE IF NOT EXISTS TreeControl(
+  TreeId                  BIGINT NOT NULL,
+  ReadOnlyRequests        BOOLEAN,
+  SigningEnabled          BOOLEAN,
+  SequencingEnabled       BOOLEAN,
+  SequenceIntervalSeconds INTEGER,
+  SignIntervalSeconds     INTEGER,
+  -- Queued leaves are only sequenced once they're this old
+  SequenceGuardSeconds    INTEGER,
+  -- If set the latest root is re-signed when it's this old, even if it's unchanged
+  MaxRootDurationSeconds  INTEGER,
+  -- If NULL the tree is FROZEN if ReadOnlyRequests is set, or else ACTIVE
+  TreeState               VARCHAR(8) CHECK (TreeState IN ('ACTIVE', 'FROZEN', 'DRAINING', 'ARCHIVED')),
+  PRIMARY KEY(TreeId),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId)
+);
+
+CREATE TABLE IF NOT EXISTS Subtree(
+  TreeId               BIGINT NOT NULL,
+  SubtreeId            BYTEA NOT NULL,
+  Nodes                BYTEA NOT NULL,
+  SubtreeRevision      INTEGER NOT NULL,
+  PRIMARY KEY(TreeId, SubtreeId, SubtreeRevision),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+-- The unique constraint on TreeRevision is used to enforce that there is only
+-- one STH at any tree revision
+CREATE TABLE IF NOT EXISTS TreeHead(
+  TreeId               BIGINT NOT NULL,
+  TreeHeadTimestamp    BIGINT,
+  TreeSize             BIGINT,
+  RootHash             BYTEA NOT NULL,
+  RootSignature        BYTEA NOT NULL,
+  TreeRevision         BIGINT,
+  PRIMARY KEY(TreeId, TreeHeadTimestamp),
+  UNIQUE(TreeId, TreeRevision),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+-- Witness signatures of the TreeHead at each revision. Signature is a
+-- marshaled DigitallySigned.
+CREATE TABLE IF NOT EXISTS TreeHeadCosignature(
+  TreeId               BIGINT NOT NULL,
+  TreeRevision         BIGINT NOT NULL,
+  WitnessId            VARCHAR(255) NOT NULL,
+  Signature            BYTEA NOT NULL,
+  PRIMARY KEY(TreeId, TreeRevision, WitnessId),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+
+-- ---------------------------------------------
+-- Log specific stuff here
+-- ---------------------------------------------
+
+-- A leaf that has not been sequenced has a row in this table. If duplicate leaves
+-- are allowed they will all reference this row.
+CREATE TABLE IF NOT EXISTS LeafData(
+  TreeId               BIGINT NOT NULL,
+  LeafHash             BYTEA NOT NULL,
+  TheData              BYTEA NOT NULL,
+  PRIMARY KEY(TreeId, LeafHash),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+-- When a leaf is sequenced a row is added to this table. If logs allow duplicates then
+-- multiple rows will exist with different sequence numbers.
+CREATE TABLE IF NOT EXISTS SequencedLeafData(
+  TreeId               BIGINT NOT NULL,
+  SequenceNumber       BIGINT NOT NULL CHECK (SequenceNumber >= 0),
+  LeafHash             BYTEA NOT NULL,
+  -- The timestamp of the root the leaf was integrated in, zero for leaves
+  -- sequenced before this was recorded
+  IntegrateTimestampNanos BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY(TreeId, SequenceNumber),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE,
+  FOREIGN KEY(TreeId, LeafHash) REFERENCES LeafData(TreeId, LeafHash) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS SequencedLeafHashIdx ON SequencedLeafData(TreeId, LeafHash);
+CREATE INDEX IF NOT EXISTS IntegrateTimestampIdx ON SequencedLeafData(TreeId, IntegrateTimestampNanos);
+
+-- Leaves added to a pre-ordered log at their indices, which aren't readable
+-- until the sequencer integrates them and moves them to SequencedLeafData.
+CREATE TABLE IF NOT EXISTS StagedLeafData(
+  TreeId               BIGINT NOT NULL,
+  SequenceNumber       BIGINT NOT NULL CHECK (SequenceNumber >= 0),
+  LeafHash             BYTEA NOT NULL,
+  PRIMARY KEY(TreeId, SequenceNumber),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE,
+  FOREIGN KEY(TreeId, LeafHash) REFERENCES LeafData(TreeId, LeafHash) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS Unsequenced(
+  TreeId               BIGINT NOT NULL,
+  LeafHash             BYTEA NOT NULL,
+  -- SHA256("queueId"|TreeId|leafHash)
+  -- We want this to be unique per entry per log, but queryable by FEs so that
+  -- we can try to stomp dupe submissions.
+  MessageId            BYTEA NOT NULL,
+  Payload              BYTEA NOT NULL,
+  QueueTimestamp       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (TreeId, LeafHash, MessageId)
+);
+-- Leaves are dequeued, and the oldest found, in queue order
+CREATE INDEX IF NOT EXISTS UnsequencedQueueTimestampIdx ON Unsequenced(TreeId, QueueTimestamp);
+
+
+-- ---------------------------------------------
+-- Map specific stuff here
+-- ---------------------------------------------
+
+CREATE TABLE IF NOT EXISTS MapLeaf(
+  TreeId                BIGINT NOT NULL,
+  KeyHash               BYTEA NOT NULL,
+  -- MapRevision is stored negated, as it is in MySQL, so more recent revisions
+  -- come first in the primary key index.
+  MapRevision           BIGINT NOT NULL,
+  TheData               BYTEA NOT NULL,
+  PRIMARY KEY(TreeId, KeyHash, MapRevision),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS MapLeafRevisionIdx ON MapLeaf(TreeId, MapRevision);
+
+CREATE TABLE IF NOT EXISTS MapHead(
+  TreeId               BIGINT NOT NULL,
+  MapHeadTimestamp     BIGINT,
+  RootHash             BYTEA NOT NULL,
+  MapRevision          BIGINT,
+  RootSignature        BYTEA NOT NULL,
+  MapperData           BYTEA,
+  PRIMARY KEY(TreeId, MapHeadTimestamp),
+  UNIQUE(TreeId, MapRevision),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+-- A map revision which has been written but not yet published. There can be at
+-- most one per tree. The revision becomes readable when its root is moved into
+-- MapHead, or is removed along with its leaves and nodes if abandoned.
+CREATE TABLE IF NOT EXISTS MapStagedHead(
+  TreeId               BIGINT NOT NULL,
+  MapRevision          BIGINT NOT NULL,
+  RootHash             BYTEA NOT NULL,
+  StagedTimestamp      BIGINT NOT NULL,
+  MapperData           BYTEA,
+  PRIMARY KEY(TreeId),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+-- Each row records the serving head of a map being reverted to an earlier
+-- revision. The data for the revisions after ToRevision is moved into the
+-- Abandoned tables below, tagged with the RevertTimestamp, rather than deleted.
+CREATE TABLE IF NOT EXISTS MapHeadRevert(
+  TreeId               BIGINT NOT NULL,
+  RevertTimestamp      BIGINT NOT NULL,
+  FromRevision         BIGINT NOT NULL,
+  ToRevision           BIGINT NOT NULL,
+  Reason               VARCHAR(1024) NOT NULL,
+  PRIMARY KEY(TreeId, RevertTimestamp),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS AbandonedMapHead(
+  TreeId               BIGINT NOT NULL,
+  RevertTimestamp      BIGINT NOT NULL,
+  MapHeadTimestamp     BIGINT,
+  RootHash             BYTEA NOT NULL,
+  MapRevision          BIGINT,
+  RootSignature        BYTEA NOT NULL,
+  MapperData           BYTEA,
+  PRIMARY KEY(TreeId, RevertTimestamp, MapRevision),
+  FOREIGN KEY(TreeId, RevertTimestamp) REFERENCES MapHeadRevert(TreeId, RevertTimestamp) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS AbandonedMapLeaf(
+  TreeId                BIGINT NOT NULL,
+  RevertTimestamp       BIGINT NOT NULL,
+  KeyHash               BYTEA NOT NULL,
+  -- Negated, as in MapLeaf
+  MapRevision           BIGINT NOT NULL,
+  TheData               BYTEA NOT NULL,
+  PRIMARY KEY(TreeId, RevertTimestamp, KeyHash, MapRevision),
+  FOREIGN KEY(TreeId, RevertTimestamp) REFERENCES MapHeadRevert(TreeId, RevertTimestamp) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS AbandonedSubtree(
+  TreeId               BIGINT NOT NULL,
+  RevertTimestamp      BIGINT NOT NULL,
+  SubtreeId            BYTEA NOT NULL,
+  Nodes                BYTEA NOT NULL,
+  SubtreeRevision      INTEGER NOT NULL,
+  PRIMARY KEY(TreeId, RevertTimestamp, SubtreeId, SubtreeRevision),
+  FOREIGN KEY(TreeId, RevertTimestamp) REFERENCES MapHeadRevert(TreeId, RevertTimestamp) ON DELETE CASCADE
+);
+
+-- Tags which were removed because they were on revisions abandoned by a revert.
+CREATE TABLE IF NOT EXISTS AbandonedMapRevisionTag(
+  TreeId               BIGINT NOT NULL,
+  RevertTimestamp      BIGINT NOT NULL,
+  Tag                  VARCHAR(255) NOT NULL,
+  MapRevision          BIGINT NOT NULL,
+  TagTimestamp         BIGINT NOT NULL,
+  PRIMARY KEY(TreeId, RevertTimestamp, Tag),
+  FOREIGN KEY(TreeId, RevertTimestamp) REFERENCES MapHeadRevert(TreeId, RevertTimestamp) ON DELETE CASCADE
+);
+
+-- Human readable names for map revisions. Tags are not changed once created.
+CREATE TABLE IF NOT EXISTS MapRevisionTag(
+  TreeId               BIGINT NOT NULL,
+  Tag                  VARCHAR(255) NOT NULL,
+  MapRevision          BIGINT NOT NULL,
+  TagTimestamp         BIGINT NOT NULL,
+  PRIMARY KEY(TreeId, Tag),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+-- The retention policy for a tree and the earliest revision that is still
+-- readable. Trees without a row retain all revisions.
+CREATE TABLE IF NOT EXISTS TreeRetention(
+  TreeId                 BIGINT NOT NULL,
+  -- Zero means there is no limit
+  MaxRevisions           BIGINT NOT NULL DEFAULT 0,
+  MaxAgeSeconds          BIGINT NOT NULL DEFAULT 0,
+  OldestRetainedRevision BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY(TreeId),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+-- Map revisions whose data has been moved to archive segments in object storage.
+CREATE TABLE IF NOT EXISTS ArchivedRevision(
+  TreeId               BIGINT NOT NULL,
+  MapRevision          BIGINT NOT NULL,
+  -- Empty if there was no data to archive at this revision
+  SegmentName          VARCHAR(1024) NOT NULL,
+  PRIMARY KEY(TreeId, MapRevision),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+-- Pruned map revisions which have been temporarily restored from archive and
+-- can be read until they expire.
+CREATE TABLE IF NOT EXISTS RestoredRevision(
+  TreeId               BIGINT NOT NULL,
+  MapRevision          BIGINT NOT NULL,
+  ExpiresTimestamp     BIGINT NOT NULL,
+  PRIMARY KEY(TreeId, MapRevision),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
@@ -0,0 +1,533 @@
+// Package postgres implements LogStorage and MapStorage on PostgreSQL. The
+// schema in storage.sql mirrors the MySQL one, and trees are stored in the same
+// way, in subtrees of the same strata.
+package postgres
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/cache"
+	"github.com/google/trillian/storage/sqlhooks"
+)
+
+// Statements are written with ? placeholders, like the MySQL ones, and rebind
+// converts them to the numbered placeholders Postgres uses. Statements with a
+// placeholderSQL list are rebound when they're expanded.
+var insertTreeHeadSQL = rebind(`INSERT INTO TreeHead(TreeId,TreeHeadTimestamp,TreeSize,RootHash,TreeRevision,RootSignature)
+		 VALUES(?,?,?,?,?,?)`)
+var selectTreeHashingSQL = rebind("SELECT TreeHasherType, HashStrategy, LeafHashPrefix, NodeHashPrefix FROM Trees WHERE TreeId=?")
+var selectTreeStrataSQL = rebind("SELECT MapStrata FROM Trees WHERE TreeId=?")
+var selectTreeRevisionAtSizeSQL = rebind("SELECT TreeRevision FROM TreeHead WHERE TreeId=? AND TreeSize=? ORDER BY TreeRevision DESC LIMIT 1")
+
+const selectActiveLogsSQL string = "SELECT TreeId, KeyId FROM Trees WHERE TreeType IN ('LOG','PREORDERED_LOG')"
+const selectActiveLogsWithUnsequencedSQL string = `SELECT t.TreeId, t.KeyId FROM Trees t
+		 WHERE t.TreeType IN ('LOG','PREORDERED_LOG')
+		 AND (EXISTS (SELECT 1 FROM Unsequenced u WHERE u.TreeId=t.TreeId)
+		 OR EXISTS (SELECT 1 FROM StagedLeafData s WHERE s.TreeId=t.TreeId))`
+
+const insertSubtreeMultiSQL string = `INSERT INTO Subtree(TreeId, SubtreeId, Nodes, SubtreeRevision) ` + placeholderSQL
+const selectSubtreeSQL string = `SELECT x.SubtreeId, x.MaxRevision, Subtree.Nodes
+				 FROM (SELECT n.SubtreeId, max(n.SubtreeRevision) AS MaxRevision
+							 FROM Subtree n
+							 WHERE n.SubtreeId IN (` + placeholderSQL + `) AND
+										 n.TreeId = ? AND
+										 n.SubtreeRevision <= ?
+							 GROUP BY n.SubtreeId) AS x
+				 INNER JOIN Subtree ON Subtree.SubtreeId = x.SubtreeId AND
+														Subtree.SubtreeRevision = x.MaxRevision AND
+														Subtree.TreeId = ?`
+
+const placeholderSQL string = "<placeholder>"
+
+// rebind replaces each ? placeholder in statement with the numbered $1, $2...
+// placeholders that Postgres uses. None of the statements have a ? anywhere else.
+func rebind(statement string) string {
+	var b bytes.Buffer
+	n := 0
+	for _, r := range statement {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		fmt.Fprintf(&b, "$%d", n)
+	}
+	return b.String()
+}
+
+// postgresTreeStorage is shared between the log and map storage, and contains
+// the functionality which is common to both.
+type postgresTreeStorage struct {
+	treeID          int64
+	db              *sql.DB
+	hashSizeBytes   int
+	hashAlgorithm   trillian.HashAlgorithm
+	hashStrategy    trillian.HashStrategy
+	hashPrefixes    storage.TreeHashPrefixes
+	populateSubtree storage.PopulateSubtreeFunc
+
+	// Must hold the mutex before manipulating the statement map. The map is from
+	// the statement to the number of values in its placeholder list to the
+	// prepared statement.
+	statementMutex sync.Mutex
+	statements     map[string]map[int]*sql.Stmt
+	treeDepth      int
+	strataDepths   []int
+}
+
+func openDB(dbURL string, opts Options) (*sql.DB, error) {
+	var db *sql.DB
+	var err error
+	if opts.StatementHook != nil {
+		db, err = sqlhooks.Open(driverName, dbURL, opts.StatementHook)
+	} else {
+		db, err = sql.Open(driverName, dbURL)
+	}
+	if err != nil {
+		// Don't log uri as it could contain credentials
+		glog.Warningf("Could not open Postgres database, check config: %s", err)
+		return nil, err
+	}
+
+	// Make sure that a connection can be made, rather than failing later on first use
+	if err := db.Ping(); err != nil {
+		glog.Warningf("Failed to connect to Postgres db: %s", err)
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func newTreeStorage(treeID int64, dbURL string, opts Options, strata storage.StrataFunc, populate func(merkle.TreeHasher) storage.PopulateSubtreeFunc) (*postgresTreeStorage, error) {
+	db, err := openDB(dbURL, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	alg, strategy, prefixes, err := readTreeHashing(db, treeID)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	th, err := merkle.NewTreeHasherForStrategy(strategy, alg, prefixes)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("tree %d has invalid hashing config: %v", treeID, err)
+	}
+
+	treeDepth, strataDepths := strata(th.Size())
+	treeStrata, err := readTreeStrata(db, treeID)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if len(treeStrata) > 0 {
+		strataDepths = treeStrata
+	}
+	if err := cache.ValidateStrata(treeDepth, strataDepths); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("tree %d has invalid strata: %v", treeID, err)
+	}
+
+	return &postgresTreeStorage{
+		treeID:          treeID,
+		db:              db,
+		hashSizeBytes:   th.Size(),
+		hashAlgorithm:   alg,
+		hashStrategy:    strategy,
+		hashPrefixes:    prefixes,
+		populateSubtree: populate(th),
+		statements:      make(map[string]map[int]*sql.Stmt),
+		treeDepth:       treeDepth,
+		strataDepths:    strataDepths,
+	}, nil
+}
+
+// readTreeHashing returns the hash algorithm, hash strategy and domain
+// separation prefixes stored in the tree's record. Trees without a record use
+// SHA-256 with the default strategy and prefixes.
+func readTreeHashing(db *sql.DB, treeID int64) (trillian.HashAlgorithm, trillian.HashStrategy, storage.TreeHashPrefixes, error) {
+	var hasherType, strategyName string
+	var prefixes storage.TreeHashPrefixes
+	err := db.QueryRow(selectTreeHashingSQL, treeID).Scan(&hasherType, &strategyName, &prefixes.Leaf, &prefixes.Node)
+	switch {
+	case err == sql.ErrNoRows:
+		return trillian.HashAlgorithm_SHA256, trillian.HashStrategy_RFC6962, prefixes, nil
+	case err != nil:
+		glog.Warningf("Failed to read hashing config for tree %d: %s", treeID, err)
+		return 0, 0, storage.TreeHashPrefixes{}, err
+	}
+	alg, ok := trillian.HashAlgorithm_value[hasherType]
+	if !ok {
+		return 0, 0, storage.TreeHashPrefixes{}, fmt.Errorf("tree %d has unknown hasher type %q", treeID, hasherType)
+	}
+	strategy, ok := trillian.HashStrategy_value[strategyName]
+	if !ok {
+		return 0, 0, storage.TreeHashPrefixes{}, fmt.Errorf("tree %d has unknown hash strategy %q", treeID, strategyName)
+	}
+	return trillian.HashAlgorithm(alg), trillian.HashStrategy(strategy), prefixes, nil
+}
+
+// readTreeStrata returns the strata depths stored in the tree's record. Trees
+// without a record, or strata, use the default strata.
+func readTreeStrata(db *sql.DB, treeID int64) ([]int, error) {
+	var strata sql.NullString
+	err := db.QueryRow(selectTreeStrataSQL, treeID).Scan(&strata)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		glog.Warningf("Failed to read strata for tree %d: %s", treeID, err)
+		return nil, err
+	}
+	depths, err := cache.ParseStrata(strata.String)
+	if err != nil {
+		return nil, fmt.Errorf("tree %d has invalid strata: %v", treeID, err)
+	}
+	return depths, nil
+}
+
+// HashAlgorithm returns the hash algorithm configured for the tree.
+func (m *postgresTreeStorage) HashAlgorithm() trillian.HashAlgorithm {
+	return m.hashAlgorithm
+}
+
+// HashStrategy returns the hash strategy configured for the tree.
+func (m *postgresTreeStorage) HashStrategy() trillian.HashStrategy {
+	return m.hashStrategy
+}
+
+// HashPrefixes returns the domain separation prefixes configured for the tree.
+func (m *postgresTreeStorage) HashPrefixes() storage.TreeHashPrefixes {
+	return m.hashPrefixes
+}
+
+// expandPlaceholderSQL expands the placeholder list in a statement to num
+// values, the first written as first and the others as rest, then numbers all
+// of the statement's placeholders.
+func expandPlaceholderSQL(statement string, num int, first, rest string) string {
+	if num <= 0 {
+		panic(fmt.Errorf("Trying to expand SQL placeholder with <= 0 parameters: %s", statement))
+	}
+
+	parameters := first + strings.Repeat(","+rest, num-1)
+
+	return rebind(strings.Replace(statement, placeholderSQL, parameters, 1))
+}
+
+// getStmt creates and caches sql.Stmt structs based on the passed in statement
+// and number of values in its placeholder list.
+func (m *postgresTreeStorage) getStmt(statement string, num int, first, rest string) (*sql.Stmt, error) {
+	m.statementMutex.Lock()
+	defer m.statementMutex.Unlock()
+
+	if m.statements[statement] != nil {
+		if m.statements[statement][num] != nil {
+			return m.statements[statement][num], nil
+		}
+	} else {
+		m.statements[statement] = make(map[int]*sql.Stmt)
+	}
+
+	s, err := m.db.Prepare(expandPlaceholderSQL(statement, num, first, rest))
+
+	if err != nil {
+		glog.Warningf("Failed to prepare statement %d: %s", num, err)
+		return nil, err
+	}
+
+	m.statements[statement][num] = s
+
+	return s, nil
+}
+
+// getInStmt returns the statement to use for an IN clause holding values, and
+// the values padded to fit it. The values must be the first arguments of the
+// statement.
+func (m *postgresTreeStorage) getInStmt(statement string, values []interface{}) (*sql.Stmt, []interface{}, error) {
+	padded := storage.PadInValues(values)
+	s, err := m.getStmt(statement, len(padded), "?", "?")
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, padded, nil
+}
+
+func (m *postgresTreeStorage) getSubtreeStmt(nodeIDs []interface{}) (*sql.Stmt, []interface{}, error) {
+	return m.getInStmt(selectSubtreeSQL, nodeIDs)
+}
+
+func (m *postgresTreeStorage) setSubtreeStmt(num int) (*sql.Stmt, error) {
+	return m.getStmt(insertSubtreeMultiSQL, num, "VALUES(?, ?, ?, ?)", "(?, ?, ?, ?)")
+}
+
+func (m *postgresTreeStorage) beginTreeTx() (treeTX, error) {
+	t, err := m.db.Begin()
+	if err != nil {
+		glog.Warningf("Could not start tree TX: %s", err)
+		return treeTX{}, err
+	}
+	return treeTX{
+		tx:            t,
+		ts:            m,
+		subtreeCache:  cache.NewSubtreeCacheForDepth(m.treeDepth, m.strataDepths, m.populateSubtree),
+		writeRevision: -1,
+	}, nil
+}
+
+type treeTX struct {
+	closed        bool
+	tx            *sql.Tx
+	ts            *postgresTreeStorage
+	subtreeCache  cache.SubtreeCache
+	writeRevision int64
+}
+
+func (t *treeTX) getSubtree(treeRevision int64, nodeID storage.NodeID) (*storage.SubtreeProto, error) {
+	s, err := t.getSubtrees(treeRevision, []storage.NodeID{nodeID})
+	if err != nil {
+		return nil, err
+	}
+	switch len(s) {
+	case 0:
+		return nil, nil
+	case 1:
+		return s[0], nil
+	default:
+		return nil, fmt.Errorf("got %d subtrees, but expected 1", len(s))
+	}
+}
+
+// GetStoredSubtree implements storage.SubtreeInspector. The subtree's internal
+// nodes aren't populated.
+func (t *treeTX) GetStoredSubtree(treeRevision int64, id storage.NodeID) (*storage.SubtreeProto, error) {
+	return t.getSubtree(treeRevision, id)
+}
+
+func (t *treeTX) getSubtrees(treeRevision int64, nodeIDs []storage.NodeID) ([]*storage.SubtreeProto, error) {
+	if len(nodeIDs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]interface{}, 0, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		if nodeID.PrefixLenBits%8 != 0 {
+			return nil, fmt.Errorf("invalid subtree ID - not multiple of 8: %d", nodeID.PrefixLenBits)
+		}
+		ids = append(ids, interface{}(nodeID.Path[:nodeID.PrefixLenBits/8]))
+	}
+
+	tmpl, args, err := t.ts.getSubtreeStmt(ids)
+	if err != nil {
+		return nil, err
+	}
+	stx := t.tx.Stmt(tmpl)
+	defer stx.Close()
+
+	args = append(args, t.ts.treeID, treeRevision, t.ts.treeID)
+
+	rows, err := stx.Query(args...)
+	if err != nil {
+		glog.Warningf("Failed to get merkle subtrees: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]*storage.SubtreeProto, 0, len(nodeIDs))
+	for rows.Next() {
+		var subtreeIDBytes []byte
+		var subtreeRev int64
+		var nodesRaw []byte
+		if err := rows.Scan(&subtreeIDBytes, &subtreeRev, &nodesRaw); err != nil {
+			glog.Warningf("Failed to scan merkle subtree: %s", err)
+			return nil, err
+		}
+		var subtree storage.SubtreeProto
+		if err := proto.Unmarshal(nodesRaw, &subtree); err != nil {
+			glog.Warningf("Failed to unmarshal SubtreeProto: %s", err)
+			return nil, err
+		}
+		if subtree.Prefix == nil {
+			subtree.Prefix = []byte{}
+		}
+		ret = append(ret, &subtree)
+	}
+
+	// The InternalNodes cache is nil here, but the SubtreeCache (which called
+	// this method) will re-populate it.
+	return ret, rows.Err()
+}
+
+func (t *treeTX) storeSubtrees(subtrees []*storage.SubtreeProto) error {
+	if len(subtrees) == 0 {
+		glog.Warning("attempted to store 0 subtrees...")
+		return nil
+	}
+
+	const argsPerSubtree = 4
+	args := make([]interface{}, 0, len(subtrees)*argsPerSubtree)
+	for _, s := range subtrees {
+		if s.Prefix == nil {
+			panic(fmt.Errorf("nil prefix on %v", s))
+		}
+		// Ensure we're not storing the internal nodes, since we'll just recalculate
+		// them when we read this subtree back.
+		s.InternalNodes = nil
+		subtreeBytes, err := proto.Marshal(s)
+		if err != nil {
+			return err
+		}
+		args = append(args, t.ts.treeID, s.Prefix, subtreeBytes, t.writeRevision)
+	}
+
+	// Inserted rows can't be padded, so they're written in batches of the
+	// statement shapes
+	for _, num := range storage.SplitIntoShapes(len(subtrees)) {
+		if err := t.storeSubtreeBatch(num, args[:num*argsPerSubtree]); err != nil {
+			return err
+		}
+		args = args[num*argsPerSubtree:]
+	}
+	return nil
+}
+
+// storeSubtreeBatch inserts num subtrees with args.
+func (t *treeTX) storeSubtreeBatch(num int, args []interface{}) error {
+	tmpl, err := t.ts.setSubtreeStmt(num)
+	if err != nil {
+		return err
+	}
+	stx := t.tx.Stmt(tmpl)
+	defer stx.Close()
+
+	if _, err := stx.Exec(args...); err != nil {
+		glog.Warningf("Failed to set merkle subtrees: %s", err)
+		return err
+	}
+	return nil
+}
+
+func checkResultOkAndRowCountIs(res sql.Result, err error, count int64) error {
+	// The Exec() might have just failed
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected != count {
+		return fmt.Errorf("Expected %d row(s) to be affected but saw: %d", count, rowsAffected)
+	}
+
+	return nil
+}
+
+// GetTreeRevisionAtSize returns the max node version for a tree at a particular size.
+// It is an error to request tree sizes larger than the currently published tree size.
+// This only works for sizes where there is a stored tree head.
+func (t *treeTX) GetTreeRevisionAtSize(treeSize int64) (int64, error) {
+	// Negative size is not sensible and a zero sized tree has no nodes so no revisions
+	if treeSize <= 0 {
+		return 0, fmt.Errorf("Invalid tree size: %d", treeSize)
+	}
+
+	var treeRevision int64
+	err := t.tx.QueryRow(selectTreeRevisionAtSizeSQL, t.ts.treeID, treeSize).Scan(&treeRevision)
+
+	return treeRevision, err
+}
+
+func (t *treeTX) GetMerkleNodes(treeRevision int64, nodeIDs []storage.NodeID) ([]storage.Node, error) {
+	// The preload runs its fetches concurrently but the transaction's connection can
+	// only run one query at a time, so the queries are serialized here.
+	var queryMutex sync.Mutex
+	err := t.subtreeCache.Preload(nodeIDs, func(ids []storage.NodeID) ([]*storage.SubtreeProto, error) {
+		queryMutex.Lock()
+		defer queryMutex.Unlock()
+		return t.getSubtrees(treeRevision, ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]storage.Node, 0, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		h, err := t.subtreeCache.GetNodeHash(
+			nodeID,
+			func(n storage.NodeID) (*storage.SubtreeProto, error) {
+				return t.getSubtree(treeRevision, n)
+			})
+		if err != nil {
+			return nil, err
+		}
+		if h != nil {
+			ret = append(ret, storage.Node{
+				NodeID: nodeID,
+				Hash:   h,
+			})
+		}
+	}
+
+	return ret, nil
+}
+
+func (t *treeTX) SetMerkleNodes(nodes []storage.Node) error {
+	for _, n := range nodes {
+		err := t.subtreeCache.SetNodeHash(n.NodeID, n.Hash,
+			func(nID storage.NodeID) (*storage.SubtreeProto, error) {
+				return t.getSubtree(t.writeRevision, nID)
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *treeTX) Commit() error {
+	if t.writeRevision > -1 {
+		if err := t.subtreeCache.Flush(t.storeSubtrees); err != nil {
+			glog.Warningf("TX commit flush error: %s", err)
+			t.closed = true
+			t.tx.Rollback()
+			return err
+		}
+	}
+	t.closed = true
+	err := t.tx.Commit()
+
+	if err != nil {
+		glog.Warningf("TX commit error: %s", err)
+	}
+
+	return err
+}
+
+func (t *treeTX) Rollback() error {
+	t.closed = true
+	err := t.tx.Rollback()
+
+	if err != nil {
+		glog.Warningf("TX rollback error: %s", err)
+	}
+
+	return err
+}
+
+func (t *treeTX) IsOpen() bool {
+	return !t.closed
+}
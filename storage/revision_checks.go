@@ -0,0 +1,51 @@
+package storage
+
+import "fmt"
+
+// RestoredFunc reports whether any revision of a map from revision on has been
+// restored from archive.
+type RestoredFunc func(revision int64) (bool, error)
+
+// CheckRevisionReadable returns a RevisionOutOfRangeError if revision is before
+// oldest, the oldest revision a map retains, and has not been restored from
+// archive.
+func CheckRevisionReadable(revision, oldest int64, restored RestoredFunc) error {
+	if revision >= oldest {
+		return nil
+	}
+	// A pruned revision can still be read while it is restored from archive
+	ok, err := restored(revision)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return RevisionOutOfRangeError{Revision: revision, OldestRetained: oldest}
+	}
+	return nil
+}
+
+// CheckRevisionDeletable returns an error if the data superseded before
+// revision can't be deleted from a map whose oldest retained revision is
+// oldest, see MapRetention.DeleteMapLeavesBelowRevision.
+func CheckRevisionDeletable(revision, oldest int64, restored RestoredFunc) error {
+	if revision > oldest {
+		return fmt.Errorf("cannot delete map leaves below revision %d, oldest retained revision is %d", revision, oldest)
+	}
+	ok, err := restored(0)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return fmt.Errorf("cannot delete map leaves below revision %d while revisions are restored", revision)
+	}
+	return nil
+}
+
+// CheckRevisionArchivable returns an error unless revision is before oldest, the
+// oldest revision a map retains, see MapArchiver.GetArchivableRevision.
+func CheckRevisionArchivable(revision, oldest int64) error {
+	if revision >= oldest {
+		return fmt.Errorf("revision %d cannot be archived as it is retained, oldest retained revision is %d", revision, oldest)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+// restoredUpTo returns a RestoredFunc for a map whose revisions up to first
+// have been restored, or none if first is negative.
+func restoredUpTo(first int64) RestoredFunc {
+	return func(revision int64) (bool, error) {
+		return first >= 0 && revision <= first, nil
+	}
+}
+
+func TestCheckRevisionReadable(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		revision int64
+		restored RestoredFunc
+		want     error
+	}{
+		{desc: "retained", revision: 10, restored: restoredUpTo(-1)},
+		{desc: "pruned", revision: 9, restored: restoredUpTo(-1), want: RevisionOutOfRangeError{Revision: 9, OldestRetained: 10}},
+		{desc: "restored", revision: 5, restored: restoredUpTo(7)},
+		{desc: "before restored", revision: 8, restored: restoredUpTo(7), want: RevisionOutOfRangeError{Revision: 8, OldestRetained: 10}},
+	} {
+		if got := CheckRevisionReadable(test.revision, 10, test.restored); got != test.want {
+			t.Errorf("%s: CheckRevisionReadable(%d, 10) = %v, want %v", test.desc, test.revision, got, test.want)
+		}
+	}
+
+	failed := errors.New("failed")
+	fail := func(int64) (bool, error) { return false, failed }
+	if err := CheckRevisionReadable(5, 10, fail); err != failed {
+		t.Errorf("CheckRevisionReadable() = %v, want %v", err, failed)
+	}
+}
+
+func TestCheckRevisionDeletable(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		revision int64
+		restored RestoredFunc
+		ok       bool
+	}{
+		{desc: "oldest", revision: 10, restored: restoredUpTo(-1), ok: true},
+		{desc: "before oldest", revision: 5, restored: restoredUpTo(-1), ok: true},
+		{desc: "after oldest", revision: 11, restored: restoredUpTo(-1)},
+		{desc: "restored", revision: 5, restored: restoredUpTo(3)},
+	} {
+		if err := CheckRevisionDeletable(test.revision, 10, test.restored); (err == nil) != test.ok {
+			t.Errorf("%s: CheckRevisionDeletable(%d, 10) = %v, want success %v", test.desc, test.revision, err, test.ok)
+		}
+	}
+}
+
+func TestCheckRevisionArchivable(t *testing.T) {
+	if err := CheckRevisionArchivable(9, 10); err != nil {
+		t.Errorf("CheckRevisionArchivable(9, 10) = %v, want no error", err)
+	}
+	if err := CheckRevisionArchivable(10, 10); err == nil {
+		t.Error("CheckRevisionArchivable(10, 10) succeeded for a retained revision")
+	}
+}
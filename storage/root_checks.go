@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/google/trillian"
+)
+
+// NonMonotonicRootError is returned when a new root doesn't follow on from the
+// current one, for example because the clock has stepped backwards.
+type NonMonotonicRootError struct {
+	// Field names the value that went backwards.
+	Field string
+	// Current and New are the values in the current and new roots.
+	Current int64
+	New     int64
+}
+
+func (e NonMonotonicRootError) Error() string {
+	return fmt.Sprintf("storage: New root has %s %d, which does not follow the current root's %d", e.Field, e.New, e.Current)
+}
+
+// checkTimestamp checks a new root's timestamp is later than the current one,
+// or no more than maxSkew earlier.
+func checkTimestamp(current, next int64, maxSkew time.Duration) error {
+	if next <= current-maxSkew.Nanoseconds() {
+		return NonMonotonicRootError{Field: "timestamp", Current: current, New: next}
+	}
+	return nil
+}
+
+// CheckLogRootFollows returns a NonMonotonicRootError unless next has a higher
+// revision than current, a tree size that is no smaller, and a timestamp that
+// is later or within maxSkew of current's. A root with the same tree size is
+// allowed as roots are signed periodically even if no leaves have been added.
+func CheckLogRootFollows(current, next trillian.SignedLogRoot, maxSkew time.Duration) error {
+	if next.TreeRevision <= current.TreeRevision {
+		return NonMonotonicRootError{Field: "revision", Current: current.TreeRevision, New: next.TreeRevision}
+	}
+	if next.TreeSize < current.TreeSize {
+		return NonMonotonicRootError{Field: "tree size", Current: current.TreeSize, New: next.TreeSize}
+	}
+	return checkTimestamp(current.TimestampNanos, next.TimestampNanos, maxSkew)
+}
+
+// CheckMapRootFollows returns a NonMonotonicRootError unless next has a higher
+// revision than current, and a timestamp that is later or within maxSkew of
+// current's.
+func CheckMapRootFollows(current, next trillian.SignedMapRoot, maxSkew time.Duration) error {
+	if next.MapRevision <= current.MapRevision {
+		return NonMonotonicRootError{Field: "revision", Current: current.MapRevision, New: next.MapRevision}
+	}
+	return checkTimestamp(current.TimestampNanos, next.TimestampNanos, maxSkew)
+}
+
+// CheckLogRootRefresh returns an error unless next re-signs current with a
+// later timestamp, keeping its revision, tree size and root hash.
+func CheckLogRootRefresh(current, next trillian.SignedLogRoot) error {
+	if next.TreeRevision != current.TreeRevision {
+		return NonMonotonicRootError{Field: "revision", Current: current.TreeRevision, New: next.TreeRevision}
+	}
+	if next.TreeSize != current.TreeSize {
+		return NonMonotonicRootError{Field: "tree size", Current: current.TreeSize, New: next.TreeSize}
+	}
+	if !bytes.Equal(next.RootHash, current.RootHash) {
+		return fmt.Errorf("storage: Refreshed root has hash %x, which differs from the current root's %x", next.RootHash, current.RootHash)
+	}
+	return checkTimestamp(current.TimestampNanos, next.TimestampNanos, 0)
+}
+
+// CheckMapRootRefresh returns an error unless next re-signs current with a
+// later timestamp, keeping its revision and root hash.
+func CheckMapRootRefresh(current, next trillian.SignedMapRoot) error {
+	if next.MapRevision != current.MapRevision {
+		return NonMonotonicRootError{Field: "revision", Current: current.MapRevision, New: next.MapRevision}
+	}
+	if !bytes.Equal(next.RootHash, current.RootHash) {
+		return fmt.Errorf("storage: Refreshed root has hash %x, which differs from the current root's %x", next.RootHash, current.RootHash)
+	}
+	return checkTimestamp(current.TimestampNanos, next.TimestampNanos, 0)
+}
+
+// CheckMapperMetadataFollows returns an error unless the log entries that next
+// records a new map revision applying follow on from those current records the
+// map as having consumed, so that none are skipped or applied twice. Either may
+// be nil. Metadata without a source log isn't checked.
+func CheckMapperMetadataFollows(current, next *trillian.MapperMetadata) error {
+	if next == nil || len(next.SourceLogId) == 0 {
+		return nil
+	}
+	consumed := int64(-1)
+	if current != nil && len(current.SourceLogId) > 0 {
+		if !bytes.Equal(next.SourceLogId, current.SourceLogId) {
+			return fmt.Errorf("storage: New root is mapped from log %s, but the current root is mapped from log %s", next.SourceLogId, current.SourceLogId)
+		}
+		consumed = current.HighestFullyCompletedSeq
+	}
+	if next.RevisionStartSeq != consumed+1 {
+		return fmt.Errorf("storage: New root applies log entries from %d, but the current root has applied them up to %d", next.RevisionStartSeq, consumed)
+	}
+	if next.HighestFullyCompletedSeq < consumed {
+		return fmt.Errorf("storage: New root has applied log entries up to %d, which is before the current root's %d", next.HighestFullyCompletedSeq, consumed)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+)
+
+func TestCheckLogRootFollows(t *testing.T) {
+	current := trillian.SignedLogRoot{TreeRevision: 5, TreeSize: 10, TimestampNanos: 1000}
+	for _, test := range []struct {
+		next    trillian.SignedLogRoot
+		maxSkew time.Duration
+		field   string
+	}{
+		{next: trillian.SignedLogRoot{TreeRevision: 6, TreeSize: 11, TimestampNanos: 1001}},
+		{next: trillian.SignedLogRoot{TreeRevision: 6, TreeSize: 10, TimestampNanos: 1001}},
+		{next: trillian.SignedLogRoot{TreeRevision: 5, TreeSize: 11, TimestampNanos: 1001}, field: "revision"},
+		{next: trillian.SignedLogRoot{TreeRevision: 6, TreeSize: 9, TimestampNanos: 1001}, field: "tree size"},
+		{next: trillian.SignedLogRoot{TreeRevision: 6, TreeSize: 11, TimestampNanos: 1000}, field: "timestamp"},
+		{next: trillian.SignedLogRoot{TreeRevision: 6, TreeSize: 11, TimestampNanos: 995}, maxSkew: 10},
+		{next: trillian.SignedLogRoot{TreeRevision: 6, TreeSize: 11, TimestampNanos: 990}, maxSkew: 10, field: "timestamp"},
+	} {
+		err := CheckLogRootFollows(current, test.next, test.maxSkew)
+		if test.field == "" {
+			if err != nil {
+				t.Errorf("CheckLogRootFollows(%+v, %v) = %v, want nil", test.next, test.maxSkew, err)
+			}
+			continue
+		}
+		if e, ok := err.(NonMonotonicRootError); !ok || e.Field != test.field {
+			t.Errorf("CheckLogRootFollows(%+v, %v) = %v, want a NonMonotonicRootError for %s", test.next, test.maxSkew, err, test.field)
+		}
+	}
+}
+
+func TestCheckMapRootFollows(t *testing.T) {
+	current := trillian.SignedMapRoot{MapRevision: 5, TimestampNanos: 1000}
+	for _, test := range []struct {
+		next    trillian.SignedMapRoot
+		maxSkew time.Duration
+		field   string
+	}{
+		{next: trillian.SignedMapRoot{MapRevision: 6, TimestampNanos: 1001}},
+		{next: trillian.SignedMapRoot{MapRevision: 4, TimestampNanos: 1001}, field: "revision"},
+		{next: trillian.SignedMapRoot{MapRevision: 6, TimestampNanos: 999}, field: "timestamp"},
+		{next: trillian.SignedMapRoot{MapRevision: 6, TimestampNanos: 999}, maxSkew: 2},
+	} {
+		err := CheckMapRootFollows(current, test.next, test.maxSkew)
+		if test.field == "" {
+			if err != nil {
+				t.Errorf("CheckMapRootFollows(%+v, %v) = %v, want nil", test.next, test.maxSkew, err)
+			}
+			continue
+		}
+		if e, ok := err.(NonMonotonicRootError); !ok || e.Field != test.field {
+			t.Errorf("CheckMapRootFollows(%+v, %v) = %v, want a NonMonotonicRootError for %s", test.next, test.maxSkew, err, test.field)
+		}
+	}
+}
+
+func TestCheckLogRootRefresh(t *testing.T) {
+	current := trillian.SignedLogRoot{TreeRevision: 5, TreeSize: 10, RootHash: []byte("root"), TimestampNanos: 1000}
+	for _, test := range []struct {
+		next    trillian.SignedLogRoot
+		wantErr bool
+	}{
+		{next: trillian.SignedLogRoot{TreeRevision: 5, TreeSize: 10, RootHash: []byte("root"), TimestampNanos: 1001}},
+		{next: trillian.SignedLogRoot{TreeRevision: 6, TreeSize: 10, RootHash: []byte("root"), TimestampNanos: 1001}, wantErr: true},
+		{next: trillian.SignedLogRoot{TreeRevision: 5, TreeSize: 11, RootHash: []byte("root"), TimestampNanos: 1001}, wantErr: true},
+		{next: trillian.SignedLogRoot{TreeRevision: 5, TreeSize: 10, RootHash: []byte("other"), TimestampNanos: 1001}, wantErr: true},
+		{next: trillian.SignedLogRoot{TreeRevision: 5, TreeSize: 10, RootHash: []byte("root"), TimestampNanos: 1000}, wantErr: true},
+	} {
+		if err := CheckLogRootRefresh(current, test.next); (err != nil) != test.wantErr {
+			t.Errorf("CheckLogRootRefresh(%+v) = %v, want error %v", test.next, err, test.wantErr)
+		}
+	}
+}
+
+func TestCheckMapRootRefresh(t *testing.T) {
+	current := trillian.SignedMapRoot{MapRevision: 5, RootHash: []byte("root"), TimestampNanos: 1000}
+	for _, test := range []struct {
+		next    trillian.SignedMapRoot
+		wantErr bool
+	}{
+		{next: trillian.SignedMapRoot{MapRevision: 5, RootHash: []byte("root"), TimestampNanos: 1001}},
+		{next: trillian.SignedMapRoot{MapRevision: 6, RootHash: []byte("root"), TimestampNanos: 1001}, wantErr: true},
+		{next: trillian.SignedMapRoot{MapRevision: 5, RootHash: []byte("other"), TimestampNanos: 1001}, wantErr: true},
+		{next: trillian.SignedMapRoot{MapRevision: 5, RootHash: []byte("root"), TimestampNanos: 999}, wantErr: true},
+	} {
+		if err := CheckMapRootRefresh(current, test.next); (err != nil) != test.wantErr {
+			t.Errorf("CheckMapRootRefresh(%+v) = %v, want error %v", test.next, err, test.wantErr)
+		}
+	}
+}
+
+func TestCheckMapperMetadataFollows(t *testing.T) {
+	current := &trillian.MapperMetadata{SourceLogId: []byte("log"), HighestFullyCompletedSeq: 9}
+	for _, test := range []struct {
+		desc    string
+		current *trillian.MapperMetadata
+		next    *trillian.MapperMetadata
+		wantErr bool
+	}{
+		{desc: "no metadata", current: current},
+		{desc: "no source log", current: current, next: &trillian.MapperMetadata{HighestFullyCompletedSeq: 3}},
+		{desc: "first batch", next: &trillian.MapperMetadata{SourceLogId: []byte("log"), HighestFullyCompletedSeq: 4}},
+		{desc: "first batch after unsourced root", current: &trillian.MapperMetadata{HighestFullyCompletedSeq: 7}, next: &trillian.MapperMetadata{SourceLogId: []byte("log"), HighestFullyCompletedSeq: 4}},
+		{desc: "first batch not from start", next: &trillian.MapperMetadata{SourceLogId: []byte("log"), RevisionStartSeq: 1, HighestFullyCompletedSeq: 4}, wantErr: true},
+		{desc: "next batch", current: current, next: &trillian.MapperMetadata{SourceLogId: []byte("log"), RevisionStartSeq: 10, HighestFullyCompletedSeq: 14}},
+		{desc: "empty batch", current: current, next: &trillian.MapperMetadata{SourceLogId: []byte("log"), RevisionStartSeq: 10, HighestFullyCompletedSeq: 9}},
+		{desc: "skipped entries", current: current, next: &trillian.MapperMetadata{SourceLogId: []byte("log"), RevisionStartSeq: 11, HighestFullyCompletedSeq: 14}, wantErr: true},
+		{desc: "repeated entries", current: current, next: &trillian.MapperMetadata{SourceLogId: []byte("log"), RevisionStartSeq: 5, HighestFullyCompletedSeq: 14}, wantErr: true},
+		{desc: "backwards", current: current, next: &trillian.MapperMetadata{SourceLogId: []byte("log"), RevisionStartSeq: 10, HighestFullyCompletedSeq: 8}, wantErr: true},
+		{desc: "other log", current: current, next: &trillian.MapperMetadata{SourceLogId: []byte("other"), RevisionStartSeq: 10, HighestFullyCompletedSeq: 14}, wantErr: true},
+	} {
+		if err := CheckMapperMetadataFollows(test.current, test.next); (err != nil) != test.wantErr {
+			t.Errorf("%s: CheckMapperMetadataFollows() = %v, want error %v", test.desc, err, test.wantErr)
+		}
+	}
+}
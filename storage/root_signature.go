@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+)
+
+// MarshalRootSignature returns the form in which the signatures of a tree head
+// are stored: its signature, and its key signatures made while the tree's key
+// is being rotated. Without key signatures it's the same as the marshaled
+// signature.
+func MarshalRootSignature(signature *trillian.DigitallySigned, keySignatures []*trillian.KeySignature) ([]byte, error) {
+	if signature == nil {
+		return nil, proto.ErrNil
+	}
+	return proto.Marshal(&RootSignatureProto{
+		SignatureAlgorithm: signature.SignatureAlgorithm,
+		HashAlgorithm:      signature.HashAlgorithm,
+		Signature:          signature.Signature,
+		KeySignatures:      keySignatures,
+	})
+}
+
+// UnmarshalRootSignature reads signatures written by MarshalRootSignature,
+// setting signature and returning the key signatures, if there are any.
+func UnmarshalRootSignature(data []byte, signature *trillian.DigitallySigned) ([]*trillian.KeySignature, error) {
+	var stored RootSignatureProto
+	if err := proto.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	*signature = trillian.DigitallySigned{
+		SignatureAlgorithm: stored.SignatureAlgorithm,
+		HashAlgorithm:      stored.HashAlgorithm,
+		Signature:          stored.Signature,
+	}
+	return stored.KeySignatures, nil
+}
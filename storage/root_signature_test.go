@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+)
+
+func TestRootSignatureRoundTrip(t *testing.T) {
+	signature := trillian.DigitallySigned{SignatureAlgorithm: trillian.SignatureAlgorithm_ECDSA, HashAlgorithm: trillian.HashAlgorithm_SHA256, Signature: []byte("signed")}
+	keySignatures := []*trillian.KeySignature{{KeyId: "key2", Signature: &trillian.DigitallySigned{SignatureAlgorithm: trillian.SignatureAlgorithm_RSA, Signature: []byte("signed by key2")}}}
+
+	data, err := MarshalRootSignature(&signature, keySignatures)
+	if err != nil {
+		t.Fatalf("MarshalRootSignature() = %v", err)
+	}
+	var got trillian.DigitallySigned
+	gotKeySignatures, err := UnmarshalRootSignature(data, &got)
+	if err != nil {
+		t.Fatalf("UnmarshalRootSignature() = %v", err)
+	}
+	if !reflect.DeepEqual(got, signature) || len(gotKeySignatures) != 1 || !proto.Equal(gotKeySignatures[0], keySignatures[0]) {
+		t.Errorf("UnmarshalRootSignature() = %v, %v, want %v, %v", got, gotKeySignatures, signature, keySignatures)
+	}
+
+	// Signatures stored as a plain DigitallySigned read the same, and those
+	// without key signatures can be read as one
+	plain, err := proto.Marshal(&signature)
+	if err != nil {
+		t.Fatalf("Marshal() = %v", err)
+	}
+	if gotKeySignatures, err := UnmarshalRootSignature(plain, &got); err != nil || !reflect.DeepEqual(got, signature) || gotKeySignatures != nil {
+		t.Errorf("UnmarshalRootSignature(DigitallySigned) = %v, %v, %v, want %v", got, gotKeySignatures, err, signature)
+	}
+	withoutKeys, err := MarshalRootSignature(&signature, nil)
+	if err != nil {
+		t.Fatalf("MarshalRootSignature() = %v", err)
+	}
+	if string(withoutKeys) != string(plain) {
+		t.Errorf("MarshalRootSignature() without key signatures = %x, want %x", withoutKeys, plain)
+	}
+}
@@ -0,0 +1,281 @@
+package routing
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+)
+
+// LogOpener opens the storage for a log held by the named backend.
+type LogOpener func(backend string, treeID int64) (storage.LogStorage, error)
+
+// MapOpener opens the storage for a map held by the named backend.
+type MapOpener func(backend string, treeID int64) (storage.MapStorage, error)
+
+// checkBackend returns an error if backend is not one of backends.
+func checkBackend(treeID int64, backend string, backends []string) error {
+	for _, b := range backends {
+		if b == backend {
+			return nil
+		}
+	}
+	return fmt.Errorf("tree %d is routed to unknown backend %q", treeID, backend)
+}
+
+// evictedCloseDelay is how long storage that's no longer cached is kept open,
+// so that transactions already using it can finish.
+const evictedCloseDelay = time.Minute
+
+// closeLater closes s after evictedCloseDelay, if it can be closed.
+func closeLater(treeID int64, s interface{}) {
+	c, ok := s.(io.Closer)
+	if !ok {
+		return
+	}
+	time.AfterFunc(evictedCloseDelay, func() {
+		if err := c.Close(); err != nil {
+			glog.Warningf("%d: failed to close storage: %v", treeID, err)
+		}
+	})
+}
+
+type routedLogStorage struct {
+	backend string
+	s       storage.LogStorage
+}
+
+// LogStorageProvider opens the storage for each log on the backend that the
+// router assigns it to. Storage is cached, and opened again on the new backend
+// if the log is moved.
+type LogStorageProvider struct {
+	router   *Router
+	backends []string
+	open     LogOpener
+	// Must hold this lock before accessing the fields below
+	mu   sync.Mutex
+	logs map[int64]routedLogStorage
+	all  storage.LogStorage
+}
+
+// NewLogStorageProvider creates a LogStorageProvider. Backends lists the name of
+// every backend which may hold logs, including DefaultBackend.
+func NewLogStorageProvider(router *Router, backends []string, open LogOpener) *LogStorageProvider {
+	return &LogStorageProvider{router: router, backends: backends, open: open, logs: make(map[int64]routedLogStorage)}
+}
+
+// LogStorage returns the storage for treeID.
+func (p *LogStorageProvider) LogStorage(treeID int64) (storage.LogStorage, error) {
+	backend := p.router.Backend(treeID)
+	if err := checkBackend(treeID, backend, p.backends); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	l, ok := p.logs[treeID]
+	if ok && l.backend == backend {
+		return l.s, nil
+	}
+	glog.Infof("%d: opening log storage on backend %q", treeID, backend)
+	s, err := p.open(backend, treeID)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		closeLater(treeID, l.s)
+	}
+	p.logs[treeID] = routedLogStorage{backend: backend, s: s}
+	return s, nil
+}
+
+// Evict drops the cached storage for treeID, so that it's opened again with
+// the tree's current settings the next time it's used. The old storage is
+// closed once transactions already using it have had time to finish.
+func (p *LogStorageProvider) Evict(treeID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if l, ok := p.logs[treeID]; ok {
+		delete(p.logs, treeID)
+		closeLater(treeID, l.s)
+	}
+}
+
+// AllLogs returns storage for operations which apply to every log rather than
+// one tree, such as listing the active logs. Its transactions run on the default
+// backend, except that the lists of active logs include the logs on every
+// backend.
+func (p *LogStorageProvider) AllLogs() (storage.LogStorage, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.all != nil {
+		return p.all, nil
+	}
+
+	all := &allLogsStorage{}
+	for _, backend := range p.backends {
+		// TODO(Martin2112): Have to pass a tree ID when we just want metadata
+		s, err := p.open(backend, 0)
+		if err != nil {
+			return nil, err
+		}
+		if backend == DefaultBackend {
+			all.LogStorage = s
+		} else {
+			all.others = append(all.others, s)
+		}
+	}
+	if all.LogStorage == nil {
+		return nil, fmt.Errorf("the default backend is not configured")
+	}
+	p.all = all
+	return all, nil
+}
+
+// allLogsStorage is the storage returned by AllLogs. The embedded LogStorage is
+// for the default backend.
+type allLogsStorage struct {
+	storage.LogStorage
+	others []storage.LogStorage
+}
+
+func (s *allLogsStorage) Begin() (storage.LogTX, error) {
+	tx, err := s.LogStorage.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &allLogsTX{LogTX: tx, others: s.others}, nil
+}
+
+type allLogsTX struct {
+	storage.LogTX
+	others []storage.LogStorage
+}
+
+// GetActiveLogIDs implements storage.LogMetadata.
+func (t *allLogsTX) GetActiveLogIDs() ([]trillian.LogID, error) {
+	return t.collect(storage.LogTX.GetActiveLogIDs)
+}
+
+// GetActiveLogIDsWithPendingWork implements storage.LogMetadata.
+func (t *allLogsTX) GetActiveLogIDsWithPendingWork() ([]trillian.LogID, error) {
+	return t.collect(storage.LogTX.GetActiveLogIDsWithPendingWork)
+}
+
+// collect calls list on this transaction and on a new transaction on each of
+// the other backends, and returns all the log IDs found. A log found on more
+// than one backend, as it can be while it's being moved, is returned once.
+func (t *allLogsTX) collect(list func(storage.LogTX) ([]trillian.LogID, error)) ([]trillian.LogID, error) {
+	ids, err := list(t.LogTX)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range t.others {
+		tx, err := s.Begin()
+		if err != nil {
+			return nil, err
+		}
+		more, err := list(tx)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		ids = append(ids, more...)
+	}
+
+	seen := make(map[int64]bool)
+	unique := ids[:0]
+	for _, id := range ids {
+		if !seen[id.TreeID] {
+			seen[id.TreeID] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique, nil
+}
+
+type routedMapStorage struct {
+	backend string
+	s       storage.MapStorage
+}
+
+// MapStorageProvider opens the storage for each map on the backend that the
+// router assigns it to. Storage is cached, and opened again on the new backend
+// if the map is moved.
+type MapStorageProvider struct {
+	router   *Router
+	backends []string
+	open     MapOpener
+	// Must hold this lock before accessing maps
+	mu   sync.Mutex
+	maps map[int64]routedMapStorage
+}
+
+// NewMapStorageProvider creates a MapStorageProvider. Backends lists the name of
+// every backend which may hold maps, including DefaultBackend.
+func NewMapStorageProvider(router *Router, backends []string, open MapOpener) *MapStorageProvider {
+	return &MapStorageProvider{router: router, backends: backends, open: open, maps: make(map[int64]routedMapStorage)}
+}
+
+// MapStorage returns the storage for treeID.
+func (p *MapStorageProvider) MapStorage(treeID int64) (storage.MapStorage, error) {
+	backend := p.router.Backend(treeID)
+	if err := checkBackend(treeID, backend, p.backends); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m, ok := p.maps[treeID]
+	if ok && m.backend == backend {
+		return m.s, nil
+	}
+	glog.Infof("%d: opening map storage on backend %q", treeID, backend)
+	s, err := p.open(backend, treeID)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		closeLater(treeID, m.s)
+	}
+	p.maps[treeID] = routedMapStorage{backend: backend, s: s}
+	return s, nil
+}
+
+// Evict drops the cached storage for treeID, so that it's opened again with
+// the tree's current settings the next time it's used. The old storage is
+// closed once transactions already using it have had time to finish.
+func (p *MapStorageProvider) Evict(treeID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if m, ok := p.maps[treeID]; ok {
+		delete(p.maps, treeID)
+		closeLater(treeID, m.s)
+	}
+}
+
+// OpenMaps returns the storage for every map that has been opened, on the
+// backend it was last opened on.
+func (p *MapStorageProvider) OpenMaps() []storage.MapStorage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	maps := make([]storage.MapStorage, 0, len(p.maps))
+	for _, m := range p.maps {
+		maps = append(maps, m.s)
+	}
+	return maps
+}
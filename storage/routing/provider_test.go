@@ -0,0 +1,156 @@
+package routing
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+)
+
+// testRouter returns a Router with the given routes, which can be changed
+// before calling Reload.
+func testRouter(t *testing.T, routes *map[int64]string) *Router {
+	r, err := NewRouter(func() (map[int64]string, error) { return *routes, nil })
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	return r
+}
+
+type openCall struct {
+	backend string
+	treeID  int64
+}
+
+func TestMapStorageProviderFollowsRoutes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	routes := map[int64]string{2: "east"}
+	router := testRouter(t, &routes)
+
+	var opened []openCall
+	p := NewMapStorageProvider(router, []string{DefaultBackend, "east", "west"}, func(backend string, treeID int64) (storage.MapStorage, error) {
+		opened = append(opened, openCall{backend, treeID})
+		return storage.NewMockMapStorage(ctrl), nil
+	})
+
+	s1, err := p.MapStorage(1)
+	if err != nil {
+		t.Fatalf("MapStorage(1) failed: %v", err)
+	}
+	s2, err := p.MapStorage(2)
+	if err != nil {
+		t.Fatalf("MapStorage(2) failed: %v", err)
+	}
+	// Storage is cached while the route doesn't change
+	if s, _ := p.MapStorage(2); s != s2 {
+		t.Fatalf("MapStorage(2) opened storage again for an unchanged route")
+	}
+
+	routes = map[int64]string{2: "west"}
+	if _, err := router.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if s, _ := p.MapStorage(2); s == s2 {
+		t.Fatalf("MapStorage(2) returned storage for the old backend after the map moved")
+	}
+	if s, _ := p.MapStorage(1); s != s1 {
+		t.Fatalf("MapStorage(1) opened storage again for an unchanged route")
+	}
+
+	want := []openCall{{DefaultBackend, 1}, {"east", 2}, {"west", 2}}
+	if !reflect.DeepEqual(opened, want) {
+		t.Fatalf("Opened %v, want %v", opened, want)
+	}
+	if got := len(p.OpenMaps()); got != 2 {
+		t.Fatalf("OpenMaps() returned %d maps, want 2", got)
+	}
+}
+
+func TestLogStorageProviderEvict(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	routes := map[int64]string{}
+	opened := 0
+	p := NewLogStorageProvider(testRouter(t, &routes), []string{DefaultBackend}, func(string, int64) (storage.LogStorage, error) {
+		opened++
+		return storage.NewMockLogStorage(ctrl), nil
+	})
+
+	s1, err := p.LogStorage(1)
+	if err != nil {
+		t.Fatalf("LogStorage(1) failed: %v", err)
+	}
+	p.Evict(1)
+	// Evicting a tree that isn't cached does nothing
+	p.Evict(2)
+	s2, err := p.LogStorage(1)
+	if err != nil {
+		t.Fatalf("LogStorage(1) failed: %v", err)
+	}
+	if s1 == s2 || opened != 2 {
+		t.Errorf("LogStorage(1) after Evict() returned the cached storage, opened %d times", opened)
+	}
+}
+
+func TestProviderUnknownBackend(t *testing.T) {
+	routes := map[int64]string{3: "north"}
+	router := testRouter(t, &routes)
+
+	p := NewLogStorageProvider(router, []string{DefaultBackend}, func(string, int64) (storage.LogStorage, error) {
+		t.Fatalf("Storage opened for a tree on an unknown backend")
+		return nil, nil
+	})
+	if _, err := p.LogStorage(3); err == nil {
+		t.Fatalf("LogStorage(3) succeeded for a tree on an unknown backend")
+	}
+}
+
+func TestAllLogsListsEveryBackend(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	routes := map[int64]string{}
+	router := testRouter(t, &routes)
+
+	defaultTX := storage.NewMockLogTX(ctrl)
+	defaultTX.EXPECT().GetActiveLogIDs().Return([]trillian.LogID{{TreeID: 1}}, nil)
+	defaultTX.EXPECT().Commit().Return(nil)
+	defaultStorage := storage.NewMockLogStorage(ctrl)
+	defaultStorage.EXPECT().Begin().Return(defaultTX, nil)
+
+	eastTX := storage.NewMockLogTX(ctrl)
+	// Log 1 is on both backends, as when it's being moved
+	eastTX.EXPECT().GetActiveLogIDs().Return([]trillian.LogID{{TreeID: 2}, {TreeID: 1}, {TreeID: 3}}, nil)
+	eastTX.EXPECT().Commit().Return(nil)
+	eastStorage := storage.NewMockLogStorage(ctrl)
+	eastStorage.EXPECT().Begin().Return(eastTX, nil)
+
+	stores := map[string]storage.LogStorage{DefaultBackend: defaultStorage, "east": eastStorage}
+	p := NewLogStorageProvider(router, []string{DefaultBackend, "east"}, func(backend string, treeID int64) (storage.LogStorage, error) {
+		return stores[backend], nil
+	})
+
+	s, err := p.AllLogs()
+	if err != nil {
+		t.Fatalf("AllLogs failed: %v", err)
+	}
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	ids, err := tx.GetActiveLogIDs()
+	if err != nil {
+		t.Fatalf("GetActiveLogIDs failed: %v", err)
+	}
+	if want := []trillian.LogID{{TreeID: 1}, {TreeID: 2}, {TreeID: 3}}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("GetActiveLogIDs returned %v, want %v", ids, want)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Package routing allows one set of servers to serve trees which are held in
+// several storage backends, such as different databases.
+package routing
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DefaultBackend is the name of the backend that holds trees without a route.
+const DefaultBackend = ""
+
+// RouteLoader returns the name of the backend holding each routed tree, keyed by
+// tree ID.
+type RouteLoader func() (map[int64]string, error)
+
+// Router assigns trees to backends according to routes loaded from
+// configuration, usually held in the administration database. The routes can be
+// reloaded while the Router is in use. It is safe for concurrent use.
+type Router struct {
+	load RouteLoader
+	// Must hold this lock before accessing routes
+	mu     sync.RWMutex
+	routes map[int64]string
+}
+
+// NewRouter creates a Router and loads its routes. If load is nil every tree is
+// routed to the default backend.
+func NewRouter(load RouteLoader) (*Router, error) {
+	r := &Router{load: load, routes: make(map[int64]string)}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Backend returns the name of the backend holding treeID.
+func (r *Router) Backend(treeID int64) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if backend, ok := r.routes[treeID]; ok {
+		return backend
+	}
+	return DefaultBackend
+}
+
+// Reload reads the routes again, returning whether any tree has moved. The
+// existing routes are kept if they can't be read.
+func (r *Router) Reload() (bool, error) {
+	if r.load == nil {
+		return false, nil
+	}
+	routes, err := r.load()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := len(routes) != len(r.routes)
+	for treeID, backend := range routes {
+		if old, ok := r.routes[treeID]; !ok || old != backend {
+			glog.Infof("%d: tree routed to backend %q", treeID, backend)
+			changed = true
+		}
+	}
+	for treeID := range r.routes {
+		if _, ok := routes[treeID]; !ok {
+			glog.Infof("%d: tree routed to default backend", treeID)
+		}
+	}
+	r.routes = routes
+	return changed, nil
+}
+
+// Watch reloads the routes every interval until done is closed, so that
+// changes to the configuration are picked up without a restart.
+func (r *Router) Watch(done <-chan struct{}, interval time.Duration) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+
+		if _, err := r.Reload(); err != nil {
+			glog.Warningf("Failed to reload tree routes, keeping existing routes: %v", err)
+		}
+	}
+}
+
+// ParseBackends parses a comma separated list of name=uri pairs, as might be
+// supplied by a command line flag, into a map from backend name to URI. Names
+// must be unique and not empty, as the empty name is DefaultBackend. An empty
+// string results in an empty map.
+func ParseBackends(backends string) (map[string]string, error) {
+	result := make(map[string]string)
+
+	if len(strings.TrimSpace(backends)) == 0 {
+		return result, nil
+	}
+
+	// Errors don't include the pair as the uri could contain credentials
+	for i, pair := range strings.Split(backends, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("backend %d not in name=uri form", i)
+		}
+
+		name := strings.TrimSpace(parts[0])
+		if name == DefaultBackend {
+			return nil, fmt.Errorf("backend %d has no name", i)
+		}
+		if _, ok := result[name]; ok {
+			return nil, fmt.Errorf("duplicate backend name: %s", name)
+		}
+
+		result[name] = strings.TrimSpace(parts[1])
+	}
+
+	return result, nil
+}
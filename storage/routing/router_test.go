@@ -0,0 +1,81 @@
+package routing
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRouterReload(t *testing.T) {
+	var routes map[int64]string
+	var loadErr error
+	r, err := NewRouter(func() (map[int64]string, error) { return routes, loadErr })
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	if got := r.Backend(1); got != DefaultBackend {
+		t.Fatalf("Backend(1) = %q with no routes, want default", got)
+	}
+
+	for _, test := range []struct {
+		routes  map[int64]string
+		loadErr error
+		changed bool
+		want    map[int64]string
+	}{
+		{routes: map[int64]string{1: "a", 2: "b"}, changed: true, want: map[int64]string{1: "a", 2: "b", 3: DefaultBackend}},
+		{routes: map[int64]string{1: "a", 2: "b"}, changed: false, want: map[int64]string{1: "a", 2: "b"}},
+		{routes: map[int64]string{1: "a", 2: "c"}, changed: true, want: map[int64]string{1: "a", 2: "c"}},
+		{routes: map[int64]string{1: "a"}, changed: true, want: map[int64]string{1: "a", 2: DefaultBackend}},
+		// Routes are kept if they can't be loaded
+		{routes: nil, loadErr: errors.New("db down"), want: map[int64]string{1: "a", 2: DefaultBackend}},
+	} {
+		routes, loadErr = test.routes, test.loadErr
+		changed, err := r.Reload()
+		if gotErr := err != nil; gotErr != (test.loadErr != nil) {
+			t.Errorf("Reload() with routes %v returned error %v, want error %v", test.routes, err, test.loadErr)
+		}
+		if changed != test.changed {
+			t.Errorf("Reload() with routes %v returned changed %v, want %v", test.routes, changed, test.changed)
+		}
+		for treeID, want := range test.want {
+			if got := r.Backend(treeID); got != want {
+				t.Errorf("Backend(%d) = %q after loading %v, want %q", treeID, got, test.routes, want)
+			}
+		}
+	}
+}
+
+func TestNewRouterNoLoader(t *testing.T) {
+	r, err := NewRouter(nil)
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	if got := r.Backend(5); got != DefaultBackend {
+		t.Fatalf("Backend(5) = %q, want default", got)
+	}
+}
+
+func TestParseBackends(t *testing.T) {
+	for _, test := range []struct {
+		flag    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{flag: "", want: map[string]string{}},
+		{flag: "east=user:pw@tcp(east)/db", want: map[string]string{"east": "user:pw@tcp(east)/db"}},
+		{flag: "east=a/db?parseTime=true, west=b/db", want: map[string]string{"east": "a/db?parseTime=true", "west": "b/db"}},
+		{flag: "east", wantErr: true},
+		{flag: "=a/db", wantErr: true},
+		{flag: "east=a/db,east=b/db", wantErr: true},
+	} {
+		got, err := ParseBackends(test.flag)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("ParseBackends(%q) returned error %v, want error %v", test.flag, err, test.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseBackends(%q) = %v, want %v", test.flag, got, test.want)
+		}
+	}
+}
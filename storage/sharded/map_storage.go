@@ -0,0 +1,856 @@
+// Package sharded provides map storage which spreads the leaves and nodes of a
+// single map across several storage backends.
+package sharded
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/monitoring/trace"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util"
+)
+
+// MaxShards is the largest number of shards a map can be split into. Each shard
+// owns the subtrees below one node in the top stratum of the tree, which is 8
+// levels deep.
+const MaxShards = 256
+
+// topStratumDepth is the number of levels of the tree held by the top store.
+// Nodes below it belong to the shard for their key hash range. This must match
+// the depth of the first stratum used by the underlying storage so that no
+// subtree is split between stores.
+const topStratumDepth = 8
+
+// ErrArchiveNotSupported is returned by the MapArchiver methods of a sharded
+// map transaction. Archived segments are per store, and nothing records which
+// shard a segment belongs to.
+var ErrArchiveNotSupported = errors.New("archival is not supported for sharded maps")
+
+// MapStorage is a storage.MapStorage which splits the key hash space of a map
+// into equal, contiguous ranges and stores the leaves and subtrees for each
+// range in its own shard. A separate top store holds the top stratum of the
+// tree, which combines the shard subtree roots into the map root, along with
+// the published roots, tags, reverts and retention policy.
+//
+// Every store has a copy of each map root, and each transaction writes the same
+// revision to all of them. Shards are committed before the top store, so the
+// top store never publishes a revision that any shard is missing. If a commit
+// fails part way through, shards can be left ahead of the top store. They're
+// brought back into step with RepairShards, which the next call to Begin does
+// before starting its transaction.
+//
+// The top store and shards must be separate storage for the same map ID, and
+// the underlying storage must keep the top 8 levels of the tree in a single
+// stratum, as the MySQL storage's default strata do. A map created with its own
+// strata must start with one of 8 levels to be sharded, see CheckStrata.
+type MapStorage struct {
+	top    storage.MapStorage
+	shards []storage.MapStorage
+	// bits is the number of leading key hash bits used to pick a shard.
+	bits       uint
+	timeSource util.TimeSource
+
+	// Must hold this lock before accessing needsRepair
+	mu sync.Mutex
+	// needsRepair is set when a commit failed after some shards had committed,
+	// which may have left them ahead of the top store
+	needsRepair bool
+}
+
+// NewMapStorage creates a MapStorage over top and shards. The number of shards
+// must be a power of two no larger than MaxShards, and they must all use the
+// same hash prefixes and algorithm as top. Keys are assigned to shards in order, so shards[0]
+// holds the lowest key hashes.
+func NewMapStorage(top storage.MapStorage, shards []storage.MapStorage) (*MapStorage, error) {
+	n := len(shards)
+	if n == 0 || n > MaxShards || n&(n-1) != 0 {
+		return nil, fmt.Errorf("shard count must be a power of two between 1 and %d, got %d", MaxShards, n)
+	}
+
+	prefixes := top.HashPrefixes()
+	for i, s := range shards {
+		if s.MapID().TreeID != top.MapID().TreeID {
+			return nil, fmt.Errorf("shard %d is for map %d, not %d", i, s.MapID().TreeID, top.MapID().TreeID)
+		}
+		p := s.HashPrefixes()
+		if !bytes.Equal(p.Leaf, prefixes.Leaf) || !bytes.Equal(p.Node, prefixes.Node) {
+			return nil, fmt.Errorf("shard %d has different hash prefixes to the top store", i)
+		}
+		if s.HashAlgorithm() != top.HashAlgorithm() {
+			return nil, fmt.Errorf("shard %d has a different hash algorithm to the top store", i)
+		}
+		if s.HashStrategy() != top.HashStrategy() {
+			return nil, fmt.Errorf("shard %d has a different hash strategy to the top store", i)
+		}
+	}
+
+	for i, ms := range append([]storage.MapStorage{top}, shards...) {
+		r, ok := ms.(storage.MapStrataReader)
+		if !ok {
+			continue
+		}
+		if err := CheckStrata(r.StrataDepths()); err != nil {
+			if i == 0 {
+				return nil, fmt.Errorf("top store: %v", err)
+			}
+			return nil, fmt.Errorf("shard %d: %v", i-1, err)
+		}
+	}
+
+	var bits uint
+	for 1<<bits < n {
+		bits++
+	}
+	return &MapStorage{top: top, shards: shards, bits: bits, timeSource: util.SystemTimeSource{}}, nil
+}
+
+// CheckStrata returns an error unless a map stored in strata can be sharded,
+// which needs the top stratum to be the top store's 8 levels.
+func CheckStrata(strata []int) error {
+	if len(strata) == 0 || strata[0] != topStratumDepth {
+		return fmt.Errorf("sharded maps need a top stratum of %d levels, the strata are %v", topStratumDepth, strata)
+	}
+	return nil
+}
+
+// MapID implements storage.MapStorage.
+func (s *MapStorage) MapID() trillian.MapID {
+	return s.top.MapID()
+}
+
+// HashPrefixes implements storage.MapStorage.
+func (s *MapStorage) HashPrefixes() storage.TreeHashPrefixes {
+	return s.top.HashPrefixes()
+}
+
+// HashAlgorithm implements storage.MapStorage.
+func (s *MapStorage) HashAlgorithm() trillian.HashAlgorithm {
+	return s.top.HashAlgorithm()
+}
+
+// HashStrategy implements storage.MapStorage.
+func (s *MapStorage) HashStrategy() trillian.HashStrategy {
+	return s.top.HashStrategy()
+}
+
+// Close closes the top store and every shard that can be closed, returning the
+// first error.
+func (s *MapStorage) Close() error {
+	var firstErr error
+	for _, ms := range append([]storage.MapStorage{s.top}, s.shards...) {
+		if c, ok := ms.(io.Closer); ok {
+			if err := c.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// Begin implements storage.MapStorage. Transactions on the shards are only
+// started when the transaction first touches them. If an earlier commit
+// failed part way through, the shards are repaired first.
+func (s *MapStorage) Begin() (storage.MapTX, error) {
+	if err := s.repairIfNeeded(); err != nil {
+		return nil, err
+	}
+	tx, err := s.top.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &mapTX{MapTX: tx, ms: s, shards: make([]storage.MapTX, len(s.shards))}, nil
+}
+
+// Snapshot implements storage.MapStorage. As with Begin, snapshots of the
+// shards are only taken when needed.
+func (s *MapStorage) Snapshot() (storage.ReadOnlyMapTX, error) {
+	tx, err := s.top.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyMapTX{ReadOnlyMapTX: tx, ms: s, shards: make([]storage.ReadOnlyMapTX, len(s.shards))}, nil
+}
+
+// SnapshotAtLeast implements storage.MapRevisionSnapshotter, passing revision
+// on to the top store if it's a MapRevisionSnapshotter.
+func (s *MapStorage) SnapshotAtLeast(revision int64) (storage.ReadOnlyMapTX, error) {
+	top, ok := s.top.(storage.MapRevisionSnapshotter)
+	if !ok {
+		return s.Snapshot()
+	}
+	tx, err := top.SnapshotAtLeast(revision)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyMapTX{ReadOnlyMapTX: tx, ms: s, shards: make([]storage.ReadOnlyMapTX, len(s.shards))}, nil
+}
+
+// RepairShards brings any shard which is ahead of the top store, because a
+// transaction failed while committing, back to the top store's latest revision.
+// A revision staged on a shard but not on the top store is abandoned, and later
+// published revisions are reverted. As reverted revisions aren't written again,
+// the other stores then skip them too. It returns the number of shards
+// repaired.
+func (s *MapStorage) RepairShards(timestampNanos int64) (int, error) {
+	tx, err := s.top.Snapshot()
+	if err != nil {
+		return 0, err
+	}
+	root, err := tx.LatestSignedMapRoot()
+	if err != nil {
+		tx.Commit()
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	repaired := 0
+	for i, shard := range s.shards {
+		changed, err := repairShard(shard, root.MapRevision, timestampNanos)
+		if err != nil {
+			return repaired, fmt.Errorf("failed to repair shard %d: %v", i, err)
+		}
+		if changed {
+			glog.Warningf("%d: repaired shard %d to revision %d", s.MapID().TreeID, i, root.MapRevision)
+			repaired++
+		}
+	}
+	if repaired > 0 {
+		if err := s.alignRevisions(timestampNanos); err != nil {
+			return repaired, err
+		}
+	}
+	return repaired, nil
+}
+
+// repairIfNeeded repairs the shards if a commit has failed since they were
+// last known to be in step with the top store. The repair reads the latest
+// revision from storage, so it's safe whether or not the top store's commit
+// took effect.
+func (s *MapStorage) repairIfNeeded() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.needsRepair {
+		return nil
+	}
+	if _, err := s.RepairShards(s.timeSource.Now().UnixNano()); err != nil {
+		return fmt.Errorf("shards of map %d need repair after a failed commit: %v", s.MapID().TreeID, err)
+	}
+	s.needsRepair = false
+	return nil
+}
+
+// setNeedsRepair records that the shards must be repaired before the map is
+// written to again.
+func (s *MapStorage) setNeedsRepair() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.needsRepair = true
+}
+
+// alignRevisions makes every store of the map write the same next revision,
+// by skipping the stores which are behind to the furthest one.
+func (s *MapStorage) alignRevisions(timestampNanos int64) error {
+	stores := append([]storage.MapStorage{s.top}, s.shards...)
+	revisions := make([]int64, len(stores))
+	var next int64
+	for i, ms := range stores {
+		tx, err := ms.Begin()
+		if err != nil {
+			return err
+		}
+		revisions[i] = tx.WriteRevision()
+		tx.Rollback()
+		if revisions[i] > next {
+			next = revisions[i]
+		}
+	}
+
+	for i, ms := range stores {
+		if revisions[i] == next {
+			continue
+		}
+		if err := skipRevisions(ms, next-1, timestampNanos); err != nil {
+			return fmt.Errorf("failed to skip store %d to revision %d: %v", i, next-1, err)
+		}
+	}
+	return nil
+}
+
+// skipRevisions makes the next revision written to ms follow revision.
+func skipRevisions(ms storage.MapStorage, revision, timestampNanos int64) error {
+	tx, err := ms.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := tx.SkipMapRevisions(revision, "repair of sharded map after failed commit", timestampNanos); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// repairShard makes revision the latest revision of shard, returning whether
+// anything had to be changed.
+func repairShard(shard storage.MapStorage, revision, timestampNanos int64) (bool, error) {
+	tx, err := shard.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// The top store commits last, so if it had a staged revision every shard
+	// would have it too and there would be nothing to repair. Any staged
+	// revision found here was left by a failed commit.
+	_, staged, err := tx.StagedSignedMapRoot()
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	if staged {
+		if err := tx.AbandonStagedMapRoot(); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	root, err := tx.LatestSignedMapRoot()
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case root.MapRevision < revision:
+		return false, fmt.Errorf("shard is at revision %d, behind the top store at %d", root.MapRevision, revision)
+	case root.MapRevision > revision:
+		if _, err := tx.RevertMapHead(revision, "repair of sharded map after failed commit", timestampNanos); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	if !changed {
+		return false, nil
+	}
+	return true, tx.Commit()
+}
+
+// keyShard returns the shard which owns the key hash, or node path, h.
+func (s *MapStorage) keyShard(h []byte) int {
+	if s.bits == 0 {
+		return 0
+	}
+	return int(h[0] >> (8 - s.bits))
+}
+
+// nodeShard returns the shard which owns id, or -1 if it is held by the top store.
+func (s *MapStorage) nodeShard(id storage.NodeID) int {
+	if id.PrefixLenBits <= topStratumDepth {
+		return -1
+	}
+	return s.keyShard(id.Path)
+}
+
+// shardReader returns the transaction to use to read from a shard.
+type shardReader func(i int) (storage.ReadOnlyMapTX, error)
+
+// get reads keyHashes from the shards which own them.
+func (s *MapStorage) get(top storage.ReadOnlyMapTX, shard shardReader, revision int64, keyHashes []trillian.Hash) ([]trillian.MapLeaf, error) {
+	if revision < 0 {
+		// Shards may be ahead of the top store, so their latest revision
+		// can't be used
+		root, err := top.LatestSignedMapRoot()
+		if err != nil {
+			return nil, err
+		}
+		revision = root.MapRevision
+	}
+
+	byShard := make(map[int][]trillian.Hash)
+	for _, kh := range keyHashes {
+		i := s.keyShard(kh)
+		byShard[i] = append(byShard[i], kh)
+	}
+
+	var leaves []trillian.MapLeaf
+	for i := range s.shards {
+		if len(byShard[i]) == 0 {
+			continue
+		}
+		tx, err := shard(i)
+		if err != nil {
+			return nil, err
+		}
+		l, err := tx.Get(revision, byShard[i])
+		if err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, l...)
+	}
+	return leaves, nil
+}
+
+// getChangedLeaves reads the leaves set at revision from every shard. Each key
+// is owned by a single shard, so merging the shards' leaves by key hash gives
+// the leaves in the same order as a single store would.
+func (s *MapStorage) getChangedLeaves(shard shardReader, revision int64) ([]trillian.MapLeaf, error) {
+	var leaves []trillian.MapLeaf
+	for i := range s.shards {
+		tx, err := shard(i)
+		if err != nil {
+			return nil, err
+		}
+		l, err := tx.GetChangedLeaves(revision)
+		if err != nil {
+			return nil, fmt.Errorf("shard %d: %v", i, err)
+		}
+		leaves = append(leaves, l...)
+	}
+	sort.Sort(byKeyHash(leaves))
+	return leaves, nil
+}
+
+// listLeaves lists the leaves at revision from the shards in key hash order.
+// Each shard owns a contiguous range of key hashes, so the shards are read in
+// turn from the one owning afterKeyHash until count leaves have been found.
+func (s *MapStorage) listLeaves(shard shardReader, revision int64, afterKeyHash trillian.Hash, count int) ([]trillian.MapLeaf, error) {
+	first := 0
+	if len(afterKeyHash) > 0 {
+		first = s.keyShard(afterKeyHash)
+	}
+	var leaves []trillian.MapLeaf
+	for i := first; i < len(s.shards) && len(leaves) < count; i++ {
+		tx, err := shard(i)
+		if err != nil {
+			return nil, err
+		}
+		l, err := tx.ListLeaves(revision, afterKeyHash, count-len(leaves))
+		if err != nil {
+			return nil, fmt.Errorf("shard %d: %v", i, err)
+		}
+		leaves = append(leaves, l...)
+	}
+	return leaves, nil
+}
+
+// byKeyHash sorts leaves by key hash.
+type byKeyHash []trillian.MapLeaf
+
+func (l byKeyHash) Len() int           { return len(l) }
+func (l byKeyHash) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l byKeyHash) Less(i, j int) bool { return bytes.Compare(l[i].KeyHash, l[j].KeyHash) < 0 }
+
+// getMerkleNodes reads ids from the stores which own them. The nodes are not
+// returned in the order requested.
+func (s *MapStorage) getMerkleNodes(top storage.ReadOnlyMapTX, shard shardReader, revision int64, ids []storage.NodeID) ([]storage.Node, error) {
+	var topIDs []storage.NodeID
+	byShard := make(map[int][]storage.NodeID)
+	for _, id := range ids {
+		if i := s.nodeShard(id); i >= 0 {
+			byShard[i] = append(byShard[i], id)
+		} else {
+			topIDs = append(topIDs, id)
+		}
+	}
+
+	var nodes []storage.Node
+	if len(topIDs) > 0 {
+		n, err := top.GetMerkleNodes(revision, topIDs)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n...)
+	}
+	for i := range s.shards {
+		if len(byShard[i]) == 0 {
+			continue
+		}
+		tx, err := shard(i)
+		if err != nil {
+			return nil, err
+		}
+		n, err := tx.GetMerkleNodes(revision, byShard[i])
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n...)
+	}
+	return nodes, nil
+}
+
+// mapTX is a read-write transaction over a sharded map. The embedded MapTX is
+// the transaction on the top store, which answers everything not overridden.
+type mapTX struct {
+	storage.MapTX
+	ms *MapStorage
+	// shards holds the transactions started on each shard so far, nil for the
+	// shards that haven't been touched
+	shards []storage.MapTX
+}
+
+// SetSpan implements trace.SpanSetter, passing the span on to the
+// transaction on the top store.
+func (t *mapTX) SetSpan(s *trace.Span) {
+	trace.SetSpan(t.MapTX, s)
+}
+
+// shard returns the transaction for shard i, starting it if needed.
+func (t *mapTX) shard(i int) (storage.MapTX, error) {
+	if t.shards[i] != nil {
+		return t.shards[i], nil
+	}
+	tx, err := t.ms.shards[i].Begin()
+	if err != nil {
+		return nil, err
+	}
+	if got, want := tx.WriteRevision(), t.MapTX.WriteRevision(); got != want {
+		tx.Rollback()
+		return nil, fmt.Errorf("shard %d would write revision %d, not %d, and must be repaired", i, got, want)
+	}
+	t.shards[i] = tx
+	return tx, nil
+}
+
+// readShard adapts shard for use as a shardReader.
+func (t *mapTX) readShard(i int) (storage.ReadOnlyMapTX, error) {
+	return t.shard(i)
+}
+
+// forAllShards calls f with the transaction for every shard, stopping at the
+// first error.
+func (t *mapTX) forAllShards(f func(storage.MapTX) error) error {
+	for i := range t.shards {
+		tx, err := t.shard(i)
+		if err != nil {
+			return err
+		}
+		if err := f(tx); err != nil {
+			return fmt.Errorf("shard %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Get implements storage.Getter.
+func (t *mapTX) Get(revision int64, keyHashes []trillian.Hash) ([]trillian.MapLeaf, error) {
+	return t.ms.get(t.MapTX, t.readShard, revision, keyHashes)
+}
+
+// GetChangedLeaves implements storage.ChangedLeafReader.
+func (t *mapTX) GetChangedLeaves(revision int64) ([]trillian.MapLeaf, error) {
+	return t.ms.getChangedLeaves(t.readShard, revision)
+}
+
+// ListLeaves implements storage.MapLeafLister.
+func (t *mapTX) ListLeaves(revision int64, afterKeyHash trillian.Hash, count int) ([]trillian.MapLeaf, error) {
+	return t.ms.listLeaves(t.readShard, revision, afterKeyHash, count)
+}
+
+// Set implements storage.Setter.
+func (t *mapTX) Set(keyHash trillian.Hash, value trillian.MapLeaf) error {
+	tx, err := t.shard(t.ms.keyShard(keyHash))
+	if err != nil {
+		return err
+	}
+	return tx.Set(keyHash, value)
+}
+
+// SetLeaves implements storage.Setter. Each shard's leaves are set in one call.
+func (t *mapTX) SetLeaves(leaves []trillian.MapLeaf) error {
+	byShard := make(map[int][]trillian.MapLeaf)
+	for _, leaf := range leaves {
+		i := t.ms.keyShard(leaf.KeyHash)
+		byShard[i] = append(byShard[i], leaf)
+	}
+	for i, shardLeaves := range byShard {
+		tx, err := t.shard(i)
+		if err != nil {
+			return err
+		}
+		if err := tx.SetLeaves(shardLeaves); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMerkleNodes implements storage.NodeReader.
+func (t *mapTX) GetMerkleNodes(revision int64, ids []storage.NodeID) ([]storage.Node, error) {
+	return t.ms.getMerkleNodes(t.MapTX, t.readShard, revision, ids)
+}
+
+// SetMerkleNodes implements storage.NodeReaderWriter.
+func (t *mapTX) SetMerkleNodes(nodes []storage.Node) error {
+	var topNodes []storage.Node
+	byShard := make(map[int][]storage.Node)
+	for _, n := range nodes {
+		if i := t.ms.nodeShard(n.NodeID); i >= 0 {
+			byShard[i] = append(byShard[i], n)
+		} else {
+			topNodes = append(topNodes, n)
+		}
+	}
+
+	if len(topNodes) > 0 {
+		if err := t.MapTX.SetMerkleNodes(topNodes); err != nil {
+			return err
+		}
+	}
+	for i := range t.shards {
+		if len(byShard[i]) == 0 {
+			continue
+		}
+		tx, err := t.shard(i)
+		if err != nil {
+			return err
+		}
+		if err := tx.SetMerkleNodes(byShard[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StoreSignedMapRoot implements storage.MapRootWriter.
+func (t *mapTX) StoreSignedMapRoot(root trillian.SignedMapRoot) error {
+	if err := t.forAllShards(func(tx storage.MapTX) error { return tx.StoreSignedMapRoot(root) }); err != nil {
+		return err
+	}
+	return t.MapTX.StoreSignedMapRoot(root)
+}
+
+// RefreshSignedMapRoot implements storage.MapRootWriter.
+func (t *mapTX) RefreshSignedMapRoot(root trillian.SignedMapRoot) error {
+	if err := t.forAllShards(func(tx storage.MapTX) error { return tx.RefreshSignedMapRoot(root) }); err != nil {
+		return err
+	}
+	return t.MapTX.RefreshSignedMapRoot(root)
+}
+
+// StageSignedMapRoot implements storage.MapStager.
+func (t *mapTX) StageSignedMapRoot(root trillian.SignedMapRoot) error {
+	if err := t.forAllShards(func(tx storage.MapTX) error { return tx.StageSignedMapRoot(root) }); err != nil {
+		return err
+	}
+	return t.MapTX.StageSignedMapRoot(root)
+}
+
+// PublishStagedMapRoot implements storage.MapStager.
+func (t *mapTX) PublishStagedMapRoot(root trillian.SignedMapRoot) error {
+	if err := t.forAllShards(func(tx storage.MapTX) error { return tx.PublishStagedMapRoot(root) }); err != nil {
+		return err
+	}
+	return t.MapTX.PublishStagedMapRoot(root)
+}
+
+// AbandonStagedMapRoot implements storage.MapStager.
+func (t *mapTX) AbandonStagedMapRoot() error {
+	if err := t.forAllShards(func(tx storage.MapTX) error { return tx.AbandonStagedMapRoot() }); err != nil {
+		return err
+	}
+	return t.MapTX.AbandonStagedMapRoot()
+}
+
+// RevertMapHead implements storage.MapHeadReverter. The revert recorded by the
+// top store is returned.
+func (t *mapTX) RevertMapHead(revision int64, reason string, timestampNanos int64) (storage.MapHeadRevert, error) {
+	err := t.forAllShards(func(tx storage.MapTX) error {
+		_, err := tx.RevertMapHead(revision, reason, timestampNanos)
+		return err
+	})
+	if err != nil {
+		return storage.MapHeadRevert{}, err
+	}
+	return t.MapTX.RevertMapHead(revision, reason, timestampNanos)
+}
+
+// SkipMapRevisions implements storage.MapHeadReverter.
+func (t *mapTX) SkipMapRevisions(revision int64, reason string, timestampNanos int64) error {
+	err := t.forAllShards(func(tx storage.MapTX) error {
+		return tx.SkipMapRevisions(revision, reason, timestampNanos)
+	})
+	if err != nil {
+		return err
+	}
+	return t.MapTX.SkipMapRevisions(revision, reason, timestampNanos)
+}
+
+// PruneRevisionsBefore implements storage.MapRetention.
+func (t *mapTX) PruneRevisionsBefore(revision int64) error {
+	if err := t.forAllShards(func(tx storage.MapTX) error { return tx.PruneRevisionsBefore(revision) }); err != nil {
+		return err
+	}
+	return t.MapTX.PruneRevisionsBefore(revision)
+}
+
+// DeleteMapLeavesBelowRevision implements storage.MapRetention. The shards
+// hold the leaves and the lower subtrees, and the top store the others.
+func (t *mapTX) DeleteMapLeavesBelowRevision(revision int64) (int64, error) {
+	var deleted int64
+	err := t.forAllShards(func(tx storage.MapTX) error {
+		n, err := tx.DeleteMapLeavesBelowRevision(revision)
+		deleted += n
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	n, err := t.MapTX.DeleteMapLeavesBelowRevision(revision)
+	if err != nil {
+		return 0, err
+	}
+	return deleted + n, nil
+}
+
+// GetArchivableRevision implements storage.MapArchiver.
+func (t *mapTX) GetArchivableRevision(revision int64) (*storage.ArchiveSegment, error) {
+	return nil, ErrArchiveNotSupported
+}
+
+// ArchiveRevision implements storage.MapArchiver.
+func (t *mapTX) ArchiveRevision(revision int64, segment string) error {
+	return ErrArchiveNotSupported
+}
+
+// GetArchivedRevisions implements storage.MapArchiver.
+func (t *mapTX) GetArchivedRevisions() (map[int64]string, error) {
+	return nil, ErrArchiveNotSupported
+}
+
+// RestoreArchivedRevision implements storage.MapArchiver.
+func (t *mapTX) RestoreArchivedRevision(segment *storage.ArchiveSegment) error {
+	return ErrArchiveNotSupported
+}
+
+// SetRevisionRestored implements storage.MapArchiver.
+func (t *mapTX) SetRevisionRestored(revision int64, expiresNanos int64) error {
+	return ErrArchiveNotSupported
+}
+
+// GetRestoredRevisions implements storage.MapArchiver.
+func (t *mapTX) GetRestoredRevisions() (map[int64]int64, error) {
+	return nil, ErrArchiveNotSupported
+}
+
+// ClearRevisionRestored implements storage.MapArchiver.
+func (t *mapTX) ClearRevisionRestored(revision int64) error {
+	return ErrArchiveNotSupported
+}
+
+// Commit implements storage.TreeTX. The shards are committed before the top
+// store, see MapStorage. If the commit fails after any shard has committed, the
+// shards are repaired before the next transaction starts.
+func (t *mapTX) Commit() error {
+	committed := false
+	for i, tx := range t.shards {
+		if tx == nil {
+			continue
+		}
+		if err := tx.Commit(); err != nil {
+			t.rollbackShards()
+			t.MapTX.Rollback()
+			if committed {
+				t.ms.setNeedsRepair()
+			}
+			return fmt.Errorf("failed to commit shard %d: %v", i, err)
+		}
+		committed = true
+	}
+	if err := t.MapTX.Commit(); err != nil {
+		if committed {
+			glog.Warningf("%d: top store failed to commit after its shards did, they'll be repaired: %v", t.ms.MapID().TreeID, err)
+			t.ms.setNeedsRepair()
+		}
+		return err
+	}
+	return nil
+}
+
+// Rollback implements storage.TreeTX.
+func (t *mapTX) Rollback() error {
+	t.rollbackShards()
+	return t.MapTX.Rollback()
+}
+
+// rollbackShards rolls back the shard transactions which are still open.
+func (t *mapTX) rollbackShards() {
+	for i, tx := range t.shards {
+		if tx == nil || !tx.IsOpen() {
+			continue
+		}
+		if err := tx.Rollback(); err != nil {
+			glog.Warningf("%d: failed to roll back shard %d: %v", t.ms.MapID().TreeID, i, err)
+		}
+	}
+}
+
+// readOnlyMapTX is a snapshot of a sharded map. The embedded ReadOnlyMapTX is
+// the snapshot of the top store.
+type readOnlyMapTX struct {
+	storage.ReadOnlyMapTX
+	ms     *MapStorage
+	shards []storage.ReadOnlyMapTX
+}
+
+// SetSpan implements trace.SpanSetter, passing the span on to the snapshot
+// of the top store.
+func (t *readOnlyMapTX) SetSpan(s *trace.Span) {
+	trace.SetSpan(t.ReadOnlyMapTX, s)
+}
+
+// shard returns the snapshot for shard i, taking it if needed.
+func (t *readOnlyMapTX) shard(i int) (storage.ReadOnlyMapTX, error) {
+	if t.shards[i] == nil {
+		tx, err := t.ms.shards[i].Snapshot()
+		if err != nil {
+			return nil, err
+		}
+		t.shards[i] = tx
+	}
+	return t.shards[i], nil
+}
+
+// Get implements storage.Getter.
+func (t *readOnlyMapTX) Get(revision int64, keyHashes []trillian.Hash) ([]trillian.MapLeaf, error) {
+	return t.ms.get(t.ReadOnlyMapTX, t.shard, revision, keyHashes)
+}
+
+// GetChangedLeaves implements storage.ChangedLeafReader.
+func (t *readOnlyMapTX) GetChangedLeaves(revision int64) ([]trillian.MapLeaf, error) {
+	return t.ms.getChangedLeaves(t.shard, revision)
+}
+
+// ListLeaves implements storage.MapLeafLister.
+func (t *readOnlyMapTX) ListLeaves(revision int64, afterKeyHash trillian.Hash, count int) ([]trillian.MapLeaf, error) {
+	return t.ms.listLeaves(t.shard, revision, afterKeyHash, count)
+}
+
+// GetMerkleNodes implements storage.NodeReader.
+func (t *readOnlyMapTX) GetMerkleNodes(revision int64, ids []storage.NodeID) ([]storage.Node, error) {
+	return t.ms.getMerkleNodes(t.ReadOnlyMapTX, t.shard, revision, ids)
+}
+
+// Commit implements storage.ReadOnlyTreeTX. Every snapshot is committed, and
+// the first error seen is returned.
+func (t *readOnlyMapTX) Commit() error {
+	var firstErr error
+	for i, tx := range t.shards {
+		if tx == nil {
+			continue
+		}
+		if err := tx.Commit(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to commit shard %d: %v", i, err)
+		}
+	}
+	if err := t.ReadOnlyMapTX.Commit(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
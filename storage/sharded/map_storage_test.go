@@ -0,0 +1,578 @@
+package sharded
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util"
+)
+
+const testTreeID = int64(12)
+
+var testMapID = trillian.MapID{MapID: []byte("sharded"), TreeID: testTreeID}
+
+func newMockMapStorage(ctrl *gomock.Controller) *storage.MockMapStorage {
+	s := storage.NewMockMapStorage(ctrl)
+	s.EXPECT().MapID().AnyTimes().Return(testMapID)
+	s.EXPECT().HashPrefixes().AnyTimes().Return(storage.TreeHashPrefixes{})
+	s.EXPECT().HashStrategy().AnyTimes().Return(trillian.HashStrategy_RFC6962)
+	s.EXPECT().HashAlgorithm().AnyTimes().Return(trillian.HashAlgorithm_SHA256)
+	return s
+}
+
+// newTestMapStorage returns a sharded map over mocks for the top store and n
+// shards.
+func newTestMapStorage(t *testing.T, ctrl *gomock.Controller, n int) (*MapStorage, *storage.MockMapStorage, []*storage.MockMapStorage) {
+	top := newMockMapStorage(ctrl)
+	mocks := make([]*storage.MockMapStorage, n)
+	shards := make([]storage.MapStorage, n)
+	for i := range shards {
+		mocks[i] = newMockMapStorage(ctrl)
+		shards[i] = mocks[i]
+	}
+	s, err := NewMapStorage(top, shards)
+	if err != nil {
+		t.Fatalf("NewMapStorage failed: %v", err)
+	}
+	return s, top, mocks
+}
+
+// expectBegin expects a transaction to be started on s, writing revision.
+func expectBegin(ctrl *gomock.Controller, s *storage.MockMapStorage, revision int64) *storage.MockMapTX {
+	tx := storage.NewMockMapTX(ctrl)
+	s.EXPECT().Begin().Return(tx, nil)
+	tx.EXPECT().WriteRevision().AnyTimes().Return(revision)
+	return tx
+}
+
+func keyHash(first byte) trillian.Hash {
+	h := make([]byte, 32)
+	h[0] = first
+	return h
+}
+
+func TestNewMapStorageValidatesShards(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	top := newMockMapStorage(ctrl)
+	for _, n := range []int{0, 3, 6, 512} {
+		shards := make([]storage.MapStorage, n)
+		for i := range shards {
+			shards[i] = newMockMapStorage(ctrl)
+		}
+		if _, err := NewMapStorage(top, shards); err == nil {
+			t.Errorf("NewMapStorage with %d shards succeeded", n)
+		}
+	}
+
+	other := storage.NewMockMapStorage(ctrl)
+	other.EXPECT().MapID().AnyTimes().Return(testMapID)
+	other.EXPECT().HashPrefixes().AnyTimes().Return(storage.TreeHashPrefixes{Leaf: []byte{5}, Node: []byte{6}})
+	other.EXPECT().HashStrategy().AnyTimes().Return(trillian.HashStrategy_RFC6962)
+	if _, err := NewMapStorage(top, []storage.MapStorage{newMockMapStorage(ctrl), other}); err == nil {
+		t.Errorf("NewMapStorage with mismatched hash prefixes succeeded")
+	}
+
+	sha512 := storage.NewMockMapStorage(ctrl)
+	sha512.EXPECT().MapID().AnyTimes().Return(testMapID)
+	sha512.EXPECT().HashPrefixes().AnyTimes().Return(storage.TreeHashPrefixes{})
+	sha512.EXPECT().HashStrategy().AnyTimes().Return(trillian.HashStrategy_RFC6962)
+	sha512.EXPECT().HashAlgorithm().AnyTimes().Return(trillian.HashAlgorithm_SHA512)
+	if _, err := NewMapStorage(top, []storage.MapStorage{newMockMapStorage(ctrl), sha512}); err == nil {
+		t.Errorf("NewMapStorage with mismatched hash algorithms succeeded")
+	}
+
+	lie := storage.NewMockMapStorage(ctrl)
+	lie.EXPECT().MapID().AnyTimes().Return(testMapID)
+	lie.EXPECT().HashPrefixes().AnyTimes().Return(storage.TreeHashPrefixes{})
+	lie.EXPECT().HashAlgorithm().AnyTimes().Return(trillian.HashAlgorithm_SHA256)
+	lie.EXPECT().HashStrategy().AnyTimes().Return(trillian.HashStrategy_LIE_SHA512_256)
+	if _, err := NewMapStorage(top, []storage.MapStorage{newMockMapStorage(ctrl), lie}); err == nil {
+		t.Errorf("NewMapStorage with mismatched hash strategies succeeded")
+	}
+}
+
+// strataMapStorage is a map storage that says which strata it stores the map in.
+type strataMapStorage struct {
+	*storage.MockMapStorage
+	strata []int
+}
+
+func (s strataMapStorage) StrataDepths() []int {
+	return s.strata
+}
+
+func TestNewMapStorageChecksStrata(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, test := range []struct {
+		top, shard []int
+		ok         bool
+	}{
+		{top: []int{8, 8, 240}, shard: []int{8, 8, 240}, ok: true},
+		{top: []int{16, 240}, shard: []int{8, 248}},
+		{top: []int{8, 248}, shard: []int{4, 4, 248}},
+	} {
+		top := strataMapStorage{newMockMapStorage(ctrl), test.top}
+		shard := strataMapStorage{newMockMapStorage(ctrl), test.shard}
+		_, err := NewMapStorage(top, []storage.MapStorage{shard})
+		if got := err == nil; got != test.ok {
+			t.Errorf("NewMapStorage(top strata %v, shard strata %v)=_, %v, want success %v", test.top, test.shard, err, test.ok)
+		}
+	}
+}
+
+func TestCheckStrata(t *testing.T) {
+	for _, test := range []struct {
+		strata []int
+		ok     bool
+	}{
+		{strata: []int{8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 176}, ok: true},
+		{strata: []int{8, 248}, ok: true},
+		{strata: []int{16, 240}},
+		{strata: []int{4, 252}},
+		{strata: nil},
+	} {
+		if err := CheckStrata(test.strata); (err == nil) != test.ok {
+			t.Errorf("CheckStrata(%v)=%v, want success %v", test.strata, err, test.ok)
+		}
+	}
+}
+
+func TestSetRoutesByKeyHash(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, top, shards := newTestMapStorage(t, ctrl, 4)
+	topTX := expectBegin(ctrl, top, 6)
+	// Only the shards written to should be touched
+	tx1 := expectBegin(ctrl, shards[1], 6)
+	tx3 := expectBegin(ctrl, shards[3], 6)
+
+	low, high, high2 := keyHash(0x40), keyHash(0xc0), keyHash(0xff)
+	tx1.EXPECT().Set(low, gomock.Any()).Return(nil)
+	tx3.EXPECT().Set(high, gomock.Any()).Return(nil)
+	tx3.EXPECT().Set(high2, gomock.Any()).Return(nil)
+	gomock.InOrder(
+		tx1.EXPECT().Commit().Return(nil),
+		tx3.EXPECT().Commit().Return(nil),
+		topTX.EXPECT().Commit().Return(nil),
+	)
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	for _, kh := range []trillian.Hash{low, high, high2} {
+		if err := tx.Set(kh, trillian.MapLeaf{KeyHash: kh}); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+}
+
+func TestSetLeavesGroupsByShard(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, top, shards := newTestMapStorage(t, ctrl, 4)
+	topTX := expectBegin(ctrl, top, 6)
+	tx1 := expectBegin(ctrl, shards[1], 6)
+	tx3 := expectBegin(ctrl, shards[3], 6)
+
+	low, high, high2 := keyHash(0x40), keyHash(0xc0), keyHash(0xff)
+	tx1.EXPECT().SetLeaves([]trillian.MapLeaf{{KeyHash: low}}).Return(nil)
+	tx3.EXPECT().SetLeaves([]trillian.MapLeaf{{KeyHash: high}, {KeyHash: high2}}).Return(nil)
+	gomock.InOrder(
+		tx1.EXPECT().Commit().Return(nil),
+		tx3.EXPECT().Commit().Return(nil),
+		topTX.EXPECT().Commit().Return(nil),
+	)
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := tx.SetLeaves([]trillian.MapLeaf{{KeyHash: low}, {KeyHash: high}, {KeyHash: high2}}); err != nil {
+		t.Fatalf("SetLeaves failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+}
+
+func TestGetGroupsKeysByShard(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, top, shards := newTestMapStorage(t, ctrl, 2)
+	topTX := storage.NewMockReadOnlyMapTX(ctrl)
+	top.EXPECT().Snapshot().Return(topTX, nil)
+	tx0 := storage.NewMockReadOnlyMapTX(ctrl)
+	shards[0].EXPECT().Snapshot().Return(tx0, nil)
+	tx1 := storage.NewMockReadOnlyMapTX(ctrl)
+	shards[1].EXPECT().Snapshot().Return(tx1, nil)
+
+	a, b, c := keyHash(0x10), keyHash(0x90), keyHash(0x20)
+	// The latest revision comes from the top store, never the shards
+	topTX.EXPECT().LatestSignedMapRoot().Return(trillian.SignedMapRoot{MapRevision: 4}, nil)
+	tx0.EXPECT().Get(int64(4), []trillian.Hash{a, c}).Return([]trillian.MapLeaf{{KeyHash: a}}, nil)
+	tx1.EXPECT().Get(int64(4), []trillian.Hash{b}).Return([]trillian.MapLeaf{{KeyHash: b}}, nil)
+	tx0.EXPECT().Commit().Return(nil)
+	tx1.EXPECT().Commit().Return(nil)
+	topTX.EXPECT().Commit().Return(nil)
+
+	tx, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	leaves, err := tx.Get(-1, []trillian.Hash{a, b, c})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if want := []trillian.MapLeaf{{KeyHash: a}, {KeyHash: b}}; !reflect.DeepEqual(leaves, want) {
+		t.Fatalf("Get returned %v, want %v", leaves, want)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+}
+
+func TestGetChangedLeavesReadsAllShards(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, top, shards := newTestMapStorage(t, ctrl, 2)
+	topTX := storage.NewMockReadOnlyMapTX(ctrl)
+	top.EXPECT().Snapshot().Return(topTX, nil)
+	tx0 := storage.NewMockReadOnlyMapTX(ctrl)
+	shards[0].EXPECT().Snapshot().Return(tx0, nil)
+	tx1 := storage.NewMockReadOnlyMapTX(ctrl)
+	shards[1].EXPECT().Snapshot().Return(tx1, nil)
+
+	a, b, c := keyHash(0x10), keyHash(0x20), keyHash(0x90)
+	tx0.EXPECT().GetChangedLeaves(int64(3)).Return([]trillian.MapLeaf{{KeyHash: a}, {KeyHash: b}}, nil)
+	tx1.EXPECT().GetChangedLeaves(int64(3)).Return([]trillian.MapLeaf{{KeyHash: c}}, nil)
+	tx0.EXPECT().Commit().Return(nil)
+	tx1.EXPECT().Commit().Return(nil)
+	topTX.EXPECT().Commit().Return(nil)
+
+	tx, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	leaves, err := tx.GetChangedLeaves(3)
+	if err != nil {
+		t.Fatalf("GetChangedLeaves failed: %v", err)
+	}
+	if want := []trillian.MapLeaf{{KeyHash: a}, {KeyHash: b}, {KeyHash: c}}; !reflect.DeepEqual(leaves, want) {
+		t.Fatalf("GetChangedLeaves returned %v, want %v", leaves, want)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+}
+
+func TestListLeavesReadsShardsInOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, top, shards := newTestMapStorage(t, ctrl, 4)
+	topTX := storage.NewMockReadOnlyMapTX(ctrl)
+	top.EXPECT().Snapshot().Return(topTX, nil)
+	// The listing starts in shard 1, which owns the key hash it follows, and
+	// ends in shard 2 once enough leaves have been found
+	tx1 := storage.NewMockReadOnlyMapTX(ctrl)
+	shards[1].EXPECT().Snapshot().Return(tx1, nil)
+	tx2 := storage.NewMockReadOnlyMapTX(ctrl)
+	shards[2].EXPECT().Snapshot().Return(tx2, nil)
+
+	after, a, b, c := keyHash(0x50), keyHash(0x60), keyHash(0x80), keyHash(0x90)
+	tx1.EXPECT().ListLeaves(int64(3), after, 3).Return([]trillian.MapLeaf{{KeyHash: a}}, nil)
+	tx2.EXPECT().ListLeaves(int64(3), after, 2).Return([]trillian.MapLeaf{{KeyHash: b}, {KeyHash: c}}, nil)
+	tx1.EXPECT().Commit().Return(nil)
+	tx2.EXPECT().Commit().Return(nil)
+	topTX.EXPECT().Commit().Return(nil)
+
+	tx, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	leaves, err := tx.ListLeaves(3, after, 3)
+	if err != nil {
+		t.Fatalf("ListLeaves failed: %v", err)
+	}
+	if want := []trillian.MapLeaf{{KeyHash: a}, {KeyHash: b}, {KeyHash: c}}; !reflect.DeepEqual(leaves, want) {
+		t.Fatalf("ListLeaves returned %v, want %v", leaves, want)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+}
+
+func TestMerkleNodesRouting(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, top, shards := newTestMapStorage(t, ctrl, 4)
+	topTX := expectBegin(ctrl, top, 3)
+	tx2 := expectBegin(ctrl, shards[2], 3)
+
+	rootNode := storage.Node{NodeID: storage.NewEmptyNodeID(256), Hash: []byte("root")}
+	// The deepest node of the top stratum belongs to the top store
+	topNode := storage.Node{NodeID: storage.NodeID{Path: keyHash(0x80), PrefixLenBits: 8, PathLenBits: 256}, Hash: []byte("top")}
+	shardNode := storage.Node{NodeID: storage.NodeID{Path: keyHash(0x80), PrefixLenBits: 9, PathLenBits: 256}, Hash: []byte("shard")}
+	leafNode := storage.Node{NodeID: storage.NewNodeIDFromHash(keyHash(0xa0)), Hash: []byte("leaf")}
+
+	topTX.EXPECT().SetMerkleNodes([]storage.Node{rootNode, topNode}).Return(nil)
+	tx2.EXPECT().SetMerkleNodes([]storage.Node{shardNode, leafNode}).Return(nil)
+	topTX.EXPECT().GetMerkleNodes(int64(2), []storage.NodeID{rootNode.NodeID}).Return([]storage.Node{rootNode}, nil)
+	tx2.EXPECT().GetMerkleNodes(int64(2), []storage.NodeID{leafNode.NodeID}).Return(nil, nil)
+	tx2.EXPECT().Commit().Return(nil)
+	topTX.EXPECT().Commit().Return(nil)
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := tx.SetMerkleNodes([]storage.Node{rootNode, shardNode, topNode, leafNode}); err != nil {
+		t.Fatalf("SetMerkleNodes failed: %v", err)
+	}
+	nodes, err := tx.GetMerkleNodes(2, []storage.NodeID{leafNode.NodeID, rootNode.NodeID})
+	if err != nil {
+		t.Fatalf("GetMerkleNodes failed: %v", err)
+	}
+	if want := []storage.Node{rootNode}; !reflect.DeepEqual(nodes, want) {
+		t.Fatalf("GetMerkleNodes returned %v, want %v", nodes, want)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+}
+
+func TestStoreSignedMapRootWritesAllStores(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, top, shards := newTestMapStorage(t, ctrl, 2)
+	root := trillian.SignedMapRoot{MapRevision: 8, RootHash: []byte("root")}
+	topTX := expectBegin(ctrl, top, 8)
+	for _, shard := range shards {
+		tx := expectBegin(ctrl, shard, 8)
+		tx.EXPECT().StoreSignedMapRoot(root).Return(nil)
+		tx.EXPECT().Commit().Return(nil)
+	}
+	topTX.EXPECT().StoreSignedMapRoot(root).Return(nil)
+	topTX.EXPECT().Commit().Return(nil)
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := tx.StoreSignedMapRoot(root); err != nil {
+		t.Fatalf("StoreSignedMapRoot failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+}
+
+func TestShardOutOfStep(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, top, shards := newTestMapStorage(t, ctrl, 2)
+	topTX := expectBegin(ctrl, top, 5)
+	shardTX := expectBegin(ctrl, shards[0], 6)
+	shardTX.EXPECT().Rollback().Return(nil)
+	topTX.EXPECT().Rollback().Return(nil)
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := tx.Set(keyHash(0), trillian.MapLeaf{}); err == nil {
+		t.Fatalf("Set succeeded on a shard writing a different revision")
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+}
+
+func TestCommitFailureRollsBack(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, top, shards := newTestMapStorage(t, ctrl, 2)
+	topTX := expectBegin(ctrl, top, 5)
+	tx0 := expectBegin(ctrl, shards[0], 5)
+	tx1 := expectBegin(ctrl, shards[1], 5)
+	tx0.EXPECT().Set(gomock.Any(), gomock.Any()).Return(nil)
+	tx1.EXPECT().Set(gomock.Any(), gomock.Any()).Return(nil)
+	tx0.EXPECT().Commit().Return(errors.New("lost connection"))
+	tx0.EXPECT().IsOpen().Return(false)
+	tx1.EXPECT().IsOpen().Return(true)
+	tx1.EXPECT().Rollback().Return(nil)
+	topTX.EXPECT().Rollback().Return(nil)
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	for _, kh := range []trillian.Hash{keyHash(0), keyHash(0xff)} {
+		if err := tx.Set(kh, trillian.MapLeaf{}); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if err := tx.Commit(); err == nil {
+		t.Fatalf("Commit succeeded when a shard failed to commit")
+	}
+}
+
+func TestTopCommitFailureRepairsShards(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, top, shards := newTestMapStorage(t, ctrl, 1)
+	s.timeSource = util.FakeTimeSource{FakeTime: time.Unix(0, 1234)}
+	topTX := expectBegin(ctrl, top, 5)
+	shardTX := expectBegin(ctrl, shards[0], 5)
+	shardTX.EXPECT().Set(gomock.Any(), gomock.Any()).Return(nil)
+	shardTX.EXPECT().Commit().Return(nil)
+	topTX.EXPECT().Commit().Return(errors.New("lost connection"))
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := tx.Set(keyHash(0), trillian.MapLeaf{}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Fatalf("Commit succeeded when the top store failed to commit")
+	}
+
+	// The next transaction reverts the shard to the top store's revision
+	// before it starts
+	snapshot := storage.NewMockReadOnlyMapTX(ctrl)
+	top.EXPECT().Snapshot().Return(snapshot, nil)
+	snapshot.EXPECT().LatestSignedMapRoot().Return(trillian.SignedMapRoot{MapRevision: 4}, nil)
+	snapshot.EXPECT().Commit().Return(nil)
+	repairTX := storage.NewMockMapTX(ctrl)
+	shards[0].EXPECT().Begin().Return(repairTX, nil)
+	repairTX.EXPECT().StagedSignedMapRoot().Return(trillian.SignedMapRoot{}, false, nil)
+	repairTX.EXPECT().LatestSignedMapRoot().Return(trillian.SignedMapRoot{MapRevision: 5}, nil)
+	repairTX.EXPECT().RevertMapHead(int64(4), gomock.Any(), int64(1234)).Return(storage.MapHeadRevert{}, nil)
+	repairTX.EXPECT().Commit().Return(nil)
+	repairTX.EXPECT().Rollback().Return(nil)
+	expectBegin(ctrl, top, 5).EXPECT().Rollback().Return(nil)
+	expectBegin(ctrl, shards[0], 6).EXPECT().Rollback().Return(nil)
+	skipTX := expectBegin(ctrl, top, 5)
+	skipTX.EXPECT().SkipMapRevisions(int64(5), gomock.Any(), int64(1234)).Return(nil)
+	skipTX.EXPECT().Commit().Return(nil)
+	skipTX.EXPECT().Rollback().Return(nil)
+	expectBegin(ctrl, top, 6).EXPECT().Rollback().Return(nil)
+
+	tx, err = s.Begin()
+	if err != nil {
+		t.Fatalf("Begin after failed commit failed: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	// Once repaired, transactions start without repairing again
+	expectBegin(ctrl, top, 6).EXPECT().Rollback().Return(nil)
+	tx, err = s.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+}
+
+func TestArchiveNotSupported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, top, _ := newTestMapStorage(t, ctrl, 1)
+	topTX := expectBegin(ctrl, top, 1)
+	topTX.EXPECT().Rollback().Return(nil)
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.GetArchivedRevisions(); err != ErrArchiveNotSupported {
+		t.Fatalf("GetArchivedRevisions returned %v, want %v", err, ErrArchiveNotSupported)
+	}
+}
+
+func TestRepairShards(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	s, top, shards := newTestMapStorage(t, ctrl, 4)
+	topTX := storage.NewMockReadOnlyMapTX(ctrl)
+	top.EXPECT().Snapshot().Return(topTX, nil)
+	topTX.EXPECT().LatestSignedMapRoot().Return(trillian.SignedMapRoot{MapRevision: 10}, nil)
+	topTX.EXPECT().Commit().Return(nil)
+
+	for i, test := range []struct {
+		staged bool
+		latest int64
+		repair bool
+	}{
+		{latest: 10},
+		{latest: 11, repair: true},
+		{staged: true, latest: 10, repair: true},
+		{staged: true, latest: 11, repair: true},
+	} {
+		tx := storage.NewMockMapTX(ctrl)
+		shards[i].EXPECT().Begin().Return(tx, nil)
+		tx.EXPECT().StagedSignedMapRoot().Return(trillian.SignedMapRoot{}, test.staged, nil)
+		if test.staged {
+			tx.EXPECT().AbandonStagedMapRoot().Return(nil)
+		}
+		tx.EXPECT().LatestSignedMapRoot().Return(trillian.SignedMapRoot{MapRevision: test.latest}, nil)
+		if test.latest > 10 {
+			tx.EXPECT().RevertMapHead(int64(10), gomock.Any(), int64(1234)).Return(storage.MapHeadRevert{}, nil)
+		}
+		if test.repair {
+			tx.EXPECT().Commit().Return(nil)
+		}
+		tx.EXPECT().Rollback().Return(nil)
+	}
+
+	// The shards that reverted revision 11 won't write it again, so the
+	// other stores skip it too
+	expectBegin(ctrl, top, 11).EXPECT().Rollback().Return(nil)
+	for i, next := range []int64{11, 12, 11, 12} {
+		expectBegin(ctrl, shards[i], next).EXPECT().Rollback().Return(nil)
+	}
+	for _, ms := range []*storage.MockMapStorage{top, shards[0], shards[2]} {
+		tx := expectBegin(ctrl, ms, 11)
+		tx.EXPECT().SkipMapRevisions(int64(11), gomock.Any(), int64(1234)).Return(nil)
+		tx.EXPECT().Commit().Return(nil)
+		tx.EXPECT().Rollback().Return(nil)
+	}
+
+	repaired, err := s.RepairShards(1234)
+	if err != nil {
+		t.Fatalf("RepairShards failed: %v", err)
+	}
+	if repaired != 3 {
+		t.Fatalf("RepairShards repaired %d shards, want 3", repaired)
+	}
+}
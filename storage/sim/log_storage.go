@@ -0,0 +1,531 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+)
+
+// ConflictError is returned when committing a transaction whose writes clash
+// with ones committed since it started. It stands for the unique keys and row
+// counts that reject the same writes in the MySQL storage.
+type ConflictError struct {
+	What string
+}
+
+func (e ConflictError) Error() string {
+	return fmt.Sprintf("conflicting write: %s", e.What)
+}
+
+// Log holds the committed state of a simulated log, shared by the actors
+// using it. Transactions read what has been committed, along with their own
+// writes, and their writes are applied when they commit.
+type Log struct {
+	logID trillian.LogID
+
+	roots     []trillian.SignedLogRoot
+	queue     []trillian.LogLeaf
+	sequenced map[int64]trillian.LogLeaf
+	// nodes holds the revisions of each node, keyed by NodeID.String(), in the
+	// order they were written
+	nodes map[string][]storage.Node
+}
+
+// NewLog creates an empty simulated log.
+func NewLog(logID trillian.LogID) *Log {
+	return &Log{
+		logID:     logID,
+		sequenced: make(map[int64]trillian.LogLeaf),
+		nodes:     make(map[string][]storage.Node),
+	}
+}
+
+// Roots returns every root that has been committed, in the order they were.
+func (l *Log) Roots() []trillian.SignedLogRoot {
+	return append([]trillian.SignedLogRoot{}, l.roots...)
+}
+
+// Queued returns the leaves waiting to be sequenced.
+func (l *Log) Queued() []trillian.LogLeaf {
+	return append([]trillian.LogLeaf{}, l.queue...)
+}
+
+// Sequenced returns the leaves that have been sequenced, in sequence order.
+func (l *Log) Sequenced() []trillian.LogLeaf {
+	leaves := make([]trillian.LogLeaf, 0, len(l.sequenced))
+	for _, leaf := range l.sequenced {
+		leaves = append(leaves, leaf)
+	}
+	sort.Sort(bySequence(leaves))
+	return leaves
+}
+
+// Storage returns a LogStorage for a's use. Each of its operations yields to
+// the scheduler at a point named after the operation, such as
+// "LogTX.DequeueLeaves". If a is nil the operations never yield.
+func (l *Log) Storage(a *Actor) storage.LogStorage {
+	return &logStorage{l: l, a: a}
+}
+
+func (l *Log) latestRoot() trillian.SignedLogRoot {
+	var latest trillian.SignedLogRoot
+	for _, r := range l.roots {
+		if r.TimestampNanos > latest.TimestampNanos || (r.TimestampNanos == latest.TimestampNanos && r.TreeRevision > latest.TreeRevision) {
+			latest = r
+		}
+	}
+	return latest
+}
+
+type bySequence []trillian.LogLeaf
+
+func (l bySequence) Len() int           { return len(l) }
+func (l bySequence) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l bySequence) Less(i, j int) bool { return l[i].SequenceNumber < l[j].SequenceNumber }
+
+type logStorage struct {
+	l *Log
+	a *Actor
+}
+
+func (s *logStorage) HashPrefixes() storage.TreeHashPrefixes {
+	return storage.TreeHashPrefixes{}
+}
+
+func (s *logStorage) HashAlgorithm() trillian.HashAlgorithm {
+	return trillian.HashAlgorithm_SHA256
+}
+
+func (s *logStorage) HashStrategy() trillian.HashStrategy {
+	return trillian.HashStrategy_RFC6962
+}
+
+func (s *logStorage) MaxRootDuration() time.Duration {
+	return 0
+}
+
+func (s *logStorage) SequenceGuard() time.Duration {
+	return 0
+}
+
+func (s *logStorage) TreeState() trillian.TreeState {
+	return trillian.TreeState_ACTIVE
+}
+
+func (s *logStorage) TreeType() trillian.TreeType {
+	return trillian.TreeType_LOG
+}
+
+// DuplicatePolicy is ALLOW_DUPLICATES, as the simulated storage queues every leaf.
+func (s *logStorage) DuplicatePolicy() trillian.DuplicatePolicy {
+	return trillian.DuplicatePolicy_ALLOW_DUPLICATES
+}
+
+func (s *logStorage) Begin() (storage.LogTX, error) {
+	if err := s.a.Yield("LogStorage.Begin"); err != nil {
+		return nil, err
+	}
+	return s.begin(), nil
+}
+
+func (s *logStorage) Snapshot() (storage.ReadOnlyLogTX, error) {
+	if err := s.a.Yield("LogStorage.Snapshot"); err != nil {
+		return nil, err
+	}
+	return s.begin(), nil
+}
+
+func (s *logStorage) begin() *logTX {
+	return &logTX{l: s.l, a: s.a, open: true, writeRevision: s.l.latestRoot().TreeRevision + 1}
+}
+
+var errClosed = errors.New("transaction is closed")
+
+type logTX struct {
+	l             *Log
+	a             *Actor
+	open          bool
+	writeRevision int64
+
+	// The writes to apply when the transaction commits
+	queued    []trillian.LogLeaf
+	dequeued  []trillian.LogLeaf
+	sequenced []trillian.LogLeaf
+	nodes     []storage.Node
+	roots     []trillian.SignedLogRoot
+	refreshed []trillian.SignedLogRoot
+}
+
+// op yields at the point for the named operation, and returns an error if the
+// operation mustn't go ahead.
+func (t *logTX) op(name string) error {
+	if !t.open {
+		return errClosed
+	}
+	return t.a.Yield("LogTX." + name)
+}
+
+func (t *logTX) IsOpen() bool {
+	return t.open
+}
+
+func (t *logTX) WriteRevision() int64 {
+	return t.writeRevision
+}
+
+func (t *logTX) Commit() error {
+	if err := t.op("Commit"); err != nil {
+		t.open = false
+		return err
+	}
+	t.open = false
+	if err := t.check(); err != nil {
+		return err
+	}
+
+	l := t.l
+	l.queue = append(l.queue, t.queued...)
+	for _, leaf := range t.dequeued {
+		l.queue = removeLeaf(l.queue, leaf)
+	}
+	for _, leaf := range t.sequenced {
+		l.sequenced[leaf.SequenceNumber] = leaf
+	}
+	for _, n := range t.nodes {
+		id := n.NodeID.String()
+		l.nodes[id] = append(l.nodes[id], n)
+	}
+	l.roots = append(l.roots, t.roots...)
+	for _, r := range t.refreshed {
+		for i, c := range l.roots {
+			if c.TreeRevision == r.TreeRevision {
+				l.roots[i] = r
+			}
+		}
+	}
+	return nil
+}
+
+// check returns a ConflictError if the transaction's writes can't be applied
+// to what is committed now.
+func (t *logTX) check() error {
+	l := t.l
+	for _, leaf := range t.dequeued {
+		if findLeaf(l.queue, leaf) < 0 {
+			return ConflictError{fmt.Sprintf("dequeued leaf %x is no longer queued", leaf.LeafHash)}
+		}
+	}
+	seen := make(map[int64]bool)
+	for _, leaf := range t.sequenced {
+		if _, ok := l.sequenced[leaf.SequenceNumber]; ok || seen[leaf.SequenceNumber] {
+			return ConflictError{fmt.Sprintf("sequence number %d is already used", leaf.SequenceNumber)}
+		}
+		seen[leaf.SequenceNumber] = true
+	}
+	for _, n := range t.nodes {
+		for _, c := range l.nodes[n.NodeID.String()] {
+			if c.NodeRevision == n.NodeRevision {
+				return ConflictError{fmt.Sprintf("node %s already has revision %d", n.NodeID.String(), n.NodeRevision)}
+			}
+		}
+	}
+	for _, r := range t.roots {
+		for _, c := range l.roots {
+			if c.TreeRevision == r.TreeRevision {
+				return ConflictError{fmt.Sprintf("root with revision %d already exists", r.TreeRevision)}
+			}
+		}
+	}
+	for _, r := range t.refreshed {
+		if latest := l.latestRoot(); latest.TreeRevision != r.TreeRevision {
+			return ConflictError{fmt.Sprintf("refreshed root with revision %d is no longer the latest, which has revision %d", r.TreeRevision, latest.TreeRevision)}
+		}
+	}
+	return nil
+}
+
+func (t *logTX) Rollback() error {
+	err := t.op("Rollback")
+	t.open = false
+	return err
+}
+
+func findLeaf(leaves []trillian.LogLeaf, leaf trillian.LogLeaf) int {
+	for i, l := range leaves {
+		if bytes.Equal(l.LeafHash, leaf.LeafHash) {
+			return i
+		}
+	}
+	return -1
+}
+
+func removeLeaf(leaves []trillian.LogLeaf, leaf trillian.LogLeaf) []trillian.LogLeaf {
+	if i := findLeaf(leaves, leaf); i >= 0 {
+		return append(leaves[:i:i], leaves[i+1:]...)
+	}
+	return leaves
+}
+
+// QueueLeaves queues every leaf, as simulated logs allow duplicates.
+func (t *logTX) QueueLeaves(leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
+	if err := t.op("QueueLeaves"); err != nil {
+		return nil, err
+	}
+	t.queued = append(t.queued, leaves...)
+	return make([]*trillian.LogLeaf, len(leaves)), nil
+}
+
+// DequeueLeaves returns the oldest queued leaves. A leaf dequeued by two
+// transactions can only be sequenced by the first of them to commit. Leaves
+// aren't timestamped, so the guard window is ignored.
+func (t *logTX) DequeueLeaves(limit int, guardWindow time.Duration) ([]trillian.LogLeaf, error) {
+	if err := t.op("DequeueLeaves"); err != nil {
+		return nil, err
+	}
+	leaves := make([]trillian.LogLeaf, 0, limit)
+	for _, leaf := range t.l.queue {
+		if len(leaves) >= limit {
+			break
+		}
+		if findLeaf(t.dequeued, leaf) < 0 {
+			leaves = append(leaves, leaf)
+		}
+	}
+	t.dequeued = append(t.dequeued, leaves...)
+	return leaves, nil
+}
+
+// OldestQueuedLeafTimestampNanos always returns zero, as simulated leaves
+// aren't timestamped.
+func (t *logTX) OldestQueuedLeafTimestampNanos() (int64, error) {
+	if err := t.op("OldestQueuedLeafTimestampNanos"); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+func (t *logTX) UpdateSequencedLeaves(leaves []trillian.LogLeaf) error {
+	if err := t.op("UpdateSequencedLeaves"); err != nil {
+		return err
+	}
+	t.sequenced = append(t.sequenced, leaves...)
+	return nil
+}
+
+// AddSequencedLeaves always fails, as simulated logs aren't pre-ordered.
+func (t *logTX) AddSequencedLeaves(leaves []trillian.LogLeaf) ([]*trillian.LogLeaf, error) {
+	if err := t.op("AddSequencedLeaves"); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("simulated logs aren't pre-ordered")
+}
+
+// DequeueSequencedLeaves always fails, as simulated logs aren't pre-ordered.
+func (t *logTX) DequeueSequencedLeaves(start int64, limit int) ([]trillian.LogLeaf, error) {
+	if err := t.op("DequeueSequencedLeaves"); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("simulated logs aren't pre-ordered")
+}
+
+func (t *logTX) GetSequencedLeafCount() (int64, error) {
+	if err := t.op("GetSequencedLeafCount"); err != nil {
+		return 0, err
+	}
+	return int64(len(t.l.sequenced)), nil
+}
+
+func (t *logTX) GetLeavesByIndex(indices []int64) ([]trillian.LogLeaf, error) {
+	if err := t.op("GetLeavesByIndex"); err != nil {
+		return nil, err
+	}
+	leaves := make([]trillian.LogLeaf, 0, len(indices))
+	for _, index := range indices {
+		leaf, ok := t.l.sequenced[index]
+		if !ok {
+			return nil, fmt.Errorf("no leaf at index %d", index)
+		}
+		leaves = append(leaves, leaf)
+	}
+	return leaves, nil
+}
+
+func (t *logTX) GetLeavesByRange(start, count int64) ([]trillian.LogLeaf, error) {
+	if err := t.op("GetLeavesByRange"); err != nil {
+		return nil, err
+	}
+	if start < 0 || count <= 0 {
+		return nil, fmt.Errorf("invalid range start=%d count=%d", start, count)
+	}
+	var leaves []trillian.LogLeaf
+	for index := start; index < start+count; index++ {
+		leaf, ok := t.l.sequenced[index]
+		if !ok {
+			break
+		}
+		leaves = append(leaves, leaf)
+	}
+	return leaves, nil
+}
+
+func (t *logTX) GetLeafIndexRangeByTime(startNanos, endNanos int64) (int64, int64, error) {
+	if err := t.op("GetLeafIndexRangeByTime"); err != nil {
+		return 0, 0, err
+	}
+	var begin, end int64
+	for _, leaf := range t.l.Sequenced() {
+		if leaf.IntegrateTimestampNanos < startNanos {
+			begin = leaf.SequenceNumber + 1
+		}
+		if leaf.IntegrateTimestampNanos < endNanos {
+			end = leaf.SequenceNumber + 1
+		}
+	}
+	return begin, end, nil
+}
+
+func (t *logTX) GetLeavesByHash(leafHashes []trillian.Hash, orderBySequence bool) ([]trillian.LogLeaf, error) {
+	if err := t.op("GetLeavesByHash"); err != nil {
+		return nil, err
+	}
+	var leaves []trillian.LogLeaf
+	for _, leaf := range t.l.Sequenced() {
+		for _, hash := range leafHashes {
+			if bytes.Equal(leaf.LeafHash, hash) {
+				leaves = append(leaves, leaf)
+				break
+			}
+		}
+	}
+	return leaves, nil
+}
+
+func (t *logTX) LatestSignedLogRoot() (trillian.SignedLogRoot, error) {
+	if err := t.op("LatestSignedLogRoot"); err != nil {
+		return trillian.SignedLogRoot{}, err
+	}
+	return t.l.latestRoot(), nil
+}
+
+// GetLogRootCosignatures returns no cosignatures, as simulated logs don't store
+// them.
+func (t *logTX) GetLogRootCosignatures(treeRevision int64) ([]trillian.Cosignature, error) {
+	if err := t.op("GetLogRootCosignatures"); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// StoreLogRootCosignature always fails, as simulated logs don't store
+// cosignatures.
+func (t *logTX) StoreLogRootCosignature(treeRevision int64, cosig trillian.Cosignature) error {
+	if err := t.op("StoreLogRootCosignature"); err != nil {
+		return err
+	}
+	return errors.New("simulated logs don't store cosignatures")
+}
+
+// RefreshSignedLogRoot replaces the latest root when the transaction commits.
+// Simulated logs don't store cosignatures, so there are none to discard.
+func (t *logTX) RefreshSignedLogRoot(root trillian.SignedLogRoot) error {
+	if err := t.op("RefreshSignedLogRoot"); err != nil {
+		return err
+	}
+	t.refreshed = append(t.refreshed, root)
+	return nil
+}
+
+func (t *logTX) StoreSignedLogRoot(root trillian.SignedLogRoot) error {
+	if err := t.op("StoreSignedLogRoot"); err != nil {
+		return err
+	}
+	t.roots = append(t.roots, root)
+	return nil
+}
+
+func (t *logTX) GetTreeRevisionAtSize(treeSize int64) (int64, error) {
+	if err := t.op("GetTreeRevisionAtSize"); err != nil {
+		return 0, err
+	}
+	if treeSize <= 0 {
+		return 0, fmt.Errorf("invalid tree size: %d", treeSize)
+	}
+	rev := int64(-1)
+	for _, r := range t.l.roots {
+		if r.TreeSize == treeSize && r.TreeRevision > rev {
+			rev = r.TreeRevision
+		}
+	}
+	if rev < 0 {
+		return 0, fmt.Errorf("no root with tree size %d", treeSize)
+	}
+	return rev, nil
+}
+
+// GetMerkleNodes returns the latest revision of each node that is no later
+// than treeRevision, leaving out nodes that have none.
+func (t *logTX) GetMerkleNodes(treeRevision int64, ids []storage.NodeID) ([]storage.Node, error) {
+	if err := t.op("GetMerkleNodes"); err != nil {
+		return nil, err
+	}
+	var nodes []storage.Node
+	for _, id := range ids {
+		var found *storage.Node
+		for _, n := range t.revisions(id) {
+			if n.NodeRevision <= treeRevision && (found == nil || n.NodeRevision >= found.NodeRevision) {
+				n := n
+				found = &n
+			}
+		}
+		if found != nil {
+			nodes = append(nodes, *found)
+		}
+	}
+	return nodes, nil
+}
+
+// revisions returns the committed revisions of a node along with any the
+// transaction has written.
+func (t *logTX) revisions(id storage.NodeID) []storage.Node {
+	key := id.String()
+	nodes := append([]storage.Node{}, t.l.nodes[key]...)
+	for _, n := range t.nodes {
+		if n.NodeID.String() == key {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+func (t *logTX) SetMerkleNodes(nodes []storage.Node) error {
+	if err := t.op("SetMerkleNodes"); err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		n.NodeRevision = t.writeRevision
+		t.nodes = append(t.nodes, n)
+	}
+	return nil
+}
+
+func (t *logTX) GetActiveLogIDs() ([]trillian.LogID, error) {
+	if err := t.op("GetActiveLogIDs"); err != nil {
+		return nil, err
+	}
+	return []trillian.LogID{t.l.logID}, nil
+}
+
+func (t *logTX) GetActiveLogIDsWithPendingWork() ([]trillian.LogID, error) {
+	if err := t.op("GetActiveLogIDsWithPendingWork"); err != nil {
+		return nil, err
+	}
+	if len(t.l.queue) == 0 {
+		return nil, nil
+	}
+	return []trillian.LogID{t.l.logID}, nil
+}
@@ -0,0 +1,128 @@
+// Package sim provides storage for tests whose operations are interleaved by a
+// deterministic scheduler. Each storage operation is a point at which the
+// scheduler may switch to another actor, so races between concurrent writers,
+// like two sequencers trying to write the same tree revision, can be explored
+// and replayed exactly from a seed. Operations can also be made to fail at
+// chosen points.
+package sim
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// event is sent by an actor when it stops running.
+type event struct {
+	actor *Actor
+	done  bool
+}
+
+type failure struct {
+	nth int
+	err error
+}
+
+// Scheduler runs a set of actors one at a time, switching between them at
+// random at the points where they yield. Only one actor runs at any time, so
+// the state they share doesn't need locking, and the order they run in is
+// decided entirely by the seed.
+type Scheduler struct {
+	rand   *rand.Rand
+	actors []*Actor
+	events chan event
+
+	arrivals map[string]int
+	failures map[string][]failure
+	trace    []string
+}
+
+// NewScheduler creates a Scheduler whose choices are made from seed.
+func NewScheduler(seed int64) *Scheduler {
+	return &Scheduler{
+		rand:     rand.New(rand.NewSource(seed)),
+		events:   make(chan event),
+		arrivals: make(map[string]int),
+		failures: make(map[string][]failure),
+	}
+}
+
+// Actor is a thread of execution run by a Scheduler. A nil Actor never yields,
+// for setting up and checking state outside of a run.
+type Actor struct {
+	name   string
+	s      *Scheduler
+	resume chan struct{}
+}
+
+// Name returns the name the actor was created with.
+func (a *Actor) Name() string {
+	if a == nil {
+		return ""
+	}
+	return a.name
+}
+
+// Go adds an actor running f. It doesn't start until Run is called.
+func (s *Scheduler) Go(name string, f func(a *Actor)) {
+	a := &Actor{name: name, s: s, resume: make(chan struct{})}
+	s.actors = append(s.actors, a)
+	go func() {
+		<-a.resume
+		f(a)
+		s.events <- event{actor: a, done: true}
+	}()
+}
+
+// FailAt makes the nth arrival of any actor at point fail with err, counting
+// from 1. The operation at the point isn't performed.
+func (s *Scheduler) FailAt(point string, nth int, err error) {
+	s.failures[point] = append(s.failures[point], failure{nth: nth, err: err})
+}
+
+// Run runs the actors until they have all finished.
+func (s *Scheduler) Run() {
+	for len(s.actors) > 0 {
+		i := s.rand.Intn(len(s.actors))
+		s.actors[i].resume <- struct{}{}
+		if ev := <-s.events; ev.done {
+			s.remove(ev.actor)
+		}
+	}
+}
+
+func (s *Scheduler) remove(a *Actor) {
+	for i, b := range s.actors {
+		if a == b {
+			s.actors = append(s.actors[:i], s.actors[i+1:]...)
+			return
+		}
+	}
+}
+
+// Trace returns the points the actors have yielded at, in order, as
+// "actor@point". Runs with the same seed and actors give the same trace.
+func (s *Scheduler) Trace() []string {
+	return append([]string{}, s.trace...)
+}
+
+// Yield records that a has arrived at point and lets the scheduler run another
+// actor before it carries on. It returns the error injected by FailAt for this
+// arrival, if there is one.
+func (a *Actor) Yield(point string) error {
+	if a == nil {
+		return nil
+	}
+	s := a.s
+	s.arrivals[point]++
+	s.trace = append(s.trace, fmt.Sprintf("%s@%s", a.name, point))
+	var err error
+	for _, f := range s.failures[point] {
+		if f.nth == s.arrivals[point] {
+			err = f.err
+		}
+	}
+
+	s.events <- event{actor: a}
+	<-a.resume
+	return err
+}
@@ -0,0 +1,195 @@
+package sim
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/log"
+	"github.com/google/trillian/merkle"
+)
+
+func yielder(points ...string) func(a *Actor) {
+	return func(a *Actor) {
+		for _, p := range points {
+			a.Yield(p)
+		}
+	}
+}
+
+func runYielders(seed int64) []string {
+	s := NewScheduler(seed)
+	s.Go("a", yielder("1", "2", "3", "4", "5"))
+	s.Go("b", yielder("1", "2", "3", "4", "5"))
+	s.Run()
+	return s.Trace()
+}
+
+func TestSchedulerIsDeterministic(t *testing.T) {
+	for seed := int64(0); seed < 10; seed++ {
+		trace := runYielders(seed)
+		if got, want := len(trace), 10; got != want {
+			t.Errorf("seed %d: got %d points in trace, want %d: %v", seed, got, want, trace)
+		}
+		if again := runYielders(seed); !reflect.DeepEqual(trace, again) {
+			t.Errorf("seed %d: got trace %v, then %v", seed, trace, again)
+		}
+	}
+}
+
+func TestFailAt(t *testing.T) {
+	errInjected := errors.New("injected")
+	s := NewScheduler(1)
+	s.FailAt("p", 2, errInjected)
+	var errs []error
+	s.Go("a", func(a *Actor) {
+		for i := 0; i < 3; i++ {
+			errs = append(errs, a.Yield("p"))
+		}
+	})
+	s.Run()
+
+	if want := []error{nil, errInjected, nil}; !reflect.DeepEqual(errs, want) {
+		t.Errorf("Yield() returned %v, want %v", errs, want)
+	}
+}
+
+type fakeSigner struct{}
+
+func (fakeSigner) SignLogRoot(root trillian.SignedLogRoot) (trillian.DigitallySigned, error) {
+	return trillian.DigitallySigned{Signature: []byte("signed")}, nil
+}
+
+func rootNeverExpires(trillian.SignedLogRoot) bool {
+	return false
+}
+
+func newLogWithLeaves(t *testing.T, n int) *Log {
+	l := NewLog(trillian.LogID{LogID: []byte("log"), TreeID: 1})
+	tx, err := l.Storage(nil).Begin()
+	if err != nil {
+		t.Fatalf("Begin() = %v", err)
+	}
+	var leaves []trillian.LogLeaf
+	for i := 0; i < n; i++ {
+		hash := sha256.Sum256([]byte(fmt.Sprintf("leaf %d", i)))
+		leaves = append(leaves, trillian.LogLeaf{Leaf: trillian.Leaf{LeafHash: hash[:]}})
+	}
+	if _, err := tx.QueueLeaves(leaves); err != nil {
+		t.Fatalf("QueueLeaves() = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() = %v", err)
+	}
+	return l
+}
+
+// tickingTimeSource returns a time one second later on each call, as roots
+// must have increasing timestamps.
+type tickingTimeSource struct {
+	now time.Time
+}
+
+func (ts *tickingTimeSource) Now() time.Time {
+	ts.now = ts.now.Add(time.Second)
+	return ts.now
+}
+
+// sequence runs a sequencer until the log's queue is empty, returning the
+// errors it hit.
+func sequence(l *Log, a *Actor) []error {
+	hasher := merkle.NewRFC6962TreeHasher(trillian.NewSHA256())
+	ts := &tickingTimeSource{now: time.Unix(1000, 0)}
+	s := log.NewSequencerWithRootSigner(hasher, ts, l.Storage(a), fakeSigner{})
+	var errs []error
+	for i := 0; i < 100 && len(l.Queued()) > 0; i++ {
+		if _, err := s.SequenceBatch(3, rootNeverExpires); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// checkLog checks that every queued leaf has been sequenced exactly once, and
+// that the roots are for consecutive revisions of the tree.
+func checkLog(t *testing.T, seed int64, l *Log, n int) {
+	leaves := l.Sequenced()
+	if len(leaves) != n || len(l.Queued()) != 0 {
+		t.Errorf("seed %d: got %d sequenced leaves and %d queued, want %d sequenced", seed, len(leaves), len(l.Queued()), n)
+		return
+	}
+	tree := merkle.NewCompactMerkleTree(merkle.NewRFC6962TreeHasher(trillian.NewSHA256()))
+	roots := make(map[int64]trillian.Hash)
+	seen := make(map[string]bool)
+	for i, leaf := range leaves {
+		if leaf.SequenceNumber != int64(i) {
+			t.Errorf("seed %d: got leaf with sequence number %d at position %d", seed, leaf.SequenceNumber, i)
+		}
+		if seen[string(leaf.LeafHash)] {
+			t.Errorf("seed %d: leaf %x sequenced twice", seed, leaf.LeafHash)
+		}
+		seen[string(leaf.LeafHash)] = true
+		tree.AddLeafHash(leaf.LeafHash, func(int, int64, trillian.Hash) {})
+		roots[tree.Size()] = tree.CurrentRoot()
+	}
+
+	for i, root := range l.Roots() {
+		if got, want := root.TreeRevision, int64(i+1); got != want {
+			t.Errorf("seed %d: got root %d with revision %d, want %d", seed, i, got, want)
+		}
+		if want := roots[root.TreeSize]; !bytes.Equal(root.RootHash, want) {
+			t.Errorf("seed %d: got root hash %x at size %d, want %x", seed, root.RootHash, root.TreeSize, want)
+		}
+	}
+}
+
+func TestConcurrentSequencers(t *testing.T) {
+	const numLeaves = 10
+	conflicts := 0
+	for seed := int64(0); seed < 50; seed++ {
+		l := newLogWithLeaves(t, numLeaves)
+		s := NewScheduler(seed)
+		var errs []error
+		for _, name := range []string{"a", "b"} {
+			s.Go(name, func(a *Actor) {
+				errs = append(errs, sequence(l, a)...)
+			})
+		}
+		s.Run()
+
+		for _, err := range errs {
+			if _, ok := err.(ConflictError); ok {
+				conflicts++
+			}
+		}
+		checkLog(t, seed, l, numLeaves)
+	}
+
+	// The seeds should find at least some of the interleavings in which both
+	// sequencers try to write the same revision.
+	if conflicts == 0 {
+		t.Error("Sequencers never conflicted")
+	}
+}
+
+func TestSequencerCommitFailure(t *testing.T) {
+	const numLeaves = 5
+	l := newLogWithLeaves(t, numLeaves)
+	s := NewScheduler(1)
+	s.FailAt("LogTX.Commit", 1, errors.New("connection lost"))
+	var errs []error
+	s.Go("a", func(a *Actor) {
+		errs = sequence(l, a)
+	})
+	s.Run()
+
+	if len(errs) != 1 {
+		t.Errorf("Got errors %v, want the injected one", errs)
+	}
+	checkLog(t, 1, l, numLeaves)
+}
@@ -0,0 +1,241 @@
+// Package sqlhooks wraps a database/sql driver so that every statement run
+// through it is reported to a hook, with its latency, the number of rows it
+// returned or affected and its error. Storage backends open their databases
+// through it rather than instrumenting each query by hand, so that metrics and
+// slow query logging work the same way for all of them.
+package sqlhooks
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Statement describes a statement that has been run.
+type Statement struct {
+	// Query is the SQL of the statement. Transactions are reported as
+	// statements with the Query "COMMIT" or "ROLLBACK".
+	Query string
+	// Latency is the time taken to run the statement. For queries it includes
+	// the time taken to read the rows, up to when they were closed.
+	Latency time.Duration
+	// Rows is the number of rows returned by a query, or affected by any other
+	// statement. Drivers don't report the number of rows the database examined
+	// to produce them.
+	Rows int64
+	// Err is the error the statement failed with, if any.
+	Err error
+}
+
+// Hook is called after each statement is run. It may be called concurrently
+// for statements on different connections.
+type Hook func(s Statement)
+
+// Combine returns a Hook which calls each of hooks in turn.
+func Combine(hooks ...Hook) Hook {
+	return func(s Statement) {
+		for _, h := range hooks {
+			h(s)
+		}
+	}
+}
+
+// Driver is a driver.Driver which reports the statements run on its
+// connections to a Hook.
+type Driver struct {
+	driver.Driver
+	hook Hook
+	now  func() time.Time
+}
+
+// Wrap returns a driver which opens connections with d and reports their
+// statements to hook.
+func Wrap(d driver.Driver, hook Hook) *Driver {
+	return &Driver{Driver: d, hook: hook, now: time.Now}
+}
+
+// wrappedDrivers counts the drivers registered by Open, to give them unique names.
+var wrappedDrivers int64
+
+// Open opens a database like sql.Open, with the driver registered as
+// driverName, reporting its statements to hook. A separate driver is
+// registered with database/sql for each call, so it should only be used when
+// setting up storage.
+func Open(driverName, dsn string, hook Hook) (*sql.DB, error) {
+	// Opening a database doesn't connect to it, so this is a cheap way to find
+	// the registered driver without importing it
+	db, err := sql.Open(driverName, "")
+	if err != nil {
+		return nil, err
+	}
+	d := db.Driver()
+	db.Close()
+
+	name := fmt.Sprintf("sqlhooks-%s-%d", driverName, atomic.AddInt64(&wrappedDrivers, 1))
+	sql.Register(name, Wrap(d, hook))
+	return sql.Open(name, dsn)
+}
+
+// Open implements driver.Driver.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.Driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, d: d}, nil
+}
+
+// report calls the hook for a statement started at start.
+func (d *Driver) report(query string, start time.Time, rows int64, err error) {
+	d.hook(Statement{Query: query, Latency: d.now().Sub(start), Rows: rows, Err: err})
+}
+
+// conn wraps a connection. The Execer and Queryer fast paths are always
+// offered, and fall back to a prepared statement if the wrapped connection
+// doesn't support them, as database/sql itself would.
+type conn struct {
+	driver.Conn
+	d *Driver
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	s, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{Stmt: s, d: c.d, query: query}, nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	t, err := c.Conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: t, d: c.d}, nil
+}
+
+func (c *conn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.Execer)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := c.d.now()
+	res, err := execer.Exec(query, args)
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	c.d.report(query, start, rowsAffected(res, err), err)
+	return res, err
+}
+
+func (c *conn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.Queryer)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := c.d.now()
+	r, err := queryer.Query(query, args)
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	if err != nil {
+		c.d.report(query, start, 0, err)
+		return nil, err
+	}
+	return &rows{Rows: r, d: c.d, query: query, start: start}, nil
+}
+
+type stmt struct {
+	driver.Stmt
+	d     *Driver
+	query string
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	start := s.d.now()
+	res, err := s.Stmt.Exec(args)
+	s.d.report(s.query, start, rowsAffected(res, err), err)
+	return res, err
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	start := s.d.now()
+	r, err := s.Stmt.Query(args)
+	if err != nil {
+		s.d.report(s.query, start, 0, err)
+		return nil, err
+	}
+	return &rows{Rows: r, d: s.d, query: s.query, start: start}, nil
+}
+
+// ColumnConverter passes on the wrapped statement's converter, if it has one.
+func (s *stmt) ColumnConverter(idx int) driver.ValueConverter {
+	if cc, ok := s.Stmt.(driver.ColumnConverter); ok {
+		return cc.ColumnConverter(idx)
+	}
+	return driver.DefaultParameterConverter
+}
+
+// rows counts the rows read, and reports the query when they are closed.
+type rows struct {
+	driver.Rows
+	d     *Driver
+	query string
+	start time.Time
+	n     int64
+	err   error
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	switch err {
+	case nil:
+		r.n++
+	case io.EOF:
+	default:
+		r.err = err
+	}
+	return err
+}
+
+func (r *rows) Close() error {
+	err := r.Rows.Close()
+	if r.err == nil {
+		r.err = err
+	}
+	r.d.report(r.query, r.start, r.n, r.err)
+	return err
+}
+
+type tx struct {
+	driver.Tx
+	d *Driver
+}
+
+func (t *tx) Commit() error {
+	start := t.d.now()
+	err := t.Tx.Commit()
+	t.d.report("COMMIT", start, 0, err)
+	return err
+}
+
+func (t *tx) Rollback() error {
+	start := t.d.now()
+	err := t.Tx.Rollback()
+	t.d.report("ROLLBACK", start, 0, err)
+	return err
+}
+
+func rowsAffected(res driver.Result, err error) int64 {
+	if err != nil || res == nil {
+		return 0
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0
+	}
+	return n
+}
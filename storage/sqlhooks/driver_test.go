@@ -0,0 +1,240 @@
+package sqlhooks
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/monitoring"
+)
+
+var errFake = errors.New("fake statement failed")
+
+// fakeDriver's statements return two rows when queried and affect one row when
+// executed. Statements containing "FAIL" fail.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	return fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{query: query}, nil
+}
+
+func (fakeConn) Close() error {
+	return nil
+}
+
+func (fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+type fakeStmt struct {
+	query string
+}
+
+func (fakeStmt) Close() error {
+	return nil
+}
+
+func (fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.query == "FAIL" {
+		return nil, errFake
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.query == "FAIL" {
+		return nil, errFake
+	}
+	return &fakeRows{left: 2}, nil
+}
+
+type fakeRows struct {
+	left int
+}
+
+func (*fakeRows) Columns() []string {
+	return []string{"value"}
+}
+
+func (*fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.left == 0 {
+		return io.EOF
+	}
+	r.left--
+	dest[0] = int64(r.left)
+	return nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error {
+	return nil
+}
+
+func (fakeTx) Rollback() error {
+	return nil
+}
+
+func init() {
+	sql.Register("sqlhooks-fake", fakeDriver{})
+}
+
+// statementRecorder keeps the statements reported to its hook, without their
+// latencies.
+type statementRecorder struct {
+	statements []Statement
+}
+
+func (r *statementRecorder) hook(s Statement) {
+	s.Latency = 0
+	r.statements = append(r.statements, s)
+}
+
+func TestOpenReportsStatements(t *testing.T) {
+	r := &statementRecorder{}
+	db, err := Open("sqlhooks-fake", "", r.hook)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("INSERT INTO Things VALUES(?)", 1); err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	rows, err := db.Query("SELECT value FROM Things")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+	if _, err := db.Exec("FAIL"); err != errFake {
+		t.Fatalf("Exec returned %v, want %v", err, errFake)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	want := []Statement{
+		{Query: "INSERT INTO Things VALUES(?)", Rows: 1},
+		{Query: "SELECT value FROM Things", Rows: 2},
+		{Query: "FAIL", Err: errFake},
+		{Query: "COMMIT"},
+	}
+	if !reflect.DeepEqual(r.statements, want) {
+		t.Errorf("Got statements %+v, want %+v", r.statements, want)
+	}
+}
+
+func TestLatencyIncludesReadingRows(t *testing.T) {
+	var got []time.Duration
+	d := Wrap(fakeDriver{}, func(s Statement) { got = append(got, s.Latency) })
+	now := time.Unix(0, 0)
+	d.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	c, err := d.Open("")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	s, err := c.Prepare("SELECT value FROM Things")
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+	rows, err := s.Query(nil)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	rows.Close()
+	if want := []time.Duration{time.Second}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got latencies %v, want %v", got, want)
+	}
+}
+
+func TestStatementName(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		want  string
+	}{
+		{query: "", want: "UNKNOWN"},
+		{query: "COMMIT", want: "COMMIT"},
+		{query: "select TreeId, KeyId from Trees where TreeType='LOG'", want: "SELECT Trees"},
+		{query: "INSERT INTO Subtree(TreeId, SubtreeId) VALUES(?, ?)", want: "INSERT Subtree"},
+		{query: "UPDATE Unsequenced SET x=1", want: "UPDATE Unsequenced"},
+		{query: "DELETE FROM MapLeaf WHERE TreeId=?", want: "DELETE MapLeaf"},
+		{query: `SELECT x.SubtreeId FROM (SELECT n.SubtreeId
+			FROM Subtree n) AS x`, want: "SELECT Subtree"},
+	} {
+		if got := StatementName(test.query); got != test.want {
+			t.Errorf("StatementName(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestMetricsHook(t *testing.T) {
+	mf := &recordingMetricFactory{}
+	hook := MetricsHook(mf, GenericErrorCode)
+	hook(Statement{Query: "SELECT a FROM T", Latency: 3 * time.Millisecond, Rows: 4})
+	hook(Statement{Query: "SELECT b FROM T", Latency: 5 * time.Millisecond, Rows: 2})
+	hook(Statement{Query: "DELETE FROM T", Err: errFake})
+
+	if got, want := mf.counters["sql_statements"].Value("SELECT T", "ok"), 2.0; got != want {
+		t.Errorf("Got %v successful selects, want %v", got, want)
+	}
+	if got, want := mf.counters["sql_statements"].Value("DELETE T", "error"), 1.0; got != want {
+		t.Errorf("Got %v failed deletes, want %v", got, want)
+	}
+	if count, sum := mf.histograms["sql_statement_latency_ms"].Info("SELECT T"); count != 2 || sum != 8 {
+		t.Errorf("Got select latency count %d and sum %v, want 2 and 8", count, sum)
+	}
+	if count, sum := mf.histograms["sql_statement_rows"].Info("SELECT T"); count != 2 || sum != 6 {
+		t.Errorf("Got select rows count %d and sum %v, want 2 and 6", count, sum)
+	}
+}
+
+// recordingMetricFactory creates inert metrics and keeps them by name.
+type recordingMetricFactory struct {
+	monitoring.InertMetricFactory
+	counters   map[string]monitoring.Counter
+	histograms map[string]monitoring.Histogram
+}
+
+func (f *recordingMetricFactory) NewCounter(name, help string, labelNames ...string) monitoring.Counter {
+	if f.counters == nil {
+		f.counters = make(map[string]monitoring.Counter)
+	}
+	f.counters[name] = f.InertMetricFactory.NewCounter(name, help, labelNames...)
+	return f.counters[name]
+}
+
+func (f *recordingMetricFactory) NewHistogram(name, help string, labelNames ...string) monitoring.Histogram {
+	if f.histograms == nil {
+		f.histograms = make(map[string]monitoring.Histogram)
+	}
+	f.histograms[name] = f.InertMetricFactory.NewHistogram(name, help, labelNames...)
+	return f.histograms[name]
+}
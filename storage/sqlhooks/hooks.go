@@ -0,0 +1,72 @@
+package sqlhooks
+
+import (
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/monitoring"
+)
+
+// ErrorCodeFunc returns a short, low cardinality code for a statement error,
+// such as the database's error number. It's only called with non-nil errors.
+type ErrorCodeFunc func(err error) string
+
+// GenericErrorCode is an ErrorCodeFunc for drivers whose errors have no code.
+func GenericErrorCode(err error) string {
+	return "error"
+}
+
+// MetricsHook returns a Hook which records the number, latency, rows and errors
+// of statements in metrics created by mf. Statements are labelled by their
+// operation and the table they act on, as given by StatementName.
+func MetricsHook(mf monitoring.MetricFactory, errorCode ErrorCodeFunc) Hook {
+	count := mf.NewCounter("sql_statements", "Number of SQL statements run by statement and result", "statement", "result")
+	latency := mf.NewHistogram("sql_statement_latency_ms", "Latency of SQL statements in milliseconds by statement", "statement")
+	rows := mf.NewHistogram("sql_statement_rows", "Number of rows returned or affected by SQL statements by statement", "statement")
+	return func(s Statement) {
+		name := StatementName(s.Query)
+		result := "ok"
+		if s.Err != nil {
+			result = errorCode(s.Err)
+		}
+		count.Inc(name, result)
+		latency.Observe(float64(s.Latency.Nanoseconds())/float64(time.Millisecond), name)
+		rows.Observe(float64(s.Rows), name)
+	}
+}
+
+// SlowQueryHook returns a Hook which logs statements that take at least
+// threshold to run.
+func SlowQueryHook(threshold time.Duration) Hook {
+	return func(s Statement) {
+		if s.Latency >= threshold {
+			glog.Warningf("Slow SQL statement took %v for %d rows (err=%v): %s", s.Latency, s.Rows, s.Err, strings.Join(strings.Fields(s.Query), " "))
+		}
+	}
+}
+
+// StatementName returns a short name for a statement made of its operation and
+// the first table it names, e.g. "SELECT Subtree", so that statements which
+// only differ in their number of placeholders are labelled the same.
+func StatementName(query string) string {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return "UNKNOWN"
+	}
+	op := strings.ToUpper(words[0])
+	if op == "UPDATE" && len(words) > 1 {
+		return op + " " + strings.Trim(words[1], "`")
+	}
+	// The table follows the first of these keywords which isn't followed by
+	// a subquery
+	for i := 1; i < len(words)-1; i++ {
+		switch strings.ToUpper(words[i]) {
+		case "FROM", "INTO", "TABLE":
+			if table := words[i+1]; !strings.HasPrefix(table, "(") {
+				return op + " " + strings.Trim(strings.SplitN(table, "(", 2)[0], "`")
+			}
+		}
+	}
+	return op
+}
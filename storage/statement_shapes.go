@@ -0,0 +1,47 @@
+package storage
+
+// StatementShapes are the numbers of values that SQL statements taking a list
+// of values are prepared for, smallest first. Using a few fixed shapes rather
+// than one per list length keeps the number of prepared statements, and query
+// plans, small. Longer lists use a multiple of the largest shape.
+var StatementShapes = []int{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024}
+
+// ShapeFor returns the number of values to prepare a statement for so that it
+// can take num values.
+func ShapeFor(num int) int {
+	for _, shape := range StatementShapes {
+		if num <= shape {
+			return shape
+		}
+	}
+	largest := StatementShapes[len(StatementShapes)-1]
+	return (num + largest - 1) / largest * largest
+}
+
+// PadInValues pads the values for an IN clause up to the size of their shape
+// by repeating the last value, which doesn't change which rows match.
+func PadInValues(values []interface{}) []interface{} {
+	if len(values) == 0 {
+		return values
+	}
+	padded := make([]interface{}, ShapeFor(len(values)))
+	n := copy(padded, values)
+	for i := n; i < len(padded); i++ {
+		padded[i] = values[n-1]
+	}
+	return padded
+}
+
+// SplitIntoShapes splits num values into batches whose sizes are all shapes,
+// largest first, for statements such as multi-row INSERTs whose values can't be
+// padded.
+func SplitIntoShapes(num int) []int {
+	var sizes []int
+	for i := len(StatementShapes) - 1; i >= 0; i-- {
+		for num >= StatementShapes[i] {
+			sizes = append(sizes, StatementShapes[i])
+			num -= StatementShapes[i]
+		}
+	}
+	return sizes
+}
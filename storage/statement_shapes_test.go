@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShapeFor(t *testing.T) {
+	for _, test := range []struct {
+		num, want int
+	}{
+		{num: 1, want: 1},
+		{num: 3, want: 4},
+		{num: 16, want: 16},
+		{num: 17, want: 32},
+		{num: 1000, want: 1024},
+		{num: 1025, want: 2048},
+		{num: 5000, want: 5120},
+	} {
+		if got := ShapeFor(test.num); got != test.want {
+			t.Errorf("ShapeFor(%d) = %d, want %d", test.num, got, test.want)
+		}
+	}
+}
+
+func TestPadInValues(t *testing.T) {
+	got := PadInValues([]interface{}{1, 2, 3, 4, 5})
+	if want := []interface{}{1, 2, 3, 4, 5, 5, 5, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PadInValues() = %v, want %v", got, want)
+	}
+	if got := PadInValues(nil); len(got) != 0 {
+		t.Errorf("PadInValues(nil) = %v, want no values", got)
+	}
+}
+
+func TestSplitIntoShapes(t *testing.T) {
+	for _, test := range []struct {
+		num  int
+		want []int
+	}{
+		{num: 0, want: nil},
+		{num: 1, want: []int{1}},
+		{num: 37, want: []int{32, 4, 1}},
+		{num: 2050, want: []int{1024, 1024, 2}},
+	} {
+		if got := SplitIntoShapes(test.num); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SplitIntoShapes(%d) = %v, want %v", test.num, got, test.want)
+		}
+	}
+}
@@ -11,12 +11,16 @@ It is generated from these files:
 It has these top-level messages:
 	NodeIDProto
 	SubtreeProto
+	ArchivedLeaf
+	ArchiveSegment
+	RootSignatureProto
 */
 package storage
 
 import proto "github.com/golang/protobuf/proto"
 import fmt "fmt"
 import math "math"
+import trillian "github.com/google/trillian"
 
 // Reference imports to suppress errors if they are not otherwise used.
 var _ = proto.Marshal
@@ -75,32 +79,113 @@ func (m *SubtreeProto) GetInternalNodes() map[string][]byte {
 	return nil
 }
 
+// ArchivedLeaf is a map leaf which has been moved out of hot storage by archiving.
+type ArchivedLeaf struct {
+	KeyHash []byte `protobuf:"bytes,1,opt,name=key_hash,json=keyHash,proto3" json:"key_hash,omitempty"`
+	// leaf_data is the serialized MapLeaf as it was held in storage.
+	LeafData []byte `protobuf:"bytes,2,opt,name=leaf_data,json=leafData,proto3" json:"leaf_data,omitempty"`
+}
+
+func (m *ArchivedLeaf) Reset()                    { *m = ArchivedLeaf{} }
+func (m *ArchivedLeaf) String() string            { return proto.CompactTextString(m) }
+func (*ArchivedLeaf) ProtoMessage()               {}
+func (*ArchivedLeaf) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+// ArchiveSegment holds the leaves and subtrees written at a single map revision
+// which have been moved out of hot storage. Segments are stored compressed in
+// an object store and can be restored if the revision needs to be read again.
+type ArchiveSegment struct {
+	TreeId   int64           `protobuf:"varint,1,opt,name=tree_id,json=treeId" json:"tree_id,omitempty"`
+	Revision int64           `protobuf:"varint,2,opt,name=revision" json:"revision,omitempty"`
+	Leaves   []*ArchivedLeaf `protobuf:"bytes,3,rep,name=leaves" json:"leaves,omitempty"`
+	Subtrees []*SubtreeProto `protobuf:"bytes,4,rep,name=subtrees" json:"subtrees,omitempty"`
+}
+
+func (m *ArchiveSegment) Reset()                    { *m = ArchiveSegment{} }
+func (m *ArchiveSegment) String() string            { return proto.CompactTextString(m) }
+func (*ArchiveSegment) ProtoMessage()               {}
+func (*ArchiveSegment) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *ArchiveSegment) GetLeaves() []*ArchivedLeaf {
+	if m != nil {
+		return m.Leaves
+	}
+	return nil
+}
+
+func (m *ArchiveSegment) GetSubtrees() []*SubtreeProto {
+	if m != nil {
+		return m.Subtrees
+	}
+	return nil
+}
+
+// RootSignatureProto is the serialized form of the signatures of a tree head.
+// Its first fields are those of trillian.DigitallySigned, so heads stored
+// without key signatures read the same as a DigitallySigned.
+type RootSignatureProto struct {
+	SignatureAlgorithm trillian.SignatureAlgorithm `protobuf:"varint,1,opt,name=signature_algorithm,json=signatureAlgorithm,enum=trillian.SignatureAlgorithm" json:"signature_algorithm,omitempty"`
+	HashAlgorithm      trillian.HashAlgorithm      `protobuf:"varint,2,opt,name=hash_algorithm,json=hashAlgorithm,enum=trillian.HashAlgorithm" json:"hash_algorithm,omitempty"`
+	Signature          []byte                      `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+	// The head's signatures by the keys that will replace the tree's key.
+	KeySignatures []*trillian.KeySignature `protobuf:"bytes,4,rep,name=key_signatures,json=keySignatures" json:"key_signatures,omitempty"`
+}
+
+func (m *RootSignatureProto) Reset()                    { *m = RootSignatureProto{} }
+func (m *RootSignatureProto) String() string            { return proto.CompactTextString(m) }
+func (*RootSignatureProto) ProtoMessage()               {}
+func (*RootSignatureProto) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *RootSignatureProto) GetKeySignatures() []*trillian.KeySignature {
+	if m != nil {
+		return m.KeySignatures
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*NodeIDProto)(nil), "storage.NodeIDProto")
 	proto.RegisterType((*SubtreeProto)(nil), "storage.SubtreeProto")
+	proto.RegisterType((*ArchivedLeaf)(nil), "storage.ArchivedLeaf")
+	proto.RegisterType((*ArchiveSegment)(nil), "storage.ArchiveSegment")
+	proto.RegisterType((*RootSignatureProto)(nil), "storage.RootSignatureProto")
 }
 
 func init() { proto.RegisterFile("github.com/google/trillian/storage/storage.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 304 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x94, 0x91, 0xdf, 0x4a, 0xc3, 0x30,
-	0x14, 0xc6, 0xd9, 0x5f, 0xdd, 0xd9, 0xa6, 0x12, 0x44, 0xca, 0xbc, 0x99, 0xbb, 0x90, 0x5e, 0xb5,
-	0xa2, 0x37, 0xce, 0x2b, 0x11, 0x05, 0x0b, 0x43, 0xa5, 0x3e, 0x40, 0x49, 0xdd, 0xb1, 0x0d, 0xc6,
-	0xa4, 0xa4, 0xe9, 0x70, 0xaf, 0xeb, 0x93, 0xd8, 0x26, 0x19, 0x14, 0xf4, 0xc6, 0xab, 0x9c, 0xef,
-	0xcb, 0x39, 0xbf, 0xc3, 0x97, 0xc0, 0x45, 0xc6, 0x74, 0x5e, 0xa5, 0xc1, 0x9b, 0xfc, 0x0c, 0x33,
-	0x29, 0x33, 0x8e, 0xa1, 0x56, 0x8c, 0x73, 0x46, 0x45, 0x58, 0x6a, 0xa9, 0x68, 0x86, 0xbb, 0x33,
-	0x28, 0x94, 0xd4, 0x92, 0xec, 0x39, 0xb9, 0x88, 0x60, 0xfc, 0x24, 0xd7, 0x18, 0xdd, 0xbf, 0x18,
-	0x9f, 0x40, 0xbf, 0xa0, 0x3a, 0xf7, 0x3a, 0xf3, 0x8e, 0x3f, 0x89, 0x4d, 0x4d, 0xce, 0xe1, 0xb0,
-	0x50, 0xf8, 0xce, 0xbe, 0x12, 0x8e, 0x22, 0x49, 0x99, 0x2e, 0xbd, 0x6e, 0x7d, 0x3d, 0x88, 0xa7,
-	0xd6, 0x5e, 0xa1, 0xb8, 0xab, 0xcd, 0xc5, 0x77, 0x17, 0x26, 0xaf, 0x55, 0xaa, 0x15, 0xa2, 0x85,
-	0x9d, 0xc0, 0xd0, 0x76, 0x38, 0x9c, 0x53, 0xe4, 0x18, 0x06, 0x6b, 0x2c, 0xea, 0x2d, 0x16, 0x63,
-	0x05, 0x39, 0x85, 0x91, 0x92, 0x52, 0x27, 0x39, 0x2d, 0x73, 0xaf, 0x67, 0x06, 0xf6, 0x1b, 0xe3,
-	0xb1, 0xd6, 0x64, 0x09, 0x43, 0x8e, 0x74, 0x83, 0xa5, 0xd7, 0x9f, 0xf7, 0xfc, 0xf1, 0xe5, 0x59,
-	0xb0, 0xcb, 0xd3, 0xde, 0x18, 0xac, 0x4c, 0xcf, 0x83, 0xd0, 0x6a, 0x1b, 0xbb, 0x01, 0xf2, 0x0c,
-	0x07, 0x4c, 0x68, 0x54, 0x82, 0xf2, 0x44, 0xd4, 0x51, 0x4b, 0x6f, 0x60, 0x10, 0xfe, 0xdf, 0x88,
-	0xc8, 0xf5, 0x36, 0xaf, 0xe2, 0x48, 0x53, 0xd6, 0xf6, 0x66, 0x4b, 0x18, 0xb7, 0xf6, 0x90, 0x23,
-	0xe8, 0x7d, 0xe0, 0xd6, 0x44, 0x1c, 0xc5, 0x4d, 0xd9, 0xe4, 0xdb, 0x50, 0x5e, 0xa1, 0xc9, 0x37,
-	0x89, 0xad, 0xb8, 0xe9, 0x5e, 0x77, 0x66, 0xb7, 0x40, 0x7e, 0xf3, 0xff, 0x43, 0x48, 0x87, 0xe6,
-	0xff, 0xae, 0x7e, 0x02, 0x00, 0x00, 0xff, 0xff, 0xce, 0x67, 0x36, 0x28, 0xf3, 0x01, 0x00, 0x00,
+	// 523 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x94, 0x93, 0xdd, 0x6e, 0xd3, 0x30,
+	0x14, 0xc7, 0xd5, 0x66, 0xfd, 0x3a, 0xfd, 0x00, 0x19, 0xb6, 0x95, 0x6e, 0x17, 0xa5, 0x17, 0xa8,
+	0x5c, 0xd0, 0xc2, 0xb8, 0x61, 0x48, 0x20, 0x86, 0x06, 0xa2, 0xa2, 0x7c, 0xc8, 0x7d, 0x80, 0xc8,
+	0x5d, 0x4e, 0x13, 0xab, 0x69, 0x5c, 0xd9, 0x6e, 0x45, 0xee, 0x78, 0x1b, 0xde, 0x8b, 0x27, 0x41,
+	0x71, 0x1c, 0x37, 0xd2, 0x26, 0xa4, 0x5d, 0xd5, 0xff, 0xbf, 0xce, 0xf9, 0xc5, 0xe7, 0x7f, 0x5c,
+	0x78, 0x19, 0x72, 0x1d, 0xed, 0x96, 0x93, 0x1b, 0xb1, 0x99, 0x86, 0x42, 0x84, 0x31, 0x4e, 0xb5,
+	0xe4, 0x71, 0xcc, 0x59, 0x32, 0x55, 0x5a, 0x48, 0x16, 0x62, 0xf1, 0x3b, 0xd9, 0x4a, 0xa1, 0x05,
+	0x69, 0x58, 0x39, 0x78, 0xfe, 0x9f, 0xd6, 0xe2, 0x90, 0xf7, 0x8c, 0x66, 0xd0, 0xfe, 0x2e, 0x02,
+	0x9c, 0x5d, 0xff, 0x34, 0x08, 0x02, 0x47, 0x5b, 0xa6, 0xa3, 0x7e, 0x65, 0x58, 0x19, 0x77, 0xa8,
+	0x39, 0x93, 0x67, 0xf0, 0x60, 0x2b, 0x71, 0xc5, 0x7f, 0xf9, 0x31, 0x26, 0xfe, 0x92, 0x6b, 0xd5,
+	0xaf, 0x0e, 0x2b, 0xe3, 0x1a, 0xed, 0xe6, 0xf6, 0x1c, 0x93, 0x8f, 0x5c, 0xab, 0xd1, 0xdf, 0x2a,
+	0x74, 0x16, 0xbb, 0xa5, 0x96, 0x88, 0x39, 0xec, 0x04, 0xea, 0x79, 0x85, 0xc5, 0x59, 0x45, 0x1e,
+	0x43, 0x2d, 0xc0, 0xad, 0x8e, 0x2c, 0x26, 0x17, 0xe4, 0x0c, 0x5a, 0x52, 0x08, 0xed, 0x47, 0x4c,
+	0x45, 0x7d, 0xcf, 0x34, 0x34, 0x33, 0xe3, 0x0b, 0x53, 0x11, 0xb9, 0x84, 0x7a, 0x8c, 0x6c, 0x8f,
+	0xaa, 0x7f, 0x34, 0xf4, 0xc6, 0xed, 0x8b, 0xa7, 0x93, 0x62, 0xf4, 0xf2, 0x17, 0x27, 0x73, 0x53,
+	0xf3, 0x29, 0xd1, 0x32, 0xa5, 0xb6, 0x81, 0xfc, 0x80, 0x1e, 0x4f, 0x34, 0xca, 0x84, 0xc5, 0x7e,
+	0x22, 0x02, 0x54, 0xfd, 0x9a, 0x41, 0x8c, 0xef, 0x46, 0xcc, 0x6c, 0x6d, 0x96, 0x8a, 0x25, 0x75,
+	0x79, 0xd9, 0x1b, 0x5c, 0x42, 0xbb, 0xf4, 0x1d, 0xf2, 0x10, 0xbc, 0x35, 0xa6, 0x66, 0xc4, 0x16,
+	0xcd, 0x8e, 0xd9, 0x7c, 0x7b, 0x16, 0xef, 0xd0, 0xcc, 0xd7, 0xa1, 0xb9, 0x78, 0x5b, 0x7d, 0x53,
+	0x19, 0x7c, 0x00, 0x72, 0x9b, 0x7f, 0x1f, 0xc2, 0xe8, 0x33, 0x74, 0xae, 0xe4, 0x4d, 0xc4, 0xf7,
+	0x18, 0xcc, 0x91, 0xad, 0xc8, 0x13, 0x68, 0xae, 0x31, 0xcd, 0x43, 0xcb, 0x53, 0x6e, 0xac, 0x31,
+	0x35, 0x99, 0x9d, 0x41, 0x2b, 0x46, 0xb6, 0xf2, 0x03, 0xa6, 0x99, 0x05, 0x35, 0x33, 0xe3, 0x9a,
+	0x69, 0x36, 0xfa, 0x53, 0x81, 0x9e, 0x05, 0x2d, 0x30, 0xdc, 0x60, 0xa2, 0xc9, 0x29, 0x34, 0xb2,
+	0x18, 0x7c, 0x1e, 0x18, 0x92, 0x47, 0xeb, 0x99, 0x9c, 0x05, 0x64, 0x00, 0x4d, 0x89, 0x7b, 0xae,
+	0xb8, 0x48, 0x0c, 0xc7, 0xa3, 0x4e, 0x93, 0x17, 0x6e, 0x31, 0x9e, 0x49, 0xf5, 0xd8, 0xa5, 0x5a,
+	0xbe, 0xa6, 0x5b, 0xc6, 0x2b, 0x68, 0xaa, 0x3c, 0xed, 0x62, 0x93, 0xc7, 0x77, 0xae, 0x81, 0xba,
+	0xb2, 0xd1, 0xef, 0x2a, 0x10, 0x2a, 0x84, 0x5e, 0xf0, 0x30, 0x61, 0x7a, 0x27, 0xed, 0xe3, 0xfa,
+	0x06, 0x8f, 0x54, 0xe1, 0xf8, 0x2c, 0x0e, 0x85, 0xe4, 0x3a, 0xda, 0x98, 0x9b, 0xf7, 0x2e, 0xce,
+	0x27, 0xee, 0x99, 0xbb, 0xb6, 0xab, 0xa2, 0x86, 0x12, 0x75, 0xcb, 0x23, 0xef, 0xa1, 0x97, 0x65,
+	0x58, 0x22, 0x55, 0x0d, 0xe9, 0xf4, 0x40, 0xca, 0x42, 0x3d, 0x40, 0xba, 0x51, 0x59, 0x92, 0x73,
+	0x68, 0x39, 0xaa, 0x7d, 0xbd, 0x07, 0x83, 0xbc, 0x83, 0x5e, 0xb6, 0x25, 0x67, 0x14, 0xc3, 0x9f,
+	0x1c, 0xe8, 0x5f, 0x31, 0x75, 0x57, 0xa5, 0xdd, 0x75, 0x49, 0xa9, 0x65, 0xdd, 0xfc, 0x57, 0x5f,
+	0xff, 0x1b, 0x00, 0x70, 0x0a, 0xc0, 0x6d, 0x13, 0x04, 0x00, 0x00,
 }
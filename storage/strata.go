@@ -0,0 +1,43 @@
+package storage
+
+// StrataFunc returns the depth of a tree whose hashes are hashSizeBytes long,
+// and the depths of the strata its subtrees are stored in.
+type StrataFunc func(hashSizeBytes int) (treeDepth int, strataDepths []int)
+
+var defaultLogStrata = []int{8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8}
+
+// LogStrata returns the strata for a log. Log node IDs are positions in the
+// tree rather than hashes, so they're the same whatever the hash size.
+func LogStrata(int) (int, []int) {
+	return 256, defaultLogStrata
+}
+
+const (
+	// mapTopStrata is the number of 8 level strata at the top of a map, where
+	// nearly every node is populated.
+	mapTopStrata = 10
+	// mapStratumDepth is the depth of the strata below the top ones, which
+	// are sparse.
+	mapStratumDepth = 176
+)
+
+// MapStrata returns the depth of a map whose key hashes are hashSizeBytes long,
+// and the strata it's stored in. SHA-256 maps get mapTopStrata strata of 8 levels and one of
+// mapStratumDepth levels, deeper maps get more strata of up to
+// mapStratumDepth levels beneath those.
+func MapStrata(hashSizeBytes int) (int, []int) {
+	depth := hashSizeBytes * 8
+	var strata []int
+	for left := depth; left > 0; {
+		d := mapStratumDepth
+		if len(strata) < mapTopStrata {
+			d = 8
+		}
+		if d > left {
+			d = left
+		}
+		strata = append(strata, d)
+		left -= d
+	}
+	return depth, strata
+}
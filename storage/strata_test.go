@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapStrata(t *testing.T) {
+	for _, test := range []struct {
+		hashSizeBytes int
+		want          []int
+	}{
+		{hashSizeBytes: 32, want: []int{8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 176}},
+		{hashSizeBytes: 48, want: []int{8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 176, 128}},
+		{hashSizeBytes: 64, want: []int{8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 176, 176, 80}},
+	} {
+		depth, strata := MapStrata(test.hashSizeBytes)
+		if got, want := depth, test.hashSizeBytes*8; got != want {
+			t.Errorf("MapStrata(%d) gave depth %d, want %d", test.hashSizeBytes, got, want)
+		}
+		if !reflect.DeepEqual(strata, test.want) {
+			t.Errorf("MapStrata(%d) gave strata %v, want %v", test.hashSizeBytes, strata, test.want)
+		}
+	}
+}
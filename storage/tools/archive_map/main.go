@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	log "github.com/golang/glog"
+	"github.com/google/trillian/storage/archive"
+	"github.com/google/trillian/storage/tools"
+	"github.com/google/trillian/util"
+)
+
+var archiveDirFlag = flag.String("archive_dir", "", "Directory holding the archive segments for the map")
+var restoreFlag = flag.Int64("restore", -1, "If set, the pruned map revision to restore from archive, otherwise pruned revisions are archived")
+var ttlFlag = flag.Duration("ttl", time.Hour*24, "How long a restored revision remains readable before it can be archived again")
+
+func validateFlagsOrDie() {
+	if len(*archiveDirFlag) == 0 {
+		panic("An archive directory must be given")
+	}
+
+	if *ttlFlag <= 0 {
+		panic("Invalid value for ttl")
+	}
+}
+
+// Archives the pruned revisions of the map given by the treeid flag, or restores
+// one of them so it can be read again until the ttl expires. If anything fails it
+// panics.
+func main() {
+	flag.Parse()
+	validateFlagsOrDie()
+
+	mapStorage, err := tools.GetMapStorageFromFlags()
+
+	if err != nil {
+		panic(err)
+	}
+
+	store, err := archive.NewDirectoryObjectStore(*archiveDirFlag)
+
+	if err != nil {
+		panic(err)
+	}
+
+	archiver := archive.NewArchiver(store, util.SystemTimeSource{})
+
+	if *restoreFlag >= 0 {
+		if err := archiver.Restore(mapStorage, *restoreFlag, *ttlFlag); err != nil {
+			panic(err)
+		}
+
+		log.Infof("Restored map revision %d for %s", *restoreFlag, *ttlFlag)
+		return
+	}
+
+	if _, err := archiver.ExpireRestores(mapStorage); err != nil {
+		panic(err)
+	}
+
+	count, err := archiver.ArchiveMap(mapStorage)
+
+	if err != nil {
+		panic(err)
+	}
+
+	log.Infof("Archived %d map revisions", count)
+}
@@ -50,6 +50,34 @@ func GetStorageFromFlags(treeID trillian.LogID) (storage.LogStorage, error) {
 	return nil, fmt.Errorf("Unknown storage type: %s", *storageTypeFlag)
 }
 
+// GetMapStorageFromFlags returns a configured map storage instance for the tree
+// specified by the treeid flag, this can fail with an error
+func GetMapStorageFromFlags() (storage.MapStorage, error) {
+	switch {
+	case *storageTypeFlag == "mysql":
+		// TODO: As for logs, the map id isn't needed here, only the tree id.
+		return mysql.NewMapStorage(trillian.MapID{MapID: []byte("This needs fixing"), TreeID: *treeIDFlag}, *mysqlURIFlag)
+	}
+
+	return nil, fmt.Errorf("Unknown storage type: %s", *storageTypeFlag)
+}
+
+// GetTreeAdminStorageFromFlags returns storage for creating and configuring
+// trees, this can fail with an error
+func GetTreeAdminStorageFromFlags() (*mysql.TreeAdminStorage, error) {
+	switch {
+	case *storageTypeFlag == "mysql":
+		return mysql.NewTreeAdminStorage(*mysqlURIFlag, mysql.Options{})
+	}
+
+	return nil, fmt.Errorf("Unknown storage type: %s", *storageTypeFlag)
+}
+
+// GetTreeIDFromFlags returns the tree ID given by the treeid flag.
+func GetTreeIDFromFlags() int64 {
+	return *treeIDFlag
+}
+
 // GetStorageFromFlagsOrDie returns a configured storage instance, errors are fatal and if it
 // returns the storage can be used.
 func GetStorageFromFlagsOrDie(treeID trillian.LogID) storage.LogStorage {
@@ -0,0 +1,352 @@
+// The inspect_tree command shows how one leaf of a log or map is held in
+// storage, to help find out why a tree's root doesn't match what was expected.
+// For the leaf given by the leaf_index or key flags it shows the leaf, the
+// nodes on its path to the root as stored next to the hashes recomputed from
+// their children, and the subtrees the path passes through. Usage:
+//
+//	inspect_tree --treeid=<id> --leaf_index=<index> log
+//	inspect_tree --treeid=<id> --key=<key> map
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	log "github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/tools"
+)
+
+// logPathBits is the length of log node IDs, as used by the log server.
+const logPathBits = 64
+
+var leafIndexFlag = flag.Int64("leaf_index", 0, "Index of the log leaf to inspect")
+var treeSizeFlag = flag.Int64("tree_size", 0, "Size of the log to inspect the leaf in, zero for the latest root")
+var keyFlag = flag.String("key", "", "Map key to inspect")
+var keyHashFlag = flag.String("key_hash", "", "Hex encoded hash of the map key to inspect, instead of key")
+var revisionFlag = flag.Int64("revision", -1, "Map revision to inspect, -1 for the latest")
+var allLevelsFlag = flag.Bool("all_levels", false, "If true show every level of a map path, rather than skipping levels with empty siblings that match")
+var dumpSubtreesFlag = flag.Bool("dump_subtrees", false, "If true show every leaf of the stored subtrees on the path")
+
+// pathRow describes one level of the path from a leaf to the root.
+type pathRow struct {
+	level   int
+	nodeID  storage.NodeID
+	sibling trillian.Hash
+	// recomputed is nil if it couldn't be worked out from the levels below
+	recomputed trillian.Hash
+	// stored is nil if no node is stored
+	stored trillian.Hash
+	// expected is what stored should be if it's nil, if anything
+	expected trillian.Hash
+}
+
+// printPath writes the rows side by side, flagging any level where the
+// recomputed hash differs from the stored one.
+func printPath(rows []pathRow) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "LEVEL\tNODE\tSIBLING\tRECOMPUTED\tSTORED\t")
+	for _, r := range rows {
+		stored, want := hex.EncodeToString(r.stored), r.stored
+		if r.stored == nil {
+			stored, want = "(none)", r.expected
+		}
+		status := ""
+		if r.recomputed != nil && want != nil && !bytes.Equal(r.recomputed, want) {
+			status = "MISMATCH"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%x\t%x\t%s\t%s\n", r.level, nodeName(r.nodeID), r.sibling, r.recomputed, stored, status)
+	}
+	return w.Flush()
+}
+
+// nodeName abbreviates the bits of a node ID, which can be very long for maps.
+func nodeName(id storage.NodeID) string {
+	s := id.String()
+	if len(s) > 24 {
+		s = fmt.Sprintf("%s...(%d bits)", s[:16], len(s))
+	}
+	if len(s) == 0 {
+		return "(root)"
+	}
+	return s
+}
+
+// nodeAt returns the node at prefixLenBits on the path to id.
+func nodeAt(id storage.NodeID, prefixLenBits int) storage.NodeID {
+	n := storage.NodeID{Path: make([]byte, len(id.Path)), PathLenBits: id.PathLenBits, PrefixLenBits: prefixLenBits}
+	copy(n.Path, id.Path)
+	return n
+}
+
+// getNodes reads nodes and returns them keyed by the string form of their IDs.
+func getNodes(tx storage.NodeReader, revision int64, ids []storage.NodeID) (map[string]trillian.Hash, error) {
+	nodes, err := tx.GetMerkleNodes(revision, ids)
+	if err != nil {
+		return nil, err
+	}
+	r := make(map[string]trillian.Hash)
+	for _, n := range nodes {
+		r[n.NodeID.String()] = n.Hash
+	}
+	return r, nil
+}
+
+// printSubtrees shows the stored subtrees with prefixes on the path to id, if
+// the storage can return them.
+func printSubtrees(tx interface{}, revision int64, id storage.NodeID) error {
+	inspector, ok := tx.(storage.SubtreeInspector)
+	if !ok {
+		fmt.Println("Storage can't return stored subtrees")
+		return nil
+	}
+	fmt.Println("Stored subtrees on the path:")
+	for prefixLen := 0; prefixLen < id.PathLenBits; prefixLen += 8 {
+		subtree, err := inspector.GetStoredSubtree(revision, nodeAt(id, prefixLen))
+		if err != nil {
+			return err
+		}
+		if subtree == nil {
+			continue
+		}
+		fmt.Printf("  prefix %x: depth %d, root hash %x, %d leaves\n", subtree.Prefix, subtree.Depth, subtree.RootHash, len(subtree.Leaves))
+		if *dumpSubtreesFlag {
+			suffixes := make([]string, 0, len(subtree.Leaves))
+			for s := range subtree.Leaves {
+				suffixes = append(suffixes, s)
+			}
+			sort.Strings(suffixes)
+			for _, s := range suffixes {
+				fmt.Printf("    %x: %x\n", s, subtree.Leaves[s])
+			}
+		}
+	}
+	return nil
+}
+
+func inspectLog() error {
+	ls, err := tools.GetStorageFromFlags(trillian.LogID{TreeID: tools.GetTreeIDFromFlags()})
+	if err != nil {
+		return err
+	}
+	th, err := merkle.NewTreeHasherForStrategy(ls.HashStrategy(), ls.HashAlgorithm(), ls.HashPrefixes())
+	if err != nil {
+		return err
+	}
+	tx, err := ls.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	root, err := tx.LatestSignedLogRoot()
+	if err != nil {
+		return err
+	}
+	treeSize, index := *treeSizeFlag, *leafIndexFlag
+	if treeSize == 0 {
+		treeSize = root.TreeSize
+	}
+	if index < 0 || index >= treeSize {
+		return fmt.Errorf("leaf %d is not in a tree of size %d", index, treeSize)
+	}
+	revision, err := tx.GetTreeRevisionAtSize(treeSize)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Log %d at tree size %d, revision %d\n", tools.GetTreeIDFromFlags(), treeSize, revision)
+
+	leaves, err := tx.GetLeavesByIndex([]int64{index})
+	if err != nil {
+		return err
+	}
+	if len(leaves) != 1 {
+		return fmt.Errorf("leaf %d is not stored", index)
+	}
+	leafHash := leaves[0].LeafHash
+	// Leaf hashes may be given by the client, so they needn't be hashes of the data
+	fmt.Printf("Leaf %d: stored hash %x, hash of data %x\n", index, leafHash, th.HashLeaf(leaves[0].LeafValue))
+
+	proofIDs, err := merkle.CalcInclusionProofNodeAddresses(treeSize, index, logPathBits)
+	if err != nil {
+		return err
+	}
+	// The ancestors of the leaf are only stored where they are the roots of
+	// complete subtrees
+	var ancestorIDs []storage.NodeID
+	for level := uint(1); (index>>level+1)<<level <= treeSize && int(level) <= len(proofIDs); level++ {
+		id, err := storage.NewNodeIDForTreeCoords(int64(level), index>>level, logPathBits)
+		if err != nil {
+			return err
+		}
+		ancestorIDs = append(ancestorIDs, id)
+	}
+	leafID, err := storage.NewNodeIDForTreeCoords(0, index, logPathBits)
+	if err != nil {
+		return err
+	}
+	nodes, err := getNodes(tx, revision, append(append(proofIDs, ancestorIDs...), leafID))
+	if err != nil {
+		return err
+	}
+
+	proof := make([]trillian.Hash, len(proofIDs))
+	for i, id := range proofIDs {
+		proof[i] = nodes[id.String()]
+	}
+	rows := []pathRow{{nodeID: leafID, recomputed: leafHash, stored: nodes[leafID.String()]}}
+	running := leafHash
+	for i, id := range ancestorIDs {
+		if index>>uint(i)&1 == 0 {
+			running = th.HashChildren(running, proof[i])
+		} else {
+			running = th.HashChildren(proof[i], running)
+		}
+		rows = append(rows, pathRow{level: i + 1, nodeID: id, sibling: proof[i], recomputed: running, stored: nodes[id.String()]})
+	}
+	// Above the complete subtrees only the siblings in the proof are stored
+	for i := len(ancestorIDs); i < len(proofIDs); i++ {
+		rows = append(rows, pathRow{level: i + 1, nodeID: proofIDs[i], sibling: proof[i]})
+	}
+	if err := printPath(rows); err != nil {
+		return err
+	}
+
+	// Recompute the root from the proof, comparing it with the signed root if
+	// there is one for this size
+	var want trillian.Hash
+	if treeSize == root.TreeSize {
+		want = root.RootHash
+	}
+	var got trillian.Hash
+	switch err := merkle.NewLogVerifier(th).VerifyInclusionProof(index, treeSize, proof, want, leafHash).(type) {
+	case nil:
+		got = want
+	case merkle.RootHashMismatchError:
+		got = err.ActualHash
+	default:
+		return err
+	}
+	if want == nil {
+		fmt.Printf("Recomputed root %x, there is no signed root for this size to compare with\n", got)
+	} else {
+		fmt.Printf("Recomputed root %x, signed root %x, match %v\n", got, want, bytes.Equal(got, want))
+	}
+
+	return printSubtrees(tx, revision, leafID)
+}
+
+func inspectMap() error {
+	ms, err := tools.GetMapStorageFromFlags()
+	if err != nil {
+		return err
+	}
+	th, err := merkle.NewTreeHasherForStrategy(ms.HashStrategy(), ms.HashAlgorithm(), ms.HashPrefixes())
+	if err != nil {
+		return err
+	}
+	h := merkle.NewMapHasher(th)
+	tx, err := ms.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	root, err := tx.LatestSignedMapRoot()
+	if err != nil {
+		return err
+	}
+	revision := *revisionFlag
+	if revision < 0 {
+		revision = root.MapRevision
+	}
+
+	keyHash := h.HashKey([]byte(*keyFlag))
+	if len(*keyHashFlag) > 0 {
+		if keyHash, err = hex.DecodeString(*keyHashFlag); err != nil {
+			return fmt.Errorf("invalid key_hash: %v", err)
+		}
+	}
+	fmt.Printf("Map %d at revision %d, key hash %x\n", tools.GetTreeIDFromFlags(), revision, keyHash)
+
+	leaves, err := tx.Get(revision, []trillian.Hash{keyHash})
+	if err != nil {
+		return err
+	}
+	empty := h.EmptyHashes()
+	leafHash := empty[0]
+	if len(leaves) == 0 {
+		fmt.Println("Key is not in the map")
+	} else {
+		leafHash = leaves[0].LeafHash
+		fmt.Printf("Leaf: value %x, stored hash %x, hash of value %x\n", leaves[0].LeafValue, leafHash, h.HashLeaf(leaves[0].LeafValue))
+	}
+
+	keyID := storage.NewNodeIDFromHash(keyHash)
+	hBits := keyID.PathLenBits
+	siblingIDs := keyID.Siblings()
+	ids := append([]storage.NodeID{}, siblingIDs...)
+	for prefixLen := hBits; prefixLen >= 0; prefixLen-- {
+		ids = append(ids, nodeAt(keyID, prefixLen))
+	}
+	nodes, err := getNodes(tx, revision, ids)
+	if err != nil {
+		return err
+	}
+
+	// Missing nodes are the roots of empty subtrees
+	rows := []pathRow{{nodeID: keyID, recomputed: leafHash, stored: nodes[keyID.String()], expected: empty[0]}}
+	running := leafHash
+	for bit, sibID := range siblingIDs {
+		sibling, ok := nodes[sibID.String()]
+		if !ok {
+			sibling = empty[bit]
+		}
+		if keyID.Bit(bit) == 0 {
+			running = h.HashChildren(running, sibling)
+		} else {
+			running = h.HashChildren(sibling, running)
+		}
+		id := nodeAt(keyID, hBits-bit-1)
+		row := pathRow{level: bit + 1, nodeID: id, sibling: sibling, recomputed: running, stored: nodes[id.String()], expected: empty[bit+1]}
+		want := row.stored
+		if want == nil {
+			want = row.expected
+		}
+		if !*allLevelsFlag && !ok && bytes.Equal(want, running) {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if err := printPath(rows); err != nil {
+		return err
+	}
+
+	if revision == root.MapRevision {
+		fmt.Printf("Recomputed root %x, signed root %x, match %v\n", running, root.RootHash, bytes.Equal(running, root.RootHash))
+	}
+	return printSubtrees(tx, revision, keyID)
+}
+
+func main() {
+	flag.Parse()
+	var err error
+	switch flag.Arg(0) {
+	case "log":
+		err = inspectLog()
+	case "map":
+		err = inspectMap()
+	default:
+		log.Exitf("Usage: inspect_tree [flags] log|map")
+	}
+	if err != nil {
+		log.Exitf("Failed to inspect tree: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+
+	_ "github.com/go-sql-driver/mysql"
+	log "github.com/golang/glog"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/tools"
+)
+
+var setFlag = flag.Bool("set", false, "If true sets the retention policy from the flags, otherwise the current policy is shown")
+var maxRevisionsFlag = flag.Int64("max_revisions", 0, "Number of most recent map revisions to retain, zero for no limit")
+var maxAgeFlag = flag.Duration("max_age", 0, "How long to retain map revisions for, zero for no limit")
+
+func validateFlagsOrDie() {
+	if *maxRevisionsFlag < 0 {
+		panic("Invalid value for max_revisions")
+	}
+
+	if *maxAgeFlag < 0 {
+		panic("Invalid value for max_age")
+	}
+}
+
+// Shows or sets the retention policy of the map given by the treeid flag. If
+// anything fails it panics, leaving storage untouched.
+func main() {
+	flag.Parse()
+	validateFlagsOrDie()
+
+	mapStorage, err := tools.GetMapStorageFromFlags()
+
+	if err != nil {
+		panic(err)
+	}
+
+	tx, err := mapStorage.Begin()
+
+	if err != nil {
+		panic(err)
+	}
+
+	if *setFlag {
+		if err := tx.SetRetentionPolicy(storage.RetentionPolicy{MaxRevisions: *maxRevisionsFlag, MaxAge: *maxAgeFlag}); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}
+
+	policy, err := tx.GetRetentionPolicy()
+
+	if err != nil {
+		tx.Rollback()
+		panic(err)
+	}
+
+	oldest, err := tx.OldestRetainedRevision()
+
+	if err != nil {
+		tx.Rollback()
+		panic(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		panic(err)
+	}
+
+	log.Infof("Retention policy: max revisions %d, max age %v. Oldest retained revision: %d", policy.MaxRevisions, policy.MaxAge, oldest)
+}
@@ -1,13 +1,13 @@
 package main
 
 import (
-	"crypto/sha256"
 	"flag"
 	"fmt"
 
 	_ "github.com/go-sql-driver/mysql"
 	log "github.com/golang/glog"
 	"github.com/google/trillian"
+	"github.com/google/trillian/merkle"
 	"github.com/google/trillian/storage/tools"
 )
 
@@ -44,6 +44,8 @@ func main() {
 		panic(err)
 	}
 
+	// Storage hashes the leaves itself, as they would be by an RFC6962 tree
+	hasher := merkle.NewRFC6962TreeHasher(trillian.NewSHA256())
 	leaves := []trillian.LogLeaf{}
 
 	for l := 0; l < *numInsertionsFlag; l++ {
@@ -51,13 +53,13 @@ func main() {
 		leafNumber := *startInsertFromFlag + l
 
 		data := []byte(fmt.Sprintf("Leaf %d", leafNumber))
-		hash := sha256.Sum256(data)
+		hash := hasher.HashLeaf(data)
 
 		log.Infof("Preparing leaf %d\n", leafNumber)
 
 		leaf := trillian.LogLeaf{
 			Leaf: trillian.Leaf{
-				LeafHash:  trillian.Hash(hash[:]),
+				LeafHash:  hash,
 				LeafValue: data,
 				ExtraData: nil,
 			},
@@ -65,7 +67,7 @@ func main() {
 		leaves = append(leaves, leaf)
 
 		if len(leaves) >= *queueBatchSizeFlag {
-			err = tx.QueueLeaves(leaves)
+			_, err = tx.QueueLeaves(leaves)
 			leaves = leaves[:0] // starting new batch
 
 			if err != nil {
@@ -76,7 +78,7 @@ func main() {
 
 	// There might be some leaves left over that didn't get queued yet
 	if len(leaves) > 0 {
-		err = tx.QueueLeaves(leaves)
+		_, err = tx.QueueLeaves(leaves)
 
 		if err != nil {
 			panic(err)
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	log "github.com/golang/glog"
+	"github.com/google/trillian/storage/tools"
+)
+
+var revisionFlag = flag.Int64("revision", -1, "The map revision to revert the serving head to")
+var reasonFlag = flag.String("reason", "", "Why the map is being reverted, this is recorded for audit")
+var listFlag = flag.Bool("list", false, "If true lists previous reverts of the map instead of reverting it")
+
+func validateFlagsOrDie() {
+	if *listFlag {
+		return
+	}
+
+	if *revisionFlag < 0 {
+		panic("Invalid value for revision")
+	}
+
+	if len(*reasonFlag) == 0 {
+		panic("A reason must be given when reverting a map")
+	}
+}
+
+// Reverts the serving head of the map given by the treeid flag to an earlier
+// revision. Later revisions are retained as abandoned, not deleted. If anything
+// fails it panics, leaving storage untouched.
+func main() {
+	flag.Parse()
+	validateFlagsOrDie()
+
+	storage, err := tools.GetMapStorageFromFlags()
+
+	if err != nil {
+		panic(err)
+	}
+
+	tx, err := storage.Begin()
+
+	if err != nil {
+		panic(err)
+	}
+
+	if *listFlag {
+		reverts, err := tx.MapHeadReverts()
+
+		if err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+
+		for _, revert := range reverts {
+			log.Infof("%s: reverted from revision %d to %d: %s",
+				time.Unix(0, revert.TimestampNanos).UTC(), revert.FromRevision, revert.ToRevision, revert.Reason)
+			for tag, revision := range revert.AbandonedTags {
+				log.Infof("  removed tag %q on revision %d", tag, revision)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			panic(err)
+		}
+
+		return
+	}
+
+	revert, err := tx.RevertMapHead(*revisionFlag, *reasonFlag, time.Now().UnixNano())
+
+	if err != nil {
+		tx.Rollback()
+		panic(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		panic(err)
+	}
+
+	log.Infof("Reverted map from revision %d to %d", revert.FromRevision, revert.ToRevision)
+	for tag, revision := range revert.AbandonedTags {
+		log.Infof("Removed tag %q on abandoned revision %d", tag, revision)
+	}
+}
@@ -0,0 +1,176 @@
+// The strata_advisor command recommends strata for the map given by the treeid
+// flag. It reads the keys written in each retained revision of the map to find
+// how they're spread through the tree and how many are written per revision,
+// then projects the subtree reads and writes, storage and latency of a range of
+// strata for the workload given by the flags. For an empty or growing map the
+// keys flag projects a map of that size instead.
+//
+// The current strata are the map's own, or the MySQL storage's defaults if it
+// has none. Strata are chosen when a map is created, e.g. with trilctl's
+// map_strata flag, so a recommendation applies to new maps with similar keys
+// and workload.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	log "github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/cache"
+	"github.com/google/trillian/storage/tools"
+)
+
+var keysFlag = flag.Int64("keys", 0, "Number of keys to project for, zero to use the keys in the map")
+var lookupsPerWriteFlag = flag.Float64("lookups_per_write", 10, "Number of keys looked up for each key set")
+var writeBatchFlag = flag.Float64("write_batch", 0, "Mean number of keys set per revision, zero to use the map's")
+var topFlag = flag.Int("top", 5, "Number of the best strata to report")
+var subtreeReadFlag = flag.Duration("subtree_read", cache.DefaultCostModel.SubtreeRead, "Cost of reading a subtree row")
+var subtreeWriteFlag = flag.Duration("subtree_write", cache.DefaultCostModel.SubtreeWrite, "Cost of writing a subtree row")
+var kbReadFlag = flag.Duration("kb_read", cache.DefaultCostModel.KBRead, "Cost of reading each KB of subtree data")
+var kbWrittenFlag = flag.Duration("kb_written", cache.DefaultCostModel.KBWritten, "Cost of writing each KB of subtree data")
+var hashFlag = flag.Duration("hash", cache.DefaultCostModel.Hash, "Cost of a hash")
+
+// mapKeys returns the key hashes written to the map in its retained revisions,
+// the number of revisions that wrote any and the map's hash size.
+func mapKeys() ([]trillian.Hash, int, int, error) {
+	ms, err := tools.GetMapStorageFromFlags()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	hasher, err := trillian.NewHasher(ms.HashAlgorithm())
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	tx, err := ms.Begin()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	// Nothing is written so the transaction is always rolled back
+	defer tx.Rollback()
+
+	root, err := tx.LatestSignedMapRoot()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	oldest, err := tx.OldestRetainedRevision()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if oldest < 1 {
+		oldest = 1
+	}
+
+	var keys []trillian.Hash
+	revisions := 0
+	for rev := oldest; rev <= root.MapRevision; rev++ {
+		leaves, err := tx.GetChangedLeaves(rev)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("revision %d: %v", rev, err)
+		}
+		if len(leaves) > 0 {
+			revisions++
+		}
+		for _, leaf := range leaves {
+			keys = append(keys, leaf.KeyHash)
+		}
+	}
+	return keys, revisions, hasher.Size(), nil
+}
+
+// currentStrata returns the strata of the map, which are the storage's defaults
+// for its hash size if it wasn't created with its own.
+func currentStrata(hashSize int) ([]int, error) {
+	admin, err := tools.GetTreeAdminStorageFromFlags()
+	if err != nil {
+		return nil, err
+	}
+	tree, err := admin.GetTree(tools.GetTreeIDFromFlags())
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, err
+	case len(tree.MapStrata) > 0:
+		return tree.MapStrata, nil
+	}
+	_, strata := storage.MapStrata(hashSize)
+	return strata, nil
+}
+
+func round(d time.Duration) time.Duration {
+	return d - d%time.Microsecond
+}
+
+func printEstimate(w *tabwriter.Writer, name string, e cache.StrataEstimate) {
+	fmt.Fprintf(w, "%s\t%s\t%.1f\t%.1f\t%v\t%.1f\t%.1f\t%v\t%.0f\t%v\n", name, cache.FormatStrata(e.Strata),
+		e.SubtreesPerLookup, e.KBPerLookup, round(e.LookupLatency),
+		e.SubtreesPerRevision, e.KBPerRevision, round(e.RevisionLatency),
+		e.StoredKB, round(e.Cost))
+}
+
+func main() {
+	flag.Parse()
+
+	keys, revisions, hashSize, err := mapKeys()
+	if err != nil {
+		log.Exitf("Failed to read map keys: %v", err)
+	}
+
+	var profile cache.KeyProfile
+	switch {
+	case *keysFlag > 0:
+		profile = cache.UniformKeyProfile(hashSize*8, *keysFlag)
+	case len(keys) > 0:
+		if profile, err = cache.KeyProfileFromHashes(keys); err != nil {
+			log.Exitf("Failed to profile keys: %v", err)
+		}
+	default:
+		log.Exit("The map has no keys, use the keys flag to project for a number of keys")
+	}
+
+	writeBatch := *writeBatchFlag
+	if writeBatch <= 0 {
+		if revisions == 0 {
+			log.Exit("The map has no writes, use the write_batch flag to set the keys written per revision")
+		}
+		writeBatch = float64(len(keys)) / float64(revisions)
+	}
+
+	// The workload is for a period in which every key is written once
+	workload := cache.Workload{Lookups: profile.Keys() * *lookupsPerWriteFlag, Writes: profile.Keys(), WriteBatch: writeBatch}
+	model := cache.CostModel{
+		SubtreeRead:  *subtreeReadFlag,
+		SubtreeWrite: *subtreeWriteFlag,
+		KBRead:       *kbReadFlag,
+		KBWritten:    *kbWrittenFlag,
+		Hash:         *hashFlag,
+	}
+	current, err := currentStrata(hashSize)
+	if err != nil {
+		log.Exitf("Failed to read the map's strata: %v", err)
+	}
+	currentEstimate, err := cache.EstimateStrata(profile, workload, model, current)
+	if err != nil {
+		log.Exitf("Failed to estimate current strata: %v", err)
+	}
+	estimates, err := cache.AdviseStrata(profile, workload, model)
+	if err != nil {
+		log.Exitf("Failed to estimate strata: %v", err)
+	}
+
+	fmt.Printf("Map %d: %.0f keys, %.1f keys written per revision, %.1f lookups per key written\n", tools.GetTreeIDFromFlags(), profile.Keys(), writeBatch, *lookupsPerWriteFlag)
+	fmt.Printf("Recommended strata: %s\n\n", cache.FormatStrata(estimates[0].Strata))
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "\tSTRATA\tSUBTREES/LOOKUP\tKB/LOOKUP\tLOOKUP\tSUBTREES/REV\tKB/REV\tREVISION\tSTORED KB\tTOTAL")
+	printEstimate(w, "current", currentEstimate)
+	for i := 0; i < *topFlag && i < len(estimates); i++ {
+		printEstimate(w, fmt.Sprintf("#%d", i+1), estimates[i])
+	}
+	w.Flush()
+}
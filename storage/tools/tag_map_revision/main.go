@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	log "github.com/golang/glog"
+	"github.com/google/trillian/storage/tools"
+)
+
+var tagFlag = flag.String("tag", "", "The tag to attach to the map revision")
+var revisionFlag = flag.Int64("revision", -1, "The map revision to tag")
+var listFlag = flag.Bool("list", false, "If true lists the existing tags for the map instead of adding one")
+
+func validateFlagsOrDie() {
+	if *listFlag {
+		return
+	}
+
+	if len(*tagFlag) == 0 {
+		panic("Invalid value for tag")
+	}
+
+	if *revisionFlag < 0 {
+		panic("Invalid value for revision")
+	}
+}
+
+// Attaches a tag to a revision of the map given by the treeid flag, so it can be
+// referred to by name in read requests. If anything fails it panics, leaving
+// storage untouched.
+func main() {
+	flag.Parse()
+	validateFlagsOrDie()
+
+	storage, err := tools.GetMapStorageFromFlags()
+
+	if err != nil {
+		panic(err)
+	}
+
+	tx, err := storage.Begin()
+
+	if err != nil {
+		panic(err)
+	}
+
+	if *listFlag {
+		tags, err := tx.GetRevisionTags()
+
+		if err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+
+		for tag, revision := range tags {
+			log.Infof("%s: revision %d", tag, revision)
+		}
+
+		if err := tx.Commit(); err != nil {
+			panic(err)
+		}
+
+		return
+	}
+
+	if err := tx.TagMapRevision(*tagFlag, *revisionFlag, time.Now().UnixNano()); err != nil {
+		tx.Rollback()
+		panic(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		panic(err)
+	}
+
+	log.Infof("Tagged map revision %d as %s", *revisionFlag, *tagFlag)
+}
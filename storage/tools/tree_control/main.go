@@ -0,0 +1,201 @@
+// The tree_control command shows the size and status of trees, and changes
+// the settings of trees that the TrillianAdmin service doesn't manage, working
+// on storage directly. Trees are created and configured through the service
+// with trilctl. Usage:
+//
+//	tree_control [flags] <command>
+//
+// where command is one of stats, status, set-guard, set-max-root-duration,
+// set-compression or purge. Commands act on the tree given by the treeid flag,
+// other than stats.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	log "github.com/golang/glog"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/mysql"
+	"github.com/google/trillian/storage/tools"
+)
+
+var guardFlag = flag.Duration("guard", 0, "How long leaves must have been queued before they're sequenced, for set-guard. Rounded down to seconds")
+var maxRootDurationFlag = flag.Duration("max_root_duration", 0, "How old a tree's root can get before it's re-signed, for set-max-root-duration. Zero uses the signer's default for logs and the map server's max_root_age for maps")
+var compressionFlag = flag.String("compression", "none", "How leaf data written to the tree is compressed, for set-compression: none or snappy")
+var forceFlag = flag.Bool("force", false, "Must be set for purge, which removes the tree and all of its data at once")
+
+// commands maps each command name to the function that runs it.
+var commands = map[string]func(*mysql.TreeAdminStorage, int64) error{
+	"stats":                 showStats,
+	"status":                showStatus,
+	"set-guard":             setGuard,
+	"set-max-root-duration": setMaxRootDuration,
+	"set-compression":       setCompression,
+	"purge":                 purgeTree,
+}
+
+// showStats reports the size of every tree. It reads all of the data in the
+// database, so shouldn't be run often against a busy one.
+func showStats(s *mysql.TreeAdminStorage, _ int64) error {
+	trees, err := s.ListTrees()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "TREE ID\tTYPE\tLEAVES\tLEAF VERSIONS\tUNSEQUENCED\tREVISIONS\tSUBTREES\tBYTES\tOLDEST ROOT\tNEWEST ROOT\t")
+	var totalBytes int64
+	for _, tree := range trees {
+		stats, err := s.GetTreeStats(tree.TreeID)
+		if err != nil {
+			return fmt.Errorf("failed to read stats for tree %d: %v", tree.TreeID, err)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t\n", stats.TreeID, stats.TreeType, stats.Leaves, stats.LeafVersions, stats.Unsequenced,
+			stats.Revisions, stats.Subtrees, stats.TotalBytes(), formatRoot(stats.OldestRoot), formatRoot(stats.NewestRoot))
+		totalBytes += stats.TotalBytes()
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d trees holding %d bytes, not counting indexes\n", len(trees), totalBytes)
+	return nil
+}
+
+// formatRoot describes a root by its revision and when it was created.
+func formatRoot(root *mysql.RootStats) string {
+	if root == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d at %s", root.Revision, time.Unix(0, root.TimestampNanos).UTC().Format(time.RFC3339))
+}
+
+// showStatus shows the settings and latest root of the tree given by the
+// treeid flag.
+func showStatus(s *mysql.TreeAdminStorage, treeID int64) error {
+	status, err := s.GetTreeStatus(treeID)
+	if err != nil {
+		return err
+	}
+	// The tree's parameters are shown by trilctl status
+	tree := status.Tree
+	fmt.Printf("Tree %d: %s\n", tree.TreeID, tree.TreeType)
+	if c := status.Control; c != nil {
+		fmt.Printf("State %v, signing %v, sequencing %v, guard %v, max root duration %v, compression %v\n", c.TreeState, c.SigningEnabled, c.SequencingEnabled,
+			time.Duration(c.SequenceGuardSeconds)*time.Second, time.Duration(c.MaxRootDurationSeconds)*time.Second, c.LeafCompression)
+	} else {
+		fmt.Println("No tree control settings")
+	}
+	if status.LatestRevision < 0 {
+		fmt.Println("No roots")
+	} else {
+		fmt.Printf("Latest root: revision %d at %v", status.LatestRevision, time.Unix(0, status.LatestTimestampNanos).UTC())
+		if tree.TreeType != mysql.MapTreeType {
+			fmt.Printf(", tree size %d", status.LatestTreeSize)
+		}
+		fmt.Println()
+	}
+	if tree.TreeType == mysql.LogTreeType {
+		fmt.Printf("Unsequenced leaves: %d\n", status.Unsequenced)
+	}
+	return nil
+}
+
+// setGuard sets the guard window of the log given by the treeid flag, so its
+// queued leaves are only sequenced once they're at least that old.
+func setGuard(s *mysql.TreeAdminStorage, treeID int64) error {
+	if *guardFlag < 0 {
+		return fmt.Errorf("guard can't be negative")
+	}
+	control, ok, err := s.GetTreeControl(treeID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		control = mysql.DefaultTreeControl
+	}
+	control.SequenceGuardSeconds = int(*guardFlag / time.Second)
+	if err := s.SetTreeControl(treeID, control); err != nil {
+		return err
+	}
+	fmt.Printf("Tree %d guard window: %v\n", treeID, time.Duration(control.SequenceGuardSeconds)*time.Second)
+	return nil
+}
+
+// setMaxRootDuration sets how old the latest root of the tree given by the treeid
+// flag can get before it's re-signed.
+func setMaxRootDuration(s *mysql.TreeAdminStorage, treeID int64) error {
+	if *maxRootDurationFlag < 0 {
+		return fmt.Errorf("max_root_duration can't be negative")
+	}
+	control, ok, err := s.GetTreeControl(treeID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		control = mysql.DefaultTreeControl
+	}
+	control.MaxRootDurationSeconds = int(*maxRootDurationFlag / time.Second)
+	if err := s.SetTreeControl(treeID, control); err != nil {
+		return err
+	}
+	fmt.Printf("Tree %d max root duration: %v\n", treeID, time.Duration(control.MaxRootDurationSeconds)*time.Second)
+	return nil
+}
+
+// setCompression sets how leaf data written to the tree given by the treeid flag
+// is compressed. Existing data is left as it is, and can still be read.
+func setCompression(s *mysql.TreeAdminStorage, treeID int64) error {
+	compression, err := storage.ParseLeafCompression(*compressionFlag)
+	if err != nil {
+		return err
+	}
+	control, ok, err := s.GetTreeControl(treeID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		control = mysql.DefaultTreeControl
+	}
+	control.LeafCompression = compression
+	if err := s.SetTreeControl(treeID, control); err != nil {
+		return err
+	}
+	fmt.Printf("Tree %d leaf compression: %v. Servers must be restarted to pick this up\n", treeID, control.LeafCompression)
+	return nil
+}
+
+// purgeTree removes the tree and its data without the grace period of a
+// deletion through the TrillianAdmin service, so it can't be undeleted.
+func purgeTree(s *mysql.TreeAdminStorage, treeID int64) error {
+	if !*forceFlag {
+		return fmt.Errorf("purge removes all of the tree's data, set force to confirm")
+	}
+	if err := s.DeleteTree(treeID); err != nil {
+		return err
+	}
+	fmt.Printf("Purged tree %d\n", treeID)
+	return nil
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Exitf("Usage: tree_control [flags] <command>, where command is one of stats, status, set-guard, set-max-root-duration, set-compression or purge")
+	}
+	command, ok := commands[flag.Arg(0)]
+	if !ok {
+		log.Exitf("Unknown command: %s", flag.Arg(0))
+	}
+
+	s, err := tools.GetTreeAdminStorageFromFlags()
+	if err != nil {
+		log.Exitf("Failed to open storage: %v", err)
+	}
+	if err := command(s, tools.GetTreeIDFromFlags()); err != nil {
+		log.Exitf("%s failed: %v", flag.Arg(0), err)
+	}
+}
@@ -0,0 +1,360 @@
+// The trilctl command creates, configures and shows the status of trees, and
+// manages quota limits, through the TrillianAdmin service of a log or map
+// server started with enable_admin_service. Usage:
+//
+//	trilctl [flags] <command>
+//
+// where command is one of list, status, create, freeze, unfreeze, drain,
+// archive, rotate-key, set-retention, delete, undelete, quotas, set-quota or
+// delete-quota.
+// Commands act on the tree given by the treeid flag, other than list and the
+// quota commands. Settings the service doesn't manage are changed with the
+// tree_control tool, which works on storage directly.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/auth"
+	"github.com/google/trillian/storage/cache"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var adminServerFlag = flag.String("admin_server", "localhost:8090", "host:port of a log or map server serving the TrillianAdmin service")
+var rpcCAFileFlag = flag.String("rpc_ca_file", "", "If set, file containing the PEM encoded CA certificates that the server's certificate is checked against. Otherwise it's connected to without TLS")
+var rpcCertFileFlag = flag.String("rpc_cert_file", "", "If set with rpc_ca_file, file containing the PEM encoded certificate presented to the server. Its principal must be one of the server's admin_principals")
+var rpcKeyFileFlag = flag.String("rpc_key_file", "", "File containing the PEM encoded private key for rpc_cert_file")
+var timeoutFlag = flag.Duration("timeout", 30*time.Second, "How long to wait for the server to answer")
+var treeIDFlag = flag.Int64("treeid", 0, "The tree to act on. For create, zero lets the server choose one")
+var treeTypeFlag = flag.String("tree_type", trillian.TreeType_LOG.String(), "Type of tree to create, LOG, PREORDERED_LOG or MAP")
+var keyIDFlag = flag.String("key_id", "", "Identifies the key that signs the tree's roots, for create and rotate-key")
+var activateAfterFlag = flag.Duration("activate_after", 0, "How long after rotate-key the new key is activated. Until then roots are signed with both the current and the new key")
+var hashAlgorithmFlag = flag.String("hash_algorithm", trillian.HashAlgorithm_SHA256.String(), "Hash algorithm of the created tree, SHA256 or SHA512. A map's key hashes are as long as its digests")
+var hashStrategyFlag = flag.String("hash_strategy", trillian.HashStrategy_RFC6962.String(), "Hash strategy of the created tree, RFC6962, SHA512_256 or LIE_SHA512_256")
+var signatureAlgorithmFlag = flag.String("signature_algorithm", trillian.SignatureAlgorithm_ECDSA.String(), "Algorithm of the key that signs the created tree's roots, ECDSA, RSA, ED25519 or THRESHOLD")
+var duplicatePolicyFlag = flag.String("duplicate_policy", trillian.DuplicatePolicy_MERGE_DUPLICATES.String(), "What the created log does with leaves already in it, MERGE_DUPLICATES, REJECT_DUPLICATES or ALLOW_DUPLICATES")
+var leafHashPrefixFlag = flag.String("leaf_hash_prefix", "", "Hex encoded domain separation prefix for leaf hashes of the created tree, empty for RFC 6962")
+var nodeHashPrefixFlag = flag.String("node_hash_prefix", "", "Hex encoded domain separation prefix for node hashes of the created tree, empty for RFC 6962")
+var mapStrataFlag = flag.String("map_strata", "", "Depths of the created map's strata from the root, e.g. 8x10,176 for ten of 8 levels then one of 176. Empty for the default")
+var maxRevisionsFlag = flag.Int64("max_revisions", 0, "Most revisions of the map that set-retention keeps, zero for no limit")
+var maxAgeFlag = flag.Duration("max_age", 0, "How long set-retention keeps the map's revisions after they're published, zero for no limit")
+var showDeletedFlag = flag.Bool("show_deleted", false, "If true list also shows soft deleted trees")
+var quotaGroupFlag = flag.String("quota_group", trillian.QuotaGroup_TREE.String(), "Group of requests limited, for set-quota and delete-quota: GLOBAL, TREE for the tree given by treeid, or USER for quota_user. A treeid of zero or an empty quota_user is the default limit of the group")
+var quotaKindFlag = flag.String("quota_kind", trillian.QuotaKind_WRITE.String(), "Kind of requests limited, for set-quota and delete-quota: READ or WRITE")
+var quotaUserFlag = flag.String("quota_user", "", "The user a USER quota limit is for")
+var tokensPerSecondFlag = flag.Float64("tokens_per_second", 0, "Rate the quota set by set-quota is refilled at")
+var burstFlag = flag.Int64("burst", 0, "Most tokens the quota set by set-quota can hold")
+
+// commands maps each command name to the function that runs it.
+var commands = map[string]func(context.Context, trillian.TrillianAdminClient, int64) error{
+	"list":          listTrees,
+	"status":        showStatus,
+	"create":        createTree,
+	"freeze":        setTreeState(trillian.TreeState_FROZEN),
+	"unfreeze":      setTreeState(trillian.TreeState_ACTIVE),
+	"drain":         setTreeState(trillian.TreeState_DRAINING),
+	"archive":       setTreeState(trillian.TreeState_ARCHIVED),
+	"rotate-key":    rotateKey,
+	"set-retention": setRetention,
+	"delete":        deleteTree,
+	"undelete":      undeleteTree,
+	"quotas":        listQuotaLimits,
+	"set-quota":     setQuotaLimit,
+	"delete-quota":  deleteQuotaLimit,
+}
+
+func listTrees(ctx context.Context, client trillian.TrillianAdminClient, _ int64) error {
+	resp, err := client.ListTrees(ctx, &trillian.ListTreesRequest{ShowDeleted: *showDeletedFlag})
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TREE ID\tTYPE\tSTATE\tKEY ID\tDUPLICATES\tDELETED")
+	for _, tree := range resp.Tree {
+		fmt.Fprintf(w, "%d\t%v\t%v\t%s\t%v\t%v\n", tree.TreeId, tree.TreeType, tree.TreeState, tree.KeyId, tree.DuplicatePolicy, tree.Deleted)
+	}
+	return w.Flush()
+}
+
+func showStatus(ctx context.Context, client trillian.TrillianAdminClient, treeID int64) error {
+	resp, err := client.GetTree(ctx, &trillian.GetTreeRequest{TreeId: treeID})
+	if err != nil {
+		return err
+	}
+	printTree(resp.Tree)
+	return nil
+}
+
+// printTree describes tree.
+func printTree(tree *trillian.Tree) {
+	fmt.Printf("Tree %d: %v, state %v, key %q, duplicate policy %v\n", tree.TreeId, tree.TreeType, tree.TreeState, tree.KeyId, tree.DuplicatePolicy)
+	fmt.Printf("Hash algorithm %v, strategy %v, prefixes: leaf %x, node %x\n", tree.HashAlgorithm, tree.HashStrategy, tree.LeafHashPrefix, tree.NodeHashPrefix)
+	fmt.Printf("Signature algorithm %v\n", tree.SignatureAlgorithm)
+	if len(tree.Keys) > 1 {
+		for _, key := range tree.Keys {
+			fmt.Printf("Key %q activated at %v\n", key.KeyId, time.Unix(0, key.ActivateTimeNanos).UTC())
+		}
+	}
+	if tree.TreeType == trillian.TreeType_MAP {
+		strata := "default"
+		if len(tree.MapStrata) > 0 {
+			depths := make([]int, 0, len(tree.MapStrata))
+			for _, d := range tree.MapStrata {
+				depths = append(depths, int(d))
+			}
+			strata = cache.FormatStrata(depths)
+		}
+		fmt.Printf("Map strata: %s\n", strata)
+		if r := tree.MapRetention; r != nil {
+			fmt.Printf("Retention: %d revisions, %v\n", r.MaxRevisions, time.Duration(r.MaxAgeSeconds)*time.Second)
+		}
+	}
+	if tree.Deleted {
+		fmt.Printf("Deleted at %v\n", time.Unix(0, tree.DeleteTimeNanos).UTC())
+	}
+}
+
+func createTree(ctx context.Context, client trillian.TrillianAdminClient, treeID int64) error {
+	if len(*keyIDFlag) == 0 {
+		return errors.New("key_id must be set")
+	}
+	treeType, ok := trillian.TreeType_value[*treeTypeFlag]
+	if !ok {
+		return fmt.Errorf("unknown tree_type: %s", *treeTypeFlag)
+	}
+	alg, ok := trillian.HashAlgorithm_value[*hashAlgorithmFlag]
+	if !ok {
+		return fmt.Errorf("unknown hash_algorithm: %s", *hashAlgorithmFlag)
+	}
+	strategy, ok := trillian.HashStrategy_value[*hashStrategyFlag]
+	if !ok {
+		return fmt.Errorf("unknown hash_strategy: %s", *hashStrategyFlag)
+	}
+	signature, ok := trillian.SignatureAlgorithm_value[*signatureAlgorithmFlag]
+	if !ok {
+		return fmt.Errorf("unknown signature_algorithm: %s", *signatureAlgorithmFlag)
+	}
+	policy, ok := trillian.DuplicatePolicy_value[*duplicatePolicyFlag]
+	if !ok {
+		return fmt.Errorf("unknown duplicate_policy: %s", *duplicatePolicyFlag)
+	}
+	tree := &trillian.Tree{
+		TreeId:             treeID,
+		TreeType:           trillian.TreeType(treeType),
+		HashAlgorithm:      trillian.HashAlgorithm(alg),
+		HashStrategy:       trillian.HashStrategy(strategy),
+		SignatureAlgorithm: trillian.SignatureAlgorithm(signature),
+		KeyId:              *keyIDFlag,
+		DuplicatePolicy:    trillian.DuplicatePolicy(policy),
+	}
+	var err error
+	if tree.LeafHashPrefix, err = parsePrefix(*leafHashPrefixFlag); err != nil {
+		return fmt.Errorf("invalid leaf_hash_prefix: %v", err)
+	}
+	if tree.NodeHashPrefix, err = parsePrefix(*nodeHashPrefixFlag); err != nil {
+		return fmt.Errorf("invalid node_hash_prefix: %v", err)
+	}
+	strata, err := cache.ParseStrata(*mapStrataFlag)
+	if err != nil {
+		return fmt.Errorf("invalid map_strata: %v", err)
+	}
+	for _, depth := range strata {
+		tree.MapStrata = append(tree.MapStrata, int32(depth))
+	}
+	resp, err := client.CreateTree(ctx, &trillian.CreateTreeRequest{Tree: tree})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created %v tree %d\n", resp.Tree.TreeType, resp.Tree.TreeId)
+	return nil
+}
+
+// parsePrefix decodes a hash prefix, where empty means there isn't one.
+func parsePrefix(prefix string) ([]byte, error) {
+	if len(prefix) == 0 {
+		return nil, nil
+	}
+	return hex.DecodeString(prefix)
+}
+
+// setTreeState returns a command which sets the state of the tree given by the
+// treeid flag to state.
+func setTreeState(state trillian.TreeState) func(context.Context, trillian.TrillianAdminClient, int64) error {
+	return func(ctx context.Context, client trillian.TrillianAdminClient, treeID int64) error {
+		resp, err := client.UpdateTree(ctx, &trillian.UpdateTreeRequest{TreeId: treeID, TreeState: state})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Tree %d state: %v\n", treeID, resp.Tree.TreeState)
+		return nil
+	}
+}
+
+func rotateKey(ctx context.Context, client trillian.TrillianAdminClient, treeID int64) error {
+	if len(*keyIDFlag) == 0 {
+		return errors.New("key_id must be set")
+	}
+	if *activateAfterFlag < 0 {
+		return errors.New("activate_after can't be negative")
+	}
+	req := &trillian.UpdateTreeRequest{TreeId: treeID, KeyId: *keyIDFlag}
+	if *activateAfterFlag > 0 {
+		req.KeyActivateTimeNanos = time.Now().Add(*activateAfterFlag).UnixNano()
+	}
+	if _, err := client.UpdateTree(ctx, req); err != nil {
+		return err
+	}
+	if req.KeyActivateTimeNanos == 0 {
+		fmt.Printf("Tree %d now signed with key %q\n", treeID, *keyIDFlag)
+	} else {
+		fmt.Printf("Tree %d signed with key %q from %v, and with it as well as its current key until then\n", treeID, *keyIDFlag, time.Unix(0, req.KeyActivateTimeNanos).UTC())
+	}
+	return nil
+}
+
+// setRetention sets how many revisions of a map, and for how long, the map
+// servers' revision GC keeps.
+func setRetention(ctx context.Context, client trillian.TrillianAdminClient, treeID int64) error {
+	if *maxRevisionsFlag < 0 || *maxAgeFlag < 0 {
+		return errors.New("max_revisions and max_age can't be negative")
+	}
+	req := &trillian.UpdateTreeRequest{
+		TreeId:       treeID,
+		MapRetention: &trillian.MapRetentionPolicy{MaxRevisions: *maxRevisionsFlag, MaxAgeSeconds: int64(*maxAgeFlag / time.Second)},
+	}
+	resp, err := client.UpdateTree(ctx, req)
+	if err != nil {
+		return err
+	}
+	printTree(resp.Tree)
+	return nil
+}
+
+// deleteTree soft deletes the tree, so it's no longer served. Its data is kept
+// until the servers' deleted tree GC removes it.
+func deleteTree(ctx context.Context, client trillian.TrillianAdminClient, treeID int64) error {
+	if _, err := client.DeleteTree(ctx, &trillian.DeleteTreeRequest{TreeId: treeID}); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted tree %d, it can be undeleted until its data is removed\n", treeID)
+	return nil
+}
+
+func undeleteTree(ctx context.Context, client trillian.TrillianAdminClient, treeID int64) error {
+	if _, err := client.UndeleteTree(ctx, &trillian.UndeleteTreeRequest{TreeId: treeID}); err != nil {
+		return err
+	}
+	fmt.Printf("Undeleted tree %d\n", treeID)
+	return nil
+}
+
+func listQuotaLimits(ctx context.Context, client trillian.TrillianAdminClient, _ int64) error {
+	resp, err := client.ListQuotaLimits(ctx, &trillian.ListQuotaLimitsRequest{})
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "GROUP\tKIND\tTREE ID\tUSER\tTOKENS/S\tBURST")
+	for _, l := range resp.Limit {
+		fmt.Fprintf(w, "%v\t%v\t%d\t%s\t%v\t%d\n", l.Group, l.Kind, l.TreeId, l.User, l.TokensPerSecond, l.Burst)
+	}
+	return w.Flush()
+}
+
+// quotaSpec returns the group, kind, tree and user of the quota limit given by
+// the flags. Only TREE limits are for the tree given by treeid.
+func quotaSpec(treeID int64) (trillian.QuotaGroup, trillian.QuotaKind, int64, error) {
+	group, ok := trillian.QuotaGroup_value[strings.ToUpper(*quotaGroupFlag)]
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("unknown quota_group: %s", *quotaGroupFlag)
+	}
+	kind, ok := trillian.QuotaKind_value[strings.ToUpper(*quotaKindFlag)]
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("unknown quota_kind: %s", *quotaKindFlag)
+	}
+	if trillian.QuotaGroup(group) != trillian.QuotaGroup_TREE {
+		treeID = 0
+	}
+	return trillian.QuotaGroup(group), trillian.QuotaKind(kind), treeID, nil
+}
+
+func setQuotaLimit(ctx context.Context, client trillian.TrillianAdminClient, treeID int64) error {
+	group, kind, treeID, err := quotaSpec(treeID)
+	if err != nil {
+		return err
+	}
+	limit := &trillian.QuotaLimit{Group: group, Kind: kind, TreeId: treeID, User: *quotaUserFlag, TokensPerSecond: *tokensPerSecondFlag, Burst: *burstFlag}
+	if _, err := client.SetQuotaLimit(ctx, &trillian.SetQuotaLimitRequest{Limit: limit}); err != nil {
+		return err
+	}
+	fmt.Printf("Set %v %v quota limit to %v tokens/s, burst %d\n", group, kind, limit.TokensPerSecond, limit.Burst)
+	return nil
+}
+
+func deleteQuotaLimit(ctx context.Context, client trillian.TrillianAdminClient, treeID int64) error {
+	group, kind, treeID, err := quotaSpec(treeID)
+	if err != nil {
+		return err
+	}
+	if _, err := client.DeleteQuotaLimit(ctx, &trillian.DeleteQuotaLimitRequest{Group: group, Kind: kind, TreeId: treeID, User: *quotaUserFlag}); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %v %v quota limit\n", group, kind)
+	return nil
+}
+
+// dial connects to the server given by the admin_server flag.
+func dial() (*grpc.ClientConn, error) {
+	opt := grpc.WithInsecure()
+	switch {
+	case len(*rpcCertFileFlag) > 0:
+		if len(*rpcCAFileFlag) == 0 {
+			return nil, errors.New("rpc_cert_file requires rpc_ca_file")
+		}
+		config, err := auth.ClientTLSConfig(*rpcCertFileFlag, *rpcKeyFileFlag, *rpcCAFileFlag)
+		if err != nil {
+			return nil, err
+		}
+		opt = grpc.WithTransportCredentials(credentials.NewTLS(config))
+	case len(*rpcCAFileFlag) > 0:
+		creds, err := credentials.NewClientTLSFromFile(*rpcCAFileFlag, "")
+		if err != nil {
+			return nil, err
+		}
+		opt = grpc.WithTransportCredentials(creds)
+	}
+	return grpc.Dial(*adminServerFlag, opt)
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Exitf("Usage: trilctl [flags] <command>, where command is one of list, status, create, freeze, unfreeze, drain, archive, rotate-key, set-retention, delete, undelete, quotas, set-quota or delete-quota")
+	}
+	command, ok := commands[flag.Arg(0)]
+	if !ok {
+		log.Exitf("Unknown command: %s", flag.Arg(0))
+	}
+
+	conn, err := dial()
+	if err != nil {
+		log.Exitf("Failed to connect to %s: %v", *adminServerFlag, err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeoutFlag)
+	defer cancel()
+	if err := command(ctx, trillian.NewTrillianAdminClient(conn), *treeIDFlag); err != nil {
+		log.Exitf("%s failed: %v", flag.Arg(0), err)
+	}
+}
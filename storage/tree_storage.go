@@ -45,3 +45,28 @@ type NodeReaderWriter interface {
 	// SetMerkleNodes stores the provided nodes, at the transaction's writeRevision.
 	SetMerkleNodes(nodes []Node) error
 }
+
+// SubtreeInspector is implemented by transactions that can return subtrees in
+// the form they're stored, for tools that debug the contents of a tree. It's
+// not needed to serve trees.
+type SubtreeInspector interface {
+	// GetStoredSubtree returns the subtree whose prefix is given by id, as it was
+	// stored at treeRevision, or nil if there is no such subtree.
+	GetStoredSubtree(treeRevision int64, id NodeID) (*SubtreeProto, error)
+}
+
+// PartialRevisionRemover is implemented by transactions that can remove the
+// data of revisions which were partly written but never got a root. A map
+// revision written across several stores, such as the shards of a sharded map,
+// is committed to each of them separately, so a crash in between leaves nodes
+// behind that the next write at that revision would collide with. Without the
+// leaves and root the revision can't be completed, so it's rolled back. This
+// must only be done when nothing else is writing to the tree, such as by the
+// server elected master of the tree when it opens it. Logs write each revision
+// in a single transaction, so only maps need it.
+type PartialRevisionRemover interface {
+	// RemovePartialRevisions deletes everything written at revisions after the
+	// latest root, or a map's staged root, and returns the number of rows
+	// deleted.
+	RemovePartialRevisions() (int64, error)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/trillian"
 )
@@ -11,6 +12,66 @@ import (
 // ErrReadOnly is returned when storage operations are not allowed because a resource is read only
 var ErrReadOnly = errors.New("storage: Operation not allowed because resource is read only")
 
+// ErrNoStagedRevision is returned when an operation requires a staged map revision but there isn't one
+var ErrNoStagedRevision = errors.New("storage: No map revision is staged")
+
+// ErrTagNotFound is returned when a map revision tag does not exist
+var ErrTagNotFound = errors.New("storage: Map revision tag not found")
+
+// ErrMapRootNotFound is returned when there is no published root for a map revision
+var ErrMapRootNotFound = errors.New("storage: No map root for revision")
+
+// ErrTreeNeedsInit is returned when the root of a tree is read before the tree has
+// been initialized with its empty root
+var ErrTreeNeedsInit = errors.New("storage: Tree has no root and must be initialized")
+
+// ErrTreeAlreadyInitialized is returned when initializing a tree that already has a root
+var ErrTreeAlreadyInitialized = errors.New("storage: Tree already has a root")
+
+// ErrTreeDeleted is returned when opening or changing a tree that has been soft
+// deleted, until it's undeleted or its data is removed
+var ErrTreeDeleted = errors.New("storage: Tree has been deleted")
+
+// ErrTreeNotDeleted is returned when undeleting a tree that isn't deleted
+var ErrTreeNotDeleted = errors.New("storage: Tree is not deleted")
+
+// RevisionOutOfRangeError is returned when a read is made at a tree revision that
+// has been pruned under the tree's RetentionPolicy.
+type RevisionOutOfRangeError struct {
+	// Revision is the revision that was requested.
+	Revision int64
+	// OldestRetained is the earliest revision that can still be read.
+	OldestRetained int64
+}
+
+func (e RevisionOutOfRangeError) Error() string {
+	return fmt.Sprintf("storage: Revision %d is out of range, oldest retained revision is %d", e.Revision, e.OldestRetained)
+}
+
+// RetentionPolicy controls how many revisions of a tree are kept. Revisions outside
+// the policy may be pruned by garbage collection. The latest revision is always kept.
+type RetentionPolicy struct {
+	// MaxRevisions is the number of most recent revisions to keep, or zero for no limit.
+	MaxRevisions int64
+	// MaxAge is how long revisions are kept after they are published, or zero for no limit.
+	MaxAge time.Duration
+}
+
+// TreeHashPrefixes holds the domain separation prefixes a tree hashes its leaves
+// and nodes with. They're set when the tree is created and must not change after.
+// If both are empty the tree uses the RFC 6962 prefixes.
+type TreeHashPrefixes struct {
+	// Leaf is prefixed to leaf data before it is hashed.
+	Leaf []byte
+	// Node is prefixed to the concatenated child hashes of a node before they are hashed.
+	Node []byte
+}
+
+// IsDefault returns true if the tree uses the RFC 6962 prefixes.
+func (p TreeHashPrefixes) IsDefault() bool {
+	return len(p.Leaf) == 0 && len(p.Node) == 0
+}
+
 // Node represents a single node in a Merkle tree.
 type Node struct {
 	NodeID       NodeID
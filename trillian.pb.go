@@ -40,15 +40,25 @@ type SignatureAlgorithm int32
 const (
 	SignatureAlgorithm_ECDSA SignatureAlgorithm = 0
 	SignatureAlgorithm_RSA   SignatureAlgorithm = 1
+	// The signature is a signer.ThresholdSignature, made up of the signatures
+	// of at least a threshold number of separate signers.
+	SignatureAlgorithm_THRESHOLD SignatureAlgorithm = 2
+	// The signature is an Ed25519 signature of the digest, as Ed25519 hashes
+	// what it signs itself.
+	SignatureAlgorithm_ED25519 SignatureAlgorithm = 3
 )
 
 var SignatureAlgorithm_name = map[int32]string{
 	0: "ECDSA",
 	1: "RSA",
+	2: "THRESHOLD",
+	3: "ED25519",
 }
 var SignatureAlgorithm_value = map[string]int32{
-	"ECDSA": 0,
-	"RSA":   1,
+	"ECDSA":     0,
+	"RSA":       1,
+	"THRESHOLD": 2,
+	"ED25519":   3,
 }
 
 func (x SignatureAlgorithm) String() string {
@@ -60,13 +70,16 @@ type HashAlgorithm int32
 
 const (
 	HashAlgorithm_SHA256 HashAlgorithm = 0
+	HashAlgorithm_SHA512 HashAlgorithm = 1
 )
 
 var HashAlgorithm_name = map[int32]string{
 	0: "SHA256",
+	1: "SHA512",
 }
 var HashAlgorithm_value = map[string]int32{
 	"SHA256": 0,
+	"SHA512": 1,
 }
 
 func (x HashAlgorithm) String() string {
@@ -74,6 +87,236 @@ func (x HashAlgorithm) String() string {
 }
 func (HashAlgorithm) EnumDescriptor() ([]byte, []int) { return fileDescriptor1, []int{2} }
 
+// HashStrategy selects how the leaves and nodes of a tree are hashed. It's set
+// when the tree is created and must not change after.
+type HashStrategy int32
+
+const (
+	// RFC 6962 hashing with the tree's hash algorithm. Trees with their own
+	// domain separation prefixes use them in place of the RFC 6962 ones.
+	HashStrategy_RFC6962 HashStrategy = 0
+	// As RFC6962 but using SHA-512/256. The tree's hash algorithm must be SHA256,
+	// which has the same digest size.
+	HashStrategy_SHA512_256 HashStrategy = 1
+	// Hashing with SHA-512/256 where leaves are prefixed with "L", interior
+	// nodes with "I", and the empty hash, which is also the hash of an absent map
+	// leaf, is the hash of "E". The tree's hash algorithm must be SHA256 and it
+	// can't have its own prefixes. Unlike CONIKS hashing, the tree ID and a
+	// node's position aren't hashed.
+	HashStrategy_LIE_SHA512_256 HashStrategy = 2
+)
+
+var HashStrategy_name = map[int32]string{
+	0: "RFC6962",
+	1: "SHA512_256",
+	2: "LIE_SHA512_256",
+}
+var HashStrategy_value = map[string]int32{
+	"RFC6962":        0,
+	"SHA512_256":     1,
+	"LIE_SHA512_256": 2,
+}
+
+func (x HashStrategy) String() string {
+	return proto.EnumName(HashStrategy_name, int32(x))
+}
+func (HashStrategy) EnumDescriptor() ([]byte, []int) { return fileDescriptor1, []int{3} }
+
+// TreeType says whether a tree holds a log or a map.
+type TreeType int32
+
+const (
+	TreeType_UNKNOWN_TREE_TYPE TreeType = 0
+	TreeType_LOG               TreeType = 1
+	TreeType_MAP               TreeType = 2
+	// A log whose leaves are sequenced by the caller, which adds them at their
+	// indices with AddSequencedLeaves. They are integrated in order of index,
+	// without being queued and sequenced by the log.
+	TreeType_PREORDERED_LOG TreeType = 3
+)
+
+var TreeType_name = map[int32]string{
+	0: "UNKNOWN_TREE_TYPE",
+	1: "LOG",
+	2: "MAP",
+	3: "PREORDERED_LOG",
+}
+var TreeType_value = map[string]int32{
+	"UNKNOWN_TREE_TYPE": 0,
+	"LOG":               1,
+	"MAP":               2,
+	"PREORDERED_LOG":    3,
+}
+
+func (x TreeType) String() string {
+	return proto.EnumName(TreeType_name, int32(x))
+}
+func (TreeType) EnumDescriptor() ([]byte, []int) { return fileDescriptor1, []int{4} }
+
+// TreeState says which operations a tree allows.
+type TreeState int32
+
+const (
+	TreeState_UNKNOWN_TREE_STATE TreeState = 0
+	// The tree can be read and written.
+	TreeState_ACTIVE TreeState = 1
+	// The tree can be read but not written, for example while it's being
+	// migrated or investigated. A log's queued leaves aren't sequenced.
+	TreeState_FROZEN TreeState = 2
+	// The log can be read but no more leaves can be queued. Leaves already
+	// queued are still sequenced, after which the log can be archived.
+	TreeState_DRAINING TreeState = 3
+	// The tree is retired. It can be read but not written, and its roots are no
+	// longer signed.
+	TreeState_ARCHIVED TreeState = 4
+)
+
+var TreeState_name = map[int32]string{
+	0: "UNKNOWN_TREE_STATE",
+	1: "ACTIVE",
+	2: "FROZEN",
+	3: "DRAINING",
+	4: "ARCHIVED",
+}
+var TreeState_value = map[string]int32{
+	"UNKNOWN_TREE_STATE": 0,
+	"ACTIVE":             1,
+	"FROZEN":             2,
+	"DRAINING":           3,
+	"ARCHIVED":           4,
+}
+
+func (x TreeState) String() string {
+	return proto.EnumName(TreeState_name, int32(x))
+}
+func (TreeState) EnumDescriptor() ([]byte, []int) { return fileDescriptor1, []int{5} }
+
+// DuplicatePolicy says what a log does with a leaf whose hash is already
+// sequenced or queued in it.
+type DuplicatePolicy int32
+
+const (
+	// The leaf isn't queued again. The existing leaf is returned, with its index
+	// and integrate timestamp once it's been sequenced.
+	DuplicatePolicy_MERGE_DUPLICATES DuplicatePolicy = 0
+	// The leaf isn't queued again, and the submission is refused.
+	DuplicatePolicy_REJECT_DUPLICATES DuplicatePolicy = 1
+	// The leaf is queued again, and is sequenced as a separate leaf.
+	DuplicatePolicy_ALLOW_DUPLICATES DuplicatePolicy = 2
+)
+
+var DuplicatePolicy_name = map[int32]string{
+	0: "MERGE_DUPLICATES",
+	1: "REJECT_DUPLICATES",
+	2: "ALLOW_DUPLICATES",
+}
+var DuplicatePolicy_value = map[string]int32{
+	"MERGE_DUPLICATES":  0,
+	"REJECT_DUPLICATES": 1,
+	"ALLOW_DUPLICATES":  2,
+}
+
+func (x DuplicatePolicy) String() string {
+	return proto.EnumName(DuplicatePolicy_name, int32(x))
+}
+func (DuplicatePolicy) EnumDescriptor() ([]byte, []int) { return fileDescriptor1, []int{6} }
+
+// Tree holds the parameters of a tree, as managed by the TrillianAdmin service.
+// Only the key ID and state can be changed once a tree has been created.
+type Tree struct {
+	TreeId    int64     `protobuf:"varint,1,opt,name=tree_id,json=treeId" json:"tree_id,omitempty"`
+	TreeType  TreeType  `protobuf:"varint,2,opt,name=tree_type,json=treeType,enum=trillian.TreeType" json:"tree_type,omitempty"`
+	TreeState TreeState `protobuf:"varint,3,opt,name=tree_state,json=treeState,enum=trillian.TreeState" json:"tree_state,omitempty"`
+	// The hash algorithm of the tree's leaves and nodes, and a map's key hashes,
+	// so it sets the depth of a map.
+	HashAlgorithm HashAlgorithm `protobuf:"varint,4,opt,name=hash_algorithm,json=hashAlgorithm,enum=trillian.HashAlgorithm" json:"hash_algorithm,omitempty"`
+	HashStrategy  HashStrategy  `protobuf:"varint,5,opt,name=hash_strategy,json=hashStrategy,enum=trillian.HashStrategy" json:"hash_strategy,omitempty"`
+	// The algorithm of the key that signs the tree's roots. Trees can only be
+	// created with the algorithm their key signs with.
+	SignatureAlgorithm SignatureAlgorithm `protobuf:"varint,6,opt,name=signature_algorithm,json=signatureAlgorithm,enum=trillian.SignatureAlgorithm" json:"signature_algorithm,omitempty"`
+	// Identifies the key that signs the tree's roots now.
+	KeyId string `protobuf:"bytes,7,opt,name=key_id,json=keyId" json:"key_id,omitempty"`
+	// Set for logs whose duplicate_policy is ALLOW_DUPLICATES, which setting it
+	// when creating a tree is the same as.
+	AllowsDuplicateLeaves bool `protobuf:"varint,8,opt,name=allows_duplicate_leaves,json=allowsDuplicateLeaves" json:"allows_duplicate_leaves,omitempty"`
+	// Domain separation prefixes for leaf and node hashes, empty for RFC 6962.
+	LeafHashPrefix []byte `protobuf:"bytes,9,opt,name=leaf_hash_prefix,json=leafHashPrefix,proto3" json:"leaf_hash_prefix,omitempty"`
+	NodeHashPrefix []byte `protobuf:"bytes,10,opt,name=node_hash_prefix,json=nodeHashPrefix,proto3" json:"node_hash_prefix,omitempty"`
+	// Set if the tree has been soft deleted, at delete_time_nanos. Deleted trees
+	// aren't served and can't be changed, but can be undeleted until their data
+	// is removed.
+	Deleted         bool  `protobuf:"varint,11,opt,name=deleted" json:"deleted,omitempty"`
+	DeleteTimeNanos int64 `protobuf:"varint,12,opt,name=delete_time_nanos,json=deleteTimeNanos" json:"delete_time_nanos,omitempty"`
+	// What a log does with leaves already in it. Maps ignore it.
+	DuplicatePolicy DuplicatePolicy `protobuf:"varint,13,opt,name=duplicate_policy,json=duplicatePolicy,enum=trillian.DuplicatePolicy" json:"duplicate_policy,omitempty"`
+	// The depths of the strata a map's nodes are stored in, from the root. Each
+	// is a multiple of 8 no deeper than 248, and together they add up to the
+	// map's depth. If empty the storage's default strata are used. Servers
+	// sharding maps across several databases need the first stratum to be 8
+	// levels. Logs have no strata.
+	MapStrata []int32 `protobuf:"varint,14,rep,name=map_strata,json=mapStrata" json:"map_strata,omitempty"`
+	// Every key that has signed or will sign the tree's roots, in order of
+	// activation, so clients can verify roots signed before the tree's key was
+	// rotated. A root is signed by the key active at its timestamp.
+	Keys []*TreeKey `protobuf:"bytes,15,rep,name=keys" json:"keys,omitempty"`
+	// The revisions a map keeps, older ones are pruned. It's only returned by
+	// GetTree and UpdateTree, and only by servers with access to the map's
+	// storage.
+	MapRetention *MapRetentionPolicy `protobuf:"bytes,16,opt,name=map_retention,json=mapRetention" json:"map_retention,omitempty"`
+}
+
+func (m *Tree) Reset()                    { *m = Tree{} }
+func (m *Tree) String() string            { return proto.CompactTextString(m) }
+func (*Tree) ProtoMessage()               {}
+func (*Tree) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{0} }
+
+func (m *Tree) GetKeys() []*TreeKey {
+	if m != nil {
+		return m.Keys
+	}
+	return nil
+}
+
+func (m *Tree) GetMapRetention() *MapRetentionPolicy {
+	if m != nil {
+		return m.MapRetention
+	}
+	return nil
+}
+
+// MapRetentionPolicy limits the revisions of a map that are kept. The latest
+// revision is always kept.
+type MapRetentionPolicy struct {
+	// The number of most recent revisions kept, zero for no limit.
+	MaxRevisions int64 `protobuf:"varint,1,opt,name=max_revisions,json=maxRevisions" json:"max_revisions,omitempty"`
+	// How long revisions are kept, zero for no limit.
+	MaxAgeSeconds int64 `protobuf:"varint,2,opt,name=max_age_seconds,json=maxAgeSeconds" json:"max_age_seconds,omitempty"`
+}
+
+func (m *MapRetentionPolicy) Reset()                    { *m = MapRetentionPolicy{} }
+func (m *MapRetentionPolicy) String() string            { return proto.CompactTextString(m) }
+func (*MapRetentionPolicy) ProtoMessage()               {}
+func (*MapRetentionPolicy) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{1} }
+
+// TreeKey is a key that signs a tree's roots from its activation time until the
+// next key's. Until it's activated, roots are signed with it as well as with
+// the key it will replace, so clients have time to learn it.
+type TreeKey struct {
+	// Identifies the key, as a tree's key_id does.
+	KeyId string `protobuf:"bytes,1,opt,name=key_id,json=keyId" json:"key_id,omitempty"`
+	// The DER encoded public key, empty if it wasn't known when the key was
+	// added to the tree.
+	PublicKeyDer []byte `protobuf:"bytes,2,opt,name=public_key_der,json=publicKeyDer,proto3" json:"public_key_der,omitempty"`
+	// When the key starts signing the tree's roots, zero for the key the tree
+	// was created with.
+	ActivateTimeNanos int64 `protobuf:"varint,3,opt,name=activate_time_nanos,json=activateTimeNanos" json:"activate_time_nanos,omitempty"`
+}
+
+func (m *TreeKey) Reset()                    { *m = TreeKey{} }
+func (m *TreeKey) String() string            { return proto.CompactTextString(m) }
+func (*TreeKey) ProtoMessage()               {}
+func (*TreeKey) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{2} }
+
 type DigitallySigned struct {
 	SignatureAlgorithm SignatureAlgorithm `protobuf:"varint,1,opt,name=signature_algorithm,json=signatureAlgorithm,enum=trillian.SignatureAlgorithm" json:"signature_algorithm,omitempty"`
 	HashAlgorithm      HashAlgorithm      `protobuf:"varint,2,opt,name=hash_algorithm,json=hashAlgorithm,enum=trillian.HashAlgorithm" json:"hash_algorithm,omitempty"`
@@ -83,7 +326,7 @@ type DigitallySigned struct {
 func (m *DigitallySigned) Reset()                    { *m = DigitallySigned{} }
 func (m *DigitallySigned) String() string            { return proto.CompactTextString(m) }
 func (*DigitallySigned) ProtoMessage()               {}
-func (*DigitallySigned) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{0} }
+func (*DigitallySigned) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{3} }
 
 type SignedEntryTimestamp struct {
 	TimestampNanos int64            `protobuf:"varint,1,opt,name=timestamp_nanos,json=timestampNanos" json:"timestamp_nanos,omitempty"`
@@ -94,7 +337,7 @@ type SignedEntryTimestamp struct {
 func (m *SignedEntryTimestamp) Reset()                    { *m = SignedEntryTimestamp{} }
 func (m *SignedEntryTimestamp) String() string            { return proto.CompactTextString(m) }
 func (*SignedEntryTimestamp) ProtoMessage()               {}
-func (*SignedEntryTimestamp) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{1} }
+func (*SignedEntryTimestamp) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{4} }
 
 func (m *SignedEntryTimestamp) GetSignature() *DigitallySigned {
 	if m != nil {
@@ -114,12 +357,18 @@ type SignedLogRoot struct {
 	Signature    *DigitallySigned `protobuf:"bytes,4,opt,name=signature" json:"signature,omitempty"`
 	LogId        []byte           `protobuf:"bytes,5,opt,name=log_id,json=logId,proto3" json:"log_id,omitempty"`
 	TreeRevision int64            `protobuf:"varint,6,opt,name=tree_revision,json=treeRevision" json:"tree_revision,omitempty"`
+	// Signatures of the root by witnesses that have checked it is consistent with
+	// the log's earlier roots. They aren't covered by the log's signature.
+	Cosignatures []*Cosignature `protobuf:"bytes,7,rep,name=cosignatures" json:"cosignatures,omitempty"`
+	// Signatures of the root by the keys that will replace the log's key, while
+	// it's being rotated.
+	KeySignatures []*KeySignature `protobuf:"bytes,8,rep,name=key_signatures,json=keySignatures" json:"key_signatures,omitempty"`
 }
 
 func (m *SignedLogRoot) Reset()                    { *m = SignedLogRoot{} }
 func (m *SignedLogRoot) String() string            { return proto.CompactTextString(m) }
 func (*SignedLogRoot) ProtoMessage()               {}
-func (*SignedLogRoot) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{2} }
+func (*SignedLogRoot) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{5} }
 
 func (m *SignedLogRoot) GetSignature() *DigitallySigned {
 	if m != nil {
@@ -128,16 +377,76 @@ func (m *SignedLogRoot) GetSignature() *DigitallySigned {
 	return nil
 }
 
+func (m *SignedLogRoot) GetCosignatures() []*Cosignature {
+	if m != nil {
+		return m.Cosignatures
+	}
+	return nil
+}
+
+func (m *SignedLogRoot) GetKeySignatures() []*KeySignature {
+	if m != nil {
+		return m.KeySignatures
+	}
+	return nil
+}
+
+// KeySignature is a signature of a root by one of its tree's keys other than
+// the one that made its main signature, made in the same way.
+type KeySignature struct {
+	// Identifies the key, as a TreeKey's key_id does.
+	KeyId     string           `protobuf:"bytes,1,opt,name=key_id,json=keyId" json:"key_id,omitempty"`
+	Signature *DigitallySigned `protobuf:"bytes,2,opt,name=signature" json:"signature,omitempty"`
+}
+
+func (m *KeySignature) Reset()                    { *m = KeySignature{} }
+func (m *KeySignature) String() string            { return proto.CompactTextString(m) }
+func (*KeySignature) ProtoMessage()               {}
+func (*KeySignature) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{6} }
+
+func (m *KeySignature) GetSignature() *DigitallySigned {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+// Cosignature is a witness's signature of a log root, made in the same way as
+// the log's own signature so it can be checked with the witness's public key.
+type Cosignature struct {
+	// Names the witness, so clients can find the key that made the signature.
+	WitnessId string           `protobuf:"bytes,1,opt,name=witness_id,json=witnessId" json:"witness_id,omitempty"`
+	Signature *DigitallySigned `protobuf:"bytes,2,opt,name=signature" json:"signature,omitempty"`
+}
+
+func (m *Cosignature) Reset()                    { *m = Cosignature{} }
+func (m *Cosignature) String() string            { return proto.CompactTextString(m) }
+func (*Cosignature) ProtoMessage()               {}
+func (*Cosignature) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{7} }
+
+func (m *Cosignature) GetSignature() *DigitallySigned {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
 type MapperMetadata struct {
 	SourceLogId                  []byte `protobuf:"bytes,1,opt,name=source_log_id,json=sourceLogId,proto3" json:"source_log_id,omitempty"`
 	HighestFullyCompletedSeq     int64  `protobuf:"varint,2,opt,name=highest_fully_completed_seq,json=highestFullyCompletedSeq" json:"highest_fully_completed_seq,omitempty"`
 	HighestPartiallyCompletedSeq int64  `protobuf:"varint,3,opt,name=highest_partially_completed_seq,json=highestPartiallyCompletedSeq" json:"highest_partially_completed_seq,omitempty"`
+	// The index of the first log entry applied by the revision, whose entries run
+	// up to highest_fully_completed_seq. If source_log_id is set a root is only
+	// written if this follows on from the previous root's
+	// highest_fully_completed_seq, or is zero if the previous root has no source
+	// log, so that no entry is skipped or applied twice.
+	RevisionStartSeq int64 `protobuf:"varint,4,opt,name=revision_start_seq,json=revisionStartSeq" json:"revision_start_seq,omitempty"`
 }
 
 func (m *MapperMetadata) Reset()                    { *m = MapperMetadata{} }
 func (m *MapperMetadata) String() string            { return proto.CompactTextString(m) }
 func (*MapperMetadata) ProtoMessage()               {}
-func (*MapperMetadata) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{3} }
+func (*MapperMetadata) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{8} }
 
 // SignedMapRoot represents a commitment by a Map to a particular tree.
 type SignedMapRoot struct {
@@ -148,12 +457,15 @@ type SignedMapRoot struct {
 	Signature   *DigitallySigned `protobuf:"bytes,4,opt,name=signature" json:"signature,omitempty"`
 	MapId       []byte           `protobuf:"bytes,5,opt,name=map_id,json=mapId,proto3" json:"map_id,omitempty"`
 	MapRevision int64            `protobuf:"varint,6,opt,name=map_revision,json=mapRevision" json:"map_revision,omitempty"`
+	// Signatures of the root by the keys that will replace the map's key, while
+	// it's being rotated.
+	KeySignatures []*KeySignature `protobuf:"bytes,7,rep,name=key_signatures,json=keySignatures" json:"key_signatures,omitempty"`
 }
 
 func (m *SignedMapRoot) Reset()                    { *m = SignedMapRoot{} }
 func (m *SignedMapRoot) String() string            { return proto.CompactTextString(m) }
 func (*SignedMapRoot) ProtoMessage()               {}
-func (*SignedMapRoot) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{4} }
+func (*SignedMapRoot) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{9} }
 
 func (m *SignedMapRoot) GetMetadata() *MapperMetadata {
 	if m != nil {
@@ -169,54 +481,115 @@ func (m *SignedMapRoot) GetSignature() *DigitallySigned {
 	return nil
 }
 
+func (m *SignedMapRoot) GetKeySignatures() []*KeySignature {
+	if m != nil {
+		return m.KeySignatures
+	}
+	return nil
+}
+
 func init() {
+	proto.RegisterType((*Tree)(nil), "trillian.Tree")
+	proto.RegisterType((*MapRetentionPolicy)(nil), "trillian.MapRetentionPolicy")
+	proto.RegisterType((*TreeKey)(nil), "trillian.TreeKey")
 	proto.RegisterType((*DigitallySigned)(nil), "trillian.DigitallySigned")
 	proto.RegisterType((*SignedEntryTimestamp)(nil), "trillian.SignedEntryTimestamp")
 	proto.RegisterType((*SignedLogRoot)(nil), "trillian.SignedLogRoot")
+	proto.RegisterType((*KeySignature)(nil), "trillian.KeySignature")
+	proto.RegisterType((*Cosignature)(nil), "trillian.Cosignature")
 	proto.RegisterType((*MapperMetadata)(nil), "trillian.MapperMetadata")
 	proto.RegisterType((*SignedMapRoot)(nil), "trillian.SignedMapRoot")
 	proto.RegisterEnum("trillian.TreeHasherPreimageType", TreeHasherPreimageType_name, TreeHasherPreimageType_value)
 	proto.RegisterEnum("trillian.SignatureAlgorithm", SignatureAlgorithm_name, SignatureAlgorithm_value)
 	proto.RegisterEnum("trillian.HashAlgorithm", HashAlgorithm_name, HashAlgorithm_value)
+	proto.RegisterEnum("trillian.HashStrategy", HashStrategy_name, HashStrategy_value)
+	proto.RegisterEnum("trillian.TreeType", TreeType_name, TreeType_value)
+	proto.RegisterEnum("trillian.TreeState", TreeState_name, TreeState_value)
+	proto.RegisterEnum("trillian.DuplicatePolicy", DuplicatePolicy_name, DuplicatePolicy_value)
 }
 
 func init() { proto.RegisterFile("github.com/google/trillian/trillian.proto", fileDescriptor1) }
 
 var fileDescriptor1 = []byte{
-	// 549 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xac, 0x54, 0x5d, 0x8f, 0xd2, 0x40,
-	0x14, 0xdd, 0x8a, 0x20, 0x5c, 0x3e, 0x16, 0xc7, 0x2f, 0x0c, 0x24, 0x2a, 0x3e, 0xb8, 0xf2, 0x00,
-	0x09, 0x2a, 0xc6, 0x07, 0x4d, 0x08, 0xcb, 0xba, 0x9b, 0x2c, 0x86, 0x4c, 0x79, 0x9f, 0xcc, 0x2e,
-	0x63, 0x3b, 0x49, 0xdb, 0xe9, 0x4e, 0x07, 0x13, 0xfc, 0x13, 0xfe, 0x1f, 0x1f, 0xfc, 0x3b, 0xfe,
-	0x0b, 0xe3, 0x4c, 0x69, 0x4b, 0x81, 0x97, 0x4d, 0xf4, 0x6d, 0xee, 0xe9, 0xb9, 0x67, 0xce, 0xbd,
-	0xa7, 0x2d, 0xbc, 0x76, 0xb8, 0x72, 0x57, 0x57, 0xfd, 0x6b, 0xe1, 0x0f, 0x1c, 0x21, 0x1c, 0x8f,
-	0x0d, 0x94, 0xe4, 0x9e, 0xc7, 0x69, 0x90, 0x1d, 0xfa, 0xa1, 0x14, 0x4a, 0xa0, 0x72, 0x5a, 0x77,
-	0x7f, 0x59, 0x70, 0x7c, 0xca, 0x75, 0x27, 0xf5, 0xbc, 0xb5, 0xcd, 0x9d, 0x80, 0x2d, 0xd1, 0x0c,
-	0x1e, 0x44, 0xfa, 0x44, 0xd5, 0x4a, 0x32, 0x42, 0x3d, 0x47, 0x48, 0x2d, 0xec, 0xb7, 0xac, 0xe7,
-	0xd6, 0x49, 0x63, 0xd8, 0xe9, 0x67, 0x5a, 0x76, 0x4a, 0x1a, 0xa7, 0x1c, 0x8c, 0xa2, 0x03, 0x0c,
-	0x7d, 0x82, 0x86, 0x4b, 0x23, 0x37, 0xa7, 0x74, 0x27, 0x56, 0x7a, 0xb2, 0x55, 0x3a, 0xd7, 0xcf,
-	0xb7, 0x22, 0x75, 0x37, 0x5f, 0xa2, 0x0e, 0x54, 0x32, 0xd5, 0x56, 0x41, 0xb7, 0xd6, 0xf0, 0x16,
-	0xe8, 0xfe, 0xb0, 0xe0, 0xe1, 0xc6, 0xf7, 0x34, 0x50, 0x72, 0xbd, 0xe0, 0x3e, 0x8b, 0x14, 0xf5,
-	0x43, 0xf4, 0x0a, 0x8e, 0x55, 0x5a, 0x90, 0x80, 0x06, 0x22, 0x8a, 0x27, 0x28, 0xe0, 0x46, 0x06,
-	0x7f, 0x31, 0x28, 0x7a, 0x04, 0x25, 0x4f, 0x38, 0x84, 0x2f, 0x63, 0x5f, 0x35, 0x5c, 0xd4, 0xd5,
-	0xc5, 0x12, 0xbd, 0xdf, 0xbf, 0xb6, 0x3a, 0x7c, 0xba, 0x75, 0xbc, 0xb7, 0xb3, 0xbc, 0xa3, 0xdf,
-	0x16, 0xd4, 0x37, 0xe8, 0xa5, 0x70, 0xb0, 0x10, 0xea, 0xf6, 0x56, 0xda, 0x50, 0x91, 0xba, 0x81,
-	0x98, 0x05, 0x24, 0x6e, 0xca, 0x06, 0x30, 0xfb, 0x31, 0x0f, 0x95, 0x64, 0x8c, 0x44, 0xfc, 0xfb,
-	0xc6, 0x50, 0x01, 0x97, 0x0d, 0x60, 0xeb, 0x7a, 0xd7, 0xed, 0xdd, 0xdb, 0xbb, 0xcd, 0x4d, 0x5f,
-	0xcc, 0x4f, 0xff, 0x12, 0xea, 0xf1, 0x65, 0x92, 0x7d, 0xe3, 0x11, 0x17, 0x41, 0xab, 0x14, 0x5f,
-	0x58, 0x33, 0x20, 0x4e, 0xb0, 0xee, 0x4f, 0x0b, 0x1a, 0x33, 0x1a, 0x86, 0x4c, 0xce, 0x98, 0xa2,
-	0x4b, 0xaa, 0x28, 0xea, 0x42, 0x3d, 0x12, 0x2b, 0x79, 0xcd, 0x48, 0xa2, 0x6a, 0xc5, 0xaa, 0xd5,
-	0x0d, 0x78, 0x19, 0x6b, 0x7f, 0x84, 0xb6, 0xcb, 0x1d, 0x57, 0x0f, 0x4e, 0xbe, 0xae, 0xb4, 0x29,
-	0xa2, 0xdf, 0xd8, 0xd0, 0x63, 0x8a, 0x2d, 0x49, 0xc4, 0x6e, 0xe2, 0xb9, 0x0b, 0xb8, 0x95, 0x50,
-	0xce, 0x0c, 0x63, 0x92, 0x12, 0x6c, 0x76, 0x83, 0xa6, 0xf0, 0x2c, 0x6d, 0x0f, 0xa9, 0x54, 0x9c,
-	0x1e, 0x4a, 0x6c, 0xb6, 0xd3, 0x49, 0x68, 0xf3, 0x94, 0x95, 0x97, 0xe9, 0xfe, 0xc9, 0x62, 0xd2,
-	0x23, 0xfc, 0xc7, 0x98, 0xde, 0x42, 0xd9, 0x4f, 0xb6, 0x91, 0xbc, 0x36, 0xad, 0x6d, 0x10, 0xbb,
-	0xdb, 0xc2, 0x19, 0xf3, 0x9f, 0xf2, 0xf3, 0x69, 0x98, 0xcb, 0x4f, 0x57, 0x7a, 0xc7, 0x2f, 0xa0,
-	0x66, 0xe0, 0xbd, 0xf8, 0xaa, 0x1a, 0x4b, 0xd3, 0xeb, 0x0d, 0xe0, 0xf1, 0x42, 0xa7, 0x69, 0x4c,
-	0x33, 0x39, 0x97, 0x8c, 0xfb, 0xd4, 0x61, 0x8b, 0x75, 0x68, 0x34, 0xef, 0xe3, 0xb3, 0x09, 0x19,
-	0x7d, 0x18, 0x0d, 0xc9, 0x1c, 0x4f, 0x2f, 0x66, 0xe3, 0xcf, 0xd3, 0xe6, 0x51, 0xef, 0x04, 0xd0,
-	0xe1, 0x27, 0x8f, 0x2a, 0x50, 0x9c, 0x4e, 0x4e, 0xed, 0x71, 0xf3, 0x08, 0xdd, 0x83, 0x02, 0xd6,
-	0x07, 0xab, 0xd7, 0x86, 0xfa, 0xce, 0x27, 0x8d, 0x00, 0x4a, 0xf6, 0xf9, 0x78, 0xf8, 0x6e, 0xd4,
-	0x3c, 0xba, 0x2a, 0xc5, 0xff, 0xa0, 0x37, 0x7f, 0x03, 0x00, 0x00, 0xff, 0xff, 0x69, 0x4c, 0x6d,
-	0xe8, 0xb0, 0x04, 0x00, 0x00,
+	// 1276 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xac, 0x56, 0xdd, 0x6e, 0xdb, 0xb6,
+	0x17, 0x8f, 0xec, 0xc4, 0x1f, 0xc7, 0xb2, 0xad, 0xb0, 0x4d, 0xab, 0x3f, 0xda, 0x3f, 0xe6, 0xb9,
+	0xdb, 0xea, 0x19, 0x43, 0x82, 0x7a, 0x4b, 0x86, 0x62, 0xe8, 0x06, 0xc1, 0x56, 0x12, 0x2f, 0xb6,
+	0x63, 0x50, 0x6e, 0x8b, 0xed, 0x62, 0x02, 0x6b, 0xb1, 0xb2, 0x10, 0xd9, 0x52, 0x25, 0x26, 0xad,
+	0xfa, 0x04, 0xbb, 0xdb, 0x13, 0x6d, 0xef, 0xb2, 0xbb, 0x3d, 0xc6, 0x40, 0x4a, 0xb2, 0xa5, 0x66,
+	0x05, 0x9a, 0x75, 0x77, 0xe4, 0xef, 0x77, 0xce, 0xe1, 0xe1, 0xf9, 0x22, 0xe1, 0x4b, 0xdb, 0x61,
+	0x8b, 0xcb, 0x17, 0xfb, 0x73, 0x6f, 0x79, 0x60, 0x7b, 0x9e, 0xed, 0xd2, 0x03, 0x16, 0x38, 0xae,
+	0xeb, 0x90, 0xd5, 0x7a, 0xb1, 0xef, 0x07, 0x1e, 0xf3, 0x50, 0x25, 0xdd, 0xb7, 0x7f, 0x2d, 0xc1,
+	0xf6, 0x2c, 0xa0, 0x14, 0xdd, 0x85, 0x32, 0x0b, 0x28, 0x35, 0x1d, 0x4b, 0x95, 0x5a, 0x52, 0xa7,
+	0x88, 0x4b, 0x7c, 0x3b, 0xb4, 0xd0, 0x01, 0x54, 0x05, 0xc1, 0x22, 0x9f, 0xaa, 0x85, 0x96, 0xd4,
+	0x69, 0xf4, 0xd0, 0xfe, 0xda, 0x1e, 0xd7, 0x9d, 0x45, 0x3e, 0xc5, 0x15, 0x96, 0xac, 0x50, 0x0f,
+	0x40, 0x28, 0x84, 0x8c, 0x30, 0xaa, 0x16, 0x85, 0xc6, 0xad, 0xbc, 0x86, 0xc1, 0x29, 0x5c, 0x65,
+	0xe9, 0x12, 0x7d, 0x0f, 0x8d, 0x05, 0x09, 0x17, 0x26, 0x71, 0x6d, 0x2f, 0x70, 0xd8, 0x62, 0xa9,
+	0x6e, 0x0b, 0xbd, 0xbb, 0x1b, 0xbd, 0x53, 0x12, 0x2e, 0xb4, 0x94, 0xc6, 0xf5, 0x45, 0x76, 0x8b,
+	0xbe, 0x03, 0x01, 0x98, 0x21, 0x0b, 0x08, 0xa3, 0x76, 0xa4, 0xee, 0x08, 0xf5, 0x3b, 0x79, 0x75,
+	0x23, 0x61, 0xb1, 0xbc, 0xc8, 0xec, 0xd0, 0x18, 0x6e, 0x85, 0x8e, 0xbd, 0x22, 0xec, 0x32, 0xa0,
+	0x19, 0x0f, 0x4a, 0xc2, 0xc4, 0xfd, 0x8d, 0x09, 0x23, 0x15, 0xda, 0xb8, 0x81, 0xc2, 0x6b, 0x18,
+	0xda, 0x83, 0xd2, 0x05, 0x8d, 0x78, 0x20, 0xcb, 0x2d, 0xa9, 0x53, 0xc5, 0x3b, 0x17, 0x34, 0x1a,
+	0x5a, 0xe8, 0x08, 0xee, 0x12, 0xd7, 0xf5, 0x5e, 0x87, 0xa6, 0x75, 0xe9, 0xbb, 0xce, 0x9c, 0x30,
+	0x6a, 0xba, 0x94, 0x5c, 0xd1, 0x50, 0xad, 0xb4, 0xa4, 0x4e, 0x05, 0xef, 0xc5, 0xf4, 0x20, 0x65,
+	0x47, 0x82, 0x44, 0x1d, 0x50, 0x5c, 0x4a, 0x5e, 0x9a, 0xe2, 0x7e, 0x7e, 0x40, 0x5f, 0x3a, 0x6f,
+	0xd4, 0x6a, 0x4b, 0xea, 0xc8, 0xb8, 0xc1, 0x71, 0x7e, 0xaf, 0xa9, 0x40, 0xb9, 0xe4, 0xca, 0xb3,
+	0x68, 0x4e, 0x12, 0x62, 0x49, 0x8e, 0x67, 0x24, 0x55, 0x28, 0x5b, 0xd4, 0xa5, 0x8c, 0x5a, 0x6a,
+	0x4d, 0x9c, 0x9d, 0x6e, 0x51, 0x17, 0x76, 0xe3, 0xa5, 0xc9, 0x9c, 0x25, 0x35, 0x57, 0x64, 0xe5,
+	0x85, 0xaa, 0x2c, 0x0a, 0xa2, 0x19, 0x13, 0x33, 0x67, 0x49, 0x27, 0x1c, 0x46, 0x03, 0x50, 0x36,
+	0x57, 0xf1, 0x3d, 0xd7, 0x99, 0x47, 0x6a, 0x5d, 0x04, 0xed, 0x7f, 0x9b, 0xa0, 0xad, 0xaf, 0x33,
+	0x15, 0x02, 0xb8, 0x69, 0xe5, 0x01, 0xf4, 0x7f, 0x80, 0x25, 0xf1, 0xe3, 0xcc, 0x11, 0xb5, 0xd1,
+	0x2a, 0x76, 0x76, 0x70, 0x75, 0x49, 0x7c, 0x91, 0x1e, 0x82, 0x3e, 0x87, 0xed, 0x0b, 0x1a, 0x85,
+	0x6a, 0xb3, 0x55, 0xec, 0xd4, 0x7a, 0xbb, 0xf9, 0x3a, 0x3a, 0xa3, 0x11, 0x16, 0x34, 0xd2, 0xa0,
+	0xce, 0xad, 0x04, 0x94, 0xd1, 0x15, 0x73, 0xbc, 0x95, 0xaa, 0xb4, 0xa4, 0x4e, 0x2d, 0x9b, 0xbd,
+	0x31, 0xf1, 0x71, 0xca, 0x26, 0xbe, 0xc8, 0xcb, 0x0c, 0xd6, 0x26, 0x80, 0xae, 0xcb, 0xa0, 0x07,
+	0xdc, 0xf0, 0x1b, 0x33, 0xa0, 0x57, 0x4e, 0xe8, 0x78, 0xab, 0x30, 0xe9, 0x0e, 0x79, 0x49, 0xde,
+	0xe0, 0x14, 0x43, 0x5f, 0x40, 0x93, 0x0b, 0x11, 0x9b, 0x9a, 0x21, 0x9d, 0x7b, 0x2b, 0x2b, 0x14,
+	0x9d, 0x52, 0xc4, 0x5c, 0x57, 0xb3, 0xa9, 0x11, 0x83, 0xed, 0x2b, 0x28, 0x27, 0x6e, 0x67, 0xaa,
+	0x44, 0xca, 0x56, 0xc9, 0x67, 0xd0, 0xf0, 0x2f, 0x5f, 0xb8, 0xce, 0xdc, 0xe4, 0xac, 0x45, 0x03,
+	0x61, 0x48, 0xc6, 0x72, 0x8c, 0x9e, 0xd1, 0x68, 0x40, 0x03, 0xb4, 0x0f, 0xb7, 0xc8, 0x9c, 0x39,
+	0x57, 0x24, 0x9f, 0xa7, 0xa2, 0x38, 0x73, 0x37, 0xa5, 0xd6, 0x99, 0x6a, 0xff, 0x21, 0x41, 0x73,
+	0xe0, 0xd8, 0x0e, 0x23, 0xae, 0x1b, 0xf1, 0x32, 0xa6, 0xd6, 0xfb, 0xaa, 0x5e, 0xfa, 0x97, 0x55,
+	0x7f, 0xbd, 0x83, 0x0b, 0x37, 0xea, 0xe0, 0xfb, 0x50, 0x5d, 0x5b, 0x15, 0x17, 0x91, 0xf1, 0x06,
+	0x68, 0xff, 0x26, 0xc1, 0xed, 0xd8, 0x6f, 0x7d, 0xc5, 0x82, 0x88, 0xdf, 0x2c, 0x64, 0x64, 0xe9,
+	0xa3, 0x87, 0xd0, 0x64, 0xe9, 0x26, 0x89, 0x42, 0x9c, 0xa0, 0xc6, 0x1a, 0x8e, 0x8b, 0x75, 0x0f,
+	0x4a, 0xae, 0x67, 0xf3, 0x78, 0xc7, 0x01, 0xdd, 0x71, 0x3d, 0x7b, 0x68, 0xa1, 0x6f, 0xdf, 0x3d,
+	0xb6, 0x96, 0x2b, 0xde, 0x7c, 0xcc, 0xb2, 0x1e, 0xfd, 0x59, 0x80, 0x7a, 0x8c, 0x8e, 0x3c, 0x1b,
+	0x7b, 0x1e, 0xfb, 0x70, 0x57, 0xee, 0x41, 0x35, 0xf0, 0x3c, 0x26, 0xfa, 0x34, 0xf1, 0xa6, 0xc2,
+	0x01, 0x1e, 0x1f, 0x4e, 0xc6, 0xd3, 0xd3, 0x79, 0x4b, 0x93, 0x84, 0x8a, 0xd1, 0x6a, 0x38, 0x6f,
+	0x69, 0xde, 0xdb, 0xed, 0x0f, 0xf7, 0x36, 0x73, 0xfb, 0x9d, 0xec, 0xed, 0x1f, 0x40, 0x5d, 0x1c,
+	0x96, 0x56, 0xb7, 0x98, 0x79, 0x45, 0x2c, 0x73, 0x30, 0xad, 0x6e, 0xf4, 0x18, 0xe4, 0xb9, 0xb7,
+	0x36, 0x15, 0xaa, 0x65, 0xd1, 0x89, 0x7b, 0x9b, 0x73, 0xfb, 0x1b, 0x16, 0xe7, 0x44, 0xd1, 0x13,
+	0x68, 0xf0, 0x32, 0xce, 0x28, 0x57, 0x84, 0x72, 0x66, 0x2e, 0x9f, 0xd1, 0x68, 0x5d, 0x61, 0xb8,
+	0x7e, 0x91, 0xd9, 0x85, 0xed, 0x5f, 0x40, 0xce, 0xd2, 0xef, 0xeb, 0x99, 0x5c, 0x54, 0x0a, 0x37,
+	0xc8, 0x21, 0x85, 0x5a, 0xc6, 0x77, 0x3e, 0x89, 0x5e, 0x3b, 0x6c, 0x45, 0xc3, 0x70, 0x73, 0x44,
+	0x35, 0x41, 0x3e, 0xe6, 0x98, 0xbf, 0x24, 0x68, 0x8c, 0x89, 0xef, 0xd3, 0x60, 0x4c, 0x19, 0xb1,
+	0xf8, 0x54, 0x6b, 0x43, 0x3d, 0xf4, 0x2e, 0x83, 0x39, 0x35, 0x93, 0xb4, 0x48, 0x22, 0x2d, 0xb5,
+	0x18, 0x1c, 0x89, 0xe4, 0x3c, 0x81, 0x7b, 0x0b, 0xc7, 0x5e, 0xd0, 0x90, 0x99, 0x2f, 0x2f, 0x5d,
+	0x37, 0x32, 0xe7, 0xde, 0xd2, 0x17, 0x53, 0xda, 0x0c, 0xe9, 0xab, 0x64, 0xc0, 0xa8, 0x89, 0xc8,
+	0x31, 0x97, 0xe8, 0xa7, 0x02, 0x06, 0x7d, 0x85, 0x74, 0xf8, 0x24, 0x55, 0xf7, 0x49, 0xc0, 0x1c,
+	0x72, 0xdd, 0x44, 0x5c, 0x5e, 0xf7, 0x13, 0xb1, 0x69, 0x2a, 0x95, 0x33, 0xf3, 0x15, 0xa0, 0xb4,
+	0x3a, 0xf8, 0x8b, 0x1e, 0x30, 0xa1, 0xb9, 0x2d, 0x34, 0x95, 0x94, 0x31, 0x38, 0x61, 0xd0, 0x57,
+	0xed, 0xdf, 0xd7, 0x5d, 0xc1, 0x47, 0xe9, 0x7f, 0xd7, 0x15, 0xdf, 0x40, 0x65, 0x99, 0xc4, 0x2e,
+	0xe9, 0x52, 0x35, 0x37, 0xd9, 0x33, 0xb1, 0xc5, 0x6b, 0xc9, 0x8f, 0x6a, 0x17, 0xfe, 0x9a, 0x6c,
+	0xda, 0x65, 0x49, 0xfc, 0xa1, 0x85, 0x3e, 0x05, 0x39, 0x7e, 0x64, 0x72, 0xdd, 0x52, 0x13, 0xaf,
+	0x48, 0x0c, 0xfd, 0x43, 0xc5, 0x97, 0x6f, 0x50, 0xf1, 0xdd, 0x03, 0xb8, 0xc3, 0x1f, 0x08, 0x7e,
+	0x67, 0x1a, 0x4c, 0x03, 0xea, 0x2c, 0x89, 0x1d, 0xff, 0xaa, 0xf6, 0x60, 0x17, 0x1f, 0xf7, 0xcd,
+	0xa3, 0xc7, 0x47, 0x3d, 0x73, 0x8a, 0xf5, 0xe1, 0x58, 0x3b, 0xd1, 0x95, 0xad, 0xee, 0x00, 0xd0,
+	0xf5, 0x01, 0x8d, 0xaa, 0xb0, 0xa3, 0xf7, 0x07, 0x86, 0xa6, 0x6c, 0xa1, 0x32, 0x14, 0xb1, 0xa1,
+	0x29, 0x12, 0xaa, 0x43, 0x75, 0x76, 0x8a, 0x75, 0xe3, 0xf4, 0x7c, 0x34, 0x50, 0x0a, 0xa8, 0x06,
+	0x65, 0x7d, 0xd0, 0x3b, 0x3c, 0x7c, 0xf4, 0x58, 0x29, 0x76, 0x1f, 0x42, 0x3d, 0x37, 0x9c, 0x11,
+	0x40, 0xc9, 0x38, 0xd5, 0x7a, 0x87, 0x47, 0xca, 0x56, 0xb2, 0x3e, 0x7c, 0xd4, 0x53, 0xa4, 0xee,
+	0x0f, 0x20, 0x67, 0x3f, 0x52, 0xdc, 0x0a, 0x3e, 0xee, 0x73, 0xa7, 0x94, 0x2d, 0xd4, 0x00, 0x88,
+	0x05, 0x4d, 0xae, 0x28, 0x21, 0x04, 0x8d, 0xd1, 0x50, 0x37, 0x33, 0x58, 0xa1, 0x7b, 0x02, 0x95,
+	0xf4, 0xcb, 0xc8, 0xaf, 0xf4, 0x74, 0x72, 0x36, 0x39, 0x7f, 0x3e, 0x31, 0x67, 0x58, 0xd7, 0xcd,
+	0xd9, 0x4f, 0x53, 0x3d, 0xf6, 0x78, 0x74, 0x7e, 0xa2, 0x48, 0x7c, 0x31, 0xd6, 0xa6, 0x4a, 0x81,
+	0x1b, 0x9a, 0x62, 0xfd, 0x1c, 0x0f, 0x74, 0xac, 0x0f, 0x4c, 0x4e, 0x16, 0xbb, 0xcf, 0xa1, 0xba,
+	0xfe, 0x49, 0xa2, 0x3b, 0x80, 0x72, 0x96, 0x8c, 0x99, 0x36, 0xd3, 0x63, 0xd7, 0xb5, 0xfe, 0x6c,
+	0xf8, 0x4c, 0x57, 0x24, 0xbe, 0x3e, 0xc6, 0xe7, 0x3f, 0xeb, 0x13, 0xa5, 0x80, 0x64, 0xa8, 0x0c,
+	0xb0, 0x36, 0x9c, 0x0c, 0x27, 0x27, 0x4a, 0x91, 0xef, 0x34, 0xdc, 0x3f, 0x1d, 0x3e, 0xd3, 0x07,
+	0xca, 0x76, 0x77, 0x06, 0xcd, 0x77, 0xfe, 0x2c, 0xe8, 0x36, 0x28, 0x63, 0x1d, 0x9f, 0xe8, 0xe6,
+	0xe0, 0xe9, 0x74, 0x34, 0xec, 0x6b, 0x33, 0xdd, 0x50, 0xb6, 0x44, 0x46, 0xf4, 0x1f, 0xf5, 0xfe,
+	0x2c, 0x0b, 0x4b, 0x5c, 0x58, 0x1b, 0x8d, 0xce, 0x9f, 0x67, 0xd1, 0xc2, 0x8b, 0x92, 0xf8, 0x78,
+	0x7f, 0xfd, 0xf7, 0x00, 0x9c, 0x36, 0xa3, 0x79, 0xa5, 0x0b, 0x00, 0x00,
 }
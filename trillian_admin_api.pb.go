@@ -0,0 +1,853 @@
+// Code generated by protoc-gen-go.
+// source: github.com/google/trillian/trillian_admin_api.proto
+// DO NOT EDIT!
+
+package trillian
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// QuotaGroup is the set of requests that a quota limits.
+type QuotaGroup int32
+
+const (
+	// Every request to the server.
+	QuotaGroup_GLOBAL QuotaGroup = 0
+	// The requests for one tree.
+	QuotaGroup_TREE QuotaGroup = 1
+	// The requests made by one user, who is identified by their TLS client
+	// certificate or else by their address.
+	QuotaGroup_USER QuotaGroup = 2
+)
+
+var QuotaGroup_name = map[int32]string{
+	0: "GLOBAL",
+	1: "TREE",
+	2: "USER",
+}
+var QuotaGroup_value = map[string]int32{
+	"GLOBAL": 0,
+	"TREE":   1,
+	"USER":   2,
+}
+
+func (x QuotaGroup) String() string {
+	return proto.EnumName(QuotaGroup_name, int32(x))
+}
+func (QuotaGroup) EnumDescriptor() ([]byte, []int) { return fileDescriptor2, []int{0} }
+
+// QuotaKind separates the quotas for requests which read and write trees.
+type QuotaKind int32
+
+const (
+	QuotaKind_READ  QuotaKind = 0
+	QuotaKind_WRITE QuotaKind = 1
+)
+
+var QuotaKind_name = map[int32]string{
+	0: "READ",
+	1: "WRITE",
+}
+var QuotaKind_value = map[string]int32{
+	"READ":  0,
+	"WRITE": 1,
+}
+
+func (x QuotaKind) String() string {
+	return proto.EnumName(QuotaKind_name, int32(x))
+}
+func (QuotaKind) EnumDescriptor() ([]byte, []int) { return fileDescriptor2, []int{1} }
+
+type CreateTreeRequest struct {
+	// The tree to create. If its tree_id is zero an unused one is chosen. The
+	// tree_state is ignored, new trees are active.
+	Tree *Tree `protobuf:"bytes,1,opt,name=tree" json:"tree,omitempty"`
+}
+
+func (m *CreateTreeRequest) Reset()                    { *m = CreateTreeRequest{} }
+func (m *CreateTreeRequest) String() string            { return proto.CompactTextString(m) }
+func (*CreateTreeRequest) ProtoMessage()               {}
+func (*CreateTreeRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{0} }
+
+func (m *CreateTreeRequest) GetTree() *Tree {
+	if m != nil {
+		return m.Tree
+	}
+	return nil
+}
+
+type CreateTreeResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	Tree   *Tree              `protobuf:"bytes,2,opt,name=tree" json:"tree,omitempty"`
+}
+
+func (m *CreateTreeResponse) Reset()                    { *m = CreateTreeResponse{} }
+func (m *CreateTreeResponse) String() string            { return proto.CompactTextString(m) }
+func (*CreateTreeResponse) ProtoMessage()               {}
+func (*CreateTreeResponse) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{1} }
+
+func (m *CreateTreeResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *CreateTreeResponse) GetTree() *Tree {
+	if m != nil {
+		return m.Tree
+	}
+	return nil
+}
+
+type GetTreeRequest struct {
+	TreeId int64 `protobuf:"varint,1,opt,name=tree_id,json=treeId" json:"tree_id,omitempty"`
+}
+
+func (m *GetTreeRequest) Reset()                    { *m = GetTreeRequest{} }
+func (m *GetTreeRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetTreeRequest) ProtoMessage()               {}
+func (*GetTreeRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{2} }
+
+type GetTreeResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	Tree   *Tree              `protobuf:"bytes,2,opt,name=tree" json:"tree,omitempty"`
+}
+
+func (m *GetTreeResponse) Reset()                    { *m = GetTreeResponse{} }
+func (m *GetTreeResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetTreeResponse) ProtoMessage()               {}
+func (*GetTreeResponse) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{3} }
+
+func (m *GetTreeResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *GetTreeResponse) GetTree() *Tree {
+	if m != nil {
+		return m.Tree
+	}
+	return nil
+}
+
+type ListTreesRequest struct {
+	// If set, soft deleted trees are listed too.
+	ShowDeleted bool `protobuf:"varint,1,opt,name=show_deleted,json=showDeleted" json:"show_deleted,omitempty"`
+}
+
+func (m *ListTreesRequest) Reset()                    { *m = ListTreesRequest{} }
+func (m *ListTreesRequest) String() string            { return proto.CompactTextString(m) }
+func (*ListTreesRequest) ProtoMessage()               {}
+func (*ListTreesRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{4} }
+
+type ListTreesResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	// The trees, ordered by tree ID.
+	Tree []*Tree `protobuf:"bytes,2,rep,name=tree" json:"tree,omitempty"`
+}
+
+func (m *ListTreesResponse) Reset()                    { *m = ListTreesResponse{} }
+func (m *ListTreesResponse) String() string            { return proto.CompactTextString(m) }
+func (*ListTreesResponse) ProtoMessage()               {}
+func (*ListTreesResponse) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{5} }
+
+func (m *ListTreesResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *ListTreesResponse) GetTree() []*Tree {
+	if m != nil {
+		return m.Tree
+	}
+	return nil
+}
+
+type UpdateTreeRequest struct {
+	TreeId int64 `protobuf:"varint,1,opt,name=tree_id,json=treeId" json:"tree_id,omitempty"`
+	// The new key ID of the tree, or empty to leave it unchanged. Roots signed
+	// before the change are still signed with the old key.
+	KeyId string `protobuf:"bytes,2,opt,name=key_id,json=keyId" json:"key_id,omitempty"`
+	// The new state of the tree, or UNKNOWN_TREE_STATE to leave it unchanged.
+	TreeState TreeState `protobuf:"varint,3,opt,name=tree_state,json=treeState,enum=trillian.TreeState" json:"tree_state,omitempty"`
+	// When key_id starts signing the tree's roots, or zero for now. It can't be
+	// earlier than now or than the activation of the tree's other keys. Until
+	// then roots are signed with both the tree's current key and key_id.
+	KeyActivateTimeNanos int64 `protobuf:"varint,4,opt,name=key_activate_time_nanos,json=keyActivateTimeNanos" json:"key_activate_time_nanos,omitempty"`
+	// The new retention policy of a map, or unset to leave it unchanged.
+	MapRetention *MapRetentionPolicy `protobuf:"bytes,5,opt,name=map_retention,json=mapRetention" json:"map_retention,omitempty"`
+}
+
+func (m *UpdateTreeRequest) Reset()                    { *m = UpdateTreeRequest{} }
+func (m *UpdateTreeRequest) String() string            { return proto.CompactTextString(m) }
+func (*UpdateTreeRequest) ProtoMessage()               {}
+func (*UpdateTreeRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{6} }
+
+func (m *UpdateTreeRequest) GetMapRetention() *MapRetentionPolicy {
+	if m != nil {
+		return m.MapRetention
+	}
+	return nil
+}
+
+type UpdateTreeResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	Tree   *Tree              `protobuf:"bytes,2,opt,name=tree" json:"tree,omitempty"`
+}
+
+func (m *UpdateTreeResponse) Reset()                    { *m = UpdateTreeResponse{} }
+func (m *UpdateTreeResponse) String() string            { return proto.CompactTextString(m) }
+func (*UpdateTreeResponse) ProtoMessage()               {}
+func (*UpdateTreeResponse) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{7} }
+
+func (m *UpdateTreeResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *UpdateTreeResponse) GetTree() *Tree {
+	if m != nil {
+		return m.Tree
+	}
+	return nil
+}
+
+type DeleteTreeRequest struct {
+	TreeId int64 `protobuf:"varint,1,opt,name=tree_id,json=treeId" json:"tree_id,omitempty"`
+}
+
+func (m *DeleteTreeRequest) Reset()                    { *m = DeleteTreeRequest{} }
+func (m *DeleteTreeRequest) String() string            { return proto.CompactTextString(m) }
+func (*DeleteTreeRequest) ProtoMessage()               {}
+func (*DeleteTreeRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{8} }
+
+type DeleteTreeResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	// The deleted tree.
+	Tree *Tree `protobuf:"bytes,2,opt,name=tree" json:"tree,omitempty"`
+}
+
+func (m *DeleteTreeResponse) Reset()                    { *m = DeleteTreeResponse{} }
+func (m *DeleteTreeResponse) String() string            { return proto.CompactTextString(m) }
+func (*DeleteTreeResponse) ProtoMessage()               {}
+func (*DeleteTreeResponse) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{9} }
+
+func (m *DeleteTreeResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *DeleteTreeResponse) GetTree() *Tree {
+	if m != nil {
+		return m.Tree
+	}
+	return nil
+}
+
+type UndeleteTreeRequest struct {
+	TreeId int64 `protobuf:"varint,1,opt,name=tree_id,json=treeId" json:"tree_id,omitempty"`
+}
+
+func (m *UndeleteTreeRequest) Reset()                    { *m = UndeleteTreeRequest{} }
+func (m *UndeleteTreeRequest) String() string            { return proto.CompactTextString(m) }
+func (*UndeleteTreeRequest) ProtoMessage()               {}
+func (*UndeleteTreeRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{10} }
+
+type UndeleteTreeResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	Tree   *Tree              `protobuf:"bytes,2,opt,name=tree" json:"tree,omitempty"`
+}
+
+func (m *UndeleteTreeResponse) Reset()                    { *m = UndeleteTreeResponse{} }
+func (m *UndeleteTreeResponse) String() string            { return proto.CompactTextString(m) }
+func (*UndeleteTreeResponse) ProtoMessage()               {}
+func (*UndeleteTreeResponse) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{11} }
+
+func (m *UndeleteTreeResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *UndeleteTreeResponse) GetTree() *Tree {
+	if m != nil {
+		return m.Tree
+	}
+	return nil
+}
+
+// QuotaLimit limits the tokens that requests can be charged. Tokens are
+// refilled at tokens_per_second, up to burst tokens. Each server enforces the
+// limits separately.
+type QuotaLimit struct {
+	Group QuotaGroup `protobuf:"varint,1,opt,name=group,enum=trillian.QuotaGroup" json:"group,omitempty"`
+	Kind  QuotaKind  `protobuf:"varint,2,opt,name=kind,enum=trillian.QuotaKind" json:"kind,omitempty"`
+	// The tree a TREE limit is for, or zero for the limit of every tree without
+	// its own.
+	TreeId int64 `protobuf:"varint,3,opt,name=tree_id,json=treeId" json:"tree_id,omitempty"`
+	// The user a USER limit is for, or empty for the limit of every user without
+	// their own.
+	User            string  `protobuf:"bytes,4,opt,name=user" json:"user,omitempty"`
+	TokensPerSecond float64 `protobuf:"fixed64,5,opt,name=tokens_per_second,json=tokensPerSecond" json:"tokens_per_second,omitempty"`
+	Burst           int64   `protobuf:"varint,6,opt,name=burst" json:"burst,omitempty"`
+}
+
+func (m *QuotaLimit) Reset()                    { *m = QuotaLimit{} }
+func (m *QuotaLimit) String() string            { return proto.CompactTextString(m) }
+func (*QuotaLimit) ProtoMessage()               {}
+func (*QuotaLimit) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{12} }
+
+type ListQuotaLimitsRequest struct {
+}
+
+func (m *ListQuotaLimitsRequest) Reset()                    { *m = ListQuotaLimitsRequest{} }
+func (m *ListQuotaLimitsRequest) String() string            { return proto.CompactTextString(m) }
+func (*ListQuotaLimitsRequest) ProtoMessage()               {}
+func (*ListQuotaLimitsRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{13} }
+
+type ListQuotaLimitsResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	Limit  []*QuotaLimit      `protobuf:"bytes,2,rep,name=limit" json:"limit,omitempty"`
+}
+
+func (m *ListQuotaLimitsResponse) Reset()                    { *m = ListQuotaLimitsResponse{} }
+func (m *ListQuotaLimitsResponse) String() string            { return proto.CompactTextString(m) }
+func (*ListQuotaLimitsResponse) ProtoMessage()               {}
+func (*ListQuotaLimitsResponse) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{14} }
+
+func (m *ListQuotaLimitsResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *ListQuotaLimitsResponse) GetLimit() []*QuotaLimit {
+	if m != nil {
+		return m.Limit
+	}
+	return nil
+}
+
+type SetQuotaLimitRequest struct {
+	// The limit to set, replacing any with the same group, kind, tree and user.
+	Limit *QuotaLimit `protobuf:"bytes,1,opt,name=limit" json:"limit,omitempty"`
+}
+
+func (m *SetQuotaLimitRequest) Reset()                    { *m = SetQuotaLimitRequest{} }
+func (m *SetQuotaLimitRequest) String() string            { return proto.CompactTextString(m) }
+func (*SetQuotaLimitRequest) ProtoMessage()               {}
+func (*SetQuotaLimitRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{15} }
+
+func (m *SetQuotaLimitRequest) GetLimit() *QuotaLimit {
+	if m != nil {
+		return m.Limit
+	}
+	return nil
+}
+
+type SetQuotaLimitResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+}
+
+func (m *SetQuotaLimitResponse) Reset()                    { *m = SetQuotaLimitResponse{} }
+func (m *SetQuotaLimitResponse) String() string            { return proto.CompactTextString(m) }
+func (*SetQuotaLimitResponse) ProtoMessage()               {}
+func (*SetQuotaLimitResponse) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{16} }
+
+func (m *SetQuotaLimitResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+type DeleteQuotaLimitRequest struct {
+	Group  QuotaGroup `protobuf:"varint,1,opt,name=group,enum=trillian.QuotaGroup" json:"group,omitempty"`
+	Kind   QuotaKind  `protobuf:"varint,2,opt,name=kind,enum=trillian.QuotaKind" json:"kind,omitempty"`
+	TreeId int64      `protobuf:"varint,3,opt,name=tree_id,json=treeId" json:"tree_id,omitempty"`
+	User   string     `protobuf:"bytes,4,opt,name=user" json:"user,omitempty"`
+}
+
+func (m *DeleteQuotaLimitRequest) Reset()                    { *m = DeleteQuotaLimitRequest{} }
+func (m *DeleteQuotaLimitRequest) String() string            { return proto.CompactTextString(m) }
+func (*DeleteQuotaLimitRequest) ProtoMessage()               {}
+func (*DeleteQuotaLimitRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{17} }
+
+type DeleteQuotaLimitResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+}
+
+func (m *DeleteQuotaLimitResponse) Reset()                    { *m = DeleteQuotaLimitResponse{} }
+func (m *DeleteQuotaLimitResponse) String() string            { return proto.CompactTextString(m) }
+func (*DeleteQuotaLimitResponse) ProtoMessage()               {}
+func (*DeleteQuotaLimitResponse) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{18} }
+
+func (m *DeleteQuotaLimitResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*CreateTreeRequest)(nil), "trillian.CreateTreeRequest")
+	proto.RegisterType((*CreateTreeResponse)(nil), "trillian.CreateTreeResponse")
+	proto.RegisterType((*GetTreeRequest)(nil), "trillian.GetTreeRequest")
+	proto.RegisterType((*GetTreeResponse)(nil), "trillian.GetTreeResponse")
+	proto.RegisterType((*ListTreesRequest)(nil), "trillian.ListTreesRequest")
+	proto.RegisterType((*ListTreesResponse)(nil), "trillian.ListTreesResponse")
+	proto.RegisterType((*UpdateTreeRequest)(nil), "trillian.UpdateTreeRequest")
+	proto.RegisterType((*UpdateTreeResponse)(nil), "trillian.UpdateTreeResponse")
+	proto.RegisterType((*DeleteTreeRequest)(nil), "trillian.DeleteTreeRequest")
+	proto.RegisterType((*DeleteTreeResponse)(nil), "trillian.DeleteTreeResponse")
+	proto.RegisterType((*UndeleteTreeRequest)(nil), "trillian.UndeleteTreeRequest")
+	proto.RegisterType((*UndeleteTreeResponse)(nil), "trillian.UndeleteTreeResponse")
+	proto.RegisterType((*QuotaLimit)(nil), "trillian.QuotaLimit")
+	proto.RegisterType((*ListQuotaLimitsRequest)(nil), "trillian.ListQuotaLimitsRequest")
+	proto.RegisterType((*ListQuotaLimitsResponse)(nil), "trillian.ListQuotaLimitsResponse")
+	proto.RegisterType((*SetQuotaLimitRequest)(nil), "trillian.SetQuotaLimitRequest")
+	proto.RegisterType((*SetQuotaLimitResponse)(nil), "trillian.SetQuotaLimitResponse")
+	proto.RegisterType((*DeleteQuotaLimitRequest)(nil), "trillian.DeleteQuotaLimitRequest")
+	proto.RegisterType((*DeleteQuotaLimitResponse)(nil), "trillian.DeleteQuotaLimitResponse")
+	proto.RegisterEnum("trillian.QuotaGroup", QuotaGroup_name, QuotaGroup_value)
+	proto.RegisterEnum("trillian.QuotaKind", QuotaKind_name, QuotaKind_value)
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion3
+
+// Client API for TrillianAdmin service
+
+type TrillianAdminClient interface {
+	ListTrees(ctx context.Context, in *ListTreesRequest, opts ...grpc.CallOption) (*ListTreesResponse, error)
+	GetTree(ctx context.Context, in *GetTreeRequest, opts ...grpc.CallOption) (*GetTreeResponse, error)
+	CreateTree(ctx context.Context, in *CreateTreeRequest, opts ...grpc.CallOption) (*CreateTreeResponse, error)
+	// UpdateTree changes the parameters of a tree that can be changed while
+	// it's in use, which are its key ID, state and a map's retention policy.
+	// Deleted trees can't be updated.
+	UpdateTree(ctx context.Context, in *UpdateTreeRequest, opts ...grpc.CallOption) (*UpdateTreeResponse, error)
+	// DeleteTree soft deletes a tree, so it's no longer served. Its data is kept
+	// for a grace period set on the servers, until then the deletion can be
+	// reversed with UndeleteTree.
+	DeleteTree(ctx context.Context, in *DeleteTreeRequest, opts ...grpc.CallOption) (*DeleteTreeResponse, error)
+	UndeleteTree(ctx context.Context, in *UndeleteTreeRequest, opts ...grpc.CallOption) (*UndeleteTreeResponse, error)
+	// Quota limits are stored with the trees. Changes take effect at once on
+	// the server handling the request, and on others when they next reload them.
+	ListQuotaLimits(ctx context.Context, in *ListQuotaLimitsRequest, opts ...grpc.CallOption) (*ListQuotaLimitsResponse, error)
+	SetQuotaLimit(ctx context.Context, in *SetQuotaLimitRequest, opts ...grpc.CallOption) (*SetQuotaLimitResponse, error)
+	// DeleteQuotaLimit removes a limit. Requests it applied to are then limited
+	// by the default for their tree or user if there is one.
+	DeleteQuotaLimit(ctx context.Context, in *DeleteQuotaLimitRequest, opts ...grpc.CallOption) (*DeleteQuotaLimitResponse, error)
+}
+
+type trillianAdminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewTrillianAdminClient(cc *grpc.ClientConn) TrillianAdminClient {
+	return &trillianAdminClient{cc}
+}
+
+func (c *trillianAdminClient) ListTrees(ctx context.Context, in *ListTreesRequest, opts ...grpc.CallOption) (*ListTreesResponse, error) {
+	out := new(ListTreesResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianAdmin/ListTrees", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianAdminClient) GetTree(ctx context.Context, in *GetTreeRequest, opts ...grpc.CallOption) (*GetTreeResponse, error) {
+	out := new(GetTreeResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianAdmin/GetTree", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianAdminClient) CreateTree(ctx context.Context, in *CreateTreeRequest, opts ...grpc.CallOption) (*CreateTreeResponse, error) {
+	out := new(CreateTreeResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianAdmin/CreateTree", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianAdminClient) UpdateTree(ctx context.Context, in *UpdateTreeRequest, opts ...grpc.CallOption) (*UpdateTreeResponse, error) {
+	out := new(UpdateTreeResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianAdmin/UpdateTree", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianAdminClient) DeleteTree(ctx context.Context, in *DeleteTreeRequest, opts ...grpc.CallOption) (*DeleteTreeResponse, error) {
+	out := new(DeleteTreeResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianAdmin/DeleteTree", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianAdminClient) UndeleteTree(ctx context.Context, in *UndeleteTreeRequest, opts ...grpc.CallOption) (*UndeleteTreeResponse, error) {
+	out := new(UndeleteTreeResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianAdmin/UndeleteTree", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianAdminClient) ListQuotaLimits(ctx context.Context, in *ListQuotaLimitsRequest, opts ...grpc.CallOption) (*ListQuotaLimitsResponse, error) {
+	out := new(ListQuotaLimitsResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianAdmin/ListQuotaLimits", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianAdminClient) SetQuotaLimit(ctx context.Context, in *SetQuotaLimitRequest, opts ...grpc.CallOption) (*SetQuotaLimitResponse, error) {
+	out := new(SetQuotaLimitResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianAdmin/SetQuotaLimit", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianAdminClient) DeleteQuotaLimit(ctx context.Context, in *DeleteQuotaLimitRequest, opts ...grpc.CallOption) (*DeleteQuotaLimitResponse, error) {
+	out := new(DeleteQuotaLimitResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianAdmin/DeleteQuotaLimit", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for TrillianAdmin service
+
+type TrillianAdminServer interface {
+	ListTrees(context.Context, *ListTreesRequest) (*ListTreesResponse, error)
+	GetTree(context.Context, *GetTreeRequest) (*GetTreeResponse, error)
+	CreateTree(context.Context, *CreateTreeRequest) (*CreateTreeResponse, error)
+	// UpdateTree changes the parameters of a tree that can be changed while
+	// it's in use, which are its key ID, state and a map's retention policy.
+	// Deleted trees can't be updated.
+	UpdateTree(context.Context, *UpdateTreeRequest) (*UpdateTreeResponse, error)
+	// DeleteTree soft deletes a tree, so it's no longer served. Its data is kept
+	// for a grace period set on the servers, until then the deletion can be
+	// reversed with UndeleteTree.
+	DeleteTree(context.Context, *DeleteTreeRequest) (*DeleteTreeResponse, error)
+	UndeleteTree(context.Context, *UndeleteTreeRequest) (*UndeleteTreeResponse, error)
+	// Quota limits are stored with the trees. Changes take effect at once on
+	// the server handling the request, and on others when they next reload them.
+	ListQuotaLimits(context.Context, *ListQuotaLimitsRequest) (*ListQuotaLimitsResponse, error)
+	SetQuotaLimit(context.Context, *SetQuotaLimitRequest) (*SetQuotaLimitResponse, error)
+	// DeleteQuotaLimit removes a limit. Requests it applied to are then limited
+	// by the default for their tree or user if there is one.
+	DeleteQuotaLimit(context.Context, *DeleteQuotaLimitRequest) (*DeleteQuotaLimitResponse, error)
+}
+
+func RegisterTrillianAdminServer(s *grpc.Server, srv TrillianAdminServer) {
+	s.RegisterService(&_TrillianAdmin_serviceDesc, srv)
+}
+
+func _TrillianAdmin_ListTrees_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTreesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianAdminServer).ListTrees(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianAdmin/ListTrees",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianAdminServer).ListTrees(ctx, req.(*ListTreesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianAdmin_GetTree_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTreeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianAdminServer).GetTree(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianAdmin/GetTree",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianAdminServer).GetTree(ctx, req.(*GetTreeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianAdmin_CreateTree_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTreeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianAdminServer).CreateTree(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianAdmin/CreateTree",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianAdminServer).CreateTree(ctx, req.(*CreateTreeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianAdmin_UpdateTree_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateTreeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianAdminServer).UpdateTree(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianAdmin/UpdateTree",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianAdminServer).UpdateTree(ctx, req.(*UpdateTreeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianAdmin_DeleteTree_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTreeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianAdminServer).DeleteTree(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianAdmin/DeleteTree",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianAdminServer).DeleteTree(ctx, req.(*DeleteTreeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianAdmin_UndeleteTree_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UndeleteTreeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianAdminServer).UndeleteTree(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianAdmin/UndeleteTree",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianAdminServer).UndeleteTree(ctx, req.(*UndeleteTreeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianAdmin_ListQuotaLimits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListQuotaLimitsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianAdminServer).ListQuotaLimits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianAdmin/ListQuotaLimits",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianAdminServer).ListQuotaLimits(ctx, req.(*ListQuotaLimitsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianAdmin_SetQuotaLimit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetQuotaLimitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianAdminServer).SetQuotaLimit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianAdmin/SetQuotaLimit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianAdminServer).SetQuotaLimit(ctx, req.(*SetQuotaLimitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianAdmin_DeleteQuotaLimit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteQuotaLimitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianAdminServer).DeleteQuotaLimit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianAdmin/DeleteQuotaLimit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianAdminServer).DeleteQuotaLimit(ctx, req.(*DeleteQuotaLimitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _TrillianAdmin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "trillian.TrillianAdmin",
+	HandlerType: (*TrillianAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListTrees",
+			Handler:    _TrillianAdmin_ListTrees_Handler,
+		},
+		{
+			MethodName: "GetTree",
+			Handler:    _TrillianAdmin_GetTree_Handler,
+		},
+		{
+			MethodName: "CreateTree",
+			Handler:    _TrillianAdmin_CreateTree_Handler,
+		},
+		{
+			MethodName: "UpdateTree",
+			Handler:    _TrillianAdmin_UpdateTree_Handler,
+		},
+		{
+			MethodName: "DeleteTree",
+			Handler:    _TrillianAdmin_DeleteTree_Handler,
+		},
+		{
+			MethodName: "UndeleteTree",
+			Handler:    _TrillianAdmin_UndeleteTree_Handler,
+		},
+		{
+			MethodName: "ListQuotaLimits",
+			Handler:    _TrillianAdmin_ListQuotaLimits_Handler,
+		},
+		{
+			MethodName: "SetQuotaLimit",
+			Handler:    _TrillianAdmin_SetQuotaLimit_Handler,
+		},
+		{
+			MethodName: "DeleteQuotaLimit",
+			Handler:    _TrillianAdmin_DeleteQuotaLimit_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: fileDescriptor2,
+}
+
+func init() {
+	proto.RegisterFile("github.com/google/trillian/trillian_admin_api.proto", fileDescriptor2)
+}
+
+var fileDescriptor2 = []byte{
+	// 836 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xc4, 0x56, 0xdd, 0x8e, 0xe2, 0x36,
+	0x14, 0x9e, 0xec, 0x00, 0x3b, 0x9c, 0x9d, 0x1f, 0xf0, 0x32, 0x9d, 0x6c, 0x96, 0xb6, 0x4c, 0x6e,
+	0xba, 0x8b, 0xb6, 0xac, 0xc4, 0x74, 0xd5, 0xdb, 0x42, 0x97, 0x8e, 0x50, 0x69, 0x87, 0x1a, 0x46,
+	0xad, 0xd4, 0x8b, 0x28, 0x43, 0x2c, 0xd6, 0x85, 0xc4, 0x69, 0x62, 0x5a, 0xd1, 0x57, 0xe9, 0x4b,
+	0xf5, 0xaa, 0xef, 0xd1, 0x37, 0xa8, 0xec, 0x90, 0xc4, 0x21, 0x80, 0x90, 0xa6, 0xa8, 0x77, 0x8e,
+	0xbf, 0xef, 0x7c, 0xe7, 0xb3, 0x73, 0x7c, 0x6c, 0xb8, 0x99, 0x52, 0xfe, 0x61, 0xf1, 0xd0, 0x9a,
+	0x30, 0xf7, 0xed, 0x94, 0xb1, 0xe9, 0x9c, 0xbc, 0xe5, 0x01, 0x9d, 0xcf, 0xa9, 0xed, 0x25, 0x03,
+	0xcb, 0x76, 0x5c, 0xea, 0x59, 0xb6, 0x4f, 0x5b, 0x7e, 0xc0, 0x38, 0x43, 0x27, 0x31, 0x62, 0x7c,
+	0xbe, 0x57, 0x78, 0x1c, 0x68, 0xbc, 0xde, 0x83, 0x1e, 0x51, 0xcd, 0x2f, 0xa1, 0xfa, 0x75, 0x40,
+	0x6c, 0x4e, 0xc6, 0x01, 0x21, 0x98, 0xfc, 0xba, 0x20, 0x21, 0x47, 0x26, 0x14, 0x78, 0x40, 0x88,
+	0xae, 0x35, 0xb4, 0x57, 0xcf, 0xda, 0xe7, 0xad, 0x24, 0x46, 0x92, 0x24, 0x66, 0xba, 0x80, 0xd4,
+	0xc0, 0xd0, 0x67, 0x5e, 0x48, 0xd0, 0x0d, 0x94, 0x42, 0x6e, 0xf3, 0x45, 0xb8, 0x8a, 0x7d, 0xa9,
+	0xc6, 0x46, 0x83, 0x8e, 0x4f, 0x47, 0x92, 0x82, 0x57, 0xd4, 0x24, 0xdd, 0x93, 0x1d, 0xe9, 0x5e,
+	0xc3, 0xf9, 0x2d, 0xe1, 0xaa, 0xc9, 0x2b, 0x78, 0x2a, 0x10, 0x8b, 0x3a, 0x32, 0xd7, 0x31, 0x2e,
+	0x89, 0xcf, 0xbe, 0x63, 0xfe, 0x02, 0x17, 0x09, 0xf5, 0xd0, 0xb6, 0xde, 0x41, 0x65, 0x40, 0x43,
+	0x99, 0x2c, 0x8c, 0x8d, 0x5d, 0xc3, 0x69, 0xf8, 0x81, 0xfd, 0x6e, 0x39, 0x64, 0x4e, 0x38, 0x89,
+	0xdc, 0x9d, 0xe0, 0x67, 0x62, 0xee, 0x7d, 0x34, 0x65, 0xce, 0xa1, 0xaa, 0x84, 0xfd, 0x37, 0x26,
+	0x8f, 0xb7, 0x9a, 0xfc, 0x47, 0x83, 0xea, 0xbd, 0xef, 0xac, 0xfd, 0xe4, 0x6d, 0xfb, 0x87, 0x2e,
+	0xa1, 0x34, 0x23, 0x4b, 0x31, 0x2f, 0x56, 0x5e, 0xc6, 0xc5, 0x19, 0x59, 0xf6, 0x1d, 0xd4, 0x06,
+	0x90, 0x7c, 0x91, 0x98, 0xe8, 0xc7, 0x0d, 0xed, 0xd5, 0x79, 0xfb, 0x79, 0x36, 0x9f, 0xf0, 0x46,
+	0x70, 0x99, 0xc7, 0x43, 0xf4, 0x0e, 0xae, 0x84, 0x94, 0x3d, 0xe1, 0xf4, 0x37, 0x9b, 0x13, 0x8b,
+	0x53, 0x97, 0x58, 0x9e, 0xed, 0xb1, 0x50, 0x2f, 0xc8, 0x9c, 0xb5, 0x19, 0x59, 0x76, 0x56, 0xe8,
+	0x98, 0xba, 0xe4, 0x7b, 0x81, 0xa1, 0x0e, 0x9c, 0xb9, 0xb6, 0x6f, 0x05, 0x84, 0x13, 0x8f, 0x53,
+	0xe6, 0xe9, 0x45, 0xb9, 0x21, 0xf5, 0x34, 0xdb, 0x77, 0xb6, 0x8f, 0x63, 0x74, 0xc8, 0xe6, 0x74,
+	0xb2, 0xc4, 0xa7, 0xae, 0x32, 0x27, 0xca, 0x53, 0x5d, 0xf2, 0xa1, 0xeb, 0xe0, 0x0d, 0x54, 0xa3,
+	0x7f, 0xbb, 0x57, 0x85, 0xba, 0x80, 0x54, 0xf6, 0xa1, 0xcd, 0xb5, 0xe0, 0xf9, 0xbd, 0xe7, 0xec,
+	0x6f, 0x8f, 0x41, 0x2d, 0xcb, 0x3f, 0xb4, 0xc1, 0xbf, 0x34, 0x80, 0x1f, 0x16, 0x8c, 0xdb, 0x03,
+	0xea, 0x52, 0x8e, 0x9a, 0x50, 0x9c, 0x06, 0x6c, 0xe1, 0xcb, 0x34, 0xe7, 0xed, 0x5a, 0x1a, 0x23,
+	0x49, 0xb7, 0x02, 0xc3, 0x11, 0x05, 0x7d, 0x06, 0x85, 0x19, 0xf5, 0xa2, 0x52, 0xcd, 0xd4, 0xa3,
+	0xa4, 0x7e, 0x4b, 0x3d, 0x07, 0x4b, 0x82, 0xba, 0xda, 0xe3, 0x4c, 0xb9, 0x23, 0x28, 0x2c, 0x42,
+	0x12, 0xc8, 0x82, 0x2c, 0x63, 0x39, 0x46, 0x4d, 0xa8, 0x72, 0x36, 0x23, 0x5e, 0x68, 0xf9, 0x24,
+	0xb0, 0x42, 0x32, 0x61, 0x9e, 0x23, 0x8b, 0x50, 0xc3, 0x17, 0x11, 0x30, 0x24, 0xc1, 0x48, 0x4e,
+	0xa3, 0x1a, 0x14, 0x1f, 0x16, 0x41, 0xc8, 0xf5, 0x92, 0x94, 0x8d, 0x3e, 0x4c, 0x1d, 0x3e, 0x12,
+	0x27, 0x3c, 0x5d, 0x55, 0xdc, 0x1e, 0xcc, 0x3f, 0xe0, 0x2a, 0x87, 0x3c, 0x66, 0x83, 0x9b, 0x50,
+	0x9c, 0x0b, 0x99, 0x55, 0x0b, 0x58, 0xdf, 0x2d, 0x99, 0x02, 0x47, 0x14, 0xb3, 0x0b, 0xb5, 0x11,
+	0x51, 0x52, 0xc7, 0xa5, 0x90, 0x68, 0x44, 0x79, 0x77, 0x6a, 0x0c, 0xe0, 0x72, 0x4d, 0xe3, 0x11,
+	0xee, 0xcd, 0x3f, 0x35, 0xb8, 0x8a, 0xce, 0xc2, 0x46, 0x57, 0xff, 0x6f, 0x1d, 0x98, 0x77, 0xa0,
+	0xe7, 0xcd, 0x3d, 0x62, 0xb9, 0xcd, 0x37, 0x00, 0xa9, 0x77, 0x04, 0x50, 0xba, 0x1d, 0xdc, 0x75,
+	0x3b, 0x83, 0xca, 0x11, 0x3a, 0x81, 0xc2, 0x18, 0xf7, 0x7a, 0x15, 0x4d, 0x8c, 0xee, 0x47, 0x3d,
+	0x5c, 0x79, 0xd2, 0x6c, 0x40, 0x39, 0xb1, 0x2f, 0xa6, 0x71, 0xaf, 0xf3, 0xbe, 0x72, 0x84, 0xca,
+	0x50, 0xfc, 0x11, 0xf7, 0xc7, 0xbd, 0x8a, 0xd6, 0xfe, 0xbb, 0x08, 0x67, 0x49, 0x36, 0xf1, 0x7c,
+	0x40, 0xdf, 0x40, 0x39, 0xb9, 0x5a, 0x90, 0x91, 0x7a, 0x5a, 0xbf, 0xa6, 0x8c, 0x97, 0x1b, 0xb1,
+	0x68, 0x71, 0xe6, 0x11, 0xfa, 0x0a, 0x9e, 0xae, 0x6e, 0x51, 0xa4, 0xa7, 0xcc, 0xec, 0x1d, 0x6c,
+	0xbc, 0xd8, 0x80, 0x24, 0x0a, 0x7d, 0x80, 0xf4, 0x85, 0x80, 0x94, 0x74, 0xb9, 0x07, 0x87, 0x51,
+	0xdf, 0x0c, 0xaa, 0x52, 0x69, 0x37, 0x57, 0xa5, 0x72, 0xd7, 0x9a, 0x51, 0xdf, 0x0c, 0xaa, 0x52,
+	0x69, 0xef, 0x55, 0xa5, 0x72, 0xfd, 0xdb, 0xa8, 0x6f, 0x06, 0x13, 0xa9, 0x3b, 0x38, 0x55, 0xfb,
+	0x24, 0xfa, 0x58, 0x49, 0x9d, 0xef, 0xb7, 0xc6, 0x27, 0xdb, 0xe0, 0x44, 0xf0, 0x27, 0xb8, 0x58,
+	0x6b, 0x0d, 0xa8, 0x91, 0xfd, 0x4b, 0xf9, 0x7e, 0x62, 0x5c, 0xef, 0x60, 0x24, 0xca, 0x18, 0xce,
+	0x32, 0x87, 0x16, 0x29, 0x66, 0x36, 0x75, 0x04, 0xe3, 0xd3, 0xad, 0x78, 0xa2, 0xf9, 0x33, 0x54,
+	0xd6, 0x0f, 0x07, 0xba, 0x5e, 0xdf, 0xb2, 0xbc, 0xb2, 0xb9, 0x8b, 0x12, 0x8b, 0x77, 0xbf, 0x80,
+	0x17, 0x13, 0xe6, 0xb6, 0xa2, 0xd7, 0x6b, 0x2b, 0xfb, 0x68, 0xed, 0x5e, 0x66, 0x4a, 0xbe, 0xe3,
+	0xd3, 0xa1, 0x98, 0x1e, 0x6a, 0x0f, 0x25, 0x89, 0xdf, 0xfc, 0x3b, 0x00, 0xf8, 0xd1, 0xfd, 0x68,
+	0x6f, 0x0b, 0x00, 0x00,
+}
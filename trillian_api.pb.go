@@ -8,6 +8,7 @@ Package trillian is a generated protocol buffer package.
 It is generated from these files:
 	github.com/google/trillian/trillian_api.proto
 	github.com/google/trillian/trillian.proto
+	github.com/google/trillian/trillian_admin_api.proto
 
 It has these top-level messages:
 	TrillianApiStatus
@@ -15,43 +16,108 @@ It has these top-level messages:
 	NodeProto
 	ProofProto
 	QueueLeavesRequest
+	QueuedLeaf
 	QueueLeavesResponse
+	AddSequencedLeavesRequest
+	AddSequencedLeavesResponse
 	GetInclusionProofRequest
 	GetInclusionProofResponse
 	GetInclusionProofByHashRequest
 	GetInclusionProofByHashResponse
+	GetInclusionProofBatchRequest
+	GetInclusionProofBatchResponse
 	GetConsistencyProofRequest
 	GetConsistencyProofResponse
 	GetLeavesByHashRequest
 	GetLeavesByHashResponse
 	GetLeavesByIndexRequest
 	GetLeavesByIndexResponse
+	GetLeavesByRangeRequest
+	GetLeavesByRangeResponse
 	GetSequencedLeafCountRequest
 	GetSequencedLeafCountResponse
 	GetLatestSignedLogRootRequest
 	GetLatestSignedLogRootResponse
+	GetTreeKeysRequest
+	GetTreeKeysResponse
+	GetLatestCheckpointRequest
+	GetLatestCheckpointResponse
+	AddLogRootCosignatureRequest
+	AddLogRootCosignatureResponse
 	GetEntryAndProofRequest
 	GetEntryAndProofResponse
+	GetLeafIndexRangeByTimeRequest
+	GetLeafIndexRangeByTimeResponse
+	InitLogRequest
+	InitLogResponse
 	MapLeaf
 	KeyValue
 	KeyValueInclusion
 	GetMapLeavesRequest
 	GetMapLeavesResponse
+	MapLeafProof
+	GetMapLeavesWithProofResponse
 	SetMapLeavesRequest
 	SetMapLeavesResponse
 	GetSignedMapRootRequest
 	GetSignedMapRootResponse
+	GetSignedMapRootByRevisionRequest
+	InitMapRequest
+	InitMapResponse
+	PublishMapRevisionRequest
+	PublishMapRevisionResponse
+	AbandonMapRevisionRequest
+	AbandonMapRevisionResponse
+	MapLeafUpdate
+	GetMapUpdateProofRequest
+	GetMapUpdateProofResponse
+	ListMapLeavesRequest
+	ListMapLeavesResponse
+	TagMapRevisionRequest
+	TagMapRevisionResponse
+	GetMapRevisionTagsRequest
+	MapRevisionTag
+	GetMapRevisionTagsResponse
+	AddCheckpointRequest
+	AddCheckpointResponse
+	GetWitnessedRootRequest
+	GetWitnessedRootResponse
+	Tree
+	MapRetentionPolicy
+	TreeKey
 	DigitallySigned
 	SignedEntryTimestamp
 	SignedLogRoot
+	KeySignature
+	Cosignature
 	MapperMetadata
 	SignedMapRoot
+	CreateTreeRequest
+	CreateTreeResponse
+	GetTreeRequest
+	GetTreeResponse
+	ListTreesRequest
+	ListTreesResponse
+	UpdateTreeRequest
+	UpdateTreeResponse
+	DeleteTreeRequest
+	DeleteTreeResponse
+	UndeleteTreeRequest
+	UndeleteTreeResponse
+	QuotaLimit
+	ListQuotaLimitsRequest
+	ListQuotaLimitsResponse
+	SetQuotaLimitRequest
+	SetQuotaLimitResponse
+	DeleteQuotaLimitRequest
+	DeleteQuotaLimitResponse
 */
 package trillian
 
 import proto "github.com/golang/protobuf/proto"
 import fmt "fmt"
 import math "math"
+import _ "google.golang.org/genproto/googleapis/api/annotations"
 
 import (
 	context "golang.org/x/net/context"
@@ -91,6 +157,41 @@ func (x TrillianApiStatusCode) String() string {
 }
 func (TrillianApiStatusCode) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
 
+type QueuedLeaf_Status int32
+
+const (
+	// The leaf was queued.
+	QueuedLeaf_OK QueuedLeaf_Status = 0
+	// The leaf is already in the log, or queued, and the log merges
+	// duplicates, so it wasn't queued again. The leaf returned is the
+	// existing one, whose leaf_index is -1 if it hasn't been sequenced yet.
+	QueuedLeaf_DUPLICATE QueuedLeaf_Status = 1
+	// The leaf was over the tree's or the caller's write quota, so it wasn't
+	// queued. It can be submitted again later.
+	QueuedLeaf_QUOTA_EXCEEDED QueuedLeaf_Status = 2
+	// The leaf is already in the log, or queued, and the log rejects
+	// duplicates. The leaf returned is the one submitted.
+	QueuedLeaf_DUPLICATE_REJECTED QueuedLeaf_Status = 3
+)
+
+var QueuedLeaf_Status_name = map[int32]string{
+	0: "OK",
+	1: "DUPLICATE",
+	2: "QUOTA_EXCEEDED",
+	3: "DUPLICATE_REJECTED",
+}
+var QueuedLeaf_Status_value = map[string]int32{
+	"OK":                 0,
+	"DUPLICATE":          1,
+	"QUOTA_EXCEEDED":     2,
+	"DUPLICATE_REJECTED": 3,
+}
+
+func (x QueuedLeaf_Status) String() string {
+	return proto.EnumName(QueuedLeaf_Status_name, int32(x))
+}
+func (QueuedLeaf_Status) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{5, 0} }
+
 // All operations return a TrillianApiStatus.
 // TODO(Martin2112): Most of the operations are not fully defined yet. They will be implemented soon
 type TrillianApiStatus struct {
@@ -111,6 +212,9 @@ type LeafProto struct {
 	LeafData  []byte `protobuf:"bytes,2,opt,name=leaf_data,json=leafData,proto3" json:"leaf_data,omitempty"`
 	ExtraData []byte `protobuf:"bytes,3,opt,name=extra_data,json=extraData,proto3" json:"extra_data,omitempty"`
 	LeafIndex int64  `protobuf:"varint,4,opt,name=leaf_index,json=leafIndex" json:"leaf_index,omitempty"`
+	// When the leaf was integrated into the log, which is the timestamp of the
+	// first root that includes it. Unset for leaves that haven't been.
+	IntegrateTimestampNanos int64 `protobuf:"varint,5,opt,name=integrate_timestamp_nanos,json=integrateTimestampNanos" json:"integrate_timestamp_nanos,omitempty"`
 }
 
 func (m *LeafProto) Reset()                    { *m = LeafProto{} }
@@ -146,6 +250,7 @@ func (m *ProofProto) GetProofNode() []*NodeProto {
 	return nil
 }
 
+// A QueueLeavesRequest may hold up to 1000 leaves.
 type QueueLeavesRequest struct {
 	LogId  int64        `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
 	Leaves []*LeafProto `protobuf:"bytes,2,rep,name=leaves" json:"leaves,omitempty"`
@@ -163,16 +268,34 @@ func (m *QueueLeavesRequest) GetLeaves() []*LeafProto {
 	return nil
 }
 
-// TODO(Martin2112): This will eventually contain the signed timestamps and stuff that we return for
-// the queued leaves
+// QueuedLeaf is the result of queueing one of the leaves of a QueueLeavesRequest.
+type QueuedLeaf struct {
+	Leaf   *LeafProto        `protobuf:"bytes,1,opt,name=leaf" json:"leaf,omitempty"`
+	Status QueuedLeaf_Status `protobuf:"varint,2,opt,name=status,enum=trillian.QueuedLeaf.Status" json:"status,omitempty"`
+}
+
+func (m *QueuedLeaf) Reset()                    { *m = QueuedLeaf{} }
+func (m *QueuedLeaf) String() string            { return proto.CompactTextString(m) }
+func (*QueuedLeaf) ProtoMessage()               {}
+func (*QueuedLeaf) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *QueuedLeaf) GetLeaf() *LeafProto {
+	if m != nil {
+		return m.Leaf
+	}
+	return nil
+}
+
 type QueueLeavesResponse struct {
 	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	// The result for each leaf of the request, in the same order.
+	QueuedLeaves []*QueuedLeaf `protobuf:"bytes,2,rep,name=queued_leaves,json=queuedLeaves" json:"queued_leaves,omitempty"`
 }
 
 func (m *QueueLeavesResponse) Reset()                    { *m = QueueLeavesResponse{} }
 func (m *QueueLeavesResponse) String() string            { return proto.CompactTextString(m) }
 func (*QueueLeavesResponse) ProtoMessage()               {}
-func (*QueueLeavesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+func (*QueueLeavesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
 
 func (m *QueueLeavesResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -181,6 +304,60 @@ func (m *QueueLeavesResponse) GetStatus() *TrillianApiStatus {
 	return nil
 }
 
+func (m *QueueLeavesResponse) GetQueuedLeaves() []*QueuedLeaf {
+	if m != nil {
+		return m.QueuedLeaves
+	}
+	return nil
+}
+
+// An AddSequencedLeavesRequest adds leaves to a PREORDERED_LOG at their
+// leaf_index, which must be contiguous and in order. It may hold up to 1000
+// leaves.
+type AddSequencedLeavesRequest struct {
+	LogId  int64        `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+	Leaves []*LeafProto `protobuf:"bytes,2,rep,name=leaves" json:"leaves,omitempty"`
+}
+
+func (m *AddSequencedLeavesRequest) Reset()                    { *m = AddSequencedLeavesRequest{} }
+func (m *AddSequencedLeavesRequest) String() string            { return proto.CompactTextString(m) }
+func (*AddSequencedLeavesRequest) ProtoMessage()               {}
+func (*AddSequencedLeavesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *AddSequencedLeavesRequest) GetLeaves() []*LeafProto {
+	if m != nil {
+		return m.Leaves
+	}
+	return nil
+}
+
+type AddSequencedLeavesResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	// The result for each leaf of the request, in the same order: OK if it was
+	// added, or DUPLICATE if the same leaf was already at its index, in which
+	// case the existing leaf is returned.
+	Results []*QueuedLeaf `protobuf:"bytes,2,rep,name=results" json:"results,omitempty"`
+}
+
+func (m *AddSequencedLeavesResponse) Reset()                    { *m = AddSequencedLeavesResponse{} }
+func (m *AddSequencedLeavesResponse) String() string            { return proto.CompactTextString(m) }
+func (*AddSequencedLeavesResponse) ProtoMessage()               {}
+func (*AddSequencedLeavesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *AddSequencedLeavesResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *AddSequencedLeavesResponse) GetResults() []*QueuedLeaf {
+	if m != nil {
+		return m.Results
+	}
+	return nil
+}
+
 type GetInclusionProofRequest struct {
 	LogId     int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
 	LeafIndex int64 `protobuf:"varint,2,opt,name=leaf_index,json=leafIndex" json:"leaf_index,omitempty"`
@@ -190,7 +367,7 @@ type GetInclusionProofRequest struct {
 func (m *GetInclusionProofRequest) Reset()                    { *m = GetInclusionProofRequest{} }
 func (m *GetInclusionProofRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetInclusionProofRequest) ProtoMessage()               {}
-func (*GetInclusionProofRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+func (*GetInclusionProofRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
 
 type GetInclusionProofResponse struct {
 	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
@@ -200,7 +377,7 @@ type GetInclusionProofResponse struct {
 func (m *GetInclusionProofResponse) Reset()                    { *m = GetInclusionProofResponse{} }
 func (m *GetInclusionProofResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetInclusionProofResponse) ProtoMessage()               {}
-func (*GetInclusionProofResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+func (*GetInclusionProofResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
 
 func (m *GetInclusionProofResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -226,19 +403,20 @@ type GetInclusionProofByHashRequest struct {
 func (m *GetInclusionProofByHashRequest) Reset()                    { *m = GetInclusionProofByHashRequest{} }
 func (m *GetInclusionProofByHashRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetInclusionProofByHashRequest) ProtoMessage()               {}
-func (*GetInclusionProofByHashRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+func (*GetInclusionProofByHashRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
 
 type GetInclusionProofByHashResponse struct {
 	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
 	// Logs can potentially contain leaves with duplicate hashes so it's possible
-	// for this to return multiple proofs.
+	// for this to return multiple proofs. Only leaves within tree_size are
+	// proved, each proof giving the index of its leaf.
 	Proof []*ProofProto `protobuf:"bytes,2,rep,name=proof" json:"proof,omitempty"`
 }
 
 func (m *GetInclusionProofByHashResponse) Reset()                    { *m = GetInclusionProofByHashResponse{} }
 func (m *GetInclusionProofByHashResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetInclusionProofByHashResponse) ProtoMessage()               {}
-func (*GetInclusionProofByHashResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+func (*GetInclusionProofByHashResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
 
 func (m *GetInclusionProofByHashResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -254,8 +432,47 @@ func (m *GetInclusionProofByHashResponse) GetProof() []*ProofProto {
 	return nil
 }
 
+type GetInclusionProofBatchRequest struct {
+	LogId int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+	// The leaves to prove, each of which must be within tree_size.
+	LeafIndex []int64 `protobuf:"varint,2,rep,name=leaf_index,json=leafIndex" json:"leaf_index,omitempty"`
+	TreeSize  int64   `protobuf:"varint,3,opt,name=tree_size,json=treeSize" json:"tree_size,omitempty"`
+}
+
+func (m *GetInclusionProofBatchRequest) Reset()                    { *m = GetInclusionProofBatchRequest{} }
+func (m *GetInclusionProofBatchRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetInclusionProofBatchRequest) ProtoMessage()               {}
+func (*GetInclusionProofBatchRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+
+type GetInclusionProofBatchResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	// A proof for each leaf, in the order of the request's leaf_index.
+	Proof []*ProofProto `protobuf:"bytes,2,rep,name=proof" json:"proof,omitempty"`
+}
+
+func (m *GetInclusionProofBatchResponse) Reset()                    { *m = GetInclusionProofBatchResponse{} }
+func (m *GetInclusionProofBatchResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetInclusionProofBatchResponse) ProtoMessage()               {}
+func (*GetInclusionProofBatchResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+
+func (m *GetInclusionProofBatchResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *GetInclusionProofBatchResponse) GetProof() []*ProofProto {
+	if m != nil {
+		return m.Proof
+	}
+	return nil
+}
+
 type GetConsistencyProofRequest struct {
-	LogId          int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+	LogId int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+	// The sizes of the two trees, neither of which may be beyond the current
+	// tree size. If they're equal the proof is empty.
 	FirstTreeSize  int64 `protobuf:"varint,2,opt,name=first_tree_size,json=firstTreeSize" json:"first_tree_size,omitempty"`
 	SecondTreeSize int64 `protobuf:"varint,3,opt,name=second_tree_size,json=secondTreeSize" json:"second_tree_size,omitempty"`
 }
@@ -263,7 +480,7 @@ type GetConsistencyProofRequest struct {
 func (m *GetConsistencyProofRequest) Reset()                    { *m = GetConsistencyProofRequest{} }
 func (m *GetConsistencyProofRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetConsistencyProofRequest) ProtoMessage()               {}
-func (*GetConsistencyProofRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+func (*GetConsistencyProofRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
 
 type GetConsistencyProofResponse struct {
 	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
@@ -273,7 +490,7 @@ type GetConsistencyProofResponse struct {
 func (m *GetConsistencyProofResponse) Reset()                    { *m = GetConsistencyProofResponse{} }
 func (m *GetConsistencyProofResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetConsistencyProofResponse) ProtoMessage()               {}
-func (*GetConsistencyProofResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+func (*GetConsistencyProofResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
 
 func (m *GetConsistencyProofResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -298,7 +515,7 @@ type GetLeavesByHashRequest struct {
 func (m *GetLeavesByHashRequest) Reset()                    { *m = GetLeavesByHashRequest{} }
 func (m *GetLeavesByHashRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetLeavesByHashRequest) ProtoMessage()               {}
-func (*GetLeavesByHashRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+func (*GetLeavesByHashRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{17} }
 
 type GetLeavesByHashResponse struct {
 	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
@@ -308,7 +525,7 @@ type GetLeavesByHashResponse struct {
 func (m *GetLeavesByHashResponse) Reset()                    { *m = GetLeavesByHashResponse{} }
 func (m *GetLeavesByHashResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetLeavesByHashResponse) ProtoMessage()               {}
-func (*GetLeavesByHashResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+func (*GetLeavesByHashResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{18} }
 
 func (m *GetLeavesByHashResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -332,7 +549,7 @@ type GetLeavesByIndexRequest struct {
 func (m *GetLeavesByIndexRequest) Reset()                    { *m = GetLeavesByIndexRequest{} }
 func (m *GetLeavesByIndexRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetLeavesByIndexRequest) ProtoMessage()               {}
-func (*GetLeavesByIndexRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+func (*GetLeavesByIndexRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{19} }
 
 type GetLeavesByIndexResponse struct {
 	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
@@ -342,7 +559,7 @@ type GetLeavesByIndexResponse struct {
 func (m *GetLeavesByIndexResponse) Reset()                    { *m = GetLeavesByIndexResponse{} }
 func (m *GetLeavesByIndexResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetLeavesByIndexResponse) ProtoMessage()               {}
-func (*GetLeavesByIndexResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+func (*GetLeavesByIndexResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{20} }
 
 func (m *GetLeavesByIndexResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -358,6 +575,44 @@ func (m *GetLeavesByIndexResponse) GetLeaves() []*LeafProto {
 	return nil
 }
 
+type GetLeavesByRangeRequest struct {
+	LogId      int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+	StartIndex int64 `protobuf:"varint,2,opt,name=start_index,json=startIndex" json:"start_index,omitempty"`
+	// The number of leaves to return. If zero, all the leaves from start_index
+	// up to the size of the latest signed root are returned.
+	Count int64 `protobuf:"varint,3,opt,name=count" json:"count,omitempty"`
+}
+
+func (m *GetLeavesByRangeRequest) Reset()                    { *m = GetLeavesByRangeRequest{} }
+func (m *GetLeavesByRangeRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetLeavesByRangeRequest) ProtoMessage()               {}
+func (*GetLeavesByRangeRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{21} }
+
+type GetLeavesByRangeResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	// The next leaves of the range, in order of their index.
+	Leaves []*LeafProto `protobuf:"bytes,2,rep,name=leaves" json:"leaves,omitempty"`
+}
+
+func (m *GetLeavesByRangeResponse) Reset()                    { *m = GetLeavesByRangeResponse{} }
+func (m *GetLeavesByRangeResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetLeavesByRangeResponse) ProtoMessage()               {}
+func (*GetLeavesByRangeResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{22} }
+
+func (m *GetLeavesByRangeResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *GetLeavesByRangeResponse) GetLeaves() []*LeafProto {
+	if m != nil {
+		return m.Leaves
+	}
+	return nil
+}
+
 type GetSequencedLeafCountRequest struct {
 	LogId int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
 }
@@ -365,7 +620,7 @@ type GetSequencedLeafCountRequest struct {
 func (m *GetSequencedLeafCountRequest) Reset()                    { *m = GetSequencedLeafCountRequest{} }
 func (m *GetSequencedLeafCountRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetSequencedLeafCountRequest) ProtoMessage()               {}
-func (*GetSequencedLeafCountRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
+func (*GetSequencedLeafCountRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{23} }
 
 type GetSequencedLeafCountResponse struct {
 	Status    *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
@@ -375,7 +630,7 @@ type GetSequencedLeafCountResponse struct {
 func (m *GetSequencedLeafCountResponse) Reset()                    { *m = GetSequencedLeafCountResponse{} }
 func (m *GetSequencedLeafCountResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetSequencedLeafCountResponse) ProtoMessage()               {}
-func (*GetSequencedLeafCountResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{17} }
+func (*GetSequencedLeafCountResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{24} }
 
 func (m *GetSequencedLeafCountResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -391,7 +646,7 @@ type GetLatestSignedLogRootRequest struct {
 func (m *GetLatestSignedLogRootRequest) Reset()                    { *m = GetLatestSignedLogRootRequest{} }
 func (m *GetLatestSignedLogRootRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetLatestSignedLogRootRequest) ProtoMessage()               {}
-func (*GetLatestSignedLogRootRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{18} }
+func (*GetLatestSignedLogRootRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{25} }
 
 type GetLatestSignedLogRootResponse struct {
 	Status        *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
@@ -401,7 +656,7 @@ type GetLatestSignedLogRootResponse struct {
 func (m *GetLatestSignedLogRootResponse) Reset()                    { *m = GetLatestSignedLogRootResponse{} }
 func (m *GetLatestSignedLogRootResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetLatestSignedLogRootResponse) ProtoMessage()               {}
-func (*GetLatestSignedLogRootResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{19} }
+func (*GetLatestSignedLogRootResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{26} }
 
 func (m *GetLatestSignedLogRootResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -417,6 +672,105 @@ func (m *GetLatestSignedLogRootResponse) GetSignedLogRoot() *SignedLogRoot {
 	return nil
 }
 
+type GetTreeKeysRequest struct {
+	TreeId int64 `protobuf:"varint,1,opt,name=tree_id,json=treeId" json:"tree_id,omitempty"`
+}
+
+func (m *GetTreeKeysRequest) Reset()                    { *m = GetTreeKeysRequest{} }
+func (m *GetTreeKeysRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetTreeKeysRequest) ProtoMessage()               {}
+func (*GetTreeKeysRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{27} }
+
+type GetTreeKeysResponse struct {
+	// The keys that have signed or will sign the tree's roots, ordered by
+	// activation time. A root is signed by the last key activated by its
+	// timestamp.
+	Keys []*TreeKey `protobuf:"bytes,1,rep,name=keys" json:"keys,omitempty"`
+}
+
+func (m *GetTreeKeysResponse) Reset()                    { *m = GetTreeKeysResponse{} }
+func (m *GetTreeKeysResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetTreeKeysResponse) ProtoMessage()               {}
+func (*GetTreeKeysResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{28} }
+
+func (m *GetTreeKeysResponse) GetKeys() []*TreeKey {
+	if m != nil {
+		return m.Keys
+	}
+	return nil
+}
+
+type GetLatestCheckpointRequest struct {
+	LogId int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+}
+
+func (m *GetLatestCheckpointRequest) Reset()                    { *m = GetLatestCheckpointRequest{} }
+func (m *GetLatestCheckpointRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetLatestCheckpointRequest) ProtoMessage()               {}
+func (*GetLatestCheckpointRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{29} }
+
+type GetLatestCheckpointResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	// The latest root with its cosignatures, in the checkpoint format read by
+	// checkpoint.Open. Its origin is checkpoint.Origin(log_id), and it's signed
+	// with the log's key.
+	Checkpoint []byte `protobuf:"bytes,2,opt,name=checkpoint,proto3" json:"checkpoint,omitempty"`
+}
+
+func (m *GetLatestCheckpointResponse) Reset()                    { *m = GetLatestCheckpointResponse{} }
+func (m *GetLatestCheckpointResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetLatestCheckpointResponse) ProtoMessage()               {}
+func (*GetLatestCheckpointResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{30} }
+
+func (m *GetLatestCheckpointResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+type AddLogRootCosignatureRequest struct {
+	LogId int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+	// The root that was cosigned, which must be the log's latest root.
+	Root        *SignedLogRoot `protobuf:"bytes,2,opt,name=root" json:"root,omitempty"`
+	Cosignature *Cosignature   `protobuf:"bytes,3,opt,name=cosignature" json:"cosignature,omitempty"`
+}
+
+func (m *AddLogRootCosignatureRequest) Reset()                    { *m = AddLogRootCosignatureRequest{} }
+func (m *AddLogRootCosignatureRequest) String() string            { return proto.CompactTextString(m) }
+func (*AddLogRootCosignatureRequest) ProtoMessage()               {}
+func (*AddLogRootCosignatureRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{31} }
+
+func (m *AddLogRootCosignatureRequest) GetRoot() *SignedLogRoot {
+	if m != nil {
+		return m.Root
+	}
+	return nil
+}
+
+func (m *AddLogRootCosignatureRequest) GetCosignature() *Cosignature {
+	if m != nil {
+		return m.Cosignature
+	}
+	return nil
+}
+
+type AddLogRootCosignatureResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+}
+
+func (m *AddLogRootCosignatureResponse) Reset()                    { *m = AddLogRootCosignatureResponse{} }
+func (m *AddLogRootCosignatureResponse) String() string            { return proto.CompactTextString(m) }
+func (*AddLogRootCosignatureResponse) ProtoMessage()               {}
+func (*AddLogRootCosignatureResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{32} }
+
+func (m *AddLogRootCosignatureResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
 type GetEntryAndProofRequest struct {
 	LogId     int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
 	LeafIndex int64 `protobuf:"varint,2,opt,name=leaf_index,json=leafIndex" json:"leaf_index,omitempty"`
@@ -426,7 +780,7 @@ type GetEntryAndProofRequest struct {
 func (m *GetEntryAndProofRequest) Reset()                    { *m = GetEntryAndProofRequest{} }
 func (m *GetEntryAndProofRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetEntryAndProofRequest) ProtoMessage()               {}
-func (*GetEntryAndProofRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{20} }
+func (*GetEntryAndProofRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{33} }
 
 type GetEntryAndProofResponse struct {
 	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
@@ -437,7 +791,7 @@ type GetEntryAndProofResponse struct {
 func (m *GetEntryAndProofResponse) Reset()                    { *m = GetEntryAndProofResponse{} }
 func (m *GetEntryAndProofResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetEntryAndProofResponse) ProtoMessage()               {}
-func (*GetEntryAndProofResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{21} }
+func (*GetEntryAndProofResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{34} }
 
 func (m *GetEntryAndProofResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -460,6 +814,73 @@ func (m *GetEntryAndProofResponse) GetLeaf() *LeafProto {
 	return nil
 }
 
+type GetLeafIndexRangeByTimeRequest struct {
+	LogId int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+	// The window of integration times, from start inclusive to end exclusive.
+	StartTimestampNanos int64 `protobuf:"varint,2,opt,name=start_timestamp_nanos,json=startTimestampNanos" json:"start_timestamp_nanos,omitempty"`
+	EndTimestampNanos   int64 `protobuf:"varint,3,opt,name=end_timestamp_nanos,json=endTimestampNanos" json:"end_timestamp_nanos,omitempty"`
+}
+
+func (m *GetLeafIndexRangeByTimeRequest) Reset()                    { *m = GetLeafIndexRangeByTimeRequest{} }
+func (m *GetLeafIndexRangeByTimeRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetLeafIndexRangeByTimeRequest) ProtoMessage()               {}
+func (*GetLeafIndexRangeByTimeRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{35} }
+
+type GetLeafIndexRangeByTimeResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	// The leaves integrated in the window are those with indices from begin
+	// inclusive to end exclusive. If there are none both are the index of the
+	// next leaf integrated.
+	BeginIndex int64 `protobuf:"varint,2,opt,name=begin_index,json=beginIndex" json:"begin_index,omitempty"`
+	EndIndex   int64 `protobuf:"varint,3,opt,name=end_index,json=endIndex" json:"end_index,omitempty"`
+}
+
+func (m *GetLeafIndexRangeByTimeResponse) Reset()                    { *m = GetLeafIndexRangeByTimeResponse{} }
+func (m *GetLeafIndexRangeByTimeResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetLeafIndexRangeByTimeResponse) ProtoMessage()               {}
+func (*GetLeafIndexRangeByTimeResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{36} }
+
+func (m *GetLeafIndexRangeByTimeResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+type InitLogRequest struct {
+	LogId int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+}
+
+func (m *InitLogRequest) Reset()                    { *m = InitLogRequest{} }
+func (m *InitLogRequest) String() string            { return proto.CompactTextString(m) }
+func (*InitLogRequest) ProtoMessage()               {}
+func (*InitLogRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{37} }
+
+type InitLogResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	// The signed root of the empty log, with size 0 and revision 0.
+	Created *SignedLogRoot `protobuf:"bytes,2,opt,name=created" json:"created,omitempty"`
+}
+
+func (m *InitLogResponse) Reset()                    { *m = InitLogResponse{} }
+func (m *InitLogResponse) String() string            { return proto.CompactTextString(m) }
+func (*InitLogResponse) ProtoMessage()               {}
+func (*InitLogResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{38} }
+
+func (m *InitLogResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *InitLogResponse) GetCreated() *SignedLogRoot {
+	if m != nil {
+		return m.Created
+	}
+	return nil
+}
+
 // MapLeaf represents the data behind Map leaves.
 type MapLeaf struct {
 	// key_hash is the hash of the key for this leaf.
@@ -475,7 +896,7 @@ type MapLeaf struct {
 func (m *MapLeaf) Reset()                    { *m = MapLeaf{} }
 func (m *MapLeaf) String() string            { return proto.CompactTextString(m) }
 func (*MapLeaf) ProtoMessage()               {}
-func (*MapLeaf) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{22} }
+func (*MapLeaf) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{39} }
 
 type KeyValue struct {
 	Key   []byte   `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
@@ -485,7 +906,7 @@ type KeyValue struct {
 func (m *KeyValue) Reset()                    { *m = KeyValue{} }
 func (m *KeyValue) String() string            { return proto.CompactTextString(m) }
 func (*KeyValue) ProtoMessage()               {}
-func (*KeyValue) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{23} }
+func (*KeyValue) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{40} }
 
 func (m *KeyValue) GetValue() *MapLeaf {
 	if m != nil {
@@ -502,7 +923,7 @@ type KeyValueInclusion struct {
 func (m *KeyValueInclusion) Reset()                    { *m = KeyValueInclusion{} }
 func (m *KeyValueInclusion) String() string            { return proto.CompactTextString(m) }
 func (*KeyValueInclusion) ProtoMessage()               {}
-func (*KeyValueInclusion) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{24} }
+func (*KeyValueInclusion) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{41} }
 
 func (m *KeyValueInclusion) GetKeyValue() *KeyValue {
 	if m != nil {
@@ -515,12 +936,19 @@ type GetMapLeavesRequest struct {
 	MapId    int64    `protobuf:"varint,1,opt,name=map_id,json=mapId" json:"map_id,omitempty"`
 	Key      [][]byte `protobuf:"bytes,2,rep,name=key,proto3" json:"key,omitempty"`
 	Revision int64    `protobuf:"varint,3,opt,name=revision" json:"revision,omitempty"`
+	// If revision_tag is set the leaves are read at the revision it names and
+	// revision is ignored.
+	RevisionTag string `protobuf:"bytes,4,opt,name=revision_tag,json=revisionTag" json:"revision_tag,omitempty"`
+	// If revision is negative and there's no revision_tag, the latest revision
+	// read must be at least min_revision, so that a client sees the revisions it
+	// knows about even if the server reads from a lagging replica.
+	MinRevision int64 `protobuf:"varint,5,opt,name=min_revision,json=minRevision" json:"min_revision,omitempty"`
 }
 
 func (m *GetMapLeavesRequest) Reset()                    { *m = GetMapLeavesRequest{} }
 func (m *GetMapLeavesRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetMapLeavesRequest) ProtoMessage()               {}
-func (*GetMapLeavesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{25} }
+func (*GetMapLeavesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{42} }
 
 type GetMapLeavesResponse struct {
 	Status   *TrillianApiStatus   `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
@@ -531,7 +959,7 @@ type GetMapLeavesResponse struct {
 func (m *GetMapLeavesResponse) Reset()                    { *m = GetMapLeavesResponse{} }
 func (m *GetMapLeavesResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetMapLeavesResponse) ProtoMessage()               {}
-func (*GetMapLeavesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{26} }
+func (*GetMapLeavesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{43} }
 
 func (m *GetMapLeavesResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -554,16 +982,88 @@ func (m *GetMapLeavesResponse) GetMapRoot() *SignedMapRoot {
 	return nil
 }
 
+// MapLeafProof proves the value of a key in a revision of a map, or that the key
+// has no value.
+type MapLeafProof struct {
+	Key []byte `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// The leaf for the key. It's unset if the key has no value, and the proof is
+	// then for the hash of an empty leaf.
+	Leaf *MapLeaf `protobuf:"bytes,2,opt,name=leaf" json:"leaf,omitempty"`
+	// The sibling hashes on the path from the leaf to the root, starting next to
+	// the leaf. An empty entry stands for the hash of an empty subtree.
+	Inclusion [][]byte `protobuf:"bytes,3,rep,name=inclusion,proto3" json:"inclusion,omitempty"`
+}
+
+func (m *MapLeafProof) Reset()                    { *m = MapLeafProof{} }
+func (m *MapLeafProof) String() string            { return proto.CompactTextString(m) }
+func (*MapLeafProof) ProtoMessage()               {}
+func (*MapLeafProof) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{44} }
+
+func (m *MapLeafProof) GetLeaf() *MapLeaf {
+	if m != nil {
+		return m.Leaf
+	}
+	return nil
+}
+
+type GetMapLeavesWithProofResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	// A proof for each key in the request, in the same order.
+	LeafProof []*MapLeafProof `protobuf:"bytes,2,rep,name=leaf_proof,json=leafProof" json:"leaf_proof,omitempty"`
+	// The signed root of the revision that the proofs are for.
+	MapRoot *SignedMapRoot `protobuf:"bytes,3,opt,name=map_root,json=mapRoot" json:"map_root,omitempty"`
+}
+
+func (m *GetMapLeavesWithProofResponse) Reset()                    { *m = GetMapLeavesWithProofResponse{} }
+func (m *GetMapLeavesWithProofResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetMapLeavesWithProofResponse) ProtoMessage()               {}
+func (*GetMapLeavesWithProofResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{45} }
+
+func (m *GetMapLeavesWithProofResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *GetMapLeavesWithProofResponse) GetLeafProof() []*MapLeafProof {
+	if m != nil {
+		return m.LeafProof
+	}
+	return nil
+}
+
+func (m *GetMapLeavesWithProofResponse) GetMapRoot() *SignedMapRoot {
+	if m != nil {
+		return m.MapRoot
+	}
+	return nil
+}
+
 type SetMapLeavesRequest struct {
-	MapId      int64           `protobuf:"varint,1,opt,name=map_id,json=mapId" json:"map_id,omitempty"`
-	KeyValue   []*KeyValue     `protobuf:"bytes,2,rep,name=key_value,json=keyValue" json:"key_value,omitempty"`
+	MapId    int64       `protobuf:"varint,1,opt,name=map_id,json=mapId" json:"map_id,omitempty"`
+	KeyValue []*KeyValue `protobuf:"bytes,2,rep,name=key_value,json=keyValue" json:"key_value,omitempty"`
+	// The mapper metadata of the new root. If unset the current root's is kept.
 	MapperData *MapperMetadata `protobuf:"bytes,3,opt,name=mapper_data,json=mapperData" json:"mapper_data,omitempty"`
+	// If dry_run is set the new root hash is calculated and returned in the
+	// response, but nothing is written to storage and no revision is created.
+	DryRun bool `protobuf:"varint,4,opt,name=dry_run,json=dryRun" json:"dry_run,omitempty"`
+	// If stage is set the leaves and nodes for the new revision are written but
+	// the revision is not published. It must later be published with
+	// PublishMapRevision, or abandoned with AbandonMapRevision, before any further
+	// revisions can be created.
+	Stage bool `protobuf:"varint,5,opt,name=stage" json:"stage,omitempty"`
+	// If revision is set the request fails with FailedPrecondition, and nothing
+	// is written, unless the leaves would be written at that revision. Writers
+	// set it to one more than the revision their update was based on, so that
+	// concurrent updates of the map can't overwrite each other unnoticed.
+	Revision int64 `protobuf:"varint,6,opt,name=revision" json:"revision,omitempty"`
 }
 
 func (m *SetMapLeavesRequest) Reset()                    { *m = SetMapLeavesRequest{} }
 func (m *SetMapLeavesRequest) String() string            { return proto.CompactTextString(m) }
 func (*SetMapLeavesRequest) ProtoMessage()               {}
-func (*SetMapLeavesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{27} }
+func (*SetMapLeavesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{46} }
 
 func (m *SetMapLeavesRequest) GetKeyValue() []*KeyValue {
 	if m != nil {
@@ -587,7 +1087,7 @@ type SetMapLeavesResponse struct {
 func (m *SetMapLeavesResponse) Reset()                    { *m = SetMapLeavesResponse{} }
 func (m *SetMapLeavesResponse) String() string            { return proto.CompactTextString(m) }
 func (*SetMapLeavesResponse) ProtoMessage()               {}
-func (*SetMapLeavesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{28} }
+func (*SetMapLeavesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{47} }
 
 func (m *SetMapLeavesResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -605,12 +1105,14 @@ func (m *SetMapLeavesResponse) GetMapRoot() *SignedMapRoot {
 
 type GetSignedMapRootRequest struct {
 	MapId int64 `protobuf:"varint,1,opt,name=map_id,json=mapId" json:"map_id,omitempty"`
+	// The root returned must be at least min_revision, as for GetMapLeavesRequest.
+	MinRevision int64 `protobuf:"varint,2,opt,name=min_revision,json=minRevision" json:"min_revision,omitempty"`
 }
 
 func (m *GetSignedMapRootRequest) Reset()                    { *m = GetSignedMapRootRequest{} }
 func (m *GetSignedMapRootRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetSignedMapRootRequest) ProtoMessage()               {}
-func (*GetSignedMapRootRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{29} }
+func (*GetSignedMapRootRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{48} }
 
 type GetSignedMapRootResponse struct {
 	Status  *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
@@ -620,7 +1122,7 @@ type GetSignedMapRootResponse struct {
 func (m *GetSignedMapRootResponse) Reset()                    { *m = GetSignedMapRootResponse{} }
 func (m *GetSignedMapRootResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetSignedMapRootResponse) ProtoMessage()               {}
-func (*GetSignedMapRootResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{30} }
+func (*GetSignedMapRootResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{49} }
 
 func (m *GetSignedMapRootResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -636,65 +1138,502 @@ func (m *GetSignedMapRootResponse) GetMapRoot() *SignedMapRoot {
 	return nil
 }
 
-func init() {
-	proto.RegisterType((*TrillianApiStatus)(nil), "trillian.TrillianApiStatus")
-	proto.RegisterType((*LeafProto)(nil), "trillian.LeafProto")
-	proto.RegisterType((*NodeProto)(nil), "trillian.NodeProto")
-	proto.RegisterType((*ProofProto)(nil), "trillian.ProofProto")
-	proto.RegisterType((*QueueLeavesRequest)(nil), "trillian.QueueLeavesRequest")
-	proto.RegisterType((*QueueLeavesResponse)(nil), "trillian.QueueLeavesResponse")
-	proto.RegisterType((*GetInclusionProofRequest)(nil), "trillian.GetInclusionProofRequest")
-	proto.RegisterType((*GetInclusionProofResponse)(nil), "trillian.GetInclusionProofResponse")
-	proto.RegisterType((*GetInclusionProofByHashRequest)(nil), "trillian.GetInclusionProofByHashRequest")
-	proto.RegisterType((*GetInclusionProofByHashResponse)(nil), "trillian.GetInclusionProofByHashResponse")
-	proto.RegisterType((*GetConsistencyProofRequest)(nil), "trillian.GetConsistencyProofRequest")
-	proto.RegisterType((*GetConsistencyProofResponse)(nil), "trillian.GetConsistencyProofResponse")
-	proto.RegisterType((*GetLeavesByHashRequest)(nil), "trillian.GetLeavesByHashRequest")
-	proto.RegisterType((*GetLeavesByHashResponse)(nil), "trillian.GetLeavesByHashResponse")
-	proto.RegisterType((*GetLeavesByIndexRequest)(nil), "trillian.GetLeavesByIndexRequest")
-	proto.RegisterType((*GetLeavesByIndexResponse)(nil), "trillian.GetLeavesByIndexResponse")
-	proto.RegisterType((*GetSequencedLeafCountRequest)(nil), "trillian.GetSequencedLeafCountRequest")
-	proto.RegisterType((*GetSequencedLeafCountResponse)(nil), "trillian.GetSequencedLeafCountResponse")
-	proto.RegisterType((*GetLatestSignedLogRootRequest)(nil), "trillian.GetLatestSignedLogRootRequest")
-	proto.RegisterType((*GetLatestSignedLogRootResponse)(nil), "trillian.GetLatestSignedLogRootResponse")
-	proto.RegisterType((*GetEntryAndProofRequest)(nil), "trillian.GetEntryAndProofRequest")
-	proto.RegisterType((*GetEntryAndProofResponse)(nil), "trillian.GetEntryAndProofResponse")
-	proto.RegisterType((*MapLeaf)(nil), "trillian.MapLeaf")
-	proto.RegisterType((*KeyValue)(nil), "trillian.KeyValue")
-	proto.RegisterType((*KeyValueInclusion)(nil), "trillian.KeyValueInclusion")
-	proto.RegisterType((*GetMapLeavesRequest)(nil), "trillian.GetMapLeavesRequest")
-	proto.RegisterType((*GetMapLeavesResponse)(nil), "trillian.GetMapLeavesResponse")
-	proto.RegisterType((*SetMapLeavesRequest)(nil), "trillian.SetMapLeavesRequest")
-	proto.RegisterType((*SetMapLeavesResponse)(nil), "trillian.SetMapLeavesResponse")
-	proto.RegisterType((*GetSignedMapRootRequest)(nil), "trillian.GetSignedMapRootRequest")
-	proto.RegisterType((*GetSignedMapRootResponse)(nil), "trillian.GetSignedMapRootResponse")
-	proto.RegisterEnum("trillian.TrillianApiStatusCode", TrillianApiStatusCode_name, TrillianApiStatusCode_value)
+type GetSignedMapRootByRevisionRequest struct {
+	MapId int64 `protobuf:"varint,1,opt,name=map_id,json=mapId" json:"map_id,omitempty"`
+	// The revision whose root is returned. It must have been published and not
+	// since pruned.
+	Revision int64 `protobuf:"varint,2,opt,name=revision" json:"revision,omitempty"`
 }
 
-// Reference imports to suppress errors if they are not otherwise used.
-var _ context.Context
-var _ grpc.ClientConn
+func (m *GetSignedMapRootByRevisionRequest) Reset()                    { *m = GetSignedMapRootByRevisionRequest{} }
+func (m *GetSignedMapRootByRevisionRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetSignedMapRootByRevisionRequest) ProtoMessage()               {}
+func (*GetSignedMapRootByRevisionRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{50} }
 
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the grpc package it is being compiled against.
-const _ = grpc.SupportPackageIsVersion3
+type InitMapRequest struct {
+	MapId int64 `protobuf:"varint,1,opt,name=map_id,json=mapId" json:"map_id,omitempty"`
+}
 
-// Client API for TrillianLog service
+func (m *InitMapRequest) Reset()                    { *m = InitMapRequest{} }
+func (m *InitMapRequest) String() string            { return proto.CompactTextString(m) }
+func (*InitMapRequest) ProtoMessage()               {}
+func (*InitMapRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{51} }
 
-type TrillianLogClient interface {
-	// Corresponds to the LeafQueuer API
-	QueueLeaves(ctx context.Context, in *QueueLeavesRequest, opts ...grpc.CallOption) (*QueueLeavesResponse, error)
-	// No direct equivalent at the storage level
-	GetInclusionProof(ctx context.Context, in *GetInclusionProofRequest, opts ...grpc.CallOption) (*GetInclusionProofResponse, error)
-	GetInclusionProofByHash(ctx context.Context, in *GetInclusionProofByHashRequest, opts ...grpc.CallOption) (*GetInclusionProofByHashResponse, error)
-	GetConsistencyProof(ctx context.Context, in *GetConsistencyProofRequest, opts ...grpc.CallOption) (*GetConsistencyProofResponse, error)
-	// Corresponds to the LogRootReader API
+type InitMapResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	// The root of the empty map, at revision 0.
+	Created *SignedMapRoot `protobuf:"bytes,2,opt,name=created" json:"created,omitempty"`
+}
+
+func (m *InitMapResponse) Reset()                    { *m = InitMapResponse{} }
+func (m *InitMapResponse) String() string            { return proto.CompactTextString(m) }
+func (*InitMapResponse) ProtoMessage()               {}
+func (*InitMapResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{52} }
+
+func (m *InitMapResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *InitMapResponse) GetCreated() *SignedMapRoot {
+	if m != nil {
+		return m.Created
+	}
+	return nil
+}
+
+type PublishMapRevisionRequest struct {
+	MapId int64 `protobuf:"varint,1,opt,name=map_id,json=mapId" json:"map_id,omitempty"`
+	// The revision to publish, which must be the currently staged revision.
+	Revision int64 `protobuf:"varint,2,opt,name=revision" json:"revision,omitempty"`
+}
+
+func (m *PublishMapRevisionRequest) Reset()                    { *m = PublishMapRevisionRequest{} }
+func (m *PublishMapRevisionRequest) String() string            { return proto.CompactTextString(m) }
+func (*PublishMapRevisionRequest) ProtoMessage()               {}
+func (*PublishMapRevisionRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{53} }
+
+type PublishMapRevisionResponse struct {
+	Status  *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	MapRoot *SignedMapRoot     `protobuf:"bytes,2,opt,name=map_root,json=mapRoot" json:"map_root,omitempty"`
+}
+
+func (m *PublishMapRevisionResponse) Reset()                    { *m = PublishMapRevisionResponse{} }
+func (m *PublishMapRevisionResponse) String() string            { return proto.CompactTextString(m) }
+func (*PublishMapRevisionResponse) ProtoMessage()               {}
+func (*PublishMapRevisionResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{54} }
+
+func (m *PublishMapRevisionResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *PublishMapRevisionResponse) GetMapRoot() *SignedMapRoot {
+	if m != nil {
+		return m.MapRoot
+	}
+	return nil
+}
+
+type AbandonMapRevisionRequest struct {
+	MapId int64 `protobuf:"varint,1,opt,name=map_id,json=mapId" json:"map_id,omitempty"`
+	// The revision to abandon, which must be the currently staged revision.
+	Revision int64 `protobuf:"varint,2,opt,name=revision" json:"revision,omitempty"`
+}
+
+func (m *AbandonMapRevisionRequest) Reset()                    { *m = AbandonMapRevisionRequest{} }
+func (m *AbandonMapRevisionRequest) String() string            { return proto.CompactTextString(m) }
+func (*AbandonMapRevisionRequest) ProtoMessage()               {}
+func (*AbandonMapRevisionRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{55} }
+
+type AbandonMapRevisionResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+}
+
+func (m *AbandonMapRevisionResponse) Reset()                    { *m = AbandonMapRevisionResponse{} }
+func (m *AbandonMapRevisionResponse) String() string            { return proto.CompactTextString(m) }
+func (*AbandonMapRevisionResponse) ProtoMessage()               {}
+func (*AbandonMapRevisionResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{56} }
+
+func (m *AbandonMapRevisionResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+// MapLeafUpdate is a leaf that was set by a revision of a map.
+type MapLeafUpdate struct {
+	KeyHash []byte `protobuf:"bytes,1,opt,name=key_hash,json=keyHash,proto3" json:"key_hash,omitempty"`
+	// old_leaf_hash is the hash of the leaf in the previous revision, which is
+	// the hash of an empty leaf if the key wasn't set.
+	OldLeafHash []byte `protobuf:"bytes,2,opt,name=old_leaf_hash,json=oldLeafHash,proto3" json:"old_leaf_hash,omitempty"`
+	// inclusion proves old_leaf_hash is in the previous revision.
+	Inclusion [][]byte `protobuf:"bytes,3,rep,name=inclusion,proto3" json:"inclusion,omitempty"`
+	// new_leaf is the leaf as it was set by the revision.
+	NewLeaf *MapLeaf `protobuf:"bytes,4,opt,name=new_leaf,json=newLeaf" json:"new_leaf,omitempty"`
+}
+
+func (m *MapLeafUpdate) Reset()                    { *m = MapLeafUpdate{} }
+func (m *MapLeafUpdate) String() string            { return proto.CompactTextString(m) }
+func (*MapLeafUpdate) ProtoMessage()               {}
+func (*MapLeafUpdate) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{57} }
+
+func (m *MapLeafUpdate) GetNewLeaf() *MapLeaf {
+	if m != nil {
+		return m.NewLeaf
+	}
+	return nil
+}
+
+type GetMapUpdateProofRequest struct {
+	MapId int64 `protobuf:"varint,1,opt,name=map_id,json=mapId" json:"map_id,omitempty"`
+	// The published revision to prove, relative to the revision before it.
+	Revision int64 `protobuf:"varint,2,opt,name=revision" json:"revision,omitempty"`
+}
+
+func (m *GetMapUpdateProofRequest) Reset()                    { *m = GetMapUpdateProofRequest{} }
+func (m *GetMapUpdateProofRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetMapUpdateProofRequest) ProtoMessage()               {}
+func (*GetMapUpdateProofRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{58} }
+
+type GetMapUpdateProofResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	// The root hashes of the previous revision and the requested one.
+	OldRootHash []byte `protobuf:"bytes,2,opt,name=old_root_hash,json=oldRootHash,proto3" json:"old_root_hash,omitempty"`
+	NewRootHash []byte `protobuf:"bytes,3,opt,name=new_root_hash,json=newRootHash,proto3" json:"new_root_hash,omitempty"`
+	// Every leaf set by the revision, in key hash order.
+	Update []*MapLeafUpdate `protobuf:"bytes,4,rep,name=update" json:"update,omitempty"`
+}
+
+func (m *GetMapUpdateProofResponse) Reset()                    { *m = GetMapUpdateProofResponse{} }
+func (m *GetMapUpdateProofResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetMapUpdateProofResponse) ProtoMessage()               {}
+func (*GetMapUpdateProofResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{59} }
+
+func (m *GetMapUpdateProofResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *GetMapUpdateProofResponse) GetUpdate() []*MapLeafUpdate {
+	if m != nil {
+		return m.Update
+	}
+	return nil
+}
+
+type ListMapLeavesRequest struct {
+	MapId int64 `protobuf:"varint,1,opt,name=map_id,json=mapId" json:"map_id,omitempty"`
+	// The published revision whose leaves are listed, or the latest if it's
+	// negative.
+	Revision int64 `protobuf:"varint,2,opt,name=revision" json:"revision,omitempty"`
+	// If set only keys whose hashes sort after it are listed, so an interrupted
+	// listing can be continued from the last key hash received.
+	AfterKeyHash []byte `protobuf:"bytes,3,opt,name=after_key_hash,json=afterKeyHash,proto3" json:"after_key_hash,omitempty"`
+}
+
+func (m *ListMapLeavesRequest) Reset()                    { *m = ListMapLeavesRequest{} }
+func (m *ListMapLeavesRequest) String() string            { return proto.CompactTextString(m) }
+func (*ListMapLeavesRequest) ProtoMessage()               {}
+func (*ListMapLeavesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{60} }
+
+type ListMapLeavesResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	// The value of each key at the revision, in key hash order.
+	Leaves []*MapLeaf `protobuf:"bytes,2,rep,name=leaves" json:"leaves,omitempty"`
+	// The signed root of the revision listed, which is only set in the first
+	// response.
+	MapRoot *SignedMapRoot `protobuf:"bytes,3,opt,name=map_root,json=mapRoot" json:"map_root,omitempty"`
+}
+
+func (m *ListMapLeavesResponse) Reset()                    { *m = ListMapLeavesResponse{} }
+func (m *ListMapLeavesResponse) String() string            { return proto.CompactTextString(m) }
+func (*ListMapLeavesResponse) ProtoMessage()               {}
+func (*ListMapLeavesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{61} }
+
+func (m *ListMapLeavesResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *ListMapLeavesResponse) GetLeaves() []*MapLeaf {
+	if m != nil {
+		return m.Leaves
+	}
+	return nil
+}
+
+func (m *ListMapLeavesResponse) GetMapRoot() *SignedMapRoot {
+	if m != nil {
+		return m.MapRoot
+	}
+	return nil
+}
+
+type TagMapRevisionRequest struct {
+	MapId int64 `protobuf:"varint,1,opt,name=map_id,json=mapId" json:"map_id,omitempty"`
+	// The tag, which can then be given as the revision_tag of reads. It can't be
+	// moved to another revision once set.
+	Tag string `protobuf:"bytes,2,opt,name=tag" json:"tag,omitempty"`
+	// The revision to tag, which must have been published.
+	Revision int64 `protobuf:"varint,3,opt,name=revision" json:"revision,omitempty"`
+}
+
+func (m *TagMapRevisionRequest) Reset()                    { *m = TagMapRevisionRequest{} }
+func (m *TagMapRevisionRequest) String() string            { return proto.CompactTextString(m) }
+func (*TagMapRevisionRequest) ProtoMessage()               {}
+func (*TagMapRevisionRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{62} }
+
+type TagMapRevisionResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+}
+
+func (m *TagMapRevisionResponse) Reset()                    { *m = TagMapRevisionResponse{} }
+func (m *TagMapRevisionResponse) String() string            { return proto.CompactTextString(m) }
+func (*TagMapRevisionResponse) ProtoMessage()               {}
+func (*TagMapRevisionResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{63} }
+
+func (m *TagMapRevisionResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+type GetMapRevisionTagsRequest struct {
+	MapId int64 `protobuf:"varint,1,opt,name=map_id,json=mapId" json:"map_id,omitempty"`
+}
+
+func (m *GetMapRevisionTagsRequest) Reset()                    { *m = GetMapRevisionTagsRequest{} }
+func (m *GetMapRevisionTagsRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetMapRevisionTagsRequest) ProtoMessage()               {}
+func (*GetMapRevisionTagsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{64} }
+
+type MapRevisionTag struct {
+	Tag      string `protobuf:"bytes,1,opt,name=tag" json:"tag,omitempty"`
+	Revision int64  `protobuf:"varint,2,opt,name=revision" json:"revision,omitempty"`
+}
+
+func (m *MapRevisionTag) Reset()                    { *m = MapRevisionTag{} }
+func (m *MapRevisionTag) String() string            { return proto.CompactTextString(m) }
+func (*MapRevisionTag) ProtoMessage()               {}
+func (*MapRevisionTag) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{65} }
+
+type GetMapRevisionTagsResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	// Every tag of the map, in order of tag.
+	Tags []*MapRevisionTag `protobuf:"bytes,2,rep,name=tags" json:"tags,omitempty"`
+}
+
+func (m *GetMapRevisionTagsResponse) Reset()                    { *m = GetMapRevisionTagsResponse{} }
+func (m *GetMapRevisionTagsResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetMapRevisionTagsResponse) ProtoMessage()               {}
+func (*GetMapRevisionTagsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{66} }
+
+func (m *GetMapRevisionTagsResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *GetMapRevisionTagsResponse) GetTags() []*MapRevisionTag {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
+type AddCheckpointRequest struct {
+	LogId int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+	// The log root to be checked and cosigned, which must be signed by the log.
+	Root *SignedLogRoot `protobuf:"bytes,2,opt,name=root" json:"root,omitempty"`
+	// The size of the tree the consistency proof is from, which must be the size
+	// of the root the witness has already seen for the log.
+	FirstTreeSize    int64    `protobuf:"varint,3,opt,name=first_tree_size,json=firstTreeSize" json:"first_tree_size,omitempty"`
+	ConsistencyProof [][]byte `protobuf:"bytes,4,rep,name=consistency_proof,json=consistencyProof,proto3" json:"consistency_proof,omitempty"`
+}
+
+func (m *AddCheckpointRequest) Reset()                    { *m = AddCheckpointRequest{} }
+func (m *AddCheckpointRequest) String() string            { return proto.CompactTextString(m) }
+func (*AddCheckpointRequest) ProtoMessage()               {}
+func (*AddCheckpointRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{67} }
+
+func (m *AddCheckpointRequest) GetRoot() *SignedLogRoot {
+	if m != nil {
+		return m.Root
+	}
+	return nil
+}
+
+type AddCheckpointResponse struct {
+	Cosignature *Cosignature `protobuf:"bytes,1,opt,name=cosignature" json:"cosignature,omitempty"`
+}
+
+func (m *AddCheckpointResponse) Reset()                    { *m = AddCheckpointResponse{} }
+func (m *AddCheckpointResponse) String() string            { return proto.CompactTextString(m) }
+func (*AddCheckpointResponse) ProtoMessage()               {}
+func (*AddCheckpointResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{68} }
+
+func (m *AddCheckpointResponse) GetCosignature() *Cosignature {
+	if m != nil {
+		return m.Cosignature
+	}
+	return nil
+}
+
+type GetWitnessedRootRequest struct {
+	LogId int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+}
+
+func (m *GetWitnessedRootRequest) Reset()                    { *m = GetWitnessedRootRequest{} }
+func (m *GetWitnessedRootRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetWitnessedRootRequest) ProtoMessage()               {}
+func (*GetWitnessedRootRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{69} }
+
+type GetWitnessedRootResponse struct {
+	// The latest root of the log seen by the witness, which is empty if it hasn't
+	// seen one.
+	Root *SignedLogRoot `protobuf:"bytes,1,opt,name=root" json:"root,omitempty"`
+}
+
+func (m *GetWitnessedRootResponse) Reset()                    { *m = GetWitnessedRootResponse{} }
+func (m *GetWitnessedRootResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetWitnessedRootResponse) ProtoMessage()               {}
+func (*GetWitnessedRootResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{70} }
+
+func (m *GetWitnessedRootResponse) GetRoot() *SignedLogRoot {
+	if m != nil {
+		return m.Root
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*TrillianApiStatus)(nil), "trillian.TrillianApiStatus")
+	proto.RegisterType((*LeafProto)(nil), "trillian.LeafProto")
+	proto.RegisterType((*NodeProto)(nil), "trillian.NodeProto")
+	proto.RegisterType((*ProofProto)(nil), "trillian.ProofProto")
+	proto.RegisterType((*QueueLeavesRequest)(nil), "trillian.QueueLeavesRequest")
+	proto.RegisterType((*QueuedLeaf)(nil), "trillian.QueuedLeaf")
+	proto.RegisterType((*QueueLeavesResponse)(nil), "trillian.QueueLeavesResponse")
+	proto.RegisterType((*AddSequencedLeavesRequest)(nil), "trillian.AddSequencedLeavesRequest")
+	proto.RegisterType((*AddSequencedLeavesResponse)(nil), "trillian.AddSequencedLeavesResponse")
+	proto.RegisterType((*GetInclusionProofRequest)(nil), "trillian.GetInclusionProofRequest")
+	proto.RegisterType((*GetInclusionProofResponse)(nil), "trillian.GetInclusionProofResponse")
+	proto.RegisterType((*GetInclusionProofByHashRequest)(nil), "trillian.GetInclusionProofByHashRequest")
+	proto.RegisterType((*GetInclusionProofByHashResponse)(nil), "trillian.GetInclusionProofByHashResponse")
+	proto.RegisterType((*GetInclusionProofBatchRequest)(nil), "trillian.GetInclusionProofBatchRequest")
+	proto.RegisterType((*GetInclusionProofBatchResponse)(nil), "trillian.GetInclusionProofBatchResponse")
+	proto.RegisterType((*GetConsistencyProofRequest)(nil), "trillian.GetConsistencyProofRequest")
+	proto.RegisterType((*GetConsistencyProofResponse)(nil), "trillian.GetConsistencyProofResponse")
+	proto.RegisterType((*GetLeavesByHashRequest)(nil), "trillian.GetLeavesByHashRequest")
+	proto.RegisterType((*GetLeavesByHashResponse)(nil), "trillian.GetLeavesByHashResponse")
+	proto.RegisterType((*GetLeavesByIndexRequest)(nil), "trillian.GetLeavesByIndexRequest")
+	proto.RegisterType((*GetLeavesByIndexResponse)(nil), "trillian.GetLeavesByIndexResponse")
+	proto.RegisterType((*GetLeavesByRangeRequest)(nil), "trillian.GetLeavesByRangeRequest")
+	proto.RegisterType((*GetLeavesByRangeResponse)(nil), "trillian.GetLeavesByRangeResponse")
+	proto.RegisterType((*GetSequencedLeafCountRequest)(nil), "trillian.GetSequencedLeafCountRequest")
+	proto.RegisterType((*GetSequencedLeafCountResponse)(nil), "trillian.GetSequencedLeafCountResponse")
+	proto.RegisterType((*GetLatestSignedLogRootRequest)(nil), "trillian.GetLatestSignedLogRootRequest")
+	proto.RegisterType((*GetLatestSignedLogRootResponse)(nil), "trillian.GetLatestSignedLogRootResponse")
+	proto.RegisterType((*GetTreeKeysRequest)(nil), "trillian.GetTreeKeysRequest")
+	proto.RegisterType((*GetTreeKeysResponse)(nil), "trillian.GetTreeKeysResponse")
+	proto.RegisterType((*GetLatestCheckpointRequest)(nil), "trillian.GetLatestCheckpointRequest")
+	proto.RegisterType((*GetLatestCheckpointResponse)(nil), "trillian.GetLatestCheckpointResponse")
+	proto.RegisterType((*AddLogRootCosignatureRequest)(nil), "trillian.AddLogRootCosignatureRequest")
+	proto.RegisterType((*AddLogRootCosignatureResponse)(nil), "trillian.AddLogRootCosignatureResponse")
+	proto.RegisterType((*GetEntryAndProofRequest)(nil), "trillian.GetEntryAndProofRequest")
+	proto.RegisterType((*GetEntryAndProofResponse)(nil), "trillian.GetEntryAndProofResponse")
+	proto.RegisterType((*GetLeafIndexRangeByTimeRequest)(nil), "trillian.GetLeafIndexRangeByTimeRequest")
+	proto.RegisterType((*GetLeafIndexRangeByTimeResponse)(nil), "trillian.GetLeafIndexRangeByTimeResponse")
+	proto.RegisterType((*InitLogRequest)(nil), "trillian.InitLogRequest")
+	proto.RegisterType((*InitLogResponse)(nil), "trillian.InitLogResponse")
+	proto.RegisterType((*MapLeaf)(nil), "trillian.MapLeaf")
+	proto.RegisterType((*KeyValue)(nil), "trillian.KeyValue")
+	proto.RegisterType((*KeyValueInclusion)(nil), "trillian.KeyValueInclusion")
+	proto.RegisterType((*GetMapLeavesRequest)(nil), "trillian.GetMapLeavesRequest")
+	proto.RegisterType((*GetMapLeavesResponse)(nil), "trillian.GetMapLeavesResponse")
+	proto.RegisterType((*MapLeafProof)(nil), "trillian.MapLeafProof")
+	proto.RegisterType((*GetMapLeavesWithProofResponse)(nil), "trillian.GetMapLeavesWithProofResponse")
+	proto.RegisterType((*SetMapLeavesRequest)(nil), "trillian.SetMapLeavesRequest")
+	proto.RegisterType((*SetMapLeavesResponse)(nil), "trillian.SetMapLeavesResponse")
+	proto.RegisterType((*GetSignedMapRootRequest)(nil), "trillian.GetSignedMapRootRequest")
+	proto.RegisterType((*GetSignedMapRootResponse)(nil), "trillian.GetSignedMapRootResponse")
+	proto.RegisterType((*GetSignedMapRootByRevisionRequest)(nil), "trillian.GetSignedMapRootByRevisionRequest")
+	proto.RegisterType((*InitMapRequest)(nil), "trillian.InitMapRequest")
+	proto.RegisterType((*InitMapResponse)(nil), "trillian.InitMapResponse")
+	proto.RegisterType((*PublishMapRevisionRequest)(nil), "trillian.PublishMapRevisionRequest")
+	proto.RegisterType((*PublishMapRevisionResponse)(nil), "trillian.PublishMapRevisionResponse")
+	proto.RegisterType((*AbandonMapRevisionRequest)(nil), "trillian.AbandonMapRevisionRequest")
+	proto.RegisterType((*AbandonMapRevisionResponse)(nil), "trillian.AbandonMapRevisionResponse")
+	proto.RegisterType((*MapLeafUpdate)(nil), "trillian.MapLeafUpdate")
+	proto.RegisterType((*GetMapUpdateProofRequest)(nil), "trillian.GetMapUpdateProofRequest")
+	proto.RegisterType((*GetMapUpdateProofResponse)(nil), "trillian.GetMapUpdateProofResponse")
+	proto.RegisterType((*ListMapLeavesRequest)(nil), "trillian.ListMapLeavesRequest")
+	proto.RegisterType((*ListMapLeavesResponse)(nil), "trillian.ListMapLeavesResponse")
+	proto.RegisterType((*TagMapRevisionRequest)(nil), "trillian.TagMapRevisionRequest")
+	proto.RegisterType((*TagMapRevisionResponse)(nil), "trillian.TagMapRevisionResponse")
+	proto.RegisterType((*GetMapRevisionTagsRequest)(nil), "trillian.GetMapRevisionTagsRequest")
+	proto.RegisterType((*MapRevisionTag)(nil), "trillian.MapRevisionTag")
+	proto.RegisterType((*GetMapRevisionTagsResponse)(nil), "trillian.GetMapRevisionTagsResponse")
+	proto.RegisterType((*AddCheckpointRequest)(nil), "trillian.AddCheckpointRequest")
+	proto.RegisterType((*AddCheckpointResponse)(nil), "trillian.AddCheckpointResponse")
+	proto.RegisterType((*GetWitnessedRootRequest)(nil), "trillian.GetWitnessedRootRequest")
+	proto.RegisterType((*GetWitnessedRootResponse)(nil), "trillian.GetWitnessedRootResponse")
+	proto.RegisterEnum("trillian.TrillianApiStatusCode", TrillianApiStatusCode_name, TrillianApiStatusCode_value)
+	proto.RegisterEnum("trillian.QueuedLeaf.Status", QueuedLeaf_Status_name, QueuedLeaf_Status_value)
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion3
+
+// Client API for TrillianLog service
+
+type TrillianLogClient interface {
+	// Corresponds to the LeafQueuer API
+	QueueLeaves(ctx context.Context, in *QueueLeavesRequest, opts ...grpc.CallOption) (*QueueLeavesResponse, error)
+	// AddSequencedLeaves adds leaves to a pre-ordered log at the indices the
+	// caller has given them. Adding leaves that are already at their indices
+	// has no effect, but the request fails if any index holds a different leaf.
+	// Corresponds to the SequencedLeafAdder API.
+	AddSequencedLeaves(ctx context.Context, in *AddSequencedLeavesRequest, opts ...grpc.CallOption) (*AddSequencedLeavesResponse, error)
+	// No direct equivalent at the storage level
+	GetInclusionProof(ctx context.Context, in *GetInclusionProofRequest, opts ...grpc.CallOption) (*GetInclusionProofResponse, error)
+	GetInclusionProofByHash(ctx context.Context, in *GetInclusionProofByHashRequest, opts ...grpc.CallOption) (*GetInclusionProofByHashResponse, error)
+	// GetInclusionProofBatch returns proofs of inclusion for several leaves in
+	// a tree of one size, read in one transaction. Nodes shared by the proofs
+	// are only read once.
+	GetInclusionProofBatch(ctx context.Context, in *GetInclusionProofBatchRequest, opts ...grpc.CallOption) (*GetInclusionProofBatchResponse, error)
+	GetConsistencyProof(ctx context.Context, in *GetConsistencyProofRequest, opts ...grpc.CallOption) (*GetConsistencyProofResponse, error)
+	// Corresponds to the LogRootReader API
 	GetLatestSignedLogRoot(ctx context.Context, in *GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*GetLatestSignedLogRootResponse, error)
+	// GetLatestCheckpoint returns the latest signed root of the log, with any
+	// witness cosignatures, as a checkpoint, the signed note format read by
+	// other transparency log tools.
+	GetLatestCheckpoint(ctx context.Context, in *GetLatestCheckpointRequest, opts ...grpc.CallOption) (*GetLatestCheckpointResponse, error)
+	// AddLogRootCosignature stores a witness's signature of the log's latest
+	// root, which is then returned with the root. Only the cosignatures of the
+	// log's known witnesses are accepted, once they verify with the witness's
+	// key. Storing another signature from the same witness replaces it. When an
+	// idle log's root is re-signed with a new timestamp its cosignatures are
+	// dropped, and witnesses must cosign the new root.
+	AddLogRootCosignature(ctx context.Context, in *AddLogRootCosignatureRequest, opts ...grpc.CallOption) (*AddLogRootCosignatureResponse, error)
+	// GetTreeKeys returns the public keys of the log, so clients can check
+	// roots signed before and after its key is rotated.
+	GetTreeKeys(ctx context.Context, in *GetTreeKeysRequest, opts ...grpc.CallOption) (*GetTreeKeysResponse, error)
 	// Corresponds to the LeafReader API
 	GetSequencedLeafCount(ctx context.Context, in *GetSequencedLeafCountRequest, opts ...grpc.CallOption) (*GetSequencedLeafCountResponse, error)
 	GetLeavesByIndex(ctx context.Context, in *GetLeavesByIndexRequest, opts ...grpc.CallOption) (*GetLeavesByIndexResponse, error)
+	// GetLeavesByRange streams the leaves of the log in order from a start index,
+	// so that followers can read a large part of the log in one call. Leaves
+	// beyond the size of the latest signed root are not returned.
+	GetLeavesByRange(ctx context.Context, in *GetLeavesByRangeRequest, opts ...grpc.CallOption) (TrillianLog_GetLeavesByRangeClient, error)
 	GetLeavesByHash(ctx context.Context, in *GetLeavesByHashRequest, opts ...grpc.CallOption) (*GetLeavesByHashResponse, error)
+	// GetEntryAndProof returns the leaf at an index along with the proof of its
+	// inclusion in the tree of the given size, both read in one transaction.
 	GetEntryAndProof(ctx context.Context, in *GetEntryAndProofRequest, opts ...grpc.CallOption) (*GetEntryAndProofResponse, error)
+	// GetLeafIndexRangeByTime finds the leaves integrated within a window of time,
+	// which can then be read with GetLeavesByIndex.
+	GetLeafIndexRangeByTime(ctx context.Context, in *GetLeafIndexRangeByTimeRequest, opts ...grpc.CallOption) (*GetLeafIndexRangeByTimeResponse, error)
+	// InitLog creates and stores the signed root of a newly created log, which
+	// must be done before its root can be read. It fails if the log already has
+	// a root.
+	InitLog(ctx context.Context, in *InitLogRequest, opts ...grpc.CallOption) (*InitLogResponse, error)
 }
 
 type trillianLogClient struct {
@@ -714,6 +1653,15 @@ func (c *trillianLogClient) QueueLeaves(ctx context.Context, in *QueueLeavesRequ
 	return out, nil
 }
 
+func (c *trillianLogClient) AddSequencedLeaves(ctx context.Context, in *AddSequencedLeavesRequest, opts ...grpc.CallOption) (*AddSequencedLeavesResponse, error) {
+	out := new(AddSequencedLeavesResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianLog/AddSequencedLeaves", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *trillianLogClient) GetInclusionProof(ctx context.Context, in *GetInclusionProofRequest, opts ...grpc.CallOption) (*GetInclusionProofResponse, error) {
 	out := new(GetInclusionProofResponse)
 	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetInclusionProof", in, out, c.cc, opts...)
@@ -729,416 +1677,1307 @@ func (c *trillianLogClient) GetInclusionProofByHash(ctx context.Context, in *Get
 	if err != nil {
 		return nil, err
 	}
-	return out, nil
+	return out, nil
+}
+
+func (c *trillianLogClient) GetInclusionProofBatch(ctx context.Context, in *GetInclusionProofBatchRequest, opts ...grpc.CallOption) (*GetInclusionProofBatchResponse, error) {
+	out := new(GetInclusionProofBatchResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetInclusionProofBatch", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianLogClient) GetConsistencyProof(ctx context.Context, in *GetConsistencyProofRequest, opts ...grpc.CallOption) (*GetConsistencyProofResponse, error) {
+	out := new(GetConsistencyProofResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetConsistencyProof", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianLogClient) GetLatestSignedLogRoot(ctx context.Context, in *GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*GetLatestSignedLogRootResponse, error) {
+	out := new(GetLatestSignedLogRootResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetLatestSignedLogRoot", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianLogClient) GetLatestCheckpoint(ctx context.Context, in *GetLatestCheckpointRequest, opts ...grpc.CallOption) (*GetLatestCheckpointResponse, error) {
+	out := new(GetLatestCheckpointResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetLatestCheckpoint", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianLogClient) AddLogRootCosignature(ctx context.Context, in *AddLogRootCosignatureRequest, opts ...grpc.CallOption) (*AddLogRootCosignatureResponse, error) {
+	out := new(AddLogRootCosignatureResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianLog/AddLogRootCosignature", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianLogClient) GetTreeKeys(ctx context.Context, in *GetTreeKeysRequest, opts ...grpc.CallOption) (*GetTreeKeysResponse, error) {
+	out := new(GetTreeKeysResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetTreeKeys", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianLogClient) GetSequencedLeafCount(ctx context.Context, in *GetSequencedLeafCountRequest, opts ...grpc.CallOption) (*GetSequencedLeafCountResponse, error) {
+	out := new(GetSequencedLeafCountResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetSequencedLeafCount", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianLogClient) GetLeavesByIndex(ctx context.Context, in *GetLeavesByIndexRequest, opts ...grpc.CallOption) (*GetLeavesByIndexResponse, error) {
+	out := new(GetLeavesByIndexResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetLeavesByIndex", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianLogClient) GetLeavesByRange(ctx context.Context, in *GetLeavesByRangeRequest, opts ...grpc.CallOption) (TrillianLog_GetLeavesByRangeClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_TrillianLog_serviceDesc.Streams[0], c.cc, "/trillian.TrillianLog/GetLeavesByRange", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &trillianLogGetLeavesByRangeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type TrillianLog_GetLeavesByRangeClient interface {
+	Recv() (*GetLeavesByRangeResponse, error)
+	grpc.ClientStream
+}
+
+type trillianLogGetLeavesByRangeClient struct {
+	grpc.ClientStream
+}
+
+func (x *trillianLogGetLeavesByRangeClient) Recv() (*GetLeavesByRangeResponse, error) {
+	m := new(GetLeavesByRangeResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *trillianLogClient) GetLeavesByHash(ctx context.Context, in *GetLeavesByHashRequest, opts ...grpc.CallOption) (*GetLeavesByHashResponse, error) {
+	out := new(GetLeavesByHashResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetLeavesByHash", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianLogClient) GetEntryAndProof(ctx context.Context, in *GetEntryAndProofRequest, opts ...grpc.CallOption) (*GetEntryAndProofResponse, error) {
+	out := new(GetEntryAndProofResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetEntryAndProof", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianLogClient) GetLeafIndexRangeByTime(ctx context.Context, in *GetLeafIndexRangeByTimeRequest, opts ...grpc.CallOption) (*GetLeafIndexRangeByTimeResponse, error) {
+	out := new(GetLeafIndexRangeByTimeResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetLeafIndexRangeByTime", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianLogClient) InitLog(ctx context.Context, in *InitLogRequest, opts ...grpc.CallOption) (*InitLogResponse, error) {
+	out := new(InitLogResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianLog/InitLog", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for TrillianLog service
+
+type TrillianLogServer interface {
+	// Corresponds to the LeafQueuer API
+	QueueLeaves(context.Context, *QueueLeavesRequest) (*QueueLeavesResponse, error)
+	// AddSequencedLeaves adds leaves to a pre-ordered log at the indices the
+	// caller has given them. Adding leaves that are already at their indices
+	// has no effect, but the request fails if any index holds a different leaf.
+	// Corresponds to the SequencedLeafAdder API.
+	AddSequencedLeaves(context.Context, *AddSequencedLeavesRequest) (*AddSequencedLeavesResponse, error)
+	// No direct equivalent at the storage level
+	GetInclusionProof(context.Context, *GetInclusionProofRequest) (*GetInclusionProofResponse, error)
+	GetInclusionProofByHash(context.Context, *GetInclusionProofByHashRequest) (*GetInclusionProofByHashResponse, error)
+	// GetInclusionProofBatch returns proofs of inclusion for several leaves in
+	// a tree of one size, read in one transaction. Nodes shared by the proofs
+	// are only read once.
+	GetInclusionProofBatch(context.Context, *GetInclusionProofBatchRequest) (*GetInclusionProofBatchResponse, error)
+	GetConsistencyProof(context.Context, *GetConsistencyProofRequest) (*GetConsistencyProofResponse, error)
+	// Corresponds to the LogRootReader API
+	GetLatestSignedLogRoot(context.Context, *GetLatestSignedLogRootRequest) (*GetLatestSignedLogRootResponse, error)
+	// GetLatestCheckpoint returns the latest signed root of the log, with any
+	// witness cosignatures, as a checkpoint, the signed note format read by
+	// other transparency log tools.
+	GetLatestCheckpoint(context.Context, *GetLatestCheckpointRequest) (*GetLatestCheckpointResponse, error)
+	// AddLogRootCosignature stores a witness's signature of the log's latest
+	// root, which is then returned with the root. Only the cosignatures of the
+	// log's known witnesses are accepted, once they verify with the witness's
+	// key. Storing another signature from the same witness replaces it. When an
+	// idle log's root is re-signed with a new timestamp its cosignatures are
+	// dropped, and witnesses must cosign the new root.
+	AddLogRootCosignature(context.Context, *AddLogRootCosignatureRequest) (*AddLogRootCosignatureResponse, error)
+	// GetTreeKeys returns the public keys of the log, so clients can check
+	// roots signed before and after its key is rotated.
+	GetTreeKeys(context.Context, *GetTreeKeysRequest) (*GetTreeKeysResponse, error)
+	// Corresponds to the LeafReader API
+	GetSequencedLeafCount(context.Context, *GetSequencedLeafCountRequest) (*GetSequencedLeafCountResponse, error)
+	GetLeavesByIndex(context.Context, *GetLeavesByIndexRequest) (*GetLeavesByIndexResponse, error)
+	// GetLeavesByRange streams the leaves of the log in order from a start index,
+	// so that followers can read a large part of the log in one call. Leaves
+	// beyond the size of the latest signed root are not returned.
+	GetLeavesByRange(*GetLeavesByRangeRequest, TrillianLog_GetLeavesByRangeServer) error
+	GetLeavesByHash(context.Context, *GetLeavesByHashRequest) (*GetLeavesByHashResponse, error)
+	// GetEntryAndProof returns the leaf at an index along with the proof of its
+	// inclusion in the tree of the given size, both read in one transaction.
+	GetEntryAndProof(context.Context, *GetEntryAndProofRequest) (*GetEntryAndProofResponse, error)
+	// GetLeafIndexRangeByTime finds the leaves integrated within a window of time,
+	// which can then be read with GetLeavesByIndex.
+	GetLeafIndexRangeByTime(context.Context, *GetLeafIndexRangeByTimeRequest) (*GetLeafIndexRangeByTimeResponse, error)
+	// InitLog creates and stores the signed root of a newly created log, which
+	// must be done before its root can be read. It fails if the log already has
+	// a root.
+	InitLog(context.Context, *InitLogRequest) (*InitLogResponse, error)
+}
+
+func RegisterTrillianLogServer(s *grpc.Server, srv TrillianLogServer) {
+	s.RegisterService(&_TrillianLog_serviceDesc, srv)
+}
+
+func _TrillianLog_QueueLeaves_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueueLeavesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).QueueLeaves(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/QueueLeaves",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).QueueLeaves(ctx, req.(*QueueLeavesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_AddSequencedLeaves_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddSequencedLeavesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).AddSequencedLeaves(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/AddSequencedLeaves",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).AddSequencedLeaves(ctx, req.(*AddSequencedLeavesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_GetInclusionProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetInclusionProofRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).GetInclusionProof(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/GetInclusionProof",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).GetInclusionProof(ctx, req.(*GetInclusionProofRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_GetInclusionProofByHash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetInclusionProofByHashRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).GetInclusionProofByHash(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/GetInclusionProofByHash",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).GetInclusionProofByHash(ctx, req.(*GetInclusionProofByHashRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_GetInclusionProofBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetInclusionProofBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).GetInclusionProofBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/GetInclusionProofBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).GetInclusionProofBatch(ctx, req.(*GetInclusionProofBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_GetConsistencyProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetConsistencyProofRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).GetConsistencyProof(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/GetConsistencyProof",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).GetConsistencyProof(ctx, req.(*GetConsistencyProofRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_GetLatestSignedLogRoot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLatestSignedLogRootRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).GetLatestSignedLogRoot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/GetLatestSignedLogRoot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).GetLatestSignedLogRoot(ctx, req.(*GetLatestSignedLogRootRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_GetLatestCheckpoint_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLatestCheckpointRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).GetLatestCheckpoint(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/GetLatestCheckpoint",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).GetLatestCheckpoint(ctx, req.(*GetLatestCheckpointRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_AddLogRootCosignature_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddLogRootCosignatureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).AddLogRootCosignature(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/AddLogRootCosignature",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).AddLogRootCosignature(ctx, req.(*AddLogRootCosignatureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_GetTreeKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTreeKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).GetTreeKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/GetTreeKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).GetTreeKeys(ctx, req.(*GetTreeKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_GetSequencedLeafCount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSequencedLeafCountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).GetSequencedLeafCount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/GetSequencedLeafCount",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).GetSequencedLeafCount(ctx, req.(*GetSequencedLeafCountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_GetLeavesByIndex_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLeavesByIndexRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).GetLeavesByIndex(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/GetLeavesByIndex",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).GetLeavesByIndex(ctx, req.(*GetLeavesByIndexRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_GetLeavesByRange_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetLeavesByRangeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TrillianLogServer).GetLeavesByRange(m, &trillianLogGetLeavesByRangeServer{stream})
+}
+
+type TrillianLog_GetLeavesByRangeServer interface {
+	Send(*GetLeavesByRangeResponse) error
+	grpc.ServerStream
+}
+
+type trillianLogGetLeavesByRangeServer struct {
+	grpc.ServerStream
+}
+
+func (x *trillianLogGetLeavesByRangeServer) Send(m *GetLeavesByRangeResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _TrillianLog_GetLeavesByHash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLeavesByHashRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).GetLeavesByHash(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/GetLeavesByHash",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).GetLeavesByHash(ctx, req.(*GetLeavesByHashRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_GetEntryAndProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetEntryAndProofRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).GetEntryAndProof(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/GetEntryAndProof",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).GetEntryAndProof(ctx, req.(*GetEntryAndProofRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_GetLeafIndexRangeByTime_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLeafIndexRangeByTimeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).GetLeafIndexRangeByTime(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/GetLeafIndexRangeByTime",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).GetLeafIndexRangeByTime(ctx, req.(*GetLeafIndexRangeByTimeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_InitLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InitLogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).InitLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/InitLog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).InitLog(ctx, req.(*InitLogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _TrillianLog_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "trillian.TrillianLog",
+	HandlerType: (*TrillianLogServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "QueueLeaves",
+			Handler:    _TrillianLog_QueueLeaves_Handler,
+		},
+		{
+			MethodName: "AddSequencedLeaves",
+			Handler:    _TrillianLog_AddSequencedLeaves_Handler,
+		},
+		{
+			MethodName: "GetInclusionProof",
+			Handler:    _TrillianLog_GetInclusionProof_Handler,
+		},
+		{
+			MethodName: "GetInclusionProofByHash",
+			Handler:    _TrillianLog_GetInclusionProofByHash_Handler,
+		},
+		{
+			MethodName: "GetInclusionProofBatch",
+			Handler:    _TrillianLog_GetInclusionProofBatch_Handler,
+		},
+		{
+			MethodName: "GetConsistencyProof",
+			Handler:    _TrillianLog_GetConsistencyProof_Handler,
+		},
+		{
+			MethodName: "GetLatestSignedLogRoot",
+			Handler:    _TrillianLog_GetLatestSignedLogRoot_Handler,
+		},
+		{
+			MethodName: "GetLatestCheckpoint",
+			Handler:    _TrillianLog_GetLatestCheckpoint_Handler,
+		},
+		{
+			MethodName: "AddLogRootCosignature",
+			Handler:    _TrillianLog_AddLogRootCosignature_Handler,
+		},
+		{
+			MethodName: "GetTreeKeys",
+			Handler:    _TrillianLog_GetTreeKeys_Handler,
+		},
+		{
+			MethodName: "GetSequencedLeafCount",
+			Handler:    _TrillianLog_GetSequencedLeafCount_Handler,
+		},
+		{
+			MethodName: "GetLeavesByIndex",
+			Handler:    _TrillianLog_GetLeavesByIndex_Handler,
+		},
+		{
+			MethodName: "GetLeavesByHash",
+			Handler:    _TrillianLog_GetLeavesByHash_Handler,
+		},
+		{
+			MethodName: "GetEntryAndProof",
+			Handler:    _TrillianLog_GetEntryAndProof_Handler,
+		},
+		{
+			MethodName: "GetLeafIndexRangeByTime",
+			Handler:    _TrillianLog_GetLeafIndexRangeByTime_Handler,
+		},
+		{
+			MethodName: "InitLog",
+			Handler:    _TrillianLog_InitLog_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetLeavesByRange",
+			Handler:       _TrillianLog_GetLeavesByRange_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: fileDescriptor0,
+}
+
+// Client API for TrillianMap service
+
+type TrillianMapClient interface {
+	GetLeaves(ctx context.Context, in *GetMapLeavesRequest, opts ...grpc.CallOption) (*GetMapLeavesResponse, error)
+	// GetMapLeavesWithProof returns a proof for each requested key against the
+	// signed root of the revision read, proving either the key's value or that it
+	// has none.
+	GetMapLeavesWithProof(ctx context.Context, in *GetMapLeavesRequest, opts ...grpc.CallOption) (*GetMapLeavesWithProofResponse, error)
+	// SetLeaves writes the leaves, the nodes of the recalculated tree and the
+	// signed root of a single new revision in one transaction, so that either
+	// all of them are stored or none are.
+	SetLeaves(ctx context.Context, in *SetMapLeavesRequest, opts ...grpc.CallOption) (*SetMapLeavesResponse, error)
+	// SetLeavesStream writes a single new revision from leaves streamed in any
+	// number of requests, so very large updates don't need one huge message. The
+	// first request sets the options for the whole revision. Later requests only
+	// add key_value entries and must have the same map_id, or leave it unset.
+	// Nothing is written until the stream is closed, when the new root is
+	// returned.
+	SetLeavesStream(ctx context.Context, opts ...grpc.CallOption) (TrillianMap_SetLeavesStreamClient, error)
+	GetSignedMapRoot(ctx context.Context, in *GetSignedMapRootRequest, opts ...grpc.CallOption) (*GetSignedMapRootResponse, error)
+	// GetSignedMapRootByRevision returns the root published for an earlier
+	// revision, so that clients can verify data from that revision.
+	GetSignedMapRootByRevision(ctx context.Context, in *GetSignedMapRootByRevisionRequest, opts ...grpc.CallOption) (*GetSignedMapRootResponse, error)
+	// GetTreeKeys returns the public keys of the map, so clients can check roots
+	// signed before and after its key is rotated.
+	GetTreeKeys(ctx context.Context, in *GetTreeKeysRequest, opts ...grpc.CallOption) (*GetTreeKeysResponse, error)
+	PublishMapRevision(ctx context.Context, in *PublishMapRevisionRequest, opts ...grpc.CallOption) (*PublishMapRevisionResponse, error)
+	AbandonMapRevision(ctx context.Context, in *AbandonMapRevisionRequest, opts ...grpc.CallOption) (*AbandonMapRevisionResponse, error)
+	// GetMapUpdateProof returns the leaves set by a revision along with proofs
+	// of their previous values, from which the new root can be calculated from
+	// the previous one. Mirrors can use it to follow a map without fetching all
+	// of every revision.
+	GetMapUpdateProof(ctx context.Context, in *GetMapUpdateProofRequest, opts ...grpc.CallOption) (*GetMapUpdateProofResponse, error)
+	// ListMapLeaves streams every leaf of a published revision of a map in key
+	// hash order, so auditors can export the map and calculate its root
+	// independently. Deleted keys aren't listed.
+	ListMapLeaves(ctx context.Context, in *ListMapLeavesRequest, opts ...grpc.CallOption) (TrillianMap_ListMapLeavesClient, error)
+	// InitMap creates and stores the root of a newly created map, at revision 0,
+	// which must be done before its root can be read. It fails if the map
+	// already has a root.
+	InitMap(ctx context.Context, in *InitMapRequest, opts ...grpc.CallOption) (*InitMapResponse, error)
+	// TagMapRevision names a published revision, so that readers can refer to
+	// it by a stable tag. Tagging a revision again with the same tag succeeds,
+	// but a tag can't be moved to another revision.
+	TagMapRevision(ctx context.Context, in *TagMapRevisionRequest, opts ...grpc.CallOption) (*TagMapRevisionResponse, error)
+	GetMapRevisionTags(ctx context.Context, in *GetMapRevisionTagsRequest, opts ...grpc.CallOption) (*GetMapRevisionTagsResponse, error)
+}
+
+type trillianMapClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewTrillianMapClient(cc *grpc.ClientConn) TrillianMapClient {
+	return &trillianMapClient{cc}
+}
+
+func (c *trillianMapClient) GetLeaves(ctx context.Context, in *GetMapLeavesRequest, opts ...grpc.CallOption) (*GetMapLeavesResponse, error) {
+	out := new(GetMapLeavesResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianMap/GetLeaves", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianMapClient) GetMapLeavesWithProof(ctx context.Context, in *GetMapLeavesRequest, opts ...grpc.CallOption) (*GetMapLeavesWithProofResponse, error) {
+	out := new(GetMapLeavesWithProofResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianMap/GetMapLeavesWithProof", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianMapClient) SetLeaves(ctx context.Context, in *SetMapLeavesRequest, opts ...grpc.CallOption) (*SetMapLeavesResponse, error) {
+	out := new(SetMapLeavesResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianMap/SetLeaves", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianMapClient) SetLeavesStream(ctx context.Context, opts ...grpc.CallOption) (TrillianMap_SetLeavesStreamClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_TrillianMap_serviceDesc.Streams[0], c.cc, "/trillian.TrillianMap/SetLeavesStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &trillianMapSetLeavesStreamClient{stream}
+	return x, nil
+}
+
+type TrillianMap_SetLeavesStreamClient interface {
+	Send(*SetMapLeavesRequest) error
+	CloseAndRecv() (*SetMapLeavesResponse, error)
+	grpc.ClientStream
+}
+
+type trillianMapSetLeavesStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *trillianMapSetLeavesStreamClient) Send(m *SetMapLeavesRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *trillianMapSetLeavesStreamClient) CloseAndRecv() (*SetMapLeavesResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(SetMapLeavesResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *trillianMapClient) GetSignedMapRoot(ctx context.Context, in *GetSignedMapRootRequest, opts ...grpc.CallOption) (*GetSignedMapRootResponse, error) {
+	out := new(GetSignedMapRootResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianMap/GetSignedMapRoot", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianMapClient) GetSignedMapRootByRevision(ctx context.Context, in *GetSignedMapRootByRevisionRequest, opts ...grpc.CallOption) (*GetSignedMapRootResponse, error) {
+	out := new(GetSignedMapRootResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianMap/GetSignedMapRootByRevision", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianMapClient) GetTreeKeys(ctx context.Context, in *GetTreeKeysRequest, opts ...grpc.CallOption) (*GetTreeKeysResponse, error) {
+	out := new(GetTreeKeysResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianMap/GetTreeKeys", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianMapClient) PublishMapRevision(ctx context.Context, in *PublishMapRevisionRequest, opts ...grpc.CallOption) (*PublishMapRevisionResponse, error) {
+	out := new(PublishMapRevisionResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianMap/PublishMapRevision", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianMapClient) AbandonMapRevision(ctx context.Context, in *AbandonMapRevisionRequest, opts ...grpc.CallOption) (*AbandonMapRevisionResponse, error) {
+	out := new(AbandonMapRevisionResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianMap/AbandonMapRevision", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianMapClient) GetMapUpdateProof(ctx context.Context, in *GetMapUpdateProofRequest, opts ...grpc.CallOption) (*GetMapUpdateProofResponse, error) {
+	out := new(GetMapUpdateProofResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianMap/GetMapUpdateProof", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianMapClient) ListMapLeaves(ctx context.Context, in *ListMapLeavesRequest, opts ...grpc.CallOption) (TrillianMap_ListMapLeavesClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_TrillianMap_serviceDesc.Streams[1], c.cc, "/trillian.TrillianMap/ListMapLeaves", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &trillianMapListMapLeavesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type TrillianMap_ListMapLeavesClient interface {
+	Recv() (*ListMapLeavesResponse, error)
+	grpc.ClientStream
+}
+
+type trillianMapListMapLeavesClient struct {
+	grpc.ClientStream
+}
+
+func (x *trillianMapListMapLeavesClient) Recv() (*ListMapLeavesResponse, error) {
+	m := new(ListMapLeavesResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *trillianMapClient) InitMap(ctx context.Context, in *InitMapRequest, opts ...grpc.CallOption) (*InitMapResponse, error) {
+	out := new(InitMapResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianMap/InitMap", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianMapClient) TagMapRevision(ctx context.Context, in *TagMapRevisionRequest, opts ...grpc.CallOption) (*TagMapRevisionResponse, error) {
+	out := new(TagMapRevisionResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianMap/TagMapRevision", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianMapClient) GetMapRevisionTags(ctx context.Context, in *GetMapRevisionTagsRequest, opts ...grpc.CallOption) (*GetMapRevisionTagsResponse, error) {
+	out := new(GetMapRevisionTagsResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianMap/GetMapRevisionTags", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for TrillianMap service
+
+type TrillianMapServer interface {
+	GetLeaves(context.Context, *GetMapLeavesRequest) (*GetMapLeavesResponse, error)
+	// GetMapLeavesWithProof returns a proof for each requested key against the
+	// signed root of the revision read, proving either the key's value or that it
+	// has none.
+	GetMapLeavesWithProof(context.Context, *GetMapLeavesRequest) (*GetMapLeavesWithProofResponse, error)
+	// SetLeaves writes the leaves, the nodes of the recalculated tree and the
+	// signed root of a single new revision in one transaction, so that either
+	// all of them are stored or none are.
+	SetLeaves(context.Context, *SetMapLeavesRequest) (*SetMapLeavesResponse, error)
+	// SetLeavesStream writes a single new revision from leaves streamed in any
+	// number of requests, so very large updates don't need one huge message. The
+	// first request sets the options for the whole revision. Later requests only
+	// add key_value entries and must have the same map_id, or leave it unset.
+	// Nothing is written until the stream is closed, when the new root is
+	// returned.
+	SetLeavesStream(TrillianMap_SetLeavesStreamServer) error
+	GetSignedMapRoot(context.Context, *GetSignedMapRootRequest) (*GetSignedMapRootResponse, error)
+	// GetSignedMapRootByRevision returns the root published for an earlier
+	// revision, so that clients can verify data from that revision.
+	GetSignedMapRootByRevision(context.Context, *GetSignedMapRootByRevisionRequest) (*GetSignedMapRootResponse, error)
+	// GetTreeKeys returns the public keys of the map, so clients can check roots
+	// signed before and after its key is rotated.
+	GetTreeKeys(context.Context, *GetTreeKeysRequest) (*GetTreeKeysResponse, error)
+	PublishMapRevision(context.Context, *PublishMapRevisionRequest) (*PublishMapRevisionResponse, error)
+	AbandonMapRevision(context.Context, *AbandonMapRevisionRequest) (*AbandonMapRevisionResponse, error)
+	// GetMapUpdateProof returns the leaves set by a revision along with proofs
+	// of their previous values, from which the new root can be calculated from
+	// the previous one. Mirrors can use it to follow a map without fetching all
+	// of every revision.
+	GetMapUpdateProof(context.Context, *GetMapUpdateProofRequest) (*GetMapUpdateProofResponse, error)
+	// ListMapLeaves streams every leaf of a published revision of a map in key
+	// hash order, so auditors can export the map and calculate its root
+	// independently. Deleted keys aren't listed.
+	ListMapLeaves(*ListMapLeavesRequest, TrillianMap_ListMapLeavesServer) error
+	// InitMap creates and stores the root of a newly created map, at revision 0,
+	// which must be done before its root can be read. It fails if the map
+	// already has a root.
+	InitMap(context.Context, *InitMapRequest) (*InitMapResponse, error)
+	// TagMapRevision names a published revision, so that readers can refer to
+	// it by a stable tag. Tagging a revision again with the same tag succeeds,
+	// but a tag can't be moved to another revision.
+	TagMapRevision(context.Context, *TagMapRevisionRequest) (*TagMapRevisionResponse, error)
+	GetMapRevisionTags(context.Context, *GetMapRevisionTagsRequest) (*GetMapRevisionTagsResponse, error)
+}
+
+func RegisterTrillianMapServer(s *grpc.Server, srv TrillianMapServer) {
+	s.RegisterService(&_TrillianMap_serviceDesc, srv)
+}
+
+func _TrillianMap_GetLeaves_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMapLeavesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianMapServer).GetLeaves(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianMap/GetLeaves",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianMapServer).GetLeaves(ctx, req.(*GetMapLeavesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (c *trillianLogClient) GetConsistencyProof(ctx context.Context, in *GetConsistencyProofRequest, opts ...grpc.CallOption) (*GetConsistencyProofResponse, error) {
-	out := new(GetConsistencyProofResponse)
-	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetConsistencyProof", in, out, c.cc, opts...)
-	if err != nil {
+func _TrillianMap_GetMapLeavesWithProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMapLeavesRequest)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return out, nil
-}
-
-func (c *trillianLogClient) GetLatestSignedLogRoot(ctx context.Context, in *GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*GetLatestSignedLogRootResponse, error) {
-	out := new(GetLatestSignedLogRootResponse)
-	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetLatestSignedLogRoot", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+	if interceptor == nil {
+		return srv.(TrillianMapServer).GetMapLeavesWithProof(ctx, in)
 	}
-	return out, nil
-}
-
-func (c *trillianLogClient) GetSequencedLeafCount(ctx context.Context, in *GetSequencedLeafCountRequest, opts ...grpc.CallOption) (*GetSequencedLeafCountResponse, error) {
-	out := new(GetSequencedLeafCountResponse)
-	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetSequencedLeafCount", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianMap/GetMapLeavesWithProof",
 	}
-	return out, nil
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianMapServer).GetMapLeavesWithProof(ctx, req.(*GetMapLeavesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (c *trillianLogClient) GetLeavesByIndex(ctx context.Context, in *GetLeavesByIndexRequest, opts ...grpc.CallOption) (*GetLeavesByIndexResponse, error) {
-	out := new(GetLeavesByIndexResponse)
-	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetLeavesByIndex", in, out, c.cc, opts...)
-	if err != nil {
+func _TrillianMap_SetLeaves_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetMapLeavesRequest)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return out, nil
+	if interceptor == nil {
+		return srv.(TrillianMapServer).SetLeaves(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianMap/SetLeaves",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianMapServer).SetLeaves(ctx, req.(*SetMapLeavesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (c *trillianLogClient) GetLeavesByHash(ctx context.Context, in *GetLeavesByHashRequest, opts ...grpc.CallOption) (*GetLeavesByHashResponse, error) {
-	out := new(GetLeavesByHashResponse)
-	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetLeavesByHash", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
-	}
-	return out, nil
+func _TrillianMap_SetLeavesStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TrillianMapServer).SetLeavesStream(&trillianMapSetLeavesStreamServer{stream})
 }
 
-func (c *trillianLogClient) GetEntryAndProof(ctx context.Context, in *GetEntryAndProofRequest, opts ...grpc.CallOption) (*GetEntryAndProofResponse, error) {
-	out := new(GetEntryAndProofResponse)
-	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetEntryAndProof", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
-	}
-	return out, nil
+type TrillianMap_SetLeavesStreamServer interface {
+	SendAndClose(*SetMapLeavesResponse) error
+	Recv() (*SetMapLeavesRequest, error)
+	grpc.ServerStream
 }
 
-// Server API for TrillianLog service
+type trillianMapSetLeavesStreamServer struct {
+	grpc.ServerStream
+}
 
-type TrillianLogServer interface {
-	// Corresponds to the LeafQueuer API
-	QueueLeaves(context.Context, *QueueLeavesRequest) (*QueueLeavesResponse, error)
-	// No direct equivalent at the storage level
-	GetInclusionProof(context.Context, *GetInclusionProofRequest) (*GetInclusionProofResponse, error)
-	GetInclusionProofByHash(context.Context, *GetInclusionProofByHashRequest) (*GetInclusionProofByHashResponse, error)
-	GetConsistencyProof(context.Context, *GetConsistencyProofRequest) (*GetConsistencyProofResponse, error)
-	// Corresponds to the LogRootReader API
-	GetLatestSignedLogRoot(context.Context, *GetLatestSignedLogRootRequest) (*GetLatestSignedLogRootResponse, error)
-	// Corresponds to the LeafReader API
-	GetSequencedLeafCount(context.Context, *GetSequencedLeafCountRequest) (*GetSequencedLeafCountResponse, error)
-	GetLeavesByIndex(context.Context, *GetLeavesByIndexRequest) (*GetLeavesByIndexResponse, error)
-	GetLeavesByHash(context.Context, *GetLeavesByHashRequest) (*GetLeavesByHashResponse, error)
-	GetEntryAndProof(context.Context, *GetEntryAndProofRequest) (*GetEntryAndProofResponse, error)
+func (x *trillianMapSetLeavesStreamServer) SendAndClose(m *SetMapLeavesResponse) error {
+	return x.ServerStream.SendMsg(m)
 }
 
-func RegisterTrillianLogServer(s *grpc.Server, srv TrillianLogServer) {
-	s.RegisterService(&_TrillianLog_serviceDesc, srv)
+func (x *trillianMapSetLeavesStreamServer) Recv() (*SetMapLeavesRequest, error) {
+	m := new(SetMapLeavesRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
-func _TrillianLog_QueueLeaves_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(QueueLeavesRequest)
+func _TrillianMap_GetSignedMapRoot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSignedMapRootRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TrillianLogServer).QueueLeaves(ctx, in)
+		return srv.(TrillianMapServer).GetSignedMapRoot(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/trillian.TrillianLog/QueueLeaves",
+		FullMethod: "/trillian.TrillianMap/GetSignedMapRoot",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TrillianLogServer).QueueLeaves(ctx, req.(*QueueLeavesRequest))
+		return srv.(TrillianMapServer).GetSignedMapRoot(ctx, req.(*GetSignedMapRootRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _TrillianLog_GetInclusionProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetInclusionProofRequest)
+func _TrillianMap_GetSignedMapRootByRevision_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSignedMapRootByRevisionRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TrillianLogServer).GetInclusionProof(ctx, in)
+		return srv.(TrillianMapServer).GetSignedMapRootByRevision(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/trillian.TrillianLog/GetInclusionProof",
+		FullMethod: "/trillian.TrillianMap/GetSignedMapRootByRevision",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TrillianLogServer).GetInclusionProof(ctx, req.(*GetInclusionProofRequest))
+		return srv.(TrillianMapServer).GetSignedMapRootByRevision(ctx, req.(*GetSignedMapRootByRevisionRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _TrillianLog_GetInclusionProofByHash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetInclusionProofByHashRequest)
+func _TrillianMap_GetTreeKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTreeKeysRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TrillianLogServer).GetInclusionProofByHash(ctx, in)
+		return srv.(TrillianMapServer).GetTreeKeys(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/trillian.TrillianLog/GetInclusionProofByHash",
+		FullMethod: "/trillian.TrillianMap/GetTreeKeys",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TrillianLogServer).GetInclusionProofByHash(ctx, req.(*GetInclusionProofByHashRequest))
+		return srv.(TrillianMapServer).GetTreeKeys(ctx, req.(*GetTreeKeysRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _TrillianLog_GetConsistencyProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetConsistencyProofRequest)
+func _TrillianMap_PublishMapRevision_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublishMapRevisionRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TrillianLogServer).GetConsistencyProof(ctx, in)
+		return srv.(TrillianMapServer).PublishMapRevision(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/trillian.TrillianLog/GetConsistencyProof",
+		FullMethod: "/trillian.TrillianMap/PublishMapRevision",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TrillianLogServer).GetConsistencyProof(ctx, req.(*GetConsistencyProofRequest))
+		return srv.(TrillianMapServer).PublishMapRevision(ctx, req.(*PublishMapRevisionRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _TrillianLog_GetLatestSignedLogRoot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetLatestSignedLogRootRequest)
+func _TrillianMap_AbandonMapRevision_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AbandonMapRevisionRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TrillianLogServer).GetLatestSignedLogRoot(ctx, in)
+		return srv.(TrillianMapServer).AbandonMapRevision(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/trillian.TrillianLog/GetLatestSignedLogRoot",
+		FullMethod: "/trillian.TrillianMap/AbandonMapRevision",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TrillianLogServer).GetLatestSignedLogRoot(ctx, req.(*GetLatestSignedLogRootRequest))
+		return srv.(TrillianMapServer).AbandonMapRevision(ctx, req.(*AbandonMapRevisionRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _TrillianLog_GetSequencedLeafCount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetSequencedLeafCountRequest)
+func _TrillianMap_GetMapUpdateProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMapUpdateProofRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TrillianLogServer).GetSequencedLeafCount(ctx, in)
+		return srv.(TrillianMapServer).GetMapUpdateProof(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/trillian.TrillianLog/GetSequencedLeafCount",
+		FullMethod: "/trillian.TrillianMap/GetMapUpdateProof",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TrillianLogServer).GetSequencedLeafCount(ctx, req.(*GetSequencedLeafCountRequest))
+		return srv.(TrillianMapServer).GetMapUpdateProof(ctx, req.(*GetMapUpdateProofRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _TrillianLog_GetLeavesByIndex_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetLeavesByIndexRequest)
+func _TrillianMap_ListMapLeaves_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListMapLeavesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TrillianMapServer).ListMapLeaves(m, &trillianMapListMapLeavesServer{stream})
+}
+
+type TrillianMap_ListMapLeavesServer interface {
+	Send(*ListMapLeavesResponse) error
+	grpc.ServerStream
+}
+
+type trillianMapListMapLeavesServer struct {
+	grpc.ServerStream
+}
+
+func (x *trillianMapListMapLeavesServer) Send(m *ListMapLeavesResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _TrillianMap_InitMap_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InitMapRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TrillianLogServer).GetLeavesByIndex(ctx, in)
+		return srv.(TrillianMapServer).InitMap(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/trillian.TrillianLog/GetLeavesByIndex",
+		FullMethod: "/trillian.TrillianMap/InitMap",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TrillianLogServer).GetLeavesByIndex(ctx, req.(*GetLeavesByIndexRequest))
+		return srv.(TrillianMapServer).InitMap(ctx, req.(*InitMapRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _TrillianLog_GetLeavesByHash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetLeavesByHashRequest)
+func _TrillianMap_TagMapRevision_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TagMapRevisionRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TrillianLogServer).GetLeavesByHash(ctx, in)
+		return srv.(TrillianMapServer).TagMapRevision(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/trillian.TrillianLog/GetLeavesByHash",
+		FullMethod: "/trillian.TrillianMap/TagMapRevision",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TrillianLogServer).GetLeavesByHash(ctx, req.(*GetLeavesByHashRequest))
+		return srv.(TrillianMapServer).TagMapRevision(ctx, req.(*TagMapRevisionRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _TrillianLog_GetEntryAndProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetEntryAndProofRequest)
+func _TrillianMap_GetMapRevisionTags_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMapRevisionTagsRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TrillianLogServer).GetEntryAndProof(ctx, in)
+		return srv.(TrillianMapServer).GetMapRevisionTags(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/trillian.TrillianLog/GetEntryAndProof",
+		FullMethod: "/trillian.TrillianMap/GetMapRevisionTags",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TrillianLogServer).GetEntryAndProof(ctx, req.(*GetEntryAndProofRequest))
+		return srv.(TrillianMapServer).GetMapRevisionTags(ctx, req.(*GetMapRevisionTagsRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-var _TrillianLog_serviceDesc = grpc.ServiceDesc{
-	ServiceName: "trillian.TrillianLog",
-	HandlerType: (*TrillianLogServer)(nil),
+var _TrillianMap_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "trillian.TrillianMap",
+	HandlerType: (*TrillianMapServer)(nil),
 	Methods: []grpc.MethodDesc{
 		{
-			MethodName: "QueueLeaves",
-			Handler:    _TrillianLog_QueueLeaves_Handler,
+			MethodName: "GetLeaves",
+			Handler:    _TrillianMap_GetLeaves_Handler,
 		},
 		{
-			MethodName: "GetInclusionProof",
-			Handler:    _TrillianLog_GetInclusionProof_Handler,
+			MethodName: "GetMapLeavesWithProof",
+			Handler:    _TrillianMap_GetMapLeavesWithProof_Handler,
 		},
 		{
-			MethodName: "GetInclusionProofByHash",
-			Handler:    _TrillianLog_GetInclusionProofByHash_Handler,
+			MethodName: "SetLeaves",
+			Handler:    _TrillianMap_SetLeaves_Handler,
 		},
 		{
-			MethodName: "GetConsistencyProof",
-			Handler:    _TrillianLog_GetConsistencyProof_Handler,
+			MethodName: "GetSignedMapRoot",
+			Handler:    _TrillianMap_GetSignedMapRoot_Handler,
 		},
 		{
-			MethodName: "GetLatestSignedLogRoot",
-			Handler:    _TrillianLog_GetLatestSignedLogRoot_Handler,
+			MethodName: "GetSignedMapRootByRevision",
+			Handler:    _TrillianMap_GetSignedMapRootByRevision_Handler,
 		},
 		{
-			MethodName: "GetSequencedLeafCount",
-			Handler:    _TrillianLog_GetSequencedLeafCount_Handler,
+			MethodName: "GetTreeKeys",
+			Handler:    _TrillianMap_GetTreeKeys_Handler,
 		},
 		{
-			MethodName: "GetLeavesByIndex",
-			Handler:    _TrillianLog_GetLeavesByIndex_Handler,
+			MethodName: "PublishMapRevision",
+			Handler:    _TrillianMap_PublishMapRevision_Handler,
 		},
 		{
-			MethodName: "GetLeavesByHash",
-			Handler:    _TrillianLog_GetLeavesByHash_Handler,
+			MethodName: "AbandonMapRevision",
+			Handler:    _TrillianMap_AbandonMapRevision_Handler,
 		},
 		{
-			MethodName: "GetEntryAndProof",
-			Handler:    _TrillianLog_GetEntryAndProof_Handler,
+			MethodName: "GetMapUpdateProof",
+			Handler:    _TrillianMap_GetMapUpdateProof_Handler,
+		},
+		{
+			MethodName: "InitMap",
+			Handler:    _TrillianMap_InitMap_Handler,
+		},
+		{
+			MethodName: "TagMapRevision",
+			Handler:    _TrillianMap_TagMapRevision_Handler,
+		},
+		{
+			MethodName: "GetMapRevisionTags",
+			Handler:    _TrillianMap_GetMapRevisionTags_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SetLeavesStream",
+			Handler:       _TrillianMap_SetLeavesStream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ListMapLeaves",
+			Handler:       _TrillianMap_ListMapLeaves_Handler,
+			ServerStreams: true,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: fileDescriptor0,
 }
 
-// Client API for TrillianMap service
+// Client API for TrillianWitness service
 
-type TrillianMapClient interface {
-	GetLeaves(ctx context.Context, in *GetMapLeavesRequest, opts ...grpc.CallOption) (*GetMapLeavesResponse, error)
-	SetLeaves(ctx context.Context, in *SetMapLeavesRequest, opts ...grpc.CallOption) (*SetMapLeavesResponse, error)
-	GetSignedMapRoot(ctx context.Context, in *GetSignedMapRootRequest, opts ...grpc.CallOption) (*GetSignedMapRootResponse, error)
+type TrillianWitnessClient interface {
+	// AddCheckpoint checks a log root is signed by the log and proven consistent
+	// with the root the witness has seen, and if so returns the witness's
+	// signature of it. If the proof is from another tree size the request fails
+	// with FAILED_PRECONDITION, and the witnessed root can be read to retry.
+	AddCheckpoint(ctx context.Context, in *AddCheckpointRequest, opts ...grpc.CallOption) (*AddCheckpointResponse, error)
+	GetWitnessedRoot(ctx context.Context, in *GetWitnessedRootRequest, opts ...grpc.CallOption) (*GetWitnessedRootResponse, error)
 }
 
-type trillianMapClient struct {
+type trillianWitnessClient struct {
 	cc *grpc.ClientConn
 }
 
-func NewTrillianMapClient(cc *grpc.ClientConn) TrillianMapClient {
-	return &trillianMapClient{cc}
-}
-
-func (c *trillianMapClient) GetLeaves(ctx context.Context, in *GetMapLeavesRequest, opts ...grpc.CallOption) (*GetMapLeavesResponse, error) {
-	out := new(GetMapLeavesResponse)
-	err := grpc.Invoke(ctx, "/trillian.TrillianMap/GetLeaves", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
-	}
-	return out, nil
+func NewTrillianWitnessClient(cc *grpc.ClientConn) TrillianWitnessClient {
+	return &trillianWitnessClient{cc}
 }
 
-func (c *trillianMapClient) SetLeaves(ctx context.Context, in *SetMapLeavesRequest, opts ...grpc.CallOption) (*SetMapLeavesResponse, error) {
-	out := new(SetMapLeavesResponse)
-	err := grpc.Invoke(ctx, "/trillian.TrillianMap/SetLeaves", in, out, c.cc, opts...)
+func (c *trillianWitnessClient) AddCheckpoint(ctx context.Context, in *AddCheckpointRequest, opts ...grpc.CallOption) (*AddCheckpointResponse, error) {
+	out := new(AddCheckpointResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianWitness/AddCheckpoint", in, out, c.cc, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *trillianMapClient) GetSignedMapRoot(ctx context.Context, in *GetSignedMapRootRequest, opts ...grpc.CallOption) (*GetSignedMapRootResponse, error) {
-	out := new(GetSignedMapRootResponse)
-	err := grpc.Invoke(ctx, "/trillian.TrillianMap/GetSignedMapRoot", in, out, c.cc, opts...)
+func (c *trillianWitnessClient) GetWitnessedRoot(ctx context.Context, in *GetWitnessedRootRequest, opts ...grpc.CallOption) (*GetWitnessedRootResponse, error) {
+	out := new(GetWitnessedRootResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianWitness/GetWitnessedRoot", in, out, c.cc, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-// Server API for TrillianMap service
-
-type TrillianMapServer interface {
-	GetLeaves(context.Context, *GetMapLeavesRequest) (*GetMapLeavesResponse, error)
-	SetLeaves(context.Context, *SetMapLeavesRequest) (*SetMapLeavesResponse, error)
-	GetSignedMapRoot(context.Context, *GetSignedMapRootRequest) (*GetSignedMapRootResponse, error)
-}
+// Server API for TrillianWitness service
 
-func RegisterTrillianMapServer(s *grpc.Server, srv TrillianMapServer) {
-	s.RegisterService(&_TrillianMap_serviceDesc, srv)
+type TrillianWitnessServer interface {
+	// AddCheckpoint checks a log root is signed by the log and proven consistent
+	// with the root the witness has seen, and if so returns the witness's
+	// signature of it. If the proof is from another tree size the request fails
+	// with FAILED_PRECONDITION, and the witnessed root can be read to retry.
+	AddCheckpoint(context.Context, *AddCheckpointRequest) (*AddCheckpointResponse, error)
+	GetWitnessedRoot(context.Context, *GetWitnessedRootRequest) (*GetWitnessedRootResponse, error)
 }
 
-func _TrillianMap_GetLeaves_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetMapLeavesRequest)
-	if err := dec(in); err != nil {
-		return nil, err
-	}
-	if interceptor == nil {
-		return srv.(TrillianMapServer).GetLeaves(ctx, in)
-	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/trillian.TrillianMap/GetLeaves",
-	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TrillianMapServer).GetLeaves(ctx, req.(*GetMapLeavesRequest))
-	}
-	return interceptor(ctx, in, info, handler)
+func RegisterTrillianWitnessServer(s *grpc.Server, srv TrillianWitnessServer) {
+	s.RegisterService(&_TrillianWitness_serviceDesc, srv)
 }
 
-func _TrillianMap_SetLeaves_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(SetMapLeavesRequest)
+func _TrillianWitness_AddCheckpoint_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddCheckpointRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TrillianMapServer).SetLeaves(ctx, in)
+		return srv.(TrillianWitnessServer).AddCheckpoint(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/trillian.TrillianMap/SetLeaves",
+		FullMethod: "/trillian.TrillianWitness/AddCheckpoint",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TrillianMapServer).SetLeaves(ctx, req.(*SetMapLeavesRequest))
+		return srv.(TrillianWitnessServer).AddCheckpoint(ctx, req.(*AddCheckpointRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _TrillianMap_GetSignedMapRoot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetSignedMapRootRequest)
+func _TrillianWitness_GetWitnessedRoot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetWitnessedRootRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(TrillianMapServer).GetSignedMapRoot(ctx, in)
+		return srv.(TrillianWitnessServer).GetWitnessedRoot(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/trillian.TrillianMap/GetSignedMapRoot",
+		FullMethod: "/trillian.TrillianWitness/GetWitnessedRoot",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TrillianMapServer).GetSignedMapRoot(ctx, req.(*GetSignedMapRootRequest))
+		return srv.(TrillianWitnessServer).GetWitnessedRoot(ctx, req.(*GetWitnessedRootRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-var _TrillianMap_serviceDesc = grpc.ServiceDesc{
-	ServiceName: "trillian.TrillianMap",
-	HandlerType: (*TrillianMapServer)(nil),
+var _TrillianWitness_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "trillian.TrillianWitness",
+	HandlerType: (*TrillianWitnessServer)(nil),
 	Methods: []grpc.MethodDesc{
 		{
-			MethodName: "GetLeaves",
-			Handler:    _TrillianMap_GetLeaves_Handler,
-		},
-		{
-			MethodName: "SetLeaves",
-			Handler:    _TrillianMap_SetLeaves_Handler,
+			MethodName: "AddCheckpoint",
+			Handler:    _TrillianWitness_AddCheckpoint_Handler,
 		},
 		{
-			MethodName: "GetSignedMapRoot",
-			Handler:    _TrillianMap_GetSignedMapRoot_Handler,
+			MethodName: "GetWitnessedRoot",
+			Handler:    _TrillianWitness_GetWitnessedRoot_Handler,
 		},
 	},
 	Streams:  []grpc.StreamDesc{},
@@ -1148,85 +2987,181 @@ var _TrillianMap_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("github.com/google/trillian/trillian_api.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 1270 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xbc, 0x58, 0x6d, 0x73, 0xdb, 0x44,
-	0x10, 0x8e, 0xac, 0xbc, 0xd8, 0xeb, 0xa6, 0x71, 0x2e, 0x09, 0x71, 0x94, 0xa4, 0x4d, 0xaf, 0xd0,
-	0xa4, 0x61, 0x48, 0x18, 0x77, 0x60, 0xe0, 0x13, 0x34, 0x21, 0x03, 0xa1, 0x29, 0x29, 0x72, 0x87,
-	0xe9, 0xc0, 0x0c, 0x1a, 0xc5, 0xba, 0x38, 0x02, 0x5b, 0x32, 0x96, 0x1c, 0x62, 0xe8, 0xd0, 0x99,
-	0x32, 0xf0, 0x13, 0x18, 0xbe, 0xf0, 0x8d, 0x3f, 0xc1, 0xbf, 0xe3, 0x5e, 0xf4, 0x76, 0x7a, 0xb1,
-	0x53, 0x52, 0xf2, 0x4d, 0xb7, 0xbb, 0xf7, 0xec, 0xb3, 0x7b, 0x7b, 0xab, 0x95, 0xe0, 0x9d, 0xb6,
-	0xed, 0x9f, 0x0d, 0x4e, 0x76, 0x5a, 0x6e, 0x77, 0xb7, 0xed, 0xba, 0xed, 0x0e, 0xd9, 0xf5, 0xfb,
-	0x76, 0xa7, 0x63, 0x9b, 0x4e, 0xf4, 0x60, 0x98, 0x3d, 0x7b, 0xa7, 0xd7, 0x77, 0x7d, 0x17, 0x95,
-	0x43, 0x99, 0x76, 0xff, 0x12, 0x1b, 0xc5, 0x26, 0xfc, 0x23, 0xcc, 0x3f, 0x0d, 0x24, 0x0f, 0x7b,
-	0x76, 0xd3, 0x37, 0xfd, 0x81, 0x87, 0x3e, 0x86, 0xaa, 0xc7, 0x9f, 0x8c, 0x96, 0x6b, 0x91, 0xba,
-	0xb2, 0xa1, 0x6c, 0xdd, 0x6c, 0xdc, 0xde, 0x89, 0xb6, 0x66, 0x76, 0xec, 0x53, 0x33, 0x1d, 0xbc,
-	0xe8, 0x19, 0x6d, 0x40, 0xd5, 0x22, 0x5e, 0xab, 0x6f, 0xf7, 0x7c, 0xdb, 0x75, 0xea, 0x25, 0x8a,
-	0x50, 0xd1, 0x93, 0x22, 0xfc, 0xab, 0x02, 0x95, 0x23, 0x62, 0x9e, 0x3e, 0xe1, 0xdc, 0x57, 0xa1,
-	0xd2, 0xa1, 0x0b, 0xe3, 0xcc, 0xf4, 0xce, 0xb8, 0xbf, 0x1b, 0x7a, 0x99, 0x09, 0x3e, 0xa3, 0xeb,
-	0x48, 0x69, 0x99, 0xbe, 0xc9, 0xa1, 0x02, 0xe5, 0x27, 0x74, 0x8d, 0xd6, 0x01, 0xc8, 0x85, 0xdf,
-	0x37, 0x85, 0x56, 0xe5, 0xda, 0x0a, 0x97, 0x84, 0x6a, 0xbe, 0xd7, 0x76, 0x2c, 0x72, 0x51, 0x9f,
-	0xa4, 0x6a, 0x55, 0xe7, 0x68, 0x87, 0x4c, 0x80, 0x4f, 0xa1, 0xf2, 0x05, 0xe5, 0x2b, 0x48, 0x2c,
-	0xc3, 0x8c, 0x43, 0x17, 0x86, 0x6d, 0x05, 0x14, 0xa6, 0xd9, 0xf2, 0xd0, 0x62, 0x04, 0xb8, 0x82,
-	0xb3, 0x0b, 0x08, 0x30, 0x01, 0x67, 0x77, 0x17, 0x66, 0xb9, 0xb2, 0x4f, 0xce, 0x6d, 0x8f, 0x05,
-	0xab, 0x72, 0x27, 0x37, 0x98, 0x50, 0x0f, 0x64, 0xd8, 0x00, 0xa0, 0x3e, 0xdc, 0x20, 0x5a, 0x99,
-	0x94, 0x92, 0x22, 0x85, 0x1a, 0x00, 0x3d, 0x66, 0x6c, 0x30, 0x08, 0xea, 0x4f, 0xdd, 0xaa, 0x36,
-	0x16, 0xe2, 0xec, 0x47, 0x84, 0xf5, 0x0a, 0x37, 0x63, 0x6b, 0xfc, 0x0c, 0xd0, 0x97, 0x03, 0x32,
-	0x20, 0x34, 0xa5, 0xe7, 0xc4, 0xd3, 0xc9, 0x0f, 0x03, 0xe2, 0xf9, 0x68, 0x09, 0xa6, 0x3b, 0x6e,
-	0x3b, 0x0c, 0x48, 0xd5, 0xa7, 0xe8, 0x8a, 0xc6, 0xf3, 0x36, 0x15, 0x73, 0xbb, 0x2c, 0x78, 0x74,
-	0x24, 0x7a, 0x60, 0x82, 0x3f, 0x87, 0x05, 0x09, 0xd9, 0xeb, 0xb9, 0x8e, 0x47, 0xd0, 0x03, 0x98,
-	0x16, 0xe7, 0xcd, 0xa1, 0xab, 0x8d, 0xd5, 0x11, 0xe5, 0xa1, 0x07, 0xa6, 0xb8, 0x0b, 0xf5, 0x4f,
-	0x89, 0x7f, 0xe8, 0xb4, 0x3a, 0x03, 0x96, 0x16, 0x9e, 0x92, 0x31, 0x5c, 0xe5, 0x5c, 0x95, 0xd2,
-	0xb9, 0xa2, 0x47, 0xe3, 0xf7, 0x09, 0x31, 0x3c, 0xfb, 0x27, 0x12, 0x64, 0xbe, 0xcc, 0x04, 0x4d,
-	0xba, 0xc6, 0xcf, 0x61, 0x25, 0xc7, 0xdd, 0x15, 0x02, 0x40, 0xdb, 0x30, 0xc5, 0x73, 0xce, 0x89,
-	0x54, 0x1b, 0x8b, 0xf1, 0x9e, 0xf8, 0x78, 0x75, 0x61, 0x82, 0xff, 0x52, 0xe0, 0x56, 0xc6, 0xfd,
-	0xde, 0x90, 0x15, 0xcd, 0x98, 0x98, 0xa5, 0xdb, 0x50, 0xca, 0xde, 0x86, 0xc2, 0x88, 0x29, 0xbf,
-	0x79, 0xb7, 0x6f, 0x91, 0xbe, 0x71, 0x32, 0x34, 0x3c, 0xe6, 0xc4, 0x69, 0x11, 0x5e, 0xf5, 0x65,
-	0x7d, 0x8e, 0x2b, 0xf6, 0x86, 0xcd, 0x40, 0x8c, 0x5f, 0x2a, 0x70, 0xbb, 0x90, 0xdf, 0x6b, 0x4a,
-	0x92, 0x3a, 0x2e, 0x49, 0xbf, 0x29, 0xa0, 0x51, 0x12, 0xfb, 0xd4, 0x9b, 0xed, 0xf9, 0x94, 0xd7,
-	0xf0, 0x32, 0x45, 0x71, 0x0f, 0xe6, 0x4e, 0xed, 0xbe, 0xe7, 0x1b, 0x71, 0x26, 0x44, 0x65, 0xcc,
-	0x72, 0xf1, 0xd3, 0x30, 0x1d, 0x5b, 0x50, 0xf3, 0x48, 0xcb, 0x75, 0x2c, 0x23, 0x9d, 0xb2, 0x9b,
-	0x42, 0x1e, 0x5a, 0xe2, 0x5f, 0x60, 0x35, 0x97, 0xc6, 0x75, 0x15, 0xcb, 0x05, 0xbc, 0x41, 0xfd,
-	0x8b, 0x3b, 0xf6, 0x5f, 0x6a, 0x44, 0x95, 0x6a, 0x24, 0xb7, 0x0c, 0xd4, 0xfc, 0x32, 0xf8, 0x19,
-	0x96, 0x33, 0x9e, 0xaf, 0x12, 0xf5, 0x2b, 0x35, 0x97, 0x63, 0xc9, 0x39, 0xbf, 0xd2, 0xaf, 0xd8,
-	0x0f, 0x54, 0xb9, 0xa1, 0x3f, 0xe7, 0x1d, 0x26, 0x05, 0x78, 0x6d, 0xe1, 0xbc, 0x07, 0x6b, 0xd4,
-	0x7b, 0x98, 0x5a, 0x8b, 0x19, 0xec, 0xbb, 0x03, 0xc7, 0x1f, 0x1d, 0x13, 0xf6, 0x60, 0xbd, 0x60,
-	0xdb, 0x55, 0x98, 0x87, 0x99, 0x6a, 0x31, 0xa8, 0x64, 0xe7, 0xe4, 0xd8, 0xf8, 0x7d, 0xee, 0xf4,
-	0xc8, 0xf4, 0x29, 0xb1, 0xa6, 0xdd, 0x76, 0xa8, 0x5f, 0xb7, 0xad, 0xbb, 0xee, 0x38, 0xb2, 0x7f,
-	0x88, 0xb6, 0x96, 0xbb, 0xf1, 0x2a, 0x74, 0x3f, 0x82, 0x39, 0x8f, 0xa3, 0x19, 0xcc, 0x2b, 0xbd,
-	0x14, 0x7e, 0x70, 0x6f, 0x96, 0xe3, 0xdd, 0xb2, 0xbb, 0x59, 0x2f, 0xb9, 0xc4, 0x1d, 0x5e, 0x4b,
-	0x07, 0x8e, 0xdf, 0x1f, 0x3e, 0x74, 0xac, 0xff, 0xfb, 0xdd, 0xf2, 0xb7, 0xc2, 0x2b, 0x2d, 0xe5,
-	0xee, 0x9a, 0xda, 0x05, 0xda, 0x84, 0x49, 0xc6, 0x93, 0xb3, 0x2a, 0xa8, 0x49, 0x6e, 0x80, 0x5f,
-	0xc0, 0xcc, 0x63, 0xb3, 0xc7, 0xa4, 0x68, 0x05, 0xca, 0xdf, 0x93, 0x61, 0x72, 0xc4, 0x9a, 0xa1,
-	0x6b, 0x69, 0xc2, 0xca, 0x7d, 0xe1, 0x84, 0x59, 0x3a, 0x37, 0x3b, 0x03, 0x12, 0x4e, 0x58, 0x4c,
-	0xf2, 0x15, 0x13, 0xa4, 0x06, 0xb0, 0xc9, 0xd4, 0x00, 0x86, 0x0f, 0xa0, 0xfc, 0x88, 0x0c, 0x85,
-	0x69, 0x0d, 0x54, 0xea, 0x31, 0x70, 0xce, 0x1e, 0x69, 0x1c, 0x53, 0x02, 0x56, 0xc4, 0x3c, 0x1f,
-	0x07, 0x12, 0xb0, 0xd6, 0x85, 0x1e, 0x9f, 0xc0, 0x7c, 0x08, 0x13, 0xbd, 0xb0, 0xd0, 0x2e, 0x54,
-	0x58, 0x44, 0x02, 0x41, 0x64, 0x1a, 0xc5, 0x08, 0xa1, 0xbd, 0xce, 0xc2, 0x16, 0x04, 0xd6, 0xa0,
-	0x62, 0x87, 0xbb, 0x83, 0xa6, 0x19, 0x0b, 0xf0, 0xd7, 0xb0, 0x40, 0x4f, 0x54, 0x38, 0x96, 0x87,
-	0xa8, 0xae, 0xd9, 0x4b, 0x14, 0x0f, 0x5d, 0xd1, 0xe2, 0x09, 0x82, 0x11, 0x28, 0x3c, 0x18, 0x0d,
-	0xca, 0xa9, 0x21, 0x30, 0x5a, 0xe3, 0x7f, 0x14, 0x58, 0x94, 0xc1, 0xaf, 0x52, 0x2a, 0x1f, 0x24,
-	0x03, 0x17, 0x7d, 0x69, 0x35, 0x1b, 0x78, 0x94, 0xa8, 0x44, 0x06, 0x1a, 0x50, 0x66, 0xc1, 0xf0,
-	0xeb, 0xa5, 0xe6, 0x5f, 0x2f, 0xca, 0x91, 0x5f, 0xaf, 0x99, 0xae, 0x78, 0xc0, 0x7f, 0x2a, 0xb0,
-	0xd0, 0xbc, 0x7c, 0x62, 0x76, 0xb3, 0xe4, 0x46, 0x9f, 0xca, 0x87, 0x50, 0xa5, 0x3b, 0x7b, 0xf4,
-	0x75, 0x15, 0xcd, 0xf0, 0xd5, 0x46, 0x5d, 0x2a, 0x05, 0xaa, 0x7c, 0x4c, 0x7c, 0x93, 0xe9, 0x75,
-	0x10, 0xc6, 0xbc, 0xba, 0x5e, 0xc0, 0x62, 0xf3, 0xb5, 0x65, 0x35, 0x99, 0x9b, 0xd2, 0x25, 0x73,
-	0xf3, 0x2e, 0x6f, 0x3a, 0xb2, 0x72, 0x64, 0x7a, 0xd8, 0x87, 0x4f, 0x3d, 0xbb, 0xe5, 0x9a, 0x79,
-	0x6f, 0x6f, 0xc3, 0x52, 0xee, 0x57, 0x1c, 0x9a, 0x86, 0xd2, 0xf1, 0xa3, 0xda, 0x04, 0xaa, 0xc0,
-	0xd4, 0x81, 0xae, 0x1f, 0xeb, 0x35, 0xa5, 0xf1, 0x72, 0x06, 0xaa, 0xa1, 0x31, 0x6d, 0xb6, 0xe8,
-	0x08, 0xaa, 0x89, 0x2f, 0x02, 0xb4, 0x16, 0x3b, 0xcb, 0x7e, 0x82, 0x68, 0xeb, 0x05, 0x5a, 0x11,
-	0x30, 0x9e, 0x40, 0xdf, 0xc2, 0x7c, 0x66, 0x0a, 0x45, 0x38, 0xde, 0x55, 0xf4, 0xc1, 0xa0, 0xdd,
-	0x1d, 0x69, 0x13, 0xe1, 0xf7, 0xf8, 0x09, 0xe5, 0x4d, 0xb9, 0x68, 0x6b, 0x04, 0x82, 0x34, 0x84,
-	0x69, 0xf7, 0x2f, 0x61, 0x19, 0x79, 0xb4, 0x78, 0x1f, 0x49, 0xcf, 0x92, 0xe8, 0x4d, 0x09, 0xa3,
-	0x60, 0xe2, 0xd5, 0xde, 0x1a, 0x63, 0x15, 0x79, 0xe9, 0x8a, 0x89, 0x31, 0xfb, 0x1a, 0x46, 0x9b,
-	0x12, 0x44, 0xf1, 0x1b, 0x5e, 0xdb, 0x1a, 0x6f, 0x18, 0xb9, 0xfb, 0x0e, 0x96, 0x72, 0x67, 0x14,
-	0x74, 0x4f, 0x02, 0x29, 0x9c, 0x7d, 0xb4, 0xcd, 0xb1, 0x76, 0x91, 0xaf, 0x6f, 0xa0, 0x96, 0x1e,
-	0xe2, 0xd0, 0x1d, 0x99, 0x6b, 0xce, 0xc4, 0xa8, 0xe1, 0x51, 0x26, 0x11, 0xf8, 0x33, 0x98, 0x4b,
-	0xcd, 0xbb, 0x68, 0x23, 0x77, 0x63, 0xf2, 0xfc, 0xef, 0x8c, 0xb0, 0x48, 0xd1, 0x96, 0x26, 0x82,
-	0x14, 0xed, 0xbc, 0xe1, 0x24, 0x45, 0x3b, 0x77, 0xa0, 0xc0, 0x13, 0x8d, 0xdf, 0x4b, 0xf1, 0x25,
-	0xa4, 0xb7, 0x99, 0x5e, 0xc2, 0x4a, 0xc4, 0x04, 0xad, 0x4b, 0x10, 0xe9, 0x46, 0xad, 0xdd, 0x2a,
-	0x52, 0x47, 0xd4, 0x29, 0x5a, 0x33, 0x0f, 0xad, 0x39, 0x1a, 0xad, 0x99, 0x8f, 0x26, 0x12, 0x21,
-	0x75, 0x9e, 0x54, 0x22, 0xf2, 0x1a, 0x66, 0x2a, 0x11, 0xb9, 0x0d, 0x12, 0x4f, 0xec, 0xed, 0xc2,
-	0x4a, 0xcb, 0xed, 0xee, 0x88, 0xff, 0x5a, 0x3b, 0xf2, 0xef, 0xac, 0xbd, 0x5a, 0xa2, 0xa9, 0xf1,
-	0x31, 0xe8, 0x89, 0x72, 0x32, 0xcd, 0x55, 0x0f, 0xfe, 0x0d, 0x00, 0x00, 0xff, 0xff, 0x15, 0x03,
-	0xd9, 0xfc, 0x4f, 0x13, 0x00, 0x00,
+	// 2813 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xbc, 0x1a, 0x4d, 0x6f, 0x1b, 0xc7,
+	0x35, 0x4b, 0xea, 0x8b, 0x8f, 0xfa, 0xa0, 0x46, 0x5f, 0xd4, 0xca, 0xb2, 0xe4, 0xb1, 0x6c, 0xc9,
+	0xb2, 0x2d, 0x26, 0x0c, 0xd2, 0x36, 0x45, 0xd1, 0x46, 0x92, 0x05, 0x55, 0xb5, 0x64, 0xcb, 0x2b,
+	0x39, 0x09, 0xd0, 0x0f, 0x62, 0xc5, 0x1d, 0x51, 0x5b, 0x91, 0xbb, 0xf4, 0xee, 0xd2, 0x36, 0xe3,
+	0xa4, 0xae, 0x53, 0x04, 0xc8, 0xb1, 0x40, 0x8a, 0x1e, 0x12, 0x14, 0x28, 0x8a, 0xde, 0x7a, 0xe8,
+	0xb1, 0xe8, 0x29, 0x40, 0x4f, 0xed, 0xa5, 0x97, 0xfe, 0x84, 0xf6, 0x87, 0x14, 0xf3, 0xb1, 0xcb,
+	0xfd, 0x26, 0x6d, 0xda, 0xba, 0x2d, 0xe7, 0xbd, 0x79, 0xdf, 0xef, 0xcd, 0x9b, 0x37, 0x84, 0xdb,
+	0x35, 0xdd, 0x39, 0x6b, 0x9d, 0x6c, 0x54, 0xcd, 0x46, 0xa9, 0x66, 0x9a, 0xb5, 0x3a, 0x29, 0x39,
+	0x96, 0x5e, 0xaf, 0xeb, 0xaa, 0xe1, 0x7d, 0x54, 0xd4, 0xa6, 0xbe, 0xd1, 0xb4, 0x4c, 0xc7, 0x44,
+	0x23, 0xee, 0x9a, 0x7c, 0xa3, 0x87, 0x8d, 0x7c, 0x93, 0x7c, 0x49, 0xc0, 0xd5, 0xa6, 0x5e, 0x52,
+	0x0d, 0xc3, 0x74, 0x54, 0x47, 0x37, 0x0d, 0x9b, 0x43, 0xf1, 0x13, 0x98, 0x3c, 0x16, 0xf8, 0x9b,
+	0x4d, 0xfd, 0xc8, 0x51, 0x9d, 0x96, 0x8d, 0x3e, 0x80, 0xbc, 0xcd, 0xbe, 0x2a, 0x55, 0x53, 0x23,
+	0x45, 0x69, 0x59, 0x5a, 0x1b, 0x2f, 0x2f, 0x6d, 0x78, 0x84, 0x23, 0x3b, 0xb6, 0x4d, 0x8d, 0x28,
+	0x60, 0x7b, 0xdf, 0x68, 0x19, 0xf2, 0x1a, 0xb1, 0xab, 0x96, 0xde, 0xa4, 0xcc, 0x8a, 0x99, 0x65,
+	0x69, 0x2d, 0xa7, 0xf8, 0x97, 0xf0, 0xb7, 0x12, 0xe4, 0xf6, 0x89, 0x7a, 0x7a, 0xc8, 0x34, 0x5b,
+	0x80, 0x5c, 0x9d, 0xa8, 0xa7, 0x95, 0x33, 0xd5, 0x3e, 0x63, 0xfc, 0x46, 0x95, 0x11, 0xba, 0xf0,
+	0x63, 0xd5, 0x3e, 0xf3, 0x80, 0x9a, 0xea, 0xa8, 0xc5, 0x4c, 0x07, 0x78, 0x47, 0x75, 0x54, 0xb4,
+	0x08, 0x40, 0x9e, 0x3a, 0x96, 0xca, 0xa1, 0x59, 0x06, 0xcd, 0xb1, 0x15, 0x17, 0xcc, 0xf6, 0xea,
+	0x86, 0x46, 0x9e, 0x16, 0x07, 0x96, 0xa5, 0xb5, 0xac, 0xc2, 0xa8, 0xed, 0xd1, 0x05, 0xf4, 0x7d,
+	0x98, 0xd7, 0x0d, 0x87, 0xd4, 0x2c, 0xd5, 0x21, 0x15, 0x47, 0x6f, 0x10, 0xdb, 0x51, 0x1b, 0xcd,
+	0x8a, 0xa1, 0x1a, 0xa6, 0x5d, 0x1c, 0x64, 0xd8, 0x73, 0x1e, 0xc2, 0xb1, 0x0b, 0xbf, 0x47, 0xc1,
+	0xf8, 0x14, 0x72, 0xf7, 0x4c, 0x8d, 0x70, 0x05, 0xe6, 0x60, 0xd8, 0x30, 0x35, 0x52, 0xd1, 0x35,
+	0x21, 0xfe, 0x10, 0xfd, 0xb9, 0xa7, 0x51, 0xe1, 0x19, 0x80, 0x69, 0x26, 0x84, 0xa7, 0x0b, 0x4c,
+	0xb3, 0xab, 0x30, 0xc6, 0x80, 0x16, 0x79, 0xac, 0xdb, 0xd4, 0x50, 0x59, 0xc6, 0x72, 0x94, 0x2e,
+	0x2a, 0x62, 0x0d, 0x57, 0x00, 0x0e, 0x2d, 0xd3, 0x14, 0x96, 0x0a, 0x2a, 0x24, 0x85, 0x15, 0x2a,
+	0x03, 0x34, 0x29, 0x72, 0x85, 0x92, 0x28, 0x66, 0x96, 0xb3, 0x6b, 0xf9, 0xf2, 0x54, 0xc7, 0x73,
+	0x9e, 0xc0, 0x4a, 0x8e, 0xa1, 0xd1, 0xdf, 0xf8, 0x63, 0x40, 0x0f, 0x5a, 0xa4, 0x45, 0xf6, 0x89,
+	0xfa, 0x98, 0xd8, 0x0a, 0x79, 0xd4, 0x22, 0xb6, 0x83, 0x66, 0x60, 0xa8, 0x6e, 0xd6, 0x5c, 0x85,
+	0xb2, 0xca, 0x60, 0xdd, 0xac, 0xed, 0x69, 0xe8, 0x26, 0x0c, 0xd5, 0x19, 0x5e, 0x94, 0xb8, 0xe7,
+	0x4e, 0x45, 0xa0, 0xe0, 0xbf, 0x49, 0x00, 0x8c, 0xb4, 0x46, 0x61, 0x68, 0x15, 0x06, 0xa8, 0xa4,
+	0x8c, 0x60, 0xc2, 0x4e, 0x86, 0x80, 0xde, 0x85, 0x21, 0x1e, 0x4c, 0xcc, 0x62, 0xe3, 0xe5, 0x85,
+	0x0e, 0x6a, 0x87, 0xdc, 0x06, 0x8f, 0x3d, 0x45, 0xa0, 0xe2, 0xbb, 0x30, 0x24, 0xe2, 0x77, 0x08,
+	0x32, 0xf7, 0xef, 0x16, 0xde, 0x42, 0x63, 0x90, 0xbb, 0xf3, 0xf0, 0x70, 0x7f, 0x6f, 0x7b, 0xf3,
+	0x78, 0xa7, 0x20, 0x21, 0x04, 0xe3, 0x0f, 0x1e, 0xde, 0x3f, 0xde, 0xac, 0xec, 0x7c, 0xbc, 0xbd,
+	0xb3, 0x73, 0x67, 0xe7, 0x4e, 0x21, 0x83, 0x66, 0x01, 0x79, 0x28, 0x15, 0x65, 0xe7, 0x27, 0x3b,
+	0xdb, 0xc7, 0x3b, 0x77, 0x0a, 0x59, 0xfc, 0x85, 0x04, 0x53, 0x01, 0xa3, 0xd8, 0x4d, 0xd3, 0xb0,
+	0x89, 0x4f, 0x32, 0xae, 0xc4, 0x42, 0x4a, 0x56, 0xb8, 0x92, 0xa1, 0xf7, 0x61, 0xec, 0x11, 0x13,
+	0xbb, 0x12, 0x30, 0xdd, 0x74, 0x9c, 0x56, 0xca, 0xe8, 0x23, 0xf7, 0x9b, 0x5a, 0xb0, 0x02, 0xf3,
+	0x9b, 0x9a, 0x76, 0x44, 0x7d, 0x62, 0x54, 0x89, 0xf6, 0xfa, 0x5d, 0xf4, 0x42, 0x02, 0x39, 0x8e,
+	0x43, 0x3f, 0xfa, 0x6e, 0xc0, 0xb0, 0x45, 0xec, 0x56, 0xdd, 0x49, 0xd7, 0xd4, 0x45, 0xc2, 0x0d,
+	0x28, 0xee, 0x12, 0x67, 0xcf, 0xa8, 0xd6, 0x5b, 0x34, 0xe2, 0x59, 0xb4, 0x77, 0xd1, 0x31, 0x98,
+	0x06, 0x99, 0x70, 0x1a, 0x2c, 0x40, 0xce, 0xb1, 0x08, 0xa9, 0xd8, 0xfa, 0x27, 0x44, 0x24, 0xd5,
+	0x08, 0x5d, 0x38, 0xd2, 0x3f, 0x21, 0xf8, 0x53, 0x98, 0x8f, 0x61, 0xd7, 0x8f, 0xc2, 0xeb, 0x30,
+	0xc8, 0xd2, 0x89, 0x09, 0x12, 0x50, 0xb7, 0x93, 0xb9, 0x0a, 0x47, 0xc1, 0x7f, 0x90, 0xe0, 0x72,
+	0x84, 0xfd, 0x56, 0x9b, 0xd6, 0x83, 0x2e, 0x3a, 0x07, 0x8a, 0x64, 0x26, 0x5a, 0x24, 0x13, 0x35,
+	0x46, 0xeb, 0x30, 0x69, 0x5a, 0x1a, 0xb1, 0x2a, 0x27, 0xed, 0x8a, 0x2d, 0x3c, 0xcd, 0x8a, 0xe1,
+	0x88, 0x32, 0xc1, 0x00, 0x5b, 0x6d, 0x37, 0x00, 0xf0, 0xe7, 0x12, 0x2c, 0x25, 0xca, 0xf7, 0x9a,
+	0x8c, 0x94, 0xed, 0x66, 0x24, 0x0b, 0x16, 0xa3, 0x32, 0xa8, 0x4e, 0xf5, 0xec, 0x25, 0xc3, 0x22,
+	0xfb, 0x12, 0x61, 0xf1, 0x22, 0xd6, 0x31, 0x9c, 0xe9, 0x45, 0xe9, 0xfd, 0x85, 0x04, 0xf2, 0x2e,
+	0x71, 0xb6, 0x4d, 0xc3, 0xd6, 0x6d, 0x87, 0x18, 0xd5, 0x76, 0x2f, 0xc9, 0x70, 0x1d, 0x26, 0x4e,
+	0x75, 0xcb, 0x76, 0x2a, 0x1d, 0xe5, 0x78, 0x46, 0x8c, 0xb1, 0xe5, 0x63, 0x37, 0x0c, 0xd6, 0xa0,
+	0x60, 0x93, 0xaa, 0x69, 0x68, 0x95, 0xb0, 0x15, 0xc6, 0xf9, 0xba, 0x8b, 0x89, 0x7f, 0x05, 0x0b,
+	0xb1, 0x62, 0x5c, 0x54, 0x92, 0x3c, 0x85, 0xd9, 0x5d, 0xe2, 0xf0, 0x5a, 0xf4, 0x2a, 0xb9, 0x91,
+	0x0d, 0xe4, 0x46, 0x6c, 0xf8, 0x67, 0xe3, 0xc3, 0xff, 0x19, 0xcc, 0x45, 0x38, 0xf7, 0xa3, 0xf5,
+	0x4b, 0x15, 0xe3, 0xfb, 0x01, 0xe6, 0x2c, 0x66, 0xfb, 0x0a, 0x78, 0xfc, 0x29, 0x14, 0xa3, 0x04,
+	0x2f, 0x4c, 0x9d, 0x5a, 0x40, 0x1d, 0x45, 0x35, 0x6a, 0xa4, 0x8b, 0x3a, 0x4b, 0xac, 0xf3, 0xb4,
+	0x9c, 0x40, 0x5d, 0x07, 0xb6, 0xc4, 0x33, 0x78, 0x1a, 0x06, 0xab, 0x66, 0xcb, 0x70, 0x44, 0xdc,
+	0xf2, 0x1f, 0x21, 0x35, 0x05, 0xa3, 0x0b, 0x53, 0xf3, 0x3d, 0xb8, 0xb4, 0x4b, 0x1c, 0xff, 0x09,
+	0x7a, 0xba, 0x4d, 0xc5, 0x4a, 0xd7, 0x15, 0xdb, 0xb0, 0x98, 0xb0, 0xad, 0x1f, 0xc9, 0xdd, 0x80,
+	0xe0, 0x56, 0xf2, 0x1d, 0x8c, 0x8c, 0x36, 0xfe, 0x0e, 0x63, 0xba, 0xaf, 0x3a, 0xc4, 0x76, 0x8e,
+	0xf4, 0x9a, 0x41, 0xb4, 0x7d, 0xb3, 0xa6, 0x98, 0x66, 0x37, 0x61, 0x7f, 0xcf, 0x8b, 0x63, 0xec,
+	0xc6, 0x7e, 0xc4, 0xfd, 0x11, 0x4c, 0xd8, 0x8c, 0x5a, 0x85, 0x72, 0xb5, 0x4c, 0xd3, 0x11, 0xe5,
+	0x61, 0xae, 0xb3, 0x3b, 0xc8, 0x6e, 0xcc, 0xf6, 0xff, 0xc4, 0xb7, 0x01, 0xed, 0x12, 0x56, 0xe2,
+	0xee, 0x92, 0xb6, 0xd7, 0x19, 0xcd, 0xc1, 0x30, 0x2b, 0x71, 0x9e, 0x1a, 0x43, 0xf4, 0xe7, 0x9e,
+	0x86, 0x7f, 0x00, 0x53, 0x01, 0x74, 0x21, 0xfb, 0x35, 0x18, 0x38, 0x27, 0x6d, 0x2a, 0x39, 0xf5,
+	0xf6, 0xa4, 0x5f, 0x72, 0x86, 0xa9, 0x30, 0x30, 0x7e, 0x17, 0x64, 0xcf, 0x08, 0xdb, 0x67, 0xa4,
+	0x7a, 0xde, 0x34, 0xf5, 0xae, 0x7e, 0xb6, 0x60, 0x21, 0x76, 0x53, 0x3f, 0x66, 0xbb, 0x0c, 0x50,
+	0xf5, 0x48, 0x89, 0x5e, 0xc0, 0xb7, 0x82, 0xbf, 0x91, 0xe0, 0xd2, 0xa6, 0xe6, 0x1a, 0x69, 0xdb,
+	0xa4, 0x36, 0x53, 0x9d, 0x96, 0x45, 0xba, 0xb6, 0x8e, 0x03, 0xbd, 0xf8, 0x80, 0x21, 0xa1, 0xef,
+	0x42, 0xbe, 0xda, 0xa1, 0xcc, 0x32, 0x32, 0x5f, 0x9e, 0xe9, 0xec, 0xf1, 0xb3, 0xf5, 0x63, 0xe2,
+	0x63, 0x58, 0x4c, 0x10, 0xae, 0x0f, 0x9b, 0xe0, 0x3a, 0xab, 0x36, 0x3b, 0x86, 0x63, 0xb5, 0x37,
+	0x0d, 0xed, 0x4d, 0x37, 0x91, 0x7f, 0x96, 0xa0, 0x18, 0x65, 0x77, 0x41, 0xe7, 0xa3, 0x77, 0x93,
+	0xca, 0x76, 0xb9, 0x49, 0xe1, 0x6f, 0x44, 0xde, 0xba, 0x4a, 0xb1, 0xda, 0xb8, 0xd5, 0xa6, 0x57,
+	0xd9, 0x2e, 0xc6, 0x29, 0xc3, 0x0c, 0x2f, 0xc5, 0xe1, 0x6b, 0x31, 0xb7, 0xd3, 0x14, 0x03, 0x06,
+	0xaf, 0xc4, 0x68, 0x03, 0xa6, 0x08, 0xed, 0x2e, 0x42, 0x3b, 0xb8, 0xed, 0x26, 0x89, 0xa1, 0x85,
+	0xae, 0xd0, 0xbf, 0xe3, 0xbd, 0x66, 0xbc, 0x74, 0xfd, 0xd8, 0x72, 0x09, 0xf2, 0x27, 0xa4, 0xa6,
+	0x1b, 0xc1, 0x73, 0x84, 0x2d, 0x79, 0xbe, 0xa5, 0x92, 0x72, 0xb0, 0xf0, 0x2d, 0x31, 0x34, 0x7e,
+	0x6a, 0xae, 0xc2, 0xf8, 0x9e, 0xa1, 0x3b, 0x34, 0x40, 0xd3, 0x53, 0xbb, 0x0d, 0x13, 0x1e, 0x62,
+	0x3f, 0xe2, 0xbe, 0x03, 0xc3, 0x55, 0x8b, 0xa8, 0x0e, 0xd1, 0xba, 0x65, 0x9e, 0x8b, 0x87, 0x9f,
+	0xc3, 0xf0, 0x81, 0xda, 0x64, 0xd7, 0xea, 0x79, 0x18, 0x39, 0x27, 0x6d, 0xff, 0xec, 0x64, 0xf8,
+	0x9c, 0xb4, 0x03, 0xa3, 0x93, 0xd8, 0x2b, 0x83, 0x1b, 0xfe, 0x8f, 0xd5, 0x7a, 0x8b, 0xb8, 0xa3,
+	0x13, 0xba, 0xf2, 0x21, 0x5d, 0x08, 0x4d, 0x56, 0x06, 0x42, 0x93, 0x15, 0xbc, 0x03, 0x23, 0x77,
+	0x49, 0x9b, 0xa3, 0x16, 0x20, 0x7b, 0x4e, 0xda, 0x82, 0x39, 0xfd, 0x44, 0xab, 0x30, 0xc8, 0xc9,
+	0x72, 0x7d, 0x7c, 0x15, 0x55, 0x48, 0xad, 0x70, 0x38, 0x3e, 0x81, 0x49, 0x97, 0x8c, 0xd7, 0x79,
+	0xa3, 0x12, 0xe4, 0xa8, 0x46, 0x9c, 0x02, 0xb7, 0x23, 0xea, 0x50, 0x70, 0xf1, 0x95, 0x91, 0x73,
+	0xf1, 0x85, 0x2e, 0x41, 0x4e, 0x77, 0x77, 0x8b, 0xf6, 0xaf, 0xb3, 0x80, 0xff, 0x28, 0xb1, 0xaa,
+	0xcf, 0x39, 0x07, 0xef, 0xcf, 0x0d, 0xb5, 0xe9, 0xf3, 0x6a, 0x43, 0x6d, 0xee, 0x69, 0xae, 0x36,
+	0x9c, 0x0c, 0xd3, 0x46, 0x86, 0x91, 0xd0, 0x88, 0xc6, 0xfb, 0x8d, 0xae, 0xc0, 0xa8, 0xfb, 0x5d,
+	0x71, 0xd4, 0x1a, 0x33, 0x54, 0x4e, 0xc9, 0xbb, 0x6b, 0xc7, 0x6a, 0x8d, 0xa2, 0x34, 0x74, 0xa3,
+	0x33, 0xe5, 0xe1, 0x83, 0xa5, 0x7c, 0x43, 0x37, 0xbc, 0x21, 0xcf, 0xdf, 0x25, 0x98, 0x0e, 0x8a,
+	0xd8, 0x4f, 0x3c, 0x7d, 0xcf, 0x6f, 0x3f, 0xde, 0xc1, 0x2c, 0x44, 0xed, 0xe7, 0xd9, 0xdb, 0x67,
+	0xc8, 0x32, 0x8c, 0x50, 0x93, 0xb0, 0x43, 0x20, 0x1b, 0x1f, 0x8a, 0x07, 0x6a, 0x93, 0x87, 0x62,
+	0x83, 0x7f, 0x60, 0x02, 0xa3, 0xc2, 0xa9, 0xac, 0x50, 0xc5, 0x44, 0xc3, 0x35, 0x51, 0xae, 0x12,
+	0x83, 0x81, 0x81, 0x83, 0x5e, 0xcc, 0x86, 0xbd, 0xf8, 0xad, 0xc4, 0x7a, 0x17, 0xcf, 0x44, 0x1f,
+	0xe9, 0xce, 0xd9, 0x6b, 0x28, 0xbb, 0xef, 0x89, 0x2c, 0xf0, 0xdf, 0xd1, 0x66, 0x23, 0x12, 0x72,
+	0x46, 0xb9, 0xba, 0xfb, 0xf9, 0x4a, 0x86, 0xfa, 0xaf, 0x04, 0x53, 0x47, 0xbd, 0xc7, 0x61, 0x29,
+	0xea, 0xc5, 0xf4, 0x2c, 0x78, 0x1f, 0xf2, 0x0d, 0xb5, 0xd9, 0x24, 0x56, 0x67, 0x18, 0x9a, 0x2f,
+	0x17, 0x03, 0xba, 0x34, 0x89, 0x75, 0x40, 0x1c, 0x95, 0xc2, 0x15, 0xe0, 0xc8, 0x6c, 0x4e, 0x3a,
+	0x07, 0xc3, 0x9a, 0xd5, 0xae, 0x58, 0x2d, 0x43, 0xcc, 0x05, 0x86, 0x34, 0xab, 0xad, 0xb4, 0x0c,
+	0xda, 0x70, 0xdb, 0x8e, 0x5a, 0x23, 0x2c, 0x68, 0x47, 0x14, 0xfe, 0x23, 0x90, 0x10, 0x43, 0xc1,
+	0x84, 0xc0, 0xcf, 0x61, 0xfa, 0xe8, 0xb5, 0x45, 0xb2, 0xdf, 0xcc, 0x99, 0x1e, 0xcd, 0x7c, 0xc4,
+	0x1a, 0x81, 0x20, 0x30, 0xdd, 0xd2, 0xe1, 0x04, 0xcd, 0x44, 0x13, 0xf4, 0x37, 0xfc, 0xbc, 0x0f,
+	0x51, 0xbd, 0x68, 0xd5, 0x3e, 0x84, 0x2b, 0x61, 0x21, 0xb6, 0xda, 0xae, 0x8c, 0x5d, 0x94, 0xf4,
+	0xfb, 0x2c, 0x13, 0xf2, 0x99, 0x38, 0xf1, 0x28, 0xc9, 0x54, 0x22, 0xee, 0x89, 0xc7, 0x10, 0xdf,
+	0xec, 0x89, 0xe7, 0xe9, 0xee, 0x9e, 0x78, 0xf7, 0x60, 0xfe, 0xb0, 0x75, 0x52, 0xd7, 0xed, 0x33,
+	0xc6, 0xbd, 0x6f, 0x9d, 0xe9, 0xac, 0x25, 0x8e, 0xe0, 0x45, 0xfb, 0xf4, 0x1e, 0xcc, 0x6f, 0x9e,
+	0xa8, 0x86, 0x66, 0x1a, 0xaf, 0x47, 0xaf, 0x07, 0x20, 0xc7, 0xd1, 0xeb, 0xa7, 0xb5, 0xfe, 0x5a,
+	0x82, 0x31, 0x51, 0x08, 0x1f, 0x36, 0x35, 0xd5, 0x21, 0x69, 0x3d, 0x07, 0x86, 0x31, 0xb3, 0xae,
+	0x55, 0xc2, 0x7d, 0x47, 0xde, 0xac, 0xb3, 0x3b, 0x2e, 0xc3, 0x49, 0xad, 0xf4, 0xe8, 0x16, 0x8c,
+	0x18, 0xe4, 0x09, 0xa3, 0x50, 0x1c, 0x48, 0x3a, 0x32, 0x86, 0x0d, 0xf2, 0x84, 0x7e, 0xe0, 0x03,
+	0x96, 0x98, 0x07, 0x6a, 0x93, 0x8b, 0x16, 0x6e, 0xfc, 0x5f, 0xd6, 0x7c, 0xff, 0x92, 0x60, 0x3e,
+	0x86, 0x5e, 0x3f, 0x51, 0x21, 0x2c, 0x42, 0xa3, 0x22, 0x6c, 0x11, 0x1a, 0x01, 0xae, 0xd5, 0xa8,
+	0xce, 0x1d, 0x1c, 0xde, 0x8f, 0xe5, 0x0d, 0xf2, 0xc4, 0xc3, 0x29, 0xc1, 0x50, 0x8b, 0xc9, 0x54,
+	0x1c, 0x58, 0xce, 0x06, 0x63, 0x2b, 0xe0, 0x1d, 0x45, 0xa0, 0x61, 0x13, 0xa6, 0xf7, 0x75, 0xbb,
+	0xe7, 0x03, 0x27, 0xc5, 0x2c, 0x68, 0x05, 0xc6, 0xd5, 0x53, 0x87, 0x58, 0x15, 0xcf, 0xed, 0x5c,
+	0xc0, 0x51, 0xb6, 0x7a, 0x97, 0xfb, 0x1e, 0xff, 0x45, 0x82, 0x99, 0x10, 0xc7, 0x7e, 0x0c, 0x77,
+	0x23, 0x34, 0x86, 0x89, 0x09, 0x03, 0x81, 0xf0, 0x4a, 0xe7, 0xf1, 0xcf, 0x60, 0xe6, 0x58, 0xad,
+	0xf5, 0x9e, 0x75, 0x05, 0xc8, 0xd2, 0x0e, 0x8f, 0xbf, 0x66, 0xd2, 0xcf, 0xb4, 0xc6, 0x10, 0x1f,
+	0xc0, 0x6c, 0x98, 0x7a, 0x3f, 0x39, 0x58, 0x76, 0xc3, 0x52, 0xe9, 0x74, 0x96, 0x5d, 0x1c, 0x8a,
+	0x7f, 0x08, 0xe3, 0xc1, 0x0d, 0xae, 0x0a, 0x52, 0xbc, 0x0a, 0x99, 0xc8, 0x51, 0x2e, 0xc7, 0xf1,
+	0xec, 0xc7, 0xa5, 0xb7, 0x60, 0xc0, 0x51, 0x6b, 0xae, 0x43, 0x83, 0xcd, 0x89, 0x8f, 0x8b, 0xc2,
+	0xb0, 0xf0, 0x5f, 0x25, 0x98, 0xde, 0xd4, 0xb4, 0x5e, 0x67, 0x2d, 0x2f, 0x37, 0xbf, 0x88, 0x19,
+	0x9b, 0x67, 0xe3, 0xc6, 0xe6, 0x37, 0x61, 0xb2, 0xda, 0x99, 0x84, 0x8b, 0x46, 0x71, 0x80, 0x15,
+	0xad, 0x42, 0x35, 0x34, 0x22, 0xc7, 0x87, 0x30, 0x13, 0x12, 0x58, 0x58, 0x2b, 0x34, 0x2d, 0x91,
+	0x7a, 0x9e, 0x96, 0xbc, 0xcd, 0xda, 0x99, 0x8f, 0x74, 0xc7, 0x20, 0xb6, 0x4d, 0xb4, 0x1e, 0x86,
+	0x75, 0xbb, 0x50, 0x8c, 0xee, 0x10, 0x62, 0xb8, 0x16, 0x92, 0x7a, 0xb0, 0xd0, 0xfa, 0x3a, 0xcc,
+	0xc4, 0xbe, 0xf5, 0x7b, 0x2f, 0xac, 0x39, 0x18, 0xdc, 0x51, 0x94, 0xfb, 0x4a, 0x41, 0x2a, 0xff,
+	0x73, 0x02, 0xf2, 0x2e, 0xf2, 0xbe, 0x59, 0x43, 0xfb, 0x90, 0xf7, 0x3d, 0xa0, 0xa2, 0x4b, 0xa1,
+	0x27, 0xc0, 0x40, 0x41, 0x92, 0x17, 0x13, 0xa0, 0x5c, 0x68, 0xfc, 0x16, 0x52, 0x01, 0x45, 0x5f,
+	0x29, 0xd1, 0xd5, 0xce, 0xb6, 0xc4, 0x57, 0x52, 0x79, 0x25, 0x1d, 0xc9, 0x63, 0xf1, 0xa5, 0x04,
+	0x93, 0x91, 0xf7, 0x1f, 0x84, 0x3b, 0xbb, 0x93, 0xde, 0x28, 0xe5, 0xab, 0xa9, 0x38, 0x82, 0xc1,
+	0xfa, 0xe7, 0xff, 0xf9, 0xdf, 0x57, 0x99, 0x15, 0x84, 0x4b, 0x8f, 0xdf, 0x29, 0xd5, 0xcd, 0x9a,
+	0x5d, 0x7a, 0xc6, 0x7d, 0xf7, 0x59, 0x89, 0x45, 0x94, 0x5d, 0xea, 0x1c, 0x80, 0x7f, 0x92, 0x60,
+	0x2e, 0x42, 0x89, 0xbf, 0x46, 0xa0, 0xb5, 0x14, 0x66, 0x81, 0xa7, 0x12, 0xf9, 0x46, 0x0f, 0x98,
+	0x42, 0xb8, 0x32, 0x13, 0xee, 0x16, 0x5a, 0xef, 0x2e, 0x5c, 0xe9, 0xa4, 0x7d, 0x9b, 0xd6, 0x7f,
+	0xd4, 0x80, 0xd9, 0x28, 0x59, 0xfa, 0x5c, 0x86, 0x56, 0xd3, 0x18, 0xfb, 0x5e, 0xf1, 0xe4, 0xb5,
+	0xee, 0x88, 0x9e, 0x7b, 0x7e, 0xcb, 0x2f, 0xf1, 0xe1, 0x37, 0x29, 0xb4, 0x12, 0xa0, 0x91, 0xf0,
+	0x72, 0x26, 0x5f, 0xeb, 0x82, 0x25, 0xd8, 0xdc, 0x62, 0x76, 0xb8, 0x8e, 0x56, 0x12, 0xed, 0xe0,
+	0x4b, 0x78, 0xf4, 0x95, 0x04, 0xb3, 0xde, 0x68, 0x37, 0x90, 0x3f, 0x21, 0x13, 0x24, 0xcf, 0xdb,
+	0xe5, 0xb5, 0xee, 0x88, 0x42, 0xb6, 0xeb, 0x4c, 0xb6, 0x65, 0x74, 0x39, 0x2a, 0x1b, 0x4d, 0x56,
+	0xbb, 0x54, 0x67, 0x9b, 0x91, 0x06, 0x53, 0x1e, 0xa5, 0x4e, 0x1d, 0x0a, 0xd9, 0x29, 0x61, 0x86,
+	0x2d, 0x5f, 0xeb, 0x82, 0xe5, 0xb9, 0xe3, 0x97, 0xac, 0xce, 0x45, 0x67, 0xb8, 0xe8, 0x7a, 0x20,
+	0xdd, 0x12, 0x27, 0xd0, 0xf2, 0x6a, 0x57, 0x3c, 0x8f, 0xd7, 0x39, 0xe4, 0x7d, 0x43, 0x7b, 0x7f,
+	0x29, 0x89, 0x8e, 0xfe, 0xe5, 0xc5, 0x04, 0xa8, 0xa0, 0xb6, 0xc4, 0xac, 0x38, 0x8f, 0xe6, 0x3a,
+	0x56, 0x14, 0x2f, 0x05, 0x9f, 0x95, 0xe8, 0x8c, 0x9f, 0xc6, 0xd9, 0x4c, 0xec, 0xbb, 0x8c, 0x5f,
+	0xb3, 0xb4, 0xf7, 0x1e, 0x79, 0xb5, 0x2b, 0x5e, 0x77, 0x8f, 0xf2, 0xae, 0xa6, 0xc4, 0x5e, 0x71,
+	0xd0, 0x33, 0x28, 0x84, 0x5f, 0xf1, 0xd0, 0x95, 0xa0, 0xa3, 0x62, 0x9e, 0x0c, 0x65, 0x9c, 0x86,
+	0x22, 0x44, 0x58, 0x66, 0x22, 0xc8, 0xa8, 0x98, 0x24, 0x02, 0xfa, 0x79, 0x80, 0x39, 0x9b, 0xd0,
+	0x26, 0x30, 0xf7, 0x3f, 0xf0, 0xc9, 0x38, 0x0d, 0xc5, 0xf5, 0xec, 0xdb, 0x12, 0xfa, 0xb5, 0x04,
+	0x13, 0xa1, 0x07, 0x57, 0xb4, 0x1c, 0xbb, 0xd7, 0x5f, 0xda, 0xae, 0xa4, 0x60, 0x08, 0xe2, 0x6b,
+	0x4c, 0x33, 0x8c, 0x96, 0x13, 0x8d, 0xeb, 0x16, 0xb2, 0x9f, 0x42, 0x21, 0x3c, 0xc9, 0x0f, 0x69,
+	0x18, 0xf7, 0xa8, 0x20, 0xe3, 0x34, 0x14, 0x2f, 0x76, 0x9b, 0x30, 0x97, 0x30, 0xe1, 0x0e, 0x55,
+	0xf2, 0x94, 0x11, 0xbd, 0x7c, 0xa3, 0x07, 0x4c, 0x8f, 0xe3, 0x07, 0x30, 0x2c, 0x86, 0xd2, 0xc8,
+	0xd7, 0x5e, 0x05, 0x07, 0xda, 0xf2, 0x7c, 0x0c, 0xc4, 0xa5, 0x50, 0xfe, 0x77, 0xbe, 0x73, 0x94,
+	0x1f, 0xa8, 0x4d, 0x54, 0x87, 0x9c, 0x67, 0x65, 0x14, 0xcc, 0xaf, 0xf0, 0xd5, 0x42, 0xbe, 0x9c,
+	0x04, 0x8e, 0x0b, 0xb8, 0x86, 0xda, 0xb4, 0x4b, 0xcf, 0x78, 0xe7, 0xea, 0x05, 0xdc, 0x97, 0x3c,
+	0x01, 0xa3, 0x73, 0xbe, 0x6e, 0xac, 0x57, 0xe3, 0xc1, 0x91, 0x39, 0x21, 0x5e, 0x65, 0x32, 0x5c,
+	0x41, 0x4b, 0x49, 0x32, 0x88, 0x62, 0x8f, 0xf6, 0x21, 0x77, 0x14, 0xa7, 0xf8, 0x51, 0xba, 0xe2,
+	0x71, 0xe3, 0x2f, 0xfc, 0x16, 0x3a, 0x86, 0x09, 0x8f, 0xda, 0x91, 0x63, 0x11, 0xb5, 0xd1, 0x37,
+	0xcd, 0x35, 0x09, 0xbd, 0x90, 0x58, 0xf8, 0x06, 0xae, 0x38, 0xa1, 0xf0, 0x8d, 0x1b, 0x85, 0xc9,
+	0x38, 0x0d, 0x25, 0xae, 0x40, 0x05, 0x0d, 0x15, 0x38, 0x72, 0xbe, 0xe6, 0x7f, 0x5b, 0x49, 0x98,
+	0x4b, 0xa1, 0x9b, 0xc9, 0xac, 0x22, 0xd3, 0xab, 0x9e, 0xe4, 0xba, 0xc9, 0xe4, 0xba, 0x86, 0xae,
+	0x26, 0xc9, 0x75, 0xd2, 0xbe, 0xed, 0xdd, 0x5c, 0xdf, 0xd8, 0xe9, 0xc1, 0x19, 0x07, 0x4f, 0x0f,
+	0x15, 0x50, 0x74, 0xa6, 0xe4, 0xef, 0x53, 0x13, 0x47, 0x58, 0xf2, 0x4a, 0x3a, 0x52, 0xa0, 0x15,
+	0x8e, 0xcc, 0x77, 0x02, 0xad, 0x70, 0xd2, 0x34, 0x49, 0x5e, 0x49, 0x47, 0xf2, 0x58, 0xfc, 0x02,
+	0x26, 0x23, 0x23, 0x90, 0x50, 0x27, 0x1c, 0x3b, 0x6f, 0x91, 0xaf, 0xa6, 0xe2, 0xf8, 0x32, 0x61,
+	0x2c, 0x30, 0x25, 0x40, 0xbe, 0x40, 0x8f, 0x1b, 0x58, 0xc8, 0x4b, 0x89, 0x70, 0xdf, 0x51, 0x22,
+	0x0a, 0x1f, 0xad, 0x58, 0xa1, 0xc2, 0xd7, 0x99, 0x6b, 0xca, 0xf3, 0x31, 0x10, 0x4f, 0xae, 0x87,
+	0x30, 0x1e, 0xbc, 0xb2, 0x23, 0x1f, 0xe3, 0xd8, 0x51, 0x81, 0xbc, 0x9c, 0x8c, 0xe0, 0x91, 0x7d,
+	0xce, 0xfe, 0xa3, 0x10, 0xba, 0x46, 0xa3, 0x88, 0xad, 0x62, 0x2e, 0xf6, 0xf2, 0x4a, 0x3a, 0x92,
+	0x60, 0x71, 0x99, 0x85, 0x65, 0x11, 0xcd, 0x46, 0xf3, 0x81, 0x5e, 0xa3, 0xcb, 0xff, 0x90, 0x60,
+	0xc2, 0x2d, 0xe8, 0xe2, 0x5a, 0x88, 0x14, 0x18, 0x0b, 0x5c, 0x54, 0xfd, 0x3e, 0x88, 0xbb, 0x72,
+	0xcb, 0x4b, 0x89, 0x70, 0x4f, 0x51, 0x7e, 0x92, 0x06, 0x2e, 0x9e, 0xa1, 0x52, 0x14, 0x77, 0x8d,
+	0x95, 0x71, 0x1a, 0x8a, 0x4b, 0x7c, 0xab, 0x04, 0xf3, 0x55, 0xb3, 0xb1, 0xc1, 0xff, 0xce, 0xbe,
+	0x11, 0xfc, 0x97, 0xfb, 0x56, 0xc1, 0x77, 0x4f, 0x65, 0xef, 0xdf, 0x87, 0xd2, 0xc9, 0x10, 0x03,
+	0xbd, 0xfb, 0xff, 0x01, 0x00, 0xa5, 0xa6, 0x48, 0xfb, 0x66, 0x2f, 0x00, 0x00,
 }
@@ -57,6 +57,12 @@ type LogLeaf struct {
 	Leaf
 	// SequenceNumber holds the position in the log this leaf has been assigned to.
 	SequenceNumber int64
+	// QueueTimestampNanos is when the leaf was queued. It's only set on leaves
+	// returned by DequeueLeaves.
+	QueueTimestampNanos int64
+	// IntegrateTimestampNanos is when the leaf was sequenced, which is the
+	// timestamp of the first root that includes it. It is zero until then.
+	IntegrateTimestampNanos int64
 }
 
 // Key is a map key.
@@ -0,0 +1,157 @@
+// Package capture records the shape of the RPC traffic a server handles, so
+// that it can be replayed against a test cluster. Only the method, tree, sizes
+// and timing of each call are recorded, none of the data it carried.
+package capture
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Record describes one RPC.
+type Record struct {
+	// Method is the full gRPC method name
+	Method string `json:"method"`
+	// TreeID is the log or map the request was for, or zero if not known
+	TreeID int64 `json:"tree_id,omitempty"`
+	// Items is the number of leaves, indices, hashes or keys in the request
+	Items int `json:"items,omitempty"`
+	// TreeSize is the tree size a log proof was requested at, or the second
+	// size of a consistency proof
+	TreeSize int64 `json:"tree_size,omitempty"`
+	// RequestBytes and ResponseBytes are the encoded sizes of the messages
+	RequestBytes  int `json:"request_bytes"`
+	ResponseBytes int `json:"response_bytes,omitempty"`
+	// StartNanos is when the call started, relative to the start of the capture
+	StartNanos    int64 `json:"start_nanos"`
+	DurationNanos int64 `json:"duration_nanos"`
+	// Code is the status the call ended with
+	Code string `json:"code"`
+}
+
+// describe fills in the parts of r that come from the request.
+func describe(r *Record, req interface{}) {
+	switch req := req.(type) {
+	case *trillian.QueueLeavesRequest:
+		r.TreeID, r.Items = req.LogId, len(req.Leaves)
+	case *trillian.AddSequencedLeavesRequest:
+		r.TreeID, r.Items = req.LogId, len(req.Leaves)
+	case *trillian.GetInclusionProofRequest:
+		r.TreeID, r.TreeSize = req.LogId, req.TreeSize
+	case *trillian.GetInclusionProofBatchRequest:
+		r.TreeID, r.TreeSize, r.Items = req.LogId, req.TreeSize, len(req.LeafIndex)
+	case *trillian.GetInclusionProofByHashRequest:
+		r.TreeID, r.TreeSize = req.LogId, req.TreeSize
+	case *trillian.GetConsistencyProofRequest:
+		r.TreeID, r.TreeSize = req.LogId, req.SecondTreeSize
+	case *trillian.GetLeavesByHashRequest:
+		r.TreeID, r.Items = req.LogId, len(req.LeafHash)
+	case *trillian.GetLeavesByIndexRequest:
+		r.TreeID, r.Items = req.LogId, len(req.LeafIndex)
+	case *trillian.GetSequencedLeafCountRequest:
+		r.TreeID = req.LogId
+	case *trillian.GetLatestSignedLogRootRequest:
+		r.TreeID = req.LogId
+	case *trillian.GetLatestCheckpointRequest:
+		r.TreeID = req.LogId
+	case *trillian.AddLogRootCosignatureRequest:
+		r.TreeID = req.LogId
+	case *trillian.GetTreeKeysRequest:
+		r.TreeID = req.TreeId
+	case *trillian.GetEntryAndProofRequest:
+		r.TreeID, r.TreeSize = req.LogId, req.TreeSize
+	case *trillian.GetLeafIndexRangeByTimeRequest:
+		r.TreeID = req.LogId
+	case *trillian.InitLogRequest:
+		r.TreeID = req.LogId
+	case *trillian.GetMapLeavesRequest:
+		r.TreeID, r.Items = req.MapId, len(req.Key)
+	case *trillian.SetMapLeavesRequest:
+		r.TreeID, r.Items = req.MapId, len(req.KeyValue)
+	case *trillian.GetSignedMapRootRequest:
+		r.TreeID = req.MapId
+	case *trillian.GetSignedMapRootByRevisionRequest:
+		r.TreeID = req.MapId
+	case *trillian.InitMapRequest:
+		r.TreeID = req.MapId
+	}
+	if m, ok := req.(proto.Message); ok {
+		r.RequestBytes = proto.Size(m)
+	}
+}
+
+// Recorder writes a Record for each RPC to a stream, as a line of JSON.
+type Recorder struct {
+	timeSource util.TimeSource
+	start      time.Time
+
+	// Must hold this lock before accessing the fields below
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder creates a Recorder writing to w, with times measured from now.
+func NewRecorder(w io.Writer, timeSource util.TimeSource) *Recorder {
+	return &Recorder{timeSource: timeSource, start: timeSource.Now(), enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error writing a record, after which nothing more is
+// written.
+func (c *Recorder) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Recorder) write(r *Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = c.enc.Encode(r)
+	}
+}
+
+// UnaryInterceptor returns a UnaryServerInterceptor which records each call.
+// It should be the first interceptor, so that the time calls spend waiting in
+// the others is recorded, along with any that are rejected.
+func (c *Recorder) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := c.timeSource.Now()
+		resp, err := handler(ctx, req)
+
+		r := &Record{Method: info.FullMethod, StartNanos: start.Sub(c.start).Nanoseconds()}
+		r.DurationNanos = c.timeSource.Now().Sub(start).Nanoseconds()
+		r.Code = grpc.Code(err).String()
+		describe(r, req)
+		if m, ok := resp.(proto.Message); ok && err == nil {
+			r.ResponseBytes = proto.Size(m)
+		}
+		c.write(r)
+		return resp, err
+	}
+}
+
+// ReadRecords reads the records written by a Recorder, in the order they were
+// written.
+func ReadRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	dec := json.NewDecoder(r)
+	for {
+		var record Record
+		if err := dec.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
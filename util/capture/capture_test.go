@@ -0,0 +1,109 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestRecorderRecordsCalls(t *testing.T) {
+	base := time.Unix(1000, 0)
+	ts := &util.IncrementingFakeTimeSource{
+		BaseTime:   base,
+		Increments: []time.Duration{0, 5 * time.Millisecond, 7 * time.Millisecond, 10 * time.Millisecond, 11 * time.Millisecond},
+	}
+	var out bytes.Buffer
+	c := NewRecorder(&out, ts)
+	interceptor := c.UnaryInterceptor()
+
+	queue := &trillian.QueueLeavesRequest{LogId: 5, Leaves: []*trillian.LeafProto{{LeafData: []byte("secret1")}, {LeafData: []byte("secret2")}}}
+	queueResp := &trillian.QueueLeavesResponse{}
+	_, err := interceptor(context.Background(), queue, &grpc.UnaryServerInfo{FullMethod: "/trillian.TrillianLog/QueueLeaves"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return queueResp, nil
+	})
+	if err != nil {
+		t.Fatalf("QueueLeaves failed: %v", err)
+	}
+
+	proof := &trillian.GetInclusionProofRequest{LogId: 6, LeafIndex: 3, TreeSize: 100}
+	_, err = interceptor(context.Background(), proof, &grpc.UnaryServerInfo{FullMethod: "/trillian.TrillianLog/GetInclusionProof"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, grpc.Errorf(codes.NotFound, "no such leaf")
+	})
+	if grpc.Code(err) != codes.NotFound {
+		t.Fatalf("GetInclusionProof returned %v, want the handler's error", err)
+	}
+	if err := c.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+
+	if bytes.Contains(out.Bytes(), []byte("secret")) {
+		t.Errorf("Capture holds leaf data: %s", out.String())
+	}
+	records, err := ReadRecords(&out)
+	if err != nil {
+		t.Fatalf("ReadRecords() = %v", err)
+	}
+	want := []Record{
+		{Method: "/trillian.TrillianLog/QueueLeaves", TreeID: 5, Items: 2, RequestBytes: proto.Size(queue), ResponseBytes: proto.Size(queueResp),
+			StartNanos: int64(5 * time.Millisecond), DurationNanos: int64(2 * time.Millisecond), Code: "OK"},
+		{Method: "/trillian.TrillianLog/GetInclusionProof", TreeID: 6, TreeSize: 100, RequestBytes: proto.Size(proof),
+			StartNanos: int64(10 * time.Millisecond), DurationNanos: int64(time.Millisecond), Code: "NotFound"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("ReadRecords() = %+v, want %+v", records, want)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := trillian.NewMockTrillianLogClient(ctrl)
+
+	records := []Record{
+		{Method: "/trillian.TrillianLog/GetInclusionProof", TreeID: 1, TreeSize: 10, StartNanos: 20},
+		{Method: "/trillian.TrillianLog/QueueLeaves", TreeID: 1, Items: 3, RequestBytes: 3 * (leafOverheadBytes + 100), StartNanos: 10},
+		{Method: "/trillian.TrillianMap/GetLeaves", TreeID: 2, Items: 1, StartNanos: 30},
+		{Method: "/trillian.TrillianLog/Unknown", StartNanos: 40},
+	}
+
+	client.EXPECT().QueueLeaves(gomock.Any(), gomock.Any()).Do(func(ctx context.Context, req *trillian.QueueLeavesRequest, opts ...grpc.CallOption) {
+		if req.LogId != 7 || len(req.Leaves) != 3 {
+			t.Errorf("QueueLeaves got %d leaves for log %d, want 3 for log 7", len(req.Leaves), req.LogId)
+		}
+		for _, leaf := range req.Leaves {
+			if len(leaf.LeafData) != 100 {
+				t.Errorf("QueueLeaves got a leaf of %d bytes, want 100", len(leaf.LeafData))
+			}
+		}
+	}).Return(&trillian.QueueLeavesResponse{}, nil)
+	client.EXPECT().GetInclusionProof(gomock.Any(), gomock.Any()).Do(func(ctx context.Context, req *trillian.GetInclusionProofRequest, opts ...grpc.CallOption) {
+		if req.LogId != 7 || req.TreeSize != 10 || req.LeafIndex < 0 || req.LeafIndex >= 10 {
+			t.Errorf("GetInclusionProof got unexpected request %v", req)
+		}
+	}).Return(nil, errors.New("failed"))
+
+	p := &Replayer{Log: client, TreeIDs: map[int64]int64{1: 7}, Rand: rand.New(rand.NewSource(1))}
+	result := p.Replay(context.Background(), records, 0)
+
+	// There's no map client, so the map request is skipped with the unknown one
+	if result.Skipped != 2 {
+		t.Errorf("Skipped %d records, want 2", result.Skipped)
+	}
+	if m := result.Methods["/trillian.TrillianLog/QueueLeaves"]; m == nil || m.Calls != 1 || m.Errors != 0 {
+		t.Errorf("Got QueueLeaves result %+v, want 1 call", m)
+	}
+	if m := result.Methods["/trillian.TrillianLog/GetInclusionProof"]; m == nil || m.Calls != 1 || m.Errors != 1 {
+		t.Errorf("Got GetInclusionProof result %+v, want 1 failed call", m)
+	}
+}
@@ -0,0 +1,231 @@
+package capture
+
+import (
+	"crypto/sha256"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+)
+
+// leafOverheadBytes is roughly how much of an encoded leaf or key value isn't
+// its data, which is taken off the captured sizes when making up new leaves.
+const leafOverheadBytes = 40
+
+// MethodResult summarizes the replayed calls of one method.
+type MethodResult struct {
+	Calls  int
+	Errors int
+	// TotalNanos and MaxNanos are the total and longest durations of the calls
+	TotalNanos int64
+	MaxNanos   int64
+}
+
+// Result summarizes a replay.
+type Result struct {
+	// Skipped is the number of records of methods that can't be replayed, or
+	// for which there is no client
+	Skipped int
+	// Methods holds the results for each method that was replayed
+	Methods map[string]*MethodResult
+}
+
+// Replayer issues requests with the same shape as captured ones, made up of
+// random data. Replayed proof requests are only served if the trees replayed
+// against are at least as large as the captured ones.
+type Replayer struct {
+	// Log and Map are the servers to replay against, either may be nil if
+	// there are no requests for it
+	Log trillian.TrillianLogClient
+	Map trillian.TrillianMapClient
+	// TreeIDs maps captured tree IDs to the IDs of the trees to replay them
+	// against. Trees that aren't in it are replayed against the same ID.
+	TreeIDs map[int64]int64
+	// Rand gives the data for replayed requests
+	Rand *rand.Rand
+}
+
+// Replay issues a request for each record, at the time it was made relative to
+// the first one divided by speed, or as fast as possible if speed isn't
+// positive. It returns once every request has completed.
+func (p *Replayer) Replay(ctx context.Context, records []Record, speed float64) Result {
+	records = append([]Record{}, records...)
+	sort.Sort(byStart(records))
+
+	result := Result{Methods: make(map[string]*MethodResult)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	start := time.Now()
+	for _, r := range records {
+		call := p.request(r)
+		if call == nil {
+			result.Skipped++
+			continue
+		}
+		if speed > 0 {
+			at := time.Duration(float64(r.StartNanos-records[0].StartNanos) / speed)
+			select {
+			case <-time.After(at - time.Since(start)):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(method string) {
+			defer wg.Done()
+			callStart := time.Now()
+			err := call(ctx)
+			d := time.Since(callStart).Nanoseconds()
+
+			mu.Lock()
+			defer mu.Unlock()
+			m, ok := result.Methods[method]
+			if !ok {
+				m = &MethodResult{}
+				result.Methods[method] = m
+			}
+			m.Calls++
+			if err != nil {
+				m.Errors++
+			}
+			m.TotalNanos += d
+			if d > m.MaxNanos {
+				m.MaxNanos = d
+			}
+		}(r.Method)
+	}
+	wg.Wait()
+	return result
+}
+
+type byStart []Record
+
+func (r byStart) Len() int           { return len(r) }
+func (r byStart) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byStart) Less(i, j int) bool { return r[i].StartNanos < r[j].StartNanos }
+
+func (p *Replayer) treeID(r Record) int64 {
+	if id, ok := p.TreeIDs[r.TreeID]; ok {
+		return id
+	}
+	return r.TreeID
+}
+
+// itemBytes returns the size of the data to give each item of a request.
+func itemBytes(r Record) int {
+	if r.Items == 0 || r.RequestBytes/r.Items <= leafOverheadBytes {
+		return 1
+	}
+	return r.RequestBytes/r.Items - leafOverheadBytes
+}
+
+func (p *Replayer) randomBytes(n int) []byte {
+	b := make([]byte, n)
+	p.Rand.Read(b)
+	return b
+}
+
+func (p *Replayer) randomHash() []byte {
+	return p.randomBytes(sha256.Size)
+}
+
+// index returns a random leaf index in a tree of the recorded size, or zero if
+// the size isn't known.
+func (p *Replayer) index(r Record) int64 {
+	if r.TreeSize <= 0 {
+		return 0
+	}
+	return p.Rand.Int63n(r.TreeSize)
+}
+
+// request returns a function making a request shaped like r, or nil if it
+// can't be replayed. The request is made up when request is called, so only
+// the returned function needs to be safe to call concurrently.
+func (p *Replayer) request(r Record) func(ctx context.Context) error {
+	id := p.treeID(r)
+	if p.Log != nil {
+		switch r.Method {
+		case "/trillian.TrillianLog/QueueLeaves":
+			req := &trillian.QueueLeavesRequest{LogId: id}
+			for i := 0; i < r.Items; i++ {
+				data := p.randomBytes(itemBytes(r))
+				hash := sha256.Sum256(data)
+				req.Leaves = append(req.Leaves, &trillian.LeafProto{LeafHash: hash[:], LeafData: data})
+			}
+			return func(ctx context.Context) error { _, err := p.Log.QueueLeaves(ctx, req); return err }
+		case "/trillian.TrillianLog/GetInclusionProof":
+			req := &trillian.GetInclusionProofRequest{LogId: id, LeafIndex: p.index(r), TreeSize: r.TreeSize}
+			return func(ctx context.Context) error { _, err := p.Log.GetInclusionProof(ctx, req); return err }
+		case "/trillian.TrillianLog/GetInclusionProofBatch":
+			req := &trillian.GetInclusionProofBatchRequest{LogId: id, TreeSize: r.TreeSize}
+			for i := 0; i < r.Items; i++ {
+				req.LeafIndex = append(req.LeafIndex, p.index(r))
+			}
+			return func(ctx context.Context) error { _, err := p.Log.GetInclusionProofBatch(ctx, req); return err }
+		case "/trillian.TrillianLog/GetInclusionProofByHash":
+			req := &trillian.GetInclusionProofByHashRequest{LogId: id, LeafHash: p.randomHash(), TreeSize: r.TreeSize}
+			return func(ctx context.Context) error { _, err := p.Log.GetInclusionProofByHash(ctx, req); return err }
+		case "/trillian.TrillianLog/GetConsistencyProof":
+			req := &trillian.GetConsistencyProofRequest{LogId: id, FirstTreeSize: p.index(r) + 1, SecondTreeSize: r.TreeSize}
+			return func(ctx context.Context) error { _, err := p.Log.GetConsistencyProof(ctx, req); return err }
+		case "/trillian.TrillianLog/GetLatestSignedLogRoot":
+			req := &trillian.GetLatestSignedLogRootRequest{LogId: id}
+			return func(ctx context.Context) error { _, err := p.Log.GetLatestSignedLogRoot(ctx, req); return err }
+		case "/trillian.TrillianLog/GetLatestCheckpoint":
+			req := &trillian.GetLatestCheckpointRequest{LogId: id}
+			return func(ctx context.Context) error { _, err := p.Log.GetLatestCheckpoint(ctx, req); return err }
+		case "/trillian.TrillianLog/GetSequencedLeafCount":
+			req := &trillian.GetSequencedLeafCountRequest{LogId: id}
+			return func(ctx context.Context) error { _, err := p.Log.GetSequencedLeafCount(ctx, req); return err }
+		case "/trillian.TrillianLog/GetLeavesByIndex":
+			// The size of the tree isn't recorded, so the first leaves are read
+			req := &trillian.GetLeavesByIndexRequest{LogId: id}
+			for i := 0; i < r.Items; i++ {
+				req.LeafIndex = append(req.LeafIndex, int64(i))
+			}
+			return func(ctx context.Context) error { _, err := p.Log.GetLeavesByIndex(ctx, req); return err }
+		case "/trillian.TrillianLog/GetLeavesByHash":
+			req := &trillian.GetLeavesByHashRequest{LogId: id}
+			for i := 0; i < r.Items; i++ {
+				req.LeafHash = append(req.LeafHash, p.randomHash())
+			}
+			return func(ctx context.Context) error { _, err := p.Log.GetLeavesByHash(ctx, req); return err }
+		case "/trillian.TrillianLog/GetEntryAndProof":
+			req := &trillian.GetEntryAndProofRequest{LogId: id, LeafIndex: p.index(r), TreeSize: r.TreeSize}
+			return func(ctx context.Context) error { _, err := p.Log.GetEntryAndProof(ctx, req); return err }
+		}
+	}
+	if p.Map != nil {
+		switch r.Method {
+		case "/trillian.TrillianMap/GetLeaves":
+			req := &trillian.GetMapLeavesRequest{MapId: id, Revision: -1}
+			for i := 0; i < r.Items; i++ {
+				req.Key = append(req.Key, p.randomHash())
+			}
+			return func(ctx context.Context) error { _, err := p.Map.GetLeaves(ctx, req); return err }
+		case "/trillian.TrillianMap/GetMapLeavesWithProof":
+			req := &trillian.GetMapLeavesRequest{MapId: id, Revision: -1}
+			for i := 0; i < r.Items; i++ {
+				req.Key = append(req.Key, p.randomHash())
+			}
+			return func(ctx context.Context) error { _, err := p.Map.GetMapLeavesWithProof(ctx, req); return err }
+		case "/trillian.TrillianMap/SetLeaves":
+			req := &trillian.SetMapLeavesRequest{MapId: id}
+			for i := 0; i < r.Items; i++ {
+				value := &trillian.MapLeaf{LeafValue: p.randomBytes(itemBytes(r))}
+				req.KeyValue = append(req.KeyValue, &trillian.KeyValue{Key: p.randomHash(), Value: value})
+			}
+			return func(ctx context.Context) error { _, err := p.Map.SetLeaves(ctx, req); return err }
+		case "/trillian.TrillianMap/GetSignedMapRoot":
+			req := &trillian.GetSignedMapRootRequest{MapId: id}
+			return func(ctx context.Context) error { _, err := p.Map.GetSignedMapRoot(ctx, req); return err }
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Package election provides mastership elections, so that when several
+// instances of a server are run only one of them acts on each tree at a time.
+package election
+
+import (
+	"golang.org/x/net/context"
+)
+
+// MasterElection campaigns for mastership of a single resource, such as a log,
+// on behalf of this instance.
+type MasterElection interface {
+	// Start begins campaigning for mastership in the background. It
+	// continues until Close is called.
+	Start(ctx context.Context) error
+	// IsMaster returns whether this instance is currently master. Where it
+	// can't be sure, for example because the election backend can't be
+	// reached, false is returned.
+	IsMaster(ctx context.Context) (bool, error)
+	// WaitForMastership blocks until this instance is master or ctx is done.
+	WaitForMastership(ctx context.Context) error
+	// Resign gives up mastership, if it is held, and stops campaigning for
+	// long enough that another instance can take over. It should be called
+	// once any work done as master is complete, so that the other instances
+	// don't need to wait for mastership to expire.
+	Resign(ctx context.Context) error
+	// Close stops campaigning, and gives up mastership if it is held so that
+	// another instance can take over without waiting for it to expire.
+	Close(ctx context.Context) error
+}
+
+// Factory creates the elections for resources.
+type Factory interface {
+	// NewElection creates an election for resourceID, which has not been
+	// started.
+	NewElection(ctx context.Context, resourceID string) (MasterElection, error)
+}
+
+// NoopFactory creates elections which are always won, for use where only one
+// instance of a server is run.
+type NoopFactory struct{}
+
+// NewElection implements Factory.
+func (NoopFactory) NewElection(ctx context.Context, resourceID string) (MasterElection, error) {
+	return noopElection{}, nil
+}
+
+type noopElection struct{}
+
+func (noopElection) Start(ctx context.Context) error {
+	return nil
+}
+
+func (noopElection) IsMaster(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func (noopElection) WaitForMastership(ctx context.Context) error {
+	return nil
+}
+
+func (noopElection) Resign(ctx context.Context) error {
+	return nil
+}
+
+func (noopElection) Close(ctx context.Context) error {
+	return nil
+}
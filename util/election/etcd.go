@@ -0,0 +1,267 @@
+package election
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/util"
+	"github.com/google/trillian/util/etcd"
+	"golang.org/x/net/context"
+)
+
+// EtcdConfig configures elections held in etcd.
+type EtcdConfig struct {
+	// Client is used to access etcd.
+	Client *etcd.Client
+	// InstanceID identifies this instance, and must be unique among the
+	// instances taking part in elections.
+	InstanceID string
+	// KeyPrefix is added to the resource ID to form the key held by the
+	// master.
+	KeyPrefix string
+	// LeaseDuration is the TTL of the etcd lease the key is attached to, so
+	// how long other instances wait for the master to renew it before taking
+	// over. It's rounded down to whole seconds.
+	LeaseDuration time.Duration
+	// RetryPeriod is the time between attempts to acquire the key or renew
+	// the lease. It must be well under LeaseDuration so that several renewals
+	// can fail before mastership is lost.
+	RetryPeriod time.Duration
+	// TimeSource is used to get the current time.
+	TimeSource util.TimeSource
+}
+
+// EtcdFactory creates elections held in etcd. The master of a resource holds
+// a key, whose value is its instance ID, attached to a lease that it keeps
+// alive. If the master stops renewing the lease etcd deletes the key, and
+// another instance can create it.
+type EtcdFactory struct {
+	config EtcdConfig
+}
+
+// NewEtcdFactory creates an EtcdFactory.
+func NewEtcdFactory(config EtcdConfig) (*EtcdFactory, error) {
+	if len(config.InstanceID) == 0 {
+		return nil, errors.New("an instance ID is needed for elections")
+	}
+	if config.LeaseDuration < time.Second || config.RetryPeriod <= 0 || config.RetryPeriod*2 > config.LeaseDuration {
+		return nil, fmt.Errorf("lease duration %v must be at least 1s and more than twice the retry period %v", config.LeaseDuration, config.RetryPeriod)
+	}
+	return &EtcdFactory{config: config}, nil
+}
+
+// NewElection implements Factory.
+func (f *EtcdFactory) NewElection(ctx context.Context, resourceID string) (MasterElection, error) {
+	return &etcdElection{
+		config: f.config,
+		key:    []byte(f.config.KeyPrefix + resourceID),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+type etcdElection struct {
+	config EtcdConfig
+	key    []byte
+	// stop is closed to end campaigning, and done is closed when it has ended
+	stop chan struct{}
+	done chan struct{}
+
+	// Must hold this lock while using the lease or the key, so that attempts
+	// to acquire the key and to release it can't interleave
+	leaseMu sync.Mutex
+	// lease is the ID of this instance's etcd lease, zero if it has none
+	lease int64
+
+	// Must hold this lock before accessing the fields below
+	mu sync.Mutex
+	// resignedUntil is when this instance can campaign again after resigning
+	resignedUntil time.Time
+	// held is whether this instance held the key when last checked
+	held bool
+	// renewed is when the lease was last renewed while holding the key
+	renewed time.Time
+}
+
+// Start implements MasterElection.
+func (e *etcdElection) Start(ctx context.Context) error {
+	go e.campaign(ctx)
+	return nil
+}
+
+// campaign tries to acquire the key or renew the lease every retry period
+// until stopped.
+func (e *etcdElection) campaign(ctx context.Context) {
+	defer close(e.done)
+	for {
+		if _, err := e.tryAcquireOrRenew(ctx); err != nil {
+			glog.Warningf("Failed to acquire or renew etcd key %s: %v", e.key, err)
+		}
+		select {
+		case <-e.stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-time.After(e.config.RetryPeriod):
+		}
+	}
+}
+
+// renewDeadline is how long after last renewing the lease this instance stops
+// acting as master. It's shorter than the lease duration so that this instance
+// stops before the key expires and another can take over.
+func (e *etcdElection) renewDeadline() time.Duration {
+	return e.config.LeaseDuration - e.config.RetryPeriod
+}
+
+// tryAcquireOrRenew makes one attempt to take or keep the key, and returns
+// whether this instance holds it afterwards.
+func (e *etcdElection) tryAcquireOrRenew(ctx context.Context) (bool, error) {
+	e.leaseMu.Lock()
+	defer e.leaseMu.Unlock()
+
+	now := e.config.TimeSource.Now()
+	e.mu.Lock()
+	resigned := now.Before(e.resignedUntil)
+	e.mu.Unlock()
+	if resigned {
+		return false, nil
+	}
+
+	if e.lease != 0 {
+		ttl, err := e.config.Client.KeepAlive(ctx, e.lease)
+		if err != nil {
+			return e.checked(now, err)
+		}
+		if ttl <= 0 {
+			// The lease expired, taking the key with it if it was held
+			glog.Warningf("Lease for etcd key %s expired", e.key)
+			e.lease = 0
+		}
+	}
+	if e.lease == 0 {
+		id, err := e.config.Client.Grant(ctx, int64(e.config.LeaseDuration/time.Second))
+		if err != nil {
+			return e.checked(now, err)
+		}
+		e.lease = id
+	}
+
+	// Create the key if it doesn't exist, or else read who holds it
+	resp, err := e.config.Client.Txn(ctx, etcd.TxnRequest{
+		Compare: []etcd.Compare{{Key: e.key, Target: "CREATE", Result: "EQUAL"}},
+		Success: []etcd.RequestOp{{RequestPut: &etcd.PutRequest{Key: e.key, Value: []byte(e.config.InstanceID), Lease: e.lease}}},
+		Failure: []etcd.RequestOp{{RequestRange: &etcd.RangeRequest{Key: e.key}}},
+	})
+	if err != nil {
+		return e.checked(now, err)
+	}
+	if resp.Succeeded {
+		return e.checked(now, nil)
+	}
+	if len(resp.Responses) == 1 && resp.Responses[0].ResponseRange != nil {
+		for _, kv := range resp.Responses[0].ResponseRange.Kvs {
+			if bytes.Equal(kv.Value, []byte(e.config.InstanceID)) && kv.Lease == e.lease {
+				return e.checked(now, nil)
+			}
+		}
+	}
+	return e.checked(now, errNotHolder)
+}
+
+// checked records the outcome of an attempt at time now to hold the key.
+func (e *etcdElection) checked(now time.Time, err error) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch err {
+	case nil:
+		if !e.held {
+			glog.Infof("Acquired etcd key %s", e.key)
+		}
+		e.held, e.renewed = true, now
+		return true, nil
+	case errNotHolder:
+		e.held = false
+		return false, nil
+	default:
+		// Mastership is kept, if it was held, until the renew deadline
+		return false, err
+	}
+}
+
+// IsMaster implements MasterElection.
+func (e *etcdElection) IsMaster(ctx context.Context) (bool, error) {
+	now := e.config.TimeSource.Now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.held && now.Sub(e.renewed) < e.renewDeadline(), nil
+}
+
+// WaitForMastership implements MasterElection.
+func (e *etcdElection) WaitForMastership(ctx context.Context) error {
+	for {
+		if master, _ := e.IsMaster(ctx); master {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(e.config.RetryPeriod):
+		}
+	}
+}
+
+// Resign implements MasterElection. This instance doesn't campaign again for a
+// lease duration, during which any other instance should acquire the key
+// within one retry period.
+func (e *etcdElection) Resign(ctx context.Context) error {
+	e.leaseMu.Lock()
+	defer e.leaseMu.Unlock()
+
+	e.mu.Lock()
+	e.held = false
+	e.resignedUntil = e.config.TimeSource.Now().Add(e.config.LeaseDuration)
+	e.mu.Unlock()
+	return e.release(ctx)
+}
+
+// Close implements MasterElection.
+func (e *etcdElection) Close(ctx context.Context) error {
+	select {
+	case <-e.stop:
+		return nil
+	default:
+		close(e.stop)
+	}
+	<-e.done
+
+	e.leaseMu.Lock()
+	defer e.leaseMu.Unlock()
+
+	e.mu.Lock()
+	e.held = false
+	e.mu.Unlock()
+	return e.release(ctx)
+}
+
+// release revokes this instance's lease, if it has one, which deletes the key
+// if it's held so another instance can acquire it straight away. The caller
+// must hold leaseMu.
+func (e *etcdElection) release(ctx context.Context) error {
+	if e.lease == 0 {
+		return nil
+	}
+	if err := e.config.Client.Revoke(ctx, e.lease); err != nil {
+		return err
+	}
+	e.lease = 0
+	glog.Infof("Revoked lease for etcd key %s", e.key)
+	return nil
+}
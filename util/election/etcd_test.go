@@ -0,0 +1,323 @@
+package election
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/util"
+	"github.com/google/trillian/util/etcd"
+	"golang.org/x/net/context"
+)
+
+// fakeEtcdServer implements enough of the etcd JSON gateway for the tests.
+// Leases expire according to ts.
+type fakeEtcdServer struct {
+	ts *util.FakeTimeSource
+
+	mu        sync.Mutex
+	kvs       map[string]etcd.KeyValue
+	leases    map[int64]time.Time
+	ttls      map[int64]int64
+	lastLease int64
+	revision  int64
+}
+
+func newFakeEtcdServer(ts *util.FakeTimeSource) *fakeEtcdServer {
+	return &fakeEtcdServer{ts: ts, kvs: make(map[string]etcd.KeyValue), leases: make(map[int64]time.Time), ttls: make(map[int64]int64)}
+}
+
+// expire removes the leases that have expired, and their keys.
+func (f *fakeEtcdServer) expire() {
+	for id, expiry := range f.leases {
+		if !f.ts.Now().Before(expiry) {
+			f.revoke(id)
+		}
+	}
+}
+
+func (f *fakeEtcdServer) revoke(id int64) {
+	delete(f.leases, id)
+	for k, kv := range f.kvs {
+		if kv.Lease == id {
+			delete(f.kvs, k)
+		}
+	}
+}
+
+func (f *fakeEtcdServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expire()
+
+	var lr struct {
+		ID  int64 `json:"ID,omitempty,string"`
+		TTL int64 `json:"TTL,omitempty,string"`
+	}
+	var resp interface{}
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		json.NewDecoder(r.Body).Decode(&lr)
+		f.lastLease++
+		f.leases[f.lastLease] = f.ts.Now().Add(time.Duration(lr.TTL) * time.Second)
+		f.ttls[f.lastLease] = lr.TTL
+		lr.ID = f.lastLease
+		resp = lr
+	case "/v3/lease/keepalive":
+		json.NewDecoder(r.Body).Decode(&lr)
+		if _, ok := f.leases[lr.ID]; ok {
+			lr.TTL = f.ttls[lr.ID]
+			f.leases[lr.ID] = f.ts.Now().Add(time.Duration(lr.TTL) * time.Second)
+		}
+		resp = map[string]interface{}{"result": lr}
+	case "/v3/lease/revoke":
+		json.NewDecoder(r.Body).Decode(&lr)
+		if _, ok := f.leases[lr.ID]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		f.revoke(lr.ID)
+		resp = struct{}{}
+	case "/v3/kv/txn":
+		var req etcd.TxnRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp = f.txn(req)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// txn supports creation revision comparisons, which are all the elections use.
+func (f *fakeEtcdServer) txn(req etcd.TxnRequest) etcd.TxnResponse {
+	succeeded := true
+	for _, c := range req.Compare {
+		if c.Target != "CREATE" || c.Result != "EQUAL" {
+			panic("unsupported comparison")
+		}
+		succeeded = succeeded && f.kvs[string(c.Key)].CreateRevision == c.CreateRevision
+	}
+	ops := req.Failure
+	if succeeded {
+		ops = req.Success
+	}
+
+	resp := etcd.TxnResponse{Succeeded: succeeded}
+	for _, op := range ops {
+		switch {
+		case op.RequestPut != nil:
+			if _, ok := f.leases[op.RequestPut.Lease]; op.RequestPut.Lease != 0 && !ok {
+				panic("put with unknown lease")
+			}
+			f.revision++
+			kv := f.kvs[string(op.RequestPut.Key)]
+			if kv.CreateRevision == 0 {
+				kv.CreateRevision = f.revision
+			}
+			kv.Key, kv.Value, kv.Lease, kv.ModRevision = op.RequestPut.Key, op.RequestPut.Value, op.RequestPut.Lease, f.revision
+			f.kvs[string(kv.Key)] = kv
+			resp.Responses = append(resp.Responses, etcd.ResponseOp{})
+		case op.RequestRange != nil:
+			rr := &etcd.RangeResponse{}
+			if kv, ok := f.kvs[string(op.RequestRange.Key)]; ok {
+				rr.Kvs = append(rr.Kvs, kv)
+			}
+			resp.Responses = append(resp.Responses, etcd.ResponseOp{ResponseRange: rr})
+		}
+	}
+	return resp
+}
+
+func (f *fakeEtcdServer) holder(key string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expire()
+	return string(f.kvs[key].Value)
+}
+
+func newTestEtcdElection(t *testing.T, url, instanceID string, ts util.TimeSource) *etcdElection {
+	f, err := NewEtcdFactory(EtcdConfig{
+		Client:        &etcd.Client{Endpoints: []string{url}},
+		InstanceID:    instanceID,
+		KeyPrefix:     "log-",
+		LeaseDuration: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+		TimeSource:    ts,
+	})
+	if err != nil {
+		t.Fatalf("NewEtcdFactory failed: %v", err)
+	}
+	e, err := f.NewElection(context.Background(), "42")
+	if err != nil {
+		t.Fatalf("NewElection failed: %v", err)
+	}
+	return e.(*etcdElection)
+}
+
+func mustTryEtcd(t *testing.T, e *etcdElection, want bool) {
+	got, err := e.tryAcquireOrRenew(context.Background())
+	if err != nil {
+		t.Fatalf("%s: tryAcquireOrRenew failed: %v", e.config.InstanceID, err)
+	}
+	if got != want {
+		t.Fatalf("%s: tryAcquireOrRenew = %v, want %v", e.config.InstanceID, got, want)
+	}
+	if master, _ := e.IsMaster(context.Background()); master != want {
+		t.Fatalf("%s: IsMaster = %v, want %v", e.config.InstanceID, master, want)
+	}
+}
+
+func TestEtcdTakeoverAfterExpiry(t *testing.T) {
+	ts := &util.FakeTimeSource{FakeTime: time.Unix(1000, 0)}
+	fake := newFakeEtcdServer(ts)
+	s := httptest.NewServer(fake)
+	defer s.Close()
+
+	a := newTestEtcdElection(t, s.URL, "a", ts)
+	b := newTestEtcdElection(t, s.URL, "b", ts)
+
+	mustTryEtcd(t, a, true)
+	mustTryEtcd(t, b, false)
+	if got := fake.holder("log-42"); got != "a" {
+		t.Fatalf("key held by %q, want a", got)
+	}
+
+	// a keeps renewing so b can't take over
+	for i := 0; i < 10; i++ {
+		ts.FakeTime = ts.FakeTime.Add(2 * time.Second)
+		mustTryEtcd(t, a, true)
+		mustTryEtcd(t, b, false)
+	}
+
+	// a stops renewing, and stops acting as master before its lease expires
+	ts.FakeTime = ts.FakeTime.Add(8 * time.Second)
+	if master, _ := a.IsMaster(context.Background()); master {
+		t.Fatalf("a still master after missing its renew deadline")
+	}
+	mustTryEtcd(t, b, false)
+	ts.FakeTime = ts.FakeTime.Add(2 * time.Second)
+	mustTryEtcd(t, b, true)
+	if got := fake.holder("log-42"); got != "b" {
+		t.Fatalf("key held by %q, want b", got)
+	}
+
+	// a finds its lease has expired, and can't take the key back
+	mustTryEtcd(t, a, false)
+}
+
+func TestEtcdReleasedOnClose(t *testing.T) {
+	ts := &util.FakeTimeSource{FakeTime: time.Unix(1000, 0)}
+	fake := newFakeEtcdServer(ts)
+	s := httptest.NewServer(fake)
+	defer s.Close()
+
+	a := newTestEtcdElection(t, s.URL, "a", ts)
+	b := newTestEtcdElection(t, s.URL, "b", ts)
+
+	ctx := context.Background()
+	if err := a.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := a.WaitForMastership(waitCtx); err != nil {
+		t.Fatalf("WaitForMastership failed: %v", err)
+	}
+	if err := a.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got := fake.holder("log-42"); got != "" {
+		t.Fatalf("key held by %q after Close, want released", got)
+	}
+
+	// b can take over straight away
+	mustTryEtcd(t, b, true)
+}
+
+func TestEtcdHandedOverOnResign(t *testing.T) {
+	ts := &util.FakeTimeSource{FakeTime: time.Unix(1000, 0)}
+	fake := newFakeEtcdServer(ts)
+	s := httptest.NewServer(fake)
+	defer s.Close()
+
+	a := newTestEtcdElection(t, s.URL, "a", ts)
+	b := newTestEtcdElection(t, s.URL, "b", ts)
+
+	ctx := context.Background()
+	mustTryEtcd(t, a, true)
+	mustTryEtcd(t, b, false)
+	if err := a.Resign(ctx); err != nil {
+		t.Fatalf("Resign failed: %v", err)
+	}
+	if master, _ := a.IsMaster(ctx); master {
+		t.Fatalf("a still master after resigning")
+	}
+
+	// a doesn't take the key back, so b can take over at its next attempt
+	mustTryEtcd(t, a, false)
+	mustTryEtcd(t, b, true)
+	if got := fake.holder("log-42"); got != "b" {
+		t.Fatalf("key held by %q, want b", got)
+	}
+
+	// a campaigns again after a lease duration, and is re-elected once b
+	// stops renewing
+	ts.FakeTime = ts.FakeTime.Add(10 * time.Second)
+	mustTryEtcd(t, a, true)
+	if got := fake.holder("log-42"); got != "a" {
+		t.Fatalf("key held by %q, want a", got)
+	}
+}
+
+func TestEtcdClientTriesEachEndpoint(t *testing.T) {
+	ts := &util.FakeTimeSource{FakeTime: time.Unix(1000, 0)}
+	s := httptest.NewServer(newFakeEtcdServer(ts))
+	defer s.Close()
+	// Nothing listens on the first endpoint
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	c, err := etcd.NewClient(down.URL + ", " + s.URL + "/")
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	id, err := c.Grant(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+	if ttl, err := c.KeepAlive(context.Background(), id); err != nil || ttl != 10 {
+		t.Fatalf("KeepAlive()=%d, %v, want 10, nil", ttl, err)
+	}
+}
+
+func TestEtcdKeyValueJSON(t *testing.T) {
+	// The gateway's encoding of a key read with a lease
+	const gateway = `{"key":"bG9nLTQy","value":"YQ==","create_revision":"5","mod_revision":"7","lease":"1234"}`
+	var kv etcd.KeyValue
+	if err := json.Unmarshal([]byte(gateway), &kv); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !bytes.Equal(kv.Key, []byte("log-42")) || !bytes.Equal(kv.Value, []byte("a")) || kv.CreateRevision != 5 || kv.ModRevision != 7 || kv.Lease != 1234 {
+		t.Errorf("got %+v", kv)
+	}
+}
+
+func TestNewEtcdFactoryValidates(t *testing.T) {
+	for _, config := range []EtcdConfig{
+		{LeaseDuration: 10 * time.Second, RetryPeriod: 2 * time.Second},
+		{InstanceID: "a", LeaseDuration: 10 * time.Second, RetryPeriod: 6 * time.Second},
+		{InstanceID: "a", LeaseDuration: 10 * time.Millisecond, RetryPeriod: time.Millisecond},
+	} {
+		if _, err := NewEtcdFactory(config); err == nil {
+			t.Errorf("NewEtcdFactory(%+v) succeeded", config)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package election
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/util"
+	"github.com/google/trillian/util/kubernetes"
+	"golang.org/x/net/context"
+)
+
+// microTimeFormat is the format of the MicroTime fields of a Lease.
+const microTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// KubernetesLeaseConfig configures elections held with Kubernetes Leases.
+type KubernetesLeaseConfig struct {
+	// Client is used to access the Leases, which are held in its namespace.
+	Client *kubernetes.Client
+	// InstanceID identifies this instance, and must be unique among the
+	// instances taking part in elections. The pod name is a good choice.
+	InstanceID string
+	// LeasePrefix is added to the resource ID to form the name of its Lease.
+	LeasePrefix string
+	// LeaseDuration is how long other instances wait for the master to renew
+	// its Lease before taking over.
+	LeaseDuration time.Duration
+	// RetryPeriod is the time between attempts to acquire or renew a Lease.
+	// It must be well under LeaseDuration so that several renewals can fail
+	// before mastership is lost.
+	RetryPeriod time.Duration
+	// TimeSource is used to get the current time.
+	TimeSource util.TimeSource
+}
+
+// KubernetesLeaseFactory creates elections held using the Kubernetes
+// coordination.k8s.io/v1 Lease API, so that servers running in a cluster don't
+// need a separate coordination service. The service account used needs
+// permission to get, create and update Leases.
+type KubernetesLeaseFactory struct {
+	config KubernetesLeaseConfig
+}
+
+// NewKubernetesLeaseFactory creates a KubernetesLeaseFactory.
+func NewKubernetesLeaseFactory(config KubernetesLeaseConfig) (*KubernetesLeaseFactory, error) {
+	if len(config.InstanceID) == 0 {
+		return nil, errors.New("an instance ID is needed for elections")
+	}
+	if config.LeaseDuration < time.Second || config.RetryPeriod <= 0 || config.RetryPeriod*2 > config.LeaseDuration {
+		return nil, fmt.Errorf("lease duration %v must be at least 1s and more than twice the retry period %v", config.LeaseDuration, config.RetryPeriod)
+	}
+	return &KubernetesLeaseFactory{config: config}, nil
+}
+
+// NewElection implements Factory.
+func (f *KubernetesLeaseFactory) NewElection(ctx context.Context, resourceID string) (MasterElection, error) {
+	name := strings.ToLower(f.config.LeasePrefix + resourceID)
+	return &kubernetesLeaseElection{
+		config: f.config,
+		path:   fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", f.config.Client.Namespace),
+		name:   name,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// lease is the subset of a coordination.k8s.io/v1 Lease that is used.
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+type kubernetesLeaseElection struct {
+	config KubernetesLeaseConfig
+	// path is the API path of the Lease collection
+	path string
+	name string
+	// stop is closed to end campaigning, and done is closed when it has ended
+	stop chan struct{}
+	done chan struct{}
+
+	// Must hold this lock while reading or writing the Lease, so that attempts
+	// to renew it and to release it can't interleave
+	leaseMu sync.Mutex
+
+	// Must hold this lock before accessing the fields below
+	mu sync.Mutex
+	// resignedUntil is when this instance can campaign again after resigning
+	resignedUntil time.Time
+	// held is whether this instance held the Lease when it was last written
+	held bool
+	// renewed is when this instance last wrote the Lease
+	renewed time.Time
+	// observed is the holder and renew time of the Lease when it last changed,
+	// and observedAt is when that change was seen. Expiry is judged from when
+	// a change was seen, rather than the renew time written by another
+	// instance, so clock skew between instances doesn't matter.
+	observed   leaseSpec
+	observedAt time.Time
+}
+
+// Start implements MasterElection.
+func (e *kubernetesLeaseElection) Start(ctx context.Context) error {
+	go e.campaign(ctx)
+	return nil
+}
+
+// campaign tries to acquire or renew the Lease every retry period until stopped.
+func (e *kubernetesLeaseElection) campaign(ctx context.Context) {
+	defer close(e.done)
+	for {
+		if _, err := e.tryAcquireOrRenew(ctx); err != nil {
+			glog.Warningf("Failed to acquire or renew lease %s: %v", e.name, err)
+		}
+		select {
+		case <-e.stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-time.After(e.config.RetryPeriod):
+		}
+	}
+}
+
+// renewDeadline is how long after last renewing the Lease this instance stops
+// acting as master. It's shorter than the lease duration so that this instance
+// stops before any other can take over.
+func (e *kubernetesLeaseElection) renewDeadline() time.Duration {
+	return e.config.LeaseDuration - e.config.RetryPeriod
+}
+
+func (e *kubernetesLeaseElection) newLease(now time.Time) lease {
+	return lease{
+		APIVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata:   leaseMetadata{Name: e.name, Namespace: e.config.Client.Namespace},
+		Spec: leaseSpec{
+			HolderIdentity:       e.config.InstanceID,
+			LeaseDurationSeconds: int(e.config.LeaseDuration / time.Second),
+			AcquireTime:          now.UTC().Format(microTimeFormat),
+			RenewTime:            now.UTC().Format(microTimeFormat),
+		},
+	}
+}
+
+// tryAcquireOrRenew makes one attempt to take or keep the Lease, and returns
+// whether this instance holds it afterwards.
+func (e *kubernetesLeaseElection) tryAcquireOrRenew(ctx context.Context) (bool, error) {
+	e.leaseMu.Lock()
+	defer e.leaseMu.Unlock()
+
+	now := e.config.TimeSource.Now()
+	e.mu.Lock()
+	resigned := now.Before(e.resignedUntil)
+	e.mu.Unlock()
+	if resigned {
+		return false, nil
+	}
+
+	var l lease
+	err := e.config.Client.Do(ctx, "GET", e.path+"/"+e.name, nil, &l)
+	if kubernetes.IsStatus(err, http.StatusNotFound) {
+		l = e.newLease(now)
+		err := e.config.Client.Do(ctx, "POST", e.path, &l, &l)
+		if kubernetes.IsStatus(err, http.StatusConflict) {
+			// Another instance created it first
+			return false, nil
+		}
+		return e.written(now, err)
+	}
+	if err != nil {
+		return e.written(now, err)
+	}
+
+	e.mu.Lock()
+	if l.Spec.HolderIdentity != e.observed.HolderIdentity || l.Spec.RenewTime != e.observed.RenewTime {
+		e.observed, e.observedAt = l.Spec, now
+	}
+	observedAt := e.observedAt
+	e.mu.Unlock()
+
+	holder := l.Spec.HolderIdentity
+	if holder != e.config.InstanceID {
+		expiry := observedAt.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second)
+		if len(holder) > 0 && now.Before(expiry) {
+			return e.written(now, errNotHolder)
+		}
+		l.Spec.AcquireTime = now.UTC().Format(microTimeFormat)
+		l.Spec.LeaseTransitions++
+		glog.Infof("Taking over lease %s from %q", e.name, holder)
+	}
+	l.Spec.HolderIdentity = e.config.InstanceID
+	l.Spec.LeaseDurationSeconds = int(e.config.LeaseDuration / time.Second)
+	l.Spec.RenewTime = now.UTC().Format(microTimeFormat)
+
+	// The update fails if the Lease has changed since it was read, as it
+	// includes the resource version
+	err = e.config.Client.Do(ctx, "PUT", e.path+"/"+e.name, &l, &l)
+	if kubernetes.IsStatus(err, http.StatusConflict) {
+		return e.written(now, errNotHolder)
+	}
+	return e.written(now, err)
+}
+
+// errNotHolder is used internally when another instance holds the Lease.
+var errNotHolder = errors.New("lease held by another instance")
+
+// written records the outcome of an attempt at time now to write the Lease.
+func (e *kubernetesLeaseElection) written(now time.Time, err error) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch err {
+	case nil:
+		if !e.held {
+			glog.Infof("Acquired lease %s", e.name)
+		}
+		e.held, e.renewed = true, now
+		return true, nil
+	case errNotHolder:
+		e.held = false
+		return false, nil
+	default:
+		// Mastership is kept, if it was held, until the renew deadline
+		return false, err
+	}
+}
+
+// IsMaster implements MasterElection.
+func (e *kubernetesLeaseElection) IsMaster(ctx context.Context) (bool, error) {
+	now := e.config.TimeSource.Now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.held && now.Sub(e.renewed) < e.renewDeadline(), nil
+}
+
+// WaitForMastership implements MasterElection.
+func (e *kubernetesLeaseElection) WaitForMastership(ctx context.Context) error {
+	for {
+		if master, _ := e.IsMaster(ctx); master {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(e.config.RetryPeriod):
+		}
+	}
+}
+
+// Resign implements MasterElection. This instance doesn't campaign again for a
+// lease duration, during which any other instance should acquire the Lease
+// within one retry period.
+func (e *kubernetesLeaseElection) Resign(ctx context.Context) error {
+	e.leaseMu.Lock()
+	defer e.leaseMu.Unlock()
+
+	e.mu.Lock()
+	held := e.held
+	e.held = false
+	e.resignedUntil = e.config.TimeSource.Now().Add(e.config.LeaseDuration)
+	e.mu.Unlock()
+	if !held {
+		return nil
+	}
+	return e.release(ctx)
+}
+
+// Close implements MasterElection.
+func (e *kubernetesLeaseElection) Close(ctx context.Context) error {
+	select {
+	case <-e.stop:
+		return nil
+	default:
+		close(e.stop)
+	}
+	<-e.done
+
+	e.leaseMu.Lock()
+	defer e.leaseMu.Unlock()
+
+	e.mu.Lock()
+	held := e.held
+	e.held = false
+	e.mu.Unlock()
+	if !held {
+		return nil
+	}
+	return e.release(ctx)
+}
+
+// release clears the holder of the Lease, if it's still this instance, so
+// another instance can acquire it straight away. The caller must hold leaseMu.
+func (e *kubernetesLeaseElection) release(ctx context.Context) error {
+	var l lease
+	if err := e.config.Client.Do(ctx, "GET", e.path+"/"+e.name, nil, &l); err != nil {
+		return err
+	}
+	if l.Spec.HolderIdentity != e.config.InstanceID {
+		return nil
+	}
+	l.Spec.HolderIdentity = ""
+	l.Spec.RenewTime = e.config.TimeSource.Now().UTC().Format(microTimeFormat)
+	if err := e.config.Client.Do(ctx, "PUT", e.path+"/"+e.name, &l, nil); err != nil {
+		return err
+	}
+	glog.Infof("Released lease %s", e.name)
+	return nil
+}
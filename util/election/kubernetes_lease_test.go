@@ -0,0 +1,205 @@
+package election
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/util"
+	"github.com/google/trillian/util/kubernetes"
+	"golang.org/x/net/context"
+)
+
+const leasePath = "/apis/coordination.k8s.io/v1/namespaces/trillian/leases"
+
+// fakeLeaseServer implements enough of the Lease API for the tests, including
+// rejecting updates with a stale resource version.
+type fakeLeaseServer struct {
+	mu      sync.Mutex
+	leases  map[string]lease
+	version int
+}
+
+func (f *fakeLeaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, leasePath), "/")
+	var l lease
+	switch r.Method {
+	case "GET":
+		var ok bool
+		if l, ok = f.leases[name]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+	case "POST", "PUT":
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		old, exists := f.leases[l.Metadata.Name]
+		if r.Method == "POST" && exists || r.Method == "PUT" && (!exists || old.Metadata.ResourceVersion != l.Metadata.ResourceVersion) {
+			http.Error(w, "conflict", http.StatusConflict)
+			return
+		}
+		f.version++
+		l.Metadata.ResourceVersion = strconv.Itoa(f.version)
+		f.leases[l.Metadata.Name] = l
+	}
+	json.NewEncoder(w).Encode(l)
+}
+
+func (f *fakeLeaseServer) holder(name string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.leases[name].Spec.HolderIdentity
+}
+
+func newTestElection(t *testing.T, url, instanceID string, ts util.TimeSource) *kubernetesLeaseElection {
+	f, err := NewKubernetesLeaseFactory(KubernetesLeaseConfig{
+		Client:        &kubernetes.Client{APIServer: url, Namespace: "trillian"},
+		InstanceID:    instanceID,
+		LeasePrefix:   "log-",
+		LeaseDuration: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+		TimeSource:    ts,
+	})
+	if err != nil {
+		t.Fatalf("NewKubernetesLeaseFactory failed: %v", err)
+	}
+	e, err := f.NewElection(context.Background(), "42")
+	if err != nil {
+		t.Fatalf("NewElection failed: %v", err)
+	}
+	return e.(*kubernetesLeaseElection)
+}
+
+func mustTry(t *testing.T, e *kubernetesLeaseElection, want bool) {
+	got, err := e.tryAcquireOrRenew(context.Background())
+	if err != nil {
+		t.Fatalf("%s: tryAcquireOrRenew failed: %v", e.config.InstanceID, err)
+	}
+	if got != want {
+		t.Fatalf("%s: tryAcquireOrRenew = %v, want %v", e.config.InstanceID, got, want)
+	}
+	if master, _ := e.IsMaster(context.Background()); master != want {
+		t.Fatalf("%s: IsMaster = %v, want %v", e.config.InstanceID, master, want)
+	}
+}
+
+func TestLeaseTakeoverAfterExpiry(t *testing.T) {
+	fake := &fakeLeaseServer{leases: make(map[string]lease)}
+	s := httptest.NewServer(fake)
+	defer s.Close()
+
+	ts := &util.FakeTimeSource{FakeTime: time.Unix(1000, 0)}
+	a := newTestElection(t, s.URL, "a", ts)
+	b := newTestElection(t, s.URL, "b", ts)
+
+	mustTry(t, a, true)
+	mustTry(t, b, false)
+	if got := fake.holder("log-42"); got != "a" {
+		t.Fatalf("Lease held by %q, want a", got)
+	}
+
+	// a keeps renewing so b can't take over
+	for i := 0; i < 10; i++ {
+		ts.FakeTime = ts.FakeTime.Add(2 * time.Second)
+		mustTry(t, a, true)
+		mustTry(t, b, false)
+	}
+
+	// a stops renewing, and stops acting as master before b can take over
+	ts.FakeTime = ts.FakeTime.Add(8 * time.Second)
+	if master, _ := a.IsMaster(context.Background()); master {
+		t.Fatalf("a still master after missing its renew deadline")
+	}
+	mustTry(t, b, false)
+	ts.FakeTime = ts.FakeTime.Add(10 * time.Second)
+	mustTry(t, b, true)
+	mustTry(t, a, false)
+	if got := fake.holder("log-42"); got != "b" {
+		t.Fatalf("Lease held by %q, want b", got)
+	}
+}
+
+func TestLeaseReleasedOnClose(t *testing.T) {
+	fake := &fakeLeaseServer{leases: make(map[string]lease)}
+	s := httptest.NewServer(fake)
+	defer s.Close()
+
+	ts := &util.FakeTimeSource{FakeTime: time.Unix(1000, 0)}
+	a := newTestElection(t, s.URL, "a", ts)
+	b := newTestElection(t, s.URL, "b", ts)
+
+	ctx := context.Background()
+	if err := a.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := a.WaitForMastership(waitCtx); err != nil {
+		t.Fatalf("WaitForMastership failed: %v", err)
+	}
+	if err := a.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got := fake.holder("log-42"); got != "" {
+		t.Fatalf("Lease held by %q after Close, want released", got)
+	}
+
+	// b can take over straight away
+	mustTry(t, b, true)
+}
+
+func TestLeaseHandedOverOnResign(t *testing.T) {
+	fake := &fakeLeaseServer{leases: make(map[string]lease)}
+	s := httptest.NewServer(fake)
+	defer s.Close()
+
+	ts := &util.FakeTimeSource{FakeTime: time.Unix(1000, 0)}
+	a := newTestElection(t, s.URL, "a", ts)
+	b := newTestElection(t, s.URL, "b", ts)
+
+	ctx := context.Background()
+	mustTry(t, a, true)
+	mustTry(t, b, false)
+	if err := a.Resign(ctx); err != nil {
+		t.Fatalf("Resign failed: %v", err)
+	}
+	if master, _ := a.IsMaster(ctx); master {
+		t.Fatalf("a still master after resigning")
+	}
+
+	// a doesn't take the Lease back, so b can take over at its next attempt
+	mustTry(t, a, false)
+	mustTry(t, b, true)
+	if got := fake.holder("log-42"); got != "b" {
+		t.Fatalf("Lease held by %q, want b", got)
+	}
+
+	// a campaigns again after a lease duration, and takes over if b stops
+	// renewing
+	ts.FakeTime = ts.FakeTime.Add(10 * time.Second)
+	mustTry(t, a, false)
+	ts.FakeTime = ts.FakeTime.Add(10 * time.Second)
+	mustTry(t, a, true)
+}
+
+func TestNewKubernetesLeaseFactoryValidates(t *testing.T) {
+	for _, config := range []KubernetesLeaseConfig{
+		{LeaseDuration: 10 * time.Second, RetryPeriod: 2 * time.Second},
+		{InstanceID: "a", LeaseDuration: 10 * time.Second, RetryPeriod: 6 * time.Second},
+		{InstanceID: "a", LeaseDuration: 10 * time.Millisecond, RetryPeriod: time.Millisecond},
+	} {
+		if _, err := NewKubernetesLeaseFactory(config); err == nil {
+			t.Errorf("NewKubernetesLeaseFactory(%+v) succeeded", config)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package etcd is a minimal client for the parts of the etcd v3 API used by
+// Trillian. It talks to the JSON gateway which etcd serves alongside its gRPC
+// API, so Trillian doesn't depend on the full etcd client libraries.
+package etcd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// StatusError is returned when etcd responds with an error status.
+type StatusError struct {
+	Path string
+	// Code is the HTTP status code, e.g. http.StatusNotFound.
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned %s", e.Path, e.Status)
+}
+
+// Client makes requests to an etcd cluster.
+type Client struct {
+	// Endpoints are the base URLs of the cluster members, e.g.
+	// http://etcd-0:2379. Each is tried in turn until one can be reached.
+	Endpoints []string
+	// HTTPClient is used to make requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// NewClient creates a Client for the comma separated list of endpoints.
+func NewClient(endpoints string) (*Client, error) {
+	var urls []string
+	for _, e := range strings.Split(endpoints, ",") {
+		if e = strings.TrimSpace(e); len(e) > 0 {
+			urls = append(urls, strings.TrimSuffix(e, "/"))
+		}
+	}
+	if len(urls) == 0 {
+		return nil, errors.New("no etcd endpoints given")
+	}
+	return &Client{Endpoints: urls}, nil
+}
+
+// Do posts in as JSON to path, such as /v3/kv/range, and decodes the JSON
+// response into out if it's not nil. The endpoints are tried in turn until one
+// responds, a *StatusError is returned if it's not successful.
+func (c *Client) Do(ctx context.Context, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	for _, endpoint := range c.Endpoints {
+		var resp *http.Response
+		resp, err = ctxhttp.Post(ctx, client, endpoint+path, "application/json", bytes.NewReader(body))
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			// Try the next member
+			continue
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return &StatusError{Path: path, Code: resp.StatusCode, Status: resp.Status}
+		}
+		if out == nil {
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return err
+}
+
+// The JSON gateway encodes int64 fields as strings and bytes fields as base64,
+// which the ",string" options and []byte fields below match.
+
+// KeyValue is a key and its value.
+type KeyValue struct {
+	Key            []byte `json:"key"`
+	Value          []byte `json:"value"`
+	CreateRevision int64  `json:"create_revision,string"`
+	ModRevision    int64  `json:"mod_revision,string"`
+	Lease          int64  `json:"lease,omitempty,string"`
+}
+
+// Compare is a condition of a transaction. Target is CREATE to compare the
+// revision at which the key was created, which is zero if it doesn't exist,
+// or VALUE to compare its value. Result is EQUAL, NOT_EQUAL, GREATER or LESS.
+type Compare struct {
+	Key            []byte `json:"key"`
+	Target         string `json:"target"`
+	Result         string `json:"result"`
+	CreateRevision int64  `json:"create_revision,omitempty,string"`
+	Value          []byte `json:"value,omitempty"`
+}
+
+// RangeRequest reads a key.
+type RangeRequest struct {
+	Key []byte `json:"key"`
+}
+
+// RangeResponse holds the keys read by a RangeRequest.
+type RangeResponse struct {
+	Kvs []KeyValue `json:"kvs"`
+}
+
+// PutRequest sets the value of a key, which is deleted when Lease expires if
+// it's set.
+type PutRequest struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	Lease int64  `json:"lease,omitempty,string"`
+}
+
+// DeleteRangeRequest deletes a key.
+type DeleteRangeRequest struct {
+	Key []byte `json:"key"`
+}
+
+// RequestOp is one operation of a transaction, only one field is set.
+type RequestOp struct {
+	RequestRange       *RangeRequest       `json:"request_range,omitempty"`
+	RequestPut         *PutRequest         `json:"request_put,omitempty"`
+	RequestDeleteRange *DeleteRangeRequest `json:"request_delete_range,omitempty"`
+}
+
+// ResponseOp is the result of a RequestOp. Only range results are decoded.
+type ResponseOp struct {
+	ResponseRange *RangeResponse `json:"response_range,omitempty"`
+}
+
+// TxnRequest is a transaction which performs Success if every Compare holds,
+// or else Failure.
+type TxnRequest struct {
+	Compare []Compare   `json:"compare,omitempty"`
+	Success []RequestOp `json:"success,omitempty"`
+	Failure []RequestOp `json:"failure,omitempty"`
+}
+
+// TxnResponse is the result of a TxnRequest, with a ResponseOp for each of the
+// operations performed.
+type TxnResponse struct {
+	Succeeded bool         `json:"succeeded"`
+	Responses []ResponseOp `json:"responses"`
+}
+
+// Txn performs a transaction.
+func (c *Client) Txn(ctx context.Context, req TxnRequest) (TxnResponse, error) {
+	var resp TxnResponse
+	err := c.Do(ctx, "/v3/kv/txn", req, &resp)
+	return resp, err
+}
+
+// leaseRequest is the body of the lease requests.
+type leaseRequest struct {
+	ID  int64 `json:"ID,omitempty,string"`
+	TTL int64 `json:"TTL,omitempty,string"`
+}
+
+// leaseResponse is the response to the lease requests.
+type leaseResponse struct {
+	ID  int64 `json:"ID,string"`
+	TTL int64 `json:"TTL,string"`
+}
+
+// Grant creates a lease which expires after ttl seconds unless kept alive,
+// and returns its ID.
+func (c *Client) Grant(ctx context.Context, ttl int64) (int64, error) {
+	var resp leaseResponse
+	if err := c.Do(ctx, "/v3/lease/grant", leaseRequest{TTL: ttl}, &resp); err != nil {
+		return 0, err
+	}
+	if resp.ID == 0 {
+		return 0, errors.New("etcd granted no lease")
+	}
+	return resp.ID, nil
+}
+
+// KeepAlive renews a lease, and returns its new TTL in seconds. A TTL of zero
+// means the lease has already expired, and the keys attached to it deleted.
+func (c *Client) KeepAlive(ctx context.Context, id int64) (int64, error) {
+	// Keep alive is a streaming call, whose responses the gateway wraps
+	var resp struct {
+		Result leaseResponse `json:"result"`
+	}
+	if err := c.Do(ctx, "/v3/lease/keepalive", leaseRequest{ID: id}, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Result.TTL, nil
+}
+
+// Revoke ends a lease, deleting the keys attached to it.
+func (c *Client) Revoke(ctx context.Context, id int64) error {
+	return c.Do(ctx, "/v3/lease/revoke", leaseRequest{ID: id}, nil)
+}
@@ -0,0 +1,41 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+func TestChainUnaryInterceptors(t *testing.T) {
+	var calls []string
+	record := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			calls = append(calls, name+" before")
+			resp, err := handler(ctx, req)
+			calls = append(calls, name+" after")
+			return resp, err
+		}
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls = append(calls, "handler")
+		return req, nil
+	}
+
+	chain := ChainUnaryInterceptors(record("first"), record("second"))
+	resp, err := chain(context.Background(), "request", &grpc.UnaryServerInfo{}, handler)
+	if err != nil || resp != "request" {
+		t.Fatalf("Chain returned %v, %v", resp, err)
+	}
+	want := []string{"first before", "second before", "handler", "second after", "first after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("Calls were %v, want %v", calls, want)
+	}
+
+	// An empty chain calls the handler directly
+	calls = nil
+	if _, err := ChainUnaryInterceptors()(context.Background(), "request", &grpc.UnaryServerInfo{}, handler); err != nil || len(calls) != 1 {
+		t.Fatalf("Empty chain made calls %v, err %v", calls, err)
+	}
+}
@@ -0,0 +1,130 @@
+// Package kubernetes is a minimal client for the parts of the Kubernetes API
+// used by Trillian, so it can run in a cluster without depending on the full
+// Kubernetes client libraries.
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Files mounted into every pod for access to the API server.
+const (
+	tokenFile     = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	caCertFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// StatusError is returned when the API server responds with an error status.
+type StatusError struct {
+	Path string
+	// Code is the HTTP status code, e.g. http.StatusConflict.
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned %s", e.Path, e.Status)
+}
+
+// IsStatus returns whether err is a StatusError with the given code.
+func IsStatus(err error, code int) bool {
+	se, ok := err.(*StatusError)
+	return ok && se.Code == code
+}
+
+// Client makes requests to the Kubernetes API server.
+type Client struct {
+	// APIServer is the base URL of the API server.
+	APIServer string
+	// Token is the bearer token sent with requests, if set.
+	Token string
+	// Namespace is the namespace to use when none is given.
+	Namespace string
+	// HTTPClient is used to make requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// NewInClusterClient creates a Client for use by a pod, with the credentials and
+// namespace of the pod's service account.
+func NewInClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if len(host) == 0 || len(port) == 0 {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster")
+	}
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	namespace, err := ioutil.ReadFile(namespaceFile)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := ioutil.ReadFile(caCertFile)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no certificates found in %s", caCertFile)
+	}
+
+	return &Client{
+		APIServer:  "https://" + net.JoinHostPort(host, port),
+		Token:      strings.TrimSpace(string(token)),
+		Namespace:  strings.TrimSpace(string(namespace)),
+		HTTPClient: &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}},
+	}, nil
+}
+
+// Do makes a request to path on the API server. If in is not nil it's sent as
+// the JSON request body, and if out is not nil the JSON response is decoded
+// into it. A *StatusError is returned if the request is not successful.
+func (c *Client) Do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.APIServer+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(c.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := ctxhttp.Do(ctx, client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{Path: path, Code: resp.StatusCode, Status: resp.Status}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
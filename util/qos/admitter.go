@@ -0,0 +1,272 @@
+// Package qos provides traffic classes, so that interactive requests such as
+// proof lookups aren't starved by bulk writes and sequencing when a server or
+// its storage is busy.
+package qos
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/trillian/monitoring"
+	"golang.org/x/net/context"
+)
+
+// Class is the traffic class of a request or of work done in the background.
+type Class int
+
+const (
+	// Interactive is for reads where a client is waiting, such as proofs and
+	// leaf lookups.
+	Interactive Class = iota
+	// Bulk is for writes of leaves, which usually come in large volumes.
+	Bulk
+	// Background is for work done by the server itself, such as sequencing.
+	Background
+)
+
+var classNames = map[Class]string{
+	Interactive: "interactive",
+	Bulk:        "bulk",
+	Background:  "background",
+}
+
+func (c Class) String() string {
+	if name, ok := classNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Class(%d)", int(c))
+}
+
+// ParseClass returns the class with the given name.
+func ParseClass(name string) (Class, error) {
+	for c, n := range classNames {
+		if n == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown traffic class: %s", name)
+}
+
+// DefaultWeights admits interactive requests ahead of bulk writes, which are in
+// turn admitted ahead of background work, without starving either of them.
+var DefaultWeights = map[Class]int{
+	Interactive: 8,
+	Bulk:        2,
+	Background:  1,
+}
+
+// ParseWeights parses a comma separated list of class=weight pairs, as might be
+// supplied by a command line flag. Classes that aren't listed keep their
+// weight from DefaultWeights.
+func ParseWeights(weights string) (map[Class]int, error) {
+	result := make(map[Class]int)
+	for c, w := range DefaultWeights {
+		result[c] = w
+	}
+
+	if len(strings.TrimSpace(weights)) == 0 {
+		return result, nil
+	}
+
+	for _, pair := range strings.Split(weights, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("weight not in class=weight form: %s", pair)
+		}
+		c, err := ParseClass(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, err
+		}
+		w, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("invalid weight for class %v: %s", c, parts[1])
+		}
+		result[c] = w
+	}
+
+	return result, nil
+}
+
+// strideScale is divided by a class's weight to give the distance it moves on
+// for each request admitted. It's a multiple of every likely weight so strides
+// are exact.
+const strideScale = 720720
+
+// waiter is a request waiting for a slot.
+type waiter struct {
+	ready    chan struct{}
+	admitted bool
+}
+
+// Admitter limits the number of requests in progress at once. When there are
+// more requests than slots, the classes with requests waiting take turns in
+// proportion to their weights, using stride scheduling, so a class with twice
+// the weight of another is admitted twice as often. Requests within a class are
+// admitted in the order they arrived.
+type Admitter struct {
+	weights map[Class]int
+
+	// Must hold this lock before accessing the fields below
+	mu   sync.Mutex
+	free int
+	// waiting holds the requests waiting in each class, oldest first
+	waiting map[Class][]*waiter
+	// pass is how far each class has moved on, the class with the lowest pass
+	// is admitted next
+	pass map[Class]int64
+	// now is the pass of the class that was admitted last
+	now int64
+
+	// waitingGauge records the number of requests waiting in each class if set,
+	// labelled with name
+	waitingGauge monitoring.Gauge
+	name         string
+}
+
+// AdmitterMetrics records the requests waiting to be admitted. The metrics are
+// created once, by NewAdmitterMetrics, and shared by every Admitter.
+type AdmitterMetrics struct {
+	waiting monitoring.Gauge
+}
+
+// NewAdmitterMetrics creates the admitter metrics in mf.
+func NewAdmitterMetrics(mf monitoring.MetricFactory) *AdmitterMetrics {
+	return &AdmitterMetrics{
+		waiting: mf.NewGauge("qos_waiting_requests", "Number of requests waiting to be admitted by admitter and class", "admitter", "class"),
+	}
+}
+
+// NewAdmitter creates an Admitter allowing slots requests in progress at once,
+// admitting waiting requests from each class in proportion to weights.
+func NewAdmitter(slots int, weights map[Class]int) (*Admitter, error) {
+	if slots < 1 {
+		return nil, fmt.Errorf("an admitter needs at least one slot, got %d", slots)
+	}
+	for c, w := range weights {
+		if w <= 0 {
+			return nil, fmt.Errorf("weight for class %v must be positive, got %d", c, w)
+		}
+	}
+	return &Admitter{
+		weights: weights,
+		free:    slots,
+		waiting: make(map[Class][]*waiter),
+		pass:    make(map[Class]int64),
+	}, nil
+}
+
+// SetMetrics records the number of requests waiting in m, labelled with name to
+// tell this Admitter apart from others.
+func (a *Admitter) SetMetrics(m *AdmitterMetrics, name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.waitingGauge = m.waiting
+	a.name = name
+}
+
+// Admit waits until a request of class c can go ahead, or until ctx is done.
+// If it's admitted the returned function must be called once the request is
+// finished, to free its slot for another.
+func (a *Admitter) Admit(ctx context.Context, c Class) (func(), error) {
+	a.mu.Lock()
+	if a.free > 0 && a.queued() == 0 {
+		a.free--
+		a.mu.Unlock()
+		return a.releaser(), nil
+	}
+	if len(a.waiting[c]) == 0 && a.pass[c] < a.now {
+		// A class that was idle doesn't get to catch up on the turns it missed
+		a.pass[c] = a.now
+	}
+	w := &waiter{ready: make(chan struct{})}
+	a.waiting[c] = append(a.waiting[c], w)
+	a.recordWaiting(c)
+	a.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return a.releaser(), nil
+	case <-ctx.Done():
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if w.admitted {
+		// It was given a slot at the same time, which has to be passed on
+		a.release()
+		return nil, ctx.Err()
+	}
+	for i, other := range a.waiting[c] {
+		if other == w {
+			a.waiting[c] = append(a.waiting[c][:i], a.waiting[c][i+1:]...)
+			a.recordWaiting(c)
+			break
+		}
+	}
+	return nil, ctx.Err()
+}
+
+// releaser returns a function which frees a slot the first time it's called.
+func (a *Admitter) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			a.release()
+		})
+	}
+}
+
+// release hands a freed slot to the next waiting request, if there is one.
+// Must be called with mu held.
+func (a *Admitter) release() {
+	next := Class(-1)
+	for c, ws := range a.waiting {
+		if len(ws) == 0 {
+			continue
+		}
+		if next < 0 || a.pass[c] < a.pass[next] || (a.pass[c] == a.pass[next] && c < next) {
+			next = c
+		}
+	}
+	if next < 0 {
+		a.free++
+		return
+	}
+
+	w := a.waiting[next][0]
+	a.waiting[next] = a.waiting[next][1:]
+	a.recordWaiting(next)
+	a.now = a.pass[next]
+	a.pass[next] += strideScale / int64(a.weight(next))
+	w.admitted = true
+	close(w.ready)
+}
+
+// recordWaiting updates the metric for the requests waiting in c, if there is
+// one. Must be called with mu held.
+func (a *Admitter) recordWaiting(c Class) {
+	if a.waitingGauge != nil {
+		a.waitingGauge.Set(float64(len(a.waiting[c])), a.name, c.String())
+	}
+}
+
+// weight returns the weight of c, classes without one have the lowest weight.
+func (a *Admitter) weight(c Class) int {
+	if w, ok := a.weights[c]; ok {
+		return w
+	}
+	return 1
+}
+
+// queued returns the number of requests waiting. Must be called with mu held.
+func (a *Admitter) queued() int {
+	n := 0
+	for _, ws := range a.waiting {
+		n += len(ws)
+	}
+	return n
+}
@@ -0,0 +1,153 @@
+package qos
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/monitoring"
+	"golang.org/x/net/context"
+)
+
+// waitQueued waits until n requests are waiting to be admitted by a.
+func waitQueued(t *testing.T, a *Admitter, n int) {
+	for i := 0; i < 1000; i++ {
+		a.mu.Lock()
+		queued := a.queued()
+		a.mu.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d requests to queue", n)
+}
+
+func TestAdmitterWeightedOrder(t *testing.T) {
+	a, err := NewAdmitter(1, map[Class]int{Interactive: 2, Bulk: 1})
+	if err != nil {
+		t.Fatalf("NewAdmitter failed: %v", err)
+	}
+	release, err := a.Admit(context.Background(), Bulk)
+	if err != nil {
+		t.Fatalf("Admit failed: %v", err)
+	}
+
+	// Queue up bulk requests first, then interactive ones
+	admitted := make(chan Class)
+	classes := []Class{Bulk, Bulk, Bulk, Interactive, Interactive, Interactive}
+	for i, c := range classes {
+		go func(c Class) {
+			release, err := a.Admit(context.Background(), c)
+			if err != nil {
+				t.Errorf("Admit(%v) failed: %v", c, err)
+				return
+			}
+			admitted <- c
+			release()
+		}(c)
+		waitQueued(t, a, i+1)
+	}
+
+	release()
+	var got []Class
+	for range classes {
+		got = append(got, <-admitted)
+	}
+	// Interactive requests get twice the turns of bulk ones
+	want := []Class{Interactive, Bulk, Interactive, Interactive, Bulk, Bulk}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Admitted %v, want %v", got, want)
+	}
+}
+
+func TestAdmitterCancelled(t *testing.T) {
+	a, err := NewAdmitter(1, DefaultWeights)
+	if err != nil {
+		t.Fatalf("NewAdmitter failed: %v", err)
+	}
+	release, err := a.Admit(context.Background(), Interactive)
+	if err != nil {
+		t.Fatalf("Admit failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := a.Admit(ctx, Bulk); err != context.DeadlineExceeded {
+		t.Fatalf("Admit returned %v, want DeadlineExceeded", err)
+	}
+
+	// The cancelled request mustn't hold on to the slot when it's freed, and
+	// releasing twice mustn't free another
+	release()
+	release()
+	second, err := a.Admit(context.Background(), Bulk)
+	if err != nil {
+		t.Fatalf("Admit failed after release: %v", err)
+	}
+	defer second()
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := a.Admit(ctx, Interactive); err != context.DeadlineExceeded {
+		t.Fatalf("Admit returned %v with all slots in use, want DeadlineExceeded", err)
+	}
+}
+
+func TestAdmitterMetrics(t *testing.T) {
+	a, err := NewAdmitter(1, DefaultWeights)
+	if err != nil {
+		t.Fatalf("NewAdmitter failed: %v", err)
+	}
+	m := NewAdmitterMetrics(monitoring.InertMetricFactory{})
+	a.SetMetrics(m, "rpc")
+	release, err := a.Admit(context.Background(), Interactive)
+	if err != nil {
+		t.Fatalf("Admit failed: %v", err)
+	}
+
+	admitted := make(chan struct{})
+	go func() {
+		release, err := a.Admit(context.Background(), Bulk)
+		if err != nil {
+			t.Errorf("Admit failed: %v", err)
+		}
+		release()
+		close(admitted)
+	}()
+	waitQueued(t, a, 1)
+	if got := m.waiting.Value("rpc", Bulk.String()); got != 1 {
+		t.Errorf("Waiting bulk requests = %v, want 1", got)
+	}
+
+	release()
+	<-admitted
+	if got := m.waiting.Value("rpc", Bulk.String()); got != 0 {
+		t.Errorf("Waiting bulk requests after release = %v, want 0", got)
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	weights, err := ParseWeights("interactive=10, background=3")
+	if err != nil {
+		t.Fatalf("ParseWeights failed: %v", err)
+	}
+	want := map[Class]int{Interactive: 10, Bulk: DefaultWeights[Bulk], Background: 3}
+	if !reflect.DeepEqual(weights, want) {
+		t.Fatalf("ParseWeights returned %v, want %v", weights, want)
+	}
+
+	for _, bad := range []string{"interactive", "unknown=1", "bulk=0", "bulk=x"} {
+		if _, err := ParseWeights(bad); err == nil {
+			t.Errorf("ParseWeights(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestNewAdmitterValidates(t *testing.T) {
+	if _, err := NewAdmitter(0, DefaultWeights); err == nil {
+		t.Errorf("NewAdmitter with no slots succeeded")
+	}
+	if _, err := NewAdmitter(1, map[Class]int{Bulk: 0}); err == nil {
+		t.Errorf("NewAdmitter with a zero weight succeeded")
+	}
+}
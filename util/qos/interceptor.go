@@ -0,0 +1,48 @@
+package qos
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Classifier returns the class of requests to an RPC method, given its full
+// name such as "/trillian.TrillianLog/QueueLeaves".
+type Classifier func(method string) Class
+
+// MethodClasses returns a Classifier which looks up the class of each method in
+// classes, and uses def for the methods that aren't listed.
+func MethodClasses(classes map[string]Class, def Class) Classifier {
+	return func(method string) Class {
+		if c, ok := classes[method]; ok {
+			return c
+		}
+		return def
+	}
+}
+
+// UnaryInterceptor returns a UnaryServerInterceptor which waits for each request
+// to be admitted by a in the class given by classify, and holds its slot until
+// the handler returns.
+func UnaryInterceptor(a *Admitter, classify Classifier) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		release, err := a.Admit(ctx, classify(info.FullMethod))
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor returns a StreamServerInterceptor which admits streams in
+// the same way as UnaryInterceptor. The slot is held for the life of the stream.
+func StreamInterceptor(a *Admitter, classify Classifier) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		release, err := a.Admit(stream.Context(), classify(info.FullMethod))
+		if err != nil {
+			return err
+		}
+		defer release()
+		return handler(srv, stream)
+	}
+}
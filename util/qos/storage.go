@@ -0,0 +1,89 @@
+package qos
+
+import (
+	"github.com/google/trillian/monitoring/trace"
+	"github.com/google/trillian/storage"
+	"golang.org/x/net/context"
+)
+
+// LogStorageWrapper returns a LogStorageWrapper which admits each transaction in
+// class c, holding its slot until the transaction is committed or rolled back.
+// Wrapping the storage used for different kinds of work, such as sequencing and
+// serving RPCs, with the same Admitter shares the storage connections between
+// them by weight.
+//
+// Nothing may begin a transaction while holding another from the same
+// Admitter, as it could wait forever for a slot.
+func LogStorageWrapper(a *Admitter, c Class) storage.LogStorageWrapper {
+	return func(s storage.LogStorage) storage.LogStorage {
+		return &admittedLogStorage{LogStorage: s, admitter: a, class: c}
+	}
+}
+
+type admittedLogStorage struct {
+	storage.LogStorage
+	admitter *Admitter
+	class    Class
+}
+
+func (s *admittedLogStorage) Begin() (storage.LogTX, error) {
+	// Storage has no request context, so waits for a slot can't be cancelled
+	release, err := s.admitter.Admit(context.Background(), s.class)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.LogStorage.Begin()
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &admittedLogTX{LogTX: tx, release: release}, nil
+}
+
+func (s *admittedLogStorage) Snapshot() (storage.ReadOnlyLogTX, error) {
+	release, err := s.admitter.Admit(context.Background(), s.class)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.LogStorage.Snapshot()
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &admittedReadOnlyLogTX{ReadOnlyLogTX: tx, release: release}, nil
+}
+
+type admittedLogTX struct {
+	storage.LogTX
+	release func()
+}
+
+func (t *admittedLogTX) Commit() error {
+	defer t.release()
+	return t.LogTX.Commit()
+}
+
+func (t *admittedLogTX) Rollback() error {
+	defer t.release()
+	return t.LogTX.Rollback()
+}
+
+// SetSpan implements trace.SpanSetter, passing the span on to the transaction.
+func (t *admittedLogTX) SetSpan(s *trace.Span) {
+	trace.SetSpan(t.LogTX, s)
+}
+
+type admittedReadOnlyLogTX struct {
+	storage.ReadOnlyLogTX
+	release func()
+}
+
+func (t *admittedReadOnlyLogTX) Commit() error {
+	defer t.release()
+	return t.ReadOnlyLogTX.Commit()
+}
+
+// SetSpan implements trace.SpanSetter, passing the span on to the transaction.
+func (t *admittedReadOnlyLogTX) SetSpan(s *trace.Span) {
+	trace.SetSpan(t.ReadOnlyLogTX, s)
+}
@@ -0,0 +1,53 @@
+package qos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian/storage"
+	"golang.org/x/net/context"
+)
+
+func TestLogStorageWrapperHoldsSlotUntilCommit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+	mockStorage.EXPECT().Begin().Times(2).Return(mockTx, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+	mockTx.EXPECT().Rollback().Return(nil)
+
+	a, err := NewAdmitter(1, DefaultWeights)
+	if err != nil {
+		t.Fatalf("NewAdmitter failed: %v", err)
+	}
+	s := storage.WrapLogStorage(mockStorage, LogStorageWrapper(a, Background))
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := a.Admit(ctx, Interactive); err == nil {
+		t.Fatalf("Admit succeeded while the transaction was open")
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	tx, err = s.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed after commit: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	release, err := a.Admit(context.Background(), Interactive)
+	if err != nil {
+		t.Fatalf("Admit failed after rollback: %v", err)
+	}
+	release()
+}
@@ -0,0 +1,46 @@
+package witness
+
+import (
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Server serves the TrillianWitness API from a Witness.
+type Server struct {
+	w *Witness
+}
+
+// NewServer creates a Server for w.
+func NewServer(w *Witness) *Server {
+	return &Server{w: w}
+}
+
+// AddCheckpoint returns the witness's signature of the root in req, if it is
+// proven consistent with the root the witness has seen of the log.
+func (s *Server) AddCheckpoint(ctx context.Context, req *trillian.AddCheckpointRequest) (*trillian.AddCheckpointResponse, error) {
+	if req.Root == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "no root in request")
+	}
+	cosig, err := s.w.Update(req.LogId, *req.Root, req.FirstTreeSize, req.ConsistencyProof)
+	if err == ErrUnknownLog {
+		return nil, grpc.Errorf(codes.NotFound, "%v", err)
+	}
+	if _, ok := err.(WrongSizeError); ok {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return &trillian.AddCheckpointResponse{Cosignature: &cosig}, nil
+}
+
+// GetWitnessedRoot returns the latest root the witness has seen of a log.
+func (s *Server) GetWitnessedRoot(ctx context.Context, req *trillian.GetWitnessedRootRequest) (*trillian.GetWitnessedRootResponse, error) {
+	root, err := s.w.Root(req.LogId)
+	if err != nil {
+		return nil, grpc.Errorf(codes.NotFound, "%v", err)
+	}
+	return &trillian.GetWitnessedRootResponse{Root: &root}, nil
+}
@@ -0,0 +1,88 @@
+package witness
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+)
+
+// RootStore records the latest root the witness has seen of each log, so that
+// a restarted witness carries on checking the log against it.
+type RootStore interface {
+	// LastRoot returns the latest root seen of the log logID, or nil if none
+	// has been.
+	LastRoot(logID int64) (*trillian.SignedLogRoot, error)
+	// SetLastRoot records root as the latest root seen of the log logID.
+	SetLastRoot(logID int64, root trillian.SignedLogRoot) error
+}
+
+// FileRootStore is a RootStore which keeps the latest root of each log in a
+// file of its own.
+type FileRootStore struct {
+	dir string
+}
+
+// NewFileRootStore creates a FileRootStore keeping its files in dir, which
+// must already exist.
+func NewFileRootStore(dir string) (*FileRootStore, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &FileRootStore{dir: dir}, nil
+}
+
+func (f *FileRootStore) path(logID int64) string {
+	return filepath.Join(f.dir, fmt.Sprintf("%d.root", logID))
+}
+
+// LastRoot implements RootStore.
+func (f *FileRootStore) LastRoot(logID int64) (*trillian.SignedLogRoot, error) {
+	data, err := ioutil.ReadFile(f.path(logID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var root trillian.SignedLogRoot
+	if err := proto.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("corrupt root for log %d: %v", logID, err)
+	}
+	return &root, nil
+}
+
+// SetLastRoot implements RootStore. The file is replaced by a rename, so a
+// crash leaves either the old root or the new one.
+func (f *FileRootStore) SetLastRoot(logID int64, root trillian.SignedLogRoot) error {
+	data, err := proto.Marshal(&root)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(f.dir, "tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(logID))
+}
@@ -0,0 +1,270 @@
+// Package witness checks that logs stay consistent on behalf of their clients.
+// A witness keeps the latest root it has seen of each log it watches, and only
+// signs a new root once the log has proven it consistent with that one. Clients
+// that require roots to be cosigned by witnesses they trust know they are being
+// shown the same tree as everyone else who checks the witnesses, as a log can't
+// get a witness to sign two roots that fork from each other.
+package witness
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+)
+
+// ErrUnknownLog is returned for logs the witness doesn't watch.
+var ErrUnknownLog = errors.New("log is not watched by this witness")
+
+// WrongSizeError is returned when a root is proven consistent with a root of a
+// different size to the one the witness has seen. The proof must be fetched
+// again from Size.
+type WrongSizeError struct {
+	Size int64
+}
+
+func (e WrongSizeError) Error() string {
+	return fmt.Sprintf("consistency proof must be from the witnessed tree size %d", e.Size)
+}
+
+// watchedLog holds what the witness knows about a log.
+type watchedLog struct {
+	hasher   merkle.TreeHasher
+	verifier merkle.LogVerifier
+	keys     *crypto.KeySet
+	// root is the latest root seen, empty until one has been added
+	root trillian.SignedLogRoot
+	// loaded is set once root has been read from the witness's store
+	loaded bool
+}
+
+// Witness checks and cosigns the roots of the logs it watches. Unless it's
+// given a RootStore, the roots it has seen are only held in memory, so a
+// restarted witness trusts the first root it sees of each log. It is safe for
+// concurrent use.
+type Witness struct {
+	id     string
+	signer crypto.LogRootSigner
+	store  RootStore
+
+	// Must hold this lock before accessing logs
+	mu   sync.Mutex
+	logs map[int64]*watchedLog
+}
+
+// New creates a Witness named id, which signs the roots it has checked with
+// signer.
+func New(id string, signer crypto.LogRootSigner) *Witness {
+	return &Witness{id: id, signer: signer, logs: make(map[int64]*watchedLog)}
+}
+
+// ID returns the name of the witness, which its cosignatures are made under.
+func (w *Witness) ID() string {
+	return w.id
+}
+
+// SetRootStore makes the witness record the latest root it has seen of each log
+// in store, and start from the root recorded there. It must be called before
+// the witness is used.
+func (w *Witness) SetRootStore(store RootStore) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.store = store
+}
+
+// AddLog makes the witness watch the log logID, whose nodes are hashed with th
+// and roots are signed with the private key of publicKey.
+func (w *Witness) AddLog(logID int64, th merkle.TreeHasher, publicKey gocrypto.PublicKey) {
+	w.AddLogWithKeys(logID, th, crypto.NewKeySetForKey(publicKey))
+}
+
+// AddLogWithKeys makes the witness watch the log logID, whose nodes are hashed
+// with th and roots are signed with the key in keys active at their timestamp,
+// so that the log's key can be rotated.
+func (w *Witness) AddLogWithKeys(logID int64, th merkle.TreeHasher, keys *crypto.KeySet) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.logs[logID] = &watchedLog{hasher: th, verifier: merkle.NewLogVerifier(th), keys: keys}
+}
+
+// Root returns the latest root of the log logID seen by the witness, which is
+// empty if it hasn't seen one.
+func (w *Witness) Root(logID int64) (trillian.SignedLogRoot, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	l, err := w.watched(logID)
+	if err != nil {
+		return trillian.SignedLogRoot{}, err
+	}
+	return l.root, nil
+}
+
+// watched returns the log logID, with the latest root recorded in the store
+// the first time it's used. The caller must hold mu.
+func (w *Witness) watched(logID int64) (*watchedLog, error) {
+	l, ok := w.logs[logID]
+	if !ok {
+		return nil, ErrUnknownLog
+	}
+	if w.store != nil && !l.loaded {
+		root, err := w.store.LastRoot(logID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read witnessed root of log %d: %v", logID, err)
+		}
+		if root != nil {
+			l.root = *root
+		}
+		l.loaded = true
+	}
+	return l, nil
+}
+
+// setRoot makes root the latest root seen of the log l, recording it in the
+// store first. The caller must hold mu.
+func (w *Witness) setRoot(logID int64, l *watchedLog, root trillian.SignedLogRoot) error {
+	if w.store != nil {
+		if err := w.store.SetLastRoot(logID, root); err != nil {
+			return fmt.Errorf("failed to record witnessed root of log %d: %v", logID, err)
+		}
+	}
+	l.root = root
+	return nil
+}
+
+// SetRoot makes root the latest root the witness has seen of the log logID, if
+// it's signed by the log, so that the log's later roots are checked against it.
+// It can be used to start from a root witnessed by a previous run.
+func (w *Witness) SetRoot(logID int64, root trillian.SignedLogRoot) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	l, err := w.watched(logID)
+	if err != nil {
+		return err
+	}
+	if err := l.verifySignature(root); err != nil {
+		return err
+	}
+	return w.setRoot(logID, l, root)
+}
+
+func (l *watchedLog) verifySignature(root trillian.SignedLogRoot) error {
+	if root.Signature == nil {
+		return errors.New("log root is not signed")
+	}
+	if err := l.keys.VerifyLogRoot(l.hasher.Hasher, root); err != nil {
+		return fmt.Errorf("log root signature is invalid: %v", err)
+	}
+	return nil
+}
+
+// Update checks root is signed by the log logID and consistent with the latest
+// root the witness has seen, using proof from the tree size firstTreeSize, and
+// returns the witness's signature of it. The root becomes the latest seen if
+// it's newer. No proof is needed for the first root seen, or for a root of the
+// same size, which must have the same hash.
+func (w *Witness) Update(logID int64, root trillian.SignedLogRoot, firstTreeSize int64, proof [][]byte) (trillian.Cosignature, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	l, err := w.watched(logID)
+	if err != nil {
+		return trillian.Cosignature{}, err
+	}
+	if err := l.verifySignature(root); err != nil {
+		return trillian.Cosignature{}, err
+	}
+
+	current := l.root
+	switch {
+	case root.TreeSize < current.TreeSize:
+		return trillian.Cosignature{}, fmt.Errorf("log root has tree size %d, older than the witnessed tree size %d", root.TreeSize, current.TreeSize)
+	case root.TreeSize == current.TreeSize:
+		if current.Signature != nil && !bytes.Equal(root.RootHash, current.RootHash) {
+			glog.Errorf("Log %d has roots %x and %x for tree size %d", logID, current.RootHash, root.RootHash, root.TreeSize)
+			return trillian.Cosignature{}, fmt.Errorf("log root hash %x differs from the witnessed root hash %x", root.RootHash, current.RootHash)
+		}
+	case current.TreeSize > 0:
+		if firstTreeSize != current.TreeSize {
+			return trillian.Cosignature{}, WrongSizeError{Size: current.TreeSize}
+		}
+		hashes := make([]trillian.Hash, 0, len(proof))
+		for _, h := range proof {
+			hashes = append(hashes, h)
+		}
+		if err := l.verifier.VerifyConsistencyProof(current.TreeSize, root.TreeSize, current.RootHash, root.RootHash, hashes); err != nil {
+			glog.Errorf("Log %d root at tree size %d isn't consistent with tree size %d: %v", logID, root.TreeSize, current.TreeSize, err)
+			return trillian.Cosignature{}, fmt.Errorf("consistency proof from tree size %d to %d is invalid: %v", current.TreeSize, root.TreeSize, err)
+		}
+	}
+
+	sig, err := w.signer.SignLogRoot(root)
+	if err != nil {
+		return trillian.Cosignature{}, err
+	}
+	if root.TreeSize > current.TreeSize || root.TimestampNanos > current.TimestampNanos {
+		// The log's cosignatures aren't part of what was witnessed. The root
+		// is recorded before the signature is released, or a restart could
+		// let an inconsistent root be signed
+		root.Cosignatures = nil
+		if err := w.setRoot(logID, l, root); err != nil {
+			return trillian.Cosignature{}, err
+		}
+	}
+	return trillian.Cosignature{WitnessId: w.id, Signature: &sig}, nil
+}
+
+// Follow has the witness check the latest root of the log logID, fetched from
+// client along with any proof needed, and stores the witness's signature of it
+// with the log. It returns the root that was cosigned.
+func (w *Witness) Follow(ctx context.Context, client trillian.TrillianLogClient, logID int64) (trillian.SignedLogRoot, error) {
+	current, err := w.Root(logID)
+	if err != nil {
+		return trillian.SignedLogRoot{}, err
+	}
+	rootResp, err := client.GetLatestSignedLogRoot(ctx, &trillian.GetLatestSignedLogRootRequest{LogId: logID})
+	if err != nil {
+		return trillian.SignedLogRoot{}, fmt.Errorf("failed to get root of log %d: %v", logID, err)
+	}
+	if rootResp.SignedLogRoot == nil {
+		return trillian.SignedLogRoot{}, fmt.Errorf("log %d returned no root", logID)
+	}
+	root := *rootResp.SignedLogRoot
+
+	var proof [][]byte
+	if current.TreeSize > 0 && root.TreeSize > current.TreeSize {
+		req := &trillian.GetConsistencyProofRequest{LogId: logID, FirstTreeSize: current.TreeSize, SecondTreeSize: root.TreeSize}
+		resp, err := client.GetConsistencyProof(ctx, req)
+		if err != nil {
+			return trillian.SignedLogRoot{}, fmt.Errorf("failed to get consistency proof of log %d from tree size %d to %d: %v", logID, current.TreeSize, root.TreeSize, err)
+		}
+		if resp.Proof != nil {
+			for _, node := range resp.Proof.ProofNode {
+				proof = append(proof, node.NodeHash)
+			}
+		}
+	}
+
+	cosig, err := w.Update(logID, root, current.TreeSize, proof)
+	if err != nil {
+		return trillian.SignedLogRoot{}, err
+	}
+	if _, err := client.AddLogRootCosignature(ctx, &trillian.AddLogRootCosignatureRequest{LogId: logID, Root: &root, Cosignature: &cosig}); err != nil {
+		return trillian.SignedLogRoot{}, fmt.Errorf("failed to store cosignature with log %d: %v", logID, err)
+	}
+	return root, nil
+}
+
+// VerifyCosignature checks that cosig is a signature of root, made by a witness
+// with the private key corresponding to pub.
+func VerifyCosignature(pub gocrypto.PublicKey, hasher trillian.Hasher, root trillian.SignedLogRoot, cosig trillian.Cosignature) error {
+	if cosig.Signature == nil {
+		return errors.New("cosignature has no signature")
+	}
+	return crypto.VerifyLogRoot(pub, hasher, root, *cosig.Signature)
+}
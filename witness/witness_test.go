@@ -0,0 +1,268 @@
+package witness
+
+import (
+	gocrypto "crypto"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const testLogID = int64(3)
+
+// testLog is a log held in memory, whose roots are signed by its own key.
+type testLog struct {
+	t      *testing.T
+	tree   *merkle.InMemoryMerkleTree
+	signer *crypto.TrillianSigner
+}
+
+func newTestLog(t *testing.T, th merkle.TreeHasher) (*testLog, gocrypto.PublicKey) {
+	key, err := crypto.GenerateKey(trillian.SignatureAlgorithm_ECDSA)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	return &testLog{t: t, tree: merkle.NewInMemoryMerkleTree(th), signer: crypto.NewTrillianSigner(th.Hasher, trillian.SignatureAlgorithm_ECDSA, key)}, key.Public()
+}
+
+// grow adds n leaves to the log.
+func (l *testLog) grow(n int) {
+	for i := 0; i < n; i++ {
+		l.tree.AddLeaf([]byte(fmt.Sprintf("leaf %d", l.tree.LeafCount())))
+	}
+}
+
+// sign returns a root of the log with rootHash signed by the log's key.
+func (l *testLog) sign(treeSize int64, rootHash []byte) trillian.SignedLogRoot {
+	root := trillian.SignedLogRoot{TimestampNanos: treeSize * 1000, TreeSize: treeSize, RootHash: rootHash}
+	sig, err := l.signer.SignLogRoot(root)
+	if err != nil {
+		l.t.Fatalf("SignLogRoot failed: %v", err)
+	}
+	root.Signature = &sig
+	return root
+}
+
+// root returns the log's current signed root.
+func (l *testLog) root() trillian.SignedLogRoot {
+	return l.sign(int64(l.tree.LeafCount()), l.tree.CurrentRoot().Hash())
+}
+
+// proof returns the consistency proof of the log between two tree sizes.
+func (l *testLog) proof(first, second int64) [][]byte {
+	var proof [][]byte
+	for _, entry := range l.tree.SnapshotConsistency(int(first), int(second)) {
+		proof = append(proof, entry.Value.Hash())
+	}
+	return proof
+}
+
+func newTestWitness(t *testing.T) (*Witness, gocrypto.PublicKey) {
+	key, err := crypto.GenerateKey(trillian.SignatureAlgorithm_ECDSA)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	return New("test-witness", crypto.NewTrillianSigner(trillian.NewSHA256(), trillian.SignatureAlgorithm_ECDSA, key)), key.Public()
+}
+
+func TestWitnessUpdate(t *testing.T) {
+	th := merkle.NewRFC6962TreeHasher(trillian.NewSHA256())
+	log, logKey := newTestLog(t, th)
+	w, witnessKey := newTestWitness(t)
+
+	if _, err := w.Update(testLogID, log.root(), 0, nil); err != ErrUnknownLog {
+		t.Fatalf("Update() of an unwatched log = %v, want ErrUnknownLog", err)
+	}
+	w.AddLog(testLogID, th, logKey)
+
+	// The first root seen is trusted without a proof
+	log.grow(3)
+	first := log.root()
+	cosig, err := w.Update(testLogID, first, 0, nil)
+	if err != nil {
+		t.Fatalf("Update() of the first root failed: %v", err)
+	}
+	if cosig.WitnessId != "test-witness" {
+		t.Errorf("Cosignature has witness ID %q, want %q", cosig.WitnessId, "test-witness")
+	}
+	if err := VerifyCosignature(witnessKey, trillian.NewSHA256(), first, cosig); err != nil {
+		t.Errorf("Cosignature of the first root doesn't verify: %v", err)
+	}
+
+	log.grow(4)
+	second := log.root()
+	for _, test := range []struct {
+		desc  string
+		root  trillian.SignedLogRoot
+		first int64
+		proof [][]byte
+	}{
+		{desc: "unsigned root", root: trillian.SignedLogRoot{TreeSize: 7, RootHash: second.RootHash}, first: 3, proof: log.proof(3, 7)},
+		{desc: "root signed by another key", root: func() trillian.SignedLogRoot {
+			other, _ := newTestLog(t, th)
+			return other.sign(7, second.RootHash)
+		}(), first: 3, proof: log.proof(3, 7)},
+		{desc: "older root", root: log.sign(2, []byte("older")), first: 3},
+		{desc: "forked root", root: log.sign(3, []byte("forked")), first: 3},
+		{desc: "no proof", root: second, first: 3},
+		{desc: "wrong proof", root: second, first: 3, proof: log.proof(4, 7)},
+	} {
+		if _, err := w.Update(testLogID, test.root, test.first, test.proof); err == nil {
+			t.Errorf("%s: Update() succeeded, want an error", test.desc)
+		}
+	}
+	if _, err := w.Update(testLogID, second, 4, log.proof(4, 7)); err != (WrongSizeError{Size: 3}) {
+		t.Errorf("Update() with a proof from the wrong size = %v, want %v", err, WrongSizeError{Size: 3})
+	}
+	if root, err := w.Root(testLogID); err != nil || root.TreeSize != 3 {
+		t.Fatalf("Root() = %v, %v, want the first root after failed updates", root, err)
+	}
+
+	cosig, err = w.Update(testLogID, second, 3, log.proof(3, 7))
+	if err != nil {
+		t.Fatalf("Update() of a consistent root failed: %v", err)
+	}
+	if err := VerifyCosignature(witnessKey, trillian.NewSHA256(), second, cosig); err != nil {
+		t.Errorf("Cosignature of the second root doesn't verify: %v", err)
+	}
+	if root, err := w.Root(testLogID); err != nil || root.TreeSize != 7 {
+		t.Errorf("Root() = %v, %v, want the second root", root, err)
+	}
+
+	// A root the witness has already seen can be cosigned again
+	if _, err := w.Update(testLogID, second, 7, nil); err != nil {
+		t.Errorf("Update() of the witnessed root failed: %v", err)
+	}
+}
+
+func TestWitnessRootStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "witness")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewFileRootStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileRootStore failed: %v", err)
+	}
+
+	th := merkle.NewRFC6962TreeHasher(trillian.NewSHA256())
+	log, logKey := newTestLog(t, th)
+	w, _ := newTestWitness(t)
+	w.SetRootStore(store)
+	w.AddLog(testLogID, th, logKey)
+
+	log.grow(3)
+	if _, err := w.Update(testLogID, log.root(), 0, nil); err != nil {
+		t.Fatalf("Update() of the first root failed: %v", err)
+	}
+
+	// A new witness using the same store carries on from the root seen, so
+	// doesn't trust a root that forks from it
+	w, _ = newTestWitness(t)
+	w.SetRootStore(store)
+	w.AddLog(testLogID, th, logKey)
+	if root, err := w.Root(testLogID); err != nil || root.TreeSize != 3 {
+		t.Fatalf("Root() after restart = %v, %v, want the root of tree size 3", root, err)
+	}
+	if _, err := w.Update(testLogID, log.sign(3, []byte("forked")), 3, nil); err == nil {
+		t.Error("Update() of a forked root after restart succeeded, want an error")
+	}
+	log.grow(2)
+	if _, err := w.Update(testLogID, log.root(), 3, log.proof(3, 5)); err != nil {
+		t.Errorf("Update() of a consistent root after restart failed: %v", err)
+	}
+	if root, err := store.LastRoot(testLogID); err != nil || root == nil || root.TreeSize != 5 {
+		t.Errorf("LastRoot() = %v, %v, want the root of tree size 5", root, err)
+	}
+}
+
+func TestWitnessFollow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	th := merkle.NewRFC6962TreeHasher(trillian.NewSHA256())
+	log, logKey := newTestLog(t, th)
+	w, witnessKey := newTestWitness(t)
+	w.AddLog(testLogID, th, logKey)
+	client := trillian.NewMockTrillianLogClient(ctrl)
+
+	log.grow(2)
+	first := log.root()
+	if err := w.SetRoot(testLogID, first); err != nil {
+		t.Fatalf("SetRoot() failed: %v", err)
+	}
+
+	log.grow(3)
+	second := log.root()
+	client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), &trillian.GetLatestSignedLogRootRequest{LogId: testLogID}).Return(
+		&trillian.GetLatestSignedLogRootResponse{SignedLogRoot: &second}, nil)
+	proof := &trillian.ProofProto{}
+	for _, h := range log.proof(2, 5) {
+		proof.ProofNode = append(proof.ProofNode, &trillian.NodeProto{NodeHash: h})
+	}
+	client.EXPECT().GetConsistencyProof(gomock.Any(), &trillian.GetConsistencyProofRequest{LogId: testLogID, FirstTreeSize: 2, SecondTreeSize: 5}).Return(
+		&trillian.GetConsistencyProofResponse{Proof: proof}, nil)
+	var stored *trillian.AddLogRootCosignatureRequest
+	client.EXPECT().AddLogRootCosignature(gomock.Any(), gomock.Any()).Do(func(ctx context.Context, req *trillian.AddLogRootCosignatureRequest, opts ...grpc.CallOption) {
+		stored = req
+	}).Return(&trillian.AddLogRootCosignatureResponse{}, nil)
+
+	root, err := w.Follow(context.Background(), client, testLogID)
+	if err != nil {
+		t.Fatalf("Follow() failed: %v", err)
+	}
+	if root.TreeSize != 5 {
+		t.Errorf("Follow() cosigned tree size %d, want 5", root.TreeSize)
+	}
+	if stored == nil || stored.LogId != testLogID || stored.Root.TreeSize != 5 {
+		t.Fatalf("Follow() stored cosignature %v, want one of tree size 5 of log %d", stored, testLogID)
+	}
+	if err := VerifyCosignature(witnessKey, trillian.NewSHA256(), second, *stored.Cosignature); err != nil {
+		t.Errorf("Stored cosignature doesn't verify: %v", err)
+	}
+}
+
+func TestServerAddCheckpoint(t *testing.T) {
+	th := merkle.NewRFC6962TreeHasher(trillian.NewSHA256())
+	log, logKey := newTestLog(t, th)
+	w, _ := newTestWitness(t)
+	w.AddLog(testLogID, th, logKey)
+	s := NewServer(w)
+	ctx := context.Background()
+
+	log.grow(2)
+	first := log.root()
+	if _, err := s.AddCheckpoint(ctx, &trillian.AddCheckpointRequest{LogId: testLogID, Root: &first}); err != nil {
+		t.Fatalf("AddCheckpoint() failed: %v", err)
+	}
+	resp, err := s.GetWitnessedRoot(ctx, &trillian.GetWitnessedRootRequest{LogId: testLogID})
+	if err != nil || resp.Root.TreeSize != 2 {
+		t.Fatalf("GetWitnessedRoot() = %v, %v, want the root of tree size 2", resp, err)
+	}
+
+	log.grow(2)
+	second := log.root()
+	for _, test := range []struct {
+		req  *trillian.AddCheckpointRequest
+		want codes.Code
+	}{
+		{req: &trillian.AddCheckpointRequest{LogId: testLogID}, want: codes.InvalidArgument},
+		{req: &trillian.AddCheckpointRequest{LogId: testLogID + 1, Root: &second}, want: codes.NotFound},
+		{req: &trillian.AddCheckpointRequest{LogId: testLogID, Root: &second, FirstTreeSize: 3, ConsistencyProof: log.proof(3, 4)}, want: codes.FailedPrecondition},
+		{req: &trillian.AddCheckpointRequest{LogId: testLogID, Root: &second, FirstTreeSize: 2}, want: codes.InvalidArgument},
+		{req: &trillian.AddCheckpointRequest{LogId: testLogID, Root: &second, FirstTreeSize: 2, ConsistencyProof: log.proof(2, 4)}, want: codes.OK},
+	} {
+		if _, err := s.AddCheckpoint(ctx, test.req); grpc.Code(err) != test.want {
+			t.Errorf("AddCheckpoint(%v) = %v, want code %v", test.req, err, test.want)
+		}
+	}
+}